@@ -5,44 +5,47 @@ import (
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/utreexo/utreexod/wire"
 )
 
-// randAddr generates a *wire.NetAddress backed by a random IPv4/IPv6 address.
-// Some of the returned addresses may not be routable.
-func randAddr(t *testing.T) *wire.NetAddress {
+// randAddr generates a *wire.NetAddressV2 backed by a random IPv4/IPv6, torv3
+// or i2p address.  Some of the returned addresses may not be routable.
+func randAddr(t *testing.T) *wire.NetAddressV2 {
 	t.Helper()
 
-	ipv4 := rand.Intn(2) == 0
-	var ip net.IP
-	if ipv4 {
-		var b [4]byte
-		if _, err := rand.Read(b[:]); err != nil {
+	services := wire.ServiceFlag(rand.Uint64())
+	port := uint16(rand.Uint32())
+
+	var b []byte
+	switch rand.Intn(4) {
+	case 0:
+		b = make([]byte, 4)
+	case 1:
+		b = make([]byte, 16)
+	case 2:
+		b = make([]byte, wire.TorV3Size)
+	case 3:
+		var hash [wire.I2PSize]byte
+		if _, err := rand.Read(hash[:]); err != nil {
 			t.Fatal(err)
 		}
-		ip = b[:]
-	} else {
-		var b [16]byte
-		if _, err := rand.Read(b[:]); err != nil {
-			t.Fatal(err)
-		}
-		ip = b[:]
+		return wire.NewNetAddressV2I2P(time.Now(), services, hash, port)
 	}
-
-	return &wire.NetAddress{
-		Services: wire.ServiceFlag(rand.Uint64()),
-		IP:       ip,
-		Port:     uint16(rand.Uint32()),
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
 	}
+
+	return wire.NetAddressV2FromBytes(time.Now(), services, net.IP(b), port)
 }
 
-// routableRandAddr generates a *wire.NetAddress backed by a random IPv4/IPv6 address
+// routableRandAddr generates a *wire.NetAddressV2 backed by a random address
 // that is always routable.
-func routableRandAddr(t *testing.T) *wire.NetAddress {
+func routableRandAddr(t *testing.T) *wire.NetAddressV2 {
 	t.Helper()
 
-	var addr *wire.NetAddress
+	var addr *wire.NetAddressV2
 
 	// If the address is not routable, try again.
 	routable := false
@@ -56,13 +59,15 @@ func routableRandAddr(t *testing.T) *wire.NetAddress {
 
 // assertAddr ensures that the two addresses match. The timestamp is not
 // checked as it does not affect uniquely identifying a specific address.
-func assertAddr(t *testing.T, got, expected *wire.NetAddress) {
+func assertAddr(t *testing.T, got, expected *wire.NetAddressV2) {
 	if got.Services != expected.Services {
 		t.Fatalf("expected address services %v, got %v",
 			expected.Services, got.Services)
 	}
-	if !got.IP.Equal(expected.IP) {
-		t.Fatalf("expected address IP %v, got %v", expected.IP, got.IP)
+	gotAddr := got.Addr.String()
+	expectedAddr := expected.Addr.String()
+	if gotAddr != expectedAddr {
+		t.Fatalf("expected address %v, got %v", expectedAddr, gotAddr)
 	}
 	if got.Port != expected.Port {
 		t.Fatalf("expected address port %d, got %d", expected.Port,
@@ -73,7 +78,7 @@ func assertAddr(t *testing.T, got, expected *wire.NetAddress) {
 // assertAddrs ensures that the manager's address cache matches the given
 // expected addresses.
 func assertAddrs(t *testing.T, addrMgr *AddrManager,
-	expectedAddrs map[string]*wire.NetAddress) {
+	expectedAddrs map[string]*wire.NetAddressV2) {
 
 	t.Helper()
 
@@ -113,7 +118,7 @@ func TestAddrManagerSerialization(t *testing.T) {
 	// We'll be adding 5 random addresses to the manager.
 	const numAddrs = 5
 
-	expectedAddrs := make(map[string]*wire.NetAddress, numAddrs)
+	expectedAddrs := make(map[string]*wire.NetAddressV2, numAddrs)
 	for i := 0; i < numAddrs; i++ {
 		addr := routableRandAddr(t)
 		expectedAddrs[NetAddressKey(addr)] = addr
@@ -158,7 +163,7 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	// each addresses' services will not be stored.
 	const numAddrs = 5
 
-	expectedAddrs := make(map[string]*wire.NetAddress, numAddrs)
+	expectedAddrs := make(map[string]*wire.NetAddressV2, numAddrs)
 	for i := 0; i < numAddrs; i++ {
 		addr := routableRandAddr(t)
 		expectedAddrs[NetAddressKey(addr)] = addr
@@ -32,7 +32,7 @@ func (*BDKWalletFactory) Create(dbPath string, chainParams *chaincfg.Params) (Wa
 	switch network {
 	case "mainnet":
 		network = "bitcoin"
-	case "testnet3":
+	case "testnet3", "testnet4":
 		network = "testnet"
 	}
 
@@ -0,0 +1,429 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// bootstrapVersion is the version of the serialized bootstrap package.
+	bootstrapVersion = 1
+
+	// maxBootstrapSectionSize is the largest section of a bootstrap package
+	// that's read.  It's well above the size of the headers of mainnet.
+	maxBootstrapSectionSize = 1 << 30
+
+	// MaxBootstrapProofs is the most proofs that a bootstrap package holds.
+	MaxBootstrapProofs = 1000
+)
+
+// bootstrapMagic is the start of every serialized bootstrap package.
+var bootstrapMagic = [4]byte{'u', 't', 'b', 's'}
+
+// BootstrapPackage is what a compact state node needs to start at a block
+// instead of at the genesis block: the headers up to the block, the roots of the
+// accumulator after the block and optionally the proofs of the blocks up to it.
+//
+// The serialized package is made of a prefix, three sections and a checksum:
+//
+//	Field          Type            Size
+//	magic          [4]byte         4
+//	version        uint32          4
+//	genesis hash   chainhash.Hash  32
+//	headers        section         variable
+//	roots          section         variable
+//	proofs         section         variable
+//	checksum       [32]byte        32
+//
+// Every section is its uint64 length followed by the data and the sha256 of the
+// data.  The headers section is the uint32 number of headers and the headers of
+// the blocks from height 1.  The roots section is the hash of the last header
+// and the serialized roots.  The proofs section is the uint32 number of proofs
+// and, for every proof, the hash of its block followed by the uint32 length of
+// the serialized proof and the proof.  The proofs are of the last blocks of the
+// headers.  The checksum is the sha256 of everything before it.
+type BootstrapPackage struct {
+	// GenesisHash is the hash of the genesis block of the network.
+	GenesisHash chainhash.Hash
+
+	// Headers are the headers from height 1 to the block the package is at.
+	Headers []wire.BlockHeader
+
+	// NumLeaves and Roots are the accumulator after the last header.
+	NumLeaves uint64
+	Roots     []utreexo.Hash
+
+	// Proofs are the proofs of the last len(Proofs) blocks, the last of
+	// which is the proof of the block the package is at.  The leaf datas
+	// are in the compact form.
+	Proofs []*wire.UData
+}
+
+// Height returns the height of the block that the package is at.
+func (bp *BootstrapPackage) Height() int32 {
+	return int32(len(bp.Headers))
+}
+
+// BlockHash returns the hash of the block that the package is at.
+func (bp *BootstrapPackage) BlockHash() chainhash.Hash {
+	if len(bp.Headers) == 0 {
+		return bp.GenesisHash
+	}
+
+	return bp.Headers[len(bp.Headers)-1].BlockHash()
+}
+
+// RootsHash returns the hash of the roots of the package.  It's what
+// --assumeutreexo takes to start at the block of the package.
+func (bp *BootstrapPackage) RootsHash() chainhash.Hash {
+	return UtreexoRootsHash(bp.NumLeaves, bp.Roots)
+}
+
+// proofBlockHash returns the hash of the block of the proof at the given index.
+func (bp *BootstrapPackage) proofBlockHash(i int) chainhash.Hash {
+	return bp.Headers[len(bp.Headers)-len(bp.Proofs)+i].BlockHash()
+}
+
+// checkCommitments returns an error if the parts of the package don't fit
+// together.
+func (bp *BootstrapPackage) checkCommitments() error {
+	if len(bp.Proofs) > MaxBootstrapProofs {
+		return fmt.Errorf("%d proofs is more than the max of %d",
+			len(bp.Proofs), MaxBootstrapProofs)
+	}
+	if len(bp.Proofs) > len(bp.Headers) {
+		return fmt.Errorf("%d proofs for %d headers", len(bp.Proofs),
+			len(bp.Headers))
+	}
+	if bits.OnesCount64(bp.NumLeaves) != len(bp.Roots) {
+		return fmt.Errorf("%d roots for %d leaves", len(bp.Roots),
+			bp.NumLeaves)
+	}
+
+	return nil
+}
+
+// writeBootstrapSection writes the data as a section of a bootstrap package.
+func writeBootstrapSection(w io.Writer, data []byte) error {
+	var buf [8]byte
+	byteOrder.PutUint64(buf[:], uint64(len(data)))
+	_, err := w.Write(buf[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(data)
+	_, err = w.Write(checksum[:])
+	return err
+}
+
+// readBootstrapSection reads a section of a bootstrap package and returns its
+// data after checking its checksum.
+func readBootstrapSection(r io.Reader, name string) ([]byte, error) {
+	var buf [8]byte
+	_, err := io.ReadFull(r, buf[:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the %s section: %v", name, err)
+	}
+	size := byteOrder.Uint64(buf[:])
+	if size > maxBootstrapSectionSize {
+		return nil, fmt.Errorf("the %s section is %d bytes which is more "+
+			"than the max of %d", name, size, maxBootstrapSectionSize)
+	}
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the %s section: %v", name, err)
+	}
+	var checksum [sha256.Size]byte
+	_, err = io.ReadFull(r, checksum[:])
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the %s section: %v", name, err)
+	}
+	if sha256.Sum256(data) != checksum {
+		return nil, fmt.Errorf("the checksum of the %s section doesn't match",
+			name)
+	}
+
+	return data, nil
+}
+
+// Serialize writes the package to w in the format described on
+// BootstrapPackage.
+func (bp *BootstrapPackage) Serialize(w io.Writer) error {
+	err := bp.checkCommitments()
+	if err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	mw := io.MultiWriter(w, hasher)
+
+	var buf [4]byte
+	byteOrder.PutUint32(buf[:], bootstrapVersion)
+	for _, field := range [][]byte{bootstrapMagic[:], buf[:], bp.GenesisHash[:]} {
+		_, err = mw.Write(field)
+		if err != nil {
+			return err
+		}
+	}
+
+	var headers bytes.Buffer
+	headers.Grow(4 + len(bp.Headers)*blockHdrSize)
+	byteOrder.PutUint32(buf[:], uint32(len(bp.Headers)))
+	headers.Write(buf[:])
+	for i := range bp.Headers {
+		err = bp.Headers[i].Serialize(&headers)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeBootstrapSection(mw, headers.Bytes())
+	if err != nil {
+		return err
+	}
+
+	serializedRoots, err := SerializeUtreexoRoots(bp.NumLeaves, bp.Roots)
+	if err != nil {
+		return err
+	}
+	blockHash := bp.BlockHash()
+	err = writeBootstrapSection(mw, append(blockHash[:], serializedRoots...))
+	if err != nil {
+		return err
+	}
+
+	var proofs bytes.Buffer
+	byteOrder.PutUint32(buf[:], uint32(len(bp.Proofs)))
+	proofs.Write(buf[:])
+	for i, ud := range bp.Proofs {
+		blockHash := bp.proofBlockHash(i)
+		proofs.Write(blockHash[:])
+		byteOrder.PutUint32(buf[:], uint32(ud.SerializeSize()))
+		proofs.Write(buf[:])
+		err = ud.Serialize(&proofs)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeBootstrapSection(mw, proofs.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(hasher.Sum(nil))
+	return err
+}
+
+// Deserialize reads a package in the format described on BootstrapPackage from
+// r.  An error is returned if a checksum doesn't match or if the roots and the
+// proofs aren't for the blocks of the headers.
+func (bp *BootstrapPackage) Deserialize(r io.Reader) error {
+	hasher := sha256.New()
+	tr := io.TeeReader(r, hasher)
+
+	var magic [4]byte
+	_, err := io.ReadFull(tr, magic[:])
+	if err != nil {
+		return err
+	}
+	if magic != bootstrapMagic {
+		return fmt.Errorf("not a bootstrap package")
+	}
+	var buf [4]byte
+	_, err = io.ReadFull(tr, buf[:])
+	if err != nil {
+		return err
+	}
+	if version := byteOrder.Uint32(buf[:]); version != bootstrapVersion {
+		return fmt.Errorf("unknown bootstrap package version %d", version)
+	}
+	_, err = io.ReadFull(tr, bp.GenesisHash[:])
+	if err != nil {
+		return err
+	}
+
+	headers, err := readBootstrapSection(tr, "headers")
+	if err != nil {
+		return err
+	}
+	roots, err := readBootstrapSection(tr, "roots")
+	if err != nil {
+		return err
+	}
+	proofs, err := readBootstrapSection(tr, "proofs")
+	if err != nil {
+		return err
+	}
+
+	sum := hasher.Sum(nil)
+	var checksum [sha256.Size]byte
+	_, err = io.ReadFull(r, checksum[:])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, checksum[:]) {
+		return fmt.Errorf("the checksum of the bootstrap package doesn't match")
+	}
+
+	err = bp.deserializeHeaders(headers)
+	if err != nil {
+		return err
+	}
+	err = bp.deserializeRoots(roots)
+	if err != nil {
+		return err
+	}
+	err = bp.deserializeProofs(proofs)
+	if err != nil {
+		return err
+	}
+
+	return bp.checkCommitments()
+}
+
+// deserializeHeaders reads the headers section of a bootstrap package.
+func (bp *BootstrapPackage) deserializeHeaders(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("the headers section is too short")
+	}
+	count := byteOrder.Uint32(data)
+	if uint64(len(data)-4) != uint64(count)*blockHdrSize {
+		return fmt.Errorf("the headers section is %d bytes for %d headers",
+			len(data), count)
+	}
+
+	r := bytes.NewReader(data[4:])
+	bp.Headers = make([]wire.BlockHeader, count)
+	for i := range bp.Headers {
+		err := bp.Headers[i].Deserialize(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deserializeRoots reads the roots section of a bootstrap package.  The roots
+// have to be for the block of the last header.
+func (bp *BootstrapPackage) deserializeRoots(data []byte) error {
+	if len(data) < chainhash.HashSize+8 ||
+		(len(data)-chainhash.HashSize-8)%chainhash.HashSize != 0 {
+
+		return fmt.Errorf("the roots section is %d bytes", len(data))
+	}
+
+	var blockHash chainhash.Hash
+	copy(blockHash[:], data)
+	if blockHash != bp.BlockHash() {
+		return fmt.Errorf("the roots are for block %v instead of block %v "+
+			"of the last header", blockHash, bp.BlockHash())
+	}
+
+	numLeaves, roots, err := DeserializeUtreexoRoots(data[chainhash.HashSize:])
+	if err != nil {
+		return err
+	}
+	bp.NumLeaves, bp.Roots = numLeaves, roots
+
+	return nil
+}
+
+// deserializeProofs reads the proofs section of a bootstrap package.  The
+// proofs have to be for the blocks of the last headers.
+func (bp *BootstrapPackage) deserializeProofs(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("the proofs section is too short")
+	}
+	count := byteOrder.Uint32(data)
+	if count > MaxBootstrapProofs || int(count) > len(bp.Headers) {
+		return fmt.Errorf("%d proofs for %d headers", count, len(bp.Headers))
+	}
+
+	r := bytes.NewReader(data[4:])
+	bp.Proofs = make([]*wire.UData, count)
+	for i := range bp.Proofs {
+		var blockHash chainhash.Hash
+		var buf [4]byte
+		_, err := io.ReadFull(r, blockHash[:])
+		if err == nil {
+			_, err = io.ReadFull(r, buf[:])
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read proof %d: %v", i, err)
+		}
+		size := byteOrder.Uint32(buf[:])
+		if int64(size) > int64(r.Len()) {
+			return fmt.Errorf("proof %d is %d bytes which is past the "+
+				"end of the proofs section", i, size)
+		}
+		proofBytes := make([]byte, size)
+		_, err = io.ReadFull(r, proofBytes)
+		if err != nil {
+			return err
+		}
+
+		if want := bp.proofBlockHash(i); blockHash != want {
+			return fmt.Errorf("proof %d is for block %v instead of "+
+				"block %v", i, blockHash, want)
+		}
+
+		ud := new(wire.UData)
+		err = ud.Deserialize(bytes.NewReader(proofBytes))
+		if err != nil {
+			return fmt.Errorf("unable to deserialize proof %d: %v", i, err)
+		}
+		bp.Proofs[i] = ud
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d bytes left over in the proofs section", r.Len())
+	}
+
+	return nil
+}
+
+// Verify checks that the package is for the given network and that its headers
+// connect to the genesis block and have enough proof of work.  It doesn't check
+// the difficulty adjustments of the headers so the hash of the block or the
+// roots of the package should still be compared with a trusted source before
+// the package is used.
+func (bp *BootstrapPackage) Verify(params *chaincfg.Params) error {
+	if bp.GenesisHash != *params.GenesisHash {
+		return fmt.Errorf("the bootstrap package is for the network with "+
+			"genesis block %v instead of %v", bp.GenesisHash,
+			params.GenesisHash)
+	}
+
+	prevHash := *params.GenesisHash
+	for i := range bp.Headers {
+		header := &bp.Headers[i]
+		if header.PrevBlock != prevHash {
+			return fmt.Errorf("the header at height %d doesn't connect "+
+				"to the header before it", i+1)
+		}
+		err := checkProofOfWork(header, params.PowLimit, BFNone)
+		if err != nil {
+			return fmt.Errorf("the header at height %d: %v", i+1, err)
+		}
+		prevHash = header.BlockHash()
+	}
+
+	return bp.checkCommitments()
+}
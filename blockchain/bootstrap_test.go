@@ -0,0 +1,128 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/blockchain/chainbuilder"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// serializeBootstrap returns the serialized package.
+func serializeBootstrap(t *testing.T, bp *blockchain.BootstrapPackage) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := bp.Serialize(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBootstrapPackage(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 2
+
+	// Build blocks that spend coinbases so that the proofs aren't empty.
+	b := chainbuilder.New(&params, nil)
+	for height := int32(1); height <= 10; height++ {
+		var txns []*wire.MsgTx
+		if height > int32(params.CoinbaseMaturity) {
+			coinbase := b.Blocks()[height-int32(params.CoinbaseMaturity)-1].
+				Block.MsgBlock().Transactions[0]
+			tx := wire.NewMsgTx(1)
+			tx.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash()},
+				Sequence:         wire.MaxTxInSequenceNum,
+			})
+			tx.AddTxOut(wire.NewTxOut(coinbase.TxOut[0].Value-1000,
+				coinbase.TxOut[0].PkScript))
+			txns = append(txns, tx)
+		}
+		_, err := b.NextBlock(txns)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stump := b.Stump()
+	bp := &blockchain.BootstrapPackage{
+		GenesisHash: *params.GenesisHash,
+		NumLeaves:   stump.NumLeaves,
+		Roots:       stump.Roots,
+	}
+	for _, block := range b.Blocks() {
+		bp.Headers = append(bp.Headers, block.Block.MsgBlock().Header)
+	}
+	for _, block := range b.Blocks()[7:] {
+		bp.Proofs = append(bp.Proofs, block.UData)
+	}
+
+	serialized := serializeBootstrap(t, bp)
+	var got blockchain.BootstrapPackage
+	err := got.Deserialize(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = got.Verify(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Height() != 10 || got.BlockHash() != *b.Tip().Hash() {
+		t.Fatalf("expected the package to be at block %v at height 10, "+
+			"got %v at height %d", b.Tip().Hash(), got.BlockHash(),
+			got.Height())
+	}
+	if got.RootsHash() != blockchain.UtreexoRootsHash(stump.NumLeaves, stump.Roots) {
+		t.Fatal("the roots hash doesn't match the roots of the builder")
+	}
+	if !bytes.Equal(serializeBootstrap(t, &got), serialized) {
+		t.Fatal("the package serialized differently after deserializing")
+	}
+	if len(got.Proofs) != 3 || len(got.Proofs[2].AccProof.Targets) == 0 {
+		t.Fatalf("expected 3 proofs that aren't empty, got %d", len(got.Proofs))
+	}
+
+	// Flipping any byte fails one of the checksums or the magic.
+	for i := range serialized {
+		corrupt := append([]byte(nil), serialized...)
+		corrupt[i] ^= 0xff
+		err = new(blockchain.BootstrapPackage).Deserialize(bytes.NewReader(corrupt))
+		if err == nil {
+			t.Fatalf("no error with byte %d corrupted", i)
+		}
+	}
+	err = new(blockchain.BootstrapPackage).Deserialize(
+		bytes.NewReader(serialized[:len(serialized)-1]))
+	if err == nil {
+		t.Fatal("no error with a truncated package")
+	}
+
+	// The package isn't for other networks.
+	err = got.Verify(&chaincfg.TestNet3Params)
+	if err == nil {
+		t.Fatal("expected an error verifying against another network")
+	}
+
+	// Headers that don't connect are refused.
+	bad := got
+	bad.Headers = append([]wire.BlockHeader(nil), got.Headers...)
+	bad.Headers[4].Timestamp = bad.Headers[4].Timestamp.Add(time.Second)
+	if bad.Verify(&params) == nil {
+		t.Fatal("expected an error verifying headers that don't connect")
+	}
+
+	// Roots that can't be for the number of leaves are refused.
+	bad = got
+	bad.Roots = got.Roots[1:]
+	if bad.Serialize(new(bytes.Buffer)) == nil {
+		t.Fatal("expected an error serializing too few roots")
+	}
+}
@@ -92,11 +92,62 @@ func (b *BlockChain) AssumeUtreexoHeight() int32 {
 	return b.assumeUtreexoPoint.BlockHeight
 }
 
-// AssumeUtreexoHash returns the blockhash of the assumed utreexo point.
+// AssumeUtreexoHash returns the blockhash of the assumed utreexo point.  The
+// zero hash is returned if the blockhash isn't known yet.
 func (b *BlockChain) AssumeUtreexoHash() chainhash.Hash {
+	if b.assumeUtreexoPoint.BlockHash == nil {
+		return chainhash.Hash{}
+	}
 	return *b.assumeUtreexoPoint.BlockHash
 }
 
+// AssumeUtreexoRootsKnown returns true if the roots of the assumed utreexo point
+// are known.  They're not known when the point is given as a height and a roots
+// hash and the roots have yet to be fetched from peers.
+func (b *BlockChain) AssumeUtreexoRootsKnown() bool {
+	return len(b.assumeUtreexoPoint.Roots) > 0
+}
+
+// SetAssumeUtreexoRoots sets the roots of the assumed utreexo point to the given
+// roots at the given block.  The block must be at the height of the assumed
+// utreexo point in the best header chain and the roots must hash to the roots
+// hash of the assumed utreexo point.
+//
+// This function is NOT safe for concurrent access and must be called before
+// SetNewBestStateFromAssumedUtreexoPoint.
+func (b *BlockChain) SetAssumeUtreexoRoots(blockHash *chainhash.Hash,
+	numLeaves uint64, roots []utreexo.Hash) error {
+
+	if b.assumeUtreexoPoint.RootsHash == nil {
+		return fmt.Errorf("the assumed utreexo point has no roots hash " +
+			"to verify the roots against")
+	}
+	height, err := b.HeaderHeightByHash(*blockHash)
+	if err != nil {
+		return err
+	}
+	if height != b.assumeUtreexoPoint.BlockHeight {
+		return fmt.Errorf("block %v is at height %d but the assumed "+
+			"utreexo point is at height %d", blockHash, height,
+			b.assumeUtreexoPoint.BlockHeight)
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("no roots were given for block %v", blockHash)
+	}
+	rootsHash := UtreexoRootsHash(numLeaves, roots)
+	if !rootsHash.IsEqual(b.assumeUtreexoPoint.RootsHash) {
+		return fmt.Errorf("the roots at block %v hash to %v but the "+
+			"assumed utreexo point has the roots hash %v", blockHash,
+			rootsHash, b.assumeUtreexoPoint.RootsHash)
+	}
+
+	hash := *blockHash
+	b.assumeUtreexoPoint.BlockHash = &hash
+	b.assumeUtreexoPoint.NumLeaves = numLeaves
+	b.assumeUtreexoPoint.Roots = roots
+	return nil
+}
+
 // SetNewBestStateFromAssumedUtreexoPoint sets the best state for the node based
 // on the current blockIndex and the assumed utreexo point. Also marks all the
 // blocks in the blockIndex prior to the assumed utreexo point as valid.
@@ -192,6 +243,11 @@ type BlockChain struct {
 	// from peers.
 	utreexoView *UtreexoViewpoint
 
+	// utreexoRemember is the function that decides which of the newly
+	// created utxos have their proofs kept in the accumulator of the
+	// utreexoView.  It's carried over when the utreexoView is replaced.
+	utreexoRemember func(wire.OutPoint) bool
+
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
 	orphanLock   sync.RWMutex
@@ -2262,9 +2318,17 @@ func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
 	// Push back the block node being invalidated.
 	detachNodes.PushBack(node)
 
+	// Flush the indexes at the current tip before anything is undone so
+	// that the utreexo accumulators on disk can still be rolled back with
+	// the undo data of the blocks being disconnected.
+	err := b.flushIndexesForDisconnect()
+	if err != nil {
+		return err
+	}
+
 	// Reorg back to the parent of the block being invalidated.
 	// Nothing to attach so just pass an empty list.
-	err := b.reorganizeChain(detachNodes, list.New())
+	err = b.reorganizeChain(detachNodes, list.New())
 	if err != nil {
 		return err
 	}
@@ -2392,9 +2456,27 @@ func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
 		return nil
 	}
 
+	if detachNodes.Len() > 0 {
+		err = b.flushIndexesForDisconnect()
+		if err != nil {
+			return err
+		}
+	}
+
 	return b.reorganizeChain(detachNodes, attachNodes)
 }
 
+// flushIndexesForDisconnect flushes the indexes at the current tip ahead of
+// the blocks of the main chain being disconnected.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushIndexesForDisconnect() error {
+	if b.indexManager == nil {
+		return nil
+	}
+	return b.indexManager.Flush(&b.BestSnapshot().Hash, FlushRequired, false)
+}
+
 // IndexManager provides a generic interface that the is called when blocks are
 // connected and disconnected to and from the tip of the main chain for the
 // purpose of supporting optional indexes.
@@ -2444,6 +2526,26 @@ func (b *BlockChain) FlushIndexes(mode FlushMode, onConnect bool) error {
 	return nil
 }
 
+// FlushIndexesAndRun flushes the indexes and then calls fn while still holding
+// the chain lock so that no blocks are connected or disconnected until fn
+// returns.  It lets fn see the indexes on disk at the tip.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushIndexesAndRun(fn func(tip *BestState) error) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	tip := b.BestSnapshot()
+	if b.indexManager != nil {
+		err := b.indexManager.Flush(&tip.Hash, FlushRequired, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fn(tip)
+}
+
 // Config is a descriptor which specifies the blockchain instance configuration.
 type Config struct {
 	// DB defines the database which houses the blocks and will be used to
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/btcutil"
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
@@ -2118,3 +2119,90 @@ func TestReconsiderBlock(t *testing.T) {
 		}()
 	}
 }
+
+// TestSetAssumeUtreexoRoots ensures that the roots of an assumed utreexo point
+// given as a height and a roots hash are only accepted if they're at the height
+// of the point and hash to the roots hash.
+func TestSetAssumeUtreexoRoots(t *testing.T) {
+	// Construct a synthetic header chain of 10 blocks on top of genesis.
+	tip := tstTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	nodes := chainedNodes(chain.bestChain.Genesis(), 10)
+	for _, node := range nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestHeader = newChainView(tip(nodes))
+
+	roots := []utreexo.Hash{{1}, {2}, {3}}
+	numLeaves := uint64(11)
+	rootsHash := UtreexoRootsHash(numLeaves, roots)
+	chain.assumeUtreexoPoint = chaincfg.AssumeUtreexo{
+		BlockHeight: 5,
+		RootsHash:   &rootsHash,
+	}
+	if chain.AssumeUtreexoRootsKnown() {
+		t.Fatalf("expected the assumed utreexo roots to be unknown")
+	}
+	if hash := chain.AssumeUtreexoHash(); hash != (chainhash.Hash{}) {
+		t.Fatalf("expected the zero hash, got %v", hash)
+	}
+
+	tests := []struct {
+		name      string
+		hash      *chainhash.Hash
+		numLeaves uint64
+		roots     []utreexo.Hash
+	}{
+		{
+			name:      "wrong height",
+			hash:      &nodes[5].hash,
+			numLeaves: numLeaves,
+			roots:     roots,
+		},
+		{
+			name:      "unknown block",
+			hash:      &chainhash.Hash{0xff},
+			numLeaves: numLeaves,
+			roots:     roots,
+		},
+		{
+			name:      "wrong numleaves",
+			hash:      &nodes[4].hash,
+			numLeaves: numLeaves + 1,
+			roots:     roots,
+		},
+		{
+			name:      "wrong roots",
+			hash:      &nodes[4].hash,
+			numLeaves: numLeaves,
+			roots:     roots[:2],
+		},
+	}
+	for _, test := range tests {
+		err := chain.SetAssumeUtreexoRoots(test.hash, test.numLeaves, test.roots)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		if chain.AssumeUtreexoRootsKnown() {
+			t.Fatalf("%s: expected the assumed utreexo roots to be "+
+				"unknown", test.name)
+		}
+	}
+
+	err := chain.SetAssumeUtreexoRoots(&nodes[4].hash, numLeaves, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.AssumeUtreexoRootsKnown() {
+		t.Fatalf("expected the assumed utreexo roots to be known")
+	}
+	if hash := chain.AssumeUtreexoHash(); hash != nodes[4].hash {
+		t.Fatalf("expected assumed utreexo hash %v, got %v",
+			nodes[4].hash, hash)
+	}
+	if chain.assumeUtreexoPoint.NumLeaves != numLeaves ||
+		!reflect.DeepEqual(chain.assumeUtreexoPoint.Roots, roots) {
+
+		t.Fatalf("unexpected assumed utreexo roots")
+	}
+}
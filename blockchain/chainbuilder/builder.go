@@ -0,0 +1,438 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package chainbuilder builds valid blocks along with their utreexo proofs and
+// undo data on top of a parent state without a running chain.  It's meant for
+// test suites that need to fabricate regtest or simnet chains.
+package chainbuilder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/mining"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// blockInterval is the time between the timestamps of the built blocks.
+	blockInterval = time.Minute * 10
+
+	// vbTopBits are the bits that are set in the version of every built
+	// block as defined by BIP0009.
+	vbTopBits = 0x20000000
+)
+
+// opTrueScript is the default public key script of the coinbases.  It's
+// spendable with an empty signature script.
+var opTrueScript = []byte{txscript.OP_TRUE}
+
+// Block is a block built or connected by a Builder along with the utreexo data
+// that a utreexo proof index would have for it.
+type Block struct {
+	// Block is the block.  The UData of the block is set to the proof of
+	// the outputs it spends.
+	Block *btcutil.Block
+
+	// UData is the proof of the outputs that the block spends along with
+	// their leaf datas.
+	UData *wire.UData
+
+	// Stxos are the outputs that the block spends in the order of the spend
+	// journal.
+	Stxos []blockchain.SpentTxOut
+
+	// NumAdds, Targets and DelHashes are the undo data of the accumulator
+	// for the block.
+	NumAdds   uint64
+	Targets   []uint64
+	DelHashes []utreexo.Hash
+
+	// Stump is the accumulator after the block was connected.
+	Stump utreexo.Stump
+
+	// prevRoots are the roots of the accumulator before the block was
+	// connected.  They're needed to undo the block.
+	prevRoots []utreexo.Hash
+
+	// spent and added are the leaf datas of the outputs that the block
+	// deleted from and added to the accumulator.
+	spent []wire.LeafData
+	added []wire.LeafData
+}
+
+// Builder builds blocks on top of a parent state.  The state is the tip block,
+// the full accumulator and the unspent outputs.  Only networks where the
+// blocks may be at the proof of work limit, like regtest and simnet, are
+// supported.
+//
+// A Builder is not safe for concurrent access.
+type Builder struct {
+	params    *chaincfg.Params
+	payScript []byte
+
+	genesis *btcutil.Block
+	tip     *btcutil.Block
+	blocks  []*Block
+
+	pollard utreexo.MapPollard
+	utxos   map[wire.OutPoint]wire.LeafData
+
+	// extraNonce is put in the coinbases of the built blocks so that forks
+	// don't build the same blocks.  forks is shared among the forks of a
+	// builder to hand out unique extra nonces.
+	extraNonce uint64
+	forks      *uint64
+}
+
+// New returns a Builder with the genesis block of the given network as the
+// tip.  The coinbases of the built blocks pay to payScript or to OP_TRUE if
+// payScript is nil.
+func New(params *chaincfg.Params, payScript []byte) *Builder {
+	if payScript == nil {
+		payScript = opTrueScript
+	}
+
+	genesis := btcutil.NewBlock(params.GenesisBlock)
+	genesis.SetHeight(0)
+
+	return &Builder{
+		params:    params,
+		payScript: payScript,
+		genesis:   genesis,
+		tip:       genesis,
+		pollard:   utreexo.NewMapPollard(true),
+		utxos:     make(map[wire.OutPoint]wire.LeafData),
+		forks:     new(uint64),
+	}
+}
+
+// Tip returns the block that the next block is built on.
+func (b *Builder) Tip() *btcutil.Block {
+	return b.tip
+}
+
+// Blocks returns the blocks after the genesis block up to the tip.
+func (b *Builder) Blocks() []*Block {
+	return b.blocks
+}
+
+// Stump returns the roots and the number of leaves of the accumulator at the
+// tip.
+func (b *Builder) Stump() utreexo.Stump {
+	return utreexo.Stump{
+		Roots:     b.pollard.GetRoots(),
+		NumLeaves: b.pollard.NumLeaves,
+	}
+}
+
+// LeafData returns the leaf data of the given output and whether it's unspent
+// at the tip.
+func (b *Builder) LeafData(op wire.OutPoint) (wire.LeafData, bool) {
+	ld, ok := b.utxos[op]
+	return ld, ok
+}
+
+// NextBlock builds a block with the given transactions on the tip and connects
+// it.  A coinbase that claims the subsidy and the fees is put in front of the
+// transactions.  A witness commitment is added if any of the transactions has
+// a witness.  The transactions aren't validated beyond their inputs being
+// unspent and mature and them not spending more than their inputs.
+func (b *Builder) NextBlock(txns []*wire.MsgTx) (*Block, error) {
+	height := b.tip.Height() + 1
+
+	// Sum the fees of the transactions so that the coinbase claims them.
+	created := make(map[wire.OutPoint]int64)
+	var fees int64
+	for _, tx := range txns {
+		var in, out int64
+		for _, txIn := range tx.TxIn {
+			if ld, ok := b.utxos[txIn.PreviousOutPoint]; ok {
+				in += ld.Amount
+				continue
+			}
+			amount, ok := created[txIn.PreviousOutPoint]
+			if !ok {
+				return nil, fmt.Errorf("transaction %v spends "+
+					"unknown output %v", tx.TxHash(),
+					txIn.PreviousOutPoint)
+			}
+			in += amount
+		}
+
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			out += txOut.Value
+			created[wire.OutPoint{Hash: txHash, Index: uint32(i)}] = txOut.Value
+		}
+		if out > in {
+			return nil, fmt.Errorf("transaction %v spends %d but "+
+				"its inputs are only worth %d", txHash, out, in)
+		}
+		fees += in - out
+	}
+
+	coinbaseScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).AddInt64(int64(b.extraNonce)).Script()
+	if err != nil {
+		return nil, err
+	}
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: coinbaseScript,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(
+		blockchain.CalcBlockSubsidy(height, b.params)+fees, b.payScript))
+
+	txns = append([]*wire.MsgTx{coinbase}, txns...)
+	utilTxns := make([]*btcutil.Tx, 0, len(txns))
+	var hasWitness bool
+	for _, tx := range txns {
+		utilTxns = append(utilTxns, btcutil.NewTx(tx))
+		hasWitness = hasWitness || tx.HasWitness()
+	}
+	if hasWitness {
+		mining.AddWitnessCommitment(utilTxns[0], utilTxns)
+		utilTxns[0] = btcutil.NewTx(coinbase)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(utilTxns, false)
+
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    b.blockVersion(),
+			PrevBlock:  *b.tip.Hash(),
+			MerkleRoot: *merkles[len(merkles)-1],
+			Timestamp: b.tip.MsgBlock().Header.Timestamp.Add(
+				blockInterval),
+			Bits: b.params.PowLimitBits,
+		},
+		Transactions: txns,
+	}
+
+	// Solve the block by trying the nonces in order so that the same block
+	// is always built for the same state and transactions.
+	target := blockchain.CompactToBig(msgBlock.Header.Bits)
+	for {
+		hash := msgBlock.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+		if msgBlock.Header.Nonce == ^uint32(0) {
+			return nil, fmt.Errorf("unable to solve the block at "+
+				"height %d", height)
+		}
+		msgBlock.Header.Nonce++
+	}
+
+	return b.ConnectBlock(btcutil.NewBlock(msgBlock))
+}
+
+// blockVersion returns the version of the built blocks.  It signals for the
+// csv, segwit and taproot deployments so that they activate like they would
+// with blocks from the miner.
+func (b *Builder) blockVersion() int32 {
+	version := uint32(vbTopBits)
+	for _, id := range []int{chaincfg.DeploymentCSV,
+		chaincfg.DeploymentSegwit, chaincfg.DeploymentTaproot} {
+
+		version |= 1 << b.params.Deployments[id].BitNumber
+	}
+
+	return int32(version)
+}
+
+// ConnectBlock connects the given block to the tip and returns it along with
+// its utreexo data.  The UData of the block is set to the generated proof.  The
+// block may come from anywhere but it must build on the tip and only spend
+// unspent and mature outputs.
+func (b *Builder) ConnectBlock(block *btcutil.Block) (*Block, error) {
+	if block.MsgBlock().Header.PrevBlock != *b.tip.Hash() {
+		return nil, fmt.Errorf("block %v doesn't build on the tip %v",
+			block.Hash(), b.tip.Hash())
+	}
+	height := b.tip.Height() + 1
+	block.SetHeight(height)
+
+	_, outCount, inskip, outskip := blockchain.DedupeBlock(block)
+
+	// Gather the leaf datas of the outputs that the block spends from the
+	// accumulator along with the stxos of all the spent outputs.
+	created := make(map[wire.OutPoint]*wire.TxOut)
+	spent := make(map[wire.OutPoint]struct{})
+	var stxos []blockchain.SpentTxOut
+	var dels []wire.LeafData
+	var inIdx uint32
+	for txIdx, tx := range block.Transactions() {
+		for _, txIn := range tx.MsgTx().TxIn {
+			if txIdx == 0 {
+				inIdx++
+				continue
+			}
+
+			op := txIn.PreviousOutPoint
+			if _, ok := spent[op]; ok {
+				return nil, fmt.Errorf("block %v spends %v twice",
+					block.Hash(), op)
+			}
+			spent[op] = struct{}{}
+
+			// Outputs created in the same block aren't in the
+			// accumulator.
+			if len(inskip) > 0 && inskip[0] == inIdx {
+				inskip = inskip[1:]
+				inIdx++
+
+				txOut, ok := created[op]
+				if !ok {
+					return nil, fmt.Errorf("block %v spends "+
+						"%v before it's created",
+						block.Hash(), op)
+				}
+				stxos = append(stxos, blockchain.SpentTxOut{
+					Amount:   txOut.Value,
+					PkScript: txOut.PkScript,
+					Height:   height,
+				})
+				continue
+			}
+			inIdx++
+
+			ld, ok := b.utxos[op]
+			if !ok {
+				return nil, fmt.Errorf("block %v spends unknown "+
+					"or spent output %v", block.Hash(), op)
+			}
+			if ld.IsCoinBase &&
+				height-ld.Height < int32(b.params.CoinbaseMaturity) {
+
+				return nil, fmt.Errorf("block %v spends the "+
+					"immature coinbase output %v", block.Hash(), op)
+			}
+			dels = append(dels, ld)
+			stxos = append(stxos, blockchain.SpentTxOut{
+				Amount:     ld.Amount,
+				PkScript:   ld.PkScript,
+				Height:     ld.Height,
+				IsCoinBase: ld.IsCoinBase,
+			})
+		}
+
+		for i, txOut := range tx.MsgTx().TxOut {
+			created[wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}] = txOut
+		}
+	}
+
+	ud, err := wire.GenerateUData(dels, &b.pollard)
+	if err != nil {
+		return nil, err
+	}
+	delHashes, err := wire.HashesFromLeafDatas(ud.LeafDatas)
+	if err != nil {
+		return nil, err
+	}
+	adds := blockchain.BlockToAddLeaves(block, outskip, nil, outCount)
+
+	// Copy the targets as the proof is handed out with the block.
+	targets := make([]uint64, len(ud.AccProof.Targets))
+	copy(targets, ud.AccProof.Targets)
+
+	prevRoots := b.pollard.GetRoots()
+	err = b.pollard.Modify(adds, delHashes, ud.AccProof)
+	if err != nil {
+		return nil, err
+	}
+
+	added := blockchain.BlockToAddLeafDatas(block, outskip, outCount)
+	for _, ld := range dels {
+		delete(b.utxos, ld.OutPoint)
+	}
+	for _, ld := range added {
+		b.utxos[ld.OutPoint] = ld
+	}
+
+	block.MsgBlock().UData = ud
+	built := &Block{
+		Block:     block,
+		UData:     ud,
+		Stxos:     stxos,
+		NumAdds:   uint64(len(adds)),
+		Targets:   targets,
+		DelHashes: delHashes,
+		Stump:     b.Stump(),
+		prevRoots: prevRoots,
+		spent:     dels,
+		added:     added,
+	}
+	b.blocks = append(b.blocks, built)
+	b.tip = block
+
+	return built, nil
+}
+
+// DisconnectTip disconnects the tip with its undo data so that the parent of
+// the tip is the tip again.
+func (b *Builder) DisconnectTip() error {
+	if len(b.blocks) == 0 {
+		return fmt.Errorf("unable to disconnect the genesis block")
+	}
+	tip := b.blocks[len(b.blocks)-1]
+
+	err := b.pollard.Undo(tip.NumAdds, utreexo.Proof{Targets: tip.Targets},
+		tip.DelHashes, tip.prevRoots)
+	if err != nil {
+		return err
+	}
+
+	for _, ld := range tip.added {
+		delete(b.utxos, ld.OutPoint)
+	}
+	for _, ld := range tip.spent {
+		b.utxos[ld.OutPoint] = ld
+	}
+
+	b.blocks = b.blocks[:len(b.blocks)-1]
+	if len(b.blocks) == 0 {
+		b.tip = b.genesis
+	} else {
+		b.tip = b.blocks[len(b.blocks)-1].Block
+	}
+
+	return nil
+}
+
+// Fork returns a copy of the builder that builds on the same tip.  The blocks
+// that the copy builds are different from the ones the original builds with
+// the same transactions so that they can be used for reorgs.
+func (b *Builder) Fork() (*Builder, error) {
+	*b.forks++
+	fork := &Builder{
+		params:     b.params,
+		payScript:  b.payScript,
+		genesis:    b.genesis,
+		tip:        b.genesis,
+		pollard:    utreexo.NewMapPollard(true),
+		utxos:      make(map[wire.OutPoint]wire.LeafData),
+		extraNonce: *b.forks,
+		forks:      b.forks,
+	}
+
+	// The accumulator can't be copied so the blocks are connected again.
+	for _, block := range b.blocks {
+		_, err := fork.ConnectBlock(block.Block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fork, nil
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainbuilder
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/database"
+	_ "github.com/utreexo/utreexod/database/ffldb"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// newTestChain returns a chain with its database in a temporary directory.  The
+// chain is a compact state node if csn is true.
+func newTestChain(t *testing.T, params *chaincfg.Params, csn bool) *blockchain.BlockChain {
+	db, err := database.Create("ffldb", filepath.Join(t.TempDir(), "db"),
+		params.Net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &blockchain.Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	}
+	if csn {
+		cfg.UtreexoView = blockchain.NewUtreexoViewpoint()
+	}
+	chain, err := blockchain.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return chain
+}
+
+// spendTx returns a transaction that spends the given OP_TRUE output into two
+// OP_TRUE outputs, leaving a fee of 1000.
+func spendTx(op wire.OutPoint, amount int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: op,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	value := amount - 1000
+	tx.AddTxOut(wire.NewTxOut(value/2, opTrueScript))
+	tx.AddTxOut(wire.NewTxOut(value-value/2, opTrueScript))
+	return tx
+}
+
+func TestBuilder(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 5
+
+	b := New(&params, nil)
+	fullChain := newTestChain(t, &params, false)
+	csnChain := newTestChain(t, &params, true)
+
+	process := func(block *Block) {
+		t.Helper()
+		for _, chain := range []*blockchain.BlockChain{fullChain, csnChain} {
+			_, _, err := chain.ProcessBlock(block.Block, blockchain.BFNone)
+			if err != nil {
+				t.Fatalf("block at height %d: %v",
+					block.Block.Height(), err)
+			}
+			if chain.BestSnapshot().Hash != *block.Block.Hash() {
+				t.Fatalf("block at height %d isn't the tip",
+					block.Block.Height())
+			}
+		}
+	}
+
+	// Build blocks that spend the mature coinbases along with the outputs
+	// created in the previous block and in the same block.
+	var prevSpend *wire.MsgTx
+	for height := int32(1); height <= 20; height++ {
+		var txns []*wire.MsgTx
+		matureHeight := height - int32(params.CoinbaseMaturity)
+		if matureHeight > 0 {
+			coinbase := b.Blocks()[matureHeight-1].Block.MsgBlock().Transactions[0]
+			spend := spendTx(wire.OutPoint{Hash: coinbase.TxHash()},
+				coinbase.TxOut[0].Value)
+			txns = append(txns, spend)
+
+			child := spendTx(wire.OutPoint{Hash: spend.TxHash()},
+				spend.TxOut[0].Value)
+			txns = append(txns, child)
+
+			if prevSpend != nil {
+				txns = append(txns, spendTx(
+					wire.OutPoint{Hash: prevSpend.TxHash(), Index: 1},
+					prevSpend.TxOut[1].Value))
+			}
+			prevSpend = spend
+		}
+
+		prevStump := b.Stump()
+		block, err := b.NextBlock(txns)
+		if err != nil {
+			t.Fatalf("height %d: %v", height, err)
+		}
+
+		// The proof must verify against the previous accumulator.
+		_, err = utreexo.Verify(prevStump, block.DelHashes,
+			block.UData.AccProof)
+		if err != nil {
+			t.Fatalf("height %d: proof doesn't verify: %v", height, err)
+		}
+		if len(block.Stxos) != len(txns) {
+			t.Fatalf("height %d: expected %d stxos, got %d", height,
+				len(txns), len(block.Stxos))
+		}
+
+		process(block)
+	}
+
+	// Immature coinbases and spent outputs are refused.
+	coinbase := b.Tip().MsgBlock().Transactions[0]
+	_, err := b.NextBlock([]*wire.MsgTx{spendTx(
+		wire.OutPoint{Hash: coinbase.TxHash()}, coinbase.TxOut[0].Value)})
+	if err == nil {
+		t.Fatal("expected an error spending an immature coinbase")
+	}
+	spent := b.Blocks()[0].Block.MsgBlock().Transactions[0]
+	_, err = b.NextBlock([]*wire.MsgTx{spendTx(
+		wire.OutPoint{Hash: spent.TxHash()}, spent.TxOut[0].Value)})
+	if err == nil {
+		t.Fatal("expected an error spending a spent output")
+	}
+
+	// Disconnecting the tip goes back to the previous accumulator and
+	// unspends the outputs.
+	tip := b.Blocks()[len(b.Blocks())-1]
+	parentStump := b.Blocks()[len(b.Blocks())-2].Stump
+	err = b.DisconnectTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stumpsEqual(b.Stump(), parentStump) {
+		t.Fatalf("expected stump %v after the disconnect, got %v",
+			parentStump, b.Stump())
+	}
+	for _, ld := range tip.spent {
+		if _, ok := b.LeafData(ld.OutPoint); !ok {
+			t.Fatalf("%v isn't unspent after the disconnect",
+				ld.OutPoint)
+		}
+	}
+	reconnected, err := b.ConnectBlock(tip.Block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stumpsEqual(reconnected.Stump, tip.Stump) {
+		t.Fatalf("expected stump %v after reconnecting, got %v",
+			tip.Stump, reconnected.Stump)
+	}
+
+	// A longer fork of the parent of the tip reorgs the chains.
+	err = b.DisconnectTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := b.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stumpsEqual(fork.Stump(), b.Stump()) {
+		t.Fatalf("expected the fork to have stump %v, got %v",
+			b.Stump(), fork.Stump())
+	}
+	for i := 0; i < 2; i++ {
+		block, err := fork.NextBlock(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *block.Block.Hash() == *tip.Block.Hash() {
+			t.Fatal("the fork built the same block as the original")
+		}
+		for _, chain := range []*blockchain.BlockChain{fullChain, csnChain} {
+			_, _, err := chain.ProcessBlock(block.Block, blockchain.BFNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	forkTip := fork.Tip().Hash()
+	for _, chain := range []*blockchain.BlockChain{fullChain, csnChain} {
+		if chain.BestSnapshot().Hash != *forkTip {
+			t.Fatalf("expected the chain to reorg to %v, got tip %v",
+				forkTip, chain.BestSnapshot().Hash)
+		}
+	}
+}
+
+// stumpsEqual returns whether the two stumps are the same.
+func stumpsEqual(a, b utreexo.Stump) bool {
+	if a.NumLeaves != b.NumLeaves || len(a.Roots) != len(b.Roots) {
+		return false
+	}
+	for i := range a.Roots {
+		if a.Roots[i] != b.Roots[i] {
+			return false
+		}
+	}
+	return true
+}
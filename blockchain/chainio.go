@@ -1080,6 +1080,14 @@ func SerializeUtreexoRoots(numLeaves uint64, roots []utreexo.Hash) ([]byte, erro
 	return w.Bytes(), nil
 }
 
+// UtreexoRootsHash returns the hash of the serialized numLeaves and roots.  It's
+// what an assumed utreexo point given by the user commits to.
+func UtreexoRootsHash(numLeaves uint64, roots []utreexo.Hash) chainhash.Hash {
+	// Writing to a bytes.Buffer never fails.
+	serialized, _ := SerializeUtreexoRoots(numLeaves, roots)
+	return chainhash.HashH(serialized)
+}
+
 // DeserializeUtreexoRoots deserializes the provided byte slice into numLeaves and roots.
 func DeserializeUtreexoRoots(serializedUView []byte) (uint64, []utreexo.Hash, error) {
 	totalLen := len(serializedUView)
@@ -1290,6 +1298,56 @@ func ChainstateInitialized(dbTx database.Tx) bool {
 	return dbTx.Metadata().Get(chainStateKeyName) != nil
 }
 
+// VerifyBestState checks that the best chain state stored in the database can
+// be deserialized and that the block it points to is both the main chain block
+// at its height and present in the block database.  The hash and height of the
+// best block are returned.  A nil hash is returned when the chain state hasn't
+// been initialized yet.
+func VerifyBestState(dbTx database.Tx) (*chainhash.Hash, int32, error) {
+	serializedData := dbTx.Metadata().Get(chainStateKeyName)
+	if serializedData == nil {
+		return nil, 0, nil
+	}
+	state, err := deserializeBestChainState(serializedData)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	height, err := dbFetchHeightByHash(dbTx, &state.hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	if height != int32(state.height) {
+		return nil, 0, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("best block %s is at height %d "+
+				"in the hash index but the chain state has %d",
+				state.hash, height, state.height),
+		}
+	}
+
+	hasBlock, err := dbTx.HasBlock(&state.hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !hasBlock {
+		return nil, 0, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("best block %s is missing from "+
+				"the block database", state.hash),
+		}
+	}
+
+	return &state.hash, height, nil
+}
+
+// DBFetchHeightByHash uses an existing database transaction to retrieve the
+// height of the provided main chain block hash.  An error is returned when the
+// block isn't part of the main chain.
+func DBFetchHeightByHash(dbTx database.Tx, hash *chainhash.Hash) (int32, error) {
+	return dbFetchHeightByHash(dbTx, hash)
+}
+
 // initChainState attempts to load and initialize the chain state from the
 // database.  When the db does not yet contain any chain state, both it and the
 // chain state are initialized to the genesis block.
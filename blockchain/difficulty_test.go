@@ -7,6 +7,10 @@ package blockchain
 import (
 	"math/big"
 	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/wire"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +77,105 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestBIP94Difficulty ensures that on networks that enforce BIP0094 the
+// difficulty of a retarget is based on the first block of the period and that
+// the first block of a period can't be much older than the block before it.
+func TestBIP94Difficulty(t *testing.T) {
+	// Use a proof of work limit easier than the difficulty of the genesis
+	// block so that minimum difficulty blocks stand out.
+	params := chaincfg.TestNet4Params
+	params.PowLimit = chaincfg.RegressionNetParams.PowLimit
+	params.PowLimitBits = chaincfg.RegressionNetParams.PowLimitBits
+	genesisBits := params.GenesisBlock.Header.Bits
+
+	// Build a full difficulty period where the last block is a minimum
+	// difficulty block.
+	bc := newFakeChain(&params)
+	node := bc.bestChain.Tip()
+	blockTime := params.GenesisBlock.Header.Timestamp
+	for i := int32(1); i < bc.blocksPerRetarget-1; i++ {
+		blockTime = blockTime.Add(params.TargetTimePerBlock)
+		node = newFakeNode(node, 0x20000000, genesisBits, blockTime)
+	}
+	blockTime = blockTime.Add(params.MinDiffReductionTime + time.Second)
+	node = newFakeNode(node, 0x20000000, params.PowLimitBits, blockTime)
+
+	// The retarget is based on the first block of the period so the
+	// minimum difficulty block doesn't reset the difficulty.
+	nextTime := blockTime.Add(params.TargetTimePerBlock)
+	bits, err := bc.calcNextRequiredDifficulty(node, nextTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits != genesisBits {
+		t.Fatalf("unexpected retarget with BIP0094: got %08x, want %08x",
+			bits, genesisBits)
+	}
+
+	// Without BIP0094 the minimum difficulty of the last block carries
+	// over to the next period.
+	noBIP94Params := params
+	noBIP94Params.EnforceBIP94 = false
+	noBIP94Chain := newFakeChain(&noBIP94Params)
+	bits, err = noBIP94Chain.calcNextRequiredDifficulty(node, nextTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits != params.PowLimitBits {
+		t.Fatalf("unexpected retarget without BIP0094: got %08x, want %08x",
+			bits, params.PowLimitBits)
+	}
+
+	tests := []struct {
+		name     string
+		chain    *BlockChain
+		prevNode *blockNode
+		offset   time.Duration
+		valid    bool
+	}{
+		{
+			name:     "start of period at the timewarp limit",
+			chain:    bc,
+			prevNode: node,
+			offset:   -maxTimewarp,
+			valid:    true,
+		},
+		{
+			name:     "start of period past the timewarp limit",
+			chain:    bc,
+			prevNode: node,
+			offset:   -maxTimewarp - time.Second,
+		},
+		{
+			name:     "middle of period past the timewarp limit",
+			chain:    bc,
+			prevNode: node.parent,
+			offset:   -time.Hour,
+			valid:    true,
+		},
+		{
+			name:     "start of period without BIP0094",
+			chain:    noBIP94Chain,
+			prevNode: node,
+			offset:   -time.Hour,
+			valid:    true,
+		},
+	}
+	for _, test := range tests {
+		header := &wire.BlockHeader{
+			Timestamp: time.Unix(test.prevNode.timestamp, 0).Add(test.offset),
+		}
+		err := test.chain.checkTimewarp(header, test.prevNode)
+		if test.valid {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrTimeTooOld {
+			t.Fatalf("%s: expected ErrTimeTooOld, got %v", test.name, err)
+		}
+	}
+}
@@ -227,6 +227,10 @@ const (
 
 	// ErrMissingParent indicates that the block was an orphan.
 	ErrMissingParent
+
+	// ErrBadSignetSolution indicates that the solution of a block on a
+	// signet network doesn't satisfy the challenge of the network.
+	ErrBadSignetSolution
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -276,6 +280,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrPrevBlockNotBest:          "ErrPrevBlockNotBest",
 	ErrKnownInvalidBlock:         "ErrKnownInvalidBlock",
 	ErrMissingParent:             "ErrMissingParent",
+	ErrBadSignetSolution:         "ErrBadSignetSolution",
 }
 
 // String returns the ErrorCode as a human-readable name.
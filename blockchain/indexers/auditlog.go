@@ -0,0 +1,190 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jrick/logrotate/rotator"
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// auditLogFileName is the name of the audit log of the accumulator in
+	// the directory of the utreexo state.  The rolled over logs are named
+	// after it with an increasing number and are gzipped.
+	auditLogFileName = "audit.log"
+
+	// auditLogMaxRolls is the number of rolled over audit logs that are
+	// kept around.
+	auditLogMaxRolls = 5
+
+	// auditOpModify and auditOpUndo are the operations on the accumulator
+	// that are recorded in the audit log.
+	auditOpModify = "modify"
+	auditOpUndo   = "undo"
+)
+
+// auditRecord is a modification of the accumulator as it's recorded in the
+// audit log.  Each record is written as a line of JSON.
+type auditRecord struct {
+	// Time is the unix time of when the accumulator was modified.
+	Time int64 `json:"time"`
+
+	// Op is either auditOpModify for a block that was attached to the
+	// accumulator or auditOpUndo for one that was detached from it.
+	Op string `json:"op"`
+
+	// Height and BlockHash identify the block that was attached or
+	// detached.
+	Height    int32  `json:"height"`
+	BlockHash string `json:"blockhash"`
+
+	// NumAdds is the count of the leaves the block added.  Adds are their
+	// hashes and are only known when the block is attached.
+	NumAdds uint64   `json:"numadds"`
+	Adds    []string `json:"adds,omitempty"`
+
+	// Dels are the hashes of the leaves the block deleted and Targets are
+	// their positions.
+	Dels    []string `json:"dels"`
+	Targets []uint64 `json:"targets"`
+
+	// NumLeaves and RootsHash are the number of leaves and the hash of the
+	// roots of the accumulator after the modification.
+	NumLeaves uint64 `json:"numleaves"`
+	RootsHash string `json:"rootshash"`
+}
+
+// auditLog is an append-only log of every modification of an accumulator.  It
+// makes it possible to find out exactly when and how the accumulator diverged
+// from the one of another node.  The log is rolled over once it grows past its
+// maximum size.
+type auditLog struct {
+	mtx     sync.Mutex
+	rotator *rotator.Rotator
+}
+
+// openAuditLog opens the audit log of the utreexo state described by the config.
+// nil is returned when the audit log isn't enabled.
+func openAuditLog(cfg *UtreexoConfig) (*auditLog, error) {
+	if !cfg.AuditLog {
+		return nil, nil
+	}
+
+	path := filepath.Join(utreexoBasePath(cfg), auditLogFileName)
+	thresholdKB := cfg.AuditLogMaxSize / 1000
+	if thresholdKB < 1 {
+		thresholdKB = 1
+	}
+	r, err := rotator.New(path, thresholdKB, false, auditLogMaxRolls)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Recording the modifications of the %s utreexo state to %s",
+		cfg.Name, path)
+	return &auditLog{rotator: r}, nil
+}
+
+// record appends the record to the audit log.
+//
+// This function is safe for concurrent access.
+func (a *auditLog) record(rec *auditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	_, err = a.rotator.Write(line)
+	return err
+}
+
+// close closes the audit log.  It waits for the rolled over logs to be
+// compressed.
+func (a *auditLog) close() error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.rotator.Close()
+}
+
+// hexHashes returns the hashes as hex strings.
+func hexHashes(hashes []utreexo.Hash) []string {
+	strs := make([]string, len(hashes))
+	for i := range hashes {
+		strs[i] = hex.EncodeToString(hashes[i][:])
+	}
+	return strs
+}
+
+// audit records the modification of the accumulator by the block at the given
+// height to the audit log if it's enabled.  adds is nil when the block was
+// detached.  The accumulator has to already be modified.  Failing to record it
+// is only logged as the accumulator itself was modified fine.
+func (us *UtreexoState) audit(op string, height int32, blockHash *chainhash.Hash,
+	numAdds uint64, adds []utreexo.Leaf, delHashes []utreexo.Hash,
+	targets []uint64) {
+
+	if us.auditLog == nil {
+		return
+	}
+
+	numLeaves := us.state.GetNumLeaves()
+	rootsHash, err := utreexoRootsHash(numLeaves, us.state.GetRoots())
+	if err != nil {
+		log.Warnf("Unable to record the %s of block %s to the audit "+
+			"log: %v", op, blockHash, err)
+		return
+	}
+
+	rec := &auditRecord{
+		Time:      time.Now().Unix(),
+		Op:        op,
+		Height:    height,
+		BlockHash: blockHash.String(),
+		NumAdds:   numAdds,
+		Dels:      hexHashes(delHashes),
+		Targets:   targets,
+		NumLeaves: numLeaves,
+		RootsHash: rootsHash.String(),
+	}
+	if adds != nil {
+		rec.Adds = make([]string, len(adds))
+		for i := range adds {
+			rec.Adds[i] = hex.EncodeToString(adds[i].Hash[:])
+		}
+	}
+	if rec.Targets == nil {
+		rec.Targets = []uint64{}
+	}
+
+	err = us.auditLog.record(rec)
+	if err != nil {
+		log.Warnf("Unable to record the %s of block %s to the audit "+
+			"log: %v", op, blockHash, err)
+	}
+}
+
+// closeAuditLog closes the audit log if it's enabled.
+func (us *UtreexoState) closeAuditLog() {
+	if us.auditLog == nil {
+		return
+	}
+
+	err := us.auditLog.close()
+	if err != nil {
+		log.Warnf("error while closing the utreexo audit log. %v", err)
+	}
+}
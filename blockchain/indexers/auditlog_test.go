@@ -0,0 +1,132 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+
+	cfg := &UtreexoConfig{
+		DataDir:         t.TempDir(),
+		Name:            "test",
+		AuditLog:        true,
+		AuditLogMaxSize: 4000,
+	}
+	err := os.MkdirAll(utreexoBasePath(cfg), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The audit log isn't opened unless it's enabled.
+	disabled := *cfg
+	disabled.AuditLog = false
+	al, err := openAuditLog(&disabled)
+	if err != nil || al != nil {
+		t.Fatalf("expected no audit log, got %v and %v", al, err)
+	}
+
+	al, err = openAuditLog(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := utreexo.NewMapPollard(true)
+	us := &UtreexoState{config: cfg, state: &p, auditLog: al}
+
+	// Attach a block and then detach it again.
+	adds := make([]utreexo.Leaf, 8)
+	for i := range adds {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(i))
+		adds[i] = utreexo.Leaf{Hash: sha256.Sum256(buf[:])}
+	}
+	err = p.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockHash := chainhash.Hash{1}
+	us.audit(auditOpModify, 1, &blockHash, uint64(len(adds)), adds, nil, nil)
+	wantRoots, err := utreexoRootsHash(p.NumLeaves, p.GetRoots())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Undo(uint64(len(adds)), utreexo.Proof{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.audit(auditOpUndo, 1, &blockHash, uint64(len(adds)), nil, nil, nil)
+
+	path := filepath.Join(utreexoBasePath(cfg), auditLogFileName)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		err = json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	f.Close()
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+
+	modify := recs[0]
+	if modify.Op != auditOpModify || modify.Height != 1 ||
+		modify.BlockHash != blockHash.String() || modify.NumAdds != 8 ||
+		modify.NumLeaves != 8 || modify.RootsHash != wantRoots.String() {
+
+		t.Fatalf("unexpected modify record %+v", modify)
+	}
+	wantAdds := make([]string, len(adds))
+	for i := range adds {
+		wantAdds[i] = hex.EncodeToString(adds[i].Hash[:])
+	}
+	if !reflect.DeepEqual(modify.Adds, wantAdds) {
+		t.Fatalf("expected adds %v, got %v", wantAdds, modify.Adds)
+	}
+
+	undo := recs[1]
+	if undo.Op != auditOpUndo || undo.NumLeaves != 0 || undo.Adds != nil {
+		t.Fatalf("unexpected undo record %+v", undo)
+	}
+
+	// The log is rolled over once it grows past its maximum size.
+	for i := 0; i < 20; i++ {
+		us.audit(auditOpModify, int32(i), &blockHash, uint64(len(adds)),
+			adds, nil, nil)
+	}
+	us.closeAuditLog()
+	rolled, err := filepath.Glob(path + ".*.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolled) == 0 {
+		t.Fatal("expected the audit log to be rolled over")
+	}
+	if len(rolled) > auditLogMaxRolls {
+		t.Fatalf("expected at most %d rolled over logs, got %d",
+			auditLogMaxRolls, len(rolled))
+	}
+}
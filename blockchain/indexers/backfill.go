@@ -0,0 +1,289 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+)
+
+// backfillRetryInterval is how long the backfill handler waits before trying
+// again when the next block for an index isn't in the main chain yet.
+const backfillRetryInterval = time.Second
+
+// IndexInfo describes how far an index is caught up to the main chain.
+type IndexInfo struct {
+	// Name is the human-readable name of the index.
+	Name string
+
+	// Hash and Height are the hash and the height of the last block that
+	// was indexed.  Height is -1 when no block has been indexed yet.
+	Hash   chainhash.Hash
+	Height int32
+
+	// Synced is whether the index is caught up to the main chain.  It's
+	// false while the index is being caught up in the background.
+	Synced bool
+}
+
+// isBackfilling returns whether the index is being caught up to the main chain
+// in the background.
+//
+// This function is safe for concurrent access.
+func (m *Manager) isBackfilling(indexer Indexer) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	_, ok := m.backfilling[indexer]
+	return ok
+}
+
+// IndexInfo returns how far each of the enabled indexes is caught up to the main
+// chain in the order they were enabled.
+//
+// This function is safe for concurrent access.
+func (m *Manager) IndexInfo() ([]IndexInfo, error) {
+	infos := make([]IndexInfo, 0, len(m.enabledIndexes))
+	err := m.db.View(func(dbTx database.Tx) error {
+		for _, indexer := range m.enabledIndexes {
+			hash, height, err := dbFetchIndexerTip(dbTx, indexer.Key())
+			if err != nil {
+				return err
+			}
+
+			infos = append(infos, IndexInfo{
+				Name:   indexer.Name(),
+				Hash:   *hash,
+				Height: height,
+				Synced: !m.isBackfilling(indexer),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+// SetCPUQuota sets the quota that caps the share of the CPU cores used to
+// catch up the indexes in the background.  It must be called before Start.
+func (m *Manager) SetCPUQuota(quota *CPUQuota) {
+	m.cpuQuota = quota
+}
+
+// SetDeferSync sets whether all of the indexes are caught up in the background
+// after startup instead of only the ones that opt in as Backfillers.  The
+// indexes that are behind then no longer hold up the initialization of the
+// chain.  It must be called before Init.
+func (m *Manager) SetDeferSync(deferSync bool) {
+	m.deferSync = deferSync
+}
+
+// Start begins catching up the indexes that were left behind the main chain
+// during initialization in the background.
+func (m *Manager) Start() {
+	var indexes []Indexer
+	for _, indexer := range m.enabledIndexes {
+		if m.isBackfilling(indexer) {
+			indexes = append(indexes, indexer)
+		}
+	}
+	if len(indexes) == 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go m.backfillHandler(indexes)
+}
+
+// Stop stops catching up the indexes in the background and waits for it to
+// finish.
+func (m *Manager) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// backfillHandler catches up the passed indexes to the main chain one after
+// the other.  It must be run as a goroutine.
+func (m *Manager) backfillHandler(indexes []Indexer) {
+	defer m.wg.Done()
+
+	for _, indexer := range indexes {
+		err := m.backfill(indexer)
+		if err == errInterruptRequested {
+			return
+		}
+		if err != nil {
+			log.Errorf("Unable to catch up %s in the background: %v",
+				indexer.Name(), err)
+		}
+	}
+}
+
+// backfill connects the blocks of the main chain to the index one at a time
+// until the index is caught up to the tip.  Once it is, the index is connected
+// to and disconnected from along with the main chain.
+func (m *Manager) backfill(indexer Indexer) error {
+	progressLogger := newBlockProgressLogger("Backfilled", log)
+	idxKey := indexer.Key()
+
+	for {
+		var tipHash *chainhash.Hash
+		var tipHeight int32
+		err := m.db.View(func(dbTx database.Tx) error {
+			var err error
+			tipHash, tipHeight, err = dbFetchIndexerTip(dbTx, idxKey)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if interruptRequested(m.quit) {
+			if tipHeight != -1 {
+				err = indexer.Flush(tipHash, blockchain.FlushRequired, true)
+				if err != nil {
+					log.Errorf("Error while flushing the %s: %v",
+						indexer.Name(), err)
+				}
+			}
+			return errInterruptRequested
+		}
+
+		// The index is caught up once its tip is the tip of the main
+		// chain.  It's checked again and marked as caught up within a
+		// database transaction so that no block can be connected to the
+		// main chain in between.
+		m.mtx.Lock()
+		atTip := tipHash.IsEqual(&m.chainTip)
+		m.mtx.Unlock()
+		if atTip {
+			var caughtUp bool
+			err = m.db.Update(func(dbTx database.Tx) error {
+				hash, _, err := dbFetchIndexerTip(dbTx, idxKey)
+				if err != nil {
+					return err
+				}
+
+				m.mtx.Lock()
+				defer m.mtx.Unlock()
+				if hash.IsEqual(&m.chainTip) {
+					delete(m.backfilling, indexer)
+					caughtUp = true
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if caughtUp {
+				log.Infof("Finished catching up the %s to height %d",
+					indexer.Name(), tipHeight)
+				return nil
+			}
+			continue
+		}
+
+		// Disconnect the tip from the index when it was reorganized out
+		// of the main chain.
+		if tipHeight != -1 && !m.chain.MainChainHasBlock(tipHash) {
+			err = m.backfillDisconnect(indexer, tipHash, tipHeight)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Wait for the next block to be in the main chain if it isn't
+		// yet.  This happens when the block was just connected and the
+		// main chain hasn't been updated with it yet.
+		block, err := m.chain.BlockByHeight(tipHeight + 1)
+		if err != nil || !block.MsgBlock().Header.PrevBlock.IsEqual(tipHash) {
+			select {
+			case <-m.quit:
+			case <-time.After(backfillRetryInterval):
+			}
+			continue
+		}
+
+		err = m.cpuQuota.Run(m.quit, func() error {
+			return m.backfillConnect(indexer, block)
+		})
+		if err == errInterruptRequested {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		progressLogger.LogBlockHeight(block)
+	}
+}
+
+// backfillConnect connects the next block of the main chain to the index that
+// is being caught up in the background.
+func (m *Manager) backfillConnect(indexer Indexer, block *btcutil.Block) error {
+	var stxos []blockchain.SpentTxOut
+	if indexNeedsInputs(indexer) {
+		var err error
+		stxos, err = m.fetchSpentTxOuts(m.chain, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := m.db.Update(func(dbTx database.Tx) error {
+		return dbIndexConnectBlock(dbTx, indexer, block, stxos)
+	})
+	if err != nil {
+		return err
+	}
+
+	return indexer.Flush(block.Hash(), blockchain.FlushIfNeeded, true)
+}
+
+// backfillDisconnect disconnects the block at the tip of the index that is
+// being caught up in the background.
+func (m *Manager) backfillDisconnect(indexer Indexer, hash *chainhash.Hash,
+	height int32) error {
+
+	// The block is no longer in the main chain so it has to be loaded from
+	// the database directly.
+	var block *btcutil.Block
+	err := m.db.View(func(dbTx database.Tx) error {
+		blockBytes, err := dbTx.FetchBlock(hash)
+		if err != nil {
+			return err
+		}
+		block, err = btcutil.NewBlockFromBytes(blockBytes)
+		if err != nil {
+			return err
+		}
+		block.SetHeight(height)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stxos, err := m.chain.FetchSpendJournal(block)
+	if err != nil {
+		return err
+	}
+
+	err = m.db.Update(func(dbTx database.Tx) error {
+		return dbIndexDisconnectBlock(dbTx, indexer, block, stxos)
+	})
+	if err != nil {
+		return err
+	}
+
+	return indexer.Flush(&block.MsgBlock().Header.PrevBlock, blockchain.FlushIfNeeded, false)
+}
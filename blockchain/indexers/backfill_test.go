@@ -0,0 +1,182 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/txscript"
+)
+
+// backfillLeafDataIndex is a leaf data index that's caught up in the
+// background.
+type backfillLeafDataIndex struct {
+	*LeafDataIndex
+}
+
+// Backfills signals that the index is caught up in the background.
+func (idx backfillLeafDataIndex) Backfills() bool {
+	return true
+}
+
+// checkIndexInfo checks that the index is at the given block and whether it's
+// caught up to the main chain.
+func checkIndexInfo(t *testing.T, m *Manager, block *btcutil.Block, synced bool) {
+	t.Helper()
+
+	infos, err := m.IndexInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected the info of 1 index, got %d", len(infos))
+	}
+	info := infos[0]
+	if info.Hash != *block.Hash() || info.Height != block.Height() {
+		t.Fatalf("expected the index tip to be %v (%d), got %v (%d)",
+			block.Hash(), block.Height(), info.Hash, info.Height)
+	}
+	if info.Synced != synced {
+		t.Fatalf("expected synced to be %v, got %v", synced, info.Synced)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+
+	db, dbPath, err := createDB("TestBackfill")
+	defer func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a chain without the index.
+	config := blockchain.Config{
+		DB:               db,
+		ChainParams:      &params,
+		TimeSource:       blockchain.NewMedianTime(),
+		SigCache:         txscript.NewSigCache(1000),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+	}
+	chain, err := blockchain.New(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := btcutil.NewBlock(params.GenesisBlock)
+	b1, spends1, err := blockchain.AddBlock(chain, tip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextBlock, nextSpends := b1, spends1
+	for i := 0; i < 10; i++ {
+		nextBlock, nextSpends, err = blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = chain.FlushUtxoCache(blockchain.FlushRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Enable the index on the synced chain.  It's left behind when the
+	// chain is loaded and blocks keep being connected without it.
+	idx := NewLeafDataIndex(db)
+	indexer := backfillLeafDataIndex{idx}
+	indexManager := NewManager(db, []Indexer{indexer})
+	config.IndexManager = indexManager
+	chain, err = blockchain.New(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexManager.Stop()
+	for i := 0; i < 3; i++ {
+		nextBlock, nextSpends, err = blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := indexManager.IndexInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Synced || infos[0].Height != -1 {
+		t.Fatalf("expected the index to be left behind, got %+v", infos)
+	}
+
+	// Starting the manager catches up the index in the background.  The
+	// handler returns once it's caught up.
+	indexManager.Start()
+	indexManager.wg.Wait()
+	checkIndexInfo(t, indexManager, nextBlock, true)
+	checkLeafDataIndex(t, chain, db, idx)
+
+	// Leave the index behind again and reorganize the chain to a longer
+	// chain that forks off after the first block.  The tip of the index is
+	// no longer in the main chain.
+	indexManager.mtx.Lock()
+	indexManager.backfilling[indexer] = struct{}{}
+	indexManager.mtx.Unlock()
+	altBlock, altSpends := b1, []*blockchain.SpendableOut(nil)
+	for i := 0; i < 15; i++ {
+		altBlock, altSpends, err = blockchain.AddBlock(chain, altBlock, altSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chain.BestSnapshot().Hash != *altBlock.Hash() {
+		t.Fatalf("expected the chain to reorg to %v", altBlock.Hash())
+	}
+	checkIndexInfo(t, indexManager, nextBlock, false)
+
+	// Catching up disconnects the orphaned blocks from the index before
+	// connecting the new main chain.
+	err = indexManager.backfill(indexer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkIndexInfo(t, indexManager, altBlock, true)
+	checkLeafDataIndex(t, chain, db, idx)
+
+	// Once caught up, the index is connected to along with the chain.
+	for i := 0; i < 5; i++ {
+		altBlock, altSpends, err = blockchain.AddBlock(chain, altBlock, altSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkIndexInfo(t, indexManager, altBlock, true)
+	checkLeafDataIndex(t, chain, db, idx)
+}
+
+func TestIndexBackfills(t *testing.T) {
+	idx := &LeafDataIndex{}
+	m := NewManager(nil, nil)
+
+	// Only the indexes that opt in are caught up in the background unless
+	// the index sync is deferred.
+	if m.indexBackfills(idx) {
+		t.Fatal("expected the index to be caught up during initialization")
+	}
+	if !m.indexBackfills(backfillLeafDataIndex{idx}) {
+		t.Fatal("expected the opted in index to be caught up in the background")
+	}
+
+	m.SetDeferSync(true)
+	if !m.indexBackfills(idx) {
+		t.Fatal("expected the deferred index to be caught up in the background")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// copyFileSection copies the first size bytes of src to a new file at dst.
+func copyFileSection(src *os.File, size int64, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, io.NewSectionReader(src, 0, size))
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// copyFile copies the file at src to a new file at dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	return copyFileSection(in, fi.Size(), dst)
+}
+
+// Backup copies the offsetFile and the dataFile to the directory at path which
+// must not have them already.  The data stays the same while it's copied as
+// nothing is stored to or removed from the flat file state in the meantime.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) Backup(path string) error {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		file *os.File
+		name string
+	}{
+		{ff.offsetFile, offsetFileName},
+		{ff.dataFile, ff.name + dataFileSuffix},
+	} {
+		fi, err := f.file.Stat()
+		if err != nil {
+			return err
+		}
+		err = copyFileSection(f.file, fi.Size(), filepath.Join(path, f.name))
+		if err != nil {
+			return fmt.Errorf("unable to back up the %s flat file: %v",
+				ff.name, err)
+		}
+	}
+
+	return nil
+}
+
+// backup writes a checkpoint of the utreexo state database to where it'd be
+// with destDir as the data directory.  Only what was flushed is in the
+// checkpoint.  The pollard file is copied along with it when the accumulator is
+// kept in memory.
+func (us *UtreexoState) backup(destDir string) (string, error) {
+	destPath := filepath.Join(destDir, filepath.Base(utreexoBasePath(us.config)))
+	err := us.utreexoStateDB.Checkpoint(destPath, pebble.WithFlushedWAL())
+	if err != nil {
+		return "", fmt.Errorf("unable to checkpoint the utreexo state: %v", err)
+	}
+
+	if us.pollardPath != "" {
+		err = copyFile(us.pollardPath, filepath.Join(destPath, pollardFileName))
+		if err != nil {
+			return "", fmt.Errorf("unable to back up the pollard file: %v", err)
+		}
+	}
+
+	return destPath, nil
+}
+
+// backup copies the undo files to the directory at path.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) backup(path string) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		err = copyFile(filepath.Join(s.dir, entry.Name()),
+			filepath.Join(path, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("unable to back up the undo files: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Backup copies the utreexo state and the undo files of the index to destDir,
+// laid out the same way as they are in the data directory, and returns the
+// paths it wrote to.  The proofs are kept in the block database and aren't
+// copied.
+//
+// The index has to be flushed and no blocks may be connected to or disconnected
+// from it until Backup returns.  BlockChain.FlushIndexesAndRun takes care of
+// both.
+func (idx *UtreexoProofIndex) Backup(destDir string) ([]string, error) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	statePath, err := idx.utreexoState.backup(destDir)
+	if err != nil {
+		return nil, err
+	}
+	if idx.undoFiles != nil {
+		err = idx.undoFiles.backup(filepath.Join(statePath, undoDirName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []string{statePath}, nil
+}
+
+// Backup copies the utreexo state and the flat files of the index to destDir,
+// laid out the same way as they are in the data directory, and returns the
+// paths it wrote to.
+//
+// The index has to be flushed and no blocks may be connected to or disconnected
+// from it until Backup returns.  BlockChain.FlushIndexesAndRun takes care of
+// both.
+func (idx *FlatUtreexoProofIndex) Backup(destDir string) ([]string, error) {
+	// Keep the flat files from being compacted while they're copied.
+	idx.compactMtx.Lock()
+	defer idx.compactMtx.Unlock()
+
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	statePath, err := idx.utreexoState.backup(destDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{statePath}
+
+	for _, ff := range []*FlatFileState{&idx.proofState, &idx.undoState,
+		&idx.proofStatsState, &idx.rootsState, &idx.ttlState,
+		&idx.summaryState} {
+
+		// The flat files that aren't kept were never initialized.
+		if ff.dataFile == nil {
+			continue
+		}
+
+		path := flatFilePath(destDir, ff.name)
+		err = ff.Backup(path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// blockSpentLeaves returns the leaf datas of the outputs in the utxo set that
+// are spent by the passed block, which must extend the tip of the chain, in the
+// order they're spent.  Outputs created in the block itself are skipped as
+// they're never added to the accumulator.
+func blockSpentLeaves(chain *blockchain.BlockChain, block *btcutil.Block) (
+	[]wire.LeafData, error) {
+
+	// The spent outputs are passed in the order they're spent with a
+	// placeholder for the ones that are skipped.
+	_, _, inskip, _ := blockchain.DedupeBlock(block)
+	skip := make(map[uint32]struct{}, len(inskip))
+	for _, idx := range inskip {
+		skip[idx] = struct{}{}
+	}
+
+	txs := block.Transactions()
+	var stxos []blockchain.SpentTxOut
+	blockInIdx := uint32(len(txs[0].MsgTx().TxIn))
+	for _, tx := range txs[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			_, skipped := skip[blockInIdx]
+			blockInIdx++
+			if skipped {
+				stxos = append(stxos, blockchain.SpentTxOut{})
+				continue
+			}
+
+			prevOut := txIn.PreviousOutPoint
+			entry, err := chain.FetchUtxoEntry(prevOut)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil || entry.IsSpent() {
+				return nil, fmt.Errorf("output %v spent by tx %v "+
+					"is not in the utxo set", prevOut, tx.Hash())
+			}
+			stxos = append(stxos, blockchain.SpentTxOut{
+				Amount:     entry.Amount(),
+				PkScript:   entry.PkScript(),
+				Height:     entry.BlockHeight(),
+				IsCoinBase: entry.IsCoinBase(),
+			})
+		}
+	}
+
+	return blockchain.BlockToDelLeaves(stxos, chain, block, inskip)
+}
+
+// checkBlockProof checks the passed utreexo proof of the block the same way
+// nodes that only keep the accumulator do: it must prove exactly the outputs
+// spent by the block and verify against the roots with the passed function.
+func checkBlockProof(block *btcutil.Block, ud *wire.UData,
+	verify func([]utreexo.Hash, *utreexo.Proof) error) error {
+
+	err := blockchain.ProofSanity(ud, blockchain.BlockToDelOPs(block))
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]utreexo.Hash, 0, len(ud.LeafDatas))
+	for _, ld := range ud.LeafDatas {
+		hashes = append(hashes, ld.LeafHash())
+	}
+	return verify(hashes, &ud.AccProof)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// CoinAgeBounds are the largest ages in blocks of the outputs counted in each
+// element of CoinAgeStats.Buckets except for the last, which counts all the
+// older outputs.  They're roughly a day, a week, a month, six months, a year,
+// two years and five years.
+var CoinAgeBounds = []int32{144, 1008, 4320, 26280, 52560, 105120, 262800}
+
+// IsDustFunc returns whether an output of the given amount and public key
+// script is dust.
+type IsDustFunc func(amount int64, pkScript []byte) bool
+
+// CoinAgeBucket counts the unspent outputs within a range of ages.
+type CoinAgeBucket struct {
+	// Count and Amount are the number of outputs in the bucket and the sum
+	// of their amounts in satoshis.
+	Count  uint64
+	Amount int64
+
+	// DustCount and DustAmount are the same for only the dust outputs.
+	DustCount  uint64
+	DustAmount int64
+}
+
+// add counts an output of the given amount.
+func (b *CoinAgeBucket) add(amount int64, dust bool) {
+	b.Count++
+	b.Amount += amount
+	if dust {
+		b.DustCount++
+		b.DustAmount += amount
+	}
+}
+
+// CoinAgeStats is the distribution of the ages of the outputs in the utreexo
+// accumulator at a block.  The age of an output is the number of blocks since
+// the one that created it so outputs of the block itself have an age of 0.
+type CoinAgeStats struct {
+	// Height and BlockHash are the block the accumulator is at.
+	Height    int32
+	BlockHash chainhash.Hash
+
+	// Total counts all the outputs.
+	Total CoinAgeBucket
+
+	// Buckets count the outputs by age.  Element i counts the outputs
+	// older than CoinAgeBounds[i-1] up to an age of CoinAgeBounds[i].
+	Buckets []CoinAgeBucket
+}
+
+// newCoinAgeStats returns empty statistics of the accumulator at the block.
+func newCoinAgeStats(height int32, blockHash *chainhash.Hash) *CoinAgeStats {
+	return &CoinAgeStats{
+		Height:    height,
+		BlockHash: *blockHash,
+		Buckets:   make([]CoinAgeBucket, len(CoinAgeBounds)+1),
+	}
+}
+
+// add counts an output created at the given height.
+func (s *CoinAgeStats) add(height int32, amount int64, dust bool) {
+	age := s.Height - height
+	i := 0
+	for i < len(CoinAgeBounds) && age > CoinAgeBounds[i] {
+		i++
+	}
+	s.Buckets[i].add(amount, dust)
+	s.Total.add(amount, dust)
+}
+
+// CoinAgeStats returns the distribution of the ages of the outputs in the
+// utreexo accumulator at the tip of the index.  Every entry of the index is
+// read.  The interrupt channel stops the gathering early with an error.
+func (idx *LeafDataIndex) CoinAgeStats(isDust IsDustFunc,
+	interrupt <-chan struct{}) (*CoinAgeStats, error) {
+
+	var stats *CoinAgeStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, leafDataIndexKey)
+		if err != nil {
+			return err
+		}
+		stats = newCoinAgeStats(tipHeight, tipHash)
+
+		bucket := dbTx.Metadata().Bucket(leafDataIndexKey)
+		return bucket.ForEach(func(k, v []byte) error {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+
+			var leafData wire.LeafData
+			err := leafData.Deserialize(bytes.NewReader(v))
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt leaf data "+
+						"index entry for %x: %v", k, err),
+				}
+			}
+			stats.add(leafData.Height, leafData.Amount,
+				isDust(leafData.Amount, leafData.PkScript))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CoinAgeStats returns the distribution of the ages of the outputs in the
+// utreexo accumulator at the given height.  The outputs are found from the leaf
+// ttls of every block up to the height, which are read along with the blocks.
+// The interrupt channel stops the gathering early with an error.
+func (idx *FlatUtreexoProofIndex) CoinAgeStats(height int32, isDust IsDustFunc,
+	interrupt <-chan struct{}) (*CoinAgeStats, error) {
+
+	if !idx.config.LeafTTLs {
+		return nil, fmt.Errorf("the leaf ttls are not kept by the flat " +
+			"utreexo proof index")
+	}
+	if height <= 0 || height > idx.ttlState.BestHeight() {
+		return nil, fmt.Errorf("no leaf ttls for height %d. The leaf ttls "+
+			"are kept for heights 1 to %d", height, idx.ttlState.BestHeight())
+	}
+
+	blockHash, err := idx.chain.BlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := newCoinAgeStats(height, blockHash)
+	for h := int32(1); h <= height; h++ {
+		if interruptRequested(interrupt) {
+			return nil, errInterruptRequested
+		}
+
+		block, err := idx.chain.BlockByHeight(h)
+		if err != nil {
+			return nil, err
+		}
+		record, err := idx.ttlState.FetchData(h)
+		if err != nil {
+			return nil, err
+		}
+		leafTTLs, err := deserializeLeafTTLs(record, blockAddOutPoints(block))
+		if err != nil {
+			return nil, fmt.Errorf("leaf ttl record at height %d doesn't "+
+				"match the block %v: %v", h, block.Hash(), err)
+		}
+
+		txs := make(map[chainhash.Hash]*wire.MsgTx, len(block.Transactions()))
+		for _, tx := range block.Transactions() {
+			txs[*tx.Hash()] = tx.MsgTx()
+		}
+		for _, leafTTL := range leafTTLs {
+			// Skip the outputs that were spent by the height.
+			if leafTTL.TTL != 0 && h+leafTTL.TTL <= height {
+				continue
+			}
+
+			txOut := txs[leafTTL.OutPoint.Hash].TxOut[leafTTL.OutPoint.Index]
+			stats.add(h, txOut.Value, isDust(txOut.Value, txOut.PkScript))
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestCoinAgeStats(t *testing.T) {
+	t.Parallel()
+
+	stats := newCoinAgeStats(300000, &chainhash.Hash{})
+	tests := []struct {
+		height int32
+		amount int64
+		dust   bool
+		bucket int
+	}{
+		{300000, 100, true, 0},
+		{300000 - 144, 1000, false, 0},
+		{300000 - 145, 2000, false, 1},
+		{300000 - 4320, 3000, true, 2},
+		{300000 - 262800, 4000, false, 6},
+		{1, 5000, false, 7},
+	}
+	for _, test := range tests {
+		before := stats.Buckets[test.bucket]
+		stats.add(test.height, test.amount, test.dust)
+
+		after := stats.Buckets[test.bucket]
+		if after.Count != before.Count+1 ||
+			after.Amount != before.Amount+test.amount {
+
+			t.Fatalf("output at height %d wasn't counted in bucket %d",
+				test.height, test.bucket)
+		}
+		if test.dust && after.DustCount != before.DustCount+1 {
+			t.Fatalf("dust output at height %d wasn't counted as dust",
+				test.height)
+		}
+	}
+
+	want := CoinAgeBucket{Count: 6, Amount: 15100, DustCount: 2, DustAmount: 3100}
+	if stats.Total != want {
+		t.Fatalf("expected a total of %+v, got %+v", want, stats.Total)
+	}
+}
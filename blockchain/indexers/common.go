@@ -33,6 +33,13 @@ type NeedsInputser interface {
 	NeedsInputs() bool
 }
 
+// Backfiller provides a generic interface for an indexer to specify that it
+// can be caught up to the main chain in the background while new blocks keep
+// being connected instead of during initialization.
+type Backfiller interface {
+	Backfills() bool
+}
+
 // Indexer provides a generic interface for an indexer that is managed by an
 // index manager such as the Manager type provided by this package.
 type Indexer interface {
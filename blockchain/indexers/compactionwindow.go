@@ -0,0 +1,165 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CompactionWindow is a daily span of local time that the heavy maintenance
+// work of the utreexo proof indexes, such as compacting the utreexo state
+// database and dropping the proofs of old blocks, is done in.  The window wraps
+// around midnight when it ends before it starts.
+type CompactionWindow struct {
+	// Start and End are the offsets from midnight the window starts and
+	// ends at.
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseCompactionWindow parses a compaction window in the form of
+// "HH:MM-HH:MM".
+func ParseCompactionWindow(s string) (CompactionWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return CompactionWindow{}, fmt.Errorf("compaction window %q "+
+			"is not in the form of HH:MM-HH:MM", s)
+	}
+
+	var offsets [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return CompactionWindow{}, fmt.Errorf("compaction window "+
+				"%q has an invalid time %q", s, part)
+		}
+		offsets[i] = time.Duration(t.Hour())*time.Hour +
+			time.Duration(t.Minute())*time.Minute
+	}
+	if offsets[0] == offsets[1] {
+		return CompactionWindow{}, fmt.Errorf("compaction window %q "+
+			"is empty", s)
+	}
+
+	return CompactionWindow{Start: offsets[0], End: offsets[1]}, nil
+}
+
+// String returns the window in the form it's parsed from.
+func (w CompactionWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour),
+			int(d%time.Hour/time.Minute))
+	}
+	return format(w.Start) + "-" + format(w.End)
+}
+
+// contains returns whether the given time falls within the window.
+func (w CompactionWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// InCompactionWindow returns whether the given time falls within any of the
+// windows.  Any time does when no windows are given.
+func InCompactionWindow(windows []CompactionWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compactDB compacts all the keys of the utreexo state database.  The keys are
+// compacted in ranges of their first byte, each of which is run within the
+// quota so that the compaction only takes up its share of the machine.
+func (us *UtreexoState) compactDB(quota *CPUQuota, quit <-chan struct{}) error {
+	iter, err := us.utreexoStateDB.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	var first, last []byte
+	if iter.First() {
+		first = append([]byte(nil), iter.Key()...)
+	}
+	if iter.Last() {
+		last = append([]byte(nil), iter.Key()...)
+	}
+	err = iter.Close()
+	if err != nil {
+		return err
+	}
+	if len(first) == 0 || len(last) == 0 {
+		return nil
+	}
+
+	for b := int(first[0]); b <= int(last[0]); b++ {
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+
+		start, end := []byte{byte(b)}, []byte{byte(b + 1)}
+		if b == int(last[0]) {
+			// The end is exclusive so the last key is compacted
+			// by ending right after it.
+			end = append(append([]byte(nil), last...), 0)
+		}
+		err = quota.Run(quit, func() error {
+			return us.utreexoStateDB.Compact(start, end, false)
+		})
+		if err == errInterruptRequested {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunCompactions compacts the utreexo state database within the CPU quota of
+// the config.  It's meant to be run in a compaction window, the heavy work is
+// interrupted when quit is closed.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoProofIndex) RunCompactions(quit <-chan struct{}) error {
+	idx.mtx.RLock()
+	us := idx.utreexoState
+	idx.mtx.RUnlock()
+
+	return us.compactDB(idx.config.CPUQuota, quit)
+}
+
+// RunCompactions drops the proofs below the prune height from the config that
+// were held back for a compaction window and compacts the utreexo state
+// database, both within the CPU quota of the config.  It's meant to be run in a
+// compaction window, the heavy work is interrupted when quit is closed.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) RunCompactions(quit <-chan struct{}) error {
+	err := idx.compactConfiguredProofs(idx.config.CPUQuota)
+	if err != nil {
+		return err
+	}
+
+	idx.mtx.RLock()
+	us := idx.utreexoState
+	idx.mtx.RUnlock()
+
+	return us.compactDB(idx.config.CPUQuota, quit)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCompactionWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		valid  bool
+	}{
+		{"02:00-05:30", true},
+		{"23:00-01:00", true},
+		{" 01:00 - 02:00 ", true},
+		{"02:00", false},
+		{"02:00-05:00-06:00", false},
+		{"25:00-05:00", false},
+		{"02:00-02:00", false},
+	}
+	for _, test := range tests {
+		w, err := ParseCompactionWindow(test.window)
+		if test.valid != (err == nil) {
+			t.Errorf("%q: unexpected error %v", test.window, err)
+			continue
+		}
+		if err == nil && test.window[0] != ' ' && w.String() != test.window {
+			t.Errorf("%q: got %q back", test.window, w.String())
+		}
+	}
+}
+
+func TestInCompactionWindow(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	at := func(hour, min int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour +
+			time.Duration(min)*time.Minute)
+	}
+
+	night, err := ParseCompactionWindow("23:00-01:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	morning, err := ParseCompactionWindow("04:00-05:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows := []CompactionWindow{night, morning}
+
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(23, 0), true},
+		{at(0, 30), true},
+		{at(1, 30), false},
+		{at(3, 59), false},
+		{at(4, 30), true},
+		{at(5, 0), false},
+		{at(12, 0), false},
+	}
+	for _, test := range tests {
+		got := InCompactionWindow(windows, test.t)
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.t.Format("15:04"),
+				got, test.want)
+		}
+	}
+
+	if !InCompactionWindow(nil, at(12, 0)) {
+		t.Error("expected any time to be allowed without windows")
+	}
+}
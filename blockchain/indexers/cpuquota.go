@@ -0,0 +1,88 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"math"
+	"runtime"
+	"time"
+)
+
+// CPUQuota caps the share of the CPU cores that background tasks such as
+// catching up indexes and compacting proofs may use so that they don't take
+// the cores away from the validation of new blocks.
+//
+// The work of the background tasks is split into units that are run with Run.
+// Only as many units as there are whole cores in the quota run at once and a
+// fractional core is enforced by idling after each unit for long enough that
+// the unit only used its share of the time.
+//
+// A nil CPUQuota doesn't cap anything.
+type CPUQuota struct {
+	// tokens holds a token for each unit that's running.
+	tokens chan struct{}
+
+	// duty is the share of the time a unit may keep its core busy.
+	duty float64
+}
+
+// NewCPUQuota returns a CPUQuota that caps the background tasks to the given
+// percentage of the CPU cores.  nil is returned for 100 percent or more as
+// nothing is capped then.
+func NewCPUQuota(percent int) *CPUQuota {
+	if percent >= 100 {
+		return nil
+	}
+	if percent < 1 {
+		percent = 1
+	}
+
+	cores := float64(runtime.NumCPU()) * float64(percent) / 100
+	numTokens := math.Ceil(cores)
+	return &CPUQuota{
+		tokens: make(chan struct{}, int(numTokens)),
+		duty:   cores / numTokens,
+	}
+}
+
+// Cores returns the number of cores the background tasks may use.  It's the
+// number of CPU cores when the quota is nil.
+func (q *CPUQuota) Cores() float64 {
+	if q == nil {
+		return float64(runtime.NumCPU())
+	}
+	return float64(cap(q.tokens)) * q.duty
+}
+
+// Run runs a unit of background work within the quota.  It waits for a core
+// to be free before running fn and idles after it for the rest of the share of
+// the core.  errInterruptRequested is returned when quit is closed before fn
+// is run.  The idling is cut short when quit is closed after it is run.
+//
+// This function is safe for concurrent access.
+func (q *CPUQuota) Run(quit <-chan struct{}, fn func() error) error {
+	if q == nil {
+		return fn()
+	}
+
+	select {
+	case q.tokens <- struct{}{}:
+	case <-quit:
+		return errInterruptRequested
+	}
+	defer func() { <-q.tokens }()
+
+	start := time.Now()
+	err := fn()
+	if q.duty < 1 {
+		idle := time.Duration(float64(time.Since(start)) * (1/q.duty - 1))
+		select {
+		case <-time.After(idle):
+		case <-quit:
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCPUQuota(t *testing.T) {
+	t.Parallel()
+
+	// Nothing is capped at 100 percent.
+	if q := NewCPUQuota(100); q != nil {
+		t.Fatalf("expected no quota at 100 percent, got %v cores", q.Cores())
+	}
+	var nilQuota *CPUQuota
+	if nilQuota.Cores() != float64(runtime.NumCPU()) {
+		t.Fatalf("expected %d cores, got %v", runtime.NumCPU(),
+			nilQuota.Cores())
+	}
+	testErr := errors.New("test")
+	err := nilQuota.Run(nil, func() error { return testErr })
+	if err != testErr {
+		t.Fatalf("expected %v, got %v", testErr, err)
+	}
+
+	// The quota is never less than a percent of the cores.
+	want := float64(runtime.NumCPU()) / 100
+	if got := NewCPUQuota(0).Cores(); got < want-1e-9 || got > want+1e-9 {
+		t.Fatalf("expected %v cores, got %v", want, got)
+	}
+
+	// A unit with half a core idles for as long as it ran.
+	q := &CPUQuota{tokens: make(chan struct{}, 1), duty: 0.5}
+	const work = 20 * time.Millisecond
+	start := time.Now()
+	err = q.Run(nil, func() error {
+		time.Sleep(work)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*work {
+		t.Fatalf("expected the unit to take at least %v, took %v",
+			2*work, elapsed)
+	}
+
+	// A unit waiting for a core gives up once quit is closed.
+	q.tokens <- struct{}{}
+	quit := make(chan struct{})
+	close(quit)
+	err = q.Run(quit, func() error {
+		t.Fatal("the unit ran without a free core")
+		return nil
+	})
+	if err != errInterruptRequested {
+		t.Fatalf("expected %v, got %v", errInterruptRequested, err)
+	}
+	<-q.tokens
+}
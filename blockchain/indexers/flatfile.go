@@ -7,9 +7,13 @@ package indexers
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 )
 
@@ -25,13 +29,54 @@ const (
 
 	// dataFileSuffix is the suffix given to the dataFile name.
 	dataFileSuffix = ".dat"
+
+	// flatFileVersion is the version of the dataFile format that's written.
+	// Version 0 dataFiles have no header and their entries have no
+	// checksums.  Version 1 dataFiles start with a header and every entry
+	// carries the checksum of its data.
+	flatFileVersion = 1
+
+	// fileHeaderSize is the size of the header at the start of the dataFile.
+	// It holds the file magic bytes followed by the version.
+	fileHeaderSize = 8
 )
 
 var (
 	// magicBytes are the bytes prepended to any entry in the dataFiles.
 	magicBytes = [4]byte{0xaa, 0xff, 0xaa, 0xff}
+
+	// fileMagicBytes are the bytes at the start of the header of the
+	// dataFiles.
+	fileMagicBytes = [4]byte{0x75, 0x74, 0x78, 0x66}
+
+	// crcTable is the table used to calculate the checksums of the entries.
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// errFlatFileReadOnly is returned when writing to a FlatFileState that
+	// was initialized with InitReadOnly.
+	errFlatFileReadOnly = errors.New("the flat file state is read only")
 )
 
+// ErrCorruptProof is returned when the data stored for a height in a flat
+// file state doesn't read back as it was written, such as when the disk it's
+// on suffers from bit-rot.
+type ErrCorruptProof struct {
+	// Name is the name of the data of the flat file state.
+	Name string
+
+	// Height is the height of the corrupt entry.
+	Height int32
+
+	// Reason describes what's wrong with the entry.
+	Reason string
+}
+
+// Error returns the description of the corrupt entry.
+func (e ErrCorruptProof) Error() string {
+	return fmt.Sprintf("corrupt %s entry at height %d: %s", e.Name,
+		e.Height, e.Reason)
+}
+
 // FlatFileState is the shared state for storing flatfiles.  It is specifically designed
 // for the utreexo proofs and stores data as a [key-value] of [height-data].
 type FlatFileState struct {
@@ -57,6 +102,113 @@ type FlatFileState struct {
 	// NOTE Since we account for the genesis block in the offsets, to fetch data for
 	// height x, you'd do 'offsets[x]' and not 'offsets[x-1]'.
 	offsets []int64
+
+	// syncWrites makes every store fsync the dataFile and the offsetFile
+	// before returning.
+	syncWrites bool
+
+	// compactedHeight is the height up to which the data was dropped from
+	// the dataFile by Compact.  The offsets of the compacted heights are
+	// kept so that the offsets of the rest of the data stay the same.
+	compactedHeight int32
+
+	// name is the name of the data kept in the dataFile.
+	name string
+
+	// version is the version of the format of the dataFile.
+	version uint32
+
+	// readOnly is set when the FlatFileState was initialized with
+	// InitReadOnly.  Nothing is written to the files then.
+	readOnly bool
+}
+
+// entryHeaderSize returns the size of what's written in front of the data of
+// every entry.  That's the magic bytes and the size of the data, followed by
+// the checksum of the data from version 1 on.
+func (ff *FlatFileState) entryHeaderSize() int64 {
+	if ff.version == 0 {
+		return 8
+	}
+
+	return 12
+}
+
+// corruptErr returns an ErrCorruptProof for the entry at the given height.
+func (ff *FlatFileState) corruptErr(height int32, format string, args ...interface{}) error {
+	return ErrCorruptProof{
+		Name:   ff.name,
+		Height: height,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// entryEnd returns the offset in the dataFile where the entry for the given
+// height ends.
+//
+// This function MUST be called with the mutex held.
+func (ff *FlatFileState) entryEnd(height int32) int64 {
+	if height < ff.currentHeight {
+		return ff.offsets[height+1]
+	}
+
+	return ff.currentOffset
+}
+
+// readEntry reads and checks the data of the entry stored for the given
+// height.  An ErrCorruptProof is returned when the entry doesn't read back as
+// it was written.
+//
+// This function MUST be called with the mutex held.
+func (ff *FlatFileState) readEntry(height int32) ([]byte, error) {
+	// Grab the offset for where the data is in the dataFile.
+	offset := ff.offsets[height]
+
+	// Read from the dataFile.  This read will grab the magic bytes, the
+	// size bytes and the checksum.
+	headerSize := ff.entryHeaderSize()
+	buf := make([]byte, headerSize)
+	_, err := ff.dataFile.ReadAt(buf, offset)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ff.corruptErr(height, "entry is truncated")
+		}
+		return nil, err
+	}
+
+	// Sanity check.  If wrong magic was read, then error out.
+	if !bytes.Equal(buf[:4], magicBytes[:]) {
+		return nil, ff.corruptErr(height, "read wrong magic bytes. "+
+			"Expect %x but got %x", magicBytes, buf[:4])
+	}
+
+	// Size of the actual data we want to fetch.  The entries are stored
+	// back to back so it has to fill up the space up to the next entry.
+	size := binary.BigEndian.Uint32(buf[4:8])
+	if offset+headerSize+int64(size) != ff.entryEnd(height) {
+		return nil, ff.corruptErr(height, "size of %d bytes doesn't "+
+			"match the %d bytes the entry takes up", size,
+			ff.entryEnd(height)-offset-headerSize)
+	}
+
+	// Now do the actual read of the data from the dataFile.
+	dataBuf := make([]byte, size)
+	_, err = ff.dataFile.ReadAt(dataBuf, offset+headerSize)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ff.corruptErr(height, "entry is truncated")
+		}
+		return nil, err
+	}
+
+	if ff.version > 0 {
+		checksum := binary.BigEndian.Uint32(buf[8:12])
+		if crc32.Checksum(dataBuf, crcTable) != checksum {
+			return nil, ff.corruptErr(height, "checksum mismatch")
+		}
+	}
+
+	return dataBuf, nil
 }
 
 // recoverOffsetFile recovers the offset file to the latest readable offset.
@@ -69,27 +221,15 @@ func (ff *FlatFileState) recoverOffsetFile(fileSize int64) error {
 // reable stored data.
 func (ff *FlatFileState) recover() error {
 	log.Infof("Recovering flatfile as it's not consistent")
-	buf := make([]byte, 8)
-	for ; ff.currentHeight > 0; ff.currentHeight-- {
-		// Read from the dataFile.  This read will grab the magic bytes and the
-		// size bytes.
+
+	// The compacted data can't be recovered so don't roll back past it.
+	for ; ff.currentHeight > ff.compactedHeight; ff.currentHeight-- {
 		offset := ff.offsets[ff.currentHeight]
 
-		_, err := ff.dataFile.ReadAt(buf, offset)
-		if err == nil && bytes.Equal(buf[:4], magicBytes[:]) {
-			// Size of the actual data we want to fetch.
-			size := binary.BigEndian.Uint32(buf[4:])
-
-			// Read the data.
-			dataBuf := make([]byte, size)
-			read, err := ff.dataFile.ReadAt(dataBuf, offset+8)
-			if err == nil && uint32(read) == size {
-				_, err := ff.FetchData(ff.currentHeight)
-				if err == nil {
-					// If we're able to read the data bytes, then return here.
-					return nil
-				}
-			}
+		// If we're able to read the data bytes, then return here.
+		_, err := ff.readEntry(ff.currentHeight)
+		if err == nil {
+			return nil
 		}
 
 		// Truncating when the offset is bigger will append 0s.
@@ -147,6 +287,12 @@ func (ff *FlatFileState) Init(path, dataName string) error {
 	if err != nil {
 		return err
 	}
+	ff.name = dataName
+
+	err = ff.initHeader()
+	if err != nil {
+		return err
+	}
 
 	// Seek to end to get the number of offsets in the file (# of blocks).
 	offsetFileSize, err := ff.offsetFile.Seek(0, 2)
@@ -167,32 +313,16 @@ func (ff *FlatFileState) Init(path, dataName string) error {
 	// If the file size is bigger than 0, we're resuming and will read all
 	// existing offsets to ff.offsets.
 	if offsetFileSize > 0 {
-		// -1 since we have to account for the genesis block of height 0.
-		ff.currentHeight = int32(offsetFileSize/8) - 1
-
-		// Seek back to the file start / block "0".
-		_, err := ff.offsetFile.Seek(0, 0)
+		err = ff.readOffsets(offsetFileSize)
 		if err != nil {
 			return err
 		}
-		ff.offsets = make([]int64, offsetFileSize/8)
-
-		// Go through the entire offset file and read&store every offset in memory.
-		for i := int32(0); i <= ff.currentHeight; i++ {
-			err = binary.Read(ff.offsetFile, binary.BigEndian, &ff.currentOffset)
-			if err != nil {
-				return err
-			}
-
-			ff.offsets[i] = ff.currentOffset
-		}
 
 		// Set the currentOffset to the end of the data file.
 		ff.currentOffset, err = ff.dataFile.Seek(0, 2)
 		if err != nil {
 			return err
 		}
-
 	} else {
 		// We don't save block 0 with utreexo proof index.  Just append
 		// 0s since we don't keep it.
@@ -203,6 +333,12 @@ func (ff *FlatFileState) Init(path, dataName string) error {
 
 		// Do the same with the in-ram slice.
 		ff.offsets = make([]int64, 1)
+
+		// The data starts after the header.
+		ff.currentOffset, err = ff.dataFile.Seek(0, 2)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Test if we can fetch the last stored data.
@@ -215,6 +351,238 @@ func (ff *FlatFileState) Init(path, dataName string) error {
 	return ff.recover()
 }
 
+// readOffsets reads the offsets in the first offsetFileSize bytes of the
+// offsetFile to memory.
+func (ff *FlatFileState) readOffsets(offsetFileSize int64) error {
+	// -1 since we have to account for the genesis block of height 0.
+	ff.currentHeight = int32(offsetFileSize/8) - 1
+
+	// Seek back to the file start / block "0".
+	_, err := ff.offsetFile.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+	ff.offsets = make([]int64, offsetFileSize/8)
+
+	// Go through the entire offset file and read&store every offset in memory.
+	for i := int32(0); i <= ff.currentHeight; i++ {
+		err = binary.Read(ff.offsetFile, binary.BigEndian, &ff.currentOffset)
+		if err != nil {
+			return err
+		}
+
+		ff.offsets[i] = ff.currentOffset
+	}
+
+	ff.compactedHeight = ff.findCompactedHeight()
+
+	return nil
+}
+
+// InitReadOnly initializes the FlatFileState from the existing files at path
+// without writing to them so that the files of a running node can be read.
+// Only the entries that are fully written when it's called are read and an
+// entry that's still being written is left out instead of being recovered.
+// The FlatFileState can't be written to afterwards.
+func (ff *FlatFileState) InitReadOnly(path, dataName string) error {
+	var err error
+	ff.offsetFile, err = os.Open(filepath.Join(path, offsetFileName))
+	if err != nil {
+		return err
+	}
+	ff.dataFile, err = os.Open(filepath.Join(path, dataName+dataFileSuffix))
+	if err != nil {
+		ff.offsetFile.Close()
+		return err
+	}
+	ff.name = dataName
+	ff.readOnly = true
+
+	err = ff.initHeader()
+	if err != nil {
+		ff.Close()
+		return err
+	}
+
+	offsetFileSize, err := ff.offsetFile.Seek(0, 2)
+	if err != nil {
+		ff.Close()
+		return err
+	}
+	if offsetFileSize < 8 {
+		ff.Close()
+		return fmt.Errorf("the %s flat file at %s has no offsets",
+			dataName, path)
+	}
+
+	// Leave out the offset that may be partially written.
+	err = ff.readOffsets(offsetFileSize - offsetFileSize%8)
+	if err != nil {
+		ff.Close()
+		return err
+	}
+
+	// The offset of an entry is written before its data so the data of the
+	// last entries may not be there yet.  The end of the last entry is
+	// taken from the size in its header as the data of the entry after it
+	// may already be written.
+	for ; ff.currentHeight > ff.compactedHeight; ff.currentHeight-- {
+		ff.currentOffset, err = ff.storedEntryEnd(ff.currentHeight)
+		if err == nil {
+			_, err = ff.readEntry(ff.currentHeight)
+			if err == nil {
+				break
+			}
+		}
+		ff.offsets = ff.offsets[:ff.currentHeight]
+	}
+
+	return nil
+}
+
+// storedEntryEnd returns where the entry for the given height ends in the
+// dataFile according to the size in the header of the entry.
+func (ff *FlatFileState) storedEntryEnd(height int32) (int64, error) {
+	buf := make([]byte, 8)
+	_, err := ff.dataFile.ReadAt(buf, ff.offsets[height])
+	if err != nil {
+		return 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(buf[4:8]))
+
+	return ff.offsets[height] + ff.entryHeaderSize() + size, nil
+}
+
+// Close closes the offsetFile and the dataFile.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) Close() error {
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
+
+	err := ff.offsetFile.Close()
+	dataErr := ff.dataFile.Close()
+	if err != nil {
+		return err
+	}
+	return dataErr
+}
+
+// initHeader writes the header to a new dataFile or reads the version from the
+// header of an existing one.  dataFiles written before the header was added
+// don't have one and are read as version 0.
+func (ff *FlatFileState) initHeader() error {
+	dataFileSize, err := ff.dataFile.Seek(0, 2)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, fileHeaderSize)
+	if dataFileSize == 0 {
+		ff.version = flatFileVersion
+		if ff.readOnly {
+			return nil
+		}
+
+		copy(buf[:4], fileMagicBytes[:])
+		binary.BigEndian.PutUint32(buf[4:], flatFileVersion)
+		_, err = ff.dataFile.WriteAt(buf, 0)
+		return err
+	}
+
+	_, err = ff.dataFile.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Equal(buf[:4], fileMagicBytes[:]) {
+		ff.version = 0
+		return nil
+	}
+
+	ff.version = binary.BigEndian.Uint32(buf[4:])
+	if ff.version > flatFileVersion {
+		return fmt.Errorf("the %s flat file is of version %d but only "+
+			"versions up to %d are supported", ff.name, ff.version,
+			flatFileVersion)
+	}
+
+	return nil
+}
+
+// isCompacted returns whether the data for the given height was dropped by
+// Compact.  The dropped data reads as zeros so the magic bytes are missing.
+func (ff *FlatFileState) isCompacted(height int32) bool {
+	buf := make([]byte, len(magicBytes))
+	_, err := ff.dataFile.ReadAt(buf, ff.offsets[height])
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(buf, make([]byte, len(magicBytes)))
+}
+
+// findCompactedHeight returns the height up to which the data was dropped from
+// the dataFile.  Only the data at the start of the file is ever dropped so it's
+// searched for the first height that still has its data.
+func (ff *FlatFileState) findCompactedHeight() int32 {
+	if ff.currentHeight <= 0 || !ff.isCompacted(1) {
+		return 0
+	}
+
+	return int32(sort.Search(int(ff.currentHeight), func(i int) bool {
+		return !ff.isCompacted(int32(i) + 1)
+	}))
+}
+
+// Compact drops the data stored for the heights up to and including the given
+// height from the dataFile and frees up the disk space it took up.  The data
+// for those heights can't be fetched afterwards.  The data for the latest
+// height is never dropped.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) Compact(height int32) error {
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
+
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
+	if height <= ff.compactedHeight {
+		return nil
+	}
+	if height >= ff.currentHeight {
+		return fmt.Errorf("can't compact up to height %d as the latest "+
+			"height stored is %d", height, ff.currentHeight)
+	}
+
+	start := ff.offsets[ff.compactedHeight+1]
+	end := ff.offsets[height+1]
+	err := punchHole(ff.dataFile, start, end-start)
+	if err != nil {
+		return err
+	}
+	if ff.syncWrites {
+		err = ff.dataFile.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	ff.compactedHeight = height
+
+	return nil
+}
+
+// CompactedHeight returns the height up to which the data was dropped from the
+// flat file state.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) CompactedHeight() int32 {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
+	return ff.compactedHeight
+}
+
 // StoreData stores the given byte slice as a new entry in the dataFile.
 // Two important things to note:
 //
@@ -232,6 +600,10 @@ func (ff *FlatFileState) StoreData(height int32, data []byte) error {
 	ff.mtx.Lock()
 	defer ff.mtx.Unlock()
 
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
+
 	// We only accept the next block in seqence.
 	if height != ff.currentHeight+1 || height <= 0 {
 		return fmt.Errorf("Passed in height not the next block in sequence. "+
@@ -239,7 +611,8 @@ func (ff *FlatFileState) StoreData(height int32, data []byte) error {
 	}
 
 	// Pre-allocate the needed buffer.
-	buf := make([]byte, len(data)+8)
+	headerSize := ff.entryHeaderSize()
+	buf := make([]byte, int64(len(data))+headerSize)
 
 	// Slice the buffer to 8 bytes and encode the offset to it.
 	buf = buf[:8]
@@ -253,21 +626,37 @@ func (ff *FlatFileState) StoreData(height int32, data []byte) error {
 	}
 
 	// Re-slice the buffer to the total length.
-	buf = buf[:len(data)+8]
+	buf = buf[:int64(len(data))+headerSize]
 
-	// Add the magic bytes, size, and the data to the buffer to be written.
+	// Add the magic bytes, size, checksum and the data to the buffer to be
+	// written.
 	copy(buf[:4], magicBytes[:])
 	binary.BigEndian.PutUint32(buf[4:8], uint32(len(data)))
-	copy(buf[8:], data)
+	if ff.version > 0 {
+		binary.BigEndian.PutUint32(buf[8:12], crc32.Checksum(data, crcTable))
+	}
+	copy(buf[headerSize:], data)
 
-	// Write the magic+size+data to the dataFile.
+	// Write the magic+size+checksum+data to the dataFile.
 	_, err = ff.dataFile.WriteAt(buf, ff.currentOffset)
 	if err != nil {
 		return err
 	}
 
-	// Increment the current offset.  +8 to account for the magic bytes and size.
-	ff.currentOffset += int64(len(data)) + 8
+	if ff.syncWrites {
+		err = ff.dataFile.Sync()
+		if err != nil {
+			return err
+		}
+		err = ff.offsetFile.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Increment the current offset to account for the magic bytes, size and
+	// checksum as well.
+	ff.currentOffset += int64(len(buf))
 
 	// Finally, increment the currentHeight.
 	ff.currentHeight++
@@ -277,7 +666,8 @@ func (ff *FlatFileState) StoreData(height int32, data []byte) error {
 
 // FetchData fetches the data stored for the given block height.  Returns
 // nil if the requested height is greater than the one it stored.  Also
-// returns nil if asked to fetch height 0.
+// returns nil if asked to fetch height 0.  An ErrCorruptProof is returned
+// when the stored data doesn't match its checksum.
 //
 // This function is safe for concurrent access.
 func (ff *FlatFileState) FetchData(height int32) ([]byte, error) {
@@ -289,35 +679,181 @@ func (ff *FlatFileState) FetchData(height int32) ([]byte, error) {
 	if height > ff.currentHeight || height <= 0 {
 		return nil, nil
 	}
+	if height <= ff.compactedHeight {
+		return nil, fmt.Errorf("the data for height %d was dropped when "+
+			"compacting up to height %d", height, ff.compactedHeight)
+	}
 
-	// Grab the offset for where the data is in the dataFile.
-	offset := ff.offsets[height]
+	return ff.readEntry(height)
+}
 
-	// Read from the dataFile.  This read will grab the magic bytes and the
-	// size bytes.
-	buf := make([]byte, 8)
-	_, err := ff.dataFile.ReadAt(buf, offset)
+// dataLocation returns the offset in the dataFile of the data stored for the
+// given height, skipping the magic bytes, the size and the checksum, and the
+// size of the data.
+//
+// This function MUST be called with the mutex held.
+func (ff *FlatFileState) dataLocation(height int32) (int64, int64, error) {
+	if height > ff.currentHeight || height <= 0 {
+		return 0, 0, fmt.Errorf("no data stored for height %d", height)
+	}
+	if height <= ff.compactedHeight {
+		return 0, 0, fmt.Errorf("the data for height %d was dropped when "+
+			"compacting up to height %d", height, ff.compactedHeight)
+	}
+
+	offset := ff.offsets[height] + ff.entryHeaderSize()
+	return offset, ff.entryEnd(height) - offset, nil
+}
+
+// FetchDataAt reads len(buf) bytes of the data stored for the given block
+// height into buf, starting at the given offset within the data.  The checksum
+// of the data isn't checked as only a part of the data is read.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) FetchDataAt(height int32, buf []byte, offset int64) error {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
+	dataOffset, size, err := ff.dataLocation(height)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if offset < 0 || offset+int64(len(buf)) > size {
+		return fmt.Errorf("can't read %d bytes at offset %d of the %d "+
+			"bytes stored for height %d", len(buf), offset, size, height)
 	}
 
-	// Sanity check.  If wrong magic was read, then error out.
-	if !bytes.Equal(buf[:4], magicBytes[:]) {
-		return nil, fmt.Errorf("Read wrong magic bytes. Expect %x but got %x",
-			magicBytes, buf[:4])
+	_, err = ff.dataFile.ReadAt(buf, dataOffset+offset)
+	return err
+}
+
+// DataSize returns the size of the data stored for the given block height.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) DataSize(height int32) (int64, error) {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
+	_, size, err := ff.dataLocation(height)
+	return size, err
+}
+
+// FileSizes returns the sizes of the dataFile and the offsetFile.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) FileSizes() (int64, int64, error) {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
+	dataInfo, err := ff.dataFile.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	offsetInfo, err := ff.offsetFile.Stat()
+	if err != nil {
+		return 0, 0, err
 	}
 
-	// Size of the actual data we want to fetch.
-	size := binary.BigEndian.Uint32(buf[4:])
+	return dataInfo.Size(), offsetInfo.Size(), nil
+}
 
-	// Now do the actual read of the data from the dataFile.
-	dataBuf := make([]byte, size)
-	_, err = ff.dataFile.ReadAt(dataBuf, offset+8)
+// UpdateData overwrites the data stored for the given block height with the
+// passed in data, starting at the given offset within the data.  The size of
+// the stored data can't be changed.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) UpdateData(height int32, data []byte, offset int64) error {
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
+
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
+
+	dataOffset, size, err := ff.dataLocation(height)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if offset < 0 || offset+int64(len(data)) > size {
+		return fmt.Errorf("can't write %d bytes at offset %d of the %d "+
+			"bytes stored for height %d", len(data), offset, size, height)
 	}
 
-	return dataBuf, nil
+	// The checksum covers all of the data so the rest of it is read to
+	// calculate the new one.
+	if ff.version > 0 {
+		entry, err := ff.readEntry(height)
+		if err != nil {
+			return err
+		}
+		copy(entry[offset:], data)
+
+		return ff.writeEntryData(height, entry)
+	}
+
+	_, err = ff.dataFile.WriteAt(data, dataOffset+offset)
+	if err != nil {
+		return err
+	}
+	if ff.syncWrites {
+		return ff.dataFile.Sync()
+	}
+
+	return nil
+}
+
+// writeEntryData overwrites all of the data stored for the given height along
+// with its checksum.
+//
+// This function MUST be called with the mutex held.
+func (ff *FlatFileState) writeEntryData(height int32, data []byte) error {
+	offset := ff.offsets[height]
+	headerSize := ff.entryHeaderSize()
+	buf := make([]byte, headerSize)
+	copy(buf[:4], magicBytes[:])
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(data)))
+	if ff.version > 0 {
+		binary.BigEndian.PutUint32(buf[8:12], crc32.Checksum(data, crcTable))
+	}
+
+	_, err := ff.dataFile.WriteAt(buf, offset)
+	if err != nil {
+		return err
+	}
+	_, err = ff.dataFile.WriteAt(data, offset+headerSize)
+	if err != nil {
+		return err
+	}
+	if ff.syncWrites {
+		return ff.dataFile.Sync()
+	}
+
+	return nil
+}
+
+// RepairData overwrites the corrupt entry stored for the given height with
+// the passed in data.  The data must be of the size that the entry takes up
+// as the entries after it stay where they are.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) RepairData(height int32, data []byte) error {
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
+
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
+
+	_, size, err := ff.dataLocation(height)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("can't repair the %d bytes stored for height "+
+			"%d with %d bytes", size, height, len(data))
+	}
+
+	return ff.writeEntryData(height, data)
 }
 
 // DisconnectBlock is used during reorganizations and it deletes the last data
@@ -329,32 +865,57 @@ func (ff *FlatFileState) DisconnectBlock(height int32) error {
 	ff.mtx.Lock()
 	defer ff.mtx.Unlock()
 
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
 	if height != ff.currentHeight {
 		return fmt.Errorf("FlatFileState: Lastest block saved is %d but was asked to disconnect height %d",
 			ff.currentHeight, height)
 	}
+	if ff.compactedHeight > 0 && height <= ff.compactedHeight+1 {
+		return fmt.Errorf("FlatFileState: can't disconnect height %d as the data "+
+			"was compacted up to height %d", height, ff.compactedHeight)
+	}
 
-	offset := ff.offsets[height]
-	buf := make([]byte, 8)
+	return ff.disconnectLocked(height)
+}
 
-	// Read from the dataFile to get the size of the data.
-	_, err := ff.dataFile.ReadAt(buf, offset)
-	if err != nil {
-		return err
-	}
+// DisconnectCompactedBlock is like DisconnectBlock but it also deletes the last
+// data stored when the data was dropped by Compact, lowering the compacted
+// height along with it.  It's used for reorgs that go deeper than the data that
+// was kept.
+//
+// This function is safe for concurrent access.
+func (ff *FlatFileState) DisconnectCompactedBlock(height int32) error {
+	ff.mtx.Lock()
+	defer ff.mtx.Unlock()
 
-	if !bytes.Equal(buf[:4], magicBytes[:]) {
-		return fmt.Errorf("read wrong magic of %x", buf[:4])
+	if ff.readOnly {
+		return errFlatFileReadOnly
+	}
+	if height != ff.currentHeight {
+		return fmt.Errorf("FlatFileState: Lastest block saved is %d but was asked to disconnect height %d",
+			ff.currentHeight, height)
 	}
 
-	size := int64(binary.BigEndian.Uint32(buf[4:]))
-
-	dataFileSize, err := ff.dataFile.Seek(0, 2)
+	err := ff.disconnectLocked(height)
 	if err != nil {
 		return err
 	}
+	if ff.compactedHeight > ff.currentHeight {
+		ff.compactedHeight = ff.currentHeight
+	}
 
-	err = ff.dataFile.Truncate(dataFileSize - (size + 8))
+	return nil
+}
+
+// disconnectLocked deletes the last data stored which is for the given height.
+//
+// This function MUST be called with the mutex held.
+func (ff *FlatFileState) disconnectLocked(height int32) error {
+	// The entry is removed even if it's corrupt so truncate the dataFile
+	// to where the entry starts.
+	err := ff.dataFile.Truncate(ff.offsets[height])
 	if err != nil {
 		return err
 	}
@@ -383,7 +944,12 @@ func (ff *FlatFileState) DisconnectBlock(height int32) error {
 }
 
 // BestHeight returns the current latest height of the flat file state.
+//
+// This function is safe for concurrent access.
 func (ff *FlatFileState) BestHeight() int32 {
+	ff.mtx.RLock()
+	defer ff.mtx.RUnlock()
+
 	return ff.currentHeight
 }
 
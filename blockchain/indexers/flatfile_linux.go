@@ -0,0 +1,27 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package indexers
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	// fallocKeepSize and fallocPunchHole are the fallocate modes to
+	// deallocate a range of a file without changing its size.
+	fallocKeepSize  = 0x01
+	fallocPunchHole = 0x02
+)
+
+// punchHole frees up the disk space used by the given range of the file.  The
+// range reads as zeros afterwards.
+func punchHole(f *os.File, offset, size int64) error {
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize|fallocPunchHole,
+		offset, size)
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package indexers
+
+import (
+	"os"
+)
+
+// punchHole zeroes out the given range of the file.  Freeing up the disk space
+// of a range in the middle of a file isn't supported on this platform so the
+// range is only marked as dropped.
+func punchHole(f *os.File, offset, size int64) error {
+	zeros := make([]byte, 1<<20)
+	for size > 0 {
+		n := int64(len(zeros))
+		if size < n {
+			n = size
+		}
+		_, err := f.WriteAt(zeros[:n], offset)
+		if err != nil {
+			return err
+		}
+		offset += n
+		size -= n
+	}
+
+	return nil
+}
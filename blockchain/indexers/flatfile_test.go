@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -239,7 +240,9 @@ func TestStoreAndFetchData(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		// Actually do the store.
+		// Actually do the store.  Sync the last half of the stores
+		// to check that the synced writes are stored the same way.
+		ff.syncWrites = i > blockCount/2
 		err = ff.StoreData(i, data)
 		if err != nil {
 			t.Fatal(err)
@@ -344,7 +347,7 @@ func getAfterSizes(ff *FlatFileState, height int32) (int64, int64, error) {
 		return 0, 0, err
 	}
 
-	return dataFileSize - int64(dataSize+8), offsetSize - 8, nil
+	return dataFileSize - (int64(dataSize) + ff.entryHeaderSize()), offsetSize - 8, nil
 }
 
 func getSizes(ff *FlatFileState) (int64, int64, error) {
@@ -650,6 +653,66 @@ func TestMultipleFetchData(t *testing.T) {
 	wg.Wait()
 }
 
+func TestUpdateData(t *testing.T) {
+	t.Parallel()
+
+	ff, tmpDir, err := initFF("TestUpdateData")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	datas := [][]byte{{1, 2, 3, 4}, {5, 6, 7, 8, 9}, {10, 11}}
+	for i, data := range datas {
+		err = ff.StoreData(int32(i+1), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Overwrite the middle of the data of each height, including the last.
+	for i := range datas {
+		height := int32(i + 1)
+		err = ff.UpdateData(height, []byte{0xff}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datas[i][1] = 0xff
+
+		fetched, err := ff.FetchData(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fetched, datas[i]) {
+			t.Fatalf("expected %x but got %x", datas[i], fetched)
+		}
+
+		buf := make([]byte, 2)
+		err = ff.FetchDataAt(height, buf, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, datas[i][:2]) {
+			t.Fatalf("expected %x but got %x", datas[i][:2], buf)
+		}
+	}
+
+	// Reads and writes past the data of a height or of heights that
+	// aren't stored are rejected.
+	if err := ff.UpdateData(1, []byte{0, 0}, 3); err == nil {
+		t.Fatalf("expected an error when writing past the data")
+	}
+	if err := ff.FetchDataAt(3, make([]byte, 3), 0); err == nil {
+		t.Fatalf("expected an error when reading past the data")
+	}
+	if err := ff.UpdateData(4, []byte{0}, 0); err == nil {
+		t.Fatalf("expected an error when writing to an unknown height")
+	}
+	if err := ff.FetchDataAt(0, []byte{0}, 0); err == nil {
+		t.Fatalf("expected an error when reading height 0")
+	}
+}
+
 func TestRecover(t *testing.T) {
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -846,3 +909,428 @@ func TestRecover(t *testing.T) {
 		}
 	}
 }
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	testName := "TestCompact"
+	ff, tmpDir, err := initFF(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	blockCount := int32(100)
+	storedData, err := ffStoreRandData(blockCount, rnd, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The latest height can't be compacted.
+	err = ff.Compact(blockCount)
+	if err == nil {
+		t.Fatalf("expected an error when compacting the latest height")
+	}
+
+	checkCompacted := func(ff *FlatFileState, compactedHeight int32) {
+		t.Helper()
+
+		if got := ff.CompactedHeight(); got != compactedHeight {
+			t.Fatalf("expected a compacted height of %d, got %d",
+				compactedHeight, got)
+		}
+		for i := int32(1); i <= ff.BestHeight(); i++ {
+			data, err := ff.FetchData(i)
+			if i <= compactedHeight {
+				if err == nil {
+					t.Fatalf("expected an error when fetching "+
+						"the compacted height %d", i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, storedData[i]) {
+				t.Fatalf("height %d: expected %x but got %x", i,
+					storedData[i], data)
+			}
+		}
+	}
+
+	// Compacting twice drops the data from where the first one left off.
+	err = ff.Compact(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 20)
+	err = ff.Compact(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 50)
+
+	// Compacting below the compacted height is a no-op.
+	err = ff.Compact(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 50)
+
+	// The compacted height is found again on restarts.
+	_, _, _, err = closeFF(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff, err = restartFF(tmpDir, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 50)
+
+	// Blocks can be disconnected down to the one after the compacted
+	// height.
+	for i := blockCount; i > 51; i-- {
+		err = ff.DisconnectBlock(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ff.DisconnectBlock(51)
+	if err == nil {
+		t.Fatalf("expected an error when disconnecting the last " +
+			"height that isn't compacted")
+	}
+	checkCompacted(ff, 50)
+
+	// Deep reorgs disconnect the compacted heights as well.
+	err = ff.DisconnectCompactedBlock(51)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 50)
+	err = ff.DisconnectCompactedBlock(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 49)
+
+	// The blocks of the new chain are stored on top of them.
+	err = ff.StoreData(50, storedData[50])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCompacted(ff, 49)
+}
+
+func TestCorruptData(t *testing.T) {
+	t.Parallel()
+
+	testName := "TestCorruptData"
+	ff, tmpDir, err := initFF(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	blockCount := int32(100)
+	storedData, err := ffStoreRandData(blockCount, rnd, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCorrupt := func(height int32) {
+		t.Helper()
+
+		_, err := ff.FetchData(height)
+		var corruptErr ErrCorruptProof
+		if !errors.As(err, &corruptErr) {
+			t.Fatalf("expected ErrCorruptProof for height %d, got %v",
+				height, err)
+		}
+		if corruptErr.Height != height {
+			t.Fatalf("expected the corrupt height %d, got %d",
+				height, corruptErr.Height)
+		}
+	}
+
+	// Flip a bit in the data of an entry that isn't empty.
+	flipHeight := int32(50)
+	for len(storedData[flipHeight]) == 0 {
+		flipHeight++
+	}
+	dataOffset, size, err := ff.dataLocation(flipHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	flipOffset := dataOffset + rnd.Int63n(size)
+	_, err = ff.dataFile.ReadAt(buf, flipOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[0] ^= 0x01
+	_, err = ff.dataFile.WriteAt(buf, flipOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCorrupt(flipHeight)
+
+	// Break the size of another entry.
+	_, err = ff.dataFile.WriteAt([]byte{0xff}, ff.offsets[60]+4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCorrupt(60)
+
+	// Partial updates of a corrupt entry are refused.
+	err = ff.UpdateData(flipHeight, []byte{0x00}, 0)
+	if err == nil {
+		t.Fatalf("expected an error when updating a corrupt entry")
+	}
+
+	// The entries can be repaired with data of the same size.
+	err = ff.RepairData(flipHeight, append(storedData[flipHeight], 0x00))
+	if err == nil {
+		t.Fatalf("expected an error when repairing with data of a " +
+			"different size")
+	}
+	for _, height := range []int32{flipHeight, 60} {
+		err = ff.RepairData(height, storedData[height])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := int32(1); i <= blockCount; i++ {
+		data, err := ff.FetchData(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, storedData[i]) {
+			t.Fatalf("height %d: expected %x but got %x", i,
+				storedData[i], data)
+		}
+	}
+
+	// A corrupt last entry is rolled back on restarts.
+	_, err = ff.dataFile.WriteAt([]byte{0x00}, ff.offsets[blockCount])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = closeFF(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff, err = restartFF(tmpDir, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ff.BestHeight(); got != blockCount-1 {
+		t.Fatalf("expected the best height %d, got %d", blockCount-1, got)
+	}
+}
+
+func TestLegacyFlatFile(t *testing.T) {
+	t.Parallel()
+
+	testName := "TestLegacyFlatFile"
+	tmpDir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	// Write the files without a header and without checksums.
+	ffPath := filepath.Join(tmpDir, testName)
+	err = os.MkdirAll(ffPath, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	blockCount := int32(10)
+	storedData := make(map[int32][]byte, blockCount)
+	var dataFile, offsetFile bytes.Buffer
+	offsetFile.Write(make([]byte, 8))
+	for i := int32(1); i <= blockCount; i++ {
+		data, err := createRandByteSlice(rnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storedData[i] = data
+
+		err = binary.Write(&offsetFile, binary.BigEndian, uint64(dataFile.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dataFile.Write(magicBytes[:])
+		err = binary.Write(&dataFile, binary.BigEndian, uint32(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dataFile.Write(data)
+	}
+	err = os.WriteFile(filepath.Join(ffPath, offsetFileName), offsetFile.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(ffPath, "data"+dataFileSuffix), dataFile.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ff, err := restartFF(tmpDir, testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.version != 0 {
+		t.Fatalf("expected version 0, got %d", ff.version)
+	}
+	if got := ff.BestHeight(); got != blockCount {
+		t.Fatalf("expected the best height %d, got %d", blockCount, got)
+	}
+
+	// The legacy format is kept for the data that's stored after it.
+	data, err := createRandByteSlice(rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedData[blockCount+1] = data
+	err = ff.StoreData(blockCount+1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(1); i <= blockCount+1; i++ {
+		data, err := ff.FetchData(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, storedData[i]) {
+			t.Fatalf("height %d: expected %x but got %x", i,
+				storedData[i], data)
+		}
+	}
+}
+
+func TestInitReadOnly(t *testing.T) {
+	t.Parallel()
+
+	testName := "TestInitReadOnly"
+	ff, tmpDir, err := initFF(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	blockCount := int32(10)
+	storedData, err := ffStoreRandData(blockCount, rnd, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave the next entry half written like a running node that's in the
+	// middle of storing it.  The offset is written but only a part of the
+	// data is, followed by a part of the offset after it.
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(ff.currentOffset))
+	_, err = ff.offsetFile.WriteAt(append(buf, 0, 0, 0), int64(blockCount+1)*8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, ff.entryHeaderSize()+10)
+	copy(header, magicBytes[:])
+	binary.BigEndian.PutUint32(header[4:8], 100)
+	_, err = ff.dataFile.WriteAt(header, ff.currentOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataSize, offsetSize, err := getSizes(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro := NewFlatFileState()
+	err = ro.InitReadOnly(filepath.Join(tmpDir, testName), "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	if got := ro.BestHeight(); got != blockCount {
+		t.Fatalf("expected the best height %d, got %d", blockCount, got)
+	}
+	err = checkDataStillFetches(blockCount, ro, storedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing can be written and the files are left as they were.
+	err = ro.StoreData(blockCount+1, []byte{1})
+	if !errors.Is(err, errFlatFileReadOnly) {
+		t.Fatalf("expected %v storing data, got %v", errFlatFileReadOnly, err)
+	}
+	err = ro.DisconnectBlock(blockCount)
+	if !errors.Is(err, errFlatFileReadOnly) {
+		t.Fatalf("expected %v disconnecting, got %v", errFlatFileReadOnly, err)
+	}
+	gotDataSize, gotOffsetSize, err := getSizes(ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotDataSize != dataSize || gotOffsetSize != offsetSize {
+		t.Fatalf("expected the data and offset files of %d and %d "+
+			"bytes, got %d and %d", dataSize, offsetSize,
+			gotDataSize, gotOffsetSize)
+	}
+}
+
+func TestFlatFileBackup(t *testing.T) {
+	t.Parallel()
+
+	testName := "TestFlatFileBackup"
+	ff, tmpDir, err := initFF(testName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	blockCount := int32(10)
+	storedData, err := ffStoreRandData(blockCount, rnd, ff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupPath := filepath.Join(tmpDir, "backup")
+	err = ff.Backup(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Data stored after the backup isn't in it.
+	err = ff.StoreData(blockCount+1, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := NewFlatFileState()
+	err = backup.Init(backupPath, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backup.BestHeight(); got != blockCount {
+		t.Fatalf("expected the backup at height %d, got %d", blockCount, got)
+	}
+	err = checkDataStillFetches(blockCount, backup, storedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The files of an existing backup aren't overwritten.
+	err = ff.Backup(backupPath)
+	if err == nil {
+		t.Fatal("expected an error backing up over an existing backup")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// proofWriteQueueSize is the maximum number of connected blocks whose proofs
+// may be waiting to be written to the flat files.  Connecting a block blocks
+// once the queue is full so that the memory used by the pending proofs stays
+// bounded.
+const proofWriteQueueSize = 64
+
+// proofWriteJob is a proof of a connected block that's waiting to be written.
+type proofWriteJob struct {
+	height    int32
+	blockHash chainhash.Hash
+	numAdds   uint16
+	delCount  uint64
+	ud        *wire.UData
+
+	// serialized, summaryHash and err are set by the hashing workers before
+	// done is closed.
+	serialized  []byte
+	summaryHash utreexo.Hash
+	err         error
+	done        chan struct{}
+}
+
+// hash serializes the proof and hashes the block summary of the job.
+func (job *proofWriteJob) hash() error {
+	buf := bytes.NewBuffer(make([]byte, 0, job.ud.SerializeSize()))
+	err := job.ud.Serialize(buf)
+	if err != nil {
+		return err
+	}
+	job.serialized = buf.Bytes()
+
+	summary := wire.UtreexoBlockSummary{
+		BlockHash:    job.blockHash,
+		NumAdds:      job.numAdds,
+		BlockTargets: make([]uint64, len(job.ud.AccProof.Targets)),
+	}
+	copy(summary.BlockTargets, job.ud.AccProof.Targets)
+
+	buf = bytes.NewBuffer(make([]byte, 0, summary.SerializeSize()))
+	err = summary.Serialize(buf)
+	if err != nil {
+		return err
+	}
+	job.summaryHash = sha256.Sum256(buf.Bytes())
+
+	return nil
+}
+
+// proofWriter serializes and hashes the proofs of the connected blocks in a
+// pool of workers and writes them to the flat files in the order of the blocks.
+// This keeps the proof writes from holding up the connecting of the blocks.
+type proofWriter struct {
+	hashJobs  chan *proofWriteJob
+	writeJobs chan *proofWriteJob
+	wg        sync.WaitGroup
+
+	// mtx protects the fields below.  cond is signaled every time a proof is
+	// written or the writing fails.
+	mtx  sync.Mutex
+	cond *sync.Cond
+
+	// queuedHeight is the height of the last block whose proof was queued
+	// and writtenHeight is the height of the last one that was written.
+	queuedHeight  int32
+	writtenHeight int32
+
+	// err is the error that the writing of the proofs failed with.  No
+	// more proofs are written once it's set.
+	err error
+}
+
+// startProofWriter starts the workers that write the proofs of the connected
+// blocks.  height is the height of the last proof that's already written.
+func (idx *FlatUtreexoProofIndex) startProofWriter(height int32) {
+	pw := &proofWriter{
+		hashJobs:      make(chan *proofWriteJob, proofWriteQueueSize),
+		writeJobs:     make(chan *proofWriteJob, proofWriteQueueSize),
+		queuedHeight:  height,
+		writtenHeight: height,
+	}
+	pw.cond = sync.NewCond(&pw.mtx)
+	idx.proofWriter = pw
+
+	numWorkers := runtime.NumCPU()
+	pw.wg.Add(numWorkers + 1)
+	for i := 0; i < numWorkers; i++ {
+		go idx.proofHashHandler(pw)
+	}
+	go idx.proofWriteHandler(pw)
+}
+
+// stopProofWriter writes out the queued proofs and stops the workers.
+func (idx *FlatUtreexoProofIndex) stopProofWriter() {
+	pw := idx.proofWriter
+	if pw == nil {
+		return
+	}
+
+	close(pw.hashJobs)
+	close(pw.writeJobs)
+	pw.wg.Wait()
+}
+
+// proofHashHandler serializes and hashes the queued proofs.  It must be run as
+// a goroutine.
+func (idx *FlatUtreexoProofIndex) proofHashHandler(pw *proofWriter) {
+	defer pw.wg.Done()
+
+	for job := range pw.hashJobs {
+		job.err = job.hash()
+		close(job.done)
+	}
+}
+
+// proofWriteHandler writes the queued proofs once they're hashed in the order
+// they were queued.  It must be run as a goroutine.
+func (idx *FlatUtreexoProofIndex) proofWriteHandler(pw *proofWriter) {
+	defer pw.wg.Done()
+
+	for job := range pw.writeJobs {
+		<-job.done
+
+		pw.mtx.Lock()
+		failed := pw.err != nil
+		pw.mtx.Unlock()
+		if failed {
+			continue
+		}
+
+		err := job.err
+		if err == nil {
+			err = idx.writeProof(job)
+		}
+
+		pw.mtx.Lock()
+		if err != nil {
+			log.Errorf("Unable to write the utreexo proof for "+
+				"height %d: %v", job.height, err)
+			pw.err = err
+		} else {
+			pw.writtenHeight = job.height
+		}
+		pw.cond.Broadcast()
+		pw.mtx.Unlock()
+	}
+}
+
+// writeProof writes the hashed proof of the job to the flat files and adds its
+// block summary to the block summary state.
+func (idx *FlatUtreexoProofIndex) writeProof(job *proofWriteJob) error {
+	idx.pStats.UpdateTotalDelCount(job.delCount)
+	idx.pStats.UpdateUDStats(false, job.ud)
+
+	idx.pStats.BlockHeight = uint64(job.height)
+	err := idx.pStats.WritePStats(&idx.proofStatsState)
+	if err != nil {
+		return err
+	}
+
+	err = idx.proofState.StoreData(job.height, job.serialized)
+	if err != nil {
+		return fmt.Errorf("store proof err. %v", err)
+	}
+
+	idx.summaryMtx.Lock()
+	defer idx.summaryMtx.Unlock()
+	return idx.blockSummaryState.Modify(
+		[]utreexo.Leaf{{Hash: job.summaryHash}}, nil, utreexo.Proof{})
+}
+
+// queueProof queues the proof of the connected block to be written.  It blocks
+// when the queue is full.  The error of a previously queued proof that failed
+// to be written is returned.
+func (idx *FlatUtreexoProofIndex) queueProof(height int32, blockHash *chainhash.Hash,
+	numAdds uint16, delCount uint64, ud *wire.UData) error {
+
+	pw := idx.proofWriter
+
+	pw.mtx.Lock()
+	err := pw.err
+	if err == nil {
+		pw.queuedHeight = height
+	}
+	pw.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	job := &proofWriteJob{
+		height:    height,
+		blockHash: *blockHash,
+		numAdds:   numAdds,
+		delCount:  delCount,
+		ud:        ud,
+		done:      make(chan struct{}),
+	}
+	pw.hashJobs <- job
+	pw.writeJobs <- job
+
+	return nil
+}
+
+// waitForProof waits until the proof at the given height is written if it's
+// queued.  The error that the writing of the proofs failed with is returned.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) waitForProof(height int32) error {
+	pw := idx.proofWriter
+	if pw == nil {
+		return nil
+	}
+
+	pw.mtx.Lock()
+	defer pw.mtx.Unlock()
+	for pw.err == nil && pw.writtenHeight < height && height <= pw.queuedHeight {
+		pw.cond.Wait()
+	}
+
+	return pw.err
+}
+
+// waitForProofs waits until all the queued proofs are written.  The error that
+// the writing of the proofs failed with is returned.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) waitForProofs() error {
+	pw := idx.proofWriter
+	if pw == nil {
+		return nil
+	}
+
+	pw.mtx.Lock()
+	height := pw.queuedHeight
+	pw.mtx.Unlock()
+
+	return idx.waitForProof(height)
+}
+
+// resetProofWriter sets the height of the last written proof after the proofs
+// were removed from the flat files.  It must only be called once all the
+// queued proofs are written.
+func (idx *FlatUtreexoProofIndex) resetProofWriter(height int32) {
+	pw := idx.proofWriter
+	if pw == nil {
+		return
+	}
+
+	pw.mtx.Lock()
+	pw.queuedHeight = height
+	pw.writtenHeight = height
+	pw.mtx.Unlock()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testProof returns a proof that's unique to the given height.
+func testProof(height int32) *wire.UData {
+	return &wire.UData{
+		AccProof: utreexo.Proof{
+			Targets: []uint64{uint64(height), uint64(height) * 2},
+			Proof:   []utreexo.Hash{{byte(height)}, {byte(height >> 8)}},
+		},
+	}
+}
+
+func TestProofWriter(t *testing.T) {
+	idx, err := NewFlatUtreexoProofIndex(&UtreexoConfig{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.blockSummaryState = utreexo.NewAccumulator()
+	idx.startProofWriter(0)
+	defer idx.stopProofWriter()
+
+	// Queue more proofs than fit in the queue.  The proofs must be written
+	// in the order of the heights even though they're hashed concurrently.
+	numBlocks := int32(proofWriteQueueSize * 3)
+	for height := int32(1); height <= numBlocks; height++ {
+		err := idx.queueProof(height, &chainhash.Hash{byte(height)}, 1, 2,
+			testProof(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height := int32(1); height <= numBlocks; height++ {
+		ud, err := idx.FetchUtreexoProof(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ud, testProof(height)) {
+			t.Fatalf("expected proof %v at height %d, got %v",
+				testProof(height).AccProof, height, ud.AccProof)
+		}
+	}
+	if got := idx.blockSummaryState.GetNumLeaves(); got != uint64(numBlocks) {
+		t.Fatalf("expected %d block summaries, got %d", numBlocks, got)
+	}
+
+	// Remove the last proof and queue a different one in its place.
+	err = idx.waitForProofs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.proofState.DisconnectBlock(numBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.resetProofWriter(numBlocks - 1)
+	err = idx.queueProof(numBlocks, &chainhash.Hash{}, 1, 2, testProof(numBlocks+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ud, err := idx.FetchUtreexoProof(numBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ud, testProof(numBlocks+1)) {
+		t.Fatalf("expected the replaced proof at height %d", numBlocks)
+	}
+
+	// A proof that fails to be written stops the writing of the proofs and
+	// the error is returned from then on.
+	err = idx.queueProof(numBlocks+2, &chainhash.Hash{}, 1, 2, testProof(numBlocks+2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.waitForProofs()
+	if err == nil {
+		t.Fatalf("expected an error for a proof that's out of order")
+	}
+	err = idx.queueProof(numBlocks+3, &chainhash.Hash{}, 1, 2, testProof(numBlocks+3))
+	if err == nil {
+		t.Fatalf("expected an error after the writing of the proofs failed")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,7 +18,6 @@ import (
 	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/btcutil"
-	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/database"
 	"github.com/utreexo/utreexod/wire"
@@ -50,6 +50,25 @@ const (
 	// files.
 	flatUtreexoRootsName = "roots"
 
+	// flatUtreexoLeafTTLName is the name given to the leaf ttl data of the
+	// flat utreexo proof index.  This name is used as the dataFile name in
+	// the flat files.
+	flatUtreexoLeafTTLName = "leafttl"
+
+	// flatUtreexoSummaryName is the name given to the block summary hashes
+	// of the blocks whose proofs were dropped from the flat utreexo proof
+	// index.  This name is used as the dataFile name in the flat files.
+	flatUtreexoSummaryName = "summaries"
+
+	// compactKeepBlocks is the number of blocks from the tip whose proofs
+	// are never dropped when compacting so that they can still be used to
+	// disconnect the blocks on reorgs.
+	compactKeepBlocks = 288
+
+	// MinProofRetention is the least number of blocks that the proofs may
+	// be kept for with the ProofRetention option.
+	MinProofRetention = compactKeepBlocks
+
 	// defaultProofGenInterval is the default value used to determine how often
 	// a utreexo accumulator proof should be generated.  An interval of 10 will
 	// make the proof be generated on blocks 10, 20, 30 and so on.
@@ -73,6 +92,13 @@ var _ Indexer = (*FlatUtreexoProofIndex)(nil)
 // Ensure the UtreexoProofIndex type implements the NeedsInputser interface.
 var _ NeedsInputser = (*FlatUtreexoProofIndex)(nil)
 
+// Ensure the FlatUtreexoProofIndex type implements the Backfiller interface.
+var _ Backfiller = (*FlatUtreexoProofIndex)(nil)
+
+// Ensure the FlatUtreexoProofIndex type implements the stateReconciler
+// interface.
+var _ stateReconciler = (*FlatUtreexoProofIndex)(nil)
+
 // FlatUtreexoProofIndex implements a utreexo accumulator proof index for all the blocks.
 // In a flat file.
 type FlatUtreexoProofIndex struct {
@@ -81,24 +107,51 @@ type FlatUtreexoProofIndex struct {
 	proofStatsState FlatFileState
 	rootsState      FlatFileState
 
+	// ttlState keeps the time to live of every leaf if enabled in the
+	// config.
+	ttlState FlatFileState
+
+	// summaryState keeps the block summary hashes of the blocks whose
+	// proofs were compacted away so that the block summary state can still
+	// be built.
+	summaryState FlatFileState
+
+	// flatFilesStartHeight is the highest height that any of the flat files
+	// were at when the index was initialized, before they were rolled back
+	// to the index tip.
+	flatFilesStartHeight int32
+
+	// compactMtx makes sure only one compaction of the flat files runs at
+	// a time.
+	compactMtx *sync.Mutex
+
 	// All the configurable metadata.
 	config *UtreexoConfig
 
 	// The blockchain instance the index corresponds to.
 	chain *blockchain.BlockChain
 
-	// mtx protects concurrent access to the utreexoView .
+	// mtx protects concurrent access to the utreexoState.  Readers that
+	// only need the current roots should use FetchCurrentUtreexoState.
 	mtx *sync.RWMutex
 
 	// utreexoState represents the Bitcoin UTXO set as a utreexo accumulator.
 	// It keeps all the elements of the forest in order to generate proofs.
 	utreexoState *UtreexoState
 
+	// rootsMtx protects concurrent access to utreexoRootsState.  It's
+	// separate from mtx so that serving the roots proofs to peers doesn't
+	// contend with the block connects and flushes of the utreexo state.
+	rootsMtx *sync.RWMutex
+
 	// utreexoRootsState is the accumulator for all the roots at each of the
 	// blocks. This is so that we can serve to peers the proof that a set of
 	// roots at a block is correct.
 	utreexoRootsState utreexo.Pollard
 
+	// summaryMtx protects concurrent access to blockSummaryState.
+	summaryMtx *sync.RWMutex
+
 	// blockSummaryState is the accumulator for all the block summaries at each
 	// of the blocks. This is so that we can serve to peers the proof that the given
 	// block summaries of a block is correct.
@@ -107,8 +160,9 @@ type FlatUtreexoProofIndex struct {
 	// pStats are the proof size statistics that are kept for research purposes.
 	pStats proofStats
 
-	// The time of when the utreexo state was last flushed.
-	lastFlushTime time.Time
+	// proofWriter writes the proofs of the connected blocks to the flat
+	// files.  It's nil when the node is pruned as the proofs aren't kept.
+	proofWriter *proofWriter
 }
 
 // NeedsInputs signals that the index requires the referenced inputs in order
@@ -119,13 +173,70 @@ func (idx *FlatUtreexoProofIndex) NeedsInputs() bool {
 	return true
 }
 
+// Backfills signals that the index can be caught up to the main chain in the
+// background.  Pruned nodes may not have the blocks to catch up from so they're
+// caught up during initialization like before.
+//
+// This implements the Backfiller interface.
+func (idx *FlatUtreexoProofIndex) Backfills() bool {
+	return !idx.config.Pruned
+}
+
+// reconciledStartHeights returns the heights that the utreexo state and the
+// flat files were at when the index was initialized.
+//
+// This implements the stateReconciler interface.
+func (idx *FlatUtreexoProofIndex) reconciledStartHeights() []stateHeight {
+	return []stateHeight{
+		{"utreexo state", idx.utreexoState.startHeight},
+		{"flat files", idx.flatFilesStartHeight},
+	}
+}
+
+// loadedFlatFileStates returns the flat file states that are loaded.  The
+// proofs and the block summaries aren't kept by pruned nodes and the leaf ttls
+// are only kept when they're enabled.
+func (idx *FlatUtreexoProofIndex) loadedFlatFileStates() []*FlatFileState {
+	states := []*FlatFileState{&idx.undoState, &idx.proofStatsState,
+		&idx.rootsState}
+	if !idx.config.Pruned {
+		states = append(states, &idx.proofState, &idx.summaryState)
+	}
+	if idx.config.LeafTTLs {
+		states = append(states, &idx.ttlState)
+	}
+	return states
+}
+
 // consistentFlatFileState rolls back all the flat file states to the tip height.
 // The data is written to the flat files directly but the index tips are cached and
 // then written to disk. This may lead to states where the index tip is lower than the
 // data stored in the flat files. Rolling back the flat file state to the index tip
 // keep ths entire indexer consistent.
 func (idx *FlatUtreexoProofIndex) consistentFlatFileState(tipHeight int32) error {
+	// The leaf ttls are rolled back first as the records of the blocks
+	// being rolled back are needed to reset the ttls of the spent leaves.
+	if idx.config.LeafTTLs {
+		bestHeight := idx.ttlState.BestHeight()
+		for tipHeight < bestHeight && bestHeight > 0 {
+			err := idx.disconnectLeafTTLs(bestHeight)
+			if err != nil {
+				return err
+			}
+			bestHeight--
+		}
+	}
+
 	if !idx.config.Pruned {
+		bestHeight := idx.summaryState.BestHeight()
+		for tipHeight < bestHeight && bestHeight > 0 {
+			err := idx.summaryState.DisconnectBlock(bestHeight)
+			if err != nil {
+				return err
+			}
+			bestHeight--
+		}
+
 		if idx.proofState.BestHeight() != 0 &&
 			tipHeight < idx.proofState.BestHeight() {
 			bestHeight := idx.proofState.BestHeight()
@@ -204,6 +315,44 @@ func (idx *FlatUtreexoProofIndex) initUtreexoRootsState() error {
 	return nil
 }
 
+// blockSummaryHash returns the hash of the block summary of the block at the
+// given height.  prevNumLeaves is the number of leaves in the accumulator before
+// the block and the number of leaves after it is returned.
+func (idx *FlatUtreexoProofIndex) blockSummaryHash(height int32,
+	prevNumLeaves uint64) (utreexo.Hash, uint64, error) {
+
+	blockHash, err := idx.chain.BlockHashByHeight(height)
+	if err != nil {
+		return utreexo.Hash{}, 0, err
+	}
+
+	stump, err := idx.fetchRoots(height)
+	if err != nil {
+		return utreexo.Hash{}, 0, err
+	}
+	numAdds := uint16(stump.NumLeaves - prevNumLeaves)
+
+	proof, err := idx.FetchUtreexoProof(height)
+	if err != nil {
+		return utreexo.Hash{}, 0, err
+	}
+
+	blockHeader := wire.UtreexoBlockSummary{
+		BlockHash:    *blockHash,
+		NumAdds:      numAdds,
+		BlockTargets: make([]uint64, len(proof.AccProof.Targets)),
+	}
+	copy(blockHeader.BlockTargets, proof.AccProof.Targets)
+
+	buf := bytes.NewBuffer(make([]byte, 0, blockHeader.SerializeSize()))
+	err = blockHeader.Serialize(buf)
+	if err != nil {
+		return utreexo.Hash{}, 0, err
+	}
+
+	return sha256.Sum256(buf.Bytes()), stump.NumLeaves, nil
+}
+
 // initBlockSummaryState creates and accumulator from the block summaries of each
 // block and holds it in memory so that the proofs for them can be generated.
 func (idx *FlatUtreexoProofIndex) initBlockSummaryState() error {
@@ -211,40 +360,35 @@ func (idx *FlatUtreexoProofIndex) initBlockSummaryState() error {
 
 	var prevNumLeaves uint64
 	bestHeight := idx.proofState.BestHeight()
+	summaryHeight := idx.summaryState.BestHeight()
 	for h := int32(0); h <= bestHeight; h++ {
-		blockHash, err := idx.chain.BlockHashByHeight(h)
-		if err != nil {
-			return err
-		}
-
-		stump, err := idx.fetchRoots(h)
-		if err != nil {
-			return err
-		}
-		numAdds := uint16(stump.NumLeaves - prevNumLeaves)
-		prevNumLeaves = stump.NumLeaves
-
-		proof, err := idx.FetchUtreexoProof(h)
-		if err != nil {
-			return err
-		}
-
-		blockHeader := wire.UtreexoBlockSummary{
-			BlockHash:    *blockHash,
-			NumAdds:      numAdds,
-			BlockTargets: make([]uint64, len(proof.AccProof.Targets)),
-		}
-		copy(blockHeader.BlockTargets, proof.AccProof.Targets)
+		var hash utreexo.Hash
+		if h > 0 && h <= summaryHeight {
+			// The proofs of the blocks were compacted away so
+			// the saved hashes of their summaries are used.
+			serialized, err := idx.summaryState.FetchData(h)
+			if err != nil {
+				return err
+			}
+			copy(hash[:], serialized)
 
-		buf := bytes.NewBuffer(make([]byte, 0, blockHeader.SerializeSize()))
-		err = blockHeader.Serialize(buf)
-		if err != nil {
-			return err
+			if h == summaryHeight {
+				stump, err := idx.fetchRoots(h)
+				if err != nil {
+					return err
+				}
+				prevNumLeaves = stump.NumLeaves
+			}
+		} else {
+			var err error
+			hash, prevNumLeaves, err = idx.blockSummaryHash(h, prevNumLeaves)
+			if err != nil {
+				return err
+			}
 		}
-		rootHash := sha256.Sum256(buf.Bytes())
 
-		err = idx.blockSummaryState.Modify(
-			[]utreexo.Leaf{{Hash: rootHash}}, nil, utreexo.Proof{})
+		err := idx.blockSummaryState.Modify(
+			[]utreexo.Leaf{{Hash: hash}}, nil, utreexo.Proof{})
 		if err != nil {
 			return err
 		}
@@ -261,18 +405,34 @@ func (idx *FlatUtreexoProofIndex) Init(chain *blockchain.BlockChain,
 	idx.chain = chain
 
 	// Init Utreexo State.
-	uState, err := InitUtreexoState(idx.config, chain, tipHash, tipHeight)
+	uState, err := InitUtreexoState(idx.config, chain, tipHash, tipHeight,
+		idx.replayProof, idx.fetchRollBackData)
 	if err != nil {
 		return err
 	}
 	idx.utreexoState = uState
-	idx.lastFlushTime = time.Now()
 
+	idx.flatFilesStartHeight = tipHeight
+	for _, ff := range idx.loadedFlatFileStates() {
+		if ff.BestHeight() > idx.flatFilesStartHeight {
+			idx.flatFilesStartHeight = ff.BestHeight()
+		}
+	}
 	err = idx.consistentFlatFileState(tipHeight)
 	if err != nil {
 		return err
 	}
 
+	// The leaf ttls can only be kept if they were kept for every block
+	// since the ttls of the leaves created in the missing blocks can't be
+	// known.
+	if idx.config.LeafTTLs && idx.ttlState.BestHeight() < tipHeight {
+		return fmt.Errorf("the leaf ttls are kept up to height %d but "+
+			"the flat utreexo proof index is at height %d. The index "+
+			"must be dropped and rebuilt to keep the leaf ttls",
+			idx.ttlState.BestHeight(), tipHeight)
+	}
+
 	err = idx.initUtreexoRootsState()
 	if err != nil {
 		return err
@@ -285,7 +445,8 @@ func (idx *FlatUtreexoProofIndex) Init(chain *blockchain.BlockChain,
 			return err
 		}
 
-		return nil
+		idx.startProofWriter(idx.proofState.BestHeight())
+		return idx.maybeCompactProofs()
 	}
 
 	// We're here because the node is pruned.
@@ -311,12 +472,12 @@ func (idx *FlatUtreexoProofIndex) Init(chain *blockchain.BlockChain,
 		return nil
 	}
 
-	// Make undo blocks for blocks up to 288 block from the tip. 288 since
-	// that's the basis used for NODE_NETWORK_LIMITED. Reorgs that go past
-	// that are gonna be problematic anyways.
-	undoCount := int32(288)
+	// Make undo blocks for the blocks within the undo retention from the
+	// tip.
+	undoCount := idx.config.undoRetention()
 
-	// The bestHeight is less than 288, then just undo all the blocks we have.
+	// The bestHeight is less than the retention, then just undo all the
+	// blocks we have.
 	if undoCount > bestHeight {
 		undoCount = bestHeight
 	}
@@ -402,6 +563,21 @@ func (idx *FlatUtreexoProofIndex) Key() []byte {
 	return flatUtreexoBucketKey
 }
 
+// StoragePaths returns the paths on disk that hold the data of the flat utreexo
+// proof index.
+func (idx *FlatUtreexoProofIndex) StoragePaths() []string {
+	dataDir := idx.config.DataDir
+	return []string{
+		flatFilePath(dataDir, flatUtreexoProofName),
+		flatFilePath(dataDir, flatUtreexoUndoName),
+		flatFilePath(dataDir, flatUtreexoProofStatsName),
+		flatFilePath(dataDir, flatUtreexoRootsName),
+		flatFilePath(dataDir, flatUtreexoSummaryName),
+		flatFilePath(dataDir, flatUtreexoLeafTTLName),
+		utreexoBasePath(idx.config),
+	}
+}
+
 // Create is invoked when the indexer manager determines the index needs
 // to be created for the first time.
 //
@@ -457,6 +633,11 @@ func (idx *FlatUtreexoProofIndex) ConnectBlock(dbTx database.Tx, block *btcutil.
 		if err != nil {
 			return err
 		}
+
+		err = idx.pruneUndoBlocks(block.Height())
+		if err != nil {
+			return err
+		}
 	} else {
 		err = idx.storeUndoBlock(block.Height(), 0, nil, nil)
 		if err != nil {
@@ -469,43 +650,65 @@ func (idx *FlatUtreexoProofIndex) ConnectBlock(dbTx database.Tx, block *btcutil.
 		addHashes = append(addHashes, add.Hash)
 	}
 
+	if idx.config.CrossCheck {
+		idx.utreexoState.seedCrossCheck(&block.MsgBlock().Header.PrevBlock)
+	}
+
 	idx.mtx.Lock()
 	err = idx.utreexoState.state.Modify(adds, delHashes, ud.AccProof)
+	if err == nil {
+		// The roots state is updated before the tip snapshot is
+		// published so that the roots of the tip can always be proven.
+		err = idx.updateRootsState()
+	}
+	if err == nil {
+		idx.utreexoState.updateTip(block.Hash())
+	}
 	idx.mtx.Unlock()
 	if err != nil {
 		return err
 	}
+	idx.utreexoState.blocksSinceFlush++
+	idx.utreexoState.audit(auditOpModify, block.Height(), block.Hash(),
+		uint64(len(adds)), adds, delHashes, ud.AccProof.Targets)
+
+	if idx.config.CrossCheck {
+		err = idx.utreexoState.crossCheck(block, stxos, idx.chain,
+			adds, ud.AccProof)
+		if err != nil {
+			log.Criticalf("Hybrid validation failed. Halting block "+
+				"processing: %v", err)
+			return err
+		}
+	}
 
 	err = idx.storeRoots(block.Height(), idx.utreexoState.state)
 	if err != nil {
 		return err
 	}
 
-	err = idx.updateRootsState()
+	err = dbStoreRootSnapshot(dbTx, flatUtreexoBucketKey,
+		idx.config.RootSnapshotInterval, block, idx.utreexoState.state)
 	if err != nil {
 		return err
 	}
 
+	if idx.config.LeafTTLs {
+		err = idx.storeLeafTTLs(block, dels)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Don't store proofs if the node is pruned.
 	if idx.config.Pruned {
 		return nil
 	}
 
-	idx.pStats.UpdateTotalDelCount(uint64(len(dels)))
-	idx.pStats.UpdateUDStats(false, ud)
-
-	idx.pStats.BlockHeight = uint64(block.Height())
-	err = idx.pStats.WritePStats(&idx.proofStatsState)
-	if err != nil {
-		return err
-	}
-
-	err = idx.storeProof(block.Height(), ud)
-	if err != nil {
-		return err
-	}
-
-	return idx.updateBlockSummaryState(uint16(len(adds)), block.Hash(), ud.AccProof)
+	// The proof is serialized and written to the flat files by the proof
+	// writer so that the next block can be connected in the meantime.
+	return idx.queueProof(block.Height(), block.Hash(), uint16(len(adds)),
+		uint64(len(dels)), ud)
 }
 
 // calcProofOverhead calculates the overhead of the current utreexo accumulator proof
@@ -537,10 +740,28 @@ func (idx *FlatUtreexoProofIndex) attachBlock(blk *btcutil.Block, stxos []blockc
 		delHashes[i] = del.LeafHash()
 	}
 
+	if idx.config.CrossCheck {
+		idx.utreexoState.seedCrossCheck(&blk.MsgBlock().Header.PrevBlock)
+	}
+
 	err = idx.utreexoState.state.Modify(adds, delHashes, ud.AccProof)
 	if err != nil {
 		return err
 	}
+	idx.utreexoState.blocksSinceFlush++
+	idx.utreexoState.updateTip(blk.Hash())
+	idx.utreexoState.audit(auditOpModify, blk.Height(), blk.Hash(),
+		uint64(len(adds)), adds, delHashes, ud.AccProof.Targets)
+
+	if idx.config.CrossCheck {
+		err = idx.utreexoState.crossCheck(blk, stxos, idx.chain,
+			adds, ud.AccProof)
+		if err != nil {
+			log.Criticalf("Hybrid validation failed. Halting block "+
+				"processing: %v", err)
+			return err
+		}
+	}
 
 	return nil
 }
@@ -573,6 +794,32 @@ func (idx *FlatUtreexoProofIndex) resyncUtreexoState(start, finish int32) error
 	return nil
 }
 
+// replayProof writes the proof of a block that's attached to the utreexo state
+// when it's caught up to the index tip during initialization.  The proof is
+// missing from the flat files if the node shut down before it was written.
+func (idx *FlatUtreexoProofIndex) replayProof(block *btcutil.Block, ud *wire.UData) error {
+	if idx.config.Pruned || block.Height() != idx.proofState.BestHeight()+1 {
+		return nil
+	}
+
+	_, outCount, _, outskip := blockchain.DedupeBlock(block)
+	adds := blockchain.BlockToAddLeaves(block, outskip, nil, outCount)
+
+	job := &proofWriteJob{
+		height:    block.Height(),
+		blockHash: *block.Hash(),
+		numAdds:   uint16(len(adds)),
+		delCount:  uint64(len(ud.LeafDatas)),
+		ud:        ud,
+	}
+	err := job.hash()
+	if err != nil {
+		return err
+	}
+
+	return idx.writeProof(job)
+}
+
 // printHashes returns the hashes encoded to string.
 func printHashes(hashes []utreexo.Hash) string {
 	str := ""
@@ -625,6 +872,47 @@ func (idx *FlatUtreexoProofIndex) getUndoData(block *btcutil.Block) (uint64, []u
 	return numAdds, targets, delHashes, nil
 }
 
+// fetchUndoData returns the data needed for undoing the block.  The data of the
+// blocks deeper than what's kept is recovered from the rollback snapshots.
+func (idx *FlatUtreexoProofIndex) fetchUndoData(block *btcutil.Block) (uint64, []uint64, []utreexo.Hash, error) {
+	numAdds, targets, delHashes, err := idx.getUndoData(block)
+	if err != nil && idx.config.RollbackSnapshots > 0 {
+		log.Infof("The data for undoing block %s (%d) is no longer "+
+			"kept: %v", block.Hash(), block.Height(), err)
+		return idx.utreexoState.fetchReplayedUndo(idx.chain, block)
+	}
+	return numAdds, targets, delHashes, err
+}
+
+// fetchRollBackData returns the data needed to undo the block from a utreexo
+// state that was flushed past the index tip along with the roots before the
+// block.  The flat files still hold the data of the block as they're only rolled
+// back to the index tip once the utreexo state is.
+func (idx *FlatUtreexoProofIndex) fetchRollBackData(block *btcutil.Block) (
+	uint64, []uint64, []utreexo.Hash, utreexo.Stump, error) {
+
+	prevStump, err := idx.fetchRoots(block.Height() - 1)
+	if err != nil {
+		return 0, nil, nil, utreexo.Stump{}, err
+	}
+	numAdds, targets, delHashes, err := idx.getUndoData(block)
+	if err != nil {
+		return 0, nil, nil, utreexo.Stump{}, err
+	}
+
+	return numAdds, targets, delHashes, prevStump, nil
+}
+
+// disconnectFlatFile deletes the data stored for the given height from the flat
+// file state.  The data that was compacted is only deleted when the rollback
+// snapshots are kept as reorgs that deep can't be undone otherwise.
+func (idx *FlatUtreexoProofIndex) disconnectFlatFile(ff *FlatFileState, height int32) error {
+	if idx.config.RollbackSnapshots > 0 {
+		return ff.DisconnectCompactedBlock(height)
+	}
+	return ff.DisconnectBlock(height)
+}
+
 // DisconnectBlock is invoked by the index manager when a new block has been
 // disconnected to the main chain.
 //
@@ -632,22 +920,35 @@ func (idx *FlatUtreexoProofIndex) getUndoData(block *btcutil.Block) (uint64, []u
 func (idx *FlatUtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 	stxos []blockchain.SpentTxOut) error {
 
+	// The proofs of the blocks being disconnected must be in the flat files
+	// before they can be removed.
+	err := idx.waitForProofs()
+	if err != nil {
+		return err
+	}
+
 	state, err := idx.fetchRoots(block.Height() - 1)
 	if err != nil {
 		return err
 	}
 
-	numAdds, targets, delHashes, err := idx.getUndoData(block)
+	numAdds, targets, delHashes, err := idx.fetchUndoData(block)
 	if err != nil {
 		return err
 	}
 
 	idx.mtx.Lock()
 	err = idx.utreexoState.state.Undo(numAdds, utreexo.Proof{Targets: targets}, delHashes, state.Roots)
+	if err == nil {
+		idx.utreexoState.updateTip(&block.MsgBlock().Header.PrevBlock)
+	}
 	idx.mtx.Unlock()
 	if err != nil {
 		return err
 	}
+	idx.utreexoState.blocksSinceFlush++
+	idx.utreexoState.audit(auditOpUndo, block.Height(), block.Hash(),
+		numAdds, nil, delHashes, targets)
 
 	// Always flush the utreexo state on flushes to never leave the utreexoState
 	// at an unrecoverable state.
@@ -659,10 +960,11 @@ func (idx *FlatUtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcut
 	// Check if we're at a height where proof was generated. Only check if we're not
 	// pruned as we don't keep the historical proofs as a pruned node.
 	if !idx.config.Pruned {
-		err = idx.proofState.DisconnectBlock(block.Height())
+		err = idx.disconnectFlatFile(&idx.proofState, block.Height())
 		if err != nil {
 			return err
 		}
+		idx.resetProofWriter(block.Height() - 1)
 
 		// Re-initializes to the current accumulator roots, effectively
 		// disconnecting a block.
@@ -672,7 +974,12 @@ func (idx *FlatUtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcut
 		}
 	}
 
-	err = idx.undoState.DisconnectBlock(block.Height())
+	err = idx.disconnectFlatFile(&idx.undoState, block.Height())
+	if err != nil {
+		return err
+	}
+
+	err = idx.utreexoState.dropRollbackSnapshots(block.Height())
 	if err != nil {
 		return err
 	}
@@ -682,6 +989,22 @@ func (idx *FlatUtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcut
 		return err
 	}
 
+	// Everything else of the index is kept in the flat files so it may be
+	// disconnected without a database transaction.
+	if dbTx != nil {
+		err = dbDeleteRootSnapshot(dbTx, flatUtreexoBucketKey, block.Height())
+		if err != nil {
+			return err
+		}
+	}
+
+	if idx.config.LeafTTLs {
+		err = idx.disconnectLeafTTLs(block.Height())
+		if err != nil {
+			return err
+		}
+	}
+
 	// Re-initializes to the current accumulator roots, effectively disconnecting
 	// a block.
 	return idx.initUtreexoRootsState()
@@ -692,7 +1015,7 @@ func (idx *FlatUtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcut
 //
 // This is part of the Indexer interface.
 func (idx *FlatUtreexoProofIndex) PruneBlock(_ database.Tx, _ *chainhash.Hash, lastKeptHeight int32) error {
-	hash, _, err := dbFetchUtreexoStateConsistency(idx.utreexoState.utreexoStateDB)
+	hash, _, _, err := dbFetchUtreexoStateConsistency(idx.utreexoState.utreexoStateDB)
 	if err != nil {
 		return err
 	}
@@ -728,8 +1051,21 @@ func (idx *FlatUtreexoProofIndex) FetchUtreexoProof(height int32) (
 		return nil, fmt.Errorf("Cannot fetch historical proof as the node is pruned")
 	}
 
+	// The proof of a block that was just connected may not be written yet.
+	err := idx.waitForProof(height)
+	if err != nil {
+		return nil, err
+	}
+
 	proofBytes, err := idx.proofState.FetchData(height)
 	if err != nil {
+		// The proof hashes can only be generated from the accumulator
+		// at the block before so a corrupt proof can't be re-derived.
+		var corruptErr ErrCorruptProof
+		if errors.As(err, &corruptErr) {
+			log.Errorf("%v. The proof can't be re-derived so the index "+
+				"has to be rebuilt with --dropflatutreexoproofindex", err)
+		}
 		return nil, err
 	}
 	if proofBytes == nil {
@@ -746,6 +1082,35 @@ func (idx *FlatUtreexoProofIndex) FetchUtreexoProof(height int32) (
 	return ud, nil
 }
 
+// FetchUtreexoProofs calls fn with the Utreexo proof of every block from
+// startHeight to endHeight, inclusive, in order of height.  The proofs are read
+// sequentially from the proof file.  The iteration stops at the first error
+// returned by fn and that error is returned.
+func (idx *FlatUtreexoProofIndex) FetchUtreexoProofs(startHeight, endHeight int32,
+	fn func(height int32, proof *wire.UData) error) error {
+
+	if idx.config.Pruned {
+		return fmt.Errorf("Cannot fetch historical proof as the node is pruned")
+	}
+	if startHeight < 1 || endHeight < startHeight {
+		return fmt.Errorf("invalid height range of %d to %d", startHeight, endHeight)
+	}
+
+	for height := startHeight; height <= endHeight; height++ {
+		ud, err := idx.FetchUtreexoProof(height)
+		if err != nil {
+			return err
+		}
+
+		err = fn(height, ud)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetLeafHashPositions returns the positions of the passed in hashes.
 func (idx *FlatUtreexoProofIndex) GetLeafHashPositions(delHashes []utreexo.Hash) []uint64 {
 	idx.mtx.RLock()
@@ -760,6 +1125,28 @@ func (idx *FlatUtreexoProofIndex) GetLeafHashPositions(delHashes []utreexo.Hash)
 	return positions
 }
 
+// GetPositionHash returns the hash at the given position in the accumulator.
+// Leaves move up the accumulator as their siblings are deleted so the hash may
+// be of a leaf even if the position isn't on the bottom row.  The boolean
+// returns false if there's nothing at the position.
+func (idx *FlatUtreexoProofIndex) GetPositionHash(position uint64) (utreexo.Hash, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	hash := idx.utreexoState.state.GetHash(position)
+	return hash, hash != utreexo.Hash{}
+}
+
+// GetLeafPosition returns the current position of the leaf with the given hash
+// in the accumulator.  The boolean returns false if the leaf isn't in the
+// accumulator.
+func (idx *FlatUtreexoProofIndex) GetLeafPosition(leafHash utreexo.Hash) (uint64, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.state.GetLeafPosition(leafHash)
+}
+
 // GenerateUDataPartial generates a utreexo data based on the current state of the accumulator.
 // It leaves out the full proof hashes and only fetches the requested positions.
 func (idx *FlatUtreexoProofIndex) GenerateUDataPartial(dels []wire.LeafData, positions []uint64) (*wire.UData, error) {
@@ -799,20 +1186,137 @@ func (idx *FlatUtreexoProofIndex) GenerateUDataPartial(dels []wire.LeafData, pos
 	return ud, nil
 }
 
-// storeProof serializes and stores the utreexo data in the proof state.
-func (idx *FlatUtreexoProofIndex) storeProof(height int32, ud *wire.UData) error {
-	bytesBuf := bytes.NewBuffer(make([]byte, 0, ud.SerializeSize()))
-	err := ud.Serialize(bytesBuf)
+// CompactProofs drops the proofs and the undo data of the blocks below the given
+// height from the flat files to free up the disk space they take up.  The
+// proofs of the last 288 blocks are always kept for reorgs.  The hashes of the
+// summaries of the dropped blocks are kept so that the summaries of the rest
+// of the blocks can still be proven.  The height up to which the blocks were
+// dropped is returned.
+//
+// The work is done within the CPU quota of the config as it's done in the
+// background.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) CompactProofs(pruneHeight int32) (int32, error) {
+	return idx.compactProofs(pruneHeight, idx.config.CPUQuota)
+}
+
+// compactProofs drops the proofs below the given height like CompactProofs
+// does.  The summary hashes of the dropped blocks are hashed within the passed
+// quota.  A nil quota hashes them as fast as possible.
+func (idx *FlatUtreexoProofIndex) compactProofs(pruneHeight int32,
+	quota *CPUQuota) (int32, error) {
+
+	if idx.config.Pruned {
+		return 0, fmt.Errorf("Cannot compact the proofs as the node is pruned")
+	}
+
+	idx.compactMtx.Lock()
+	defer idx.compactMtx.Unlock()
+
+	err := idx.waitForProofs()
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	height := pruneHeight - 1
+	bestHeight := idx.proofState.BestHeight()
+	if height > bestHeight-compactKeepBlocks {
+		return 0, fmt.Errorf("can't drop the proofs below height %d as "+
+			"the proofs of the last %d blocks from the tip at height "+
+			"%d are kept", pruneHeight, compactKeepBlocks, bestHeight)
+	}
+	if height <= idx.proofState.CompactedHeight() {
+		return idx.proofState.CompactedHeight(), nil
 	}
 
-	err = idx.proofState.StoreData(height, bytesBuf.Bytes())
+	// Save the summary hashes of the blocks being dropped before their
+	// proofs are gone.
+	start := idx.summaryState.BestHeight() + 1
+	stump, err := idx.fetchRoots(start - 1)
 	if err != nil {
-		return fmt.Errorf("store proof err. %v", err)
+		return 0, err
 	}
+	prevNumLeaves := stump.NumLeaves
+	for h := start; h <= height; h++ {
+		err = quota.Run(nil, func() error {
+			hash, numLeaves, err := idx.blockSummaryHash(h, prevNumLeaves)
+			if err != nil {
+				return err
+			}
+			prevNumLeaves = numLeaves
 
-	return nil
+			err = idx.summaryState.StoreData(h, hash[:])
+			if err != nil {
+				return fmt.Errorf("store summary hash err. %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = idx.proofState.Compact(height)
+	if err != nil {
+		return 0, err
+	}
+	err = idx.undoState.Compact(height)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Infof("Dropped the utreexo proofs of the blocks up to height %d", height)
+	return height, nil
+}
+
+// ConfiguredPruneHeight returns the height below which the proofs are dropped
+// at the current tip as set by the config.  0 is returned when the config
+// doesn't drop any of the proofs.
+func (idx *FlatUtreexoProofIndex) ConfiguredPruneHeight() int32 {
+	return idx.config.proofPruneHeight(idx.proofState.BestHeight())
+}
+
+// CompactedHeight returns the height up to which the proofs were dropped by
+// CompactProofs.  0 is returned when no proofs were dropped.
+func (idx *FlatUtreexoProofIndex) CompactedHeight() int32 {
+	return idx.proofState.CompactedHeight()
+}
+
+// maybeCompactProofs drops the proofs below the prune height from the config
+// once the blocks are far enough from the tip.  Nothing is dropped outside of
+// the compaction windows from the config.
+func (idx *FlatUtreexoProofIndex) maybeCompactProofs() error {
+	if !InCompactionWindow(idx.config.CompactionWindows, time.Now()) {
+		return nil
+	}
+
+	// The proofs are dropped as the blocks are connected so they're
+	// dropped without holding up the connecting.
+	return idx.compactConfiguredProofs(nil)
+}
+
+// compactConfiguredProofs drops the proofs below the prune height from the
+// config that are far enough from the tip within the passed quota.
+func (idx *FlatUtreexoProofIndex) compactConfiguredProofs(quota *CPUQuota) error {
+	bestHeight := idx.proofState.BestHeight()
+	pruneHeight := idx.config.proofPruneHeight(bestHeight)
+	if idx.config.Pruned || pruneHeight <= 0 {
+		return nil
+	}
+
+	// Drop what can be dropped when the tip isn't far enough from the
+	// prune height yet.
+	maxPruneHeight := bestHeight - compactKeepBlocks + 1
+	if pruneHeight > maxPruneHeight {
+		pruneHeight = maxPruneHeight
+	}
+	if pruneHeight-1 <= idx.proofState.CompactedHeight() {
+		return nil
+	}
+
+	_, err := idx.compactProofs(pruneHeight, quota)
+	return err
 }
 
 // storeUndoBlock serializes and stores undo blocks in the undo state.
@@ -832,6 +1336,13 @@ func (idx *FlatUtreexoProofIndex) storeUndoBlock(height int32,
 	return nil
 }
 
+// pruneUndoBlocks drops the undo blocks that are deeper than the undo retention
+// when the tip is at the given height.  Reorgs that deep can't be undone anymore.
+func (idx *FlatUtreexoProofIndex) pruneUndoBlocks(tipHeight int32) error {
+	start := undoStartHeight(tipHeight, idx.config.undoRetention())
+	return idx.undoState.Compact(start - 1)
+}
+
 // storeRoots serializes and stores roots to the roots state.
 func (idx *FlatUtreexoProofIndex) storeRoots(height int32, p utreexo.Utreexo) error {
 	serialized, err := blockchain.SerializeUtreexoRoots(p.GetNumLeaves(), p.GetRoots())
@@ -855,12 +1366,44 @@ func (idx *FlatUtreexoProofIndex) fetchUndoBlock(height int32) (uint64, []uint64
 
 	undoBytes, err := idx.undoState.FetchData(height)
 	if err != nil {
-		return 0, nil, nil, err
+		var corruptErr ErrCorruptProof
+		if !errors.As(err, &corruptErr) {
+			return 0, nil, nil, err
+		}
+		undoBytes, err = idx.repairUndoBlock(height, err)
+		if err != nil {
+			return 0, nil, nil, err
+		}
 	}
 
 	return deserializeUndoBlock(undoBytes)
 }
 
+// repairUndoBlock re-derives the corrupt undo block at the given height and
+// overwrites it in the undo state.  Only the undo blocks of nodes that aren't
+// pruned can be re-derived as they're empty.  The undo blocks of pruned nodes
+// hold the targets of the deleted leaves which aren't kept anywhere else.
+func (idx *FlatUtreexoProofIndex) repairUndoBlock(height int32, corruptErr error) ([]byte, error) {
+	if idx.config.Pruned {
+		log.Errorf("%v. The undo block can't be re-derived on a pruned "+
+			"node so the index has to be rebuilt with "+
+			"--dropflatutreexoproofindex", corruptErr)
+		return nil, corruptErr
+	}
+
+	undoBytes, err := serializeUndoBlock(0, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = idx.undoState.RepairData(height, undoBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%v. Unable to repair it: %v", corruptErr, err)
+	}
+
+	log.Warnf("%v. Repaired the undo block at height %d", corruptErr, height)
+	return undoBytes, nil
+}
+
 // fetchRoots returns the roots at the given height. It doesn't work for the current hegiht
 // and will return an error.
 func (idx *FlatUtreexoProofIndex) fetchRoots(height int32) (utreexo.Stump, error) {
@@ -870,7 +1413,11 @@ func (idx *FlatUtreexoProofIndex) fetchRoots(height int32) (utreexo.Stump, error
 
 	undoBytes, err := idx.rootsState.FetchData(height)
 	if err != nil {
-		return utreexo.Stump{}, err
+		var corruptErr ErrCorruptProof
+		if !errors.As(err, &corruptErr) {
+			return utreexo.Stump{}, err
+		}
+		return idx.repairRoots(height, err)
 	}
 
 	numLeaves, roots, err := blockchain.DeserializeUtreexoRoots(undoBytes)
@@ -881,6 +1428,51 @@ func (idx *FlatUtreexoProofIndex) fetchRoots(height int32) (utreexo.Stump, error
 	return utreexo.Stump{Roots: roots, NumLeaves: numLeaves}, nil
 }
 
+// repairRoots re-derives the corrupt roots at the given height by applying the
+// block at the height and its proof to the roots at the height before, and
+// overwrites them in the roots state.  Pruned nodes don't keep the proofs so
+// the roots can't be re-derived there.
+func (idx *FlatUtreexoProofIndex) repairRoots(height int32, corruptErr error) (utreexo.Stump, error) {
+	if idx.config.Pruned {
+		log.Errorf("%v. The roots can't be re-derived on a pruned node "+
+			"so the index has to be rebuilt with "+
+			"--dropflatutreexoproofindex", corruptErr)
+		return utreexo.Stump{}, corruptErr
+	}
+
+	stump, err := idx.fetchRoots(height - 1)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+	block, err := idx.chain.BlockByHeight(height)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+	ud, err := idx.FetchUtreexoProof(height)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+
+	err = updateStumpWithBlock(idx.chain, &stump, block, ud)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+
+	serialized, err := blockchain.SerializeUtreexoRoots(stump.NumLeaves, stump.Roots)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+	err = idx.rootsState.RepairData(height, serialized)
+	if err != nil {
+		return utreexo.Stump{}, fmt.Errorf("%v. Unable to repair them: %v",
+			corruptErr, err)
+	}
+
+	log.Warnf("%v. Repaired the roots at height %d from block %v", corruptErr,
+		height, block.Hash())
+	return stump, nil
+}
+
 // GenerateUData generates utreexo data for the dels passed in.  Height passed in
 // should either be of block height of where the deletions are happening or just
 // the lastest block height for mempool tx proof generation.
@@ -895,12 +1487,34 @@ func (idx *FlatUtreexoProofIndex) GenerateUData(dels []wire.LeafData) (*wire.UDa
 	return ud, nil
 }
 
+// ProveBlock generates the utreexo proof of the outputs spent by the passed
+// block, which must extend the tip of the index, and checks it against the
+// current roots the same way nodes that only keep the accumulator do.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) ProveBlock(block *btcutil.Block) (*wire.UData, error) {
+	dels, err := blockSpentLeaves(idx.chain, block)
+	if err != nil {
+		return nil, err
+	}
+	ud, err := idx.GenerateUData(dels)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlockProof(block, ud, idx.VerifyAccProof); err != nil {
+		return nil, err
+	}
+
+	return ud, nil
+}
+
 // ProveUtxos returns an accumulator proof of the outpoints passed in with
 // respect to the UTXO state at chaintip.
 //
 // NOTE The accumulator state differs at every block height.  The caller must
 // take into consideration that an accumulator proof at block X will not be valid
-// at block height X+1.
+// at block height X+1.  The returned proof may be shared with other callers and
+// must not be modified.
 //
 // This function is safe for concurrent access.
 func (idx *FlatUtreexoProofIndex) ProveUtxos(utxos []*blockchain.UtxoEntry,
@@ -945,68 +1559,38 @@ func (idx *FlatUtreexoProofIndex) ProveUtxos(utxos []*blockchain.UtxoEntry,
 	}
 
 	// Get a read lock for the index.  This will prevent connectBlock from updating
-	// the beststate snapshot and the utreexo state.
+	// the utreexo state while the proof is generated.
 	idx.mtx.RLock()
 	defer idx.mtx.RUnlock()
 
-	accProof, err := idx.utreexoState.state.Prove(hashes)
-	if err != nil {
-		return nil, err
-	}
-
-	// Grab the height and the blockhash the proof was generated at.
-	snapshot := idx.chain.BestSnapshot()
-	provedAtHash := snapshot.Hash
-
-	proof := &blockchain.ChainTipProof{
-		ProvedAtHash: &provedAtHash,
-		AccProof:     &accProof,
-		HashesProven: hashes,
-	}
-
-	return proof, nil
+	return idx.utreexoState.prove(hashes)
 }
 
-// VerifyAccProof verifies the given accumulator proof.  Returns an error if the
-// verification failed.
+// VerifyAccProof verifies the given accumulator proof against the roots at the
+// tip of the index.  Returns an error if the verification failed.
+//
+// This function is safe for concurrent access.
 func (idx *FlatUtreexoProofIndex) VerifyAccProof(toProve []utreexo.Hash,
 	proof *utreexo.Proof) error {
-	return idx.utreexoState.state.Verify(toProve, *proof, false)
+	_, err := utreexo.Verify(idx.utreexoState.currentStump(), toProve, *proof)
+	return err
 }
 
 // updateRootsState updates the roots accumulator state from the roots of the current accumulator.
+//
+// This function MUST be called with the index lock held (for writes).
 func (idx *FlatUtreexoProofIndex) updateRootsState() error {
-	idx.mtx.Lock()
-	numLeaves := idx.utreexoState.state.GetNumLeaves()
-	roots := idx.utreexoState.state.GetRoots()
-	idx.mtx.Unlock()
-
-	bytes, err := blockchain.SerializeUtreexoRoots(numLeaves, roots)
+	bytes, err := blockchain.SerializeUtreexoRoots(
+		idx.utreexoState.state.GetNumLeaves(), idx.utreexoState.state.GetRoots())
 	if err != nil {
 		return err
 	}
 
 	rootHash := sha256.Sum256(bytes)
-	return idx.utreexoRootsState.Modify([]utreexo.Leaf{{Hash: rootHash}}, nil, utreexo.Proof{})
-}
-
-// updateBlockSummaryState updates the block summary accumulator state with the given inputs.
-func (idx *FlatUtreexoProofIndex) updateBlockSummaryState(numAdds uint16, blockHash *chainhash.Hash, proof utreexo.Proof) error {
-	summary := wire.UtreexoBlockSummary{
-		BlockHash:    *blockHash,
-		NumAdds:      numAdds,
-		BlockTargets: make([]uint64, len(proof.Targets)),
-	}
-	copy(summary.BlockTargets, proof.Targets)
-
-	buf := bytes.NewBuffer(make([]byte, 0, summary.SerializeSize()))
-	err := summary.Serialize(buf)
-	if err != nil {
-		return err
-	}
-	hash := sha256.Sum256(buf.Bytes())
 
-	return idx.blockSummaryState.Modify([]utreexo.Leaf{{Hash: hash}}, nil, utreexo.Proof{})
+	idx.rootsMtx.Lock()
+	defer idx.rootsMtx.Unlock()
+	return idx.utreexoRootsState.Modify([]utreexo.Leaf{{Hash: rootHash}}, nil, utreexo.Proof{})
 }
 
 // FetchUtreexoSummaries fetches all the summaries and attaches a proof for those summaries if requsted with the includeProof boolean.
@@ -1038,7 +1622,9 @@ func (idx *FlatUtreexoProofIndex) FetchUtreexoSummaries(blockHashes []*chainhash
 	}
 
 	if includeProof {
+		idx.summaryMtx.RLock()
 		proof, err := idx.blockSummaryState.Prove(leafHashes)
+		idx.summaryMtx.RUnlock()
 		if err != nil {
 			return nil, err
 		}
@@ -1083,10 +1669,20 @@ func (idx *FlatUtreexoProofIndex) fetchBlockSummary(blockHash *chainhash.Hash) (
 // FetchSummariesRoots returns the roots of the block summary state and the blockhash they were
 // at when the roots were fetched.
 func (idx *FlatUtreexoProofIndex) FetchSummariesRoots() (utreexo.Stump, chainhash.Hash) {
+	// Wait for the summaries of the blocks that were just connected to be
+	// added.  An error means that no more blocks are connected so the
+	// roots are returned as they are.
+	err := idx.waitForProofs()
+	if err != nil {
+		log.Warnf("Unable to wait for the utreexo proofs to be written: %v", err)
+	}
+
+	idx.summaryMtx.RLock()
 	stump := utreexo.Stump{
 		Roots:     idx.blockSummaryState.GetRoots(),
 		NumLeaves: idx.blockSummaryState.GetNumLeaves(),
 	}
+	idx.summaryMtx.RUnlock()
 	besthash := idx.chain.BestSnapshot().Hash
 
 	return stump, besthash
@@ -1094,14 +1690,19 @@ func (idx *FlatUtreexoProofIndex) FetchSummariesRoots() (utreexo.Stump, chainhas
 
 // FetchMsgUtreexoRoot returns a complete utreexoroot bitcoin message on the requested block.
 func (idx *FlatUtreexoProofIndex) FetchMsgUtreexoRoot(blockHash *chainhash.Hash) (*wire.MsgUtreexoRoot, error) {
-	height, err := idx.chain.BlockHeightByHash(blockHash)
-	if err != nil {
-		return nil, err
-	}
+	// Serve the tip from the in-memory snapshot to avoid hitting the
+	// flat files for the most requested block.
+	stump, bestHash := idx.utreexoState.currentTip()
+	if bestHash != *blockHash {
+		height, err := idx.chain.BlockHeightByHash(blockHash)
+		if err != nil {
+			return nil, err
+		}
 
-	stump, err := idx.fetchRoots(height)
-	if err != nil {
-		return nil, err
+		stump, err = idx.fetchRoots(height)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	bytes, err := blockchain.SerializeUtreexoRoots(stump.NumLeaves, stump.Roots)
@@ -1110,7 +1711,9 @@ func (idx *FlatUtreexoProofIndex) FetchMsgUtreexoRoot(blockHash *chainhash.Hash)
 	}
 	rootHash := sha256.Sum256(bytes)
 
+	idx.rootsMtx.RLock()
 	proof, err := idx.utreexoRootsState.Prove([]utreexo.Hash{rootHash})
+	idx.rootsMtx.RUnlock()
 	if err != nil {
 		return nil, err
 	}
@@ -1149,24 +1752,23 @@ func loadFlatFileState(dataDir, name string) (*FlatFileState, error) {
 }
 
 // NewFlatUtreexoProofIndex returns a new instance of an indexer that is used to create a flat utreexo proof index.
-// The passed in maxMemoryUsage should be in bytes and it determines how much memory the proof index will use up.
+// The utreexo state is configured with the passed in config and the name of the config is set to the type of the
+// flat utreexo proof index.
 //
 // It implements the Indexer interface which plugs into the IndexManager that in
 // turn is used by the blockchain package.  This allows the index to be
 // seamlessly maintained along with the chain.
-func NewFlatUtreexoProofIndex(pruned bool, chainParams *chaincfg.Params,
-	maxMemoryUsage int64, dataDir string, flush func() error) (*FlatUtreexoProofIndex, error) {
+func NewFlatUtreexoProofIndex(cfg *UtreexoConfig) (*FlatUtreexoProofIndex, error) {
+	config := *cfg
+	config.Name = flatUtreexoProofIndexType
+	dataDir := config.DataDir
 
 	idx := &FlatUtreexoProofIndex{
-		mtx: new(sync.RWMutex),
-		config: &UtreexoConfig{
-			MaxMemoryUsage: maxMemoryUsage,
-			Params:         chainParams,
-			Pruned:         pruned,
-			DataDir:        dataDir,
-			Name:           flatUtreexoProofIndexType,
-			FlushMainDB:    flush,
-		},
+		mtx:        new(sync.RWMutex),
+		rootsMtx:   new(sync.RWMutex),
+		summaryMtx: new(sync.RWMutex),
+		compactMtx: new(sync.Mutex),
+		config:     &config,
 	}
 
 	// Init the utreexo proof state if the node isn't pruned.
@@ -1176,6 +1778,13 @@ func NewFlatUtreexoProofIndex(pruned bool, chainParams *chaincfg.Params,
 			return nil, err
 		}
 		idx.proofState = *proofState
+		idx.proofState.syncWrites = idx.config.SyncPolicy.Proofs
+
+		summaryState, err := loadFlatFileState(dataDir, flatUtreexoSummaryName)
+		if err != nil {
+			return nil, err
+		}
+		idx.summaryState = *summaryState
 	}
 
 	// Init the undo block state.
@@ -1184,6 +1793,7 @@ func NewFlatUtreexoProofIndex(pruned bool, chainParams *chaincfg.Params,
 		return nil, err
 	}
 	idx.undoState = *undoState
+	idx.undoState.syncWrites = idx.config.SyncPolicy.Undo
 
 	proofStatsState, err := loadFlatFileState(dataDir, flatUtreexoProofStatsName)
 	if err != nil {
@@ -1197,6 +1807,14 @@ func NewFlatUtreexoProofIndex(pruned bool, chainParams *chaincfg.Params,
 	}
 	idx.rootsState = *rootsState
 
+	if idx.config.LeafTTLs {
+		ttlState, err := loadFlatFileState(dataDir, flatUtreexoLeafTTLName)
+		if err != nil {
+			return nil, err
+		}
+		idx.ttlState = *ttlState
+	}
+
 	err = idx.pStats.InitPStats(proofStatsState)
 	if err != nil {
 		return nil, err
@@ -1237,6 +1855,18 @@ func DropFlatUtreexoProofIndex(db database.DB, dataDir string, interrupt <-chan
 		return err
 	}
 
+	ttlPath := flatFilePath(dataDir, flatUtreexoLeafTTLName)
+	err = deleteFlatFile(ttlPath)
+	if err != nil {
+		return err
+	}
+
+	summaryPath := flatFilePath(dataDir, flatUtreexoSummaryName)
+	err = deleteFlatFile(summaryPath)
+	if err != nil {
+		return err
+	}
+
 	path := utreexoBasePath(&UtreexoConfig{DataDir: dataDir, Name: flatUtreexoProofIndexType})
 	return deleteUtreexoState(path)
 }
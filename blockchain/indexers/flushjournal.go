@@ -0,0 +1,370 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// A flush of the utreexo state that's split into several batches isn't atomic
+// and the nodes on disk are neither at the last flushed block nor at the block
+// being flushed when it's interrupted.  To keep such a flush recoverable, the
+// writes are first journaled under their own keys and a partial-flush marker is
+// committed along with the last of them.  The journal is then applied to the
+// nodes and the cached leaves and the marker is replaced with the consistency
+// state.  An interrupted flush is resumed from the journal on the next start
+// when the marker made it to disk and is dropped otherwise, in which case the
+// blocks since the last flush are replayed as usual.
+
+const (
+	// flushProgressInterval is how often the progress of a flush of the
+	// utreexo state is logged.
+	flushProgressInterval = 5 * time.Second
+
+	// journalOpDelete and journalOpSet tell apart the journaled deletes and
+	// sets of the keys.
+	journalOpDelete = 0
+	journalOpSet    = 1
+)
+
+var (
+	// utreexoFlushMarkerKeyName is the name of the db key of the marker of a
+	// flush that's journaled but not fully applied yet.
+	utreexoFlushMarkerKeyName = []byte("utreexopartialflush")
+
+	// utreexoFlushJournalPrefix is the prefix of the keys of the journaled
+	// writes of a flush.  It's followed by the big endian sequence number of
+	// the write so that the writes are iterated over in order.
+	utreexoFlushJournalPrefix = []byte("utreexoflushjournal")
+)
+
+// flushJournalKey returns the key of the journaled write with the given
+// sequence number.
+func flushJournalKey(seq uint64) []byte {
+	key := make([]byte, len(utreexoFlushJournalPrefix)+8)
+	copy(key, utreexoFlushJournalPrefix)
+	binary.BigEndian.PutUint64(key[len(utreexoFlushJournalPrefix):], seq)
+	return key
+}
+
+// flushJournalBounds returns the bounds of an iterator over all the journaled
+// writes.
+func flushJournalBounds() *pebble.IterOptions {
+	upper := make([]byte, len(utreexoFlushJournalPrefix))
+	copy(upper, utreexoFlushJournalPrefix)
+	upper[len(upper)-1]++
+
+	return &pebble.IterOptions{
+		LowerBound: utreexoFlushJournalPrefix,
+		UpperBound: upper,
+	}
+}
+
+// serializeJournalEntry returns the journaled write of the value to the key.  A
+// nil value is a delete of the key.
+//
+// The serialized format is:
+//
+//	<op><key length><key><value>
+//
+//	Field       Type     Size
+//	op          byte     1
+//	key length  uvarint  variable
+//	key         []byte   key length
+//	value       []byte   the rest
+func serializeJournalEntry(key, value []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(key)))
+
+	buf := make([]byte, 0, 1+n+len(key)+len(value))
+	if value == nil {
+		buf = append(buf, journalOpDelete)
+	} else {
+		buf = append(buf, journalOpSet)
+	}
+	buf = append(buf, lenBuf[:n]...)
+	buf = append(buf, key...)
+	return append(buf, value...)
+}
+
+// deserializeJournalEntry returns the key and the value of a journaled write.
+// The value is nil for a delete.
+func deserializeJournalEntry(serialized []byte) ([]byte, []byte, error) {
+	if len(serialized) < 1 {
+		return nil, nil, fmt.Errorf("empty flush journal entry")
+	}
+	op := serialized[0]
+	keyLen, n := binary.Uvarint(serialized[1:])
+	if n <= 0 || uint64(len(serialized)-1-n) < keyLen {
+		return nil, nil, fmt.Errorf("malformed flush journal entry")
+	}
+	key := serialized[1+n : 1+n+int(keyLen)]
+	value := serialized[1+n+int(keyLen):]
+
+	switch op {
+	case journalOpDelete:
+		if len(value) != 0 {
+			return nil, nil, fmt.Errorf("flush journal delete entry " +
+				"has a value")
+		}
+		return key, nil, nil
+	case journalOpSet:
+		return key, value, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown flush journal op %d", op)
+	}
+}
+
+// flushProgress logs how many of the keys of a flush were written every
+// flushProgressInterval.
+type flushProgress struct {
+	name    string
+	action  string
+	written uint64
+	total   uint64
+	lastLog time.Time
+}
+
+// newFlushProgress returns a flushProgress for the named utreexo state.  total
+// is the count of the keys to write or 0 when it isn't known.
+func newFlushProgress(name, action string, total uint64) *flushProgress {
+	return &flushProgress{
+		name:    name,
+		action:  action,
+		total:   total,
+		lastLog: time.Now(),
+	}
+}
+
+// update sets the count of the written keys and logs it if it wasn't logged
+// for a while.
+func (p *flushProgress) update(written uint64) {
+	p.written = written
+	if time.Since(p.lastLog) < flushProgressInterval {
+		return
+	}
+	p.lastLog = time.Now()
+
+	if p.total == 0 {
+		log.Infof("%s the %s utreexo state: %d keys written", p.action,
+			p.name, p.written)
+		return
+	}
+	log.Infof("%s the %s utreexo state: %d/%d keys written (%.1f%%)",
+		p.action, p.name, p.written, p.total,
+		float64(p.written)*100/float64(p.total))
+}
+
+// flushJournal records the writes of a flush under the journal keys instead of
+// writing them to the keys themselves.
+//
+// This is part of the blockchain.UtreexoBatch interface.
+type flushJournal struct {
+	batch    *blockchain.SplitBatch
+	seq      uint64
+	progress *flushProgress
+}
+
+// Enforce flushJournal to implement the UtreexoBatch interface.
+var _ blockchain.UtreexoBatch = (*flushJournal)(nil)
+
+// Set journals the write of the value to the key.  The write options are
+// ignored.
+func (j *flushJournal) Set(key, value []byte, _ *pebble.WriteOptions) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return j.add(serializeJournalEntry(key, value))
+}
+
+// Delete journals the delete of the key.  The write options are ignored.
+func (j *flushJournal) Delete(key []byte, _ *pebble.WriteOptions) error {
+	return j.add(serializeJournalEntry(key, nil))
+}
+
+// add adds the serialized write to the journal.
+func (j *flushJournal) add(entry []byte) error {
+	err := j.batch.Set(flushJournalKey(j.seq), entry, nil)
+	if err != nil {
+		return err
+	}
+	j.seq++
+	j.progress.update(j.seq)
+
+	return nil
+}
+
+// serializeFlushMarker returns the partial-flush marker of a flush of count
+// journaled writes that leaves the utreexo state at the serialized consistency
+// state.
+func serializeFlushMarker(consistency []byte, count uint64) []byte {
+	buf := make([]byte, len(consistency)+8)
+	copy(buf, consistency)
+	binary.LittleEndian.PutUint64(buf[len(consistency):], count)
+	return buf
+}
+
+// dbFetchFlushMarker returns the consistency state and the count of the
+// journaled writes of the partial-flush marker.  A nil consistency state is
+// returned when there's no marker.
+func dbFetchFlushMarker(db *pebble.DB) ([]byte, uint64, error) {
+	buf, closer, err := db.Get(utreexoFlushMarkerKeyName)
+	if err == pebble.ErrNotFound {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closer.Close()
+
+	if len(buf) != utreexoStateConsistencyLen+8 {
+		return nil, 0, fmt.Errorf("the utreexo partial-flush marker is "+
+			"%d bytes instead of %d", len(buf),
+			utreexoStateConsistencyLen+8)
+	}
+	consistency := make([]byte, utreexoStateConsistencyLen)
+	copy(consistency, buf)
+	count := binary.LittleEndian.Uint64(buf[utreexoStateConsistencyLen:])
+
+	return consistency, count, nil
+}
+
+// journalLeavesAndNodes journals the writes of the flush of the nodes and the
+// cached leaves and commits them along with the partial-flush marker that
+// leaves the utreexo state at the serialized consistency state once they're
+// applied.  The count of the batch commits and of the journaled writes are
+// returned.
+func (us *UtreexoState) journalLeavesAndNodes(bestHash *chainhash.Hash,
+	consistency []byte) (int, uint64, error) {
+
+	journal := &flushJournal{
+		batch: blockchain.NewSplitBatch(us.utreexoStateDB,
+			us.config.FlushBatchSize,
+			pebbleWriteOptions(us.config.SyncPolicy.Nodes)),
+		progress: newFlushProgress(us.config.Name, "Journaling", 0),
+	}
+	err := us.flushLeavesAndNodes(journal, bestHash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = journal.batch.Set(utreexoFlushMarkerKeyName,
+		serializeFlushMarker(consistency, journal.seq), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = journal.batch.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return journal.batch.Commits(), journal.seq, nil
+}
+
+// applyFlushJournal writes the journaled writes to the keys themselves with the
+// given batch.  Each journaled write is dropped along with being applied so
+// that an interrupted apply resumes from the first write that wasn't applied.
+// Applying a write twice is harmless as a flush writes each key only once.
+// count is the count of the journaled writes of the whole flush and is only
+// used for logging the progress.
+func applyFlushJournal(db *pebble.DB, batch *blockchain.SplitBatch, name string,
+	count uint64) error {
+
+	iter, err := db.NewIter(flushJournalBounds())
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	progress := newFlushProgress(name, "Flushing", count)
+	for iter.First(); iter.Valid(); iter.Next() {
+		key, value, err := deserializeJournalEntry(iter.Value())
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			err = batch.Delete(key, nil)
+		} else {
+			err = batch.Set(key, value, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		journalKey := iter.Key()
+		err = batch.Delete(journalKey, nil)
+		if err != nil {
+			return err
+		}
+
+		seq := binary.BigEndian.Uint64(
+			journalKey[len(utreexoFlushJournalPrefix):])
+		progress.update(seq + 1)
+	}
+
+	return iter.Error()
+}
+
+// resumeUtreexoFlush finishes the flush of the utreexo state that was
+// interrupted after it was journaled.  The journal of a flush that was
+// interrupted before it was fully journaled is dropped instead as the utreexo
+// state on disk is still at the last completed flush then.
+func resumeUtreexoFlush(db *pebble.DB, cfg *UtreexoConfig) error {
+	consistency, count, err := dbFetchFlushMarker(db)
+	if err != nil {
+		return err
+	}
+
+	batch := blockchain.NewSplitBatch(db, cfg.FlushBatchSize,
+		pebbleWriteOptions(cfg.SyncPolicy.Consistency))
+	if consistency == nil {
+		iter, err := db.NewIter(flushJournalBounds())
+		if err != nil {
+			return err
+		}
+		var dropped int
+		for iter.First(); iter.Valid(); iter.Next() {
+			err = batch.Delete(iter.Key(), nil)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+			dropped++
+		}
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return err
+		}
+		if dropped > 0 {
+			log.Infof("Dropped the journal of %d keys of an interrupted "+
+				"flush of the %s utreexo state", dropped, cfg.Name)
+		}
+		return batch.Commit()
+	}
+
+	log.Infof("Resuming an interrupted flush of the %s utreexo state "+
+		"of %d keys", cfg.Name, count)
+	err = applyFlushJournal(db, batch, cfg.Name, count)
+	if err != nil {
+		return err
+	}
+	err = batch.Set(utreexoStateConsistencyKeyName, consistency, nil)
+	if err != nil {
+		return err
+	}
+	err = batch.Delete(utreexoFlushMarkerKeyName, nil)
+	if err != nil {
+		return err
+	}
+
+	return batch.Commit()
+}
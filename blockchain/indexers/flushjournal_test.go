@@ -0,0 +1,104 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestJournalEntrySerialize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   []byte
+		value []byte
+	}{
+		{
+			name:  "set",
+			key:   []byte{0, 0, 0, 0, 0, 0, 1, 2},
+			value: bytes.Repeat([]byte{0xaa}, 33),
+		},
+		{
+			name:  "set empty value",
+			key:   bytes.Repeat([]byte{0x11}, 32),
+			value: []byte{},
+		},
+		{
+			name: "delete",
+			key:  bytes.Repeat([]byte{0x22}, 200),
+		},
+	}
+	for _, test := range tests {
+		serialized := serializeJournalEntry(test.key, test.value)
+		key, value, err := deserializeJournalEntry(serialized)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !bytes.Equal(key, test.key) {
+			t.Fatalf("%s: expected key %x, got %x", test.name,
+				test.key, key)
+		}
+		if (value == nil) != (test.value == nil) ||
+			!bytes.Equal(value, test.value) {
+
+			t.Fatalf("%s: expected value %x, got %x", test.name,
+				test.value, value)
+		}
+
+		// Truncating the key is caught.
+		_, _, err = deserializeJournalEntry(serialized[:2+len(test.key)/2])
+		if err == nil {
+			t.Fatalf("%s: expected an error for a truncated entry",
+				test.name)
+		}
+	}
+
+	for _, serialized := range [][]byte{
+		nil,
+		{journalOpDelete, 1, 0xff, 0xee},
+		{2, 1, 0xff},
+	} {
+		_, _, err := deserializeJournalEntry(serialized)
+		if err == nil {
+			t.Fatalf("expected an error for %x", serialized)
+		}
+	}
+}
+
+func TestFlushJournalKeys(t *testing.T) {
+	t.Parallel()
+
+	// The journal keys sort in the order of their sequence numbers and all
+	// fall within the iterator bounds.
+	bounds := flushJournalBounds()
+	prev := flushJournalKey(0)
+	for _, seq := range []uint64{1, 255, 256, 1 << 32, 1<<64 - 1} {
+		key := flushJournalKey(seq)
+		if bytes.Compare(prev, key) >= 0 {
+			t.Fatalf("journal key of %d doesn't sort after %x", seq, prev)
+		}
+		if bytes.Compare(key, bounds.LowerBound) < 0 ||
+			bytes.Compare(key, bounds.UpperBound) >= 0 {
+
+			t.Fatalf("journal key of %d is out of the bounds", seq)
+		}
+		prev = key
+	}
+
+	// None of the other keys of the utreexo state fall within them.
+	for _, key := range [][]byte{
+		utreexoFlushMarkerKeyName,
+		utreexoStateConsistencyKeyName,
+		utreexoStateNetworkKeyName,
+	} {
+		if bytes.Compare(key, bounds.LowerBound) >= 0 &&
+			bytes.Compare(key, bounds.UpperBound) < 0 {
+
+			t.Fatalf("%s is within the journal bounds", key)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,12 +74,20 @@ func createDB(dbName string) (database.DB, string, error) {
 func initIndexes(dbPath string, db database.DB, params *chaincfg.Params) (
 	*Manager, []Indexer, error) {
 
-	flatUtreexoProofIndex, err := NewFlatUtreexoProofIndex(false, params, 50*1024*1024, dbPath, db.Flush)
+	cfg := &UtreexoConfig{
+		MaxMemoryUsage: 50 * 1024 * 1024,
+		Params:         params,
+		DataDir:        dbPath,
+		FlushMainDB:    db.Flush,
+		LeafTTLs:       true,
+	}
+
+	flatUtreexoProofIndex, err := NewFlatUtreexoProofIndex(cfg)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	utreexoProofIndex, err := NewUtreexoProofIndex(db, false, 50*1024*1024, params, dbPath, db.Flush)
+	utreexoProofIndex, err := NewUtreexoProofIndex(db, cfg)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -200,14 +209,10 @@ func compareUtreexoIdx(start, end int32, pruned bool, chain *blockchain.BlockCha
 					}
 
 				} else {
-					err = idxType.db.View(func(dbTx database.Tx) error {
-						numAdds, targets, delHashes, err = dbFetchUndoData(dbTx, block.Hash())
-						if err != nil {
-							return err
-						}
-
-						return nil
-					})
+					numAdds, targets, delHashes, err = idxType.fetchUndoBlock(b)
+					if err != nil {
+						return err
+					}
 				}
 
 			case *FlatUtreexoProofIndex:
@@ -500,6 +505,43 @@ func TestProveUtxos(t *testing.T) {
 		t.Fatalf("timenow:%v. %v", timenow, err)
 	}
 
+	// Check that iterating over the proofs returns the same proofs as
+	// fetching them one by one.
+	for _, indexer := range indexes {
+		var err error
+		switch idxType := indexer.(type) {
+		case *UtreexoProofIndex:
+			err = idxType.FetchUtreexoProofs(1, 100, func(height int32, ud *wire.UData) error {
+				hash, err := chain.BlockHashByHeight(height)
+				if err != nil {
+					return err
+				}
+				expect, err := idxType.FetchUtreexoProof(hash)
+				if err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(expect, ud) {
+					return fmt.Errorf("iterated proof differs at height %d", height)
+				}
+				return nil
+			})
+		case *FlatUtreexoProofIndex:
+			err = idxType.FetchUtreexoProofs(1, 100, func(height int32, ud *wire.UData) error {
+				expect, err := idxType.FetchUtreexoProof(height)
+				if err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(expect, ud) {
+					return fmt.Errorf("iterated proof differs at height %d", height)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			t.Fatalf("timenow:%v. %v", timenow, err)
+		}
+	}
+
 	// Create a chain that consumes the data from the indexes and test that this
 	// chain is able to consume the data properly.
 	csnChain, _, csnTearDown, err := csnTestChain("TestProveUtxos-CsnChain")
@@ -875,8 +917,9 @@ func TestBridgeNodePruneUndoDataGen(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Make sure that the undo data is the same.
-	err = compareUtreexoIdx(1, maxHeight, true, chain, indexes)
+	// Make sure that the undo data is the same.  The undo data is only kept
+	// for the last blocks.
+	err = compareUtreexoIdx(undoStartHeight(maxHeight, DefaultUndoRetention), maxHeight, true, chain, indexes)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1142,6 +1185,114 @@ func compareUtreexoRootsState(indexes []Indexer, blockHash *chainhash.Hash) erro
 	return nil
 }
 
+func TestFlatUndoRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	// Keep the undo blocks of only the last 10 blocks like a pruned node
+	// would.
+	const retention = 10
+	undoState, err := loadFlatFileState(dir, flatUtreexoUndoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer undoState.Close()
+	idx := &FlatUtreexoProofIndex{
+		undoState: *undoState,
+		config: &UtreexoConfig{
+			Pruned:        true,
+			UndoRetention: retention,
+		},
+	}
+
+	maxHeight := int32(30)
+	for height := int32(1); height <= maxHeight; height++ {
+		err = idx.storeUndoBlock(height, uint64(height), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.pruneUndoBlocks(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The undo blocks deeper than the retention are dropped.
+	start := undoStartHeight(maxHeight, retention)
+	for height := int32(1); height <= maxHeight; height++ {
+		numAdds, _, _, err := idx.fetchUndoBlock(height)
+		if height < start {
+			if err == nil {
+				t.Fatalf("expected the undo block at height %d "+
+					"to be dropped", height)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected the undo block at height %d to be "+
+				"kept: %v", height, err)
+		}
+		if numAdds != uint64(height) {
+			t.Fatalf("expected %d adds at height %d, got %d",
+				height, height, numAdds)
+		}
+	}
+
+	// The default retention applies when it isn't set.
+	idx.config.UndoRetention = 0
+	if got := idx.config.undoRetention(); got != DefaultUndoRetention {
+		t.Fatalf("expected the default retention of %d, got %d",
+			DefaultUndoRetention, got)
+	}
+}
+
+// TestFlatStoragePaths ensures that every flat file directory the flat utreexo
+// proof index creates is in its storage paths.
+func TestFlatStoragePaths(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestFlatStoragePaths")
+	defer tearDown()
+
+	var spends []*blockchain.SpendableOut
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < 10; i++ {
+		block, outs, err := blockchain.AddBlock(chain, nextBlock, spends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock, spends = block, outs
+	}
+
+	for _, indexer := range indexes {
+		idx, ok := indexer.(*FlatUtreexoProofIndex)
+		if !ok {
+			continue
+		}
+
+		paths := idx.StoragePaths()
+		expected := []string{utreexoBasePath(idx.config)}
+		entries, err := os.ReadDir(idx.config.DataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && strings.HasSuffix(entry.Name(),
+				"_"+flatFileNameSuffix) {
+
+				expected = append(expected, filepath.Join(
+					idx.config.DataDir, entry.Name()))
+			}
+		}
+		for _, path := range expected {
+			if !slices.Contains(paths, path) {
+				t.Fatalf("%s is missing from the storage paths %v",
+					path, paths)
+			}
+		}
+	}
+}
+
 func TestUtreexoRootsAndSummaryState(t *testing.T) {
 	// Always remove the root on return.
 	defer os.RemoveAll(testDbRoot)
@@ -1219,3 +1370,251 @@ func TestUtreexoRootsAndSummaryState(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestTipUtreexoRoot ensures that the roots of the tip of the proof indexes can
+// always be proven to peers while blocks are being connected.
+func TestTipUtreexoRoot(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestTipUtreexoRoot")
+	defer tearDown()
+
+	type rootFetcher interface {
+		FetchMsgUtreexoRoot(*chainhash.Hash) (*wire.MsgUtreexoRoot, error)
+		FetchCurrentUtreexoState() ([]*chainhash.Hash, uint64, chainhash.Hash)
+	}
+
+	quit := make(chan struct{})
+	errChan := make(chan error, len(indexes))
+	for _, indexer := range indexes {
+		idx, ok := indexer.(rootFetcher)
+		if !ok {
+			continue
+		}
+		go func(name string) {
+			for {
+				select {
+				case <-quit:
+					errChan <- nil
+					return
+				default:
+				}
+
+				_, _, bestHash := idx.FetchCurrentUtreexoState()
+				if bestHash == (chainhash.Hash{}) {
+					continue
+				}
+				_, err := idx.FetchMsgUtreexoRoot(&bestHash)
+				if err != nil {
+					errChan <- fmt.Errorf("%s: unable to prove the "+
+						"roots at the tip %v: %v",
+						name, bestHash, err)
+					return
+				}
+			}
+		}(indexer.Name())
+	}
+
+	var spends []*blockchain.SpendableOut
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < 100; i++ {
+		block, outs, err := blockchain.AddBlock(chain, nextBlock, spends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock, spends = block, outs
+	}
+	close(quit)
+
+	for _, indexer := range indexes {
+		if _, ok := indexer.(rootFetcher); !ok {
+			continue
+		}
+		if err := <-errChan; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestHybridValidation ensures that the utreexo proof indexes connect and
+// disconnect blocks with the accumulator cross-checked against the UTXO set.
+func TestHybridValidation(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestHybridValidation")
+	defer tearDown()
+
+	for _, indexer := range indexes {
+		switch idxType := indexer.(type) {
+		case *UtreexoProofIndex:
+			idxType.config.CrossCheck = true
+		case *FlatUtreexoProofIndex:
+			idxType.config.CrossCheck = true
+		}
+	}
+
+	var allSpends []*blockchain.SpendableOut
+	var nextSpends []*blockchain.SpendableOut
+
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < 50; i++ {
+		newBlock, newSpendableOuts, err := blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock = newBlock
+
+		allSpends = append(allSpends, newSpendableOuts...)
+
+		var nextSpendsTmp []*blockchain.SpendableOut
+		for j := 0; j < len(allSpends); j++ {
+			randIdx := rand.Intn(len(allSpends))
+
+			spend := allSpends[randIdx]                                       // get
+			allSpends = append(allSpends[:randIdx], allSpends[randIdx+1:]...) // delete
+			nextSpendsTmp = append(nextSpendsTmp, spend)
+		}
+		nextSpends = nextSpendsTmp
+	}
+
+	// Disconnect the tip and connect a different block on top of the new
+	// tip to go through both directions with the cross check enabled.
+	bestHash := chain.BestSnapshot().Hash
+	err := chain.InvalidateBlock(&bestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bestHash = chain.BestSnapshot().Hash
+	err = compareUtreexoRootsState(indexes, &bestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevBlock, err := chain.BlockByHash(&bestHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBlock, _, err := blockchain.AddBlock(chain, prevBlock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = compareUtreexoIdx(1, newBlock.Height(), false, chain, indexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the accumulators drift from the UTXO set with a leaf that no
+	// output is behind.  The next block has to be refused.
+	drift := func(us *UtreexoState) {
+		err := us.state.Modify([]utreexo.Leaf{{Hash: utreexo.Hash{0xff}}},
+			nil, utreexo.Proof{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		us.updateTip(newBlock.Hash())
+	}
+	for _, indexer := range indexes {
+		switch idxType := indexer.(type) {
+		case *UtreexoProofIndex:
+			drift(idxType.utreexoState)
+		case *FlatUtreexoProofIndex:
+			drift(idxType.utreexoState)
+		}
+	}
+	_, _, err = blockchain.AddBlock(chain, newBlock, nil)
+	if err == nil || !strings.Contains(err.Error(), "diverged") {
+		t.Fatalf("expected the drifted accumulator to be caught, got %v", err)
+	}
+}
+
+// BenchmarkFetchCurrentUtreexoState measures reading the roots at the tip of
+// the proof indexes while blocks are being connected and the utreexo state is
+// being flushed.  The "mutex" case reads the accumulator under the index lock
+// like the readers did before the tip snapshot and serves as the baseline.
+func BenchmarkFetchCurrentUtreexoState(b *testing.B) {
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("BenchmarkFetchCurrentUtreexoState")
+	defer tearDown()
+
+	var idx *UtreexoProofIndex
+	for _, indexer := range indexes {
+		if uIdx, ok := indexer.(*UtreexoProofIndex); ok {
+			idx = uIdx
+		}
+	}
+
+	readers := []struct {
+		name string
+		read func()
+	}{
+		{
+			name: "mutex",
+			read: func() {
+				idx.mtx.RLock()
+				stump := utreexo.Stump{
+					Roots:     idx.utreexoState.state.GetRoots(),
+					NumLeaves: idx.utreexoState.state.GetNumLeaves(),
+				}
+				idx.mtx.RUnlock()
+				_ = stumpToChainhashRoots(stump)
+			},
+		},
+		{
+			name: "snapshot",
+			read: func() {
+				_, _, _ = idx.FetchCurrentUtreexoState()
+			},
+		},
+	}
+
+	tip := btcutil.NewBlock(params.GenesisBlock)
+	for _, reader := range readers {
+		b.Run(reader.name, func(b *testing.B) {
+			quit := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				var spends []*blockchain.SpendableOut
+				for i := 1; ; i++ {
+					select {
+					case <-quit:
+						return
+					default:
+					}
+
+					var err error
+					tip, spends, err = blockchain.AddBlock(chain, tip, spends)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+
+					if i%10 == 0 {
+						err = idx.Flush(tip.Hash(),
+							blockchain.FlushRequired, true)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					reader.read()
+				}
+			})
+			b.StopTimer()
+
+			close(quit)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// leafDataIndexName is the human-readable name for the index.
+	leafDataIndexName = "leaf data index"
+)
+
+var (
+	// leafDataIndexKey is the key of the leaf data index and the db bucket
+	// used to house it.
+	leafDataIndexKey = []byte("leafdatabyhashidx")
+)
+
+// -----------------------------------------------------------------------------
+// The leaf data index consists of an entry for every leaf that is currently in
+// the utreexo accumulator.  Each entry maps the hash of the leaf to the leaf data
+// that it commits to.  Entries are added when the leaves are added to the
+// accumulator and removed when they're deleted so that the index always
+// reflects the accumulator at the tip.
+//
+// Together with the accumulator of a utreexo proof index, which maps positions
+// to leaf hashes, it answers what leaf is at a given position.
+//
+// The serialized format for keys and values in the leaf data bucket is:
+//   <leaf hash> = <leaf data>
+//
+//   Field           Type              Size
+//   leaf hash       utreexo.Hash      32 bytes
+//   leaf data       wire.LeafData     variable
+// -----------------------------------------------------------------------------
+
+// dbPutLeafDatas adds an entry for each of the leaf datas to the index.
+func dbPutLeafDatas(dbTx database.Tx, leafDatas []wire.LeafData) error {
+	bucket := dbTx.Metadata().Bucket(leafDataIndexKey)
+	for i := range leafDatas {
+		var buf bytes.Buffer
+		buf.Grow(leafDatas[i].SerializeSize())
+		err := leafDatas[i].Serialize(&buf)
+		if err != nil {
+			return err
+		}
+
+		leafHash := leafDatas[i].LeafHash()
+		err = bucket.Put(leafHash[:], buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbRemoveLeafDatas removes the entries of each of the leaf datas from the
+// index.
+func dbRemoveLeafDatas(dbTx database.Tx, leafDatas []wire.LeafData) error {
+	bucket := dbTx.Metadata().Bucket(leafDataIndexKey)
+	for i := range leafDatas {
+		leafHash := leafDatas[i].LeafHash()
+		err := bucket.Delete(leafHash[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dbFetchLeafData returns the leaf data of the given leaf hash from the index.
+// nil is returned when there's no entry for the leaf hash.
+func dbFetchLeafData(dbTx database.Tx, leafHash utreexo.Hash) (*wire.LeafData, error) {
+	serialized := dbTx.Metadata().Bucket(leafDataIndexKey).Get(leafHash[:])
+	if serialized == nil {
+		return nil, nil
+	}
+
+	var leafData wire.LeafData
+	err := leafData.Deserialize(bytes.NewReader(serialized))
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt leaf data index "+
+				"entry for %s: %v", chainhash.Hash(leafHash), err),
+		}
+	}
+
+	return &leafData, nil
+}
+
+// blockLeafDatas returns the leaf datas of the leaves the block adds to and
+// deletes from the accumulator.
+func blockLeafDatas(chain *blockchain.BlockChain, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) ([]wire.LeafData, []wire.LeafData, error) {
+
+	_, outCount, inskip, outskip := blockchain.DedupeBlock(block)
+	dels, err := blockchain.BlockToDelLeaves(stxos, chain, block, inskip)
+	if err != nil {
+		return nil, nil, err
+	}
+	adds := blockchain.BlockToAddLeafDatas(block, outskip, outCount)
+
+	return adds, dels, nil
+}
+
+// LeafDataIndex implements an index of the leaf datas of the leaves that are
+// in the utreexo accumulator by their leaf hash.
+type LeafDataIndex struct {
+	db    database.DB
+	chain *blockchain.BlockChain
+}
+
+// Ensure the LeafDataIndex type implements the Indexer interface.
+var _ Indexer = (*LeafDataIndex)(nil)
+
+// Ensure the LeafDataIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*LeafDataIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *LeafDataIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the leaf data index.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) Init(chain *blockchain.BlockChain, _ *chainhash.Hash, _ int32) error {
+	idx.chain = chain
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) Key() []byte {
+	return leafDataIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) Name() string {
+	return leafDataIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the leaf data
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(leafDataIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for every leaf the
+// block adds to the accumulator and removes the entries of the leaves it
+// deletes.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	// The outputs of the genesis block aren't added to the accumulator.
+	if block.Height() == 0 {
+		return nil
+	}
+
+	adds, dels, err := blockLeafDatas(idx.chain, block, stxos)
+	if err != nil {
+		return err
+	}
+
+	err = dbRemoveLeafDatas(dbTx, dels)
+	if err != nil {
+		return err
+	}
+
+	return dbPutLeafDatas(dbTx, adds)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries of the
+// leaves the block added and adds back the entries of the leaves it deleted.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	if block.Height() == 0 {
+		return nil
+	}
+
+	adds, dels, err := blockLeafDatas(idx.chain, block, stxos)
+	if err != nil {
+		return err
+	}
+
+	err = dbRemoveLeafDatas(dbTx, adds)
+	if err != nil {
+		return err
+	}
+
+	return dbPutLeafDatas(dbTx, dels)
+}
+
+// PruneBlock is invoked when an older block is deleted after it's been
+// processed.
+// NOTE: For LeafDataIndex, it's a no-op as the index isn't allowed to be
+// enabled with pruning.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) PruneBlock(_ database.Tx, _ *chainhash.Hash, _ int32) error {
+	return nil
+}
+
+// NOTE: For LeafDataIndex, flush is a no-op.
+//
+// This is part of the Indexer interface.
+func (idx *LeafDataIndex) Flush(_ *chainhash.Hash, _ blockchain.FlushMode, _ bool) error {
+	return nil
+}
+
+// FetchLeafData returns the leaf data of the leaf with the given hash.  When
+// the leaf isn't in the accumulator, nil will be returned for both the leaf data
+// and the error.
+//
+// This function is safe for concurrent access.
+func (idx *LeafDataIndex) FetchLeafData(leafHash utreexo.Hash) (*wire.LeafData, error) {
+	var leafData *wire.LeafData
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		leafData, err = dbFetchLeafData(dbTx, leafHash)
+		return err
+	})
+	return leafData, err
+}
+
+// NewLeafDataIndex returns a new instance of an indexer that is used to create
+// a mapping of the hashes of the leaves in the utreexo accumulator to their
+// leaf datas.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewLeafDataIndex(db database.DB) *LeafDataIndex {
+	return &LeafDataIndex{db: db}
+}
+
+// DropLeafDataIndex drops the leaf data index from the provided database if it
+// exists.
+func DropLeafDataIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, leafDataIndexKey, leafDataIndexName, interrupt)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// checkLeafDataIndex checks that the leaf data index has an entry for exactly
+// the unspent outputs of the chain.
+func checkLeafDataIndex(t *testing.T, chain *blockchain.BlockChain,
+	db database.DB, idx *LeafDataIndex) {
+
+	t.Helper()
+
+	var unspent int
+	best := chain.BestSnapshot()
+	for height := int32(1); height <= best.Height; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for coinbase, tx := range block.Transactions() {
+			for outIdx, txOut := range tx.MsgTx().TxOut {
+				op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+				entry, err := chain.FetchUtxoEntry(op)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if entry == nil || entry.IsSpent() {
+					continue
+				}
+				unspent++
+
+				want := wire.LeafData{
+					BlockHash:  *block.Hash(),
+					OutPoint:   op,
+					Amount:     txOut.Value,
+					PkScript:   txOut.PkScript,
+					Height:     height,
+					IsCoinBase: coinbase == 0,
+				}
+				leafData, err := idx.FetchLeafData(want.LeafHash())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if leafData == nil {
+					t.Fatalf("no leaf data for unspent output %v", op)
+				}
+				if !reflect.DeepEqual(*leafData, want) {
+					t.Fatalf("expected leaf data %v, got %v",
+						want.String(), leafData.String())
+				}
+			}
+		}
+	}
+
+	// The index shouldn't have any entries for the spent outputs.
+	var entries int
+	err := db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(leafDataIndexKey)
+		return bucket.ForEach(func(_, _ []byte) error {
+			entries++
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != unspent {
+		t.Fatalf("expected %d entries in the leaf data index, got %d",
+			unspent, entries)
+	}
+
+	// The coin age statistics count every entry at the tip.
+	stats, err := idx.CoinAgeStats(func(int64, []byte) bool { return false }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Height != best.Height || stats.BlockHash != best.Hash ||
+		stats.Total.Count != uint64(unspent) {
+
+		t.Fatalf("expected %d outputs at %v (%d), got %d at %v (%d)",
+			unspent, best.Hash, best.Height, stats.Total.Count,
+			stats.BlockHash, stats.Height)
+	}
+}
+
+func TestLeafDataIndex(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+
+	db, dbPath, err := createDB("TestLeafDataIndex")
+	defer func() {
+		db.Close()
+		os.RemoveAll(dbPath)
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewLeafDataIndex(db)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:               db,
+		ChainParams:      &params,
+		TimeSource:       blockchain.NewMedianTime(),
+		SigCache:         txscript.NewSigCache(1000),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+		IndexManager:     NewManager(db, []Indexer{idx}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a chain where every block spends the outputs created in the
+	// previous one.
+	tip := btcutil.NewBlock(params.GenesisBlock)
+	b1, spends1, err := blockchain.AddBlock(chain, tip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextBlock, nextSpends := b1, spends1
+	for i := 0; i < 10; i++ {
+		nextBlock, nextSpends, err = blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkLeafDataIndex(t, chain, db, idx)
+
+	// Reorg to a longer chain that forks off after the first block and
+	// doesn't spend its outputs.  The leaves that the disconnected blocks
+	// deleted are added back and the ones they added are removed.
+	altBlock, altSpends := b1, []*blockchain.SpendableOut(nil)
+	for i := 0; i < 12; i++ {
+		altBlock, altSpends, err = blockchain.AddBlock(chain, altBlock, altSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chain.BestSnapshot().Hash != *altBlock.Hash() {
+		t.Fatalf("expected the chain to reorg to %v", altBlock.Hash())
+	}
+	checkLeafDataIndex(t, chain, db, idx)
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// leafTTLKeySize is the size of the keys that the leaves are looked up
+	// by in the leaf ttl records.
+	leafTTLKeySize = 8
+
+	// leafTTLEntrySize is the size of an entry of a leaf created in a
+	// block.  It's the key of the leaf followed by its ttl.
+	leafTTLEntrySize = leafTTLKeySize + 4
+
+	// leafTTLSpendSize is the size of an entry of a leaf spent in a block.
+	// It's the height the leaf was created at followed by its key.
+	leafTTLSpendSize = 4 + leafTTLKeySize
+)
+
+// LeafTTL is the time to live of a leaf that was added to the accumulator.
+type LeafTTL struct {
+	// OutPoint is the output that the leaf commits to.
+	OutPoint wire.OutPoint
+
+	// TTL is the number of blocks the output lived for before it was
+	// spent.  It's 0 if the output is still unspent.
+	TTL int32
+}
+
+// leafTTLKey returns the key that the leaf of the given outpoint is looked up by
+// in the leaf ttl record of the block it was created in.
+func leafTTLKey(op *wire.OutPoint) [leafTTLKeySize]byte {
+	var buf [chainhash.HashSize + 4]byte
+	copy(buf[:chainhash.HashSize], op.Hash[:])
+	binary.BigEndian.PutUint32(buf[chainhash.HashSize:], op.Index)
+	hash := sha256.Sum256(buf[:])
+
+	var key [leafTTLKeySize]byte
+	copy(key[:], hash[:leafTTLKeySize])
+	return key
+}
+
+// blockAddOutPoints returns the outpoints of the leaves that the block adds to
+// the accumulator in the order they're added.  It follows the order of
+// blockchain.BlockToAddLeaves.
+func blockAddOutPoints(block *btcutil.Block) []wire.OutPoint {
+	_, outCount, _, outskip := blockchain.DedupeBlock(block)
+	ops := make([]wire.OutPoint, 0, outCount-len(outskip))
+
+	var txonum uint32
+	for _, tx := range block.Transactions() {
+		for outIdx, txOut := range tx.MsgTx().TxOut {
+			if blockchain.IsUnspendable(txOut) {
+				txonum++
+				continue
+			}
+			if len(outskip) > 0 && outskip[0] == txonum {
+				outskip = outskip[1:]
+				txonum++
+				continue
+			}
+
+			ops = append(ops, wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)})
+			txonum++
+		}
+	}
+
+	return ops
+}
+
+// serializeLeafTTLs returns the leaf ttl record of a block that adds the leaves
+// of the given outpoints and spends the given leaves.
+//
+// The record is made up of:
+// 1: The count of the added leaves.
+// 2: An entry for each added leaf sorted by the key of the leaf.  The ttl of
+// every entry is 0 as the leaves were just created.
+// 3: An entry for each spent leaf so that the ttls can be reset when the block
+// is disconnected.
+func serializeLeafTTLs(adds []wire.OutPoint, dels []wire.LeafData) []byte {
+	keys := make([][leafTTLKeySize]byte, len(adds))
+	for i := range adds {
+		keys[i] = leafTTLKey(&adds[i])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+
+	buf := make([]byte, 4+len(adds)*leafTTLEntrySize+len(dels)*leafTTLSpendSize)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(adds)))
+	offset := 4
+	for _, key := range keys {
+		copy(buf[offset:], key[:])
+		offset += leafTTLEntrySize
+	}
+	for i := range dels {
+		key := leafTTLKey(&dels[i].OutPoint)
+		binary.BigEndian.PutUint32(buf[offset:], uint32(dels[i].Height))
+		copy(buf[offset+4:], key[:])
+		offset += leafTTLSpendSize
+	}
+
+	return buf
+}
+
+// storeLeafTTLs stores the leaf ttl record of the block and sets the ttls of all
+// the leaves the block spends.
+func (idx *FlatUtreexoProofIndex) storeLeafTTLs(block *btcutil.Block, dels []wire.LeafData) error {
+	height := block.Height()
+
+	// The record is stored first so that the ttls set below can always be
+	// reset from it.
+	err := idx.ttlState.StoreData(height, serializeLeafTTLs(blockAddOutPoints(block), dels))
+	if err != nil {
+		return fmt.Errorf("store leaf ttls err. %v", err)
+	}
+
+	for i := range dels {
+		err = idx.setLeafTTL(dels[i].Height, leafTTLKey(&dels[i].OutPoint),
+			height-dels[i].Height)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLeafTTL sets the ttl of the leaf with the given key in the leaf ttl record
+// of the block at the given height.
+func (idx *FlatUtreexoProofIndex) setLeafTTL(height int32,
+	key [leafTTLKeySize]byte, ttl int32) error {
+
+	var buf [leafTTLEntrySize]byte
+	err := idx.ttlState.FetchDataAt(height, buf[:4], 0)
+	if err != nil {
+		return err
+	}
+	numAdds := int(binary.BigEndian.Uint32(buf[:4]))
+
+	// Binary search for the entry of the leaf.
+	var searchErr error
+	i := sort.Search(numAdds, func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		searchErr = idx.ttlState.FetchDataAt(height, buf[:leafTTLKeySize],
+			4+int64(i)*leafTTLEntrySize)
+		return bytes.Compare(buf[:leafTTLKeySize], key[:]) >= 0
+	})
+	if searchErr != nil {
+		return searchErr
+	}
+	if i < numAdds {
+		err = idx.ttlState.FetchDataAt(height, buf[:leafTTLKeySize],
+			4+int64(i)*leafTTLEntrySize)
+		if err != nil {
+			return err
+		}
+	}
+	if i == numAdds || !bytes.Equal(buf[:leafTTLKeySize], key[:]) {
+		return fmt.Errorf("no leaf with key %x was created at height %d",
+			key, height)
+	}
+
+	binary.BigEndian.PutUint32(buf[:4], uint32(ttl))
+	return idx.ttlState.UpdateData(height, buf[:4],
+		4+int64(i)*leafTTLEntrySize+leafTTLKeySize)
+}
+
+// disconnectLeafTTLs resets the ttls of the leaves spent by the block at the
+// given height and removes the leaf ttl record of the block.
+func (idx *FlatUtreexoProofIndex) disconnectLeafTTLs(height int32) error {
+	record, err := idx.ttlState.FetchData(height)
+	if err != nil {
+		return err
+	}
+	if len(record) < 4 {
+		return fmt.Errorf("leaf ttl record at height %d is malformed", height)
+	}
+	spendsOffset := 4 + int(binary.BigEndian.Uint32(record[:4]))*leafTTLEntrySize
+	if spendsOffset > len(record) || (len(record)-spendsOffset)%leafTTLSpendSize != 0 {
+		return fmt.Errorf("leaf ttl record at height %d is malformed", height)
+	}
+	spends := record[spendsOffset:]
+
+	for ; len(spends) > 0; spends = spends[leafTTLSpendSize:] {
+		var key [leafTTLKeySize]byte
+		copy(key[:], spends[4:leafTTLSpendSize])
+		err = idx.setLeafTTL(int32(binary.BigEndian.Uint32(spends[:4])), key, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return idx.ttlState.DisconnectBlock(height)
+}
+
+// LeafTTLsHeight returns the height of the last block whose leaf ttls are kept
+// and whether the leaf ttls are kept at all.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) LeafTTLsHeight() (int32, bool) {
+	if !idx.config.LeafTTLs {
+		return -1, false
+	}
+	return idx.ttlState.BestHeight(), true
+}
+
+// FetchLeafTTLs returns the time to live of each of the leaves created in the
+// block at the given height in the order they were added to the accumulator.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) FetchLeafTTLs(height int32) ([]LeafTTL, error) {
+	if !idx.config.LeafTTLs {
+		return nil, fmt.Errorf("the leaf ttls are not kept by the flat " +
+			"utreexo proof index")
+	}
+	if height <= 0 || height > idx.ttlState.BestHeight() {
+		return nil, fmt.Errorf("no leaf ttls for height %d. The leaf ttls "+
+			"are kept for heights 1 to %d", height, idx.ttlState.BestHeight())
+	}
+
+	block, err := idx.chain.BlockByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	record, err := idx.ttlState.FetchData(height)
+	if err != nil {
+		return nil, err
+	}
+
+	leafTTLs, err := deserializeLeafTTLs(record, blockAddOutPoints(block))
+	if err != nil {
+		return nil, fmt.Errorf("leaf ttl record at height %d doesn't "+
+			"match the block %v: %v", height, block.Hash(), err)
+	}
+
+	return leafTTLs, nil
+}
+
+// deserializeLeafTTLs returns the ttls of the leaves of the given outpoints
+// from the leaf ttl record of the block that added them.  The outpoints must
+// be the ones added by the block in the order they were added.
+func deserializeLeafTTLs(record []byte, adds []wire.OutPoint) ([]LeafTTL, error) {
+	if len(record) < 4+len(adds)*leafTTLEntrySize ||
+		int(binary.BigEndian.Uint32(record[:4])) != len(adds) {
+
+		return nil, fmt.Errorf("expected the ttls of %d leaves", len(adds))
+	}
+
+	ttls := make(map[[leafTTLKeySize]byte]int32, len(adds))
+	for i := 0; i < len(adds); i++ {
+		entry := record[4+i*leafTTLEntrySize : 4+(i+1)*leafTTLEntrySize]
+
+		var key [leafTTLKeySize]byte
+		copy(key[:], entry[:leafTTLKeySize])
+		ttls[key] = int32(binary.BigEndian.Uint32(entry[leafTTLKeySize:]))
+	}
+
+	leafTTLs := make([]LeafTTL, len(adds))
+	for i, op := range adds {
+		ttl, ok := ttls[leafTTLKey(&op)]
+		if !ok {
+			return nil, fmt.Errorf("no ttl for the leaf of %v", op)
+		}
+		leafTTLs[i] = LeafTTL{OutPoint: op, TTL: ttl}
+	}
+
+	return leafTTLs, nil
+}
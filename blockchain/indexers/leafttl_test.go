@@ -0,0 +1,132 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// leafTTLTestBlock returns a block at the given height with a single
+// transaction that has the given number of spendable outputs followed by an
+// OP_RETURN output.
+func leafTTLTestBlock(height int32, numOuts int) *btcutil.Block {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{SignatureScript: []byte{byte(height)}})
+	for i := 0; i < numOuts; i++ {
+		tx.AddTxOut(wire.NewTxOut(int64(i+1), []byte{0x51}))
+	}
+	tx.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+
+	block := btcutil.NewBlock(&wire.MsgBlock{Transactions: []*wire.MsgTx{tx}})
+	block.SetHeight(height)
+	return block
+}
+
+// checkLeafTTLs checks that the leaves created in the block have the expected
+// ttls.
+func checkLeafTTLs(t *testing.T, idx *FlatUtreexoProofIndex,
+	block *btcutil.Block, expected []int32) {
+
+	t.Helper()
+
+	record, err := idx.ttlState.FetchData(block.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	adds := blockAddOutPoints(block)
+	leafTTLs, err := deserializeLeafTTLs(record, adds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]LeafTTL, len(expected))
+	for i, ttl := range expected {
+		want[i] = LeafTTL{OutPoint: adds[i], TTL: ttl}
+	}
+	if !reflect.DeepEqual(leafTTLs, want) {
+		t.Fatalf("expected leaf ttls %v, got %v", want, leafTTLs)
+	}
+}
+
+func TestLeafTTLs(t *testing.T) {
+	t.Parallel()
+
+	tmpDir, err := os.MkdirTemp("", "leafttls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ttlState, err := loadFlatFileState(tmpDir, flatUtreexoLeafTTLName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &FlatUtreexoProofIndex{
+		ttlState: *ttlState,
+		config:   &UtreexoConfig{LeafTTLs: true},
+	}
+
+	block1 := leafTTLTestBlock(1, 20)
+	adds1 := blockAddOutPoints(block1)
+	if len(adds1) != 20 {
+		t.Fatalf("expected 20 added leaves, got %d", len(adds1))
+	}
+	err = idx.storeLeafTTLs(block1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeafTTLs(t, idx, block1, make([]int32, 20))
+
+	// Spend some of the leaves created in the first block over the next
+	// blocks.
+	expected := make([]int32, 20)
+	blocks := []*btcutil.Block{block1}
+	for height := int32(2); height <= 4; height++ {
+		var dels []wire.LeafData
+		for i := int(height); i < len(adds1); i += 5 {
+			dels = append(dels, wire.LeafData{OutPoint: adds1[i], Height: 1})
+			expected[i] = height - 1
+		}
+
+		block := leafTTLTestBlock(height, 1)
+		err = idx.storeLeafTTLs(block, dels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+		checkLeafTTLs(t, idx, block1, expected)
+	}
+
+	// Spending a leaf that wasn't created in the block is an error.
+	unknown := wire.LeafData{OutPoint: blockAddOutPoints(blocks[1])[0], Height: 1}
+	err = idx.storeLeafTTLs(leafTTLTestBlock(5, 1), []wire.LeafData{unknown})
+	if err == nil {
+		t.Fatalf("expected an error when spending an unknown leaf")
+	}
+	err = idx.ttlState.DisconnectBlock(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Disconnecting the blocks resets the ttls of the leaves they spent.
+	for height := int32(4); height >= 2; height-- {
+		err = idx.disconnectLeafTTLs(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int(height); i < len(adds1); i += 5 {
+			expected[i] = 0
+		}
+		checkLeafTTLs(t, idx, block1, expected)
+	}
+	if idx.ttlState.BestHeight() != 1 {
+		t.Fatalf("expected best height 1, got %d", idx.ttlState.BestHeight())
+	}
+}
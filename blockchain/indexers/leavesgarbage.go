@@ -0,0 +1,150 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+)
+
+// garbageBackend is the part of the cached leaves backend that keeps the
+// estimate of its garbage in the database.
+type garbageBackend interface {
+	GarbageStats() blockchain.CachedLeavesGarbage
+	ForgetGarbage(count uint64)
+}
+
+// leavesGarbage compacts the utreexo state database in the background once the
+// tombstones and the overwritten entries of the cached leaves make up too much
+// of it.  Pebble only drops them when the keys they're at are compacted, which
+// may take a long time to happen on its own for a database the size of the
+// utreexo state.
+type leavesGarbage struct {
+	backend garbageBackend
+
+	mtx         sync.Mutex
+	running     bool
+	stopped     bool
+	compactions uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newLeavesGarbage returns a new leavesGarbage for the given backend.
+func newLeavesGarbage(backend garbageBackend) *leavesGarbage {
+	return &leavesGarbage{
+		backend: backend,
+		quit:    make(chan struct{}),
+	}
+}
+
+// stats returns the garbage estimate of the backend and the count of the
+// compactions that were run because of it.  A nil leavesGarbage returns zero
+// values.
+//
+// This function is safe for concurrent access.
+func (g *leavesGarbage) stats() (blockchain.CachedLeavesGarbage, uint64) {
+	if g == nil {
+		return blockchain.CachedLeavesGarbage{}, 0
+	}
+
+	g.mtx.Lock()
+	compactions := g.compactions
+	g.mtx.Unlock()
+
+	return g.backend.GarbageStats(), compactions
+}
+
+// compactIfNeeded starts compact in the background if the share of the garbage
+// is at least the given ratio and the time is within the compaction windows.
+// Nothing is started while a compaction is already running or once stopped.  A
+// ratio of 0 never compacts.
+//
+// This function is safe for concurrent access.
+func (g *leavesGarbage) compactIfNeeded(name string, ratio float64,
+	windows []CompactionWindow, compact func(quit <-chan struct{}) error) {
+
+	if g == nil || ratio <= 0 {
+		return
+	}
+	garbage := g.backend.GarbageStats()
+	if garbage.Ratio() < ratio || !InCompactionWindow(windows, time.Now()) {
+		return
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.running || g.stopped {
+		return
+	}
+	g.running = true
+
+	log.Infof("Compacting the %s utreexo state database as %.1f%% of "+
+		"its cached leaves entries are garbage", name, garbage.Ratio()*100)
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		start := time.Now()
+		err := compact(g.quit)
+
+		g.mtx.Lock()
+		defer g.mtx.Unlock()
+		g.running = false
+
+		select {
+		case <-g.quit:
+			return
+		default:
+		}
+		if err != nil {
+			log.Errorf("Unable to compact the %s utreexo state "+
+				"database: %v", name, err)
+			return
+		}
+
+		// Only the garbage from before the compaction is gone for sure
+		// as the flushes keep writing while it runs.
+		g.backend.ForgetGarbage(garbage.Garbage)
+		g.compactions++
+		log.Infof("Compacted the %s utreexo state database in %v",
+			name, time.Since(start))
+	}()
+}
+
+// stop interrupts the running compaction and waits for it to return.  No
+// compactions are started afterwards.  It's a no-op for a nil leavesGarbage.
+//
+// This function is safe for concurrent access.
+func (g *leavesGarbage) stop() {
+	if g == nil {
+		return
+	}
+
+	g.mtx.Lock()
+	if g.stopped {
+		g.mtx.Unlock()
+		return
+	}
+	g.stopped = true
+	close(g.quit)
+	g.mtx.Unlock()
+
+	g.wg.Wait()
+}
+
+// compactGarbageIfNeeded compacts the utreexo state database in the background
+// within the CPU quota when the garbage of the cached leaves is over the ratio
+// of the config.
+func (us *UtreexoState) compactGarbageIfNeeded() {
+	us.leavesGarbage.compactIfNeeded(us.config.Name,
+		us.config.GarbageCompactRatio, us.config.CompactionWindows,
+		func(quit <-chan struct{}) error {
+			return us.compactDB(us.config.CPUQuota, quit)
+		})
+}
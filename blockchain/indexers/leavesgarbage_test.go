@@ -0,0 +1,107 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+)
+
+// testGarbageBackend is a garbageBackend with a fixed estimate.
+type testGarbageBackend struct {
+	mtx     sync.Mutex
+	garbage blockchain.CachedLeavesGarbage
+}
+
+func (b *testGarbageBackend) GarbageStats() blockchain.CachedLeavesGarbage {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.garbage
+}
+
+func (b *testGarbageBackend) ForgetGarbage(count uint64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.garbage.Garbage -= count
+}
+
+func TestLeavesGarbageCompaction(t *testing.T) {
+	backend := &testGarbageBackend{
+		garbage: blockchain.CachedLeavesGarbage{Live: 60, Garbage: 40},
+	}
+	g := newLeavesGarbage(backend)
+
+	var compactions int
+	compact := func(quit <-chan struct{}) error {
+		compactions++
+		return nil
+	}
+
+	// Nothing is compacted while the garbage is under the ratio or when
+	// the automatic compactions are disabled.
+	g.compactIfNeeded("test", 0.5, nil, compact)
+	g.compactIfNeeded("test", 0, nil, compact)
+	g.wg.Wait()
+	if compactions != 0 {
+		t.Fatalf("expected no compactions, got %d", compactions)
+	}
+
+	// The garbage from before the compaction is forgotten once it's done.
+	g.compactIfNeeded("test", 0.4, nil, compact)
+	g.wg.Wait()
+	garbage, count := g.stats()
+	if compactions != 1 || count != 1 {
+		t.Fatalf("expected 1 compaction, got %d and counted %d",
+			compactions, count)
+	}
+	if garbage.Garbage != 0 || garbage.Live != 60 {
+		t.Fatalf("expected the garbage to be forgotten, got %+v", garbage)
+	}
+
+	// Nothing is compacted outside of the compaction windows.
+	backend.garbage.Garbage = 40
+	now := time.Now()
+	offset := time.Duration(now.Hour())*time.Hour +
+		time.Duration(now.Minute())*time.Minute
+	windows := []CompactionWindow{{
+		Start: (offset + 2*time.Hour) % (24 * time.Hour),
+		End:   (offset + 3*time.Hour) % (24 * time.Hour),
+	}}
+	g.compactIfNeeded("test", 0.4, windows, compact)
+	g.wg.Wait()
+	if compactions != 1 {
+		t.Fatalf("expected no compaction outside of the windows, got %d",
+			compactions-1)
+	}
+
+	// An interrupted compaction doesn't forget the garbage and none are
+	// started once stopped.
+	started := make(chan struct{})
+	g.compactIfNeeded("test", 0.4, nil, func(quit <-chan struct{}) error {
+		close(started)
+		<-quit
+		return nil
+	})
+	<-started
+	g.stop()
+	g.compactIfNeeded("test", 0.4, nil, compact)
+	g.wg.Wait()
+	garbage, count = g.stats()
+	if compactions != 1 || count != 1 || garbage.Garbage != 40 {
+		t.Fatalf("expected the interrupted compaction to keep the "+
+			"garbage, got %+v after %d compactions", garbage, count)
+	}
+
+	// A nil leavesGarbage of an accumulator kept in memory does nothing.
+	var inMemory *leavesGarbage
+	inMemory.compactIfNeeded("test", 0.4, nil, compact)
+	inMemory.stop()
+	if garbage, _ := inMemory.stats(); garbage.Ratio() != 0 {
+		t.Fatalf("expected no garbage, got %+v", garbage)
+	}
+}
@@ -7,6 +7,7 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"sync"
 
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/btcutil"
@@ -68,6 +69,48 @@ func dbFetchIndexerTip(dbTx database.Tx, idxKey []byte) (*chainhash.Hash, int32,
 	return &hash, height, nil
 }
 
+// VerifyIndexTips checks that the tip of every index stored in the database is
+// a main chain block that isn't past the best height of the chain.  It's used
+// to make sure the indexes still agree with the chain after the database has
+// been repaired.
+func VerifyIndexTips(dbTx database.Tx, bestHeight int32) error {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	if indexesBucket == nil {
+		return nil
+	}
+
+	return indexesBucket.ForEach(func(idxKey, serialized []byte) error {
+		// Skip the markers of indexes that are being dropped.
+		if bytes.Equal(idxKey, indexDropKey(serialized)) {
+			return nil
+		}
+
+		hash, height, err := dbFetchIndexerTip(dbTx, idxKey)
+		if err != nil {
+			return err
+		}
+		if height > bestHeight {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("index %q tip at height %d "+
+					"is past the chain tip at height %d",
+					string(idxKey), height, bestHeight),
+			}
+		}
+		chainHeight, err := blockchain.DBFetchHeightByHash(dbTx, hash)
+		if err != nil || chainHeight != height {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("index %q tip %s at height "+
+					"%d is not in the main chain", string(idxKey),
+					hash, height),
+			}
+		}
+
+		return nil
+	})
+}
+
 // dbPutIndexerEarliest uses an existing database transaction to update or add the
 // current earliest height for the given index to the provided values.
 func dbPutIndexerEarliest(dbTx database.Tx, idxKey []byte, hash *chainhash.Hash, height int32) error {
@@ -166,6 +209,31 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer Indexer, block *btcutil.Bl
 type Manager struct {
 	db             database.DB
 	enabledIndexes []Indexer
+	chain          *blockchain.BlockChain
+
+	// mtx protects chainTip and backfilling.
+	mtx sync.Mutex
+
+	// chainTip is the hash of the last block the manager saw being
+	// connected to the main chain.  It's updated within the same database
+	// transaction as the chain tip.
+	chainTip chainhash.Hash
+
+	// backfilling is the set of indexes that are being caught up to the
+	// main chain in the background.  Blocks aren't connected to or
+	// disconnected from these indexes until they're caught up.
+	backfilling map[Indexer]struct{}
+
+	// cpuQuota caps the share of the CPU cores used to catch up the
+	// indexes in the background.
+	cpuQuota *CPUQuota
+
+	// deferSync is whether all of the indexes are caught up in the
+	// background instead of only the ones that opt in as Backfillers.
+	deferSync bool
+
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -273,13 +341,28 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 // time new blocks are being downloaded would lead to an overall longer time to
 // catch up due to the I/O contention.
 //
+// Once the indexes are caught up, the heights that the utxo cache and each of
+// the indexes along with their utreexo states and flat files were at on startup
+// are compared to the heights they were reconciled to and the ones that had to
+// be replayed or rolled back are logged.
+//
 // This is part of the blockchain.IndexManager interface.
-func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{}) error {
+func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{}) (retErr error) {
 	// Nothing to do when no indexes are enabled.
 	if len(m.enabledIndexes) == 0 {
 		return nil
 	}
 
+	// Keep track of the heights that each part of the state was at on
+	// startup so that what had to be repaired can be logged.
+	startHeights := make([][]stateHeight, len(m.enabledIndexes))
+	defer func() {
+		if retErr == nil {
+			retErr = m.logReconciliation(chain,
+				chain.UtxoCacheStartHeight(), startHeights)
+		}
+	}()
+
 	if interruptRequested(interrupt) {
 		return errInterruptRequested
 	}
@@ -289,6 +372,12 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		return err
 	}
 
+	m.chain = chain
+	m.mtx.Lock()
+	m.chainTip = chain.BestSnapshot().Hash
+	m.backfilling = make(map[Indexer]struct{})
+	m.mtx.Unlock()
+
 	// Create the initial state for the indexes as needed.
 	err := m.db.Update(func(dbTx database.Tx) error {
 		// Create the bucket for the current tips as needed.
@@ -310,7 +399,7 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 	}
 
 	// Initialize each of the enabled indexes.
-	for _, indexer := range m.enabledIndexes {
+	for i, indexer := range m.enabledIndexes {
 		// Fetch the current tip for the index.
 		var height int32
 		var hash *chainhash.Hash
@@ -325,6 +414,12 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		if err := indexer.Init(chain, hash, height); err != nil {
 			return err
 		}
+
+		startHeights[i] = []stateHeight{{indexer.Name(), height}}
+		if r, ok := indexer.(stateReconciler); ok {
+			startHeights[i] = append(startHeights[i],
+				r.reconciledStartHeights()...)
+		}
 	}
 
 	// Rollback indexes to the main chain if their tip is an orphaned fork.
@@ -462,6 +557,41 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			lowestHeight+1, bestHeight, err)
 	}
 
+	// Leave the indexes that can be caught up in the background behind.
+	// They're caught up once the manager is started and only the rest of
+	// the indexes are caught up here.  There's nothing to gain from it when
+	// the chain only has the genesis block.
+	//
+	// The address index looks up the block ids stored by the transaction
+	// index so it's left behind as well while the transaction index is
+	// caught up in the background.
+	lowestHeight = bestHeight
+	var txIndexBehind bool
+	for i, indexer := range m.enabledIndexes {
+		_, isAddrIndex := indexer.(*AddrIndex)
+		behind := indexerHeights[i] < bestHeight ||
+			(isAddrIndex && txIndexBehind)
+		if bestHeight > 0 && behind && m.indexBackfills(indexer) {
+			if _, ok := indexer.(*TxIndex); ok {
+				txIndexBehind = true
+			}
+
+			log.Infof("Catching up %s from height %d to %d in the "+
+				"background", indexer.Name(), indexerHeights[i],
+				bestHeight)
+			m.mtx.Lock()
+			m.backfilling[indexer] = struct{}{}
+			m.mtx.Unlock()
+			continue
+		}
+		if indexerHeights[i] < lowestHeight {
+			lowestHeight = indexerHeights[i]
+		}
+	}
+	if lowestHeight == bestHeight {
+		return nil
+	}
+
 	// Create a progress logger for the indexing process below.
 	progressLogger := newBlockProgressLogger("Indexed", log)
 
@@ -484,7 +614,7 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		for i, indexer := range m.enabledIndexes {
 			// Skip indexes that don't need to be updated with this
 			// block.
-			if indexerHeights[i] >= height {
+			if indexerHeights[i] >= height || m.isBackfilling(indexer) {
 				continue
 			}
 
@@ -492,7 +622,7 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			// and they haven't been loaded yet, they need to be
 			// retrieved from the spend journal.
 			if spentTxos == nil && indexNeedsInputs(indexer) {
-				spentTxos, err = chain.FetchSpendJournal(block)
+				spentTxos, err = m.fetchSpentTxOuts(chain, block)
 				if err != nil {
 					return err
 				}
@@ -514,12 +644,16 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 
 		if interruptRequested(interrupt) {
 			for _, indexer := range m.enabledIndexes {
+				if m.isBackfilling(indexer) {
+					continue
+				}
 				switch idxType := indexer.(type) {
 				case *UtreexoProofIndex:
 					err := idxType.flushUtreexoState(block.Hash())
 					if err != nil {
 						log.Errorf("Error while flushing utreexo state for utreexo proof index: %v", err)
 					}
+					idxType.utreexoState.leavesGarbage.stop()
 					err = idxType.utreexoState.utreexoStateDB.Close()
 					if err != nil {
 						log.Errorf("Error while closing the utreexo state for utreexo proof index: %v", err)
@@ -529,6 +663,7 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 					if err != nil {
 						log.Errorf("Error while flushing utreexo state for flat utreexo proof index: %v", err)
 					}
+					idxType.utreexoState.leavesGarbage.stop()
 					err = idxType.utreexoState.utreexoStateDB.Close()
 					if err != nil {
 						log.Errorf("Error while closing the utreexo state for flat utreexo proof index: %v", err)
@@ -549,6 +684,17 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 	return nil
 }
 
+// indexBackfills returns whether or not the index is caught up to the main
+// chain in the background.  Indexes that don't opt in as Backfillers are only
+// caught up in the background when the index sync is deferred.
+func (m *Manager) indexBackfills(index Indexer) bool {
+	if idx, ok := index.(Backfiller); ok {
+		return idx.Backfills()
+	}
+
+	return m.deferSync
+}
+
 // indexNeedsInputs returns whether or not the index needs access to the txouts
 // referenced by the transaction inputs being indexed.
 func indexNeedsInputs(index Indexer) bool {
@@ -559,6 +705,52 @@ func indexNeedsInputs(index Indexer) bool {
 	return false
 }
 
+// fetchSpentTxOuts returns the outputs spent by the block for the indexes that
+// need them.  They're read from the spend journal or, when it doesn't have the
+// block such as on a pruned bridge, put together from the leaf datas of the
+// block's utreexo proof kept by an enabled utreexo proof index.
+func (m *Manager) fetchSpentTxOuts(chain *blockchain.BlockChain,
+	block *btcutil.Block) ([]blockchain.SpentTxOut, error) {
+
+	stxos, err := chain.FetchSpendJournal(block)
+	if err == nil {
+		return stxos, nil
+	}
+	if dbErr, ok := err.(database.Error); !ok ||
+		dbErr.ErrorCode != database.ErrSpendJournalNotFound {
+
+		return nil, err
+	}
+
+	var ud *wire.UData
+	for _, indexer := range m.enabledIndexes {
+		var fetchErr error
+		switch idx := indexer.(type) {
+		case *UtreexoProofIndex:
+			ud, fetchErr = idx.FetchUtreexoProof(block.Hash())
+		case *FlatUtreexoProofIndex:
+			ud, fetchErr = idx.FetchUtreexoProof(block.Height())
+		default:
+			continue
+		}
+		if fetchErr == nil {
+			break
+		}
+		log.Debugf("Unable to fetch the utreexo proof of block %v in "+
+			"place of its spend journal: %v", block.Hash(), fetchErr)
+		ud = nil
+	}
+	if ud == nil {
+		return nil, err
+	}
+
+	_, err = chain.ReconstructUData(ud, *block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return blockchain.SpentTxOutsFromLeafDatas(block, ud.LeafDatas)
+}
+
 // dbFetchTx looks up the passed transaction hash in the transaction index and
 // loads it from the database.
 func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
@@ -595,9 +787,17 @@ func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
 func (m *Manager) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 	stxos []blockchain.SpentTxOut) error {
 
+	m.mtx.Lock()
+	m.chainTip = *block.Hash()
+	m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being connected so they can update accordingly.
+	// being connected so they can update accordingly.  The indexes that
+	// are being caught up in the background will get to the block later.
 	for _, index := range m.enabledIndexes {
+		if m.isBackfilling(index) {
+			continue
+		}
 		err := dbIndexConnectBlock(dbTx, index, block, stxos)
 		if err != nil {
 			return err
@@ -615,9 +815,18 @@ func (m *Manager) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 func (m *Manager) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 	stxo []blockchain.SpentTxOut) error {
 
+	m.mtx.Lock()
+	m.chainTip = block.MsgBlock().Header.PrevBlock
+	m.mtx.Unlock()
+
 	// Call each of the currently active optional indexes with the block
-	// being disconnected so they can update accordingly.
+	// being disconnected so they can update accordingly.  The indexes that
+	// are being caught up in the background disconnect the block on their
+	// own if they've already indexed it.
 	for _, index := range m.enabledIndexes {
+		if m.isBackfilling(index) {
+			continue
+		}
 		err := dbIndexDisconnectBlock(dbTx, index, block, stxo)
 		if err != nil {
 			return err
@@ -675,8 +884,12 @@ func (m *Manager) PruneBlocks(dbTx database.Tx, lastKeptHeight int32,
 }
 
 // Flush flushes the enabled indexes. For the indexers that do not need to be flushed, it's a no-op.
+// The indexes that are being caught up in the background are flushed as they're caught up instead.
 func (m *Manager) Flush(bestHash *chainhash.Hash, mode blockchain.FlushMode, onConnect bool) error {
 	for _, index := range m.enabledIndexes {
+		if m.isBackfilling(index) {
+			continue
+		}
 		err := index.Flush(bestHash, mode, onConnect)
 		if err != nil {
 			return err
@@ -694,6 +907,8 @@ func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 	return &Manager{
 		db:             db,
 		enabledIndexes: enabledIndexes,
+		backfilling:    make(map[Indexer]struct{}),
+		quit:           make(chan struct{}),
 	}
 }
 
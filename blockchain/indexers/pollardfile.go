@@ -0,0 +1,407 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+	"golang.org/x/exp/mmap"
+)
+
+const (
+	// pollardFileName is the name of the file in the utreexo state
+	// directory that the accumulator is written to when it's kept entirely
+	// in memory.
+	pollardFileName = "pollard.dat"
+
+	// pollardFileVersion is the version of the serialization of the pollard
+	// file.
+	pollardFileVersion = 1
+
+	// pollardHeaderLen is the length of the header of the pollard file.  It
+	// is made up of the magic, the version, the hash of the block the
+	// accumulator is at, the number of leaves and the counts of the nodes
+	// and the cached leaves that follow it.
+	pollardHeaderLen = 4 + 4 + chainhash.HashSize + 8 + 8 + 8
+
+	// pollardNodeLen is the length of a serialized node.  It's the position
+	// followed by the hash and the remember flag.
+	pollardNodeLen = 8 + chainhash.HashSize + 1
+
+	// pollardCachedLeafLen is the length of a serialized cached leaf.  It's
+	// the hash followed by the position.
+	pollardCachedLeafLen = chainhash.HashSize + 8
+
+	// pollardBufferSize is the size of the buffers the pollard file is
+	// written and read through.
+	pollardBufferSize = 1 << 20
+)
+
+// pollardFileMagic marks the start of a pollard file.
+var pollardFileMagic = [4]byte{'u', 'p', 'o', 'l'}
+
+// pollardFilePath returns the path of the pollard file of the utreexo state
+// described by the config.
+func pollardFilePath(cfg *UtreexoConfig) string {
+	return filepath.Join(utreexoBasePath(cfg), pollardFileName)
+}
+
+// writePollardFile writes the nodes and the cached leaves of the accumulator to
+// the pollard file at path with a single sequential pass.  The file is written
+// to a temporary file first which then replaces the one at path so that there's
+// always a complete pollard file on disk.  A checksum of the contents is written
+// at the end of the file.
+func writePollardFile(path string, bestHash *chainhash.Hash, p *utreexo.MapPollard) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	err = serializePollard(f, bestHash, p)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// serializePollard writes the pollard file to w.
+func serializePollard(w io.Writer, bestHash *chainhash.Hash, p *utreexo.MapPollard) error {
+	hasher := sha256.New()
+	bw := bufio.NewWriterSize(io.MultiWriter(w, hasher), pollardBufferSize)
+
+	numNodes := uint64(p.Nodes.Length())
+	numCachedLeaves := uint64(p.CachedLeaves.Length())
+
+	var header [pollardHeaderLen]byte
+	copy(header[:4], pollardFileMagic[:])
+	binary.LittleEndian.PutUint32(header[4:8], pollardFileVersion)
+	copy(header[8:40], bestHash[:])
+	binary.LittleEndian.PutUint64(header[40:48], p.NumLeaves)
+	binary.LittleEndian.PutUint64(header[48:56], numNodes)
+	binary.LittleEndian.PutUint64(header[56:64], numCachedLeaves)
+	_, err := bw.Write(header[:])
+	if err != nil {
+		return err
+	}
+
+	var written uint64
+	var node [pollardNodeLen]byte
+	err = p.Nodes.ForEach(func(pos uint64, leaf utreexo.Leaf) error {
+		binary.LittleEndian.PutUint64(node[:8], pos)
+		copy(node[8:40], leaf.Hash[:])
+		node[40] = 0
+		if leaf.Remember {
+			node[40] = 1
+		}
+		written++
+		_, err := bw.Write(node[:])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != numNodes {
+		return fmt.Errorf("wrote %d nodes but the accumulator has %d",
+			written, numNodes)
+	}
+
+	written = 0
+	var cachedLeaf [pollardCachedLeafLen]byte
+	err = p.CachedLeaves.ForEach(func(hash utreexo.Hash, pos uint64) error {
+		copy(cachedLeaf[:32], hash[:])
+		binary.LittleEndian.PutUint64(cachedLeaf[32:], pos)
+		written++
+		_, err := bw.Write(cachedLeaf[:])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != numCachedLeaves {
+		return fmt.Errorf("wrote %d cached leaves but the accumulator "+
+			"has %d", written, numCachedLeaves)
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	// The checksum isn't part of what it's calculated over.
+	_, err = w.Write(hasher.Sum(nil))
+	return err
+}
+
+// readPollardFile maps the pollard file at path to memory and returns the
+// accumulator stored in it along with the hash of the block it's at.
+func readPollardFile(path string) (*chainhash.Hash, *utreexo.MapPollard, error) {
+	r, err := mmap.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+
+	bestHash, p, err := deserializePollard(r, int64(r.Len()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the pollard file %s: %v",
+			path, err)
+	}
+
+	return bestHash, p, nil
+}
+
+// deserializePollard reads the pollard file of the given size from r.
+func deserializePollard(r io.ReaderAt, size int64) (*chainhash.Hash, *utreexo.MapPollard, error) {
+	if size < pollardHeaderLen+sha256.Size {
+		return nil, nil, fmt.Errorf("file is only %d bytes", size)
+	}
+
+	// The contents are hashed as they're read so that the file is only
+	// read once.
+	hasher := sha256.New()
+	br := bufio.NewReaderSize(io.TeeReader(
+		io.NewSectionReader(r, 0, size-sha256.Size), hasher), pollardBufferSize)
+
+	var header [pollardHeaderLen]byte
+	_, err := io.ReadFull(br, header[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:4], pollardFileMagic[:]) {
+		return nil, nil, fmt.Errorf("not a pollard file")
+	}
+	if version := binary.LittleEndian.Uint32(header[4:8]); version != pollardFileVersion {
+		return nil, nil, fmt.Errorf("unknown version %d", version)
+	}
+	bestHash := new(chainhash.Hash)
+	copy(bestHash[:], header[8:40])
+	numNodes := binary.LittleEndian.Uint64(header[48:56])
+	numCachedLeaves := binary.LittleEndian.Uint64(header[56:64])
+
+	// Make sure the counts add up to the size of the file before going
+	// through it so that a corrupt count doesn't send us reading past it.
+	if numNodes > uint64(size)/pollardNodeLen ||
+		numCachedLeaves > uint64(size)/pollardCachedLeafLen ||
+		pollardHeaderLen+numNodes*pollardNodeLen+
+			numCachedLeaves*pollardCachedLeafLen+sha256.Size != uint64(size) {
+
+		return nil, nil, fmt.Errorf("%d nodes and %d cached leaves "+
+			"don't fit a file of %d bytes", numNodes, numCachedLeaves,
+			size)
+	}
+
+	p := utreexo.NewMapPollard(true)
+	p.NumLeaves = binary.LittleEndian.Uint64(header[40:48])
+
+	var node [pollardNodeLen]byte
+	for i := uint64(0); i < numNodes; i++ {
+		_, err = io.ReadFull(br, node[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		leaf := utreexo.Leaf{
+			Hash:     *(*[chainhash.HashSize]byte)(node[8:40]),
+			Remember: node[40] == 1,
+		}
+		p.Nodes.Put(binary.LittleEndian.Uint64(node[:8]), leaf)
+	}
+
+	var cachedLeaf [pollardCachedLeafLen]byte
+	for i := uint64(0); i < numCachedLeaves; i++ {
+		_, err = io.ReadFull(br, cachedLeaf[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		p.CachedLeaves.Put(*(*[chainhash.HashSize]byte)(cachedLeaf[:32]),
+			binary.LittleEndian.Uint64(cachedLeaf[32:]))
+	}
+
+	var checksum [sha256.Size]byte
+	_, err = r.ReadAt(checksum[:], size-sha256.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(checksum[:], hasher.Sum(nil)) {
+		return nil, nil, fmt.Errorf("checksum mismatch")
+	}
+
+	return bestHash, &p, nil
+}
+
+// loadPollardFromDB copies the nodes and the cached leaves of an accumulator
+// that was kept in the database to p.
+func loadPollardFromDB(db *pebble.DB, p *utreexo.MapPollard) error {
+	nodesDB, err := blockchain.InitNodesBackEnd(db, 0)
+	if err != nil {
+		return err
+	}
+	err = nodesDB.ForEach(func(pos uint64, leaf utreexo.Leaf) error {
+		p.Nodes.Put(pos, leaf)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cachedLeavesDB, err := blockchain.InitCachedLeavesBackEnd(db, 0)
+	if err != nil {
+		return err
+	}
+	return cachedLeavesDB.ForEach(func(hash utreexo.Hash, pos uint64) error {
+		p.CachedLeaves.Put(hash, pos)
+		return nil
+	})
+}
+
+// initInMemoryUtreexoState returns a utreexo state that keeps the entire
+// accumulator in memory.  The accumulator is loaded from the pollard file and
+// written back to it on every flush.  The database is only used for the
+// consistency state.
+//
+// An accumulator that was kept in the database before is read from it once
+// and is written to the pollard file on the next flush.
+func initInMemoryUtreexoState(cfg *UtreexoConfig, db *pebble.DB,
+	chain *blockchain.BlockChain, tipHash *chainhash.Hash, tipHeight int32,
+	replayed func(*btcutil.Block, *wire.UData) error,
+	rollBack rollBackDataFunc) (*UtreexoState, error) {
+
+	savedHash, numLeaves, rootsHash, err := dbFetchUtreexoStateConsistency(db)
+	if err != nil {
+		return nil, err
+	}
+
+	path := pollardFilePath(cfg)
+	var p *utreexo.MapPollard
+	_, err = os.Stat(path)
+	switch {
+	case err == nil:
+		start := time.Now()
+		var fileHash *chainhash.Hash
+		fileHash, p, err = readPollardFile(path)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Loaded %d utreexo nodes and %d cached leaves from %s in %v",
+			p.Nodes.Length(), p.CachedLeaves.Length(), path,
+			time.Since(start))
+
+		// The pollard file is written before the consistency state so
+		// it's ahead of it if the node went down in between.  It's
+		// complete either way and the consistency state is caught up on
+		// the next flush.
+		if savedHash != nil && !savedHash.IsEqual(fileHash) {
+			log.Infof("The utreexo state is at block %s in the pollard "+
+				"file and at block %s in the database", fileHash,
+				savedHash)
+			rootsHash = nil
+		}
+		savedHash = fileHash
+
+	case os.IsNotExist(err):
+		pollard := utreexo.NewMapPollard(true)
+		p = &pollard
+		if savedHash != nil {
+			log.Infof("Loading the utreexo state from the database " +
+				"into memory.  This may take a while...")
+			err = loadPollardFromDB(db, p)
+			if err != nil {
+				return nil, err
+			}
+			p.NumLeaves = numLeaves
+		}
+
+	default:
+		return nil, err
+	}
+
+	if rootsHash != nil {
+		gotHash, err := utreexoRootsHash(p.NumLeaves, p.GetRoots())
+		if err != nil {
+			return nil, err
+		}
+		if gotHash != *rootsHash {
+			return nil, fmt.Errorf("the utreexo state roots don't match "+
+				"the roots flushed at block %s. The utreexo state is "+
+				"NOT recoverable and should be dropped and reindexed",
+				savedHash)
+		}
+	}
+
+	// Nothing is ever evicted so the state is only flushed as the flush
+	// policy says, ignoring the cache utilization.
+	flush := func(_ blockchain.UtreexoBatch, bestHash *chainhash.Hash) error {
+		return writePollardFile(path, bestHash, p)
+	}
+	isCacheOverflowed := func() bool {
+		return false
+	}
+	cacheUsageStats := func() (int64, int64) {
+		return 0, 0
+	}
+	cacheMetrics := func() (UtreexoCacheMetrics, UtreexoCacheMetrics) {
+		nodes := int64(p.Nodes.Length())
+		leaves := int64(p.CachedLeaves.Length())
+		return UtreexoCacheMetrics{Used: nodes, Capacity: nodes},
+			UtreexoCacheMetrics{Used: leaves, Capacity: leaves}
+	}
+
+	audit, err := openAuditLog(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	uState := &UtreexoState{
+		config:              cfg,
+		state:               p,
+		utreexoStateDB:      db,
+		auditLog:            audit,
+		pollardPath:         path,
+		isCacheOverflowed:   isCacheOverflowed,
+		cacheUsageStats:     cacheUsageStats,
+		flushLeavesAndNodes: flush,
+		lastFlushTime:       time.Now(),
+		cacheMetrics:        cacheMetrics,
+		proofs:              newProofCache(cfg.ProofCacheSize),
+	}
+	if savedHash != nil {
+		uState.lastFlushHash = *savedHash
+	}
+
+	err = uState.initConsistentUtreexoState(chain, savedHash, tipHash,
+		tipHeight, replayed, rollBack)
+	if err != nil {
+		return nil, err
+	}
+	uState.updateTip(tipHash)
+
+	return uState, nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestPollardFile(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, pollardFileName)
+
+	// Add some leaves and remove a few of them so that there are both
+	// remembered and forgotten nodes.
+	p := utreexo.NewMapPollard(true)
+	adds := make([]utreexo.Leaf, 100)
+	for i := range adds {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], uint64(i))
+		adds[i] = utreexo.Leaf{Hash: sha256.Sum256(buf[:]), Remember: i%3 != 0}
+	}
+	err := p.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delHashes := []utreexo.Hash{adds[1].Hash, adds[7].Hash, adds[50].Hash}
+	proof, err := p.Prove(delHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Modify(nil, delHashes, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bestHash := chainhash.Hash{1, 2, 3}
+	err = writePollardFile(path, &bestHash, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("the temporary pollard file was left behind: %v", err)
+	}
+
+	gotHash, got, err := readPollardFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gotHash != bestHash {
+		t.Fatalf("expected best hash %s, got %s", bestHash, gotHash)
+	}
+	if got.NumLeaves != p.NumLeaves {
+		t.Fatalf("expected %d leaves, got %d", p.NumLeaves, got.NumLeaves)
+	}
+	if !reflect.DeepEqual(got.GetRoots(), p.GetRoots()) {
+		t.Fatalf("the roots don't match after reading the pollard file")
+	}
+	if got.Nodes.Length() != p.Nodes.Length() ||
+		got.CachedLeaves.Length() != p.CachedLeaves.Length() {
+
+		t.Fatalf("expected %d nodes and %d cached leaves, got %d and %d",
+			p.Nodes.Length(), p.CachedLeaves.Length(),
+			got.Nodes.Length(), got.CachedLeaves.Length())
+	}
+	err = p.Nodes.ForEach(func(pos uint64, leaf utreexo.Leaf) error {
+		gotLeaf, found := got.Nodes.Get(pos)
+		if !found || gotLeaf != leaf {
+			t.Fatalf("node at %d: expected %v, got %v", pos, leaf, gotLeaf)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The remaining leaves are still provable with the read accumulator.
+	_, err = got.Prove([]utreexo.Hash{adds[2].Hash, adds[99].Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A flipped bit anywhere in the file is caught.
+	serialized, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []int{0, 10, pollardHeaderLen + 5, len(serialized) - 1} {
+		corrupted := append([]byte(nil), serialized...)
+		corrupted[offset] ^= 1
+		err = os.WriteFile(path, corrupted, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = readPollardFile(path)
+		if err == nil {
+			t.Fatalf("expected an error for a corrupted byte at %d", offset)
+		}
+	}
+
+	// So is a truncated file.
+	err = os.WriteFile(path, serialized[:len(serialized)-1], 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = readPollardFile(path)
+	if err == nil {
+		t.Fatal("expected an error for a truncated pollard file")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// proofCacheKey identifies a generated proof by the block the accumulator was
+// at and the leaf hashes that were proven.
+type proofCacheKey struct {
+	blockHash chainhash.Hash
+	targets   chainhash.Hash
+}
+
+// newProofCacheKey returns the key for the proof of the given leaf hashes at
+// the given block.  The hashes are committed to in order since the targets of
+// the proof follow the order of the proven hashes.
+func newProofCacheKey(blockHash *chainhash.Hash, hashes []utreexo.Hash) proofCacheKey {
+	h := sha256.New()
+	for _, hash := range hashes {
+		h.Write(hash[:])
+	}
+
+	key := proofCacheKey{blockHash: *blockHash}
+	copy(key.targets[:], h.Sum(nil))
+	return key
+}
+
+// proofCacheEntry is an element of the proof cache.
+type proofCacheEntry struct {
+	key   proofCacheKey
+	proof *blockchain.ChainTipProof
+}
+
+// proofCache is a least recently used cache of the proofs generated for sets of
+// leaf hashes.  Wallets tend to request proofs for the same outpoints over and
+// over and generating them requires walking the accumulator, so the proofs are
+// kept around until the accumulator changes.
+//
+// A proofCache with a maximum of 0 entries caches nothing.
+type proofCache struct {
+	mtx        sync.Mutex
+	maxEntries int
+	entries    map[proofCacheKey]*list.Element
+	lru        *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+// newProofCache returns a proof cache that holds up to maxEntries proofs.
+func newProofCache(maxEntries int) *proofCache {
+	return &proofCache{
+		maxEntries: maxEntries,
+		entries:    make(map[proofCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the cached proof for the given key and whether it was found.  The
+// returned proof is shared and must not be modified.
+//
+// This function is safe for concurrent access.
+func (c *proofCache) get(key proofCacheKey) (*blockchain.ChainTipProof, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*proofCacheEntry).proof, true
+}
+
+// add caches the proof under the given key, evicting the least recently used
+// proof if the cache is full.
+//
+// This function is safe for concurrent access.
+func (c *proofCache) add(key proofCacheKey, proof *blockchain.ChainTipProof) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.maxEntries <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*proofCacheEntry).proof = proof
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*proofCacheEntry).key)
+	}
+	c.entries[key] = c.lru.PushFront(&proofCacheEntry{key: key, proof: proof})
+}
+
+// purge removes all the cached proofs.  It's called whenever the accumulator
+// changes as none of the cached proofs are valid against the new roots.
+//
+// This function is safe for concurrent access.
+func (c *proofCache) purge() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.lru.Len() == 0 {
+		return
+	}
+	c.entries = make(map[proofCacheKey]*list.Element)
+	c.lru.Init()
+}
+
+// metrics returns the usage and the hit rate of the cache.
+//
+// This function is safe for concurrent access.
+func (c *proofCache) metrics() UtreexoCacheMetrics {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return UtreexoCacheMetrics{
+		Used:     int64(c.lru.Len()),
+		Capacity: int64(c.maxEntries),
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestProofCache(t *testing.T) {
+	blockA := chainhash.Hash{1}
+	blockB := chainhash.Hash{2}
+	hashes := []utreexo.Hash{{1}, {2}, {3}}
+	reversed := []utreexo.Hash{{3}, {2}, {1}}
+
+	keyA := newProofCacheKey(&blockA, hashes)
+	if keyA != newProofCacheKey(&blockA, hashes) {
+		t.Fatalf("expected the same key for the same block and hashes")
+	}
+	if keyA == newProofCacheKey(&blockB, hashes) {
+		t.Fatalf("expected different keys for different blocks")
+	}
+	if keyA == newProofCacheKey(&blockA, reversed) {
+		t.Fatalf("expected different keys for differently ordered hashes")
+	}
+
+	cache := newProofCache(2)
+	if _, ok := cache.get(keyA); ok {
+		t.Fatalf("expected a miss on an empty cache")
+	}
+
+	proofA := &blockchain.ChainTipProof{ProvedAtHash: &blockA}
+	cache.add(keyA, proofA)
+	got, ok := cache.get(keyA)
+	if !ok || got != proofA {
+		t.Fatalf("expected the cached proof to be returned")
+	}
+
+	// Adding past the maximum evicts the least recently used proof.
+	keyB := newProofCacheKey(&blockA, reversed)
+	keyC := newProofCacheKey(&blockB, hashes)
+	cache.add(keyB, &blockchain.ChainTipProof{})
+	cache.get(keyA)
+	cache.add(keyC, &blockchain.ChainTipProof{})
+	if _, ok := cache.get(keyB); ok {
+		t.Fatalf("expected the least recently used proof to be evicted")
+	}
+	if _, ok := cache.get(keyA); !ok {
+		t.Fatalf("expected the recently used proof to be kept")
+	}
+
+	metrics := cache.metrics()
+	want := UtreexoCacheMetrics{Used: 2, Capacity: 2, Hits: 3, Misses: 2}
+	if metrics != want {
+		t.Fatalf("expected metrics %+v, got %+v", want, metrics)
+	}
+
+	// Purging drops every proof.
+	cache.purge()
+	if _, ok := cache.get(keyA); ok {
+		t.Fatalf("expected a miss after purging")
+	}
+	if used := cache.metrics().Used; used != 0 {
+		t.Fatalf("expected an empty cache after purging, got %d", used)
+	}
+
+	// A cache without any entries caches nothing.
+	disabled := newProofCache(0)
+	disabled.add(keyA, proofA)
+	if _, ok := disabled.get(keyA); ok {
+		t.Fatalf("expected a disabled cache to never hit")
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// ProofSizeStats are the statistics of the utreexo proofs stored for a range of
+// blocks.
+type ProofSizeStats struct {
+	// StartHeight and EndHeight are the first and the last block of the
+	// range, inclusive.
+	StartHeight int32
+	EndHeight   int32
+
+	// TotalBytes is the size of all the proofs in the range.
+	TotalBytes uint64
+
+	// MaxBytes is the size of the biggest proof in the range and
+	// MaxBytesHeight the height of its block.
+	MaxBytes       uint64
+	MaxBytesHeight int32
+
+	// TargetCounts is a histogram of the number of targets per block.  The
+	// first element counts the blocks without targets and element i the
+	// blocks with 2^(i-1) to 2^i-1 targets.
+	TargetCounts []uint64
+}
+
+// Blocks returns the number of blocks in the range.
+func (s *ProofSizeStats) Blocks() int32 {
+	return s.EndHeight - s.StartHeight + 1
+}
+
+// AverageBytes returns the average size of the proofs in the range.
+func (s *ProofSizeStats) AverageBytes() float64 {
+	return float64(s.TotalBytes) / float64(s.Blocks())
+}
+
+// TargetCountRange returns the smallest and the largest number of targets
+// counted in element i of TargetCounts.
+func TargetCountRange(i int) (uint64, uint64) {
+	if i == 0 {
+		return 0, 0
+	}
+	return 1 << (i - 1), 1<<i - 1
+}
+
+// add counts the proof of the block at the given height.
+func (s *ProofSizeStats) add(height int32, size, numTargets uint64) {
+	s.TotalBytes += size
+	if size > s.MaxBytes {
+		s.MaxBytes = size
+		s.MaxBytesHeight = height
+	}
+
+	i := bits.Len64(numTargets)
+	for len(s.TargetCounts) <= i {
+		s.TargetCounts = append(s.TargetCounts, 0)
+	}
+	s.TargetCounts[i]++
+}
+
+// proofNumTargets returns the number of targets of the serialized proof from
+// its first bytes.  The number of targets is the first thing serialized.
+func proofNumTargets(prefix []byte) (uint64, error) {
+	return wire.ReadVarInt(bytes.NewReader(prefix), 0)
+}
+
+// checkProofStatsRange returns an error if the proofs of the given range can't
+// be gathered statistics on.
+func checkProofStatsRange(pruned bool, startHeight, endHeight int32) error {
+	if pruned {
+		return fmt.Errorf("Cannot fetch historical proof as the node is pruned")
+	}
+	if startHeight < 1 || endHeight < startHeight {
+		return fmt.Errorf("invalid height range of %d to %d", startHeight, endHeight)
+	}
+
+	return nil
+}
+
+// ProofSizeStats returns the statistics of the proofs of the blocks in the main
+// chain from startHeight to endHeight, inclusive.  Only the stored size and the
+// number of targets are read from each proof.  The interrupt channel stops the
+// gathering early with an error.
+func (idx *UtreexoProofIndex) ProofSizeStats(startHeight, endHeight int32,
+	interrupt <-chan struct{}) (*ProofSizeStats, error) {
+
+	err := checkProofStatsRange(idx.config.Pruned, startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ProofSizeStats{StartHeight: startHeight, EndHeight: endHeight}
+	for height := startHeight; height <= endHeight; height++ {
+		if interruptRequested(interrupt) {
+			return nil, errInterruptRequested
+		}
+
+		hash, err := idx.chain.BlockHashByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+
+		err = idx.db.View(func(dbTx database.Tx) error {
+			proofBytes, err := dbFetchUtreexoProofEntry(dbTx, hash)
+			if err != nil {
+				return err
+			}
+			if proofBytes == nil {
+				return fmt.Errorf("Couldn't fetch Utreexo proof for height %d", height)
+			}
+
+			numTargets, err := proofNumTargets(proofBytes)
+			if err != nil {
+				return err
+			}
+			stats.add(height, uint64(len(proofBytes)), numTargets)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// ProofSizeStats returns the statistics of the proofs of the blocks from
+// startHeight to endHeight, inclusive.  The sizes come from the offsets of the
+// proof file and only the number of targets is read from each proof.  The
+// interrupt channel stops the gathering early with an error.
+func (idx *FlatUtreexoProofIndex) ProofSizeStats(startHeight, endHeight int32,
+	interrupt <-chan struct{}) (*ProofSizeStats, error) {
+
+	err := checkProofStatsRange(idx.config.Pruned, startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// The proofs of the blocks that were just connected may not be written
+	// yet.
+	err = idx.waitForProof(endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ProofSizeStats{StartHeight: startHeight, EndHeight: endHeight}
+	var prefix [wire.MaxVarIntPayload]byte
+	for height := startHeight; height <= endHeight; height++ {
+		if interruptRequested(interrupt) {
+			return nil, errInterruptRequested
+		}
+
+		size, err := idx.proofState.DataSize(height)
+		if err != nil {
+			return nil, err
+		}
+		buf := prefix[:min(int64(len(prefix)), size)]
+		err = idx.proofState.FetchDataAt(height, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		numTargets, err := proofNumTargets(buf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the number of targets "+
+				"of the proof for height %d: %v", height, err)
+		}
+		stats.add(height, uint64(size), numTargets)
+	}
+
+	return stats, nil
+}
+
+// FlatFileSize is the size of one of the flat files of the flat utreexo proof
+// index.
+type FlatFileSize struct {
+	Name       string
+	Height     int32
+	DataSize   int64
+	OffsetSize int64
+}
+
+// FlatFileSizes returns the sizes of the flat files that the index keeps.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) FlatFileSizes() ([]FlatFileSize, error) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	var sizes []FlatFileSize
+	for _, ff := range []*FlatFileState{&idx.proofState, &idx.undoState,
+		&idx.proofStatsState, &idx.rootsState, &idx.ttlState,
+		&idx.summaryState} {
+
+		// The flat files that aren't kept were never initialized.
+		if ff.dataFile == nil {
+			continue
+		}
+
+		dataSize, offsetSize, err := ff.FileSizes()
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, FlatFileSize{
+			Name:       ff.name,
+			Height:     ff.BestHeight(),
+			DataSize:   dataSize,
+			OffsetSize: offsetSize,
+		})
+	}
+
+	return sizes, nil
+}
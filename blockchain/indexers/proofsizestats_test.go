@@ -0,0 +1,82 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestFlatProofSizeStats(t *testing.T) {
+	t.Parallel()
+
+	ff, tmpDir, err := initFF("TestFlatProofSizeStats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up. Always runs
+
+	// Store proofs with 0, 1, 3, 300 and 2 targets.  300 targets take up
+	// more than a single byte for their count.
+	targetCounts := []int{0, 1, 3, 300, 2}
+	sizes := make([]uint64, len(targetCounts))
+	for i, numTargets := range targetCounts {
+		ud := wire.UData{AccProof: utreexo.Proof{
+			Targets: make([]uint64, numTargets),
+			Proof:   make([]utreexo.Hash, i),
+		}}
+		var buf bytes.Buffer
+		err = ud.Serialize(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[i] = uint64(buf.Len())
+
+		err = ff.StoreData(int32(i+1), buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx := &FlatUtreexoProofIndex{config: &UtreexoConfig{}, proofState: *ff}
+	stats, err := idx.ProofSizeStats(2, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &ProofSizeStats{
+		StartHeight:    2,
+		EndHeight:      5,
+		TotalBytes:     sizes[1] + sizes[2] + sizes[3] + sizes[4],
+		MaxBytes:       sizes[3],
+		MaxBytesHeight: 4,
+		// 1, 2-3 and 256-511 targets.
+		TargetCounts: []uint64{0, 1, 2, 0, 0, 0, 0, 0, 0, 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+	if stats.Blocks() != 4 {
+		t.Fatalf("expected 4 blocks, got %d", stats.Blocks())
+	}
+	if lo, hi := TargetCountRange(9); lo != 256 || hi != 511 {
+		t.Fatalf("expected the last bucket to be 256 to 511, got %d to %d",
+			lo, hi)
+	}
+
+	_, err = idx.ProofSizeStats(0, 5, nil)
+	if err == nil {
+		t.Fatal("expected an error for a range starting at height 0")
+	}
+	_, err = idx.ProofSizeStats(4, 6, nil)
+	if err == nil {
+		t.Fatal("expected an error for a range past the stored proofs")
+	}
+}
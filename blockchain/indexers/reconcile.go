@@ -0,0 +1,129 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/database"
+)
+
+// stateHeight is the height that a part of the state of the node is at.
+type stateHeight struct {
+	name   string
+	height int32
+}
+
+// stateReconciler is implemented by the indexes that keep state apart from
+// their tips in the database, such as a utreexo state or flat files.  That
+// state is replayed or rolled back to the tip of the index when the index is
+// initialized.
+type stateReconciler interface {
+	// reconciledStartHeights returns the heights that the state of the
+	// index was at when the index was initialized.
+	reconciledStartHeights() []stateHeight
+}
+
+// reconciledHeight is the height that a part of the state of the node was at on
+// startup and the height it was reconciled to.
+type reconciledHeight struct {
+	name  string
+	start int32
+	end   int32
+}
+
+// String returns how the part of the state was reconciled.
+func (r reconciledHeight) String() string {
+	switch {
+	case r.start < r.end:
+		return fmt.Sprintf("replayed %s from height %d to %d", r.name,
+			r.start, r.end)
+	case r.start > r.end:
+		return fmt.Sprintf("rolled back %s from height %d to %d",
+			r.name, r.start, r.end)
+	}
+	return fmt.Sprintf("%s is at height %d", r.name, r.end)
+}
+
+// reconciliationRepairs returns the parts of the state that had to be replayed
+// or rolled back to be reconciled.  The parts that were just created aren't
+// repairs so they're left out.
+func reconciliationRepairs(heights []reconciledHeight) []reconciledHeight {
+	var repairs []reconciledHeight
+	for _, h := range heights {
+		if h.start != h.end && h.start != -1 {
+			repairs = append(repairs, h)
+		}
+	}
+	return repairs
+}
+
+// logReconciliation logs how the utxo cache and the enabled indexes were
+// reconciled with the best chain given the heights they were at when the node
+// was started.  startHeights holds the heights for each of the enabled indexes
+// with the tip of the index first, followed by the heights of the rest of the
+// state of the index.  utxoStartHeight is the height of the utxo cache or -1
+// when the node doesn't keep one.
+func (m *Manager) logReconciliation(chain *blockchain.BlockChain,
+	utxoStartHeight int32, startHeights [][]stateHeight) error {
+
+	bestHeight := chain.BestSnapshot().Height
+
+	var heights []reconciledHeight
+	if utxoStartHeight != -1 {
+		heights = append(heights, reconciledHeight{
+			name:  "utxo cache",
+			start: utxoStartHeight,
+			end:   bestHeight,
+		})
+	}
+	err := m.db.View(func(dbTx database.Tx) error {
+		for i, indexer := range m.enabledIndexes {
+			_, tipHeight, err := dbFetchIndexerTip(dbTx, indexer.Key())
+			if err != nil {
+				return err
+			}
+
+			for j, start := range startHeights[i] {
+				name := indexer.Name()
+				if j > 0 {
+					name += " " + start.name
+				}
+				heights = append(heights, reconciledHeight{
+					name:  name,
+					start: start.height,
+					end:   tipHeight,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var background string
+	m.mtx.Lock()
+	if len(m.backfilling) > 0 {
+		background = fmt.Sprintf(" (%d being caught up in the "+
+			"background)", len(m.backfilling))
+	}
+	m.mtx.Unlock()
+
+	repairs := reconciliationRepairs(heights)
+	if len(repairs) == 0 {
+		log.Infof("Utxo cache and indexes are consistent with the block "+
+			"index at height %d%s", bestHeight, background)
+		return nil
+	}
+
+	log.Infof("Reconciled the utxo cache and indexes with the block index "+
+		"at height %d%s:", bestHeight, background)
+	for _, repair := range repairs {
+		log.Infof("  %s", repair)
+	}
+	return nil
+}
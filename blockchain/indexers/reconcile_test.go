@@ -0,0 +1,182 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+)
+
+func TestReconciliationRepairs(t *testing.T) {
+	heights := []reconciledHeight{
+		{"utxo cache", 90, 100},
+		{"utreexo proof index", 100, 100},
+		{"utreexo proof index utreexo state", 95, 100},
+		{"flat utreexo proof index", 98, 98},
+		{"flat utreexo proof index flat files", 99, 98},
+		{"flat utreexo proof index utreexo state", -1, 98},
+	}
+
+	var got []string
+	for _, repair := range reconciliationRepairs(heights) {
+		got = append(got, repair.String())
+	}
+	want := []string{
+		"replayed utxo cache from height 90 to 100",
+		"replayed utreexo proof index utreexo state from height 95 to 100",
+		"rolled back flat utreexo proof index flat files from height 99 to 98",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected repairs %v, got %v", want, got)
+	}
+
+	if repairs := reconciliationRepairs(heights[1:2]); len(repairs) != 0 {
+		t.Fatalf("expected no repairs, got %v", repairs)
+	}
+	if got := heights[1].String(); got != "utreexo proof index is at height 100" {
+		t.Fatalf("unexpected description %q", got)
+	}
+}
+
+func TestLoadedFlatFileStates(t *testing.T) {
+	dir := t.TempDir()
+
+	idx := &FlatUtreexoProofIndex{config: &UtreexoConfig{Pruned: true}}
+	for _, s := range []struct {
+		ff   *FlatFileState
+		name string
+	}{
+		{&idx.undoState, flatUtreexoUndoName},
+		{&idx.proofStatsState, flatUtreexoProofStatsName},
+		{&idx.rootsState, flatUtreexoRootsName},
+	} {
+		ff, err := loadFlatFileState(dir, s.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ff.Close()
+		*s.ff = *ff
+	}
+
+	// Pruned nodes don't load the proofs and the block summaries so they
+	// must be left out.
+	states := idx.loadedFlatFileStates()
+	if len(states) != 3 {
+		t.Fatalf("expected 3 loaded flat files, got %d", len(states))
+	}
+	for _, ff := range states {
+		if ff.BestHeight() != 0 {
+			t.Fatalf("expected the flat files at height 0, got %d",
+				ff.BestHeight())
+		}
+	}
+}
+
+// TestLaggingIndexTip ensures that the utreexo state and the flat files that
+// are past the tip of the flat utreexo proof index are rolled back to it and
+// that the index is then replayed to the tip of the chain.
+func TestLaggingIndexTip(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestLaggingIndexTip")
+	defer tearDown()
+
+	var idx *FlatUtreexoProofIndex
+	for _, indexer := range indexes {
+		if flatIdx, ok := indexer.(*FlatUtreexoProofIndex); ok {
+			idx = flatIdx
+		}
+	}
+
+	const tipHeight, laggingHeight = 30, 25
+	stumps := make(map[int32]utreexo.Stump)
+	var spends []*blockchain.SpendableOut
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := 0; i < tipHeight; i++ {
+		block, outs, err := blockchain.AddBlock(chain, nextBlock, spends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock, spends = block, outs
+		stumps[block.Height()] = idx.utreexoState.currentStump()
+	}
+	tipProof, err := idx.FetchUtreexoProof(tipHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush the utreexo state at the tip of the chain and initialize the
+	// index as if its tip wasn't written past the lagging height.
+	err = idx.CloseUtreexoState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	laggingHash, err := chain.BlockHashByHeight(laggingHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Init(chain, laggingHash, laggingHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rest of the state of the index is rolled back to its tip.
+	got := idx.utreexoState.currentStump()
+	if !reflect.DeepEqual(got, stumps[laggingHeight]) {
+		t.Fatalf("expected the utreexo state at height %d to be %v, "+
+			"got %v", laggingHeight, stumps[laggingHeight], got)
+	}
+	for _, ff := range []*FlatFileState{&idx.proofState, &idx.rootsState,
+		&idx.ttlState} {
+
+		if ff.BestHeight() != laggingHeight {
+			t.Fatalf("expected the flat files at height %d, got %d",
+				laggingHeight, ff.BestHeight())
+		}
+	}
+	want := []stateHeight{
+		{"utreexo state", tipHeight},
+		{"flat files", tipHeight},
+	}
+	if got := idx.reconciledStartHeights(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the start heights %v, got %v", want, got)
+	}
+
+	// Replaying the missing blocks catches the index up to the chain.
+	for height := int32(laggingHeight + 1); height <= tipHeight; height++ {
+		block, err := chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stxos, err := chain.FetchSpendJournal(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.ConnectBlock(nil, block, stxos)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := idx.utreexoState.currentStump()
+		if !reflect.DeepEqual(got, stumps[height]) {
+			t.Fatalf("expected the utreexo state at height %d to "+
+				"be %v, got %v", height, stumps[height], got)
+		}
+	}
+	proof, err := idx.FetchUtreexoProof(tipHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(proof, tipProof) {
+		t.Fatalf("expected the proof %v, got %v", tipProof, proof)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// replicaCurrentName is the name of the file in the replica directory
+	// that names the latest snapshot.  It's replaced as a whole so that
+	// readers never see it half written.
+	replicaCurrentName = "CURRENT"
+
+	// replicaSnapshotPrefix is the prefix of the directories of the
+	// snapshots.  It's followed by the height and the hash of the block
+	// the snapshot is at.
+	replicaSnapshotPrefix = "snapshot-"
+
+	// ReplicaSnapshotsKept is how many of the latest snapshots are kept.
+	// The older ones are removed, so readers have to switch to the latest
+	// snapshot before this many newer ones are written.
+	ReplicaSnapshotsKept = 3
+)
+
+// replicaSnapshotName returns the name of the snapshot at the block.
+func replicaSnapshotName(height int32, hash *chainhash.Hash) string {
+	return fmt.Sprintf("%s%d-%s", replicaSnapshotPrefix, height, hash)
+}
+
+// parseReplicaSnapshotName returns the height of the block of the snapshot
+// with the given name.
+func parseReplicaSnapshotName(name string) (int32, error) {
+	fields := strings.Split(strings.TrimPrefix(name, replicaSnapshotPrefix), "-")
+	if !strings.HasPrefix(name, replicaSnapshotPrefix) || len(fields) != 2 {
+		return 0, fmt.Errorf("%q isn't the name of a snapshot", name)
+	}
+	height, err := strconv.ParseInt(fields[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q isn't the name of a snapshot: %v", name, err)
+	}
+	if _, err := chainhash.NewHashFromStr(fields[1]); err != nil {
+		return 0, fmt.Errorf("%q isn't the name of a snapshot: %v", name, err)
+	}
+
+	return int32(height), nil
+}
+
+// writeReplicaCurrent names the snapshot in the CURRENT file of the replica
+// directory.
+func writeReplicaCurrent(replicaDir, name string) error {
+	path := filepath.Join(replicaDir, replicaCurrentName)
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(name + "\n")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// readReplicaCurrent returns the name of the latest snapshot of the replica
+// directory.
+func readReplicaCurrent(replicaDir string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(replicaDir, replicaCurrentName))
+	if err != nil {
+		return "", fmt.Errorf("no snapshot in %s: %v", replicaDir, err)
+	}
+	name := strings.TrimSpace(string(b))
+	if _, err := parseReplicaSnapshotName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// pruneReplicaSnapshots removes all the snapshots of the replica directory but
+// the latest ReplicaSnapshotsKept ones along with the leftovers of the
+// snapshots that weren't finished.
+func pruneReplicaSnapshots(replicaDir string) error {
+	entries, err := os.ReadDir(replicaDir)
+	if err != nil {
+		return err
+	}
+
+	type snapshot struct {
+		name   string
+		height int32
+	}
+	var snapshots []snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(name, replicaSnapshotPrefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			err = os.RemoveAll(filepath.Join(replicaDir, name))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		height, err := parseReplicaSnapshotName(name)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot{name, height})
+	}
+	if len(snapshots) <= ReplicaSnapshotsKept {
+		return nil
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].height < snapshots[j].height
+	})
+	for _, s := range snapshots[:len(snapshots)-ReplicaSnapshotsKept] {
+		err = os.RemoveAll(filepath.Join(replicaDir, s.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteReplicaSnapshot writes a checkpoint of the utreexo state to a new
+// snapshot in replicaDir and hands it off to the read replicas by naming it in
+// the CURRENT file.  The checkpoint hard links the files of the database when
+// replicaDir is on the same file system as the data directory.  The flat files
+// aren't copied since the read replicas read them from the data directory.
+//
+// The index has to be flushed and no blocks may be connected to or disconnected
+// from it until WriteReplicaSnapshot returns.  BlockChain.FlushIndexesAndRun
+// takes care of both.
+func (idx *FlatUtreexoProofIndex) WriteReplicaSnapshot(replicaDir string,
+	tip *blockchain.BestState) error {
+
+	err := os.MkdirAll(replicaDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := replicaSnapshotName(tip.Height, &tip.Hash)
+	path := filepath.Join(replicaDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		tmpPath := path + ".tmp"
+		err = os.RemoveAll(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(tmpPath, 0700)
+		if err != nil {
+			return err
+		}
+		idx.mtx.RLock()
+		_, err = idx.utreexoState.backup(tmpPath)
+		idx.mtx.RUnlock()
+		if err != nil {
+			os.RemoveAll(tmpPath)
+			return err
+		}
+		err = os.Rename(tmpPath, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writeReplicaCurrent(replicaDir, name)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Handed off the utreexo state snapshot at block %v (height "+
+		"%d) to the read replicas", tip.Hash, tip.Height)
+
+	return pruneReplicaSnapshots(replicaDir)
+}
+
+// Replica is a read replica of the flat utreexo proof index of a node that
+// hands off snapshots of its utreexo state to a replica directory.  The
+// accumulator is read from the latest snapshot and the proofs from the flat
+// files in the data directory of the node, which is never written to.
+// Several replicas may read the same directories while the node runs.
+type Replica struct {
+	cfg        UtreexoConfig
+	replicaDir string
+
+	mtx      sync.Mutex
+	snapshot string
+	height   int32
+	state    *ReadOnlyUtreexoState
+}
+
+// OpenReplica opens the latest snapshot in replicaDir of the node whose
+// network and data directory are in the config.
+func OpenReplica(cfg *UtreexoConfig, replicaDir string) (*Replica, error) {
+	r := &Replica{cfg: *cfg, replicaDir: replicaDir}
+	r.cfg.Name = FlatUtreexoStateName
+
+	_, err := r.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Refresh switches to the latest snapshot and reopens the flat files when the
+// node handed off a new snapshot and returns whether it did.  The snapshot in
+// use is kept if the latest one can't be opened.
+//
+// This function is safe for concurrent access.
+func (r *Replica) Refresh() (bool, error) {
+	name, err := readReplicaCurrent(r.replicaDir)
+	if err != nil {
+		return false, err
+	}
+	r.mtx.Lock()
+	current := r.snapshot
+	r.mtx.Unlock()
+	if name == current {
+		return false, nil
+	}
+
+	height, err := parseReplicaSnapshotName(name)
+	if err != nil {
+		return false, err
+	}
+	snapshotCfg := r.cfg
+	snapshotCfg.DataDir = filepath.Join(r.replicaDir, name)
+	state, err := openUtreexoStateReadOnly(&snapshotCfg, r.cfg.DataDir)
+	if err != nil {
+		return false, err
+	}
+
+	r.mtx.Lock()
+	old := r.state
+	r.snapshot, r.height, r.state = name, height, state
+	r.mtx.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	return true, nil
+}
+
+// View calls fn with the utreexo state of the snapshot in use and the height
+// of its block.  The snapshot isn't switched while fn runs.
+//
+// This function is safe for concurrent access.
+func (r *Replica) View(fn func(state *ReadOnlyUtreexoState, height int32) error) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return fn(r.state, r.height)
+}
+
+// Close closes the snapshot in use.
+func (r *Replica) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.state.Close()
+}
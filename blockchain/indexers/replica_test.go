@@ -0,0 +1,136 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+)
+
+func TestReplica(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestReplica")
+	defer tearDown()
+
+	var idx *FlatUtreexoProofIndex
+	for _, indexer := range indexes {
+		if flatIdx, ok := indexer.(*FlatUtreexoProofIndex); ok {
+			idx = flatIdx
+		}
+	}
+	replicaDir := filepath.Join(idx.config.DataDir, "replica")
+	writeSnapshot := func() {
+		err := chain.FlushIndexesAndRun(func(tip *blockchain.BestState) error {
+			return idx.WriteReplicaSnapshot(replicaDir, tip)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var spends []*blockchain.SpendableOut
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	addBlocks := func(count int) {
+		for i := 0; i < count; i++ {
+			block, outs, err := blockchain.AddBlock(chain, nextBlock, spends)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nextBlock, spends = block, outs
+		}
+	}
+
+	// The replica sees the accumulator and the proofs at the snapshot.
+	addBlocks(20)
+	writeSnapshot()
+	replica, err := OpenReplica(idx.config, replicaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	checkReplica := func() {
+		tip := chain.BestSnapshot()
+		err := replica.View(func(state *ReadOnlyUtreexoState, height int32) error {
+			if height != tip.Height || *state.BestHash() != tip.Hash {
+				t.Fatalf("expected the snapshot at block %v (height "+
+					"%d), got %v (height %d)", tip.Hash,
+					tip.Height, state.BestHash(), height)
+			}
+
+			stump, err := state.FetchRoots(height)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(state.Stump(), stump) {
+				t.Fatalf("expected roots %v, got %v", stump,
+					state.Stump())
+			}
+
+			proof, err := state.FetchUtreexoProof(height)
+			if err != nil {
+				return err
+			}
+			expected, err := idx.FetchUtreexoProof(height)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(proof, expected) {
+				t.Fatalf("expected proof %v, got %v", expected, proof)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkReplica()
+
+	// The replica only switches to new snapshots.
+	addBlocks(5)
+	switched, err := replica.Refresh()
+	if err != nil || switched {
+		t.Fatalf("expected no switch without a new snapshot: %v", err)
+	}
+	writeSnapshot()
+	switched, err = replica.Refresh()
+	if err != nil || !switched {
+		t.Fatalf("expected a switch to the new snapshot: %v", err)
+	}
+	checkReplica()
+
+	// Only the latest snapshots are kept.
+	for i := 0; i < ReplicaSnapshotsKept+1; i++ {
+		addBlocks(1)
+		writeSnapshot()
+	}
+	entries, err := os.ReadDir(replicaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshots int
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), replicaSnapshotPrefix) {
+			snapshots++
+		}
+	}
+	if snapshots != ReplicaSnapshotsKept {
+		t.Fatalf("expected %d snapshots, got %d", ReplicaSnapshotsKept,
+			snapshots)
+	}
+	_, err = replica.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplica()
+}
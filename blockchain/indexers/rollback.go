@@ -0,0 +1,285 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// rollbackSnapshotPrefix and rollbackSnapshotSuffix make up the names of
+	// the rollback snapshots in the utreexo state directory along with the
+	// height of the block they're at.
+	rollbackSnapshotPrefix = "rollback-"
+	rollbackSnapshotSuffix = ".dat"
+)
+
+// replayedUndoBlock is the data necessary for undoing a block that was
+// recovered by replaying the blocks from a rollback snapshot.
+type replayedUndoBlock struct {
+	hash      chainhash.Hash
+	numAdds   uint64
+	targets   []uint64
+	delHashes []utreexo.Hash
+}
+
+// rollbackSnapshotPath returns the path of the rollback snapshot at the given
+// height of the utreexo state described by the config.
+func rollbackSnapshotPath(cfg *UtreexoConfig, height int32) string {
+	name := rollbackSnapshotPrefix + strconv.Itoa(int(height)) +
+		rollbackSnapshotSuffix
+	return filepath.Join(utreexoBasePath(cfg), name)
+}
+
+// rollbackSnapshotHeights returns the heights of the rollback snapshots of the
+// utreexo state described by the config from the highest to the lowest.
+func rollbackSnapshotHeights(cfg *UtreexoConfig) ([]int32, error) {
+	entries, err := os.ReadDir(utreexoBasePath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var heights []int32
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, rollbackSnapshotPrefix) ||
+			!strings.HasSuffix(name, rollbackSnapshotSuffix) {
+			continue
+		}
+		height, err := strconv.ParseInt(strings.TrimSuffix(
+			strings.TrimPrefix(name, rollbackSnapshotPrefix),
+			rollbackSnapshotSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		heights = append(heights, int32(height))
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] > heights[j]
+	})
+
+	return heights, nil
+}
+
+// maybeStoreRollbackSnapshot writes the accumulator to a rollback snapshot when
+// it's at least the undo retention past the last one and removes the snapshots
+// past the number that's kept.  It should only be called right after a flush as
+// the nodes on disk are only up to date with the ones in the cache then.
+//
+// This function MUST be called with the index lock held for reads.
+func (us *UtreexoState) maybeStoreRollbackSnapshot(chain *blockchain.BlockChain) error {
+	if us.config.RollbackSnapshots <= 0 {
+		return nil
+	}
+
+	// The accumulator may be behind the main chain while the index is
+	// caught up in the background so it's snapshotted at the block it's at.
+	_, tipHash := us.currentTip()
+	height, err := chain.BlockHeightByHash(&tipHash)
+	if err != nil {
+		// Only the accumulators at the blocks of the main chain are of
+		// any use for reorgs.
+		return nil
+	}
+
+	heights, err := rollbackSnapshotHeights(us.config)
+	if err != nil {
+		return err
+	}
+	if len(heights) > 0 && height-heights[0] < us.config.undoRetention() {
+		return nil
+	}
+
+	p, ok := us.state.(*utreexo.MapPollard)
+	if !ok {
+		return fmt.Errorf("can't snapshot a utreexo state of type %T",
+			us.state)
+	}
+	start := time.Now()
+	err = writePollardFile(rollbackSnapshotPath(us.config, height), &tipHash, p)
+	if err != nil {
+		return fmt.Errorf("unable to write the rollback snapshot at "+
+			"height %d: %v", height, err)
+	}
+	log.Debugf("Wrote the %s rollback snapshot at height %d in %v",
+		us.config.Name, height, time.Since(start))
+
+	heights = append([]int32{height}, heights...)
+	for _, old := range heights[min(len(heights), us.config.RollbackSnapshots):] {
+		err = os.Remove(rollbackSnapshotPath(us.config, old))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropRollbackSnapshots removes the rollback snapshots at the given height and
+// above.  They're of blocks that are no longer in the main chain once the block
+// at the height is disconnected.
+func (us *UtreexoState) dropRollbackSnapshots(height int32) error {
+	if us.config.RollbackSnapshots <= 0 {
+		return nil
+	}
+
+	heights, err := rollbackSnapshotHeights(us.config)
+	if err != nil {
+		return err
+	}
+	for _, h := range heights {
+		if h < height {
+			break
+		}
+		err = os.Remove(rollbackSnapshotPath(us.config, h))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchReplayedUndo returns the data necessary for undoing the given block when
+// it's no longer kept by the index.  The accumulator is at the block.  The data
+// is recovered by loading the last rollback snapshot below the block and
+// replaying the blocks on top of it up to the block.  The data recovered for the
+// blocks in between is kept around for when they're disconnected next.
+//
+// This function MUST be called from the goroutine that connects and disconnects
+// the blocks of the index.
+func (us *UtreexoState) fetchReplayedUndo(chain *blockchain.BlockChain,
+	block *btcutil.Block) (uint64, []uint64, []utreexo.Hash, error) {
+
+	height := block.Height()
+	undo, ok := us.replayedUndo[height]
+	if !ok || undo.hash != *block.Hash() {
+		err := us.replayUndo(chain, height)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		undo = us.replayedUndo[height]
+	}
+	delete(us.replayedUndo, height)
+
+	return undo.numAdds, undo.targets, undo.delHashes, nil
+}
+
+// replayUndo recovers the data necessary for undoing the blocks from the last
+// rollback snapshot below the given height up to the height by replaying them
+// on top of the snapshot.  The accumulator must be at the block at the height.
+func (us *UtreexoState) replayUndo(chain *blockchain.BlockChain, height int32) error {
+	if us.config.RollbackSnapshots <= 0 {
+		return fmt.Errorf("the data for undoing the block at height %d "+
+			"is no longer kept. Enable --rollbacksnapshots to undo "+
+			"reorgs this deep", height)
+	}
+
+	heights, err := rollbackSnapshotHeights(us.config)
+	if err != nil {
+		return err
+	}
+
+	// Pick the last snapshot below the height that's still of a block in
+	// the main chain.
+	var (
+		snapHeight int32
+		p          *utreexo.MapPollard
+	)
+	for _, h := range heights {
+		if h >= height {
+			continue
+		}
+		hash, err := chain.BlockHashByHeight(h)
+		if err != nil {
+			return err
+		}
+		var snapHash *chainhash.Hash
+		snapHash, p, err = readPollardFile(rollbackSnapshotPath(us.config, h))
+		if err != nil {
+			log.Warnf("Skipping the rollback snapshot at height %d: %v",
+				h, err)
+			continue
+		}
+		if !snapHash.IsEqual(hash) {
+			log.Warnf("Skipping the rollback snapshot at height %d as "+
+				"it's of block %s which isn't in the main chain", h,
+				snapHash)
+			p = nil
+			continue
+		}
+		snapHeight = h
+		break
+	}
+	if p == nil {
+		return fmt.Errorf("there's no rollback snapshot below height %d "+
+			"to recover the data for undoing the block from. The "+
+			"utreexo state should be dropped and reindexed", height)
+	}
+
+	log.Infof("Recovering the data for undoing blocks %d to %d from the "+
+		"rollback snapshot at height %d...", snapHeight+1, height,
+		snapHeight)
+
+	// The chain lock is held during reorgs so the spend journal is fetched
+	// without taking it.
+	replayed := make(map[int32]*replayedUndoBlock, height-snapHeight)
+	for h := snapHeight + 1; h <= height; h++ {
+		block, err := chain.BlockByHeight(h)
+		if err != nil {
+			return err
+		}
+		stxos, err := chain.FetchSpendJournalUnsafe(block)
+		if err != nil {
+			return err
+		}
+
+		adds, delHashes, ud, err := attachReplayedBlock(chain, p, block, stxos)
+		if err != nil {
+			return fmt.Errorf("unable to replay block %s (%d) on the "+
+				"rollback snapshot: %v", block.Hash(), h, err)
+		}
+		replayed[h] = &replayedUndoBlock{
+			hash:      *block.Hash(),
+			numAdds:   uint64(len(adds)),
+			targets:   ud.AccProof.Targets,
+			delHashes: delHashes,
+		}
+	}
+
+	// The replayed accumulator has to end up where the accumulator is.
+	// Otherwise the recovered data would corrupt it when it's undone.
+	stump := us.currentStump()
+	gotHash, err := utreexoRootsHash(p.NumLeaves, p.GetRoots())
+	if err != nil {
+		return err
+	}
+	wantHash, err := utreexoRootsHash(stump.NumLeaves, stump.Roots)
+	if err != nil {
+		return err
+	}
+	if gotHash != wantHash {
+		return fmt.Errorf("the accumulator replayed from the rollback "+
+			"snapshot at height %d doesn't match the utreexo state at "+
+			"height %d", snapHeight, height)
+	}
+	us.replayedUndo = replayed
+
+	return nil
+}
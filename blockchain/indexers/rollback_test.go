@@ -0,0 +1,173 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestRollbackSnapshots(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestRollbackSnapshots")
+	defer tearDown()
+
+	// Take a snapshot every 5 blocks and keep the last 2.
+	const retention = 5
+	for _, indexer := range indexes {
+		switch idxType := indexer.(type) {
+		case *FlatUtreexoProofIndex:
+			idxType.config.UndoRetention = retention
+			idxType.config.RollbackSnapshots = 2
+		case *UtreexoProofIndex:
+			idxType.config.UndoRetention = retention
+			idxType.config.RollbackSnapshots = 2
+		}
+	}
+
+	var allSpends []*blockchain.SpendableOut
+	var nextSpends []*blockchain.SpendableOut
+	maxHeight := int32(30)
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := int32(1); i <= maxHeight; i++ {
+		newBlock, newSpendableOuts, err := blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock = newBlock
+
+		allSpends = append(allSpends, newSpendableOuts...)
+		var nextSpendsTmp []*blockchain.SpendableOut
+		for j := 0; j < len(allSpends); j++ {
+			randIdx := rand.Intn(len(allSpends))
+			spend := allSpends[randIdx]
+			allSpends = append(allSpends[:randIdx], allSpends[randIdx+1:]...)
+			nextSpendsTmp = append(nextSpendsTmp, spend)
+		}
+		nextSpends = nextSpendsTmp
+
+		// Flush on every block so that a snapshot is taken as soon as
+		// the tip is far enough from the last one.
+		for _, indexer := range indexes {
+			flusher := indexer.(interface {
+				Flush(*chainhash.Hash, blockchain.FlushMode, bool) error
+			})
+			err = flusher.Flush(newBlock.Hash(), blockchain.FlushRequired, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, indexer := range indexes {
+		var (
+			us          *UtreexoState
+			getUndoData func(*btcutil.Block) (uint64, []uint64, []utreexo.Hash, error)
+		)
+		switch idxType := indexer.(type) {
+		case *FlatUtreexoProofIndex:
+			us = idxType.utreexoState
+			getUndoData = idxType.getUndoData
+		case *UtreexoProofIndex:
+			us = idxType.utreexoState
+			getUndoData = func(block *btcutil.Block) (uint64, []uint64, []utreexo.Hash, error) {
+				return idxType.getUndoData(nil, block)
+			}
+		}
+
+		// Snapshots were taken at heights 1, 6, ..., 26 and only the
+		// last 2 are kept.
+		heights, err := rollbackSnapshotHeights(us.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(heights, []int32{26, 21}) {
+			t.Fatalf("%s: expected snapshots at heights [26 21], got %v",
+				us.config.Name, heights)
+		}
+
+		// The undo data recovered from the snapshot matches the undo
+		// data generated from the stored proofs.
+		for height := maxHeight; height > 26; height-- {
+			block, err := chain.BlockByHeight(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var numAdds uint64
+			var targets []uint64
+			var delHashes []utreexo.Hash
+			if height == maxHeight {
+				numAdds, targets, delHashes, err = us.fetchReplayedUndo(chain, block)
+			} else {
+				undo := us.replayedUndo[height]
+				numAdds, targets, delHashes = undo.numAdds, undo.targets, undo.delHashes
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectNumAdds, expectTargets, expectDelHashes, err := getUndoData(block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numAdds != expectNumAdds {
+				t.Fatalf("%s: height %d: expected %d adds, got %d",
+					us.config.Name, height, expectNumAdds, numAdds)
+			}
+			if len(targets) != len(expectTargets) ||
+				(len(targets) > 0 && !reflect.DeepEqual(targets, expectTargets)) {
+				t.Fatalf("%s: height %d: expected targets %v, got %v",
+					us.config.Name, height, expectTargets, targets)
+			}
+			if len(delHashes) != len(expectDelHashes) ||
+				(len(delHashes) > 0 && !reflect.DeepEqual(delHashes, expectDelHashes)) {
+				t.Fatalf("%s: height %d: expected del hashes %v, got %v",
+					us.config.Name, height, expectDelHashes, delHashes)
+			}
+		}
+
+		// The undo data of a block that's replaced by another one isn't
+		// used.
+		if _, ok := us.replayedUndo[maxHeight]; ok {
+			t.Fatalf("%s: expected the used undo data to be dropped",
+				us.config.Name)
+		}
+
+		// The snapshots of the disconnected blocks are dropped.
+		err = us.dropRollbackSnapshots(22)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heights, err = rollbackSnapshotHeights(us.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(heights, []int32{21}) {
+			t.Fatalf("%s: expected snapshots at heights [21], got %v",
+				us.config.Name, heights)
+		}
+
+		// There's nothing to recover the undo data from below the last
+		// snapshot.
+		block, err := chain.BlockByHeight(21)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _, err = us.fetchReplayedUndo(chain, block)
+		if err == nil {
+			t.Fatalf("%s: expected an error when there's no snapshot "+
+				"below the block", us.config.Name)
+		}
+	}
+}
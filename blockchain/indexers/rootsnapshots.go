@@ -0,0 +1,236 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// DefaultRootSnapshotInterval is the default number of blocks between
+	// the root snapshots of the utreexo proof indexes.
+	DefaultRootSnapshotInterval = 1000
+)
+
+var (
+	// rootSnapshotsKey is the name of the bucket of the root snapshots.  It
+	// is included in the parent bucket of each utreexo proof index and
+	// contains the roots of the accumulator every RootSnapshotInterval
+	// blocks keyed by the height of the block they're at.
+	rootSnapshotsKey = []byte("rootsnapshots")
+)
+
+// RootSnapshot is the roots of the accumulator at a block that were stored in
+// the root snapshots of a utreexo proof index.
+type RootSnapshot struct {
+	Height int32
+	Hash   chainhash.Hash
+	Stump  utreexo.Stump
+}
+
+// rootSnapshotKey returns the key of the root snapshot at the given height.
+// The heights are big endian so that the snapshots are ordered by height.
+func rootSnapshotKey(height int32) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// dbStoreRootSnapshot stores the roots of the accumulator at the given block in
+// the root snapshots of the index with the given parent bucket when the block is
+// at a multiple of the interval.  The bucket is created for indexes made before
+// the root snapshots were kept.
+func dbStoreRootSnapshot(dbTx database.Tx, parentKey []byte, interval int32,
+	block *btcutil.Block, p utreexo.Utreexo) error {
+
+	if interval <= 0 || block.Height()%interval != 0 {
+		return nil
+	}
+
+	serialized, err := blockchain.SerializeUtreexoRoots(p.GetNumLeaves(), p.GetRoots())
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 0, chainhash.HashSize+len(serialized))
+	value = append(value, block.Hash()[:]...)
+	value = append(value, serialized...)
+
+	bucket, err := dbTx.Metadata().Bucket(parentKey).CreateBucketIfNotExists(rootSnapshotsKey)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(rootSnapshotKey(block.Height()), value)
+}
+
+// dbDeleteRootSnapshot removes the root snapshot at the given height from the
+// root snapshots of the index with the given parent bucket if there is one.
+func dbDeleteRootSnapshot(dbTx database.Tx, parentKey []byte, height int32) error {
+	bucket := dbTx.Metadata().Bucket(parentKey).Bucket(rootSnapshotsKey)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.Delete(rootSnapshotKey(height))
+}
+
+// dbFetchRootSnapshot returns the last root snapshot at or below the given
+// height of the index with the given parent bucket.  The empty accumulator at
+// the genesis block is returned when there's none.
+func dbFetchRootSnapshot(dbTx database.Tx, parentKey []byte, height int32) (*RootSnapshot, error) {
+	snapshot := &RootSnapshot{}
+	bucket := dbTx.Metadata().Bucket(parentKey).Bucket(rootSnapshotsKey)
+	if bucket == nil {
+		return snapshot, nil
+	}
+
+	var value []byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		if len(k) != 4 {
+			return nil
+		}
+		h := int32(binary.BigEndian.Uint32(k))
+		if h <= height && h > snapshot.Height {
+			snapshot.Height = h
+			value = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return snapshot, nil
+	}
+
+	if len(value) < chainhash.HashSize {
+		return nil, fmt.Errorf("the root snapshot at height %d is corrupt",
+			snapshot.Height)
+	}
+	copy(snapshot.Hash[:], value[:chainhash.HashSize])
+	numLeaves, roots, err := blockchain.DeserializeUtreexoRoots(value[chainhash.HashSize:])
+	if err != nil {
+		return nil, fmt.Errorf("the root snapshot at height %d is "+
+			"corrupt: %v", snapshot.Height, err)
+	}
+	snapshot.Stump = utreexo.Stump{Roots: roots, NumLeaves: numLeaves}
+
+	return snapshot, nil
+}
+
+// updateStumpWithBlock applies the given block and its proof to the stump.
+func updateStumpWithBlock(chain *blockchain.BlockChain, stump *utreexo.Stump,
+	block *btcutil.Block, ud *wire.UData) error {
+
+	// Need to call reconstruct since the saved utreexo data is in the
+	// compact form.
+	delHashes, err := chain.ReconstructUData(ud, *block.Hash())
+	if err != nil {
+		return err
+	}
+	_, outCount, _, outskip := blockchain.DedupeBlock(block)
+	adds := blockchain.BlockToAddLeaves(block, outskip, nil, outCount)
+	addHashes := make([]utreexo.Hash, 0, len(adds))
+	for _, add := range adds {
+		addHashes = append(addHashes, add.Hash)
+	}
+
+	_, err = stump.Update(delHashes, addHashes, ud.AccProof)
+	return err
+}
+
+// replayRoots returns the roots of the accumulator at the given height by
+// applying the blocks of the main chain above the snapshot up to the height and
+// their proofs to the roots of the snapshot.
+func replayRoots(chain *blockchain.BlockChain, snapshot *RootSnapshot, height int32,
+	fetchProof func(*btcutil.Block) (*wire.UData, error)) (utreexo.Stump, error) {
+
+	if snapshot.Height > height {
+		return utreexo.Stump{}, fmt.Errorf("can't replay the roots at "+
+			"height %d from the snapshot at height %d", height,
+			snapshot.Height)
+	}
+
+	// A snapshot of a block that's been reorganized out of the main chain
+	// would've been removed when the block was disconnected.
+	if snapshot.Height > 0 {
+		hash, err := chain.BlockHashByHeight(snapshot.Height)
+		if err != nil {
+			return utreexo.Stump{}, err
+		}
+		if *hash != snapshot.Hash {
+			return utreexo.Stump{}, fmt.Errorf("the root snapshot at "+
+				"height %d is of block %s which isn't in the main "+
+				"chain", snapshot.Height, snapshot.Hash)
+		}
+	}
+
+	stump := utreexo.Stump{
+		Roots:     append([]utreexo.Hash(nil), snapshot.Stump.Roots...),
+		NumLeaves: snapshot.Stump.NumLeaves,
+	}
+	for h := snapshot.Height + 1; h <= height; h++ {
+		block, err := chain.BlockByHeight(h)
+		if err != nil {
+			return utreexo.Stump{}, err
+		}
+		ud, err := fetchProof(block)
+		if err != nil {
+			return utreexo.Stump{}, fmt.Errorf("unable to fetch the "+
+				"proof of block %s (%d) to replay the roots from "+
+				"the snapshot at height %d: %v", block.Hash(), h,
+				snapshot.Height, err)
+		}
+		err = updateStumpWithBlock(chain, &stump, block, ud)
+		if err != nil {
+			return utreexo.Stump{}, fmt.Errorf("unable to replay block "+
+				"%s (%d) on the roots: %v", block.Hash(), h, err)
+		}
+	}
+
+	return stump, nil
+}
+
+// FetchRootSnapshot returns the last root snapshot of the index at or below the
+// given height.  The empty accumulator at the genesis block is returned when
+// there's none.
+func (idx *UtreexoProofIndex) FetchRootSnapshot(dbTx database.Tx, height int32) (*RootSnapshot, error) {
+	return dbFetchRootSnapshot(dbTx, utreexoParentBucketKey, height)
+}
+
+// FetchRootSnapshot returns the last root snapshot of the index at or below the
+// given height.  The empty accumulator at the genesis block is returned when
+// there's none.
+func (idx *FlatUtreexoProofIndex) FetchRootSnapshot(dbTx database.Tx, height int32) (*RootSnapshot, error) {
+	return dbFetchRootSnapshot(dbTx, flatUtreexoBucketKey, height)
+}
+
+// ReplayRoots returns the roots of the accumulator at the given height replayed
+// from the given root snapshot with the stored proofs.  Pruned nodes don't keep
+// the proofs so only the roots at the snapshot itself are returned there.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoProofIndex) ReplayRoots(snapshot *RootSnapshot, height int32) (utreexo.Stump, error) {
+	return replayRoots(idx.chain, snapshot, height, func(block *btcutil.Block) (*wire.UData, error) {
+		return idx.FetchUtreexoProof(block.Hash())
+	})
+}
+
+// ReplayRoots returns the roots of the accumulator at the given height replayed
+// from the given root snapshot with the stored proofs.  Pruned nodes don't keep
+// the proofs so only the roots at the snapshot itself are returned there.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) ReplayRoots(snapshot *RootSnapshot, height int32) (utreexo.Stump, error) {
+	return replayRoots(idx.chain, snapshot, height, func(block *btcutil.Block) (*wire.UData, error) {
+		return idx.FetchUtreexoProof(block.Height())
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/database"
+)
+
+func TestRootSnapshots(t *testing.T) {
+	// Always remove the root on return.
+	defer os.RemoveAll(testDbRoot)
+
+	chain, indexes, params, _, tearDown := indexersTestChain("TestRootSnapshots")
+	defer tearDown()
+
+	// Snapshot the roots every 5 blocks.
+	const interval = 5
+	var db database.DB
+	for _, indexer := range indexes {
+		switch idxType := indexer.(type) {
+		case *FlatUtreexoProofIndex:
+			idxType.config.RootSnapshotInterval = interval
+		case *UtreexoProofIndex:
+			idxType.config.RootSnapshotInterval = interval
+			db = idxType.db
+		}
+	}
+
+	var allSpends []*blockchain.SpendableOut
+	var nextSpends []*blockchain.SpendableOut
+	maxHeight := int32(22)
+	nextBlock := btcutil.NewBlock(params.GenesisBlock)
+	for i := int32(1); i <= maxHeight; i++ {
+		newBlock, newSpendableOuts, err := blockchain.AddBlock(chain, nextBlock, nextSpends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nextBlock = newBlock
+
+		allSpends = append(allSpends, newSpendableOuts...)
+		nextSpends = allSpends[:len(allSpends)/2]
+		allSpends = allSpends[len(allSpends)/2:]
+	}
+
+	// Invalidate the tip so that the snapshot at height 20 is of a block
+	// that's no longer in the main chain.
+	tipHash := chain.BestSnapshot().Hash
+	for chain.BestSnapshot().Height >= 20 {
+		err := chain.InvalidateBlock(&tipHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev, err := chain.BlockHashByHeight(chain.BestSnapshot().Height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tipHash = *prev
+	}
+	bestHeight := chain.BestSnapshot().Height
+
+	for _, indexer := range indexes {
+		var (
+			fetchSnapshot func(database.Tx, int32) (*RootSnapshot, error)
+			replay        func(*RootSnapshot, int32) (utreexo.Stump, error)
+			fetchRoots    func(int32) (utreexo.Stump, error)
+		)
+		switch idxType := indexer.(type) {
+		case *FlatUtreexoProofIndex:
+			fetchSnapshot = idxType.FetchRootSnapshot
+			replay = idxType.ReplayRoots
+			fetchRoots = idxType.fetchRoots
+		case *UtreexoProofIndex:
+			fetchSnapshot = idxType.FetchRootSnapshot
+			replay = idxType.ReplayRoots
+			fetchRoots = func(height int32) (utreexo.Stump, error) {
+				hash, err := chain.BlockHashByHeight(height)
+				if err != nil {
+					return utreexo.Stump{}, err
+				}
+				var stump utreexo.Stump
+				err = db.View(func(dbTx database.Tx) error {
+					stump, err = dbFetchUtreexoState(dbTx, hash)
+					return err
+				})
+				return stump, err
+			}
+		default:
+			continue
+		}
+
+		// The roots replayed from the last snapshot at or below every
+		// height match the roots stored for the height.
+		for height := int32(1); height <= bestHeight; height++ {
+			var snapshot *RootSnapshot
+			err := db.View(func(dbTx database.Tx) error {
+				var err error
+				snapshot, err = fetchSnapshot(dbTx, height)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantSnapHeight := height - height%interval
+			if snapshot.Height != wantSnapHeight {
+				t.Fatalf("%s: height %d: expected the snapshot at "+
+					"height %d, got %d", indexer.Name(), height,
+					wantSnapHeight, snapshot.Height)
+			}
+
+			stump, err := replay(snapshot, height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect, err := fetchRoots(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stump.NumLeaves != expect.NumLeaves ||
+				!reflect.DeepEqual(stump.Roots, expect.Roots) {
+				t.Fatalf("%s: height %d: expected roots %v with %d "+
+					"leaves, got %v with %d leaves", indexer.Name(),
+					height, expect.Roots, expect.NumLeaves,
+					stump.Roots, stump.NumLeaves)
+			}
+		}
+
+		// The snapshot of the disconnected block was removed.
+		err := db.View(func(dbTx database.Tx) error {
+			snapshot, err := fetchSnapshot(dbTx, maxHeight)
+			if err != nil {
+				return err
+			}
+			if snapshot.Height != 15 {
+				t.Fatalf("%s: expected the last snapshot at height "+
+					"15, got %d", indexer.Name(), snapshot.Height)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// undoDirName is the name of the directory under the utreexo state
+	// directory that the undo files are kept in.
+	undoDirName = "undo"
+
+	// undoEpochBlocks is the number of consecutive blocks whose undo data is
+	// kept in a single undo file.
+	undoEpochBlocks = 2016
+
+	// DefaultUndoRetention is the default number of blocks from the tip that
+	// the undo data is kept for by pruned nodes.  288 since that's the basis
+	// used for NODE_NETWORK_LIMITED.  Reorgs that go past that are gonna be
+	// problematic anyways.
+	DefaultUndoRetention = 288
+
+	// undoIndexEntrySize is the size of each entry in an undo index file.
+	// Each entry is the height of the block followed by the offset of its
+	// undo data in the undo data file.
+	undoIndexEntrySize = 4 + 8
+
+	// undoDataSuffix and undoIndexSuffix are the suffixes of the undo data
+	// files and the undo index files.  The files are named after the epoch
+	// they hold the undo data of.
+	undoDataSuffix  = ".dat"
+	undoIndexSuffix = ".idx"
+)
+
+// undoEpochFile is the undo data of the blocks in a single epoch.  The undo
+// data is appended to the data file while the index file records the height
+// and the offset of each of them.
+type undoEpochFile struct {
+	dataFile  *os.File
+	indexFile *os.File
+
+	// firstHeight is the height of the first block stored in the epoch.
+	firstHeight int32
+
+	// offsets are the offsets in the data file of the undo data of each
+	// block, starting at firstHeight.
+	offsets []int64
+
+	// dataSize is the size of the data file.
+	dataSize int64
+}
+
+// lastHeight returns the height of the last block stored in the epoch.
+func (e *undoEpochFile) lastHeight() int32 {
+	return e.firstHeight + int32(len(e.offsets)) - 1
+}
+
+// read returns the undo data stored at the given offset.
+func (e *undoEpochFile) read(offset int64) ([]byte, error) {
+	var header [8]byte
+	_, err := e.dataFile.ReadAt(header[:], offset)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], magicBytes[:]) {
+		return nil, fmt.Errorf("read wrong magic bytes. Expect %x but got %x",
+			magicBytes, header[:4])
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header[4:]))
+	_, err = e.dataFile.ReadAt(data, offset+8)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// truncate drops the undo data of all the blocks after the given height.
+func (e *undoEpochFile) truncate(height int32) error {
+	keep := int(height - e.firstHeight + 1)
+	if keep >= len(e.offsets) {
+		return nil
+	}
+	if keep < 0 {
+		keep = 0
+	}
+
+	dataSize := e.offsets[keep]
+	err := e.dataFile.Truncate(dataSize)
+	if err != nil {
+		return err
+	}
+	err = e.indexFile.Truncate(int64(keep) * undoIndexEntrySize)
+	if err != nil {
+		return err
+	}
+
+	e.offsets = e.offsets[:keep]
+	e.dataSize = dataSize
+	return nil
+}
+
+// close closes both of the files of the epoch.
+func (e *undoEpochFile) close() error {
+	err := e.dataFile.Close()
+	if err != nil {
+		e.indexFile.Close()
+		return err
+	}
+	return e.indexFile.Close()
+}
+
+// undoFileStore keeps the undo data of the utreexo proof index in append-only
+// files.  Each file holds the undo data of the blocks of one epoch of
+// undoEpochBlocks blocks so that replaying the undo data reads a single file
+// sequentially and dropping the undo data that's no longer needed is just a
+// matter of deleting the files of the old epochs.
+//
+// The undo data is always stored for a contiguous range of heights that ends at
+// the tip of the index.
+type undoFileStore struct {
+	mtx sync.RWMutex
+	dir string
+
+	// epochs are the epoch files that are kept, keyed by the epoch number.
+	epochs map[int32]*undoEpochFile
+
+	// firstHeight and tipHeight are the heights of the first and the last
+	// blocks that have undo data stored.  Both are 0 if the store is empty.
+	firstHeight int32
+	tipHeight   int32
+
+	// syncWrites makes every store fsync the undo files before returning.
+	syncWrites bool
+}
+
+// undoEpoch returns the number of the epoch that the given height is in.
+func undoEpoch(height int32) int32 {
+	return height / undoEpochBlocks
+}
+
+// undoFilePath returns the path of the undo file of the given epoch with the
+// given suffix.
+func (s *undoFileStore) undoFilePath(epoch int32, suffix string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%09d", epoch)+suffix)
+}
+
+// openUndoFileStore opens the undo files in the given directory, creating the
+// directory if it doesn't exist.  Any undo data that was partially written is
+// rolled back.
+func openUndoFileStore(dir string) (*undoFileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &undoFileStore{
+		dir:    dir,
+		epochs: make(map[int32]*undoEpochFile),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var epochNums []int32
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, undoIndexSuffix) {
+			continue
+		}
+		epoch, err := strconv.ParseInt(strings.TrimSuffix(name, undoIndexSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		epochNums = append(epochNums, int32(epoch))
+	}
+	sort.Slice(epochNums, func(i, j int) bool { return epochNums[i] < epochNums[j] })
+
+	for _, epoch := range epochNums {
+		e, err := s.openEpoch(epoch)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		if len(e.offsets) == 0 {
+			err = s.removeEpoch(epoch, e)
+			if err != nil {
+				s.close()
+				return nil, err
+			}
+			continue
+		}
+
+		// Only the undo data that's contiguous up to the tip is of any
+		// use.  Drop everything before a gap.
+		if s.tipHeight != 0 && e.firstHeight != s.tipHeight+1 {
+			log.Infof("Dropping the undo data before height %d as "+
+				"it's not contiguous", e.firstHeight)
+			err = s.pruneEpochsBefore(epoch)
+			if err != nil {
+				s.close()
+				return nil, err
+			}
+			s.tipHeight = 0
+		}
+		s.epochs[epoch] = e
+		if s.tipHeight == 0 {
+			s.firstHeight = e.firstHeight
+		}
+		s.tipHeight = e.lastHeight()
+	}
+
+	return s, nil
+}
+
+// openEpoch opens the files of the given epoch and loads its index.  Entries
+// of the index that don't point to readable undo data are dropped.
+func (s *undoFileStore) openEpoch(epoch int32) (*undoEpochFile, error) {
+	dataFile, err := os.OpenFile(s.undoFilePath(epoch, undoDataSuffix),
+		os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	indexFile, err := os.OpenFile(s.undoFilePath(epoch, undoIndexSuffix),
+		os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		dataFile.Close()
+		return nil, err
+	}
+	e := &undoEpochFile{dataFile: dataFile, indexFile: indexFile}
+
+	dataSize, err := dataFile.Seek(0, 2)
+	if err != nil {
+		e.close()
+		return nil, err
+	}
+	e.dataSize = dataSize
+
+	index, err := os.ReadFile(indexFile.Name())
+	if err != nil {
+		e.close()
+		return nil, err
+	}
+
+	// Load every complete entry that follows the previous one and points
+	// to undo data that's fully written.
+	indexSize := int64(len(index))
+	var end int64
+	for len(index) >= undoIndexEntrySize {
+		height := int32(binary.BigEndian.Uint32(index[:4]))
+		offset := int64(binary.BigEndian.Uint64(index[4:undoIndexEntrySize]))
+		index = index[undoIndexEntrySize:]
+
+		if len(e.offsets) == 0 {
+			e.firstHeight = height
+		}
+		if height != e.firstHeight+int32(len(e.offsets)) ||
+			undoEpoch(height) != epoch || offset != end {
+			break
+		}
+		data, err := e.read(offset)
+		if err != nil {
+			break
+		}
+		e.offsets = append(e.offsets, offset)
+		end = offset + 8 + int64(len(data))
+	}
+
+	// Roll back anything past the last readable undo data.
+	if end != e.dataSize || int64(len(e.offsets))*undoIndexEntrySize != indexSize {
+		log.Infof("Recovering undo file %d as it's not consistent", epoch)
+		e.dataSize = end
+		err = dataFile.Truncate(end)
+		if err != nil {
+			e.close()
+			return nil, err
+		}
+		err = indexFile.Truncate(int64(len(e.offsets)) * undoIndexEntrySize)
+		if err != nil {
+			e.close()
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// removeEpoch closes and deletes the files of the given epoch.
+func (s *undoFileStore) removeEpoch(epoch int32, e *undoEpochFile) error {
+	err := e.close()
+	if err != nil {
+		return err
+	}
+	delete(s.epochs, epoch)
+
+	err = os.Remove(s.undoFilePath(epoch, undoDataSuffix))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(s.undoFilePath(epoch, undoIndexSuffix))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// pruneEpochsBefore deletes the files of all the epochs before the given one.
+func (s *undoFileStore) pruneEpochsBefore(epoch int32) error {
+	for num, e := range s.epochs {
+		if num >= epoch {
+			continue
+		}
+		err := s.removeEpoch(num, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store appends the undo data for the block at the given height.  The height
+// must be the next one after the tip unless the store is empty.  Storing a
+// height at or below the tip first drops the undo data from that height on,
+// which happens when the index is reconnecting blocks after an unclean
+// shutdown.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) store(height int32, data []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if height <= 0 {
+		return fmt.Errorf("can't store undo data for height %d", height)
+	}
+	if s.tipHeight != 0 && height <= s.tipHeight {
+		err := s.truncateLocked(height - 1)
+		if err != nil {
+			return err
+		}
+	}
+	if s.tipHeight != 0 && height != s.tipHeight+1 {
+		return fmt.Errorf("passed in height not the next block in sequence. "+
+			"Expected height of %d but got %d", s.tipHeight+1, height)
+	}
+
+	epoch := undoEpoch(height)
+	e, ok := s.epochs[epoch]
+	if !ok {
+		var err error
+		e, err = s.openEpoch(epoch)
+		if err != nil {
+			return err
+		}
+		e.firstHeight = height
+		s.epochs[epoch] = e
+	}
+
+	buf := make([]byte, 8+len(data))
+	copy(buf[:4], magicBytes[:])
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(data)))
+	copy(buf[8:], data)
+	_, err := e.dataFile.WriteAt(buf, e.dataSize)
+	if err != nil {
+		return err
+	}
+
+	var entry [undoIndexEntrySize]byte
+	binary.BigEndian.PutUint32(entry[:4], uint32(height))
+	binary.BigEndian.PutUint64(entry[4:], uint64(e.dataSize))
+	_, err = e.indexFile.WriteAt(entry[:], int64(len(e.offsets))*undoIndexEntrySize)
+	if err != nil {
+		return err
+	}
+
+	if s.syncWrites {
+		err = e.dataFile.Sync()
+		if err != nil {
+			return err
+		}
+		err = e.indexFile.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	e.offsets = append(e.offsets, e.dataSize)
+	e.dataSize += int64(len(buf))
+
+	if s.tipHeight == 0 {
+		s.firstHeight = height
+	}
+	s.tipHeight = height
+
+	return nil
+}
+
+// fetch returns the undo data of the block at the given height.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) fetch(height int32) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.tipHeight == 0 || height < s.firstHeight || height > s.tipHeight {
+		return nil, fmt.Errorf("no undo data for height %d", height)
+	}
+
+	e := s.epochs[undoEpoch(height)]
+	return e.read(e.offsets[height-e.firstHeight])
+}
+
+// truncate drops the undo data of all the blocks after the given height.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) truncate(height int32) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.truncateLocked(height)
+}
+
+// truncateLocked drops the undo data of all the blocks after the given height.
+//
+// This function MUST be called with the store lock held.
+func (s *undoFileStore) truncateLocked(height int32) error {
+	if s.tipHeight == 0 || height >= s.tipHeight {
+		return nil
+	}
+
+	for num, e := range s.epochs {
+		if e.firstHeight > height {
+			err := s.removeEpoch(num, e)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := e.truncate(height)
+		if err != nil {
+			return err
+		}
+	}
+
+	if height < s.firstHeight {
+		s.firstHeight, s.tipHeight = 0, 0
+	} else {
+		s.tipHeight = height
+	}
+
+	return nil
+}
+
+// prune deletes the undo files of the epochs that only have undo data for the
+// blocks before the given height.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) prune(height int32) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.tipHeight == 0 || height <= s.firstHeight {
+		return nil
+	}
+	if height > s.tipHeight {
+		height = s.tipHeight
+	}
+
+	epoch := undoEpoch(height)
+	err := s.pruneEpochsBefore(epoch)
+	if err != nil {
+		return err
+	}
+	s.firstHeight = s.epochs[epoch].firstHeight
+
+	return nil
+}
+
+// bestHeight returns the height of the last block with undo data stored.  It's
+// 0 if there's no undo data stored.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) bestHeight() int32 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.tipHeight
+}
+
+// close closes all the undo files.
+//
+// This function is safe for concurrent access.
+func (s *undoFileStore) close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var firstErr error
+	for num, e := range s.epochs {
+		err := e.close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.epochs, num)
+	}
+	return firstErr
+}
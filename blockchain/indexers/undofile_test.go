@@ -0,0 +1,151 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// undoTestData returns the undo data stored for the given height in the tests.
+func undoTestData(height int32) []byte {
+	return bytes.Repeat([]byte{byte(height)}, int(height%7)+1)
+}
+
+// checkUndoFileStore checks that the store holds the test undo data for exactly
+// the heights from first to tip.
+func checkUndoFileStore(t *testing.T, s *undoFileStore, first, tip int32) {
+	t.Helper()
+
+	if s.bestHeight() != tip {
+		t.Fatalf("expected tip %d, got %d", tip, s.bestHeight())
+	}
+	if tip == 0 {
+		return
+	}
+	for height := first; height <= tip; height++ {
+		data, err := s.fetch(height)
+		if err != nil {
+			t.Fatalf("fetch %d: %v", height, err)
+		}
+		if !bytes.Equal(data, undoTestData(height)) {
+			t.Fatalf("unexpected undo data at height %d", height)
+		}
+	}
+	if _, err := s.fetch(first - 1); err == nil {
+		t.Fatalf("expected no undo data at height %d", first-1)
+	}
+	if _, err := s.fetch(tip + 1); err == nil {
+		t.Fatalf("expected no undo data at height %d", tip+1)
+	}
+}
+
+func TestUndoFileStore(t *testing.T) {
+	t.Parallel()
+
+	tmpDir, err := os.MkdirTemp("", "undofiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dir := filepath.Join(tmpDir, undoDirName)
+	s, err := openUndoFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, 0, 0)
+
+	// Store the undo data across three epochs.
+	const first, tip = int32(100), int32(2*undoEpochBlocks + 10)
+	for height := first; height <= tip; height++ {
+		err = s.store(height, undoTestData(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkUndoFileStore(t, s, first, tip)
+
+	// Heights that leave a gap are rejected.
+	if err := s.store(tip+2, undoTestData(tip+2)); err == nil {
+		t.Fatalf("expected an error when storing past the next height")
+	}
+
+	// The undo data survives a restart.
+	err = s.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = openUndoFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, first, tip)
+
+	// Truncating into the previous epoch removes the files of the last one.
+	truncHeight := int32(2*undoEpochBlocks - 5)
+	err = s.truncate(truncHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, first, truncHeight)
+	if _, err := os.Stat(s.undoFilePath(2, undoDataSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the undo file of the truncated epoch to be removed")
+	}
+
+	// Storing a height at or below the tip replaces the undo data from
+	// that height on.  The writes are synced from here on.
+	s.syncWrites = true
+	err = s.store(truncHeight-1, undoTestData(truncHeight-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, first, truncHeight-1)
+
+	// Pruning only removes the epochs that are entirely before the height.
+	err = s.prune(undoEpochBlocks + 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, undoEpochBlocks, truncHeight-1)
+	if _, err := os.Stat(s.undoFilePath(0, undoIndexSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the undo index of the pruned epoch to be removed")
+	}
+
+	// A partially written entry is rolled back on the next open.
+	e := s.epochs[undoEpoch(truncHeight-1)]
+	_, err = e.dataFile.WriteAt([]byte{0xaa, 0xff}, e.dataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = openUndoFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, undoEpochBlocks, truncHeight-1)
+
+	// Truncating below the first height empties the store.
+	err = s.truncate(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, 0, 0)
+	err = s.store(1, undoTestData(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUndoFileStore(t, s, 1, 1)
+
+	err = s.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
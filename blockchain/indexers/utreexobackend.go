@@ -6,15 +6,18 @@ package indexers
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/database"
@@ -26,6 +29,11 @@ const (
 	// is stored.
 	utreexoDirName = "utreexostate"
 
+	// utreexoStateConsistencyLen is the length of the serialized consistency
+	// state.  It's the numleaves followed by the best hash and the hash of
+	// the roots.
+	utreexoStateConsistencyLen = 8 + chainhash.HashSize*2
+
 	// oldDefaultUtreexoFileName is the file name of the utreexo state that the num leaves
 	// used to be stored in.
 	oldDefaultUtreexoFileName = "forest.dat"
@@ -35,6 +43,10 @@ var (
 	// utreexoStateConsistencyKeyName is name of the db key used to store the consistency
 	// state for the utreexo accumulator state.
 	utreexoStateConsistencyKeyName = []byte("utreexostateconsistency")
+
+	// utreexoStateNetworkKeyName is the name of the db key used to store the
+	// network that the utreexo state was created for.
+	utreexoStateNetworkKeyName = []byte("utreexostatenetwork")
 )
 
 // UtreexoConfig is a descriptor which specifies the Utreexo state instance configuration.
@@ -42,8 +54,17 @@ type UtreexoConfig struct {
 	// MaxMemoryUsage is the desired memory usage for the utreexo state cache.
 	MaxMemoryUsage int64
 
+	// MaxNodesMemory is the desired memory usage for the cache of the
+	// accumulator nodes.  If it's 0, it's derived from MaxMemoryUsage.
+	MaxNodesMemory int64
+
+	// MaxCachedLeavesMemory is the desired memory usage for the cache of the
+	// cached leaves.  If it's 0, it's derived from MaxMemoryUsage.
+	MaxCachedLeavesMemory int64
+
 	// Params are the Bitcoin network parameters. This is used to separately store
-	// different accumulators.
+	// different accumulators and the network is recorded in the utreexo state so
+	// that the state of another network is never loaded.
 	Params *chaincfg.Params
 
 	// If the node is a pruned node or not.
@@ -60,6 +81,204 @@ type UtreexoConfig struct {
 
 	// FlushMainDB flushes the main database where all the data is stored.
 	FlushMainDB func() error
+
+	// FlushPolicy determines when the utreexo state gets flushed to disk
+	// when a flush is only done if needed.
+	FlushPolicy FlushPolicy
+
+	// CrossCheck enables the hybrid validation mode where every block is
+	// cross-checked against both the UTXO set and the utreexo accumulator.
+	CrossCheck bool
+
+	// ProofCacheSize is the maximum number of generated proofs for sets of
+	// outpoints that are kept around for repeated requests.  0 disables
+	// the cache.
+	ProofCacheSize int
+
+	// LeafTTLs makes the flat utreexo proof index keep the time to live of
+	// every leaf so that they can be fetched for each block.
+	LeafTTLs bool
+
+	// ProofPruneHeight makes the flat utreexo proof index drop the proofs
+	// and the undo data of the blocks below this height.  0 keeps them all.
+	ProofPruneHeight int32
+
+	// ProofRetention makes the flat utreexo proof index keep the proofs and
+	// the undo data of only this many blocks from the tip.  0 keeps them all.
+	ProofRetention int32
+
+	// UndoRetention makes pruned nodes keep the data used to disconnect
+	// blocks on reorgs for only this many blocks from the tip.  0 keeps it
+	// for DefaultUndoRetention blocks.
+	UndoRetention int32
+
+	// RollbackSnapshots is the number of snapshots of the accumulator that
+	// are kept to undo reorgs deeper than the data kept for undoing blocks.
+	// A snapshot is taken every UndoRetention blocks.  0 disables them.
+	RollbackSnapshots int
+
+	// RootSnapshotInterval is the number of blocks between the roots of the
+	// accumulator that are stored as root snapshots.  The roots at any
+	// other block are replayed from the last snapshot below it.  0 disables
+	// them.
+	RootSnapshotInterval int32
+
+	// SyncPolicy determines which of the writes of the utreexo proof
+	// indexes are synced to disk before they're considered done.
+	SyncPolicy SyncPolicy
+
+	// FlushBatchSize is the size in bytes the batch of nodes and cached
+	// leaves written on a flush may grow to before it's committed and a new
+	// one is started.  0 commits them all in a single batch.
+	FlushBatchSize int
+
+	// AuditLog records every modification of the accumulator to an
+	// append-only log in the directory of the utreexo state.
+	AuditLog bool
+
+	// AuditLogMaxSize is the size in bytes the audit log may grow to before
+	// it's rolled over.
+	AuditLogMaxSize int64
+
+	// CPUQuota caps the share of the CPU cores used by the background work
+	// of the utreexo proof indexes such as compacting the proofs.  nil
+	// doesn't cap it.
+	CPUQuota *CPUQuota
+
+	// CompactionWindows are the times of the day that the proofs of old
+	// blocks are dropped and the utreexo state database is compacted in.
+	// nil allows them at any time.
+	CompactionWindows []CompactionWindow
+
+	// GarbageCompactRatio is the share of the cached leaves entries in the
+	// utreexo state database that may be garbage before the database is
+	// compacted on its own.  0 disables the automatic compactions.
+	GarbageCompactRatio float64
+}
+
+// undoRetention returns the number of blocks from the tip that pruned nodes keep
+// the undo data for.
+func (c *UtreexoConfig) undoRetention() int32 {
+	if c.UndoRetention <= 0 {
+		return DefaultUndoRetention
+	}
+	return c.UndoRetention
+}
+
+// SyncPolicy describes which kinds of data written by the utreexo proof indexes
+// are fsynced to disk.  Synced writes survive a crash of the operating system
+// or a power loss while unsynced writes only survive a crash of the process but
+// are much quicker to flush.
+type SyncPolicy struct {
+	// Consistency syncs the writes of the consistency state which marks
+	// what block the utreexo state on disk is at.
+	Consistency bool
+
+	// Nodes syncs the writes of the accumulator nodes and the cached
+	// leaves.
+	Nodes bool
+
+	// Proofs syncs the writes of the proofs in the flat files of the flat
+	// utreexo proof index.  The proofs of the utreexo proof index are kept
+	// in the main database and are synced along with it.
+	Proofs bool
+
+	// Undo syncs the writes of the data used for disconnecting blocks.
+	Undo bool
+}
+
+// pebbleWriteOptions returns the write options for committing a batch that
+// should or shouldn't be synced.
+func pebbleWriteOptions(sync bool) *pebble.WriteOptions {
+	if sync {
+		return pebble.Sync
+	}
+	return pebble.NoSync
+}
+
+// memoryBudgets returns the memory budgets for the nodes cache and the cached
+// leaves cache.  Budgets that are explicitly set are used as is.  If neither are
+// set, MaxMemoryUsage is split 70/30 between the nodes and the cached leaves.  If
+// only one is set, the other one gets the remainder of MaxMemoryUsage.
+//
+// The explicitly set budgets are expected to fit within MaxMemoryUsage.  This is
+// enforced when the config is loaded.
+func (cfg *UtreexoConfig) memoryBudgets() (int64, int64) {
+	maxNodesMem := cfg.MaxNodesMemory
+	maxCachedLeavesMem := cfg.MaxCachedLeavesMemory
+
+	switch {
+	case maxNodesMem == 0 && maxCachedLeavesMem == 0:
+		maxNodesMem = cfg.MaxMemoryUsage * 7 / 10
+		maxCachedLeavesMem = cfg.MaxMemoryUsage - maxNodesMem
+	case maxNodesMem == 0:
+		maxNodesMem = cfg.MaxMemoryUsage - maxCachedLeavesMem
+	case maxCachedLeavesMem == 0:
+		maxCachedLeavesMem = cfg.MaxMemoryUsage - maxNodesMem
+	}
+
+	return maxNodesMem, maxCachedLeavesMem
+}
+
+// proofPruneHeight returns the height below which the proofs are dropped for
+// the given tip as set by the ProofPruneHeight and ProofRetention options of
+// the config.  0 is returned when none of the proofs are to be dropped.
+func (cfg *UtreexoConfig) proofPruneHeight(bestHeight int32) int32 {
+	pruneHeight := cfg.ProofPruneHeight
+	if cfg.ProofRetention > 0 {
+		retentionHeight := bestHeight - cfg.ProofRetention + 1
+		if retentionHeight > pruneHeight {
+			pruneHeight = retentionHeight
+		}
+	}
+
+	return pruneHeight
+}
+
+// FlushPolicy describes the conditions for flushing the utreexo state to disk
+// when the flush mode is blockchain.FlushIfNeeded.  Each of the conditions are
+// checked independently and a flush happens if any of them are met.  A zero
+// value for a condition disables it.
+//
+// Regardless of the policy, the utreexo state is always flushed once the caches
+// overflow as the memory usage would otherwise go over the configured limit.
+type FlushPolicy struct {
+	// BlockInterval is the number of blocks that may be processed before
+	// the utreexo state is flushed.
+	BlockInterval int32
+
+	// TimeInterval is the duration that may pass since the last flush
+	// before the utreexo state is flushed.
+	TimeInterval time.Duration
+
+	// CacheUtilization is the percentage of the cache capacity that may be
+	// used before the utreexo state is flushed.  Valid values are between
+	// 0 and 100.
+	CacheUtilization float64
+}
+
+// isFlushNeeded returns true if any of the conditions in the flush policy are
+// met given the blocks processed and the time passed since the last flush and
+// the given cache usage.
+func (fp *FlushPolicy) isFlushNeeded(blocksSinceFlush int32, sinceFlush time.Duration,
+	cacheUsed, cacheCapacity int64) bool {
+
+	if fp.BlockInterval > 0 && blocksSinceFlush >= fp.BlockInterval {
+		return true
+	}
+
+	if fp.TimeInterval > 0 && sinceFlush >= fp.TimeInterval {
+		return true
+	}
+
+	if fp.CacheUtilization > 0 && cacheCapacity > 0 {
+		utilization := float64(cacheUsed) / float64(cacheCapacity) * 100
+		if utilization >= fp.CacheUtilization {
+			return true
+		}
+	}
+
+	return false
 }
 
 // UtreexoState is a wrapper around the raw accumulator with configuration
@@ -69,27 +288,462 @@ type UtreexoState struct {
 	state          utreexo.Utreexo
 	utreexoStateDB *pebble.DB
 
-	isFlushNeeded       func() bool
-	flushLeavesAndNodes func(batch *pebble.Batch) error
+	isCacheOverflowed   func() bool
+	cacheUsageStats     func() (int64, int64)
+	flushLeavesAndNodes func(batch blockchain.UtreexoBatch, bestHash *chainhash.Hash) error
+
+	// pollardPath is the path of the pollard file that the accumulator is
+	// written to when it's kept entirely in memory.  It's empty when the
+	// accumulator is kept in the database.
+	pollardPath string
+
+	// auditLog records the modifications of the accumulator.  It's nil
+	// when the audit log isn't enabled.
+	auditLog *auditLog
+
+	// blocksSinceFlush is the count of the blocks that were connected or
+	// disconnected since the last flush.
+	blocksSinceFlush int32
+
+	// lastFlushTime is the time of when the utreexo state was last flushed.
+	lastFlushTime time.Time
+
+	// lastFlushHash is the hash of the block the utreexo state on disk is
+	// at.  It's zero when the utreexo state was never flushed.
+	lastFlushHash chainhash.Hash
+
+	// startHeight is the height the utreexo state on disk was consistent at
+	// when it was initialized, before it was caught up to the index tip.
+	startHeight int32
+
+	// cacheMetrics returns the metrics of the nodes and the cached leaves
+	// caches.
+	cacheMetrics func() (UtreexoCacheMetrics, UtreexoCacheMetrics)
+
+	// leavesGarbage keeps track of the garbage of the cached leaves in the
+	// database and compacts it away.  It's nil when the accumulator is
+	// kept in memory.
+	leavesGarbage *leavesGarbage
+
+	// flushCount, flushDuration and lastFlushDuration keep track of how
+	// many times and how long the utreexo state has been flushed for.
+	flushCount        uint64
+	flushDuration     time.Duration
+	lastFlushDuration time.Duration
+
+	// proofs caches the proofs generated for sets of leaves at the current
+	// tip.  It's purged whenever the accumulator changes.
+	proofs *proofCache
+
+	// replayedUndo is the data for undoing the blocks that's no longer kept
+	// by the index and was recovered from a rollback snapshot, keyed by the
+	// heights of the blocks.
+	replayedUndo map[int32]*replayedUndoBlock
+
+	// tip is a snapshot of the roots and the number of leaves of the
+	// accumulator along with the block they're at.  It's replaced after
+	// every modification of the accumulator so that readers that only need
+	// the current roots don't have to take the index lock and wait on block
+	// connects and flushes.
+	tip atomic.Pointer[utreexoTip]
+
+	// crossCheckStump is the stump of the hybrid validation mode.  It's
+	// only ever updated with the leaves derived from the spent outputs of
+	// the UTXO set, separately from the accumulator, so that the
+	// accumulator drifting from the UTXO set shows up as differing roots.
+	// crossCheckHash is the block the stump is at.
+	crossCheckStump utreexo.Stump
+	crossCheckHash  chainhash.Hash
+}
+
+// utreexoTip is an immutable snapshot of the accumulator roots at a block.
+type utreexoTip struct {
+	stump    utreexo.Stump
+	bestHash chainhash.Hash
+}
+
+// updateTip replaces the snapshot of the accumulator with its current roots
+// and number of leaves and drops the cached proofs that were generated against
+// the old roots.  It must be called after every modification of the accumulator
+// with the hash of the block the accumulator is now at.
+func (us *UtreexoState) updateTip(bestHash *chainhash.Hash) {
+	us.proofs.purge()
+	us.tip.Store(&utreexoTip{
+		stump: utreexo.Stump{
+			Roots:     us.state.GetRoots(),
+			NumLeaves: us.state.GetNumLeaves(),
+		},
+		bestHash: *bestHash,
+	})
+}
+
+// currentTip returns the last snapshot of the accumulator and the hash of the
+// block it's at.  The roots of the returned stump are shared and must not be
+// modified.
+//
+// This function is safe for concurrent access.
+func (us *UtreexoState) currentTip() (utreexo.Stump, chainhash.Hash) {
+	tip := us.tip.Load()
+	if tip == nil {
+		return utreexo.Stump{}, chainhash.Hash{}
+	}
+	return tip.stump, tip.bestHash
+}
+
+// prove returns a proof of the given leaf hashes against the current roots of
+// the accumulator.  Proofs are served from the cache when the same hashes were
+// already proven at the current tip.
+//
+// This function MUST be called with the index lock held for reads.
+func (us *UtreexoState) prove(hashes []utreexo.Hash) (*blockchain.ChainTipProof, error) {
+	_, bestHash := us.currentTip()
+	key := newProofCacheKey(&bestHash, hashes)
+	if proof, ok := us.proofs.get(key); ok {
+		return proof, nil
+	}
+
+	accProof, err := us.state.Prove(hashes)
+	if err != nil {
+		return nil, err
+	}
+	proof := &blockchain.ChainTipProof{
+		ProvedAtHash: &bestHash,
+		AccProof:     &accProof,
+		HashesProven: hashes,
+	}
+	us.proofs.add(key, proof)
+
+	return proof, nil
+}
+
+// currentStump returns the last snapshot of the accumulator.  The roots of the
+// returned stump are shared and must not be modified.
+//
+// This function is safe for concurrent access.
+func (us *UtreexoState) currentStump() utreexo.Stump {
+	stump, _ := us.currentTip()
+	return stump
+}
+
+// UtreexoCacheMetrics are the metrics of a single cache of the utreexo state.
+type UtreexoCacheMetrics struct {
+	// Used and Capacity are the cached elements and the total amount of
+	// elements the cache can hold.
+	Used     int64
+	Capacity int64
+
+	// Hits and Misses are the counts of the lookups that were and weren't
+	// served by the cache.
+	Hits   uint64
+	Misses uint64
+}
+
+// UtreexoStateMetrics is a snapshot of the metrics of the utreexo state that
+// are useful for monitoring a bridge node.
+type UtreexoStateMetrics struct {
+	// Nodes and CachedLeaves are the metrics of the respective caches.
+	Nodes        UtreexoCacheMetrics
+	CachedLeaves UtreexoCacheMetrics
+
+	// Proofs are the metrics of the cache of the generated proofs.
+	Proofs UtreexoCacheMetrics
+
+	// FlushCount is the amount of times the utreexo state was flushed.
+	// FlushDuration is the cumulative time spent flushing and
+	// LastFlushDuration is the time spent on the last flush.
+	FlushCount        uint64
+	FlushDuration     time.Duration
+	LastFlushDuration time.Duration
+
+	// LastFlushHash is the hash of the block the utreexo state was at when
+	// it was last flushed.  It's zero when it was never flushed.
+	LastFlushHash chainhash.Hash
+
+	// NumLeaves and NumRoots describe the accumulator.
+	NumLeaves uint64
+	NumRoots  int
+
+	// CachedLeavesGarbage is the estimate of the live and the garbage
+	// cached leaves entries in the database and GarbageCompactions is the
+	// amount of times the database was compacted because of the garbage.
+	CachedLeavesGarbage blockchain.CachedLeavesGarbage
+	GarbageCompactions  uint64
+
+	// Compactions, CompactionDuration and CompactionDebt are the compaction
+	// stats of the database backing the utreexo state.
+	Compactions        int64
+	CompactionDuration time.Duration
+	CompactionDebt     uint64
+}
+
+// metrics returns a snapshot of the metrics of the utreexo state.
+func (us *UtreexoState) metrics() UtreexoStateMetrics {
+	nodes, cachedLeaves := us.cacheMetrics()
+	dbMetrics := us.utreexoStateDB.Metrics()
+	stump := us.currentStump()
+	garbage, garbageCompactions := us.leavesGarbage.stats()
+
+	return UtreexoStateMetrics{
+		Nodes:               nodes,
+		CachedLeaves:        cachedLeaves,
+		Proofs:              us.proofs.metrics(),
+		FlushCount:          us.flushCount,
+		FlushDuration:       us.flushDuration,
+		LastFlushDuration:   us.lastFlushDuration,
+		LastFlushHash:       us.lastFlushHash,
+		NumLeaves:           stump.NumLeaves,
+		NumRoots:            len(stump.Roots),
+		CachedLeavesGarbage: garbage,
+		GarbageCompactions:  garbageCompactions,
+		Compactions:         dbMetrics.Compact.Count,
+		CompactionDuration:  dbMetrics.Compact.Duration,
+		CompactionDebt:      dbMetrics.Compact.EstimatedDebt,
+	}
+}
+
+// isFlushNeeded returns true if the utreexo state should be flushed to disk based
+// on the flush policy and the cache usage.
+func (us *UtreexoState) isFlushNeeded() bool {
+	if us.isCacheOverflowed() {
+		return true
+	}
+
+	used, capacity := us.cacheUsageStats()
+	return us.config.FlushPolicy.isFlushNeeded(us.blocksSinceFlush,
+		time.Since(us.lastFlushTime), used, capacity)
 }
 
 // flush flushes the utreexo state and all the data necessary for the utreexo state to be recoverable
 // on sudden crashes.
 func (us *UtreexoState) flush(bestHash *chainhash.Hash) error {
-	batch := us.utreexoStateDB.NewBatch()
+	start := time.Now()
+	policy := us.config.SyncPolicy
+
+	consistency, err := serializeUtreexoStateConsistency(bestHash,
+		us.state.GetNumLeaves(), us.state.GetRoots())
+	if err != nil {
+		return err
+	}
+
+	// The nodes and the cached leaves are committed in batches of at most
+	// the configured size so that a flush of a large cache isn't held in
+	// memory all at once.  The split flush is journaled first so that it
+	// can be resumed if it's interrupted.  The accumulator that's kept in
+	// memory is written to the pollard file instead and has nothing to
+	// journal.
+	batch := blockchain.NewSplitBatch(us.utreexoStateDB,
+		us.config.FlushBatchSize, pebbleWriteOptions(policy.Nodes))
+	journaled := us.config.FlushBatchSize > 0 && us.pollardPath == ""
+	var commits int
+	if journaled {
+		var count uint64
+		commits, count, err = us.journalLeavesAndNodes(bestHash, consistency)
+		if err != nil {
+			return err
+		}
+		err = applyFlushJournal(us.utreexoStateDB, batch,
+			us.config.Name, count)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = us.flushLeavesAndNodes(batch, bestHash)
+		if err != nil {
+			return err
+		}
+	}
+	commits += batch.Commits()
+
+	// The nodes and the consistency state are committed separately when
+	// they're synced differently.  The nodes are committed first so that
+	// the consistency state never points past the nodes on disk.  Since
+	// the writes are logged in order, syncing the consistency state also
+	// syncs the nodes that were committed before it.
+	if policy.Nodes != policy.Consistency {
+		err = batch.Commit()
+		if err != nil {
+			return err
+		}
+		commits++
+		batch = blockchain.NewSplitBatch(us.utreexoStateDB, 0,
+			pebbleWriteOptions(policy.Consistency))
+	}
 
 	// Write the best block hash and the numleaves for the utreexo state.
-	err := dbWriteUtreexoStateConsistency(batch, bestHash, us.state.GetNumLeaves())
+	err = batch.Set(utreexoStateConsistencyKeyName, consistency, nil)
 	if err != nil {
 		return err
 	}
+	if journaled {
+		err = batch.Delete(utreexoFlushMarkerKeyName, nil)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = us.flushLeavesAndNodes(batch)
+	err = batch.Commit()
 	if err != nil {
 		return err
 	}
+	commits++
+
+	us.blocksSinceFlush = 0
+	us.lastFlushTime = time.Now()
+
+	us.flushCount++
+	us.lastFlushDuration = us.lastFlushTime.Sub(start)
+	us.flushDuration += us.lastFlushDuration
+	us.lastFlushHash = *bestHash
+	log.Debugf("Flushed the %s utreexo state in %v with %d batch commits",
+		us.config.Name, us.lastFlushDuration, commits)
+
+	us.compactGarbageIfNeeded()
+	return nil
+}
+
+// seedCrossCheck starts the stump of the hybrid validation mode off the roots of
+// the accumulator unless the stump is already at prevHash, the parent of the
+// block about to be applied.  The stump only follows the connected blocks so
+// it's reseeded after the accumulator was loaded or undone.
+func (us *UtreexoState) seedCrossCheck(prevHash *chainhash.Hash) {
+	if us.crossCheckHash == *prevHash {
+		return
+	}
+
+	// Copy the roots as the stump is updated in place.
+	stump, bestHash := us.currentTip()
+	stump.Roots = append([]utreexo.Hash(nil), stump.Roots...)
+	us.crossCheckStump, us.crossCheckHash = stump, bestHash
+}
+
+// crossCheck checks the block applied to the accumulator against the UTXO set.
+// The leaves it spends are derived from the spent outputs and must be proven
+// against the stump kept separately from the accumulator, which must then be
+// at the roots of the stump updated with the block.  seedCrossCheck must be
+// called before the block is applied to the accumulator.
+//
+// A returned error means that the UTXO set and the utreexo accumulator have
+// diverged.
+func (us *UtreexoState) crossCheck(block *btcutil.Block, stxos []blockchain.SpentTxOut,
+	chain *blockchain.BlockChain, adds []utreexo.Leaf, proof utreexo.Proof) error {
+
+	// Reseed the stump for the next block if it fails the check.
+	us.crossCheckHash = chainhash.Hash{}
+
+	delHashes, err := stxoLeafHashes(block, stxos, chain)
+	if err != nil {
+		return err
+	}
+	err = crossCheckUtreexoState(block, &us.crossCheckStump, adds,
+		delHashes, proof, us.state)
+	if err != nil {
+		return err
+	}
+	us.crossCheckHash = *block.Hash()
+
+	return nil
+}
+
+// stxoLeafHashes returns the hashes of the leaves spent by the block in the
+// order of its inputs, derived straight from the spent outputs of the UTXO set.
+// The outputs created and spent within the block are skipped as they're never
+// added to the accumulator.
+func stxoLeafHashes(block *btcutil.Block, stxos []blockchain.SpentTxOut,
+	chain *blockchain.BlockChain) ([]utreexo.Hash, error) {
+
+	_, _, inskip, _ := blockchain.DedupeBlock(block)
+
+	var delHashes []utreexo.Hash
+	var inIdx uint32
+	stxoIdx := 0
+	for txIdx, tx := range block.Transactions() {
+		if txIdx == 0 {
+			inIdx += uint32(len(tx.MsgTx().TxIn))
+			continue
+		}
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			if stxoIdx >= len(stxos) {
+				return nil, fmt.Errorf("block %v(%d) spends more "+
+					"than the %d spent outputs", block.Hash(),
+					block.Height(), len(stxos))
+			}
+			stxo := stxos[stxoIdx]
+			stxoIdx++
+
+			if len(inskip) > 0 && inskip[0] == inIdx {
+				inskip = inskip[1:]
+				inIdx++
+				continue
+			}
+			inIdx++
+
+			blockHash, err := chain.BlockHashByHeight(stxo.Height)
+			if err != nil {
+				return nil, err
+			}
+			ld := wire.LeafData{
+				BlockHash:  *blockHash,
+				OutPoint:   txIn.PreviousOutPoint,
+				Amount:     stxo.Amount,
+				PkScript:   stxo.PkScript,
+				Height:     stxo.Height,
+				IsCoinBase: stxo.IsCoinBase,
+			}
+			delHashes = append(delHashes, ld.LeafHash())
+		}
+	}
+	if stxoIdx != len(stxos) {
+		return nil, fmt.Errorf("block %v(%d) spends %d outputs but "+
+			"there are %d spent outputs", block.Hash(), block.Height(),
+			stxoIdx, len(stxos))
+	}
 
-	return batch.Commit(nil)
+	return delHashes, nil
+}
+
+// crossCheckUtreexoState checks that the deletions derived from the UTXO set are
+// proven against the stump, updates the stump with the block and checks that
+// the roots of the modified utreexo state match the ones of the stump.  The
+// stump must be kept separately from the utreexo state and be at the roots
+// before the block was applied.
+//
+// A returned error means that the UTXO set and the utreexo accumulator have
+// diverged.
+func crossCheckUtreexoState(block *btcutil.Block, stump *utreexo.Stump,
+	adds []utreexo.Leaf, delHashes []utreexo.Hash, proof utreexo.Proof,
+	state utreexo.Utreexo) error {
+
+	_, err := utreexo.Verify(*stump, delHashes, proof)
+	if err != nil {
+		return fmt.Errorf("utreexo state diverged from the UTXO set at "+
+			"block %v(%d). The spent outputs in the UTXO set are not "+
+			"proven by the accumulator: %v", block.Hash(), block.Height(), err)
+	}
+
+	addHashes := make([]utreexo.Hash, len(adds))
+	for i, add := range adds {
+		addHashes[i] = add.Hash
+	}
+	_, err = stump.Update(delHashes, addHashes, proof)
+	if err != nil {
+		return fmt.Errorf("utreexo state diverged from the UTXO set at "+
+			"block %v(%d). Couldn't update the stump: %v",
+			block.Hash(), block.Height(), err)
+	}
+
+	accStump := utreexo.Stump{Roots: state.GetRoots(), NumLeaves: state.GetNumLeaves()}
+	rootsMatch := len(accStump.Roots) == len(stump.Roots)
+	for i := 0; rootsMatch && i < len(accStump.Roots); i++ {
+		rootsMatch = accStump.Roots[i] == stump.Roots[i]
+	}
+	if !rootsMatch || accStump.NumLeaves != stump.NumLeaves {
+		return fmt.Errorf("utreexo state diverged from the UTXO set at "+
+			"block %v(%d). Accumulator is at %s but expected %s",
+			block.Hash(), block.Height(), accStump.String(), stump.String())
+	}
+
+	return nil
 }
 
 // utreexoBasePath returns the base path of where the utreexo state should be
@@ -121,50 +775,180 @@ func checkUtreexoExists(cfg *UtreexoConfig, basePath string) bool {
 	return true
 }
 
+// utreexoRootsHash returns the hash of the serialized roots and number of
+// leaves of an accumulator.
+func utreexoRootsHash(numLeaves uint64, roots []utreexo.Hash) (chainhash.Hash, error) {
+	serialized, err := blockchain.SerializeUtreexoRoots(numLeaves, roots)
+	if err != nil {
+		return chainhash.Hash{}, err
+	}
+	return sha256.Sum256(serialized), nil
+}
+
 // dbWriteUtreexoStateConsistency writes the consistency state to the database using the given transaction.
-func dbWriteUtreexoStateConsistency(batch *pebble.Batch, bestHash *chainhash.Hash, numLeaves uint64) error {
-	// Create the byte slice to be written.
-	var buf [8 + chainhash.HashSize]byte
+// Along with the best hash and the numleaves, a hash of the roots is written so that a partially flushed
+// accumulator is caught when it's loaded.
+func dbWriteUtreexoStateConsistency(batch blockchain.UtreexoBatch, bestHash *chainhash.Hash,
+	numLeaves uint64, roots []utreexo.Hash) error {
+
+	buf, err := serializeUtreexoStateConsistency(bestHash, numLeaves, roots)
+	if err != nil {
+		return err
+	}
+
+	return batch.Set(utreexoStateConsistencyKeyName, buf, nil)
+}
+
+// serializeUtreexoStateConsistency returns the consistency state as it's stored
+// in the database.
+func serializeUtreexoStateConsistency(bestHash *chainhash.Hash, numLeaves uint64,
+	roots []utreexo.Hash) ([]byte, error) {
+
+	rootsHash, err := utreexoRootsHash(numLeaves, roots)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, utreexoStateConsistencyLen)
 	binary.LittleEndian.PutUint64(buf[:8], numLeaves)
 	copy(buf[8:], bestHash[:])
+	copy(buf[8+chainhash.HashSize:], rootsHash[:])
 
-	return batch.Set(utreexoStateConsistencyKeyName, buf[:], nil)
+	return buf, nil
 }
 
-// dbFetchUtreexoStateConsistency returns the stored besthash and the numleaves in the database.
-func dbFetchUtreexoStateConsistency(db *pebble.DB) (*chainhash.Hash, uint64, error) {
+// dbFetchUtreexoStateConsistency returns the stored besthash, the numleaves and the hash of the roots
+// in the database.  The hash of the roots is nil if the consistency state was written before it was
+// included.
+func dbFetchUtreexoStateConsistency(db *pebble.DB) (*chainhash.Hash, uint64, *chainhash.Hash, error) {
 	buf, closer, err := db.Get(utreexoStateConsistencyKeyName)
 	if err != nil && err != pebble.ErrNotFound {
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 	// Set error to nil as the error may have been ErrNotFound.
 	err = nil
 	if buf == nil {
-		return nil, 0, nil
+		return nil, 0, nil, nil
 	}
 	defer closer.Close()
 
-	bestHash, err := chainhash.NewHash(buf[8:])
+	bestHash, err := chainhash.NewHash(buf[8 : 8+chainhash.HashSize])
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 
-	return bestHash, binary.LittleEndian.Uint64(buf[:8]), nil
+	var rootsHash *chainhash.Hash
+	if len(buf) >= 8+chainhash.HashSize*2 {
+		rootsHash, err = chainhash.NewHash(buf[8+chainhash.HashSize : 8+chainhash.HashSize*2])
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	return bestHash, binary.LittleEndian.Uint64(buf[:8]), rootsHash, nil
 }
 
-// FetchUtreexoState returns the utreexo state at the desired block.
-func (idx *UtreexoProofIndex) FetchUtreexoState(dbTx database.Tx, blockHash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
-	stump, err := dbFetchUtreexoState(dbTx, blockHash)
-	if err != nil {
-		return nil, 0, err
+// serializeUtreexoStateNetwork returns the serialized network of the given
+// params.  It's the hash of the genesis block followed by the name of the
+// network.
+func serializeUtreexoStateNetwork(params *chaincfg.Params) []byte {
+	buf := make([]byte, chainhash.HashSize+len(params.Name))
+	copy(buf, params.GenesisHash[:])
+	copy(buf[chainhash.HashSize:], params.Name)
+	return buf
+}
+
+// verifyUtreexoStateNetwork returns an error if the serialized network doesn't
+// match the given params.
+func verifyUtreexoStateNetwork(buf []byte, path string, params *chaincfg.Params) error {
+	if len(buf) < chainhash.HashSize {
+		return fmt.Errorf("the network of the utreexo state at %s is "+
+			"corrupt. The utreexo state should be dropped and reindexed",
+			path)
 	}
 
+	var genesisHash chainhash.Hash
+	copy(genesisHash[:], buf[:chainhash.HashSize])
+	name := string(buf[chainhash.HashSize:])
+	if genesisHash != *params.GenesisHash || name != params.Name {
+		return fmt.Errorf("the utreexo state at %s was created for the "+
+			"%s network (genesis %v) but the node is running on the %s "+
+			"network (genesis %v). Check that the data directory "+
+			"belongs to the %s network", path, name, genesisHash,
+			params.Name, params.GenesisHash, params.Name)
+	}
+
+	return nil
+}
+
+// checkUtreexoStateNetwork makes sure that the utreexo state in the database
+// was created for the network of the given params.  The network is stored
+// if it's not in the database yet, which is the case for new utreexo states
+// and for ones created before the network was stored, unless the database is
+// opened read only.
+func checkUtreexoStateNetwork(db *pebble.DB, path string, params *chaincfg.Params,
+	readOnly bool) error {
+
+	if params == nil {
+		return nil
+	}
+
+	buf, closer, err := db.Get(utreexoStateNetworkKeyName)
+	if err != nil && err != pebble.ErrNotFound {
+		return err
+	}
+	if buf == nil {
+		if readOnly {
+			return nil
+		}
+		return db.Set(utreexoStateNetworkKeyName,
+			serializeUtreexoStateNetwork(params), pebble.Sync)
+	}
+	defer closer.Close()
+
+	return verifyUtreexoStateNetwork(buf, path, params)
+}
+
+// stumpToChainhashRoots returns the roots of the stump as chainhashes.
+func stumpToChainhashRoots(stump utreexo.Stump) []*chainhash.Hash {
 	chainhashRoots := make([]*chainhash.Hash, len(stump.Roots))
 	for i, root := range stump.Roots {
 		newRoot := chainhash.Hash(root)
 		chainhashRoots[i] = &newRoot
 	}
-	return chainhashRoots, stump.NumLeaves, nil
+	return chainhashRoots
+}
+
+// FetchCurrentUtreexoState returns the roots and the number of leaves of the
+// accumulator at the tip of the index along with the hash of that block.  It
+// doesn't take the index lock so it never blocks on block connects or flushes
+// of the utreexo state.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoProofIndex) FetchCurrentUtreexoState() ([]*chainhash.Hash, uint64, chainhash.Hash) {
+	stump, bestHash := idx.utreexoState.currentTip()
+	return stumpToChainhashRoots(stump), stump.NumLeaves, bestHash
+}
+
+// FetchCurrentUtreexoState returns the roots and the number of leaves of the
+// accumulator at the tip of the index along with the hash of that block.  It
+// doesn't take the index lock so it never blocks on block connects or flushes
+// of the utreexo state.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) FetchCurrentUtreexoState() ([]*chainhash.Hash, uint64, chainhash.Hash) {
+	stump, bestHash := idx.utreexoState.currentTip()
+	return stumpToChainhashRoots(stump), stump.NumLeaves, bestHash
+}
+
+// FetchUtreexoState returns the utreexo state at the desired block.
+func (idx *UtreexoProofIndex) FetchUtreexoState(dbTx database.Tx, blockHash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
+	stump, err := dbFetchUtreexoState(dbTx, blockHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return stumpToChainhashRoots(stump), stump.NumLeaves, nil
 }
 
 // FetchUtreexoState returns the utreexo state at the desired block.
@@ -174,12 +958,7 @@ func (idx *FlatUtreexoProofIndex) FetchUtreexoState(blockHeight int32) ([]*chain
 		return nil, 0, err
 	}
 
-	chainhashRoots := make([]*chainhash.Hash, len(stump.Roots))
-	for i, root := range stump.Roots {
-		newRoot := chainhash.Hash(root)
-		chainhashRoots[i] = &newRoot
-	}
-	return chainhashRoots, stump.NumLeaves, nil
+	return stumpToChainhashRoots(stump), stump.NumLeaves, nil
 }
 
 // Flush flushes the utreexo state. The different modes pass in as an argument determine if the utreexo state
@@ -194,7 +973,7 @@ func (idx *UtreexoProofIndex) Flush(bestHash *chainhash.Hash, mode blockchain.Fl
 	switch mode {
 	case blockchain.FlushPeriodic:
 		// If the time since the last flush less then the interval, just return.
-		if time.Since(idx.lastFlushTime) < blockchain.UtxoFlushPeriodicInterval {
+		if time.Since(idx.utreexoState.lastFlushTime) < blockchain.UtxoFlushPeriodicInterval {
 			return nil
 		}
 	case blockchain.FlushIfNeeded:
@@ -225,9 +1004,17 @@ func (idx *UtreexoProofIndex) Flush(bestHash *chainhash.Hash, mode blockchain.Fl
 		return err
 	}
 
-	// Set the last flush time as now as the flush was successful.
-	idx.lastFlushTime = time.Now()
-	return nil
+	return idx.storeRollbackSnapshot()
+}
+
+// UtreexoStateMetrics returns a snapshot of the metrics of the utreexo state.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoProofIndex) UtreexoStateMetrics() UtreexoStateMetrics {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.metrics()
 }
 
 // FlushUtreexoState saves the utreexo state to disk.
@@ -239,13 +1026,32 @@ func (idx *UtreexoProofIndex) flushUtreexoState(bestHash *chainhash.Hash) error
 	return idx.utreexoState.flush(bestHash)
 }
 
+// storeRollbackSnapshot writes the utreexo state to a rollback snapshot if it's
+// time for a new one.
+func (idx *UtreexoProofIndex) storeRollbackSnapshot() error {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.maybeStoreRollbackSnapshot(idx.chain)
+}
+
 // CloseUtreexoState flushes and closes the utreexo database state.
 func (idx *UtreexoProofIndex) CloseUtreexoState() error {
-	bestHash := idx.chain.BestSnapshot().Hash
+	// The accumulator is behind the main chain while the index is being
+	// caught up in the background so flush it at the block it's at.
+	_, bestHash := idx.utreexoState.currentTip()
 	err := idx.flushUtreexoState(&bestHash)
 	if err != nil {
 		log.Warnf("error whiling flushing the utreexo state. %v", err)
 	}
+	if idx.undoFiles != nil {
+		err = idx.undoFiles.close()
+		if err != nil {
+			log.Warnf("error while closing the undo files. %v", err)
+		}
+	}
+	idx.utreexoState.leavesGarbage.stop()
+	idx.utreexoState.closeAuditLog()
 	return idx.utreexoState.utreexoStateDB.Close()
 }
 
@@ -261,7 +1067,7 @@ func (idx *FlatUtreexoProofIndex) Flush(bestHash *chainhash.Hash, mode blockchai
 	switch mode {
 	case blockchain.FlushPeriodic:
 		// If the time since the last flush less then the interval, just return.
-		if time.Since(idx.lastFlushTime) < blockchain.UtxoFlushPeriodicInterval {
+		if time.Since(idx.utreexoState.lastFlushTime) < blockchain.UtxoFlushPeriodicInterval {
 			return nil
 		}
 	case blockchain.FlushIfNeeded:
@@ -272,6 +1078,13 @@ func (idx *FlatUtreexoProofIndex) Flush(bestHash *chainhash.Hash, mode blockchai
 		// Purposely left empty.
 	}
 
+	// The utreexo state is only caught up from where it was flushed so the
+	// proofs of the blocks before it have to be in the flat files first.
+	err := idx.waitForProofs()
+	if err != nil {
+		return err
+	}
+
 	if onConnect {
 		// Flush the main database first. This is because the block and other data may still
 		// be in the database cache. If we flush the utreexo state before, there's no way to
@@ -282,19 +1095,33 @@ func (idx *FlatUtreexoProofIndex) Flush(bestHash *chainhash.Hash, mode blockchai
 		// This is different from on disconnect as you want the utreexo state to be flushed
 		// first as the utreexo state can always catch up to the main db tip but can't undo
 		// without the main database data.
-		err := idx.config.FlushMainDB()
+		err = idx.config.FlushMainDB()
 		if err != nil {
 			return err
 		}
 	}
-	err := idx.flushUtreexoState(bestHash)
+	err = idx.flushUtreexoState(bestHash)
 	if err != nil {
 		return err
 	}
 
-	// Set the last flush time as now as the flush was successful.
-	idx.lastFlushTime = time.Now()
-	return nil
+	err = idx.storeRollbackSnapshot()
+	if err != nil {
+		return err
+	}
+
+	// Drop the proofs below the prune height as the tip moves along.
+	return idx.maybeCompactProofs()
+}
+
+// UtreexoStateMetrics returns a snapshot of the metrics of the utreexo state.
+//
+// This function is safe for concurrent access.
+func (idx *FlatUtreexoProofIndex) UtreexoStateMetrics() UtreexoStateMetrics {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.metrics()
 }
 
 // FlushUtreexoState saves the utreexo state to disk.
@@ -306,13 +1133,28 @@ func (idx *FlatUtreexoProofIndex) flushUtreexoState(bestHash *chainhash.Hash) er
 	return idx.utreexoState.flush(bestHash)
 }
 
+// storeRollbackSnapshot writes the utreexo state to a rollback snapshot if it's
+// time for a new one.
+func (idx *FlatUtreexoProofIndex) storeRollbackSnapshot() error {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.maybeStoreRollbackSnapshot(idx.chain)
+}
+
 // CloseUtreexoState flushes and closes the utreexo database state.
 func (idx *FlatUtreexoProofIndex) CloseUtreexoState() error {
-	bestHash := idx.chain.BestSnapshot().Hash
+	// Write out the queued proofs before the state is flushed.
+	idx.stopProofWriter()
+
+	// Flush at the block the accumulator is at as it may be behind.
+	_, bestHash := idx.utreexoState.currentTip()
 	err := idx.flushUtreexoState(&bestHash)
 	if err != nil {
 		log.Warnf("error whiling flushing the utreexo state. %v", err)
 	}
+	idx.utreexoState.leavesGarbage.stop()
+	idx.utreexoState.closeAuditLog()
 	return idx.utreexoState.utreexoStateDB.Close()
 }
 
@@ -430,9 +1272,28 @@ func deserializeUndoBlock(serialized []byte) (uint64, []uint64, []utreexo.Hash,
 	return numAdds, targets, delHashes, nil
 }
 
+// DeserializeUndoBlock deserializes an undo block as it's stored by the utreexo
+// proof indexes.  It returns the number of leaves the block added along with the
+// targets and the hashes of the leaves the block deleted.
+func DeserializeUndoBlock(serialized []byte) (uint64, []uint64, []utreexo.Hash, error) {
+	return deserializeUndoBlock(serialized)
+}
+
+// rollBackDataFunc returns the data needed to undo the block from the utreexo
+// state along with the roots of the accumulator before the block.
+type rollBackDataFunc func(block *btcutil.Block) (uint64, []uint64,
+	[]utreexo.Hash, utreexo.Stump, error)
+
 // initConsistentUtreexoState makes the utreexo state consistent with the given tipHash.
+// replayed, if not nil, is called with the proof of every block that's attached
+// to the utreexo state to catch it up.  rollBack, if not nil, returns the data
+// to undo the blocks of a utreexo state that was flushed past the tip.
 func (us *UtreexoState) initConsistentUtreexoState(chain *blockchain.BlockChain,
-	savedHash, tipHash *chainhash.Hash, tipHeight int32) error {
+	savedHash, tipHash *chainhash.Hash, tipHeight int32,
+	replayed func(*btcutil.Block, *wire.UData) error,
+	rollBack rollBackDataFunc) error {
+
+	us.startHeight = tipHeight
 
 	// This is a new accumulator state that we're working with.
 	var empty chainhash.Hash
@@ -461,15 +1322,21 @@ func (us *UtreexoState) initConsistentUtreexoState(chain *blockchain.BlockChain,
 		}
 
 		if currentHeight > tipHeight {
-			return fmt.Errorf("Saved besthash has a heigher height "+
-				"of %v than tip height of %v. The utreexo state is NOT "+
-				"recoverable and should be dropped and reindexed",
-				currentHeight, tipHeight)
+			if rollBack == nil {
+				return fmt.Errorf("Saved besthash has a heigher height "+
+					"of %v than tip height of %v. The utreexo state is NOT "+
+					"recoverable and should be dropped and reindexed",
+					currentHeight, tipHeight)
+			}
+			us.startHeight = currentHeight
+			return us.rollBackToTip(chain, currentHeight, tipHash,
+				tipHeight, rollBack)
 		}
 	} else {
 		// Mark it as an empty hash for logging below.
 		savedHash = new(chainhash.Hash)
 	}
+	us.startHeight = currentHeight
 
 	log.Infof("Reconstructing the Utreexo state after an unclean shutdown. The Utreexo state is "+
 		"consistent at block %s (%d) but the index tip is at block %s (%d),  This may "+
@@ -486,25 +1353,21 @@ func (us *UtreexoState) initConsistentUtreexoState(chain *blockchain.BlockChain,
 			return err
 		}
 
-		_, outCount, inskip, outskip := blockchain.DedupeBlock(block)
-		dels, err := blockchain.BlockToDelLeaves(stxos, chain, block, inskip)
-		if err != nil {
-			return err
-		}
-		adds := blockchain.BlockToAddLeaves(block, outskip, nil, outCount)
-
-		ud, err := wire.GenerateUData(dels, us.state)
+		adds, delHashes, ud, err := attachReplayedBlock(chain, us.state,
+			block, stxos)
 		if err != nil {
 			return err
 		}
-		delHashes := make([]utreexo.Hash, len(ud.LeafDatas))
-		for i := range delHashes {
-			delHashes[i] = ud.LeafDatas[i].LeafHash()
-		}
+		us.blocksSinceFlush++
+		us.updateTip(block.Hash())
+		us.audit(auditOpModify, h, block.Hash(), uint64(len(adds)), adds,
+			delHashes, ud.AccProof.Targets)
 
-		err = us.state.Modify(adds, delHashes, ud.AccProof)
-		if err != nil {
-			return err
+		if replayed != nil {
+			err = replayed(block, ud)
+			if err != nil {
+				return err
+			}
 		}
 
 		if us.isFlushNeeded() {
@@ -519,20 +1382,103 @@ func (us *UtreexoState) initConsistentUtreexoState(chain *blockchain.BlockChain,
 	return nil
 }
 
+// rollBackToTip undoes the blocks past the tip from a utreexo state that's
+// consistent at currentHeight.  The utreexo state is flushed past the index tip
+// when the node shuts down after the flush but before the index tip is written.
+// The index is then caught up from its tip again like any other lagging index.
+func (us *UtreexoState) rollBackToTip(chain *blockchain.BlockChain,
+	currentHeight int32, tipHash *chainhash.Hash, tipHeight int32,
+	rollBack rollBackDataFunc) error {
+
+	log.Infof("Rolling back the Utreexo state after an unclean shutdown. The Utreexo state is "+
+		"consistent at height %d but the index tip is at block %s (%d)",
+		currentHeight, tipHash.String(), tipHeight)
+
+	for h := currentHeight; h > tipHeight; h-- {
+		block, err := chain.BlockByHeight(h)
+		if err != nil {
+			return err
+		}
+
+		numAdds, targets, delHashes, prevStump, err := rollBack(block)
+		if err != nil {
+			return fmt.Errorf("unable to undo block %s (%d) from the "+
+				"utreexo state: %v. The utreexo state is NOT recoverable "+
+				"and should be dropped and reindexed", block.Hash(), h, err)
+		}
+		err = us.state.Undo(numAdds, utreexo.Proof{Targets: targets},
+			delHashes, prevStump.Roots)
+		if err != nil {
+			return err
+		}
+		us.blocksSinceFlush++
+		us.updateTip(&block.MsgBlock().Header.PrevBlock)
+		us.audit(auditOpUndo, h, block.Hash(), numAdds, nil, delHashes,
+			targets)
+
+		err = us.dropRollbackSnapshots(h)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Flush right away so that the utreexo state is never found past the
+	// index tip again.
+	return us.flush(tipHash)
+}
+
+// attachReplayedBlock generates the proof of the given block against the
+// accumulator from the outputs the block spends and attaches the block to the
+// accumulator.  It returns the leaves the block added along with the hashes of
+// the leaves it deleted and the generated proof.
+func attachReplayedBlock(chain *blockchain.BlockChain, p utreexo.Utreexo,
+	block *btcutil.Block, stxos []blockchain.SpentTxOut) (
+	[]utreexo.Leaf, []utreexo.Hash, *wire.UData, error) {
+
+	_, outCount, inskip, outskip := blockchain.DedupeBlock(block)
+	dels, err := blockchain.BlockToDelLeaves(stxos, chain, block, inskip)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adds := blockchain.BlockToAddLeaves(block, outskip, nil, outCount)
+
+	ud, err := wire.GenerateUData(dels, p)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	delHashes := make([]utreexo.Hash, len(ud.LeafDatas))
+	for i := range delHashes {
+		delHashes[i] = ud.LeafDatas[i].LeafHash()
+	}
+
+	err = p.Modify(adds, delHashes, ud.AccProof)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return adds, delHashes, ud, nil
+}
+
 // InitUtreexoState returns an initialized utreexo state. If there isn't an
 // existing state on disk, it creates one and returns it.
-// maxMemoryUsage of 0 will keep every element on disk. A negaive maxMemoryUsage will
-// load every element to the memory.
+// maxMemoryUsage of 0 will keep every element on disk. A negative maxMemoryUsage will
+// keep every element in memory and write them to the pollard file instead of the
+// database.  replayed, if not nil, is called with the
+// proof of every block that's attached to catch the state up to the tip.
+// rollBack, if not nil, returns the data to undo the blocks of a state that was
+// flushed past the tip so that it's rolled back to the tip.  Otherwise such a
+// state can't be recovered.
 func InitUtreexoState(cfg *UtreexoConfig, chain *blockchain.BlockChain,
-	tipHash *chainhash.Hash, tipHeight int32) (*UtreexoState, error) {
+	tipHash *chainhash.Hash, tipHeight int32,
+	replayed func(*btcutil.Block, *wire.UData) error,
+	rollBack rollBackDataFunc) (*UtreexoState, error) {
 
 	log.Infof("Initializing Utreexo state from '%s'", utreexoBasePath(cfg))
 	defer log.Info("Utreexo state loaded")
 
-	p := utreexo.NewMapPollard(true)
-
-	maxNodesMem := cfg.MaxMemoryUsage * 7 / 10
-	maxCachedLeavesMem := cfg.MaxMemoryUsage - maxNodesMem
+	maxNodesMem, maxCachedLeavesMem := cfg.memoryBudgets()
+	log.Debugf("Utreexo state memory budgets: nodes %d bytes, cached leaves %d bytes",
+		maxNodesMem, maxCachedLeavesMem)
 
 	cache := pebble.NewCache(128 << 20) // 128MB cache
 	db, err := pebble.Open(utreexoBasePath(cfg), &pebble.Options{
@@ -543,6 +1489,44 @@ func InitUtreexoState(cfg *UtreexoConfig, chain *blockchain.BlockChain,
 		return nil, err
 	}
 
+	// Refuse to load an accumulator of another network as connecting blocks
+	// to it would silently corrupt it.
+	err = checkUtreexoStateNetwork(db, utreexoBasePath(cfg), cfg.Params, false)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Finish a flush that was interrupted before the state is loaded as the
+	// nodes on disk are only consistent once it's done.
+	err = resumeUtreexoFlush(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if cfg.MaxMemoryUsage < 0 {
+		uState, err := initInMemoryUtreexoState(cfg, db, chain, tipHash,
+			tipHeight, replayed, rollBack)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return uState, nil
+	}
+
+	// The nodes in the database are stale once the accumulator was kept in
+	// memory.
+	if _, err := os.Stat(pollardFilePath(cfg)); err == nil {
+		db.Close()
+		return nil, fmt.Errorf("the utreexo state at %s was kept in "+
+			"memory and has to be loaded with a negative maximum memory "+
+			"usage. Otherwise it should be dropped and reindexed",
+			utreexoBasePath(cfg))
+	}
+
+	p := utreexo.NewMapPollard(true)
+
 	nodesDB, err := blockchain.InitNodesBackEnd(db, maxNodesMem)
 	if err != nil {
 		return nil, err
@@ -553,7 +1537,7 @@ func InitUtreexoState(cfg *UtreexoConfig, chain *blockchain.BlockChain,
 		return nil, err
 	}
 
-	savedHash, numLeaves, err := dbFetchUtreexoStateConsistency(db)
+	savedHash, numLeaves, rootsHash, err := dbFetchUtreexoStateConsistency(db)
 	if err != nil {
 		return nil, err
 	}
@@ -561,7 +1545,23 @@ func InitUtreexoState(cfg *UtreexoConfig, chain *blockchain.BlockChain,
 
 	p.Nodes = nodesDB
 	p.CachedLeaves = cachedLeavesDB
-	flush := func(batch *pebble.Batch) error {
+
+	// Make sure that the stored nodes reproduce the roots that were
+	// committed to on the last flush.  They won't if the flush only
+	// partially made it to disk.
+	if rootsHash != nil {
+		gotHash, err := utreexoRootsHash(p.NumLeaves, p.GetRoots())
+		if err != nil {
+			return nil, err
+		}
+		if gotHash != *rootsHash {
+			return nil, fmt.Errorf("the utreexo state roots don't match "+
+				"the roots flushed at block %s. The utreexo state is "+
+				"NOT recoverable and should be dropped and reindexed",
+				savedHash)
+		}
+	}
+	flush := func(batch blockchain.UtreexoBatch, _ *chainhash.Hash) error {
 		nodesUsed, nodesCapacity := nodesDB.UsageStats()
 		log.Debugf("Utreexo index nodesDB cache usage: %d/%d (%v%%)\n",
 			nodesUsed, nodesCapacity,
@@ -583,25 +1583,60 @@ func InitUtreexoState(cfg *UtreexoConfig, chain *blockchain.BlockChain,
 
 		return nil
 	}
-	isFlushNeeded := func() bool {
+	isCacheOverflowed := func() bool {
 		nodesNeedsFlush := nodesDB.IsFlushNeeded()
 		leavesNeedsFlush := cachedLeavesDB.IsFlushNeeded()
 		return nodesNeedsFlush || leavesNeedsFlush
 	}
+	// The cache usage is reported as the utilization of whichever cache is
+	// fuller so that the flush policy triggers before either overflows.
+	cacheUsageStats := func() (int64, int64) {
+		nodesUsed, nodesCapacity := nodesDB.UsageStats()
+		leavesUsed, leavesCapacity := cachedLeavesDB.UsageStats()
+		if nodesUsed*leavesCapacity >= leavesUsed*nodesCapacity {
+			return nodesUsed, nodesCapacity
+		}
+		return leavesUsed, leavesCapacity
+	}
+
+	cacheMetrics := func() (UtreexoCacheMetrics, UtreexoCacheMetrics) {
+		var nodes, leaves UtreexoCacheMetrics
+		nodes.Used, nodes.Capacity = nodesDB.UsageStats()
+		nodes.Hits, nodes.Misses = nodesDB.CacheStats()
+		leaves.Used, leaves.Capacity = cachedLeavesDB.UsageStats()
+		leaves.Hits, leaves.Misses = cachedLeavesDB.CacheStats()
+		return nodes, leaves
+	}
+
+	audit, err := openAuditLog(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	uState := &UtreexoState{
 		config:              cfg,
 		state:               &p,
 		utreexoStateDB:      db,
-		isFlushNeeded:       isFlushNeeded,
+		auditLog:            audit,
+		isCacheOverflowed:   isCacheOverflowed,
+		cacheUsageStats:     cacheUsageStats,
 		flushLeavesAndNodes: flush,
+		lastFlushTime:       time.Now(),
+		cacheMetrics:        cacheMetrics,
+		leavesGarbage:       newLeavesGarbage(cachedLeavesDB),
+		proofs:              newProofCache(cfg.ProofCacheSize),
+	}
+	if savedHash != nil {
+		uState.lastFlushHash = *savedHash
 	}
 
 	// Make sure that the utreexo state is consistent before returning it.
-	err = uState.initConsistentUtreexoState(chain, savedHash, tipHash, tipHeight)
+	err = uState.initConsistentUtreexoState(chain, savedHash, tipHash,
+		tipHeight, replayed, rollBack)
 	if err != nil {
 		return nil, err
 	}
+	uState.updateTip(tipHash)
 
 	return uState, err
 }
@@ -7,10 +7,15 @@ package indexers
 import (
 	"math/rand"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/pebble"
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/btcutil"
 	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
 )
 
 func TestUtreexoStateConsistencyWrite(t *testing.T) {
@@ -24,9 +29,10 @@ func TestUtreexoStateConsistencyWrite(t *testing.T) {
 	// Values to write.
 	numLeaves := rand.Uint64()
 	hash := chaincfg.MainNetParams.GenesisHash
+	roots := []utreexo.Hash{{1}, {2}}
 
 	batch := db.NewBatch()
-	err = dbWriteUtreexoStateConsistency(batch, hash, numLeaves)
+	err = dbWriteUtreexoStateConsistency(batch, hash, numLeaves, roots)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,10 +42,17 @@ func TestUtreexoStateConsistencyWrite(t *testing.T) {
 	}
 
 	// Fetch the consistency state.
-	gotHash, gotNumLeaves, err := dbFetchUtreexoStateConsistency(db)
+	gotHash, gotNumLeaves, gotRootsHash, err := dbFetchUtreexoStateConsistency(db)
 	if err != nil {
 		t.Fatal(err)
 	}
+	rootsHash, err := utreexoRootsHash(numLeaves, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotRootsHash == nil || *gotRootsHash != rootsHash {
+		t.Fatalf("expected roots hash %v, got %v", rootsHash, gotRootsHash)
+	}
 
 	// Compare.
 	if *hash != *gotHash {
@@ -49,3 +62,371 @@ func TestUtreexoStateConsistencyWrite(t *testing.T) {
 		t.Fatalf("expected %v, got %v", numLeaves, gotNumLeaves)
 	}
 }
+
+func TestFlushPolicy(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           FlushPolicy
+		blocksSinceFlush int32
+		sinceFlush       time.Duration
+		cacheUsed        int64
+		cacheCapacity    int64
+		expected         bool
+	}{
+		{
+			name:             "empty policy",
+			policy:           FlushPolicy{},
+			blocksSinceFlush: 1_000_000,
+			sinceFlush:       time.Hour * 24,
+			cacheUsed:        99,
+			cacheCapacity:    100,
+			expected:         false,
+		},
+		{
+			name:             "block interval not reached",
+			policy:           FlushPolicy{BlockInterval: 100},
+			blocksSinceFlush: 99,
+			expected:         false,
+		},
+		{
+			name:             "block interval reached",
+			policy:           FlushPolicy{BlockInterval: 100},
+			blocksSinceFlush: 100,
+			expected:         true,
+		},
+		{
+			name:       "time interval not reached",
+			policy:     FlushPolicy{TimeInterval: time.Minute * 10},
+			sinceFlush: time.Minute * 9,
+			expected:   false,
+		},
+		{
+			name:       "time interval reached",
+			policy:     FlushPolicy{TimeInterval: time.Minute * 10},
+			sinceFlush: time.Minute * 10,
+			expected:   true,
+		},
+		{
+			name:          "cache utilization not reached",
+			policy:        FlushPolicy{CacheUtilization: 80},
+			cacheUsed:     79,
+			cacheCapacity: 100,
+			expected:      false,
+		},
+		{
+			name:          "cache utilization reached",
+			policy:        FlushPolicy{CacheUtilization: 80},
+			cacheUsed:     80,
+			cacheCapacity: 100,
+			expected:      true,
+		},
+		{
+			name:          "cache utilization with zero capacity",
+			policy:        FlushPolicy{CacheUtilization: 80},
+			cacheUsed:     0,
+			cacheCapacity: 0,
+			expected:      false,
+		},
+		{
+			name: "only one condition met",
+			policy: FlushPolicy{
+				BlockInterval:    100,
+				TimeInterval:     time.Minute * 10,
+				CacheUtilization: 80,
+			},
+			blocksSinceFlush: 1,
+			sinceFlush:       time.Minute * 11,
+			cacheUsed:        1,
+			cacheCapacity:    100,
+			expected:         true,
+		},
+	}
+
+	for _, test := range tests {
+		got := test.policy.isFlushNeeded(test.blocksSinceFlush,
+			test.sinceFlush, test.cacheUsed, test.cacheCapacity)
+		if got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestMemoryBudgets(t *testing.T) {
+	tests := []struct {
+		name                 string
+		cfg                  UtreexoConfig
+		expectedNodes        int64
+		expectedCachedLeaves int64
+	}{
+		{
+			name:                 "default split",
+			cfg:                  UtreexoConfig{MaxMemoryUsage: 1000},
+			expectedNodes:        700,
+			expectedCachedLeaves: 300,
+		},
+		{
+			name: "only nodes set",
+			cfg: UtreexoConfig{
+				MaxMemoryUsage: 1000,
+				MaxNodesMemory: 900,
+			},
+			expectedNodes:        900,
+			expectedCachedLeaves: 100,
+		},
+		{
+			name: "only cached leaves set",
+			cfg: UtreexoConfig{
+				MaxMemoryUsage:        1000,
+				MaxCachedLeavesMemory: 600,
+			},
+			expectedNodes:        400,
+			expectedCachedLeaves: 600,
+		},
+		{
+			name: "both set",
+			cfg: UtreexoConfig{
+				MaxMemoryUsage:        1000,
+				MaxNodesMemory:        600,
+				MaxCachedLeavesMemory: 300,
+			},
+			expectedNodes:        600,
+			expectedCachedLeaves: 300,
+		},
+	}
+
+	for _, test := range tests {
+		gotNodes, gotCachedLeaves := test.cfg.memoryBudgets()
+		if gotNodes != test.expectedNodes {
+			t.Errorf("%s: expected nodes budget of %d, got %d",
+				test.name, test.expectedNodes, gotNodes)
+		}
+		if gotCachedLeaves != test.expectedCachedLeaves {
+			t.Errorf("%s: expected cached leaves budget of %d, got %d",
+				test.name, test.expectedCachedLeaves, gotCachedLeaves)
+		}
+	}
+}
+
+func TestProofPruneHeight(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        UtreexoConfig
+		bestHeight int32
+		expected   int32
+	}{
+		{
+			name:       "nothing dropped",
+			cfg:        UtreexoConfig{},
+			bestHeight: 1000,
+			expected:   0,
+		},
+		{
+			name:       "only prune height",
+			cfg:        UtreexoConfig{ProofPruneHeight: 500},
+			bestHeight: 1000,
+			expected:   500,
+		},
+		{
+			name:       "only retention",
+			cfg:        UtreexoConfig{ProofRetention: 300},
+			bestHeight: 1000,
+			expected:   701,
+		},
+		{
+			name:       "retention longer than the chain",
+			cfg:        UtreexoConfig{ProofRetention: 300},
+			bestHeight: 100,
+			expected:   0,
+		},
+		{
+			name: "prune height above the retention",
+			cfg: UtreexoConfig{
+				ProofPruneHeight: 800,
+				ProofRetention:   300,
+			},
+			bestHeight: 1000,
+			expected:   800,
+		},
+		{
+			name: "retention above the prune height",
+			cfg: UtreexoConfig{
+				ProofPruneHeight: 500,
+				ProofRetention:   300,
+			},
+			bestHeight: 1000,
+			expected:   701,
+		},
+	}
+
+	for _, test := range tests {
+		got := test.cfg.proofPruneHeight(test.bestHeight)
+		if got != test.expected {
+			t.Errorf("%s: expected prune height of %d, got %d",
+				test.name, test.expected, got)
+		}
+	}
+}
+
+func TestUtreexoStateNetwork(t *testing.T) {
+	mainnet := serializeUtreexoStateNetwork(&chaincfg.MainNetParams)
+	tests := []struct {
+		name    string
+		buf     []byte
+		params  *chaincfg.Params
+		wantErr bool
+	}{
+		{
+			name:   "same network",
+			buf:    mainnet,
+			params: &chaincfg.MainNetParams,
+		},
+		{
+			name:    "mainnet state with testnet params",
+			buf:     mainnet,
+			params:  &chaincfg.TestNet3Params,
+			wantErr: true,
+		},
+		{
+			name:    "testnet state with mainnet params",
+			buf:     serializeUtreexoStateNetwork(&chaincfg.TestNet3Params),
+			params:  &chaincfg.MainNetParams,
+			wantErr: true,
+		},
+		{
+			name:    "same genesis with another name",
+			buf:     append(mainnet[:chainhash.HashSize:chainhash.HashSize], "regtest"...),
+			params:  &chaincfg.MainNetParams,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			buf:     mainnet[:chainhash.HashSize-1],
+			params:  &chaincfg.MainNetParams,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := verifyUtreexoStateNetwork(test.buf, "utreexostate", test.params)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: expected error %v, got %v", test.name,
+				test.wantErr, err)
+		}
+	}
+}
+
+func TestCrossCheckUtreexoState(t *testing.T) {
+	block := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+
+	// Create an accumulator with some leaves in it.
+	p := utreexo.NewMapPollard(true)
+	leaves := make([]utreexo.Leaf, 16)
+	for i := range leaves {
+		leaves[i] = utreexo.Leaf{Hash: utreexo.Hash{byte(i + 1)}}
+	}
+	err := p.Modify(leaves, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stump is kept separately from the accumulator.
+	prevStump := p.GetStump()
+	stumpCopy := func() *utreexo.Stump {
+		stump := utreexo.Stump{NumLeaves: prevStump.NumLeaves}
+		stump.Roots = append([]utreexo.Hash(nil), prevStump.Roots...)
+		return &stump
+	}
+
+	// Delete some leaves and add new ones while cross checking.
+	delHashes := []utreexo.Hash{leaves[1].Hash, leaves[7].Hash, leaves[12].Hash}
+	proof, err := p.Prove(delHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adds := []utreexo.Leaf{{Hash: utreexo.Hash{0xaa}}, {Hash: utreexo.Hash{0xbb}}}
+
+	err = p.Modify(adds, delHashes, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stump := stumpCopy()
+	err = crossCheckUtreexoState(block, stump, adds, delHashes, proof, &p)
+	if err != nil {
+		t.Fatalf("expected no divergence but got %v", err)
+	}
+	if !reflect.DeepEqual(*stump, p.GetStump()) {
+		t.Fatalf("expected the stump to be updated to %v, got %v",
+			p.GetStump(), *stump)
+	}
+
+	// Deleting hashes that don't exist in the accumulator should be caught.
+	badDels := []utreexo.Hash{{0xff}, leaves[7].Hash, leaves[12].Hash}
+	err = crossCheckUtreexoState(block, stumpCopy(), adds, badDels, proof, &p)
+	if err == nil {
+		t.Fatalf("expected divergence for the deletions")
+	}
+
+	// Roots that don't match the independently updated stump should be caught.
+	err = crossCheckUtreexoState(block, stumpCopy(), adds[:1], delHashes, proof, &p)
+	if err == nil {
+		t.Fatalf("expected divergence for the roots")
+	}
+
+	// An accumulator that drifted from the stump should be caught even
+	// though it's consistent with itself.
+	err = p.Modify([]utreexo.Leaf{{Hash: utreexo.Hash{0xcc}}}, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = crossCheckUtreexoState(block, stumpCopy(), adds, delHashes, proof, &p)
+	if err == nil {
+		t.Fatalf("expected divergence for the drifted accumulator")
+	}
+}
+
+func TestUtreexoStateTip(t *testing.T) {
+	p := utreexo.NewMapPollard(true)
+	us := &UtreexoState{state: &p, proofs: newProofCache(0)}
+
+	// An accumulator without a snapshot should return an empty stump.
+	stump, bestHash := us.currentTip()
+	if stump.NumLeaves != 0 || len(stump.Roots) != 0 {
+		t.Fatalf("expected an empty stump, got %v", stump)
+	}
+	if bestHash != (chainhash.Hash{}) {
+		t.Fatalf("expected an empty hash, got %v", bestHash)
+	}
+
+	leaves := make([]utreexo.Leaf, 7)
+	for i := range leaves {
+		leaves[i] = utreexo.Leaf{Hash: utreexo.Hash{byte(i + 1)}}
+	}
+	err := p.Modify(leaves, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshot shouldn't change until it's updated.
+	stump = us.currentStump()
+	if stump.NumLeaves != 0 {
+		t.Fatalf("expected 0 leaves before the update, got %d", stump.NumLeaves)
+	}
+
+	us.updateTip(chaincfg.MainNetParams.GenesisHash)
+	stump, bestHash = us.currentTip()
+	if bestHash != *chaincfg.MainNetParams.GenesisHash {
+		t.Fatalf("expected hash %v, got %v", chaincfg.MainNetParams.GenesisHash, bestHash)
+	}
+	if stump.NumLeaves != p.GetNumLeaves() {
+		t.Fatalf("expected %d leaves, got %d", p.GetNumLeaves(), stump.NumLeaves)
+	}
+	roots := p.GetRoots()
+	if len(stump.Roots) != len(roots) {
+		t.Fatalf("expected %d roots, got %d", len(roots), len(stump.Roots))
+	}
+	for i := range roots {
+		if stump.Roots[i] != roots[i] {
+			t.Fatalf("expected root %d to be %v, got %v", i, roots[i], stump.Roots[i])
+		}
+	}
+}
@@ -8,13 +8,12 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"path/filepath"
 	"sync"
-	"time"
 
 	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/btcutil"
-	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/database"
 	"github.com/utreexo/utreexod/wire"
@@ -40,9 +39,10 @@ var (
 	// in the utreexoParentBucketKey and contains the utreexo state data.
 	utreexoStateKey = []byte("utreexostatekey")
 
-	// utreexoUndoKey is the name of the utreexo undo data bucket. It is included
-	// in the utreexoParentBucketKey and contains the data necessary for disconnecting
-	// blocks.
+	// utreexoUndoKey is the name of the legacy utreexo undo data bucket. It
+	// is included in the utreexoParentBucketKey and contained the data
+	// necessary for disconnecting blocks before it was moved to the undo
+	// files.
 	utreexoUndoKey = []byte("utreexoundokey")
 )
 
@@ -52,6 +52,12 @@ var _ Indexer = (*UtreexoProofIndex)(nil)
 // Ensure the UtreexoProofIndex type implements the NeedsInputser interface.
 var _ NeedsInputser = (*UtreexoProofIndex)(nil)
 
+// Ensure the UtreexoProofIndex type implements the Backfiller interface.
+var _ Backfiller = (*UtreexoProofIndex)(nil)
+
+// Ensure the UtreexoProofIndex type implements the stateReconciler interface.
+var _ stateReconciler = (*UtreexoProofIndex)(nil)
+
 // UtreexoProofIndex implements a utreexo accumulator proof index for all the blocks.
 type UtreexoProofIndex struct {
 	db     database.DB
@@ -60,25 +66,36 @@ type UtreexoProofIndex struct {
 	// The blockchain instance the index corresponds to.
 	chain *blockchain.BlockChain
 
-	// mtx protects concurrent access to utreexoView.
+	// mtx protects concurrent access to the utreexoState.  Readers that
+	// only need the current roots should use FetchCurrentUtreexoState.
 	mtx *sync.RWMutex
 
 	// utreexoState represents the Bitcoin UTXO set as a utreexo accumulator.
 	// It keeps all the elements of the forest in order to generate proofs.
 	utreexoState *UtreexoState
 
+	// rootsMtx protects concurrent access to utreexoRootsState.  It's
+	// separate from mtx so that serving the roots proofs to peers doesn't
+	// contend with the block connects and flushes of the utreexo state.
+	rootsMtx *sync.RWMutex
+
 	// utreexoRootsState is the accumulator for all the roots at each of the
 	// blocks. This is so that we can serve to peers the proof that a set of
 	// roots at a block is correct.
 	utreexoRootsState utreexo.Pollard
 
+	// summaryMtx protects concurrent access to blockSummaryState.
+	summaryMtx *sync.RWMutex
+
 	// blockSummaryState is the accumulator for all the block summaries at each
 	// of the blocks. This is so that we can serve to peers the proof that the given
 	// block summaries of a block is correct.
 	blockSummaryState utreexo.Pollard
 
-	// The time of when the utreexo state was last flushed.
-	lastFlushTime time.Time
+	// undoFiles holds the data necessary for disconnecting the last blocks.
+	// It's only used by pruned nodes as archive nodes generate the data
+	// from the stored proofs.
+	undoFiles *undoFileStore
 }
 
 // NeedsInputs signals that the index requires the referenced inputs in order
@@ -89,6 +106,23 @@ func (idx *UtreexoProofIndex) NeedsInputs() bool {
 	return true
 }
 
+// Backfills signals that the index can be caught up to the main chain in the
+// background.  Pruned nodes may not have the blocks to catch up from so they're
+// caught up during initialization like before.
+//
+// This implements the Backfiller interface.
+func (idx *UtreexoProofIndex) Backfills() bool {
+	return !idx.config.Pruned
+}
+
+// reconciledStartHeights returns the height that the utreexo state was at when
+// the index was initialized.
+//
+// This implements the stateReconciler interface.
+func (idx *UtreexoProofIndex) reconciledStartHeights() []stateHeight {
+	return []stateHeight{{"utreexo state", idx.utreexoState.startHeight}}
+}
+
 // initUtreexoRootsState creates an accumulator from all the existing roots and
 // holds it in memory so that the proofs for them can be generated.
 func (idx *UtreexoProofIndex) initUtreexoRootsState(bestHeight int32) error {
@@ -188,12 +222,11 @@ func (idx *UtreexoProofIndex) Init(chain *blockchain.BlockChain,
 	idx.chain = chain
 
 	// Init Utreexo State.
-	uState, err := InitUtreexoState(idx.config, chain, tipHash, tipHeight)
+	uState, err := InitUtreexoState(idx.config, chain, tipHash, tipHeight, nil, nil)
 	if err != nil {
 		return err
 	}
 	idx.utreexoState = uState
-	idx.lastFlushTime = time.Now()
 
 	err = idx.initUtreexoRootsState(tipHeight)
 	if err != nil {
@@ -206,57 +239,134 @@ func (idx *UtreexoProofIndex) Init(chain *blockchain.BlockChain,
 		return idx.initBlockSummaryState(tipHeight)
 	}
 
-	// Check if the utreexo undo bucket exists.
-	var exists bool
+	// The undo data of pruned nodes is kept in undo files.  Roll them back
+	// to the tip of the index as they're written before the tip is.
+	undoFiles, err := openUndoFileStore(filepath.Join(utreexoBasePath(idx.config), undoDirName))
+	if err != nil {
+		return err
+	}
+	idx.undoFiles = undoFiles
+	idx.undoFiles.syncWrites = idx.config.SyncPolicy.Undo
+	err = idx.undoFiles.truncate(tipHeight)
+	if err != nil {
+		return err
+	}
+
+	// Check if the undo data is still in the legacy undo bucket or if the
+	// node is just now being pruned after being an archive node.
+	var undoBucketExists, hasProofs bool
 	err = idx.db.View(func(dbTx database.Tx) error {
 		parentBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey)
-		bucket := parentBucket.Bucket(utreexoUndoKey)
-		exists = bucket != nil
+		undoBucketExists = parentBucket.Bucket(utreexoUndoKey) != nil
+		if proofBucket := parentBucket.Bucket(utreexoProofIndexKey); proofBucket != nil {
+			hasProofs = proofBucket.Cursor().First()
+		}
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// If the undo bucket exists, we can return now. If the undo bucket
-	// doesn't exist, the node is just now being pruned after being an
-	// archive node.
-	if exists {
+	if undoBucketExists {
+		err = idx.migrateUndoBucket(tipHeight)
+	} else if hasProofs {
+		err = idx.undoFromProofs(tipHeight)
+	}
+	if err != nil {
+		return err
+	}
+	if !undoBucketExists && !hasProofs {
 		return nil
 	}
 
-	// Create the undo bucket as we're a pruned node now.
-	err = idx.db.Update(func(dbTx database.Tx) error {
+	// Remove the legacy undo bucket and all proofs as they're not needed
+	// anymore.
+	return idx.db.Update(func(dbTx database.Tx) error {
 		parentBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey)
-		_, err = parentBucket.CreateBucket(utreexoUndoKey)
-		if err != nil {
-			return err
+		if undoBucketExists {
+			err := parentBucket.DeleteBucket(utreexoUndoKey)
+			if err != nil {
+				return err
+			}
+		}
+		if hasProofs {
+			return parentBucket.DeleteBucket(utreexoProofIndexKey)
 		}
 		return nil
 	})
+}
+
+// undoStartHeight returns the height of the first block to keep the undo data
+// for when the tip is at the given height and the undo data is kept for the
+// given number of blocks.
+func undoStartHeight(tipHeight, retention int32) int32 {
+	start := tipHeight - retention + 1
+	if start < 1 {
+		start = 1
+	}
+	return start
+}
+
+// migrateUndoBucket moves the undo data of the last blocks up to the tip from
+// the legacy undo bucket to the undo files.
+func (idx *UtreexoProofIndex) migrateUndoBucket(tipHeight int32) error {
+	// Start over in case a previous attempt was interrupted.
+	err := idx.undoFiles.truncate(0)
 	if err != nil {
 		return err
 	}
-
-	// The bestHeight is less than 288, then just undo all the blocks we have.
-	bestHeight := chain.BestSnapshot().Height
-	if bestHeight <= 0 {
+	if tipHeight <= 0 {
 		return nil
 	}
 
-	// Make undo blocks for blocks up to 288 block from the tip. 288 since
-	// that's the basis used for NODE_NETWORK_LIMITED. Reorgs that go past
-	// that are gonna be problematic anyways.
-	undoCount := int32(288)
+	// Only the undo data that's contiguous up to the tip is of any use.
+	var undos [][]byte
+	start := undoStartHeight(tipHeight, idx.config.undoRetention())
+	err = idx.db.View(func(dbTx database.Tx) error {
+		undoBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey).Bucket(utreexoUndoKey)
+		for height := tipHeight; height >= start; height-- {
+			hash, err := idx.chain.BlockHashByHeight(height)
+			if err != nil {
+				return err
+			}
+			serialized := undoBucket.Get(hash[:])
+			if serialized == nil {
+				break
+			}
+			undos = append(undos, serialized)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-	// The bestHeight is less than 288, then just undo all the blocks we have.
-	if undoCount > bestHeight {
-		undoCount = bestHeight
+	log.Infof("Moving the undo data of %d blocks to the undo files", len(undos))
+	for i := len(undos) - 1; i >= 0; i-- {
+		err = idx.undoFiles.store(tipHeight-int32(i), undos[i])
+		if err != nil {
+			return err
+		}
 	}
 
-	for i := int32(0); i < undoCount; i++ {
-		height := bestHeight - i
+	return nil
+}
 
+// undoFromProofs generates the undo data of the last blocks up to the tip from
+// the stored proofs.  It's used when an archive node is switched to a pruned
+// node.
+func (idx *UtreexoProofIndex) undoFromProofs(tipHeight int32) error {
+	// Start over in case a previous attempt was interrupted.
+	err := idx.undoFiles.truncate(0)
+	if err != nil {
+		return err
+	}
+	if tipHeight <= 0 {
+		return nil
+	}
+
+	start := undoStartHeight(tipHeight, idx.config.undoRetention())
+	for height := start; height <= tipHeight; height++ {
 		block, err := idx.chain.BlockByHeight(height)
 		if err != nil {
 			return err
@@ -268,15 +378,16 @@ func (idx *UtreexoProofIndex) Init(chain *blockchain.BlockChain,
 			if err != nil {
 				return err
 			}
-			r := bytes.NewReader(proofBytes)
-
-			err = ud.Deserialize(r)
-			if err != nil {
-				return err
+			if proofBytes == nil {
+				return fmt.Errorf("couldn't fetch utreexo proof for height %d",
+					height)
 			}
 
-			return nil
+			return ud.Deserialize(bytes.NewReader(proofBytes))
 		})
+		if err != nil {
+			return err
+		}
 
 		// Generate the data for the undo block.
 		_, outCount, _, outskip := blockchain.DedupeBlock(block)
@@ -286,25 +397,11 @@ func (idx *UtreexoProofIndex) Init(chain *blockchain.BlockChain,
 			return err
 		}
 
-		// Store undo block.
-		err = idx.db.Update(func(dbTx database.Tx) error {
-			err = dbStoreUndoData(dbTx, uint64(len(adds)),
-				ud.AccProof.Targets, block.Hash(), delHashes)
-			if err != nil {
-				return err
-			}
-
-			return nil
-		})
-	}
-
-	// Remove all proofs.
-	err = idx.db.Update(func(tx database.Tx) error {
-		parentBucket := tx.Metadata().Bucket(utreexoParentBucketKey)
-		return parentBucket.DeleteBucket(utreexoProofIndexKey)
-	})
-	if err != nil {
-		return err
+		err = idx.storeUndoBlock(height, uint64(len(adds)),
+			ud.AccProof.Targets, delHashes)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -323,6 +420,12 @@ func (idx *UtreexoProofIndex) Key() []byte {
 	return utreexoParentBucketKey
 }
 
+// StoragePaths returns the paths on disk that hold the utreexo state of the
+// utreexo proof index.  The proofs themselves are stored in the main database.
+func (idx *UtreexoProofIndex) StoragePaths() []string {
+	return []string{utreexoBasePath(idx.config)}
+}
+
 // Create is invoked when the indexer manager determines the index needs
 // to be created for the first time.  It creates the bucket for the utreexo proof
 // index.
@@ -344,14 +447,6 @@ func (idx *UtreexoProofIndex) Create(dbTx database.Tx) error {
 		return err
 	}
 
-	// Only create the undo bucket if the node is pruned.
-	if idx.config.Pruned {
-		_, err = utreexoParentBucket.CreateBucket(utreexoUndoKey)
-		if err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -390,21 +485,61 @@ func (idx *UtreexoProofIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Bloc
 		delHashes[i] = ud.LeafDatas[i].LeafHash()
 	}
 
-	// For pruned nodes, the undo data is necessary for reorgs.
+	// For pruned nodes, the undo data is necessary for reorgs.  Only the
+	// undo data of the last blocks is kept.
 	if idx.config.Pruned {
-		err = dbStoreUndoData(dbTx,
-			uint64(len(adds)), ud.AccProof.Targets, block.Hash(), delHashes)
+		err = idx.storeUndoBlock(block.Height(),
+			uint64(len(adds)), ud.AccProof.Targets, delHashes)
+		if err != nil {
+			return err
+		}
+
+		err = idx.undoFiles.prune(undoStartHeight(block.Height(),
+			idx.config.undoRetention()))
 		if err != nil {
 			return err
 		}
 	}
 
+	if idx.config.CrossCheck {
+		idx.utreexoState.seedCrossCheck(&block.MsgBlock().Header.PrevBlock)
+	}
+
 	idx.mtx.Lock()
 	err = idx.utreexoState.state.Modify(adds, delHashes, ud.AccProof)
+	if err == nil && !idx.config.Pruned {
+		// The roots state is updated before the tip snapshot is
+		// published so that the roots of the tip can always be proven.
+		err = idx.updateRootsState()
+	}
+	if err == nil {
+		idx.utreexoState.updateTip(block.Hash())
+	}
 	idx.mtx.Unlock()
 	if err != nil {
 		return err
 	}
+	idx.utreexoState.blocksSinceFlush++
+	idx.utreexoState.audit(auditOpModify, block.Height(), block.Hash(),
+		uint64(len(adds)), adds, delHashes, ud.AccProof.Targets)
+
+	if idx.config.CrossCheck {
+		err = idx.utreexoState.crossCheck(block, stxos, idx.chain,
+			adds, ud.AccProof)
+		if err != nil {
+			log.Criticalf("Hybrid validation failed. Halting block "+
+				"processing: %v", err)
+			return err
+		}
+	}
+
+	// The root snapshots are kept on pruned nodes too as they're the only
+	// roots of past blocks that are kept there.
+	err = dbStoreRootSnapshot(dbTx, utreexoParentBucketKey,
+		idx.config.RootSnapshotInterval, block, idx.utreexoState.state)
+	if err != nil {
+		return err
+	}
 
 	// Don't store proofs if the node is pruned.
 	if idx.config.Pruned {
@@ -421,12 +556,7 @@ func (idx *UtreexoProofIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Bloc
 		return err
 	}
 
-	err = idx.updateBlockSummaryState(uint16(len(adds)), block.Hash(), ud.AccProof)
-	if err != nil {
-		return err
-	}
-
-	return idx.updateRootsState()
+	return idx.updateBlockSummaryState(uint16(len(adds)), block.Hash(), ud.AccProof)
 }
 
 // getUndoData returns the data needed for undo. For pruned nodes, we fetch the data from
@@ -458,7 +588,7 @@ func (idx *UtreexoProofIndex) getUndoData(dbTx database.Tx, block *btcutil.Block
 		numAdds = uint64(len(adds))
 	} else {
 		var err error
-		numAdds, targets, delHashes, err = dbFetchUndoData(dbTx, block.Hash())
+		numAdds, targets, delHashes, err = idx.fetchUndoBlock(block.Height())
 		if err != nil {
 			return 0, nil, nil, err
 		}
@@ -467,6 +597,18 @@ func (idx *UtreexoProofIndex) getUndoData(dbTx database.Tx, block *btcutil.Block
 	return numAdds, targets, delHashes, nil
 }
 
+// fetchUndoData returns the data needed for undoing the block.  The data of the
+// blocks deeper than what's kept is recovered from the rollback snapshots.
+func (idx *UtreexoProofIndex) fetchUndoData(dbTx database.Tx, block *btcutil.Block) (uint64, []uint64, []utreexo.Hash, error) {
+	numAdds, targets, delHashes, err := idx.getUndoData(dbTx, block)
+	if err != nil && idx.config.RollbackSnapshots > 0 {
+		log.Infof("The data for undoing block %s (%d) is no longer "+
+			"kept: %v", block.Hash(), block.Height(), err)
+		return idx.utreexoState.fetchReplayedUndo(idx.chain, block)
+	}
+	return numAdds, targets, delHashes, err
+}
+
 // DisconnectBlock is invoked by the index manager when a new block has been
 // disconnected to the main chain.
 //
@@ -484,17 +626,23 @@ func (idx *UtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.B
 		return err
 	}
 
-	numAdds, targets, delHashes, err := idx.getUndoData(dbTx, block)
+	numAdds, targets, delHashes, err := idx.fetchUndoData(dbTx, block)
 	if err != nil {
 		return err
 	}
 
 	idx.mtx.Lock()
 	err = idx.utreexoState.state.Undo(numAdds, utreexo.Proof{Targets: targets}, delHashes, state.Roots)
+	if err == nil {
+		idx.utreexoState.updateTip(&block.MsgBlock().Header.PrevBlock)
+	}
 	idx.mtx.Unlock()
 	if err != nil {
 		return err
 	}
+	idx.utreexoState.blocksSinceFlush++
+	idx.utreexoState.audit(auditOpUndo, block.Height(), block.Hash(),
+		numAdds, nil, delHashes, targets)
 
 	// Always flush the utreexo state on flushes to never leave the utreexoState
 	// at an unrecoverable state.
@@ -503,13 +651,23 @@ func (idx *UtreexoProofIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.B
 		return err
 	}
 
+	err = idx.utreexoState.dropRollbackSnapshots(block.Height())
+	if err != nil {
+		return err
+	}
+
 	err = dbDeleteUtreexoState(dbTx, block.Hash())
 	if err != nil {
 		return err
 	}
 
+	err = dbDeleteRootSnapshot(dbTx, utreexoParentBucketKey, block.Height())
+	if err != nil {
+		return err
+	}
+
 	if idx.config.Pruned {
-		err = dbDeleteUndoData(dbTx, block.Hash())
+		err = idx.undoFiles.truncate(block.Height() - 1)
 		if err != nil {
 			return err
 		}
@@ -558,6 +716,51 @@ func (idx *UtreexoProofIndex) FetchUtreexoProof(hash *chainhash.Hash) (*wire.UDa
 	return ud, err
 }
 
+// FetchUtreexoProofs calls fn with the Utreexo proof of every block in the main
+// chain from startHeight to endHeight, inclusive, in order of height.  The
+// iteration stops at the first error returned by fn and that error is
+// returned.
+func (idx *UtreexoProofIndex) FetchUtreexoProofs(startHeight, endHeight int32,
+	fn func(height int32, proof *wire.UData) error) error {
+
+	if idx.config.Pruned {
+		return fmt.Errorf("Cannot fetch historical proof as the node is pruned")
+	}
+	if startHeight < 1 || endHeight < startHeight {
+		return fmt.Errorf("invalid height range of %d to %d", startHeight, endHeight)
+	}
+
+	for height := startHeight; height <= endHeight; height++ {
+		hash, err := idx.chain.BlockHashByHeight(height)
+		if err != nil {
+			return err
+		}
+
+		ud := new(wire.UData)
+		err = idx.db.View(func(dbTx database.Tx) error {
+			proofBytes, err := dbFetchUtreexoProofEntry(dbTx, hash)
+			if err != nil {
+				return err
+			}
+			if proofBytes == nil {
+				return fmt.Errorf("Couldn't fetch Utreexo proof for height %d", height)
+			}
+
+			return ud.Deserialize(bytes.NewReader(proofBytes))
+		})
+		if err != nil {
+			return err
+		}
+
+		err = fn(height, ud)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetLeafHashPositions returns the positions of the passed in hashes.
 func (idx *UtreexoProofIndex) GetLeafHashPositions(delHashes []utreexo.Hash) []uint64 {
 	idx.mtx.RLock()
@@ -572,6 +775,28 @@ func (idx *UtreexoProofIndex) GetLeafHashPositions(delHashes []utreexo.Hash) []u
 	return positions
 }
 
+// GetPositionHash returns the hash at the given position in the accumulator.
+// Leaves move up the accumulator as their siblings are deleted so the hash may
+// be of a leaf even if the position isn't on the bottom row.  The boolean
+// returns false if there's nothing at the position.
+func (idx *UtreexoProofIndex) GetPositionHash(position uint64) (utreexo.Hash, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	hash := idx.utreexoState.state.GetHash(position)
+	return hash, hash != utreexo.Hash{}
+}
+
+// GetLeafPosition returns the current position of the leaf with the given hash
+// in the accumulator.  The boolean returns false if the leaf isn't in the
+// accumulator.
+func (idx *UtreexoProofIndex) GetLeafPosition(leafHash utreexo.Hash) (uint64, bool) {
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+
+	return idx.utreexoState.state.GetLeafPosition(leafHash)
+}
+
 // GenerateUDataPartial generates a utreexo data based on the current state of the accumulator.
 // It leaves out the full proof hashes and only fetches the requested positions.
 func (idx *UtreexoProofIndex) GenerateUDataPartial(dels []wire.LeafData, positions []uint64) (*wire.UData, error) {
@@ -624,12 +849,34 @@ func (idx *UtreexoProofIndex) GenerateUData(dels []wire.LeafData) (*wire.UData,
 	return ud, nil
 }
 
+// ProveBlock generates the utreexo proof of the outputs spent by the passed
+// block, which must extend the tip of the index, and checks it against the
+// current roots the same way nodes that only keep the accumulator do.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoProofIndex) ProveBlock(block *btcutil.Block) (*wire.UData, error) {
+	dels, err := blockSpentLeaves(idx.chain, block)
+	if err != nil {
+		return nil, err
+	}
+	ud, err := idx.GenerateUData(dels)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlockProof(block, ud, idx.VerifyAccProof); err != nil {
+		return nil, err
+	}
+
+	return ud, nil
+}
+
 // ProveUtxos returns an accumulator proof of the outpoints passed in with
 // respect to the UTXO state at chaintip.
 //
 // NOTE The accumulator state differs at every block height.  The caller must
 // take into consideration that an accumulator proof at block X will not be valid
-// at block height X+1.
+// at block height X+1.  The returned proof may be shared with other callers and
+// must not be modified.
 //
 // This function is safe for concurrent access.
 func (idx *UtreexoProofIndex) ProveUtxos(utxos []*blockchain.UtxoEntry,
@@ -674,49 +921,37 @@ func (idx *UtreexoProofIndex) ProveUtxos(utxos []*blockchain.UtxoEntry,
 	}
 
 	// Get a read lock for the index.  This will prevent connectBlock from updating
-	// the height and the utreexo state.
+	// the utreexo state while the proof is generated.
 	idx.mtx.RLock()
 	defer idx.mtx.RUnlock()
 
-	// Prove the commited hashes.
-	accProof, err := idx.utreexoState.state.Prove(hashes)
-	if err != nil {
-		return nil, err
-	}
-
-	// Grab the height and the blockhash the proof was generated at.
-	snapshot := idx.chain.BestSnapshot()
-	provedAtHash := snapshot.Hash
-
-	proof := &blockchain.ChainTipProof{
-		ProvedAtHash: &provedAtHash,
-		AccProof:     &accProof,
-		HashesProven: hashes,
-	}
-
-	return proof, nil
+	return idx.utreexoState.prove(hashes)
 }
 
-// VerifyAccProof verifies the given accumulator proof.  Returns an error if the
-// verification failed.
+// VerifyAccProof verifies the given accumulator proof against the roots at the
+// tip of the index.  Returns an error if the verification failed.
+//
+// This function is safe for concurrent access.
 func (idx *UtreexoProofIndex) VerifyAccProof(toProve []utreexo.Hash,
 	proof *utreexo.Proof) error {
-	return idx.utreexoState.state.Verify(toProve, *proof, false)
+	_, err := utreexo.Verify(idx.utreexoState.currentStump(), toProve, *proof)
+	return err
 }
 
 // updateRootsState updates the roots accumulator state from the roots of the current accumulator.
+//
+// This function MUST be called with the index lock held (for writes).
 func (idx *UtreexoProofIndex) updateRootsState() error {
-	idx.mtx.Lock()
-	numLeaves := idx.utreexoState.state.GetNumLeaves()
-	roots := idx.utreexoState.state.GetRoots()
-	idx.mtx.Unlock()
-
-	bytes, err := blockchain.SerializeUtreexoRoots(numLeaves, roots)
+	bytes, err := blockchain.SerializeUtreexoRoots(
+		idx.utreexoState.state.GetNumLeaves(), idx.utreexoState.state.GetRoots())
 	if err != nil {
 		return err
 	}
 
 	rootHash := sha256.Sum256(bytes)
+
+	idx.rootsMtx.Lock()
+	defer idx.rootsMtx.Unlock()
 	return idx.utreexoRootsState.Modify([]utreexo.Leaf{{Hash: rootHash}}, nil, utreexo.Proof{})
 }
 
@@ -736,6 +971,8 @@ func (idx *UtreexoProofIndex) updateBlockSummaryState(numAdds uint16, blockHash
 	}
 	hash := sha256.Sum256(buf.Bytes())
 
+	idx.summaryMtx.Lock()
+	defer idx.summaryMtx.Unlock()
 	return idx.blockSummaryState.Modify([]utreexo.Leaf{{Hash: hash}}, nil, utreexo.Proof{})
 }
 
@@ -744,7 +981,7 @@ func (idx *UtreexoProofIndex) updateBlockSummaryState(numAdds uint16, blockHash
 //
 // This is part of the Indexer interface.
 func (idx *UtreexoProofIndex) PruneBlock(_ database.Tx, _ *chainhash.Hash, lastKeptHeight int32) error {
-	hash, _, err := dbFetchUtreexoStateConsistency(idx.utreexoState.utreexoStateDB)
+	hash, _, _, err := dbFetchUtreexoStateConsistency(idx.utreexoState.utreexoStateDB)
 	if err != nil {
 		return err
 	}
@@ -813,7 +1050,9 @@ func (idx *UtreexoProofIndex) FetchUtreexoSummaries(blockHashes []*chainhash.Has
 	}
 
 	if includeProof {
+		idx.summaryMtx.RLock()
 		proof, err := idx.blockSummaryState.Prove(leafHashes)
+		idx.summaryMtx.RUnlock()
 		if err != nil {
 			return nil, err
 		}
@@ -868,10 +1107,12 @@ func (idx *UtreexoProofIndex) fetchBlockSummary(blockHash, prevHash *chainhash.H
 // FetchSummariesRoots returns the roots of the block summary state and the blockhash they were
 // at when the roots were fetched.
 func (idx *UtreexoProofIndex) FetchSummariesRoots() (utreexo.Stump, chainhash.Hash) {
+	idx.summaryMtx.RLock()
 	stump := utreexo.Stump{
 		Roots:     idx.blockSummaryState.GetRoots(),
 		NumLeaves: idx.blockSummaryState.GetNumLeaves(),
 	}
+	idx.summaryMtx.RUnlock()
 	besthash := idx.chain.BestSnapshot().Hash
 
 	return stump, besthash
@@ -879,14 +1120,18 @@ func (idx *UtreexoProofIndex) FetchSummariesRoots() (utreexo.Stump, chainhash.Ha
 
 // FetchMsgUtreexoRoot returns a complete utreexoroot bitcoin message on the requested block.
 func (idx *UtreexoProofIndex) FetchMsgUtreexoRoot(blockHash *chainhash.Hash) (*wire.MsgUtreexoRoot, error) {
-	var stump utreexo.Stump
-	err := idx.db.View(func(dbTx database.Tx) error {
-		var err error
-		stump, err = dbFetchUtreexoState(dbTx, blockHash)
-		return err
-	})
-	if err != nil {
-		return nil, err
+	// Serve the tip from the in-memory snapshot to avoid hitting the
+	// database for the most requested block.
+	stump, bestHash := idx.utreexoState.currentTip()
+	if bestHash != *blockHash {
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			stump, err = dbFetchUtreexoState(dbTx, blockHash)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	bytes, err := blockchain.SerializeUtreexoRoots(stump.NumLeaves, stump.Roots)
@@ -895,7 +1140,9 @@ func (idx *UtreexoProofIndex) FetchMsgUtreexoRoot(blockHash *chainhash.Hash) (*w
 	}
 	rootHash := sha256.Sum256(bytes)
 
+	idx.rootsMtx.RLock()
 	proof, err := idx.utreexoRootsState.Prove([]utreexo.Hash{rootHash})
+	idx.rootsMtx.RUnlock()
 	if err != nil {
 		return nil, err
 	}
@@ -912,26 +1159,22 @@ func (idx *UtreexoProofIndex) FetchMsgUtreexoRoot(blockHash *chainhash.Hash) (*w
 }
 
 // NewUtreexoProofIndex returns a new instance of an indexer that is used to create a utreexo
-// proof index using the database passed in. The passed in maxMemoryUsage should be in bytes and
-// it determines how much memory the proof index will use up.
+// proof index using the database passed in. The utreexo state is configured with the passed in
+// config and the name of the config is set to the type of the database.
 //
 // It implements the Indexer interface which plugs into the IndexManager that in
 // turn is used by the blockchain package.  This allows the index to be
 // seamlessly maintained along with the chain.
-func NewUtreexoProofIndex(db database.DB, pruned bool, maxMemoryUsage int64,
-	chainParams *chaincfg.Params, dataDir string, flush func() error) (*UtreexoProofIndex, error) {
+func NewUtreexoProofIndex(db database.DB, cfg *UtreexoConfig) (*UtreexoProofIndex, error) {
+	config := *cfg
+	config.Name = db.Type()
 
 	idx := &UtreexoProofIndex{
-		db:  db,
-		mtx: new(sync.RWMutex),
-		config: &UtreexoConfig{
-			MaxMemoryUsage: maxMemoryUsage,
-			Params:         chainParams,
-			Pruned:         pruned,
-			DataDir:        dataDir,
-			Name:           db.Type(),
-			FlushMainDB:    flush,
-		},
+		db:         db,
+		mtx:        new(sync.RWMutex),
+		rootsMtx:   new(sync.RWMutex),
+		summaryMtx: new(sync.RWMutex),
+		config:     &config,
 	}
 
 	return idx, nil
@@ -1005,33 +1248,35 @@ func dbFetchUtreexoState(dbTx database.Tx, hash *chainhash.Hash) (utreexo.Stump,
 	return utreexo.Stump{Roots: roots, NumLeaves: numLeaves}, nil
 }
 
-// Stores the data necessary for undoing blocks.
-func dbStoreUndoData(dbTx database.Tx, numAdds uint64,
-	targets []uint64, blockHash *chainhash.Hash, delHashes []utreexo.Hash) error {
+// storeUndoBlock serializes and stores the data necessary for undoing the block
+// at the given height in the undo files.
+func (idx *UtreexoProofIndex) storeUndoBlock(height int32,
+	numAdds uint64, targets []uint64, delHashes []utreexo.Hash) error {
 
 	bytes, err := serializeUndoBlock(numAdds, targets, delHashes)
 	if err != nil {
 		return err
 	}
 
-	undoBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey).Bucket(utreexoUndoKey)
-	return undoBucket.Put(blockHash[:], bytes)
+	err = idx.undoFiles.store(height, bytes)
+	if err != nil {
+		return fmt.Errorf("store undoblock err. %v", err)
+	}
+
+	return nil
 }
 
-// Fetches the data necessary for undoing blocks.
-func dbFetchUndoData(dbTx database.Tx, blockHash *chainhash.Hash) (uint64, []uint64, []utreexo.Hash, error) {
-	undoBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey).Bucket(utreexoUndoKey)
-	bytes := undoBucket.Get(blockHash[:])
+// fetchUndoBlock returns the data necessary for undoing the block at the given
+// height from the undo files.
+func (idx *UtreexoProofIndex) fetchUndoBlock(height int32) (uint64, []uint64, []utreexo.Hash, error) {
+	bytes, err := idx.undoFiles.fetch(height)
+	if err != nil {
+		return 0, nil, nil, err
+	}
 
 	return deserializeUndoBlock(bytes)
 }
 
-// Deletes the data for undoing blocks.
-func dbDeleteUndoData(dbTx database.Tx, blockHash *chainhash.Hash) error {
-	undoBucket := dbTx.Metadata().Bucket(utreexoParentBucketKey).Bucket(utreexoUndoKey)
-	return undoBucket.Delete(blockHash[:])
-}
-
 // Deletes the utreexo state in the database.
 func dbDeleteUtreexoState(dbTx database.Tx, hash *chainhash.Hash) error {
 	idx := dbTx.Metadata().Bucket(utreexoParentBucketKey).Bucket(utreexoStateKey)
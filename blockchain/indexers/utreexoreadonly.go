@@ -0,0 +1,295 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// FlatUtreexoStateName is the Name in the UtreexoConfig of the utreexo state of
+// the flat utreexo proof index.  The utreexo state of the utreexo proof index
+// is named after the type of the block database.
+const FlatUtreexoStateName = flatUtreexoProofIndexType
+
+// noopCloser is an io.Closer that doesn't do anything.
+type noopCloser struct{}
+
+// Close returns nil.
+func (noopCloser) Close() error {
+	return nil
+}
+
+// noLockFS is a file system that doesn't lock files.  It lets the pebble
+// database of a running node be opened, which pebble refuses to do otherwise
+// even when the database is opened read only.
+type noLockFS struct {
+	vfs.FS
+}
+
+// Lock returns a closer without locking the file.
+func (noLockFS) Lock(string) (io.Closer, error) {
+	return noopCloser{}, nil
+}
+
+// ReadOnlyUtreexoState is a read only view of the utreexo state and the flat
+// files of a utreexo proof index.  It sees the state as of the last flush
+// before it was opened.
+type ReadOnlyUtreexoState struct {
+	path     string
+	db       *pebble.DB
+	state    *utreexo.MapPollard
+	bestHash *chainhash.Hash
+
+	// proofState, undoState and rootsState are the flat files of the flat
+	// utreexo proof index.  They're nil for the utreexo proof index.
+	proofState *FlatFileState
+	undoState  *FlatFileState
+	rootsState *FlatFileState
+}
+
+// OpenUtreexoStateReadOnly opens the utreexo state described by the config
+// without locking or writing to anything on disk so that external tools can
+// inspect the accumulator of a running node.  The Name of the config has to be
+// set to the name of the utreexo state which is FlatUtreexoStateName for the
+// flat utreexo proof index.  The flat files of the flat utreexo proof index are
+// opened as well.
+//
+// An error is returned if the node is in the middle of flushing the utreexo
+// state and it should be opened again.
+func OpenUtreexoStateReadOnly(cfg *UtreexoConfig) (*ReadOnlyUtreexoState, error) {
+	return openUtreexoStateReadOnly(cfg, cfg.DataDir)
+}
+
+// openUtreexoStateReadOnly opens the utreexo state described by the config
+// read only along with the flat files in flatDataDir.
+func openUtreexoStateReadOnly(cfg *UtreexoConfig,
+	flatDataDir string) (*ReadOnlyUtreexoState, error) {
+
+	path := utreexoBasePath(cfg)
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("no utreexo state at %s: %v", path, err)
+	}
+
+	db, err := pebble.Open(path, &pebble.Options{
+		ReadOnly: true,
+		FS:       noLockFS{vfs.Default},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rs := &ReadOnlyUtreexoState{path: path, db: db}
+
+	err = rs.initState(cfg)
+	if err != nil {
+		rs.Close()
+		return nil, err
+	}
+
+	if cfg.Name == FlatUtreexoStateName {
+		err = rs.initFlatFiles(flatDataDir)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+	}
+
+	return rs, nil
+}
+
+// initState loads the accumulator from the database.
+func (rs *ReadOnlyUtreexoState) initState(cfg *UtreexoConfig) error {
+	err := checkUtreexoStateNetwork(rs.db, rs.path, cfg.Params, true)
+	if err != nil {
+		return err
+	}
+
+	// The accumulator of a node that keeps it in memory is in the pollard
+	// file.  It's replaced as a whole on every flush so it's never seen
+	// half written.
+	pollardPath := pollardFilePath(cfg)
+	if _, err := os.Stat(pollardPath); err == nil {
+		rs.bestHash, rs.state, err = readPollardFile(pollardPath)
+		return err
+	}
+
+	maxNodesMem, maxCachedLeavesMem := cfg.memoryBudgets()
+	nodesDB, err := blockchain.InitNodesBackEnd(rs.db, maxNodesMem)
+	if err != nil {
+		return err
+	}
+	cachedLeavesDB, err := blockchain.InitCachedLeavesBackEnd(rs.db, maxCachedLeavesMem)
+	if err != nil {
+		return err
+	}
+
+	savedHash, numLeaves, rootsHash, err := dbFetchUtreexoStateConsistency(rs.db)
+	if err != nil {
+		return err
+	}
+	if savedHash == nil {
+		return fmt.Errorf("the utreexo state at %s was never flushed",
+			rs.path)
+	}
+
+	p := utreexo.NewMapPollard(true)
+	p.NumLeaves = numLeaves
+	p.Nodes = nodesDB
+	p.CachedLeaves = cachedLeavesDB
+
+	// The nodes are written before the roots they commit to so the roots
+	// don't match while the node is flushing.
+	if rootsHash != nil {
+		gotHash, err := utreexoRootsHash(p.NumLeaves, p.GetRoots())
+		if err != nil {
+			return err
+		}
+		if gotHash != *rootsHash {
+			return fmt.Errorf("the utreexo state roots at %s don't "+
+				"match the roots flushed at block %s. The node may "+
+				"be flushing the utreexo state, try again", rs.path,
+				savedHash)
+		}
+	}
+
+	rs.state = &p
+	rs.bestHash = savedHash
+
+	return nil
+}
+
+// initFlatFiles opens the flat files of the flat utreexo proof index.
+func (rs *ReadOnlyUtreexoState) initFlatFiles(dataDir string) error {
+	for _, ff := range []struct {
+		name  string
+		state **FlatFileState
+	}{
+		{flatUtreexoProofName, &rs.proofState},
+		{flatUtreexoUndoName, &rs.undoState},
+		{flatUtreexoRootsName, &rs.rootsState},
+	} {
+		state := NewFlatFileState()
+		err := state.InitReadOnly(flatFilePath(dataDir, ff.name), ff.name)
+		if err != nil {
+			return err
+		}
+		*ff.state = state
+	}
+
+	return nil
+}
+
+// Close closes the database and the flat files.
+func (rs *ReadOnlyUtreexoState) Close() error {
+	for _, ff := range []*FlatFileState{rs.proofState, rs.undoState, rs.rootsState} {
+		if ff != nil {
+			ff.Close()
+		}
+	}
+
+	return rs.db.Close()
+}
+
+// BestHash returns the hash of the block that the accumulator is at.
+func (rs *ReadOnlyUtreexoState) BestHash() *chainhash.Hash {
+	return rs.bestHash
+}
+
+// Stump returns the roots and the number of leaves of the accumulator.
+func (rs *ReadOnlyUtreexoState) Stump() utreexo.Stump {
+	return utreexo.Stump{
+		Roots:     rs.state.GetRoots(),
+		NumLeaves: rs.state.GetNumLeaves(),
+	}
+}
+
+// Prove returns the proof of the given leaf hashes against the accumulator.
+func (rs *ReadOnlyUtreexoState) Prove(hashes []utreexo.Hash) (utreexo.Proof, error) {
+	return rs.state.Prove(hashes)
+}
+
+// FlatBestHeight returns the height of the last block in the flat files.  It's
+// -1 for the utreexo proof index which doesn't have flat files.
+func (rs *ReadOnlyUtreexoState) FlatBestHeight() int32 {
+	if rs.proofState == nil {
+		return -1
+	}
+
+	return rs.proofState.BestHeight()
+}
+
+// fetchFlatData returns the data stored for the given height in the given flat
+// file.
+func (rs *ReadOnlyUtreexoState) fetchFlatData(ff *FlatFileState, height int32) ([]byte, error) {
+	if ff == nil {
+		return nil, fmt.Errorf("the utreexo state at %s has no flat files",
+			rs.path)
+	}
+
+	data, err := ff.FetchData(height)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("no %s stored for height %d", ff.name, height)
+	}
+
+	return data, nil
+}
+
+// FetchUtreexoProof returns the proof of the block at the given height from
+// the flat files.  The leaf datas of the proof are in the compact form.
+func (rs *ReadOnlyUtreexoState) FetchUtreexoProof(height int32) (*wire.UData, error) {
+	proofBytes, err := rs.fetchFlatData(rs.proofState, height)
+	if err != nil {
+		return nil, err
+	}
+
+	ud := new(wire.UData)
+	err = ud.Deserialize(bytes.NewReader(proofBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return ud, nil
+}
+
+// FetchUndoBlock returns the number of leaves that the block at the given
+// height added along with the targets and the hashes of the leaves it deleted
+// from the flat files.  They're only stored on pruned nodes.
+func (rs *ReadOnlyUtreexoState) FetchUndoBlock(height int32) (uint64, []uint64, []utreexo.Hash, error) {
+	undoBytes, err := rs.fetchFlatData(rs.undoState, height)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return deserializeUndoBlock(undoBytes)
+}
+
+// FetchRoots returns the accumulator after the block at the given height from
+// the flat files.
+func (rs *ReadOnlyUtreexoState) FetchRoots(height int32) (utreexo.Stump, error) {
+	rootsBytes, err := rs.fetchFlatData(rs.rootsState, height)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+
+	numLeaves, roots, err := blockchain.DeserializeUtreexoRoots(rootsBytes)
+	if err != nil {
+		return utreexo.Stump{}, err
+	}
+
+	return utreexo.Stump{Roots: roots, NumLeaves: numLeaves}, nil
+}
@@ -221,6 +221,15 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 		return false, false, err
 	}
 
+	// On signet networks, the block must also be signed off as defined by
+	// the challenge of the network.
+	if b.chainParams.SignetChallenge != nil && flags&BFNoPoWCheck != BFNoPoWCheck {
+		err = CheckSignetBlockSolution(block, b.chainParams)
+		if err != nil {
+			return false, false, err
+		}
+	}
+
 	// Find the previous checkpoint and perform some additional checks based
 	// on the checkpoint.  This provides a few nice properties such as
 	// preventing old side chain blocks before the last checkpoint,
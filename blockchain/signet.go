@@ -0,0 +1,217 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// SignetHeader is the prefix of the data push in the witness commitment of the
+// coinbase that holds the block solution on signet networks as defined by
+// BIP0325.
+var SignetHeader = []byte{0xec, 0xc7, 0xda, 0xa2}
+
+// signetScriptFlags are the script flags the block solution is verified with.
+const signetScriptFlags = txscript.ScriptBip16 | txscript.ScriptVerifyWitness |
+	txscript.ScriptVerifyDERSignatures | txscript.ScriptStrictMultiSig
+
+// appendPush appends a push of the passed data to the script the same way
+// Bitcoin Core does so that the commitment without the solution hashes the
+// same.  Unlike the script builder, single byte numbers are not replaced with
+// the small integer opcodes.
+func appendPush(script, data []byte) []byte {
+	switch {
+	case len(data) < txscript.OP_PUSHDATA1:
+		script = append(script, byte(len(data)))
+	case len(data) <= 0xff:
+		script = append(script, txscript.OP_PUSHDATA1, byte(len(data)))
+	case len(data) <= 0xffff:
+		script = append(script, txscript.OP_PUSHDATA2)
+		script = binary.LittleEndian.AppendUint16(script, uint16(len(data)))
+	default:
+		script = append(script, txscript.OP_PUSHDATA4)
+		script = binary.LittleEndian.AppendUint32(script, uint32(len(data)))
+	}
+
+	return append(script, data...)
+}
+
+// extractSignetSolution returns the block solution in the passed witness
+// commitment script along with the script with the solution cleared from it.
+// The solution is the rest of the first data push that starts with the signet
+// header.  False is returned when there's no such push.
+func extractSignetSolution(pkScript []byte) ([]byte, []byte, bool) {
+	var solution, cleared []byte
+	var found bool
+	tokenizer := txscript.MakeScriptTokenizer(0, pkScript)
+	for tokenizer.Next() {
+		data := tokenizer.Data()
+		if len(data) == 0 {
+			cleared = append(cleared, tokenizer.Opcode())
+			continue
+		}
+
+		// The push only holds a solution if there's data after the
+		// header.
+		if !found && len(data) > len(SignetHeader) &&
+			bytes.HasPrefix(data, SignetHeader) {
+
+			solution = data[len(SignetHeader):]
+			data = SignetHeader
+			found = true
+		}
+		cleared = appendPush(cleared, data)
+	}
+
+	return solution, cleared, found
+}
+
+// SignetTxs returns the virtual transactions that the solution of the passed
+// block is checked with on a signet network with the passed challenge as
+// defined by BIP0325.  The first one spends nothing and has a single output
+// with the challenge that commits to the block without its solution.  The
+// second one spends that output with the solution of the block, if any.
+//
+// A solution for the block is created by pushing the SignetHeader alone in the
+// witness commitment of the coinbase, signing the input of the second
+// transaction and then appending its signature script and witness to the push.
+func SignetTxs(block *btcutil.Block, challenge []byte) (*wire.MsgTx, *wire.MsgTx, error) {
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		return nil, nil, fmt.Errorf("block %v has no transactions",
+			block.Hash())
+	}
+
+	// The solution is part of the witness commitment so a block without
+	// one can't have a solution.
+	coinbase := txs[0].MsgTx().Copy()
+	commitmentIdx := -1
+	for i := len(coinbase.TxOut) - 1; i >= 0; i-- {
+		pkScript := coinbase.TxOut[i].PkScript
+		if len(pkScript) >= CoinbaseWitnessPkScriptLength &&
+			bytes.HasPrefix(pkScript, WitnessMagicBytes) {
+
+			commitmentIdx = i
+			break
+		}
+	}
+	if commitmentIdx == -1 {
+		return nil, nil, fmt.Errorf("block %v has no witness commitment",
+			block.Hash())
+	}
+
+	// A block without a solution is allowed for challenges that are
+	// satisfied without one.
+	commitment := coinbase.TxOut[commitmentIdx]
+	solution, cleared, found := extractSignetSolution(commitment.PkScript)
+	if found {
+		commitment.PkScript = cleared
+	}
+
+	toSign := wire.NewMsgTx(0)
+	toSign.AddTxIn(&wire.TxIn{})
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	if len(solution) > 0 {
+		r := bytes.NewReader(solution)
+		sigScript, err := wire.ReadVarBytes(r, 0, wire.MaxBlockPayload,
+			"signet solution script")
+		if err != nil {
+			return nil, nil, err
+		}
+		count, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if count > uint64(r.Len()) {
+			return nil, nil, fmt.Errorf("signet solution witness "+
+				"has %d items but only %d bytes left", count,
+				r.Len())
+		}
+		witness := make(wire.TxWitness, count)
+		for i := range witness {
+			witness[i], err = wire.ReadVarBytes(r, 0,
+				wire.MaxBlockPayload, "signet solution witness")
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if r.Len() != 0 {
+			return nil, nil, fmt.Errorf("signet solution has %d "+
+				"extra bytes", r.Len())
+		}
+		toSign.TxIn[0].SignatureScript = sigScript
+		toSign.TxIn[0].Witness = witness
+	}
+
+	// The block is committed to by the fields of its header that don't
+	// depend on the solution and by the merkle root of its transactions
+	// with the solution cleared.
+	modified := make([]*btcutil.Tx, len(txs))
+	modified[0] = btcutil.NewTx(coinbase)
+	copy(modified[1:], txs[1:])
+	merkles := BuildMerkleTreeStore(modified, false)
+
+	header := &block.MsgBlock().Header
+	blockData := make([]byte, 0, 72)
+	blockData = binary.LittleEndian.AppendUint32(blockData,
+		uint32(header.Version))
+	blockData = append(blockData, header.PrevBlock[:]...)
+	blockData = append(blockData, merkles[len(merkles)-1][:]...)
+	blockData = binary.LittleEndian.AppendUint32(blockData,
+		uint32(header.Timestamp.Unix()))
+
+	toSpend := wire.NewMsgTx(0)
+	toSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  appendPush([]byte{txscript.OP_0}, blockData),
+	})
+	toSpend.AddTxOut(wire.NewTxOut(0, challenge))
+
+	toSign.TxIn[0].PreviousOutPoint = wire.OutPoint{
+		Hash:  toSpend.TxHash(),
+		Index: 0,
+	}
+
+	return toSpend, toSign, nil
+}
+
+// CheckSignetBlockSolution checks that the solution of the passed block
+// satisfies the challenge of the signet network with the passed parameters as
+// defined by BIP0325.  The genesis block doesn't need a solution.
+func CheckSignetBlockSolution(block *btcutil.Block, params *chaincfg.Params) error {
+	if block.Hash().IsEqual(params.GenesisHash) {
+		return nil
+	}
+
+	toSpend, toSign, err := SignetTxs(block, params.SignetChallenge)
+	if err != nil {
+		str := fmt.Sprintf("block %v has an invalid signet solution: %v",
+			block.Hash(), err)
+		return ruleError(ErrBadSignetSolution, str)
+	}
+
+	challenge := toSpend.TxOut[0].PkScript
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(challenge, 0)
+	sigHashes := txscript.NewTxSigHashes(toSign, prevOutFetcher)
+	vm, err := txscript.NewEngine(challenge, toSign, 0, signetScriptFlags,
+		nil, sigHashes, 0, prevOutFetcher)
+	if err == nil {
+		err = vm.Execute()
+	}
+	if err != nil {
+		str := fmt.Sprintf("signet solution of block %v doesn't satisfy "+
+			"the challenge: %v", block.Hash(), err)
+		return ruleError(ErrBadSignetSolution, str)
+	}
+
+	return nil
+}
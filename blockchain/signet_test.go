@@ -0,0 +1,193 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// signetTestBlock returns a block with a witness commitment in its coinbase
+// when withCommitment is set.
+func signetTestBlock(withCommitment bool) *wire.MsgBlock {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x51, 0x00},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(wire.NewTxOut(50*btcutil.SatoshiPerBitcoin,
+		[]byte{txscript.OP_TRUE}))
+	if withCommitment {
+		commitment := append([]byte{}, WitnessMagicBytes...)
+		commitment = append(commitment, make([]byte, 32)...)
+		coinbase.AddTxOut(wire.NewTxOut(0, commitment))
+	}
+
+	block := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   0x20000000,
+			PrevBlock: chainhash.Hash{0x01},
+			Timestamp: time.Unix(1_700_000_000, 0),
+			Bits:      0x1e0377ae,
+		},
+	}
+	block.AddTransaction(coinbase)
+	merkles := BuildMerkleTreeStore(btcutil.NewBlock(block).Transactions(), false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	return block
+}
+
+// addSignetSolution puts the passed solution followed by the extra data in the
+// witness commitment of the block.
+func addSignetSolution(t *testing.T, block *wire.MsgBlock, sigScript []byte,
+	witness wire.TxWitness, extra []byte) {
+
+	var solution bytes.Buffer
+	solution.Write(SignetHeader)
+	if err := wire.WriteVarBytes(&solution, 0, sigScript); err != nil {
+		t.Fatal(err)
+	}
+	if err := wire.WriteVarInt(&solution, 0, uint64(len(witness))); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&solution, 0, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	solution.Write(extra)
+
+	coinbase := block.Transactions[0]
+	commitment := coinbase.TxOut[len(coinbase.TxOut)-1]
+	commitment.PkScript = appendPush(commitment.PkScript, solution.Bytes())
+}
+
+// TestCheckSignetBlockSolution ensures that only blocks with a solution that
+// satisfies the challenge of the network are accepted.
+func TestCheckSignetBlockSolution(t *testing.T) {
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKeyHash := btcutil.Hash160(privKey.PubKey().SerializeCompressed())
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := chaincfg.CustomSignetParams(challenge, nil)
+
+	// sign returns the witness that satisfies the challenge for the block.
+	// The block is committed to with the signet header alone in place of
+	// the solution.
+	sign := func(block *wire.MsgBlock) wire.TxWitness {
+		var unsigned wire.MsgBlock
+		unsigned.Header = block.Header
+		coinbase := block.Transactions[0].Copy()
+		commitment := coinbase.TxOut[len(coinbase.TxOut)-1]
+		commitment.PkScript = appendPush(commitment.PkScript, SignetHeader)
+		unsigned.AddTransaction(coinbase)
+		_, toSign, err := SignetTxs(btcutil.NewBlock(&unsigned), challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fetcher := txscript.NewCannedPrevOutputFetcher(challenge, 0)
+		sigHashes := txscript.NewTxSigHashes(toSign, fetcher)
+		witness, err := txscript.WitnessSignature(toSign, sigHashes, 0,
+			0, challenge, txscript.SigHashAll, privKey, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return witness
+	}
+
+	signed := signetTestBlock(true)
+	addSignetSolution(t, signed, nil, sign(signed), nil)
+
+	// A solution made for another block doesn't satisfy the challenge.
+	otherBlock := signetTestBlock(true)
+	otherBlock.Header.Timestamp = otherBlock.Header.Timestamp.Add(time.Second)
+	otherSolution := signetTestBlock(true)
+	addSignetSolution(t, otherSolution, nil, sign(otherBlock), nil)
+
+	// Data after the solution isn't allowed.
+	extraData := signetTestBlock(true)
+	addSignetSolution(t, extraData, nil, sign(extraData), []byte{0x00})
+
+	tests := []struct {
+		name      string
+		block     *wire.MsgBlock
+		challenge []byte
+		valid     bool
+	}{
+		{
+			name:      "valid solution",
+			block:     signed,
+			challenge: challenge,
+			valid:     true,
+		},
+		{
+			name:      "no solution",
+			block:     signetTestBlock(true),
+			challenge: challenge,
+		},
+		{
+			name:      "solution for another block",
+			block:     otherSolution,
+			challenge: challenge,
+		},
+		{
+			name:      "extra data after the solution",
+			block:     extraData,
+			challenge: challenge,
+		},
+		{
+			name:      "trivial challenge without solution",
+			block:     signetTestBlock(true),
+			challenge: []byte{txscript.OP_TRUE},
+			valid:     true,
+		},
+		{
+			name:      "no witness commitment",
+			block:     signetTestBlock(false),
+			challenge: []byte{txscript.OP_TRUE},
+		},
+	}
+	for _, test := range tests {
+		params := chaincfg.CustomSignetParams(test.challenge, nil)
+		err := CheckSignetBlockSolution(btcutil.NewBlock(test.block), &params)
+		if test.valid {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != ErrBadSignetSolution {
+			t.Fatalf("%s: expected ErrBadSignetSolution, got %v",
+				test.name, err)
+		}
+	}
+
+	// The genesis block doesn't need a solution.
+	genesis := btcutil.NewBlock(params.GenesisBlock)
+	if err := CheckSignetBlockSolution(genesis, &params); err != nil {
+		t.Fatalf("unexpected error for the genesis block: %v", err)
+	}
+}
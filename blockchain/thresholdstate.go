@@ -382,6 +382,157 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// DeploymentStats are the statistics of the signalling for a deployment in the
+// confirmation window of a block.
+type DeploymentStats struct {
+	// Period is the number of blocks in a confirmation window.
+	Period uint32
+
+	// Threshold is the number of blocks in a confirmation window that have
+	// to signal for the deployment to lock in.
+	Threshold uint32
+
+	// Elapsed is the number of blocks of the confirmation window up to and
+	// including the block and Count is how many of them signalled.
+	Elapsed uint32
+	Count   uint32
+
+	// Possible is whether the threshold can still be reached in the
+	// confirmation window.
+	Possible bool
+}
+
+// DeploymentInfo describes the state of a deployment at a block.
+type DeploymentInfo struct {
+	// State is the state of the deployment for the block and Since is the
+	// height of the first block that had the deployment in that state.
+	State ThresholdState
+	Since int32
+
+	// NextState is the state of the deployment for the block after the
+	// block and NextSince is the height of the first block that had or
+	// will have the deployment in that state.
+	NextState ThresholdState
+	NextSince int32
+
+	// Stats are the statistics of the signalling in the confirmation
+	// window of the block.  They're only set when the deployment is
+	// started or locked in for the block.
+	Stats *DeploymentStats
+}
+
+// DeploymentInfo returns the state of the given deployment ID at the block with
+// the given hash.  The block doesn't have to be in the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentInfo(hash *chainhash.Hash, deploymentID uint32) (*DeploymentInfo, error) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	info := &DeploymentInfo{}
+	var err error
+	info.State, err = b.deploymentState(node.parent, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	info.Since, err = b.deploymentStateSince(node.parent, deploymentID,
+		info.State)
+	if err != nil {
+		return nil, err
+	}
+	info.NextState, err = b.deploymentState(node, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	info.NextSince, err = b.deploymentStateSince(node, deploymentID,
+		info.NextState)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.State == ThresholdStarted || info.State == ThresholdLockedIn {
+		deployment := &b.chainParams.Deployments[deploymentID]
+		checker := deploymentChecker{deployment: deployment, chain: b}
+		info.Stats, err = deploymentStats(node, checker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// deploymentStateSince returns the height of the first block that had the
+// deployment in the given state, which has to be the state for the block AFTER
+// the passed node.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) deploymentStateSince(prevNode *blockNode, deploymentID uint32,
+	state ThresholdState) (int32, error) {
+
+	// Every deployment is defined from the genesis block on.
+	if state == ThresholdDefined {
+		return 0, nil
+	}
+
+	// The state is the same for all the blocks of a confirmation window so
+	// walk back a window at a time for as long as the state stays the same.
+	confirmationWindow := int32(b.chainParams.MinerConfirmationWindow)
+	prevNode = prevNode.Ancestor(prevNode.height -
+		(prevNode.height+1)%confirmationWindow)
+	for {
+		prevWindow := prevNode.RelativeAncestor(confirmationWindow)
+		if prevWindow == nil {
+			break
+		}
+		prevState, err := b.deploymentState(prevWindow, deploymentID)
+		if err != nil {
+			return 0, err
+		}
+		if prevState != state {
+			break
+		}
+		prevNode = prevWindow
+	}
+
+	return prevNode.height + 1, nil
+}
+
+// deploymentStats returns the statistics of the signalling in the confirmation
+// window of the given node up to and including the node.
+func deploymentStats(node *blockNode, checker thresholdConditionChecker) (*DeploymentStats, error) {
+	period := checker.MinerConfirmationWindow()
+	stats := &DeploymentStats{
+		Period:    period,
+		Threshold: checker.RuleChangeActivationThreshold(),
+		Elapsed:   uint32(node.height)%period + 1,
+	}
+
+	countNode := node
+	for i := uint32(0); i < stats.Elapsed && countNode != nil; i++ {
+		condition, err := checker.Condition(countNode)
+		if err != nil {
+			return nil, err
+		}
+		if condition {
+			stats.Count++
+		}
+		countNode = countNode.parent
+	}
+	stats.Possible = period-stats.Threshold >= stats.Elapsed-stats.Count
+
+	return stats, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
@@ -5,8 +5,11 @@
 package blockchain
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 )
 
@@ -316,3 +319,130 @@ func TestThresholdStateTransition(t *testing.T) {
 		}
 	}
 }
+
+// TestDeploymentInfo ensures the state, the heights the states started at and
+// the signalling statistics of a deployment are reported as expected over its
+// lifetime.
+func TestDeploymentInfo(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	chain := newFakeChain(&params)
+	window := int32(params.MinerConfirmationWindow)
+	bit := params.Deployments[chaincfg.DeploymentTestDummy].BitNumber
+
+	// Signal for the deployment with every block from the second window on.
+	node := chain.bestChain.Tip()
+	nodes := []*blockNode{node}
+	blockTime := node.Header().Timestamp
+	for height := int32(1); height <= window*4; height++ {
+		version := int32(vbTopBits)
+		if height >= window {
+			version |= 1 << bit
+		}
+		blockTime = blockTime.Add(time.Second)
+		node = newFakeNode(node, version, 0, blockTime)
+		chain.index.AddNode(node)
+		chain.bestChain.SetTip(node)
+		nodes = append(nodes, node)
+	}
+
+	tests := []struct {
+		height    int32
+		state     ThresholdState
+		since     int32
+		nextState ThresholdState
+		nextSince int32
+		stats     *DeploymentStats
+	}{
+		{
+			height:    100,
+			state:     ThresholdDefined,
+			nextState: ThresholdDefined,
+		},
+		{
+			height:    window - 1,
+			state:     ThresholdDefined,
+			nextState: ThresholdStarted,
+			nextSince: window,
+		},
+		{
+			height:    window + 56,
+			state:     ThresholdStarted,
+			since:     window,
+			nextState: ThresholdStarted,
+			nextSince: window,
+			stats: &DeploymentStats{
+				Period:    uint32(window),
+				Threshold: params.RuleChangeActivationThreshold,
+				Elapsed:   57,
+				Count:     57,
+				Possible:  true,
+			},
+		},
+		{
+			height:    window*2 - 1,
+			state:     ThresholdStarted,
+			since:     window,
+			nextState: ThresholdLockedIn,
+			nextSince: window * 2,
+			stats: &DeploymentStats{
+				Period:    uint32(window),
+				Threshold: params.RuleChangeActivationThreshold,
+				Elapsed:   uint32(window),
+				Count:     uint32(window),
+				Possible:  true,
+			},
+		},
+		{
+			height:    window * 2,
+			state:     ThresholdLockedIn,
+			since:     window * 2,
+			nextState: ThresholdLockedIn,
+			nextSince: window * 2,
+			stats: &DeploymentStats{
+				Period:    uint32(window),
+				Threshold: params.RuleChangeActivationThreshold,
+				Elapsed:   1,
+				Count:     1,
+				Possible:  true,
+			},
+		},
+		{
+			height:    window * 4,
+			state:     ThresholdActive,
+			since:     window * 3,
+			nextState: ThresholdActive,
+			nextSince: window * 3,
+		},
+	}
+
+	for _, test := range tests {
+		info, err := chain.DeploymentInfo(&nodes[test.height].hash,
+			chaincfg.DeploymentTestDummy)
+		if err != nil {
+			t.Fatalf("height %d: %v", test.height, err)
+		}
+		want := &DeploymentInfo{
+			State:     test.state,
+			Since:     test.since,
+			NextState: test.nextState,
+			NextSince: test.nextSince,
+			Stats:     test.stats,
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Fatalf("height %d: expected %+v (stats %+v), got %+v "+
+				"(stats %+v)", test.height, want, want.Stats,
+				info, info.Stats)
+		}
+	}
+
+	// Unknown blocks and deployments are rejected.
+	_, err := chain.DeploymentInfo(&chainhash.Hash{1},
+		chaincfg.DeploymentTestDummy)
+	if err == nil {
+		t.Fatal("expected an error for an unknown block")
+	}
+	_, err = chain.DeploymentInfo(&node.hash, chaincfg.DefinedDeployments)
+	if err == nil {
+		t.Fatal("expected an error for an unknown deployment")
+	}
+}
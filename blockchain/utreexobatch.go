@@ -0,0 +1,111 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"github.com/cockroachdb/pebble"
+)
+
+// UtreexoBatch is what the nodes and the cached leaves of the utreexo state are
+// written to when they're flushed.  Both *pebble.Batch and *SplitBatch
+// implement it.
+type UtreexoBatch interface {
+	Set(key, value []byte, opts *pebble.WriteOptions) error
+	Delete(key []byte, opts *pebble.WriteOptions) error
+}
+
+// Enforce SplitBatch and pebble.Batch to implement the UtreexoBatch interface.
+var (
+	_ UtreexoBatch = (*SplitBatch)(nil)
+	_ UtreexoBatch = (*pebble.Batch)(nil)
+)
+
+// SplitBatch writes to a pebble batch that's committed and replaced with a new
+// one every time it grows past a maximum size.  This keeps a flush of a large
+// utreexo cache from having to hold all of its writes in memory and commit them
+// all at once.
+//
+// Only the last commit uses the write options of the SplitBatch.  The earlier
+// ones are never synced as pebble logs the writes in order so syncing the last
+// commit syncs the ones before it as well.
+type SplitBatch struct {
+	db      *pebble.DB
+	batch   *pebble.Batch
+	maxSize int
+	opts    *pebble.WriteOptions
+	commits int
+}
+
+// NewSplitBatch returns a SplitBatch that writes to the given database and
+// commits its batch every time it's at least maxSize bytes big.  The batch is
+// never split when maxSize is 0.
+func NewSplitBatch(db *pebble.DB, maxSize int, opts *pebble.WriteOptions) *SplitBatch {
+	return &SplitBatch{
+		db:      db,
+		batch:   db.NewBatch(),
+		maxSize: maxSize,
+		opts:    opts,
+	}
+}
+
+// Set adds the key-value pair to the batch.  The write options are ignored.
+func (b *SplitBatch) Set(key, value []byte, _ *pebble.WriteOptions) error {
+	err := b.batch.Set(key, value, nil)
+	if err != nil {
+		return err
+	}
+
+	return b.maybeSplit()
+}
+
+// Delete adds the deletion of the key to the batch.  The write options are
+// ignored.
+func (b *SplitBatch) Delete(key []byte, _ *pebble.WriteOptions) error {
+	err := b.batch.Delete(key, nil)
+	if err != nil {
+		return err
+	}
+
+	return b.maybeSplit()
+}
+
+// maybeSplit commits the batch without syncing it and starts a new one if it
+// has grown past the maximum size.
+func (b *SplitBatch) maybeSplit() error {
+	if b.maxSize <= 0 || b.batch.Len() < b.maxSize {
+		return nil
+	}
+
+	err := b.commitBatch(pebble.NoSync)
+	if err != nil {
+		return err
+	}
+	b.batch = b.db.NewBatch()
+
+	return nil
+}
+
+// commitBatch commits and closes the current batch.
+func (b *SplitBatch) commitBatch(opts *pebble.WriteOptions) error {
+	err := b.batch.Commit(opts)
+	if err != nil {
+		b.batch.Close()
+		return err
+	}
+	b.commits++
+
+	return b.batch.Close()
+}
+
+// Commit commits what's left in the batch with the write options of the
+// SplitBatch.  The SplitBatch can't be used after Commit.
+func (b *SplitBatch) Commit() error {
+	return b.commitBatch(b.opts)
+}
+
+// Commits returns the number of batches that were committed.
+func (b *SplitBatch) Commits() int {
+	return b.commits
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/utreexo/utreexo"
+)
+
+func TestSplitBatch(t *testing.T) {
+	tmpDir := filepath.Join(os.TempDir(), "TestSplitBatch")
+	db, err := pebble.Open(tmpDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer db.Close()
+
+	nodesBackEnd, err := InitNodesBackEnd(db, 1*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := uint64(1000)
+	for i := uint64(0); i < count; i++ {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], i)
+		nodesBackEnd.Put(i, utreexo.Leaf{Hash: sha256.Sum256(buf[:])})
+	}
+
+	// Each node takes up a little over 33 bytes so the flush has to be
+	// split into many batches.
+	batch := NewSplitBatch(db, 1024, pebble.Sync)
+	err = nodesBackEnd.Flush(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Commits() < 20 {
+		t.Fatalf("expected the flush to be split into at least 20 "+
+			"batches but got %d", batch.Commits())
+	}
+	err = batch.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything that was flushed is read back after the cache was reset.
+	for i := uint64(0); i < count; i++ {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], i)
+		leaf, found := nodesBackEnd.Get(i)
+		if !found || leaf.Hash != sha256.Sum256(buf[:]) {
+			t.Fatalf("node %d wasn't read back after the flush", i)
+		}
+	}
+
+	// Nothing is committed before Commit without a maximum size.
+	batch = NewSplitBatch(db, 0, pebble.NoSync)
+	for i := uint64(0); i < count; i++ {
+		err = NodesBackendPut(batch, count+i, utreexo.Leaf{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if batch.Commits() != 0 {
+		t.Fatalf("expected no commits but got %d", batch.Commits())
+	}
+	err = batch.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Commits() != 1 {
+		t.Fatalf("expected a single commit but got %d", batch.Commits())
+	}
+}
@@ -5,7 +5,10 @@
 package blockchain
 
 import (
+	"encoding/binary"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cockroachdb/pebble"
 	"github.com/utreexo/utreexo"
@@ -49,6 +52,11 @@ type NodesBackEnd struct {
 	db           *pebble.DB
 	maxCacheElem int64
 	cache        utreexobackends.NodesMapSlice
+
+	// hits and misses are the counts of the lookups that were and weren't
+	// served by the cache.  They must be accessed atomically.
+	hits   uint64
+	misses uint64
 }
 
 // InitNodesBackEnd returns a newly initialized NodesBackEnd which implements
@@ -91,6 +99,8 @@ func (m *NodesBackEnd) Get(k uint64) (utreexo.Leaf, bool) {
 	// Look it up on the cache first.
 	cLeaf, found := m.cache.Get(k)
 	if found {
+		atomic.AddUint64(&m.hits, 1)
+
 		// The leaf might not have been cleaned up yet.
 		if cLeaf.IsRemoved() {
 			return utreexo.Leaf{}, false
@@ -101,6 +111,7 @@ func (m *NodesBackEnd) Get(k uint64) (utreexo.Leaf, bool) {
 	}
 
 	// Since it's not in the cache, look it up in the database.
+	atomic.AddUint64(&m.misses, 1)
 	leaf, found := m.dbGet(k)
 	if !found {
 		// If it's not in the database and the cache, it
@@ -115,7 +126,7 @@ func (m *NodesBackEnd) Get(k uint64) (utreexo.Leaf, bool) {
 }
 
 // NodesBackendPut puts a key-value pair in the given pebbledb batch.
-func NodesBackendPut(batch *pebble.Batch, k uint64, v utreexo.Leaf) error {
+func NodesBackendPut(batch UtreexoBatch, k uint64, v utreexo.Leaf) error {
 	size := serializeSizeVLQ(k)
 	buf := make([]byte, size)
 	putVLQ(buf, k)
@@ -147,7 +158,7 @@ func (m *NodesBackEnd) Put(k uint64, v utreexo.Leaf) {
 }
 
 // NodesBackendDelete deletes the corresponding key-value pair from the given pebble tx.
-func NodesBackendDelete(batch *pebble.Batch, k uint64) error {
+func NodesBackendDelete(batch UtreexoBatch, k uint64) error {
 	size := serializeSizeVLQ(k)
 	buf := make([]byte, size)
 	putVLQ(buf, k)
@@ -220,7 +231,7 @@ func (m *NodesBackEnd) ForEach(fn func(uint64, utreexo.Leaf) error) error {
 
 	iter, _ := m.db.NewIter(nil)
 	defer iter.Close()
-	for iter.Next() {
+	for iter.First(); iter.Valid(); iter.Next() {
 		// The relevant key-value pairs for nodesbackend are leafLength.
 		// Skip it since it's not relevant here.
 		value := iter.Value()
@@ -257,8 +268,16 @@ func (m *NodesBackEnd) UsageStats() (int64, int64) {
 	return int64(m.cache.Length()), m.maxCacheElem
 }
 
+// CacheStats returns the count of the lookups that were served by the cache and
+// the count of the lookups that had to go to the database.
+//
+// This function is safe for concurrent access.
+func (m *NodesBackEnd) CacheStats() (uint64, uint64) {
+	return atomic.LoadUint64(&m.hits), atomic.LoadUint64(&m.misses)
+}
+
 // flush saves all the cached entries to disk and resets the cache map.
-func (m *NodesBackEnd) Flush(batch *pebble.Batch) error {
+func (m *NodesBackEnd) Flush(batch UtreexoBatch) error {
 	err := m.cache.ForEach(func(k uint64, v utreexobackends.CachedLeaf) error {
 		if v.IsFresh() {
 			if !v.IsRemoved() {
@@ -291,6 +310,82 @@ func (m *NodesBackEnd) Flush(batch *pebble.Batch) error {
 	return nil
 }
 
+// cachedLeavesGarbageKey is the key the estimate of the live and the garbage
+// entries of the cached leaves is stored under.  It's not chainhash.HashSize
+// long so it's never mistaken for a cached leaf.
+var cachedLeavesGarbageKey = []byte("cachedleavesgarbage")
+
+// CachedLeavesGarbage is an estimate of the cached leaves entries in the
+// database.  Live is the count of the leaves that are stored while Garbage is
+// the count of the tombstones of the deleted leaves and the overwritten
+// positions of the moved leaves that take up space until the database is
+// compacted.
+type CachedLeavesGarbage struct {
+	Live    uint64
+	Garbage uint64
+}
+
+// Ratio returns the share of the entries that are garbage.  It's 0 when there
+// are no entries.
+func (g CachedLeavesGarbage) Ratio() float64 {
+	total := g.Live + g.Garbage
+	if total == 0 {
+		return 0
+	}
+	return float64(g.Garbage) / float64(total)
+}
+
+// serializeCachedLeavesGarbage serializes the garbage estimate to 16 bytes.
+func serializeCachedLeavesGarbage(g CachedLeavesGarbage) []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[:8], g.Live)
+	binary.LittleEndian.PutUint64(buf[8:], g.Garbage)
+	return buf
+}
+
+// deserializeCachedLeavesGarbage deserializes the garbage estimate serialized
+// with serializeCachedLeavesGarbage.
+func deserializeCachedLeavesGarbage(buf []byte) (CachedLeavesGarbage, error) {
+	if len(buf) != 16 {
+		return CachedLeavesGarbage{}, fmt.Errorf("cached leaves garbage "+
+			"estimate is %d bytes instead of 16", len(buf))
+	}
+	return CachedLeavesGarbage{
+		Live:    binary.LittleEndian.Uint64(buf[:8]),
+		Garbage: binary.LittleEndian.Uint64(buf[8:]),
+	}, nil
+}
+
+// dbFetchCachedLeavesGarbage fetches the stored garbage estimate.  The live
+// entries are counted if there isn't one, which is only the case for
+// databases that were written before the estimate was kept.
+func dbFetchCachedLeavesGarbage(db *pebble.DB) (CachedLeavesGarbage, error) {
+	val, closer, err := db.Get(cachedLeavesGarbageKey)
+	if err == nil {
+		defer closer.Close()
+		return deserializeCachedLeavesGarbage(val)
+	}
+	if err != pebble.ErrNotFound {
+		return CachedLeavesGarbage{}, err
+	}
+
+	log.Infof("Counting the cached leaves of the utreexo state...")
+	iter, err := db.NewIter(nil)
+	if err != nil {
+		return CachedLeavesGarbage{}, err
+	}
+	defer iter.Close()
+
+	var g CachedLeavesGarbage
+	for iter.First(); iter.Valid(); iter.Next() {
+		if len(iter.Key()) == chainhash.HashSize {
+			g.Live++
+		}
+	}
+
+	return g, iter.Error()
+}
+
 var _ utreexo.CachedLeavesInterface = (*CachedLeavesBackEnd)(nil)
 
 // CachedLeavesBackEnd implements the CachedLeavesInterface interface. The cache assumes
@@ -299,6 +394,16 @@ type CachedLeavesBackEnd struct {
 	db           *pebble.DB
 	maxCacheElem int64
 	cache        utreexobackends.CachedLeavesMapSlice
+
+	// hits and misses are the counts of the lookups that were and weren't
+	// served by the cache.  They must be accessed atomically.
+	hits   uint64
+	misses uint64
+
+	// garbage is the estimate of the live and the garbage entries in the
+	// database as of the last flush.
+	garbageMtx sync.Mutex
+	garbage    CachedLeavesGarbage
 }
 
 // dbGet fetches and deserializes the value from the database.
@@ -317,16 +422,24 @@ func (m *CachedLeavesBackEnd) dbGet(k utreexo.Hash) (uint64, bool) {
 // InitCachedLeavesBackEnd returns a newly initialized CachedLeavesBackEnd which implements
 // utreexo.CachedLeavesInterface.
 func InitCachedLeavesBackEnd(db *pebble.DB, maxMemoryUsage int64) (*CachedLeavesBackEnd, error) {
+	garbage, err := dbFetchCachedLeavesGarbage(db)
+	if err != nil {
+		return nil, err
+	}
 	cache, maxCacheElem := utreexobackends.NewCachedLeavesMapSlice(maxMemoryUsage)
-	return &CachedLeavesBackEnd{maxCacheElem: maxCacheElem, db: db, cache: cache}, nil
+	return &CachedLeavesBackEnd{maxCacheElem: maxCacheElem, db: db, cache: cache,
+		garbage: garbage}, nil
 }
 
 // Get returns the data from the underlying cache or the database.
 func (m *CachedLeavesBackEnd) Get(k utreexo.Hash) (uint64, bool) {
 	pos, found := m.cache.Get(k)
 	if !found {
+		atomic.AddUint64(&m.misses, 1)
 		return m.dbGet(k)
 	}
+	atomic.AddUint64(&m.hits, 1)
+
 	// Even if the entry was found, if the position value is math.MaxUint64,
 	// then it was already deleted.
 	if pos.IsRemoved() {
@@ -337,7 +450,7 @@ func (m *CachedLeavesBackEnd) Get(k utreexo.Hash) (uint64, bool) {
 }
 
 // CachedLeavesBackendPut puts a key-value pair in the given pebbledb batch.
-func CachedLeavesBackendPut(tx *pebble.Batch, k utreexo.Hash, v uint64) error {
+func CachedLeavesBackendPut(tx UtreexoBatch, k utreexo.Hash, v uint64) error {
 	size := serializeSizeVLQ(v)
 	buf := make([]byte, size)
 	putVLQ(buf, v)
@@ -358,8 +471,14 @@ func (m *CachedLeavesBackEnd) Put(k utreexo.Hash, v uint64) {
 func (m *CachedLeavesBackEnd) Delete(k utreexo.Hash) {
 	pos, found := m.cache.Get(k)
 	if found && pos.IsFresh() {
-		m.cache.Delete(k)
-		return
+		// A leaf that was moved is put in the cache as fresh even though
+		// its old position is still in the database.  It has to be
+		// deleted from the database as well or it'd be left there for
+		// good.
+		if _, inDB := m.dbGet(k); !inDB {
+			m.cache.Delete(k)
+			return
+		}
 	}
 	p := utreexobackends.CachedPosition{
 		Position: pos.Position,
@@ -413,7 +532,7 @@ func (m *CachedLeavesBackEnd) ForEach(fn func(utreexo.Hash, uint64) error) error
 	})
 	iter, _ := m.db.NewIter(nil)
 	defer iter.Close()
-	for iter.Next() {
+	for iter.First(); iter.Valid(); iter.Next() {
 		// If the itered key is not chainhash.HashSize, it's not for cachedLeavesBackend.
 		// Skip it since it's not relevant here.
 		if len(iter.Key()) != chainhash.HashSize {
@@ -448,15 +567,64 @@ func (m *CachedLeavesBackEnd) UsageStats() (int64, int64) {
 	return int64(m.cache.Length()), m.maxCacheElem
 }
 
+// CacheStats returns the count of the lookups that were served by the cache and
+// the count of the lookups that had to go to the database.
+//
+// This function is safe for concurrent access.
+func (m *CachedLeavesBackEnd) CacheStats() (uint64, uint64) {
+	return atomic.LoadUint64(&m.hits), atomic.LoadUint64(&m.misses)
+}
+
+// GarbageStats returns the estimate of the live and the garbage entries of the
+// cached leaves in the database as of the last flush.
+//
+// This function is safe for concurrent access.
+func (m *CachedLeavesBackEnd) GarbageStats() CachedLeavesGarbage {
+	m.garbageMtx.Lock()
+	defer m.garbageMtx.Unlock()
+	return m.garbage
+}
+
+// ForgetGarbage takes the given count of garbage entries off the estimate.  It's
+// meant to be called with the garbage from before the database was compacted
+// once it's done.  The new estimate is saved on the next flush.
+//
+// This function is safe for concurrent access.
+func (m *CachedLeavesBackEnd) ForgetGarbage(count uint64) {
+	m.garbageMtx.Lock()
+	defer m.garbageMtx.Unlock()
+
+	if count > m.garbage.Garbage {
+		count = m.garbage.Garbage
+	}
+	m.garbage.Garbage -= count
+}
+
 // Flush resets the cache and saves all the key values onto the database.
-func (m *CachedLeavesBackEnd) Flush(batch *pebble.Batch) error {
+func (m *CachedLeavesBackEnd) Flush(batch UtreexoBatch) error {
+	m.garbageMtx.Lock()
+	defer m.garbageMtx.Unlock()
+
+	garbage := m.garbage
 	err := m.cache.ForEach(func(k utreexo.Hash, v utreexobackends.CachedPosition) error {
+		// Both the tombstones and the old entries of the keys that are
+		// overwritten take up space until they're compacted away.
+		_, inDB := m.dbGet(k)
 		if v.IsRemoved() {
+			garbage.Garbage++
+			if inDB && garbage.Live > 0 {
+				garbage.Live--
+			}
 			err := batch.Delete(k[:], nil)
 			if err != nil {
 				return err
 			}
 		} else {
+			if inDB {
+				garbage.Garbage++
+			} else {
+				garbage.Live++
+			}
 			err := CachedLeavesBackendPut(batch, k, v.Position)
 			if err != nil {
 				return err
@@ -468,7 +636,13 @@ func (m *CachedLeavesBackEnd) Flush(batch *pebble.Batch) error {
 	if err != nil {
 		return fmt.Errorf("CachedLeavesBackEnd flush error. %v", err)
 	}
+	err = batch.Set(cachedLeavesGarbageKey,
+		serializeCachedLeavesGarbage(garbage), nil)
+	if err != nil {
+		return fmt.Errorf("CachedLeavesBackEnd flush error. %v", err)
+	}
 
+	m.garbage = garbage
 	m.cache.ClearMaps()
 	return nil
 }
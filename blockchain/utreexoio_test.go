@@ -280,3 +280,126 @@ func TestNodesBackEnd(t *testing.T) {
 		}
 	}
 }
+
+func TestBackEndCacheStats(t *testing.T) {
+	tmpDir := filepath.Join(os.TempDir(), "TestBackEndCacheStats")
+	db, err := pebble.Open(tmpDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer db.Close()
+
+	nodesBackEnd, err := InitNodesBackEnd(db, 1*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedLeavesBackEnd, err := InitCachedLeavesBackEnd(db, 1*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte{1})
+	nodesBackEnd.Put(0, utreexo.Leaf{Hash: hash})
+	cachedLeavesBackEnd.Put(hash, 0)
+
+	// One lookup that's in the cache and two that aren't.
+	nodesBackEnd.Get(0)
+	nodesBackEnd.Get(1)
+	nodesBackEnd.Get(2)
+	cachedLeavesBackEnd.Get(hash)
+	cachedLeavesBackEnd.Get(utreexo.Hash{})
+	cachedLeavesBackEnd.Get(utreexo.Hash{1})
+
+	hits, misses := nodesBackEnd.CacheStats()
+	if hits != 1 || misses != 2 {
+		t.Fatalf("expected 1 hit and 2 misses for the nodes but got %d hits "+
+			"and %d misses", hits, misses)
+	}
+	hits, misses = cachedLeavesBackEnd.CacheStats()
+	if hits != 1 || misses != 2 {
+		t.Fatalf("expected 1 hit and 2 misses for the cached leaves but got "+
+			"%d hits and %d misses", hits, misses)
+	}
+}
+
+func TestCachedLeavesGarbage(t *testing.T) {
+	tmpDir := filepath.Join(os.TempDir(), "TestCachedLeavesGarbage")
+	db, err := pebble.Open(tmpDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	defer db.Close()
+
+	cachedLeavesBackEnd, err := InitCachedLeavesBackEnd(db, 1*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flush := func() {
+		batch := db.NewBatch()
+		err := cachedLeavesBackEnd.Flush(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = batch.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(live, garbage uint64) {
+		t.Helper()
+		got := cachedLeavesBackEnd.GarbageStats()
+		if got.Live != live || got.Garbage != garbage {
+			t.Fatalf("expected %d live and %d garbage entries, got %+v",
+				live, garbage, got)
+		}
+	}
+
+	hashes := make([]utreexo.Hash, 10)
+	for i := range hashes {
+		hashes[i] = sha256.Sum256([]byte{byte(i)})
+		cachedLeavesBackEnd.Put(hashes[i], uint64(i))
+	}
+	flush()
+	check(10, 0)
+
+	// The estimate is kept across restarts.
+	cachedLeavesBackEnd, err = InitCachedLeavesBackEnd(db, 1*1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(10, 0)
+
+	// Moving leaves leaves their old entries behind and deleting them
+	// leaves tombstones.  A leaf that's added and deleted before a flush
+	// never makes it to the database.
+	cachedLeavesBackEnd.Put(hashes[0], 20)
+	cachedLeavesBackEnd.Put(hashes[1], 21)
+	cachedLeavesBackEnd.Delete(hashes[2])
+	cachedLeavesBackEnd.Delete(hashes[3])
+	added := sha256.Sum256([]byte{100})
+	cachedLeavesBackEnd.Put(added, 100)
+	cachedLeavesBackEnd.Delete(added)
+	flush()
+	check(8, 4)
+
+	// A leaf that's moved and then deleted is deleted from the database.
+	cachedLeavesBackEnd.Put(hashes[4], 24)
+	cachedLeavesBackEnd.Delete(hashes[4])
+	flush()
+	check(7, 5)
+	if _, found := cachedLeavesBackEnd.Get(hashes[4]); found {
+		t.Fatalf("expected the moved leaf to be deleted")
+	}
+	if length := cachedLeavesBackEnd.Length(); length != 7 {
+		t.Fatalf("expected 7 cached leaves, got %d", length)
+	}
+
+	ratio := cachedLeavesBackEnd.GarbageStats().Ratio()
+	if ratio != 5.0/12.0 {
+		t.Fatalf("expected a garbage ratio of %v, got %v", 5.0/12.0, ratio)
+	}
+	cachedLeavesBackEnd.ForgetGarbage(10)
+	check(7, 0)
+}
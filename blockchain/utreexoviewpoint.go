@@ -26,6 +26,11 @@ type UtreexoViewpoint struct {
 	// It only holds the root hashes and the number of elements in the
 	// accumulator.
 	accumulator utreexo.MapPollard
+
+	// remember returns whether the proof of the given newly created utxo
+	// should be kept in the accumulator.  It's nil when no proofs of new
+	// utxos are kept.
+	remember func(wire.OutPoint) bool
 }
 
 // CopyWithRoots returns a new utreexo viewpoint with just the roots copied.
@@ -48,7 +53,7 @@ func (uview *UtreexoViewpoint) ProcessUData(block *btcutil.Block,
 
 	// Extracts the block into additions and deletions that will be processed.
 	// Adds correspond to newly created UTXOs and dels correspond to STXOs.
-	adds, err := ExtractAccumulatorAdds(block, []uint32{})
+	adds, err := ExtractAccumulatorAdds(block, uview.blockRemembers(block))
 	if err != nil {
 		return err
 	}
@@ -340,6 +345,54 @@ func (b *BlockChain) ReconstructUData(ud *wire.UData, blockHash chainhash.Hash)
 	return delHashes, nil
 }
 
+// SpentTxOutsFromLeafDatas returns the outputs spent by the block in the same
+// order as the spend journal has them, put together from the reconstructed leaf
+// datas of the block's utreexo proof.  The outputs created and spent within the
+// block aren't in the leaf datas so they're taken from the block itself.  This
+// lets the indexes that need the spent outputs be built without the spend
+// journal or the utxo set.
+func SpentTxOutsFromLeafDatas(block *btcutil.Block,
+	leafDatas []wire.LeafData) ([]SpentTxOut, error) {
+
+	spent := make(map[wire.OutPoint]SpentTxOut, len(leafDatas))
+	for _, ld := range leafDatas {
+		spent[ld.OutPoint] = SpentTxOut{
+			Amount:     ld.Amount,
+			PkScript:   ld.PkScript,
+			Height:     ld.Height,
+			IsCoinBase: ld.IsCoinBase,
+		}
+	}
+
+	stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+	for txIdx, tx := range block.Transactions() {
+		if txIdx != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				stxo, found := spent[txIn.PreviousOutPoint]
+				if !found {
+					return nil, fmt.Errorf("the leaf datas of block "+
+						"%v are missing the spent output %v",
+						block.Hash(), txIn.PreviousOutPoint)
+				}
+				stxos = append(stxos, stxo)
+			}
+		}
+
+		// The outputs may be spent by the transactions after this one.
+		for outIdx, txOut := range tx.MsgTx().TxOut {
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			spent[op] = SpentTxOut{
+				Amount:     txOut.Value,
+				PkScript:   txOut.PkScript,
+				Height:     block.Height(),
+				IsCoinBase: txIdx == 0,
+			}
+		}
+	}
+
+	return stxos, nil
+}
+
 // reconstructUData adds in missing information to the passed in compact UData and
 // makes it full. The hashes returned are the hashes of the individual leaf data
 // that were commited into the accumulator.
@@ -516,7 +569,11 @@ func BlockToAddLeaves(block *btcutil.Block, skiplist []uint32, remembers []uint3
 			}
 
 			// Set remember to be true if the current UTXO corresponds
-			// to an index that should be remembered.
+			// to an index that should be remembered.  Remembers of the
+			// skipped utxos are dropped.
+			for len(remembers) > 0 && remembers[0] < txonum {
+				remembers = remembers[1:]
+			}
 			remember := false
 			if len(remembers) > 0 && remembers[0] == txonum {
 				remembers = remembers[1:]
@@ -536,6 +593,47 @@ func BlockToAddLeaves(block *btcutil.Block, skiplist []uint32, remembers []uint3
 	return leaves
 }
 
+// BlockToAddLeafDatas returns the leaf datas of the newly created utxos in a
+// block in the order they're committed to the utreexo accumulator.  The skiplist
+// is the same as the one for BlockToAddLeaves.
+func BlockToAddLeafDatas(block *btcutil.Block, skiplist []uint32,
+	outCount int) []wire.LeafData {
+
+	leafDatas := make([]wire.LeafData, 0, outCount-len(skiplist))
+
+	var txonum uint32
+	for coinbase, tx := range block.Transactions() {
+		for outIdx, txOut := range tx.MsgTx().TxOut {
+			// Skip all the OP_RETURNs
+			if IsUnspendable(txOut) {
+				txonum++
+				continue
+			}
+			// Skip txos on the skip list
+			if len(skiplist) > 0 && skiplist[0] == txonum {
+				skiplist = skiplist[1:]
+				txonum++
+				continue
+			}
+
+			leafDatas = append(leafDatas, wire.LeafData{
+				BlockHash: *block.Hash(),
+				OutPoint: wire.OutPoint{
+					Hash:  *tx.Hash(),
+					Index: uint32(outIdx),
+				},
+				Amount:     txOut.Value,
+				PkScript:   txOut.PkScript,
+				Height:     block.Height(),
+				IsCoinBase: coinbase == 0,
+			})
+			txonum++
+		}
+	}
+
+	return leafDatas
+}
+
 // ExcludedUtxo is the utxo that was excluded because it was spent and created
 // within a given block interval.  It includes the creation height and the outpoint
 // of the utxo.
@@ -563,6 +661,16 @@ func BlockToDelLeaves(stxos []SpentTxOut, chain *BlockChain, block *btcutil.Bloc
 		return nil, fmt.Errorf("Passed in chain is nil. Cannot make delLeaves")
 	}
 
+	// When the block was reorganized out of the main chain, the outputs it
+	// spends that were created after the fork are in blocks that are no
+	// longer in the main chain either.  Those are looked up by walking back
+	// from the block instead.
+	var node, fork *blockNode
+	if n := chain.index.LookupNode(block.Hash()); n != nil && !chain.bestChain.Contains(n) {
+		node = n
+		fork = chain.bestChain.FindFork(n)
+	}
+
 	var blockInIdx uint32
 	for idx, tx := range block.Transactions() {
 		if idx == 0 {
@@ -586,9 +694,14 @@ func BlockToDelLeaves(stxos []SpentTxOut, chain *BlockChain, block *btcutil.Bloc
 
 			stxo := stxos[blockInIdx-1]
 
-			blockHash, err := chain.BlockHashByHeight(stxo.Height)
-			if err != nil {
-				return nil, err
+			var blockHash *chainhash.Hash
+			if fork != nil && stxo.Height > fork.height {
+				blockHash = &node.Ancestor(stxo.Height).hash
+			} else {
+				blockHash, err = chain.BlockHashByHeight(stxo.Height)
+				if err != nil {
+					return nil, err
+				}
 			}
 			if blockHash == nil {
 				return nil, fmt.Errorf("Couldn't find blockhash for height %d",
@@ -835,6 +948,45 @@ func (uview *UtreexoViewpoint) PruneAll() {
 	uview.accumulator = newUView.accumulator
 }
 
+// blockRemembers returns the indexes of the outputs of the block whose proofs
+// are to be kept in the accumulator as decided by the remember function of the
+// viewpoint.  The outputs are indexed in the same way as in BlockToAddLeaves.
+func (uview *UtreexoViewpoint) blockRemembers(block *btcutil.Block) []uint32 {
+	if uview.remember == nil {
+		return nil
+	}
+
+	var remembers []uint32
+	var txonum uint32
+	for _, tx := range block.Transactions() {
+		for outIdx, txOut := range tx.MsgTx().TxOut {
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			if !IsUnspendable(txOut) && uview.remember(op) {
+				remembers = append(remembers, txonum)
+			}
+			txonum++
+		}
+	}
+
+	return remembers
+}
+
+// SetUtreexoRememberFunc sets the function that decides which of the utxos
+// created by the connected blocks have their proofs kept in the accumulator.
+// This lets the proofs of the utxos spent by unconfirmed transactions be
+// generated once the utxos are confirmed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetUtreexoRememberFunc(remember func(wire.OutPoint) bool) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	b.utreexoRemember = remember
+	if b.utreexoView != nil {
+		b.utreexoView.remember = remember
+	}
+}
+
 // NewUtreexoViewpoint returns an empty UtreexoViewpoint
 func NewUtreexoViewpoint() *UtreexoViewpoint {
 	return &UtreexoViewpoint{
@@ -848,6 +1000,7 @@ func (b *BlockChain) SetUtreexoStateFromAssumePoint() {
 	b.utreexoView = &UtreexoViewpoint{
 		accumulator: utreexo.NewMapPollardFromRoots(
 			b.assumeUtreexoPoint.Roots, b.assumeUtreexoPoint.NumLeaves, false),
+		remember: b.utreexoRemember,
 	}
 }
 
@@ -876,7 +1029,8 @@ func (b *BlockChain) IsUtreexoViewActive() bool {
 
 // IsAssumeUtreexo returns true if the assume utreexo points are set.
 func (b *BlockChain) IsAssumeUtreexo() bool {
-	return len(b.assumeUtreexoPoint.Roots) > 0 && len(b.utreexoView.GetRoots()) == 0
+	return (len(b.assumeUtreexoPoint.Roots) > 0 || b.assumeUtreexoPoint.RootsHash != nil) &&
+		len(b.utreexoView.GetRoots()) == 0
 }
 
 // VerifyUData processes the given UData and then verifies that the proof validates
@@ -1029,6 +1183,24 @@ func (b *BlockChain) PruneFromAccumulator(leaves []wire.LeafData) error {
 	return nil
 }
 
+// CacheAccProof verifies the given accumulator proof against the current roots
+// and caches the proven hashes in the accumulator so that they're kept up to
+// date as blocks are connected.  Caching hashes that are already cached has no
+// effect.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CacheAccProof(hashes []utreexo.Hash, proof *utreexo.Proof) error {
+	if b.utreexoView == nil {
+		return fmt.Errorf("This blockchain instance doesn't have an " +
+			"accumulator. Cannot cache the proof")
+	}
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	return b.utreexoView.accumulator.Verify(hashes, *proof, true)
+}
+
 // packedPositions fetches and returns the positions of the leafHashes as chainhash.Hash.
 //
 // This function is NOT safe for concurrent access.
@@ -1077,6 +1249,68 @@ func (b *BlockChain) GetNeededPositions(packedPositions []chainhash.Hash) []chai
 	return chainhash.Uint64sToPackedHashes(missing)
 }
 
+// GetMissingLeafProofPositions returns the positions of the hashes that are
+// missing from the accumulator to prove the given leaf hashes.  False is
+// returned if any of the leaves aren't cached as their positions aren't known.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) GetMissingLeafProofPositions(leafHashes []utreexo.Hash) ([]uint64, bool) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if b.utreexoView == nil {
+		return nil, false
+	}
+
+	// The position of a leaf that isn't cached is returned as 0 so make
+	// sure that the leaf is actually there.
+	positions := b.utreexoView.accumulator.GetLeafHashPositions(leafHashes)
+	for i, pos := range positions {
+		if b.utreexoView.accumulator.GetHash(pos) != leafHashes[i] {
+			return nil, false
+		}
+	}
+
+	return b.utreexoView.accumulator.GetMissingPositions(positions), true
+}
+
+// FetchCachedHashes returns the hashes at the given positions from the accumulator.
+// An empty hash is returned for the positions that are not cached.  The passed in
+// bestHash and numLeaves must match the tip of the chain and the number of leaves
+// of the accumulator as the positions would otherwise point to different nodes.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchCachedHashes(bestHash *chainhash.Hash, numLeaves uint64,
+	positions []uint64) ([]utreexo.Hash, error) {
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if b.utreexoView == nil {
+		return nil, fmt.Errorf("This blockchain instance doesn't have an " +
+			"accumulator. Cannot fetch cached hashes")
+	}
+
+	tipHash := b.bestChain.Tip().hash
+	if !tipHash.IsEqual(bestHash) {
+		return nil, fmt.Errorf("Accumulator is at block %v but %v was given",
+			tipHash, bestHash)
+	}
+
+	accNumLeaves := b.utreexoView.accumulator.GetNumLeaves()
+	if accNumLeaves != numLeaves {
+		return nil, fmt.Errorf("Accumulator has %d leaves but %d was given",
+			accNumLeaves, numLeaves)
+	}
+
+	hashes := make([]utreexo.Hash, len(positions))
+	for i, pos := range positions {
+		hashes[i] = b.utreexoView.accumulator.GetHash(pos)
+	}
+
+	return hashes, nil
+}
+
 // FetchUtreexoViewpoint returns the utreexo viewpoint at the given block hash.
 // returns nil if it wasn't found.
 //
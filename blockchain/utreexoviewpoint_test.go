@@ -9,6 +9,8 @@ import (
 	"testing"
 
 	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/wire"
 )
 
 func TestChainTipProofSerialize(t *testing.T) {
@@ -66,3 +68,199 @@ func TestChainTipProofSerialize(t *testing.T) {
 
 	}
 }
+
+func TestGetMissingLeafProofPositions(t *testing.T) {
+	// Only the first leaf is remembered so it's the only one whose proof
+	// is cached.
+	uview := NewUtreexoViewpoint()
+	adds := make([]utreexo.Leaf, 8)
+	for i := range adds {
+		adds[i] = utreexo.Leaf{Hash: utreexo.Hash{byte(i + 1)}, Remember: i == 0}
+	}
+	err := uview.accumulator.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &BlockChain{utreexoView: uview}
+
+	missing, ok := b.GetMissingLeafProofPositions([]utreexo.Hash{adds[0].Hash})
+	if !ok || len(missing) != 0 {
+		t.Fatalf("expected the proof to be cached, got %v, %v", missing, ok)
+	}
+
+	// The position of a leaf that isn't cached isn't known.
+	_, ok = b.GetMissingLeafProofPositions([]utreexo.Hash{adds[0].Hash, adds[5].Hash})
+	if ok {
+		t.Fatal("expected the leaf that isn't cached to not be found")
+	}
+
+	// Dropping the sibling of the leaf leaves a hole in its proof.
+	uview.accumulator.Nodes.Delete(1)
+	missing, ok = b.GetMissingLeafProofPositions([]utreexo.Hash{adds[0].Hash})
+	if !ok || !reflect.DeepEqual(missing, []uint64{1}) {
+		t.Fatalf("expected position 1 to be missing, got %v, %v", missing, ok)
+	}
+}
+
+func TestBlockRemembers(t *testing.T) {
+	// A block with a coinbase and a tx with an OP_RETURN output in between
+	// two spendable ones, the first of which is spent by another tx in the
+	// same block.
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{})
+	coinbase.AddTxOut(wire.NewTxOut(50, []byte{0x51}))
+
+	tx1 := wire.NewMsgTx(1)
+	tx1.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: 7}})
+	tx1.AddTxOut(wire.NewTxOut(1, []byte{0x51}))
+	tx1.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+	tx1.AddTxOut(wire.NewTxOut(2, []byte{0x52}))
+
+	tx2 := wire.NewMsgTx(1)
+	tx2.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: tx1.TxHash(), Index: 0},
+	})
+	tx2.AddTxOut(wire.NewTxOut(1, []byte{0x53}))
+
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, tx1, tx2},
+	})
+
+	// Nothing is remembered without a remember function.
+	uview := NewUtreexoViewpoint()
+	if remembers := uview.blockRemembers(block); remembers != nil {
+		t.Fatalf("expected no remembers, got %v", remembers)
+	}
+
+	// Remember every output of the txs but the coinbase.  The spent and
+	// the unspendable outputs don't make it to the accumulator.
+	uview.remember = func(op wire.OutPoint) bool {
+		return op.Hash != coinbase.TxHash()
+	}
+	remembers := uview.blockRemembers(block)
+	if !reflect.DeepEqual(remembers, []uint32{1, 3, 4}) {
+		t.Fatalf("expected remembers [1 3 4], got %v", remembers)
+	}
+
+	adds, err := ExtractAccumulatorAdds(block, remembers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adds) != 3 {
+		t.Fatalf("expected 3 adds, got %d", len(adds))
+	}
+	for i, want := range []bool{false, true, true} {
+		if adds[i].Remember != want {
+			t.Fatalf("expected add %d to have remember=%v", i, want)
+		}
+	}
+}
+
+func TestSpentTxOutsFromLeafDatas(t *testing.T) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(50, []byte{0x51}))
+
+	// The first transaction spends an output from an earlier block and the
+	// second one spends the output of the first.
+	prevOut := wire.OutPoint{Hash: [32]byte{1}, Index: 2}
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(&wire.TxIn{PreviousOutPoint: prevOut})
+	spend.AddTxOut(wire.NewTxOut(40, []byte{0x52}))
+
+	sameBlockSpend := wire.NewMsgTx(1)
+	sameBlockSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: spend.TxHash()},
+	})
+	sameBlockSpend.AddTxOut(wire.NewTxOut(30, []byte{0x53}))
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	msgBlock.AddTransaction(coinbase)
+	msgBlock.AddTransaction(spend)
+	msgBlock.AddTransaction(sameBlockSpend)
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(100)
+
+	leafDatas := []wire.LeafData{{
+		OutPoint:   prevOut,
+		Height:     10,
+		IsCoinBase: true,
+		Amount:     45,
+		PkScript:   []byte{0x54},
+	}}
+	stxos, err := SpentTxOutsFromLeafDatas(block, leafDatas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SpentTxOut{
+		{Amount: 45, PkScript: []byte{0x54}, Height: 10, IsCoinBase: true},
+		{Amount: 40, PkScript: []byte{0x52}, Height: 100},
+	}
+	if !reflect.DeepEqual(stxos, want) {
+		t.Fatalf("got %+v, want %+v", stxos, want)
+	}
+
+	if _, err := SpentTxOutsFromLeafDatas(block, nil); err == nil {
+		t.Fatal("expected an error for missing leaf datas")
+	}
+}
+
+func TestCacheAccProof(t *testing.T) {
+	leaves := make([]utreexo.Leaf, 8)
+	for i := range leaves {
+		leaves[i] = utreexo.Leaf{Hash: utreexo.Hash{byte(i + 1)}}
+	}
+
+	// Prove with a full accumulator since the one of the chain doesn't
+	// cache anything.
+	full := utreexo.NewMapPollard(true)
+	err := full.Modify(leaves, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := []utreexo.Hash{leaves[2].Hash, leaves[5].Hash}
+	proof, err := full.Prove(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&BlockChain{}).CacheAccProof(hashes, &proof); err == nil {
+		t.Fatalf("expected an error without an accumulator")
+	}
+
+	b := &BlockChain{utreexoView: NewUtreexoViewpoint()}
+	err = b.utreexoView.accumulator.Modify(leaves, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.utreexoView.accumulator.Prove(hashes); err == nil {
+		t.Fatalf("expected the hashes to not be cached")
+	}
+
+	// A proof that doesn't commit to the roots isn't cached.
+	bad := utreexo.Proof{Targets: proof.Targets, Proof: make([]utreexo.Hash, len(proof.Proof))}
+	if err := b.CacheAccProof(hashes, &bad); err == nil {
+		t.Fatalf("expected an invalid proof to be rejected")
+	}
+	if _, err := b.utreexoView.accumulator.Prove(hashes); err == nil {
+		t.Fatalf("expected the hashes to not be cached")
+	}
+
+	if err := b.CacheAccProof(hashes, &proof); err != nil {
+		t.Fatalf("unable to cache the proof: %v", err)
+	}
+	got, err := b.utreexoView.accumulator.Prove(hashes)
+	if err != nil {
+		t.Fatalf("expected the hashes to be cached: %v", err)
+	}
+	if !reflect.DeepEqual(got, proof) {
+		t.Fatalf("expected proof %v, got %v", proof, got)
+	}
+
+	// Caching it again doesn't change anything.
+	if err := b.CacheAccProof(hashes, &proof); err != nil {
+		t.Fatalf("unable to cache the proof: %v", err)
+	}
+}
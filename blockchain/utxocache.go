@@ -225,6 +225,10 @@ type utxoCache struct {
 	// Below fields are used to indicate when the last flush happened.
 	lastFlushHash chainhash.Hash
 	lastFlushTime time.Time
+
+	// startHeight is the height the utxo state on disk was consistent at
+	// when the node was started, before it was caught up to the tip.
+	startHeight int32
 }
 
 // newUtxoCache initiates a new utxo cache instance with its memory usage limited
@@ -619,6 +623,7 @@ func (b *BlockChain) InitConsistentState(tip *blockNode, interrupt <-chan struct
 
 		// Set the last flush hash as it's the default value of 0s.
 		s.lastFlushHash = tip.hash
+		s.startHeight = tip.height
 
 		return err
 	}
@@ -635,11 +640,13 @@ func (b *BlockChain) InitConsistentState(tip *blockNode, interrupt <-chan struct
 		// The last flush hash is set to the default value of all 0s. Set
 		// it to the tip since we checked it's consistent.
 		s.lastFlushHash = tip.hash
+		s.startHeight = tip.height
 
 		return nil
 	}
 
 	lastFlushNode := b.index.LookupNode(statusHash)
+	s.startHeight = lastFlushNode.height
 	log.Infof("Reconstructing UTXO state after an unclean shutdown. The UTXO state is "+
 		"consistent at block %s (%d) but the chainstate is at block %s (%d),  This may "+
 		"take a long time...", statusHash.String(), lastFlushNode.height,
@@ -714,6 +721,18 @@ func (b *BlockChain) InitConsistentState(tip *blockNode, interrupt <-chan struct
 	return nil
 }
 
+// UtxoCacheStartHeight returns the height the utxo state on disk was consistent
+// at when the node was started, before it was caught up to the tip.  -1 is
+// returned when the node doesn't keep a utxo cache.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoCacheStartHeight() int32 {
+	if b.utxoCache == nil {
+		return -1
+	}
+	return b.utxoCache.startHeight
+}
+
 // flushNeededAfterPrune returns true if the utxo cache needs to be flushed after a prune
 // of the block storage.  In the case of an unexpected shutdown, the utxo cache needs
 // to be reconstructed from where the utxo cache was last flushed.  In order for the
@@ -0,0 +1,175 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// UtxoSetPageEntry is an unspent output of a page of the utxo set.
+type UtxoSetPageEntry struct {
+	OutPoint wire.OutPoint
+	Entry    *UtxoEntry
+
+	// SpentSinceSnapshot is set for the outputs that were spent by a
+	// block after the one the utxo set is at.
+	SpentSinceSnapshot bool
+}
+
+// restoredOutPoints returns the outputs restored by the rollback that come
+// after the given outpoint in the order of the utxo set.  A nil outpoint
+// returns them all.
+func (r *utxoSetRollback) restoredOutPoints(after *wire.OutPoint) []wire.OutPoint {
+	var afterKey []byte
+	if after != nil {
+		key := OutpointKey(*after)
+		afterKey = append([]byte(nil), *key...)
+		RecycleOutpointKey(key)
+	}
+
+	ops := make([]wire.OutPoint, 0, r.count)
+	keys := make(map[wire.OutPoint][]byte, r.count)
+	for txid, coins := range r.restored {
+		for index := range coins {
+			op := wire.OutPoint{Hash: txid, Index: index}
+			key := OutpointKey(op)
+			if afterKey == nil || bytes.Compare(*key, afterKey) > 0 {
+				ops = append(ops, op)
+				keys[op] = append([]byte(nil), *key...)
+			}
+			RecycleOutpointKey(key)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return bytes.Compare(keys[ops[i]], keys[ops[j]]) < 0
+	})
+	return ops
+}
+
+// FetchUtxoSetPage returns up to count unspent outputs of the utxo set at the
+// given block of the main chain that come after the given outpoint in the order
+// of the utxo set, which is by txid and then by output index.  A nil outpoint
+// starts at the first output.  It also returns whether there are more outputs
+// after the page.
+//
+// The utxo set is rolled back from the tip to the block with the spend journal,
+// so paging through it gives the same outputs however many blocks are connected
+// in the meantime as long as the block stays in the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchUtxoSetPage(snapshot *chainhash.Hash,
+	after *wire.OutPoint, count int) ([]UtxoSetPageEntry, bool, error) {
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.utreexoView != nil {
+		return nil, false, fmt.Errorf("the utxo set isn't kept by a " +
+			"utreexo node")
+	}
+	node := b.index.LookupNode(snapshot)
+	if node == nil || !b.bestChain.Contains(node) {
+		return nil, false, fmt.Errorf("block %v is not in the main chain",
+			snapshot)
+	}
+
+	tip := b.BestSnapshot()
+	if err := b.flushUtxoSetToTip(tip); err != nil {
+		return nil, false, err
+	}
+
+	var entries []UtxoSetPageEntry
+	var more bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		rollback, err := b.rollbackUtxoSet(dbTx, node, nil)
+		if err != nil {
+			return err
+		}
+		restored := rollback.restoredOutPoints(after)
+
+		// addRestored adds the restored outputs that come before the
+		// given key of the utxo set or all of them for a nil key.
+		addRestored := func(key []byte) {
+			for len(restored) > 0 && len(entries) < count {
+				op := restored[0]
+				if key != nil {
+					opKey := OutpointKey(op)
+					before := bytes.Compare(*opKey, key) < 0
+					RecycleOutpointKey(opKey)
+					if !before {
+						return
+					}
+				}
+
+				stxo := rollback.restored[op.Hash][op.Index]
+				entry := &UtxoEntry{
+					amount:      stxo.Amount,
+					pkScript:    stxo.PkScript,
+					blockHeight: stxo.Height,
+				}
+				if stxo.IsCoinBase {
+					entry.packedFlags |= tfCoinBase
+				}
+				entries = append(entries, UtxoSetPageEntry{
+					OutPoint:           op,
+					Entry:              entry,
+					SpentSinceSnapshot: true,
+				})
+				restored = restored[1:]
+			}
+		}
+
+		cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+		var ok bool
+		if after != nil {
+			key := OutpointKey(*after)
+			ok = cursor.Seek(*key)
+			if ok && bytes.Equal(cursor.Key(), *key) {
+				ok = cursor.Next()
+			}
+			RecycleOutpointKey(key)
+		} else {
+			ok = cursor.First()
+		}
+		for ; ok; ok = cursor.Next() {
+			op, err := decodeOutpointKey(cursor.Key())
+			if err != nil {
+				return err
+			}
+			if _, ok := rollback.created[op]; ok {
+				continue
+			}
+
+			addRestored(cursor.Key())
+			if len(entries) == count {
+				more = true
+				return nil
+			}
+			entry, err := deserializeUtxoEntry(cursor.Value())
+			if err != nil {
+				return err
+			}
+			entries = append(entries, UtxoSetPageEntry{
+				OutPoint: op,
+				Entry:    entry,
+			})
+		}
+
+		addRestored(nil)
+		more = len(restored) > 0
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return entries, more, nil
+}
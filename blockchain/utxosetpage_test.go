@@ -0,0 +1,98 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/chaincfg"
+)
+
+func TestFetchUtxoSetPage(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_14131.dat")
+	if err != nil {
+		t.Fatalf("failed to read block from file. %v", err)
+	}
+	chain, tearDown, err := ChainSetup("TestFetchUtxoSetPage",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("error loading blockchain with database: %v", err)
+	}
+	defer tearDown()
+
+	processBlocks := func(start, end int) {
+		for _, block := range blocks[start : end+1] {
+			_, _, err := chain.ProcessBlock(block, BFNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	processBlocks(1, 1000)
+	snapshot := chain.BestSnapshot().Hash
+
+	all, more, err := chain.FetchUtxoSetPage(&snapshot, nil, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more || len(all) == 0 {
+		t.Fatalf("expected all the outputs in one page, got %d (more %v)",
+			len(all), more)
+	}
+
+	// Page through the utxo set while more blocks are connected halfway
+	// through.  The pages are still of the utxo set at the snapshot.
+	var paged []UtxoSetPageEntry
+	var spentSince int
+	for page := 0; ; page++ {
+		if page == 3 {
+			processBlocks(1001, 3000)
+		}
+
+		var after *UtxoSetPageEntry
+		if len(paged) > 0 {
+			after = &paged[len(paged)-1]
+		}
+		var entries []UtxoSetPageEntry
+		if after == nil {
+			entries, more, err = chain.FetchUtxoSetPage(&snapshot, nil, 50)
+		} else {
+			entries, more, err = chain.FetchUtxoSetPage(&snapshot,
+				&after.OutPoint, 50)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if more && len(entries) != 50 {
+			t.Fatalf("expected a full page before the last, got %d",
+				len(entries))
+		}
+		for _, entry := range entries {
+			if entry.SpentSinceSnapshot {
+				spentSince++
+			}
+		}
+		paged = append(paged, entries...)
+		if !more {
+			break
+		}
+	}
+
+	if len(paged) != len(all) {
+		t.Fatalf("expected %d outputs, got %d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i].OutPoint != all[i].OutPoint ||
+			paged[i].Entry.Amount() != all[i].Entry.Amount() ||
+			paged[i].Entry.BlockHeight() != all[i].Entry.BlockHeight() {
+
+			t.Fatalf("output %d: expected %v, got %v", i,
+				all[i].OutPoint, paged[i].OutPoint)
+		}
+	}
+	if spentSince == 0 {
+		t.Fatal("expected some of the outputs to be spent since the snapshot")
+	}
+}
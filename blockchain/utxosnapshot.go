@@ -0,0 +1,418 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// utxoSnapshotVersion is the version of the snapshot metadata written by
+// Bitcoin Core's dumptxoutset that the snapshots are written in.
+const utxoSnapshotVersion = 2
+
+// utxoSnapshotMagic is the start of every utxo snapshot.
+var utxoSnapshotMagic = [5]byte{'u', 't', 'x', 'o', 0xff}
+
+// UtxoSnapshotInfo describes a utxo snapshot that was written.
+type UtxoSnapshotInfo struct {
+	// BlockHash and Height are the block the snapshot is of.
+	BlockHash chainhash.Hash
+	Height    int32
+
+	// CoinsCount is the number of unspent outputs in the snapshot.
+	CoinsCount uint64
+}
+
+// utxoSnapshotWriter writes a utxo snapshot in the format of Bitcoin Core's
+// dumptxoutset so that it can be loaded by Bitcoin Core with loadtxoutset.
+//
+// The snapshot is made of the metadata followed by the coins:
+//
+//	Field          Type            Size
+//	magic          [5]byte         5
+//	version        uint16          2
+//	network        uint32          4
+//	block hash     chainhash.Hash  32
+//	coins count    uint64          8
+//	coins          grouped by txid variable
+//
+// The coins of a transaction are the txid, the CompactSize number of coins and,
+// for every coin, the CompactSize output index followed by the coin.  A coin is
+// serialized just like a utxo entry in the utxo set, which was taken from
+// Bitcoin Core to begin with.
+type utxoSnapshotWriter struct {
+	w io.Writer
+
+	// txid and coins are the transaction whose coins are being gathered
+	// and its coins.
+	txid  chainhash.Hash
+	coins []snapshotCoin
+
+	written uint64
+}
+
+// snapshotCoin is a serialized coin of a utxo snapshot along with its output
+// index.
+type snapshotCoin struct {
+	index      uint32
+	serialized []byte
+}
+
+// writeHeader writes the metadata of the snapshot.
+func (sw *utxoSnapshotWriter) writeHeader(net wire.BitcoinNet,
+	blockHash *chainhash.Hash, coinsCount uint64) error {
+
+	var buf [51]byte
+	copy(buf[:5], utxoSnapshotMagic[:])
+	binary.LittleEndian.PutUint16(buf[5:7], utxoSnapshotVersion)
+	binary.LittleEndian.PutUint32(buf[7:11], uint32(net))
+	copy(buf[11:43], blockHash[:])
+	binary.LittleEndian.PutUint64(buf[43:], coinsCount)
+	_, err := sw.w.Write(buf[:])
+	return err
+}
+
+// addCoin adds the serialized coin of the given output to the snapshot.  The
+// coins of a transaction are expected one after the other and are written in
+// the order of their output index.
+func (sw *utxoSnapshotWriter) addCoin(txid *chainhash.Hash, index uint32,
+	serializedCoin []byte) error {
+
+	if len(sw.coins) > 0 && sw.txid != *txid {
+		if err := sw.flush(); err != nil {
+			return err
+		}
+	}
+	sw.txid = *txid
+
+	serialized := make([]byte, len(serializedCoin))
+	copy(serialized, serializedCoin)
+	sw.coins = append(sw.coins, snapshotCoin{index, serialized})
+	return nil
+}
+
+// flush writes out the gathered coins of the transaction.
+func (sw *utxoSnapshotWriter) flush() error {
+	if len(sw.coins) == 0 {
+		return nil
+	}
+	if _, err := sw.w.Write(sw.txid[:]); err != nil {
+		return err
+	}
+	err := wire.WriteVarInt(sw.w, 0, uint64(len(sw.coins)))
+	if err != nil {
+		return err
+	}
+	sort.Slice(sw.coins, func(i, j int) bool {
+		return sw.coins[i].index < sw.coins[j].index
+	})
+	for _, coin := range sw.coins {
+		err := wire.WriteVarInt(sw.w, 0, uint64(coin.index))
+		if err != nil {
+			return err
+		}
+		if _, err := sw.w.Write(coin.serialized); err != nil {
+			return err
+		}
+	}
+	sw.written += uint64(len(sw.coins))
+	sw.coins = sw.coins[:0]
+	return nil
+}
+
+// serializeSnapshotCoin returns a coin serialized the way the utxo set and
+// Bitcoin Core serialize it.
+func serializeSnapshotCoin(stxo *SpentTxOut) []byte {
+	headerCode := uint64(stxo.Height) << 1
+	if stxo.IsCoinBase {
+		headerCode |= 0x01
+	}
+	size := serializeSizeVLQ(headerCode) +
+		compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
+	serialized := make([]byte, size)
+	offset := putVLQ(serialized, headerCode)
+	putCompressedTxOut(serialized[offset:], uint64(stxo.Amount), stxo.PkScript)
+	return serialized
+}
+
+// utxoSetRollback is what changes in the utxo set when going back from the tip
+// to an earlier block of the main chain.
+type utxoSetRollback struct {
+	// created are the outputs created after the block.
+	created map[wire.OutPoint]struct{}
+
+	// restored are the outputs created up to the block that were spent
+	// after it, keyed by their txid and then by their output index.
+	restored map[chainhash.Hash]map[uint32]*SpentTxOut
+	count    uint64
+}
+
+// add undoes the given block of the main chain along with the outputs it spent.
+// The blocks are expected from the tip down.
+func (r *utxoSetRollback) add(block *btcutil.Block, stxos []SpentTxOut) error {
+	// The outputs spent by the block are restored first so that the ones
+	// created by the block itself are removed again below.
+	var stxoIdx int
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			if stxoIdx >= len(stxos) {
+				return fmt.Errorf("the spend journal of block %v "+
+					"has too few entries", block.Hash())
+			}
+			op := txIn.PreviousOutPoint
+			coins := r.restored[op.Hash]
+			if coins == nil {
+				coins = make(map[uint32]*SpentTxOut)
+				r.restored[op.Hash] = coins
+			}
+			coins[op.Index] = &stxos[stxoIdx]
+			r.count++
+			stxoIdx++
+		}
+	}
+	if stxoIdx != len(stxos) {
+		return fmt.Errorf("the spend journal of block %v has too many "+
+			"entries", block.Hash())
+	}
+
+	for _, tx := range block.Transactions() {
+		for i, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}
+			if coins, ok := r.restored[op.Hash]; ok {
+				if _, ok := coins[op.Index]; ok {
+					delete(coins, op.Index)
+					r.count--
+					if len(coins) == 0 {
+						delete(r.restored, op.Hash)
+					}
+				}
+			}
+			r.created[op] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// flushUtxoSetToTip flushes the utxo cache unless the utxo set on disk is
+// already at the tip, so that the utxo set can be read from the database.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) flushUtxoSetToTip(tip *BestState) error {
+	if b.utxoCache.lastFlushHash == tip.Hash {
+		return nil
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		return b.utxoCache.flush(dbTx, FlushRequired, tip)
+	})
+}
+
+// rollbackUtxoSet returns what changes in the utxo set when going back from the
+// tip to the given block of the main chain.  Every block after the given one is
+// read along with its spend journal.
+//
+// This function MUST be called with the chain lock held.
+func (b *BlockChain) rollbackUtxoSet(dbTx database.Tx, node *blockNode,
+	interrupt <-chan struct{}) (*utxoSetRollback, error) {
+
+	rollback := &utxoSetRollback{
+		created:  make(map[wire.OutPoint]struct{}),
+		restored: make(map[chainhash.Hash]map[uint32]*SpentTxOut),
+	}
+	for n := b.bestChain.Tip(); n != node; n = n.parent {
+		if interruptRequested(interrupt) {
+			return nil, errInterruptRequested
+		}
+
+		block, err := dbFetchBlockByNode(dbTx, n)
+		if err != nil {
+			return nil, err
+		}
+		stxos, err := dbFetchSpendJournalEntry(dbTx, block)
+		if err != nil {
+			return nil, err
+		}
+		if err := rollback.add(block, stxos); err != nil {
+			return nil, err
+		}
+	}
+
+	return rollback, nil
+}
+
+// DumpUtxoSnapshot writes the utxo set at the given height of the main chain to
+// w in the format of Bitcoin Core's dumptxoutset.  The utxo set is rolled back
+// from the tip with the spend journal when the height is below the tip.
+//
+// The utxo cache is flushed and the chain lock is held while the snapshot is
+// written so no blocks are connected until it's done.  The interrupt channel
+// stops the writing early with an error.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer, height int32,
+	interrupt <-chan struct{}) (*UtxoSnapshotInfo, error) {
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.utreexoView != nil {
+		return nil, fmt.Errorf("the utxo set isn't kept by a utreexo node")
+	}
+	tip := b.BestSnapshot()
+	if height < 0 || height > tip.Height {
+		return nil, fmt.Errorf("height %d is out of the range of 0 to %d",
+			height, tip.Height)
+	}
+	node := b.bestChain.NodeByHeight(height)
+
+	if err := b.flushUtxoSetToTip(tip); err != nil {
+		return nil, err
+	}
+
+	var info *UtxoSnapshotInfo
+	err := b.db.View(func(dbTx database.Tx) error {
+		rollback, err := b.rollbackUtxoSet(dbTx, node, interrupt)
+		if err != nil {
+			return err
+		}
+
+		// The number of coins comes before them so they're counted
+		// with a pass over the utxo set first.
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		coinsCount := rollback.count
+		err = utxoBucket.ForEach(func(k, _ []byte) error {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+			op, err := decodeOutpointKey(k)
+			if err != nil {
+				return err
+			}
+			if _, ok := rollback.created[op]; !ok {
+				coinsCount++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sw := utxoSnapshotWriter{w: w}
+		err = sw.writeHeader(b.chainParams.Net, &node.hash, coinsCount)
+		if err != nil {
+			return err
+		}
+
+		// The keys of the utxo set start with the txid so the coins of
+		// a transaction come one after the other and the transactions
+		// are in order.  The restored coins are merged in so that the
+		// snapshot is the same as one written at the height.
+		txids := make([]chainhash.Hash, 0, len(rollback.restored))
+		for txid := range rollback.restored {
+			txids = append(txids, txid)
+		}
+		sort.Slice(txids, func(i, j int) bool {
+			return bytes.Compare(txids[i][:], txids[j][:]) < 0
+		})
+		addRestoredBefore := func(txid *chainhash.Hash) error {
+			for len(txids) > 0 && (txid == nil ||
+				bytes.Compare(txids[0][:], txid[:]) <= 0) {
+
+				err := addRestoredCoins(&sw, rollback, &txids[0])
+				if err != nil {
+					return err
+				}
+				txids = txids[1:]
+			}
+			return nil
+		}
+		err = utxoBucket.ForEach(func(k, v []byte) error {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+			op, err := decodeOutpointKey(k)
+			if err != nil {
+				return err
+			}
+			if _, ok := rollback.created[op]; ok {
+				return nil
+			}
+			if err := addRestoredBefore(&op.Hash); err != nil {
+				return err
+			}
+			return sw.addCoin(&op.Hash, op.Index, v)
+		})
+		if err != nil {
+			return err
+		}
+		if err := addRestoredBefore(nil); err != nil {
+			return err
+		}
+		if err := sw.flush(); err != nil {
+			return err
+		}
+
+		if sw.written != coinsCount {
+			return AssertError(fmt.Sprintf("wrote %d coins to the "+
+				"utxo snapshot instead of %d", sw.written,
+				coinsCount))
+		}
+		info = &UtxoSnapshotInfo{
+			BlockHash:  node.hash,
+			Height:     node.height,
+			CoinsCount: coinsCount,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// addRestoredCoins adds the coins of the transaction restored by the rollback
+// to the snapshot.
+func addRestoredCoins(sw *utxoSnapshotWriter, rollback *utxoSetRollback,
+	txid *chainhash.Hash) error {
+
+	for index, stxo := range rollback.restored[*txid] {
+		err := sw.addCoin(txid, index, serializeSnapshotCoin(stxo))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeOutpointKey decodes a key of the utxo set into the outpoint it's of.
+func decodeOutpointKey(key []byte) (wire.OutPoint, error) {
+	if len(key) <= chainhash.HashSize {
+		return wire.OutPoint{}, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt utxo set key %x",
+				key),
+		}
+	}
+
+	var op wire.OutPoint
+	copy(op.Hash[:], key[:chainhash.HashSize])
+	index, _ := deserializeVLQ(key[chainhash.HashSize:])
+	op.Index = uint32(index)
+	return op, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestUtxoSnapshotWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	sw := utxoSnapshotWriter{w: &buf}
+	blockHash := chainhash.Hash{0xaa}
+	if err := sw.writeHeader(wire.MainNet, &blockHash, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	txid1, txid2 := chainhash.Hash{1}, chainhash.Hash{2}
+	coins := []struct {
+		txid  *chainhash.Hash
+		index uint32
+		coin  []byte
+	}{
+		{&txid1, 0, []byte{0x10}},
+		{&txid1, 300, []byte{0x11}},
+		{&txid2, 1, []byte{0x12}},
+	}
+	for _, c := range coins {
+		if err := sw.addCoin(c.txid, c.index, c.coin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if sw.written != 3 {
+		t.Fatalf("expected 3 coins written, got %d", sw.written)
+	}
+
+	var want bytes.Buffer
+	want.Write([]byte{'u', 't', 'x', 'o', 0xff, 0x02, 0x00})
+	want.Write([]byte{0xf9, 0xbe, 0xb4, 0xd9})
+	want.Write(blockHash[:])
+	binary.Write(&want, binary.LittleEndian, uint64(3))
+	want.Write(txid1[:])
+	want.Write([]byte{0x02, 0x00, 0x10, 0xfd, 0x2c, 0x01, 0x11})
+	want.Write(txid2[:])
+	want.Write([]byte{0x01, 0x01, 0x12})
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Fatalf("unexpected snapshot\ngot  %x\nwant %x", buf.Bytes(),
+			want.Bytes())
+	}
+}
+
+func TestUtxoSetRollback(t *testing.T) {
+	t.Parallel()
+
+	pkScript := []byte{0x51}
+	spentOp := wire.OutPoint{Hash: chainhash.Hash{9}, Index: 2}
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Index: ^uint32(0)}})
+	coinbase.AddTxOut(wire.NewTxOut(50, pkScript))
+
+	// The first transaction spends an older output and the second one
+	// spends the first output of the first.
+	tx1 := wire.NewMsgTx(1)
+	tx1.AddTxIn(&wire.TxIn{PreviousOutPoint: spentOp})
+	tx1.AddTxOut(wire.NewTxOut(10, pkScript))
+	tx1.AddTxOut(wire.NewTxOut(0, []byte{0x6a}))
+	tx2 := wire.NewMsgTx(1)
+	tx2.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: tx1.TxHash()}})
+	tx2.AddTxOut(wire.NewTxOut(9, pkScript))
+
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, tx1, tx2},
+	})
+	stxos := []SpentTxOut{
+		{Amount: 20, PkScript: pkScript, Height: 5},
+		{Amount: 10, PkScript: pkScript, Height: 10},
+	}
+
+	rollback := utxoSetRollback{
+		created:  make(map[wire.OutPoint]struct{}),
+		restored: make(map[chainhash.Hash]map[uint32]*SpentTxOut),
+	}
+	if err := rollback.add(block, stxos); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the older output is restored and the unspendable output isn't
+	// counted as created.
+	if rollback.count != 1 || len(rollback.restored) != 1 ||
+		rollback.restored[spentOp.Hash][spentOp.Index] != &stxos[0] {
+
+		t.Fatalf("expected only %v to be restored, got %v", spentOp,
+			rollback.restored)
+	}
+	if len(rollback.created) != 3 {
+		t.Fatalf("expected 3 created outputs, got %d",
+			len(rollback.created))
+	}
+	if _, ok := rollback.created[wire.OutPoint{Hash: tx1.TxHash(), Index: 1}]; ok {
+		t.Fatal("expected the unspendable output not to be created")
+	}
+
+	if err := rollback.add(block, stxos[:1]); err == nil {
+		t.Fatal("expected an error for a short spend journal")
+	}
+}
+
+func TestDumpUtxoSnapshot(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_14131.dat")
+	if err != nil {
+		t.Fatalf("failed to read block from file. %v", err)
+	}
+
+	// dump syncs a new chain up to the given height and dumps the utxo set
+	// at the snapshot height.
+	dump := func(name string, syncHeight, snapshotHeight int32) []byte {
+		chain, tearDown, err := ChainSetup(name, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("error loading blockchain with database: %v", err)
+		}
+		defer tearDown()
+
+		for _, block := range blocks[1 : syncHeight+1] {
+			_, _, err := chain.ProcessBlock(block, BFNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		info, err := chain.DumpUtxoSnapshot(&buf, snapshotHeight, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Height != snapshotHeight ||
+			info.BlockHash != *blocks[snapshotHeight].Hash() {
+
+			t.Fatalf("expected a snapshot at height %d, got %d",
+				snapshotHeight, info.Height)
+		}
+		return buf.Bytes()
+	}
+
+	// The utxo set rolled back from the tip is the same as the one of the
+	// chain synced only up to the height.
+	atTip := dump("TestDumpUtxoSnapshotTip", 1000, 1000)
+	rolledBack := dump("TestDumpUtxoSnapshotRollback", 3000, 1000)
+	if !bytes.Equal(atTip, rolledBack) {
+		t.Fatal("the rolled back utxo snapshot doesn't match the one " +
+			"at the tip")
+	}
+}
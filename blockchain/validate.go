@@ -35,6 +35,11 @@ const (
 	// used to calculate the median time used to validate block timestamps.
 	medianTimeBlocks = 11
 
+	// maxTimewarp is how much earlier than the previous block the first
+	// block of a difficulty period is allowed to be on networks that
+	// enforce BIP0094.
+	maxTimewarp = 10 * time.Minute
+
 	// serializedHeightVersion is the block version which changed block
 	// coinbases to start with the serialized block height.
 	serializedHeightVersion = 2
@@ -696,6 +701,14 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 			str = fmt.Sprintf(str, header.Timestamp, medianTime)
 			return ruleError(ErrTimeTooOld, str)
 		}
+
+		// Networks that enforce BIP0094 don't allow the first block of
+		// a difficulty period to be much older than the block before it
+		// to prevent timewarp attacks.
+		err = b.checkTimewarp(header, prevNode)
+		if err != nil {
+			return err
+		}
 	}
 
 	// The height of this block is one more than the referenced previous
@@ -741,6 +754,29 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	return nil
 }
 
+// checkTimewarp ensures the timestamp of the block with the passed header isn't
+// more than maxTimewarp earlier than the previous block when it's the first
+// block of a difficulty period on networks that enforce BIP0094.
+func (b *BlockChain) checkTimewarp(header *wire.BlockHeader, prevNode *blockNode) error {
+	if !b.chainParams.EnforceBIP94 ||
+		(prevNode.height+1)%b.blocksPerRetarget != 0 {
+
+		return nil
+	}
+
+	minTime := time.Unix(prevNode.timestamp, 0).Add(-maxTimewarp)
+	if header.Timestamp.Before(minTime) {
+		str := "block timestamp of %v at the start of a difficulty " +
+			"period is more than %v before the previous block " +
+			"timestamp of %v"
+		str = fmt.Sprintf(str, header.Timestamp, maxTimewarp,
+			time.Unix(prevNode.timestamp, 0))
+		return ruleError(ErrTimeTooOld, str)
+	}
+
+	return nil
+}
+
 // checkBlockContext peforms several validation checks on the block which depend
 // on its position within the block chain.
 //
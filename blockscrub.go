@@ -0,0 +1,504 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// scrubIssueKind is what the block scrubber found to be wrong with a block.
+type scrubIssueKind uint8
+
+const (
+	// scrubBadBlock is a stored block that can't be read back or that
+	// doesn't match its header.  It's repaired by fetching the block from
+	// a peer again.
+	scrubBadBlock scrubIssueKind = iota
+
+	// scrubBadProof is a stored utreexo proof that doesn't prove the
+	// inputs of its block against the accumulator at the block before.
+	// Proofs are generated locally so it can't be repaired from peers.
+	scrubBadProof
+)
+
+// String returns the scrubIssueKind as a human-readable name.
+func (k scrubIssueKind) String() string {
+	switch k {
+	case scrubBadBlock:
+		return "block"
+	case scrubBadProof:
+		return "proof"
+	}
+	return "unknown"
+}
+
+// scrubIssue is a block the block scrubber found a problem with.
+type scrubIssue struct {
+	kind   scrubIssueKind
+	hash   chainhash.Hash
+	height int32
+	err    error
+	found  time.Time
+
+	// repairRequested is when the block was last asked for from a peer.
+	// It's zero if no peer could be asked.
+	repairRequested time.Time
+}
+
+// blockScrubInfo is a snapshot of the state of the block scrubber.
+type blockScrubInfo struct {
+	scrubbing      bool
+	passes         uint64
+	height         int32
+	passStart      time.Time
+	passEnd        time.Time
+	blocksChecked  uint64
+	proofsChecked  uint64
+	badBlocks      uint64
+	repairedBlocks uint64
+	badProofs      uint64
+	issues         []scrubIssue
+}
+
+// blockScrubber keeps track of the passes of the background scrubber that
+// reads back the stored blocks and utreexo proofs to catch the ones that were
+// silently corrupted on disk.  The blocks that are found to be corrupted are
+// kept track of until they're fetched from a peer again.
+type blockScrubber struct {
+	mtx  sync.Mutex
+	info blockScrubInfo
+
+	// issues are the problems found that haven't been resolved yet.
+	issues map[chainhash.Hash]*scrubIssue
+}
+
+// newBlockScrubber returns a new block scrubber that hasn't started a pass yet.
+func newBlockScrubber() *blockScrubber {
+	return &blockScrubber{issues: make(map[chainhash.Hash]*scrubIssue)}
+}
+
+// startPass records the start of a pass over the blocks.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) startPass(now time.Time) {
+	bs.mtx.Lock()
+	bs.info.scrubbing = true
+	bs.info.passStart = now
+	bs.info.height = 0
+	bs.mtx.Unlock()
+}
+
+// finishPass records the end of a pass over the blocks.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) finishPass(now time.Time) {
+	bs.mtx.Lock()
+	bs.info.scrubbing = false
+	bs.info.passEnd = now
+	bs.info.passes++
+	bs.mtx.Unlock()
+}
+
+// checked records that the block at the given height was found to be fine
+// along with its proof if that was checked as well.  Any issue previously found
+// with the block is resolved.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) checked(hash *chainhash.Hash, height int32, proof bool) {
+	bs.mtx.Lock()
+	defer bs.mtx.Unlock()
+
+	bs.info.height = height
+	bs.info.blocksChecked++
+	if proof {
+		bs.info.proofsChecked++
+	}
+	delete(bs.issues, *hash)
+}
+
+// addIssue records a problem found with a block and returns whether it's new.
+// Problems found again in later passes are only counted once.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) addIssue(issue *scrubIssue) bool {
+	bs.mtx.Lock()
+	defer bs.mtx.Unlock()
+
+	bs.info.height = issue.height
+	bs.info.blocksChecked++
+	if old, exists := bs.issues[issue.hash]; exists && old.kind == issue.kind {
+		old.err = issue.err
+		return false
+	}
+
+	bs.issues[issue.hash] = issue
+	switch issue.kind {
+	case scrubBadBlock:
+		bs.info.badBlocks++
+	case scrubBadProof:
+		bs.info.proofsChecked++
+		bs.info.badProofs++
+	}
+	return true
+}
+
+// requestedRepair records that the block with the given hash was asked for from
+// a peer at the given time.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) requestedRepair(hash *chainhash.Hash, now time.Time) {
+	bs.mtx.Lock()
+	if issue, exists := bs.issues[*hash]; exists {
+		issue.repairRequested = now
+	}
+	bs.mtx.Unlock()
+}
+
+// pendingRepair returns the height of the block with the given hash and true if
+// the block was found to be corrupted and asked for from a peer.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) pendingRepair(hash *chainhash.Hash) (int32, bool) {
+	bs.mtx.Lock()
+	defer bs.mtx.Unlock()
+
+	issue, exists := bs.issues[*hash]
+	if !exists || issue.kind != scrubBadBlock || issue.repairRequested.IsZero() {
+		return 0, false
+	}
+	return issue.height, true
+}
+
+// repaired records that the corrupted block with the given hash was replaced.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) repaired(hash *chainhash.Hash) {
+	bs.mtx.Lock()
+	if _, exists := bs.issues[*hash]; exists {
+		delete(bs.issues, *hash)
+		bs.info.repairedBlocks++
+	}
+	bs.mtx.Unlock()
+}
+
+// Info returns a snapshot of the state of the block scrubber with the issues
+// that haven't been resolved ordered by height.
+//
+// This function is safe for concurrent access.
+func (bs *blockScrubber) Info() blockScrubInfo {
+	bs.mtx.Lock()
+	defer bs.mtx.Unlock()
+
+	info := bs.info
+	info.issues = make([]scrubIssue, 0, len(bs.issues))
+	for _, issue := range bs.issues {
+		info.issues = append(info.issues, *issue)
+	}
+	sort.Slice(info.issues, func(i, j int) bool {
+		return info.issues[i].height < info.issues[j].height
+	})
+	return info
+}
+
+// checkBlockData returns an error if the block doesn't match its header.  The
+// merkle root and the witness commitment are recomputed from the transactions
+// so that a flipped bit anywhere in the block is caught.
+func checkBlockData(block *btcutil.Block) error {
+	msgBlock := block.MsgBlock()
+	if len(msgBlock.Transactions) == 0 {
+		return errors.New("block has no transactions")
+	}
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	merkleRoot := merkles[len(merkles)-1]
+	if !merkleRoot.IsEqual(&msgBlock.Header.MerkleRoot) {
+		return fmt.Errorf("transactions have the merkle root %v instead "+
+			"of %v", merkleRoot, msgBlock.Header.MerkleRoot)
+	}
+
+	return blockchain.ValidateWitnessCommitment(block)
+}
+
+// checkStoredBlock deserializes the stored bytes of the block with the given
+// hash and returns an error if they don't make up that block.
+func checkStoredBlock(hash *chainhash.Hash, blockBytes []byte) (*btcutil.Block, error) {
+	var msgBlock wire.MsgBlock
+	err := msgBlock.Deserialize(bytes.NewReader(blockBytes))
+	if err != nil {
+		return nil, fmt.Errorf("unable to deserialize the block: %v", err)
+	}
+	if blockHash := msgBlock.BlockHash(); !blockHash.IsEqual(hash) {
+		return nil, fmt.Errorf("the stored header hashes to %v", blockHash)
+	}
+
+	block := btcutil.NewBlock(&msgBlock)
+	return block, checkBlockData(block)
+}
+
+// proofCheckable returns whether the stored utreexo proof of the block at the
+// given height can be cross-checked.  Pruned nodes and flat proof indexes that
+// dropped the older proofs don't have them.
+func (s *server) proofCheckable(height int32) bool {
+	if height == 0 || cfg.Prune != 0 {
+		return false
+	}
+	if s.utreexoProofIndex != nil {
+		return true
+	}
+	return s.flatUtreexoProofIndex != nil &&
+		height > s.flatUtreexoProofIndex.CompactedHeight()
+}
+
+// verifyStoredProof checks that the stored utreexo proof of the block proves
+// the outputs the block spends against the accumulator at the block before.
+func (s *server) verifyStoredProof(block *btcutil.Block) error {
+	ud, err := s.fetchStoredUData(block.Hash())
+	if err != nil {
+		return fmt.Errorf("unable to fetch the proof: %v", err)
+	}
+	delHashes, err := s.chain.ReconstructUData(ud, *block.Hash())
+	if err != nil {
+		return fmt.Errorf("proof doesn't match the block: %v", err)
+	}
+
+	var roots []*chainhash.Hash
+	var numLeaves uint64
+	prevHash := &block.MsgBlock().Header.PrevBlock
+	if s.utreexoProofIndex != nil {
+		err = s.db.View(func(dbTx database.Tx) error {
+			var err error
+			roots, numLeaves, err = s.utreexoProofIndex.FetchUtreexoState(
+				dbTx, prevHash)
+			return err
+		})
+	} else {
+		roots, numLeaves, err = s.flatUtreexoProofIndex.FetchUtreexoState(
+			block.Height() - 1)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to fetch the accumulator at %v: %v",
+			prevHash, err)
+	}
+
+	stump := utreexo.Stump{
+		Roots:     make([]utreexo.Hash, 0, len(roots)),
+		NumLeaves: numLeaves,
+	}
+	for _, root := range roots {
+		stump.Roots = append(stump.Roots, utreexo.Hash(*root))
+	}
+	_, err = utreexo.Verify(stump, delHashes, ud.AccProof)
+	if err != nil {
+		return fmt.Errorf("proof doesn't verify: %v", err)
+	}
+
+	return nil
+}
+
+// scrubBlock reads back the block at the given height and its utreexo proof and
+// returns the issue found with them or nil if there's none.  Blocks that were
+// pruned are skipped.
+func (s *server) scrubBlock(height int32) (*scrubIssue, error) {
+	hash, err := s.chain.BlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	var blockBytes []byte
+	err = s.db.View(func(dbTx database.Tx) error {
+		var err error
+		blockBytes, err = dbTx.FetchBlock(hash)
+		return err
+	})
+	if dbErr, ok := err.(database.Error); ok &&
+		dbErr.ErrorCode == database.ErrBlockNotFound {
+
+		return nil, nil
+	}
+
+	issue := &scrubIssue{
+		kind:   scrubBadBlock,
+		hash:   *hash,
+		height: height,
+		found:  time.Now(),
+	}
+	var block *btcutil.Block
+	if err == nil {
+		block, err = checkStoredBlock(hash, blockBytes)
+	}
+	if err != nil {
+		issue.err = err
+		return issue, nil
+	}
+	block.SetHeight(height)
+
+	proof := s.proofCheckable(height)
+	if proof {
+		err = s.verifyStoredProof(block)
+		if err != nil {
+			issue.kind = scrubBadProof
+			issue.err = err
+			return issue, nil
+		}
+	}
+
+	s.blockScrubber.checked(hash, height, proof)
+	return nil, nil
+}
+
+// requestBlockRepair asks a connected peer that serves full blocks for the
+// block of the issue so that the corrupted copy can be replaced.  It returns
+// whether a peer was asked.
+func (s *server) requestBlockRepair(issue *scrubIssue) bool {
+	replyChan := make(chan []*serverPeer)
+	select {
+	case s.query <- getPeersMsg{reply: replyChan}:
+	case <-s.quit:
+		return false
+	}
+	peers := <-replyChan
+
+	for _, sp := range peers {
+		if !sp.Connected() || !sp.IsWitnessEnabled() ||
+			sp.Services()&wire.SFNodeNetwork != wire.SFNodeNetwork {
+			continue
+		}
+
+		gdmsg := wire.NewMsgGetData()
+		gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock, &issue.hash))
+		sp.QueueMessage(gdmsg, nil)
+		s.blockScrubber.requestedRepair(&issue.hash, time.Now())
+
+		srvrLog.Infof("Requested block %v (height %d) from %v to repair it",
+			issue.hash, issue.height, sp)
+		return true
+	}
+
+	return false
+}
+
+// repairBlock replaces the stored copy of a corrupted block with the one the
+// peer sent.  It returns false if the block wasn't asked for to repair it so
+// that it's processed as usual.
+func (s *server) repairBlock(sp *serverPeer, msgBlock *wire.MsgBlock) bool {
+	if s.blockScrubber == nil {
+		return false
+	}
+	hash := msgBlock.BlockHash()
+	height, ok := s.blockScrubber.pendingRepair(&hash)
+	if !ok {
+		return false
+	}
+
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(height)
+	if err := checkBlockData(block); err != nil {
+		srvrLog.Warnf("Block %v from %v can't repair the stored copy: %v",
+			hash, sp, err)
+		return true
+	}
+
+	err := s.db.Update(func(dbTx database.Tx) error {
+		return dbTx.ReplaceBlock(block)
+	})
+	if err != nil {
+		srvrLog.Errorf("Unable to replace corrupted block %v: %v", hash, err)
+		return true
+	}
+
+	s.blockScrubber.repaired(&hash)
+	srvrLog.Infof("Repaired corrupted block %v (height %d) with the copy "+
+		"from %v", hash, height, sp)
+	return true
+}
+
+// scrubPass checks every stored block up to the tip at the start of the pass at
+// no more than the --blockscrubrate.  It returns false if the server is
+// shutting down.
+func (s *server) scrubPass() bool {
+	s.blockScrubber.startPass(time.Now())
+
+	limiter := time.NewTicker(time.Second / time.Duration(cfg.BlockScrubRate))
+	defer limiter.Stop()
+
+	bestHeight := s.chain.BestSnapshot().Height
+	for height := int32(0); height <= bestHeight; height++ {
+		select {
+		case <-limiter.C:
+		case <-s.quit:
+			return false
+		}
+
+		issue, err := s.scrubBlock(height)
+		if err != nil {
+			// The block may have been reorged out.
+			srvrLog.Debugf("Block scrubber skipped height %d: %v",
+				height, err)
+			continue
+		}
+		if issue == nil {
+			continue
+		}
+
+		if s.blockScrubber.addIssue(issue) {
+			srvrLog.Errorf("Block scrubber found a corrupted %v at "+
+				"height %d (block %v): %v", issue.kind, issue.height,
+				issue.hash, issue.err)
+			if issue.kind == scrubBadProof {
+				srvrLog.Errorf("The utreexo proof index has to be " +
+					"rebuilt to fix the corrupted proof")
+			}
+		}
+		if issue.kind == scrubBadBlock && !s.requestBlockRepair(issue) {
+			srvrLog.Warnf("No peer to fetch corrupted block %v from",
+				issue.hash)
+		}
+	}
+
+	s.blockScrubber.finishPass(time.Now())
+	return true
+}
+
+// blockScrubHandler reads back the stored blocks and their utreexo proofs in
+// the background to find the ones corrupted on disk, waiting --blockscrubinterval
+// between passes.
+//
+// It must be run as a goroutine.
+func (s *server) blockScrubHandler() {
+	timer := time.NewTimer(cfg.BlockScrubInterval)
+
+out:
+	for {
+		select {
+		case <-timer.C:
+			if !s.scrubPass() {
+				break out
+			}
+			info := s.blockScrubber.Info()
+			srvrLog.Infof("Block scrubber finished a pass in %v with %d "+
+				"unresolved issues", info.passEnd.Sub(info.passStart).
+				Round(time.Second), len(info.issues))
+			timer.Reset(cfg.BlockScrubInterval)
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	timer.Stop()
+	s.wg.Done()
+}
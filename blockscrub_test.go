@@ -0,0 +1,109 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestCheckStoredBlock(t *testing.T) {
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	hash := genesis.BlockHash()
+	var buf bytes.Buffer
+	if err := genesis.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+
+	if _, err := checkStoredBlock(&hash, good); err != nil {
+		t.Fatalf("unexpected error for the intact block: %v", err)
+	}
+
+	// A flipped bit in the output script of the coinbase doesn't change the
+	// header but is caught by the merkle root.
+	flipped := append([]byte(nil), good...)
+	flipped[len(flipped)-10] ^= 0x01
+	if _, err := checkStoredBlock(&hash, flipped); err == nil {
+		t.Fatal("expected an error for a flipped bit in a transaction")
+	}
+
+	// A flipped bit in the header makes it hash to another block.
+	flipped = append([]byte(nil), good...)
+	flipped[4] ^= 0x01
+	if _, err := checkStoredBlock(&hash, flipped); err == nil {
+		t.Fatal("expected an error for a flipped bit in the header")
+	}
+
+	// Truncated blocks can't be deserialized.
+	if _, err := checkStoredBlock(&hash, good[:len(good)/2]); err == nil {
+		t.Fatal("expected an error for a truncated block")
+	}
+}
+
+func TestBlockScrubber(t *testing.T) {
+	bs := newBlockScrubber()
+	now := time.Unix(1700000000, 0)
+	bad := chainhash.Hash{1}
+	proof := chainhash.Hash{2}
+
+	bs.startPass(now)
+	bs.checked(&chainhash.Hash{3}, 1, true)
+	issue := &scrubIssue{kind: scrubBadBlock, hash: bad, height: 5,
+		err: errors.New("bad"), found: now}
+	if !bs.addIssue(issue) {
+		t.Fatal("expected the first issue to be new")
+	}
+	if bs.addIssue(&scrubIssue{kind: scrubBadBlock, hash: bad, height: 5,
+		err: errors.New("bad"), found: now}) {
+		t.Fatal("expected the same issue found again not to be new")
+	}
+	bs.addIssue(&scrubIssue{kind: scrubBadProof, hash: proof, height: 2,
+		err: errors.New("bad"), found: now})
+
+	// The block isn't waited on to be repaired until it's asked for.
+	if _, ok := bs.pendingRepair(&bad); ok {
+		t.Fatal("expected no pending repair before the block was asked for")
+	}
+	bs.requestedRepair(&bad, now)
+	if height, ok := bs.pendingRepair(&bad); !ok || height != 5 {
+		t.Fatalf("expected a pending repair at height 5, got %d %v",
+			height, ok)
+	}
+	bs.requestedRepair(&proof, now)
+	if _, ok := bs.pendingRepair(&proof); ok {
+		t.Fatal("expected bad proofs not to be repaired from peers")
+	}
+
+	bs.finishPass(now.Add(time.Minute))
+	info := bs.Info()
+	if info.scrubbing || info.passes != 1 || info.blocksChecked != 4 ||
+		info.proofsChecked != 2 || info.badBlocks != 1 ||
+		info.badProofs != 1 {
+
+		t.Fatalf("unexpected counts %+v", info)
+	}
+	if len(info.issues) != 2 || info.issues[0].hash != proof ||
+		info.issues[1].hash != bad {
+
+		t.Fatalf("expected the issues ordered by height, got %+v",
+			info.issues)
+	}
+
+	bs.repaired(&bad)
+	bs.checked(&proof, 2, true)
+	info = bs.Info()
+	if len(info.issues) != 0 || info.repairedBlocks != 1 {
+		t.Fatalf("expected the issues to be resolved, got %+v", info)
+	}
+	if _, ok := bs.pendingRepair(&bad); ok {
+		t.Fatal("expected no pending repair after the block was repaired")
+	}
+}
@@ -76,6 +76,21 @@ func NewGenerateToAddressCmd(numBlocks int64, address string, maxTries *int64) *
 	}
 }
 
+// GenerateBlockCmd defines the generateblock JSON-RPC command.
+type GenerateBlockCmd struct {
+	Output       string
+	Transactions []string
+}
+
+// NewGenerateBlockCmd returns a new instance which can be used to issue a
+// generateblock JSON-RPC command.
+func NewGenerateBlockCmd(output string, transactions []string) *GenerateBlockCmd {
+	return &GenerateBlockCmd{
+		Output:       output,
+		Transactions: transactions,
+	}
+}
+
 // GenerateCmd defines the generate JSON-RPC command.
 type GenerateCmd struct {
 	NumBlocks uint32
@@ -89,6 +104,24 @@ func NewGenerateCmd(numBlocks uint32) *GenerateCmd {
 	}
 }
 
+// GenerateTestUtxosCmd defines the generatetestutxos JSON-RPC command.
+type GenerateTestUtxosCmd struct {
+	Count       uint32
+	ScriptTypes *[]string
+}
+
+// NewGenerateTestUtxosCmd returns a new instance which can be used to issue a
+// generatetestutxos JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGenerateTestUtxosCmd(count uint32, scriptTypes *[]string) *GenerateTestUtxosCmd {
+	return &GenerateTestUtxosCmd{
+		Count:       count,
+		ScriptTypes: scriptTypes,
+	}
+}
+
 // GetBestBlockCmd defines the getbestblock JSON-RPC command.
 type GetBestBlockCmd struct{}
 
@@ -148,7 +181,9 @@ func init() {
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
+	MustRegisterCmd("generateblock", (*GenerateBlockCmd)(nil), flags)
 	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
+	MustRegisterCmd("generatetestutxos", (*GenerateTestUtxosCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
@@ -114,6 +114,47 @@ func TestBtcdExtCmds(t *testing.T) {
 				NumBlocks: 1,
 			},
 		},
+		{
+			name: "generatetestutxos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetestutxos", 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateTestUtxosCmd(10, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetestutxos","params":[10],"id":1}`,
+			unmarshalled: &btcjson.GenerateTestUtxosCmd{
+				Count: 10,
+			},
+		},
+		{
+			name: "generatetestutxos optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetestutxos", 10, []string{"p2pkh", "p2tr"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateTestUtxosCmd(10, &[]string{"p2pkh", "p2tr"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetestutxos","params":[10,["p2pkh","p2tr"]],"id":1}`,
+			unmarshalled: &btcjson.GenerateTestUtxosCmd{
+				Count:       10,
+				ScriptTypes: &[]string{"p2pkh", "p2tr"},
+			},
+		},
+		{
+			name: "generateblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generateblock", "1Address", []string{"123", "456"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateBlockCmd("1Address", []string{"123", "456"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generateblock","params":["1Address",["123","456"]],"id":1}`,
+			unmarshalled: &btcjson.GenerateBlockCmd{
+				Output:       "1Address",
+				Transactions: []string{"123", "456"},
+			},
+		},
 		{
 			name: "generatetoaddress",
 			newCmd: func() (interface{}, error) {
@@ -18,3 +18,29 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// TestUtxoResult models an unspent output created by the generatetestutxos
+// command along with the key that spends it.
+type TestUtxoResult struct {
+	Txid       string  `json:"txid"`
+	Vout       uint32  `json:"vout"`
+	Amount     float64 `json:"amount"`
+	ScriptType string  `json:"scripttype"`
+	Address    string  `json:"address"`
+	PkScript   string  `json:"pkscript"`
+	PrivKey    string  `json:"privkey"`
+	BlockHash  string  `json:"blockhash"`
+	Height     int32   `json:"height"`
+}
+
+// GenerateBlockResult models the data from the generateblock command.
+type GenerateBlockResult struct {
+	Hash string `json:"hash"`
+}
+
+// GenerateTestUtxosResult models the data from the generatetestutxos command.
+// The proof is only set when a utreexo proof index is enabled.
+type GenerateTestUtxosResult struct {
+	Utxos []TestUtxoResult                         `json:"utxos"`
+	Proof *ProveUtxoChainTipInclusionVerboseResult `json:"proof,omitempty"`
+}
@@ -48,6 +48,19 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// BackupUtreexoStateCmd defines the backuputreexostate JSON-RPC command.
+type BackupUtreexoStateCmd struct {
+	DestDir string
+}
+
+// NewBackupUtreexoStateCmd returns a new instance which can be used to issue a
+// backuputreexostate JSON-RPC command.
+func NewBackupUtreexoStateCmd(destDir string) *BackupUtreexoStateCmd {
+	return &BackupUtreexoStateCmd{
+		DestDir: destDir,
+	}
+}
+
 // BalanceCmd defines the balance JSON-RPC command.
 type BalanceCmd struct{}
 
@@ -57,6 +70,22 @@ func NewBalanceCmd() *BalanceCmd {
 	return &BalanceCmd{}
 }
 
+// CompactProofsCmd defines the compactproofs JSON-RPC command.
+type CompactProofsCmd struct {
+	PruneHeight *int32
+}
+
+// NewCompactProofsCmd returns a new instance which can be used to issue a
+// compactproofs JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewCompactProofsCmd(pruneHeight *int32) *CompactProofsCmd {
+	return &CompactProofsCmd{
+		PruneHeight: pruneHeight,
+	}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -111,6 +140,30 @@ func NewCreateRawTransactionCmd(inputs []TransactionInput, amounts map[string]fl
 	}
 }
 
+// CreatePsbtCmd defines the createpsbt JSON-RPC command.
+type CreatePsbtCmd struct {
+	Inputs   []TransactionInput
+	Amounts  map[string]float64 `jsonrpcusage:"{\"address\":amount,...}"` // In BTC
+	LockTime *int64
+}
+
+// NewCreatePsbtCmd returns a new instance which can be used to issue a
+// createpsbt JSON-RPC command.
+//
+// Amounts are in BTC. Passing in nil and the empty slice as inputs is equivalent,
+// both gets interpreted as the empty slice.
+func NewCreatePsbtCmd(inputs []TransactionInput, amounts map[string]float64,
+	lockTime *int64) *CreatePsbtCmd {
+	if inputs == nil {
+		inputs = []TransactionInput{}
+	}
+	return &CreatePsbtCmd{
+		Inputs:   inputs,
+		Amounts:  amounts,
+		LockTime: lockTime,
+	}
+}
+
 // DecodeRawTransactionCmd defines the decoderawtransaction JSON-RPC command.
 type DecodeRawTransactionCmd struct {
 	HexTx string
@@ -152,6 +205,24 @@ func NewDeriveAddressesCmd(descriptor string, descriptorRange *DescriptorRange)
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path   string
+	Height *int32
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewDumpTxOutSetCmd(path string, height *int32) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path:   path,
+		Height: height,
+	}
+}
+
 // ChangeType defines the different output types to use for the change address
 // of a transaction built by the node.
 type ChangeType string
@@ -205,6 +276,24 @@ func NewFundRawTransactionCmd(serializedTx []byte, opts FundRawTransactionOpts,
 	}
 }
 
+// FinalizePsbtCmd defines the finalizepsbt JSON-RPC command.
+type FinalizePsbtCmd struct {
+	Psbt    string
+	Extract *bool `jsonrpcdefault:"true"`
+}
+
+// NewFinalizePsbtCmd returns a new instance which can be used to issue a
+// finalizepsbt JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewFinalizePsbtCmd(psbt string, extract *bool) *FinalizePsbtCmd {
+	return &FinalizePsbtCmd{
+		Psbt:    psbt,
+		Extract: extract,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -361,6 +450,15 @@ func (h *HashOrHeight) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// GetBlockScrubInfoCmd defines the getblockscrubinfo JSON-RPC command.
+type GetBlockScrubInfoCmd struct{}
+
+// NewGetBlockScrubInfoCmd returns a new instance which can be used to issue a
+// getblockscrubinfo JSON-RPC command.
+func NewGetBlockScrubInfoCmd() *GetBlockScrubInfoCmd {
+	return &GetBlockScrubInfoCmd{}
+}
+
 // GetBlockStatsCmd defines the getblockstats JSON-RPC command.
 type GetBlockStatsCmd struct {
 	HashOrHeight HashOrHeight
@@ -468,6 +566,24 @@ func NewGetBlockTemplateCmd(request *TemplateRequest) *GetBlockTemplateCmd {
 	}
 }
 
+// GetBootstrapPackageCmd defines the getbootstrappackage JSON-RPC command.
+type GetBootstrapPackageCmd struct {
+	BlockHash *string
+	NumProofs *int32 `jsonrpcdefault:"0"`
+}
+
+// NewGetBootstrapPackageCmd returns a new instance which can be used to issue
+// a getbootstrappackage JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBootstrapPackageCmd(blockHash *string, numProofs *int32) *GetBootstrapPackageCmd {
+	return &GetBootstrapPackageCmd{
+		BlockHash: blockHash,
+		NumProofs: numProofs,
+	}
+}
+
 // GetCFilterCmd defines the getcfilter JSON-RPC command.
 type GetCFilterCmd struct {
 	Hash       string
@@ -526,6 +642,22 @@ func NewGetChainTxStatsCmd(nBlocks *int32, blockHash *string) *GetChainTxStatsCm
 	}
 }
 
+// GetConformanceVectorsCmd defines the getconformancevectors JSON-RPC command.
+type GetConformanceVectorsCmd struct {
+	Height *int32
+}
+
+// NewGetConformanceVectorsCmd returns a new instance which can be used to
+// issue a getconformancevectors JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetConformanceVectorsCmd(height *int32) *GetConformanceVectorsCmd {
+	return &GetConformanceVectorsCmd{
+		Height: height,
+	}
+}
+
 // GetConnectionCountCmd defines the getconnectioncount JSON-RPC command.
 type GetConnectionCountCmd struct{}
 
@@ -548,6 +680,22 @@ func NewGetDescriptorInfoCmd(descriptor string) *GetDescriptorInfoCmd {
 	}
 }
 
+// GetDeploymentInfoCmd defines the getdeploymentinfo JSON-RPC command.
+type GetDeploymentInfoCmd struct {
+	BlockHash *string
+}
+
+// NewGetDeploymentInfoCmd returns a new instance which can be used to issue a
+// getdeploymentinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetDeploymentInfoCmd(blockHash *string) *GetDeploymentInfoCmd {
+	return &GetDeploymentInfoCmd{
+		BlockHash: blockHash,
+	}
+}
+
 // GetDifficultyCmd defines the getdifficulty JSON-RPC command.
 type GetDifficultyCmd struct{}
 
@@ -557,6 +705,15 @@ func NewGetDifficultyCmd() *GetDifficultyCmd {
 	return &GetDifficultyCmd{}
 }
 
+// GetDiskUsageCmd defines the getdiskusage JSON-RPC command.
+type GetDiskUsageCmd struct{}
+
+// NewGetDiskUsageCmd returns a new instance which can be used to issue a
+// getdiskusage JSON-RPC command.
+func NewGetDiskUsageCmd() *GetDiskUsageCmd {
+	return &GetDiskUsageCmd{}
+}
+
 // GetGenerateCmd defines the getgenerate JSON-RPC command.
 type GetGenerateCmd struct{}
 
@@ -575,6 +732,22 @@ func NewGetHashesPerSecCmd() *GetHashesPerSecCmd {
 	return &GetHashesPerSecCmd{}
 }
 
+// GetIndexInfoCmd defines the getindexinfo JSON-RPC command.
+type GetIndexInfoCmd struct {
+	IndexName *string
+}
+
+// NewGetIndexInfoCmd returns a new instance which can be used to issue a
+// getindexinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetIndexInfoCmd(indexName *string) *GetIndexInfoCmd {
+	return &GetIndexInfoCmd{
+		IndexName: indexName,
+	}
+}
+
 // GetInfoCmd defines the getinfo JSON-RPC command.
 type GetInfoCmd struct{}
 
@@ -584,6 +757,61 @@ func NewGetInfoCmd() *GetInfoCmd {
 	return &GetInfoCmd{}
 }
 
+// GetCoinAgeStatsCmd defines the getcoinagestats JSON-RPC command.
+type GetCoinAgeStatsCmd struct {
+	Height *int32
+}
+
+// NewGetCoinAgeStatsCmd returns a new instance which can be used to issue a
+// getcoinagestats JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetCoinAgeStatsCmd(height *int32) *GetCoinAgeStatsCmd {
+	return &GetCoinAgeStatsCmd{
+		Height: height,
+	}
+}
+
+// GetLeafTTLsCmd defines the getleafttls JSON-RPC command.
+type GetLeafTTLsCmd struct {
+	Height int32
+}
+
+// NewGetLeafTTLsCmd returns a new instance which can be used to issue a
+// getleafttls JSON-RPC command.
+func NewGetLeafTTLsCmd(height int32) *GetLeafTTLsCmd {
+	return &GetLeafTTLsCmd{
+		Height: height,
+	}
+}
+
+// GetLeafAtPositionCmd defines the getleafatposition JSON-RPC command.
+type GetLeafAtPositionCmd struct {
+	Position uint64
+}
+
+// NewGetLeafAtPositionCmd returns a new instance which can be used to issue a
+// getleafatposition JSON-RPC command.
+func NewGetLeafAtPositionCmd(position uint64) *GetLeafAtPositionCmd {
+	return &GetLeafAtPositionCmd{
+		Position: position,
+	}
+}
+
+// GetLeafByHashCmd defines the getleafbyhash JSON-RPC command.
+type GetLeafByHashCmd struct {
+	LeafHash string
+}
+
+// NewGetLeafByHashCmd returns a new instance which can be used to issue a
+// getleafbyhash JSON-RPC command.
+func NewGetLeafByHashCmd(leafHash string) *GetLeafByHashCmd {
+	return &GetLeafByHashCmd{
+		LeafHash: leafHash,
+	}
+}
+
 // GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
 type GetMempoolEntryCmd struct {
 	TxID string
@@ -651,6 +879,15 @@ func NewGetTxTotalsCmd() *GetTxTotalsCmd {
 	return &GetTxTotalsCmd{}
 }
 
+// GetPeerPolicyInfoCmd defines the getpeerpolicyinfo JSON-RPC command.
+type GetPeerPolicyInfoCmd struct{}
+
+// NewGetPeerPolicyInfoCmd returns a new instance which can be used to issue a
+// getpeerpolicyinfo JSON-RPC command.
+func NewGetPeerPolicyInfoCmd() *GetPeerPolicyInfoCmd {
+	return &GetPeerPolicyInfoCmd{}
+}
+
 // GetNetworkHashPSCmd defines the getnetworkhashps JSON-RPC command.
 type GetNetworkHashPSCmd struct {
 	Blocks *int `jsonrpcdefault:"120"`
@@ -694,6 +931,15 @@ func NewGetPeerInfoCmd() *GetPeerInfoCmd {
 	return &GetPeerInfoCmd{}
 }
 
+// GetPeerReputationCmd defines the getpeerreputation JSON-RPC command.
+type GetPeerReputationCmd struct{}
+
+// NewGetPeerReputationCmd returns a new instance which can be used to issue a
+// getpeerreputation JSON-RPC command.
+func NewGetPeerReputationCmd() *GetPeerReputationCmd {
+	return &GetPeerReputationCmd{}
+}
+
 // GetRawMempoolCmd defines the getmempool JSON-RPC command.
 type GetRawMempoolCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -811,14 +1057,88 @@ func NewGetUtreexoProofCmd(blockhash string, verbosity *int) *GetUtreexoProofCmd
 	}
 }
 
+// GetUtreexoProofsCmd defines the getutreexoproofs JSON-RPC command.
+type GetUtreexoProofsCmd struct {
+	StartHeight int32
+	EndHeight   int32
+}
+
+// NewGetUtreexoProofsCmd returns a new instance which can be used to issue a
+// getutreexoproofs JSON-RPC command.
+func NewGetUtreexoProofsCmd(startHeight, endHeight int32) *GetUtreexoProofsCmd {
+	return &GetUtreexoProofsCmd{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+	}
+}
+
+// GetUtreexoInfoCmd defines the getutreexoinfo JSON-RPC command.
+type GetUtreexoInfoCmd struct{}
+
+// NewGetUtreexoInfoCmd returns a new instance which can be used to issue a
+// getutreexoinfo JSON-RPC command.
+func NewGetUtreexoInfoCmd() *GetUtreexoInfoCmd {
+	return &GetUtreexoInfoCmd{}
+}
+
+// GetUtreexoProofStatsCmd defines the getutreexoproofstats JSON-RPC command.
+type GetUtreexoProofStatsCmd struct {
+	StartHeight *int32
+	EndHeight   *int32
+}
+
+// NewGetUtreexoProofStatsCmd returns a new instance which can be used to issue
+// a getutreexoproofstats JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetUtreexoProofStatsCmd(startHeight, endHeight *int32) *GetUtreexoProofStatsCmd {
+	return &GetUtreexoProofStatsCmd{
+		StartHeight: startHeight,
+		EndHeight:   endHeight,
+	}
+}
+
+// GetHistoricalRootsCmd defines the gethistoricalroots JSON-RPC command.
+type GetHistoricalRootsCmd struct {
+	Height int32
+}
+
+// NewGetHistoricalRootsCmd returns a new instance which can be used to issue a
+// gethistoricalroots JSON-RPC command.
+func NewGetHistoricalRootsCmd(height int32) *GetHistoricalRootsCmd {
+	return &GetHistoricalRootsCmd{
+		Height: height,
+	}
+}
+
+// GetProofAccessStatsCmd defines the getproofaccessstats JSON-RPC command.
+type GetProofAccessStatsCmd struct {
+	Reset *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetProofAccessStatsCmd returns a new instance which can be used to issue
+// a getproofaccessstats JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetProofAccessStatsCmd(reset *bool) *GetProofAccessStatsCmd {
+	return &GetProofAccessStatsCmd{
+		Reset: reset,
+	}
+}
+
 // GetUtreexoRootsCmd defines the getutreexoroots JSON-RPC command.
 type GetUtreexoRootsCmd struct {
-	BlockHash string
+	BlockHash *string
 }
 
 // NewGetUtreexoRootsCmd returns a new instance which can be used
 // to issue a getutreexoroots JSON-RPC command.
-func NewGetUtreexoRootsCmd(blockhash string) *GetUtreexoRootsCmd {
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetUtreexoRootsCmd(blockhash *string) *GetUtreexoRootsCmd {
 	return &GetUtreexoRootsCmd{
 		BlockHash: blockhash,
 	}
@@ -849,6 +1169,22 @@ func NewGetWorkCmd(data *string) *GetWorkCmd {
 	}
 }
 
+// GetWalletUtxosCmd defines the getwalletutxos JSON-RPC command.
+type GetWalletUtxosCmd struct {
+	Descriptor *string
+}
+
+// NewGetWalletUtxosCmd returns a new instance which can be used to issue a
+// getwalletutxos JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetWalletUtxosCmd(descriptor *string) *GetWalletUtxosCmd {
+	return &GetWalletUtxosCmd{
+		Descriptor: descriptor,
+	}
+}
+
 // GetWatchOnlyBalanceCmd defines the getwatchonlybalance JSON-RPC command.
 type GetWatchOnlyBalanceCmd struct{}
 
@@ -905,6 +1241,26 @@ func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
 	}
 }
 
+// ListUtxoSetCmd defines the listutxoset JSON-RPC command.
+type ListUtxoSetCmd struct {
+	Cursor        *string
+	Count         *int  `jsonrpcdefault:"1000"`
+	IncludeProofs *bool `jsonrpcdefault:"false"`
+}
+
+// NewListUtxoSetCmd returns a new instance which can be used to issue a
+// listutxoset JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListUtxoSetCmd(cursor *string, count *int, includeProofs *bool) *ListUtxoSetCmd {
+	return &ListUtxoSetCmd{
+		Cursor:        cursor,
+		Count:         count,
+		IncludeProofs: includeProofs,
+	}
+}
+
 // PeekAddressCmd defines the peekaddress JSON-RPC command.
 type PeekAddressCmd struct {
 	Index uint32
@@ -938,6 +1294,21 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// ProveUtxoCmd defines the proveutxo JSON-RPC command.
+type ProveUtxoCmd struct {
+	Txid string
+	Vout uint32
+}
+
+// NewProveUtxoCmd returns a new instance which can be used to issue a proveutxo
+// JSON-RPC command.
+func NewProveUtxoCmd(txid string, vout uint32) *ProveUtxoCmd {
+	return &ProveUtxoCmd{
+		Txid: txid,
+		Vout: vout,
+	}
+}
+
 // ProveUtxoChainTipInclusionCmd defines the proveutxochaintipinclusion JSON-RPC
 // command.
 type ProveUtxoChainTipInclusionCmd struct {
@@ -995,6 +1366,20 @@ func NewRegisterAddressesToWatchOnlyWalletCmd(addresses []string) *RegisterAddre
 	}
 }
 
+// RegisterDescriptorsToWatchOnlyWalletCmd defines the registerdescriptorstowatchonlywallet
+// JSON-RPC command.
+type RegisterDescriptorsToWatchOnlyWalletCmd struct {
+	Descriptors []string
+}
+
+// NewRegisterDescriptorsToWatchOnlyWalletCmd returns a new instance which can be used to
+// issue a registerdescriptorstowatchonlywallet JSON-RPC command.
+func NewRegisterDescriptorsToWatchOnlyWalletCmd(descriptors []string) *RegisterDescriptorsToWatchOnlyWalletCmd {
+	return &RegisterDescriptorsToWatchOnlyWalletCmd{
+		Descriptors: descriptors,
+	}
+}
+
 // RebroadcastUnconfirmedBDKTxsCmd defines the rebroadcastunconfirmedbdktxs JSON-RPC
 // command.
 type RebroadcastUnconfirmedBDKTxsCmd struct{}
@@ -1116,6 +1501,22 @@ func NewBitcoindSendRawTransactionCmd(hexTx string, maxFeeRate int32) *SendRawTr
 	}
 }
 
+// SendRawTransactionWithProofCmd defines the sendrawtransactionwithproof
+// JSON-RPC command.
+type SendRawTransactionWithProofCmd struct {
+	HexTx    string
+	HexProof string
+}
+
+// NewSendRawTransactionWithProofCmd returns a new instance which can be used to
+// issue a sendrawtransactionwithproof JSON-RPC command.
+func NewSendRawTransactionWithProofCmd(hexTx, hexProof string) *SendRawTransactionWithProofCmd {
+	return &SendRawTransactionWithProofCmd{
+		HexTx:    hexTx,
+		HexProof: hexProof,
+	}
+}
+
 // SetGenerateCmd defines the setgenerate JSON-RPC command.
 type SetGenerateCmd struct {
 	Generate     bool
@@ -1186,6 +1587,30 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// SubmitPackageCmd defines the submitpackage JSON-RPC command.
+type SubmitPackageCmd struct {
+	// RawTxns are the hex-encoded raw transactions of the package, the
+	// parents first and the child last.
+	RawTxns []string
+
+	// Proofs are the hex-encoded utreexo proofs of the inputs of the
+	// transactions in the same order as the transactions.  They're
+	// required by nodes without the utxo set.
+	Proofs *[]string
+}
+
+// NewSubmitPackageCmd returns a new instance which can be used to issue a
+// submitpackage JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSubmitPackageCmd(rawTxns []string, proofs *[]string) *SubmitPackageCmd {
+	return &SubmitPackageCmd{
+		RawTxns: rawTxns,
+		Proofs:  proofs,
+	}
+}
+
 // UnusedAddressCmd defines the unusedaddress JSON-RPC command.
 type UnusedAddressCmd struct{}
 
@@ -1203,6 +1628,19 @@ func NewUptimeCmd() *UptimeCmd {
 	return &UptimeCmd{}
 }
 
+// UtxoUpdatePsbtCmd defines the utxoupdatepsbt JSON-RPC command.
+type UtxoUpdatePsbtCmd struct {
+	Psbt string
+}
+
+// NewUtxoUpdatePsbtCmd returns a new instance which can be used to issue a
+// utxoupdatepsbt JSON-RPC command.
+func NewUtxoUpdatePsbtCmd(psbt string) *UtxoUpdatePsbtCmd {
+	return &UtxoUpdatePsbtCmd{
+		Psbt: psbt,
+	}
+}
+
 // ValidateAddressCmd defines the validateaddress JSON-RPC command.
 type ValidateAddressCmd struct {
 	Address string
@@ -1264,6 +1702,27 @@ func NewVerifyTxOutProofCmd(proof string) *VerifyTxOutProofCmd {
 	}
 }
 
+// VerifyUtreexoProofCmd defines the verifyutreexoproof JSON-RPC command.
+type VerifyUtreexoProofCmd struct {
+	Roots     []string
+	NumLeaves uint64
+	Proof     string
+	DelHashes []string
+}
+
+// NewVerifyUtreexoProofCmd returns a new instance which can be used to issue a
+// verifyutreexoproof JSON-RPC command.
+func NewVerifyUtreexoProofCmd(roots []string, numLeaves uint64, proof string,
+	delHashes []string) *VerifyUtreexoProofCmd {
+
+	return &VerifyUtreexoProofCmd{
+		Roots:     roots,
+		NumLeaves: numLeaves,
+		Proof:     proof,
+		DelHashes: delHashes,
+	}
+}
+
 // VerifyUtxoChainTipInclusionProofCmd defines the verifyutxochaintipinclusionproof JSON-RPC
 // command.
 type VerifyUtxoChainTipInclusionProofCmd struct {
@@ -1284,16 +1743,25 @@ type TestMempoolAcceptCmd struct {
 	// Reject transactions whose fee rate is higher than the specified
 	// value, expressed in BTC/kvB, optional, default="0.10".
 	MaxFeeRate float64 `json:"omitempty"`
+
+	// An array of hex strings of the utreexo proofs of the inputs of the
+	// raw transactions in the same order as the transactions.  They're
+	// required by nodes without the utxo set.
+	Proofs *[]string
 }
 
 // NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
 // testmempoolaccept JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
 func NewTestMempoolAcceptCmd(rawTxns []string,
-	maxFeeRate float64) *TestMempoolAcceptCmd {
+	maxFeeRate float64, proofs *[]string) *TestMempoolAcceptCmd {
 
 	return &TestMempoolAcceptCmd{
 		RawTxns:    rawTxns,
 		MaxFeeRate: maxFeeRate,
+		Proofs:     proofs,
 	}
 }
 
@@ -1303,11 +1771,16 @@ func init() {
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
 	MustRegisterCmd("balance", (*BalanceCmd)(nil), flags)
+	MustRegisterCmd("backuputreexostate", (*BackupUtreexoStateCmd)(nil), flags)
+	MustRegisterCmd("compactproofs", (*CompactProofsCmd)(nil), flags)
 	MustRegisterCmd("createtransactionfrombdkwallet", (*CreateTransactionFromBDKWalletCmd)(nil), flags)
+	MustRegisterCmd("createpsbt", (*CreatePsbtCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
 	MustRegisterCmd("deriveaddresses", (*DeriveAddressesCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
+	MustRegisterCmd("finalizepsbt", (*FinalizePsbtCmd)(nil), flags)
 	MustRegisterCmd("freshaddress", (*FreshAddressCmd)(nil), flags)
 	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
@@ -1319,18 +1792,28 @@ func init() {
 	MustRegisterCmd("getblockfilter", (*GetBlockFilterCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockscrubinfo", (*GetBlockScrubInfoCmd)(nil), flags)
 	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
+	MustRegisterCmd("getbootstrappackage", (*GetBootstrapPackageCmd)(nil), flags)
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getchaintxstats", (*GetChainTxStatsCmd)(nil), flags)
+	MustRegisterCmd("getconformancevectors", (*GetConformanceVectorsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
 	MustRegisterCmd("getdescriptorinfo", (*GetDescriptorInfoCmd)(nil), flags)
+	MustRegisterCmd("getdeploymentinfo", (*GetDeploymentInfoCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
+	MustRegisterCmd("getdiskusage", (*GetDiskUsageCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
+	MustRegisterCmd("getindexinfo", (*GetIndexInfoCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getleafatposition", (*GetLeafAtPositionCmd)(nil), flags)
+	MustRegisterCmd("getleafbyhash", (*GetLeafByHashCmd)(nil), flags)
+	MustRegisterCmd("getcoinagestats", (*GetCoinAgeStatsCmd)(nil), flags)
+	MustRegisterCmd("getleafttls", (*GetLeafTTLsCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
@@ -1341,41 +1824,56 @@ func init() {
 	MustRegisterCmd("getnetworkhashps", (*GetNetworkHashPSCmd)(nil), flags)
 	MustRegisterCmd("getnodeaddresses", (*GetNodeAddressesCmd)(nil), flags)
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
+	MustRegisterCmd("getpeerpolicyinfo", (*GetPeerPolicyInfoCmd)(nil), flags)
+	MustRegisterCmd("getpeerreputation", (*GetPeerReputationCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getttl", (*GetTTLCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
+	MustRegisterCmd("getutreexoinfo", (*GetUtreexoInfoCmd)(nil), flags)
 	MustRegisterCmd("getutreexoproof", (*GetUtreexoProofCmd)(nil), flags)
+	MustRegisterCmd("getutreexoproofs", (*GetUtreexoProofsCmd)(nil), flags)
+	MustRegisterCmd("getutreexoproofstats", (*GetUtreexoProofStatsCmd)(nil), flags)
+	MustRegisterCmd("gethistoricalroots", (*GetHistoricalRootsCmd)(nil), flags)
+	MustRegisterCmd("getproofaccessstats", (*GetProofAccessStatsCmd)(nil), flags)
 	MustRegisterCmd("getutreexoroots", (*GetUtreexoRootsCmd)(nil), flags)
 	MustRegisterCmd("getutreexoblocksummaryroots", (*GetUtreexoBlockSummaryRootsCmd)(nil), flags)
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
+	MustRegisterCmd("getwalletutxos", (*GetWalletUtxosCmd)(nil), flags)
 	MustRegisterCmd("getwatchonlybalance", (*GetWatchOnlyBalanceCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("listbdktransactions", (*ListBDKTransactionsCmd)(nil), flags)
 	MustRegisterCmd("listbdkutxos", (*ListBDKUTXOsCmd)(nil), flags)
+	MustRegisterCmd("listutxoset", (*ListUtxoSetCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
 	MustRegisterCmd("peekaddress", (*PeekAddressCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("proveutxo", (*ProveUtxoCmd)(nil), flags)
 	MustRegisterCmd("proveutxochaintipinclusion", (*ProveUtxoChainTipInclusionCmd)(nil), flags)
 	MustRegisterCmd("provewatchonlychaintipinclusion", (*ProveWatchOnlyChainTipInclusionCmd)(nil), flags)
 	MustRegisterCmd("registeraddressestowatchonlywallet", (*RegisterAddressesToWatchOnlyWalletCmd)(nil), flags)
+	MustRegisterCmd("registerdescriptorstowatchonlywallet", (*RegisterDescriptorsToWatchOnlyWalletCmd)(nil), flags)
 	MustRegisterCmd("rebroadcastunconfirmedbdktxs", (*RebroadcastUnconfirmedBDKTxsCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("sendrawtransactionwithproof", (*SendRawTransactionWithProofCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("signmessagewithprivkey", (*SignMessageWithPrivKeyCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("submitpackage", (*SubmitPackageCmd)(nil), flags)
 	MustRegisterCmd("unusedaddress", (*UnusedAddressCmd)(nil), flags)
 	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
+	MustRegisterCmd("utxoupdatepsbt", (*UtxoUpdatePsbtCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
 	MustRegisterCmd("verifytxoutproof", (*VerifyTxOutProofCmd)(nil), flags)
+	MustRegisterCmd("verifyutreexoproof", (*VerifyUtreexoProofCmd)(nil), flags)
 	MustRegisterCmd("verifyutxochaintipinclusionproof", (*VerifyUtxoChainTipInclusionProofCmd)(nil), flags)
 	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
 }
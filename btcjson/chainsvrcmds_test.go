@@ -42,6 +42,100 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "backuputreexostate",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("backuputreexostate", "/backup")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewBackupUtreexoStateCmd("/backup")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"backuputreexostate","params":["/backup"],"id":1}`,
+			unmarshalled: &btcjson.BackupUtreexoStateCmd{DestDir: "/backup"},
+		},
+		{
+			name: "compactproofs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("compactproofs")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCompactProofsCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"compactproofs","params":[],"id":1}`,
+			unmarshalled: &btcjson.CompactProofsCmd{PruneHeight: nil},
+		},
+		{
+			name: "compactproofs optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("compactproofs", 1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCompactProofsCmd(btcjson.Int32(1000))
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"compactproofs","params":[1000],"id":1}`,
+			unmarshalled: &btcjson.CompactProofsCmd{PruneHeight: btcjson.Int32(1000)},
+		},
+		{
+			name: "createpsbt",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("createpsbt", `[{"txid":"123","vout":1}]`,
+					`{"456":0.0123}`, int64(100))
+			},
+			staticCmd: func() interface{} {
+				txInputs := []btcjson.TransactionInput{
+					{Txid: "123", Vout: 1},
+				}
+				amounts := map[string]float64{"456": .0123}
+				return btcjson.NewCreatePsbtCmd(txInputs, amounts, btcjson.Int64(100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"createpsbt","params":[[{"txid":"123","vout":1}],{"456":0.0123},100],"id":1}`,
+			unmarshalled: &btcjson.CreatePsbtCmd{
+				Inputs:   []btcjson.TransactionInput{{Txid: "123", Vout: 1}},
+				Amounts:  map[string]float64{"456": .0123},
+				LockTime: btcjson.Int64(100),
+			},
+		},
+		{
+			name: "finalizepsbt",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("finalizepsbt", "cHNidP8=")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewFinalizePsbtCmd("cHNidP8=", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"finalizepsbt","params":["cHNidP8="],"id":1}`,
+			unmarshalled: &btcjson.FinalizePsbtCmd{
+				Psbt:    "cHNidP8=",
+				Extract: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "finalizepsbt optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("finalizepsbt", "cHNidP8=", false)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewFinalizePsbtCmd("cHNidP8=", btcjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"finalizepsbt","params":["cHNidP8=",false],"id":1}`,
+			unmarshalled: &btcjson.FinalizePsbtCmd{
+				Psbt:    "cHNidP8=",
+				Extract: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "utxoupdatepsbt",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("utxoupdatepsbt", "cHNidP8=")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewUtxoUpdatePsbtCmd("cHNidP8=")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"utxoupdatepsbt","params":["cHNidP8="],"id":1}`,
+			unmarshalled: &btcjson.UtxoUpdatePsbtCmd{
+				Psbt: "cHNidP8=",
+			},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -265,6 +359,31 @@ func TestChainSvrCmds(t *testing.T) {
 				Range:      &btcjson.DescriptorRange{Value: []int{0, 2}},
 			},
 		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDumpTxOutSetCmd("utxo.dat", nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &btcjson.DumpTxOutSetCmd{Path: "utxo.dat"},
+		},
+		{
+			name: "dumptxoutset optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("dumptxoutset", "utxo.dat", 840000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDumpTxOutSetCmd("utxo.dat", btcjson.Int32(840000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat",840000],"id":1}`,
+			unmarshalled: &btcjson.DumpTxOutSetCmd{
+				Path:   "utxo.dat",
+				Height: btcjson.Int32(840000),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -412,6 +531,218 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getblockhash","params":[123],"id":1}`,
 			unmarshalled: &btcjson.GetBlockHashCmd{Index: 123},
 		},
+		{
+			name: "getleafatposition",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getleafatposition", 12)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetLeafAtPositionCmd(12)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getleafatposition","params":[12],"id":1}`,
+			unmarshalled: &btcjson.GetLeafAtPositionCmd{Position: 12},
+		},
+		{
+			name: "getleafbyhash",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getleafbyhash", "0102")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetLeafByHashCmd("0102")
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getleafbyhash","params":["0102"],"id":1}`,
+			unmarshalled: &btcjson.GetLeafByHashCmd{LeafHash: "0102"},
+		},
+		{
+			name: "getleafttls",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getleafttls", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetLeafTTLsCmd(100)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getleafttls","params":[100],"id":1}`,
+			unmarshalled: &btcjson.GetLeafTTLsCmd{Height: 100},
+		},
+		{
+			name: "getutreexoproofs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoproofs", 1, 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoProofsCmd(1, 10)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getutreexoproofs","params":[1,10],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoProofsCmd{
+				StartHeight: 1,
+				EndHeight:   10,
+			},
+		},
+		{
+			name: "getutreexoinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getutreexoinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoInfoCmd{},
+		},
+		{
+			name: "getcoinagestats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcoinagestats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCoinAgeStatsCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getcoinagestats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetCoinAgeStatsCmd{},
+		},
+		{
+			name: "getcoinagestats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcoinagestats", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCoinAgeStatsCmd(btcjson.Int32(100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getcoinagestats","params":[100],"id":1}`,
+			unmarshalled: &btcjson.GetCoinAgeStatsCmd{
+				Height: btcjson.Int32(100),
+			},
+		},
+		{
+			name: "getutreexoproofstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoproofstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoProofStatsCmd(nil, nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getutreexoproofstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoProofStatsCmd{},
+		},
+		{
+			name: "getutreexoproofstats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoproofstats", 100, 200)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoProofStatsCmd(btcjson.Int32(100),
+					btcjson.Int32(200))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getutreexoproofstats","params":[100,200],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoProofStatsCmd{
+				StartHeight: btcjson.Int32(100),
+				EndHeight:   btcjson.Int32(200),
+			},
+		},
+		{
+			name: "gethistoricalroots",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gethistoricalroots", 123)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetHistoricalRootsCmd(123)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gethistoricalroots","params":[123],"id":1}`,
+			unmarshalled: &btcjson.GetHistoricalRootsCmd{
+				Height: 123,
+			},
+		},
+		{
+			name: "getwalletutxos",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getwalletutxos")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetWalletUtxosCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getwalletutxos","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetWalletUtxosCmd{
+				Descriptor: nil,
+			},
+		},
+		{
+			name: "getwalletutxos descriptor",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getwalletutxos", "addr(bcrt1qxyz)")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetWalletUtxosCmd(btcjson.String("addr(bcrt1qxyz)"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getwalletutxos","params":["addr(bcrt1qxyz)"],"id":1}`,
+			unmarshalled: &btcjson.GetWalletUtxosCmd{
+				Descriptor: btcjson.String("addr(bcrt1qxyz)"),
+			},
+		},
+		{
+			name: "registerdescriptorstowatchonlywallet",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("registerdescriptorstowatchonlywallet",
+					[]string{"wpkh(tpub/0/*)", "addr(bcrt1qxyz)"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRegisterDescriptorsToWatchOnlyWalletCmd(
+					[]string{"wpkh(tpub/0/*)", "addr(bcrt1qxyz)"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"registerdescriptorstowatchonlywallet","params":[["wpkh(tpub/0/*)","addr(bcrt1qxyz)"]],"id":1}`,
+			unmarshalled: &btcjson.RegisterDescriptorsToWatchOnlyWalletCmd{
+				Descriptors: []string{"wpkh(tpub/0/*)", "addr(bcrt1qxyz)"},
+			},
+		},
+		{
+			name: "getproofaccessstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getproofaccessstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetProofAccessStatsCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getproofaccessstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetProofAccessStatsCmd{
+				Reset: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getproofaccessstats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getproofaccessstats", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetProofAccessStatsCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getproofaccessstats","params":[true],"id":1}`,
+			unmarshalled: &btcjson.GetProofAccessStatsCmd{
+				Reset: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "getutreexoroots",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoroots")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoRootsCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getutreexoroots","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoRootsCmd{},
+		},
+		{
+			name: "getutreexoroots height",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getutreexoroots", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetUtreexoRootsCmd(btcjson.String("123"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getutreexoroots","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetUtreexoRootsCmd{
+				BlockHash: btcjson.String("123"),
+			},
+		},
 		{
 			name: "getblockheader",
 			newCmd: func() (interface{}, error) {
@@ -426,6 +757,17 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblockscrubinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockscrubinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockScrubInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getblockscrubinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetBlockScrubInfoCmd{},
+		},
 		{
 			name: "getblockstats height",
 			newCmd: func() (interface{}, error) {
@@ -644,6 +986,58 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: btcjson.String("0000afaf"),
 			},
 		},
+		{
+			name: "getbootstrappackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getbootstrappackage")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBootstrapPackageCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getbootstrappackage","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetBootstrapPackageCmd{
+				NumProofs: btcjson.Int32(0),
+			},
+		},
+		{
+			name: "getbootstrappackage optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getbootstrappackage", "1000", 10)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBootstrapPackageCmd(btcjson.String("1000"),
+					btcjson.Int32(10))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getbootstrappackage","params":["1000",10],"id":1}`,
+			unmarshalled: &btcjson.GetBootstrapPackageCmd{
+				BlockHash: btcjson.String("1000"),
+				NumProofs: btcjson.Int32(10),
+			},
+		},
+		{
+			name: "getconformancevectors",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getconformancevectors")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetConformanceVectorsCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getconformancevectors","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetConformanceVectorsCmd{},
+		},
+		{
+			name: "getconformancevectors optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getconformancevectors", 101)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetConformanceVectorsCmd(btcjson.Int32(101))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getconformancevectors","params":[101],"id":1}`,
+			unmarshalled: &btcjson.GetConformanceVectorsCmd{
+				Height: btcjson.Int32(101),
+			},
+		},
 		{
 			name: "getconnectioncount",
 			newCmd: func() (interface{}, error) {
@@ -655,6 +1049,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getconnectioncount","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetConnectionCountCmd{},
 		},
+		{
+			name: "getdeploymentinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdeploymentinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDeploymentInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDeploymentInfoCmd{},
+		},
+		{
+			name: "getdeploymentinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdeploymentinfo", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDeploymentInfoCmd(btcjson.String("123"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetDeploymentInfoCmd{
+				BlockHash: btcjson.String("123"),
+			},
+		},
 		{
 			name: "getdifficulty",
 			newCmd: func() (interface{}, error) {
@@ -666,6 +1084,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getdifficulty","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetDifficultyCmd{},
 		},
+		{
+			name: "getdiskusage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdiskusage")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDiskUsageCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdiskusage","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDiskUsageCmd{},
+		},
 		{
 			name: "getgenerate",
 			newCmd: func() (interface{}, error) {
@@ -688,6 +1117,28 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"gethashespersec","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetHashesPerSecCmd{},
 		},
+		{
+			name: "getindexinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getindexinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetIndexInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getindexinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetIndexInfoCmd{IndexName: nil},
+		},
+		{
+			name: "getindexinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getindexinfo", "utreexoproofindex")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetIndexInfoCmd(btcjson.String("utreexoproofindex"))
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getindexinfo","params":["utreexoproofindex"],"id":1}`,
+			unmarshalled: &btcjson.GetIndexInfoCmd{IndexName: btcjson.String("utreexoproofindex")},
+		},
 		{
 			name: "getinfo",
 			newCmd: func() (interface{}, error) {
@@ -756,6 +1207,28 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getnettotals","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetNetTotalsCmd{},
 		},
+		{
+			name: "getpeerpolicyinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpeerpolicyinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPeerPolicyInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpeerpolicyinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPeerPolicyInfoCmd{},
+		},
+		{
+			name: "getpeerreputation",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpeerreputation")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPeerReputationCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpeerreputation","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPeerReputationCmd{},
+		},
 		{
 			name: "getnetworkhashps",
 			newCmd: func() (interface{}, error) {
@@ -1025,6 +1498,36 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "listutxoset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listutxoset")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListUtxoSetCmd(nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listutxoset","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListUtxoSetCmd{
+				Count:         btcjson.Int(1000),
+				IncludeProofs: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "listutxoset optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listutxoset", "abcd", 10, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListUtxoSetCmd(btcjson.String("abcd"),
+					btcjson.Int(10), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listutxoset","params":["abcd",10,true],"id":1}`,
+			unmarshalled: &btcjson.ListUtxoSetCmd{
+				Cursor:        btcjson.String("abcd"),
+				Count:         btcjson.Int(10),
+				IncludeProofs: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -1049,6 +1552,20 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "proveutxo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("proveutxo", "012345", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewProveUtxoCmd("012345", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"proveutxo","params":["012345",1],"id":1}`,
+			unmarshalled: &btcjson.ProveUtxoCmd{
+				Txid: "012345",
+				Vout: 1,
+			},
+		},
 		{
 			name: "proveutxochaintipinclusion",
 			newCmd: func() (interface{}, error) {
@@ -1299,6 +1816,20 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "sendrawtransactionwithproof",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("sendrawtransactionwithproof", "1122", "3344")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSendRawTransactionWithProofCmd("1122", "3344")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"sendrawtransactionwithproof","params":["1122","3344"],"id":1}`,
+			unmarshalled: &btcjson.SendRawTransactionWithProofCmd{
+				HexTx:    "1122",
+				HexProof: "3344",
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -1385,6 +1916,35 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxns: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "submitpackage with proofs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", []string{"1122", "3344"},
+					[]string{"55", "66"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"},
+					&[]string{"55", "66"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"],["55","66"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxns: []string{"1122", "3344"},
+				Proofs:  &[]string{"55", "66"},
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -1409,6 +1969,22 @@ func TestChainSvrCmds(t *testing.T) {
 				Address: "1Address",
 			},
 		},
+		{
+			name: "verifyutreexoproof",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("verifyutreexoproof", `["aa"]`, 3, "0100", `["bb"]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewVerifyUtreexoProofCmd([]string{"aa"}, 3, "0100", []string{"bb"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"verifyutreexoproof","params":[["aa"],3,"0100",["bb"]],"id":1}`,
+			unmarshalled: &btcjson.VerifyUtreexoProofCmd{
+				Roots:     []string{"aa"},
+				NumLeaves: 3,
+				Proof:     "0100",
+				DelHashes: []string{"bb"},
+			},
+		},
 		{
 			name: "verifychain",
 			newCmd: func() (interface{}, error) {
@@ -1496,7 +2072,7 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("testmempoolaccept", []string{"rawhex"}, 0.1)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewTestMempoolAcceptCmd([]string{"rawhex"}, 0.1)
+				return btcjson.NewTestMempoolAcceptCmd([]string{"rawhex"}, 0.1, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["rawhex"],0.1],"id":1}`,
 			unmarshalled: &btcjson.TestMempoolAcceptCmd{
@@ -1510,7 +2086,7 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("testmempoolaccept", []string{"rawhex"}, 0.01)
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewTestMempoolAcceptCmd([]string{"rawhex"}, 0.01)
+				return btcjson.NewTestMempoolAcceptCmd([]string{"rawhex"}, 0.01, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["rawhex"],0.01],"id":1}`,
 			unmarshalled: &btcjson.TestMempoolAcceptCmd{
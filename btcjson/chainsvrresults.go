@@ -65,6 +65,33 @@ type GetBlockHeaderVerboseResult struct {
 	NextHash      string  `json:"nextblockhash,omitempty"`
 }
 
+// BlockScrubIssueResult models a problem the block scrubber found with a stored
+// block or its utreexo proof as part of the getblockscrubinfo command.
+type BlockScrubIssueResult struct {
+	Kind            string `json:"kind"`
+	Hash            string `json:"hash"`
+	Height          int32  `json:"height"`
+	Error           string `json:"error"`
+	Found           int64  `json:"found"`
+	RepairRequested int64  `json:"repairrequested,omitempty"`
+}
+
+// GetBlockScrubInfoResult models the data from the getblockscrubinfo command.
+type GetBlockScrubInfoResult struct {
+	Enabled        bool                    `json:"enabled"`
+	Scrubbing      bool                    `json:"scrubbing"`
+	Passes         uint64                  `json:"passes"`
+	Height         int32                   `json:"height"`
+	PassStart      int64                   `json:"passstart,omitempty"`
+	PassEnd        int64                   `json:"passend,omitempty"`
+	BlocksChecked  uint64                  `json:"blockschecked"`
+	ProofsChecked  uint64                  `json:"proofschecked"`
+	BadBlocks      uint64                  `json:"badblocks"`
+	RepairedBlocks uint64                  `json:"repairedblocks"`
+	BadProofs      uint64                  `json:"badproofs"`
+	Issues         []BlockScrubIssueResult `json:"issues"`
+}
+
 // GetBlockStatsResult models the data from the getblockstats command.
 type GetBlockStatsResult struct {
 	AverageFee         int64   `json:"avgfee"`
@@ -114,13 +141,34 @@ type GetBlockVerboseResult struct {
 	VersionHex    string        `json:"versionHex"`
 	MerkleRoot    string        `json:"merkleroot"`
 	Tx            []string      `json:"tx,omitempty"`
-	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose != 2.
+	RawTx         []TxRawResult `json:"rawtx,omitempty"` // Note: this field is always empty when verbose < 2.
 	Time          int64         `json:"time"`
 	Nonce         uint32        `json:"nonce"`
 	Bits          string        `json:"bits"`
 	Difficulty    float64       `json:"difficulty"`
 	PreviousHash  string        `json:"previousblockhash"`
 	NextHash      string        `json:"nextblockhash,omitempty"`
+	UData         *UDataResult  `json:"udata,omitempty"` // Note: this field is only set when verbose is 3.
+}
+
+// LeafDataResult models the decoded leaf data of an output spent by a block.
+type LeafDataResult struct {
+	LeafHash   string  `json:"leafhash"`
+	BlockHash  string  `json:"blockhash"`
+	Txid       string  `json:"txid"`
+	Vout       uint32  `json:"vout"`
+	Height     int32   `json:"height"`
+	IsCoinBase bool    `json:"iscoinbase"`
+	Amount     float64 `json:"amount"`
+	PkScript   string  `json:"pkscript"`
+}
+
+// UDataResult models the decoded utreexo data of a block from the getblock
+// command when the verbose flag is set to 3.
+type UDataResult struct {
+	Targets     []uint64         `json:"targets"`
+	ProofHashes []string         `json:"proofhashes"`
+	LeafDatas   []LeafDataResult `json:"leafdatas"`
 }
 
 // GetBlockVerboseTxResult models the data from the getblock command when the
@@ -161,6 +209,18 @@ type GetBestStateResult struct {
 	MedianTime  int64  `json:"mediantime"`  // Median time as per CalcPastMedianTime.
 }
 
+// GetBootstrapPackageResult models the data from the getbootstrappackage
+// command.
+type GetBootstrapPackageResult struct {
+	Height    int32  `json:"height"`
+	BlockHash string `json:"blockhash"`
+	NumLeaves uint64 `json:"numleaves"`
+	RootsHash string `json:"rootshash"`
+	NumProofs int32  `json:"numproofs"`
+	Checksum  string `json:"checksum"`
+	Package   string `json:"package"`
+}
+
 // GetChainTipsResult models the data from the getchaintips command.
 type GetChainTipsResult struct {
 	Height    int32  `json:"height"`
@@ -181,6 +241,25 @@ type GetChainTxStatsResult struct {
 	TxRate                 float64 `json:"txrate"`
 }
 
+// ConformanceVectorResult models a single block of the conformance chain as
+// returned by the getconformancevectors command.
+type ConformanceVectorResult struct {
+	Height    int32    `json:"height"`
+	BlockHash string   `json:"blockhash"`
+	Block     string   `json:"block"`
+	Proof     string   `json:"proof"`
+	Roots     []string `json:"roots"`
+	NumLeaves uint64   `json:"numleaves"`
+	RootsHash string   `json:"rootshash"`
+}
+
+// GetConformanceVectorsResult models the data from the getconformancevectors
+// command.
+type GetConformanceVectorsResult struct {
+	Network string                    `json:"network"`
+	Vectors []ConformanceVectorResult `json:"vectors"`
+}
+
 // CreateMultiSigResult models the data returned from the createmultisig
 // command.
 type CreateMultiSigResult struct {
@@ -197,6 +276,15 @@ type DecodeScriptResult struct {
 	P2sh      string   `json:"p2sh,omitempty"`
 }
 
+// DumpTxOutSetResult models the data from the dumptxoutset command.  The names
+// of the fields are the ones of Bitcoin Core.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+}
+
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
 // getaddednodeinfo command.
 type GetAddedNodeInfoResultAddr struct {
@@ -265,6 +353,47 @@ type UnifiedSoftForks struct {
 	SoftForks map[string]*UnifiedSoftFork `json:"softforks"`
 }
 
+// DeploymentStatistics describes the signalling for a BIP0009 soft-fork in the
+// current confirmation window.
+type DeploymentStatistics struct {
+	Period    uint32 `json:"period"`
+	Threshold uint32 `json:"threshold"`
+	Elapsed   uint32 `json:"elapsed"`
+	Count     uint32 `json:"count"`
+	Possible  bool   `json:"possible"`
+}
+
+// Bip9DeploymentInfo describes the state of a BIP0009 version bits soft-fork at
+// a block.
+type Bip9DeploymentInfo struct {
+	Bit                 uint8                 `json:"bit"`
+	StartTime           int64                 `json:"start_time"`
+	Timeout             int64                 `json:"timeout"`
+	MinActivationHeight int32                 `json:"min_activation_height"`
+	Status              string                `json:"status"`
+	Since               int32                 `json:"since"`
+	StatusNext          string                `json:"status_next"`
+	Statistics          *DeploymentStatistics `json:"statistics,omitempty"`
+}
+
+// DeploymentInfo describes a soft-fork at a block.  Buried soft-forks only
+// have an activation height while BIP0009 ones also have their state.  The
+// height is only set once the soft-fork is active.
+type DeploymentInfo struct {
+	Type   string              `json:"type"`
+	Height *int32              `json:"height,omitempty"`
+	Active bool                `json:"active"`
+	Bip9   *Bip9DeploymentInfo `json:"bip9,omitempty"`
+}
+
+// GetDeploymentInfoResult models the data returned from the getdeploymentinfo
+// command.
+type GetDeploymentInfoResult struct {
+	Hash        string                     `json:"hash"`
+	Height      int32                      `json:"height"`
+	Deployments map[string]*DeploymentInfo `json:"deployments"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
@@ -280,6 +409,7 @@ type GetBlockChainInfoResult struct {
 	PruneHeight          int32   `json:"pruneheight,omitempty"`
 	ChainWork            string  `json:"chainwork,omitempty"`
 	SizeOnDisk           int64   `json:"size_on_disk,omitempty"`
+	Warnings             string  `json:"warnings,omitempty"`
 	*SoftForks
 	*UnifiedSoftForks
 }
@@ -331,6 +461,10 @@ type GetBlockTemplateResult struct {
 	// Witness commitment defined in BIP 0141.
 	DefaultWitnessCommitment string `json:"default_witness_commitment,omitempty"`
 
+	// Hex-encoded challenge the block solution must satisfy on signet
+	// networks as defined by BIP 0325.
+	SignetChallenge string `json:"signet_challenge,omitempty"`
+
 	// Optional long polling from BIP 0022.
 	LongPollID  string `json:"longpollid,omitempty"`
 	LongPollURI string `json:"longpolluri,omitempty"`
@@ -349,6 +483,10 @@ type GetBlockTemplateResult struct {
 	// Block proposal from BIP 0023.
 	Capabilities []string `json:"capabilities,omitempty"`
 	RejectReason string   `json:"reject-reason,omitempty"`
+
+	// Hex-encoded utreexo proof of the outputs spent by the transactions.
+	// Only provided when requested with the utreexoproof capability.
+	UtreexoProof string `json:"utreexoproof,omitempty"`
 }
 
 // GetMempoolEntryResult models the data returned from the getmempoolentry's
@@ -432,6 +570,7 @@ type GetNodeAddressesResult struct {
 	Services uint64 `json:"services"` // The services offered
 	Address  string `json:"address"`  // The address of the node
 	Port     uint16 `json:"port"`     // The port of the node
+	Network  string `json:"network"`  // The network of the node: ipv4, ipv6, onion or i2p
 }
 
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
@@ -457,6 +596,8 @@ type GetPeerInfoResult struct {
 	BanScore       int32   `json:"banscore"`
 	FeeFilter      int64   `json:"feefilter"`
 	SyncNode       bool    `json:"syncnode"`
+	TransportType  string  `json:"transport_protocol_type"`
+	SessionID      string  `json:"session_id"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -472,6 +613,11 @@ type GetRawMempoolVerboseResult struct {
 	StartingPriority float64  `json:"startingpriority"`
 	CurrentPriority  float64  `json:"currentpriority"`
 	Depends          []string `json:"depends"`
+
+	// BIP125Replaceable is whether the transaction can be replaced
+	// through the Replace-By-Fee (RBF) policy, either because it signals
+	// replaceability or because one of its unconfirmed ancestors does.
+	BIP125Replaceable bool `json:"bip125-replaceable"`
 }
 
 // ScriptPubKeyResult models the scriptPubKey data of a tx script.  It is
@@ -574,6 +720,37 @@ type GetTxTotalsResult struct {
 	TimeMillis          int64  `json:"timemillis"`
 }
 
+// GetPeerPolicyInfoResult models the data returned from the getpeerpolicyinfo
+// command.
+type GetPeerPolicyInfoResult struct {
+	AgentBlacklist         []string `json:"agentblacklist"`
+	AgentWhitelist         []string `json:"agentwhitelist"`
+	AgentDeprioritize      []string `json:"agentdeprioritize"`
+	RejectServices         []string `json:"rejectservices"`
+	AgentBlacklisted       uint64   `json:"agentblacklisted"`
+	AgentNotWhitelisted    uint64   `json:"agentnotwhitelisted"`
+	ServicesRejected       uint64   `json:"servicesrejected"`
+	Deprioritized          uint64   `json:"deprioritized"`
+	DeprioritizedEvicted   uint64   `json:"deprioritizedevicted"`
+	ProofRequestsThrottled uint64   `json:"proofrequeststhrottled"`
+}
+
+// GetPeerReputationResult models the reputation of a peer returned from the
+// getpeerreputation command.
+type GetPeerReputationResult struct {
+	Addr           string  `json:"addr"`
+	Score          float64 `json:"score"`
+	Connected      bool    `json:"connected"`
+	ValidProofs    uint64  `json:"validproofs"`
+	InvalidProofs  uint64  `json:"invalidproofs"`
+	Timeouts       uint64  `json:"timeouts"`
+	LatencyMillis  int64   `json:"latencyms"`
+	LatencySamples uint64  `json:"latencysamples"`
+	Connections    uint64  `json:"connections"`
+	Uptime         int64   `json:"uptime"`
+	LastSeen       int64   `json:"lastseen"`
+}
+
 // ScriptSig models a signature script.  It is defined separately since it only
 // applies to non-coinbase.  Therefore the field in the Vin structure needs
 // to be a pointer.
@@ -912,6 +1089,15 @@ type DumpWalletResult struct {
 	Filename string `json:"filename"`
 }
 
+// ProveUtxoResult models the data from the proveutxo command.
+type ProveUtxoResult struct {
+	ProvedAtHash string   `json:"provedathash"`
+	LeafHash     string   `json:"leafhash"`
+	Targets      []uint64 `json:"targets"`
+	ProofHashes  []string `json:"proofhashes"`
+	Hex          string   `json:"hex"`
+}
+
 // ProveUtxoChainTipInclusionVerboseResult models the data from the
 // proveutxochaintipinclusion command when the verbose flag is set.  When the
 // verbose flag is not set, just the hex-encoded string of the entire proof
@@ -924,23 +1110,264 @@ type ProveUtxoChainTipInclusionVerboseResult struct {
 	Hex          string   `json:"hex"`
 }
 
+// ListUtxoSetEntry models an unspent output of a page of the listutxoset
+// command.
+type ListUtxoSetEntry struct {
+	Txid               string  `json:"txid"`
+	Vout               uint32  `json:"vout"`
+	Amount             float64 `json:"amount"`
+	PkScript           string  `json:"pkscript"`
+	Height             int32   `json:"height"`
+	IsCoinBase         bool    `json:"iscoinbase"`
+	SpentSinceSnapshot bool    `json:"spentsincesnapshot,omitempty"`
+}
+
+// ListUtxoSetResult models the data from the listutxoset command.  The proof
+// is only set when proofs are requested and is of the outputs of the page that
+// are still unspent at the chain tip.
+type ListUtxoSetResult struct {
+	SnapshotHash   string                                   `json:"snapshothash"`
+	SnapshotHeight int32                                    `json:"snapshotheight"`
+	Utxos          []ListUtxoSetEntry                       `json:"utxos"`
+	NextCursor     string                                   `json:"nextcursor,omitempty"`
+	Proof          *ProveUtxoChainTipInclusionVerboseResult `json:"proof,omitempty"`
+}
+
 // GetUtreexoProofVerboseResult models the data from the
 // getutreexoproof when the verbose flag is set.  When the
 // verbose flag is not set, just the hex-encoded string of the entire proof
 // is returned.
 type GetUtreexoProofVerboseResult struct {
+	Hex             string   `json:"hex"`
 	ProofHashes     []string `json:"proofhashes"`
 	TargetHashes    []string `json:"targethashes"`
 	TargetPreimages []string `json:"targetpreimages"`
 	ProofTargets    []uint64 `json:"prooftargets"`
 }
 
+// GetUtreexoProofsResult models the data of a single block from the
+// getutreexoproofs command.
+type GetUtreexoProofsResult struct {
+	Height    int32  `json:"height"`
+	BlockHash string `json:"blockhash"`
+	Hex       string `json:"hex"`
+}
+
+// TargetCountBucketResult models the number of blocks whose proofs have from
+// MinTargets to MaxTargets targets.
+type TargetCountBucketResult struct {
+	MinTargets uint64 `json:"mintargets"`
+	MaxTargets uint64 `json:"maxtargets"`
+	Blocks     uint64 `json:"blocks"`
+}
+
+// FlatFileSizeResult models the size of a flat file of the flat utreexo proof
+// index.
+type FlatFileSizeResult struct {
+	Name       string `json:"name"`
+	Height     int32  `json:"height"`
+	DataSize   int64  `json:"datasize"`
+	OffsetSize int64  `json:"offsetsize"`
+}
+
+// GetUtreexoProofStatsResult models the data from the getutreexoproofstats
+// command.
+type GetUtreexoProofStatsResult struct {
+	Height           int32                     `json:"height"`
+	BlockHash        string                    `json:"blockhash"`
+	NumLeaves        uint64                    `json:"numleaves"`
+	ForestRows       uint8                     `json:"forestrows"`
+	StartHeight      int32                     `json:"startheight"`
+	EndHeight        int32                     `json:"endheight"`
+	TotalProofBytes  uint64                    `json:"totalproofbytes"`
+	AvgProofBytes    float64                   `json:"avgproofbytes"`
+	MaxProofBytes    uint64                    `json:"maxproofbytes"`
+	MaxProofHeight   int32                     `json:"maxproofheight"`
+	TargetsHistogram []TargetCountBucketResult `json:"targetshistogram"`
+	FlatFileCount    int                       `json:"flatfilecount"`
+	FlatFiles        []FlatFileSizeResult      `json:"flatfiles,omitempty"`
+}
+
+// UtreexoCacheInfoResult models the usage of a cache of the utreexo state.
+type UtreexoCacheInfoResult struct {
+	Used        int64   `json:"used"`
+	Capacity    int64   `json:"capacity"`
+	Utilization float64 `json:"utilization"`
+}
+
+// GetUtreexoInfoResult models the data from the getutreexoinfo command.
+type GetUtreexoInfoResult struct {
+	Mode                  string                  `json:"mode"`
+	Height                int32                   `json:"height"`
+	BlockHash             string                  `json:"blockhash"`
+	NumLeaves             uint64                  `json:"numleaves"`
+	Roots                 []string                `json:"roots"`
+	UtreexoProofIndex     bool                    `json:"utreexoproofindex"`
+	FlatUtreexoProofIndex bool                    `json:"flatutreexoproofindex"`
+	NodesCache            *UtreexoCacheInfoResult `json:"nodescache,omitempty"`
+	CachedLeavesCache     *UtreexoCacheInfoResult `json:"cachedleavescache,omitempty"`
+	LastFlushHeight       int32                   `json:"lastflushheight,omitempty"`
+	LastFlushHash         string                  `json:"lastflushhash,omitempty"`
+	CachedLeavesLive      uint64                  `json:"cachedleaveslive,omitempty"`
+	CachedLeavesGarbage   uint64                  `json:"cachedleavesgarbage,omitempty"`
+	GarbageRatio          float64                 `json:"garbageratio,omitempty"`
+	GarbageCompactions    uint64                  `json:"garbagecompactions,omitempty"`
+	Pruned                bool                    `json:"pruned"`
+	ProofPruneHeight      int32                   `json:"proofpruneheight"`
+	ProofRetention        int32                   `json:"proofretention"`
+	UndoRetention         int32                   `json:"undoretention"`
+	RollbackSnapshots     int                     `json:"rollbacksnapshots"`
+	RootSnapshotInterval  int32                   `json:"rootsnapshotinterval"`
+	CompactedHeight       int32                   `json:"compactedheight"`
+}
+
+// GetIndexInfoResult models the objects included in the getindexinfo response.
+// In the actual result, these objects are keyed by the name of the index.
+type GetIndexInfoResult struct {
+	Synced           bool    `json:"synced"`
+	BestBlockHeight  int32   `json:"best_block_height"`
+	BestBlockHash    string  `json:"best_block_hash"`
+	Lag              int32   `json:"lag"`
+	BackfillProgress float64 `json:"backfill_progress"`
+}
+
+// BackupUtreexoStateResult models the data from the backuputreexostate
+// command.
+type BackupUtreexoStateResult struct {
+	BlockHash string   `json:"blockhash"`
+	Height    int32    `json:"height"`
+	Paths     []string `json:"paths"`
+}
+
+// CompactProofsResult models the data from the compactproofs command.
+type CompactProofsResult struct {
+	CompactedHeight int32 `json:"compactedheight"`
+}
+
+// GetLeafAtPositionResult models the data from the getleafatposition command.
+type GetLeafAtPositionResult struct {
+	Position   uint64  `json:"position"`
+	LeafHash   string  `json:"leafhash"`
+	BlockHash  string  `json:"blockhash"`
+	Txid       string  `json:"txid"`
+	Vout       uint32  `json:"vout"`
+	Height     int32   `json:"height"`
+	IsCoinBase bool    `json:"iscoinbase"`
+	Amount     float64 `json:"amount"`
+	PkScript   string  `json:"pkscript"`
+}
+
+// LeafTTLResult models the time to live of a single output from the
+// getleafttls command.
+type LeafTTLResult struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+	TTL  int32  `json:"ttl"`
+}
+
+// GetLeafTTLsResult models the data from the getleafttls command.
+type GetLeafTTLsResult struct {
+	Height    int32           `json:"height"`
+	BlockHash string          `json:"blockhash"`
+	LeafTTLs  []LeafTTLResult `json:"leafttls"`
+}
+
+// CoinAgeBucketResult models the unspent outputs with an age of MinAge to
+// MaxAge blocks.  MaxAge is left out for the bucket of the oldest outputs.
+type CoinAgeBucketResult struct {
+	MinAge     int32   `json:"minage"`
+	MaxAge     *int32  `json:"maxage,omitempty"`
+	Count      uint64  `json:"count"`
+	Amount     float64 `json:"amount"`
+	DustCount  uint64  `json:"dustcount"`
+	DustAmount float64 `json:"dustamount"`
+}
+
+// GetCoinAgeStatsResult models the data from the getcoinagestats command.
+type GetCoinAgeStatsResult struct {
+	Height       int32                 `json:"height"`
+	BlockHash    string                `json:"blockhash"`
+	Count        uint64                `json:"count"`
+	Amount       float64               `json:"amount"`
+	DustCount    uint64                `json:"dustcount"`
+	DustAmount   float64               `json:"dustamount"`
+	AgeHistogram []CoinAgeBucketResult `json:"agehistogram"`
+}
+
 // GetUtreexoRootsResult models the data from the getutreexoroots command.
 type GetUtreexoRootsResult struct {
+	BlockHash string   `json:"blockhash"`
+	Roots     []string `json:"roots"`
+	NumLeaves uint64   `json:"numleaves"`
+	RootsHash string   `json:"rootshash"`
+}
+
+// GetHistoricalRootsResult models the data from the gethistoricalroots command.
+type GetHistoricalRootsResult struct {
+	BlockHash      string   `json:"blockhash"`
+	Height         int32    `json:"height"`
+	Roots          []string `json:"roots"`
+	NumLeaves      uint64   `json:"numleaves"`
+	RootsHash      string   `json:"rootshash"`
+	SnapshotHeight int32    `json:"snapshotheight"`
+	ReplayedBlocks int32    `json:"replayedblocks"`
+}
+
+// ProofAccessGroupResult models the counts of the utreexo proofs served from a
+// source for blocks at a range of depths with a range of targets.
+type ProofAccessGroupResult struct {
+	Source  string `json:"source"`
+	Depth   string `json:"depth"`
+	Size    string `json:"size"`
+	Proofs  uint64 `json:"proofs"`
+	Targets uint64 `json:"targets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// ProofAccessClientResult models the counts of the utreexo proofs served to a
+// client.
+type ProofAccessClientResult struct {
+	Client  string `json:"client"`
+	Proofs  uint64 `json:"proofs"`
+	Targets uint64 `json:"targets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// GetProofAccessStatsResult models the data from the getproofaccessstats
+// command.
+type GetProofAccessStatsResult struct {
+	Since       int64                     `json:"since"`
+	ClientsMode string                    `json:"clientsmode"`
+	Groups      []ProofAccessGroupResult  `json:"groups"`
+	Clients     []ProofAccessClientResult `json:"clients,omitempty"`
+}
+
+// VerifyUtreexoProofResult models the data from the verifyutreexoproof command.
+type VerifyUtreexoProofResult struct {
+	Valid     bool     `json:"valid"`
+	Error     string   `json:"error,omitempty"`
 	Roots     []string `json:"roots"`
 	NumLeaves uint64   `json:"numleaves"`
 }
 
+// DiskUsageResult models the on-disk size and the forecasted growth rate of
+// a single index or state.
+type DiskUsageResult struct {
+	Name         string   `json:"name"`
+	Paths        []string `json:"paths"`
+	Size         int64    `json:"size"`
+	GrowthPerDay int64    `json:"growthperday"`
+	WindowSecs   int64    `json:"windowsecs"`
+}
+
+// GetDiskUsageResult models the data from the getdiskusage command.
+type GetDiskUsageResult struct {
+	SampledAt         int64             `json:"sampledat"`
+	TotalSize         int64             `json:"totalsize"`
+	TotalGrowthPerDay int64             `json:"totalgrowthperday"`
+	Usage             []DiskUsageResult `json:"usage"`
+}
+
 // GetUtreexoBlockSummaryRootsResult models the data from the getutreexoblocksummaryroots command.
 type GetUtreexoBlockSummaryRootsResult struct {
 	Roots     []string `json:"roots"`
@@ -960,6 +1387,38 @@ type ProveWatchOnlyChainTipInclusionVerboseResult struct {
 	Hex          string   `json:"hex"`
 }
 
+// WalletUtxoResult models a utxo of the watch only wallet returned by the
+// getwalletutxos command.
+type WalletUtxoResult struct {
+	TxID         string `json:"txid"`
+	Vout         uint32 `json:"vout"`
+	Amount       int64  `json:"amount"`
+	ScriptPubKey string `json:"scriptpubkey"`
+	Height       int32  `json:"height"`
+	BlockHash    string `json:"blockhash"`
+	Coinbase     bool   `json:"coinbase"`
+	Descriptor   string `json:"descriptor,omitempty"`
+	LeafHash     string `json:"leafhash"`
+	Proof        string `json:"proof"`
+}
+
+// GetWalletUtxosResult models the data from the getwalletutxos command.
+type GetWalletUtxosResult struct {
+	BestHash  string             `json:"besthash"`
+	NumLeaves uint64             `json:"numleaves"`
+	Utxos     []WalletUtxoResult `json:"utxos"`
+}
+
+// FinalizePsbtResult models the data from the finalizepsbt command.  The psbt
+// is returned when the transaction isn't extracted.  The hex of the transaction
+// and the proof of its inputs are returned when it is.
+type FinalizePsbtResult struct {
+	Psbt     string `json:"psbt,omitempty"`
+	Hex      string `json:"hex,omitempty"`
+	Proof    string `json:"proof,omitempty"`
+	Complete bool   `json:"complete"`
+}
+
 // BDKAddressResult models the data for all rpc calls that the bdk wallet returns.
 // This includes the following commands: unusedaddress, freshaddress, and peekaddress.
 type BDKAddressResult struct {
@@ -974,6 +1433,49 @@ type CreateTransactionFromBDKWalletResult struct {
 	RawBytes string `json:"rawbytes"`
 }
 
+// SubmitPackageFees models the `fees` section of a transaction in the result
+// of the submitpackage command.
+type SubmitPackageFees struct {
+	// Base is the transaction fee in BTC.
+	Base float64 `json:"base"`
+
+	// EffectiveFeeRate is the fee rate in BTC per KvB the transaction was
+	// accepted for.  It's the fee rate of the package if the transaction
+	// was added to the mempool along with the package.
+	EffectiveFeeRate float64 `json:"effective-feerate,omitempty"`
+
+	// EffectiveIncludes are the wtxids of the transactions whose fees and
+	// vsizes are included in effective-feerate.
+	EffectiveIncludes []string `json:"effective-includes,omitempty"`
+}
+
+// SubmitPackageTxResult models the result of a transaction of the package
+// passed to the submitpackage command.
+type SubmitPackageTxResult struct {
+	// Txid is the transaction hash in hex.
+	Txid string `json:"txid"`
+
+	// Vsize is the virtual transaction size as defined in BIP 141.
+	Vsize int32 `json:"vsize"`
+
+	// Fees are the fees of the transaction.
+	Fees SubmitPackageFees `json:"fees"`
+}
+
+// SubmitPackageResult models the data from the submitpackage command.
+type SubmitPackageResult struct {
+	// PackageMsg is "success" when the package was accepted.
+	PackageMsg string `json:"package_msg"`
+
+	// TxResults are the results of the transactions of the package keyed
+	// by their wtxid.
+	TxResults map[string]SubmitPackageTxResult `json:"tx-results"`
+
+	// ReplacedTransactions are the txids of the transactions replaced by
+	// the package.  Packages can't replace transactions so it's empty.
+	ReplacedTransactions []string `json:"replaced-transactions"`
+}
+
 // TestMempoolAcceptResult models the data from the testmempoolaccept command.
 // The result of the mempool acceptance test for each raw transaction in the
 // input array. Returns results for each transaction in the same order they
@@ -1007,6 +1509,12 @@ type TestMempoolAcceptResult struct {
 	// RejectReason is the rejection string (only present when 'allowed' is
 	// false).
 	RejectReason string `json:"reject-reason,omitempty"`
+
+	// ReplacedTransactions are the txids of the mempool transactions,
+	// including their descendants, that the tx would replace through the
+	// Replace-By-Fee (RBF) policy (only present when 'allowed' is true and
+	// the tx is a replacement).
+	ReplacedTransactions []string `json:"replaced-transactions,omitempty"`
 }
 
 // TestMempoolAcceptFees models the `fees` section from the testmempoolaccept
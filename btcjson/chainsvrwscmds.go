@@ -41,6 +41,25 @@ func NewStopNotifyBlocksCmd() *StopNotifyBlocksCmd {
 	return &StopNotifyBlocksCmd{}
 }
 
+// NotifyUtreexoRootsCmd defines the notifyutreexoroots JSON-RPC command.
+type NotifyUtreexoRootsCmd struct{}
+
+// NewNotifyUtreexoRootsCmd returns a new instance which can be used to issue a
+// notifyutreexoroots JSON-RPC command.
+func NewNotifyUtreexoRootsCmd() *NotifyUtreexoRootsCmd {
+	return &NotifyUtreexoRootsCmd{}
+}
+
+// StopNotifyUtreexoRootsCmd defines the stopnotifyutreexoroots JSON-RPC
+// command.
+type StopNotifyUtreexoRootsCmd struct{}
+
+// NewStopNotifyUtreexoRootsCmd returns a new instance which can be used to
+// issue a stopnotifyutreexoroots JSON-RPC command.
+func NewStopNotifyUtreexoRootsCmd() *StopNotifyUtreexoRootsCmd {
+	return &StopNotifyUtreexoRootsCmd{}
+}
+
 // NotifyNewTransactionsCmd defines the notifynewtransactions JSON-RPC command.
 type NotifyNewTransactionsCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -231,11 +250,13 @@ func init() {
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
+	MustRegisterCmd("notifyutreexoroots", (*NotifyUtreexoRootsCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyutreexoroots", (*StopNotifyUtreexoRootsCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
 	MustRegisterCmd("rescanblocks", (*RescanBlocksCmd)(nil), flags)
 }
@@ -63,6 +63,28 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyblocks","params":[],"id":1}`,
 			unmarshalled: &btcjson.StopNotifyBlocksCmd{},
 		},
+		{
+			name: "notifyutreexoroots",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyutreexoroots")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyUtreexoRootsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyutreexoroots","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyUtreexoRootsCmd{},
+		},
+		{
+			name: "stopnotifyutreexoroots",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyutreexoroots")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyUtreexoRootsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyutreexoroots","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyUtreexoRootsCmd{},
+		},
 		{
 			name: "notifynewtransactions",
 			newCmd: func() (interface{}, error) {
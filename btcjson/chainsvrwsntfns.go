@@ -75,6 +75,11 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// UtreexoRootsNtfnMethod is the method used for notifications from the
+	// chain server that the utreexo accumulator changed because a block
+	// was connected or disconnected.
+	UtreexoRootsNtfnMethod = "utreexoroots"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +290,32 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// UtreexoRootsNtfn defines the utreexoroots JSON-RPC notification.  The roots
+// and the number of leaves are of the accumulator at the given block, which is
+// the new tip.  Disconnected is set when the tip changed because the block
+// after it was disconnected.
+type UtreexoRootsNtfn struct {
+	Hash         string
+	Height       int32
+	NumLeaves    uint64
+	Roots        []string
+	Disconnected bool
+}
+
+// NewUtreexoRootsNtfn returns a new instance which can be used to issue a
+// utreexoroots JSON-RPC notification.
+func NewUtreexoRootsNtfn(hash string, height int32, numLeaves uint64,
+	roots []string, disconnected bool) *UtreexoRootsNtfn {
+
+	return &UtreexoRootsNtfn{
+		Hash:         hash,
+		Height:       height,
+		NumLeaves:    numLeaves,
+		Roots:        roots,
+		Disconnected: disconnected,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +332,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(UtreexoRootsNtfnMethod, (*UtreexoRootsNtfn)(nil), flags)
 }
@@ -225,6 +225,22 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "utreexoroots",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("utreexoroots", "123", 100000, 5, []string{"aa", "bb"}, false)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewUtreexoRootsNtfn("123", 100000, 5, []string{"aa", "bb"}, false)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"utreexoroots","params":["123",100000,5,["aa","bb"],false],"id":null}`,
+			unmarshalled: &btcjson.UtreexoRootsNtfn{
+				Hash:      "123",
+				Height:    100000,
+				NumLeaves: 5,
+				Roots:     []string{"aa", "bb"},
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -247,3 +247,53 @@ func MethodUsageText(method string) (string, error) {
 	registerLock.Unlock()
 	return usage, nil
 }
+
+// MethodParam describes a parameter of a registered method.
+type MethodParam struct {
+	// Name is the lowercased name of the parameter as it's shown in the
+	// usage of the method.
+	Name string
+
+	// Optional is whether or not the parameter may be left out.
+	Optional bool
+
+	// Default is the default value of an optional parameter.  It's nil
+	// when the parameter doesn't have one.
+	Default interface{}
+}
+
+// MethodParams returns the parameters of the provided method in the order they
+// are passed to NewCmd.  This allows callers to accept the parameters by name
+// and pass them along positionally.  The provided method must be associated
+// with a registered type.
+func MethodParams(method string) ([]MethodParam, error) {
+	// Look up details about the provided method and error out if not
+	// registered.
+	registerLock.RLock()
+	rtp, ok := methodToConcreteType[method]
+	info := methodToInfo[method]
+	registerLock.RUnlock()
+	if !ok {
+		str := fmt.Sprintf("%q is not registered", method)
+		return nil, makeError(ErrUnregisteredMethod, str)
+	}
+
+	rt := rtp.Elem()
+	params := make([]MethodParam, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		rtf := rt.Field(i)
+		param := MethodParam{
+			Name:     strings.ToLower(rtf.Name),
+			Optional: rtf.Type.Kind() == reflect.Ptr,
+		}
+
+		// Default values are pointers due to the rules enforced by
+		// RegisterCmd.
+		if defVal, ok := info.defaults[i]; ok {
+			param.Default = defVal.Elem().Interface()
+		}
+		params = append(params, param)
+	}
+
+	return params, nil
+}
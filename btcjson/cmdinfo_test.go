@@ -428,3 +428,29 @@ func TestFieldUsage(t *testing.T) {
 		}
 	}
 }
+
+// TestMethodParams tests the MethodParams function to ensure it returns the
+// expected parameters and errors.
+func TestMethodParams(t *testing.T) {
+	t.Parallel()
+
+	_, err := btcjson.MethodParams("bogus")
+	if jerr, ok := err.(btcjson.Error); !ok ||
+		jerr.ErrorCode != btcjson.ErrUnregisteredMethod {
+
+		t.Fatalf("expected an unregistered method error, got %v", err)
+	}
+
+	params, err := btcjson.MethodParams("getblock")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []btcjson.MethodParam{
+		{Name: "hash"},
+		{Name: "verbosity", Optional: true, Default: 1},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Fatalf("mismatched params - got %+v, want %+v", params,
+			expected)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package psbt implements the partially signed bitcoin transaction format defined
+in BIP 174.
+
+# Overview
+
+A PSBT carries an unsigned transaction along with everything the parties
+involved in creating it need to sign and finalize it.  The creator builds the
+unsigned transaction, the updater attaches the data of the outputs being spent,
+the signers add their signatures and the finalizer turns the signatures into the
+final input scripts before the transaction is extracted.
+
+# Utreexo data
+
+Nodes that don't keep the utxo set need the leaf data of every input and an
+accumulator proof of them to validate a transaction.  The updater is able to
+attach both as proprietary fields with the identifier "utreexo":
+
+  - The global field with subtype 0x00 holds the hash of the block that the
+    accumulator proof is for.
+  - The global field with subtype 0x01 holds the accumulator proof of the leaf
+    datas of all the inputs, in the order of the inputs.
+  - The input field with subtype 0x00 holds the leaf data of the output being
+    spent.
+
+Once the transaction is finalized, ExtractUData returns the udata that goes
+along with the extracted transaction.
+*/
+package psbt
@@ -0,0 +1,243 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// PrevOutput returns the output spent by the input at the given index.  It's
+// taken from the witness utxo, the non-witness utxo or the utreexo leaf data
+// of the input, whichever is set.
+func (p *Packet) PrevOutput(index int) (*wire.TxOut, error) {
+	pIn := &p.Inputs[index]
+	switch {
+	case pIn.WitnessUtxo != nil:
+		return pIn.WitnessUtxo, nil
+
+	case pIn.NonWitnessUtxo != nil:
+		vout := p.UnsignedTx.TxIn[index].PreviousOutPoint.Index
+		if int(vout) >= len(pIn.NonWitnessUtxo.TxOut) {
+			return nil, ErrInvalidValue
+		}
+		return pIn.NonWitnessUtxo.TxOut[vout], nil
+
+	case pIn.UtreexoLeafData != nil:
+		ld := pIn.UtreexoLeafData
+		return wire.NewTxOut(ld.Amount, ld.PkScript), nil
+	}
+
+	return nil, ErrMissingUtxo
+}
+
+// Finalize builds the final input script and witness of the input at the
+// given index from its signatures.  Inputs spending p2pkh, p2wpkh, p2sh-p2wpkh
+// and p2tr key path outputs are supported.
+func Finalize(p *Packet, index int) error {
+	pIn := &p.Inputs[index]
+	if isFinalized(pIn) {
+		return nil
+	}
+
+	prevOut, err := p.PrevOutput(index)
+	if err != nil {
+		return err
+	}
+	pkScript := prevOut.PkScript
+
+	var scriptSig []byte
+	var witness wire.TxWitness
+	switch {
+	case txscript.IsPayToTaproot(pkScript):
+		if pIn.TaprootKeySpendSig == nil {
+			return ErrMissingSignature
+		}
+		witness = wire.TxWitness{pIn.TaprootKeySpendSig}
+
+	case txscript.IsPayToWitnessPubKeyHash(pkScript):
+		sig, err := singleSig(pIn, pkScript[2:22])
+		if err != nil {
+			return err
+		}
+		witness = wire.TxWitness{sig.Signature, sig.PubKey}
+
+	case txscript.IsPayToScriptHash(pkScript):
+		redeemScript := pIn.RedeemScript
+		if !txscript.IsPayToWitnessPubKeyHash(redeemScript) {
+			return ErrUnsupportedScriptType
+		}
+		if !bytes.Equal(btcutil.Hash160(redeemScript), pkScript[2:22]) {
+			return fmt.Errorf("redeem script doesn't match the " +
+				"script hash")
+		}
+		sig, err := singleSig(pIn, redeemScript[2:22])
+		if err != nil {
+			return err
+		}
+		witness = wire.TxWitness{sig.Signature, sig.PubKey}
+		scriptSig, err = txscript.NewScriptBuilder().
+			AddData(redeemScript).Script()
+		if err != nil {
+			return err
+		}
+
+	case txscript.IsPayToPubKeyHash(pkScript):
+		sig, err := singleSig(pIn, pkScript[3:23])
+		if err != nil {
+			return err
+		}
+		scriptSig, err = txscript.NewScriptBuilder().
+			AddData(sig.Signature).AddData(sig.PubKey).Script()
+		if err != nil {
+			return err
+		}
+
+	default:
+		return ErrUnsupportedScriptType
+	}
+
+	if witness != nil {
+		pIn.FinalScriptWitness, err = serializeWitness(witness)
+		if err != nil {
+			return err
+		}
+	}
+	pIn.FinalScriptSig = scriptSig
+
+	// The fields used to build the final scripts are no longer needed.
+	pIn.PartialSigs = nil
+	pIn.SighashType = 0
+	pIn.RedeemScript = nil
+	pIn.WitnessScript = nil
+	pIn.TaprootKeySpendSig = nil
+
+	return nil
+}
+
+// MaybeFinalizeAll finalizes every input of the PSBT that has the signatures
+// it needs.  The inputs that can't be finalized yet are left unchanged.  It
+// returns true if all the inputs are finalized.
+func MaybeFinalizeAll(p *Packet) bool {
+	for i := range p.Inputs {
+		// An input that can't be finalized yet is only an incomplete
+		// PSBT and not an error.
+		_ = Finalize(p, i)
+	}
+
+	return p.IsComplete()
+}
+
+// Extract returns the final transaction of a PSBT that has all of its inputs
+// finalized.
+func Extract(p *Packet) (*wire.MsgTx, error) {
+	if !p.IsComplete() {
+		return nil, ErrIncompletePSBT
+	}
+
+	tx := p.UnsignedTx.Copy()
+	for i, txIn := range tx.TxIn {
+		pIn := &p.Inputs[i]
+		txIn.SignatureScript = pIn.FinalScriptSig
+		if pIn.FinalScriptWitness != nil {
+			witness, err := parseWitness(pIn.FinalScriptWitness)
+			if err != nil {
+				return nil, err
+			}
+			txIn.Witness = witness
+		}
+	}
+
+	return tx, nil
+}
+
+// ExtractUData returns the udata of the PSBT with the leaf datas in the order
+// of the inputs.  Every input must have its leaf data.
+func ExtractUData(p *Packet) (*wire.UData, error) {
+	if p.UtreexoProof == nil {
+		return nil, ErrMissingUtreexoData
+	}
+
+	leafDatas := make([]wire.LeafData, 0, len(p.Inputs))
+	for _, pIn := range p.Inputs {
+		if pIn.UtreexoLeafData == nil {
+			return nil, ErrMissingUtreexoData
+		}
+		leafDatas = append(leafDatas, *pIn.UtreexoLeafData)
+	}
+
+	return &wire.UData{
+		AccProof:  *p.UtreexoProof,
+		LeafDatas: leafDatas,
+	}, nil
+}
+
+// isFinalized returns true if the input has its final input script or
+// witness.
+func isFinalized(pIn *PInput) bool {
+	return pIn.FinalScriptSig != nil || pIn.FinalScriptWitness != nil
+}
+
+// singleSig returns the only partial signature of the input after checking
+// that its public key hashes to pubKeyHash.
+func singleSig(pIn *PInput, pubKeyHash []byte) (*PartialSig, error) {
+	if len(pIn.PartialSigs) != 1 {
+		return nil, ErrMissingSignature
+	}
+	sig := pIn.PartialSigs[0]
+	if !bytes.Equal(btcutil.Hash160(sig.PubKey), pubKeyHash) {
+		return nil, fmt.Errorf("partial signature public key doesn't "+
+			"match the public key hash %x", pubKeyHash)
+	}
+
+	return sig, nil
+}
+
+// serializeWitness returns the witness serialized as a count of the items
+// followed by each item.
+func serializeWitness(witness wire.TxWitness) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarInt(&buf, 0, uint64(len(witness))); err != nil {
+		return nil, err
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(&buf, 0, item); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseWitness parses a witness serialized by serializeWitness.
+func parseWitness(b []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(b)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(b)) {
+		return nil, ErrInvalidValue
+	}
+
+	witness := make(wire.TxWitness, 0, count)
+	for i := uint64(0); i < count; i++ {
+		item, err := wire.ReadVarBytes(r, 0, maxPsbtValueLength,
+			"witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+
+	return witness, nil
+}
@@ -0,0 +1,818 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// psbtMagic is the magic that every serialized PSBT starts with.  It's the
+// string "psbt" followed by the separator 0xff.
+var psbtMagic = [5]byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+const (
+	// maxPsbtKeyLength is the maximum allowed length of a key.
+	maxPsbtKeyLength = 10000
+
+	// maxPsbtValueLength is the maximum allowed length of a value.
+	maxPsbtValueLength = 4000000
+)
+
+// The key types of the global map.
+const (
+	unsignedTxType  = 0x00
+	versionType     = 0xfb
+	proprietaryType = 0xfc
+)
+
+// The key types of the input maps.
+const (
+	nonWitnessUtxoType     = 0x00
+	witnessUtxoType        = 0x01
+	partialSigType         = 0x02
+	sighashType            = 0x03
+	inRedeemScriptType     = 0x04
+	inWitnessScriptType    = 0x05
+	finalScriptSigType     = 0x07
+	finalScriptWitnessType = 0x08
+	taprootKeySpendSigType = 0x13
+)
+
+// The key types of the output maps.
+const (
+	outRedeemScriptType  = 0x00
+	outWitnessScriptType = 0x01
+)
+
+// UtreexoIdentifier is the identifier of the proprietary fields that hold the
+// utreexo data of a PSBT.
+const UtreexoIdentifier = "utreexo"
+
+// The subtypes of the utreexo proprietary fields.
+const (
+	// utreexoProvedAtHashSubtype is the global field that holds the hash of
+	// the block the accumulator proof is for.
+	utreexoProvedAtHashSubtype = 0x00
+
+	// utreexoProofSubtype is the global field that holds the accumulator
+	// proof of the leaf datas of the inputs.
+	utreexoProofSubtype = 0x01
+
+	// utreexoLeafDataSubtype is the input field that holds the leaf data of
+	// the output being spent.
+	utreexoLeafDataSubtype = 0x00
+)
+
+var (
+	// ErrInvalidMagic is returned when the serialized PSBT doesn't start
+	// with the PSBT magic.
+	ErrInvalidMagic = errors.New("invalid psbt magic")
+
+	// ErrDuplicateKey is returned when a map of the PSBT has the same key
+	// more than once.
+	ErrDuplicateKey = errors.New("duplicate key in psbt")
+
+	// ErrInvalidKey is returned when a key of the PSBT is malformed.
+	ErrInvalidKey = errors.New("invalid psbt key")
+
+	// ErrInvalidValue is returned when a value of the PSBT is malformed.
+	ErrInvalidValue = errors.New("invalid psbt value")
+
+	// ErrMissingUnsignedTx is returned when the PSBT has no unsigned
+	// transaction.
+	ErrMissingUnsignedTx = errors.New("psbt has no unsigned transaction")
+
+	// ErrSignedTx is returned when the transaction of the PSBT has input
+	// scripts or witnesses.
+	ErrSignedTx = errors.New("psbt transaction is not unsigned")
+
+	// ErrMissingUtxo is returned when an input has none of the fields
+	// describing the output it spends.
+	ErrMissingUtxo = errors.New("input has no utxo information")
+
+	// ErrMissingSignature is returned when an input doesn't have the
+	// signatures needed to be finalized.
+	ErrMissingSignature = errors.New("input is missing signatures")
+
+	// ErrUnsupportedScriptType is returned when an input spends a script
+	// that can't be finalized.
+	ErrUnsupportedScriptType = errors.New("unsupported script type")
+
+	// ErrIncompletePSBT is returned when a transaction is extracted from a
+	// PSBT that has inputs that aren't finalized.
+	ErrIncompletePSBT = errors.New("psbt has inputs that aren't finalized")
+
+	// ErrMissingUtreexoData is returned when the udata is extracted from a
+	// PSBT that doesn't have the utreexo data for every input.
+	ErrMissingUtreexoData = errors.New("psbt is missing utreexo data")
+)
+
+// Unknown is a key-value pair that isn't interpreted by this package.  It's
+// kept so that it's serialized back unchanged.
+type Unknown struct {
+	Key   []byte
+	Value []byte
+}
+
+// PartialSig is a signature of an input along with the public key it's for.
+type PartialSig struct {
+	PubKey    []byte
+	Signature []byte
+}
+
+// PInput is the data of a PSBT input.
+type PInput struct {
+	NonWitnessUtxo     *wire.MsgTx
+	WitnessUtxo        *wire.TxOut
+	PartialSigs        []*PartialSig
+	SighashType        txscript.SigHashType
+	RedeemScript       []byte
+	WitnessScript      []byte
+	FinalScriptSig     []byte
+	FinalScriptWitness []byte
+	TaprootKeySpendSig []byte
+
+	// UtreexoLeafData is the leaf data of the output the input spends.
+	UtreexoLeafData *wire.LeafData
+
+	Unknowns []*Unknown
+}
+
+// POutput is the data of a PSBT output.
+type POutput struct {
+	RedeemScript  []byte
+	WitnessScript []byte
+	Unknowns      []*Unknown
+}
+
+// Packet is a partially signed bitcoin transaction.
+type Packet struct {
+	// UnsignedTx is the transaction being built.  All of its input scripts
+	// and witnesses are empty.
+	UnsignedTx *wire.MsgTx
+
+	// Inputs and Outputs hold the data of each input and output of the
+	// unsigned transaction, in the same order.
+	Inputs  []PInput
+	Outputs []POutput
+
+	// UtreexoProvedAtHash is the hash of the block UtreexoProof is for.
+	UtreexoProvedAtHash *chainhash.Hash
+
+	// UtreexoProof is the accumulator proof of the leaf datas of the
+	// inputs, in the order of the inputs.
+	UtreexoProof *utreexo.Proof
+
+	Unknowns []*Unknown
+}
+
+// NewFromUnsignedTx returns a PSBT for the given unsigned transaction.
+func NewFromUnsignedTx(tx *wire.MsgTx) (*Packet, error) {
+	if !isUnsigned(tx) {
+		return nil, ErrSignedTx
+	}
+
+	return &Packet{
+		UnsignedTx: tx,
+		Inputs:     make([]PInput, len(tx.TxIn)),
+		Outputs:    make([]POutput, len(tx.TxOut)),
+	}, nil
+}
+
+// NewFromRawBytes parses a serialized PSBT from r.  When b64 is true, the PSBT
+// is expected to be base64 encoded.
+func NewFromRawBytes(r io.Reader, b64 bool) (*Packet, error) {
+	if b64 {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	var magic [5]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != psbtMagic {
+		return nil, ErrInvalidMagic
+	}
+
+	p := &Packet{}
+	pairs, err := readMap(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		err := p.parseGlobal(pair)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.UnsignedTx == nil {
+		return nil, ErrMissingUnsignedTx
+	}
+
+	p.Inputs = make([]PInput, len(p.UnsignedTx.TxIn))
+	for i := range p.Inputs {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			err := p.Inputs[i].parse(pair)
+			if err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+		}
+
+		nonWitnessUtxo := p.Inputs[i].NonWitnessUtxo
+		prevOut := p.UnsignedTx.TxIn[i].PreviousOutPoint
+		if nonWitnessUtxo != nil && nonWitnessUtxo.TxHash() != prevOut.Hash {
+			return nil, fmt.Errorf("input %d: non-witness utxo %v "+
+				"doesn't match the outpoint %v", i,
+				nonWitnessUtxo.TxHash(), prevOut)
+		}
+	}
+
+	p.Outputs = make([]POutput, len(p.UnsignedTx.TxOut))
+	for i := range p.Outputs {
+		pairs, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			err := p.Outputs[i].parse(pair)
+			if err != nil {
+				return nil, fmt.Errorf("output %d: %w", i, err)
+			}
+		}
+	}
+
+	if err := p.SanityCheck(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// parseGlobal sets the global field of the key-value pair.
+func (p *Packet) parseGlobal(pair kvPair) error {
+	switch pair.key[0] {
+	case unsignedTxType:
+		if len(pair.key) != 1 {
+			return ErrInvalidKey
+		}
+		tx := wire.NewMsgTx(wire.TxVersion)
+		err := tx.DeserializeNoWitness(bytes.NewReader(pair.value))
+		if err != nil {
+			return err
+		}
+		if !isUnsigned(tx) {
+			return ErrSignedTx
+		}
+		p.UnsignedTx = tx
+		return nil
+
+	case versionType:
+		if len(pair.key) != 1 || len(pair.value) != 4 {
+			return ErrInvalidKey
+		}
+		if binary.LittleEndian.Uint32(pair.value) != 0 {
+			return fmt.Errorf("unsupported psbt version %d",
+				binary.LittleEndian.Uint32(pair.value))
+		}
+
+	case proprietaryType:
+		subtype, ok, err := parseUtreexoKey(pair.key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		switch subtype {
+		case utreexoProvedAtHashSubtype:
+			hash, err := chainhash.NewHash(pair.value)
+			if err != nil {
+				return ErrInvalidValue
+			}
+			p.UtreexoProvedAtHash = hash
+			return nil
+
+		case utreexoProofSubtype:
+			proof, err := wire.BatchProofDeserialize(
+				bytes.NewReader(pair.value))
+			if err != nil {
+				return err
+			}
+			p.UtreexoProof = proof
+			return nil
+		}
+	}
+
+	p.Unknowns = append(p.Unknowns, &Unknown{pair.key, pair.value})
+	return nil
+}
+
+// parse sets the input field of the key-value pair.
+func (pi *PInput) parse(pair kvPair) error {
+	// The keys of the fields that aren't indexed by a public key or by
+	// proprietary key data are only the key type.
+	keyType := pair.key[0]
+	switch keyType {
+	case nonWitnessUtxoType, witnessUtxoType, sighashType,
+		inRedeemScriptType, inWitnessScriptType, finalScriptSigType,
+		finalScriptWitnessType, taprootKeySpendSigType:
+
+		if len(pair.key) != 1 {
+			return ErrInvalidKey
+		}
+	}
+
+	switch keyType {
+	case nonWitnessUtxoType:
+		tx := wire.NewMsgTx(wire.TxVersion)
+		err := tx.Deserialize(bytes.NewReader(pair.value))
+		if err != nil {
+			return err
+		}
+		pi.NonWitnessUtxo = tx
+
+	case witnessUtxoType:
+		txOut, err := readTxOut(pair.value)
+		if err != nil {
+			return err
+		}
+		pi.WitnessUtxo = txOut
+
+	case partialSigType:
+		pubKey := pair.key[1:]
+		if len(pubKey) != 33 && len(pubKey) != 65 {
+			return ErrInvalidKey
+		}
+		pi.PartialSigs = append(pi.PartialSigs, &PartialSig{
+			PubKey:    pubKey,
+			Signature: pair.value,
+		})
+
+	case sighashType:
+		if len(pair.value) != 4 {
+			return ErrInvalidValue
+		}
+		pi.SighashType = txscript.SigHashType(
+			binary.LittleEndian.Uint32(pair.value))
+
+	case inRedeemScriptType:
+		pi.RedeemScript = pair.value
+
+	case inWitnessScriptType:
+		pi.WitnessScript = pair.value
+
+	case finalScriptSigType:
+		pi.FinalScriptSig = pair.value
+
+	case finalScriptWitnessType:
+		if _, err := parseWitness(pair.value); err != nil {
+			return err
+		}
+		pi.FinalScriptWitness = pair.value
+
+	case taprootKeySpendSigType:
+		if len(pair.value) != 64 && len(pair.value) != 65 {
+			return ErrInvalidValue
+		}
+		pi.TaprootKeySpendSig = pair.value
+
+	case proprietaryType:
+		subtype, ok, err := parseUtreexoKey(pair.key)
+		if err != nil {
+			return err
+		}
+		if ok && subtype == utreexoLeafDataSubtype {
+			var ld wire.LeafData
+			err := ld.Deserialize(bytes.NewReader(pair.value))
+			if err != nil {
+				return err
+			}
+			pi.UtreexoLeafData = &ld
+			return nil
+		}
+		pi.Unknowns = append(pi.Unknowns, &Unknown{pair.key, pair.value})
+
+	default:
+		pi.Unknowns = append(pi.Unknowns, &Unknown{pair.key, pair.value})
+	}
+
+	return nil
+}
+
+// parse sets the output field of the key-value pair.
+func (po *POutput) parse(pair kvPair) error {
+	switch pair.key[0] {
+	case outRedeemScriptType:
+		if len(pair.key) != 1 {
+			return ErrInvalidKey
+		}
+		po.RedeemScript = pair.value
+
+	case outWitnessScriptType:
+		if len(pair.key) != 1 {
+			return ErrInvalidKey
+		}
+		po.WitnessScript = pair.value
+
+	default:
+		po.Unknowns = append(po.Unknowns, &Unknown{pair.key, pair.value})
+	}
+
+	return nil
+}
+
+// Serialize writes the PSBT to w.
+func (p *Packet) Serialize(w io.Writer) error {
+	if err := p.SanityCheck(); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(psbtMagic[:]); err != nil {
+		return err
+	}
+
+	// Global map.
+	var txBuf bytes.Buffer
+	if err := p.UnsignedTx.SerializeNoWitness(&txBuf); err != nil {
+		return err
+	}
+	if err := writePair(w, []byte{unsignedTxType}, txBuf.Bytes()); err != nil {
+		return err
+	}
+	if p.UtreexoProvedAtHash != nil {
+		err := writePair(w, utreexoKey(utreexoProvedAtHashSubtype),
+			p.UtreexoProvedAtHash[:])
+		if err != nil {
+			return err
+		}
+	}
+	if p.UtreexoProof != nil {
+		var proofBuf bytes.Buffer
+		err := wire.BatchProofSerialize(&proofBuf, p.UtreexoProof)
+		if err != nil {
+			return err
+		}
+		err = writePair(w, utreexoKey(utreexoProofSubtype), proofBuf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeUnknowns(w, p.Unknowns); err != nil {
+		return err
+	}
+
+	for i := range p.Inputs {
+		if err := p.Inputs[i].serialize(w); err != nil {
+			return err
+		}
+	}
+	for i := range p.Outputs {
+		if err := p.Outputs[i].serialize(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serialize writes the input map to w.
+func (pi *PInput) serialize(w io.Writer) error {
+	if pi.NonWitnessUtxo != nil {
+		var buf bytes.Buffer
+		if err := pi.NonWitnessUtxo.Serialize(&buf); err != nil {
+			return err
+		}
+		err := writePair(w, []byte{nonWitnessUtxoType}, buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	if pi.WitnessUtxo != nil {
+		var buf bytes.Buffer
+		var amount [8]byte
+		binary.LittleEndian.PutUint64(amount[:], uint64(pi.WitnessUtxo.Value))
+		buf.Write(amount[:])
+		if err := wire.WriteVarBytes(&buf, 0, pi.WitnessUtxo.PkScript); err != nil {
+			return err
+		}
+		if err := writePair(w, []byte{witnessUtxoType}, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	for _, sig := range pi.PartialSigs {
+		key := append([]byte{partialSigType}, sig.PubKey...)
+		if err := writePair(w, key, sig.Signature); err != nil {
+			return err
+		}
+	}
+	if pi.SighashType != 0 {
+		var value [4]byte
+		binary.LittleEndian.PutUint32(value[:], uint32(pi.SighashType))
+		if err := writePair(w, []byte{sighashType}, value[:]); err != nil {
+			return err
+		}
+	}
+
+	scripts := []struct {
+		keyType byte
+		value   []byte
+	}{
+		{inRedeemScriptType, pi.RedeemScript},
+		{inWitnessScriptType, pi.WitnessScript},
+		{finalScriptSigType, pi.FinalScriptSig},
+		{finalScriptWitnessType, pi.FinalScriptWitness},
+		{taprootKeySpendSigType, pi.TaprootKeySpendSig},
+	}
+	for _, script := range scripts {
+		if script.value == nil {
+			continue
+		}
+		if err := writePair(w, []byte{script.keyType}, script.value); err != nil {
+			return err
+		}
+	}
+
+	if pi.UtreexoLeafData != nil {
+		var buf bytes.Buffer
+		if err := pi.UtreexoLeafData.Serialize(&buf); err != nil {
+			return err
+		}
+		err := writePair(w, utreexoKey(utreexoLeafDataSubtype), buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeUnknowns(w, pi.Unknowns)
+}
+
+// serialize writes the output map to w.
+func (po *POutput) serialize(w io.Writer) error {
+	if po.RedeemScript != nil {
+		err := writePair(w, []byte{outRedeemScriptType}, po.RedeemScript)
+		if err != nil {
+			return err
+		}
+	}
+	if po.WitnessScript != nil {
+		err := writePair(w, []byte{outWitnessScriptType}, po.WitnessScript)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeUnknowns(w, po.Unknowns)
+}
+
+// B64Encode returns the base64 encoding of the serialized PSBT.
+func (p *Packet) B64Encode() (string, error) {
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// SanityCheck returns an error if the inputs and outputs of the PSBT don't
+// match its unsigned transaction or if the utreexo data is inconsistent.
+func (p *Packet) SanityCheck() error {
+	if p.UnsignedTx == nil {
+		return ErrMissingUnsignedTx
+	}
+	if !isUnsigned(p.UnsignedTx) {
+		return ErrSignedTx
+	}
+	if len(p.Inputs) != len(p.UnsignedTx.TxIn) {
+		return fmt.Errorf("psbt has %d inputs but its transaction has %d",
+			len(p.Inputs), len(p.UnsignedTx.TxIn))
+	}
+	if len(p.Outputs) != len(p.UnsignedTx.TxOut) {
+		return fmt.Errorf("psbt has %d outputs but its transaction has %d",
+			len(p.Outputs), len(p.UnsignedTx.TxOut))
+	}
+
+	for i, pIn := range p.Inputs {
+		ld := pIn.UtreexoLeafData
+		if ld == nil {
+			continue
+		}
+		if ld.OutPoint != p.UnsignedTx.TxIn[i].PreviousOutPoint {
+			return fmt.Errorf("input %d: leaf data outpoint %v doesn't "+
+				"match the outpoint %v", i, ld.OutPoint,
+				p.UnsignedTx.TxIn[i].PreviousOutPoint)
+		}
+	}
+
+	if p.UtreexoProof != nil {
+		if p.UtreexoProvedAtHash == nil {
+			return fmt.Errorf("psbt has a utreexo proof without the " +
+				"hash it was proved at")
+		}
+		leafCount := 0
+		for _, pIn := range p.Inputs {
+			if pIn.UtreexoLeafData != nil {
+				leafCount++
+			}
+		}
+		if len(p.UtreexoProof.Targets) != leafCount {
+			return fmt.Errorf("psbt utreexo proof has %d targets but %d "+
+				"inputs have leaf datas",
+				len(p.UtreexoProof.Targets), leafCount)
+		}
+	}
+
+	return nil
+}
+
+// IsComplete returns true if all the inputs of the PSBT are finalized.
+func (p *Packet) IsComplete() bool {
+	for i := range p.Inputs {
+		if !isFinalized(&p.Inputs[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddUtreexoData attaches the leaf datas and the accumulator proof in the
+// udata to the inputs of the PSBT.  The leaf datas must be for every input of
+// the PSBT and the proof must be for their hashes in the order of the inputs.
+// The inputs spending witness programs also get their witness utxo set.
+func (p *Packet) AddUtreexoData(ud *wire.UData, provedAt chainhash.Hash) error {
+	if len(ud.LeafDatas) != len(p.Inputs) {
+		return fmt.Errorf("have %d leaf datas for %d inputs",
+			len(ud.LeafDatas), len(p.Inputs))
+	}
+	if len(ud.AccProof.Targets) != len(ud.LeafDatas) {
+		return fmt.Errorf("utreexo proof has %d targets for %d leaf datas",
+			len(ud.AccProof.Targets), len(ud.LeafDatas))
+	}
+
+	for i := range ud.LeafDatas {
+		ld := ud.LeafDatas[i]
+		prevOut := p.UnsignedTx.TxIn[i].PreviousOutPoint
+		if ld.OutPoint != prevOut {
+			return fmt.Errorf("input %d: leaf data outpoint %v doesn't "+
+				"match the outpoint %v", i, ld.OutPoint, prevOut)
+		}
+
+		pIn := &p.Inputs[i]
+		pIn.UtreexoLeafData = &ld
+		if pIn.WitnessUtxo == nil && txscript.IsWitnessProgram(ld.PkScript) {
+			pIn.WitnessUtxo = wire.NewTxOut(ld.Amount, ld.PkScript)
+		}
+	}
+
+	proof := ud.AccProof
+	p.UtreexoProof = &proof
+	p.UtreexoProvedAtHash = &provedAt
+
+	return nil
+}
+
+// isUnsigned returns true if none of the inputs of the transaction have an
+// input script or a witness.
+func isUnsigned(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// kvPair is a key-value pair of a PSBT map.
+type kvPair struct {
+	key   []byte
+	value []byte
+}
+
+// readMap reads the key-value pairs of a map up to and including its
+// separator.
+func readMap(r io.Reader) ([]kvPair, error) {
+	var pairs []kvPair
+	seen := make(map[string]struct{})
+	for {
+		keyLen, err := wire.ReadVarInt(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		if keyLen == 0 {
+			return pairs, nil
+		}
+		if keyLen > maxPsbtKeyLength {
+			return nil, ErrInvalidKey
+		}
+
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		value, err := wire.ReadVarBytes(r, 0, maxPsbtValueLength, "psbt value")
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[string(key)]; ok {
+			return nil, ErrDuplicateKey
+		}
+		seen[string(key)] = struct{}{}
+
+		pairs = append(pairs, kvPair{key: key, value: value})
+	}
+}
+
+// writePair writes the key-value pair to w.
+func writePair(w io.Writer, key, value []byte) error {
+	if err := wire.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+
+	return wire.WriteVarBytes(w, 0, value)
+}
+
+// writeUnknowns writes the unknown key-value pairs followed by the map
+// separator to w.
+func writeUnknowns(w io.Writer, unknowns []*Unknown) error {
+	for _, unknown := range unknowns {
+		if err := writePair(w, unknown.Key, unknown.Value); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0x00})
+	return err
+}
+
+// utreexoKey returns the key of the utreexo proprietary field with the given
+// subtype.
+func utreexoKey(subtype uint64) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(proprietaryType)
+	wire.WriteVarBytes(&buf, 0, []byte(UtreexoIdentifier))
+	wire.WriteVarInt(&buf, 0, subtype)
+
+	return buf.Bytes()
+}
+
+// parseUtreexoKey returns the subtype of the proprietary key.  The returned
+// bool is false if the key isn't a utreexo field.
+func parseUtreexoKey(key []byte) (uint64, bool, error) {
+	r := bytes.NewReader(key[1:])
+	identifier, err := wire.ReadVarBytes(r, 0, maxPsbtKeyLength,
+		"proprietary identifier")
+	if err != nil {
+		return 0, false, ErrInvalidKey
+	}
+	subtype, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return 0, false, ErrInvalidKey
+	}
+
+	// The utreexo fields don't have any key data after the subtype.
+	if string(identifier) != UtreexoIdentifier || r.Len() != 0 {
+		return 0, false, nil
+	}
+
+	return subtype, true, nil
+}
+
+// readTxOut parses a witness utxo value, which is an 8 byte amount followed
+// by the public key script.
+func readTxOut(value []byte) (*wire.TxOut, error) {
+	if len(value) < 8 {
+		return nil, ErrInvalidValue
+	}
+	amount := int64(binary.LittleEndian.Uint64(value[:8]))
+
+	r := bytes.NewReader(value[8:])
+	pkScript, err := wire.ReadVarBytes(r, 0, wire.MaxScriptSize, "pkscript")
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, ErrInvalidValue
+	}
+
+	return wire.NewTxOut(amount, pkScript), nil
+}
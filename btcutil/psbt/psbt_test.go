@@ -0,0 +1,398 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testUtxo is an output spent in the tests along with the key that can spend
+// it.
+type testUtxo struct {
+	key      *btcec.PrivateKey
+	leafData wire.LeafData
+}
+
+// newTestUtxos returns a p2wpkh and a p2pkh utxo along with an accumulator
+// that has both of them and a few other leaves.
+func newTestUtxos(t *testing.T) ([]testUtxo, *utreexo.Pollard) {
+	var utxos []testUtxo
+	for i := 0; i < 2; i++ {
+		key, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeyHash := btcutil.Hash160(key.PubKey().SerializeCompressed())
+
+		builder := txscript.NewScriptBuilder()
+		if i == 0 {
+			builder.AddOp(txscript.OP_0).AddData(pubKeyHash)
+		} else {
+			builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+				AddData(pubKeyHash).AddOp(txscript.OP_EQUALVERIFY).
+				AddOp(txscript.OP_CHECKSIG)
+		}
+		pkScript, err := builder.Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		utxos = append(utxos, testUtxo{
+			key: key,
+			leafData: wire.LeafData{
+				BlockHash: chainhash.Hash{0x01, byte(i)},
+				OutPoint: wire.OutPoint{
+					Hash:  chainhash.Hash{0x02, byte(i)},
+					Index: uint32(i),
+				},
+				Amount:   int64(i+1) * 100000,
+				PkScript: pkScript,
+				Height:   int32(i + 1),
+			},
+		})
+	}
+
+	acc := utreexo.NewAccumulator()
+	var adds []utreexo.Leaf
+	for i := 0; i < 5; i++ {
+		adds = append(adds, utreexo.Leaf{Hash: utreexo.Hash{0x03, byte(i)}})
+	}
+	for _, utxo := range utxos {
+		adds = append(adds, utreexo.Leaf{Hash: utxo.leafData.LeafHash()})
+	}
+	err := acc.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return utxos, &acc
+}
+
+// newTestPacket returns a PSBT spending the utxos with their utreexo data
+// attached.
+func newTestPacket(t *testing.T, utxos []testUtxo, acc *utreexo.Pollard) *Packet {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	var hashes []utreexo.Hash
+	var leafDatas []wire.LeafData
+	for _, utxo := range utxos {
+		prevOut := utxo.leafData.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&prevOut, nil, nil))
+		hashes = append(hashes, utxo.leafData.LeafHash())
+		leafDatas = append(leafDatas, utxo.leafData)
+	}
+	tx.AddTxOut(wire.NewTxOut(250000, utxos[0].leafData.PkScript))
+
+	p, err := NewFromUnsignedTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := acc.Prove(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ud := wire.UData{AccProof: proof, LeafDatas: leafDatas}
+	err = p.AddUtreexoData(&ud, chainhash.Hash{0x04})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	utxos, acc := newTestUtxos(t)
+	p := newTestPacket(t, utxos, acc)
+	p.Inputs[1].PartialSigs = []*PartialSig{{
+		PubKey:    utxos[1].key.PubKey().SerializeCompressed(),
+		Signature: []byte{0x30, 0x01},
+	}}
+	p.Inputs[1].SighashType = txscript.SigHashAll
+	p.Unknowns = []*Unknown{{Key: []byte{0xf0, 0x01}, Value: []byte{0x02}}}
+	p.Outputs[0].Unknowns = []*Unknown{{Key: []byte{0xf1}, Value: nil}}
+
+	// Only the witness program input gets its witness utxo set.
+	if p.Inputs[0].WitnessUtxo == nil || p.Inputs[1].WitnessUtxo != nil {
+		t.Fatalf("expected only the first input to have a witness utxo")
+	}
+
+	encoded, err := p.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reencoded, err := parsed.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reencoded != encoded {
+		t.Fatalf("expected %s, got %s", encoded, reencoded)
+	}
+
+	if *parsed.UtreexoProvedAtHash != *p.UtreexoProvedAtHash {
+		t.Fatalf("expected proved at hash %v, got %v",
+			p.UtreexoProvedAtHash, parsed.UtreexoProvedAtHash)
+	}
+	if !reflect.DeepEqual(parsed.UtreexoProof, p.UtreexoProof) {
+		t.Fatalf("expected proof %v, got %v", p.UtreexoProof,
+			parsed.UtreexoProof)
+	}
+	for i := range p.Inputs {
+		if !reflect.DeepEqual(parsed.Inputs[i].UtreexoLeafData,
+			p.Inputs[i].UtreexoLeafData) {
+
+			t.Fatalf("input %d: expected leaf data %v, got %v", i,
+				p.Inputs[i].UtreexoLeafData,
+				parsed.Inputs[i].UtreexoLeafData)
+		}
+	}
+	if parsed.Inputs[1].SighashType != txscript.SigHashAll {
+		t.Fatalf("expected sighash type %v, got %v", txscript.SigHashAll,
+			parsed.Inputs[1].SighashType)
+	}
+}
+
+func TestFinalizeAndExtract(t *testing.T) {
+	utxos, acc := newTestUtxos(t)
+	p := newTestPacket(t, utxos, acc)
+
+	if MaybeFinalizeAll(p) {
+		t.Fatalf("expected the psbt without signatures to be incomplete")
+	}
+	if _, err := Extract(p); !errors.Is(err, ErrIncompletePSBT) {
+		t.Fatalf("expected %v, got %v", ErrIncompletePSBT, err)
+	}
+
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut)
+	for i := range p.Inputs {
+		prevOut, err := p.PrevOutput(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevOuts[p.UnsignedTx.TxIn[i].PreviousOutPoint] = prevOut
+	}
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(p.UnsignedTx, fetcher)
+
+	// Sign the p2wpkh input.
+	ld := utxos[0].leafData
+	witnessSig, err := txscript.RawTxInWitnessSignature(p.UnsignedTx,
+		sigHashes, 0, ld.Amount, ld.PkScript, txscript.SigHashAll,
+		utxos[0].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].PartialSigs = []*PartialSig{{
+		PubKey:    utxos[0].key.PubKey().SerializeCompressed(),
+		Signature: witnessSig,
+	}}
+
+	// Sign the p2pkh input.
+	ld = utxos[1].leafData
+	sig, err := txscript.RawTxInSignature(p.UnsignedTx, 1, ld.PkScript,
+		txscript.SigHashAll, utxos[1].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[1].PartialSigs = []*PartialSig{{
+		PubKey:    utxos[1].key.PubKey().SerializeCompressed(),
+		Signature: sig,
+	}}
+
+	// Round trip the signed PSBT before finalizing it like a finalizer
+	// receiving it from the signers would.
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err = NewFromRawBytes(&buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !MaybeFinalizeAll(p) {
+		t.Fatalf("expected the signed psbt to be complete")
+	}
+	tx, err := Extract(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range tx.TxIn {
+		prevOut := prevOuts[tx.TxIn[i].PreviousOutPoint]
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i,
+			txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value,
+			fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+
+	// The udata must prove the inputs against the accumulator.
+	ud, err := ExtractUData(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []utreexo.Hash
+	for i, ld := range ud.LeafDatas {
+		if ld.OutPoint != tx.TxIn[i].PreviousOutPoint {
+			t.Fatalf("leaf data %d is for %v, expected %v", i,
+				ld.OutPoint, tx.TxIn[i].PreviousOutPoint)
+		}
+		hashes = append(hashes, ld.LeafHash())
+	}
+	stump := utreexo.Stump{Roots: acc.GetRoots(), NumLeaves: acc.GetNumLeaves()}
+	if _, err := utreexo.Verify(stump, hashes, ud.AccProof); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFinalizeErrors(t *testing.T) {
+	utxos, acc := newTestUtxos(t)
+	p := newTestPacket(t, utxos, acc)
+
+	// A signature from a key that doesn't match the script.
+	otherKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Inputs[0].PartialSigs = []*PartialSig{{
+		PubKey:    otherKey.PubKey().SerializeCompressed(),
+		Signature: []byte{0x30},
+	}}
+	if err := Finalize(p, 0); err == nil {
+		t.Fatalf("expected an error for a mismatched public key")
+	}
+
+	// An input without any information about the output it spends.
+	p.Inputs[1].UtreexoLeafData = nil
+	if err := Finalize(p, 1); !errors.Is(err, ErrMissingUtxo) {
+		t.Fatalf("expected %v, got %v", ErrMissingUtxo, err)
+	}
+	if _, err := ExtractUData(p); !errors.Is(err, ErrMissingUtreexoData) {
+		t.Fatalf("expected %v, got %v", ErrMissingUtreexoData, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	utxos, acc := newTestUtxos(t)
+	p := newTestPacket(t, utxos, acc)
+	var buf bytes.Buffer
+	if err := p.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	// The utreexo leaf data of the first input is duplicated.
+	p2 := newTestPacket(t, utxos, acc)
+	p2.Inputs[0].Unknowns = []*Unknown{{
+		Key:   utreexoKey(utreexoLeafDataSubtype),
+		Value: []byte{0x00},
+	}}
+	var dupBuf bytes.Buffer
+	if err := p2.Serialize(&dupBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			name: "invalid magic",
+			b:    append([]byte{0x70, 0x73, 0x62, 0x74, 0x00}, valid[5:]...),
+			err:  ErrInvalidMagic,
+		},
+		{
+			name: "duplicate key",
+			b:    dupBuf.Bytes(),
+			err:  ErrDuplicateKey,
+		},
+		{
+			name: "missing unsigned tx",
+			b:    append(psbtMagic[:], 0x00),
+			err:  ErrMissingUnsignedTx,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewFromRawBytes(bytes.NewReader(test.b), false)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	// A truncated psbt must fail to parse.
+	_, err := NewFromRawBytes(bytes.NewReader(valid[:len(valid)-1]), false)
+	if err == nil {
+		t.Fatalf("expected an error for a truncated psbt")
+	}
+
+	// A signed transaction isn't allowed in a psbt.
+	signed := p.UnsignedTx.Copy()
+	signed.TxIn[0].SignatureScript = []byte{0x00}
+	if _, err := NewFromUnsignedTx(signed); !errors.Is(err, ErrSignedTx) {
+		t.Fatalf("expected %v, got %v", ErrSignedTx, err)
+	}
+}
+
+func TestParseBIP174(t *testing.T) {
+	// A valid psbt from the test vectors of BIP0174 with one input that
+	// has a non-witness utxo and two outputs.
+	b64 := "cHNidP8BAHUCAAAAASaBcTce3/KF6Tet7qSze3gADAVmy7OtZGQXE8pCFxv2AAAAAA" +
+		"D+////AtPf9QUAAAAAGXapFNDFmQPFusKGh2DpD9UhpGZap2UgiKwA4fUFAAAAABepFD" +
+		"VF5uM7gyxHBQ8k0+65PJwDlIvHh7MuEwAAAQD9pQEBAAAAAAECiaPHHqtNIOA3G7ukzG" +
+		"mPopXJRjr6Ljl/hTPMti+VZ+UBAAAAFxYAFL4Y0VKpsBIDna89p95PUzSe7LmF/////4" +
+		"b4qkOnHf8USIk6UwpyN+9rRgi7st0tAXHmOuxqSJC0AQAAABcWABT+Pp7xp0XpdNkCxD" +
+		"VZQ6vLNL1TU/////8CAMLrCwAAAAAZdqkUhc/xCX/Z4Ai7NK9wnGIZeziXikiIrHL++E" +
+		"4sAAAAF6kUM5cluiHv1irHU6m80GfWx6ajnQWHAkcwRAIgJxK+IuAnDzlPVoMR3Hyppo" +
+		"lwuAJf3TskAinwf4pfOiQCIAGLONfc0xTnNMkna9b7QPZzMlvEuqFEyADS8vAtsnZcAS" +
+		"ED0uFWdJQbrUqZY3LLh+GFbTZSYG2YVi/jnF6efkE/IQUCSDBFAiEA0SuFLYXc2WHS9f" +
+		"SrZgZU327tzHlMDDPOXMMJ/7X85Y0CIGczio4OFyXBl/saiK9Z9R5E5CVbIBZ8hoQDHA" +
+		"XR8lkqASECI7cr7vCWXRC+B3jv7NYfysb3mk6haTkzgHNEZPhPKrMAAAAAAAAA"
+	p, err := NewFromRawBytes(strings.NewReader(b64), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Inputs) != 1 || len(p.Outputs) != 2 {
+		t.Fatalf("expected 1 input and 2 outputs, got %d and %d",
+			len(p.Inputs), len(p.Outputs))
+	}
+	if p.Inputs[0].NonWitnessUtxo == nil {
+		t.Fatalf("expected the input to have a non-witness utxo")
+	}
+
+	encoded, err := p.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded != base64.StdEncoding.EncodeToString(raw) {
+		t.Fatalf("expected %s, got %s", b64, encoded)
+	}
+}
@@ -83,17 +83,30 @@ func realMain() error {
 	}
 	defer db.Close()
 
-	fi, err := os.Open(cfg.InFile)
-	if err != nil {
-		log.Errorf("Failed to open file %v: %v", cfg.InFile, err)
-		return err
+	// Read the blocks from the block files of Bitcoin Core or from the
+	// input file.
+	var fi *os.File
+	var coreFiles *coreBlockFiles
+	if cfg.coreBlocksDir != "" {
+		coreFiles, err = newCoreBlockFiles(cfg.coreBlocksDir)
+		if err != nil {
+			log.Errorf("Failed to open the block files: %v", err)
+			return err
+		}
+		defer coreFiles.Close()
+	} else {
+		fi, err = os.Open(cfg.InFile)
+		if err != nil {
+			log.Errorf("Failed to open file %v: %v", cfg.InFile, err)
+			return err
+		}
+		defer fi.Close()
 	}
-	defer fi.Close()
 
 	// Create a block importer for the database and input file and start it.
 	// The done channel returned from start will contain an error if
 	// anything went wrong.
-	importer, err := newBlockImporter(db, fi)
+	importer, err := newBlockImporter(db, fi, coreFiles)
 	if err != nil {
 		log.Errorf("Failed create block importer: %v", err)
 		return err
@@ -21,11 +21,15 @@ const (
 	defaultDbType   = "ffldb"
 	defaultDataFile = "bootstrap.dat"
 	defaultProgress = 10
+
+	// defaultUtreexoMaxMemory is the memory in mebibytes (MiB) the utreexo
+	// proof indexes use for caching the accumulator.
+	defaultUtreexoMaxMemory = 500
 )
 
 var (
-	btcdHomeDir     = btcutil.AppDataDir("btcd", false)
-	defaultDataDir  = filepath.Join(btcdHomeDir, "data")
+	defaultHomeDir  = btcutil.AppDataDir("utreexod", false)
+	defaultDataDir  = filepath.Join(defaultHomeDir, "data")
 	knownDbTypes    = database.SupportedDrivers()
 	activeNetParams = &chaincfg.MainNetParams
 )
@@ -34,15 +38,22 @@ var (
 //
 // See loadConfig for details on the configuration load process.
 type config struct {
-	AddrIndex      bool   `long:"addrindex" description:"Build a full address-based transaction index which makes the searchrawtransactions RPC available"`
-	DataDir        string `short:"b" long:"datadir" description:"Location of the btcd data directory"`
-	DbType         string `long:"dbtype" description:"Database backend to use for the Block Chain"`
-	InFile         string `short:"i" long:"infile" description:"File containing the block(s)"`
-	Progress       int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
-	RegressionTest bool   `long:"regtest" description:"Use the regression test network"`
-	SimNet         bool   `long:"simnet" description:"Use the simulation test network"`
-	TestNet3       bool   `long:"testnet" description:"Use the test network"`
-	TxIndex        bool   `long:"txindex" description:"Build a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	AddrIndex             bool   `long:"addrindex" description:"Build a full address-based transaction index which makes the searchrawtransactions RPC available"`
+	CoreDataDir           string `long:"coredatadir" description:"Import the blocks from the block files (blk*.dat) in the data directory of a Bitcoin Core node instead of from --infile"`
+	DataDir               string `short:"b" long:"datadir" description:"Location of the utreexod data directory"`
+	DbType                string `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	FlatUtreexoProofIndex bool   `long:"flatutreexoproofindex" description:"Build the utreexo accumulator and the flat utreexo proof index along with the blocks"`
+	InFile                string `short:"i" long:"infile" description:"File containing the block(s)"`
+	Progress              int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
+	RegressionTest        bool   `long:"regtest" description:"Use the regression test network"`
+	SimNet                bool   `long:"simnet" description:"Use the simulation test network"`
+	TestNet3              bool   `long:"testnet" description:"Use the test network"`
+	TxIndex               bool   `long:"txindex" description:"Build a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	UtreexoProofIndex     bool   `long:"utreexoproofindex" description:"Build the utreexo accumulator and the utreexo proof index along with the blocks"`
+
+	// coreBlocksDir is the directory of the block files of Bitcoin Core
+	// for the active network.
+	coreBlocksDir string
 }
 
 // filesExists reports whether the named file or directory exists.
@@ -148,6 +159,28 @@ func loadConfig() (*config, []string, error) {
 	// worry about changing names per network and such.
 	cfg.DataDir = filepath.Join(cfg.DataDir, netName(activeNetParams))
 
+	// Find the block files of the active network when importing from the
+	// data directory of Bitcoin Core.
+	if cfg.CoreDataDir != "" {
+		cfg.coreBlocksDir, err = coreBlocksDir(cfg.CoreDataDir,
+			activeNetParams)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			parser.WriteHelp(os.Stderr)
+			return nil, nil, err
+		}
+		if !fileExists(cfg.coreBlocksDir) {
+			str := "%s: The block files directory [%v] does not exist"
+			err := fmt.Errorf(str, funcName, cfg.coreBlocksDir)
+			fmt.Fprintln(os.Stderr, err)
+			parser.WriteHelp(os.Stderr)
+			return nil, nil, err
+		}
+
+		return &cfg, remainingArgs, nil
+	}
+
 	// Ensure the specified block file exists.
 	if !fileExists(cfg.InFile) {
 		str := "%s: The specified block file [%v] does not exist"
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// coreBlocksDir returns the directory Bitcoin Core keeps the block files of the
+// given network in under its data directory.
+func coreBlocksDir(dataDir string, chainParams *chaincfg.Params) (string, error) {
+	switch chainParams.Net {
+	case wire.MainNet:
+		return filepath.Join(dataDir, "blocks"), nil
+	case wire.TestNet3:
+		return filepath.Join(dataDir, "testnet3", "blocks"), nil
+	case wire.TestNet:
+		return filepath.Join(dataDir, "regtest", "blocks"), nil
+	}
+	return "", fmt.Errorf("Bitcoin Core doesn't support the %s network",
+		chainParams.Name)
+}
+
+// coreBlockFiles reads the blocks from the blk*.dat files of Bitcoin Core in
+// the order they're stored in.  Core writes the blocks in the order they're
+// downloaded in, so a block may come before its parent and the files may have
+// blocks that aren't in the main chain.
+type coreBlockFiles struct {
+	dir     string
+	fileNum int
+	file    *os.File
+	r       *bufio.Reader
+
+	// xorKey is the key the files are obfuscated with as read from
+	// xor.dat.  It's nil for the files of the Core versions from before
+	// the obfuscation.
+	xorKey []byte
+
+	// offset is the position in the current file the next byte is read
+	// from.  The obfuscation key is applied from the start of the file.
+	offset int64
+}
+
+// newCoreBlockFiles returns a reader for the block files in the given blocks
+// directory of Bitcoin Core.
+func newCoreBlockFiles(dir string) (*coreBlockFiles, error) {
+	if _, err := os.Stat(filepath.Join(dir, "blk00000.dat")); err != nil {
+		return nil, fmt.Errorf("no block files in %s: %v", dir, err)
+	}
+
+	xorKey, err := os.ReadFile(filepath.Join(dir, "xor.dat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, b := range xorKey {
+		if b != 0 {
+			return &coreBlockFiles{dir: dir, xorKey: xorKey}, nil
+		}
+	}
+
+	// An all zero key doesn't change the files.
+	return &coreBlockFiles{dir: dir}, nil
+}
+
+// Read reads from the current block file and removes the obfuscation.
+func (f *coreBlockFiles) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if len(f.xorKey) > 0 {
+		for i := 0; i < n; i++ {
+			p[i] ^= f.xorKey[(f.offset+int64(i))%int64(len(f.xorKey))]
+		}
+	}
+	f.offset += int64(n)
+	return n, err
+}
+
+// openNext opens the next block file.  It returns false when there are no more
+// block files.
+func (f *coreBlockFiles) openNext() (bool, error) {
+	name := filepath.Join(f.dir, fmt.Sprintf("blk%05d.dat", f.fileNum))
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	log.Infof("Reading blocks from %s", name)
+	f.fileNum++
+	f.file = file
+	f.r = bufio.NewReaderSize(file, 1<<20)
+	f.offset = 0
+	return true, nil
+}
+
+// closeCurrent closes the current block file.
+func (f *coreBlockFiles) closeCurrent() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// readBlock reads the next block from the block files.  No block and no error
+// means there are no more blocks to read.
+func (f *coreBlockFiles) readBlock() ([]byte, error) {
+	for {
+		if f.file == nil {
+			more, err := f.openNext()
+			if err != nil || !more {
+				return nil, err
+			}
+		}
+
+		// The block files have the same format as the bootstrap file.
+		// Core preallocates the files so the rest of a file that
+		// wasn't written to is zeroed.
+		var net uint32
+		err := binary.Read(f, binary.LittleEndian, &net)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && net == 0) {
+			f.closeCurrent()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if net != uint32(activeNetParams.Net) {
+			return nil, fmt.Errorf("network mismatch in blk%05d.dat "+
+				"-- got %x, want %x", f.fileNum-1, net,
+				uint32(activeNetParams.Net))
+		}
+
+		var blockLen uint32
+		if err := binary.Read(f, binary.LittleEndian, &blockLen); err != nil {
+			return nil, err
+		}
+		if blockLen > wire.MaxBlockPayload {
+			return nil, fmt.Errorf("block payload of %d bytes is larger "+
+				"than the max allowed %d bytes", blockLen,
+				wire.MaxBlockPayload)
+		}
+
+		serializedBlock := make([]byte, blockLen)
+		if _, err := io.ReadFull(f, serializedBlock); err != nil {
+			return nil, err
+		}
+		return serializedBlock, nil
+	}
+}
+
+// Close closes the block file that's being read.
+func (f *coreBlockFiles) Close() {
+	f.closeCurrent()
+}
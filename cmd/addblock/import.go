@@ -34,6 +34,8 @@ type blockImporter struct {
 	db                database.DB
 	chain             *blockchain.BlockChain
 	r                 io.ReadSeeker
+	coreFiles         *coreBlockFiles
+	utreexoIndexes    []utreexoStateCloser
 	processQueue      chan []byte
 	doneChan          chan bool
 	errChan           chan error
@@ -46,10 +48,26 @@ type blockImporter struct {
 	lastHeight        int64
 	lastBlockTime     time.Time
 	lastLogTime       time.Time
+
+	// pending houses the blocks read from the block files of Bitcoin Core
+	// before their parent, keyed by the hash of the parent.
+	pending map[chainhash.Hash][]*btcutil.Block
+}
+
+// utreexoStateCloser is implemented by the utreexo proof indexes which keep
+// their accumulator outside of the block database and need it to be written
+// out once the import is done.
+type utreexoStateCloser interface {
+	CloseUtreexoState() error
 }
 
-// readBlock reads the next block from the input file.
+// readBlock reads the next block from the input file or from the block files
+// of Bitcoin Core.
 func (bi *blockImporter) readBlock() ([]byte, error) {
+	if bi.coreFiles != nil {
+		return bi.coreFiles.readBlock()
+	}
+
 	// The block file format is:
 	//  <network> <block length> <serialized block>
 	var net uint32
@@ -92,6 +110,10 @@ func (bi *blockImporter) readBlock() ([]byte, error) {
 // block through the chain rules to ensure it follows all rules and matches
 // up to the known checkpoint.  Returns whether the block was imported along
 // with any potential errors.
+//
+// The blocks from the block files of Bitcoin Core aren't in order, so orphans
+// are held back until their parent is imported instead and the blocks that
+// don't extend the main chain are skipped.
 func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 	// Deserialize the block which includes checks for malformed blocks.
 	block, err := btcutil.NewBlockFromBytes(serializedBlock)
@@ -121,19 +143,44 @@ func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 			return false, err
 		}
 		if !exists {
+			if bi.coreFiles != nil {
+				bi.pending[*prevHash] = append(
+					bi.pending[*prevHash], block)
+				return false, nil
+			}
 			return false, fmt.Errorf("import file contains block "+
 				"%v which does not link to the available "+
 				"block chain", prevHash)
 		}
 	}
 
-	// Ensure the blocks follows all of the chain rules and match up to the
-	// known checkpoints.
+	imported, err := bi.connectBlock(block)
+	if err != nil || bi.coreFiles == nil {
+		return imported, err
+	}
+
+	return imported, bi.processPending(blockHash)
+}
+
+// connectBlock runs the block through the chain rules to ensure it follows all
+// rules and matches up to the known checkpoints.  Returns whether the block
+// extended the main chain.
+func (bi *blockImporter) connectBlock(block *btcutil.Block) (bool, error) {
+	blockHash := block.Hash()
 	isMainChain, isOrphan, err := bi.chain.ProcessBlock(block,
 		blockchain.BFFastAdd)
 	if err != nil {
+		// Bitcoin Core stores the blocks it receives before fully
+		// validating them, so its block files may have invalid ones.
+		if _, ok := err.(blockchain.RuleError); ok && bi.coreFiles != nil {
+			log.Warnf("Skipping invalid block %v: %v", blockHash, err)
+			return false, nil
+		}
 		return false, err
 	}
+	if bi.coreFiles != nil {
+		return isMainChain && !isOrphan, nil
+	}
 	if !isMainChain {
 		return false, fmt.Errorf("import file contains an block that "+
 			"does not extend the main chain: %v", blockHash)
@@ -146,6 +193,31 @@ func (bi *blockImporter) processBlock(serializedBlock []byte) (bool, error) {
 	return true, nil
 }
 
+// processPending imports the blocks held back until the block with the given
+// hash was imported, along with the blocks held back for them in turn.
+func (bi *blockImporter) processPending(hash *chainhash.Hash) error {
+	parents := []chainhash.Hash{*hash}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		children := bi.pending[parent]
+		delete(bi.pending, parent)
+		for _, block := range children {
+			imported, err := bi.connectBlock(block)
+			if err != nil {
+				return err
+			}
+			if imported {
+				bi.blocksImported++
+			}
+			parents = append(parents, *block.Hash())
+		}
+	}
+
+	return nil
+}
+
 // readHandler is the main handler for reading blocks from the import file.
 // This allows block processing to take place in parallel with block reads.
 // It must be run as a goroutine.
@@ -228,7 +300,13 @@ out:
 			}
 
 			bi.blocksProcessed++
-			bi.lastHeight++
+			if bi.coreFiles != nil {
+				// The blocks aren't in order so the height is
+				// taken from the chain instead.
+				bi.lastHeight = int64(bi.chain.BestSnapshot().Height)
+			} else {
+				bi.lastHeight++
+			}
 			imported, err := bi.processBlock(serializedBlock)
 			if err != nil {
 				bi.errChan <- err
@@ -288,6 +366,15 @@ func (bi *blockImporter) Import() chan *importResults {
 	go func() {
 		bi.wg.Wait()
 
+		if len(bi.pending) > 0 {
+			var orphans int
+			for _, blocks := range bi.pending {
+				orphans += len(blocks)
+			}
+			log.Warnf("Skipped %d blocks whose parent wasn't found "+
+				"in the block files", orphans)
+		}
+
 		// Flush the changes made to the blockchain.
 		log.Info("Flushing blockchain caches to the disk...")
 		if err := bi.chain.FlushUtxoCache(blockchain.FlushRequired); err != nil {
@@ -295,6 +382,13 @@ func (bi *blockImporter) Import() chan *importResults {
 			bi.errChan <- err
 			return
 		}
+		for _, idx := range bi.utreexoIndexes {
+			if err := idx.CloseUtreexoState(); err != nil {
+				log.Errorf("Error while flushing the utreexo state: %v", err)
+				bi.errChan <- err
+				return
+			}
+		}
 		log.Info("Done flushing blockchain caches to disk")
 
 		bi.doneChan <- true
@@ -308,8 +402,11 @@ func (bi *blockImporter) Import() chan *importResults {
 }
 
 // newBlockImporter returns a new importer for the provided file reader seeker
-// and database.
-func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
+// or block files of Bitcoin Core and database.  Only one of r and coreFiles is
+// used.
+func newBlockImporter(db database.DB, r io.ReadSeeker,
+	coreFiles *coreBlockFiles) (*blockImporter, error) {
+
 	// Create the transaction and address indexes if needed.
 	//
 	// CAUTION: the txindex needs to be first in the indexes array because
@@ -334,6 +431,34 @@ func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
 		indexes = append(indexes, indexers.NewAddrIndex(db, activeNetParams))
 	}
 
+	// Build the utreexo accumulator along with the blocks if any of the
+	// utreexo proof indexes are enabled.
+	var utreexoIndexes []utreexoStateCloser
+	utreexoConfig := &indexers.UtreexoConfig{
+		MaxMemoryUsage: defaultUtreexoMaxMemory * 1024 * 1024,
+		Params:         activeNetParams,
+		DataDir:        cfg.DataDir,
+		FlushMainDB:    db.Flush,
+	}
+	if cfg.UtreexoProofIndex {
+		log.Info("Utreexo proof index is enabled")
+		idx, err := indexers.NewUtreexoProofIndex(db, utreexoConfig)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+		utreexoIndexes = append(utreexoIndexes, idx)
+	}
+	if cfg.FlatUtreexoProofIndex {
+		log.Info("Flat utreexo proof index is enabled")
+		idx, err := indexers.NewFlatUtreexoProofIndex(utreexoConfig)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, idx)
+		utreexoIndexes = append(utreexoIndexes, idx)
+	}
+
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
@@ -351,13 +476,16 @@ func newBlockImporter(db database.DB, r io.ReadSeeker) (*blockImporter, error) {
 	}
 
 	return &blockImporter{
-		db:           db,
-		r:            r,
-		processQueue: make(chan []byte, 2),
-		doneChan:     make(chan bool),
-		errChan:      make(chan error),
-		quit:         make(chan struct{}),
-		chain:        chain,
-		lastLogTime:  time.Now(),
+		db:             db,
+		r:              r,
+		coreFiles:      coreFiles,
+		utreexoIndexes: utreexoIndexes,
+		processQueue:   make(chan []byte, 2),
+		doneChan:       make(chan bool),
+		errChan:        make(chan error),
+		quit:           make(chan struct{}),
+		chain:          chain,
+		lastLogTime:    time.Now(),
+		pending:        make(map[chainhash.Hash][]*btcutil.Block),
 	}, nil
 }
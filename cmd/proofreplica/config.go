@@ -0,0 +1,145 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	flags "github.com/jessevdk/go-flags"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	defaultListen          = "127.0.0.1:8336"
+	defaultRefreshInterval = time.Second * 5
+	defaultMaxMemory       = 250
+)
+
+var (
+	utreexodHomeDir = btcutil.AppDataDir("utreexod", false)
+	defaultDataDir  = filepath.Join(utreexodHomeDir, "data")
+	activeNetParams = &chaincfg.MainNetParams
+)
+
+// config defines the configuration options for proofreplica.
+//
+// See loadConfig for details on the configuration load process.
+type config struct {
+	DataDir         string        `short:"b" long:"datadir" description:"Location of the utreexod data directory"`
+	ReplicaDir      string        `long:"replicadir" description:"The --readreplicadir of the utreexod the snapshots are read from" required:"true"`
+	Listen          string        `long:"listen" description:"Interface/port to serve the proofs on"`
+	RefreshInterval time.Duration `long:"refreshinterval" description:"How often to check for a new snapshot. Valid time units are {s, m, h}"`
+	MaxMemory       int64         `long:"maxmemory" description:"The maximum memory in mebibytes (MiB) used to cache the accumulator"`
+	RegressionTest  bool          `long:"regtest" description:"Use the regression test network"`
+	SigNet          bool          `long:"signet" description:"Use the signet test network"`
+	SimNet          bool          `long:"simnet" description:"Use the simulation test network"`
+	TestNet3        bool          `long:"testnet" description:"Use the test network"`
+	TestNet4        bool          `long:"testnet4" description:"Use the test network (version 4)"`
+}
+
+// netName returns the name used when referring to a bitcoin network.  At the
+// time of writing, utreexod currently places blocks for testnet version 3 in
+// the data and log directory "testnet", which does not match the Name field of
+// the chaincfg parameters.  This function can be used to override this
+// directory name as "testnet" when the passed active network matches
+// wire.TestNet3.
+func netName(chainParams *chaincfg.Params) string {
+	switch chainParams.Net {
+	case wire.TestNet3:
+		return "testnet"
+	default:
+		return chainParams.Name
+	}
+}
+
+// cleanAndExpandPath expands environment variables and leading ~ in the
+// passed path, cleans the result, and returns it.
+func cleanAndExpandPath(path string) string {
+	if len(path) > 0 && path[0] == '~' {
+		path = filepath.Join(utreexodHomeDir, "..", path[1:])
+	}
+	return filepath.Clean(os.ExpandEnv(path))
+}
+
+// loadConfig initializes and parses the config using command line options.
+func loadConfig() (*config, []string, error) {
+	// Default config.
+	cfg := config{
+		DataDir:         defaultDataDir,
+		Listen:          defaultListen,
+		RefreshInterval: defaultRefreshInterval,
+		MaxMemory:       defaultMaxMemory,
+	}
+
+	// Parse command line options.
+	parser := flags.NewParser(&cfg, flags.Default)
+	remainingArgs, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			parser.WriteHelp(os.Stderr)
+		}
+		return nil, nil, err
+	}
+
+	// Multiple networks can't be selected simultaneously.
+	funcName := "loadConfig"
+	numNets := 0
+	if cfg.TestNet3 {
+		numNets++
+		activeNetParams = &chaincfg.TestNet3Params
+	}
+	if cfg.TestNet4 {
+		numNets++
+		activeNetParams = &chaincfg.TestNet4Params
+	}
+	if cfg.RegressionTest {
+		numNets++
+		activeNetParams = &chaincfg.RegressionNetParams
+	}
+	if cfg.SimNet {
+		numNets++
+		activeNetParams = &chaincfg.SimNetParams
+	}
+	if cfg.SigNet {
+		numNets++
+		activeNetParams = &chaincfg.SigNetParams
+	}
+	if numNets > 1 {
+		str := "%s: The testnet, testnet4, regtest, simnet, and signet " +
+			"params can't be used together -- choose one of the five"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	// The data directory is namespaced per network like the one of
+	// utreexod.
+	cfg.DataDir = filepath.Join(cleanAndExpandPath(cfg.DataDir),
+		netName(activeNetParams))
+	cfg.ReplicaDir = cleanAndExpandPath(cfg.ReplicaDir)
+
+	if cfg.RefreshInterval <= 0 {
+		str := "%s: The refresh interval must be positive -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.RefreshInterval)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+	if cfg.MaxMemory <= 0 {
+		str := "%s: The max memory must be positive -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MaxMemory)
+		fmt.Fprintln(os.Stderr, err)
+		parser.WriteHelp(os.Stderr)
+		return nil, nil, err
+	}
+
+	return &cfg, remainingArgs, nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// proofreplica is a read replica of the flat utreexo proof index of a utreexod
+// started with --readreplicadir.  It serves the utreexo proofs and roots over
+// HTTP from the snapshots the node hands off and the flat files of its data
+// directory without locking or writing to either, so that the proof serving
+// load can be spread over several processes and machines sharing the disk.
+//
+// The following endpoints are served:
+//
+//	/tip                     the block, roots and number of leaves of the
+//	                         snapshot in use
+//	/roots/<height>          the roots and number of leaves after the block
+//	/utreexoproof/<height>   the hex encoded serialized utreexo proof of the
+//	                         block
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain/indexers"
+)
+
+// rootsReply is the reply of the /tip and /roots endpoints.
+type rootsReply struct {
+	Hash      string   `json:"hash,omitempty"`
+	Height    int32    `json:"height"`
+	NumLeaves uint64   `json:"numleaves"`
+	Roots     []string `json:"roots"`
+}
+
+// proofReply is the reply of the /utreexoproof endpoint.
+type proofReply struct {
+	Height int32  `json:"height"`
+	Proof  string `json:"proof"`
+}
+
+// newRootsReply returns the reply of the roots of the stump.
+func newRootsReply(height int32, stump utreexo.Stump) *rootsReply {
+	roots := make([]string, 0, len(stump.Roots))
+	for _, root := range stump.Roots {
+		roots = append(roots, hex.EncodeToString(root[:]))
+	}
+	return &rootsReply{Height: height, NumLeaves: stump.NumLeaves, Roots: roots}
+}
+
+// parseHeight parses the height at the end of the request path and checks
+// that the snapshot reaches it.  The flat files may already have the data of
+// newer blocks, which aren't served until a snapshot is at them.
+func parseHeight(path, prefix string, tipHeight int32) (int32, int, error) {
+	height, err := strconv.ParseInt(strings.TrimPrefix(path, prefix), 10, 32)
+	if err != nil || height < 0 {
+		return 0, http.StatusBadRequest, fmt.Errorf("invalid height: %s",
+			strings.TrimPrefix(path, prefix))
+	}
+	if int32(height) > tipHeight {
+		return 0, http.StatusNotFound, fmt.Errorf("height %d is past "+
+			"the tip at %d", height, tipHeight)
+	}
+
+	return int32(height), http.StatusOK, nil
+}
+
+// writeJSON writes the reply as json.
+func writeJSON(w http.ResponseWriter, reply interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(reply)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write the reply: %v\n", err)
+	}
+}
+
+// newHandler returns the handler of the endpoints served from the replica.
+func newHandler(replica *indexers.Replica) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tip", func(w http.ResponseWriter, r *http.Request) {
+		var reply *rootsReply
+		replica.View(func(state *indexers.ReadOnlyUtreexoState, height int32) error {
+			reply = newRootsReply(height, state.Stump())
+			reply.Hash = state.BestHash().String()
+			return nil
+		})
+		writeJSON(w, reply)
+	})
+	mux.HandleFunc("/roots/", func(w http.ResponseWriter, r *http.Request) {
+		var reply *rootsReply
+		code := http.StatusOK
+		err := replica.View(func(state *indexers.ReadOnlyUtreexoState, tipHeight int32) error {
+			var height int32
+			var err error
+			height, code, err = parseHeight(r.URL.Path, "/roots/", tipHeight)
+			if err != nil {
+				return err
+			}
+			stump, err := state.FetchRoots(height)
+			if err != nil {
+				code = http.StatusNotFound
+				return err
+			}
+			reply = newRootsReply(height, stump)
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		writeJSON(w, reply)
+	})
+	mux.HandleFunc("/utreexoproof/", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		var height int32
+		code := http.StatusOK
+		err := replica.View(func(state *indexers.ReadOnlyUtreexoState, tipHeight int32) error {
+			var err error
+			height, code, err = parseHeight(r.URL.Path, "/utreexoproof/",
+				tipHeight)
+			if err != nil {
+				return err
+			}
+			udata, err := state.FetchUtreexoProof(height)
+			if err != nil {
+				code = http.StatusNotFound
+				return err
+			}
+			return udata.Serialize(&buf)
+		})
+		if err != nil {
+			if code == http.StatusOK {
+				code = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		writeJSON(w, &proofReply{
+			Height: height,
+			Proof:  hex.EncodeToString(buf.Bytes()),
+		})
+	})
+
+	return mux
+}
+
+// refreshHandler switches the replica to the latest snapshot every interval
+// until ctx is done.
+func refreshHandler(ctx context.Context, replica *indexers.Replica,
+	interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			switched, err := replica.Refresh()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to switch to the "+
+					"latest snapshot: %v\n", err)
+				continue
+			}
+			if switched {
+				replica.View(func(state *indexers.ReadOnlyUtreexoState, height int32) error {
+					fmt.Printf("Switched to the snapshot at block "+
+						"%v (height %d)\n", state.BestHash(), height)
+					return nil
+				})
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func realMain() error {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	replica, err := indexers.OpenReplica(&indexers.UtreexoConfig{
+		MaxMemoryUsage: cfg.MaxMemory * 1024 * 1024,
+		Params:         activeNetParams,
+		DataDir:        cfg.DataDir,
+	}, cfg.ReplicaDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open the replica:", err)
+		return err
+	}
+	defer replica.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	go refreshHandler(ctx, replica, cfg.RefreshInterval)
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           newHandler(replica),
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Printf("Serving the utreexo proofs of %s on %s\n", cfg.DataDir,
+		cfg.Listen)
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "failed to serve the proofs:", err)
+		return err
+	}
+
+	return nil
+}
+
+func main() {
+	if err := realMain(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -37,6 +37,13 @@ var (
 	defaultRPCServer      = "localhost"
 	defaultRPCCertFile    = filepath.Join(utreexodHomeDir, "rpc.cert")
 	defaultWalletCertFile = filepath.Join(utreexowalletHomeDir, "rpc.cert")
+	defaultFormat         = formatJSON
+)
+
+const (
+	// formatJSON and formatTable are the values of --format.
+	formatJSON  = "json"
+	formatTable = "table"
 )
 
 // listCommands categorizes and lists all of the usable commands along with
@@ -90,6 +97,15 @@ func listCommands() {
 		}
 		fmt.Println()
 	}
+
+	fmt.Println("Utreexo Commands:")
+	fmt.Println(utreexoProofUsage)
+	fmt.Println(utreexoRootsUsage)
+	fmt.Println(verifyUtreexoStateUsage)
+	fmt.Println()
+
+	fmt.Println("Local Commands:")
+	fmt.Println(decodeProofUsage)
 }
 
 // config defines the configuration options for utreexoctl.
@@ -98,7 +114,9 @@ func listCommands() {
 type config struct {
 	ConfigFile     string `short:"C" long:"configfile" description:"Path to configuration file"`
 	DataDir        string `long:"datadir" description:"Path to the utreexod datadir"`
+	Format         string `long:"format" description:"Format to display the results in: json or table"`
 	ListCommands   bool   `short:"l" long:"listcommands" description:"List all of the supported commands and exit"`
+	Named          bool   `long:"named" description:"Pass the parameters of the command by name as name=value pairs"`
 	NoTLS          bool   `long:"notls" description:"Disable TLS"`
 	Proxy          string `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
 	ProxyPass      string `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
@@ -108,9 +126,12 @@ type config struct {
 	RPCPassword    string `short:"P" long:"rpcpass" default-mask:"-" description:"RPC password"`
 	RPCServer      string `short:"s" long:"rpcserver" description:"RPC server to connect to"`
 	RPCUser        string `short:"u" long:"rpcuser" description:"RPC username"`
+	RPCWait        bool   `long:"rpcwait" description:"Wait for the RPC server to start accepting connections"`
+	RPCWaitTimeout int    `long:"rpcwaittimeout" description:"Seconds to wait for the RPC server with --rpcwait (0 to wait forever)"`
 	SimNet         bool   `long:"simnet" description:"Connect to the simulation test network"`
 	TLSSkipVerify  bool   `long:"skipverify" description:"Do not verify tls certificates (not recommended!)"`
 	TestNet3       bool   `long:"testnet" description:"Connect to testnet"`
+	TestNet4       bool   `long:"testnet4" description:"Connect to testnet4"`
 	SigNet         bool   `long:"signet" description:"Connect to signet"`
 	ShowVersion    bool   `short:"V" long:"version" description:"Display version information and exit"`
 	Wallet         bool   `long:"wallet" description:"Connect to wallet"`
@@ -129,6 +150,12 @@ func normalizeAddress(addr string, chain *chaincfg.Params, useWallet bool) (stri
 			} else {
 				defaultPort = "18334"
 			}
+		case &chaincfg.TestNet4Params:
+			if useWallet {
+				defaultPort = "48332"
+			} else {
+				defaultPort = "48334"
+			}
 		case &chaincfg.SimNetParams:
 			if useWallet {
 				defaultPort = "18554"
@@ -192,6 +219,7 @@ func loadConfig() (*config, []string, error) {
 	// Default config.
 	cfg := config{
 		ConfigFile: defaultConfigFile,
+		Format:     defaultFormat,
 		RPCServer:  defaultRPCServer,
 		RPCCert:    defaultRPCCertFile,
 	}
@@ -276,6 +304,10 @@ func loadConfig() (*config, []string, error) {
 		numNets++
 		network = &chaincfg.TestNet3Params
 	}
+	if cfg.TestNet4 {
+		numNets++
+		network = &chaincfg.TestNet4Params
+	}
 	if cfg.SimNet {
 		numNets++
 		network = &chaincfg.SimNetParams
@@ -297,6 +329,24 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the format of the results.
+	if cfg.Format != formatJSON && cfg.Format != formatTable {
+		str := "%s: The format must be %s or %s -- got %q"
+		err := fmt.Errorf(str, "loadConfig", formatJSON, formatTable,
+			cfg.Format)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.RPCWaitTimeout < 0 {
+		str := "%s: The rpcwaittimeout option may not be negative -- " +
+			"got %d"
+		err := fmt.Errorf(str, "loadConfig", cfg.RPCWaitTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	if cfg.DataDir == "" {
 		name := network.Name
 		if network.Name == "testnet3" {
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/utreexo/utreexod/blockchain/indexers"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// decodeProofCmd is the name of the subcommand that decodes a utreexo proof
+// or undo block locally without connecting to the server.
+const decodeProofCmd = "decode-proof"
+
+// decodeProofUsage is the usage text of the decode-proof subcommand.
+const decodeProofUsage = decodeProofCmd + " [proof|undo] <hex|file|->"
+
+// readDecodeProofInput returns the bytes of the given argument.  The argument
+// is read from stdin when it's '-' and from the file it names when it exists.
+// The read data, or the argument itself, is decoded as hex when it's valid hex
+// and used as raw bytes otherwise.
+func readDecodeProofInput(arg string) ([]byte, error) {
+	var data []byte
+	switch {
+	case arg == "-":
+		var err error
+		data, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read data from stdin: %v", err)
+		}
+
+	default:
+		var err error
+		data, err = os.ReadFile(arg)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			data = []byte(arg)
+		}
+	}
+
+	hexStr := strings.TrimSpace(string(data))
+	decoded, err := hex.DecodeString(hexStr)
+	if err == nil {
+		return decoded, nil
+	}
+
+	// Data that's passed on the command line must be hex.
+	if arg != "-" && string(data) == arg {
+		return nil, fmt.Errorf("'%s' is neither a file nor valid hex: %v",
+			arg, err)
+	}
+
+	return data, nil
+}
+
+// printProof prints a human-readable breakdown of the serialized utreexo proof
+// as returned by getutreexoproof.
+func printProof(serialized []byte) error {
+	var ud wire.UData
+	r := bytes.NewReader(serialized)
+	err := ud.Deserialize(r)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize the proof: %v", err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after the proof", r.Len())
+	}
+
+	fmt.Printf("Size: %d bytes\n\n", len(serialized))
+
+	fmt.Printf("Targets (%d):\n", len(ud.AccProof.Targets))
+	for i, target := range ud.AccProof.Targets {
+		fmt.Printf("  %d: %d\n", i, target)
+	}
+	fmt.Println()
+
+	fmt.Printf("Proof hashes (%d):\n", len(ud.AccProof.Proof))
+	for i, hash := range ud.AccProof.Proof {
+		fmt.Printf("  %d: %x\n", i, hash)
+	}
+	fmt.Println()
+
+	fmt.Printf("Leaf datas (%d):\n", len(ud.LeafDatas))
+	for i, ld := range ud.LeafDatas {
+		fmt.Printf("  %d:\n", i)
+		if ld.IsUnconfirmed() {
+			fmt.Println("    Unconfirmed: true")
+			continue
+		}
+		if !ld.IsCompact() {
+			fmt.Printf("    BlockHash: %s\n", ld.BlockHash)
+			fmt.Printf("    OutPoint: %s\n", ld.OutPoint)
+			fmt.Printf("    LeafHash: %x\n", ld.LeafHash())
+		}
+		fmt.Printf("    Height: %d\n", ld.Height)
+		fmt.Printf("    IsCoinBase: %v\n", ld.IsCoinBase)
+		fmt.Printf("    Amount: %d\n", ld.Amount)
+		fmt.Printf("    PkScript: %x\n", ld.PkScript)
+	}
+
+	return nil
+}
+
+// printUndoBlock prints a human-readable breakdown of the serialized undo block
+// as stored by the utreexo proof indexes.
+func printUndoBlock(serialized []byte) error {
+	numAdds, targets, delHashes, err := indexers.DeserializeUndoBlock(serialized)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize the undo block: %v", err)
+	}
+
+	fmt.Printf("Size: %d bytes\n\n", len(serialized))
+	fmt.Printf("Number of adds: %d\n\n", numAdds)
+
+	fmt.Printf("Targets (%d):\n", len(targets))
+	for i, target := range targets {
+		fmt.Printf("  %d: %d\n", i, target)
+	}
+	fmt.Println()
+
+	fmt.Printf("Deleted hashes (%d):\n", len(delHashes))
+	for i, hash := range delHashes {
+		fmt.Printf("  %d: %x\n", i, hash)
+	}
+
+	return nil
+}
+
+// decodeProof decodes the proof or undo block given in the arguments of the
+// decode-proof subcommand and prints it.
+func decodeProof(args []string) error {
+	kind := "proof"
+	if len(args) == 2 {
+		kind, args = args[0], args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	serialized, err := readDecodeProofInput(args[0])
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "proof":
+		return printProof(serialized)
+	case "undo":
+		return printUndoBlock(serialized)
+	default:
+		return fmt.Errorf("unknown type '%s', expected proof or undo", kind)
+	}
+}
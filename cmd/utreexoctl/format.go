@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// objectFields returns the fields of the JSON object in the order they appear
+// in it.
+func objectFields(obj json.RawMessage) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected object key %v", tok)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	return keys, values, nil
+}
+
+// tableCell returns how the JSON value is shown in a cell of a table.  Strings
+// are shown without their quotes and everything else as compact JSON.
+func tableCell(value json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str
+	}
+
+	var dst bytes.Buffer
+	if err := json.Compact(&dst, value); err != nil {
+		return string(value)
+	}
+	return dst.String()
+}
+
+// writeTable writes the JSON result as a table.  An object is shown with a row
+// for each of its fields and an array of objects with a row for each object
+// and a column for each field.  Any other array is shown with an element on
+// each line.
+func writeTable(w io.Writer, result json.RawMessage) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	switch {
+	case bytes.HasPrefix(result, []byte("{")):
+		keys, values, err := objectFields(result)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", key, tableCell(values[key]))
+		}
+
+	case bytes.HasPrefix(result, []byte("[")):
+		var elems []json.RawMessage
+		if err := json.Unmarshal(result, &elems); err != nil {
+			return err
+		}
+		if len(elems) == 0 {
+			break
+		}
+
+		// The columns are the fields of all the objects in the order
+		// they're first seen.
+		var columns []string
+		seen := make(map[string]struct{})
+		rows := make([]map[string]json.RawMessage, 0, len(elems))
+		for _, elem := range elems {
+			if !bytes.HasPrefix(bytes.TrimSpace(elem), []byte("{")) {
+				rows = nil
+				break
+			}
+			keys, values, err := objectFields(elem)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					columns = append(columns, key)
+				}
+			}
+			rows = append(rows, values)
+		}
+
+		// Not every element is an object so each one is shown on a line
+		// of its own.
+		if rows == nil {
+			for _, elem := range elems {
+				fmt.Fprintln(tw, tableCell(elem))
+			}
+			break
+		}
+
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, row := range rows {
+			cells := make([]string, 0, len(columns))
+			for _, column := range columns {
+				cell := "-"
+				if value, ok := row[column]; ok {
+					cell = tableCell(value)
+				}
+				cells = append(cells, cell)
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+
+	default:
+		fmt.Fprintln(tw, tableCell(result))
+	}
+
+	return tw.Flush()
+}
+
+// printResult prints the result returned by the server in the given format.
+func printResult(result []byte, format string) error {
+	strResult := string(result)
+	isComposite := strings.HasPrefix(strResult, "{") ||
+		strings.HasPrefix(strResult, "[")
+
+	switch {
+	case isComposite && format == formatTable:
+		return writeTable(os.Stdout, result)
+
+	case isComposite:
+		var dst bytes.Buffer
+		if err := json.Indent(&dst, result, "", "  "); err != nil {
+			return fmt.Errorf("failed to format result: %v", err)
+		}
+		fmt.Println(dst.String())
+
+	case strings.HasPrefix(strResult, `"`):
+		var str string
+		if err := json.Unmarshal(result, &str); err != nil {
+			return fmt.Errorf("failed to unmarshal result: %v", err)
+		}
+		fmt.Println(str)
+
+	case strResult != "null":
+		fmt.Println(strResult)
+	}
+
+	return nil
+}
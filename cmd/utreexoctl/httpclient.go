@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/go-socks/socks"
@@ -70,7 +72,7 @@ func newHTTPClient(cfg *config) (*http.Client, error) {
 func readCookieFile(path string) (username, password string, err error) {
 	f, err := os.Open(path)
 	if err != nil {
-		retErr := fmt.Errorf("%v. Cookiefile only exists if the node is running", err)
+		retErr := fmt.Errorf("%w. Cookiefile only exists if the node is running", err)
 		err = retErr
 		return
 	}
@@ -94,6 +96,44 @@ func readCookieFile(path string) (username, password string, err error) {
 	return
 }
 
+// rpcWaitInterval is how long to wait between the attempts to connect to the
+// server with --rpcwait.
+const rpcWaitInterval = time.Second
+
+// isConnectError returns whether the error is from failing to connect to the
+// server, either since nothing is listening yet or since the node hasn't
+// written the cookie file yet.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// sendPostRequestWait sends the marshalled JSON-RPC command like
+// sendPostRequest does.  When --rpcwait is set, the command is sent again until
+// the server accepts the connection or --rpcwaittimeout passes.
+func sendPostRequestWait(marshalledJSON []byte, cfg *config) ([]byte, error) {
+	var deadline time.Time
+	if cfg.RPCWaitTimeout > 0 {
+		deadline = time.Now().Add(
+			time.Duration(cfg.RPCWaitTimeout) * time.Second)
+	}
+
+	for {
+		result, err := sendPostRequest(marshalledJSON, cfg)
+		if err == nil || !cfg.RPCWait || !isConnectError(err) {
+			return result, err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the RPC "+
+				"server: %v", err)
+		}
+		time.Sleep(rpcWaitInterval)
+	}
+}
+
 // sendPostRequest sends the marshalled JSON-RPC command using HTTP-POST mode
 // to the server described in the passed config struct.  It also attempts to
 // unmarshal the response as a JSON-RPC response and returns either the result
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// utreexoProofCmd is the name of the subcommand that fetches the
+	// utreexo proof of a block given by either its hash or height.
+	utreexoProofCmd   = "utreexo-proof"
+	utreexoProofUsage = utreexoProofCmd + " <blockhash|height> (verbosity=0)"
+
+	// utreexoRootsCmd is the name of the subcommand that fetches the
+	// utreexo roots at a block given by either its hash or height.
+	utreexoRootsCmd   = "utreexo-roots"
+	utreexoRootsUsage = utreexoRootsCmd + " (<blockhash|height>)"
+
+	// verifyUtreexoStateCmd is the name of the subcommand that checks the
+	// accumulator of the node against the roots stored by its index and
+	// the roots replayed from the root snapshots.
+	verifyUtreexoStateCmd   = "verify-utreexo-state"
+	verifyUtreexoStateUsage = verifyUtreexoStateCmd
+)
+
+// errInconsistentUtreexoState is returned along with the result of the
+// verify-utreexo-state subcommand when the utreexo state isn't consistent so
+// that the result is still displayed.
+var errInconsistentUtreexoState = errors.New("the utreexo state is not consistent")
+
+// utreexoCmds are the utreexo subcommands keyed by their names.  Each one
+// returns its result as JSON so that it's displayed like the results of the
+// commands sent to the server are.
+var utreexoCmds = map[string]struct {
+	usage string
+	run   func(cfg *config, args []string) ([]byte, error)
+}{
+	utreexoProofCmd:       {utreexoProofUsage, utreexoProof},
+	utreexoRootsCmd:       {utreexoRootsUsage, utreexoRoots},
+	verifyUtreexoStateCmd: {verifyUtreexoStateUsage, verifyUtreexoState},
+}
+
+// sendCmd creates the command for the method with the given parameters, sends
+// it to the server and returns the result.
+func sendCmd(cfg *config, method string, params ...interface{}) ([]byte, error) {
+	cmd, err := btcjson.NewCmd(method, params...)
+	if err != nil {
+		return nil, err
+	}
+	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, 1, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return sendPostRequestWait(marshalledJSON, cfg)
+}
+
+// resolveBlockHash returns the hash of the block the argument refers to.  The
+// argument is taken as a height unless it's a block hash.
+func resolveBlockHash(cfg *config, arg string) (string, error) {
+	if len(arg) == chainhash.MaxHashStringSize {
+		return arg, nil
+	}
+	height, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is neither a block hash nor a "+
+			"height", arg)
+	}
+
+	result, err := sendCmd(cfg, "getblockhash", height)
+	if err != nil {
+		return "", err
+	}
+	var hash string
+	if err := json.Unmarshal(result, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// utreexoProof fetches the utreexo proof of the block given by either its hash
+// or height.
+func utreexoProof(cfg *config, args []string) ([]byte, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("wrong number of arguments")
+	}
+	hash, err := resolveBlockHash(cfg, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	params := []interface{}{hash}
+	if len(args) == 2 {
+		params = append(params, args[1])
+	}
+	return sendCmd(cfg, "getutreexoproof", params...)
+}
+
+// utreexoRoots fetches the utreexo roots at the block given by either its hash
+// or height, or at the tip when no block is given.
+func utreexoRoots(cfg *config, args []string) ([]byte, error) {
+	switch len(args) {
+	case 0:
+		return sendCmd(cfg, "getutreexoroots")
+	case 1:
+		hash, err := resolveBlockHash(cfg, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return sendCmd(cfg, "getutreexoroots", hash)
+	}
+	return nil, fmt.Errorf("wrong number of arguments")
+}
+
+// verifyUtreexoStateResult is the result of the verify-utreexo-state
+// subcommand.
+type verifyUtreexoStateResult struct {
+	Height          int32  `json:"height"`
+	BlockHash       string `json:"blockhash"`
+	NumLeaves       uint64 `json:"numleaves"`
+	IndexRoots      bool   `json:"indexroots"`
+	HistoricalRoots string `json:"historicalroots"`
+	Consistent      bool   `json:"consistent"`
+}
+
+// rootsEqual returns whether both sets of roots are the same.
+func rootsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyUtreexoState checks that the roots of the accumulator of the node match
+// the roots its index stored for the tip and, when root snapshots are kept, the
+// roots replayed from the last snapshot.
+func verifyUtreexoState(cfg *config, args []string) ([]byte, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("wrong number of arguments")
+	}
+
+	result, err := sendCmd(cfg, "getutreexoinfo")
+	if err != nil {
+		return nil, err
+	}
+	var info btcjson.GetUtreexoInfoResult
+	if err := json.Unmarshal(result, &info); err != nil {
+		return nil, err
+	}
+
+	result, err = sendCmd(cfg, "getutreexoroots", info.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	var roots btcjson.GetUtreexoRootsResult
+	if err := json.Unmarshal(result, &roots); err != nil {
+		return nil, err
+	}
+
+	verified := verifyUtreexoStateResult{
+		Height:    info.Height,
+		BlockHash: info.BlockHash,
+		NumLeaves: info.NumLeaves,
+		IndexRoots: roots.NumLeaves == info.NumLeaves &&
+			rootsEqual(roots.Roots, info.Roots),
+	}
+	verified.Consistent = verified.IndexRoots
+
+	// The roots can only be replayed when the node keeps root snapshots
+	// so it's not an inconsistency when they aren't.
+	result, err = sendCmd(cfg, "gethistoricalroots", info.Height)
+	if err != nil {
+		verified.HistoricalRoots = fmt.Sprintf("unavailable: %v", err)
+	} else {
+		var historical btcjson.GetHistoricalRootsResult
+		if err := json.Unmarshal(result, &historical); err != nil {
+			return nil, err
+		}
+		if historical.BlockHash == info.BlockHash &&
+			historical.NumLeaves == info.NumLeaves &&
+			rootsEqual(historical.Roots, info.Roots) {
+
+			verified.HistoricalRoots = "match"
+		} else {
+			verified.HistoricalRoots = "mismatch"
+			verified.Consistent = false
+		}
+	}
+
+	result, err = json.Marshal(verified)
+	if err != nil {
+		return nil, err
+	}
+	if !verified.Consistent {
+		return result, errInconsistentUtreexoState
+	}
+	return result, nil
+}
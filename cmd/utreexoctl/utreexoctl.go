@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -46,6 +45,96 @@ func usage(errorMessage string) {
 	fmt.Fprintln(os.Stderr, listCmdMessage)
 }
 
+// readParam returns the parameter as it's given on the command line or the next
+// line from stdin when it's '-'.
+func readParam(bio *bufio.Reader, arg string) (string, error) {
+	if arg != "-" {
+		return arg, nil
+	}
+
+	param, err := bio.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("Failed to read data from stdin: %v", err)
+	}
+	if err == io.EOF && len(param) == 0 {
+		return "", fmt.Errorf("Not enough lines provided on stdin")
+	}
+	return strings.TrimRight(param, "\r\n"), nil
+}
+
+// namedParams returns the name=value pairs given for the method in the order
+// the parameters are passed to it.  The optional parameters that are left out
+// ahead of a given one are passed with their default values.
+func namedParams(method string, args []string, bio *bufio.Reader) ([]interface{}, error) {
+	methodParams, err := btcjson.MethodParams(method)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(args))
+	last := -1
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' is not of the form "+
+				"name=value", arg)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("parameter '%s' is given more "+
+				"than once", name)
+		}
+
+		idx := -1
+		for i, param := range methodParams {
+			if param.Name == name {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return nil, fmt.Errorf("unknown parameter '%s'", name)
+		}
+		if idx > last {
+			last = idx
+		}
+
+		value, err = readParam(bio, value)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+
+	params := make([]interface{}, 0, last+1)
+	for _, param := range methodParams[:last+1] {
+		if value, ok := values[param.Name]; ok {
+			params = append(params, value)
+			continue
+		}
+
+		// Required parameters are left for NewCmd to complain about.
+		if !param.Optional {
+			break
+		}
+		if param.Default == nil {
+			return nil, fmt.Errorf("parameter '%s' has no default "+
+				"and must be given along with the ones after it",
+				param.Name)
+		}
+		if str, ok := param.Default.(string); ok {
+			params = append(params, str)
+			continue
+		}
+		def, err := json.Marshal(param.Default)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, string(def))
+	}
+
+	return params, nil
+}
+
 func main() {
 	cfg, args, err := loadConfig()
 	if err != nil {
@@ -56,9 +145,42 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The decode-proof subcommand is handled locally and doesn't need a
+	// connection to the server.
+	method := args[0]
+	if method == decodeProofCmd {
+		if err := decodeProof(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s command: %v\n", method, err)
+			fmt.Fprintln(os.Stderr, "Usage:")
+			fmt.Fprintf(os.Stderr, "  %s\n", decodeProofUsage)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The utreexo subcommands are built from the commands sent to the
+	// server.
+	if utreexoCmd, ok := utreexoCmds[method]; ok {
+		result, err := utreexoCmd.run(cfg, args[1:])
+		if result != nil {
+			if err := printResult(result, cfg.Format); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s command: %v\n", method, err)
+			if result == nil {
+				fmt.Fprintln(os.Stderr, "Usage:")
+				fmt.Fprintf(os.Stderr, "  %s\n", utreexoCmd.usage)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Ensure the specified method identifies a valid registered command and
 	// is one of the usable types.
-	method := args[0]
 	usageFlags, err := btcjson.MethodUsageFlags(method)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unrecognized command '%s'\n", method)
@@ -79,27 +201,27 @@ func main() {
 	// too large for the Operating System to allow as a normal command line
 	// parameter, support using '-' as an argument to allow the argument
 	// to be read from a stdin pipe.
+	//
+	// With --named, the parameters are given as name=value pairs in any
+	// order instead.
 	bio := bufio.NewReader(os.Stdin)
 	params := make([]interface{}, 0, len(args[1:]))
-	for _, arg := range args[1:] {
-		if arg == "-" {
-			param, err := bio.ReadString('\n')
-			if err != nil && err != io.EOF {
-				fmt.Fprintf(os.Stderr, "Failed to read data "+
-					"from stdin: %v\n", err)
-				os.Exit(1)
-			}
-			if err == io.EOF && len(param) == 0 {
-				fmt.Fprintln(os.Stderr, "Not enough lines "+
-					"provided on stdin")
+	if cfg.Named {
+		params, err = namedParams(method, args[1:], bio)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s command: %v\n", method, err)
+			commandUsage(method)
+			os.Exit(1)
+		}
+	} else {
+		for _, arg := range args[1:] {
+			param, err := readParam(bio, arg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
-			param = strings.TrimRight(param, "\r\n")
 			params = append(params, param)
-			continue
 		}
-
-		params = append(params, arg)
 	}
 
 	// Attempt to create the appropriate command using the arguments
@@ -135,33 +257,16 @@ func main() {
 
 	// Send the JSON-RPC request to the server using the user-specified
 	// connection configuration.
-	result, err := sendPostRequest(marshalledJSON, cfg)
+	result, err := sendPostRequestWait(marshalledJSON, cfg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	// Choose how to display the result based on its type.
-	strResult := string(result)
-	if strings.HasPrefix(strResult, "{") || strings.HasPrefix(strResult, "[") {
-		var dst bytes.Buffer
-		if err := json.Indent(&dst, result, "", "  "); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to format result: %v",
-				err)
-			os.Exit(1)
-		}
-		fmt.Println(dst.String())
-
-	} else if strings.HasPrefix(strResult, `"`) {
-		var str string
-		if err := json.Unmarshal(result, &str); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to unmarshal result: %v",
-				err)
-			os.Exit(1)
-		}
-		fmt.Println(str)
-
-	} else if strResult != "null" {
-		fmt.Println(strResult)
+	// Choose how to display the result based on its type and the
+	// requested format.
+	if err := printResult(result, cfg.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// maxBlockTxnDepth is how far below the tip a block may be for the missing
+// transactions of its compact block to still be served.  Compact blocks are
+// only sent for new blocks so older requests aren't answered.
+const maxBlockTxnDepth = 10
+
+// canServeCmpctBlocks returns whether the server keeps the utreexo proofs of
+// the blocks needed to send them along with compact blocks.
+func (s *server) canServeCmpctBlocks() bool {
+	return s.utreexoProofIndex != nil || s.flatUtreexoProofIndex != nil
+}
+
+// wantsCmpctBlocks returns whether the peer asked for new blocks to be
+// announced with compact blocks carrying their utreexo proofs.
+func (sp *serverPeer) wantsCmpctBlocks() bool {
+	return atomic.LoadInt32(&sp.cmpctBlocks) != 0
+}
+
+// pushCmpctBlock sends the compact block of the block with the given hash along
+// with its utreexo proof to the peer.  The block is announced with its header
+// instead when the proof can't be fetched.
+func (s *server) pushCmpctBlock(sp *serverPeer, hash *chainhash.Hash,
+	header *wire.BlockHeader) {
+
+	block, err := s.chain.BlockByHash(hash)
+	if err == nil {
+		var ud *wire.UData
+		ud, err = s.fetchUData(hash)
+		if err == nil {
+			msgBlock := *block.MsgBlock()
+			msgBlock.UData = ud
+			var nonce uint64
+			nonce, err = wire.RandomUint64()
+			if err == nil {
+				sp.QueueMessage(wire.NewMsgCmpctBlock(&msgBlock, nonce), nil)
+				sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeBlock, hash))
+				return
+			}
+		}
+	}
+
+	peerLog.Debugf("Unable to send compact block %v to %v: %v -- "+
+		"announcing its header instead", hash, sp, err)
+	msgHeaders := wire.NewMsgHeaders()
+	if err := msgHeaders.AddBlockHeader(header); err != nil {
+		peerLog.Errorf("Failed to add block header: %v", err)
+		return
+	}
+	sp.QueueMessage(msgHeaders, nil)
+}
+
+// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin message.  New
+// blocks are announced to the peer with compact blocks from then on if it asks
+// for the utreexo version of them and the server keeps the utreexo proofs to
+// send along.  Other versions are ignored.
+func (sp *serverPeer) OnSendCmpct(_ *peer.Peer, msg *wire.MsgSendCmpct) {
+	if msg.Version != wire.CmpctBlockVersionUtreexo ||
+		!sp.server.canServeCmpctBlocks() {
+
+		peerLog.Debugf("Ignoring sendcmpct version %x from %v",
+			msg.Version, sp)
+		return
+	}
+
+	var announce int32
+	if msg.Announce {
+		announce = 1
+	}
+	atomic.StoreInt32(&sp.cmpctBlocks, announce)
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// The message is passed down to the sync manager to put the block together.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	blockHash := msg.Header.BlockHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+	sp.server.syncManager.QueueCmpctBlock(msg, sp.Peer)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message.
+// It's sent by peers that got a compact block and are missing some of the
+// transactions of it.  The peer is disconnected if it asks for transactions the
+// block doesn't have.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	chain := sp.server.chain
+	height, err := chain.BlockHeightByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to serve the transactions of block %v "+
+			"to %v: %v", msg.BlockHash, sp, err)
+		return
+	}
+	if chain.BestSnapshot().Height-height >= maxBlockTxnDepth {
+		peerLog.Debugf("Not serving the transactions of block %v at "+
+			"height %d to %v as it's too deep", msg.BlockHash,
+			height, sp)
+		return
+	}
+
+	block, err := chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to serve the transactions of block %v "+
+			"to %v: %v", msg.BlockHash, sp, err)
+		return
+	}
+
+	txs := block.MsgBlock().Transactions
+	reply := wire.NewMsgBlockTxn(&msg.BlockHash,
+		make([]*wire.MsgTx, 0, len(msg.Indexes)))
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txs) {
+			peerLog.Infof("Peer %v asked for transaction %d of block "+
+				"%v with %d transactions -- disconnecting", sp,
+				index, msg.BlockHash, len(txs))
+			sp.Disconnect()
+			return
+		}
+		reply.Txs = append(reply.Txs, txs[index])
+	}
+
+	sp.QueueMessage(reply, nil)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  The
+// message is passed down to the sync manager to finish putting together the
+// block the transactions were asked for.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	sp.server.syncManager.QueueBlockTxn(msg, sp.Peer)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain/indexers"
+)
+
+// compactionCheckInterval is how often it's checked whether a compaction window
+// has started.
+const compactionCheckInterval = time.Minute
+
+// compactionHandler runs the heavy compactions of the utreexo proof indexes
+// once at the start of every compaction window from the config.  The proofs
+// held back outside of the windows are dropped then and the utreexo state
+// databases are compacted so that the I/O doesn't collide with serving proofs
+// during the busy hours.
+//
+// It must be run as a goroutine.
+func (s *server) compactionHandler() {
+	ticker := time.NewTicker(compactionCheckInterval)
+	defer ticker.Stop()
+
+	// The compactions are run once per window.  Starting up in the middle
+	// of a window counts as its start.
+	var ran bool
+	for {
+		if !indexers.InCompactionWindow(cfg.compactWindows, time.Now()) {
+			ran = false
+		} else if !ran {
+			ran = true
+			s.runCompactions()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			s.wg.Done()
+			return
+		}
+	}
+}
+
+// runCompactions runs the heavy compactions of the enabled utreexo proof
+// indexes.
+func (s *server) runCompactions() {
+	start := time.Now()
+	if s.utreexoProofIndex != nil {
+		err := s.utreexoProofIndex.RunCompactions(s.quit)
+		if err != nil {
+			srvrLog.Errorf("Unable to compact the utreexo proof index: %v",
+				err)
+		}
+	}
+	if s.flatUtreexoProofIndex != nil {
+		err := s.flatUtreexoProofIndex.RunCompactions(s.quit)
+		if err != nil {
+			srvrLog.Errorf("Unable to compact the flat utreexo proof "+
+				"index: %v", err)
+		}
+	}
+	srvrLog.Infof("Finished the compactions of the compaction window in %v",
+		time.Since(start).Round(time.Second))
+}
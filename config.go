@@ -22,53 +22,82 @@ import (
 	"github.com/btcsuite/go-socks/socks"
 	flags "github.com/jessevdk/go-flags"
 	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/blockchain/indexers"
 	"github.com/utreexo/utreexod/btcutil"
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/connmgr"
+	"github.com/utreexo/utreexod/corebridge"
 	"github.com/utreexo/utreexod/database"
 	_ "github.com/utreexo/utreexod/database/ffldb"
 	"github.com/utreexo/utreexod/mempool"
 	"github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
 )
 
 const (
-	defaultConfigFilename        = "utreexod.conf"
-	defaultDataDirname           = "data"
-	defaultLogLevel              = "info"
-	defaultLogDirname            = "logs"
-	defaultLogFilename           = "utreexod.log"
-	defaultMaxPeers              = 125
-	defaultBanDuration           = time.Hour * 24
-	defaultBanThreshold          = 300
-	defaultConnectTimeout        = time.Second * 30
-	defaultMaxRPCClients         = 10
-	defaultMaxRPCWebsockets      = 25
-	defaultMaxRPCConcurrentReqs  = 20
-	defaultDbType                = "ffldb"
-	defaultElectrumServerPort    = "50001"
-	defaultTLSElectrumServerPort = "50002"
-	defaultFreeTxRelayLimit      = 15.0
-	defaultTrickleInterval       = peer.DefaultTrickleInterval
-	defaultBlockMinSize          = 0
-	defaultBlockMaxSize          = 750000
-	defaultBlockMinWeight        = 0
-	defaultBlockMaxWeight        = 3000000
-	blockMaxSizeMin              = 1000
-	blockMaxSizeMax              = blockchain.MaxBlockBaseSize - 1000
-	blockMaxWeightMin            = 4000
-	blockMaxWeightMax            = blockchain.MaxBlockWeight - 4000
-	defaultGenerate              = false
-	defaultMaxOrphanTransactions = 100
-	defaultMaxOrphanTxSize       = 100000
-	defaultSigCacheMaxSize       = 100000
-	defaultUtxoCacheMaxSizeMiB   = 250
-	defaultCookieFileName        = ".cookie"
-	sampleConfigFilename         = "sample-utreexod.conf"
-	defaultTxIndex               = false
-	defaultTTLIndex              = false
-	defaultAddrIndex             = false
-	pruneMinSize                 = 550
+	defaultConfigFilename           = "utreexod.conf"
+	defaultDataDirname              = "data"
+	defaultLogLevel                 = "info"
+	defaultLogDirname               = "logs"
+	defaultLogFilename              = "utreexod.log"
+	defaultMaxPeers                 = 125
+	defaultBanDuration              = time.Hour * 24
+	defaultBanThreshold             = 300
+	defaultConnectTimeout           = time.Second * 30
+	defaultStaleTipTimeout          = time.Minute * 30
+	defaultBlockScrubRate           = 100
+	defaultArchivalConns            = 2
+	defaultMaxRPCClients            = 10
+	defaultMaxRPCWebsockets         = 25
+	defaultMaxRPCConcurrentReqs     = 20
+	defaultDbType                   = "ffldb"
+	defaultElectrumServerPort       = "50001"
+	defaultTLSElectrumServerPort    = "50002"
+	defaultFreeTxRelayLimit         = 15.0
+	defaultTrickleInterval          = peer.DefaultTrickleInterval
+	defaultReadReplicaInterval      = time.Second * 30
+	defaultBlockMinSize             = 0
+	defaultBlockMaxSize             = 750000
+	defaultBlockMinWeight           = 0
+	defaultBlockMaxWeight           = 3000000
+	blockMaxSizeMin                 = 1000
+	blockMaxSizeMax                 = blockchain.MaxBlockBaseSize - 1000
+	blockMaxWeightMin               = 4000
+	blockMaxWeightMax               = blockchain.MaxBlockWeight - 4000
+	defaultGenerate                 = false
+	defaultMaxOrphanTransactions    = 100
+	defaultMaxOrphanTxSize          = 100000
+	defaultSigCacheMaxSize          = 100000
+	defaultUtxoCacheMaxSizeMiB      = 250
+	defaultUtreexoProofCacheSize    = 1000
+	defaultServedProofCacheSize     = 144
+	defaultProofAccessClients       = proofClientsNone
+	defaultUtreexoFlushBatchSize    = 64
+	defaultUtreexoShutdownTimeout   = 10 * time.Minute
+	defaultUtreexoAuditLogMaxSize   = 100
+	defaultUtreexoConsistencyWrites = writeModeSync
+	defaultUtreexoNodeWrites        = writeModeSync
+	defaultUtreexoProofWrites       = writeModeAsync
+	defaultUtreexoUndoWrites        = writeModeAsync
+	defaultMaxProofTargets          = 25000
+	defaultBackgroundCPUPercent     = 100
+	defaultUtreexoCompactGarbage    = 50
+	defaultMaxProofBytes            = wire.MaxMessagePayload
+	defaultMaxPeerProofRequests     = 8
+	defaultMaxPeerFilteredBlocks    = 2000
+	defaultCookieFileName           = ".cookie"
+	defaultTorControl               = "127.0.0.1:9051"
+	sampleConfigFilename            = "sample-utreexod.conf"
+	defaultTxIndex                  = false
+	defaultTTLIndex                 = false
+	defaultAddrIndex                = false
+	pruneMinSize                    = 550
+
+	// writeModeSync and writeModeAsync are the values of the options that
+	// select whether a kind of utreexo data is fsynced when written.
+	writeModeSync  = "sync"
+	writeModeAsync = "async"
 )
 
 var (
@@ -108,6 +137,8 @@ type config struct {
 	SigCacheMaxSize     uint   `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	UtxoCacheMaxSizeMiB uint   `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache"`
 	NoUtreexo           bool   `long:"noutreexo" description:"Disable utreexo compact state during block validation"`
+	CSN                 bool   `long:"csn" description:"Run as a compact state node that only keeps the roots of the utreexo accumulator and validates blocks with the proofs received from peers. Can't be combined with the options that build a UTXO set, a transaction index or serve utreexo proofs"`
+	NoDbRepair          bool   `long:"nodbrepair" description:"Do not attempt to automatically repair the block database when it fails to open due to corruption"`
 	NoWinService        bool   `long:"nowinservice" description:"Do not start as a background service on Windows -- NOTE: This flag only works on the command line, not in the config file"`
 	Prune               uint64 `long:"prune" description:"Prune already validated blocks from the database. Must specify a target size in MiB (minimum value of 550, default of 550. Set to 0 to disable pruning.)"`
 
@@ -117,8 +148,35 @@ type config struct {
 	MemoryProfile string `long:"memprofile" description:"Write memory profile to the specified file"`
 	TraceProfile  string `long:"traceprofile" description:"Write trace profile to the specified file"`
 
+	// Monitoring options.
+	PrometheusListen string `long:"prometheuslisten" description:"Serve Prometheus metrics of the utreexo state on /metrics at the given interface/port (e.g. localhost:9101)"`
+
+	// ZMQ notification options.
+	ZMQPubRawBlock     string `long:"zmqpubrawblock" description:"Publish the blocks connected to the main chain on the given ZMQ endpoint (e.g. tcp://127.0.0.1:28332)"`
+	ZMQPubRawTx        string `long:"zmqpubrawtx" description:"Publish the transactions accepted to the mempool or connected in a block on the given ZMQ endpoint (e.g. tcp://127.0.0.1:28333)"`
+	ZMQPubUtreexoRoots string `long:"zmqpubutreexoroots" description:"Publish the utreexo roots whenever the tip changes on the given ZMQ endpoint (e.g. tcp://127.0.0.1:28334).  Requires the utreexo proof index, the flat utreexo proof index or --noutreexo disabled"`
+
+	// Bitcoin Core bridge options.
+	CoreRPC          string        `long:"corerpc" description:"Bridge blocks and transactions with the trusted Bitcoin Core node whose RPC server is at the given host:port (e.g. 127.0.0.1:8332).  Requires --noutreexo or one of the utreexo proof indexes"`
+	CoreRPCUser      string        `long:"corerpcuser" description:"Username for the RPC server of the Bitcoin Core node"`
+	CoreRPCPass      string        `long:"corerpcpass" default-mask:"-" description:"Password for the RPC server of the Bitcoin Core node"`
+	CoreZMQRawBlock  string        `long:"corezmqrawblock" description:"Receive the blocks of the Bitcoin Core node from its zmqpubrawblock endpoint (e.g. tcp://127.0.0.1:28332) instead of polling its RPC server"`
+	CoreZMQRawTx     string        `long:"corezmqrawtx" description:"Receive the mempool transactions of the Bitcoin Core node from its zmqpubrawtx endpoint (e.g. tcp://127.0.0.1:28333)"`
+	CorePollInterval time.Duration `long:"corepollinterval" description:"How often the tip of the Bitcoin Core node is polled when --corezmqrawblock isn't set.  Valid time units are {s, m, h}"`
+
+	// Replication options.
+	ReplicateFrom string `long:"replicatefrom" description:"Follow the trusted leader utreexod whose gRPC API is at the given host:port (e.g. 10.0.0.1:8335) by adding its blocks without validating them again.  Utreexo nodes require a leader with one of the utreexo proof indexes"`
+	ReplicateCert string `long:"replicatecert" description:"File containing the TLS certificate of the gRPC API of the leader.  The system certificates are used when unset"`
+	ReplicateUser string `long:"replicateuser" description:"Username for the RPC server of the leader"`
+	ReplicatePass string `long:"replicatepass" default-mask:"-" description:"Password for the RPC server of the leader"`
+
+	// Block scrubbing options.
+	BlockScrubInterval time.Duration `long:"blockscrubinterval" description:"Read back the stored blocks and utreexo proofs in the background to catch the ones corrupted on disk, refetching corrupted blocks from peers.  A new pass starts this long after the last one finished.  Valid time units are {s, m, h}.  Set to 0 to disable"`
+	BlockScrubRate     int           `long:"blockscrubrate" description:"Maximum number of blocks per second the block scrubber reads back"`
+
 	// Network options.
 	TestNet3        bool   `long:"testnet" description:"Use the test network"`
+	TestNet4        bool   `long:"testnet4" description:"Use the test network (version 4)"`
 	RegressionTest  bool   `long:"regtest" description:"Use the regression test network"`
 	SimNet          bool   `long:"simnet" description:"Use the simulation test network"`
 	SigNet          bool   `long:"signet" description:"Use the signet test network"`
@@ -133,6 +191,8 @@ type config struct {
 	RPCLimitUser         string   `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCListeners         []string `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCMaxClients        int      `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
+	GRPCListeners        []string `long:"grpclisten" description:"Add an interface/port to serve the gRPC API on (e.g. localhost:8335) -- NOTE: It uses the TLS certificate and the credentials of the RPC server so it can't be used with --norpc or --notls"`
+	REST                 bool     `long:"rest" description:"Accept public REST requests on the RPC listeners (e.g. /rest/utreexoproof/<blockhash>.<bin|hex|json>)"`
 	RPCMaxConcurrentReqs int      `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCMaxWebsockets     int      `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCQuirks            bool     `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
@@ -140,23 +200,37 @@ type config struct {
 	RPCUser              string   `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 
 	// P2P proxy and Tor settings.
-	Proxy          string `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
-	ProxyPass      string `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
-	ProxyUser      string `long:"proxyuser" description:"Username for proxy server"`
-	NoOnion        bool   `long:"noonion" description:"Disable connecting to tor hidden services"`
-	OnionProxy     string `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
-	OnionProxyPass string `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
-	OnionProxyUser string `long:"onionuser" description:"Username for onion proxy server"`
-	TorIsolation   bool   `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	Proxy           string `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	ProxyPass       string `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
+	ProxyUser       string `long:"proxyuser" description:"Username for proxy server"`
+	NoOnion         bool   `long:"noonion" description:"Disable connecting to tor hidden services"`
+	OnionProxy      string `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	OnionProxyPass  string `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
+	OnionProxyUser  string `long:"onionuser" description:"Username for onion proxy server"`
+	TorIsolation    bool   `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	ListenOnion     bool   `long:"listenonion" description:"Automatically create a Tor v3 onion service for inbound connections through the Tor control port"`
+	TorControl      string `long:"torcontrol" description:"Tor control port to create the onion service with when --listenonion is set"`
+	TorPassword     string `long:"torpassword" default-mask:"-" description:"Password for the Tor control port -- The authentication cookie of Tor is used when not set"`
+	FullRelayProxy  string `long:"fullrelayproxy" description:"Connect to full-relay peers via this SOCKS5 proxy instead of the one from --proxy (eg. 127.0.0.1:9050) -- Use direct to connect to them without a proxy"`
+	BlockRelayProxy string `long:"blockrelayproxy" description:"Connect to block-relay-only peers via this SOCKS5 proxy instead of the one from --proxy (eg. 127.0.0.1:9050) -- Use direct to connect to them without a proxy"`
+	ProofProxy      string `long:"proofproxy" description:"Connect to the full-relay peers that transaction proofs are fetched from when running as a utreexo CSN via this SOCKS5 proxy instead of the one from --proxy (eg. 127.0.0.1:9050) -- Use direct to connect to them without a proxy"`
 
 	// P2P network options.
 	AddPeers          []string      `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	ConnectPeers      []string      `long:"connect" description:"Connect only to the specified peers at startup"`
+	OnlyNet           []string      `long:"onlynet" description:"Only make automatic outbound connections to addresses of this network (ipv4, ipv6 or onion) -- May be given multiple times"`
+	NoV2Transport     bool          `long:"nov2transport" description:"Disable the BIP0324 v2 encrypted transport for peer connections -- When enabled, outbound connections that fail its handshake are retried with the unencrypted v1 transport"`
+	ProofSources      []string      `long:"proofsource" description:"Add a proof source to keep connected to and fetch blocks and utreexo proofs from before the public peers in the form of <host:port>[,token=<token>][,pubkey=<hex>].  The token authenticates the node to the source and the source has to prove it holds the key of the x-only public key.  May be given multiple times"`
+	ProofAuthTokens   []string      `long:"proofauthtoken" description:"Accept nodes authenticating with this token as proof clients that are served proofs without limits or ban scores.  May be given multiple times"`
 	Listeners         []string      `long:"listen" description:"Add an interface/port to listen for connections (default all interfaces port: 8333, testnet: 18333)"`
+	ListenServices    []string      `long:"listenservices" description:"Advertise only the given services to the peers connecting to a listener in the form of <listen address>=<service>[,<service>...] (services: network, networklimited, bloom, witness, cf, utreexo, utreexoarchive, utreexorecent, utreexocsn).  Services the node doesn't offer are never advertised"`
 	DisableListen     bool          `long:"nolisten" description:"Disable listening for incoming connections -- NOTE: Listening is automatically disabled if the --connect or --proxy options are used without also specifying listen interfaces via --listen"`
 	MaxPeers          int           `long:"maxpeers" description:"Max number of inbound and outbound peers"`
+	BlockRelayConns   int           `long:"blockrelayconns" description:"Number of outbound connections that only relay blocks to make in addition to the full-relay ones"`
+	ArchivalConns     int           `long:"archivalconns" description:"Number of the full-relay outbound connections of a utreexo CSN to keep to archival bridges that serve the proofs of every block while it's catching up -- Set to 0 to connect to any utreexo peer"`
 	UserAgentComments []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	TrickleInterval   time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
+	StaleTipTimeout   time.Duration `long:"staletiptimeout" description:"How long the tip may go without advancing before an outbound peer is swapped out, the DNS seeds are queried again and a warning is raised.  Valid time units are {s, m, h}.  Set to 0 to disable"`
 
 	// P2P network discovery options.
 	DisableDNSSeed bool     `long:"nodnsseed" description:"Disable DNS seeding for peers"`
@@ -165,27 +239,31 @@ type config struct {
 	Upnp           bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
 
 	// Banning options.
-	AgentBlacklist []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause utreexod to reject any peers whose user-agent contains any of the blacklisted substrings."`
-	AgentWhitelist []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause utreexod to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
-	Whitelists     []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
-	DisableBanning bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
-	BanDuration    time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
-	BanThreshold   uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	AgentBlacklist    []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause utreexod to reject any peers whose user-agent contains any of the blacklisted substrings."`
+	AgentWhitelist    []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause utreexod to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
+	AgentDeprioritize []string      `long:"agentdeprioritize" description:"A comma separated list of user-agent substrings of peers to deprioritize.  Deprioritized inbound peers are evicted to make room for other inbound peers when the max peers is reached and only get one utreexo proof served at a time."`
+	RejectServices    []string      `long:"rejectservices" description:"Reject peers that advertise exactly the given service flags.  The flags are a number such as 0 for peers that advertise no services or 0x1000009.  May be repeated for several sets of flags."`
+	Whitelists        []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	DisableBanning    bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
+	BanDuration       time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	BanThreshold      uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 
 	// Chain related options.
 	AddCheckpoints     []string `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
 	DisableCheckpoints bool     `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
 	NoAssumeUtreexo    bool     `long:"noassumeutreexo" description:"Disable starting from the assume utreexo point and start the initial block download from the genesis block"`
+	AssumeUtreexo      string   `long:"assumeutreexo" description:"Start from the accumulator roots at the given height instead of the hard-coded assume utreexo point.  The roots are fetched from peers and must hash to the given roots hash, which is returned by getutreexoroots.  Format: '<height>:<rootshash>'"`
 
 	// Relay and mempool policy.
-	BlocksOnly        bool    `long:"blocksonly" description:"Do not accept transactions from remote peers."`
-	MaxOrphanTxs      int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
-	MinRelayTxFee     float64 `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
-	NoRelayPriority   bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
-	RelayNonStd       bool    `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
-	RejectNonStd      bool    `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
-	RejectReplacement bool    `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
-	FreeTxRelayLimit  float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
+	BlocksOnly          bool    `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	MaxOrphanTxs        int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MinRelayTxFee       float64 `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
+	IncrementalRelayFee float64 `long:"incrementalrelayfee" description:"The fee rate in BTC/kB a replacement transaction must pay for its own size on top of the fees of the transactions it replaces."`
+	NoRelayPriority     bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
+	RelayNonStd         bool    `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
+	RejectNonStd        bool    `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
+	RejectReplacement   bool    `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
+	FreeTxRelayLimit    float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 
 	// Mining options and policy.
 	Generate          bool     `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
@@ -197,24 +275,63 @@ type config struct {
 	BlockPrioritySize uint32   `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
 
 	// Indexing options.
-	AddrIndex                  bool  `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
-	TxIndex                    bool  `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
-	UtreexoProofIndex          bool  `long:"utreexoproofindex" description:"Maintain a utreexo proof for all blocks"`
-	FlatUtreexoProofIndex      bool  `long:"flatutreexoproofindex" description:"Maintain a utreexo proof for all blocks in flat files"`
-	UtreexoProofIndexMaxMemory int64 `long:"utreexoproofindexmaxmemory" description:"The maxmimum memory in mebibytes (MiB) that the utreexo proof indexes will use up. Default of 500MiB. Minimum of 250MiB"`
-	CFilters                   bool  `long:"cfilters" description:"Enable committed filtering (CF) support"`
-	NoPeerBloomFilters         bool  `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
-	DropAddrIndex              bool  `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
-	DropCfIndex                bool  `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
-	DropTxIndex                bool  `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
-	DropUtreexoProofIndex      bool  `long:"droputreexoproofindex" description:"Deletes the utreexo proof index from the database on start up and then exits."`
-	DropFlatUtreexoProofIndex  bool  `long:"dropflatutreexoproofindex" description:"Deletes the flat utreexo proof index from the database on start up and then exits."`
+	AddrIndex                    bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
+	TxIndex                      bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
+	DeferIndexSync               bool          `long:"deferindexsync" description:"Catch up the optional indexes that are behind the main chain in the background after startup instead of before the node starts serving peers and RPC clients. The utreexo proof indexes are always caught up in the background"`
+	UtreexoProofIndex            bool          `long:"utreexoproofindex" description:"Maintain a utreexo proof for all blocks"`
+	FlatUtreexoProofIndex        bool          `long:"flatutreexoproofindex" description:"Maintain a utreexo proof for all blocks in flat files"`
+	UtreexoProofIndexMaxMemory   int64         `long:"utreexoproofindexmaxmemory" description:"The maxmimum memory in mebibytes (MiB) that the utreexo proof indexes will use up. Default of 500MiB. Minimum of 250MiB. A negative value keeps the whole accumulator in memory and writes it to a flat file on flushes. --utreexomaxnodesmemory and --utreexomaxcachedleavesmemory must fit within it"`
+	UtreexoMaxNodesMemory        int64         `long:"utreexomaxnodesmemory" description:"The maximum memory in mebibytes (MiB) for the cache of the accumulator nodes. Overrides the default 70% share of --utreexoproofindexmaxmemory when set"`
+	UtreexoMaxCachedLeavesMemory int64         `long:"utreexomaxcachedleavesmemory" description:"The maximum memory in mebibytes (MiB) for the cache of the cached leaves. Overrides the default 30% share of --utreexoproofindexmaxmemory when set"`
+	UtreexoFlushBlockInterval    int32         `long:"utreexoflushblockinterval" description:"Flush the utreexo state to disk every N blocks. Set to 0 to disable."`
+	UtreexoFlushInterval         time.Duration `long:"utreexoflushinterval" description:"Flush the utreexo state to disk if this much time has passed since the last flush. Valid time units are {s, m, h}. Set to 0 to disable."`
+	UtreexoFlushCacheUsage       float64       `long:"utreexoflushcacheusage" description:"Flush the utreexo state to disk once the cache is filled to this percentage (0-100). Set to 0 to disable."`
+	UtreexoFlushBatchSize        int64         `long:"utreexoflushbatchsize" description:"The maximum size in mebibytes (MiB) of a batch of utreexo accumulator nodes and cached leaves committed at once when flushing. Set to 0 to commit each flush in a single batch."`
+	UtreexoAuditLog              bool          `long:"utreexoauditlog" description:"Record every modification of the utreexo accumulator (height, adds, deletes and resulting roots) to an audit log in the utreexo state directory"`
+	UtreexoAuditLogMaxSize       int64         `long:"utreexoauditlogmaxsize" description:"The size in mebibytes (MiB) the utreexo audit log may grow to before it's rolled over. The last 5 rolled over logs are kept gzipped"`
+	UtreexoShutdownTimeout       time.Duration `long:"utreexoshutdowntimeout" description:"The maximum time to wait for the utreexo state to be flushed on shutdown. The flush is resumed or the blocks since the last flush are replayed on the next start if it takes longer. Valid time units are {s, m, h}. Set to 0 to always wait for the flush."`
+	UtreexoConsistencyWrites     string        `long:"utreexoconsistencywrites" description:"Whether the writes of the utreexo state consistency marker are fsynced to disk {sync, async}"`
+	UtreexoNodeWrites            string        `long:"utreexonodewrites" description:"Whether the writes of the utreexo accumulator nodes and cached leaves are fsynced to disk {sync, async}"`
+	UtreexoProofWrites           string        `long:"utreexoproofwrites" description:"Whether the writes of the proofs of the flat utreexo proof index are fsynced to disk {sync, async}"`
+	UtreexoUndoWrites            string        `long:"utreexoundowrites" description:"Whether the writes of the undo data of the utreexo proof indexes are fsynced to disk {sync, async}"`
+	BackgroundCPUPercent         int           `long:"backgroundcpupercent" description:"Maximum percentage of the CPU cores used by background work such as catching up indexes and compacting proofs (1-100)"`
+	UtreexoProofCacheSize        int           `long:"utreexoproofcachesize" description:"The maximum number of generated utreexo proofs for sets of outpoints to keep in memory for repeated requests. Cached proofs are dropped whenever a block is connected or disconnected. Set to 0 to disable."`
+	ServedProofCacheSize         int           `long:"servedproofcachesize" description:"The maximum number of utreexo proofs of blocks to keep in memory after serving them to peers so that the recent blocks asked for by many syncing peers are only read from the proof index once. Set to 0 to disable."`
+	ProofAccessStats             bool          `long:"proofaccessstats" description:"Count the utreexo proofs served over P2P, RPC and REST by how deep their block is and how many targets they have. The counts are returned by getproofaccessstats and exported to Prometheus when --prometheuslisten is set"`
+	ProofAccessClients           string        `long:"proofaccessclients" description:"How the clients are told apart in the counts of --proofaccessstats {none, truncated, full}. With truncated only the /24 of IPv4 and the /48 of IPv6 addresses is kept"`
+	MaxProofTargets              int           `long:"maxprooftargets" description:"The maximum number of targets that a single RPC or P2P request may ask a utreexo proof for"`
+	MaxProofBytes                int           `long:"maxproofbytes" description:"The maximum size in bytes of a utreexo proof served in a single RPC, REST or P2P response"`
+	MaxPeerProofRequests         int           `long:"maxpeerproofrequests" description:"The maximum number of utreexo proofs requested by a single peer that may be waiting to be sent out. Further requests from the peer are ignored until they are sent"`
+	LeafTTLs                     bool          `long:"leafttls" description:"Keep the time to live of every output added to the utreexo accumulator so that they can be fetched with getleafttls. Requires --flatutreexoproofindex and can only be enabled when the index is built from the genesis block"`
+	ProofPruneHeight             int32         `long:"proofpruneheight" description:"Drop the proofs of the flat utreexo proof index for the blocks below this height to free up disk space. The proofs of the last 288 blocks are always kept. Requires --flatutreexoproofindex"`
+	ProofRetention               int32         `long:"proofretention" description:"Keep the proofs of the flat utreexo proof index for only this many blocks from the tip and drop the older ones as new blocks come in. The accumulator is still maintained for all blocks. Must be at least 288 so that reorgs can be undone. Requires --flatutreexoproofindex"`
+	UndoRetention                int32         `long:"undoretention" description:"Keep the data used to disconnect blocks on reorgs for only this many blocks from the tip on pruned nodes running a utreexo proof index. Reorgs deeper than this can't be undone unless --rollbacksnapshots is set"`
+	RollbackSnapshots            int           `long:"rollbacksnapshots" description:"Keep this many snapshots of the utreexo accumulator taken every --undoretention blocks so that reorgs deeper than the kept undo data are undone by replaying the blocks from a snapshot instead of reindexing. Each snapshot takes up as much disk space as the accumulator. Requires --utreexoproofindex or --flatutreexoproofindex"`
+	RootSnapshotInterval         int32         `long:"rootsnapshotinterval" description:"Store the roots of the utreexo accumulator every this many blocks so that the roots at any past block can be looked up with gethistoricalroots by replaying the blocks from the last snapshot below it. Set to 0 to disable."`
+	CompactionWindows            []string      `long:"compactionwindow" description:"Only drop the proofs of old blocks and compact the utreexo state database within this daily window of local time in the form of HH:MM-HH:MM such as 02:00-05:00. The proofs past --proofpruneheight or --proofretention are held back outside of the windows and the compaction is capped by --backgroundcpupercent. May be specified multiple times"`
+	UtreexoCompactGarbage        float64       `long:"utreexocompactgarbage" description:"Compact the utreexo state database once this percentage (0-100) of its cached leaves entries are garbage left behind by spent and moved leaves. The compaction runs in the background within --compactionwindow and is capped by --backgroundcpupercent. Set to 0 to disable."`
+	LeafDataIndex                bool          `long:"leafdataindex" description:"Maintain an index of the outputs committed to by the leaves in the utreexo accumulator so that the getleafatposition RPC can tell what is at a position. Requires --utreexoproofindex or --flatutreexoproofindex"`
+	ReadReplicaDir               string        `long:"readreplicadir" description:"Hand off snapshots of the accumulator of the flat utreexo proof index to this directory so that read replicas can serve proofs from the data directory without locking it. The directory should be on the same file system as the data directory so that the snapshots are hard links. Requires --flatutreexoproofindex and --prune=0"`
+	ReadReplicaInterval          time.Duration `long:"readreplicainterval" description:"How often a new snapshot is handed off to --readreplicadir when the tip changed. Valid time units are {s, m, h}"`
+	HybridValidation             bool          `long:"hybridvalidation" description:"Cross-check every block against both the UTXO set and the utreexo accumulator and halt block processing on divergence. Requires --utreexoproofindex or --flatutreexoproofindex"`
+	Conformance                  bool          `long:"conformance" description:"Connect a fixed chain of regtest blocks on start up and serve their blocks, proofs and roots as canonical vectors over P2P and the getconformancevectors RPC so that other utreexo implementations can check their conformance against this node. Requires --regtest and --utreexoproofindex or --flatutreexoproofindex"`
+	CFilters                     bool          `long:"cfilters" description:"Enable committed filtering (CF) support"`
+	PeerBloomFilters             bool          `long:"peerbloomfilters" description:"Enable bloom filtering support (BIP0037) so that legacy SPV clients can load filters and request filtered blocks"`
+	NoPeerBloomFilters           bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support.  It's disabled unless --peerbloomfilters is given"`
+	MaxPeerFilteredBlocks        int           `long:"maxpeerfilteredblocks" description:"The maximum number of filtered blocks served to a single peer per minute when bloom filtering is enabled. Further requests are answered with notfound. Set to 0 for no limit"`
+	DropAddrIndex                bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	DropCfIndex                  bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
+	DropTxIndex                  bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	DropUtreexoProofIndex        bool          `long:"droputreexoproofindex" description:"Deletes the utreexo proof index from the database on start up and then exits."`
+	DropFlatUtreexoProofIndex    bool          `long:"dropflatutreexoproofindex" description:"Deletes the flat utreexo proof index from the database on start up and then exits."`
+	DropLeafDataIndex            bool          `long:"dropleafdataindex" description:"Deletes the leaf data index from the database on start up and then exits."`
 
 	// Wallet options.
 	WatchOnlyWallet                                      bool     `long:"watchonlywallet" description:"Enable the watch only wallet with utreexo proofs. Must have --noutreexo disabled"`
 	RegisterAddressToWatchOnlyWallet                     []string `long:"registeraddresstowatchonlywallet" description:"Registers addresses to be watched to the watch only wallet. Must have --watchonlywallet enabled"`
 	RegisterExtendedPubKeysToWatchOnlyWallet             []string `long:"registerextendedpubkeystowatchonlywallet" description:"Registers extended pubkeys to be watched to the watch only wallet. Must have --watchonlywallet enabled."`
 	RegisterExtendedPubKeysWithAddrTypeToWatchOnlyWallet []string `long:"registerextendedpubkeyswithaddresstypetowatchonlywallet" description:"Registers extended pubkeys to be watched to the watch only wallet and let's the user override the hd type of the extended public key. Must have --watchonlywallet enabled. Format: '<extendedpubkey>:<address type>. Supported address types: '{p2pkh, p2wpkh, p2sh}'"`
+	RegisterDescriptorsToWatchOnlyWallet                 []string `long:"registerdescriptorstowatchonlywallet" description:"Registers output descriptors to be watched to the watch only wallet. Must have --watchonlywallet enabled. Supported descriptors: '{pkh, wpkh, sh(wpkh), tr, addr, raw}'"`
 	NoBdkWallet                                          bool     `long:"nobdkwallet" description:"Disable the BDK wallet."`
 
 	// Electrum server options.
@@ -222,15 +339,28 @@ type config struct {
 	TLSElectrumListeners []string `long:"tlselectrumlisteners" description:"Interface/port for the electrum server to listen to with tls. (default 50002). TLS electrum server is only enabled when --watchonlywallet is enabled"`
 	DisableElectrum      bool     `long:"disableelectrum" description:"Disable the electrum server while the --watchonlywallet flag is on"`
 
+	// Experimental options.
+	Experimental []string `long:"experimental" description:"Enable the given comma-separated experimental features that aren't ready to be on by default. Only allowed on the test networks"`
+
 	// Cooked options ready for use.
-	lookup          func(string) ([]net.IP, error)
-	oniondial       func(string, string, time.Duration) (net.Conn, error)
-	dial            func(string, string, time.Duration) (net.Conn, error)
-	addCheckpoints  []chaincfg.Checkpoint
-	miningAddrs     []btcutil.Address
-	minRelayTxFee   btcutil.Amount
-	whitelists      []*net.IPNet
-	extendedPubkeys map[string]string
+	lookup              func(string) ([]net.IP, error)
+	oniondial           func(string, string, time.Duration) (net.Conn, error)
+	dial                func(string, string, time.Duration) (net.Conn, error)
+	classDials          [numConnClasses]func(string, string, time.Duration) (net.Conn, error)
+	classProxies        [numConnClasses]string
+	reachableNets       map[string]struct{}
+	addCheckpoints      []chaincfg.Checkpoint
+	assumeUtreexo       *chaincfg.AssumeUtreexo
+	miningAddrs         []btcutil.Address
+	minRelayTxFee       btcutil.Amount
+	incrementalRelayFee btcutil.Amount
+	whitelists          []*net.IPNet
+	rejectServices      []wire.ServiceFlag
+	listenServices      map[string]wire.ServiceFlag
+	proofSources        []*proofSource
+	compactWindows      []indexers.CompactionWindow
+	experimental        map[string]struct{}
+	extendedPubkeys     map[string]string
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -430,6 +560,47 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// parseAssumeUtreexo parses an assume utreexo point in the '<height>:<rootshash>'
+// format.  The hard-coded point of the network is returned if it's the one given.
+// Otherwise the returned point only has the height and the roots hash set and
+// the roots are fetched from peers.
+func parseAssumeUtreexo(point string, params *chaincfg.Params) (*chaincfg.AssumeUtreexo, error) {
+	parts := strings.Split(point, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unable to parse assume utreexo point "+
+			"%q -- use the syntax <height>:<rootshash>", point)
+	}
+
+	height, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || height <= 0 {
+		return nil, fmt.Errorf("unable to parse assume utreexo point "+
+			"%q due to malformed height", point)
+	}
+
+	if len(parts[1]) == 0 {
+		return nil, fmt.Errorf("unable to parse assume utreexo point "+
+			"%q due to missing roots hash", point)
+	}
+	rootsHash, err := chainhash.NewHashFromStr(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse assume utreexo point "+
+			"%q due to malformed roots hash", point)
+	}
+
+	hardcoded := params.AssumeUtreexoPoint
+	if len(hardcoded.Roots) > 0 && hardcoded.BlockHeight == int32(height) {
+		hash := blockchain.UtreexoRootsHash(hardcoded.NumLeaves, hardcoded.Roots)
+		if hash.IsEqual(rootsHash) {
+			return &hardcoded, nil
+		}
+	}
+
+	return &chaincfg.AssumeUtreexo{
+		BlockHeight: int32(height),
+		RootsHash:   rootsHash,
+	}, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -440,6 +611,46 @@ func fileExists(name string) bool {
 	return true
 }
 
+// csnConflicts returns the options that are set in the config and can't be used
+// when running as a compact state node.  Compact state nodes don't keep the UTXO
+// set or the full accumulator so they can't maintain the transaction indexes or
+// serve utreexo proofs.
+func csnConflicts(cfg *config) []string {
+	options := []struct {
+		flag string
+		set  bool
+	}{
+		{"--noutreexo", cfg.NoUtreexo},
+		{"--utreexoproofindex", cfg.UtreexoProofIndex},
+		{"--flatutreexoproofindex", cfg.FlatUtreexoProofIndex},
+		{"--hybridvalidation", cfg.HybridValidation},
+		{"--leafttls", cfg.LeafTTLs},
+		{"--leafdataindex", cfg.LeafDataIndex},
+		{"--txindex", cfg.TxIndex},
+		{"--addrindex", cfg.AddrIndex},
+	}
+
+	var conflicts []string
+	for _, option := range options {
+		if option.set {
+			conflicts = append(conflicts, option.flag)
+		}
+	}
+
+	return conflicts
+}
+
+// utreexoSyncPolicy returns the sync policy of the utreexo proof indexes that's
+// selected by the write mode options.
+func utreexoSyncPolicy(cfg *config) indexers.SyncPolicy {
+	return indexers.SyncPolicy{
+		Consistency: cfg.UtreexoConsistencyWrites == writeModeSync,
+		Nodes:       cfg.UtreexoNodeWrites == writeModeSync,
+		Proofs:      cfg.UtreexoProofWrites == writeModeSync,
+		Undo:        cfg.UtreexoUndoWrites == writeModeSync,
+	}
+}
+
 // newConfigParser returns a new command line flags parser.
 func newConfigParser(cfg *config, so *serviceOptions, options flags.Options) *flags.Parser {
 	parser := flags.NewParser(cfg, options)
@@ -469,6 +680,13 @@ func loadConfig() (*config, []string, error) {
 		MaxPeers:                   defaultMaxPeers,
 		BanDuration:                defaultBanDuration,
 		BanThreshold:               defaultBanThreshold,
+		TorControl:                 defaultTorControl,
+		StaleTipTimeout:            defaultStaleTipTimeout,
+		BlockScrubRate:             defaultBlockScrubRate,
+		CorePollInterval:           corebridge.DefaultPollInterval,
+		UndoRetention:              indexers.DefaultUndoRetention,
+		RootSnapshotInterval:       indexers.DefaultRootSnapshotInterval,
+		ArchivalConns:              defaultArchivalConns,
 		RPCMaxClients:              defaultMaxRPCClients,
 		RPCMaxWebsockets:           defaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs:       defaultMaxRPCConcurrentReqs,
@@ -478,8 +696,10 @@ func loadConfig() (*config, []string, error) {
 		RPCKey:                     defaultRPCKeyFile,
 		RPCCert:                    defaultRPCCertFile,
 		MinRelayTxFee:              mempool.DefaultMinRelayTxFee.ToBTC(),
+		IncrementalRelayFee:        mempool.DefaultIncrementalRelayFee.ToBTC(),
 		FreeTxRelayLimit:           defaultFreeTxRelayLimit,
 		TrickleInterval:            defaultTrickleInterval,
+		ReadReplicaInterval:        defaultReadReplicaInterval,
 		BlockMinSize:               defaultBlockMinSize,
 		BlockMaxSize:               defaultBlockMaxSize,
 		BlockMinWeight:             defaultBlockMinWeight,
@@ -489,6 +709,22 @@ func loadConfig() (*config, []string, error) {
 		SigCacheMaxSize:            defaultSigCacheMaxSize,
 		UtxoCacheMaxSizeMiB:        defaultUtxoCacheMaxSizeMiB,
 		UtreexoProofIndexMaxMemory: defaultUtxoCacheMaxSizeMiB * 2,
+		UtreexoConsistencyWrites:   defaultUtreexoConsistencyWrites,
+		UtreexoNodeWrites:          defaultUtreexoNodeWrites,
+		UtreexoProofWrites:         defaultUtreexoProofWrites,
+		UtreexoUndoWrites:          defaultUtreexoUndoWrites,
+		UtreexoProofCacheSize:      defaultUtreexoProofCacheSize,
+		ServedProofCacheSize:       defaultServedProofCacheSize,
+		ProofAccessClients:         defaultProofAccessClients,
+		UtreexoFlushBatchSize:      defaultUtreexoFlushBatchSize,
+		UtreexoShutdownTimeout:     defaultUtreexoShutdownTimeout,
+		UtreexoAuditLogMaxSize:     defaultUtreexoAuditLogMaxSize,
+		BackgroundCPUPercent:       defaultBackgroundCPUPercent,
+		UtreexoCompactGarbage:      defaultUtreexoCompactGarbage,
+		MaxProofTargets:            defaultMaxProofTargets,
+		MaxProofBytes:              defaultMaxProofBytes,
+		MaxPeerProofRequests:       defaultMaxPeerProofRequests,
+		MaxPeerFilteredBlocks:      defaultMaxPeerFilteredBlocks,
 		Generate:                   defaultGenerate,
 		TxIndex:                    defaultTxIndex,
 		AddrIndex:                  defaultAddrIndex,
@@ -597,6 +833,10 @@ func loadConfig() (*config, []string, error) {
 		numNets++
 		activeNetParams = &testNet3Params
 	}
+	if cfg.TestNet4 {
+		numNets++
+		activeNetParams = &testNet4Params
+	}
 	if cfg.RegressionTest {
 		numNets++
 		activeNetParams = &regressionNetParams
@@ -647,9 +887,9 @@ func loadConfig() (*config, []string, error) {
 		activeNetParams.Params = &chainParams
 	}
 	if numNets > 1 {
-		str := "%s: The testnet, regtest, segnet, signet and simnet " +
-			"params can't be used together -- choose one of the " +
-			"five"
+		str := "%s: The testnet, testnet4, regtest, segnet, signet " +
+			"and simnet params can't be used together -- choose " +
+			"one of the six"
 		err := fmt.Errorf(str, funcName)
 		fmt.Fprintln(os.Stderr, err)
 		fmt.Fprintln(os.Stderr, usageMessage)
@@ -730,6 +970,19 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Validate the prometheus listen address.
+	if cfg.PrometheusListen != "" {
+		_, _, err := net.SplitHostPort(cfg.PrometheusListen)
+		if err != nil {
+			str := "%s: The prometheuslisten option must be a valid " +
+				"interface/port -- parsed [%v]: %v"
+			err := fmt.Errorf(str, funcName, cfg.PrometheusListen, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Don't allow ban durations that are too short.
 	if cfg.BanDuration < time.Second {
 		str := "%s: The banduration option may not be less than 1s -- parsed [%v]"
@@ -739,6 +992,56 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.StaleTipTimeout < 0 {
+		str := "%s: The staletiptimeout option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StaleTipTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.BlockScrubInterval < 0 {
+		str := "%s: The blockscrubinterval option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.BlockScrubInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.CorePollInterval <= 0 {
+		str := "%s: The corepollinterval option must be positive -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.CorePollInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.BlockScrubRate < 1 {
+		str := "%s: The blockscrubrate option must be at least 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BlockScrubRate)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.BlockRelayConns < 0 {
+		str := "%s: The blockrelayconns option may not be negative -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BlockRelayConns)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ArchivalConns < 0 || cfg.ArchivalConns > defaultTargetOutbound {
+		str := "%s: The archivalconns option must be between 0 and %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, defaultTargetOutbound,
+			cfg.ArchivalConns)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate any given whitelisted IP addresses and networks.
 	if len(cfg.Whitelists) > 0 {
 		var ip net.IP
@@ -771,6 +1074,16 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Parse the sets of service flags to reject peers for.
+	cfg.rejectServices, err = parseServiceFlags(cfg.RejectServices)
+	if err != nil {
+		err := fmt.Errorf("%s: the --rejectservices option is invalid: "+
+			"%v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -781,6 +1094,25 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --listenonion needs to accept the connections forwarded by Tor and
+	// can't reach Tor when onion services are disabled.
+	if cfg.ListenOnion && cfg.DisableListen {
+		str := "%s: the --listenonion and --nolisten options may not " +
+			"be activated at the same time"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ListenOnion && cfg.NoOnion {
+		str := "%s: the --listenonion and --noonion options may not " +
+			"be activated at the same time"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --proxy or --connect without --listen disables listening.
 	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
 		len(cfg.Listeners) == 0 {
@@ -857,6 +1189,19 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the incrementalrelayfee.
+	cfg.incrementalRelayFee, err = btcutil.NewAmount(cfg.IncrementalRelayFee)
+	if err == nil && cfg.incrementalRelayFee < 0 {
+		err = fmt.Errorf("%v is negative", cfg.incrementalRelayFee)
+	}
+	if err != nil {
+		str := "%s: invalid incrementalrelayfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -969,6 +1314,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --leafdataindex and --dropleafdataindex do not mix.
+	if cfg.LeafDataIndex && cfg.DropLeafDataIndex {
+		err := fmt.Errorf("%s: the --leafdataindex and --dropleafdataindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --flatutreexoproofindex and --dropflatutreexoproofindex do not mix.
 	if cfg.FlatUtreexoProofIndex && cfg.DropFlatUtreexoProofIndex {
 		err := fmt.Errorf("%s: the --flatutreexoproofindex and --dropflatutreexoproofindex"+
@@ -979,7 +1334,7 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	if cfg.UtreexoProofIndexMaxMemory < 250 {
+	if cfg.UtreexoProofIndexMaxMemory >= 0 && cfg.UtreexoProofIndexMaxMemory < 250 {
 		err := fmt.Errorf("%s: the --utreexoproofindexmaxmemory "+
 			"option may not be less than 250",
 			funcName)
@@ -988,6 +1343,185 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.UtreexoMaxNodesMemory < 0 || cfg.UtreexoMaxCachedLeavesMemory < 0 {
+		err := fmt.Errorf("%s: the --utreexomaxnodesmemory and "+
+			"--utreexomaxcachedleavesmemory options may not be negative",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// There's nothing to budget when the whole accumulator is kept in
+	// memory.
+	if cfg.UtreexoProofIndexMaxMemory < 0 &&
+		(cfg.UtreexoMaxNodesMemory != 0 || cfg.UtreexoMaxCachedLeavesMemory != 0) {
+
+		err := fmt.Errorf("%s: the --utreexomaxnodesmemory and "+
+			"--utreexomaxcachedleavesmemory options may not be set "+
+			"when --utreexoproofindexmaxmemory is negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// When only one of the memory budgets is set, the other one gets the
+	// remainder of --utreexoproofindexmaxmemory so there must be some left.
+	// When both are set, they may not add up to more than the total.
+	nodesMem, cachedLeavesMem := cfg.UtreexoMaxNodesMemory, cfg.UtreexoMaxCachedLeavesMemory
+	if (nodesMem == 0) != (cachedLeavesMem == 0) &&
+		nodesMem+cachedLeavesMem >= cfg.UtreexoProofIndexMaxMemory {
+
+		err := fmt.Errorf("%s: the --utreexomaxnodesmemory or "+
+			"--utreexomaxcachedleavesmemory option must be less than "+
+			"--utreexoproofindexmaxmemory when only one of them is set",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if nodesMem != 0 && cachedLeavesMem != 0 &&
+		nodesMem+cachedLeavesMem > cfg.UtreexoProofIndexMaxMemory {
+
+		err := fmt.Errorf("%s: the --utreexomaxnodesmemory and "+
+			"--utreexomaxcachedleavesmemory options may not add up to "+
+			"more than --utreexoproofindexmaxmemory",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoFlushBlockInterval < 0 {
+		err := fmt.Errorf("%s: the --utreexoflushblockinterval "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoFlushInterval < 0 {
+		err := fmt.Errorf("%s: the --utreexoflushinterval "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoAuditLogMaxSize < 1 {
+		err := fmt.Errorf("%s: the --utreexoauditlogmaxsize "+
+			"option must be at least 1", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoShutdownTimeout < 0 {
+		err := fmt.Errorf("%s: the --utreexoshutdowntimeout "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoFlushCacheUsage < 0 || cfg.UtreexoFlushCacheUsage > 100 {
+		err := fmt.Errorf("%s: the --utreexoflushcacheusage "+
+			"option must be between 0 and 100", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoCompactGarbage < 0 || cfg.UtreexoCompactGarbage > 100 {
+		err := fmt.Errorf("%s: the --utreexocompactgarbage "+
+			"option must be between 0 and 100", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UtreexoFlushBatchSize < 0 {
+		err := fmt.Errorf("%s: the --utreexoflushbatchsize "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.BackgroundCPUPercent < 1 || cfg.BackgroundCPUPercent > 100 {
+		err := fmt.Errorf("%s: the --backgroundcpupercent "+
+			"option must be between 1 and 100", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the sync modes of the utreexo writes.
+	writeModes := []struct {
+		flag string
+		mode string
+	}{
+		{"--utreexoconsistencywrites", cfg.UtreexoConsistencyWrites},
+		{"--utreexonodewrites", cfg.UtreexoNodeWrites},
+		{"--utreexoproofwrites", cfg.UtreexoProofWrites},
+		{"--utreexoundowrites", cfg.UtreexoUndoWrites},
+	}
+	for _, wm := range writeModes {
+		if wm.mode != writeModeSync && wm.mode != writeModeAsync {
+			err := fmt.Errorf("%s: the %s option must be either "+
+				"%q or %q -- got %q", funcName, wm.flag,
+				writeModeSync, writeModeAsync, wm.mode)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	if cfg.UtreexoProofCacheSize < 0 {
+		err := fmt.Errorf("%s: the --utreexoproofcachesize "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ServedProofCacheSize < 0 {
+		err := fmt.Errorf("%s: the --servedproofcachesize "+
+			"option may not be negative", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	switch cfg.ProofAccessClients {
+	case proofClientsNone, proofClientsTruncated, proofClientsFull:
+	default:
+		err := fmt.Errorf("%s: the --proofaccessclients option must be "+
+			"one of %q, %q or %q -- got %q", funcName, proofClientsNone,
+			proofClientsTruncated, proofClientsFull, cfg.ProofAccessClients)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ProofAccessClients != proofClientsNone && !cfg.ProofAccessStats {
+		err := fmt.Errorf("%s: the --proofaccessclients option requires "+
+			"--proofaccessstats", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.MaxProofTargets < 1 || cfg.MaxProofBytes < 1 ||
+		cfg.MaxPeerProofRequests < 1 {
+
+		err := fmt.Errorf("%s: the --maxprooftargets, --maxproofbytes "+
+			"and --maxpeerproofrequests options must be positive",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -1025,6 +1559,51 @@ func loadConfig() (*config, []string, error) {
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
 		activeNetParams.DefaultPort)
 
+	// Parse the services to advertise on each listener and make sure they
+	// are given for listener addresses that are actually used.
+	if len(cfg.ListenServices) > 0 {
+		listeners := make(map[string]struct{}, len(cfg.Listeners))
+		for _, addr := range cfg.Listeners {
+			listeners[addr] = struct{}{}
+		}
+
+		cfg.listenServices = make(map[string]wire.ServiceFlag, len(cfg.ListenServices))
+		for _, option := range cfg.ListenServices {
+			addr, services, err := parseListenServices(option)
+			if err != nil {
+				err := fmt.Errorf("%s: invalid --listenservices "+
+					"option: %v", funcName, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+
+			addr = normalizeAddress(addr, activeNetParams.DefaultPort)
+			if _, ok := listeners[addr]; !ok {
+				str := "%s: --listenservices is given for %s " +
+					"which isn't a listen address"
+				err := fmt.Errorf(str, funcName, addr)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			cfg.listenServices[addr] = services
+		}
+	}
+
+	// Parse the proof sources.
+	for _, option := range cfg.ProofSources {
+		source, err := parseProofSource(option, activeNetParams.DefaultPort)
+		if err != nil {
+			err := fmt.Errorf("%s: invalid --proofsource option: %v",
+				funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.proofSources = append(cfg.proofSources, source)
+	}
+
 	// Add default port to all rpc listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
@@ -1060,6 +1639,27 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// The gRPC server shares the TLS certificate and the credentials of the
+	// RPC server.
+	if len(cfg.GRPCListeners) > 0 && (cfg.DisableRPC || cfg.DisableTLS) {
+		str := "%s: the --grpclisten option may not be used with " +
+			"--norpc or --notls"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, addr := range cfg.GRPCListeners {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			str := "%s: The grpclisten option must be a valid " +
+				"interface/port -- parsed [%v]: %v"
+			err := fmt.Errorf(str, funcName, addr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Add default port to all added peer addresses if needed and remove
 	// duplicate addresses.
 	cfg.AddPeers = normalizeAddresses(cfg.AddPeers,
@@ -1192,16 +1792,358 @@ func loadConfig() (*config, []string, error) {
 		cfg.oniondial = cfg.dial
 	}
 
+	// Setup the dial functions of the connection classes that have a proxy
+	// of their own.  The connections of the other classes are dialed with
+	// the normal dial function selected above.  This allows for example the
+	// proofs a CSN fetches to go over tor while blocks are relayed over
+	// clearnet.
+	for class, proxy := range map[connClass]string{
+		connClassFullRelay:  cfg.FullRelayProxy,
+		connClassBlockRelay: cfg.BlockRelayProxy,
+		connClassProof:      cfg.ProofProxy,
+	} {
+		if proxy == "" {
+			continue
+		}
+		dial, err := classDialFunc(proxy, cfg.TorIsolation)
+		if err != nil {
+			str := "%s: The %s proxy address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, class, proxy, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.classDials[class] = dial
+		cfg.classProxies[class] = proxy
+	}
+
+	// --hybridvalidation requires one of the utreexo proof indexes as they
+	// maintain the accumulator alongside the UTXO set.
+	if cfg.HybridValidation && !cfg.UtreexoProofIndex && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --hybridvalidation option requires "+
+			"either --utreexoproofindex or --flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --leafdataindex requires one of the utreexo proof indexes as they
+	// map the positions in the accumulator to the leaves.
+	if cfg.LeafDataIndex && !cfg.UtreexoProofIndex && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --leafdataindex option requires "+
+			"either --utreexoproofindex or --flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --proofpruneheight only applies to the flat utreexo proof index.
+	if cfg.ProofPruneHeight < 0 {
+		err := fmt.Errorf("%s: the --proofpruneheight option may not be "+
+			"negative -- parsed [%d]", funcName, cfg.ProofPruneHeight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ProofPruneHeight != 0 && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --proofpruneheight option requires "+
+			"--flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the daily windows that the heavy compactions of the utreexo
+	// proof indexes are done in.
+	if len(cfg.CompactionWindows) > 0 && !cfg.UtreexoProofIndex &&
+		!cfg.FlatUtreexoProofIndex {
+
+		err := fmt.Errorf("%s: the --compactionwindow option requires "+
+			"either --utreexoproofindex or --flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, s := range cfg.CompactionWindows {
+		window, err := indexers.ParseCompactionWindow(s)
+		if err != nil {
+			str := "%s: The compactionwindow option is invalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.compactWindows = append(cfg.compactWindows, window)
+	}
+
+	cfg.experimental, err = parseExperimentalFlags(cfg.Experimental,
+		activeNetParams.Net)
+	if err != nil {
+		str := "%s: The experimental option is invalid: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, name := range experimentalFlagNames() {
+		if cfg.experimentalEnabled(name) {
+			btcdLog.Warnf("Experimental feature %s is enabled: %s",
+				name, experimentalFlags[name])
+		}
+	}
+
+	// --conformance connects a fixed chain of regtest blocks and serves the
+	// proofs of its blocks which are kept by the utreexo proof indexes.
+	if cfg.Conformance && !cfg.RegressionTest {
+		err := fmt.Errorf("%s: the --conformance option requires "+
+			"--regtest", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.Conformance && !cfg.UtreexoProofIndex && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --conformance option requires "+
+			"either --utreexoproofindex or --flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --peerbloomfilters and --nopeerbloomfilters contradict each other.
+	if cfg.PeerBloomFilters && cfg.NoPeerBloomFilters {
+		err := fmt.Errorf("%s: the --peerbloomfilters and "+
+			"--nopeerbloomfilters options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxPeerFilteredBlocks < 0 {
+		err := fmt.Errorf("%s: the --maxpeerfilteredblocks option may "+
+			"not be negative -- parsed [%d]", funcName,
+			cfg.MaxPeerFilteredBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --proofretention only applies to the flat utreexo proof index and must
+	// keep enough blocks to undo reorgs.
+	if cfg.ProofRetention != 0 && cfg.ProofRetention < indexers.MinProofRetention {
+		err := fmt.Errorf("%s: the --proofretention option must be at "+
+			"least %d -- parsed [%d]", funcName, indexers.MinProofRetention,
+			cfg.ProofRetention)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ProofRetention != 0 && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --proofretention option requires "+
+			"--flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.UndoRetention < 1 {
+		err := fmt.Errorf("%s: the --undoretention option must be at "+
+			"least 1 -- parsed [%d]", funcName, cfg.UndoRetention)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.RollbackSnapshots < 0 {
+		err := fmt.Errorf("%s: the --rollbacksnapshots option may not be "+
+			"negative -- parsed [%d]", funcName, cfg.RollbackSnapshots)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.RootSnapshotInterval < 0 {
+		err := fmt.Errorf("%s: the --rootsnapshotinterval option may not "+
+			"be negative -- parsed [%d]", funcName, cfg.RootSnapshotInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --rollbacksnapshots snapshots the accumulator of the utreexo proof
+	// indexes.
+	if cfg.RollbackSnapshots > 0 && !cfg.UtreexoProofIndex && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --rollbacksnapshots option requires "+
+			"either --utreexoproofindex or --flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The read replicas read the proofs from the flat files of the flat
+	// utreexo proof index, which only keeps them when the node isn't pruned.
+	if cfg.ReadReplicaDir != "" {
+		if !cfg.FlatUtreexoProofIndex || cfg.Prune != 0 {
+			err := fmt.Errorf("%s: the --readreplicadir option requires "+
+				"--flatutreexoproofindex and --prune=0", funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.ReadReplicaInterval <= 0 {
+			err := fmt.Errorf("%s: the --readreplicainterval option "+
+				"must be positive -- parsed [%v]", funcName,
+				cfg.ReadReplicaInterval)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.ReadReplicaDir = cleanAndExpandPath(cfg.ReadReplicaDir)
+	}
+
+	// --leafttls requires the flat utreexo proof index as it's the one that
+	// keeps them.
+	if cfg.LeafTTLs && !cfg.FlatUtreexoProofIndex {
+		err := fmt.Errorf("%s: the --leafttls option requires "+
+			"--flatutreexoproofindex", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --csn can't be combined with any of the options that need more than
+	// the roots of the accumulator.
+	if cfg.CSN {
+		if conflicts := csnConflicts(&cfg); len(conflicts) > 0 {
+			err := fmt.Errorf("%s: the --csn option can't be used "+
+				"with %s", funcName, strings.Join(conflicts, ", "))
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Set --noutreexo to true if either of the utreexo bridges are enabled.
 	if cfg.UtreexoProofIndex || cfg.FlatUtreexoProofIndex {
 		cfg.NoUtreexo = true
 	}
 
+	// Blocks from Bitcoin Core come without utreexo proofs so only nodes
+	// that keep the full UTXO set can be bridged with it.
+	if cfg.CoreRPC != "" {
+		if !cfg.NoUtreexo {
+			str := "%s: the --corerpc option requires --noutreexo " +
+				"or one of the utreexo proof indexes"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if _, _, err := net.SplitHostPort(cfg.CoreRPC); err != nil {
+			str := "%s: The corerpc option must be a valid " +
+				"host:port -- parsed [%v]: %v"
+			err := fmt.Errorf(str, funcName, cfg.CoreRPC, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	} else if cfg.CoreZMQRawBlock != "" || cfg.CoreZMQRawTx != "" {
+		str := "%s: the --corezmqrawblock and --corezmqrawtx options " +
+			"require --corerpc"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the leader to replicate the blocks of.
+	if cfg.ReplicateFrom != "" {
+		if _, _, err := net.SplitHostPort(cfg.ReplicateFrom); err != nil {
+			str := "%s: The replicatefrom option must be a valid " +
+				"host:port -- parsed [%v]: %v"
+			err := fmt.Errorf(str, funcName, cfg.ReplicateFrom, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.ReplicateCert != "" {
+			cfg.ReplicateCert = cleanAndExpandPath(cfg.ReplicateCert)
+		}
+	} else if cfg.ReplicateCert != "" || cfg.ReplicateUser != "" ||
+		cfg.ReplicatePass != "" {
+
+		str := "%s: the --replicatecert, --replicateuser and " +
+			"--replicatepass options require --replicatefrom"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Set --noassumeutreexo if the node is not a utreexo node.
 	if cfg.NoUtreexo {
 		cfg.NoAssumeUtreexo = true
 	}
 
+	// Parse the assume utreexo point given by the user.  It can only be
+	// used by utreexo nodes that start from an assume utreexo point.
+	if cfg.AssumeUtreexo != "" {
+		if cfg.NoAssumeUtreexo {
+			str := "%s: the --assumeutreexo option can't be used " +
+				"with --noassumeutreexo or when the node isn't a " +
+				"utreexo compact state node"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+
+		cfg.assumeUtreexo, err = parseAssumeUtreexo(cfg.AssumeUtreexo,
+			activeNetParams.Params)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Setup the networks automatic outbound connections are made to.  Onion
+	// addresses are only reachable through a proxy and i2p addresses can't
+	// be reached at all, but both are still stored and relayed to peers.
+	cfg.reachableNets = make(map[string]struct{})
+	if len(cfg.OnlyNet) == 0 {
+		cfg.reachableNets[wire.NetworkIPv4] = struct{}{}
+		cfg.reachableNets[wire.NetworkIPv6] = struct{}{}
+		if !cfg.NoOnion && (cfg.Proxy != "" || cfg.OnionProxy != "") {
+			cfg.reachableNets[wire.NetworkOnion] = struct{}{}
+		}
+	}
+	for _, network := range cfg.OnlyNet {
+		network = strings.ToLower(network)
+		switch network {
+		case wire.NetworkIPv4, wire.NetworkIPv6:
+		case wire.NetworkOnion:
+			if cfg.NoOnion || (cfg.Proxy == "" &&
+				cfg.OnionProxy == "" && !cfg.ListenOnion) {
+
+				str := "%s: --onlynet=onion requires a proxy to " +
+					"reach tor hidden services"
+				err := fmt.Errorf(str, funcName)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		default:
+			str := "%s: the network '%s' given with --onlynet is " +
+				"not one of ipv4, ipv6 or onion"
+			err := fmt.Errorf(str, funcName, network)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.reachableNets[network] = struct{}{}
+	}
+
 	// Specifying --noonion means the onion address dial function results in
 	// an error.
 	if cfg.NoOnion {
@@ -1233,6 +2175,14 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if !cfg.WatchOnlyWallet && len(cfg.RegisterDescriptorsToWatchOnlyWallet) > 0 {
+		err := fmt.Errorf("%s: the --registerdescriptorstowatchonlywallet requires the --watchonlywallet option on "+
+			"at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	if !cfg.WatchOnlyWallet && len(cfg.RegisterExtendedPubKeysWithAddrTypeToWatchOnlyWallet) > 0 {
 		err := fmt.Errorf("%s: the --registerextendedpubkeyswithaddresstypetowatchonlywallet requires the --watchonlywallet option on "+
 			"at the same time", funcName)
@@ -1302,6 +2252,44 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.Prune != 0 && cfg.LeafDataIndex {
+		err := fmt.Errorf("%s: the --prune and --leafdataindex options may "+
+			"not be activated at the same time. Set --prune=0 to disable pruning.", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The blocks to catch up the indexes from in the background may have
+	// been pruned.
+	if cfg.Prune != 0 && cfg.DeferIndexSync {
+		err := fmt.Errorf("%s: the --prune and --deferindexsync options may "+
+			"not be activated at the same time. Set --prune=0 to disable pruning.", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --proofpruneheight drops the proofs that a pruned node doesn't keep
+	// in the first place.
+	if cfg.Prune != 0 && cfg.ProofPruneHeight != 0 {
+		err := fmt.Errorf("%s: the --prune and --proofpruneheight options may "+
+			"not be activated at the same time. Set --prune=0 to disable pruning.", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --proofretention drops the proofs that a pruned node doesn't keep in
+	// the first place.
+	if cfg.Prune != 0 && cfg.ProofRetention != 0 {
+		err := fmt.Errorf("%s: the --prune and --proofretention options may "+
+			"not be activated at the same time. Set --prune=0 to disable pruning.", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
 	// options.  Note this should go directly before the return.
@@ -1362,12 +2350,16 @@ func createDefaultConfigFile(destinationPath string) error {
 // dial function depending on the address and configuration options.  For
 // example, .onion addresses will be dialed using the onion specific proxy if
 // one was specified, but will otherwise use the normal dial function (which
-// could itself use a proxy or not).
+// could itself use a proxy or not).  Connections of a class with its own proxy
+// are dialed through that proxy.
 func btcdDial(addr net.Addr) (net.Conn, error) {
 	if strings.Contains(addr.String(), ".onion:") {
 		return cfg.oniondial(addr.Network(), addr.String(),
 			defaultConnectTimeout)
 	}
+	if dial := cfg.classDials[connClassOf(addr)]; dial != nil {
+		return dial(addr.Network(), addr.String(), defaultConnectTimeout)
+	}
 	return cfg.dial(addr.Network(), addr.String(), defaultConnectTimeout)
 }
 
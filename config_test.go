@@ -1,11 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg"
 )
 
 func TestCreateDefaultConfigFile(t *testing.T) {
@@ -50,3 +55,52 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Fatalf("Failed to create a default config file: %v", err)
 	}
 }
+
+func TestCSNConflicts(t *testing.T) {
+	cfg := &config{}
+	if conflicts := csnConflicts(cfg); len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", conflicts)
+	}
+
+	cfg.FlatUtreexoProofIndex = true
+	cfg.TxIndex = true
+	conflicts := csnConflicts(cfg)
+	want := []string{"--flatutreexoproofindex", "--txindex"}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Fatalf("expected conflicts %v, got %v", want, conflicts)
+	}
+}
+
+func TestParseAssumeUtreexo(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	hardcoded := params.AssumeUtreexoPoint
+	rootsHash := blockchain.UtreexoRootsHash(hardcoded.NumLeaves, hardcoded.Roots)
+
+	// The hard-coded point is used when it's the one given.
+	point, err := parseAssumeUtreexo(fmt.Sprintf("%d:%v",
+		hardcoded.BlockHeight, rootsHash), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*point, hardcoded) {
+		t.Fatalf("expected the hard-coded assume utreexo point, got %v", point)
+	}
+
+	// Any other point only has the height and the roots hash.
+	point, err = parseAssumeUtreexo(fmt.Sprintf("%d:%v", 900_000, rootsHash), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chaincfg.AssumeUtreexo{BlockHeight: 900_000, RootsHash: &rootsHash}
+	if !reflect.DeepEqual(*point, want) {
+		t.Fatalf("expected assume utreexo point %v, got %v", want, point)
+	}
+
+	for _, bad := range []string{"900000", "abc:" + rootsHash.String(),
+		"0:" + rootsHash.String(), "900000:", "900000:zz", "1:2:3"} {
+
+		if _, err := parseAssumeUtreexo(bad, params); err == nil {
+			t.Fatalf("expected an error parsing %q", bad)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// conformanceNumBlocks is the number of blocks in the conformance chain.
+	// The chain is long enough for the coinbases of the first blocks to
+	// mature so that the last blocks spend outputs and come with proofs.
+	conformanceNumBlocks = 120
+
+	// conformanceBlockInterval is the time between the timestamps of the
+	// blocks in the conformance chain.
+	conformanceBlockInterval = time.Minute * 10
+)
+
+// conformanceScript is the public key script of every output created in the
+// conformance chain.  It's spendable with an empty signature script.
+var conformanceScript = []byte{txscript.OP_TRUE}
+
+// conformanceBlocks returns the blocks of the conformance chain that builds on
+// the genesis block of the given network.  The blocks are always the same for
+// the same network.
+//
+// Once the coinbases start to mature, every block spends the coinbase of the
+// block that's CoinbaseMaturity blocks below it along with the output that the
+// previous block created by spending a coinbase.  This makes the proofs of the
+// blocks cover both old leaves and leaves that were just added.
+func conformanceBlocks(params *chaincfg.Params) ([]*btcutil.Block, error) {
+	genesis := params.GenesisBlock
+	blocks := make([]*btcutil.Block, 0, conformanceNumBlocks)
+
+	prevHash := genesis.BlockHash()
+	var coinbases []*wire.MsgTx
+	var prevSpend *wire.MsgTx
+	for height := int32(1); height <= conformanceNumBlocks; height++ {
+		coinbaseScript, err := txscript.NewScriptBuilder().
+			AddInt64(int64(height)).AddInt64(0).Script()
+		if err != nil {
+			return nil, err
+		}
+		coinbase := wire.NewMsgTx(1)
+		coinbase.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+				wire.MaxPrevOutIndex),
+			SignatureScript: coinbaseScript,
+			Sequence:        wire.MaxTxInSequenceNum,
+		})
+		coinbase.AddTxOut(wire.NewTxOut(
+			blockchain.CalcBlockSubsidy(height, params), conformanceScript))
+		txns := []*wire.MsgTx{coinbase}
+
+		matureIdx := int(height) - 1 - int(params.CoinbaseMaturity)
+		if matureIdx >= 0 {
+			spend := wire.NewMsgTx(1)
+			value := coinbases[matureIdx].TxOut[0].Value
+			spend.AddTxIn(&wire.TxIn{
+				PreviousOutPoint: wire.OutPoint{
+					Hash: coinbases[matureIdx].TxHash(),
+				},
+				Sequence: wire.MaxTxInSequenceNum,
+			})
+			if prevSpend != nil {
+				value += prevSpend.TxOut[0].Value
+				spend.AddTxIn(&wire.TxIn{
+					PreviousOutPoint: wire.OutPoint{
+						Hash: prevSpend.TxHash(),
+					},
+					Sequence: wire.MaxTxInSequenceNum,
+				})
+			}
+
+			// Split the value in two so that the leaves added by the
+			// blocks aren't all coinbases.
+			spend.AddTxOut(wire.NewTxOut(value/2, conformanceScript))
+			spend.AddTxOut(wire.NewTxOut(value-value/2, conformanceScript))
+			txns = append(txns, spend)
+			prevSpend = spend
+		}
+		coinbases = append(coinbases, coinbase)
+
+		utilTxns := make([]*btcutil.Tx, 0, len(txns))
+		for _, tx := range txns {
+			utilTxns = append(utilTxns, btcutil.NewTx(tx))
+		}
+		merkles := blockchain.BuildMerkleTreeStore(utilTxns, false)
+
+		msgBlock := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Version:    1,
+				PrevBlock:  prevHash,
+				MerkleRoot: *merkles[len(merkles)-1],
+				Timestamp: genesis.Header.Timestamp.Add(
+					conformanceBlockInterval * time.Duration(height)),
+				Bits: params.PowLimitBits,
+			},
+			Transactions: txns,
+		}
+
+		// Solve the block by trying the nonces in order so that the
+		// same nonce is always found.
+		target := blockchain.CompactToBig(msgBlock.Header.Bits)
+		for {
+			hash := msgBlock.Header.BlockHash()
+			if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+				break
+			}
+			if msgBlock.Header.Nonce == ^uint32(0) {
+				return nil, fmt.Errorf("unable to solve the "+
+					"conformance block at height %d", height)
+			}
+			msgBlock.Header.Nonce++
+		}
+
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		blocks = append(blocks, block)
+		prevHash = msgBlock.Header.BlockHash()
+	}
+
+	return blocks, nil
+}
+
+// conformanceCheckpoint returns the checkpoint at the last block of the given
+// conformance chain.  It keeps the chain from being reorganized away by blocks
+// from the peers.
+func conformanceCheckpoint(blocks []*btcutil.Block) chaincfg.Checkpoint {
+	last := blocks[len(blocks)-1]
+	return chaincfg.Checkpoint{Height: last.Height(), Hash: last.Hash()}
+}
+
+// connectConformanceBlocks connects the blocks of the conformance chain that
+// aren't connected yet.  An error is returned when the chain has different
+// blocks at the heights of the conformance chain.
+func connectConformanceBlocks(chain *blockchain.BlockChain, blocks []*btcutil.Block) error {
+	for _, block := range blocks {
+		best := chain.BestSnapshot()
+		if block.Height() <= best.Height {
+			hash, err := chain.BlockHashByHeight(block.Height())
+			if err != nil {
+				return err
+			}
+			if !hash.IsEqual(block.Hash()) {
+				return fmt.Errorf("the chain has block %v at height "+
+					"%d instead of the conformance block %v. Start "+
+					"with an empty data directory to use --conformance",
+					hash, block.Height(), block.Hash())
+			}
+			continue
+		}
+
+		isMainChain, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			return fmt.Errorf("unable to connect the conformance block "+
+				"%v at height %d: %v", block.Hash(), block.Height(), err)
+		}
+		if !isMainChain || isOrphan {
+			return fmt.Errorf("the conformance block %v at height %d "+
+				"wasn't connected to the main chain", block.Hash(),
+				block.Height())
+		}
+	}
+
+	srvrLog.Infof("Connected the %d blocks of the conformance chain",
+		len(blocks))
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg"
+)
+
+func TestConformanceBlocks(t *testing.T) {
+	// The log rotator isn't initialized in tests, so keep the subsystems
+	// from writing to it.
+	setLogLevels("off")
+
+	blocks, err := conformanceBlocks(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != conformanceNumBlocks {
+		t.Fatalf("expected %d blocks, got %d", conformanceNumBlocks, len(blocks))
+	}
+
+	// The same blocks must be generated every time.
+	again, err := conformanceBlocks(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range blocks {
+		if !blocks[i].Hash().IsEqual(again[i].Hash()) {
+			t.Fatalf("block at height %d differs between runs: %v vs %v",
+				blocks[i].Height(), blocks[i].Hash(), again[i].Hash())
+		}
+	}
+
+	chain, teardown, err := blockchain.ChainSetup("conformanceblocks",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardown()
+
+	// The blocks must be valid and connecting them again must be a no-op.
+	for i := 0; i < 2; i++ {
+		err = connectConformanceBlocks(chain, blocks)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	best := chain.BestSnapshot()
+	last := blocks[len(blocks)-1]
+	if best.Height != last.Height() || best.Hash != *last.Hash() {
+		t.Fatalf("expected the tip at %v(%d), got %v(%d)", last.Hash(),
+			last.Height(), best.Hash, best.Height)
+	}
+
+	// The blocks of another chain mustn't be accepted in place of the
+	// conformance chain.
+	other, err := conformanceBlocks(&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connectConformanceBlocks(chain, other); err == nil {
+		t.Fatalf("expected an error for blocks that aren't in the chain")
+	}
+}
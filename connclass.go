@@ -0,0 +1,142 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/go-socks/socks"
+)
+
+// directConnection is the proxy setting of a connection class whose
+// connections are made without a proxy.
+const directConnection = "direct"
+
+// connClass is the class of an outbound connection.  The connections of each
+// class may be made through their own proxy.
+type connClass uint8
+
+const (
+	// connClassFullRelay is an outbound connection that relays blocks,
+	// transactions and addresses.
+	connClassFullRelay connClass = iota
+
+	// connClassBlockRelay is an outbound connection that only relays
+	// blocks.  Neither transactions nor addresses are relayed over it.
+	connClassBlockRelay
+
+	// connClassProof is a full-relay outbound connection of a utreexo CSN.
+	// The proofs for the transactions the CSN learns about are requested
+	// over it.
+	connClassProof
+
+	// numConnClasses is the number of connection classes.
+	numConnClasses
+)
+
+// connClassStrings is a map of connection classes back to their constant names
+// for pretty printing.
+var connClassStrings = map[connClass]string{
+	connClassFullRelay:  "full-relay",
+	connClassBlockRelay: "block-relay",
+	connClassProof:      "proof",
+}
+
+// String returns the connection class in human-readable form.
+func (c connClass) String() string {
+	if s, ok := connClassStrings[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown connClass (%d)", uint8(c))
+}
+
+// classAddr is the address of an outbound connection tagged with the class of
+// the connection and whether it's made with the v1 transport.
+type classAddr struct {
+	net.Addr
+	class connClass
+	v1    bool
+}
+
+// connClassOf returns the class of the outbound connection made to addr.
+// Addresses that weren't tagged are for full-relay connections.
+func connClassOf(addr net.Addr) connClass {
+	if ca, ok := addr.(*classAddr); ok {
+		return ca.class
+	}
+	return connClassFullRelay
+}
+
+// connClassProxy returns the address of the proxy the connections of the class
+// are made through or an empty string when they're made directly.
+func connClassProxy(class connClass) string {
+	switch proxy := cfg.classProxies[class]; proxy {
+	case "":
+		return cfg.Proxy
+	case directConnection:
+		return ""
+	default:
+		return proxy
+	}
+}
+
+// classDialFunc returns the function that dials the connections of a class with
+// the given proxy setting, which is either the address of a SOCKS5 proxy or
+// "direct".
+func classDialFunc(proxy string, torIsolation bool) (func(string, string, time.Duration) (net.Conn, error), error) {
+	if proxy == directConnection {
+		return net.DialTimeout, nil
+	}
+
+	_, _, err := net.SplitHostPort(proxy)
+	if err != nil {
+		return nil, err
+	}
+	p := &socks.Proxy{
+		Addr:         proxy,
+		TorIsolation: torIsolation,
+	}
+	return p.DialTimeout, nil
+}
+
+// blockRelaySlots keeps track of how many of the automatic outbound
+// connections are block-relay-only, counting the ones that are still being
+// dialed.
+type blockRelaySlots struct {
+	mtx  sync.Mutex
+	max  int
+	used int
+}
+
+// reserve takes a slot for a block-relay-only connection and returns whether
+// there was one free.
+//
+// This function is safe for concurrent access.
+func (s *blockRelaySlots) reserve() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.used >= s.max {
+		return false
+	}
+	s.used++
+	return true
+}
+
+// release frees the slot of a block-relay-only connection that failed or was
+// disconnected.
+//
+// This function is safe for concurrent access.
+func (s *blockRelaySlots) release() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.used > 0 {
+		s.used--
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/utreexo/utreexod/connmgr"
+)
+
+func TestConnClassOf(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8333}
+	if class := connClassOf(addr); class != connClassFullRelay {
+		t.Fatalf("expected an untagged address to be %v, got %v",
+			connClassFullRelay, class)
+	}
+
+	for class := connClassFullRelay; class < numConnClasses; class++ {
+		tagged := &classAddr{Addr: addr, class: class}
+		if got := connClassOf(tagged); got != class {
+			t.Fatalf("expected %v, got %v", class, got)
+		}
+		if tagged.String() != addr.String() ||
+			tagged.Network() != addr.Network() {
+
+			t.Fatalf("the %v address %v doesn't match %v", class,
+				tagged, addr)
+		}
+	}
+}
+
+func TestUseV2Transport(t *testing.T) {
+	oldCfg := cfg
+	cfg = &config{}
+	defer func() { cfg = oldCfg }()
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8333}
+	if !useV2Transport(addr) ||
+		!useV2Transport(&classAddr{Addr: addr, class: connClassProof}) {
+
+		t.Fatal("expected the v2 transport for the peers of the user")
+	}
+	if useV2Transport(&classAddr{Addr: addr, v1: true}) {
+		t.Fatal("expected the v1 transport for peers without v2")
+	}
+
+	// Peers that fail the handshake keep their class and are connected to
+	// again with v1.
+	sp := &serverPeer{
+		connReq:   &connmgr.ConnReq{Addr: &classAddr{Addr: addr, class: connClassBlockRelay}},
+		connClass: connClassBlockRelay,
+	}
+	fallBackToV1(sp)
+	if useV2Transport(sp.connReq.Addr) {
+		t.Fatal("expected the v1 transport after falling back")
+	}
+	if class := connClassOf(sp.connReq.Addr); class != connClassBlockRelay ||
+		sp.connReq.Addr.String() != addr.String() {
+
+		t.Fatalf("expected the %v address %v, got the %v address %v",
+			connClassBlockRelay, addr, class, sp.connReq.Addr)
+	}
+
+	cfg.NoV2Transport = true
+	if useV2Transport(addr) {
+		t.Fatal("expected the v1 transport with --nov2transport")
+	}
+}
+
+func TestClassDialFunc(t *testing.T) {
+	tests := []struct {
+		proxy string
+		valid bool
+	}{
+		{directConnection, true},
+		{"127.0.0.1:9050", true},
+		{"[::1]:9050", true},
+		{"127.0.0.1", false},
+		{"tor", false},
+	}
+	for _, test := range tests {
+		dial, err := classDialFunc(test.proxy, false)
+		if test.valid && (err != nil || dial == nil) {
+			t.Fatalf("%s: unexpected error: %v", test.proxy, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("%s: expected an error", test.proxy)
+		}
+	}
+}
+
+func TestBlockRelaySlots(t *testing.T) {
+	slots := blockRelaySlots{max: 2}
+	if !slots.reserve() || !slots.reserve() {
+		t.Fatal("expected to reserve both slots")
+	}
+	if slots.reserve() {
+		t.Fatal("reserved more slots than there are")
+	}
+
+	slots.release()
+	if !slots.reserve() {
+		t.Fatal("expected to reserve the released slot")
+	}
+
+	// Releasing more than was reserved doesn't make up extra slots.
+	for i := 0; i < 4; i++ {
+		slots.release()
+	}
+	if !slots.reserve() || !slots.reserve() || slots.reserve() {
+		t.Fatal("expected exactly two slots after releasing them all")
+	}
+}
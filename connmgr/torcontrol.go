@@ -0,0 +1,432 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// torControlTimeout is how long a reply to a command sent to the Tor
+	// control port is waited for.
+	torControlTimeout = 30 * time.Second
+
+	// torReplyOK is the status code of a successful reply.
+	torReplyOK = 250
+
+	// torSafeCookieServerKey and torSafeCookieClientKey are the keys of
+	// the HMACs exchanged for the SAFECOOKIE authentication method.
+	torSafeCookieServerKey = "Tor safe cookie authentication server-to-controller hash"
+	torSafeCookieClientKey = "Tor safe cookie authentication controller-to-server hash"
+
+	// torCookieLen is the length of the authentication cookie of Tor.
+	torCookieLen = 32
+
+	// torNonceLen is the length of the nonces of the SAFECOOKIE
+	// authentication method.
+	torNonceLen = 32
+)
+
+var (
+	// ErrTorNoAuthMethod indicates that none of the authentication methods
+	// the Tor control port accepts can be used.
+	ErrTorNoAuthMethod = errors.New("no supported tor control " +
+		"authentication method")
+
+	// ErrTorInvalidControlReply indicates the Tor control port replied in
+	// an unexpected format.
+	ErrTorInvalidControlReply = errors.New("invalid tor control reply")
+)
+
+// torReply is a reply of the Tor control port.  Every line of the reply
+// shares the same status code.
+type torReply struct {
+	code  int
+	lines []string
+}
+
+// OnionService is an onion service created through the Tor control port.
+type OnionService struct {
+	// ServiceID is the onion address of the service without the .onion
+	// suffix.
+	ServiceID string
+
+	// PrivateKey is the private key of the service in the KeyType:KeyBlob
+	// format the ADD_ONION command takes.  It's only set when the service
+	// was created with a new key.
+	PrivateKey string
+}
+
+// Hostname returns the .onion hostname of the service.
+func (s *OnionService) Hostname() string {
+	return s.ServiceID + ".onion"
+}
+
+// TorController is a client of the control port of a Tor daemon as described
+// in the Tor control protocol specification.  The onion services it creates are
+// removed by Tor once the controller is closed.
+type TorController struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// DialTorController connects to the Tor control port at the passed address and
+// authenticates with the password, if any, or the authentication cookie of Tor.
+func DialTorController(addr, password string) (*TorController, error) {
+	conn, err := net.DialTimeout("tcp", addr, torControlTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &TorController{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if err := c.authenticate(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the connection to the Tor control port.
+func (c *TorController) Close() error {
+	return c.conn.Close()
+}
+
+// readReply reads a reply of the Tor control port.  The lines of data replies
+// are joined to their keyword line with newlines.
+func (c *TorController) readReply() (*torReply, error) {
+	var reply torReply
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 4 {
+			return nil, ErrTorInvalidControlReply
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return nil, ErrTorInvalidControlReply
+		}
+		if reply.code != 0 && reply.code != code {
+			return nil, ErrTorInvalidControlReply
+		}
+		reply.code = code
+
+		text := line[4:]
+		switch line[3] {
+		case ' ':
+			reply.lines = append(reply.lines, text)
+			return &reply, nil
+
+		case '-':
+			reply.lines = append(reply.lines, text)
+
+		case '+':
+			// Data is read up to the line with a single dot.
+			for {
+				dataLine, err := c.reader.ReadString('\n')
+				if err != nil {
+					return nil, err
+				}
+				dataLine = strings.TrimRight(dataLine, "\r\n")
+				if dataLine == "." {
+					break
+				}
+				text += "\n" + strings.TrimPrefix(dataLine, ".")
+			}
+			reply.lines = append(reply.lines, text)
+
+		default:
+			return nil, ErrTorInvalidControlReply
+		}
+	}
+}
+
+// command sends the passed command to the Tor control port and returns the
+// lines of its reply.  An error is returned if the command didn't succeed.
+func (c *TorController) command(cmd string) ([]string, error) {
+	err := c.conn.SetDeadline(time.Now().Add(torControlTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write([]byte(cmd + "\r\n")); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	if reply.code != torReplyOK {
+		// Only the command name is reported as the arguments may
+		// hold credentials.
+		name := strings.SplitN(cmd, " ", 2)[0]
+		return nil, fmt.Errorf("tor control command %s failed: %d %s",
+			name, reply.code, strings.Join(reply.lines, " "))
+	}
+
+	return reply.lines, nil
+}
+
+// parseTorReplyArgs parses the space separated KEY=VALUE arguments of a reply
+// line.  Values may be quoted strings with backslash escapes.  Arguments
+// without a value are mapped to an empty string.
+func parseTorReplyArgs(s string) (map[string]string, error) {
+	args := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return args, nil
+		}
+
+		end := strings.IndexAny(s, "= ")
+		if end == -1 || s[end] == ' ' {
+			if end == -1 {
+				end = len(s)
+			}
+			args[s[:end]] = ""
+			s = s[end:]
+			continue
+		}
+		key := s[:end]
+		s = s[end+1:]
+
+		if !strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s, ' ')
+			if end == -1 {
+				end = len(s)
+			}
+			args[key] = s[:end]
+			s = s[end:]
+			continue
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return nil, ErrTorInvalidControlReply
+		}
+		args[key] = value.String()
+		s = s[i+1:]
+	}
+}
+
+// quoteTorString returns the passed string as a quoted string of the Tor
+// control protocol.
+func quoteTorString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// authenticate authenticates to the Tor control port with the first method it
+// accepts out of the password, if one is passed, the safe cookie, the cookie
+// and no authentication.
+func (c *TorController) authenticate(password string) error {
+	lines, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		return err
+	}
+	var methods, cookieFile string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "AUTH ") {
+			continue
+		}
+		args, err := parseTorReplyArgs(strings.TrimPrefix(line, "AUTH "))
+		if err != nil {
+			return err
+		}
+		methods = args["METHODS"]
+		cookieFile = args["COOKIEFILE"]
+	}
+	supported := make(map[string]struct{})
+	for _, method := range strings.Split(methods, ",") {
+		supported[method] = struct{}{}
+	}
+
+	_, hashedPassword := supported["HASHEDPASSWORD"]
+	_, safeCookie := supported["SAFECOOKIE"]
+	_, cookie := supported["COOKIE"]
+	_, null := supported["NULL"]
+	switch {
+	case password != "" && hashedPassword:
+		_, err := c.command("AUTHENTICATE " + quoteTorString(password))
+		return err
+
+	case safeCookie && cookieFile != "":
+		return c.authenticateSafeCookie(cookieFile)
+
+	case cookie && cookieFile != "":
+		cookie, err := readTorCookie(cookieFile)
+		if err != nil {
+			return err
+		}
+		_, err = c.command("AUTHENTICATE " + hex.EncodeToString(cookie))
+		return err
+
+	case null:
+		_, err := c.command("AUTHENTICATE")
+		return err
+	}
+
+	return ErrTorNoAuthMethod
+}
+
+// readTorCookie reads the authentication cookie of Tor from the passed file.
+func readTorCookie(cookieFile string) ([]byte, error) {
+	cookie, err := os.ReadFile(cookieFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(cookie) != torCookieLen {
+		return nil, fmt.Errorf("tor authentication cookie %s is %d "+
+			"bytes instead of %d", cookieFile, len(cookie),
+			torCookieLen)
+	}
+
+	return cookie, nil
+}
+
+// torSafeCookieHash returns the HMAC of the cookie and the nonces with the
+// passed key as used by the SAFECOOKIE authentication method.
+func torSafeCookieHash(key string, cookie, clientNonce, serverNonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(cookie)
+	mac.Write(clientNonce)
+	mac.Write(serverNonce)
+	return mac.Sum(nil)
+}
+
+// authenticateSafeCookie authenticates with the SAFECOOKIE method which proves
+// the knowledge of the cookie without sending it and checks that Tor knows it
+// as well.
+func (c *TorController) authenticateSafeCookie(cookieFile string) error {
+	cookie, err := readTorCookie(cookieFile)
+	if err != nil {
+		return err
+	}
+
+	clientNonce := make([]byte, torNonceLen)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return err
+	}
+	lines, err := c.command("AUTHCHALLENGE SAFECOOKIE " +
+		hex.EncodeToString(clientNonce))
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "AUTHCHALLENGE ") {
+		return ErrTorInvalidControlReply
+	}
+	args, err := parseTorReplyArgs(strings.TrimPrefix(lines[0],
+		"AUTHCHALLENGE "))
+	if err != nil {
+		return err
+	}
+	serverHash, err := hex.DecodeString(args["SERVERHASH"])
+	if err != nil {
+		return ErrTorInvalidControlReply
+	}
+	serverNonce, err := hex.DecodeString(args["SERVERNONCE"])
+	if err != nil || len(serverNonce) != torNonceLen {
+		return ErrTorInvalidControlReply
+	}
+
+	expected := torSafeCookieHash(torSafeCookieServerKey, cookie,
+		clientNonce, serverNonce)
+	if !hmac.Equal(serverHash, expected) {
+		return errors.New("tor control port doesn't know the " +
+			"authentication cookie")
+	}
+
+	clientHash := torSafeCookieHash(torSafeCookieClientKey, cookie,
+		clientNonce, serverNonce)
+	_, err = c.command("AUTHENTICATE " + hex.EncodeToString(clientHash))
+	return err
+}
+
+// AddOnion creates a v3 onion service that forwards the connections to the
+// passed virtual port to the target address.  The service is created with the
+// passed private key, as returned with a previously created service, or with a
+// new key when it's empty.
+func (c *TorController) AddOnion(privateKey string, virtPort uint16,
+	target string) (*OnionService, error) {
+
+	key := "NEW:ED25519-V3"
+	if privateKey != "" {
+		key = privateKey
+	}
+	cmd := fmt.Sprintf("ADD_ONION %s Port=%d,%s", key, virtPort, target)
+	lines, err := c.command(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var service OnionService
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "ServiceID="):
+			service.ServiceID = strings.TrimPrefix(line, "ServiceID=")
+		case strings.HasPrefix(line, "PrivateKey="):
+			service.PrivateKey = strings.TrimPrefix(line, "PrivateKey=")
+		}
+	}
+	if service.ServiceID == "" {
+		return nil, ErrTorInvalidControlReply
+	}
+
+	return &service, nil
+}
+
+// DelOnion removes the onion service with the passed service ID.
+func (c *TorController) DelOnion(serviceID string) error {
+	_, err := c.command("DEL_ONION " + serviceID)
+	return err
+}
+
+// SocksListener returns the address of the first SOCKS listener of Tor, which
+// connections to onion services are made through.
+func (c *TorController) SocksListener() (string, error) {
+	const key = "net/listeners/socks"
+	lines, err := c.command("GETINFO " + key)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, key+"=") {
+			continue
+		}
+		listeners := strings.Fields(strings.TrimPrefix(line, key+"="))
+		if len(listeners) == 0 {
+			break
+		}
+		return strings.Trim(listeners[0], `"`), nil
+	}
+
+	return "", errors.New("tor has no SOCKS listener")
+}
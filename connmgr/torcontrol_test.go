@@ -0,0 +1,228 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mockTorControl is a Tor control port that accepts a single connection and
+// replies to the commands with the passed handler.
+type mockTorControl struct {
+	listener net.Listener
+}
+
+// newMockTorControl starts a mock Tor control port.  The handler returns the
+// raw reply to each command.
+func newMockTorControl(t *testing.T, handler func(cmd string) string) *mockTorControl {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockTorControl{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			if _, err := conn.Write([]byte(handler(cmd))); err != nil {
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+// TestTorControlSafeCookie ensures the controller authenticates with the
+// SAFECOOKIE method and creates onion services.
+func TestTorControlSafeCookie(t *testing.T) {
+	cookie := bytes.Repeat([]byte{0x42}, torCookieLen)
+	cookieFile := filepath.Join(t.TempDir(), "control_auth_cookie")
+	if err := os.WriteFile(cookieFile, cookie, 0600); err != nil {
+		t.Fatal(err)
+	}
+	serverNonce := bytes.Repeat([]byte{0x07}, torNonceLen)
+
+	const serviceID = "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd"
+	var clientHash []byte
+	mock := newMockTorControl(t, func(cmd string) string {
+		switch {
+		case cmd == "PROTOCOLINFO 1":
+			return "250-PROTOCOLINFO 1\r\n" +
+				"250-AUTH METHODS=COOKIE,SAFECOOKIE " +
+				"COOKIEFILE=" + quoteTorString(cookieFile) + "\r\n" +
+				"250-VERSION Tor=\"0.4.8.9\"\r\n" +
+				"250 OK\r\n"
+
+		case strings.HasPrefix(cmd, "AUTHCHALLENGE SAFECOOKIE "):
+			clientNonce, _ := hex.DecodeString(strings.TrimPrefix(
+				cmd, "AUTHCHALLENGE SAFECOOKIE "))
+			serverHash := torSafeCookieHash(torSafeCookieServerKey,
+				cookie, clientNonce, serverNonce)
+			clientHash = torSafeCookieHash(torSafeCookieClientKey,
+				cookie, clientNonce, serverNonce)
+			return fmt.Sprintf("250 AUTHCHALLENGE SERVERHASH=%x "+
+				"SERVERNONCE=%x\r\n", serverHash, serverNonce)
+
+		case strings.HasPrefix(cmd, "AUTHENTICATE "):
+			if cmd != "AUTHENTICATE "+hex.EncodeToString(clientHash) {
+				return "515 Authentication failed\r\n"
+			}
+			return "250 OK\r\n"
+
+		case cmd == "ADD_ONION NEW:ED25519-V3 Port=8333,127.0.0.1:40000":
+			return "250-ServiceID=" + serviceID + "\r\n" +
+				"250-PrivateKey=ED25519-V3:secret\r\n" +
+				"250 OK\r\n"
+
+		case cmd == "ADD_ONION ED25519-V3:secret Port=8333,127.0.0.1:40000":
+			return "250-ServiceID=" + serviceID + "\r\n" +
+				"250 OK\r\n"
+
+		case cmd == "GETINFO net/listeners/socks":
+			return "250-net/listeners/socks=\"127.0.0.1:9050\" " +
+				"\"127.0.0.1:9150\"\r\n250 OK\r\n"
+		}
+
+		return "510 Unrecognized command\r\n"
+	})
+
+	c, err := DialTorController(mock.listener.Addr().String(), "")
+	if err != nil {
+		t.Fatalf("unable to authenticate: %v", err)
+	}
+	defer c.Close()
+
+	service, err := c.AddOnion("", 8333, "127.0.0.1:40000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &OnionService{ServiceID: serviceID, PrivateKey: "ED25519-V3:secret"}
+	if !reflect.DeepEqual(service, want) {
+		t.Fatalf("unexpected service: got %+v, want %+v", service, want)
+	}
+	if service.Hostname() != serviceID+".onion" {
+		t.Fatalf("unexpected hostname %s", service.Hostname())
+	}
+
+	// The service is recreated with the same address from its key.
+	service, err = c.AddOnion(want.PrivateKey, 8333, "127.0.0.1:40000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.ServiceID != serviceID || service.PrivateKey != "" {
+		t.Fatalf("unexpected service: %+v", service)
+	}
+
+	socks, err := c.SocksListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if socks != "127.0.0.1:9050" {
+		t.Fatalf("unexpected socks listener %s", socks)
+	}
+
+	if err := c.DelOnion(serviceID); err == nil {
+		t.Fatal("expected an error for the failed command")
+	}
+}
+
+// TestTorControlPassword ensures the controller authenticates with the password
+// when one is passed and that a rejected password is reported.
+func TestTorControlPassword(t *testing.T) {
+	handler := func(cmd string) string {
+		switch cmd {
+		case "PROTOCOLINFO 1":
+			return "250-PROTOCOLINFO 1\r\n" +
+				"250-AUTH METHODS=HASHEDPASSWORD\r\n" +
+				"250 OK\r\n"
+		case `AUTHENTICATE "pass\"word"`:
+			return "250 OK\r\n"
+		}
+		return "515 Authentication failed\r\n"
+	}
+
+	mock := newMockTorControl(t, handler)
+	c, err := DialTorController(mock.listener.Addr().String(), `pass"word`)
+	if err != nil {
+		t.Fatalf("unable to authenticate: %v", err)
+	}
+	c.Close()
+
+	mock = newMockTorControl(t, handler)
+	_, err = DialTorController(mock.listener.Addr().String(), "wrong")
+	if err == nil {
+		t.Fatal("expected an error for the wrong password")
+	}
+
+	// A password is needed when it's the only method.
+	mock = newMockTorControl(t, handler)
+	_, err = DialTorController(mock.listener.Addr().String(), "")
+	if err != ErrTorNoAuthMethod {
+		t.Fatalf("expected ErrTorNoAuthMethod, got %v", err)
+	}
+}
+
+// TestParseTorReplyArgs ensures the arguments of the replies of the Tor control
+// port are parsed correctly.
+func TestParseTorReplyArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{
+			in: `METHODS=COOKIE,SAFECOOKIE COOKIEFILE="/var/lib/tor/control_auth_cookie"`,
+			want: map[string]string{
+				"METHODS":    "COOKIE,SAFECOOKIE",
+				"COOKIEFILE": "/var/lib/tor/control_auth_cookie",
+			},
+		},
+		{
+			in: `COOKIEFILE="C:\\tor\\cookie \"x\"" FLAG`,
+			want: map[string]string{
+				"COOKIEFILE": `C:\tor\cookie "x"`,
+				"FLAG":       "",
+			},
+		},
+		{
+			in:   "",
+			want: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		got, err := parseTorReplyArgs(test.in)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.in, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+
+	if _, err := parseTorReplyArgs(`KEY="unterminated`); err == nil {
+		t.Fatal("expected an error for an unterminated string")
+	}
+}
@@ -0,0 +1,510 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package corebridge cross-feeds blocks and transactions between utreexod and a
+// trusted Bitcoin Core node so that utreexod can serve utreexo proofs next to an
+// existing Core deployment.
+//
+// Blocks and transactions are received from Core over its ZMQ notifications,
+// or for blocks by polling its RPC server, and the ones utreexod learns about
+// from its own peers are submitted to Core over RPC.
+package corebridge
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/mempool"
+	"github.com/utreexo/utreexod/rpcclient"
+	"github.com/utreexo/utreexod/wire"
+	"github.com/utreexo/utreexod/zmq"
+)
+
+const (
+	// DefaultPollInterval is how often the tip of Core is polled when its
+	// blocks aren't received over ZMQ.
+	DefaultPollInterval = 10 * time.Second
+
+	// retryInterval is how long to wait before reconnecting to a ZMQ
+	// endpoint of Core.
+	retryInterval = 10 * time.Second
+
+	// maxParentFetches is how many missing parents of a block from Core
+	// are fetched before giving up and leaving the rest to the sync with
+	// the peers.
+	maxParentFetches = 100
+
+	// maxRecentHashes is how many hashes of the blocks and transactions
+	// received from Core are remembered so they aren't sent back.
+	maxRecentHashes = 5000
+
+	// submitQueueSize is how many blocks and transactions may be waiting
+	// to be submitted to Core.  Any more are dropped.
+	submitQueueSize = 1000
+)
+
+// coreClient is the RPC client of Core.  It's satisfied by *rpcclient.Client.
+type coreClient interface {
+	GetBestBlockHash() (*chainhash.Hash, error)
+	GetBlock(hash *chainhash.Hash) (*wire.MsgBlock, error)
+	SubmitBlock(block *btcutil.Block, options *btcjson.SubmitBlockOptions) error
+	SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainhash.Hash, error)
+	Shutdown()
+}
+
+// Chain is the chain of utreexod.  It's satisfied by *blockchain.BlockChain.
+type Chain interface {
+	HaveBlock(hash *chainhash.Hash) (bool, error)
+	IsCurrent() bool
+	Subscribe(callback blockchain.NotificationCallback)
+}
+
+// Config is the configuration of the bridge.
+type Config struct {
+	// RPCHost is the host:port of the RPC server of Core and RPCUser and
+	// RPCPass are its credentials.
+	RPCHost string
+	RPCUser string
+	RPCPass string
+
+	// ZMQRawBlock and ZMQRawTx are the endpoints Core publishes its
+	// rawblock and rawtx notifications on.  The tip of Core is polled
+	// over RPC when ZMQRawBlock is empty and no transactions are received
+	// from Core when ZMQRawTx is.
+	ZMQRawBlock string
+	ZMQRawTx    string
+
+	// PollInterval is how often the tip of Core is polled.
+	PollInterval time.Duration
+
+	// Chain is the chain the blocks from Core are checked against and
+	// the connected blocks are submitted to Core from.
+	Chain Chain
+
+	// ProcessBlock processes a block from Core and returns whether it's an
+	// orphan.
+	ProcessBlock func(block *btcutil.Block) (bool, error)
+
+	// ProcessTransaction accepts a transaction from Core to the mempool
+	// and relays it.
+	ProcessTransaction func(tx *btcutil.Tx) error
+}
+
+// recentHashes is a set of the most recently added hashes.
+type recentHashes struct {
+	mtx    sync.Mutex
+	hashes map[chainhash.Hash]struct{}
+	order  []chainhash.Hash
+	next   int
+}
+
+// add adds the hash to the set, evicting the oldest one when it's full.
+func (r *recentHashes) add(hash *chainhash.Hash) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.hashes[*hash]; ok {
+		return
+	}
+	if len(r.order) < maxRecentHashes {
+		r.order = append(r.order, *hash)
+	} else {
+		delete(r.hashes, r.order[r.next])
+		r.order[r.next] = *hash
+		r.next = (r.next + 1) % maxRecentHashes
+	}
+	r.hashes[*hash] = struct{}{}
+}
+
+// contains returns whether the hash is in the set.
+func (r *recentHashes) contains(hash *chainhash.Hash) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	_, ok := r.hashes[*hash]
+	return ok
+}
+
+// Bridge cross-feeds blocks and transactions between utreexod and Core.
+type Bridge struct {
+	started  int32
+	shutdown int32
+
+	cfg    Config
+	client coreClient
+
+	// fromCore are the blocks and transactions received from Core, which
+	// aren't submitted back to it.
+	fromCore recentHashes
+
+	submitBlocks chan *btcutil.Block
+	submitTxs    chan *btcutil.Tx
+
+	subMtx        sync.Mutex
+	subscriptions map[*zmq.Subscription]struct{}
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a bridge to the Core node in the config.  It's subscribed to the
+// chain right away, but nothing is exchanged with Core until it's started.
+func New(cfg *Config) (*Bridge, error) {
+	client, err := rpcclient.New(&rpcclient.ConnConfig{
+		Host:         cfg.RPCHost,
+		User:         cfg.RPCUser,
+		Pass:         cfg.RPCPass,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newBridge(cfg, client), nil
+}
+
+// newBridge returns a bridge that talks to Core with the given client.
+func newBridge(cfg *Config, client coreClient) *Bridge {
+	b := Bridge{
+		cfg:           *cfg,
+		client:        client,
+		fromCore:      recentHashes{hashes: make(map[chainhash.Hash]struct{})},
+		submitBlocks:  make(chan *btcutil.Block, submitQueueSize),
+		submitTxs:     make(chan *btcutil.Tx, submitQueueSize),
+		subscriptions: make(map[*zmq.Subscription]struct{}),
+		quit:          make(chan struct{}),
+	}
+	if b.cfg.PollInterval <= 0 {
+		b.cfg.PollInterval = DefaultPollInterval
+	}
+	b.cfg.Chain.Subscribe(b.handleBlockchainNotification)
+	return &b
+}
+
+// Start starts exchanging blocks and transactions with Core.
+func (b *Bridge) Start() {
+	// Already started?
+	if atomic.AddInt32(&b.started, 1) != 1 {
+		return
+	}
+
+	log.Infof("Bridging blocks and transactions with Bitcoin Core at %s",
+		b.cfg.RPCHost)
+
+	b.wg.Add(2)
+	go b.submitHandler()
+	if b.cfg.ZMQRawBlock != "" {
+		go b.receiveHandler(b.cfg.ZMQRawBlock, zmq.TopicRawBlock,
+			b.handleRawBlock)
+	} else {
+		go b.pollHandler()
+	}
+	if b.cfg.ZMQRawTx != "" {
+		b.wg.Add(1)
+		go b.receiveHandler(b.cfg.ZMQRawTx, zmq.TopicRawTx,
+			b.handleRawTx)
+	}
+}
+
+// Stop stops exchanging blocks and transactions with Core and waits for the
+// handlers to finish.
+func (b *Bridge) Stop() {
+	// Already stopped?
+	if atomic.AddInt32(&b.shutdown, 1) != 1 {
+		log.Infof("Core bridge is already in the process of shutting down")
+		return
+	}
+
+	close(b.quit)
+	b.subMtx.Lock()
+	for sub := range b.subscriptions {
+		sub.Close()
+	}
+	b.subMtx.Unlock()
+	b.client.Shutdown()
+	b.wg.Wait()
+}
+
+// NotifyNewTransactions submits the transactions accepted to the mempool that
+// didn't come from Core to it.
+func (b *Bridge) NotifyNewTransactions(txns []*mempool.TxDesc) {
+	for _, txD := range txns {
+		if b.fromCore.contains(txD.Tx.Hash()) {
+			continue
+		}
+		select {
+		case b.submitTxs <- txD.Tx:
+		default:
+			log.Debugf("Dropping transaction %v for Bitcoin Core as "+
+				"the submit queue is full", txD.Tx.Hash())
+		}
+	}
+}
+
+// handleBlockchainNotification submits the blocks connected to the main chain
+// that didn't come from Core to it.  Nothing is submitted while the chain is
+// catching up since Core is expected to have those blocks already.
+func (b *Bridge) handleBlockchainNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		log.Warnf("Chain connected notification is not a block.")
+		return
+	}
+	if b.fromCore.contains(block.Hash()) || !b.cfg.Chain.IsCurrent() {
+		return
+	}
+
+	select {
+	case b.submitBlocks <- block:
+	default:
+		log.Warnf("Dropping block %v for Bitcoin Core as the submit "+
+			"queue is full", block.Hash())
+	}
+}
+
+// submitHandler submits the queued blocks and transactions to Core.
+//
+// This must be run as a goroutine.
+func (b *Bridge) submitHandler() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case block := <-b.submitBlocks:
+			b.submitBlock(block)
+
+		case tx := <-b.submitTxs:
+			_, err := b.client.SendRawTransaction(tx.MsgTx(), false)
+			if err != nil {
+				// Core rejecting transactions it already has
+				// or that break its policy is expected.
+				log.Debugf("Bitcoin Core didn't accept "+
+					"transaction %v: %v", tx.Hash(), err)
+			}
+
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// submitBlock submits the block without its utreexo proof to Core.
+func (b *Bridge) submitBlock(block *btcutil.Block) {
+	msgBlock := *block.MsgBlock()
+	msgBlock.UData = nil
+
+	err := b.client.SubmitBlock(btcutil.NewBlock(&msgBlock), nil)
+	switch {
+	case err == nil:
+		log.Infof("Submitted block %v to Bitcoin Core", block.Hash())
+
+	// Core already having the block or not being able to tell if it's
+	// valid yet isn't an error.
+	case err.Error() == "duplicate" || err.Error() == "inconclusive":
+		log.Debugf("Bitcoin Core didn't accept block %v: %v",
+			block.Hash(), err)
+
+	default:
+		log.Warnf("Unable to submit block %v to Bitcoin Core: %v",
+			block.Hash(), err)
+	}
+}
+
+// receiveHandler receives the notifications of the topic from the ZMQ endpoint
+// of Core and reconnects when the connection is lost.
+//
+// This must be run as a goroutine.
+func (b *Bridge) receiveHandler(endpoint, topic string, handle func([]byte)) {
+	defer b.wg.Done()
+
+	for {
+		b.receive(endpoint, topic, handle)
+
+		select {
+		case <-time.After(retryInterval):
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// receive handles the notifications of the topic until the subscription to the
+// ZMQ endpoint fails or the bridge is stopped.
+func (b *Bridge) receive(endpoint, topic string, handle func([]byte)) {
+	sub, err := zmq.Subscribe(endpoint, topic)
+	if err != nil {
+		log.Warnf("Unable to subscribe to %s of Bitcoin Core at %s: %v",
+			topic, endpoint, err)
+		return
+	}
+	b.subMtx.Lock()
+	select {
+	case <-b.quit:
+		b.subMtx.Unlock()
+		sub.Close()
+		return
+	default:
+	}
+	b.subscriptions[sub] = struct{}{}
+	b.subMtx.Unlock()
+	defer func() {
+		b.subMtx.Lock()
+		delete(b.subscriptions, sub)
+		b.subMtx.Unlock()
+		sub.Close()
+	}()
+	log.Infof("Subscribed to %s of Bitcoin Core at %s", topic, endpoint)
+
+	// Blocks may have been missed while not subscribed.
+	if topic == zmq.TopicRawBlock {
+		b.syncTip()
+	}
+
+	var lastSequence uint32
+	for first := true; ; first = false {
+		n, err := sub.Receive()
+		if err != nil {
+			select {
+			case <-b.quit:
+			default:
+				log.Warnf("Lost the subscription to %s of "+
+					"Bitcoin Core at %s: %v", topic,
+					endpoint, err)
+			}
+			return
+		}
+
+		// Catch up with the tip of Core when it dropped blocks.
+		gap := n.HasSequence && !first && n.Sequence != lastSequence+1
+		lastSequence = n.Sequence
+		if gap && topic == zmq.TopicRawBlock {
+			log.Debugf("Missed blocks from Bitcoin Core")
+			b.syncTip()
+		}
+		handle(n.Body)
+	}
+}
+
+// pollHandler polls the tip of Core.
+//
+// This must be run as a goroutine.
+func (b *Bridge) pollHandler() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.PollInterval)
+	defer ticker.Stop()
+
+	b.syncTip()
+	for {
+		select {
+		case <-ticker.C:
+			b.syncTip()
+
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// syncTip processes the tip of Core if it's missing from the chain.
+func (b *Bridge) syncTip() {
+	hash, err := b.client.GetBestBlockHash()
+	if err != nil {
+		log.Warnf("Unable to fetch the tip of Bitcoin Core: %v", err)
+		return
+	}
+	if have, err := b.cfg.Chain.HaveBlock(hash); err != nil || have {
+		return
+	}
+	msgBlock, err := b.client.GetBlock(hash)
+	if err != nil {
+		log.Warnf("Unable to fetch block %v from Bitcoin Core: %v",
+			hash, err)
+		return
+	}
+	b.processBlock(msgBlock)
+}
+
+// handleRawBlock processes a rawblock notification of Core.
+func (b *Bridge) handleRawBlock(body []byte) {
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(bytes.NewReader(body)); err != nil {
+		log.Warnf("Unable to deserialize block from Bitcoin Core: %v",
+			err)
+		return
+	}
+	b.processBlock(&msgBlock)
+}
+
+// processBlock processes a block from Core along with the missing parents it
+// has, up to maxParentFetches of them.
+func (b *Bridge) processBlock(msgBlock *wire.MsgBlock) {
+	for i := 0; ; i++ {
+		block := btcutil.NewBlock(msgBlock)
+		if have, err := b.cfg.Chain.HaveBlock(block.Hash()); err != nil || have {
+			return
+		}
+
+		b.fromCore.add(block.Hash())
+		isOrphan, err := b.cfg.ProcessBlock(block)
+		if err != nil {
+			log.Warnf("Block %v from Bitcoin Core was rejected: %v",
+				block.Hash(), err)
+			return
+		}
+		if !isOrphan {
+			log.Infof("Processed block %v from Bitcoin Core",
+				block.Hash())
+			return
+		}
+		if i == maxParentFetches {
+			log.Infof("Block %v from Bitcoin Core is missing more "+
+				"than %d parents -- leaving them to the sync with "+
+				"the peers", block.Hash(), maxParentFetches)
+			return
+		}
+
+		// The orphan is processed by the chain once its parent is.
+		parent := &msgBlock.Header.PrevBlock
+		msgBlock, err = b.client.GetBlock(parent)
+		if err != nil {
+			log.Warnf("Unable to fetch block %v from Bitcoin Core: %v",
+				parent, err)
+			return
+		}
+	}
+}
+
+// handleRawTx processes a rawtx notification of Core.  Core also publishes the
+// transactions of the blocks it connects, which the mempool rejects.
+func (b *Bridge) handleRawTx(body []byte) {
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(body)); err != nil {
+		log.Warnf("Unable to deserialize transaction from Bitcoin "+
+			"Core: %v", err)
+		return
+	}
+	tx := btcutil.NewTx(&msgTx)
+
+	b.fromCore.add(tx.Hash())
+	if err := b.cfg.ProcessTransaction(tx); err != nil {
+		// Only log what isn't a plain rejection at a higher level.
+		if _, ok := err.(mempool.RuleError); ok {
+			log.Tracef("Transaction %v from Bitcoin Core was "+
+				"rejected: %v", tx.Hash(), err)
+			return
+		}
+		log.Warnf("Unable to process transaction %v from Bitcoin "+
+			"Core: %v", tx.Hash(), err)
+	}
+}
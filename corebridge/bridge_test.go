@@ -0,0 +1,221 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package corebridge
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/mempool"
+	"github.com/utreexo/utreexod/mining"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testCore is a Core node with a chain of blocks.
+type testCore struct {
+	blocks    map[chainhash.Hash]*wire.MsgBlock
+	tip       chainhash.Hash
+	submitted []*wire.MsgBlock
+	sent      []*wire.MsgTx
+}
+
+func (c *testCore) GetBestBlockHash() (*chainhash.Hash, error) {
+	return &c.tip, nil
+}
+
+func (c *testCore) GetBlock(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+	block, ok := c.blocks[*hash]
+	if !ok {
+		return nil, errors.New("block not found")
+	}
+	return block, nil
+}
+
+func (c *testCore) SubmitBlock(block *btcutil.Block,
+	_ *btcjson.SubmitBlockOptions) error {
+
+	c.submitted = append(c.submitted, block.MsgBlock())
+	return nil
+}
+
+func (c *testCore) SendRawTransaction(tx *wire.MsgTx, _ bool) (*chainhash.Hash, error) {
+	c.sent = append(c.sent, tx)
+	hash := tx.TxHash()
+	return &hash, nil
+}
+
+func (c *testCore) Shutdown() {}
+
+// testChain is the chain of utreexod which only accepts blocks whose parent
+// it has.
+type testChain struct {
+	blocks   map[chainhash.Hash]struct{}
+	orphans  map[chainhash.Hash]*btcutil.Block
+	current  bool
+	callback blockchain.NotificationCallback
+}
+
+func (c *testChain) HaveBlock(hash *chainhash.Hash) (bool, error) {
+	_, ok := c.blocks[*hash]
+	return ok, nil
+}
+
+func (c *testChain) IsCurrent() bool { return c.current }
+
+func (c *testChain) Subscribe(callback blockchain.NotificationCallback) {
+	c.callback = callback
+}
+
+// processBlock connects the block and the orphans it's the parent of.
+func (c *testChain) processBlock(block *btcutil.Block) (bool, error) {
+	if _, ok := c.blocks[block.MsgBlock().Header.PrevBlock]; !ok {
+		c.orphans[*block.Hash()] = block
+		return true, nil
+	}
+	c.blocks[*block.Hash()] = struct{}{}
+	for hash, orphan := range c.orphans {
+		if orphan.MsgBlock().Header.PrevBlock == *block.Hash() {
+			delete(c.orphans, hash)
+			c.processBlock(orphan)
+		}
+	}
+	return false, nil
+}
+
+// makeBlocks returns a chain of n blocks on top of the parent.
+func makeBlocks(parent chainhash.Hash, n int) []*wire.MsgBlock {
+	blocks := make([]*wire.MsgBlock, 0, n)
+	for i := 0; i < n; i++ {
+		block := &wire.MsgBlock{Header: wire.BlockHeader{
+			PrevBlock: parent,
+			Nonce:     uint32(i),
+		}}
+		blocks = append(blocks, block)
+		parent = block.BlockHash()
+	}
+	return blocks
+}
+
+func TestProcessBlocksFromCore(t *testing.T) {
+	genesis := chainhash.Hash{0x01}
+	blocks := makeBlocks(genesis, 5)
+	core := &testCore{blocks: make(map[chainhash.Hash]*wire.MsgBlock)}
+	for _, block := range blocks {
+		core.blocks[block.BlockHash()] = block
+	}
+	core.tip = blocks[len(blocks)-1].BlockHash()
+
+	chain := &testChain{
+		blocks:  map[chainhash.Hash]struct{}{genesis: {}},
+		orphans: make(map[chainhash.Hash]*btcutil.Block),
+		current: true,
+	}
+	b := newBridge(&Config{
+		Chain:        chain,
+		ProcessBlock: chain.processBlock,
+	}, core)
+
+	// The missing parents of the tip of Core are fetched until the chain
+	// can connect them all.
+	b.syncTip()
+	for _, block := range blocks {
+		hash := block.BlockHash()
+		if have, _ := chain.HaveBlock(&hash); !have {
+			t.Fatalf("block %v wasn't connected", hash)
+		}
+	}
+
+	// Blocks from Core aren't submitted back to it, but the ones from the
+	// peers are once the chain is current.
+	peerBlocks := makeBlocks(core.tip, 2)
+	for i, block := range append(blocks, peerBlocks...) {
+		chain.current = i != len(blocks)
+		chain.callback(&blockchain.Notification{
+			Type: blockchain.NTBlockConnected,
+			Data: btcutil.NewBlock(block),
+		})
+	}
+	if len(b.submitBlocks) != 1 {
+		t.Fatalf("expected 1 block to submit, got %d", len(b.submitBlocks))
+	}
+
+	// The utreexo proof of a block isn't submitted.
+	block := btcutil.NewBlock(peerBlocks[1])
+	block.MsgBlock().UData = &wire.UData{}
+	b.submitBlock(block)
+	if len(core.submitted) != 1 || core.submitted[0].UData != nil {
+		t.Fatal("expected the block to be submitted without its proof")
+	}
+}
+
+func TestTransactionsFromCore(t *testing.T) {
+	core := &testCore{}
+	chain := &testChain{}
+	var processed []*btcutil.Tx
+	b := newBridge(&Config{
+		Chain: chain,
+		ProcessTransaction: func(tx *btcutil.Tx) error {
+			processed = append(processed, tx)
+			return nil
+		},
+	}, core)
+
+	// A transaction from Core is processed, but not sent back when it's
+	// accepted to the mempool.
+	fromCore := wire.NewMsgTx(wire.TxVersion)
+	fromCore.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 0}, nil, nil))
+	fromCore.AddTxOut(wire.NewTxOut(1, nil))
+	fromPeer := wire.NewMsgTx(wire.TxVersion)
+	fromPeer.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	fromPeer.AddTxOut(wire.NewTxOut(2, nil))
+
+	var buf bytes.Buffer
+	if err := fromCore.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b.handleRawTx(buf.Bytes())
+	if len(processed) != 1 || processed[0].MsgTx().TxHash() != fromCore.TxHash() {
+		t.Fatal("expected the transaction from Core to be processed")
+	}
+
+	b.NotifyNewTransactions([]*mempool.TxDesc{
+		{TxDesc: mining.TxDesc{Tx: btcutil.NewTx(fromCore)}},
+		{TxDesc: mining.TxDesc{Tx: btcutil.NewTx(fromPeer)}},
+	})
+	if len(b.submitTxs) != 1 {
+		t.Fatalf("expected 1 transaction to submit, got %d",
+			len(b.submitTxs))
+	}
+	if tx := <-b.submitTxs; tx.MsgTx().TxHash() != fromPeer.TxHash() {
+		t.Fatal("expected the transaction from the peers to be submitted")
+	}
+}
+
+func TestRecentHashes(t *testing.T) {
+	r := recentHashes{hashes: make(map[chainhash.Hash]struct{})}
+	for i := 0; i < maxRecentHashes+10; i++ {
+		r.add(&chainhash.Hash{byte(i), byte(i >> 8)})
+	}
+	if len(r.hashes) != maxRecentHashes {
+		t.Fatalf("expected %d hashes, got %d", maxRecentHashes,
+			len(r.hashes))
+	}
+
+	// The oldest hashes are evicted first.
+	if r.contains(&chainhash.Hash{0}) || r.contains(&chainhash.Hash{9}) {
+		t.Fatal("expected the oldest hashes to be evicted")
+	}
+	last := maxRecentHashes + 9
+	if !r.contains(&chainhash.Hash{byte(last), byte(last >> 8)}) ||
+		!r.contains(&chainhash.Hash{10}) {
+
+		t.Fatal("expected the newest hashes to be kept")
+	}
+}
@@ -27,6 +27,11 @@ type Driver struct {
 	// ErrDbDoesNotExist if the database has not already been created.
 	Open func(args ...interface{}) (DB, error)
 
+	// Repair is the function that will be invoked with all user-specified
+	// arguments to attempt to repair a database that failed to open due to
+	// corruption.  It may be nil if the driver doesn't support repairing.
+	Repair func(args ...interface{}) error
+
 	// UseLogger uses a specified Logger to output package logging info.
 	UseLogger func(logger btclog.Logger)
 }
@@ -87,3 +92,25 @@ func Open(dbType string, args ...interface{}) (DB, error) {
 
 	return drv.Open(args...)
 }
+
+// Repair attempts to repair an existing database of the specified type that
+// failed to open due to corruption.  The arguments are specific to the database
+// type driver.  See the documentation for the database driver for further
+// details.
+//
+// ErrDbUnknownType will be returned if the the database type is not registered
+// and ErrDriverSpecific will be returned if the driver doesn't support repairing.
+func Repair(dbType string, args ...interface{}) error {
+	drv, exists := drivers[dbType]
+	if !exists {
+		str := fmt.Sprintf("driver %q is not registered", dbType)
+		return makeError(ErrDbUnknownType, str, nil)
+	}
+
+	if drv.Repair == nil {
+		str := fmt.Sprintf("driver %q does not support repairing", dbType)
+		return makeError(ErrDriverSpecific, str, nil)
+	}
+
+	return drv.Repair(args...)
+}
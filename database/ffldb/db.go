@@ -1201,6 +1201,49 @@ func (tx *transaction) StoreBlock(block *btcutil.Block) error {
 		return makeDbErr(database.ErrBlockExists, str, nil)
 	}
 
+	return tx.addPendingBlock(block)
+}
+
+// ReplaceBlock stores the provided block into the database in place of the
+// copy of it that's already stored.  The block index is pointed at the new copy
+// when the transaction is committed and the old one is left in its file.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the block hash isn't stored yet
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) ReplaceBlock(block *btcutil.Block) error {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "replace block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Only blocks that are already stored can be replaced.
+	blockHash := block.Hash()
+	if !tx.hasBlock(blockHash) {
+		str := fmt.Sprintf("block %s does not exist", blockHash)
+		return makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+	if _, exists := tx.pendingBlocks[*blockHash]; exists {
+		str := fmt.Sprintf("block %s is pending to be stored", blockHash)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+
+	return tx.addPendingBlock(block)
+}
+
+// addPendingBlock adds the provided block to the blocks that are written to the
+// block files and the block index when the transaction is committed.
+func (tx *transaction) addPendingBlock(block *btcutil.Block) error {
+	blockHash := block.Hash()
 	blockBytes, err := block.Bytes()
 	if err != nil {
 		str := fmt.Sprintf("failed to get serialized bytes for block %s",
@@ -2456,5 +2499,147 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
-	return reconcileDB(pdb, create)
+	rdb, err := reconcileDB(pdb, create)
+	if err != nil {
+		// Release the metadata database so that it may be repaired or
+		// opened again.
+		_ = ldb.Close()
+		return nil, err
+	}
+
+	return rdb, nil
+}
+
+// repairDB attempts to recover the metadata database of the database at the
+// provided path by rebuilding its manifest from the tables and journals that
+// are still intact.  The recovered metadata is then verified by reading every
+// entry with all the checksums enforced and by reading back every block the
+// block index references from the block files.  The recovered data may be
+// missing the writes that were lost, which the reconciliation done when the
+// database is opened again will detect.
+func repairDB(dbPath string, network wire.BitcoinNet) error {
+	metadataDbPath := filepath.Join(dbPath, metadataDbName)
+	if !fileExists(metadataDbPath) {
+		str := fmt.Sprintf("database %q does not exist", metadataDbPath)
+		return makeDbErr(database.ErrDbDoesNotExist, str, nil)
+	}
+
+	log.Infof("Attempting to recover the metadata database at %q",
+		metadataDbPath)
+	opts := opt.Options{
+		Strict:      opt.DefaultStrict,
+		Compression: opt.NoCompression,
+		Filter:      filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.RecoverFile(metadataDbPath, &opts)
+	if err != nil {
+		str := fmt.Sprintf("failed to recover the metadata database: %v", err)
+		return convertErr(str, err)
+	}
+	defer ldb.Close()
+
+	log.Infof("Verifying the recovered metadata database")
+	iter := ldb.NewIterator(nil, &opt.ReadOptions{Strict: opt.StrictAll})
+	var numEntries int
+	for iter.Next() {
+		numEntries++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		str := fmt.Sprintf("failed to verify the recovered metadata "+
+			"database: %v", err)
+		return convertErr(str, err)
+	}
+	log.Infof("Recovered %d entries in the metadata database", numEntries)
+
+	// The internal buckets and write cursors are written when the database
+	// is created, so recovered metadata that lacks any of them lost the
+	// tables they lived in and can't be trusted.
+	requiredKeys := [][]byte{
+		curBucketIDKeyName,
+		bucketIndexKey(metadataBucketID, blockIdxBucketName),
+		bucketIndexKey(metadataBucketID, sjIdxBucketName),
+		bucketizedKey(metadataBucketID, blkWriteLocKeyName),
+		bucketizedKey(metadataBucketID, sjWriteLocKeyName),
+	}
+	for _, key := range requiredKeys {
+		exists, err := ldb.Has(key, nil)
+		if err != nil {
+			str := fmt.Sprintf("failed to verify the recovered metadata "+
+				"database: %v", err)
+			return convertErr(str, err)
+		}
+		if !exists {
+			str := fmt.Sprintf("recovered metadata database is missing "+
+				"the internal key %q", key)
+			return makeDbErr(database.ErrCorruption, str, nil)
+		}
+	}
+
+	// Make sure every block the recovered metadata knows about can still
+	// be read back from the flat files.  A recovered table that silently
+	// dropped or mangled block locations would otherwise only be noticed
+	// once the block is requested.
+	log.Infof("Verifying the block locations in the recovered metadata")
+	numBlocks, err := verifyBlockLocations(ldb, dbPath, network)
+	if err != nil {
+		return err
+	}
+	log.Infof("Verified %d blocks against the block files", numBlocks)
+
+	return nil
+}
+
+// verifyBlockLocations reads every block referenced by the block index in the
+// passed metadata database from the block files under dbPath and returns the
+// number of blocks that were checked.  ErrCorruption is returned if a location
+// is malformed or the block it points to can't be read or fails its checksum.
+func verifyBlockLocations(ldb *leveldb.DB, dbPath string,
+	network wire.BitcoinNet) (int, error) {
+
+	store, err := newBlockStore(dbPath, network)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		for _, blockFile := range store.openBlockFiles {
+			_ = blockFile.file.Close()
+		}
+	}()
+
+	var numBlocks int
+	iter := ldb.NewIterator(util.BytesPrefix(blockIdxBucketID[:]), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, blockRow := iter.Key(), iter.Value()
+		if len(key) != len(blockIdxBucketID)+chainhash.HashSize ||
+			len(blockRow) < blockLocSize {
+
+			str := fmt.Sprintf("malformed block index entry %x", key)
+			return numBlocks, makeDbErr(database.ErrCorruption, str, nil)
+		}
+
+		// Every block record holds at least the network, the length,
+		// and the checksum.
+		var hash chainhash.Hash
+		copy(hash[:], key[len(blockIdxBucketID):])
+		loc := deserializeBlockLoc(blockRow)
+		if loc.blockLen < 12 {
+			str := fmt.Sprintf("block %s has a malformed location", hash)
+			return numBlocks, makeDbErr(database.ErrCorruption, str, nil)
+		}
+		_, err := store.readBlock(&hash, loc)
+		if err != nil {
+			str := fmt.Sprintf("block %s referenced by the recovered "+
+				"metadata is unreadable", hash)
+			return numBlocks, makeDbErr(database.ErrCorruption, str, err)
+		}
+		numBlocks++
+	}
+	if err := iter.Error(); err != nil {
+		str := fmt.Sprintf("failed to iterate the block index: %v", err)
+		return numBlocks, convertErr(str, err)
+	}
+
+	return numBlocks, nil
 }
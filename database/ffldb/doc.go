@@ -25,5 +25,13 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+The Repair function takes the same parameters and attempts to recover a
+database whose metadata failed to open due to corruption:
+
+	err := database.Repair("ffldb", "path/to/database", wire.MainNet)
+	if err != nil {
+		// Handle error
+	}
 */
 package ffldb
@@ -63,6 +63,17 @@ func createDBDriver(args ...interface{}) (database.DB, error) {
 	return openDB(dbPath, network, true)
 }
 
+// repairDBDriver is the callback provided during driver registration that
+// repairs a database that failed to open due to corruption.
+func repairDBDriver(args ...interface{}) error {
+	dbPath, network, err := parseArgs("Repair", args...)
+	if err != nil {
+		return err
+	}
+
+	return repairDB(dbPath, network)
+}
+
 // useLogger is the callback provided during driver registration that sets the
 // current logger to the provided one.
 func useLogger(logger btclog.Logger) {
@@ -75,6 +86,7 @@ func init() {
 		DbType:    dbType,
 		Create:    createDBDriver,
 		Open:      openDBDriver,
+		Repair:    repairDBDriver,
 		UseLogger: useLogger,
 	}
 	if err := database.RegisterDriver(driver); err != nil {
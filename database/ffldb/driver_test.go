@@ -259,6 +259,190 @@ func TestPersistence(t *testing.T) {
 	}
 }
 
+// TestRepair ensures that a database with a corrupted metadata manifest can be
+// repaired and opened again with its data intact.
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-repairtest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisBlock.SetHeight(0)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.StoreBlock(genesisBlock); err != nil {
+			return err
+		}
+		return tx.StoreSpendJournal(genesisHash, []byte{})
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	db.Close()
+
+	// Corrupt the manifest of the metadata database.
+	manifests, err := filepath.Glob(filepath.Join(dbPath, "metadata",
+		"MANIFEST-*"))
+	if err != nil || len(manifests) == 0 {
+		t.Errorf("Unable to find the manifest: %v", err)
+		return
+	}
+	for _, manifest := range manifests {
+		err = os.WriteFile(manifest, []byte("corrupted manifest"), 0600)
+		if err != nil {
+			t.Errorf("Unable to corrupt the manifest: %v", err)
+			return
+		}
+	}
+
+	// Ensure the database fails to open due to the corruption.
+	_, err = database.Open(dbType, dbPath, blockDataNet)
+	if !checkDbError(t, "Open", err, database.ErrCorruption) {
+		return
+	}
+
+	// Repair the database and ensure the stored block is still there.
+	err = database.Repair(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Repair: unexpected error: %v", err)
+		return
+	}
+	db, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open repaired database (%s) %v", dbType, err)
+		return
+	}
+	defer db.Close()
+
+	err = db.View(func(tx database.Tx) error {
+		genesisBlockBytes, _ := genesisBlock.Bytes()
+		gotBytes, err := tx.FetchBlock(genesisHash)
+		if err != nil {
+			return fmt.Errorf("FetchBlock: unexpected error: %v",
+				err)
+		}
+		if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+			return fmt.Errorf("FetchBlock: stored block mismatch")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+	}
+
+	// Ensure attempting to repair a database that doesn't exist returns
+	// the expected error.
+	err = database.Repair(dbType, "noexist", blockDataNet)
+	checkDbError(t, "Repair", err, database.ErrDbDoesNotExist)
+}
+
+// storeGenesisForRepair creates a database at dbPath holding the main network
+// genesis block and its spend journal and closes it again.
+func storeGenesisForRepair(t *testing.T, dbPath string) *btcutil.Block {
+	t.Helper()
+
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisBlock.SetHeight(0)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.StoreBlock(genesisBlock); err != nil {
+			return err
+		}
+		return tx.StoreSpendJournal(genesisHash, []byte{})
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	// Open and close the database once more so that the metadata journal
+	// gets flushed into a table.
+	db, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	return genesisBlock
+}
+
+// corruptFiles overwrites the bytes at the given offset of every file in
+// dbPath matching pattern.
+func corruptFiles(t *testing.T, dbPath, pattern string, offset int64) {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dbPath, pattern))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Unable to find files matching %q: %v", pattern, err)
+	}
+	for _, file := range files {
+		f, err := os.OpenFile(file, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("Unable to open %s: %v", file, err)
+		}
+		_, err = f.WriteAt([]byte("corrupted"), offset)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Unable to corrupt %s: %v", file, err)
+		}
+	}
+}
+
+// TestRepairCorruptTable ensures that a database whose metadata table is
+// corrupted along with its manifest is not reported as repaired since the
+// recovered metadata is missing the data that lived in the table.
+func TestRepairCorruptTable(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-repairtabletest")
+	storeGenesisForRepair(t, dbPath)
+
+	// Corrupt the data blocks of the metadata tables along with the
+	// manifest so the database has to be recovered from the tables.
+	corruptFiles(t, dbPath, filepath.Join("metadata", "*.ldb"), 0)
+	corruptFiles(t, dbPath, filepath.Join("metadata", "MANIFEST-*"), 0)
+
+	err := database.Repair(dbType, dbPath, blockDataNet)
+	checkDbError(t, "Repair", err, database.ErrCorruption)
+}
+
+// TestRepairCorruptBlockFile ensures that a repair fails when a block that the
+// recovered metadata references doesn't match its checksum in the block files.
+func TestRepairCorruptBlockFile(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(t.TempDir(), "ffldb-repairblocktest")
+	storeGenesisForRepair(t, dbPath)
+
+	// Corrupt the manifest so a repair is needed and the serialized
+	// genesis block right after its network and length.
+	corruptFiles(t, dbPath, filepath.Join("metadata", "MANIFEST-*"), 0)
+	corruptFiles(t, dbPath, "*.fdb", 8)
+
+	err := database.Repair(dbType, dbPath, blockDataNet)
+	checkDbError(t, "Repair", err, database.ErrCorruption)
+}
+
 // TestInterface performs all interfaces tests for this database driver.
 func TestInterface(t *testing.T) {
 	t.Parallel()
@@ -8,6 +8,7 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/bzip2"
 	"encoding/binary"
 	"fmt"
@@ -601,6 +602,71 @@ func testCorruption(tc *testContext) bool {
 	return true
 }
 
+// testReplaceBlock ensures a block that was corrupted on disk can be read back
+// again after it's replaced and that only stored blocks can be replaced.
+func testReplaceBlock(tc *testContext) bool {
+	if !resetDatabase(tc) {
+		return false
+	}
+
+	err := tc.db.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(tc.blocks[0])
+	})
+	if err != nil {
+		tc.t.Errorf("StoreBlock: unexpected error: %v", err)
+		return false
+	}
+
+	// Corrupt a transaction byte of the stored block.
+	block0Hash := tc.blocks[0].Hash()
+	tc.files[0].file.(*mockFile).data[90] ^= 0x10
+	err = tc.db.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(block0Hash)
+		return err
+	})
+	if !checkDbError(tc.t, "FetchBlock before replace", err,
+		database.ErrCorruption) {
+		return false
+	}
+
+	err = tc.db.Update(func(tx database.Tx) error {
+		err := tx.ReplaceBlock(tc.blocks[1])
+		if !checkDbError(tc.t, "ReplaceBlock unstored", err,
+			database.ErrBlockNotFound) {
+			return errSubTestFail
+		}
+		return tx.ReplaceBlock(tc.blocks[0])
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("ReplaceBlock: unexpected error: %v", err)
+		}
+		return false
+	}
+
+	wantBytes, _ := tc.blocks[0].Bytes()
+	err = tc.db.View(func(tx database.Tx) error {
+		gotBytes, err := tx.FetchBlock(block0Hash)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(gotBytes, wantBytes) {
+			tc.t.Errorf("FetchBlock after replace: bytes mismatch")
+			return errSubTestFail
+		}
+		return nil
+	})
+	if err != nil {
+		if err != errSubTestFail {
+			tc.t.Errorf("FetchBlock after replace: unexpected "+
+				"error: %v", err)
+		}
+		return false
+	}
+
+	return true
+}
+
 // testAssertSameFileNum tests that the block and its spend journal is stored in the
 // same file number.
 func testAssertSameFileNum(tc *testContext) bool {
@@ -970,5 +1036,10 @@ func TestFailureScenarios(t *testing.T) {
 	}
 
 	// Test various corruption scenarios.
-	testCorruption(tc)
+	if !testCorruption(tc) {
+		return
+	}
+
+	// Test replacing a corrupted block.
+	testReplaceBlock(tc)
 }
@@ -229,6 +229,21 @@ type Tx interface {
 	// Other errors are possible depending on the implementation.
 	StoreBlock(block *btcutil.Block) error
 
+	// ReplaceBlock stores the provided block into the database in place of
+	// the copy of it that's already stored.  It's meant for replacing a
+	// copy that was found to be corrupted with one fetched again.  The
+	// block index is pointed at the new copy and the old one is left in
+	// its file until the file is pruned.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the block hash isn't stored yet
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	ReplaceBlock(block *btcutil.Block) error
+
 	// HasBlock returns whether or not a block with the given hash exists
 	// in the database.
 	//
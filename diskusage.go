@@ -0,0 +1,180 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// diskUsageSampleInterval is how often the disk usage of the tracked
+	// directories are sampled.
+	diskUsageSampleInterval = time.Minute * 10
+
+	// diskUsageWindow is the trailing window of samples that's used to
+	// forecast the growth rate of the tracked directories.
+	diskUsageWindow = time.Hour * 24
+)
+
+// errDiskUsageNotSampled is returned when the disk usage is requested before
+// the first sample was taken.
+var errDiskUsageNotSampled = errors.New("the disk usage hasn't been sampled yet")
+
+// diskUsageTarget is a named group of paths on disk that belong to a single
+// index or state.
+type diskUsageTarget struct {
+	name  string
+	paths []string
+}
+
+// diskUsageSample is the size of every tracked target at a point in time.
+type diskUsageSample struct {
+	timestamp time.Time
+	sizes     []int64
+}
+
+// diskUsage is the on-disk size of a single target along with its forecasted
+// growth rate.
+type diskUsage struct {
+	name         string
+	paths        []string
+	size         int64
+	growthPerDay int64
+	window       time.Duration
+}
+
+// diskUsageMonitor keeps track of the on-disk size of the block database and
+// the indexes and forecasts how fast they're growing based on the samples
+// taken over the trailing window.
+type diskUsageMonitor struct {
+	targets []diskUsageTarget
+
+	mtx     sync.Mutex
+	samples []diskUsageSample
+}
+
+// newDiskUsageMonitor returns a new disk usage monitor for the given targets.
+func newDiskUsageMonitor(targets []diskUsageTarget) *diskUsageMonitor {
+	return &diskUsageMonitor{targets: targets}
+}
+
+// dirSize returns the total size of all the files under the given path.  A
+// path that doesn't exist has a size of 0.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// measure returns the current on-disk size of every target.
+func (m *diskUsageMonitor) measure() ([]int64, error) {
+	sizes := make([]int64, len(m.targets))
+	for i, target := range m.targets {
+		for _, path := range target.paths {
+			size, err := dirSize(path)
+			if err != nil {
+				return nil, err
+			}
+			sizes[i] += size
+		}
+	}
+
+	return sizes, nil
+}
+
+// addSample records the sizes taken at the given time and drops the samples
+// that have fallen out of the trailing window.
+//
+// This function is safe for concurrent access.
+func (m *diskUsageMonitor) addSample(now time.Time, sizes []int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.samples = append(m.samples, diskUsageSample{timestamp: now, sizes: sizes})
+
+	cutoff := now.Add(-diskUsageWindow)
+	i := 0
+	for i < len(m.samples) && m.samples[i].timestamp.Before(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// sample measures the current on-disk size of every target and records it.
+func (m *diskUsageMonitor) sample() error {
+	sizes, err := m.measure()
+	if err != nil {
+		return err
+	}
+	m.addSample(time.Now(), sizes)
+	return nil
+}
+
+// usage returns the on-disk size of every target with the given current sizes
+// along with the growth rate forecasted from the oldest sample in the trailing
+// window.  The growth rate is 0 if there aren't any samples older than now.
+//
+// This function is safe for concurrent access.
+func (m *diskUsageMonitor) usage(now time.Time, sizes []int64) []diskUsage {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var oldest *diskUsageSample
+	if len(m.samples) > 0 && m.samples[0].timestamp.Before(now) {
+		oldest = &m.samples[0]
+	}
+
+	usages := make([]diskUsage, 0, len(m.targets))
+	for i, target := range m.targets {
+		usage := diskUsage{
+			name:  target.name,
+			paths: target.paths,
+			size:  sizes[i],
+		}
+		if oldest != nil {
+			usage.window = now.Sub(oldest.timestamp)
+			growth := float64(sizes[i]-oldest.sizes[i]) /
+				usage.window.Hours() * 24
+			usage.growthPerDay = int64(growth)
+		}
+		usages = append(usages, usage)
+	}
+
+	return usages
+}
+
+// DiskUsage returns the on-disk size of every tracked target as of the latest
+// sample along with their forecasted growth rates in bytes per day and the time
+// the sample was taken.  The directories aren't walked here so that repeated
+// calls stay cheap.
+//
+// This function is safe for concurrent access.
+func (m *diskUsageMonitor) DiskUsage() ([]diskUsage, time.Time, error) {
+	m.mtx.Lock()
+	if len(m.samples) == 0 {
+		m.mtx.Unlock()
+		return nil, time.Time{}, errDiskUsageNotSampled
+	}
+	latest := m.samples[len(m.samples)-1]
+	m.mtx.Unlock()
+
+	return m.usage(latest.timestamp, latest.sizes), latest.timestamp, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "a"), make([]byte, 100), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "sub", "b"), make([]byte, 50), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := dirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 150 {
+		t.Fatalf("expected size of 150, got %d", size)
+	}
+
+	// A path that doesn't exist should have a size of 0.
+	size, err = dirSize(filepath.Join(dir, "doesnotexist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Fatalf("expected size of 0, got %d", size)
+	}
+}
+
+func TestDiskUsageForecast(t *testing.T) {
+	m := newDiskUsageMonitor([]diskUsageTarget{
+		{name: "blocks"},
+		{name: "flatutreexoproofindex"},
+	})
+	start := time.Unix(1700000000, 0)
+
+	// No samples means there's nothing to forecast with.
+	usages := m.usage(start, []int64{1000, 2000})
+	for _, usage := range usages {
+		if usage.growthPerDay != 0 || usage.window != 0 {
+			t.Fatalf("%s: expected no forecast, got %d bytes/day over %v",
+				usage.name, usage.growthPerDay, usage.window)
+		}
+	}
+
+	// Samples that fall out of the trailing window shouldn't be used for
+	// the forecast.
+	m.addSample(start, []int64{0, 0})
+	m.addSample(start.Add(time.Hour*12), []int64{1000, 2000})
+	m.addSample(start.Add(diskUsageWindow+time.Hour), []int64{1500, 3000})
+	if len(m.samples) != 2 {
+		t.Fatalf("expected 2 samples in the window, got %d", len(m.samples))
+	}
+
+	now := start.Add(time.Hour * 36)
+	usages = m.usage(now, []int64{2000, 5000})
+	expected := []int64{1000, 3000}
+	for i, usage := range usages {
+		if usage.window != time.Hour*24 {
+			t.Fatalf("%s: expected window of %v, got %v",
+				usage.name, time.Hour*24, usage.window)
+		}
+		if usage.growthPerDay != expected[i] {
+			t.Fatalf("%s: expected growth of %d bytes/day, got %d",
+				usage.name, expected[i], usage.growthPerDay)
+		}
+	}
+}
+
+func TestDiskUsageLatestSample(t *testing.T) {
+	m := newDiskUsageMonitor([]diskUsageTarget{{name: "blocks"}})
+
+	// Nothing to serve before the first sample.
+	_, _, err := m.DiskUsage()
+	if err != errDiskUsageNotSampled {
+		t.Fatalf("expected %v, got %v", errDiskUsageNotSampled, err)
+	}
+
+	start := time.Now().Add(-time.Hour * 2)
+	m.addSample(start, []int64{1000})
+	m.addSample(start.Add(time.Hour), []int64{2000})
+
+	// The latest sample should be served as is without measuring the
+	// directories again.
+	usages, sampledAt, err := m.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sampledAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected sample time of %v, got %v", start.Add(time.Hour), sampledAt)
+	}
+	if usages[0].size != 2000 {
+		t.Fatalf("expected size of 2000, got %d", usages[0].size)
+	}
+	if usages[0].growthPerDay != 24000 {
+		t.Fatalf("expected growth of 24000 bytes/day, got %d", usages[0].growthPerDay)
+	}
+}
@@ -29,6 +29,9 @@ Application Options:
 	    --addrindex             Maintain a full address-based transaction index
 	                            which makes the searchrawtransactions RPC
 	                            available
+	    --backgroundcpupercent= Maximum percentage of the CPU cores used by
+	                            background work such as catching up indexes and
+	                            compacting proofs (1-100) (default: 100)
 	    --banduration=          How long to ban misbehaving peers.  Valid time
 	                            units are {s, m, h}.  Minimum 1 second (default:
 	                            24h0m0s)
@@ -45,6 +48,13 @@ Application Options:
 	    --blockprioritysize=    Size in bytes for high-priority/low-fee
 	                            transactions when creating a block (default:
 	                            50000)
+	    --blockrelayconns=      Number of outbound connections that only relay
+	                            blocks to make in addition to the full-relay
+	                            ones
+	    --blockrelayproxy=      Connect to block-relay-only peers via this SOCKS5
+	                            proxy instead of the one from --proxy (eg.
+	                            127.0.0.1:9050) -- Use direct to connect to them
+	                            without a proxy
 	    --blocksonly            Do not accept transactions from remote peers.
 	-C, --configfile=           Path to configuration file
 	    --connect=              Connect only to the specified peers at startup
@@ -68,16 +78,33 @@ Application Options:
 	                            database on start up and then exits.
 	    --externalip=           Add an ip to the list of local addresses we claim
 	                            to listen on to peers
+	    --fullrelayproxy=       Connect to full-relay peers via this SOCKS5 proxy
+	                            instead of the one from --proxy (eg.
+	                            127.0.0.1:9050) -- Use direct to connect to them
+	                            without a proxy
 	    --generate              Generate (mine) bitcoins using the CPU
+	    --incrementalrelayfee=  The fee rate in BTC/kB a replacement transaction
+	                            must pay for its own size on top of the fees of
+	                            the transactions it replaces. (default: 1e-05)
 	    --limitfreerelay=       Limit relay of transactions with no transaction
 	                            fee to the given amount in thousands of bytes per
 	                            minute (default: 15)
 	    --listen=               Add an interface/port to listen for connections
 	                            (default all interfaces port: 8333, testnet:
 	                            18333, signet: 38333)
+	    --listenonion           Automatically create a Tor v3 onion service for
+	                            inbound connections through the Tor control port
+	    --listenservices=       Advertise only the given services to the peers
+	                            connecting to a listener in the form of
+	                            <listen address>=<service>[,<service>...]
+	                            (services: network, networklimited, bloom,
+	                            witness, cf, utreexo).  Services the node doesn't
+	                            offer are never advertised
 	    --logdir=               Directory to log output
 	    --maxorphantx=          Max number of orphan transactions to keep in
 	                            memory (default: 100)
+	    --maxpeerfilteredblocks= The maximum number of filtered blocks served to
+	                            a single peer per minute (default: 2000)
 	    --maxpeers=             Max number of inbound and outbound peers
 	                            (default: 125)
 	    --miningaddr=           Add the specified payment address to the list of
@@ -96,7 +123,8 @@ Application Options:
 	                            --connect or --proxy options are used without
 	                            also specifying listen interfaces via --listen
 	    --noonion               Disable connecting to tor hidden services
-	    --nopeerbloomfilters    Disable bloom filtering support
+	    --nopeerbloomfilters    Disable bloom filtering support.  It's disabled
+	                            unless --peerbloomfilters is given
 	    --norelaypriority       Do not require free or low-fee transactions to
 	                            have high priority for relaying
 	    --norpc                 Disable built-in RPC server -- NOTE: The RPC
@@ -106,12 +134,25 @@ Application Options:
 	    --notls                 Disable TLS for the RPC server -- NOTE: This is
 	                            only allowed if the RPC server is bound to
 	                            localhost
+	    --nov2transport         Disable the BIP0324 v2 encrypted transport for
+	                            peer connections -- When enabled, outbound
+	                            connections that fail its handshake are retried
+	                            with the unencrypted v1 transport
 	    --onion=                Connect to tor hidden services via SOCKS5 proxy
 	                            (eg. 127.0.0.1:9050)
 	    --onionpass=            Password for onion proxy server
 	    --onionuser=            Username for onion proxy server
+	    --onlynet=              Only make automatic outbound connections to
+	                            addresses of this network (ipv4, ipv6 or onion)
+	                            -- May be given multiple times
+	    --peerbloomfilters      Enable bloom filtering support (BIP0037)
 	    --profile=              Enable HTTP profiling on given port -- NOTE port
 	                            must be between 1024 and 65536
+	    --proofproxy=           Connect to the full-relay peers that transaction
+	                            proofs are fetched from when running as a utreexo
+	                            CSN via this SOCKS5 proxy instead of the one from
+	                            --proxy (eg. 127.0.0.1:9050) -- Use direct to
+	                            connect to them without a proxy
 	    --proxy=                Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)
 	    --proxypass=            Password for proxy server
 	    --proxyuser=            Username for proxy server
@@ -140,9 +181,21 @@ Application Options:
 	    --sigcachemaxsize=      The maximum number of entries in the signature
 	                            verification cache (default: 100000)
 	    --simnet                Use the simulation test network
+	    --staletiptimeout=      How long the tip may go without advancing before
+	                            an outbound peer is swapped out, the DNS seeds
+	                            are queried again and a warning is raised.
+	                            Valid time units are {s, m, h}.  Set to 0 to
+	                            disable (default: 30m0s)
 	    --testnet               Use the test network
+	    --testnet4              Use the test network (version 4)
+	    --torcontrol=           Tor control port to create the onion service
+	                            with when --listenonion is set (default:
+	                            127.0.0.1:9051)
 	    --torisolation          Enable Tor stream isolation by randomizing user
 	                            credentials for each connection.
+	    --torpassword=          Password for the Tor control port -- The
+	                            authentication cookie of Tor is used when not
+	                            set
 	    --trickleinterval=      Minimum time between attempts to send new
 	                            inventory to a connected peer (default: 10s)
 	    --txindex               Maintain a full hash-based transaction index
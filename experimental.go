@@ -0,0 +1,71 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+// experimentalFlags are the experimental features that may be enabled with
+// --experimental keyed by their names, along with what they do.  Features that
+// aren't ready to be on by default register themselves here as they're
+// introduced and check cfg.experimentalEnabled before doing anything
+// differently, so they can be tried out on the test networks without separate
+// builds.
+var experimentalFlags = map[string]string{}
+
+// experimentalFlagNames returns the names of the registered experimental
+// features in sorted order.
+func experimentalFlagNames() []string {
+	names := make([]string, 0, len(experimentalFlags))
+	for name := range experimentalFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseExperimentalFlags parses the --experimental options, each of which is a
+// comma-separated list of the names of experimental features, into the set of
+// features that are enabled.  The features may only be enabled on the test
+// networks.
+func parseExperimentalFlags(options []string, net wire.BitcoinNet) (map[string]struct{}, error) {
+	enabled := make(map[string]struct{})
+	for _, option := range options {
+		for _, name := range strings.Split(option, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := experimentalFlags[name]; !ok {
+				known := "none"
+				if len(experimentalFlags) > 0 {
+					known = strings.Join(experimentalFlagNames(), ", ")
+				}
+				return nil, fmt.Errorf("unknown experimental feature "+
+					"%q -- known features: %s", name, known)
+			}
+			enabled[name] = struct{}{}
+		}
+	}
+
+	if len(enabled) > 0 && net == wire.MainNet {
+		return nil, fmt.Errorf("experimental features may only be " +
+			"enabled on the test networks")
+	}
+
+	return enabled, nil
+}
+
+// experimentalEnabled returns whether the experimental feature with the given
+// name was enabled with --experimental.
+func (c *config) experimentalEnabled(name string) bool {
+	_, ok := c.experimental[name]
+	return ok
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestParseExperimentalFlags(t *testing.T) {
+	experimentalFlags["testfeaturea"] = "first test feature"
+	experimentalFlags["testfeatureb"] = "second test feature"
+	defer func() {
+		delete(experimentalFlags, "testfeaturea")
+		delete(experimentalFlags, "testfeatureb")
+	}()
+
+	tests := []struct {
+		options []string
+		net     wire.BitcoinNet
+		enabled []string
+		valid   bool
+	}{
+		{
+			net:   wire.MainNet,
+			valid: true,
+		},
+		{
+			options: []string{"testfeaturea"},
+			net:     wire.TestNet3,
+			enabled: []string{"testfeaturea"},
+			valid:   true,
+		},
+		{
+			options: []string{"TestFeatureA, testfeatureb", ","},
+			net:     wire.SimNet,
+			enabled: []string{"testfeaturea", "testfeatureb"},
+			valid:   true,
+		},
+		{
+			options: []string{"testfeaturea", "testfeaturea"},
+			net:     wire.TestNet,
+			enabled: []string{"testfeaturea"},
+			valid:   true,
+		},
+		{options: []string{"unknown"}, net: wire.TestNet3},
+		{options: []string{"testfeaturea"}, net: wire.MainNet},
+	}
+
+	for _, test := range tests {
+		enabled, err := parseExperimentalFlags(test.options, test.net)
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("%v on %v: expected an error", test.options,
+					test.net)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v on %v: unexpected error: %v", test.options,
+				test.net, err)
+		}
+		if len(enabled) != len(test.enabled) {
+			t.Fatalf("%v on %v: expected %d features, got %d",
+				test.options, test.net, len(test.enabled), len(enabled))
+		}
+		cfg := config{experimental: enabled}
+		for _, name := range test.enabled {
+			if !cfg.experimentalEnabled(name) {
+				t.Fatalf("%v on %v: expected %s to be enabled",
+					test.options, test.net, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/integration/rpctest"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// TestGenerateBlockUtreexoProof checks that the blocks mined by bridge nodes on
+// regtest are proven so that a CSN validates them and that a CSN is able to
+// mine blocks on its own.
+func TestGenerateBlockUtreexoProof(t *testing.T) {
+	for _, index := range []string{"--utreexoproofindex", "--flatutreexoproofindex"} {
+		bridgeNodeArgs := []string{index, "--noutreexo", "--nobdkwallet", "--prune=0"}
+		bridgeNode, err := rpctest.New(&chaincfg.RegressionNetParams, nil, bridgeNodeArgs, "")
+		if err != nil {
+			t.Fatal("TestGenerateBlockUtreexoProof fail. Unable to create primary harness: ", err)
+		}
+		if err := bridgeNode.SetUp(true, 5); err != nil {
+			t.Fatalf("TestGenerateBlockUtreexoProof fail. Unable to setup test chain: %v", err)
+		}
+		defer bridgeNode.TearDown()
+
+		csn, err := rpctest.New(&chaincfg.RegressionNetParams, nil, []string{"--nobdkwallet"}, "")
+		if err != nil {
+			t.Fatal("TestGenerateBlockUtreexoProof fail. Unable to create primary harness: ", err)
+		}
+		if err := csn.SetUp(true, 0); err != nil {
+			t.Fatalf("TestGenerateBlockUtreexoProof fail. Unable to setup test chain: %v", err)
+		}
+		defer csn.TearDown()
+
+		// Send a few transactions and mine a block with them and with a
+		// transaction that's not in the mempool.
+		txs := make([]string, 0, 4)
+		for i := 0; i < 3; i++ {
+			addr, err := bridgeNode.NewAddress()
+			if err != nil {
+				t.Fatalf("unable to get new address: %v", err)
+			}
+			addrScript, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				t.Fatalf("unable to generate pkscript to addr: %v", err)
+			}
+			output := wire.NewTxOut(btcutil.SatoshiPerBitcoin, addrScript)
+			txid, err := bridgeNode.SendOutputs([]*wire.TxOut{output}, 10)
+			if err != nil {
+				t.Fatalf("coinbase spend failed: %v", err)
+			}
+			txs = append(txs, txid.String())
+		}
+		addr, err := bridgeNode.NewAddress()
+		if err != nil {
+			t.Fatalf("unable to get new address: %v", err)
+		}
+		addrScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("unable to generate pkscript to addr: %v", err)
+		}
+		output := wire.NewTxOut(btcutil.SatoshiPerBitcoin, addrScript)
+		rawTx, err := bridgeNode.CreateTransaction([]*wire.TxOut{output}, 10, true)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := rawTx.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, hex.EncodeToString(buf.Bytes()))
+
+		blockHash, err := bridgeNode.Client.GenerateBlock(addr, txs)
+		if err != nil {
+			t.Fatalf("unable to generate block: %v", err)
+		}
+		block, err := bridgeNode.Client.GetBlock(blockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block.Transactions) != len(txs)+1 {
+			t.Fatalf("expected %d transactions in the block, got %d",
+				len(txs)+1, len(block.Transactions))
+		}
+
+		// Sync the CSN to the bridge node.  The CSN is only able to connect
+		// the generated block with its proof.
+		_, bestHeight, err := bridgeNode.Client.GetBestBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockHashes := make([]*chainhash.Hash, 0, bestHeight)
+		for height := int64(1); height <= int64(bestHeight); height++ {
+			blockHash, err := bridgeNode.Client.GetBlockHash(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blockHashes = append(blockHashes, blockHash)
+		}
+		blocks, err := fetchBlocks(blockHashes, bridgeNode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			err = csn.Client.SubmitBlock(block, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		bestHash, _, err := csn.Client.GetBestBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bestHash.IsEqual(blockHash) {
+			t.Fatalf("expected best block %v, got %v", blockHash, bestHash)
+		}
+
+		// The CSN proves the blocks it mines on its own.
+		csnHashes, err := csn.Client.GenerateToAddress(2, addr, nil)
+		if err != nil {
+			t.Fatalf("unable to generate blocks on the CSN: %v", err)
+		}
+		csnHash, err := csn.Client.GenerateBlock(addr, nil)
+		if err != nil {
+			t.Fatalf("unable to generate block on the CSN: %v", err)
+		}
+		_, csnHeight, err := csn.Client.GetBestBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if csnHeight != bestHeight+3 || len(csnHashes) != 2 {
+			t.Fatalf("expected the CSN to mine 3 blocks on top of "+
+				"height %d, got height %d", bestHeight, csnHeight)
+		}
+		if _, err := csn.Client.GetBlock(csnHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/integration/rpctest"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// TestGetBlockTemplateUtreexoProof checks that the utreexo proof included in
+// the block templates of bridge nodes lets a CSN validate the block mined from
+// the template.
+func TestGetBlockTemplateUtreexoProof(t *testing.T) {
+	for _, index := range []string{"--utreexoproofindex", "--flatutreexoproofindex"} {
+		bridgeNodeArgs := []string{index, "--noutreexo", "--nobdkwallet", "--prune=0"}
+		bridgeNode, err := rpctest.New(&chaincfg.RegressionNetParams, nil, bridgeNodeArgs, "")
+		if err != nil {
+			t.Fatal("TestGetBlockTemplateUtreexoProof fail. Unable to create primary harness: ", err)
+		}
+		if err := bridgeNode.SetUp(true, 5); err != nil {
+			t.Fatalf("TestGetBlockTemplateUtreexoProof fail. Unable to setup test chain: %v", err)
+		}
+		defer bridgeNode.TearDown()
+
+		csn, err := rpctest.New(&chaincfg.RegressionNetParams, nil, []string{"--nobdkwallet"}, "")
+		if err != nil {
+			t.Fatal("TestGetBlockTemplateUtreexoProof fail. Unable to create primary harness: ", err)
+		}
+		if err := csn.SetUp(true, 0); err != nil {
+			t.Fatalf("TestGetBlockTemplateUtreexoProof fail. Unable to setup test chain: %v", err)
+		}
+		defer csn.TearDown()
+
+		// Sync the CSN to the bridge node.
+		_, bestHeight, err := bridgeNode.Client.GetBestBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockHashes := make([]*chainhash.Hash, 0, bestHeight)
+		for height := int64(1); height <= int64(bestHeight); height++ {
+			blockHash, err := bridgeNode.Client.GetBlockHash(height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blockHashes = append(blockHashes, blockHash)
+		}
+		blocks, err := fetchBlocks(blockHashes, bridgeNode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			err = csn.Client.SubmitBlock(block, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Send a few transactions so that the template spends confirmed
+		// outputs.
+		for i := 0; i < 3; i++ {
+			addr, err := bridgeNode.NewAddress()
+			if err != nil {
+				t.Fatalf("unable to get new address: %v", err)
+			}
+			addrScript, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				t.Fatalf("unable to generate pkscript to addr: %v", err)
+			}
+			output := wire.NewTxOut(btcutil.SatoshiPerBitcoin, addrScript)
+			_, err = bridgeNode.SendOutputs([]*wire.TxOut{output}, 10)
+			if err != nil {
+				t.Fatalf("coinbase spend failed: %v", err)
+			}
+		}
+
+		request := &btcjson.TemplateRequest{
+			Capabilities: []string{"coinbasevalue", "utreexoproof"},
+			Rules:        []string{"segwit"},
+		}
+		template, err := bridgeNode.Client.GetBlockTemplate(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(template.Transactions) != 3 {
+			t.Fatalf("expected 3 transactions in the template, got %d",
+				len(template.Transactions))
+		}
+
+		// Mine a block with the transactions of the template and attach
+		// the proof of the template to it.
+		txs := make([]*btcutil.Tx, 0, len(template.Transactions))
+		for _, resultTx := range template.Transactions {
+			raw, err := hex.DecodeString(resultTx.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx, err := btcutil.NewTxFromBytes(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			txs = append(txs, tx)
+		}
+		raw, err := hex.DecodeString(template.UtreexoProof)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ud := new(wire.UData)
+		if err := ud.Deserialize(bytes.NewReader(raw)); err != nil {
+			t.Fatal(err)
+		}
+
+		prevBlock := blocks[len(blocks)-1]
+		prevBlock.SetHeight(bestHeight)
+		miningAddr, err := bridgeNode.NewAddress()
+		if err != nil {
+			t.Fatalf("unable to get new address: %v", err)
+		}
+		block, err := rpctest.CreateBlock(prevBlock, txs, template.Version,
+			time.Unix(template.CurTime, 0), miningAddr, nil,
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.MsgBlock().UData = ud
+
+		// The CSN is only able to connect the block with the proof.
+		err = csn.Client.SubmitBlock(block, nil)
+		if err != nil {
+			t.Fatalf("unable to submit the block mined from the template: %v", err)
+		}
+		bestHash, _, err := csn.Client.GetBestBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bestHash.IsEqual(block.Hash()) {
+			t.Fatalf("expected best block %v, got %v", block.Hash(), bestHash)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+// serviceNames maps the names accepted by --listenservices to the service
+// flags they stand for.
+var serviceNames = map[string]wire.ServiceFlag{
+	"network":        wire.SFNodeNetwork,
+	"networklimited": wire.SFNodeNetworkLimited,
+	"bloom":          wire.SFNodeBloom,
+	"witness":        wire.SFNodeWitness,
+	"cf":             wire.SFNodeCF,
+	"utreexo":        wire.SFNodeUtreexo,
+	"utreexoarchive": wire.SFNodeUtreexoArchive,
+	"utreexorecent":  wire.SFNodeUtreexoRecent,
+	"utreexocsn":     wire.SFNodeUtreexoCSN,
+}
+
+// parseListenServices parses a --listenservices option in the form of
+// <listen address>=<service>[,<service>...] and returns the listen address
+// and the services.  An empty list of services advertises none of them.
+func parseListenServices(option string) (string, wire.ServiceFlag, error) {
+	addr, names, found := strings.Cut(option, "=")
+	if !found || addr == "" {
+		return "", 0, fmt.Errorf("%q is not in the form of "+
+			"<listen address>=<service>[,<service>...]", option)
+	}
+
+	var services wire.ServiceFlag
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		service, ok := serviceNames[name]
+		if !ok {
+			return "", 0, fmt.Errorf("unknown service %q", name)
+		}
+		services |= service
+	}
+
+	return addr, services, nil
+}
+
+// serviceListener is a net.Listener whose accepted connections are advertised
+// their own set of services instead of the ones of the server.
+type serviceListener struct {
+	net.Listener
+	services wire.ServiceFlag
+}
+
+// Accept waits for and returns the next connection to the listener.
+//
+// This is part of the net.Listener interface.
+func (l *serviceListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &serviceConn{Conn: conn, services: l.services}, nil
+}
+
+// serviceConn is a connection accepted by a serviceListener.
+type serviceConn struct {
+	net.Conn
+	services wire.ServiceFlag
+}
+
+// connServices returns the services to advertise to the peer of an inbound
+// connection.  These are the services of the listener that accepted the
+// connection if it has its own, limited to the ones the server offers.
+func connServices(conn net.Conn, services wire.ServiceFlag) wire.ServiceFlag {
+	if sc, ok := conn.(*serviceConn); ok {
+		return sc.services & services
+	}
+	return services
+}
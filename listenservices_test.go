@@ -0,0 +1,101 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestParseListenServices(t *testing.T) {
+	tests := []struct {
+		option   string
+		addr     string
+		services wire.ServiceFlag
+		valid    bool
+	}{
+		{
+			option:   "127.0.0.1:8336=network,witness",
+			addr:     "127.0.0.1:8336",
+			services: wire.SFNodeNetwork | wire.SFNodeWitness,
+			valid:    true,
+		},
+		{
+			option: "[::1]:8333=Network, Witness,UTREEXO",
+			addr:   "[::1]:8333",
+			services: wire.SFNodeNetwork | wire.SFNodeWitness |
+				wire.SFNodeUtreexo,
+			valid: true,
+		},
+		{
+			option: ":8333=",
+			addr:   ":8333",
+			valid:  true,
+		},
+		{option: "127.0.0.1:8333"},
+		{option: "=network"},
+		{option: "127.0.0.1:8333=network,getutxo"},
+	}
+	for _, test := range tests {
+		addr, services, err := parseListenServices(test.option)
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("%s: expected an error", test.option)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.option, err)
+		}
+		if addr != test.addr || services != test.services {
+			t.Fatalf("%s: expected %s and %v, got %s and %v",
+				test.option, test.addr, test.services, addr,
+				services)
+		}
+	}
+}
+
+func TestServiceListener(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := &serviceListener{
+		Listener: listener,
+		services: wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeBloom,
+	}
+	defer sl.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp4", sl.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := sl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Only the services of the listener that the server offers as well are
+	// advertised.
+	offered := wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeUtreexo
+	want := wire.SFNodeNetwork | wire.SFNodeWitness
+	if got := connServices(conn, offered); got != want {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Connections of the other listeners are advertised the services of
+	// the server.
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	if got := connServices(server, offered); got != offered {
+		t.Fatalf("expected %v, got %v", offered, got)
+	}
+}
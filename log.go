@@ -15,6 +15,7 @@ import (
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/blockchain/indexers"
 	"github.com/utreexo/utreexod/connmgr"
+	"github.com/utreexo/utreexod/corebridge"
 	"github.com/utreexo/utreexod/database"
 	"github.com/utreexo/utreexod/electrum"
 	"github.com/utreexo/utreexod/mempool"
@@ -22,8 +23,11 @@ import (
 	"github.com/utreexo/utreexod/mining/cpuminer"
 	"github.com/utreexo/utreexod/netsync"
 	"github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/replication"
+	"github.com/utreexo/utreexod/rpcserver/grpc"
 	"github.com/utreexo/utreexod/txscript"
 	"github.com/utreexo/utreexod/wallet"
+	"github.com/utreexo/utreexod/zmq"
 
 	"github.com/btcsuite/btclog"
 	"github.com/jrick/logrotate/rotator"
@@ -75,6 +79,10 @@ var (
 	wlltLog = backendLog.Logger("WLLT")
 	elecLog = backendLog.Logger("ELEC")
 	bdkwLog = backendLog.Logger("BDKW")
+	zmqnLog = backendLog.Logger("ZMQN")
+	grpcLog = backendLog.Logger("GRPC")
+	coreLog = backendLog.Logger("CORE")
+	replLog = backendLog.Logger("REPL")
 )
 
 // Initialize package-global logger variables.
@@ -93,6 +101,10 @@ func init() {
 	wallet.UseLogger(wlltLog)
 	electrum.UseLogger(elecLog)
 	bdkwallet.UseLogger(bdkwLog)
+	zmq.UseLogger(zmqnLog)
+	grpc.UseLogger(grpcLog)
+	corebridge.UseLogger(coreLog)
+	replication.UseLogger(replLog)
 }
 
 // subsystemLoggers maps each subsystem identifier to its associated logger.
@@ -115,6 +127,10 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"WLLT": wlltLog,
 	"ELEC": elecLog,
 	"BDKW": bdkwLog,
+	"ZMQN": zmqnLog,
+	"GRPC": grpcLog,
+	"CORE": coreLog,
+	"REPL": replLog,
 }
 
 // initLogRotator initializes the logging rotater to write logs to logFile and
@@ -50,6 +50,13 @@ type TxMempool interface {
 	ProcessTransaction(tx *btcutil.Tx, utreexoData *wire.UData, allowOrphan,
 		rateLimit bool, tag Tag) ([]*TxDesc, error)
 
+	// ProcessPackage accepts a package made of a child transaction and
+	// its unconfirmed parents into the memory pool atomically.  The
+	// parents don't need to pay the minimum relay fee on their own as
+	// long as the package as a whole does.
+	ProcessPackage(txs []*btcutil.Tx, udatas []*wire.UData,
+		rateLimit bool) (*PackageAcceptResult, error)
+
 	// RemoveTransaction removes the passed transaction from the mempool.
 	// When the removeRedeemers flag is set, any transactions that redeem
 	// outputs from the removed transaction will also be removed
@@ -61,8 +68,10 @@ type TxMempool interface {
 	// `testmempoolaccept` RPC method. It will perform a series of checks
 	// to decide whether this transaction can be accepted to the mempool.
 	// If not, the specific error is returned and the caller needs to take
-	// actions based on it.
-	CheckMempoolAcceptance(tx *btcutil.Tx) (*MempoolAcceptResult, error)
+	// actions based on it.  The utreexo data of the inputs is required on
+	// nodes without the utxo set and is ignored otherwise.
+	CheckMempoolAcceptance(tx *btcutil.Tx,
+		utreexoData *wire.UData) (*MempoolAcceptResult, error)
 
 	// CheckSpend checks whether the passed outpoint is already spent by
 	// a transaction in the mempool. If that's the case the spending
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/blockchain/indexers"
 	"github.com/utreexo/utreexod/btcjson"
@@ -103,6 +104,17 @@ type Config struct {
 	// PruneFromAccumulator uncaches the given hashes from the accumulator.
 	PruneFromAccumulator func(hashes []wire.LeafData) error
 
+	// GenerateUData defines the function to use to prove the passed in
+	// leaves against the current roots of the utreexo accumulator.  This
+	// is only used when the node is run with the UtreexoView activated.
+	GenerateUData func(dels []wire.LeafData) (*wire.UData, error)
+
+	// CacheAccProof verifies the given accumulator proof against the
+	// current roots of the utreexo accumulator and caches the proven
+	// hashes.  This is only used when the node is run with the UtreexoView
+	// activated.
+	CacheAccProof func(hashes []utreexo.Hash, proof *utreexo.Proof) error
+
 	// SigCache defines a signature cache to use.
 	SigCache *txscript.SigCache
 
@@ -117,6 +129,11 @@ type Config struct {
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
 	// records all new transactions it observes into the feeEstimator.
 	FeeEstimator *FeeEstimator
+
+	// SmartFeeEstimator provides a smart fee estimator.  If it is not nil,
+	// the mempool records all the transactions entering and leaving it
+	// into the smart fee estimator.
+	SmartFeeEstimator *SmartFeeEstimator
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -158,6 +175,12 @@ type Policy struct {
 	// considered a non-zero fee.
 	MinRelayTxFee btcutil.Amount
 
+	// IncrementalRelayFee defines the fee rate in BTC/kB a replacement
+	// transaction must pay for its own size on top of the fees of the
+	// transactions it replaces.  The minimum relay fee is used if it's
+	// nil.
+	IncrementalRelayFee *btcutil.Amount
+
 	// RejectReplacement, if true, rejects accepting replacement
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
@@ -194,6 +217,7 @@ type TxPool struct {
 	cfg           Config
 	pool          map[chainhash.Hash]*TxDesc
 	poolLeaves    map[chainhash.Hash][]wire.LeafData
+	poolProofs    map[chainhash.Hash]*txProof
 	orphans       map[chainhash.Hash]*orphanTx
 	orphanUData   map[chainhash.Hash]*wire.UData
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx
@@ -206,6 +230,22 @@ type TxPool struct {
 	// the scan will only run when an orphan is added to the pool as opposed
 	// to on an unconditional timer.
 	nextExpireScan time.Time
+
+	// aggregatedLeaves are the leaf datas for all the inputs of the
+	// transactions in the pool keyed by their leaf hash.  The proofs for
+	// these leaves are cached in the accumulator so together they make up
+	// an aggregated proof for the whole mempool.  This allows the proof of
+	// a block to be mostly assembled locally when it includes transactions
+	// that were already in the mempool.
+	aggregatedLeaves map[utreexo.Hash]wire.LeafData
+
+	// unconfirmedSpends are the outpoints created by unconfirmed
+	// transactions that are spent by the transactions in the pool.  The
+	// leaf datas of these inputs are swapped in once the outpoints are
+	// confirmed.  The set has its own lock so that the chain is able to
+	// consult it while it holds the chain lock.
+	unconfirmedMtx    sync.RWMutex
+	unconfirmedSpends map[wire.OutPoint]struct{}
 }
 
 // Ensure the TxPool type implements the mining.TxSource interface.
@@ -530,7 +570,12 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
+		mp.removeUtreexoData(txDesc.Tx)
 		delete(mp.pool, *txHash)
+
+		if mp.cfg.SmartFeeEstimator != nil {
+			mp.cfg.SmartFeeEstimator.RemoveTransaction(txHash)
+		}
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -605,6 +650,19 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		mp.cfg.FeeEstimator.ObserveTransaction(txD)
 	}
 
+	// The fee rate of transactions spending unconfirmed outputs doesn't
+	// reflect how fast they confirm so they're not used for estimates.
+	if mp.cfg.SmartFeeEstimator != nil {
+		validFeeEstimate := true
+		for _, txIn := range tx.MsgTx().TxIn {
+			if _, exists := mp.pool[txIn.PreviousOutPoint.Hash]; exists {
+				validFeeEstimate = false
+				break
+			}
+		}
+		mp.cfg.SmartFeeEstimator.ProcessTransaction(txD, validFeeEstimate)
+	}
+
 	return txD
 }
 
@@ -621,9 +679,130 @@ func (mp *TxPool) addUtreexoData(tx *btcutil.Tx, udata *wire.UData) error {
 	}
 	mp.poolLeaves[*tx.Hash()] = udata.LeafDatas
 
+	// Keep the proof of the inputs around to re-root it as blocks are
+	// connected.
+	if mp.cfg.IsUtreexoViewActive != nil && mp.cfg.IsUtreexoViewActive() {
+		mp.addTxProof(tx.Hash(), udata.LeafDatas)
+	}
+
+	txIns := tx.MsgTx().TxIn
+	for i, ld := range udata.LeafDatas {
+		// Unconfirmed leaves aren't present in the accumulator.
+		if ld.IsUnconfirmed() {
+			mp.unconfirmedMtx.Lock()
+			mp.unconfirmedSpends[txIns[i].PreviousOutPoint] = struct{}{}
+			mp.unconfirmedMtx.Unlock()
+			continue
+		}
+		if ld.IsCompact() {
+			continue
+		}
+		mp.aggregatedLeaves[ld.LeafHash()] = ld
+	}
+
 	return nil
 }
 
+// removeUtreexoData removes the leaves for the given tx from the memory pool.
+// The proof is left cached in the accumulator as a replacement transaction may
+// still need it for the ingestion.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeUtreexoData(tx *btcutil.Tx) {
+	leaves, found := mp.poolLeaves[*tx.Hash()]
+	if !found {
+		return
+	}
+	delete(mp.poolLeaves, *tx.Hash())
+	delete(mp.poolProofs, *tx.Hash())
+
+	txIns := tx.MsgTx().TxIn
+	for i, ld := range leaves {
+		if ld.IsUnconfirmed() {
+			mp.unconfirmedMtx.Lock()
+			delete(mp.unconfirmedSpends, txIns[i].PreviousOutPoint)
+			mp.unconfirmedMtx.Unlock()
+			continue
+		}
+		if ld.IsCompact() {
+			continue
+		}
+		delete(mp.aggregatedLeaves, ld.LeafHash())
+	}
+}
+
+// IsUnconfirmedSpend returns whether the outpoint was created by an unconfirmed
+// transaction and is spent by a transaction in the pool.
+//
+// This function is safe for concurrent access and doesn't take the mempool lock
+// so it may be called while the chain lock is held.
+func (mp *TxPool) IsUnconfirmedSpend(op wire.OutPoint) bool {
+	mp.unconfirmedMtx.RLock()
+	_, found := mp.unconfirmedSpends[op]
+	mp.unconfirmedMtx.RUnlock()
+
+	return found
+}
+
+// ConfirmLeafDatas swaps in the leaf datas of the inputs of the transactions in
+// the pool that spend the outputs of the passed block in place of the
+// unconfirmed leaf datas they were accepted with.  The proofs of these outputs
+// are kept by the accumulator when the block is connected so the transactions
+// are relayed to utreexo peers with the proofs of all of their confirmed
+// inputs.  It should be called after the block is connected and before its
+// transactions are removed from the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ConfirmLeafDatas(block *btcutil.Block) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	for txIdx, tx := range block.Transactions() {
+		for outIdx, txOut := range tx.MsgTx().TxOut {
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(outIdx)}
+			if !mp.IsUnconfirmedSpend(op) {
+				continue
+			}
+			spender, found := mp.outpoints[op]
+			if !found {
+				continue
+			}
+			leaves, found := mp.poolLeaves[*spender.Hash()]
+			if !found {
+				continue
+			}
+
+			// The leaves are handed out by FetchLeafDatas so they're
+			// copied instead of being modified in place.
+			confirmed := make([]wire.LeafData, len(leaves))
+			copy(confirmed, leaves)
+			for i, txIn := range spender.MsgTx().TxIn {
+				if txIn.PreviousOutPoint != op {
+					continue
+				}
+
+				ld := wire.LeafData{
+					BlockHash:  *block.Hash(),
+					OutPoint:   op,
+					Amount:     txOut.Value,
+					PkScript:   txOut.PkScript,
+					Height:     block.Height(),
+					IsCoinBase: txIdx == 0,
+				}
+				confirmed[i] = ld
+				mp.aggregatedLeaves[ld.LeafHash()] = ld
+				break
+			}
+			mp.poolLeaves[*spender.Hash()] = confirmed
+
+			mp.unconfirmedMtx.Lock()
+			delete(mp.unconfirmedSpends, op)
+			mp.unconfirmedMtx.Unlock()
+		}
+	}
+}
+
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // If it does, we'll check whether each of those transactions are signaling for
@@ -909,6 +1088,58 @@ func (mp *TxPool) fetchInputUtxosFromLeaves(tx *btcutil.Tx, leaves []wire.LeafDa
 	return utxoView
 }
 
+// fetchInputUtxosFromUData verifies the passed utreexo data against the current
+// roots of the utreexo accumulator and returns a utxo view of the inputs of the
+// transaction built from the proven leaf datas.  Inputs spending outputs of
+// other transactions in the pool are marked as unconfirmed in the utreexo data
+// and are fetched from the pool instead.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) fetchInputUtxosFromUData(tx *btcutil.Tx,
+	ud *wire.UData) (*blockchain.UtxoViewpoint, error) {
+
+	txHash := tx.Hash()
+	txIns := tx.MsgTx().TxIn
+	if ud == nil {
+		str := fmt.Sprintf("transaction %v is missing the utreexo "+
+			"data of its inputs", txHash)
+		return nil, txRuleError(wire.RejectInvalid, str)
+	}
+	if len(ud.LeafDatas) != len(txIns) {
+		str := fmt.Sprintf("transaction %v has %d inputs but its "+
+			"utreexo data has %d leaf datas", txHash, len(txIns),
+			len(ud.LeafDatas))
+		return nil, txRuleError(wire.RejectInvalid, str)
+	}
+
+	// Verify the proof to ensure that the leaf datas of the confirmed
+	// inputs exist in the accumulator.
+	err := mp.cfg.VerifyUData(ud, txIns, false)
+	if err != nil {
+		str := fmt.Sprintf("transaction %v failed the utreexo data verification. %v",
+			txHash, err)
+		return nil, txRuleError(wire.RejectInvalid, str)
+	}
+	log.Debugf("VerifyUData passed for tx %s", txHash.String())
+
+	// The leaf datas were reconstructed from the inputs during the
+	// verification so they must commit to the outpoints being spent.
+	for i, ld := range ud.LeafDatas {
+		if ld.IsUnconfirmed() {
+			continue
+		}
+		if ld.OutPoint != txIns[i].PreviousOutPoint {
+			str := fmt.Sprintf("transaction %v input %d spends %v "+
+				"but its leaf data is for %v", txHash, i,
+				txIns[i].PreviousOutPoint, ld.OutPoint)
+			return nil, txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	// After the validation passes, turn that proof into a utxoView.
+	return mp.fetchInputUtxosFromLeaves(tx, ud.LeafDatas), nil
+}
+
 // FetchTransaction returns the requested transaction from the transaction pool.
 // This only fetches from the main transaction pool and does not include
 // orphans.
@@ -928,7 +1159,9 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*btcutil.Tx, error)
 }
 
 // FetchLeafDatas returns the leafdatas for the given tx.  Returns an error if
-// the leaves for the given tx is not in the pool.
+// the leaves for the given tx is not in the pool.  The leaves are removed along
+// with the tx so they're no longer available once the tx is mined, replaced or
+// evicted.
 func (mp *TxPool) FetchLeafDatas(txHash *chainhash.Hash) ([]wire.LeafData, error) {
 	// Protect concurrent access.
 	mp.mtx.RLock()
@@ -942,6 +1175,19 @@ func (mp *TxPool) FetchLeafDatas(txHash *chainhash.Hash) ([]wire.LeafData, error
 	return nil, fmt.Errorf("leafdata for the transaction is not in the pool")
 }
 
+// FetchLeafDataByHash returns the leafdata with the given leaf hash if it's
+// being spent by any of the transactions in the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchLeafDataByHash(leafHash utreexo.Hash) (wire.LeafData, bool) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	ld, found := mp.aggregatedLeaves[leafHash]
+	mp.mtx.RUnlock()
+
+	return ld, found
+}
+
 // validateReplacement determines whether a transaction is deemed as a valid
 // replacement of all of its conflicts according to the RBF policy. If it is
 // valid, no error is returned. Otherwise, an error is returned indicating what
@@ -1007,8 +1253,12 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 
 	// It should also have an absolute fee greater than all of the
 	// transactions it intends to replace and pay for its own bandwidth,
-	// which is determined by our minimum relay fee.
-	minFee := calcMinRequiredTxRelayFee(txSize, mp.cfg.Policy.MinRelayTxFee)
+	// which is determined by our incremental relay fee.
+	incrementalRelayFee := mp.cfg.Policy.MinRelayTxFee
+	if mp.cfg.Policy.IncrementalRelayFee != nil {
+		incrementalRelayFee = *mp.cfg.Policy.IncrementalRelayFee
+	}
+	minFee := calcMinRequiredTxRelayFee(txSize, incrementalRelayFee)
 	if txFee < conflictsFee+minFee {
 		str := fmt.Sprintf("replacement transaction %v has an "+
 			"insufficient absolute fee: needs %v, has %v",
@@ -1371,7 +1621,7 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 		// input transactions can't be found for some reason.
 		tx := desc.Tx
 		var currentPriority float64
-		if mp.cfg.IsUtreexoViewActive == nil && !mp.cfg.IsUtreexoViewActive() {
+		if mp.cfg.IsUtreexoViewActive == nil || !mp.cfg.IsUtreexoViewActive() {
 			utxos, err := mp.fetchInputUtxos(tx)
 			if err == nil {
 				currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
@@ -1396,6 +1646,8 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 			StartingPriority: desc.StartingPriority,
 			CurrentPriority:  currentPriority,
 			Depends:          make([]string, 0),
+
+			BIP125Replaceable: mp.signalsReplacement(tx, nil),
 		}
 		for _, txIn := range tx.MsgTx().TxIn {
 			hash := &txIn.PreviousOutPoint.Hash
@@ -1452,7 +1704,12 @@ type MempoolAcceptResult struct {
 // RPC method. It will perform a series of checks to decide whether this
 // transaction can be accepted to the mempool. If not, the specific error is
 // returned and the caller needs to take actions based on it.
-func (mp *TxPool) CheckMempoolAcceptance(tx *btcutil.Tx) (
+//
+// On nodes without the utxo set, the inputs are fetched from the passed utreexo
+// data after its proof is verified against the current roots of the
+// accumulator.  The proof isn't cached in the accumulator.  The utreexo data is
+// ignored otherwise.
+func (mp *TxPool) CheckMempoolAcceptance(tx *btcutil.Tx, utreexoData *wire.UData) (
 	*MempoolAcceptResult, error) {
 
 	mp.mtx.RLock()
@@ -1462,7 +1719,9 @@ func (mp *TxPool) CheckMempoolAcceptance(tx *btcutil.Tx) (
 	// which has the effect that we always check the fee paid from this tx
 	// is greater than min relay fee. We also reject this tx if it's
 	// already an orphan.
-	result, err := mp.checkMempoolAcceptance(tx, nil, true, true, true)
+	result, err := mp.checkMempoolAcceptance(
+		tx, utreexoData, true, true, true,
+	)
 	if err != nil {
 		log.Errorf("CheckMempoolAcceptance: %v", err)
 		return nil, err
@@ -1542,18 +1801,13 @@ func (mp *TxPool) checkMempoolAcceptance(tx *btcutil.Tx, utreexoData *wire.UData
 
 	var utxoView *blockchain.UtxoViewpoint
 	if mp.cfg.IsUtreexoViewActive != nil && mp.cfg.IsUtreexoViewActive() {
-		// First verify the proof to ensure that the proof the peer has
-		// sent was over valid.
-		err = mp.cfg.VerifyUData(utreexoData, tx.MsgTx().TxIn, false)
+		// There's no utxo set to fetch the inputs from so they're
+		// fetched from the utreexo data after it's been proven against
+		// the current roots of the accumulator.
+		utxoView, err = mp.fetchInputUtxosFromUData(tx, utreexoData)
 		if err != nil {
-			str := fmt.Sprintf("transaction %v failed the utreexo data verification. %v",
-				txHash, err)
-			return nil, txRuleError(wire.RejectInvalid, str)
+			return nil, err
 		}
-		log.Debugf("VerifyUData passed for tx %s", txHash.String())
-
-		// After the validation passes, turn that proof into a utxoView.
-		utxoView = mp.fetchInputUtxosFromLeaves(tx, utreexoData.LeafDatas)
 	} else {
 		// Fetch all of the unspent transaction outputs referenced by the
 		// inputs to this transaction. This function also attempts to fetch the
@@ -1910,13 +2164,16 @@ func (mp *TxPool) validateRelayFeeMet(tx *btcutil.Tx, txFee, txSize int64,
 // transactions until they are mined into a block.
 func New(cfg *Config) *TxPool {
 	return &TxPool{
-		cfg:            *cfg,
-		pool:           make(map[chainhash.Hash]*TxDesc),
-		poolLeaves:     make(map[chainhash.Hash][]wire.LeafData),
-		orphans:        make(map[chainhash.Hash]*orphanTx),
-		orphanUData:    make(map[chainhash.Hash]*wire.UData),
-		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
-		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
-		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		cfg:               *cfg,
+		pool:              make(map[chainhash.Hash]*TxDesc),
+		poolLeaves:        make(map[chainhash.Hash][]wire.LeafData),
+		poolProofs:        make(map[chainhash.Hash]*txProof),
+		orphans:           make(map[chainhash.Hash]*orphanTx),
+		orphanUData:       make(map[chainhash.Hash]*wire.UData),
+		orphansByPrev:     make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
+		nextExpireScan:    time.Now().Add(orphanExpireScanInterval),
+		outpoints:         make(map[wire.OutPoint]*btcutil.Tx),
+		aggregatedLeaves:  make(map[utreexo.Hash]wire.LeafData),
+		unconfirmedSpends: make(map[wire.OutPoint]struct{}),
 	}
 }
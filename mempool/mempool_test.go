@@ -6,6 +6,7 @@ package mempool
 
 import (
 	"encoding/hex"
+	"fmt"
 	"reflect"
 	"strings"
 	"sync"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/btcutil"
 	"github.com/utreexo/utreexod/chaincfg"
@@ -1673,6 +1675,70 @@ func TestRBF(t *testing.T) {
 			},
 			err: "insufficient absolute fee",
 		},
+		{
+			// The fees a replacement pays on top of the fees of the
+			// transactions it replaces must cover its size at the
+			// incremental relay fee rather than the minimum relay
+			// fee when it's set.
+			name: "insufficient incremental relay fee",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				incrementalRelayFee := btcutil.Amount(100000)
+				ctx.harness.txPool.cfg.Policy.IncrementalRelayFee =
+					&incrementalRelayFee
+
+				coinbase := ctx.addCoinbaseTx(1)
+
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				ctx.addSignedTx(outs, 1, defaultFee, true, false)
+
+				// The replacement pays enough extra fees for
+				// its size at the minimum relay fee but not at
+				// the incremental relay fee.
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee+1000, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, nil
+			},
+			err: "insufficient absolute fee",
+		},
+		{
+			// An incremental relay fee of zero is used as is rather
+			// than falling back to the minimum relay fee, so a
+			// replacement only has to pay more than the fees of the
+			// transactions it replaces.
+			name: "zero incremental relay fee",
+			setup: func(ctx *testContext) (*btcutil.Tx, []*btcutil.Tx) {
+				var incrementalRelayFee btcutil.Amount
+				ctx.harness.txPool.cfg.Policy.IncrementalRelayFee =
+					&incrementalRelayFee
+
+				coinbase := ctx.addCoinbaseTx(1)
+
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				parent := ctx.addSignedTx(outs, 2, defaultFee, true, false)
+
+				// The replacement has a higher fee rate as it
+				// has one output less but pays less extra fees
+				// than its size at the minimum relay fee.
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 1, defaultFee+1, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx, []*btcutil.Tx{parent}
+			},
+			err: "",
+		},
 		{
 			// A transaction cannot replace another if it introduces
 			// a new unconfirmed input that was not already in any
@@ -1852,3 +1918,600 @@ func TestRBF(t *testing.T) {
 		}
 	}
 }
+
+// leafDatasForTx returns the leaf datas for the inputs of the given tx from
+// the utxos of the test context's mock chain.
+func leafDatasForTx(ctx *testContext, tx *btcutil.Tx) []wire.LeafData {
+	ctx.t.Helper()
+
+	lds := make([]wire.LeafData, len(tx.MsgTx().TxIn))
+	for i, txIn := range tx.MsgTx().TxIn {
+		entry := ctx.harness.chain.utxos.LookupEntry(txIn.PreviousOutPoint)
+		if entry == nil {
+			ctx.t.Fatalf("missing utxo for %v", txIn.PreviousOutPoint)
+		}
+		lds[i] = wire.LeafData{
+			BlockHash:  chainhash.Hash{0x01},
+			OutPoint:   txIn.PreviousOutPoint,
+			Amount:     entry.Amount(),
+			PkScript:   entry.PkScript(),
+			Height:     entry.BlockHeight(),
+			IsCoinBase: entry.IsCoinBase(),
+		}
+	}
+
+	return lds
+}
+
+// TestAggregatedLeaves ensures that the leaves of the transactions in the pool
+// are added to and removed from the aggregated leaves as the transactions enter
+// and leave the pool, including when they're replaced.
+func TestAggregatedLeaves(t *testing.T) {
+	t.Parallel()
+
+	const defaultFee = btcutil.SatoshiPerBitcoin
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	mp := harness.txPool
+
+	coinbase := ctx.addCoinbaseTx(2)
+	out0 := txOutToSpendableOut(coinbase, 0)
+	out1 := txOutToSpendableOut(coinbase, 1)
+
+	tx, err := harness.CreateSignedTx([]spendableOutput{out0}, 1, defaultFee, true)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	replacement, err := harness.CreateSignedTx(
+		[]spendableOutput{out0, out1}, 1, defaultFee*3, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	replacementLds := leafDatasForTx(ctx, replacement)
+
+	// The accumulator holds both outputs of the coinbase in between other
+	// leaves.
+	acc := newTestAccumulator(t)
+	acc.useWith(mp)
+	adds := append(fillerLeaves(0, 3),
+		utreexo.Leaf{Hash: replacementLds[0].LeafHash()},
+		utreexo.Leaf{Hash: replacementLds[1].LeafHash()})
+	acc.connectBlock(append(adds, fillerLeaves(3, 3)...), nil)
+
+	accept := func(tx *btcutil.Tx, lds []wire.LeafData) {
+		t.Helper()
+		ud, err := wire.GenerateUData(confirmedLeaves(lds), &acc.bridge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ud.LeafDatas = lds
+		_, err = mp.ProcessTransaction(tx, ud, false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to process transaction: %v", err)
+		}
+	}
+
+	// checkLeaf looks up the leaf from the hash the accumulator holds at
+	// its position the same way the partial proofs of blocks are filled
+	// in.
+	checkLeaf := func(ld wire.LeafData, expected bool) {
+		t.Helper()
+		proof, err := acc.bridge.Prove([]utreexo.Hash{ld.LeafHash()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := acc.csn.GetHash(proof.Targets[0])
+		if hash != ld.LeafHash() {
+			t.Fatalf("expected the accumulator to cache leaf %v",
+				ld.OutPoint)
+		}
+		got, found := mp.FetchLeafDataByHash(hash)
+		if found != expected {
+			t.Fatalf("expected leaf %v to be found=%v", ld.OutPoint, expected)
+		}
+		if found && !reflect.DeepEqual(got, ld) {
+			t.Fatalf("expected leaf %v, got %v", ld, got)
+		}
+	}
+
+	// Spend the first output while signaling replacement.
+	lds := leafDatasForTx(ctx, tx)
+	accept(tx, lds)
+	checkLeaf(lds[0], true)
+
+	// Unconfirmed leaves aren't in the accumulator and must not be
+	// aggregated.
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(tx, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	childLd := wire.LeafData{OutPoint: child.MsgTx().TxIn[0].PreviousOutPoint}
+	childLd.SetUnconfirmed()
+	accept(child, []wire.LeafData{childLd})
+	if len(mp.aggregatedLeaves) != 1 {
+		t.Fatalf("expected 1 aggregated leaf, got %d", len(mp.aggregatedLeaves))
+	}
+
+	// Replace the transaction with one that spends both outputs.  The leaf
+	// of the first output is now spent by the replacement and must still be
+	// available while the replaced transaction and its child are gone.
+	accept(replacement, replacementLds)
+	testPoolMembership(ctx, tx, false, false)
+	testPoolMembership(ctx, child, false, false)
+	checkLeaf(replacementLds[0], true)
+	checkLeaf(replacementLds[1], true)
+	if _, err := mp.FetchLeafDatas(tx.Hash()); err == nil {
+		t.Fatalf("expected the leaves of the replaced tx to be removed")
+	}
+
+	// The aggregated leaves prove the inputs of the replacement against the
+	// roots.
+	aggregated := make([]wire.LeafData, 0, len(replacementLds))
+	for _, ld := range replacementLds {
+		got, _ := mp.FetchLeafDataByHash(ld.LeafHash())
+		aggregated = append(aggregated, got)
+	}
+	ud, err := wire.GenerateUData(aggregated, &acc.csn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = utreexo.Verify(acc.bridge.GetStump(),
+		confirmedLeafHashes(ud.LeafDatas), ud.AccProof)
+	if err != nil {
+		t.Fatalf("aggregated leaves don't verify against the roots: %v", err)
+	}
+
+	// Removing the replacement removes all of its leaves while the
+	// accumulator keeps them cached.
+	mp.RemoveTransaction(replacement, true)
+	checkLeaf(replacementLds[0], false)
+	checkLeaf(replacementLds[1], false)
+	if len(mp.aggregatedLeaves) != 0 {
+		t.Fatalf("expected no aggregated leaves, got %d", len(mp.aggregatedLeaves))
+	}
+	if len(mp.poolLeaves) != 0 {
+		t.Fatalf("expected no pool leaves, got %d", len(mp.poolLeaves))
+	}
+}
+
+// TestConfirmLeafDatas ensures that the unconfirmed leaf datas of the
+// transactions in the pool are swapped for confirmed ones once the outputs they
+// spend are mined.
+func TestConfirmLeafDatas(t *testing.T) {
+	t.Parallel()
+
+	const defaultFee = btcutil.SatoshiPerBitcoin
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	mp := harness.txPool
+
+	coinbase := ctx.addCoinbaseTx(1)
+	parent, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	parentLds := leafDatasForTx(ctx, parent)
+
+	// The accumulator holds the input of the parent in between other
+	// leaves.
+	acc := newTestAccumulator(t)
+	acc.useWith(mp)
+	adds := append(fillerLeaves(0, 3), utreexo.Leaf{Hash: parentLds[0].LeafHash()})
+	acc.connectBlock(append(adds, fillerLeaves(3, 4)...), nil)
+
+	ud, err := wire.GenerateUData(parentLds, &acc.bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = mp.ProcessTransaction(parent, ud, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(parent, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	childLd := wire.LeafData{OutPoint: child.MsgTx().TxIn[0].PreviousOutPoint}
+	childLd.SetUnconfirmed()
+	_, err = mp.ProcessTransaction(child,
+		&wire.UData{LeafDatas: []wire.LeafData{childLd}}, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+
+	parentOut := wire.OutPoint{Hash: *parent.Hash(), Index: 0}
+	if !mp.IsUnconfirmedSpend(parentOut) {
+		t.Fatalf("expected %v to be an unconfirmed spend", parentOut)
+	}
+
+	// Mine the parent.  The accumulator spends the input of the parent and
+	// adds the outputs of the block the way the chain does.
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase.MsgTx(), parent.MsgTx()},
+	})
+	block.SetHeight(harness.chain.BestHeight() + 1)
+	_, outCount, _, outskip := blockchain.DedupeBlock(block)
+	acc.connectBlock(blockchain.BlockToAddLeaves(block, outskip, nil, outCount),
+		[]utreexo.Hash{parentLds[0].LeafHash()})
+
+	leavesBefore, err := mp.FetchLeafDatas(child.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.ConfirmLeafDatas(block)
+	mp.RemoveTransaction(parent, false)
+
+	if mp.IsUnconfirmedSpend(parentOut) {
+		t.Fatalf("expected %v to no longer be an unconfirmed spend", parentOut)
+	}
+	if !leavesBefore[0].IsUnconfirmed() {
+		t.Fatalf("expected the fetched leaves to be left as they were")
+	}
+	leaves, err := mp.FetchLeafDatas(child.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaves[0].IsUnconfirmed() || leaves[0].OutPoint != parentOut {
+		t.Fatalf("expected a confirmed leaf for %v, got %v", parentOut,
+			leaves[0])
+	}
+	if _, found := mp.FetchLeafDataByHash(leaves[0].LeafHash()); !found {
+		t.Fatalf("expected the confirmed leaf to be aggregated")
+	}
+
+	// The confirmed leaf is the one the block added to the accumulator, so
+	// the bridge proves it and the proof verifies against the roots.
+	childUD, err := wire.GenerateUData(leaves, &acc.bridge)
+	if err != nil {
+		t.Fatalf("the bridge can't prove the confirmed leaf: %v", err)
+	}
+	err = mp.cfg.VerifyUData(childUD, child.MsgTx().TxIn, false)
+	if err != nil {
+		t.Fatalf("confirmed leaf doesn't verify against the roots: %v", err)
+	}
+
+	// The confirmed leaf goes away with the child.
+	mp.RemoveTransaction(child, false)
+	if _, found := mp.FetchLeafDataByHash(leaves[0].LeafHash()); found {
+		t.Fatalf("expected the confirmed leaf to be removed")
+	}
+}
+
+// testAccumulator is the accumulator of a node without the utxo set, which only
+// caches the leaves it's told to remember.  It's kept in sync with a full
+// accumulator that proves the leaves deleted by the blocks like a bridge node
+// does.
+type testAccumulator struct {
+	t      *testing.T
+	bridge utreexo.MapPollard
+	csn    utreexo.MapPollard
+}
+
+// newTestAccumulator returns an empty test accumulator.
+func newTestAccumulator(t *testing.T) *testAccumulator {
+	return &testAccumulator{
+		t:      t,
+		bridge: utreexo.NewMapPollard(true),
+		csn:    utreexo.NewMapPollard(false),
+	}
+}
+
+// confirmedLeafHashes returns the hashes of the leaves that are present in the
+// accumulator.
+func confirmedLeafHashes(lds []wire.LeafData) []utreexo.Hash {
+	hashes := make([]utreexo.Hash, 0, len(lds))
+	for _, ld := range confirmedLeaves(lds) {
+		hashes = append(hashes, ld.LeafHash())
+	}
+	return hashes
+}
+
+// useWith makes the pool prove the inputs of transactions against the
+// accumulator of the node the same way the chain does.
+func (acc *testAccumulator) useWith(mp *TxPool) {
+	mp.cfg.IsUtreexoViewActive = func() bool { return true }
+	mp.cfg.VerifyUData = func(ud *wire.UData, _ []*wire.TxIn, remember bool) error {
+		if ud == nil {
+			return fmt.Errorf("missing utreexo data")
+		}
+		return acc.csn.Verify(confirmedLeafHashes(ud.LeafDatas),
+			ud.AccProof, remember)
+	}
+	mp.cfg.GenerateUData = func(dels []wire.LeafData) (*wire.UData, error) {
+		return wire.GenerateUData(dels, &acc.csn)
+	}
+	mp.cfg.CacheAccProof = func(hashes []utreexo.Hash, proof *utreexo.Proof) error {
+		return acc.csn.Verify(hashes, *proof, true)
+	}
+	mp.cfg.PruneFromAccumulator = func(lds []wire.LeafData) error {
+		return acc.csn.Prune(confirmedLeafHashes(lds))
+	}
+}
+
+// connectBlock adds and deletes the leaves from the accumulators and returns a
+// block with the proof of the deleted leaves and the update data of the
+// modification like the chain sets on the blocks it connects.
+func (acc *testAccumulator) connectBlock(adds []utreexo.Leaf,
+	dels []utreexo.Hash) *btcutil.Block {
+
+	acc.t.Helper()
+
+	proof, err := acc.bridge.Prove(dels)
+	if err != nil {
+		acc.t.Fatal(err)
+	}
+	addHashes := make([]utreexo.Hash, 0, len(adds))
+	for _, add := range adds {
+		addHashes = append(addHashes, add.Hash)
+	}
+	stump := acc.csn.GetStump()
+	updateData, err := stump.Update(dels, addHashes, proof)
+	if err != nil {
+		acc.t.Fatal(err)
+	}
+	err = acc.csn.Ingest(dels, proof)
+	if err != nil {
+		acc.t.Fatal(err)
+	}
+	err = acc.csn.Modify(adds, dels, proof)
+	if err != nil {
+		acc.t.Fatal(err)
+	}
+	err = acc.bridge.Modify(adds, dels, proof)
+	if err != nil {
+		acc.t.Fatal(err)
+	}
+
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		UData: &wire.UData{AccProof: proof},
+	})
+	block.SetUtreexoUpdateData(&updateData)
+	block.SetUtreexoAdds(adds)
+	return block
+}
+
+// fillerLeaves returns n leaves that aren't spent by any transaction.
+func fillerLeaves(start, n int) []utreexo.Leaf {
+	leaves := make([]utreexo.Leaf, n)
+	for i := range leaves {
+		leaves[i] = utreexo.Leaf{Hash: utreexo.Hash{0xff, byte(start + i)}}
+	}
+	return leaves
+}
+
+// TestUtreexoAcceptance ensures that the inputs of transactions are only
+// accepted on utreexo nodes when they're proven by the attached utreexo data
+// and that transactions whose inputs can no longer be proven are removed.
+func TestUtreexoAcceptance(t *testing.T) {
+	t.Parallel()
+
+	const defaultFee = btcutil.SatoshiPerBitcoin
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	mp := harness.txPool
+
+	coinbase := ctx.addCoinbaseTx(2)
+	tx, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	lds := leafDatasForTx(ctx, tx)
+
+	// The accumulator holds the input of the transaction in between other
+	// leaves.
+	acc := newTestAccumulator(t)
+	acc.useWith(mp)
+	adds := append(fillerLeaves(0, 3), utreexo.Leaf{Hash: lds[0].LeafHash()})
+	acc.connectBlock(append(adds, fillerLeaves(3, 4)...), nil)
+
+	// The utreexo data is required.
+	_, err = mp.ProcessTransaction(tx, nil, false, false, 0)
+	if err == nil {
+		t.Fatalf("expected a transaction without utreexo data to be rejected")
+	}
+
+	// Every input must have a leaf data.
+	_, err = mp.ProcessTransaction(tx, &wire.UData{}, false, false, 0)
+	if err == nil {
+		t.Fatalf("expected a transaction missing leaf datas to be rejected")
+	}
+
+	// The leaf datas must be proven.
+	_, err = mp.ProcessTransaction(tx, &wire.UData{LeafDatas: lds}, false, false, 0)
+	if err == nil {
+		t.Fatalf("expected a transaction with unproven inputs to be rejected")
+	}
+
+	// The leaf datas must commit to the outpoints being spent.
+	other := leafDatasForTx(ctx, tx)
+	other[0].OutPoint = txOutToSpendableOut(coinbase, 1).outPoint
+	other[0].Amount = coinbase.MsgTx().TxOut[1].Value
+	acc.connectBlock([]utreexo.Leaf{{Hash: other[0].LeafHash()}}, nil)
+	otherUD, err := wire.GenerateUData(other, &acc.bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = mp.ProcessTransaction(tx, otherUD, false, false, 0)
+	if err == nil {
+		t.Fatalf("expected a transaction with leaf datas for other " +
+			"outpoints to be rejected")
+	}
+
+	ud, err := wire.GenerateUData(leafDatasForTx(ctx, tx), &acc.bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = mp.ProcessTransaction(tx, ud, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	testPoolMembership(ctx, tx, false, true)
+
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(tx, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	childLd := wire.LeafData{OutPoint: child.MsgTx().TxIn[0].PreviousOutPoint}
+	childLd.SetUnconfirmed()
+	_, err = mp.ProcessTransaction(child,
+		&wire.UData{LeafDatas: []wire.LeafData{childLd}}, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	testPoolMembership(ctx, child, false, true)
+
+	// Nothing is removed while the inputs are still provable.
+	block := acc.connectBlock(fillerLeaves(7, 2), []utreexo.Hash{adds[1].Hash})
+	if removed := mp.UpdateProofs(block); len(removed) != 0 {
+		t.Fatalf("expected no transactions to be removed, got %d",
+			len(removed))
+	}
+
+	// Once the input is spent by a block it can no longer be proven, so the
+	// transaction and its child are removed.
+	block = acc.connectBlock(nil, []utreexo.Hash{lds[0].LeafHash()})
+	removed := mp.UpdateProofs(block)
+	if len(removed) != 1 || *removed[0].Hash() != *tx.Hash() {
+		t.Fatalf("expected %v to be removed, got %v", tx.Hash(), removed)
+	}
+	testPoolMembership(ctx, tx, false, false)
+	testPoolMembership(ctx, child, false, false)
+}
+
+// TestUpdateProofs ensures that the proofs of the inputs of the transactions in
+// the pool are re-rooted with every connected block and cached again when the
+// accumulator no longer holds them.
+func TestUpdateProofs(t *testing.T) {
+	t.Parallel()
+
+	const defaultFee = btcutil.SatoshiPerBitcoin
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	mp := harness.txPool
+
+	coinbase := ctx.addCoinbaseTx(1)
+	tx, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(coinbase, 0)}, 1, defaultFee, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	lds := leafDatasForTx(ctx, tx)
+	leafHash := lds[0].LeafHash()
+
+	// The accumulator holds the input of the transaction in between other
+	// leaves.
+	acc := newTestAccumulator(t)
+	acc.useWith(mp)
+	adds := append(fillerLeaves(0, 3), utreexo.Leaf{Hash: leafHash})
+	adds = append(adds, fillerLeaves(3, 4)...)
+	acc.connectBlock(adds, nil)
+
+	ud, err := wire.GenerateUData(leafDatasForTx(ctx, tx), &acc.bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = mp.ProcessTransaction(tx, ud, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+
+	// isCached returns whether the accumulator is able to prove the input
+	// of the transaction.
+	isCached := func() bool {
+		_, err := wire.GenerateUData(leafDatasForTx(ctx, tx), &acc.csn)
+		return err == nil
+	}
+	if !isCached() {
+		t.Fatalf("expected the input to be cached on acceptance")
+	}
+
+	checkProof := func() {
+		t.Helper()
+
+		tp, found := mp.poolProofs[*tx.Hash()]
+		if !found {
+			t.Fatalf("expected the proof of %v to be kept", tx.Hash())
+		}
+		want := []utreexo.Hash{leafHash}
+		if !reflect.DeepEqual(tp.hashes, want) {
+			t.Fatalf("expected hashes %v, got %v", want, tp.hashes)
+		}
+		_, err := utreexo.Verify(acc.csn.GetStump(), tp.hashes, tp.proof)
+		if err != nil {
+			t.Fatalf("proof doesn't verify against the roots: %v", err)
+		}
+	}
+	checkProof()
+
+	// Connect blocks that spend and add leaves after the accumulator
+	// dropped the input.  The proof is re-rooted with each block and
+	// cached again.
+	for i := 0; i < 3; i++ {
+		err = acc.csn.Prune([]utreexo.Hash{leafHash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isCached() {
+			t.Fatalf("expected the input to be dropped")
+		}
+
+		block := acc.connectBlock(fillerLeaves(10+i*5, 5),
+			[]utreexo.Hash{adds[i].Hash})
+		if removed := mp.UpdateProofs(block); len(removed) != 0 {
+			t.Fatalf("expected no transactions to be removed, got %d",
+				len(removed))
+		}
+		checkProof()
+		if !isCached() {
+			t.Fatalf("expected the input to be cached again")
+		}
+	}
+
+	// A missed block leaves the proof unable to be re-rooted so it's
+	// proven from the accumulator, which still caches the input, instead.
+	acc.connectBlock(nil, []utreexo.Hash{adds[4].Hash})
+	block := acc.connectBlock(fillerLeaves(40, 2), nil)
+	if removed := mp.UpdateProofs(block); len(removed) != 0 {
+		t.Fatalf("expected no transactions to be removed, got %d",
+			len(removed))
+	}
+	checkProof()
+
+	// The transaction is removed when its input can't be proven either way.
+	acc.connectBlock(nil, []utreexo.Hash{adds[5].Hash})
+	block = acc.connectBlock(fillerLeaves(42, 2), nil)
+	err = acc.csn.Prune([]utreexo.Hash{leafHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed := mp.UpdateProofs(block)
+	if len(removed) != 1 || *removed[0].Hash() != *tx.Hash() {
+		t.Fatalf("expected %v to be removed, got %v", tx.Hash(), removed)
+	}
+	testPoolMembership(ctx, tx, false, false)
+	if _, found := mp.poolProofs[*tx.Hash()]; found {
+		t.Fatalf("expected the proof of %v to be removed", tx.Hash())
+	}
+}
@@ -85,6 +85,20 @@ func (m *MockTxMempool) ProcessTransaction(tx *btcutil.Tx, utreexoData *wire.UDa
 	return args.Get(0).([]*TxDesc), args.Error(1)
 }
 
+// ProcessPackage accepts a package made of a child transaction and its
+// unconfirmed parents into the memory pool atomically.
+func (m *MockTxMempool) ProcessPackage(txs []*btcutil.Tx, udatas []*wire.UData,
+	rateLimit bool) (*PackageAcceptResult, error) {
+
+	args := m.Called(txs, udatas, rateLimit)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*PackageAcceptResult), args.Error(1)
+}
+
 // RemoveTransaction removes the passed transaction from the mempool.  When the
 // removeRedeemers flag is set, any transactions that redeem outputs from the
 // removed transaction will also be removed recursively from the mempool, as
@@ -99,10 +113,10 @@ func (m *MockTxMempool) RemoveTransaction(tx *btcutil.Tx,
 // RPC method. It will perform a series of checks to decide whether this
 // transaction can be accepted to the mempool. If not, the specific error is
 // returned and the caller needs to take actions based on it.
-func (m *MockTxMempool) CheckMempoolAcceptance(
-	tx *btcutil.Tx) (*MempoolAcceptResult, error) {
+func (m *MockTxMempool) CheckMempoolAcceptance(tx *btcutil.Tx,
+	utreexoData *wire.UData) (*MempoolAcceptResult, error) {
 
-	args := m.Called(tx)
+	args := m.Called(tx, utreexoData)
 
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
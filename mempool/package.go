@@ -0,0 +1,280 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions allowed in a
+	// package.
+	MaxPackageCount = 25
+
+	// MaxPackageWeight is the maximum total weight of the transactions in
+	// a package.  It allows a package to hold a transaction of the max
+	// standard weight along with a few small ones.
+	MaxPackageWeight = 404000
+)
+
+// PackageAcceptResult holds the result of accepting a package into the memory
+// pool.
+type PackageAcceptResult struct {
+	// TxDescs are the descriptors of the transactions of the package in
+	// the same order as the package.  They include the transactions that
+	// were already in the pool.
+	TxDescs []*TxDesc
+
+	// Accepted are the transactions that were added to the pool, parents
+	// first.  They include the orphans that were accepted as a result of
+	// the package being accepted.
+	Accepted []*TxDesc
+
+	// FeePerKB is the fee rate of the transactions of the package that
+	// were added to the pool, in satoshi per 1000 virtual bytes.
+	FeePerKB int64
+}
+
+// checkPackage checks that the passed transactions form a child with its
+// unconfirmed parents: the parents come first, the last transaction spends an
+// output of each of them and none of the parents spends an output of another.
+// The transactions must not spend the same outputs and must be within the
+// count and weight limits of a package.
+func checkPackage(txs []*btcutil.Tx) error {
+	if len(txs) < 2 || len(txs) > MaxPackageCount {
+		str := fmt.Sprintf("package has %d transactions but must have "+
+			"between 2 and %d", len(txs), MaxPackageCount)
+		return txRuleError(wire.RejectInvalid, str)
+	}
+
+	var weight int64
+	indexes := make(map[chainhash.Hash]int, len(txs))
+	for i, tx := range txs {
+		if _, exists := indexes[*tx.Hash()]; exists {
+			str := fmt.Sprintf("package contains transaction %v "+
+				"more than once", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		indexes[*tx.Hash()] = i
+		weight += blockchain.GetTransactionWeight(tx)
+	}
+	if weight > MaxPackageWeight {
+		str := fmt.Sprintf("package weight of %d is larger than max "+
+			"allowed weight of %d", weight, MaxPackageWeight)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	childIdx := len(txs) - 1
+	spent := make(map[wire.OutPoint]struct{})
+	parents := make(map[chainhash.Hash]struct{}, childIdx)
+	for i, tx := range txs {
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if _, exists := spent[prevOut]; exists {
+				str := fmt.Sprintf("package transaction %v "+
+					"spends %v which is spent by another "+
+					"transaction of the package", tx.Hash(),
+					prevOut)
+				return txRuleError(wire.RejectDuplicate, str)
+			}
+			spent[prevOut] = struct{}{}
+
+			parentIdx, exists := indexes[prevOut.Hash]
+			if !exists {
+				continue
+			}
+			if i != childIdx {
+				str := fmt.Sprintf("package parent %v spends "+
+					"an output of package transaction %v",
+					tx.Hash(), txs[parentIdx].Hash())
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			parents[prevOut.Hash] = struct{}{}
+		}
+	}
+	for _, tx := range txs[:childIdx] {
+		if _, exists := parents[*tx.Hash()]; !exists {
+			str := fmt.Sprintf("package transaction %v isn't a "+
+				"parent of the child %v", tx.Hash(),
+				txs[childIdx].Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	return nil
+}
+
+// processPackage is the internal function which implements the public
+// ProcessPackage.  See the comment for ProcessPackage for more details.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) processPackage(txs []*btcutil.Tx, udatas []*wire.UData,
+	rateLimit bool) (*PackageAcceptResult, error) {
+
+	if err := checkPackage(txs); err != nil {
+		return nil, err
+	}
+	if udatas != nil && len(udatas) != len(txs) {
+		str := fmt.Sprintf("package has %d transactions but %d "+
+			"utreexo datas", len(txs), len(udatas))
+		return nil, txRuleError(wire.RejectInvalid, str)
+	}
+
+	// The package is accepted atomically so the transactions added so far
+	// are removed again if any of them fails and the ones that were
+	// orphans are put back in the orphan pool.
+	type removedOrphan struct {
+		otx *orphanTx
+		ud  *wire.UData
+	}
+	var added []*TxDesc
+	var removedOrphans []removedOrphan
+	rollback := func() {
+		for i := len(added) - 1; i >= 0; i-- {
+			mp.removeTransaction(added[i].Tx, true)
+		}
+		for _, orphan := range removedOrphans {
+			tx := orphan.otx.tx
+			mp.addOrphan(tx, orphan.ud, orphan.otx.tag)
+			if otx, exists := mp.orphans[*tx.Hash()]; exists {
+				otx.expiration = orphan.otx.expiration
+			}
+		}
+	}
+
+	result := &PackageAcceptResult{
+		TxDescs: make([]*TxDesc, len(txs)),
+	}
+	var fees, size int64
+	for i, tx := range txs {
+		// Parents that are already in the pool don't need to be paid
+		// for by the child.
+		if txD, exists := mp.pool[*tx.Hash()]; exists {
+			result.TxDescs[i] = txD
+			continue
+		}
+
+		// The inputs spending outputs of the parents are marked as
+		// unconfirmed in the utreexo data of the child as the parents
+		// aren't in the accumulator yet.  They're fetched from the pool
+		// once the parents are added to it.
+		var ud *wire.UData
+		if udatas != nil {
+			ud = udatas[i]
+		}
+
+		// The fees of the parents are only checked for the package as
+		// a whole so that the child can pay for them.  The package may
+		// contain transactions that are already orphans.
+		isChild := i == len(txs)-1
+		r, err := mp.checkMempoolAcceptance(
+			tx, ud, isChild, isChild && rateLimit, false,
+		)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if len(r.MissingParents) > 0 {
+			rollback()
+			str := fmt.Sprintf("package transaction %v references "+
+				"outputs of unknown or fully-spent transaction %v",
+				tx.Hash(), r.MissingParents[0])
+			return nil, txRuleError(wire.RejectDuplicate, str)
+		}
+		if len(r.Conflicts) > 0 {
+			rollback()
+			str := fmt.Sprintf("package transaction %v conflicts "+
+				"with transactions in the pool which can't be "+
+				"replaced by a package", tx.Hash())
+			return nil, txRuleError(wire.RejectDuplicate, str)
+		}
+
+		// Remove the transaction from the orphan pool before its
+		// utreexo data is ingested as the leaves of an orphan are
+		// pruned from the accumulator when it's removed.
+		if otx, exists := mp.orphans[*tx.Hash()]; exists {
+			removedOrphans = append(removedOrphans, removedOrphan{
+				otx: otx,
+				ud:  mp.orphanUData[*tx.Hash()],
+			})
+			mp.removeOrphan(tx, false)
+		}
+		if ud != nil {
+			err = mp.addUtreexoData(tx, ud)
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+		txD := mp.addTransaction(r.utxoView, tx, r.bestHeight, int64(r.TxFee))
+
+		// The fee rate of a package transaction doesn't reflect how
+		// fast it confirms on its own so it's not used for estimates.
+		if mp.cfg.SmartFeeEstimator != nil {
+			mp.cfg.SmartFeeEstimator.RemoveTransaction(tx.Hash())
+		}
+
+		added = append(added, txD)
+		result.TxDescs[i] = txD
+		fees += txD.Fee
+		size += GetTxVirtualSize(tx)
+	}
+	if len(added) == 0 {
+		return result, nil
+	}
+
+	minFee := calcMinRequiredTxRelayFee(size, mp.cfg.Policy.MinRelayTxFee)
+	if fees < minFee {
+		rollback()
+		str := fmt.Sprintf("package has %d fees which is under the "+
+			"required amount of %d", fees, minFee)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+	result.FeePerKB = fees * 1000 / size
+
+	// Accept any orphans that depend on the package now that it's in the
+	// pool.
+	result.Accepted = added
+	for _, txD := range added {
+		newTxs := mp.processOrphans(txD.Tx)
+		result.Accepted = append(result.Accepted, newTxs...)
+	}
+
+	log.Debugf("Accepted package of %d transactions with child %v "+
+		"(pool size: %v)", len(added), txs[len(txs)-1].Hash(),
+		len(mp.pool))
+
+	return result, nil
+}
+
+// ProcessPackage accepts a package made of a child transaction and its
+// unconfirmed parents into the memory pool.  The parents must come first and
+// may already be in the pool.  Unlike transactions processed individually,
+// the parents don't need to pay the minimum relay fee on their own as long as
+// the package as a whole does, which lets the child pay for its parents.
+//
+// The package is accepted atomically: either all of its transactions are added
+// to the pool or none are.  Transactions in the package can't replace
+// transactions already in the pool.
+//
+// On nodes without the utxo set, the utreexo data of each transaction must be
+// passed in the same order as the transactions with the inputs spending outputs
+// of the parents marked as unconfirmed.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessPackage(txs []*btcutil.Tx, udatas []*wire.UData,
+	rateLimit bool) (*PackageAcceptResult, error) {
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	return mp.processPackage(txs, udatas, rateLimit)
+}
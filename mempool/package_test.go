@@ -0,0 +1,246 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+)
+
+// createPackage returns two zero fee parents spending the outputs of a new
+// coinbase and a child spending both of them with the given fee.
+func createPackage(ctx *testContext, childFee btcutil.Amount) []*btcutil.Tx {
+	ctx.t.Helper()
+
+	coinbase := ctx.addCoinbaseTx(2)
+	txs := make([]*btcutil.Tx, 0, 3)
+	var childIns []spendableOutput
+	for i := uint32(0); i < 2; i++ {
+		outs := []spendableOutput{txOutToSpendableOut(coinbase, i)}
+		parent, err := ctx.harness.CreateSignedTx(outs, 1, 0, false)
+		if err != nil {
+			ctx.t.Fatalf("unable to create transaction: %v", err)
+		}
+		txs = append(txs, parent)
+		childIns = append(childIns, txOutToSpendableOut(parent, 0))
+	}
+	child, err := ctx.harness.CreateSignedTx(childIns, 1, childFee, false)
+	if err != nil {
+		ctx.t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	return append(txs, child)
+}
+
+// TestCheckPackage ensures that only packages made of a child and its parents
+// are accepted.
+func TestCheckPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txs := createPackage(ctx, 10000)
+	parent1, parent2, child := txs[0], txs[1], txs[2]
+
+	// A transaction spending the same output as the first parent.
+	coinbase := ctx.addCoinbaseTx(1)
+	outs := []spendableOutput{
+		txOutToSpendableOut(coinbase, 0),
+		{outPoint: parent1.MsgTx().TxIn[0].PreviousOutPoint},
+	}
+	doubleSpend, err := harness.CreateSignedTx(outs, 1, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	// A parent spending an output of the other parent.
+	outs = []spendableOutput{txOutToSpendableOut(parent1, 0)}
+	parentChild, err := harness.CreateSignedTx(outs, 1, 0, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		txs  []*btcutil.Tx
+		err  string
+	}{
+		{
+			name: "valid",
+			txs:  txs,
+		},
+		{
+			name: "single transaction",
+			txs:  []*btcutil.Tx{child},
+			err:  "package has 1 transactions",
+		},
+		{
+			name: "duplicate transaction",
+			txs:  []*btcutil.Tx{parent1, parent1, child},
+			err:  "more than once",
+		},
+		{
+			name: "child first",
+			txs:  []*btcutil.Tx{child, parent1, parent2},
+			err:  "spends an output of package transaction",
+		},
+		{
+			name: "not a parent",
+			txs:  []*btcutil.Tx{parent1, coinbase, child},
+			err:  "isn't a parent of the child",
+		},
+		{
+			name: "conflicting transactions",
+			txs:  []*btcutil.Tx{parent1, doubleSpend},
+			err:  "which is spent by another transaction",
+		},
+		{
+			name: "dependent parents",
+			txs:  []*btcutil.Tx{parent1, parentChild, child},
+			err:  "spends an output of package transaction",
+		},
+	}
+	for _, test := range tests {
+		err := checkPackage(test.txs)
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name,
+					err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: expected error containing %q, got %v",
+				test.name, test.err, err)
+		}
+	}
+}
+
+// TestProcessPackage ensures that a child can pay for its parents and that
+// packages are accepted atomically.
+func TestProcessPackage(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// A package that doesn't pay the minimum relay fee as a whole is
+	// rejected without any of its transactions being added.
+	txs := createPackage(ctx, 0)
+	_, err = harness.txPool.ProcessPackage(txs, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "package has 0 fees") {
+		t.Fatalf("expected the package fee to be too low, got %v", err)
+	}
+	for _, tx := range txs {
+		testPoolMembership(ctx, tx, false, false)
+	}
+
+	// A child that was an orphan is put back in the orphan pool when the
+	// package fails after the child was moved to the pool.
+	txs = createPackage(ctx, 0)
+	_, err = harness.txPool.ProcessTransaction(txs[2], nil, true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	testPoolMembership(ctx, txs[2], true, false)
+	_, err = harness.txPool.ProcessPackage(txs, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "package has 0 fees") {
+		t.Fatalf("expected the package fee to be too low, got %v", err)
+	}
+	testPoolMembership(ctx, txs[0], false, false)
+	testPoolMembership(ctx, txs[1], false, false)
+	testPoolMembership(ctx, txs[2], true, false)
+	harness.txPool.RemoveOrphan(txs[2])
+
+	// A package is rejected as a whole when one of its transactions
+	// conflicts with a transaction in the pool.
+	txs = createPackage(ctx, 10000)
+	outs := []spendableOutput{{
+		outPoint: txs[1].MsgTx().TxIn[0].PreviousOutPoint,
+		amount:   btcutil.Amount(txs[1].MsgTx().TxOut[0].Value),
+	}}
+	conflict := ctx.addSignedTx(outs, 1, 1000, false, false)
+	_, err = harness.txPool.ProcessPackage(txs, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "already spent") {
+		t.Fatalf("expected the package to conflict, got %v", err)
+	}
+	for _, tx := range txs {
+		testPoolMembership(ctx, tx, false, false)
+	}
+	harness.txPool.RemoveTransaction(conflict, true)
+
+	// The child pays for its parents when the package is accepted.  The
+	// child was already an orphan.
+	_, err = harness.txPool.ProcessTransaction(txs[2], nil, true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	testPoolMembership(ctx, txs[2], true, false)
+
+	// An orphan spending the child is accepted along with the package.
+	outs = []spendableOutput{txOutToSpendableOut(txs[2], 0)}
+	grandChild, err := harness.CreateSignedTx(outs, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(grandChild, nil, true, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+
+	result, err := harness.txPool.ProcessPackage(txs, nil, false)
+	if err != nil {
+		t.Fatalf("unable to process package: %v", err)
+	}
+	for i, tx := range txs {
+		testPoolMembership(ctx, tx, false, true)
+		if !result.TxDescs[i].Tx.Hash().IsEqual(tx.Hash()) {
+			t.Fatalf("expected descriptor %d to be for %v, got %v",
+				i, tx.Hash(), result.TxDescs[i].Tx.Hash())
+		}
+	}
+	testPoolMembership(ctx, grandChild, false, true)
+	if len(result.Accepted) != 4 {
+		t.Fatalf("expected 4 accepted transactions, got %d",
+			len(result.Accepted))
+	}
+	var size int64
+	for _, tx := range txs {
+		size += GetTxVirtualSize(tx)
+	}
+	if want := int64(10000 * 1000 / size); result.FeePerKB != want {
+		t.Fatalf("expected a package fee rate of %d, got %d", want,
+			result.FeePerKB)
+	}
+
+	// Parents already in the pool are left out of the package fee rate.
+	txs = createPackage(ctx, 10000)
+	_, err = harness.txPool.ProcessTransaction(txs[0], nil, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	result, err = harness.txPool.ProcessPackage(txs, nil, false)
+	if err != nil {
+		t.Fatalf("unable to process package: %v", err)
+	}
+	if len(result.Accepted) != 2 {
+		t.Fatalf("expected 2 accepted transactions, got %d",
+			len(result.Accepted))
+	}
+	size = GetTxVirtualSize(txs[1]) + GetTxVirtualSize(txs[2])
+	if want := int64(10000 * 1000 / size); result.FeePerKB != want {
+		t.Fatalf("expected a package fee rate of %d, got %d", want,
+			result.FeePerKB)
+	}
+}
@@ -49,6 +49,11 @@ const (
 	// for larger transactions.  This value is in Satoshi/1000 bytes.
 	DefaultMinRelayTxFee = btcutil.Amount(1000)
 
+	// DefaultIncrementalRelayFee is the fee rate in Satoshi/1000 bytes a
+	// replacement transaction must pay for its own size on top of the fees
+	// of the transactions it replaces.
+	DefaultIncrementalRelayFee = btcutil.Amount(1000)
+
 	// maxStandardMultiSigKeys is the maximum number of public keys allowed
 	// in a multi-signature transaction output script for it to be
 	// considered standard.
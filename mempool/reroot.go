@@ -0,0 +1,208 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"slices"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// txProof is the accumulator proof of the confirmed inputs of a transaction in
+// the pool.  It's re-rooted with every connected block so that it keeps proving
+// the inputs against the current roots of the accumulator.
+type txProof struct {
+	// hashes are the leaf hashes of the confirmed inputs in the same order
+	// as the targets of the proof.
+	hashes []utreexo.Hash
+
+	// proof is the proof of the hashes.
+	proof utreexo.Proof
+}
+
+// confirmedLeaves returns the leaf datas of the passed in leaves that are
+// present in the accumulator.
+func confirmedLeaves(leaves []wire.LeafData) []wire.LeafData {
+	dels := make([]wire.LeafData, 0, len(leaves))
+	for _, ld := range leaves {
+		// Unconfirmed leaves aren't present in the accumulator and the
+		// hash of compact ones can't be calculated.
+		if ld.IsUnconfirmed() || ld.IsCompact() {
+			continue
+		}
+		dels = append(dels, ld)
+	}
+
+	return dels
+}
+
+// proveLeaves generates the proof of the passed in leaves from the proofs
+// cached in the accumulator.
+func (mp *TxPool) proveLeaves(dels []wire.LeafData) (*txProof, error) {
+	ud, err := mp.cfg.GenerateUData(dels)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]utreexo.Hash, 0, len(dels))
+	for _, ld := range dels {
+		hashes = append(hashes, ld.LeafHash())
+	}
+
+	return &txProof{hashes: hashes, proof: ud.AccProof}, nil
+}
+
+// addTxProof keeps the proof of the confirmed inputs of the given transaction
+// so that it can be re-rooted as blocks are connected.  Nothing is kept if the
+// transaction doesn't spend any confirmed inputs.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addTxProof(txHash *chainhash.Hash, leaves []wire.LeafData) {
+	dels := confirmedLeaves(leaves)
+	if len(dels) == 0 {
+		return
+	}
+
+	tp, err := mp.proveLeaves(dels)
+	if err != nil {
+		// The proof is generated from the accumulator again when the
+		// next block is connected.
+		log.Debugf("Unable to prove the inputs of tx %v: %v", txHash, err)
+		return
+	}
+	mp.poolProofs[*txHash] = tp
+}
+
+// rerootProof updates the given proof, which proves the passed in leaves
+// against the roots before the block was connected, with the update data of
+// the block and caches it in the accumulator again.  The proof is generated
+// from the accumulator instead when there's no proof to update or when the
+// updated one doesn't prove all of the leaves against the current roots.
+//
+// The pool isn't accessed so this function is called without the mempool lock
+// held.
+func (mp *TxPool) rerootProof(tp *txProof, dels []wire.LeafData, adds []utreexo.Hash,
+	blockTargets []uint64, updateData *utreexo.UpdateData) (*txProof, error) {
+
+	if tp != nil && len(tp.hashes) == len(dels) {
+		// Update copies as the proof is modified in place and the
+		// original is still needed if the update fails.
+		proof := utreexo.Proof{
+			Targets: slices.Clone(tp.proof.Targets),
+			Proof:   slices.Clone(tp.proof.Proof),
+		}
+		hashes, err := proof.Update(slices.Clone(tp.hashes), adds,
+			blockTargets, nil, *updateData)
+		if err == nil && len(hashes) == len(dels) {
+			err = mp.cfg.CacheAccProof(hashes, &proof)
+			if err == nil {
+				return &txProof{hashes: hashes, proof: proof}, nil
+			}
+		}
+		log.Debugf("Unable to re-root the proof of %d leaves, "+
+			"proving them from the accumulator: %v", len(dels), err)
+	}
+
+	return mp.proveLeaves(dels)
+}
+
+// UpdateProofs re-roots the proofs of the confirmed inputs of the transactions
+// in the pool with the passed block so that they prove the inputs against the
+// roots the block committed to.  The re-rooted proofs are cached in the
+// accumulator again so that the transactions keep being relayed with the proofs
+// of their inputs even if the accumulator dropped them.  Transactions whose
+// inputs can't be proven either way are removed, along with their redeemers,
+// and are returned.
+//
+// The proofs are re-rooted without holding the mempool lock so that
+// transactions can be processed in the meantime.  The ones added in the meantime
+// are proven against the roots the block committed to already and the ones
+// removed in the meantime are left alone.
+//
+// It should be called after the block is connected and after the transactions
+// of the block and their double spends are removed from the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) UpdateProofs(block *btcutil.Block) []*btcutil.Tx {
+	// The update data is only set for blocks connected to the accumulator.
+	updateData := block.UtreexoUpdateData()
+	if updateData == nil {
+		return nil
+	}
+	adds := block.UtreexoAdds()
+	var blockTargets []uint64
+	if ud := block.MsgBlock().UData; ud != nil {
+		blockTargets = ud.AccProof.Targets
+	}
+
+	// Collect the proofs to re-root.  The leaves of a transaction don't
+	// change while it's in the pool so they can be used without the lock.
+	type poolProof struct {
+		tx   *btcutil.Tx
+		dels []wire.LeafData
+		tp   *txProof
+	}
+	mp.mtx.Lock()
+	proofs := make([]poolProof, 0, len(mp.poolLeaves))
+	for txHash, leaves := range mp.poolLeaves {
+		txDesc, exists := mp.pool[txHash]
+		if !exists {
+			continue
+		}
+
+		dels := confirmedLeaves(leaves)
+		if len(dels) == 0 {
+			delete(mp.poolProofs, txHash)
+			continue
+		}
+		proofs = append(proofs, poolProof{txDesc.Tx, dels,
+			mp.poolProofs[txHash]})
+	}
+	mp.mtx.Unlock()
+
+	var unprovable []*btcutil.Tx
+	rerooted := make([]*txProof, len(proofs))
+	for i, p := range proofs {
+		tp, err := mp.rerootProof(p.tp, p.dels, adds, blockTargets,
+			updateData)
+		if err != nil {
+			log.Debugf("Removing transaction %v as its inputs can't "+
+				"be proven against the current roots: %v",
+				p.tx.Hash(), err)
+			unprovable = append(unprovable, p.tx)
+			continue
+		}
+		rerooted[i] = tp
+	}
+
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	for i, p := range proofs {
+		// Only keep the proofs of the transactions that are still in
+		// the pool.
+		if rerooted[i] == nil {
+			continue
+		}
+		if _, exists := mp.pool[*p.tx.Hash()]; exists {
+			mp.poolProofs[*p.tx.Hash()] = rerooted[i]
+		}
+	}
+	for _, tx := range unprovable {
+		// The transaction may have already been removed as the redeemer
+		// of another unprovable transaction or while the proofs were
+		// being re-rooted.
+		if _, exists := mp.pool[*tx.Hash()]; !exists {
+			continue
+		}
+		mp.removeTransaction(tx, true)
+	}
+
+	return unprovable
+}
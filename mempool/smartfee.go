@@ -0,0 +1,812 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// The smart fee estimator follows the model of the block policy estimator of
+// Bitcoin Core.  Transactions entering the mempool are put in exponentially
+// spaced fee rate buckets and the number of blocks it takes for them to
+// confirm, or for them to leave the mempool without confirming, is tracked
+// over three horizons with their own decays.  An estimate for a target is the
+// lowest range of buckets whose transactions confirmed within the target at a
+// high enough rate.
+const (
+	// shortBlockPeriods, shortScale and shortDecay define the horizon
+	// tracking the confirmations of transactions over the last 12 blocks.
+	shortBlockPeriods = 12
+	shortScale        = 1
+	shortDecay        = .962
+
+	// medBlockPeriods, medScale and medDecay define the horizon tracking
+	// the confirmations of transactions over the last 48 blocks in periods
+	// of 2 blocks.
+	medBlockPeriods = 24
+	medScale        = 2
+	medDecay        = .9952
+
+	// longBlockPeriods, longScale and longDecay define the horizon tracking
+	// the confirmations of transactions over the last 1008 blocks in
+	// periods of 24 blocks.
+	longBlockPeriods = 42
+	longScale        = 24
+	longDecay        = .99931
+
+	// halfSuccessPct, successPct and doubleSuccessPct are the rates at
+	// which the transactions of a bucket range must confirm within half,
+	// exactly and double the target for the range to be a valid estimate.
+	halfSuccessPct   = .6
+	successPct       = .85
+	doubleSuccessPct = .95
+
+	// sufficientFeeTxs and sufficientTxsShort are the minimum number of
+	// transactions per block that a bucket range must have seen to be
+	// considered for an estimate in the medium and long horizons and in
+	// the short horizon respectively.
+	sufficientFeeTxs   = 0.1
+	sufficientTxsShort = 0.5
+
+	// minBucketFeeRate and maxBucketFeeRate are the lowest and highest
+	// bucket boundaries in satoshis per kilo virtual byte.  The buckets in
+	// between are feeSpacing apart.
+	minBucketFeeRate = 1000
+	maxBucketFeeRate = 1e7
+	feeSpacing       = 1.05
+
+	// infFeeRate is the boundary of the last bucket which catches all the
+	// fee rates above maxBucketFeeRate.
+	infFeeRate = 1e99
+
+	// oldestEstimateHistory is the number of blocks after which the data
+	// restored from a previous run is no longer used to decide the highest
+	// target that can be estimated.
+	oldestEstimateHistory = 6 * 1008
+
+	// smartFeeSaveVersion is the version of the serialized smart fee
+	// estimator.
+	smartFeeSaveVersion = 1
+)
+
+const (
+	// MaxSmartFeeTarget is the highest confirmation target in blocks that
+	// the smart fee estimator can estimate fees for.
+	MaxSmartFeeTarget = longBlockPeriods * longScale
+
+	// SmartFeeEstimatorFile is the name of the file in the data directory
+	// the smart fee estimator is saved to.
+	SmartFeeEstimatorFile = "fee_estimates.dat"
+)
+
+// ErrNoSmartFeeEstimate is returned by EstimateSmartFee when there's not enough
+// data to estimate a fee rate for the requested target.
+var ErrNoSmartFeeEstimate = errors.New("Insufficient data or no feerate found")
+
+// txConfirmStats tracks the confirmations of the transactions in each fee rate
+// bucket over a horizon of periods of scale blocks.  All the averages are
+// decayed every block so that older data points weigh less.
+type txConfirmStats struct {
+	// buckets are the upper boundaries of the fee rate buckets.  They're
+	// shared by all the stats of an estimator.
+	buckets []float64
+
+	// confAvg is the moving average of the transactions of each bucket
+	// that confirmed within the given number of periods.
+	confAvg [][]float64
+
+	// failAvg is the moving average of the transactions of each bucket
+	// that left the mempool unconfirmed after the given number of periods.
+	failAvg [][]float64
+
+	// txCtAvg is the moving average of the confirmed transactions of each
+	// bucket.
+	txCtAvg []float64
+
+	// feeRateAvg is the moving average of the sum of the fee rates of the
+	// confirmed transactions of each bucket.
+	feeRateAvg []float64
+
+	// unconfTxs are the transactions of each bucket still in the mempool
+	// keyed by the height they entered it at modulo the number of tracked
+	// blocks.  oldUnconfTxs are the ones that have been in the mempool
+	// for longer than that.
+	unconfTxs    [][]int
+	oldUnconfTxs []int
+
+	decay float64
+	scale uint32
+}
+
+// newTxConfirmStats returns the confirmation stats of a horizon with the given
+// number of periods, scale and decay.
+func newTxConfirmStats(buckets []float64, periods, scale uint32,
+	decay float64) *txConfirmStats {
+
+	stats := &txConfirmStats{
+		buckets:      buckets,
+		confAvg:      make([][]float64, periods),
+		failAvg:      make([][]float64, periods),
+		txCtAvg:      make([]float64, len(buckets)),
+		feeRateAvg:   make([]float64, len(buckets)),
+		unconfTxs:    make([][]int, periods*scale),
+		oldUnconfTxs: make([]int, len(buckets)),
+		decay:        decay,
+		scale:        scale,
+	}
+	for i := range stats.confAvg {
+		stats.confAvg[i] = make([]float64, len(buckets))
+		stats.failAvg[i] = make([]float64, len(buckets))
+	}
+	for i := range stats.unconfTxs {
+		stats.unconfTxs[i] = make([]int, len(buckets))
+	}
+
+	return stats
+}
+
+// maxConfirms returns the highest number of blocks the stats track.
+func (s *txConfirmStats) maxConfirms() int {
+	return int(s.scale) * len(s.confAvg)
+}
+
+// bucketIndex returns the index of the bucket the given fee rate falls in.
+func (s *txConfirmStats) bucketIndex(feeRate float64) int {
+	return sort.SearchFloat64s(s.buckets, feeRate)
+}
+
+// clearCurrent moves the transactions that entered the mempool a full window
+// of tracked blocks ago to the old unconfirmed transactions so that the slot
+// can be reused for the transactions entering at the given height.
+func (s *txConfirmStats) clearCurrent(height int32) {
+	idx := int(height) % len(s.unconfTxs)
+	for j := range s.buckets {
+		s.oldUnconfTxs[j] += s.unconfTxs[idx][j]
+		s.unconfTxs[idx][j] = 0
+	}
+}
+
+// updateMovingAverages decays all the moving averages by one block.
+func (s *txConfirmStats) updateMovingAverages() {
+	for j := range s.buckets {
+		for i := range s.confAvg {
+			s.confAvg[i][j] *= s.decay
+			s.failAvg[i][j] *= s.decay
+		}
+		s.feeRateAvg[j] *= s.decay
+		s.txCtAvg[j] *= s.decay
+	}
+}
+
+// record records a transaction with the given fee rate that confirmed after
+// the given number of blocks.
+func (s *txConfirmStats) record(blocksToConfirm int, feeRate float64) {
+	if blocksToConfirm < 1 {
+		return
+	}
+
+	periodsToConfirm := (blocksToConfirm + int(s.scale) - 1) / int(s.scale)
+	bucket := s.bucketIndex(feeRate)
+	for i := periodsToConfirm; i <= len(s.confAvg); i++ {
+		s.confAvg[i-1][bucket]++
+	}
+	s.txCtAvg[bucket]++
+	s.feeRateAvg[bucket] += feeRate
+}
+
+// newTx tracks a transaction that entered the mempool at the given height in
+// the given bucket.
+func (s *txConfirmStats) newTx(height int32, bucket int) {
+	idx := int(height) % len(s.unconfTxs)
+	s.unconfTxs[idx][bucket]++
+}
+
+// removeTx stops tracking a transaction that entered the mempool at the given
+// height.  A transaction that left the mempool without being included in a
+// block is recorded as having failed to confirm in every period it spent in
+// the mempool.
+func (s *txConfirmStats) removeTx(entryHeight, bestSeenHeight int32,
+	bucket int, inBlock bool) {
+
+	blocksAgo := int(bestSeenHeight - entryHeight)
+	if bestSeenHeight == 0 {
+		blocksAgo = 0
+	}
+	if blocksAgo < 0 {
+		// Shouldn't happen as the transactions are only tracked when
+		// they enter at the best seen height.
+		return
+	}
+
+	if blocksAgo >= len(s.unconfTxs) {
+		if s.oldUnconfTxs[bucket] > 0 {
+			s.oldUnconfTxs[bucket]--
+		}
+	} else {
+		idx := int(entryHeight) % len(s.unconfTxs)
+		if s.unconfTxs[idx][bucket] > 0 {
+			s.unconfTxs[idx][bucket]--
+		}
+	}
+
+	if !inBlock && blocksAgo >= int(s.scale) {
+		periodsAgo := blocksAgo / int(s.scale)
+		for i := 0; i < periodsAgo && i < len(s.failAvg); i++ {
+			s.failAvg[i][bucket]++
+		}
+	}
+}
+
+// estimateMedianVal returns the average fee rate of the bucket holding the
+// median transaction of the lowest range of buckets whose transactions
+// confirmed within the target at least at the success rate.  Buckets are
+// grouped together, starting from the highest fee rates, until they have seen
+// enough transactions to be tested.  -1 is returned if no range passes.
+func (s *txConfirmStats) estimateMedianVal(confTarget int, sufficientTxVal,
+	successBreakPoint float64, bestSeenHeight int32) float64 {
+
+	var (
+		nConf    float64 // Txs confirmed within the target.
+		totalNum float64 // Txs that were ever confirmed.
+		failNum  float64 // Txs that left the mempool after the target.
+		extraNum int     // Txs still in the mempool after the target.
+	)
+	periodTarget := (confTarget + int(s.scale) - 1) / int(s.scale)
+	maxBucket := len(s.buckets) - 1
+
+	curNearBucket, bestNearBucket := maxBucket, maxBucket
+	curFarBucket, bestFarBucket := maxBucket, maxBucket
+	foundAnswer := false
+	newBucketRange := true
+	bins := len(s.unconfTxs)
+
+	// Start counting from the highest fee rate transactions.
+	for bucket := maxBucket; bucket >= 0; bucket-- {
+		if newBucketRange {
+			curNearBucket = bucket
+			newBucketRange = false
+		}
+		curFarBucket = bucket
+		nConf += s.confAvg[periodTarget-1][bucket]
+		totalNum += s.txCtAvg[bucket]
+		failNum += s.failAvg[periodTarget-1][bucket]
+		for confct := confTarget; confct < s.maxConfirms(); confct++ {
+			idx := (int(bestSeenHeight) - confct) % bins
+			if idx < 0 {
+				idx += bins
+			}
+			extraNum += s.unconfTxs[idx][bucket]
+		}
+		extraNum += s.oldUnconfTxs[bucket]
+
+		// Only test the range once it has seen enough confirmed
+		// transactions so that every target looks at the same
+		// amount of data.
+		if totalNum < sufficientTxVal/(1-s.decay) {
+			continue
+		}
+
+		curPct := nConf / (totalNum + failNum + float64(extraNum))
+		if curPct < successBreakPoint {
+			continue
+		}
+
+		// The range passes so reset the counters and start a new one
+		// to try and find a lower fee rate that still passes.
+		foundAnswer = true
+		nConf, totalNum, failNum, extraNum = 0, 0, 0, 0
+		bestNearBucket = curNearBucket
+		bestFarBucket = curFarBucket
+		newBucketRange = true
+	}
+	if !foundAnswer {
+		return -1
+	}
+
+	// Report the average fee rate of the bucket holding the median
+	// transaction of the range as every fee rate isn't kept.
+	minBucket := min(bestNearBucket, bestFarBucket)
+	maxBucket = max(bestNearBucket, bestFarBucket)
+	var txSum float64
+	for j := minBucket; j <= maxBucket; j++ {
+		txSum += s.txCtAvg[j]
+	}
+	if txSum == 0 {
+		return -1
+	}
+	txSum /= 2
+	for j := minBucket; j <= maxBucket; j++ {
+		if s.txCtAvg[j] < txSum {
+			txSum -= s.txCtAvg[j]
+			continue
+		}
+		return s.feeRateAvg[j] / s.txCtAvg[j]
+	}
+
+	return -1
+}
+
+// serialize writes the moving averages of the stats to w.  The unconfirmed
+// transactions aren't written as the mempool isn't kept across restarts.
+func (s *txConfirmStats) serialize(w io.Writer) error {
+	fields := []interface{}{
+		s.decay, s.scale, uint32(len(s.confAvg)), s.feeRateAvg, s.txCtAvg,
+	}
+	for _, avg := range s.confAvg {
+		fields = append(fields, avg)
+	}
+	for _, avg := range s.failAvg {
+		fields = append(fields, avg)
+	}
+	for _, field := range fields {
+		err := binary.Write(w, binary.LittleEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deserialize reads the moving averages written by serialize into the stats.
+// The decay, scale and number of periods must match the ones of the stats.
+func (s *txConfirmStats) deserialize(r io.Reader) error {
+	var (
+		decay   float64
+		scale   uint32
+		periods uint32
+	)
+	for _, field := range []interface{}{&decay, &scale, &periods} {
+		err := binary.Read(r, binary.LittleEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+	if decay != s.decay || scale != s.scale ||
+		periods != uint32(len(s.confAvg)) {
+
+		return fmt.Errorf("stats with decay %v, scale %d and %d "+
+			"periods don't match the expected decay %v, scale %d "+
+			"and %d periods", decay, scale, periods, s.decay,
+			s.scale, len(s.confAvg))
+	}
+
+	fields := []interface{}{s.feeRateAvg, s.txCtAvg}
+	for _, avg := range s.confAvg {
+		fields = append(fields, avg)
+	}
+	for _, avg := range s.failAvg {
+		fields = append(fields, avg)
+	}
+	for _, field := range fields {
+		err := binary.Read(r, binary.LittleEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trackedTx is a transaction in the mempool tracked by the smart fee
+// estimator.
+type trackedTx struct {
+	height  int32
+	feeRate float64
+	bucket  int
+}
+
+// SmartFeeEstimator estimates the fee rate needed for a transaction to confirm
+// within a number of blocks from the transactions it's seen entering the
+// mempool and getting confirmed.  It's fed by the mempool as transactions enter
+// and leave it and by the sync manager as blocks are connected.
+type SmartFeeEstimator struct {
+	mtx sync.Mutex
+
+	// bestSeenHeight is the height of the last block processed.
+	bestSeenHeight int32
+
+	// firstRecordedHeight is the height of the first block that confirmed
+	// a tracked transaction.
+	firstRecordedHeight int32
+
+	// historicalFirst and historicalBest are the span of blocks that the
+	// data restored from a previous run was recorded over.
+	historicalFirst int32
+	historicalBest  int32
+
+	buckets    []float64
+	shortStats *txConfirmStats
+	feeStats   *txConfirmStats
+	longStats  *txConfirmStats
+
+	tracked map[chainhash.Hash]trackedTx
+}
+
+// NewSmartFeeEstimator returns a new smart fee estimator without any data.
+func NewSmartFeeEstimator() *SmartFeeEstimator {
+	var buckets []float64
+	for boundary := float64(minBucketFeeRate); boundary <= maxBucketFeeRate; boundary *= feeSpacing {
+		buckets = append(buckets, boundary)
+	}
+	buckets = append(buckets, infFeeRate)
+
+	return &SmartFeeEstimator{
+		buckets:    buckets,
+		shortStats: newTxConfirmStats(buckets, shortBlockPeriods, shortScale, shortDecay),
+		feeStats:   newTxConfirmStats(buckets, medBlockPeriods, medScale, medDecay),
+		longStats:  newTxConfirmStats(buckets, longBlockPeriods, longScale, longDecay),
+		tracked:    make(map[chainhash.Hash]trackedTx),
+	}
+}
+
+// allStats returns the stats of every horizon.
+func (ef *SmartFeeEstimator) allStats() []*txConfirmStats {
+	return []*txConfirmStats{ef.shortStats, ef.feeStats, ef.longStats}
+}
+
+// ProcessTransaction starts tracking a transaction that entered the mempool.
+// Transactions that entered while the estimator wasn't caught up with the
+// chain or that spend unconfirmed outputs, as signaled by validFeeEstimate,
+// aren't tracked as their fee rate doesn't reflect how fast they confirm.
+//
+// This function is safe for concurrent access.
+func (ef *SmartFeeEstimator) ProcessTransaction(txD *TxDesc, validFeeEstimate bool) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	txHash := *txD.Tx.Hash()
+	if _, found := ef.tracked[txHash]; found {
+		return
+	}
+	// No block has been processed yet when the best seen height is zero.
+	if ef.bestSeenHeight == 0 || txD.Height != ef.bestSeenHeight ||
+		!validFeeEstimate {
+
+		return
+	}
+
+	feeRate := float64(txD.Fee) * 1000 / float64(GetTxVirtualSize(txD.Tx))
+	bucket := ef.shortStats.bucketIndex(feeRate)
+	for _, stats := range ef.allStats() {
+		stats.newTx(txD.Height, bucket)
+	}
+	ef.tracked[txHash] = trackedTx{
+		height:  txD.Height,
+		feeRate: feeRate,
+		bucket:  bucket,
+	}
+}
+
+// removeTx stops tracking the given transaction.  It returns false if the
+// transaction wasn't tracked.
+//
+// This function MUST be called with the estimator lock held.
+func (ef *SmartFeeEstimator) removeTx(txHash *chainhash.Hash, inBlock bool) (trackedTx, bool) {
+	tx, found := ef.tracked[*txHash]
+	if !found {
+		return tx, false
+	}
+	for _, stats := range ef.allStats() {
+		stats.removeTx(tx.height, ef.bestSeenHeight, tx.bucket, inBlock)
+	}
+	delete(ef.tracked, *txHash)
+
+	return tx, true
+}
+
+// RemoveTransaction stops tracking a transaction that left the mempool without
+// being confirmed.  Transactions that were confirmed are already untracked by
+// ProcessBlock.
+//
+// This function is safe for concurrent access.
+func (ef *SmartFeeEstimator) RemoveTransaction(txHash *chainhash.Hash) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	ef.removeTx(txHash, false)
+}
+
+// ProcessBlock records the confirmations of the tracked transactions in the
+// passed block.  It should be called when the block is connected, before its
+// transactions are removed from the mempool.  Blocks at or below the best seen
+// height are ignored.
+//
+// This function is safe for concurrent access.
+func (ef *SmartFeeEstimator) ProcessBlock(block *btcutil.Block) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	height := block.Height()
+	if height <= ef.bestSeenHeight {
+		return
+	}
+	ef.bestSeenHeight = height
+
+	for _, stats := range ef.allStats() {
+		stats.clearCurrent(height)
+		stats.updateMovingAverages()
+	}
+
+	var counted int
+	for _, tx := range block.Transactions()[1:] {
+		tracked, found := ef.removeTx(tx.Hash(), true)
+		if !found {
+			continue
+		}
+
+		blocksToConfirm := int(height - tracked.height)
+		if blocksToConfirm <= 0 {
+			continue
+		}
+		for _, stats := range ef.allStats() {
+			stats.record(blocksToConfirm, tracked.feeRate)
+		}
+		counted++
+	}
+
+	if ef.firstRecordedHeight == 0 && counted > 0 {
+		ef.firstRecordedHeight = ef.bestSeenHeight
+	}
+
+	log.Debugf("Smart fee estimator recorded %d of %d txs in block %v, "+
+		"tracking %d txs", counted, len(block.Transactions())-1,
+		block.Hash(), len(ef.tracked))
+}
+
+// blockSpan returns the number of blocks data has been recorded over since
+// the estimator was started.
+func (ef *SmartFeeEstimator) blockSpan() int {
+	if ef.firstRecordedHeight == 0 {
+		return 0
+	}
+
+	return int(ef.bestSeenHeight - ef.firstRecordedHeight)
+}
+
+// historicalBlockSpan returns the number of blocks the data restored from a
+// previous run was recorded over.  It's 0 if the data is too old.
+func (ef *SmartFeeEstimator) historicalBlockSpan() int {
+	if ef.historicalFirst == 0 {
+		return 0
+	}
+	if ef.bestSeenHeight-ef.historicalBest > oldestEstimateHistory {
+		return 0
+	}
+
+	return int(ef.historicalBest - ef.historicalFirst)
+}
+
+// maxUsableEstimate returns the highest target that there's enough data
+// recorded to estimate.
+func (ef *SmartFeeEstimator) maxUsableEstimate() int {
+	span := max(ef.blockSpan(), ef.historicalBlockSpan())
+	return min(ef.longStats.maxConfirms(), span/2)
+}
+
+// estimateCombinedFee returns the fee rate estimate for the target from the
+// shortest horizon tracking it.  If checkShorterHorizon is set, the estimates
+// for the longest targets of the shorter horizons are used instead when lower.
+func (ef *SmartFeeEstimator) estimateCombinedFee(confTarget int,
+	successThreshold float64, checkShorterHorizon bool) float64 {
+
+	estimate := -1.0
+	if confTarget < 1 || confTarget > ef.longStats.maxConfirms() {
+		return estimate
+	}
+
+	switch {
+	case confTarget <= ef.shortStats.maxConfirms():
+		estimate = ef.shortStats.estimateMedianVal(confTarget,
+			sufficientTxsShort, successThreshold, ef.bestSeenHeight)
+	case confTarget <= ef.feeStats.maxConfirms():
+		estimate = ef.feeStats.estimateMedianVal(confTarget,
+			sufficientFeeTxs, successThreshold, ef.bestSeenHeight)
+	default:
+		estimate = ef.longStats.estimateMedianVal(confTarget,
+			sufficientFeeTxs, successThreshold, ef.bestSeenHeight)
+	}
+	if !checkShorterHorizon {
+		return estimate
+	}
+
+	shorter := []struct {
+		stats      *txConfirmStats
+		sufficient float64
+	}{
+		{ef.feeStats, sufficientFeeTxs},
+		{ef.shortStats, sufficientTxsShort},
+	}
+	for _, h := range shorter {
+		if confTarget <= h.stats.maxConfirms() {
+			continue
+		}
+		shorterEst := h.stats.estimateMedianVal(h.stats.maxConfirms(),
+			h.sufficient, successThreshold, ef.bestSeenHeight)
+		if shorterEst > 0 && (estimate == -1 || shorterEst < estimate) {
+			estimate = shorterEst
+		}
+	}
+
+	return estimate
+}
+
+// estimateConservativeFee returns the highest of the fee rate estimates for
+// double the target from the medium and long horizons at the highest success
+// rate.
+func (ef *SmartFeeEstimator) estimateConservativeFee(doubleTarget int) float64 {
+	estimate := -1.0
+	if doubleTarget <= ef.shortStats.maxConfirms() {
+		estimate = ef.feeStats.estimateMedianVal(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, ef.bestSeenHeight)
+	}
+	if doubleTarget <= ef.feeStats.maxConfirms() {
+		longEstimate := ef.longStats.estimateMedianVal(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, ef.bestSeenHeight)
+		if longEstimate > estimate {
+			estimate = longEstimate
+		}
+	}
+
+	return estimate
+}
+
+// EstimateSmartFee returns the fee rate in satoshis per kilo virtual byte
+// needed for a transaction to confirm within confTarget blocks along with the
+// target the estimate was made for, which is lower than the requested one when
+// there's not enough data recorded for it.  Conservative estimates use more of
+// the recorded history and are less responsive to drops in fee rates.
+// ErrNoSmartFeeEstimate is returned when there's not enough data to make an
+// estimate.
+//
+// This function is safe for concurrent access.
+func (ef *SmartFeeEstimator) EstimateSmartFee(confTarget int,
+	conservative bool) (btcutil.Amount, int, error) {
+
+	if confTarget < 1 || confTarget > MaxSmartFeeTarget {
+		return 0, 0, fmt.Errorf("confirmation target %d is out of "+
+			"range [1, %d]", confTarget, MaxSmartFeeTarget)
+	}
+
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// It's not possible to estimate for a single block as every fee rate
+	// takes at least one block to confirm.
+	if confTarget == 1 {
+		confTarget = 2
+	}
+	if maxUsable := ef.maxUsableEstimate(); confTarget > maxUsable {
+		confTarget = maxUsable
+	}
+	if confTarget <= 1 {
+		return 0, confTarget, ErrNoSmartFeeEstimate
+	}
+
+	// The estimate is the highest of the estimates for half the target
+	// at a lower success rate, for the target and for double the target
+	// at a higher success rate.
+	median := ef.estimateCombinedFee(confTarget/2, halfSuccessPct, true)
+	actualEst := ef.estimateCombinedFee(confTarget, successPct, true)
+	median = max(median, actualEst)
+	doubleEst := ef.estimateCombinedFee(2*confTarget, doubleSuccessPct,
+		!conservative)
+	median = max(median, doubleEst)
+
+	if conservative || median == -1 {
+		consEst := ef.estimateConservativeFee(2 * confTarget)
+		median = max(median, consEst)
+	}
+	if median < 0 {
+		return 0, confTarget, ErrNoSmartFeeEstimate
+	}
+
+	return btcutil.Amount(math.Round(median)), confTarget, nil
+}
+
+// Save writes the recorded data of the estimator to w so that it can be
+// restored with RestoreSmartFeeEstimator.
+//
+// This function is safe for concurrent access.
+func (ef *SmartFeeEstimator) Save(w io.Writer) error {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	// Keep the span of the previous run if more of the data was recorded
+	// over it than over this one.
+	first, best := ef.historicalFirst, ef.historicalBest
+	if ef.blockSpan() > ef.historicalBlockSpan()/2 {
+		first, best = ef.firstRecordedHeight, ef.bestSeenHeight
+	}
+
+	// The best seen height is still zero if the estimator was restored
+	// and no block has been processed since.
+	bestSeen := max(ef.bestSeenHeight, best)
+	fields := []interface{}{
+		uint32(smartFeeSaveVersion), bestSeen, first, best,
+		uint32(len(ef.buckets)), ef.buckets,
+	}
+	for _, field := range fields {
+		err := binary.Write(w, binary.LittleEndian, field)
+		if err != nil {
+			return err
+		}
+	}
+	for _, stats := range ef.allStats() {
+		err := stats.serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreSmartFeeEstimator reads a smart fee estimator saved with Save from r.
+// The transactions tracked at the time it was saved aren't restored.
+func RestoreSmartFeeEstimator(r io.Reader) (*SmartFeeEstimator, error) {
+	var (
+		version    uint32
+		bestSeen   int32
+		first      int32
+		best       int32
+		numBuckets uint32
+	)
+	fields := []interface{}{&version, &bestSeen, &first, &best, &numBuckets}
+	for _, field := range fields {
+		err := binary.Read(r, binary.LittleEndian, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if version != smartFeeSaveVersion {
+		return nil, fmt.Errorf("unsupported smart fee estimator "+
+			"version %d", version)
+	}
+	if first > best || best > bestSeen {
+		return nil, fmt.Errorf("smart fee estimator recorded from "+
+			"height %d to %d is inconsistent with its best seen "+
+			"height %d", first, best, bestSeen)
+	}
+
+	ef := NewSmartFeeEstimator()
+	if numBuckets != uint32(len(ef.buckets)) {
+		return nil, fmt.Errorf("smart fee estimator has %d buckets, "+
+			"expected %d", numBuckets, len(ef.buckets))
+	}
+	buckets := make([]float64, numBuckets)
+	err := binary.Read(r, binary.LittleEndian, buckets)
+	if err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		if buckets[i] != ef.buckets[i] {
+			return nil, fmt.Errorf("smart fee estimator bucket %d "+
+				"is %v, expected %v", i, buckets[i], ef.buckets[i])
+		}
+	}
+	for _, stats := range ef.allStats() {
+		err := stats.deserialize(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The data restored is only used for the span it was recorded over.
+	// Transactions are tracked again once the next block is processed.
+	ef.historicalFirst = first
+	ef.historicalBest = best
+
+	return ef, nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/mining"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// smartFeeTester feeds transactions and blocks to a smart fee estimator.
+type smartFeeTester struct {
+	ef      *SmartFeeEstimator
+	version int32
+	height  int32
+}
+
+// newTx returns a transaction paying the given fee rate in satoshis per kilo
+// virtual byte that entered the mempool at the current height.
+func (sft *smartFeeTester) newTx(feeRate int64) *TxDesc {
+	sft.version++
+	tx := btcutil.NewTx(&wire.MsgTx{Version: sft.version})
+	return &TxDesc{
+		TxDesc: mining.TxDesc{
+			Tx:     tx,
+			Height: sft.height,
+			Fee:    feeRate * GetTxVirtualSize(tx) / 1000,
+		},
+	}
+}
+
+// connectBlock processes the next block confirming the given transactions.
+func (sft *smartFeeTester) connectBlock(txs []*TxDesc) {
+	sft.height++
+
+	msgTxs := []*wire.MsgTx{wire.NewMsgTx(1)}
+	for _, txD := range txs {
+		msgTxs = append(msgTxs, txD.Tx.MsgTx())
+	}
+	block := btcutil.NewBlock(&wire.MsgBlock{Transactions: msgTxs})
+	block.SetHeight(sft.height)
+	sft.ef.ProcessBlock(block)
+}
+
+// TestSmartFeeEstimate ensures that the smart fee estimator estimates the fee
+// rate of the transactions that confirm within the target.
+func TestSmartFeeEstimate(t *testing.T) {
+	t.Parallel()
+
+	const (
+		highFeeRate = 20000
+		lowFeeRate  = 2000
+	)
+
+	sft := &smartFeeTester{ef: NewSmartFeeEstimator()}
+	ef := sft.ef
+
+	// Nothing can be estimated without data.
+	_, _, err := ef.EstimateSmartFee(2, true)
+	if !errors.Is(err, ErrNoSmartFeeEstimate) {
+		t.Fatalf("expected %v, got %v", ErrNoSmartFeeEstimate, err)
+	}
+	for _, target := range []int{0, MaxSmartFeeTarget + 1} {
+		if _, _, err := ef.EstimateSmartFee(target, true); err == nil {
+			t.Fatalf("expected an error for target %d", target)
+		}
+	}
+
+	// Transactions entering before the first block aren't tracked as the
+	// estimator isn't caught up.
+	ef.ProcessTransaction(sft.newTx(highFeeRate), true)
+	if len(ef.tracked) != 0 {
+		t.Fatalf("expected no tracked transactions, got %d", len(ef.tracked))
+	}
+	sft.connectBlock(nil)
+
+	// Every block confirms the high fee rate transactions that entered in
+	// the previous one while the low fee rate ones are evicted unconfirmed
+	// after a few blocks.
+	var pending [][]*TxDesc
+	for i := 0; i < 100; i++ {
+		var high, low []*TxDesc
+		for j := 0; j < 10; j++ {
+			txD := sft.newTx(highFeeRate)
+			ef.ProcessTransaction(txD, true)
+			high = append(high, txD)
+
+			txD = sft.newTx(lowFeeRate)
+			ef.ProcessTransaction(txD, true)
+			low = append(low, txD)
+		}
+
+		// Transactions spending unconfirmed outputs aren't tracked.
+		ef.ProcessTransaction(sft.newTx(lowFeeRate/2), false)
+
+		pending = append(pending, low)
+		if len(pending) > 3 {
+			for _, txD := range pending[0] {
+				ef.RemoveTransaction(txD.Tx.Hash())
+			}
+			pending = pending[1:]
+		}
+
+		sft.connectBlock(high)
+	}
+	if want := 30; len(ef.tracked) != want {
+		t.Fatalf("expected %d tracked transactions, got %d", want,
+			len(ef.tracked))
+	}
+
+	for _, conservative := range []bool{true, false} {
+		feeRate, blocks, err := ef.EstimateSmartFee(1, conservative)
+		if err != nil {
+			t.Fatalf("unable to estimate fee: %v", err)
+		}
+		if blocks != 2 {
+			t.Fatalf("expected an estimate for 2 blocks, got %d", blocks)
+		}
+		if feeRate != highFeeRate {
+			t.Fatalf("expected fee rate %d, got %d", highFeeRate, feeRate)
+		}
+	}
+
+	// Targets beyond the span of the recorded blocks are capped.
+	_, blocks, err := ef.EstimateSmartFee(MaxSmartFeeTarget, false)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if want := ef.blockSpan() / 2; blocks != want {
+		t.Fatalf("expected an estimate for %d blocks, got %d", want, blocks)
+	}
+
+	// Old blocks are ignored.
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{wire.NewMsgTx(1)},
+	})
+	block.SetHeight(sft.height - 1)
+	ef.ProcessBlock(block)
+	if ef.bestSeenHeight != sft.height {
+		t.Fatalf("expected best seen height %d, got %d", sft.height,
+			ef.bestSeenHeight)
+	}
+}
+
+// TestSmartFeeSaveRestore ensures that the smart fee estimator keeps making the
+// same estimates after it's saved and restored.
+func TestSmartFeeSaveRestore(t *testing.T) {
+	t.Parallel()
+
+	sft := &smartFeeTester{ef: NewSmartFeeEstimator()}
+	sft.connectBlock(nil)
+	for i := 0; i < 50; i++ {
+		var txs []*TxDesc
+		for j := 0; j < 5; j++ {
+			txD := sft.newTx(int64(5000 + j*1000))
+			sft.ef.ProcessTransaction(txD, true)
+			txs = append(txs, txD)
+		}
+		sft.connectBlock(txs)
+	}
+	want, wantBlocks, err := sft.ef.EstimateSmartFee(6, true)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := sft.ef.Save(&buf); err != nil {
+		t.Fatalf("unable to save the estimator: %v", err)
+	}
+	saved := buf.Bytes()
+
+	restored, err := RestoreSmartFeeEstimator(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatalf("unable to restore the estimator: %v", err)
+	}
+	got, gotBlocks, err := restored.EstimateSmartFee(6, true)
+	if err != nil {
+		t.Fatalf("unable to estimate fee: %v", err)
+	}
+	if got != want || gotBlocks != wantBlocks {
+		t.Fatalf("expected fee rate %d for %d blocks, got %d for %d "+
+			"blocks", want, wantBlocks, got, gotBlocks)
+	}
+
+	// Saving the restored estimator keeps the span of the data.
+	span := sft.ef.blockSpan()
+	if restored.historicalBlockSpan() != span {
+		t.Fatalf("expected a historical span of %d, got %d", span,
+			restored.historicalBlockSpan())
+	}
+	buf.Reset()
+	if err := restored.Save(&buf); err != nil {
+		t.Fatalf("unable to save the estimator: %v", err)
+	}
+	restored, err = RestoreSmartFeeEstimator(&buf)
+	if err != nil {
+		t.Fatalf("unable to restore the estimator: %v", err)
+	}
+	if restored.historicalBlockSpan() != span {
+		t.Fatalf("expected a historical span of %d, got %d", span,
+			restored.historicalBlockSpan())
+	}
+
+	// Truncated and unknown versions fail to restore.
+	_, err = RestoreSmartFeeEstimator(bytes.NewReader(saved[:len(saved)-1]))
+	if err == nil {
+		t.Fatalf("expected a truncated estimator to fail to restore")
+	}
+	badVersion := append([]byte{0xff}, saved[1:]...)
+	_, err = RestoreSmartFeeEstimator(bytes.NewReader(badVersion))
+	if err == nil {
+		t.Fatalf("expected an unknown version to fail to restore")
+	}
+}
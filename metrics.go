@@ -0,0 +1,305 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/utreexo/utreexod/blockchain/indexers"
+)
+
+const (
+	// metricsNamespace is the namespace that all the exported metrics are
+	// prefixed with.
+	metricsNamespace = "utreexod"
+
+	// metricsSubsystem is the subsystem for the metrics of the utreexo
+	// state.
+	metricsSubsystem = "utreexo"
+
+	// proofAccessMetricsSubsystem is the subsystem for the metrics of the
+	// served utreexo proofs.
+	proofAccessMetricsSubsystem = "proofaccess"
+
+	// metricsShutdownTimeout is how long the metrics server waits for the
+	// in-flight scrapes to finish when it's being stopped.
+	metricsShutdownTimeout = time.Second * 5
+)
+
+// utreexoMetricsSource is a utreexo proof index that the metrics of its utreexo
+// state are exported for.
+type utreexoMetricsSource struct {
+	// name is the value of the index label for the metrics.
+	name string
+
+	// fetch returns a snapshot of the metrics of the utreexo state.
+	fetch func() indexers.UtreexoStateMetrics
+}
+
+// utreexoCollector implements prometheus.Collector for the utreexo states of
+// the enabled utreexo proof indexes.  The metrics are fetched from the utreexo
+// states on every scrape.
+type utreexoCollector struct {
+	sources []utreexoMetricsSource
+
+	cacheEntries       *prometheus.Desc
+	cacheCapacity      *prometheus.Desc
+	cacheHits          *prometheus.Desc
+	cacheMisses        *prometheus.Desc
+	flushes            *prometheus.Desc
+	flushDuration      *prometheus.Desc
+	lastFlushDuration  *prometheus.Desc
+	numLeaves          *prometheus.Desc
+	numRoots           *prometheus.Desc
+	compactions        *prometheus.Desc
+	compactionDuration *prometheus.Desc
+	compactionDebt     *prometheus.Desc
+	garbageRatio       *prometheus.Desc
+	garbageCompactions *prometheus.Desc
+}
+
+// Ensure utreexoCollector implements the prometheus.Collector interface.
+var _ prometheus.Collector = (*utreexoCollector)(nil)
+
+// newUtreexoCollector returns a new collector for the given sources.
+func newUtreexoCollector(sources []utreexoMetricsSource) *utreexoCollector {
+	newDesc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, metricsSubsystem, name),
+			help, append([]string{"index"}, labels...), nil)
+	}
+
+	return &utreexoCollector{
+		sources: sources,
+		cacheEntries: newDesc("cache_entries",
+			"Number of elements currently in the cache.", "cache"),
+		cacheCapacity: newDesc("cache_capacity",
+			"Number of elements the cache can hold.", "cache"),
+		cacheHits: newDesc("cache_hits_total",
+			"Number of lookups served by the cache.", "cache"),
+		cacheMisses: newDesc("cache_misses_total",
+			"Number of lookups that had to go to the database.", "cache"),
+		flushes: newDesc("flushes_total",
+			"Number of times the utreexo state was flushed to disk."),
+		flushDuration: newDesc("flush_duration_seconds_total",
+			"Cumulative time spent flushing the utreexo state to disk."),
+		lastFlushDuration: newDesc("last_flush_duration_seconds",
+			"Time spent on the last flush of the utreexo state."),
+		numLeaves: newDesc("num_leaves",
+			"Number of leaves that were ever added to the accumulator."),
+		numRoots: newDesc("num_roots",
+			"Number of roots in the accumulator."),
+		compactions: newDesc("db_compactions_total",
+			"Number of compactions of the database backing the utreexo state."),
+		compactionDuration: newDesc("db_compaction_duration_seconds_total",
+			"Cumulative time spent compacting the database backing the utreexo state."),
+		compactionDebt: newDesc("db_compaction_debt_bytes",
+			"Estimated bytes that need to be compacted for the database to reach a stable state."),
+		garbageRatio: newDesc("cachedleaves_garbage_ratio",
+			"Estimated share of the cached leaves entries in the database that are garbage."),
+		garbageCompactions: newDesc("garbage_compactions_total",
+			"Number of compactions of the database started because of the garbage of the cached leaves."),
+	}
+}
+
+// Describe sends the descriptors of all the metrics of the collector.
+//
+// This is part of the prometheus.Collector interface.
+func (c *utreexoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cacheEntries
+	ch <- c.cacheCapacity
+	ch <- c.cacheHits
+	ch <- c.cacheMisses
+	ch <- c.flushes
+	ch <- c.flushDuration
+	ch <- c.lastFlushDuration
+	ch <- c.numLeaves
+	ch <- c.numRoots
+	ch <- c.compactions
+	ch <- c.compactionDuration
+	ch <- c.compactionDebt
+	ch <- c.garbageRatio
+	ch <- c.garbageCompactions
+}
+
+// Collect fetches the metrics from every source and sends them.
+//
+// This is part of the prometheus.Collector interface.
+func (c *utreexoCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, source := range c.sources {
+		m := source.fetch()
+
+		caches := []struct {
+			name    string
+			metrics indexers.UtreexoCacheMetrics
+		}{
+			{"nodes", m.Nodes},
+			{"cachedleaves", m.CachedLeaves},
+			{"proofs", m.Proofs},
+		}
+		for _, cache := range caches {
+			ch <- prometheus.MustNewConstMetric(c.cacheEntries,
+				prometheus.GaugeValue, float64(cache.metrics.Used),
+				source.name, cache.name)
+			ch <- prometheus.MustNewConstMetric(c.cacheCapacity,
+				prometheus.GaugeValue, float64(cache.metrics.Capacity),
+				source.name, cache.name)
+			ch <- prometheus.MustNewConstMetric(c.cacheHits,
+				prometheus.CounterValue, float64(cache.metrics.Hits),
+				source.name, cache.name)
+			ch <- prometheus.MustNewConstMetric(c.cacheMisses,
+				prometheus.CounterValue, float64(cache.metrics.Misses),
+				source.name, cache.name)
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.flushes,
+			prometheus.CounterValue, float64(m.FlushCount), source.name)
+		ch <- prometheus.MustNewConstMetric(c.flushDuration,
+			prometheus.CounterValue, m.FlushDuration.Seconds(), source.name)
+		ch <- prometheus.MustNewConstMetric(c.lastFlushDuration,
+			prometheus.GaugeValue, m.LastFlushDuration.Seconds(), source.name)
+		ch <- prometheus.MustNewConstMetric(c.numLeaves,
+			prometheus.GaugeValue, float64(m.NumLeaves), source.name)
+		ch <- prometheus.MustNewConstMetric(c.numRoots,
+			prometheus.GaugeValue, float64(m.NumRoots), source.name)
+		ch <- prometheus.MustNewConstMetric(c.compactions,
+			prometheus.CounterValue, float64(m.Compactions), source.name)
+		ch <- prometheus.MustNewConstMetric(c.compactionDuration,
+			prometheus.CounterValue, m.CompactionDuration.Seconds(), source.name)
+		ch <- prometheus.MustNewConstMetric(c.compactionDebt,
+			prometheus.GaugeValue, float64(m.CompactionDebt), source.name)
+		ch <- prometheus.MustNewConstMetric(c.garbageRatio,
+			prometheus.GaugeValue, m.CachedLeavesGarbage.Ratio(), source.name)
+		ch <- prometheus.MustNewConstMetric(c.garbageCompactions,
+			prometheus.CounterValue, float64(m.GarbageCompactions), source.name)
+	}
+}
+
+// proofAccessCollector implements prometheus.Collector for the counts of the
+// served utreexo proofs.  The clients are never exported as labels so that the
+// addresses of the clients don't end up in the metrics.
+type proofAccessCollector struct {
+	stats *proofAccessStats
+
+	proofs  *prometheus.Desc
+	targets *prometheus.Desc
+	bytes   *prometheus.Desc
+}
+
+// Ensure proofAccessCollector implements the prometheus.Collector interface.
+var _ prometheus.Collector = (*proofAccessCollector)(nil)
+
+// newProofAccessCollector returns a new collector for the given counts.
+func newProofAccessCollector(stats *proofAccessStats) *proofAccessCollector {
+	newDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace,
+				proofAccessMetricsSubsystem, name),
+			help, []string{"source", "depth", "size"}, nil)
+	}
+
+	return &proofAccessCollector{
+		stats: stats,
+		proofs: newDesc("proofs_total",
+			"Number of utreexo proofs served. Reset by getproofaccessstats with reset set."),
+		targets: newDesc("targets_total",
+			"Number of targets of the utreexo proofs served."),
+		bytes: newDesc("bytes_total",
+			"Size in bytes of the utreexo proofs served."),
+	}
+}
+
+// Describe sends the descriptors of all the metrics of the collector.
+//
+// This is part of the prometheus.Collector interface.
+func (c *proofAccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.proofs
+	ch <- c.targets
+	ch <- c.bytes
+}
+
+// Collect sends the counts of every group of served proofs.
+//
+// This is part of the prometheus.Collector interface.
+func (c *proofAccessCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, g := range c.stats.result(false).Groups {
+		ch <- prometheus.MustNewConstMetric(c.proofs,
+			prometheus.CounterValue, float64(g.Proofs),
+			g.Source, g.Depth, g.Size)
+		ch <- prometheus.MustNewConstMetric(c.targets,
+			prometheus.CounterValue, float64(g.Targets),
+			g.Source, g.Depth, g.Size)
+		ch <- prometheus.MustNewConstMetric(c.bytes,
+			prometheus.CounterValue, float64(g.Bytes),
+			g.Source, g.Depth, g.Size)
+	}
+}
+
+// metricsServer serves the metrics of the node in the Prometheus exposition
+// format on the /metrics endpoint.
+type metricsServer struct {
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// newMetricsServer returns a new metrics server listening on the given address
+// that serves the metrics of the given collectors along with the standard
+// process and go runtime metrics.  The listener is bound here so that a bad
+// listen address fails the startup like the other listeners do.
+func newMetricsServer(listenAddr string, collectors ...prometheus.Collector) (*metricsServer, error) {
+	registry := prometheus.NewRegistry()
+	collectors = append(collectors,
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector())
+	for _, collector := range collectors {
+		err := registry.Register(collector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s for the "+
+			"metrics server: %v", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return &metricsServer{
+		listener: listener,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: time.Second * 10,
+		},
+	}, nil
+}
+
+// Start begins serving the metrics.
+func (m *metricsServer) Start() {
+	srvrLog.Infof("Prometheus metrics server listening on %s", m.listener.Addr())
+	go func() {
+		err := m.httpServer.Serve(m.listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			srvrLog.Errorf("Prometheus metrics server error: %v", err)
+		}
+	}()
+}
+
+// Stop gracefully shuts down the metrics server.
+func (m *metricsServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+
+	return m.httpServer.Shutdown(ctx)
+}
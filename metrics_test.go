@@ -0,0 +1,123 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/blockchain/indexers"
+)
+
+func TestUtreexoCollector(t *testing.T) {
+	collector := newUtreexoCollector([]utreexoMetricsSource{
+		{
+			name: "flatutreexoproofindex",
+			fetch: func() indexers.UtreexoStateMetrics {
+				return indexers.UtreexoStateMetrics{
+					Nodes: indexers.UtreexoCacheMetrics{
+						Used: 10, Capacity: 100, Hits: 7, Misses: 3,
+					},
+					CachedLeaves: indexers.UtreexoCacheMetrics{
+						Used: 20, Capacity: 200, Hits: 5, Misses: 5,
+					},
+					Proofs: indexers.UtreexoCacheMetrics{
+						Used: 1, Capacity: 1000, Hits: 9, Misses: 1,
+					},
+					FlushCount:         2,
+					FlushDuration:      time.Second * 3,
+					LastFlushDuration:  time.Millisecond * 500,
+					NumLeaves:          12,
+					NumRoots:           2,
+					Compactions:        4,
+					CompactionDuration: time.Second,
+					CompactionDebt:     1024,
+					CachedLeavesGarbage: blockchain.CachedLeavesGarbage{
+						Live: 30, Garbage: 10,
+					},
+					GarbageCompactions: 1,
+				}
+			},
+		},
+	})
+
+	expected := `
+# HELP utreexod_utreexo_cache_hits_total Number of lookups served by the cache.
+# TYPE utreexod_utreexo_cache_hits_total counter
+utreexod_utreexo_cache_hits_total{cache="cachedleaves",index="flatutreexoproofindex"} 5
+utreexod_utreexo_cache_hits_total{cache="nodes",index="flatutreexoproofindex"} 7
+utreexod_utreexo_cache_hits_total{cache="proofs",index="flatutreexoproofindex"} 9
+# HELP utreexod_utreexo_cache_misses_total Number of lookups that had to go to the database.
+# TYPE utreexod_utreexo_cache_misses_total counter
+utreexod_utreexo_cache_misses_total{cache="cachedleaves",index="flatutreexoproofindex"} 5
+utreexod_utreexo_cache_misses_total{cache="nodes",index="flatutreexoproofindex"} 3
+utreexod_utreexo_cache_misses_total{cache="proofs",index="flatutreexoproofindex"} 1
+# HELP utreexod_utreexo_flushes_total Number of times the utreexo state was flushed to disk.
+# TYPE utreexod_utreexo_flushes_total counter
+utreexod_utreexo_flushes_total{index="flatutreexoproofindex"} 2
+# HELP utreexod_utreexo_flush_duration_seconds_total Cumulative time spent flushing the utreexo state to disk.
+# TYPE utreexod_utreexo_flush_duration_seconds_total counter
+utreexod_utreexo_flush_duration_seconds_total{index="flatutreexoproofindex"} 3
+# HELP utreexod_utreexo_last_flush_duration_seconds Time spent on the last flush of the utreexo state.
+# TYPE utreexod_utreexo_last_flush_duration_seconds gauge
+utreexod_utreexo_last_flush_duration_seconds{index="flatutreexoproofindex"} 0.5
+# HELP utreexod_utreexo_num_leaves Number of leaves that were ever added to the accumulator.
+# TYPE utreexod_utreexo_num_leaves gauge
+utreexod_utreexo_num_leaves{index="flatutreexoproofindex"} 12
+# HELP utreexod_utreexo_num_roots Number of roots in the accumulator.
+# TYPE utreexod_utreexo_num_roots gauge
+utreexod_utreexo_num_roots{index="flatutreexoproofindex"} 2
+# HELP utreexod_utreexo_db_compaction_debt_bytes Estimated bytes that need to be compacted for the database to reach a stable state.
+# TYPE utreexod_utreexo_db_compaction_debt_bytes gauge
+utreexod_utreexo_db_compaction_debt_bytes{index="flatutreexoproofindex"} 1024
+# HELP utreexod_utreexo_cachedleaves_garbage_ratio Estimated share of the cached leaves entries in the database that are garbage.
+# TYPE utreexod_utreexo_cachedleaves_garbage_ratio gauge
+utreexod_utreexo_cachedleaves_garbage_ratio{index="flatutreexoproofindex"} 0.25
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"utreexod_utreexo_cache_hits_total",
+		"utreexod_utreexo_cache_misses_total",
+		"utreexod_utreexo_flushes_total",
+		"utreexod_utreexo_flush_duration_seconds_total",
+		"utreexod_utreexo_last_flush_duration_seconds",
+		"utreexod_utreexo_num_leaves",
+		"utreexod_utreexo_num_roots",
+		"utreexod_utreexo_db_compaction_debt_bytes",
+		"utreexod_utreexo_cachedleaves_garbage_ratio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every metric should be reported for all three caches or once per
+	// index.
+	count := testutil.CollectAndCount(collector)
+	if count != 22 {
+		t.Fatalf("expected 22 metrics, got %d", count)
+	}
+}
+
+func TestMetricsServerListenFailure(t *testing.T) {
+	// Occupy a port so that the metrics server can't listen on it.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	_, err = newMetricsServer(listener.Addr().String())
+	if err == nil {
+		t.Fatalf("expected an error when the address is already in use")
+	}
+
+	m, err := newMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.listener.Close()
+}
@@ -545,6 +545,27 @@ func (m *CPUMiner) NumWorkers() int32 {
 // generating a new block template.  When a block is solved, it is submitted.
 // The function returns a list of the hashes of generated blocks.
 func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(n, func(uint32) btcutil.Address {
+		// Choose a payment address at random.
+		rand.Seed(time.Now().UnixNano())
+		return m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+	})
+}
+
+// GenerateBlocksTo generates a block for each of the given addresses in order
+// with the coinbase of each block paying to its address.  It works the same way
+// as GenerateNBlocks otherwise.
+func (m *CPUMiner) GenerateBlocksTo(payToAddrs []btcutil.Address) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(uint32(len(payToAddrs)), func(i uint32) btcutil.Address {
+		return payToAddrs[i]
+	})
+}
+
+// generateNBlocks generates the requested number of blocks with the coinbase
+// of the i-th block paying to the address returned by payTo for i.
+func (m *CPUMiner) generateNBlocks(n uint32,
+	payTo func(i uint32) btcutil.Address) ([]*chainhash.Hash, error) {
+
 	m.Lock()
 
 	// Respond with an error if server is already mining.
@@ -588,9 +609,7 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		m.submitBlockLock.Lock()
 		curHeight := m.g.BestSnapshot().Height
 
-		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		payToAddr := payTo(i)
 
 		// Create a new block template using the available transactions
 		// in the memory pool as a source of transactions to potentially
@@ -627,6 +646,80 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 	}
 }
 
+// GenerateBlock generates a block with the coinbase paying to the passed
+// address followed by the passed transactions in the given order instead of the
+// transactions in the memory pool.  It returns an error when the block can't
+// be created or isn't accepted by the chain.  Like GenerateNBlocks, it can't be
+// called while the server is already CPU mining.
+func (m *CPUMiner) GenerateBlock(payToAddr btcutil.Address,
+	txs []*btcutil.Tx) (*chainhash.Hash, error) {
+
+	m.Lock()
+
+	// Respond with an error if server is already mining.
+	if m.started || m.discreteMining {
+		m.Unlock()
+		return nil, errors.New("Server is already CPU mining. Please call " +
+			"`setgenerate 0` before calling discrete `generateblock` commands.")
+	}
+
+	m.started = true
+	m.discreteMining = true
+
+	m.speedMonitorQuit = make(chan struct{})
+	m.wg.Add(1)
+	go m.speedMonitor()
+
+	m.Unlock()
+
+	defer func() {
+		m.Lock()
+		close(m.speedMonitorQuit)
+		m.wg.Wait()
+		m.started = false
+		m.discreteMining = false
+		m.Unlock()
+	}()
+
+	log.Tracef("Generating a block with %d transactions", len(txs))
+
+	// Start a ticker which is used to signal checks for stale work and
+	// updates to the speed monitor.
+	ticker := time.NewTicker(time.Second * hashUpdateSecs)
+	defer ticker.Stop()
+
+	for {
+		// Read updateNumWorkers in case someone tries a `setgenerate` while
+		// we're generating.
+		select {
+		case <-m.updateNumWorkers:
+		default:
+		}
+
+		m.submitBlockLock.Lock()
+		curHeight := m.g.BestSnapshot().Height
+		template, err := m.g.NewBlockTemplateWithTxs(payToAddr, txs)
+		m.submitBlockLock.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new block "+
+				"template: %v", err)
+		}
+
+		// The template is generated again when the block goes stale
+		// before it's solved.
+		if !m.solveBlock(template.Block, curHeight+1, ticker, nil) {
+			continue
+		}
+		block := btcutil.NewBlock(template.Block)
+		if !m.submitBlock(block) {
+			return nil, fmt.Errorf("block %v was not accepted",
+				block.Hash())
+		}
+
+		return block.Hash(), nil
+	}
+}
+
 // New returns a new instance of a CPU miner for the provided configuration.
 // Use Start to begin the mining process.  See the documentation for CPUMiner
 // type for more details.
@@ -413,6 +413,7 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+	proveBlock  func(*btcutil.Block) (*wire.UData, error)
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -421,11 +422,17 @@ type BlkTmplGenerator struct {
 // The additional state-related fields are required in order to ensure the
 // templates are built on top of the current best chain and adhere to the
 // consensus rules.
+//
+// The proveBlock function, when not nil, generates the utreexo proof of the
+// outputs spent by a block.  The proof is attached to the generated templates
+// so that they're checked against the accumulator on nodes that keep it and so
+// that the mined blocks can be served to nodes that need it.
 func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 	txSource TxSource, chain *blockchain.BlockChain,
 	timeSource blockchain.MedianTimeSource,
 	sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) *BlkTmplGenerator {
+	hashCache *txscript.HashCache,
+	proveBlock func(*btcutil.Block) (*wire.UData, error)) *BlkTmplGenerator {
 
 	return &BlkTmplGenerator{
 		policy:      policy,
@@ -435,6 +442,7 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 		timeSource:  timeSource,
 		sigCache:    sigCache,
 		hashCache:   hashCache,
+		proveBlock:  proveBlock,
 	}
 }
 
@@ -860,50 +868,33 @@ mempoolLoop:
 
 	// If segwit is active and we included transactions with witness data,
 	// then we'll need to include a commitment to the witness data in an
-	// OP_RETURN output within the coinbase transaction.
+	// OP_RETURN output within the coinbase transaction.  Blocks on signet
+	// networks always need one as it holds their solution.
 	var witnessCommitment []byte
-	if witnessIncluded {
+	if witnessIncluded || g.chainParams.SignetChallenge != nil {
 		witnessCommitment = AddWitnessCommitment(coinbaseTx, blockTxns)
 	}
 
-	// Calculate the required difficulty for the block.  The timestamp
-	// is potentially adjusted to ensure it comes after the median time of
-	// the last several blocks per the chain consensus rules.
-	ts := medianAdjustedTime(best, g.timeSource)
-	reqDifficulty, err := g.chain.CalcNextRequiredDifficulty(ts)
-	if err != nil {
-		return nil, err
-	}
-
-	// Calculate the next expected block version based on the state of the
-	// rule change deployments.
-	nextBlockVersion, err := g.chain.CalcNextBlockVersion()
-	if err != nil {
-		return nil, err
-	}
-
 	// Create a new block ready to be solved.
-	merkles := blockchain.BuildMerkleTreeStore(blockTxns, false)
 	var msgBlock wire.MsgBlock
-	msgBlock.Header = wire.BlockHeader{
-		Version:    nextBlockVersion,
-		PrevBlock:  best.Hash,
-		MerkleRoot: *merkles[len(merkles)-1],
-		Timestamp:  ts,
-		Bits:       reqDifficulty,
-	}
 	for _, tx := range blockTxns {
 		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
 			return nil, err
 		}
 	}
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(nextBlockHeight)
+	if g.proveBlock != nil {
+		msgBlock.UData, err = g.proveBlock(block)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Finally, perform a full check on the created block against the chain
 	// consensus rules to ensure it properly connects to the current best
 	// chain with no issues.
-	block := btcutil.NewBlock(&msgBlock)
-	block.SetHeight(nextBlockHeight)
-	if err := g.chain.CheckConnectBlockTemplate(block); err != nil {
+	if err := g.finishBlock(best, &msgBlock); err != nil {
 		return nil, err
 	}
 
@@ -922,6 +913,151 @@ mempoolLoop:
 	}, nil
 }
 
+// NewBlockTemplateWithTxs returns a new block template that is ready to be
+// solved with the passed transactions, in the given order, after a coinbase
+// that pays to the passed address along with the fees of the transactions.
+// Unlike NewBlockTemplate, the transactions don't need to be in the source pool
+// and none of the mining policy is applied to them: the block only has to pass
+// the consensus rules.
+//
+// The outputs spent by the transactions are taken from the utreexo proof of
+// the block when the generator proves blocks and from the utxo set otherwise.
+func (g *BlkTmplGenerator) NewBlockTemplateWithTxs(payToAddress btcutil.Address,
+	txs []*btcutil.Tx) (*BlockTemplate, error) {
+
+	best := g.chain.BestSnapshot()
+	nextBlockHeight := best.Height + 1
+
+	coinbaseScript, err := standardCoinbaseScript(nextBlockHeight, 0)
+	if err != nil {
+		return nil, err
+	}
+	coinbaseTx, err := createCoinbaseTx(g.chainParams, coinbaseScript,
+		nextBlockHeight, payToAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgBlock wire.MsgBlock
+	blockTxns := append([]*btcutil.Tx{coinbaseTx}, txs...)
+	for _, tx := range blockTxns {
+		if err := msgBlock.AddTransaction(tx.MsgTx()); err != nil {
+			return nil, err
+		}
+	}
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(nextBlockHeight)
+
+	blockUtxos := blockchain.NewUtxoViewpoint()
+	if g.proveBlock != nil {
+		msgBlock.UData, err = g.proveBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if err := blockUtxos.BlockToUtxoView(block); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, tx := range txs {
+			utxos, err := g.chain.FetchUtxoView(tx)
+			if err != nil {
+				return nil, err
+			}
+			mergeUtxoView(blockUtxos, utxos)
+		}
+	}
+
+	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
+	if err != nil {
+		return nil, err
+	}
+	segwitActive := segwitState == blockchain.ThresholdActive
+
+	txFees := make([]int64, 1, len(blockTxns))
+	txSigOpCosts := make([]int64, 1, len(blockTxns))
+	txSigOpCosts[0] = int64(blockchain.CountSigOps(coinbaseTx)) *
+		blockchain.WitnessScaleFactor
+	var totalFees int64
+	var witnessIncluded bool
+	for _, tx := range txs {
+		fee, err := blockchain.CheckTransactionInputs(tx,
+			nextBlockHeight, blockUtxos, g.chainParams)
+		if err != nil {
+			return nil, err
+		}
+		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
+			blockUtxos, true, segwitActive)
+		if err != nil {
+			return nil, err
+		}
+		spendTransaction(blockUtxos, tx, nextBlockHeight)
+
+		totalFees += fee
+		txFees = append(txFees, fee)
+		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
+		witnessIncluded = witnessIncluded || tx.HasWitness()
+	}
+	coinbaseTx.MsgTx().TxOut[0].Value += totalFees
+	txFees[0] = -totalFees
+
+	var witnessCommitment []byte
+	if witnessIncluded || g.chainParams.SignetChallenge != nil {
+		witnessCommitment = AddWitnessCommitment(coinbaseTx, blockTxns)
+	}
+
+	if err := g.finishBlock(best, &msgBlock); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Created new block template with %d given transactions "+
+		"(%d in fees)", len(txs), totalFees)
+
+	return &BlockTemplate{
+		Block:             &msgBlock,
+		Fees:              txFees,
+		SigOpCosts:        txSigOpCosts,
+		Height:            nextBlockHeight,
+		ValidPayAddress:   payToAddress != nil,
+		WitnessCommitment: witnessCommitment,
+	}, nil
+}
+
+// finishBlock fills in the header of the passed block so that it extends the
+// passed best block and checks the block against the consensus rules to ensure
+// it properly connects to the current best chain with no issues.
+func (g *BlkTmplGenerator) finishBlock(best *blockchain.BestState,
+	msgBlock *wire.MsgBlock) error {
+
+	// Calculate the required difficulty for the block.  The timestamp
+	// is potentially adjusted to ensure it comes after the median time of
+	// the last several blocks per the chain consensus rules.
+	ts := medianAdjustedTime(best, g.timeSource)
+	reqDifficulty, err := g.chain.CalcNextRequiredDifficulty(ts)
+	if err != nil {
+		return err
+	}
+
+	// Calculate the next expected block version based on the state of the
+	// rule change deployments.
+	nextBlockVersion, err := g.chain.CalcNextBlockVersion()
+	if err != nil {
+		return err
+	}
+
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(best.Height + 1)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header = wire.BlockHeader{
+		Version:    nextBlockVersion,
+		PrevBlock:  best.Hash,
+		MerkleRoot: *merkles[len(merkles)-1],
+		Timestamp:  ts,
+		Bits:       reqDifficulty,
+	}
+
+	return g.chain.CheckConnectBlockTemplate(block)
+}
+
 // AddWitnessCommitment adds the witness commitment as an OP_RETURN outpout
 // within the coinbase tx.  The raw commitment is returned.
 func AddWitnessCommitment(coinbaseTx *btcutil.Tx,
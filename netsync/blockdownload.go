@@ -0,0 +1,339 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	peerpkg "github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// initialDownloadWindow is how many blocks along with their utreexo
+	// proofs a peer is asked for at a time when it starts serving them.
+	initialDownloadWindow = 4
+
+	// maxDownloadWindow is the most blocks along with their utreexo proofs
+	// a peer is asked for at a time.  A peer's window grows by one with
+	// every block it delivers and is halved when it times out.
+	maxDownloadWindow = 16
+
+	// blockDownloadLookahead is how far past the tip blocks are requested.
+	// Blocks that arrive before their parent are held in memory until they
+	// can be connected so this bounds how many pile up behind a slow peer.
+	blockDownloadLookahead = 1024
+
+	// blockDownloadTimeout is how long a peer has to deliver a block and its
+	// proof before they're requested from another peer.
+	blockDownloadTimeout = time.Minute
+)
+
+// blockDownload is a block requested along with its utreexo proof from a peer
+// while downloading blocks from multiple peers.
+type blockDownload struct {
+	height    int32
+	peer      *peerpkg.Peer
+	requested time.Time
+	gotBlock  bool
+	gotProof  bool
+}
+
+// delivered returns whether both the block and its proof were received.
+func (d *blockDownload) delivered() bool {
+	return d.gotBlock && d.gotProof
+}
+
+// downloadPeer is a peer blocks are downloaded from along with how many more
+// blocks it can be asked for.
+type downloadPeer struct {
+	peer        *peerpkg.Peer
+	lastBlock   int32
+	free        int
+	proofSource bool
+}
+
+// nextDownloadPeer returns the index of the peer to request the block at the
+// given height from by going around the peers starting at next.  -1 is
+// returned if none of the peers has both the block and room for it.
+func nextDownloadPeer(peers []downloadPeer, height int32, next int) int {
+	for i := 0; i < len(peers); i++ {
+		idx := (next + i) % len(peers)
+		if peers[idx].free > 0 && peers[idx].lastBlock >= height {
+			return idx
+		}
+	}
+	return -1
+}
+
+// parallelDownload returns whether blocks are downloaded along with their
+// utreexo proofs from all the peers that serve them instead of only the sync
+// peer.  This is done by CSNs during the initial block download.
+func (sm *SyncManager) parallelDownload() bool {
+	return sm.headersFirstMode && sm.chain.IsUtreexoViewActive()
+}
+
+// downloadPeers returns the connected sync candidates that serve blocks along
+// with their utreexo proofs.  The pinned proof sources come first and the rest
+// are ordered from the most to the least reliable.
+func (sm *SyncManager) downloadPeers() []downloadPeer {
+	peers := make([]downloadPeer, 0, len(sm.peerStates))
+	for peer, state := range sm.peerStates {
+		if !state.syncCandidate || !peer.IsUtreexoEnabled() ||
+			!peer.Connected() {
+
+			continue
+		}
+
+		lastBlock := peer.LastBlock()
+		if startHeight := peer.StartingHeight(); startHeight > lastBlock {
+			lastBlock = startHeight
+		}
+		peers = append(peers, downloadPeer{
+			peer:        peer,
+			lastBlock:   lastBlock,
+			free:        state.downloadWindow - state.blocksInFlight,
+			proofSource: state.proofSource,
+		})
+	}
+
+	// The blocks closest to the tip hold up the download the most so they
+	// go to the pinned proof sources and then to the most reliable peers
+	// first.
+	sm.reputations.sortDownloadPeers(peers)
+	sortProofSourcesFirst(peers)
+	return peers
+}
+
+// blockInvType returns the inventory type to ask the peer for blocks with so
+// that the witnesses and utreexo proofs it can serve are sent along.
+func blockInvType(peer *peerpkg.Peer) wire.InvType {
+	switch {
+	case peer.IsWitnessEnabled() && peer.IsUtreexoEnabled():
+		return wire.InvTypeWitnessUtreexoBlock
+	case peer.IsWitnessEnabled():
+		return wire.InvTypeWitnessBlock
+	case peer.IsUtreexoEnabled():
+		return wire.InvTypeUtreexoBlock
+	}
+	return wire.InvTypeBlock
+}
+
+// scheduleBlockDownloads spreads the requests for the blocks past the tip and
+// their utreexo proofs over the peers that serve them.  Each peer is only
+// asked for as many blocks at a time as its download window allows.
+func (sm *SyncManager) scheduleBlockDownloads() {
+	peers := sm.downloadPeers()
+	var free int
+	for _, peer := range peers {
+		if peer.free > 0 {
+			free += peer.free
+		}
+	}
+	if free == 0 {
+		return
+	}
+
+	best := sm.chain.BestSnapshot()
+	_, bestHeaderHeight := sm.chain.BestHeader()
+	lastHeight := best.Height + blockDownloadLookahead
+	if lastHeight > bestHeaderHeight {
+		lastHeight = bestHeaderHeight
+	}
+
+	gdmsgs := make(map[*peerpkg.Peer]*wire.MsgGetData, len(peers))
+	next := 0
+	for h := best.Height + 1; h <= lastHeight; h++ {
+		hash, err := sm.chain.HeaderHashByHeight(h)
+		if err != nil {
+			log.Warnf("error while fetching the block hash for height %v -- %v",
+				h, err)
+			break
+		}
+
+		// Keep track of the numleaves to construct the proof requests.
+		summary, found := sm.utreexoSummaries[*hash]
+		if !found {
+			log.Debugf("couldn't find block summary for %v", hash)
+			sm.fetchUtreexoSummaries(nil)
+			break
+		}
+		sm.numLeaves[h] = sm.numLeaves[h-1] + uint64(summary.NumAdds)
+
+		// The blocks past the tip are either requested already or not
+		// had at all so there's no need to look for them in the database.
+		if _, requested := sm.blockDownloads[*hash]; requested {
+			continue
+		}
+
+		// The peers are gone around so that the blocks close to the tip
+		// are spread over all of them.  Since the blocks are gone through
+		// by height, none of the peers has room for or knows of the later
+		// blocks either once none is found.
+		idx := nextDownloadPeer(peers, h, next)
+		if idx < 0 {
+			break
+		}
+		next = idx + 1
+		peers[idx].free--
+
+		peer := peers[idx].peer
+		prevHash, err := sm.chain.HeaderHashByHeight(h - 1)
+		if err != nil {
+			log.Warnf("error while fetching the block hash for height %v -- %v",
+				h-1, err)
+			break
+		}
+
+		state := sm.peerStates[peer]
+		state.requestedBlocks[*hash] = struct{}{}
+		state.requestedUtreexoProofs[*hash] = struct{}{}
+		state.blocksInFlight++
+		sm.blockDownloads[*hash] = &blockDownload{
+			height:    h,
+			peer:      peer,
+			requested: time.Now(),
+		}
+
+		gdmsg, ok := gdmsgs[peer]
+		if !ok {
+			gdmsg = wire.NewMsgGetData()
+			gdmsgs[peer] = gdmsg
+		}
+		gdmsg.AddInvVect(wire.NewInvVect(blockInvType(peer), hash))
+
+		peer.QueueMessage(sm.constructGetProofMsg(hash, prevHash,
+			sm.numLeaves[h-1], summary.BlockTargets), nil)
+	}
+
+	for peer, gdmsg := range gdmsgs {
+		log.Debugf("Requesting %d blocks from %s", len(gdmsg.InvList), peer)
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// blockDownloadReceived records that the block or its utreexo proof arrived.
+// The peer the block was requested from gets room for another block once it
+// delivered both.
+func (sm *SyncManager) blockDownloadReceived(hash *chainhash.Hash,
+	peer *peerpkg.Peer, isProof bool) {
+
+	download, found := sm.blockDownloads[*hash]
+	if !found || download.delivered() {
+		return
+	}
+	if isProof {
+		download.gotProof = true
+	} else {
+		download.gotBlock = true
+	}
+	if !download.delivered() {
+		return
+	}
+
+	state, exists := sm.peerStates[download.peer]
+	if !exists {
+		return
+	}
+	state.blocksInFlight--
+	if download.peer == peer {
+		sm.reputations.delivered(peer, time.Since(download.requested))
+		if state.downloadWindow < maxDownloadWindow {
+			state.downloadWindow++
+		}
+	}
+}
+
+// connectQueuedBlocks processes the blocks that arrived before their parent
+// was connected for as long as the block after the tip and its utreexo proof
+// are both there.
+func (sm *SyncManager) connectQueuedBlocks() {
+	for sm.parallelDownload() {
+		best := sm.chain.BestSnapshot()
+		hash, err := sm.chain.HeaderHashByHeight(best.Height + 1)
+		if err != nil {
+			return
+		}
+		bmsg, found := sm.queuedBlocks[*hash]
+		if !found {
+			return
+		}
+		if _, found := sm.queuedUtreexoProofs[*hash]; !found {
+			return
+		}
+
+		sm.handleBlockMsg(bmsg)
+		if sm.chain.BestSnapshot().Height == best.Height {
+			return
+		}
+	}
+}
+
+// expireBlockDownloads requests the blocks that weren't delivered in time from
+// other peers and shrinks the download window of the peers that were too
+// slow.  A peer that's holding up the block after the tip is disconnected if
+// there are others to download from.
+func (sm *SyncManager) expireBlockDownloads() {
+	if !sm.parallelDownload() {
+		return
+	}
+
+	best := sm.chain.BestSnapshot()
+	var expired bool
+	for hash, download := range sm.blockDownloads {
+		if download.delivered() ||
+			time.Since(download.requested) <= blockDownloadTimeout {
+
+			continue
+		}
+
+		expired = true
+		delete(sm.blockDownloads, hash)
+		sm.reputations.timedOut(download.peer)
+		state, exists := sm.peerStates[download.peer]
+		if !exists {
+			continue
+		}
+		state.blocksInFlight--
+		state.downloadWindow /= 2
+		if state.downloadWindow < 1 {
+			state.downloadWindow = 1
+		}
+
+		if download.height == best.Height+1 && len(sm.downloadPeers()) > 1 {
+			log.Infof("Peer %s stalled the download of block %v(%d) "+
+				"-- disconnecting", download.peer, hash, download.height)
+			download.peer.Disconnect()
+			continue
+		}
+		log.Debugf("Timed out waiting on block %v(%d) from %s", hash,
+			download.height, download.peer)
+	}
+
+	if expired {
+		sm.scheduleBlockDownloads()
+	}
+}
+
+// releaseBlockDownloads drops the blocks requested from the peer that haven't
+// been connected yet so that they're requested from the other peers.
+func (sm *SyncManager) releaseBlockDownloads(peer *peerpkg.Peer) {
+	for hash, download := range sm.blockDownloads {
+		if download.peer == peer && !download.delivered() {
+			delete(sm.blockDownloads, hash)
+		}
+	}
+	for hash, bmsg := range sm.queuedBlocks {
+		if bmsg.peer == peer {
+			delete(sm.queuedBlocks, hash)
+			delete(sm.blockDownloads, hash)
+		}
+	}
+
+	if sm.parallelDownload() {
+		sm.scheduleBlockDownloads()
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+)
+
+func TestNextDownloadPeer(t *testing.T) {
+	peers := []downloadPeer{
+		{lastBlock: 100, free: 2},
+		{lastBlock: 50, free: 1},
+		{lastBlock: 100, free: 0},
+	}
+
+	tests := []struct {
+		name   string
+		height int32
+		next   int
+		want   int
+	}{
+		{
+			name:   "first peer",
+			height: 10,
+			next:   0,
+			want:   0,
+		},
+		{
+			name:   "next peer",
+			height: 10,
+			next:   1,
+			want:   1,
+		},
+		{
+			name:   "full peer skipped",
+			height: 10,
+			next:   2,
+			want:   0,
+		},
+		{
+			name:   "peer without the block skipped",
+			height: 60,
+			next:   1,
+			want:   0,
+		},
+		{
+			name:   "no peer has the block",
+			height: 101,
+			next:   0,
+			want:   -1,
+		},
+	}
+	for _, test := range tests {
+		got := nextDownloadPeer(peers, test.height, test.next)
+		if got != test.want {
+			t.Errorf("%s: got peer %d, want %d", test.name, got,
+				test.want)
+		}
+	}
+
+	// Spreading the blocks over the peers goes around them until all their
+	// windows are full.
+	var got []int
+	next := 0
+	for h := int32(1); ; h++ {
+		idx := nextDownloadPeer(peers, h, next)
+		if idx < 0 {
+			break
+		}
+		peers[idx].free--
+		next = idx + 1
+		got = append(got, idx)
+	}
+	if len(got) != 3 || got[0] != 0 || got[1] != 1 || got[2] != 0 {
+		t.Fatalf("unexpected order of peers %v", got)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	peerpkg "github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// maxCmpctBlockWait is how long the missing transactions of a compact block are
+// waited on before the block is fetched with its summary and proof instead.
+const maxCmpctBlockWait = 10 * time.Second
+
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came from
+// together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *peerpkg.Peer
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *peerpkg.Peer
+}
+
+// pendingCmpctBlock is a compact block that's missing transactions that were
+// asked for from the peer that sent it.
+type pendingCmpctBlock struct {
+	peer *peerpkg.Peer
+	msg  *wire.MsgCmpctBlock
+
+	// txs are the transactions of the block with the missing ones left nil
+	// and missing are their indexes.
+	txs     []*wire.MsgTx
+	missing []uint32
+
+	requested time.Time
+}
+
+// fillCmpctBlock returns the transactions of the compact block that are either
+// prefilled or among the given transactions along with the indexes of the ones
+// that are missing.  Transactions whose short ids collide with another one are
+// left missing.  False is returned if the short ids of the message itself
+// collide as the block then can't be put together from them.
+func fillCmpctBlock(msg *wire.MsgCmpctBlock, txs []*btcutil.Tx) (
+	[]*wire.MsgTx, []uint32, bool) {
+
+	blockTxs := make([]*wire.MsgTx, msg.TxCount())
+	for _, prefilled := range msg.PrefilledTxs {
+		blockTxs[prefilled.Index] = prefilled.Tx
+	}
+
+	// The short ids take up the indexes that aren't prefilled in order.
+	indexes := make(map[uint64]int, len(msg.ShortIDs))
+	next := 0
+	for _, shortID := range msg.ShortIDs {
+		for blockTxs[next] != nil {
+			next++
+		}
+		if _, exists := indexes[shortID]; exists {
+			return nil, nil, false
+		}
+		indexes[shortID] = next
+		next++
+	}
+
+	key := msg.ShortIDKey()
+	collided := make(map[int]struct{})
+	for _, tx := range txs {
+		shortID := wire.ShortTxID(&key, tx.WitnessHash())
+		index, exists := indexes[shortID]
+		if !exists {
+			continue
+		}
+		if _, exists := collided[index]; exists {
+			continue
+		}
+		if blockTxs[index] != nil {
+			blockTxs[index] = nil
+			collided[index] = struct{}{}
+			continue
+		}
+		blockTxs[index] = tx.MsgTx()
+	}
+
+	var missing []uint32
+	for i, tx := range blockTxs {
+		if tx == nil {
+			missing = append(missing, uint32(i))
+		}
+	}
+
+	return blockTxs, missing, true
+}
+
+// fill puts the transactions of a blocktxn message in place of the missing
+// ones.
+func (p *pendingCmpctBlock) fill(txs []*wire.MsgTx) error {
+	if len(txs) != len(p.missing) {
+		return fmt.Errorf("got %d transactions for the %d missing ones",
+			len(txs), len(p.missing))
+	}
+	for i, index := range p.missing {
+		p.txs[index] = txs[i]
+	}
+	p.missing = nil
+
+	return nil
+}
+
+// block returns the block put together from the compact block along with the
+// utreexo proof sent with it.  An error is returned if the transactions don't
+// match the merkle root of the header, which happens when a transaction from
+// the mempool had the short id of another one.
+func (p *pendingCmpctBlock) block() (*btcutil.Block, error) {
+	msgBlock := &wire.MsgBlock{
+		Header:       p.msg.Header,
+		Transactions: p.txs,
+		UData:        p.msg.UData,
+	}
+	block := btcutil.NewBlock(msgBlock)
+
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	merkleRoot := merkles[len(merkles)-1]
+	if !merkleRoot.IsEqual(&msgBlock.Header.MerkleRoot) {
+		return nil, fmt.Errorf("transactions have the merkle root %v "+
+			"instead of %v", merkleRoot, msgBlock.Header.MerkleRoot)
+	}
+
+	return block, nil
+}
+
+// handleCmpctBlockMsg puts together the block of a compact block from the
+// transactions in the mempool and asks the peer for the ones that are missing.
+// The block is fetched with its summary and proof like any other when it
+// doesn't extend the tip or the compact block can't be used.
+func (sm *SyncManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	peer := cmsg.peer
+	if _, exists := sm.peerStates[peer]; !exists {
+		log.Warnf("Received compact block message from unknown peer %s", peer)
+		return
+	}
+
+	// Only utreexo nodes ask for compact blocks and the utreexo proof is
+	// needed to validate the block without the summary and proof.
+	msg := cmsg.cmpctBlock
+	blockHash := msg.Header.BlockHash()
+	if !sm.chain.IsUtreexoViewActive() || msg.UData == nil {
+		log.Debugf("Ignoring compact block %v without a utreexo proof "+
+			"from %s", blockHash, peer)
+		return
+	}
+
+	// Blocks coming in during the initial block download are fetched by
+	// the sync.
+	if sm.headersFirstMode || sm.headersBuildMode {
+		return
+	}
+
+	if _, exists := sm.pendingCmpctBlocks[blockHash]; exists {
+		return
+	}
+	haveInv, err := sm.haveInventory(wire.NewInvVect(wire.InvTypeBlock, &blockHash))
+	if err == nil && haveInv {
+		return
+	}
+
+	best := sm.chain.BestSnapshot()
+	if !best.Hash.IsEqual(&msg.Header.PrevBlock) {
+		log.Debugf("Compact block %v from %s doesn't extend the tip",
+			blockHash, peer)
+		sm.fetchCmpctBlockFallback(peer, &msg.Header)
+		return
+	}
+
+	_, err = sm.chain.ProcessBlockHeader(&msg.Header, blockchain.BFNone)
+	if err != nil {
+		log.Warnf("Received compact block %v from peer %v that failed "+
+			"header verification -- disconnecting", blockHash, peer)
+		peer.Disconnect()
+		return
+	}
+
+	txDescs := sm.txMemPool.TxDescs()
+	txs := make([]*btcutil.Tx, 0, len(txDescs))
+	for _, txDesc := range txDescs {
+		txs = append(txs, txDesc.Tx)
+	}
+	blockTxs, missing, ok := fillCmpctBlock(msg, txs)
+	if !ok {
+		log.Debugf("Short ids of compact block %v from %s collide",
+			blockHash, peer)
+		sm.fetchCmpctBlockFallback(peer, &msg.Header)
+		return
+	}
+
+	pending := &pendingCmpctBlock{
+		peer:      peer,
+		msg:       msg,
+		txs:       blockTxs,
+		missing:   missing,
+		requested: time.Now(),
+	}
+	if len(missing) == 0 {
+		sm.finishCmpctBlock(pending)
+		return
+	}
+
+	log.Debugf("Requesting %d of the %d transactions of compact block "+
+		"%v from %s", len(missing), len(blockTxs), blockHash, peer)
+	sm.pendingCmpctBlocks[blockHash] = pending
+	peer.QueueMessage(wire.NewMsgGetBlockTxn(&blockHash, missing), nil)
+}
+
+// handleBlockTxnMsg finishes putting together the compact block the
+// transactions of the blocktxn message were asked for.
+func (sm *SyncManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	peer := bmsg.peer
+	if _, exists := sm.peerStates[peer]; !exists {
+		log.Warnf("Received blocktxn message from unknown peer %s", peer)
+		return
+	}
+
+	msg := bmsg.blockTxn
+	pending, exists := sm.pendingCmpctBlocks[msg.BlockHash]
+	if !exists || pending.peer != peer {
+		// The transactions may come in after having given up on
+		// them so they're ignored instead of disconnecting the peer.
+		log.Debugf("Ignoring unrequested transactions of block %v "+
+			"from %s", msg.BlockHash, peer)
+		return
+	}
+	delete(sm.pendingCmpctBlocks, msg.BlockHash)
+
+	err := pending.fill(msg.Txs)
+	if err != nil {
+		log.Warnf("Unable to fill compact block %v from %s: %v",
+			msg.BlockHash, peer, err)
+		sm.fetchCmpctBlockFallback(peer, &pending.msg.Header)
+		return
+	}
+
+	sm.finishCmpctBlock(pending)
+}
+
+// finishCmpctBlock processes the block of a compact block that has all of its
+// transactions.
+func (sm *SyncManager) finishCmpctBlock(pending *pendingCmpctBlock) {
+	peer := pending.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		return
+	}
+
+	blockHash := pending.msg.Header.BlockHash()
+	block, err := pending.block()
+	if err != nil {
+		log.Debugf("Unable to put together compact block %v from %s: %v",
+			blockHash, peer, err)
+		sm.fetchCmpctBlockFallback(peer, &pending.msg.Header)
+		return
+	}
+
+	// Another block may have been connected while the missing
+	// transactions were being waited on.
+	best := sm.chain.BestSnapshot()
+	if !best.Hash.IsEqual(&pending.msg.Header.PrevBlock) {
+		sm.fetchCmpctBlockFallback(peer, &pending.msg.Header)
+		return
+	}
+
+	state.requestedBlocks[blockHash] = struct{}{}
+	sm.requestedBlocks[blockHash] = struct{}{}
+	sm.handleBlockMsg(&blockMsg{block: block, peer: peer, cmpct: true})
+
+	// The block didn't come with a summary so keep track of the number of
+	// leaves for the proofs of the blocks after it.
+	best = sm.chain.BestSnapshot()
+	if best.Hash.IsEqual(&blockHash) {
+		sm.numLeaves[best.Height] = sm.chain.GetUtreexoView().NumLeaves()
+		if sm.bestSummariesHash.IsEqual(&pending.msg.Header.PrevBlock) {
+			sm.bestSummariesHash = blockHash
+		}
+	}
+}
+
+// fetchCmpctBlockFallback fetches the block of a compact block that couldn't be
+// used the same way as a block announced with its header.
+func (sm *SyncManager) fetchCmpctBlockFallback(peer *peerpkg.Peer,
+	header *wire.BlockHeader) {
+
+	// The headers in between are asked for when the parent isn't known.
+	if _, err := sm.chain.HeaderHeightByHash(header.PrevBlock); err != nil {
+		bestHash, _ := sm.chain.BestHeader()
+		locator := blockchain.BlockLocator([]*chainhash.Hash{&bestHash})
+		peer.PushGetHeadersMsg(locator, &zeroHash)
+		return
+	}
+
+	sm.handleHeadersMsg(&headersMsg{
+		headers: &wire.MsgHeaders{Headers: []*wire.BlockHeader{header}},
+		peer:    peer,
+	})
+}
+
+// expireCmpctBlocks fetches the blocks of the compact blocks whose missing
+// transactions weren't sent in time the same way as blocks announced with their
+// headers.  Compact blocks from disconnected peers are dropped.
+func (sm *SyncManager) expireCmpctBlocks() {
+	for blockHash, pending := range sm.pendingCmpctBlocks {
+		if _, exists := sm.peerStates[pending.peer]; !exists {
+			delete(sm.pendingCmpctBlocks, blockHash)
+			continue
+		}
+		if time.Since(pending.requested) <= maxCmpctBlockWait {
+			continue
+		}
+
+		log.Debugf("Timed out waiting on the transactions of compact "+
+			"block %v from %s", blockHash, pending.peer)
+		delete(sm.pendingCmpctBlocks, blockHash)
+		sm.fetchCmpctBlockFallback(pending.peer, &pending.msg.Header)
+	}
+}
+
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueCmpctBlock(cmpctBlock *wire.MsgCmpctBlock, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// compact blocks.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &cmpctBlockMsg{cmpctBlock: cmpctBlock, peer: peer}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block handling
+// queue.
+func (sm *SyncManager) QueueBlockTxn(blockTxn *wire.MsgBlockTxn, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// blocktxn messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &blockTxnMsg{blockTxn: blockTxn, peer: peer}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testCmpctBlock returns a block of a coinbase and a spend along with its
+// compact block.
+func testCmpctBlock() (*wire.MsgBlock, *wire.MsgCmpctBlock) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  []byte{0x51, 0x51},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(50, []byte{0x51}))
+
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash()},
+	})
+	spend.AddTxOut(wire.NewTxOut(40, []byte{0x51}))
+
+	block := &wire.MsgBlock{
+		Header:       wire.BlockHeader{Version: 1},
+		Transactions: []*wire.MsgTx{coinbase, spend},
+		UData:        &wire.UData{},
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		btcutil.NewBlock(block).Transactions(), false)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+
+	return block, wire.NewMsgCmpctBlock(block, 7)
+}
+
+func TestFillCmpctBlock(t *testing.T) {
+	block, msg := testCmpctBlock()
+	spend := btcutil.NewTx(block.Transactions[1])
+
+	// The spend is filled in from the given transactions.
+	txs, missing, ok := fillCmpctBlock(msg, []*btcutil.Tx{spend})
+	if !ok || len(missing) != 0 {
+		t.Fatalf("expected the block to be filled, got %v missing", missing)
+	}
+	pending := &pendingCmpctBlock{msg: msg, txs: txs}
+	got, err := pending.block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.MsgBlock(), block) {
+		t.Fatal("the block put together doesn't match the original")
+	}
+
+	// Without it the spend is missing and is filled in from a blocktxn
+	// message.
+	txs, missing, ok = fillCmpctBlock(msg, nil)
+	if !ok || !reflect.DeepEqual(missing, []uint32{1}) {
+		t.Fatalf("expected the spend to be missing, got %v", missing)
+	}
+	pending = &pendingCmpctBlock{msg: msg, txs: txs, missing: missing}
+	if err := pending.fill(nil); err == nil {
+		t.Fatal("expected an error for too few transactions")
+	}
+	if err := pending.fill([]*wire.MsgTx{block.Transactions[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pending.block(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong transaction is caught by the merkle root.
+	txs, missing, _ = fillCmpctBlock(msg, nil)
+	pending = &pendingCmpctBlock{msg: msg, txs: txs, missing: missing}
+	if err := pending.fill([]*wire.MsgTx{block.Transactions[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pending.block(); err == nil {
+		t.Fatal("expected an error for a merkle root mismatch")
+	}
+
+	// Short ids that collide within the message can't be used.
+	collide := *msg
+	collide.ShortIDs = []uint64{5, 5}
+	if _, _, ok := fillCmpctBlock(&collide, nil); ok {
+		t.Fatal("expected colliding short ids to be refused")
+	}
+}
@@ -37,5 +37,13 @@ type Config struct {
 	DisableCheckpoints bool
 	MaxPeers           int
 
+	// DataDir is the directory the reputations of the peers are kept in.
+	// They're only kept in memory when it's empty.
+	DataDir string
+
 	FeeEstimator *mempool.FeeEstimator
+
+	// SmartFeeEstimator is an optional smart fee estimator the confirmed
+	// transactions of the connected blocks are recorded into.
+	SmartFeeEstimator *mempool.SmartFeeEstimator
 }
@@ -7,7 +7,6 @@ package netsync
 import (
 	"bytes"
 	"crypto/sha256"
-	"math/rand"
 	"net"
 	"os"
 	"sync"
@@ -66,6 +65,10 @@ type blockMsg struct {
 	block *btcutil.Block
 	peer  *peerpkg.Peer
 	reply chan struct{}
+
+	// cmpct is set for blocks put together from a compact block.  They
+	// already have the utreexo proof that was sent along with it.
+	cmpct bool
 }
 
 // invMsg packages a bitcoin inv message and the peer it came from together
@@ -96,6 +99,13 @@ type utreexoProofMsg struct {
 	peer  *peerpkg.Peer
 }
 
+// utreexoRootMsg packages a bitcoin utreexo root message and the peer it came from
+// together so the block handler has access to that information.
+type utreexoRootMsg struct {
+	root *wire.MsgUtreexoRoot
+	peer *peerpkg.Peer
+}
+
 // notFoundMsg packages a bitcoin notfound message and the peer it came from
 // together so the block handler has access to that information.
 type notFoundMsg struct {
@@ -179,6 +189,18 @@ type peerSyncState struct {
 	requestedBlocks           map[chainhash.Hash]struct{}
 	requestedUtreexoSummaries map[chainhash.Hash]struct{}
 	requestedUtreexoProofs    map[chainhash.Hash]struct{}
+	prefetchedTxns            map[chainhash.Hash]struct{}
+
+	// blocksInFlight is how many of the blocks requested from the peer
+	// while downloading from multiple peers haven't been delivered along
+	// with their proofs.  The peer isn't asked for more than downloadWindow
+	// at a time.
+	blocksInFlight int
+	downloadWindow int
+
+	// proofSource is set for the proof sources the operator pinned the
+	// node to.  Blocks and their proofs are fetched from them first.
+	proofSource bool
 }
 
 // limitAdd is a helper function for maps that require a maximum limit by
@@ -223,11 +245,17 @@ type SyncManager struct {
 	requestedBlocks  map[chainhash.Hash]struct{}
 	syncPeer         *peerpkg.Peer
 	peerStates       map[*peerpkg.Peer]*peerSyncState
+	reputations      *peerReputations
 	lastProgressTime time.Time
 
 	// headersBuildMode downloads and builds the entire header index.
 	headersBuildMode bool
 
+	// assumeUtreexoRootHash is the block the roots of an assumed utreexo
+	// point given by the user were requested at.  It's nil until the roots
+	// are requested.
+	assumeUtreexoRootHash *chainhash.Hash
+
 	// The following fields are used for headers-first mode.
 	headersFirstMode    bool
 	startHeader         *headerNode
@@ -238,8 +266,28 @@ type SyncManager struct {
 	queuedBlocks        map[chainhash.Hash]*blockMsg
 	queuedUtreexoProofs map[chainhash.Hash]*utreexoProofMsg
 
+	// blockDownloads are the blocks past the tip that were requested along
+	// with their utreexo proofs from the peers that serve them while a CSN
+	// is downloading blocks from multiple peers.
+	blockDownloads map[chainhash.Hash]*blockDownload
+
+	// partialProofRequests are the utreexo proof requests where only the
+	// data that wasn't available locally was requested.
+	partialProofRequests map[chainhash.Hash]*partialProofRequest
+
+	// pendingCmpctBlocks are the compact blocks waiting on the
+	// transactions that were missing from the mempool.
+	pendingCmpctBlocks map[chainhash.Hash]*pendingCmpctBlock
+
+	// lastPrefetchHash is the last announced block that the proofs of the
+	// mempool transactions were prefetched for.
+	lastPrefetchHash chainhash.Hash
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
+
+	// An optional smart fee estimator.
+	smartFeeEstimator *mempool.SmartFeeEstimator
 }
 
 // findNextHeaderCheckpoint returns the next checkpoint after the passed height.
@@ -353,11 +401,8 @@ func (sm *SyncManager) startSync() {
 
 	// This means that there's extra headers that we need to download.
 	if len(higherHeaderPeers) > 0 {
-		var bestPeer *peerpkg.Peer
-		switch {
-		case len(higherHeaderPeers) > 0:
-			bestPeer = higherHeaderPeers[rand.Intn(len(higherHeaderPeers))]
-		}
+		bestPeer := sm.reputations.pick(
+			sm.preferProofSources(higherHeaderPeers))
 
 		sm.syncPeer = bestPeer
 
@@ -381,18 +426,17 @@ func (sm *SyncManager) startSync() {
 		return
 	}
 
-	// Pick randomly from the set of peers greater than our block height,
-	// falling back to a random peer of the same height if none are greater.
-	//
-	// TODO(conner): Use a better algorithm to ranking peers based on
-	// observed metrics and/or sync in parallel.
+	// Pick from the set of peers greater than our block height, falling
+	// back to a peer of the same height if none are greater.  The pinned
+	// proof sources are picked over the others and peers that have been
+	// reliable before are more likely to be picked.
 	var bestPeer *peerpkg.Peer
 	switch {
 	case len(higherPeers) > 0:
-		bestPeer = higherPeers[rand.Intn(len(higherPeers))]
+		bestPeer = sm.reputations.pick(sm.preferProofSources(higherPeers))
 
 	case len(equalPeers) > 0:
-		bestPeer = equalPeers[rand.Intn(len(equalPeers))]
+		bestPeer = sm.reputations.pick(sm.preferProofSources(equalPeers))
 	}
 
 	// Start syncing from the best peer if one was selected.
@@ -486,6 +530,23 @@ func (sm *SyncManager) isSyncCandidate(peer *peerpkg.Peer) bool {
 		prunedNode   = nodeServices.HasFlag(wire.SFNodeNetworkLimited)
 	)
 
+	// Other compact state nodes don't have any proofs to serve and bridges
+	// that only keep the proofs of the recent blocks can't serve the ones
+	// further back.  Bridges that don't signal either are from before these
+	// services and are assumed to keep all of them.
+	if utreexoViewActive {
+		if nodeServices.HasFlag(wire.SFNodeUtreexoCSN) {
+			return false
+		}
+		if nodeServices.HasFlag(wire.SFNodeUtreexoRecent) &&
+			!nodeServices.HasFlag(wire.SFNodeUtreexoArchive) &&
+			sm.chain.BestSnapshot().Height+1 <=
+				peer.LastBlock()-wire.NodeNetworkLimitedBlockThreshold {
+
+			return false
+		}
+	}
+
 	switch {
 	case fullNode:
 		// Node is a sync candidate if it has all the blocks.
@@ -526,6 +587,7 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 	}
 
 	log.Infof("New valid peer %s (%s)", peer, peer.UserAgent())
+	sm.reputations.connected(peer, time.Now())
 
 	// Initialize the peer state.
 	isSyncCandidate := sm.isSyncCandidate(peer)
@@ -535,12 +597,27 @@ func (sm *SyncManager) handleNewPeerMsg(peer *peerpkg.Peer) {
 		requestedBlocks:           make(map[chainhash.Hash]struct{}),
 		requestedUtreexoSummaries: make(map[chainhash.Hash]struct{}),
 		requestedUtreexoProofs:    make(map[chainhash.Hash]struct{}),
+		prefetchedTxns:            make(map[chainhash.Hash]struct{}),
+		downloadWindow:            initialDownloadWindow,
+	}
+
+	// Ask the new peer for the roots of the assumed utreexo point as well
+	// if they haven't been received yet.
+	if sm.headersBuildMode && sm.assumeUtreexoRootHash != nil &&
+		peer.IsUtreexoEnabled() {
+
+		peer.QueueMessage(wire.NewMsgGetUtreexoRoot(*sm.assumeUtreexoRootHash), nil)
 	}
 
 	// Start syncing by choosing the best candidate if needed.
 	if isSyncCandidate && sm.syncPeer == nil {
 		sm.startSync()
 	}
+
+	// Download blocks from the new peer as well if it serves them.
+	if isSyncCandidate && sm.parallelDownload() {
+		sm.scheduleBlockDownloads()
+	}
 }
 
 // handleStallSample will switch to a new sync peer if the current one has
@@ -552,6 +629,9 @@ func (sm *SyncManager) handleStallSample() {
 		return
 	}
 
+	sm.expireCmpctBlocks()
+	sm.expireBlockDownloads()
+
 	// If we don't have an active sync peer, exit early.
 	if sm.syncPeer == nil {
 		return
@@ -569,6 +649,7 @@ func (sm *SyncManager) handleStallSample() {
 	}
 
 	sm.clearRequestedState(state)
+	sm.reputations.timedOut(sm.syncPeer)
 
 	disconnectSyncPeer := sm.shouldDCStalledSyncPeer()
 	sm.updateSyncPeer(disconnectSyncPeer)
@@ -609,10 +690,12 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 
 	// Remove the peer from the list of candidate peers.
 	delete(sm.peerStates, peer)
+	sm.reputations.disconnected(peer, time.Now())
 
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	sm.releaseBlockDownloads(peer)
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
@@ -678,6 +761,14 @@ func (sm *SyncManager) handleTxMsg(tx *btcutil.Tx, peer *peerpkg.Peer, utreexoDa
 	// interoperability.
 	txHash := tx.Hash()
 
+	// The transactions whose proofs were prefetched are already in the
+	// mempool so only their proofs are of interest.
+	if _, exists = state.prefetchedTxns[*txHash]; exists {
+		delete(state.prefetchedTxns, *txHash)
+		sm.ingestPrefetchedProof(tx, utreexoData)
+		return
+	}
+
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
 	// rejected, the transaction was unsolicited.
@@ -805,11 +896,24 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// Check if we've received the utreexo summaries already.
-	if sm.chain.IsUtreexoViewActive() {
+	// A block downloaded from multiple peers may have been connected
+	// already if it was requested again after its peer timed out.
+	if sm.parallelDownload() {
+		sm.blockDownloadReceived(blockHash, peer, false)
+		if sm.chain.MainChainHasBlock(blockHash) {
+			delete(state.requestedBlocks, *blockHash)
+			return
+		}
+	}
+
+	// Check if we've received the utreexo summaries already.  Blocks put
+	// together from compact blocks came with their utreexo proof.
+	utreexoViewActive := sm.chain.IsUtreexoViewActive()
+	proofPeer := peer
+	if utreexoViewActive && !bmsg.cmpct {
 		best := sm.chain.BestSnapshot()
 		if !best.Hash.IsEqual(&bmsg.block.MsgBlock().Header.PrevBlock) {
-			log.Warnf("got block %v out of order", bmsg.block.Hash())
+			log.Debugf("got block %v out of order", bmsg.block.Hash())
 			sm.queuedBlocks[*blockHash] = bmsg
 			return
 		}
@@ -825,26 +929,34 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// We need the utreexo proof to be able to verify the block.
 		utreexoProofMsg, found := sm.queuedUtreexoProofs[*bmsg.block.Hash()]
 		if !found {
-			log.Warnf("got block %v but don't have the associated "+
+			log.Debugf("got block %v but don't have the associated "+
 				"utreexo proof", bmsg.block.Hash())
 			sm.queuedBlocks[*blockHash] = bmsg
 			return
 		}
 
 		// We have all the data necessary to validate the block now so
-		// it's safee to remove this utreexo proof from the queue.
+		// it's safee to remove this utreexo proof and the block from the
+		// queue.
 		delete(sm.queuedUtreexoProofs, *bmsg.block.Hash())
+		delete(sm.queuedBlocks, *blockHash)
+		proofPeer = utreexoProofMsg.peer
 
-		udata := wire.UData{
-			AccProof: utreexo.Proof{
-				Targets: utreexoSummary.BlockTargets,
-				Proof:   utreexoProofMsg.proof.ProofHashes,
-			},
-			LeafDatas: utreexoProofMsg.proof.LeafDatas,
+		udata, err := sm.assembleUData(blockHash,
+			utreexoSummary.BlockTargets, utreexoProofMsg.proof)
+		if err != nil {
+			// Ask for the full proof again as the partial proof
+			// couldn't be put together.
+			log.Warnf("Unable to assemble utreexo proof from %s: %v. "+
+				"Requesting the full proof", proofPeer, err)
+			sm.reputations.proofChecked(proofPeer, false)
+			sm.queuedBlocks[*blockHash] = bmsg
+			peer.QueueMessage(wire.ConstructGetProofMsg(blockHash,
+				sm.numLeaves[best.Height], utreexoSummary.BlockTargets), nil)
+			return
 		}
 
-		bmsg.block.MsgBlock().UData = &udata
-		bmsg.block.MsgBlock().UData.AccProof.Targets = utreexoSummary.BlockTargets
+		bmsg.block.MsgBlock().UData = udata
 	}
 
 	// Process the block based off the headers if we're still in headers-first mode.
@@ -871,6 +983,9 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		if _, ok := err.(blockchain.RuleError); ok {
 			log.Infof("Rejected block %v from %s: %v", blockHash,
 				peer, err)
+			if utreexoViewActive {
+				sm.reputations.proofChecked(proofPeer, false)
+			}
 		} else {
 			log.Errorf("Failed to process block %v: %v",
 				blockHash, err)
@@ -884,6 +999,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		// send it.
 		code, reason := mempool.ErrToRejectErr(err)
 		peer.PushRejectMsg(wire.CmdBlock, code, reason, blockHash, false)
+
+		// The block the header commits to is requested again from
+		// whichever peer is next.
+		if sm.parallelDownload() {
+			delete(sm.blockDownloads, *blockHash)
+			sm.scheduleBlockDownloads()
+		}
 		return
 	}
 
@@ -930,12 +1052,19 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 			peer.PushGetBlocksMsg(locator, orphanRoot)
 		}
 	} else {
-		if peer == sm.syncPeer {
+		if utreexoViewActive {
+			sm.reputations.proofChecked(proofPeer, true)
+		}
+
+		// Blocks downloaded from multiple peers are progress no matter
+		// which of them sent it.
+		if peer == sm.syncPeer || sm.parallelDownload() {
 			sm.lastProgressTime = time.Now()
 		}
 
 		// It's safe to delete the utreexo block summary for this block now.
 		delete(sm.utreexoSummaries, *bmsg.block.Hash())
+		delete(sm.blockDownloads, *blockHash)
 
 		// When the block is not an orphan, log information about it and
 		// update the chain state.
@@ -992,7 +1121,9 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	_, lastHeight := sm.chain.BestHeader()
 	if bmsg.block.Height() < lastHeight {
-		if sm.startHeader != nil && len(state.requestedBlocks) == 0 {
+		if sm.parallelDownload() {
+			sm.scheduleBlockDownloads()
+		} else if sm.startHeader != nil && len(state.requestedBlocks) == 0 {
 			sm.fetchHeaderBlocks(nil)
 		}
 		return
@@ -1001,6 +1132,10 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		log.Infof("Finished the initial block download and caught up to block %v(%v) "+
 			"-- now listening to blocks.", bmsg.block.Hash(), bmsg.block.Height())
 		sm.headersFirstMode = false
+		sm.blockDownloads = make(map[chainhash.Hash]*blockDownload)
+		for _, state := range sm.peerStates {
+			state.blocksInFlight = 0
+		}
 	}
 }
 
@@ -1088,6 +1223,13 @@ func (sm *SyncManager) fetchHeaderBlocks(peer *peerpkg.Peer) {
 		return
 	}
 
+	// CSNs download the blocks and their proofs from all the peers that
+	// serve them.
+	if sm.parallelDownload() {
+		sm.scheduleBlockDownloads()
+		return
+	}
+
 	bestHeaderHash, bestHeaderHeight := sm.chain.BestHeader()
 	bestState := sm.chain.BestSnapshot()
 	length := bestHeaderHeight - bestState.Height
@@ -1134,25 +1276,10 @@ func (sm *SyncManager) fetchHeaderBlocks(peer *peerpkg.Peer) {
 		if !haveInv && !requested {
 			peerState.requestedBlocks[*hash] = struct{}{}
 
-			// If we're fetching from a witness enabled peer
-			// post-fork, then ensure that we receive all the
-			// witness data in the blocks.
-			if reqPeer.IsWitnessEnabled() {
-				iv.Type = wire.InvTypeWitnessBlock
-
-				// If we're syncing from a utreexo enabled peer, also
-				// ask for the proofs.
-				if reqPeer.IsUtreexoEnabled() {
-					iv.Type = wire.InvTypeWitnessUtreexoBlock
-				}
-			} else {
-				// If we're syncing from a utreexo enabled peer, also
-				// ask for the proofs.
-				if reqPeer.IsUtreexoEnabled() {
-					iv.Type = wire.InvTypeUtreexoBlock
-				}
-			}
-
+			// If we're fetching from a witness or utreexo enabled
+			// peer, then ensure that we receive all the witness
+			// data and proofs along with the blocks.
+			iv.Type = blockInvType(reqPeer)
 			gdmsg.AddInvVect(iv)
 			numRequested++
 
@@ -1164,10 +1291,16 @@ func (sm *SyncManager) fetchHeaderBlocks(peer *peerpkg.Peer) {
 					log.Warnf("Missing utreexo summary for %v", hash)
 					return
 				}
+				prevHash, err := sm.chain.HeaderHashByHeight(h - 1)
+				if err != nil {
+					log.Warnf("error while fetching the block hash for height %v -- %v",
+						h-1, err)
+					return
+				}
 				peerState.requestedUtreexoProofs[*hash] = struct{}{}
 
-				msg := wire.ConstructGetProofMsg(
-					hash, sm.numLeaves[h-1], utreexoSummary.BlockTargets)
+				msg := sm.constructGetProofMsg(hash, prevHash,
+					sm.numLeaves[h-1], utreexoSummary.BlockTargets)
 				reqPeer.QueueMessage(msg, nil)
 			}
 		}
@@ -1249,6 +1382,13 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 
 	if sm.headersBuildMode && bestHeight >= sm.chain.AssumeUtreexoHeight() {
+		// The roots of an assumed utreexo point given by the user are
+		// fetched from peers once the header at its height is known.
+		if !sm.chain.AssumeUtreexoRootsKnown() {
+			sm.requestAssumeUtreexoRoot()
+			return
+		}
+
 		assumeUtreexoHash := sm.chain.AssumeUtreexoHash()
 		if !bestHash.IsEqual(&assumeUtreexoHash) {
 			log.Warnf("The node had hash %v hardcoded in but the valid proof-of-work "+
@@ -1259,28 +1399,7 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 			os.Exit(1)
 		}
 
-		// We're done downloading headers.
-		sm.headersBuildMode = false
-
-		// No more headers first mode either.
-		sm.headersFirstMode = false
-
-		// Set the best state and the utreexo state.
-		sm.chain.SetNewBestStateFromAssumedUtreexoPoint()
-		sm.chain.SetUtreexoStateFromAssumePoint()
-
-		bestState := sm.chain.BestSnapshot()
-		log.Infof("Finished building headers. Initialized assumed utreexo point "+
-			"at block %v(%d)", bestState.Hash.String(), bestState.Height)
-
-		locator := blockchain.BlockLocator([]*chainhash.Hash{&bestState.Hash})
-		err := peer.PushGetBlocksMsg(locator, &zeroHash)
-		if err != nil {
-			log.Warnf("Failed to send getblocks message to "+
-				"peer %s: %v", peer.Addr(), err)
-			return
-		}
-
+		sm.finishHeadersBuild(peer)
 		return
 	}
 
@@ -1339,6 +1458,87 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// finishHeadersBuild ends the headers build mode by starting the chain from the
+// assumed utreexo point and asks the peer for the blocks after it.
+func (sm *SyncManager) finishHeadersBuild(peer *peerpkg.Peer) {
+	// We're done downloading headers.
+	sm.headersBuildMode = false
+
+	// No more headers first mode either.
+	sm.headersFirstMode = false
+
+	// Set the best state and the utreexo state.
+	sm.chain.SetNewBestStateFromAssumedUtreexoPoint()
+	sm.chain.SetUtreexoStateFromAssumePoint()
+
+	bestState := sm.chain.BestSnapshot()
+	log.Infof("Finished building headers. Initialized assumed utreexo point "+
+		"at block %v(%d)", bestState.Hash.String(), bestState.Height)
+
+	locator := blockchain.BlockLocator([]*chainhash.Hash{&bestState.Hash})
+	err := peer.PushGetBlocksMsg(locator, &zeroHash)
+	if err != nil {
+		log.Warnf("Failed to send getblocks message to "+
+			"peer %s: %v", peer.Addr(), err)
+	}
+}
+
+// requestAssumeUtreexoRoot asks the utreexo peers for the roots at the block of
+// the best header chain that's at the height of the assumed utreexo point.
+func (sm *SyncManager) requestAssumeUtreexoRoot() {
+	if sm.assumeUtreexoRootHash != nil {
+		return
+	}
+
+	height := sm.chain.AssumeUtreexoHeight()
+	hash, err := sm.chain.HeaderHashByHeight(height)
+	if err != nil {
+		log.Warnf("Couldn't fetch the header at the assumed utreexo "+
+			"point height %d: %v", height, err)
+		return
+	}
+	sm.assumeUtreexoRootHash = hash
+
+	log.Infof("Requesting the utreexo roots at block %v(%d) from peers", hash, height)
+	for peer := range sm.peerStates {
+		if peer.IsUtreexoEnabled() {
+			peer.QueueMessage(wire.NewMsgGetUtreexoRoot(*hash), nil)
+		}
+	}
+}
+
+// handleUtreexoRootMsg is called when a peer sends the roots of the assumed
+// utreexo point given by the user.  The node starts from the roots if they
+// match the roots hash of the point.  Peers that send roots that don't match
+// are disconnected.
+func (sm *SyncManager) handleUtreexoRootMsg(rmsg *utreexoRootMsg) {
+	peer := rmsg.peer
+	if !sm.headersBuildMode || sm.assumeUtreexoRootHash == nil ||
+		rmsg.root.BlockHash != *sm.assumeUtreexoRootHash {
+
+		log.Debugf("Ignoring unrequested utreexo roots for block %v "+
+			"from peer %s", rmsg.root.BlockHash, peer.Addr())
+		return
+	}
+
+	err := sm.chain.SetAssumeUtreexoRoots(&rmsg.root.BlockHash,
+		rmsg.root.NumLeaves, rmsg.root.Roots)
+	if err != nil {
+		log.Warnf("Peer %s sent utreexo roots that don't match the "+
+			"assumed utreexo point -- disconnecting: %v", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+	log.Infof("Verified the utreexo roots at block %v from peer %s "+
+		"against the assumed utreexo point", rmsg.root.BlockHash, peer.Addr())
+
+	// Blocks are downloaded from the sync peer if there's one.
+	if sm.syncPeer != nil {
+		peer = sm.syncPeer
+	}
+	sm.finishHeadersBuild(peer)
+}
+
 // handleUtreexoSummariesMsg is called during utreexo summaries first download. It checks that
 // each summary was asked for and is from a known peer.
 func (sm *SyncManager) handleUtreexoSummariesMsg(hmsg *utreexoSummariesMsg) {
@@ -1458,6 +1658,22 @@ func (sm *SyncManager) handleUtreexoProofMsg(hmsg *utreexoProofMsg) {
 		return
 	}
 
+	// Proofs of blocks downloaded from multiple peers are only needed if
+	// the block wasn't connected after its peer timed out.  The blocks are
+	// connected in order once the one after the tip and its proof are both
+	// there.
+	if sm.parallelDownload() {
+		sm.blockDownloadReceived(&blockHash, peer, true)
+		if sm.chain.MainChainHasBlock(&blockHash) {
+			delete(state.requestedUtreexoProofs, blockHash)
+			return
+		}
+		sm.queuedUtreexoProofs[blockHash] = hmsg
+		sm.connectQueuedBlocks()
+		sm.scheduleBlockDownloads()
+		return
+	}
+
 	sm.queuedUtreexoProofs[blockHash] = hmsg
 
 	bmsg, haveBlock := sm.queuedBlocks[blockHash]
@@ -1506,6 +1722,7 @@ func (sm *SyncManager) handleNotFoundMsg(nfmsg *notFoundMsg) {
 				delete(state.requestedTxns, inv.Hash)
 				delete(sm.requestedTxns, inv.Hash)
 			}
+			delete(state.prefetchedTxns, inv.Hash)
 		}
 	}
 }
@@ -1633,6 +1850,15 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 		}
 	}
 
+	// Cache the proofs of the transactions in the mempool while a new
+	// block is on its way so that less of its proof has to be requested.
+	if lastBlock != -1 && sm.current() && sm.chain.IsUtreexoViewActive() {
+		haveBlock, err := sm.haveInventory(invVects[lastBlock])
+		if err == nil && !haveBlock {
+			sm.prefetchMempoolProofs(peer, state, &invVects[lastBlock].Hash)
+		}
+	}
+
 	// Don't request on inventory messages when we're in headers-first mode.
 	if sm.headersFirstMode {
 		return
@@ -1918,6 +2144,8 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 func (sm *SyncManager) blockHandler() {
 	stallTicker := time.NewTicker(stallSampleInterval)
 	defer stallTicker.Stop()
+	reputationTicker := time.NewTicker(reputationSaveInterval)
+	defer reputationTicker.Stop()
 
 out:
 	for {
@@ -1932,15 +2160,22 @@ out:
 				msg.reply <- struct{}{}
 
 			case *utreexoTxMsg:
-				sm.handleTxMsg(&msg.utreexoTx.Tx, msg.peer,
-					&wire.UData{
+				// Only nodes without the utxo set validate the
+				// tx with its utreexo data.  The others look the
+				// inputs up in the utxo set like any other tx.
+				var utreexoData *wire.UData
+				if sm.chain.IsUtreexoViewActive() {
+					utreexoData = &wire.UData{
 						AccProof:  msg.utreexoTx.MsgUtreexoTx().AccProof,
 						LeafDatas: msg.utreexoTx.MsgUtreexoTx().LeafDatas,
-					})
+					}
+				}
+				sm.handleTxMsg(&msg.utreexoTx.Tx, msg.peer, utreexoData)
 				msg.reply <- struct{}{}
 
 			case *blockMsg:
 				sm.handleBlockMsg(msg)
+				sm.connectQueuedBlocks()
 				msg.reply <- struct{}{}
 
 			case *invMsg:
@@ -1955,12 +2190,24 @@ out:
 			case *utreexoProofMsg:
 				sm.handleUtreexoProofMsg(msg)
 
+			case *utreexoRootMsg:
+				sm.handleUtreexoRootMsg(msg)
+
+			case *cmpctBlockMsg:
+				sm.handleCmpctBlockMsg(msg)
+
+			case *blockTxnMsg:
+				sm.handleBlockTxnMsg(msg)
+
 			case *notFoundMsg:
 				sm.handleNotFoundMsg(msg)
 
 			case *donePeerMsg:
 				sm.handleDonePeerMsg(msg.peer)
 
+			case *proofSourceMsg:
+				sm.handleProofSourceMsg(msg.peer)
+
 			case getSyncPeerMsg:
 				var peerID int32
 				if sm.syncPeer != nil {
@@ -1998,11 +2245,20 @@ out:
 		case <-stallTicker.C:
 			sm.handleStallSample()
 
+		case <-reputationTicker.C:
+			if err := sm.reputations.save(); err != nil {
+				log.Warnf("Unable to save the peer reputations: %v", err)
+			}
+
 		case <-sm.quit:
 			break out
 		}
 	}
 
+	if err := sm.reputations.save(); err != nil {
+		log.Errorf("Unable to save the peer reputations: %v", err)
+	}
+
 	// Only try to flush utxo cache if it exists.  A utreexo node doesn't have
 	// a utxo cache.
 	if !sm.chain.IsUtreexoViewActive() {
@@ -2054,6 +2310,19 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		// The transactions spending the outputs of the block have
+		// their inputs confirmed now so swap in their leaf datas for
+		// them to be relayed with the proofs of these inputs.
+		if sm.chain.IsUtreexoViewActive() {
+			sm.txMemPool.ConfirmLeafDatas(block)
+		}
+
+		// Record the confirmations of the transactions in the block
+		// before they're removed from the transaction pool.
+		if sm.smartFeeEstimator != nil {
+			sm.smartFeeEstimator.ProcessBlock(block)
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -2070,6 +2339,12 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 		}
 
+		// Re-root the proofs of the inputs of the remaining
+		// transactions to the roots the block committed to.
+		if sm.chain.IsUtreexoViewActive() {
+			sm.txMemPool.UpdateProofs(block)
+		}
+
 		// Register block with the fee estimator, if it exists.
 		if sm.feeEstimator != nil {
 			err := sm.feeEstimator.RegisterBlock(block)
@@ -2197,6 +2472,18 @@ func (sm *SyncManager) QueueUtreexoSummaries(summaries *wire.MsgUtreexoSummaries
 	sm.msgChan <- &utreexoSummariesMsg{summaries: summaries, peer: peer}
 }
 
+// QueueUtreexoRoot adds the passed utreexo root message and peer to the block
+// handling queue.
+func (sm *SyncManager) QueueUtreexoRoot(root *wire.MsgUtreexoRoot, peer *peerpkg.Peer) {
+	// No channel handling here because peers do not need to block on
+	// utreexo root messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &utreexoRootMsg{root: root, peer: peer}
+}
+
 // QueueUtreexoProof adds the utreexo proof to the block handling queue.
 func (sm *SyncManager) QueueUtreexoProof(proof *wire.MsgUtreexoProof, peer *peerpkg.Peer) {
 	// No channel handling here because peers do not need to block on
@@ -2264,6 +2551,14 @@ func (sm *SyncManager) SyncPeerID() int32 {
 	return <-reply
 }
 
+// PeerReputations returns the reputations of all the peers that have been
+// connected as sources of blocks and their utreexo proofs.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) PeerReputations() []PeerReputation {
+	return sm.reputations.snapshot()
+}
+
 // ProcessBlock makes use of ProcessBlock on an internal instance of a block
 // chain.
 func (sm *SyncManager) ProcessBlock(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error) {
@@ -2295,22 +2590,27 @@ func (sm *SyncManager) Pause() chan<- struct{} {
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
 	sm := SyncManager{
-		peerNotifier:        config.PeerNotifier,
-		chain:               config.Chain,
-		txMemPool:           config.TxMemPool,
-		chainParams:         config.ChainParams,
-		rejectedTxns:        make(map[chainhash.Hash]struct{}),
-		requestedTxns:       make(map[chainhash.Hash]struct{}),
-		requestedBlocks:     make(map[chainhash.Hash]struct{}),
-		numLeaves:           make(map[int32]uint64),
-		utreexoSummaries:    make(map[chainhash.Hash]*wire.UtreexoBlockSummary),
-		queuedBlocks:        make(map[chainhash.Hash]*blockMsg),
-		queuedUtreexoProofs: make(map[chainhash.Hash]*utreexoProofMsg),
-		peerStates:          make(map[*peerpkg.Peer]*peerSyncState),
-		progressLogger:      newBlockProgressLogger("Processed", log),
-		msgChan:             make(chan interface{}, config.MaxPeers*3),
-		quit:                make(chan struct{}),
-		feeEstimator:        config.FeeEstimator,
+		peerNotifier:         config.PeerNotifier,
+		chain:                config.Chain,
+		txMemPool:            config.TxMemPool,
+		chainParams:          config.ChainParams,
+		rejectedTxns:         make(map[chainhash.Hash]struct{}),
+		requestedTxns:        make(map[chainhash.Hash]struct{}),
+		requestedBlocks:      make(map[chainhash.Hash]struct{}),
+		numLeaves:            make(map[int32]uint64),
+		utreexoSummaries:     make(map[chainhash.Hash]*wire.UtreexoBlockSummary),
+		queuedBlocks:         make(map[chainhash.Hash]*blockMsg),
+		queuedUtreexoProofs:  make(map[chainhash.Hash]*utreexoProofMsg),
+		blockDownloads:       make(map[chainhash.Hash]*blockDownload),
+		partialProofRequests: make(map[chainhash.Hash]*partialProofRequest),
+		pendingCmpctBlocks:   make(map[chainhash.Hash]*pendingCmpctBlock),
+		peerStates:           make(map[*peerpkg.Peer]*peerSyncState),
+		reputations:          newPeerReputations(config.DataDir),
+		progressLogger:       newBlockProgressLogger("Processed", log),
+		msgChan:              make(chan interface{}, config.MaxPeers*3),
+		quit:                 make(chan struct{}),
+		feeEstimator:         config.FeeEstimator,
+		smartFeeEstimator:    config.SmartFeeEstimator,
 	}
 
 	best := sm.chain.BestSnapshot()
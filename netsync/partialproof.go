@@ -0,0 +1,191 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// partialProofRequest keeps track of the proof hashes and the leaf datas that
+// were left out of a getutreexoproof request because they were already
+// available locally from the accumulator and the mempool.
+type partialProofRequest struct {
+	// numLeaves is the number of leaves the accumulator had when the
+	// request was made.
+	numLeaves uint64
+
+	// proofIncludes marks the proof hashes that were requested from the
+	// peer.  proofHashes holds the locally available hashes for the ones
+	// that were not requested.
+	proofIncludes []bool
+	proofHashes   []utreexo.Hash
+
+	// leafIncludes marks the leaf datas that were requested from the peer.
+	// leafDatas holds the locally available leaf datas for the ones that
+	// were not requested.
+	leafIncludes []bool
+	leafDatas    []wire.LeafData
+}
+
+// fetchLocalProofData returns the proof hashes and the leaf datas for the given
+// targets that are already available locally.  Nil is returned if none of them
+// are available or if the accumulator isn't at the given parent block and
+// numLeaves.
+func (sm *SyncManager) fetchLocalProofData(prevHash *chainhash.Hash,
+	numLeaves uint64, targets []uint64) *partialProofRequest {
+
+	// The targets must be sorted in order for ProofPositions to work correctly.
+	sortedTargets := make([]uint64, len(targets))
+	copy(sortedTargets, targets)
+	sort.Slice(sortedTargets, func(a, b int) bool { return sortedTargets[a] < sortedTargets[b] })
+
+	proofPositions, _ := utreexo.ProofPositions(
+		sortedTargets,
+		numLeaves,
+		utreexo.TreeRows(numLeaves),
+	)
+
+	// The cached hashes can only be fetched when the accumulator is at the
+	// parent of the block.  This is the case when we're relaying new blocks
+	// at the tip but not during the initial block download.  Matching the
+	// number of leaves alone isn't enough as a sibling of the parent may
+	// have the same amount of leaves.
+	proofHashes, err := sm.chain.FetchCachedHashes(prevHash, numLeaves, proofPositions)
+	if err != nil {
+		return nil
+	}
+	leafHashes, err := sm.chain.FetchCachedHashes(prevHash, numLeaves, targets)
+	if err != nil {
+		return nil
+	}
+
+	var empty utreexo.Hash
+	haveCount := 0
+
+	proofIncludes := make([]bool, len(proofHashes))
+	for i, hash := range proofHashes {
+		if hash == empty {
+			proofIncludes[i] = true
+			continue
+		}
+		haveCount++
+	}
+
+	leafIncludes := make([]bool, len(leafHashes))
+	leafDatas := make([]wire.LeafData, len(leafHashes))
+	for i, hash := range leafHashes {
+		if hash != empty {
+			ld, found := sm.txMemPool.FetchLeafDataByHash(hash)
+			if found {
+				leafDatas[i] = ld
+				haveCount++
+				continue
+			}
+		}
+		leafIncludes[i] = true
+	}
+
+	if haveCount == 0 {
+		return nil
+	}
+
+	return &partialProofRequest{
+		numLeaves:     numLeaves,
+		proofIncludes: proofIncludes,
+		proofHashes:   proofHashes,
+		leafIncludes:  leafIncludes,
+		leafDatas:     leafDatas,
+	}
+}
+
+// constructGetProofMsg returns a getutreexoproof message for the given block
+// that builds on top of prevHash.
+// Proof hashes and leaf datas that are available locally are left out of the
+// request and are remembered so that they can be filled in once the proof is
+// received.
+func (sm *SyncManager) constructGetProofMsg(blockHash, prevHash *chainhash.Hash,
+	numLeaves uint64, targets []uint64) *wire.MsgGetUtreexoProof {
+
+	partial := sm.fetchLocalProofData(prevHash, numLeaves, targets)
+	if partial == nil {
+		delete(sm.partialProofRequests, *blockHash)
+		return wire.ConstructGetProofMsg(blockHash, numLeaves, targets)
+	}
+
+	log.Debugf("Requesting partial utreexo proof for block %v", blockHash)
+	sm.partialProofRequests[*blockHash] = partial
+	return wire.ConstructGetPartialProofMsg(
+		blockHash, partial.proofIncludes, partial.leafIncludes)
+}
+
+// assembleUData returns the utreexo data for the block from the received proof
+// message.  If only a partial proof was requested for the block, the locally
+// available proof hashes and leaf datas are filled in.
+func (sm *SyncManager) assembleUData(blockHash *chainhash.Hash, targets []uint64,
+	proof *wire.MsgUtreexoProof) (*wire.UData, error) {
+
+	partial, found := sm.partialProofRequests[*blockHash]
+	if !found {
+		return &wire.UData{
+			AccProof: utreexo.Proof{
+				Targets: targets,
+				Proof:   proof.ProofHashes,
+			},
+			LeafDatas: proof.LeafDatas,
+		}, nil
+	}
+	delete(sm.partialProofRequests, *blockHash)
+
+	received := proof.ProofHashes
+	proofHashes := make([]utreexo.Hash, len(partial.proofIncludes))
+	for i, include := range partial.proofIncludes {
+		if !include {
+			proofHashes[i] = partial.proofHashes[i]
+			continue
+		}
+		if len(received) == 0 {
+			return nil, fmt.Errorf("peer sent fewer proof hashes "+
+				"than requested for block %v", blockHash)
+		}
+		proofHashes[i] = received[0]
+		received = received[1:]
+	}
+	if len(received) != 0 {
+		return nil, fmt.Errorf("peer sent %d more proof hashes than "+
+			"requested for block %v", len(received), blockHash)
+	}
+
+	receivedLeaves := proof.LeafDatas
+	leafDatas := make([]wire.LeafData, len(partial.leafIncludes))
+	for i, include := range partial.leafIncludes {
+		if !include {
+			leafDatas[i] = partial.leafDatas[i]
+			continue
+		}
+		if len(receivedLeaves) == 0 {
+			return nil, fmt.Errorf("peer sent fewer leaf datas "+
+				"than requested for block %v", blockHash)
+		}
+		leafDatas[i] = receivedLeaves[0]
+		receivedLeaves = receivedLeaves[1:]
+	}
+	if len(receivedLeaves) != 0 {
+		return nil, fmt.Errorf("peer sent %d more leaf datas than "+
+			"requested for block %v", len(receivedLeaves), blockHash)
+	}
+
+	return &wire.UData{
+		AccProof: utreexo.Proof{
+			Targets: targets,
+			Proof:   proofHashes,
+		},
+		LeafDatas: leafDatas,
+	}, nil
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/database"
+	_ "github.com/utreexo/utreexod/database/ffldb"
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestAssembleUData(t *testing.T) {
+	blockHash := chainhash.Hash{0x01}
+
+	// The bridge caches every leaf while the CSN only caches the leaves
+	// spent by the transactions in its mempool.
+	bridge := utreexo.NewMapPollard(true)
+	csn := utreexo.NewMapPollard(false)
+	lds := make([]wire.LeafData, 16)
+	adds := make([]utreexo.Leaf, len(lds))
+	for i := range lds {
+		lds[i] = wire.LeafData{
+			BlockHash: chainhash.Hash{0x02},
+			OutPoint:  wire.OutPoint{Hash: chainhash.Hash{0x03}, Index: uint32(i)},
+			Amount:    int64(i + 1),
+			PkScript:  []byte{0x51},
+			Height:    1,
+		}
+		adds[i] = utreexo.Leaf{Hash: lds[i].LeafHash(), Remember: i == 5 || i == 6}
+	}
+	err := bridge.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = csn.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The block spends a leaf only the bridge caches and two leaves whose
+	// leaf datas are in the mempool of the CSN.
+	spent := []wire.LeafData{lds[1], lds[6], lds[5]}
+	delHashes := make([]utreexo.Hash, len(spent))
+	for i, ld := range spent {
+		delHashes[i] = ld.LeafHash()
+	}
+	fullProof, err := bridge.Prove(delHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := fullProof.Targets
+	numLeaves := csn.GetNumLeaves()
+
+	// Leave out what the CSN has cached like fetchLocalProofData does and
+	// collect what the peer sends for the rest.
+	sortedTargets := make([]uint64, len(targets))
+	copy(sortedTargets, targets)
+	sort.Slice(sortedTargets, func(a, b int) bool {
+		return sortedTargets[a] < sortedTargets[b]
+	})
+	proofPositions, _ := utreexo.ProofPositions(sortedTargets, numLeaves,
+		utreexo.TreeRows(numLeaves))
+	partial := &partialProofRequest{
+		numLeaves:     numLeaves,
+		proofIncludes: make([]bool, len(proofPositions)),
+		proofHashes:   make([]utreexo.Hash, len(proofPositions)),
+		leafIncludes:  make([]bool, len(targets)),
+		leafDatas:     make([]wire.LeafData, len(targets)),
+	}
+	var peerHashes []utreexo.Hash
+	for i, pos := range proofPositions {
+		partial.proofHashes[i] = csn.GetHash(pos)
+		if partial.proofHashes[i] == (utreexo.Hash{}) {
+			partial.proofIncludes[i] = true
+			peerHashes = append(peerHashes, fullProof.Proof[i])
+		}
+	}
+	var peerLeaves []wire.LeafData
+	for i, target := range targets {
+		if csn.GetHash(target) == (utreexo.Hash{}) {
+			partial.leafIncludes[i] = true
+			peerLeaves = append(peerLeaves, spent[i])
+			continue
+		}
+		partial.leafDatas[i] = spent[i]
+	}
+	if len(peerHashes) == 0 || len(peerHashes) == len(proofPositions) ||
+		len(peerLeaves) != 1 {
+
+		t.Fatalf("expected the proof to be split between the CSN and "+
+			"the peer, got %d of %d proof hashes and %d of %d leaf "+
+			"datas from the peer", len(peerHashes),
+			len(proofPositions), len(peerLeaves), len(targets))
+	}
+
+	badHashes := make([]utreexo.Hash, len(peerHashes))
+	copy(badHashes, peerHashes)
+	badHashes[0][0] ^= 0xff
+
+	tests := []struct {
+		name        string
+		partial     *partialProofRequest
+		proof       *wire.MsgUtreexoProof
+		wantErr     string
+		wantInvalid bool
+	}{
+		{
+			name: "full proof",
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: fullProof.Proof,
+				LeafDatas:   spent,
+			},
+		},
+		{
+			name:    "partial proof",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: peerHashes,
+				LeafDatas:   peerLeaves,
+			},
+		},
+		{
+			name:    "wrong proof hash",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: badHashes,
+				LeafDatas:   peerLeaves,
+			},
+			wantInvalid: true,
+		},
+		{
+			name:    "fewer proof hashes",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: peerHashes[:len(peerHashes)-1],
+				LeafDatas:   peerLeaves,
+			},
+			wantErr: "fewer proof hashes",
+		},
+		{
+			name:    "extra proof hashes",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: append(peerHashes[:len(peerHashes):len(peerHashes)],
+					utreexo.Hash{0x03}),
+				LeafDatas: peerLeaves,
+			},
+			wantErr: "more proof hashes",
+		},
+		{
+			name:    "fewer leaf datas",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: peerHashes,
+			},
+			wantErr: "fewer leaf datas",
+		},
+		{
+			name:    "extra leaf datas",
+			partial: partial,
+			proof: &wire.MsgUtreexoProof{
+				ProofHashes: peerHashes,
+				LeafDatas:   append(peerLeaves, lds[0]),
+			},
+			wantErr: "more leaf datas",
+		},
+	}
+
+	for _, test := range tests {
+		sm := &SyncManager{
+			partialProofRequests: make(map[chainhash.Hash]*partialProofRequest),
+		}
+		if test.partial != nil {
+			sm.partialProofRequests[blockHash] = test.partial
+		}
+
+		got, err := sm.assembleUData(&blockHash, targets, test.proof)
+		if _, found := sm.partialProofRequests[blockHash]; found {
+			t.Fatalf("%s: expected the partial request to be removed", test.name)
+		}
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("%s: expected error containing %q, got %v",
+					test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+
+		hashes := make([]utreexo.Hash, len(got.LeafDatas))
+		for i, ld := range got.LeafDatas {
+			hashes[i] = ld.LeafHash()
+		}
+		_, err = utreexo.Verify(bridge.GetStump(), hashes, got.AccProof)
+		if test.wantInvalid {
+			if err == nil {
+				t.Fatalf("%s: expected the proof not to verify", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: proof doesn't verify against the roots: %v",
+				test.name, err)
+		}
+		if !reflect.DeepEqual(got.LeafDatas, spent) {
+			t.Fatalf("%s: expected leaf datas %v, got %v", test.name,
+				spent, got.LeafDatas)
+		}
+	}
+}
+
+func TestFetchLocalProofData(t *testing.T) {
+	db, err := database.Create("ffldb", t.TempDir(), wire.MainNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	params := chaincfg.RegressionNetParams
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		UtreexoView: blockchain.NewUtreexoViewpoint(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := &SyncManager{chain: chain}
+
+	best := chain.BestSnapshot()
+	numLeaves := chain.GetUtreexoView().NumLeaves()
+	targets := []uint64{0}
+
+	// The cached hashes of the accumulator can't be used for a block that
+	// doesn't build on the tip.
+	otherHash := chainhash.Hash{0x01}
+	if partial := sm.fetchLocalProofData(&otherHash, numLeaves, targets); partial != nil {
+		t.Fatalf("expected nil for a block that doesn't build on the tip")
+	}
+
+	// Or when the number of leaves don't match up.
+	if partial := sm.fetchLocalProofData(&best.Hash, numLeaves+1, targets); partial != nil {
+		t.Fatalf("expected nil for mismatched numLeaves")
+	}
+
+	// An accumulator without anything cached has nothing to offer.
+	if partial := sm.fetchLocalProofData(&best.Hash, numLeaves, targets); partial != nil {
+		t.Fatalf("expected nil for an empty accumulator")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	peerpkg "github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// maxPrefetchTxns is the maximum number of mempool transactions whose proofs
+// are prefetched for a single announced block.
+const maxPrefetchTxns = 100
+
+// prefetchMempoolProofs requests the proof hashes that are missing from the
+// accumulator for the transactions in the mempool from the peer that announced
+// the given block.  The block is likely to spend the same leaves so having
+// their proofs cached before it arrives leaves less of its proof to request.
+// The proofs are only prefetched once for each announced block.
+func (sm *SyncManager) prefetchMempoolProofs(peer *peerpkg.Peer, state *peerSyncState,
+	blockHash *chainhash.Hash) {
+
+	if sm.lastPrefetchHash.IsEqual(blockHash) {
+		return
+	}
+	sm.lastPrefetchHash = *blockHash
+
+	gdmsg := wire.NewMsgGetData()
+	numTxns := 0
+	for _, txHash := range sm.txMemPool.TxHashes() {
+		if numTxns >= maxPrefetchTxns {
+			break
+		}
+		if _, exists := state.prefetchedTxns[*txHash]; exists {
+			continue
+		}
+
+		leafDatas, err := sm.txMemPool.FetchLeafDatas(txHash)
+		if err != nil {
+			continue
+		}
+		leafHashes := make([]utreexo.Hash, 0, len(leafDatas))
+		for _, ld := range leafDatas {
+			// Unconfirmed leaves aren't in the accumulator.
+			if ld.IsUnconfirmed() || ld.IsCompact() {
+				continue
+			}
+			leafHashes = append(leafHashes, ld.LeafHash())
+		}
+		if len(leafHashes) == 0 {
+			continue
+		}
+
+		missing, ok := sm.chain.GetMissingLeafProofPositions(leafHashes)
+		if !ok || len(missing) == 0 {
+			continue
+		}
+		neededPositions := chainhash.Uint64sToPackedHashes(missing)
+		if len(gdmsg.InvList)+len(neededPositions)+1 > wire.MaxInvPerMsg {
+			break
+		}
+
+		iv := wire.NewInvVect(wire.InvTypeUtreexoTx, txHash)
+		gdmsg.AddInvVect(iv)
+		for i := range neededPositions {
+			gdmsg.AddInvVect(wire.NewInvVect(
+				wire.InvTypeUtreexoProofHash, &neededPositions[i]))
+		}
+		limitAdd(state.prefetchedTxns, *txHash, maxRequestedTxns)
+		numTxns++
+	}
+
+	if numTxns == 0 {
+		return
+	}
+	log.Debugf("Prefetching the proofs of %d mempool transactions from %s "+
+		"for block %v", numTxns, peer, blockHash)
+	peer.QueueMessage(gdmsg, nil)
+}
+
+// ingestPrefetchedProof caches the proof of a transaction that's already in
+// the mempool to the accumulator.
+func (sm *SyncManager) ingestPrefetchedProof(tx *btcutil.Tx, utreexoData *wire.UData) {
+	// The transaction may have been mined or evicted since the proof was
+	// requested.
+	if utreexoData == nil || !sm.txMemPool.HaveTransaction(tx.Hash()) {
+		return
+	}
+
+	err := sm.chain.VerifyUData(utreexoData, tx.MsgTx().TxIn, true)
+	if err != nil {
+		log.Debugf("Unable to ingest the prefetched proof of %v: %v",
+			tx.Hash(), err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sort"
+	"sync/atomic"
+
+	peerpkg "github.com/utreexo/utreexod/peer"
+)
+
+// proofSourceMsg signifies that a peer is one of the proof sources the operator
+// pinned the node to and that it authenticated if it had to.
+type proofSourceMsg struct {
+	peer *peerpkg.Peer
+}
+
+// handleProofSourceMsg marks the peer as a proof source so that blocks and
+// their proofs are fetched from it before the public peers.
+func (sm *SyncManager) handleProofSourceMsg(peer *peerpkg.Peer) {
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Debugf("Received proof source message from unknown peer %s",
+			peer)
+		return
+	}
+	state.proofSource = true
+	log.Infof("Fetching blocks and proofs from proof source %s first", peer)
+
+	// Start syncing if there was no peer to sync from and hand the proof
+	// source the next blocks to download.
+	if state.syncCandidate && sm.syncPeer == nil {
+		sm.startSync()
+	}
+	if state.syncCandidate && sm.parallelDownload() {
+		sm.scheduleBlockDownloads()
+	}
+}
+
+// isProofSource returns whether the peer is one of the pinned proof sources.
+func (sm *SyncManager) isProofSource(peer *peerpkg.Peer) bool {
+	state, exists := sm.peerStates[peer]
+	return exists && state.proofSource
+}
+
+// preferProofSources returns the proof sources among the peers or all of the
+// peers if none of them are proof sources.  The public peers are only fallen
+// back to when none of the pinned sources can be used.
+func (sm *SyncManager) preferProofSources(peers []*peerpkg.Peer) []*peerpkg.Peer {
+	var sources []*peerpkg.Peer
+	for _, peer := range peers {
+		if sm.isProofSource(peer) {
+			sources = append(sources, peer)
+		}
+	}
+	if len(sources) == 0 {
+		return peers
+	}
+	return sources
+}
+
+// sortProofSourcesFirst moves the proof sources ahead of the other peers while
+// keeping the order among each of them.
+func sortProofSourcesFirst(peers []downloadPeer) {
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].proofSource && !peers[j].proofSource
+	})
+}
+
+// SetProofSource marks the peer as one of the proof sources the operator
+// pinned the node to.  It must be called after the peer was added with NewPeer.
+func (sm *SyncManager) SetProofSource(peer *peerpkg.Peer) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &proofSourceMsg{peer: peer}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+
+	peerpkg "github.com/utreexo/utreexod/peer"
+)
+
+func TestPreferProofSources(t *testing.T) {
+	public1 := newTestPeer(t, "10.0.0.1:8333")
+	public2 := newTestPeer(t, "10.0.0.2:8333")
+	source1 := newTestPeer(t, "10.0.0.3:8333")
+	source2 := newTestPeer(t, "10.0.0.4:8333")
+
+	sm := &SyncManager{peerStates: map[*peerpkg.Peer]*peerSyncState{
+		public1: {},
+		public2: {},
+		source1: {proofSource: true},
+		source2: {proofSource: true},
+	}}
+
+	// Only the proof sources are picked from when there are any.
+	peers := sm.preferProofSources([]*peerpkg.Peer{public1, source1,
+		public2, source2})
+	if len(peers) != 2 || peers[0] != source1 || peers[1] != source2 {
+		t.Fatalf("expected the proof sources, got %v", peers)
+	}
+	peers = sm.preferProofSources([]*peerpkg.Peer{public1, public2})
+	if len(peers) != 2 {
+		t.Fatalf("expected to fall back to the public peers, got %v",
+			peers)
+	}
+
+	// The proof sources are downloaded from first while the order among
+	// the others is kept.
+	downloadPeers := []downloadPeer{
+		{peer: public2},
+		{peer: source2, proofSource: true},
+		{peer: public1},
+		{peer: source1, proofSource: true},
+	}
+	sortProofSourcesFirst(downloadPeers)
+	want := []*peerpkg.Peer{source2, source1, public2, public1}
+	for i, peer := range downloadPeers {
+		if peer.peer != want[i] {
+			t.Fatalf("unexpected order of peers %v", downloadPeers)
+		}
+	}
+}
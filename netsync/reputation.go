@@ -0,0 +1,363 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	peerpkg "github.com/utreexo/utreexod/peer"
+)
+
+const (
+	// reputationFileName is the name of the file in the data directory the
+	// reputations of the peers are kept in across restarts.
+	reputationFileName = "peerreputation.json"
+
+	// reputationSaveInterval is how often the reputations of the peers are
+	// written to disk while running.
+	reputationSaveInterval = 10 * time.Minute
+
+	// maxPeerReputations is the most peers a reputation is kept for.  The
+	// ones that were seen the longest ago are dropped first.
+	maxPeerReputations = 2000
+
+	// latencyWeight is the weight of a new sample in the moving average of
+	// the time a peer takes to deliver a block and its proof.
+	latencyWeight = 0.2
+
+	// referenceLatency and referenceSession are the average delivery time
+	// and connection length that give a peer half of the latency and
+	// uptime parts of its score.
+	referenceLatency = 10 * time.Second
+	referenceSession = time.Hour
+
+	// invalidProofPenalty is how many failed deliveries an invalid proof
+	// counts as.  A peer serving invalid proofs is much worse than one
+	// that's sometimes slow.
+	invalidProofPenalty = 4
+)
+
+// PeerReputation is the reliability of a peer as a source of blocks and their
+// utreexo proofs across all the times it was connected.
+type PeerReputation struct {
+	// Addr is the address of the peer.  Inbound peers are only known by
+	// their host since they connect from a different port every time.
+	Addr string `json:"addr"`
+
+	// ValidProofs and InvalidProofs are the number of blocks with proofs
+	// from the peer that were connected and rejected.
+	ValidProofs   uint64 `json:"validproofs"`
+	InvalidProofs uint64 `json:"invalidproofs"`
+
+	// Timeouts is the number of times the peer didn't deliver a requested
+	// block and its proof in time or stalled the sync.
+	Timeouts uint64 `json:"timeouts"`
+
+	// Latency is the moving average of the time the peer took to deliver
+	// a requested block and its proof over LatencySamples deliveries.
+	Latency        time.Duration `json:"latency"`
+	LatencySamples uint64        `json:"latencysamples"`
+
+	// Connections is the number of times the peer was connected and Uptime
+	// is how long it was connected for in total.
+	Connections uint64        `json:"connections"`
+	Uptime      time.Duration `json:"uptime"`
+
+	// LastSeen is the last time the peer was connected.
+	LastSeen time.Time `json:"lastseen"`
+
+	// Connected is set when the peer is currently connected.
+	Connected bool `json:"-"`
+
+	// connectedSince is when the current connection to the peer started.
+	connectedSince time.Time
+}
+
+// uptime returns how long the peer was connected for including the current
+// connection.
+func (r *PeerReputation) uptime(now time.Time) time.Duration {
+	if r.Connected {
+		return r.Uptime + now.Sub(r.connectedSince)
+	}
+	return r.Uptime
+}
+
+// score returns how reliable the peer is between 0 and 1.  Most of it is the
+// share of valid deliveries while the rest rewards fast peers and peers that
+// stay connected.  A peer without any history gets a neutral score.
+func (r *PeerReputation) score(now time.Time) float64 {
+	// One valid and one failed delivery are assumed so that a single
+	// failure doesn't sink a new peer.
+	failures := r.InvalidProofs*invalidProofPenalty + r.Timeouts
+	validity := float64(r.ValidProofs+1) / float64(r.ValidProofs+failures+2)
+
+	latency := 0.5
+	if r.LatencySamples > 0 {
+		latency = float64(referenceLatency) /
+			float64(referenceLatency+r.Latency)
+	}
+
+	uptime := 0.5
+	if r.Connections > 0 {
+		session := r.uptime(now) / time.Duration(r.Connections)
+		uptime = float64(session) / float64(session+referenceSession)
+	}
+
+	return 0.6*validity + 0.25*latency + 0.15*uptime
+}
+
+// Score returns how reliable the peer is between 0 and 1.
+func (r *PeerReputation) Score() float64 {
+	return r.score(time.Now())
+}
+
+// peerReputations keeps the reputations of the peers and persists them to a
+// file in the data directory.
+//
+// This type is safe for concurrent access.
+type peerReputations struct {
+	mtx   sync.Mutex
+	file  string
+	peers map[string]*PeerReputation
+}
+
+// reputationKey returns the address the reputation of the peer is kept under.
+func reputationKey(peer *peerpkg.Peer) string {
+	if !peer.Inbound() {
+		return peer.Addr()
+	}
+	host, _, err := net.SplitHostPort(peer.Addr())
+	if err != nil {
+		return peer.Addr()
+	}
+	return host
+}
+
+// newPeerReputations returns the reputations of the peers loaded from the data
+// directory.  They're only kept in memory when no data directory is given.
+func newPeerReputations(dataDir string) *peerReputations {
+	pr := &peerReputations{peers: make(map[string]*PeerReputation)}
+	if dataDir == "" {
+		return pr
+	}
+	pr.file = filepath.Join(dataDir, reputationFileName)
+
+	f, err := os.Open(pr.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Unable to open %s: %v", pr.file, err)
+		}
+		return pr
+	}
+	defer f.Close()
+
+	var reputations []*PeerReputation
+	if err := json.NewDecoder(f).Decode(&reputations); err != nil {
+		log.Warnf("Ignoring the peer reputations in %s: %v", pr.file, err)
+		return pr
+	}
+	for _, r := range reputations {
+		pr.peers[r.Addr] = r
+	}
+	log.Debugf("Loaded the reputations of %d peers", len(pr.peers))
+
+	return pr
+}
+
+// get returns the reputation of the peer at the address and creates it if it
+// isn't known yet.
+//
+// This function MUST be called with the mutex held.
+func (pr *peerReputations) get(addr string) *PeerReputation {
+	r, ok := pr.peers[addr]
+	if !ok {
+		r = &PeerReputation{Addr: addr}
+		pr.peers[addr] = r
+	}
+	return r
+}
+
+// connected records that the peer connected.
+func (pr *peerReputations) connected(peer *peerpkg.Peer, now time.Time) {
+	pr.mtx.Lock()
+	r := pr.get(reputationKey(peer))
+	r.Connections++
+	r.Connected = true
+	r.connectedSince = now
+	r.LastSeen = now
+	pr.mtx.Unlock()
+}
+
+// disconnected records that the peer disconnected.
+func (pr *peerReputations) disconnected(peer *peerpkg.Peer, now time.Time) {
+	pr.mtx.Lock()
+	r := pr.get(reputationKey(peer))
+	if r.Connected {
+		r.Uptime += now.Sub(r.connectedSince)
+		r.Connected = false
+	}
+	r.LastSeen = now
+	pr.mtx.Unlock()
+}
+
+// proofChecked records whether a block with a proof from the peer was valid.
+func (pr *peerReputations) proofChecked(peer *peerpkg.Peer, valid bool) {
+	pr.mtx.Lock()
+	r := pr.get(reputationKey(peer))
+	if valid {
+		r.ValidProofs++
+	} else {
+		r.InvalidProofs++
+	}
+	pr.mtx.Unlock()
+}
+
+// timedOut records that the peer didn't deliver in time.
+func (pr *peerReputations) timedOut(peer *peerpkg.Peer) {
+	pr.mtx.Lock()
+	pr.get(reputationKey(peer)).Timeouts++
+	pr.mtx.Unlock()
+}
+
+// delivered records how long the peer took to deliver a block and its proof.
+func (pr *peerReputations) delivered(peer *peerpkg.Peer, latency time.Duration) {
+	pr.mtx.Lock()
+	r := pr.get(reputationKey(peer))
+	if r.LatencySamples == 0 {
+		r.Latency = latency
+	} else {
+		r.Latency = time.Duration(latencyWeight*float64(latency) +
+			(1-latencyWeight)*float64(r.Latency))
+	}
+	r.LatencySamples++
+	pr.mtx.Unlock()
+}
+
+// score returns how reliable the peer is between 0 and 1.
+func (pr *peerReputations) score(peer *peerpkg.Peer) float64 {
+	pr.mtx.Lock()
+	defer pr.mtx.Unlock()
+
+	r, ok := pr.peers[reputationKey(peer)]
+	if !ok {
+		return (&PeerReputation{}).score(time.Now())
+	}
+	return r.score(time.Now())
+}
+
+// pick returns one of the peers at random where the more reliable ones are
+// more likely to be picked.  The square of the scores is used so that flaky
+// peers are rarely picked but still can be to give them another chance.
+func (pr *peerReputations) pick(peers []*peerpkg.Peer) *peerpkg.Peer {
+	if len(peers) == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(peers))
+	var total float64
+	for i, peer := range peers {
+		score := pr.score(peer)
+		weights[i] = score * score
+		total += weights[i]
+	}
+
+	n := rand.Float64() * total
+	for i, weight := range weights {
+		if n < weight {
+			return peers[i]
+		}
+		n -= weight
+	}
+	return peers[len(peers)-1]
+}
+
+// sortDownloadPeers sorts the peers from the most to the least reliable.
+func (pr *peerReputations) sortDownloadPeers(peers []downloadPeer) {
+	scores := make(map[*peerpkg.Peer]float64, len(peers))
+	for _, peer := range peers {
+		scores[peer.peer] = pr.score(peer.peer)
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return scores[peers[i].peer] > scores[peers[j].peer]
+	})
+}
+
+// snapshot returns a copy of the reputations of all the peers.
+func (pr *peerReputations) snapshot() []PeerReputation {
+	pr.mtx.Lock()
+	defer pr.mtx.Unlock()
+
+	now := time.Now()
+	reputations := make([]PeerReputation, 0, len(pr.peers))
+	for _, r := range pr.peers {
+		copied := *r
+		copied.Uptime = r.uptime(now)
+		reputations = append(reputations, copied)
+	}
+	return reputations
+}
+
+// prune drops the reputations of the peers that were seen the longest ago
+// until at most maxPeerReputations are left.  Connected peers are kept.
+//
+// This function MUST be called with the mutex held.
+func (pr *peerReputations) prune() {
+	if len(pr.peers) <= maxPeerReputations {
+		return
+	}
+
+	reputations := make([]*PeerReputation, 0, len(pr.peers))
+	for _, r := range pr.peers {
+		if !r.Connected {
+			reputations = append(reputations, r)
+		}
+	}
+	sort.Slice(reputations, func(i, j int) bool {
+		return reputations[i].LastSeen.Before(reputations[j].LastSeen)
+	})
+	for _, r := range reputations {
+		if len(pr.peers) <= maxPeerReputations {
+			break
+		}
+		delete(pr.peers, r.Addr)
+	}
+}
+
+// save writes the reputations of the peers to the data directory.  The time
+// the connected peers have been connected for so far is saved as uptime.
+func (pr *peerReputations) save() error {
+	if pr.file == "" {
+		return nil
+	}
+
+	pr.mtx.Lock()
+	pr.prune()
+	pr.mtx.Unlock()
+	reputations := pr.snapshot()
+
+	// The reputations are written to a temporary file first so that a
+	// crash while writing never leaves a partial file behind.
+	tmpFile := pr.file + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(reputations)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, pr.file)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg"
+	peerpkg "github.com/utreexo/utreexod/peer"
+)
+
+// newTestPeer returns an outbound peer at the given address that isn't
+// connected.
+func newTestPeer(t *testing.T, addr string) *peerpkg.Peer {
+	peer, err := peerpkg.NewOutboundPeer(&peerpkg.Config{
+		ChainParams: &chaincfg.MainNetParams,
+	}, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer
+}
+
+func TestPeerReputationScore(t *testing.T) {
+	pr := newPeerReputations("")
+	good := newTestPeer(t, "10.0.0.1:8333")
+	slow := newTestPeer(t, "10.0.0.2:8333")
+	bad := newTestPeer(t, "10.0.0.3:8333")
+	unknown := newTestPeer(t, "10.0.0.4:8333")
+
+	for i := 0; i < 20; i++ {
+		pr.proofChecked(good, true)
+		pr.delivered(good, time.Second)
+		pr.proofChecked(slow, true)
+		pr.delivered(slow, time.Minute)
+		pr.proofChecked(bad, i%2 == 0)
+	}
+	pr.timedOut(slow)
+
+	scores := []float64{pr.score(good), pr.score(slow), pr.score(unknown),
+		pr.score(bad)}
+	for i := 1; i < len(scores); i++ {
+		if scores[i-1] <= scores[i] {
+			t.Fatalf("expected the scores to be decreasing, got %v",
+				scores)
+		}
+	}
+
+	// The more reliable peers come first when downloading blocks.
+	peers := []downloadPeer{{peer: bad}, {peer: unknown}, {peer: good},
+		{peer: slow}}
+	pr.sortDownloadPeers(peers)
+	if peers[0].peer != good || peers[1].peer != slow ||
+		peers[2].peer != unknown || peers[3].peer != bad {
+
+		t.Fatalf("unexpected order of peers %v", peers)
+	}
+
+	// Unreliable peers are picked far less often.
+	var picks int
+	for i := 0; i < 1000; i++ {
+		if pr.pick([]*peerpkg.Peer{good, bad}) == bad {
+			picks++
+		}
+	}
+	if picks == 0 || picks > 300 {
+		t.Fatalf("picked the bad peer %d out of 1000 times", picks)
+	}
+}
+
+func TestPeerReputationPersist(t *testing.T) {
+	DisableLog()
+	dataDir := t.TempDir()
+	pr := newPeerReputations(dataDir)
+	peer := newTestPeer(t, "10.0.0.1:8333")
+
+	start := time.Now().Add(-time.Hour)
+	pr.connected(peer, start)
+	pr.proofChecked(peer, true)
+	pr.proofChecked(peer, false)
+	pr.timedOut(peer)
+	pr.delivered(peer, 2*time.Second)
+	pr.disconnected(peer, start.Add(30*time.Minute))
+	if err := pr.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newPeerReputations(dataDir)
+	want := pr.snapshot()
+	got := loaded.snapshot()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 reputation, got %d", len(got))
+	}
+	if got[0].Addr != want[0].Addr ||
+		got[0].ValidProofs != 1 || got[0].InvalidProofs != 1 ||
+		got[0].Timeouts != 1 || got[0].Latency != 2*time.Second ||
+		got[0].Connections != 1 || got[0].Uptime != 30*time.Minute ||
+		!got[0].LastSeen.Equal(want[0].LastSeen) {
+
+		t.Fatalf("loaded %+v, want %+v", got[0], want[0])
+	}
+}
+
+func TestPeerReputationPrune(t *testing.T) {
+	pr := newPeerReputations("")
+	now := time.Now()
+	for i := 0; i < maxPeerReputations+10; i++ {
+		peer := newTestPeer(t, fmt.Sprintf("10.0.%d.%d:8333", i/256, i%256))
+		pr.connected(peer, now.Add(time.Duration(i)*time.Second))
+		if i >= 5 {
+			pr.disconnected(peer, now.Add(time.Duration(i)*time.Second))
+		}
+	}
+
+	// The oldest peers are dropped except for the connected ones.
+	pr.mtx.Lock()
+	pr.prune()
+	pr.mtx.Unlock()
+	if len(pr.peers) != maxPeerReputations {
+		t.Fatalf("expected %d reputations, got %d", maxPeerReputations,
+			len(pr.peers))
+	}
+	for i := 0; i < 15; i++ {
+		addr := fmt.Sprintf("10.0.0.%d:8333", i)
+		_, kept := pr.peers[addr]
+		if kept != (i < 5) {
+			t.Fatalf("peer %s kept %v", addr, kept)
+		}
+	}
+}
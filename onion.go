@@ -0,0 +1,156 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/go-socks/socks"
+	"github.com/utreexo/utreexod/connmgr"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// onionKeyFileName is the name of the file in the data directory the private
+// key of the onion service is kept in so that its address stays the same
+// across restarts.
+const onionKeyFileName = "onion_v3_private_key"
+
+// onionService is the Tor v3 onion service created through the Tor control
+// port for the inbound connections.  Tor forwards the connections to the
+// service to a listener bound to localhost.
+type onionService struct {
+	controller *connmgr.TorController
+	service    *connmgr.OnionService
+	listener   net.Listener
+	port       uint16
+}
+
+// newOnionService creates a listener on localhost and an onion service that
+// forwards the connections made to it on the default port of the network to
+// the listener through the Tor control port at the passed address.  The private
+// key of the service is loaded from the data directory, or saved there when a
+// new one is created.
+func newOnionService(dataDir, defaultPort, torControl, torPassword string) (*onionService, error) {
+	port, err := strconv.ParseUint(defaultPort, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFile := filepath.Join(dataDir, onionKeyFileName)
+	serialized, err := os.ReadFile(keyFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	privateKey := strings.TrimSpace(string(serialized))
+
+	controller, err := connmgr.DialTorController(torControl, torPassword)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the tor control "+
+			"port %s: %v", torControl, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		controller.Close()
+		return nil, err
+	}
+
+	service, err := controller.AddOnion(privateKey, uint16(port),
+		listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		controller.Close()
+		return nil, err
+	}
+	if service.PrivateKey != "" {
+		err := os.WriteFile(keyFile, []byte(service.PrivateKey+"\n"), 0600)
+		if err != nil {
+			srvrLog.Warnf("Unable to save the private key of the "+
+				"onion service to %s: %v", keyFile, err)
+		}
+	}
+
+	return &onionService{
+		controller: controller,
+		service:    service,
+		listener:   listener,
+		port:       uint16(port),
+	}, nil
+}
+
+// Addr returns the address of the onion service in the host:port format.
+func (o *onionService) Addr() string {
+	return net.JoinHostPort(o.service.Hostname(), strconv.Itoa(int(o.port)))
+}
+
+// useSocksListener routes the outbound connections to onion addresses through
+// the SOCKS listener of the Tor daemon the service was created with.  It's used
+// when no proxy that can reach them was configured.
+func (o *onionService) useSocksListener() error {
+	proxyAddr, err := o.controller.SocksListener()
+	if err != nil {
+		return err
+	}
+
+	cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		proxy := &socks.Proxy{
+			Addr:         proxyAddr,
+			TorIsolation: cfg.TorIsolation,
+		}
+		return proxy.DialTimeout(network, addr, timeout)
+	}
+	srvrLog.Infof("Connecting to onion addresses via the tor SOCKS "+
+		"proxy %s", proxyAddr)
+
+	// Onion addresses are now reachable unless the networks to connect to
+	// were restricted.
+	if len(cfg.OnlyNet) == 0 {
+		cfg.reachableNets[wire.NetworkOnion] = struct{}{}
+	}
+
+	return nil
+}
+
+// onionListener is the listener of the onion service.  The connections it
+// accepts are marked since they all come from Tor on localhost, so their
+// address doesn't tell the peers apart.
+type onionListener struct {
+	net.Listener
+}
+
+// Accept waits for and returns the next connection to the listener.
+//
+// This is part of the net.Listener interface.
+func (l *onionListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &onionConn{Conn: conn}, nil
+}
+
+// onionConn is a connection accepted by the listener of the onion service.
+type onionConn struct {
+	net.Conn
+}
+
+// isOnionConn returns whether the inbound connection was made to the onion
+// service.
+func isOnionConn(conn net.Conn) bool {
+	_, ok := conn.(*onionConn)
+	return ok
+}
+
+// Close removes the onion service by closing the connection to the Tor control
+// port.  The listener is closed by the connection manager.
+func (o *onionService) Close() error {
+	return o.controller.Close()
+}
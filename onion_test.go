@@ -0,0 +1,146 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/peer"
+)
+
+// TestOnionServiceKey ensures the private key of the onion service is saved to
+// the data directory and reused so that the address stays the same.
+func TestOnionServiceKey(t *testing.T) {
+	const serviceID = "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The mock control port accepts connections without authentication and
+	// only hands out the private key for new services.
+	addOnions := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.TrimSpace(line)
+					var reply string
+					switch {
+					case cmd == "PROTOCOLINFO 1":
+						reply = "250-AUTH METHODS=NULL\r\n250 OK\r\n"
+					case cmd == "AUTHENTICATE":
+						reply = "250 OK\r\n"
+					case strings.HasPrefix(cmd, "ADD_ONION NEW:"):
+						addOnions <- cmd
+						reply = "250-ServiceID=" + serviceID +
+							"\r\n250-PrivateKey=ED25519-V3:key\r\n" +
+							"250 OK\r\n"
+					case strings.HasPrefix(cmd, "ADD_ONION "):
+						addOnions <- cmd
+						reply = "250-ServiceID=" + serviceID +
+							"\r\n250 OK\r\n"
+					default:
+						reply = "510 Unrecognized command\r\n"
+					}
+					conn.Write([]byte(reply))
+				}
+			}(conn)
+		}
+	}()
+
+	dataDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		onion, err := newOnionService(dataDir, "8333",
+			listener.Addr().String(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if onion.Addr() != serviceID+".onion:8333" {
+			t.Fatalf("unexpected onion address %s", onion.Addr())
+		}
+		target := onion.listener.Addr().String()
+		onion.listener.Close()
+		onion.Close()
+
+		wantKey := "NEW:ED25519-V3"
+		if i > 0 {
+			wantKey = "ED25519-V3:key"
+		}
+		want := "ADD_ONION " + wantKey + " Port=8333," + target
+		if cmd := <-addOnions; cmd != want {
+			t.Fatalf("run %d: got %q, want %q", i, cmd, want)
+		}
+	}
+
+	key, err := os.ReadFile(filepath.Join(dataDir, onionKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "ED25519-V3:key\n" {
+		t.Fatalf("unexpected saved key %q", key)
+	}
+}
+
+// TestOnionPeersNotBanned ensures the connections accepted by the onion service
+// are marked and that banning their peers doesn't ban localhost, which all of
+// them come from.
+func TestOnionPeersNotBanned(t *testing.T) {
+	setLogLevels("off")
+
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ol := &onionListener{listener}
+	defer ol.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp4", ol.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := ol.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !isOnionConn(conn) {
+		t.Fatal("connection of the onion service isn't marked")
+	}
+	client, other := net.Pipe()
+	defer client.Close()
+	defer other.Close()
+	if isOnionConn(other) {
+		t.Fatal("connection of another listener is marked")
+	}
+
+	s := &server{}
+	state := &peerState{banned: make(map[string]time.Time)}
+	sp := &serverPeer{isOnion: true}
+	sp.Peer = peer.NewInboundPeer(&peer.Config{})
+	s.handleBanPeerMsg(state, sp)
+	if len(state.banned) != 0 {
+		t.Fatalf("onion service peer banned %v", state.banned)
+	}
+}
@@ -24,12 +24,13 @@ import (
 	"github.com/utreexo/utreexod/blockchain"
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/v2transport"
 	"github.com/utreexo/utreexod/wire"
 )
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// DefaultTrickleInterval is the min time between attempts to send an
 	// inv message to a peer.
@@ -102,6 +103,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -146,9 +150,40 @@ type MessageListeners struct {
 	// OnUtreexoProof is invoked when a peer receives a utreexo proof bitcoin message.
 	OnUtreexoProof func(p *Peer, msg *wire.MsgUtreexoProof)
 
+	// OnUtreexoRoot is invoked when a peer receives a utreexo root bitcoin message.
+	OnUtreexoRoot func(p *Peer, msg *wire.MsgUtreexoRoot)
+
 	// OnGetUtreexoProof is invoked when a peer receives a utreexo proof bitcoin message.
 	OnGetUtreexoProof func(p *Peer, msg *wire.MsgGetUtreexoProof)
 
+	// OnUtreexoTxProof is invoked when a peer receives a utxproof bitcoin
+	// message.
+	OnUtreexoTxProof func(p *Peer, msg *wire.MsgUtreexoTxProof)
+
+	// OnGetUtreexoTxProof is invoked when a peer receives a getutxproof
+	// bitcoin message.
+	OnGetUtreexoTxProof func(p *Peer, msg *wire.MsgGetUtreexoTxProof)
+
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
+	// OnProofAuth is invoked when a peer receives a proofauth utreexo
+	// message.
+	OnProofAuth func(p *Peer, msg *wire.MsgProofAuth)
+
 	// OnNotFound is invoked when a peer receives a notfound bitcoin
 	// message.
 	OnNotFound func(p *Peer, msg *wire.MsgNotFound)
@@ -217,6 +252,10 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 bitcoin
+	// message.
+	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -292,6 +331,12 @@ type Config struct {
 	// inventory to a peer.
 	TrickleInterval time.Duration
 
+	// V2Transport specifies whether to use the v2 encrypted transport
+	// defined by BIP0324.  Outbound peers start with its handshake, while
+	// inbound peers use it unless the remote peer starts with a version
+	// message of the v1 transport.
+	V2Transport bool
+
 	// AllowSelfConns is only used to allow the tests to bypass the self
 	// connection detecting and disconnect logic since they intentionally
 	// do so for testing purposes.
@@ -400,6 +445,8 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	V2Transport    bool
+	SessionID      []byte
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -412,7 +459,7 @@ type AddrFunc func(remoteAddr *wire.NetAddress) *wire.NetAddress
 // HostToNetAddrFunc is a func which takes a host, port, services and returns
 // the netaddress.
 type HostToNetAddrFunc func(host string, port uint16,
-	services wire.ServiceFlag) (*wire.NetAddress, error)
+	services wire.ServiceFlag) (*wire.NetAddressV2, error)
 
 // NOTE: The overall data flow of a peer is split into 3 goroutines.  Inbound
 // messages are read via the inHandler goroutine and generally dispatched to
@@ -458,7 +505,7 @@ type Peer struct {
 	inbound bool
 
 	flagsMtx             sync.Mutex // protects the peer flags below
-	na                   *wire.NetAddress
+	na                   *wire.NetAddressV2
 	id                   int32
 	userAgent            string
 	services             wire.ServiceFlag
@@ -466,12 +513,21 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
 	verAckReceived       bool
 	witnessEnabled       bool
 	utreexoEnabled       bool
+	v2KeyReceived        bool   // remote public key of the v2 handshake received
+	sessionID            []byte // session id of the v2 transport
 
 	wireEncoding wire.MessageEncoding
 
+	// v1Reader is what messages of the v1 transport are read from and
+	// v2Transport is used instead when the v2 transport is negotiated.
+	// They are set during the negotiation and never modified after.
+	v1Reader    io.Reader
+	v2Transport *v2transport.Transport
+
 	knownInventory     lru.Cache
 	prevGetBlocksMtx   sync.Mutex
 	prevGetBlocksBegin *chainhash.Hash
@@ -558,6 +614,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	userAgent := p.userAgent
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
+	sessionID := p.sessionID
 	p.flagsMtx.Unlock()
 
 	// Get a copy of all relevant flags and stats.
@@ -579,6 +636,8 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+		V2Transport:    sessionID != nil,
+		SessionID:      sessionID,
 	}
 
 	p.statsMtx.RUnlock()
@@ -599,7 +658,7 @@ func (p *Peer) ID() int32 {
 // NA returns the peer network address.
 //
 // This function is safe for concurrent access.
-func (p *Peer) NA() *wire.NetAddress {
+func (p *Peer) NA() *wire.NetAddressV2 {
 	p.flagsMtx.Lock()
 	na := p.na
 	p.flagsMtx.Unlock()
@@ -822,6 +881,48 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsAddrV2 returns if the peer supports addrv2 messages instead of the
+// legacy addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	wantsAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return wantsAddrV2
+}
+
+// V2Transport returns whether the connection to the peer uses the v2
+// encrypted transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2Transport() bool {
+	p.flagsMtx.Lock()
+	v2Transport := p.sessionID != nil
+	p.flagsMtx.Unlock()
+
+	return v2Transport
+}
+
+// ShouldReconnectV1 returns whether the peer should be reconnected to with the
+// v1 transport.  This is the case for outbound peers that disconnected
+// before sending their public key for the v2 handshake, which most likely
+// means they don't support the v2 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) ShouldReconnectV1() bool {
+	if p.inbound || !p.cfg.V2Transport {
+		return false
+	}
+
+	p.flagsMtx.Lock()
+	keyReceived := p.v2KeyReceived
+	p.flagsMtx.Unlock()
+
+	return !keyReceived
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -882,6 +983,42 @@ func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, er
 	return msg.AddrList, nil
 }
 
+// PushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.  Like PushAddrMsg, it limits the addresses to the
+// maximum number allowed by the message and randomizes the chosen addresses
+// when there are too many.  It returns the addresses that were actually sent
+// and no message will be sent if there are no entries in the provided
+// addresses slice.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PushAddrV2Msg(addresses []*wire.NetAddressV2) ([]*wire.NetAddressV2, error) {
+	addressCount := len(addresses)
+
+	// Nothing to send.
+	if addressCount == 0 {
+		return nil, nil
+	}
+
+	msg := wire.NewMsgAddrV2()
+	msg.AddrList = make([]*wire.NetAddressV2, addressCount)
+	copy(msg.AddrList, addresses)
+
+	// Randomize the addresses sent if there are more than the maximum allowed.
+	if addressCount > wire.MaxV2AddrPerMsg {
+		// Shuffle the address list.
+		for i := 0; i < wire.MaxV2AddrPerMsg; i++ {
+			j := i + rand.Intn(addressCount-i)
+			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+		}
+
+		// Truncate it to the maximum size.
+		msg.AddrList = msg.AddrList[:wire.MaxV2AddrPerMsg]
+	}
+
+	p.QueueMessage(msg, nil)
+	return msg.AddrList, nil
+}
+
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
 // and stop hash.  It will ignore back-to-back duplicate requests.
 //
@@ -1044,8 +1181,17 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	var n int
+	var msg wire.Message
+	var buf []byte
+	var err error
+	if p.v2Transport != nil {
+		n, msg, buf, err = p.v2Transport.ReadMessage(p.ProtocolVersion(),
+			encoding)
+	} else {
+		n, msg, buf, err = wire.ReadMessageWithEncodingN(p.v1Reader,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	}
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
@@ -1109,8 +1255,14 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	var n int
+	var err error
+	if p.v2Transport != nil {
+		n, err = p.v2Transport.WriteMessage(msg, p.ProtocolVersion(), enc)
+	} else {
+		n, err = wire.WriteMessageWithEncodingN(p.conn, msg,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
@@ -1378,6 +1530,17 @@ out:
 		rmsg, buf, err := p.readMessage(p.wireEncoding)
 		idleTimer.Stop()
 		if err != nil {
+			// Messages this peer doesn't know about are ignored like
+			// bitcoind does since other implementations may send
+			// messages after the handshake that they haven't
+			// negotiated.
+			if err == wire.ErrUnknownMessage {
+				log.Debugf("Received unknown message from %s: %v",
+					p, err)
+				idleTimer.Reset(idleTimeout)
+				continue
+			}
+
 			// In order to allow regression tests with malformed messages, don't
 			// disconnect the peer when we're in regression test mode and the
 			// error is one of the allowed errors.
@@ -1428,6 +1591,11 @@ out:
 			)
 			break out
 
+		case *wire.MsgSendAddrV2:
+			// Disconnect if peer sends this after the handshake is
+			// completed.
+			break out
+
 		case *wire.MsgGetAddr:
 			if p.cfg.Listeners.OnGetAddr != nil {
 				p.cfg.Listeners.OnGetAddr(p, msg)
@@ -1438,6 +1606,11 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1495,11 +1668,51 @@ out:
 				p.cfg.Listeners.OnUtreexoProof(p, msg)
 			}
 
+		case *wire.MsgUtreexoRoot:
+			if p.cfg.Listeners.OnUtreexoRoot != nil {
+				p.cfg.Listeners.OnUtreexoRoot(p, msg)
+			}
+
 		case *wire.MsgGetUtreexoProof:
 			if p.cfg.Listeners.OnGetUtreexoProof != nil {
 				p.cfg.Listeners.OnGetUtreexoProof(p, msg)
 			}
 
+		case *wire.MsgUtreexoTxProof:
+			if p.cfg.Listeners.OnUtreexoTxProof != nil {
+				p.cfg.Listeners.OnUtreexoTxProof(p, msg)
+			}
+
+		case *wire.MsgGetUtreexoTxProof:
+			if p.cfg.Listeners.OnGetUtreexoTxProof != nil {
+				p.cfg.Listeners.OnGetUtreexoTxProof(p, msg)
+			}
+
+		case *wire.MsgSendCmpct:
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
+		case *wire.MsgProofAuth:
+			if p.cfg.Listeners.OnProofAuth != nil {
+				p.cfg.Listeners.OnProofAuth(p, msg)
+			}
+
 		case *wire.MsgNotFound:
 			if p.cfg.Listeners.OnNotFound != nil {
 				p.cfg.Listeners.OnNotFound(p, msg)
@@ -2138,29 +2351,8 @@ func (p *Peer) readRemoteVersionMsg() error {
 	return nil
 }
 
-// readRemoteVerAckMsg waits for the next message to arrive from the remote
-// peer. If this message is not a verack message, then an error is returned.
-// This method is to be used as part of the version negotiation upon a new
-// connection.
-func (p *Peer) readRemoteVerAckMsg() error {
-	// Read the next message from the wire.
-	remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
-	if err != nil {
-		return err
-	}
-
-	// It should be a verack message, otherwise send a reject message to the
-	// peer explaining why.
-	msg, ok := remoteMsg.(*wire.MsgVerAck)
-	if !ok {
-		reason := "a verack message must follow version"
-		rejectMsg := wire.NewMsgReject(
-			msg.Command(), wire.RejectMalformed, reason,
-		)
-		_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
-		return errors.New(reason)
-	}
-
+// processRemoteVerAckMsg takes the verack from the remote peer and handles it.
+func (p *Peer) processRemoteVerAckMsg(msg *wire.MsgVerAck) {
 	p.flagsMtx.Lock()
 	p.verAckReceived = true
 	p.flagsMtx.Unlock()
@@ -2168,8 +2360,6 @@ func (p *Peer) readRemoteVerAckMsg() error {
 	if p.cfg.Listeners.OnVerAck != nil {
 		p.cfg.Listeners.OnVerAck(p, msg)
 	}
-
-	return nil
 }
 
 // localVersionMsg creates a version message that can be used to send to the
@@ -2184,7 +2374,13 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 		}
 	}
 
-	theirNA := p.na
+	// Onion and i2p addresses can't be sent in the version message so an
+	// unroutable address with their port is sent instead.
+	theirNA := p.na.ToLegacy()
+	if theirNA == nil {
+		theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}),
+			p.na.Port, p.na.Services)
+	}
 
 	// If we are behind a proxy and the connection comes from the proxy then
 	// we return an unroutable address as their address. This is to prevent
@@ -2192,7 +2388,7 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 	if p.cfg.Proxy != "" {
 		proxyaddress, _, err := net.SplitHostPort(p.cfg.Proxy)
 		// invalid proxy means poorly configured, be on the safe side.
-		if err != nil || p.na.IP.String() == proxyaddress {
+		if err != nil || p.na.Addr.String() == proxyaddress {
 			theirNA = wire.NewNetAddressIPPort(net.IP([]byte{0, 0, 0, 0}), 0,
 				theirNA.Services)
 		}
@@ -2244,14 +2440,135 @@ func (p *Peer) writeLocalVersionMsg() error {
 	return p.writeMessage(localVerMsg, wire.LatestEncoding)
 }
 
+// writeSendAddrV2Msg writes our sendaddrv2 message to the remote peer if the
+// negotiated protocol version is AddrV2Version or above.
+func (p *Peer) writeSendAddrV2Msg(pver uint32) error {
+	if pver < wire.AddrV2Version {
+		return nil
+	}
+
+	return p.writeMessage(wire.NewMsgSendAddrV2(), wire.LatestEncoding)
+}
+
+// waitToFinishNegotiation waits until the remote peer sends its verack,
+// recording whether it would like to receive addrv2 messages if it sends a
+// sendaddrv2 message before.  Unknown messages are skipped as they may be
+// other messages sent during the handshake, like wtxidrelay, that aren't
+// implemented.  Any other message is an error.
+func (p *Peer) waitToFinishNegotiation(pver uint32) error {
+	for {
+		remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
+		if err == wire.ErrUnknownMessage {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		switch msg := remoteMsg.(type) {
+		case *wire.MsgSendAddrV2:
+			if pver >= wire.AddrV2Version {
+				p.flagsMtx.Lock()
+				p.sendAddrV2 = true
+				p.flagsMtx.Unlock()
+
+				if p.cfg.Listeners.OnSendAddrV2 != nil {
+					p.cfg.Listeners.OnSendAddrV2(p, msg)
+				}
+			}
+
+		case *wire.MsgVerAck:
+			// Receiving a verack means we are done with the
+			// handshake.
+			p.processRemoteVerAckMsg(msg)
+			return nil
+
+		default:
+			reason := "a verack message must follow version"
+			rejectMsg := wire.NewMsgReject(
+				msg.Command(), wire.RejectMalformed, reason,
+			)
+			_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
+			return wire.ErrInvalidHandshake
+		}
+	}
+}
+
+// negotiateTransport performs the handshake of the v2 transport when it's
+// enabled.  Inbound peers that start with a version message of the v1
+// transport keep using it instead.
+func (p *Peer) negotiateTransport() error {
+	p.v1Reader = p.conn
+	if !p.cfg.V2Transport {
+		return nil
+	}
+
+	r := io.Reader(p.conn)
+	if p.inbound {
+		// Read enough to tell whether the remote peer sends a v1
+		// version message and put the bytes back in front of the rest
+		// of the connection.
+		prefix := make([]byte, v2transport.V1PrefixSize)
+		if _, err := io.ReadFull(p.conn, prefix); err != nil {
+			return err
+		}
+		r = io.MultiReader(bytes.NewReader(prefix), p.conn)
+		if bytes.Equal(prefix, v2transport.V1Prefix(p.cfg.ChainParams.Net)) {
+			log.Debugf("Using v1 transport with inbound peer %v", p)
+			p.v1Reader = r
+			return nil
+		}
+	}
+
+	h, err := v2transport.NewHandshake(r, p.conn, p.cfg.ChainParams.Net,
+		!p.inbound)
+	if err != nil {
+		return err
+	}
+
+	// The initiator sends its key first.
+	if !p.inbound {
+		if err := h.SendKey(); err != nil {
+			return err
+		}
+	}
+	if err := h.ReceiveKey(); err != nil {
+		return err
+	}
+	p.flagsMtx.Lock()
+	p.v2KeyReceived = true
+	p.flagsMtx.Unlock()
+	if p.inbound {
+		if err := h.SendKey(); err != nil {
+			return err
+		}
+	}
+
+	transport, err := h.Finish()
+	if err != nil {
+		return err
+	}
+	sessionID := transport.SessionID()
+	log.Debugf("Using v2 transport with peer %v (session id %x)", p,
+		sessionID)
+
+	p.v2Transport = transport
+	p.flagsMtx.Lock()
+	p.sessionID = sessionID[:]
+	p.flagsMtx.Unlock()
+
+	return nil
+}
+
 // negotiateInboundProtocol performs the negotiation protocol for an inbound
 // peer. The events should occur in the following order, otherwise an error is
 // returned:
 //
 //  1. Remote peer sends their version.
 //  2. We send our version.
-//  3. We send our verack.
-//  4. Remote peer sends their verack.
+//  3. We send sendaddrv2 if the negotiated version is >= AddrV2Version.
+//  4. We send our verack.
+//  5. Remote peer sends their verack, optionally preceded by sendaddrv2 and
+//     unknown messages.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
@@ -2261,12 +2578,17 @@ func (p *Peer) negotiateInboundProtocol() error {
 		return err
 	}
 
+	pver := p.ProtocolVersion()
+	if err := p.writeSendAddrV2Msg(pver); err != nil {
+		return err
+	}
+
 	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 	if err != nil {
 		return err
 	}
 
-	return p.readRemoteVerAckMsg()
+	return p.waitToFinishNegotiation(pver)
 }
 
 // negotiateOutboundProtocol performs the negotiation protocol for an outbound
@@ -2275,8 +2597,10 @@ func (p *Peer) negotiateInboundProtocol() error {
 //
 //  1. We send our version.
 //  2. Remote peer sends their version.
-//  3. Remote peer sends their verack.
+//  3. We send sendaddrv2 if the negotiated version is >= AddrV2Version.
 //  4. We send our verack.
+//  5. Remote peer sends their verack, optionally preceded by sendaddrv2 and
+//     unknown messages.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
@@ -2286,11 +2610,17 @@ func (p *Peer) negotiateOutboundProtocol() error {
 		return err
 	}
 
-	if err := p.readRemoteVerAckMsg(); err != nil {
+	pver := p.ProtocolVersion()
+	if err := p.writeSendAddrV2Msg(pver); err != nil {
 		return err
 	}
 
-	return p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
+	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
+	if err != nil {
+		return err
+	}
+
+	return p.waitToFinishNegotiation(pver)
 }
 
 // start begins processing input and output messages.
@@ -2299,6 +2629,11 @@ func (p *Peer) start() error {
 
 	negotiateErr := make(chan error, 1)
 	go func() {
+		if err := p.negotiateTransport(); err != nil {
+			negotiateErr <- err
+			return
+		}
+
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
 		} else {
@@ -2353,7 +2688,7 @@ func (p *Peer) AssociateConnection(conn net.Conn) {
 			p.Disconnect()
 			return
 		}
-		p.na = na
+		p.na = wire.NetAddressV2FromLegacy(na)
 	}
 
 	go func() {
@@ -2441,7 +2776,14 @@ func NewOutboundPeer(cfg *Config, addr string) (*Peer, error) {
 		}
 		p.na = na
 	} else {
-		p.na = wire.NewNetAddressIPPort(net.ParseIP(host), uint16(port), 0)
+		// If host is an onion or i2p address or a hostname, it can't
+		// be parsed as an IP.  The caller should set HostToNetAddress
+		// if connecting to these.
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("unable to parse IP %s", host)
+		}
+		p.na = wire.NetAddressV2FromBytes(time.Now(), 0, ip, uint16(port))
 	}
 
 	return p, nil
@@ -6,10 +6,12 @@
 package peer_test
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"net"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -77,18 +79,71 @@ type addr struct {
 func (m addr) Network() string { return m.net }
 func (m addr) String() string  { return m.address }
 
+// bufferedPipe is an in-memory pipe whose writes don't wait for a reader.  Both
+// sides of a connection write several messages in a row during the handshake
+// so a synchronous pipe like io.Pipe would deadlock.
+type bufferedPipe struct {
+	mtx    sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+}
+
+// newBufferedPipe returns a new empty buffered pipe.
+func newBufferedPipe() *bufferedPipe {
+	p := &bufferedPipe{}
+	p.cond = sync.NewCond(&p.mtx)
+	return p
+}
+
+// Read waits until there's data in the pipe or it's closed.
+func (p *bufferedPipe) Read(b []byte) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.buf.Read(b)
+}
+
+// Write adds the data to the pipe.
+func (p *bufferedPipe) Write(b []byte) (int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n, err := p.buf.Write(b)
+	p.cond.Broadcast()
+	return n, err
+}
+
+// Close closes the pipe.  The reader gets io.EOF once the buffered data is read.
+func (p *bufferedPipe) Close() error {
+	p.mtx.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mtx.Unlock()
+	return nil
+}
+
 // pipe turns two mock connections into a full-duplex connection similar to
 // net.Pipe to allow pipe's with (fake) addresses.
 func pipe(c1, c2 *conn) (*conn, *conn) {
-	r1, w1 := io.Pipe()
-	r2, w2 := io.Pipe()
+	p1 := newBufferedPipe()
+	p2 := newBufferedPipe()
 
-	c1.Writer = w1
-	c1.Closer = w1
-	c2.Reader = r1
-	c1.Reader = r2
-	c2.Writer = w2
-	c2.Closer = w2
+	c1.Writer = p1
+	c1.Closer = p1
+	c2.Reader = p1
+	c1.Reader = p2
+	c2.Writer = p2
+	c2.Closer = p2
 
 	return c1, c2
 }
@@ -359,7 +414,7 @@ func TestPeerConnection(t *testing.T) {
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
-	ok := make(chan wire.Message, 20)
+	ok := make(chan wire.Message, 22)
 	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnGetAddr: func(p *peer.Peer, msg *wire.MsgGetAddr) {
@@ -447,6 +502,12 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendAddrV2: func(p *peer.Peer, msg *wire.MsgSendAddrV2) {
+				ok <- msg
+			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				ok <- msg
+			},
 		},
 		UserAgentName:     "peer",
 		UserAgentVersion:  "1.0",
@@ -597,6 +658,14 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendAddrV2",
+			wire.NewMsgSendAddrV2(),
+		},
+		{
+			"OnAddrV2",
+			wire.NewMsgAddrV2(),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -989,3 +1058,214 @@ func TestUpdateLastBlockHeight(t *testing.T) {
 			remotePeerHeight+1)
 	}
 }
+
+// TestSendAddrV2Handshake tests that the version-verack handshake with the
+// addition of the sendaddrv2 message works as expected.
+func TestSendAddrV2Handshake(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	sendaddr := make(chan struct{}, 2)
+	peer1Cfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnSendAddrV2: func(p *peer.Peer,
+				msg *wire.MsgSendAddrV2) {
+
+				sendaddr <- struct{}{}
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	peer2Cfg := &peer.Config{
+		Listeners:      peer1Cfg.Listeners,
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	tests := []struct {
+		name        string
+		inVersion   uint32
+		outVersion  uint32
+		expectsV2   bool
+		numMessages int
+	}{
+		{
+			name:        "successful sendaddrv2 handshake",
+			expectsV2:   true,
+			numMessages: 4,
+		},
+		{
+			name:        "handshake with legacy inbound peer",
+			inVersion:   wire.AddrV2Version - 1,
+			numMessages: 2,
+		},
+		{
+			name:        "handshake with legacy outbound peer",
+			outVersion:  wire.AddrV2Version - 1,
+			numMessages: 2,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		peer1Cfg.ProtocolVersion = test.inVersion
+		peer2Cfg.ProtocolVersion = test.outVersion
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(peer1Cfg)
+		inPeer.AssociateConnection(inConn)
+
+		outPeer, err := peer.NewOutboundPeer(peer2Cfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		for j := 0; j < test.numMessages; j++ {
+			select {
+			case <-sendaddr:
+			case <-verack:
+			case <-time.After(time.Second * 2):
+				t.Fatalf("TestSendAddrV2Handshake #%d (%s): "+
+					"verack timeout", i, test.name)
+			}
+		}
+
+		if inPeer.WantsAddrV2() != test.expectsV2 {
+			t.Fatalf("TestSendAddrV2Handshake #%d expected "+
+				"wantsAddrV2 to be %v instead was %v", i,
+				test.expectsV2, inPeer.WantsAddrV2())
+		} else if outPeer.WantsAddrV2() != test.expectsV2 {
+			t.Fatalf("TestSendAddrV2Handshake #%d expected "+
+				"wantsAddrV2 to be %v instead was %v", i,
+				test.expectsV2, outPeer.WantsAddrV2())
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
+
+// TestV2TransportHandshake tests that peers use the v2 transport when both
+// sides support it, that inbound peers fall back to the v1 transport for
+// remote peers that use it, and that outbound peers that fail to get the
+// public key of the remote peer ask to be reconnected with the v1 transport.
+func TestV2TransportHandshake(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	peer1Cfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	peer2Cfg := &peer.Config{
+		Listeners:      peer1Cfg.Listeners,
+		AllowSelfConns: true,
+		ChainParams:    &chaincfg.MainNetParams,
+	}
+
+	tests := []struct {
+		name        string
+		inV2        bool
+		outV2       bool
+		expectsV2   bool
+		reconnectV1 bool
+	}{
+		{
+			name:      "v2 transport handshake",
+			inV2:      true,
+			outV2:     true,
+			expectsV2: true,
+		},
+		{
+			name:  "v1 outbound peer with v2 inbound peer",
+			inV2:  true,
+			outV2: false,
+		},
+		{
+			name:        "v2 outbound peer with v1 inbound peer",
+			inV2:        false,
+			outV2:       true,
+			reconnectV1: true,
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		peer1Cfg.V2Transport = test.inV2
+		peer2Cfg.V2Transport = test.outV2
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(peer1Cfg)
+		inPeer.AssociateConnection(inConn)
+
+		outPeer, err := peer.NewOutboundPeer(peer2Cfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		if test.reconnectV1 {
+			// The inbound peer disconnects when it gets the public
+			// key instead of a version message.
+			inPeer.WaitForDisconnect()
+			outConn.Close()
+			outPeer.WaitForDisconnect()
+			if !outPeer.ShouldReconnectV1() {
+				t.Fatalf("TestV2TransportHandshake #%d (%s): "+
+					"expected to reconnect with v1", i,
+					test.name)
+			}
+			continue
+		}
+
+		for j := 0; j < 2; j++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second * 2):
+				t.Fatalf("TestV2TransportHandshake #%d (%s): "+
+					"verack timeout", i, test.name)
+			}
+		}
+
+		if inPeer.V2Transport() != test.expectsV2 {
+			t.Fatalf("TestV2TransportHandshake #%d expected inbound "+
+				"v2 transport to be %v instead was %v", i,
+				test.expectsV2, inPeer.V2Transport())
+		} else if outPeer.V2Transport() != test.expectsV2 {
+			t.Fatalf("TestV2TransportHandshake #%d expected outbound "+
+				"v2 transport to be %v instead was %v", i,
+				test.expectsV2, outPeer.V2Transport())
+		}
+		inID := inPeer.StatsSnapshot().SessionID
+		outID := outPeer.StatsSnapshot().SessionID
+		if !bytes.Equal(inID, outID) {
+			t.Fatalf("TestV2TransportHandshake #%d session ids "+
+				"differ: %x and %x", i, inID, outID)
+		}
+		if outPeer.ShouldReconnectV1() {
+			t.Fatalf("TestV2TransportHandshake #%d (%s): unexpected "+
+				"reconnect with v1", i, test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+// peerRefusal is the reason a peer is refused by the connection policies once
+// its version is known.
+type peerRefusal uint8
+
+const (
+	// refusalNone is returned for peers that aren't refused.
+	refusalNone peerRefusal = iota
+
+	// refusalAgentBlacklisted is returned for peers with a user agent that
+	// contains one of the blacklisted substrings.
+	refusalAgentBlacklisted
+
+	// refusalAgentNotWhitelisted is returned for peers with a user agent
+	// that contains none of the whitelisted substrings.
+	refusalAgentNotWhitelisted
+
+	// refusalServicesRejected is returned for peers that advertise one of
+	// the rejected sets of services.
+	refusalServicesRejected
+)
+
+// String returns the peerRefusal as a human-readable reason.
+func (r peerRefusal) String() string {
+	switch r {
+	case refusalNone:
+		return "not refused"
+	case refusalAgentBlacklisted:
+		return "user agent is blacklisted"
+	case refusalAgentNotWhitelisted:
+		return "user agent is not whitelisted"
+	case refusalServicesRejected:
+		return "services are rejected"
+	}
+	return "unknown refusal"
+}
+
+// peerPolicyStats counts the peers that the connection policies refused or
+// deprioritized since the server started.
+//
+// The fields must only be used atomically.
+type peerPolicyStats struct {
+	agentBlacklisted       uint64
+	agentNotWhitelisted    uint64
+	servicesRejected       uint64
+	deprioritized          uint64
+	deprioritizedEvicted   uint64
+	proofRequestsThrottled uint64
+}
+
+// peerPolicyCounts is a snapshot of the peerPolicyStats.
+type peerPolicyCounts struct {
+	AgentBlacklisted       uint64
+	AgentNotWhitelisted    uint64
+	ServicesRejected       uint64
+	Deprioritized          uint64
+	DeprioritizedEvicted   uint64
+	ProofRequestsThrottled uint64
+}
+
+// containsAny returns whether the user agent contains any of the substrings.
+func containsAny(agent string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(agent, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseServiceFlags parses the service flags given as numbers such as 0 or
+// 0x1000009.
+func parseServiceFlags(strs []string) ([]wire.ServiceFlag, error) {
+	var flags []wire.ServiceFlag
+	for _, str := range strs {
+		flag, err := strconv.ParseUint(str, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service flags '%s'", str)
+		}
+		flags = append(flags, wire.ServiceFlag(flag))
+	}
+	return flags, nil
+}
+
+// checkPeerPolicy returns why a peer with the given user agent and services is
+// refused or refusalNone when it isn't.  The blacklist is applied before the
+// whitelist and an empty whitelist allows every user agent.  A peer is refused
+// for its services only when they're exactly one of the rejected sets so that,
+// for example, peers advertising no services at all can be refused without
+// refusing anyone else.
+func checkPeerPolicy(agent string, services wire.ServiceFlag, blacklist,
+	whitelist []string, rejectServices []wire.ServiceFlag) peerRefusal {
+
+	if containsAny(agent, blacklist) {
+		return refusalAgentBlacklisted
+	}
+	if len(whitelist) > 0 && !containsAny(agent, whitelist) {
+		return refusalAgentNotWhitelisted
+	}
+	for _, rejected := range rejectServices {
+		if services == rejected {
+			return refusalServicesRejected
+		}
+	}
+
+	return refusalNone
+}
+
+// refusedByPolicy returns whether the peer is refused by the connection
+// policies and counts the refusal if it is.
+func (s *server) refusedByPolicy(sp *serverPeer) bool {
+	refusal := checkPeerPolicy(sp.UserAgent(), sp.Services(),
+		s.agentBlacklist, s.agentWhitelist, cfg.rejectServices)
+
+	var counter *uint64
+	switch refusal {
+	case refusalNone:
+		return false
+	case refusalAgentBlacklisted:
+		counter = &s.policyStats.agentBlacklisted
+	case refusalAgentNotWhitelisted:
+		counter = &s.policyStats.agentNotWhitelisted
+	case refusalServicesRejected:
+		counter = &s.policyStats.servicesRejected
+	}
+	atomic.AddUint64(counter, 1)
+
+	srvrLog.Debugf("Ignoring peer %s with user agent %s and services %v: %v",
+		sp, sp.UserAgent(), sp.Services(), refusal)
+	return true
+}
+
+// isDeprioritized returns whether the peer's user agent contains one of the
+// substrings of --agentdeprioritize.  Deprioritized peers are the first inbound
+// peers to go when the server is full and only get one utreexo proof served at
+// a time.
+func (sp *serverPeer) isDeprioritized() bool {
+	return containsAny(sp.UserAgent(), cfg.AgentDeprioritize)
+}
+
+// deprioritizedEvictionCandidate returns the inbound deprioritized peer to
+// disconnect to make room for a peer that isn't deprioritized or nil if there
+// isn't one.  The peer that was connected the shortest is picked.
+func (ps *peerState) deprioritizedEvictionCandidate() *serverPeer {
+	var candidate *serverPeer
+	for _, sp := range ps.inboundPeers {
+		if !sp.isDeprioritized() {
+			continue
+		}
+		if candidate == nil || sp.ID() > candidate.ID() {
+			candidate = sp
+		}
+	}
+	return candidate
+}
+
+// tooManyPendingProofs returns the number of utreexo proofs requested by the
+// peer that are waiting to be sent out and whether further requests should be
+// ignored because of it.  Deprioritized peers only get one proof served at a
+// time and the requests they get ignored for are counted.  Peers that
+// authenticated as proof clients are never limited.
+func (sp *serverPeer) tooManyPendingProofs() (int32, bool) {
+	pending := atomic.LoadInt32(&sp.pendingProofs)
+	if sp.isProofAuthenticated() {
+		return pending, false
+	}
+	if int(pending) >= cfg.MaxPeerProofRequests {
+		return pending, true
+	}
+	if pending >= 1 && sp.isDeprioritized() {
+		atomic.AddUint64(&sp.server.policyStats.proofRequestsThrottled, 1)
+		return pending, true
+	}
+	return pending, false
+}
+
+// PeerPolicyCounts returns the counts of the peers the connection policies
+// refused or deprioritized since the server started.  It is safe for
+// concurrent access.
+func (s *server) PeerPolicyCounts() peerPolicyCounts {
+	stats := &s.policyStats
+	return peerPolicyCounts{
+		AgentBlacklisted:       atomic.LoadUint64(&stats.agentBlacklisted),
+		AgentNotWhitelisted:    atomic.LoadUint64(&stats.agentNotWhitelisted),
+		ServicesRejected:       atomic.LoadUint64(&stats.servicesRejected),
+		Deprioritized:          atomic.LoadUint64(&stats.deprioritized),
+		DeprioritizedEvicted:   atomic.LoadUint64(&stats.deprioritizedEvicted),
+		ProofRequestsThrottled: atomic.LoadUint64(&stats.proofRequestsThrottled),
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestParseServiceFlags(t *testing.T) {
+	flags, err := parseServiceFlags([]string{"0", "0x1000009", "1033"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []wire.ServiceFlag{0, 0x1000009, 1033}
+	if !reflect.DeepEqual(flags, want) {
+		t.Fatalf("expected %v, got %v", want, flags)
+	}
+
+	for _, str := range []string{"", "network", "-1", "0x10000000000000000"} {
+		if _, err := parseServiceFlags([]string{str}); err == nil {
+			t.Fatalf("expected an error for '%s'", str)
+		}
+	}
+}
+
+func TestCheckPeerPolicy(t *testing.T) {
+	const full = wire.SFNodeNetwork | wire.SFNodeWitness | wire.SFNodeUtreexo
+
+	tests := []struct {
+		name      string
+		agent     string
+		services  wire.ServiceFlag
+		blacklist []string
+		whitelist []string
+		reject    []wire.ServiceFlag
+		want      peerRefusal
+	}{
+		{
+			name:     "no policies",
+			agent:    "/btcwire:0.5.0/utreexod:0.3.0/",
+			services: full,
+			want:     refusalNone,
+		},
+		{
+			name:      "blacklisted",
+			agent:     "/scraper:1.0/",
+			services:  full,
+			blacklist: []string{"scraper"},
+			want:      refusalAgentBlacklisted,
+		},
+		{
+			name:      "blacklist before whitelist",
+			agent:     "/utreexod:0.3.0/scraper:1.0/",
+			services:  full,
+			blacklist: []string{"scraper"},
+			whitelist: []string{"utreexod"},
+			want:      refusalAgentBlacklisted,
+		},
+		{
+			name:      "not whitelisted",
+			agent:     "/Satoshi:27.0.0/",
+			services:  full,
+			whitelist: []string{"utreexod"},
+			want:      refusalAgentNotWhitelisted,
+		},
+		{
+			name:     "rejected services",
+			agent:    "/utreexod:0.3.0/",
+			services: 0,
+			reject:   []wire.ServiceFlag{0},
+			want:     refusalServicesRejected,
+		},
+		{
+			name:     "services only rejected when exact",
+			agent:    "/utreexod:0.3.0/",
+			services: full,
+			reject:   []wire.ServiceFlag{0, wire.SFNodeNetwork},
+			want:     refusalNone,
+		},
+	}
+
+	for _, test := range tests {
+		got := checkPeerPolicy(test.agent, test.services,
+			test.blacklist, test.whitelist, test.reject)
+		if got != test.want {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.want,
+				got)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/utreexo/utreexod/btcjson"
+)
+
+const (
+	// proofSourceP2P, proofSourceRPC and proofSourceREST are where a served
+	// utreexo proof was asked for.
+	proofSourceP2P  = "p2p"
+	proofSourceRPC  = "rpc"
+	proofSourceREST = "rest"
+
+	// proofClientsNone, proofClientsTruncated and proofClientsFull are the
+	// values of --proofaccessclients.  With none the clients aren't told
+	// apart, with truncated they're told apart by the /24 of their IPv4 or
+	// the /48 of their IPv6 address and with full by their whole address.
+	proofClientsNone      = "none"
+	proofClientsTruncated = "truncated"
+	proofClientsFull      = "full"
+
+	// maxProofAccessClients is the number of clients whose served proofs are
+	// counted separately.  The proofs served to any clients past that are
+	// lumped together so that the counts can't grow without bound.
+	maxProofAccessClients = 1000
+
+	// proofAccessOtherClients is the name of the clients past the first
+	// maxProofAccessClients.
+	proofAccessOtherClients = "other"
+)
+
+// proofDepthBuckets are the upper bounds of how many blocks below the tip the
+// block of a served proof is that the proofs are counted by.  They're roughly an
+// hour, a day, a week and a year worth of blocks.  The proofs of the blocks
+// deeper than the last bound are counted in a bucket of their own.
+var proofDepthBuckets = []struct {
+	max   int32
+	label string
+}{
+	{5, "0-5"},
+	{143, "6-143"},
+	{1007, "144-1007"},
+	{52559, "1008-52559"},
+}
+
+// proofSizeBuckets are the upper bounds of the number of targets of a served
+// proof that the proofs are counted by.  The proofs with more targets than the
+// last bound are counted in a bucket of their own.
+var proofSizeBuckets = []struct {
+	max   int
+	label string
+}{
+	{1, "1"},
+	{10, "2-10"},
+	{100, "11-100"},
+	{1000, "101-1000"},
+}
+
+// proofDepthBucket returns the label of the bucket of the given depth.
+func proofDepthBucket(depth int32) string {
+	for _, b := range proofDepthBuckets {
+		if depth <= b.max {
+			return b.label
+		}
+	}
+	return "52560+"
+}
+
+// proofSizeBucket returns the label of the bucket of the given number of
+// targets.  Proofs without any targets are counted with the smallest ones.
+func proofSizeBucket(targets int) string {
+	for _, b := range proofSizeBuckets {
+		if targets <= b.max {
+			return b.label
+		}
+	}
+	return "1001+"
+}
+
+// proofAccessKey is what the served proofs are counted by.
+type proofAccessKey struct {
+	source string
+	depth  string
+	size   string
+}
+
+// proofAccessCounts are the counts of a group of served proofs.
+type proofAccessCounts struct {
+	proofs  uint64
+	targets uint64
+	bytes   uint64
+}
+
+// add counts a served proof.
+func (c *proofAccessCounts) add(targets, bytes int) {
+	c.proofs++
+	c.targets += uint64(targets)
+	c.bytes += uint64(bytes)
+}
+
+// proofAccessStats counts the utreexo proofs served over P2P, RPC and REST by
+// where they were asked for, how deep their block is and how many targets they
+// have so that the operators of public bridges can tell how their node is used
+// without logging every request.  The clients are only told apart as configured
+// by --proofaccessclients.
+//
+// A nil proofAccessStats counts nothing.
+type proofAccessStats struct {
+	mtx         sync.Mutex
+	clientsMode string
+	since       time.Time
+	counts      map[proofAccessKey]*proofAccessCounts
+	clients     map[string]*proofAccessCounts
+}
+
+// newProofAccessStats returns a proofAccessStats that tells the clients apart
+// as given by the --proofaccessclients mode.
+func newProofAccessStats(clientsMode string) *proofAccessStats {
+	return &proofAccessStats{
+		clientsMode: clientsMode,
+		since:       time.Now(),
+		counts:      make(map[proofAccessKey]*proofAccessCounts),
+		clients:     make(map[string]*proofAccessCounts),
+	}
+}
+
+// proofAccessClient returns the name of the client at the given address as it's
+// told apart with the given mode.  An empty name is returned when the clients
+// aren't told apart or the address isn't known.
+func proofAccessClient(mode string, addr string) string {
+	if mode == proofClientsNone || addr == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// Onion and other non-IP addresses are kept as they are.
+		return host
+	}
+	if mode == proofClientsFull {
+		return ip.String()
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)),
+			Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)),
+		Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// record counts a proof with the given number of targets and size in bytes of
+// a block the given number of blocks below the tip that was served to the
+// client at the given address.  The address may be empty when the client isn't
+// known.
+//
+// This function is safe for concurrent access.
+func (p *proofAccessStats) record(source string, depth int32, targets, bytes int,
+	addr string) {
+
+	if p == nil {
+		return
+	}
+
+	key := proofAccessKey{
+		source: source,
+		depth:  proofDepthBucket(depth),
+		size:   proofSizeBucket(targets),
+	}
+	client := proofAccessClient(p.clientsMode, addr)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	counts, ok := p.counts[key]
+	if !ok {
+		counts = &proofAccessCounts{}
+		p.counts[key] = counts
+	}
+	counts.add(targets, bytes)
+
+	if client == "" {
+		return
+	}
+	clientCounts, ok := p.clients[client]
+	if !ok {
+		if len(p.clients) >= maxProofAccessClients {
+			client = proofAccessOtherClients
+		}
+		clientCounts, ok = p.clients[client]
+		if !ok {
+			clientCounts = &proofAccessCounts{}
+			p.clients[client] = clientCounts
+		}
+	}
+	clientCounts.add(targets, bytes)
+}
+
+// result returns the counts as the result of the getproofaccessstats command
+// and starts the counts over when reset is set.  The groups of proofs are
+// sorted by source, depth and size and the clients by the bytes served to them
+// from the most to the least.
+//
+// This function is safe for concurrent access.
+func (p *proofAccessStats) result(reset bool) *btcjson.GetProofAccessStatsResult {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	result := &btcjson.GetProofAccessStatsResult{
+		Since:       p.since.Unix(),
+		ClientsMode: p.clientsMode,
+		Groups:      make([]btcjson.ProofAccessGroupResult, 0, len(p.counts)),
+	}
+	for key, counts := range p.counts {
+		result.Groups = append(result.Groups, btcjson.ProofAccessGroupResult{
+			Source:  key.source,
+			Depth:   key.depth,
+			Size:    key.size,
+			Proofs:  counts.proofs,
+			Targets: counts.targets,
+			Bytes:   counts.bytes,
+		})
+	}
+	order := func(labels []string, label string) int {
+		for i, l := range labels {
+			if l == label {
+				return i
+			}
+		}
+		return len(labels)
+	}
+	var depthLabels, sizeLabels []string
+	for _, b := range proofDepthBuckets {
+		depthLabels = append(depthLabels, b.label)
+	}
+	for _, b := range proofSizeBuckets {
+		sizeLabels = append(sizeLabels, b.label)
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		a, b := result.Groups[i], result.Groups[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Depth != b.Depth {
+			return order(depthLabels, a.Depth) < order(depthLabels, b.Depth)
+		}
+		return order(sizeLabels, a.Size) < order(sizeLabels, b.Size)
+	})
+
+	for client, counts := range p.clients {
+		result.Clients = append(result.Clients, btcjson.ProofAccessClientResult{
+			Client:  client,
+			Proofs:  counts.proofs,
+			Targets: counts.targets,
+			Bytes:   counts.bytes,
+		})
+	}
+	sort.Slice(result.Clients, func(i, j int) bool {
+		a, b := result.Clients[i], result.Clients[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Client < b.Client
+	})
+
+	if reset {
+		p.since = time.Now()
+		p.counts = make(map[proofAccessKey]*proofAccessCounts)
+		p.clients = make(map[string]*proofAccessCounts)
+	}
+
+	return result
+}
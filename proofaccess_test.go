@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestProofAccessClient(t *testing.T) {
+	tests := []struct {
+		mode string
+		addr string
+		want string
+	}{
+		{proofClientsNone, "1.2.3.4:8333", ""},
+		{proofClientsTruncated, "", ""},
+		{proofClientsTruncated, "1.2.3.4:8333", "1.2.3.0/24"},
+		{proofClientsTruncated, "[2001:db8:1:2::1]:8333", "2001:db8:1::/48"},
+		{proofClientsTruncated, "::ffff:1.2.3.4", "1.2.3.0/24"},
+		{proofClientsTruncated, "abcdefghij.onion:8333", "abcdefghij.onion"},
+		{proofClientsFull, "1.2.3.4:8333", "1.2.3.4"},
+		{proofClientsFull, "[2001:db8:1:2::1]:8333", "2001:db8:1:2::1"},
+	}
+
+	for _, test := range tests {
+		got := proofAccessClient(test.mode, test.addr)
+		if got != test.want {
+			t.Errorf("%s %q: expected %q, got %q", test.mode, test.addr,
+				test.want, got)
+		}
+	}
+}
+
+func TestProofAccessStats(t *testing.T) {
+	// Nothing is counted without the stats.
+	var stats *proofAccessStats
+	stats.record(proofSourceP2P, 0, 1, 100, "1.2.3.4:8333")
+
+	stats = newProofAccessStats(proofClientsTruncated)
+	stats.record(proofSourceP2P, 3, 1, 100, "1.2.3.4:8333")
+	stats.record(proofSourceP2P, 5, 0, 50, "1.2.3.5:8333")
+	stats.record(proofSourceP2P, 200, 20, 1000, "5.6.7.8:8333")
+	stats.record(proofSourceRPC, 0, 2, 300, "")
+	stats.record(proofSourceREST, 100000, 5000, 9000, "5.6.7.9:1234")
+
+	result := stats.result(true)
+	got := make([]string, 0, len(result.Groups))
+	for _, g := range result.Groups {
+		got = append(got, fmt.Sprintf("%s %s %s %d %d %d", g.Source,
+			g.Depth, g.Size, g.Proofs, g.Targets, g.Bytes))
+	}
+	want := []string{
+		"p2p 0-5 1 2 1 150",
+		"p2p 144-1007 11-100 1 20 1000",
+		"rest 52560+ 1001+ 1 5000 9000",
+		"rpc 0-5 2-10 1 2 300",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected groups %v, got %v", want, got)
+	}
+
+	// The clients are truncated and sorted by the bytes served to them.
+	if len(result.Clients) != 2 ||
+		result.Clients[0].Client != "5.6.7.0/24" ||
+		result.Clients[0].Proofs != 2 || result.Clients[0].Bytes != 10000 ||
+		result.Clients[1].Client != "1.2.3.0/24" ||
+		result.Clients[1].Proofs != 2 || result.Clients[1].Bytes != 150 {
+		t.Fatalf("unexpected clients %+v", result.Clients)
+	}
+
+	// The counts were started over.
+	result = stats.result(false)
+	if len(result.Groups) != 0 || len(result.Clients) != 0 {
+		t.Fatalf("expected the counts to be reset, got %+v", result)
+	}
+
+	// The clients past the maximum are lumped together.
+	for i := 0; i < maxProofAccessClients+10; i++ {
+		addr := fmt.Sprintf("10.%d.%d.1:8333", i/256, i%256)
+		stats.record(proofSourceP2P, 0, 1, 1, addr)
+	}
+	result = stats.result(false)
+	if len(result.Clients) != maxProofAccessClients+1 {
+		t.Fatalf("expected %d clients, got %d", maxProofAccessClients+1,
+			len(result.Clients))
+	}
+	if result.Clients[0].Client != proofAccessOtherClients ||
+		result.Clients[0].Proofs != 10 {
+		t.Fatalf("expected 10 proofs for %s, got %+v",
+			proofAccessOtherClients, result.Clients[0])
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// servedProofKey identifies a served utreexo proof by its block and whether the
+// leaf datas were reconstructed from the block.  Blocks are sent with the proof
+// as it's stored while getutreexoproof is answered from the full leaf datas.
+type servedProofKey struct {
+	blockHash     chainhash.Hash
+	reconstructed bool
+}
+
+// servedProofEntry is an element of the served proof cache.
+type servedProofEntry struct {
+	key   servedProofKey
+	udata *wire.UData
+}
+
+// servedProofCache is a least recently used cache of the utreexo proofs served
+// to peers.  A bridge serving many syncing CSNs gets asked for the proofs of the
+// same recent blocks over and over, so they're kept in memory instead of being
+// read from the proof index and put back together for every peer.  The proof of
+// a block never changes, so entries don't need to be dropped when the tip does.
+//
+// A servedProofCache with a maximum of 0 entries caches nothing.
+type servedProofCache struct {
+	mtx        sync.Mutex
+	maxEntries int
+	entries    map[servedProofKey]*list.Element
+	lru        *list.List
+}
+
+// newServedProofCache returns a served proof cache that holds up to maxEntries
+// proofs.
+func newServedProofCache(maxEntries int) *servedProofCache {
+	return &servedProofCache{
+		maxEntries: maxEntries,
+		entries:    make(map[servedProofKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the cached proof of the block and whether it was found.  The
+// returned proof is shared with the other peers it's served to and must not be
+// modified.
+//
+// This function is safe for concurrent access.
+func (c *servedProofCache) get(hash *chainhash.Hash, reconstructed bool) (*wire.UData, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[servedProofKey{*hash, reconstructed}]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*servedProofEntry).udata, true
+}
+
+// add caches the proof of the block, evicting the least recently used proof if
+// the cache is full.  The proof must not be modified after it's added.
+//
+// This function is safe for concurrent access.
+func (c *servedProofCache) add(hash *chainhash.Hash, reconstructed bool, udata *wire.UData) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.maxEntries <= 0 {
+		return
+	}
+	key := servedProofKey{*hash, reconstructed}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*servedProofEntry).udata = udata
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if c.lru.Len() >= c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*servedProofEntry).key)
+	}
+	c.entries[key] = c.lru.PushFront(&servedProofEntry{key: key, udata: udata})
+}
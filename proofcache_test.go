@@ -0,0 +1,48 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestServedProofCache(t *testing.T) {
+	c := newServedProofCache(2)
+	hash1, hash2, hash3 := chainhash.Hash{1}, chainhash.Hash{2}, chainhash.Hash{3}
+	stored, full := &wire.UData{}, &wire.UData{}
+
+	c.add(&hash1, false, stored)
+	if _, ok := c.get(&hash1, true); ok {
+		t.Fatal("expected the stored proof not to be returned as reconstructed")
+	}
+	c.add(&hash1, true, full)
+	if ud, ok := c.get(&hash1, false); !ok || ud != stored {
+		t.Fatal("expected the stored proof to be cached")
+	}
+
+	// The reconstructed proof of the first block is the least recently
+	// used one and gets evicted.
+	c.add(&hash2, false, stored)
+	if _, ok := c.get(&hash1, true); ok {
+		t.Fatal("expected the least recently used proof to be evicted")
+	}
+	if _, ok := c.get(&hash1, false); !ok {
+		t.Fatal("expected the recently used proof to be kept")
+	}
+	c.add(&hash3, false, stored)
+	if _, ok := c.get(&hash2, false); ok {
+		t.Fatal("expected the least recently used proof to be evicted")
+	}
+
+	// Nothing is cached with a maximum of 0 entries.
+	c = newServedProofCache(0)
+	c.add(&hash1, false, stored)
+	if _, ok := c.get(&hash1, false); ok {
+		t.Fatal("expected nothing to be cached")
+	}
+}
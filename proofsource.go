@@ -0,0 +1,336 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/connmgr"
+	"github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// proofAuthKeyFileName is the name of the file in the data directory
+	// the key a node serving proofs signs the proofauth challenges with is
+	// kept in.
+	proofAuthKeyFileName = "proofauth.key"
+
+	// proofAuthTimeout is how long a proof source with a pinned public key
+	// has to answer the proofauth challenge before it's disconnected.
+	proofAuthTimeout = 30 * time.Second
+)
+
+var (
+	// proofAuthSigTag is the tag of the hash of the node's challenge that
+	// a proof source signs.
+	proofAuthSigTag = []byte("utreexo/proofauth/sig")
+
+	// proofAuthMACTag is prefixed to both challenges when a node answers
+	// the challenge of a proof source with the HMAC of its token.
+	proofAuthMACTag = []byte("utreexo/proofauth/mac")
+)
+
+// proofSource is a proof source given with --proofsource that blocks and their
+// utreexo proofs are fetched from before the public peers.
+type proofSource struct {
+	// addr is the address of the source.
+	addr string
+
+	// token authenticates the node to the source.  It's nil when the node
+	// doesn't authenticate.
+	token []byte
+
+	// pubKey is the key the source has to prove it holds.  It's nil when
+	// the source isn't authenticated.
+	pubKey *btcec.PublicKey
+}
+
+// authenticates returns whether a proofauth handshake is done with the source.
+func (ps *proofSource) authenticates() bool {
+	return ps.token != nil || ps.pubKey != nil
+}
+
+// parseProofSource parses a --proofsource option in the form of
+// <host:port>[,token=<token>][,pubkey=<hex>].  The default port is added to
+// the address when it has none.
+func parseProofSource(option, defaultPort string) (*proofSource, error) {
+	fields := strings.Split(option, ",")
+	addr := strings.TrimSpace(fields[0])
+	if addr == "" {
+		return nil, fmt.Errorf("%q is not in the form of "+
+			"<host:port>[,token=<token>][,pubkey=<hex>]", option)
+	}
+	source := &proofSource{addr: normalizeAddress(addr, defaultPort)}
+
+	for _, field := range fields[1:] {
+		key, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("%q is not in the form of "+
+				"<key>=<value>", field)
+		}
+		switch strings.ToLower(key) {
+		case "token":
+			source.token = []byte(value)
+
+		case "pubkey":
+			serialized, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pubkey %q: %v",
+					value, err)
+			}
+			source.pubKey, err = schnorr.ParsePubKey(serialized)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pubkey %q: %v",
+					value, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown proof source setting %q",
+				key)
+		}
+	}
+
+	return source, nil
+}
+
+// proofAuthSigHash returns the hash of the node's challenge that a proof source
+// signs.
+func proofAuthSigHash(challenge *[wire.ProofAuthChallengeSize]byte) []byte {
+	return chainhash.TaggedHash(proofAuthSigTag, challenge[:])[:]
+}
+
+// proofAuthMAC returns the HMAC of the token that answers the challenge of a
+// proof source.  The node's own challenge is included so the answer can't be
+// replayed to another source that happens to pick the same challenge.
+func proofAuthMAC(token []byte, sourceChallenge,
+	nodeChallenge *[wire.ProofAuthChallengeSize]byte) []byte {
+
+	mac := hmac.New(sha256.New, token)
+	mac.Write(proofAuthMACTag)
+	mac.Write(sourceChallenge[:])
+	mac.Write(nodeChallenge[:])
+	return mac.Sum(nil)
+}
+
+// newProofAuthChallenge returns a random proofauth challenge.
+func newProofAuthChallenge() ([wire.ProofAuthChallengeSize]byte, error) {
+	var challenge [wire.ProofAuthChallengeSize]byte
+	_, err := rand.Read(challenge[:])
+	return challenge, err
+}
+
+// loadProofAuthKey returns the key the node signs the proofauth challenges of
+// the nodes that pinned it as a proof source with.  A new key is created the
+// first time.
+func loadProofAuthKey(dataDir string) (*btcec.PrivateKey, error) {
+	keyFile := filepath.Join(dataDir, proofAuthKeyFileName)
+	serialized, err := os.ReadFile(keyFile)
+	if err == nil {
+		keyBytes, err := hex.DecodeString(strings.TrimSpace(string(serialized)))
+		if err != nil || len(keyBytes) != btcec.PrivKeyBytesLen {
+			return nil, fmt.Errorf("malformed proofauth key in %s",
+				keyFile)
+		}
+		key, _ := btcec.PrivKeyFromBytes(keyBytes)
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	serialized = []byte(hex.EncodeToString(key.Serialize()) + "\n")
+	if err := os.WriteFile(keyFile, serialized, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// startProofAuth sends the node's challenge to a proof source that
+// authenticates.  A source with a pinned public key that doesn't answer in time
+// is disconnected.
+func (sp *serverPeer) startProofAuth() {
+	challenge, err := newProofAuthChallenge()
+	if err != nil {
+		peerLog.Errorf("Unable to create proofauth challenge: %v", err)
+		sp.Disconnect()
+		return
+	}
+	sp.proofAuthChallenge = challenge
+	sp.proofAuthStarted = true
+	if sp.proofSource.pubKey != nil {
+		sp.proofAuthTimer = time.AfterFunc(proofAuthTimeout, func() {
+			peerLog.Warnf("Proof source %s didn't authenticate in "+
+				"time -- disconnecting", sp)
+			sp.Disconnect()
+		})
+	}
+	sp.QueueMessage(wire.NewMsgProofAuth(challenge, nil), nil)
+}
+
+// proofSourceReady hands the proof source to the sync manager once it's both
+// authenticated and known to the sync manager, whichever comes last.
+func (sp *serverPeer) proofSourceReady(authenticated, added bool) {
+	sp.proofAuthMtx.Lock()
+	defer sp.proofAuthMtx.Unlock()
+
+	if authenticated {
+		sp.proofSourceAuthed = true
+	}
+	if added {
+		sp.addedToSync = true
+	}
+	if sp.proofSourceAuthed && sp.addedToSync {
+		sp.server.syncManager.SetProofSource(sp.Peer)
+	}
+}
+
+// isProofAuthenticated returns whether the peer authenticated with one of the
+// tokens given with --proofauthtoken.
+func (sp *serverPeer) isProofAuthenticated() bool {
+	return atomic.LoadInt32(&sp.proofClientAuthed) != 0
+}
+
+// OnProofAuth is invoked when a peer receives a proofauth utreexo message.  A
+// proof source answers the challenge of a node with its signature and checks
+// the answer to its own challenge against the accepted tokens.  A node checks
+// the signature of the proof source and answers its challenge.
+func (sp *serverPeer) OnProofAuth(_ *peer.Peer, msg *wire.MsgProofAuth) {
+	if sp.proofSource != nil {
+		sp.handleProofSourceAuth(msg)
+		return
+	}
+
+	key := sp.server.proofAuthKey
+	if key == nil {
+		peerLog.Debugf("Ignoring proofauth from %s since no proofs are "+
+			"served", sp)
+		return
+	}
+
+	// The first message carries the node's challenge.
+	if !sp.proofAuthStarted {
+		challenge, err := newProofAuthChallenge()
+		if err != nil {
+			peerLog.Errorf("Unable to create proofauth challenge: %v",
+				err)
+			sp.Disconnect()
+			return
+		}
+		sig, err := schnorr.Sign(key, proofAuthSigHash(&msg.Challenge))
+		if err != nil {
+			peerLog.Errorf("Unable to sign proofauth challenge: %v",
+				err)
+			sp.Disconnect()
+			return
+		}
+		sp.proofAuthChallenge = challenge
+		sp.proofAuthPeerChallenge = msg.Challenge
+		sp.proofAuthStarted = true
+		sp.QueueMessage(wire.NewMsgProofAuth(challenge,
+			sig.Serialize()), nil)
+		return
+	}
+
+	// The second one answers ours with the HMAC of the node's token.  It's
+	// ignored when no tokens are accepted.
+	if sp.isProofAuthenticated() || len(cfg.ProofAuthTokens) == 0 {
+		return
+	}
+	for _, token := range cfg.ProofAuthTokens {
+		mac := proofAuthMAC([]byte(token), &sp.proofAuthChallenge,
+			&sp.proofAuthPeerChallenge)
+		if hmac.Equal(mac, msg.Response) {
+			atomic.StoreInt32(&sp.proofClientAuthed, 1)
+			peerLog.Infof("Peer %s authenticated as a proof client", sp)
+			return
+		}
+	}
+	peerLog.Warnf("Peer %s failed to authenticate as a proof client -- "+
+		"disconnecting", sp)
+	sp.Disconnect()
+}
+
+// handleProofSourceAuth checks the answer of a proof source to the node's
+// challenge and answers the challenge of the source with the token.
+func (sp *serverPeer) handleProofSourceAuth(msg *wire.MsgProofAuth) {
+	if !sp.proofAuthStarted || sp.proofAuthDone {
+		peerLog.Debugf("Ignoring unexpected proofauth from %s", sp)
+		return
+	}
+	sp.proofAuthDone = true
+	if sp.proofAuthTimer != nil {
+		sp.proofAuthTimer.Stop()
+	}
+
+	source := sp.proofSource
+	if source.pubKey != nil {
+		err := errors.New("no signature")
+		if len(msg.Response) == schnorr.SignatureSize {
+			var sig *schnorr.Signature
+			sig, err = schnorr.ParseSignature(msg.Response)
+			if err == nil && !sig.Verify(
+				proofAuthSigHash(&sp.proofAuthChallenge),
+				source.pubKey) {
+
+				err = errors.New("invalid signature")
+			}
+		}
+		if err != nil {
+			peerLog.Warnf("Proof source %s failed to authenticate: "+
+				"%v -- disconnecting", sp, err)
+			sp.Disconnect()
+			return
+		}
+	}
+
+	if source.token != nil {
+		mac := proofAuthMAC(source.token, &msg.Challenge,
+			&sp.proofAuthChallenge)
+		sp.QueueMessage(wire.NewMsgProofAuth(
+			[wire.ProofAuthChallengeSize]byte{}, mac), nil)
+	}
+
+	peerLog.Infof("Authenticated proof source %s", sp)
+	sp.proofSourceReady(true, false)
+}
+
+// connectProofSources makes permanent connections to the proof sources.
+func (s *server) connectProofSources(sources []*proofSource) error {
+	s.proofSources = make(map[string]*proofSource, len(sources))
+	for _, source := range sources {
+		netAddr, err := addrStringToNetAddr(source.addr)
+		if err != nil {
+			return fmt.Errorf("proof source %s: %v", source.addr, err)
+		}
+		s.proofSources[netAddr.String()] = source
+
+		go s.connManager.Connect(&connmgr.ConnReq{
+			Addr: &classAddr{
+				Addr:  netAddr,
+				class: s.relayConnClass(),
+			},
+			Permanent: true,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestParseProofSource(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := hex.EncodeToString(schnorr.SerializePubKey(key.PubKey()))
+
+	tests := []struct {
+		option string
+		addr   string
+		token  string
+		pubKey bool
+		valid  bool
+	}{
+		{
+			option: "10.0.0.1",
+			addr:   "10.0.0.1:8333",
+			valid:  true,
+		},
+		{
+			option: "bridge.example.com:8336,token=secret",
+			addr:   "bridge.example.com:8336",
+			token:  "secret",
+			valid:  true,
+		},
+		{
+			option: "[::1]:8336, Token=secret, PUBKEY=" + pubKey,
+			addr:   "[::1]:8336",
+			token:  "secret",
+			pubKey: true,
+			valid:  true,
+		},
+		{option: ""},
+		{option: ",token=secret"},
+		{option: "10.0.0.1,token"},
+		{option: "10.0.0.1,token="},
+		{option: "10.0.0.1,pubkey=zz"},
+		{option: "10.0.0.1,pubkey=" + pubKey[2:]},
+		{option: "10.0.0.1,user=satoshi"},
+	}
+	for _, test := range tests {
+		source, err := parseProofSource(test.option, "8333")
+		if !test.valid {
+			if err == nil {
+				t.Fatalf("%q: expected an error", test.option)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.option, err)
+		}
+		if source.addr != test.addr || string(source.token) != test.token ||
+			(source.pubKey != nil) != test.pubKey {
+
+			t.Fatalf("%q: unexpected proof source %+v", test.option,
+				source)
+		}
+		if source.authenticates() != (test.token != "" || test.pubKey) {
+			t.Fatalf("%q: unexpected authenticates %v", test.option,
+				source.authenticates())
+		}
+	}
+}
+
+func TestProofAuth(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The source signs the hash of the node's challenge which only
+	// verifies against its own key and challenge.
+	nodeChallenge := [wire.ProofAuthChallengeSize]byte{1}
+	sig, err := schnorr.Sign(key, proofAuthSigHash(&nodeChallenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(proofAuthSigHash(&nodeChallenge), key.PubKey()) {
+		t.Fatal("expected the signature to verify")
+	}
+	if sig.Verify(proofAuthSigHash(&nodeChallenge), other.PubKey()) {
+		t.Fatal("expected the signature not to verify for another key")
+	}
+	otherChallenge := [wire.ProofAuthChallengeSize]byte{2}
+	if sig.Verify(proofAuthSigHash(&otherChallenge), key.PubKey()) {
+		t.Fatal("expected the signature not to verify for another " +
+			"challenge")
+	}
+
+	// The answer to the source's challenge depends on the token and both
+	// challenges.
+	sourceChallenge := [wire.ProofAuthChallengeSize]byte{3}
+	mac := proofAuthMAC([]byte("secret"), &sourceChallenge, &nodeChallenge)
+	if len(mac) > wire.MaxProofAuthResponseSize {
+		t.Fatalf("mac of %d bytes doesn't fit a proofauth message",
+			len(mac))
+	}
+	if !bytes.Equal(mac, proofAuthMAC([]byte("secret"), &sourceChallenge,
+		&nodeChallenge)) {
+
+		t.Fatal("expected the same mac for the same inputs")
+	}
+	macs := [][]byte{
+		proofAuthMAC([]byte("other"), &sourceChallenge, &nodeChallenge),
+		proofAuthMAC([]byte("secret"), &otherChallenge, &nodeChallenge),
+		proofAuthMAC([]byte("secret"), &sourceChallenge, &otherChallenge),
+	}
+	for i, other := range macs {
+		if bytes.Equal(mac, other) {
+			t.Fatalf("test %d: expected a different mac", i)
+		}
+	}
+}
+
+func TestLoadProofAuthKey(t *testing.T) {
+	dataDir := t.TempDir()
+	key, err := loadProofAuthKey(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key is kept across restarts.
+	loaded, err := loadProofAuthKey(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Key.Equals(&loaded.Key) {
+		t.Fatal("expected the same key to be loaded")
+	}
+}
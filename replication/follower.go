@@ -0,0 +1,333 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package replication implements the follower side of leader/follower
+// replication.  A follower streams the blocks of a trusted leader utreexod from
+// its gRPC API along with their utreexo proofs and adds them to its chain
+// without validating them again, so that a fleet of proof-serving nodes
+// doesn't have to validate the chain once per node.
+//
+// The roots of the utreexo accumulator the leader sends with the tip are
+// compared against the ones of the follower and the replication stops when
+// they differ.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/rpcserver/grpc"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// retryInterval is how long to wait before reopening the stream from
+	// the leader after it ended.
+	retryInterval = 10 * time.Second
+
+	// replayDepth is how many blocks below the tip are requested again
+	// when the stream is opened so that reorgs of the leader that happened
+	// while the follower wasn't connected are followed.
+	replayDepth = 6
+)
+
+// errRootsMismatch is returned when the utreexo roots of the follower differ
+// from the ones of the leader.
+var errRootsMismatch = errors.New("the utreexo roots differ from the ones " +
+	"of the leader")
+
+// deltaStream is an open replication stream.  It's satisfied by
+// *grpc.ReplicationStream.
+type deltaStream interface {
+	Recv() (*grpc.ReplicationDelta, error)
+	Close() error
+}
+
+// leaderClient opens replication streams from the leader.
+type leaderClient interface {
+	SubscribeReplication(ctx context.Context, startHeight uint32) (deltaStream, error)
+}
+
+// grpcClient is the leaderClient of a gRPC server.
+type grpcClient struct {
+	*grpc.Client
+}
+
+// SubscribeReplication opens a replication stream from the leader.
+func (c grpcClient) SubscribeReplication(ctx context.Context,
+	startHeight uint32) (deltaStream, error) {
+
+	return c.Client.SubscribeReplication(ctx, startHeight)
+}
+
+// Chain is the chain of the follower.  It's satisfied by
+// *blockchain.BlockChain.
+type Chain interface {
+	BestSnapshot() *blockchain.BestState
+	MainChainHasBlock(hash *chainhash.Hash) bool
+}
+
+// Config is the configuration of the follower.
+type Config struct {
+	// Leader is the host:port of the gRPC server of the leader.
+	Leader string
+
+	// TLSConfig is the TLS config of the connections to the leader.
+	TLSConfig *tls.Config
+
+	// User and Pass are the RPC credentials of the leader.
+	User string
+	Pass string
+
+	// Chain is the chain the blocks of the leader are added to.
+	Chain Chain
+
+	// ProcessBlock processes a block of the leader with the given flags
+	// and returns whether it's an orphan.
+	ProcessBlock func(block *btcutil.Block, flags blockchain.BehaviorFlags) (bool, error)
+
+	// UtreexoView is whether the chain keeps the utreexo accumulator
+	// instead of the UTXO set, in which case the blocks are processed with
+	// their utreexo proofs.
+	UtreexoView bool
+
+	// FetchUtreexoRoots returns the roots and the number of leaves of the
+	// utreexo accumulator at the given block, which is the tip.  It's nil
+	// when there's no accumulator and the roots aren't checked.
+	FetchUtreexoRoots func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error)
+}
+
+// Follower adds the blocks of a leader to the chain.
+type Follower struct {
+	started  int32
+	shutdown int32
+
+	cfg    Config
+	client leaderClient
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns a follower of the leader in the config.  Nothing is received from
+// the leader until it's started.
+func New(cfg *Config) *Follower {
+	client := grpc.NewClient(&grpc.ClientConfig{
+		Host:      cfg.Leader,
+		TLSConfig: cfg.TLSConfig,
+		User:      cfg.User,
+		Pass:      cfg.Pass,
+	})
+	return newFollower(cfg, grpcClient{client})
+}
+
+// newFollower returns a follower that receives the blocks of the leader with
+// the given client.
+func newFollower(cfg *Config, client leaderClient) *Follower {
+	return &Follower{
+		cfg:    *cfg,
+		client: client,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Start starts following the leader.
+func (f *Follower) Start() {
+	// Already started?
+	if atomic.AddInt32(&f.started, 1) != 1 {
+		return
+	}
+
+	log.Infof("Replicating the blocks of the leader at %s", f.cfg.Leader)
+
+	f.wg.Add(1)
+	go f.replicationHandler()
+}
+
+// Stop stops following the leader and waits for the handler to finish.
+func (f *Follower) Stop() {
+	// Already stopped?
+	if atomic.AddInt32(&f.shutdown, 1) != 1 {
+		log.Infof("Replication is already in the process of shutting down")
+		return
+	}
+
+	close(f.quit)
+	f.wg.Wait()
+}
+
+// replicationHandler replicates the blocks of the leader and reopens the
+// stream when it ends, unless the chain of the follower diverged.
+//
+// This must be run as a goroutine.
+func (f *Follower) replicationHandler() {
+	defer f.wg.Done()
+
+	for {
+		err := f.replicate()
+		select {
+		case <-f.quit:
+			return
+		default:
+		}
+		if errors.Is(err, errRootsMismatch) {
+			log.Errorf("Stopped replicating the blocks of the leader "+
+				"at %s: %v", f.cfg.Leader, err)
+			return
+		}
+		log.Warnf("Lost the replication stream of the leader at %s: %v",
+			f.cfg.Leader, err)
+
+		select {
+		case <-time.After(retryInterval):
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// replicate handles the replication deltas of the leader until the stream
+// fails or the follower is stopped.
+func (f *Follower) replicate() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-f.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	startHeight := f.cfg.Chain.BestSnapshot().Height + 1 - replayDepth
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	stream, err := f.client.SubscribeReplication(ctx, uint32(startHeight))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	log.Debugf("Opened the replication stream of the leader at %s from "+
+		"height %d", f.cfg.Leader, startHeight)
+
+	for {
+		delta, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := f.handleDelta(delta); err != nil {
+			return err
+		}
+	}
+}
+
+// handleDelta adds the block of a replication delta to the chain unless it's
+// already in the main chain and checks the roots that come with it.
+func (f *Follower) handleDelta(delta *grpc.ReplicationDelta) error {
+	if delta.Block == nil {
+		return errors.New("replication delta without a block")
+	}
+	block, err := btcutil.NewBlockFromBytes(delta.Block.RawBlock)
+	if err != nil {
+		return fmt.Errorf("invalid block from the leader: %v", err)
+	}
+	block.SetHeight(int32(delta.Block.Height))
+
+	// Reorgs of the leader are followed once the blocks of the branch it
+	// switched to arrive.
+	if delta.Type == grpc.BlockDisconnected {
+		log.Debugf("Leader disconnected block %v", block.Hash())
+		return nil
+	}
+
+	if !f.cfg.Chain.MainChainHasBlock(block.Hash()) {
+		if err := f.processBlock(block, delta.RawProof); err != nil {
+			return err
+		}
+	}
+	if delta.Roots != nil {
+		return f.checkRoots(delta.Roots)
+	}
+	return nil
+}
+
+// processBlock adds a block of the leader to the chain.  Blocks that extend the
+// tip were validated by the leader so they're added without validating them
+// again.  Blocks of other branches are validated in full since they may cause
+// a reorg.
+func (f *Follower) processBlock(block *btcutil.Block, rawProof []byte) error {
+	if f.cfg.UtreexoView {
+		if len(rawProof) == 0 {
+			return fmt.Errorf("block %v from the leader has no utreexo "+
+				"proof -- the leader requires a utreexo proof index",
+				block.Hash())
+		}
+		udata := new(wire.UData)
+		if err := udata.Deserialize(bytes.NewReader(rawProof)); err != nil {
+			return fmt.Errorf("invalid utreexo proof of block %v from "+
+				"the leader: %v", block.Hash(), err)
+		}
+		block.MsgBlock().UData = udata
+	}
+
+	flags := blockchain.BFNone
+	best := f.cfg.Chain.BestSnapshot()
+	if block.MsgBlock().Header.PrevBlock == best.Hash {
+		flags = blockchain.BFFastAdd
+	}
+	isOrphan, err := f.cfg.ProcessBlock(block, flags)
+	if err != nil {
+		return fmt.Errorf("block %v from the leader was rejected: %v",
+			block.Hash(), err)
+	}
+	if isOrphan {
+		return fmt.Errorf("block %v from the leader is an orphan",
+			block.Hash())
+	}
+	log.Debugf("Processed block %v (height %d) from the leader",
+		block.Hash(), block.Height())
+	return nil
+}
+
+// checkRoots compares the roots of the leader against the ones of the chain
+// when both are at the same tip.
+func (f *Follower) checkRoots(msg *grpc.UtreexoRoots) error {
+	if f.cfg.FetchUtreexoRoots == nil {
+		return nil
+	}
+	hash, err := chainhash.NewHash(msg.Hash)
+	if err != nil {
+		return fmt.Errorf("invalid utreexo roots from the leader: %v", err)
+	}
+	if f.cfg.Chain.BestSnapshot().Hash != *hash {
+		return nil
+	}
+
+	roots, numLeaves, err := f.cfg.FetchUtreexoRoots(hash)
+	if err != nil {
+		// The tip may have changed since it was looked up.
+		log.Debugf("Unable to fetch the utreexo roots at block %v: %v",
+			hash, err)
+		return nil
+	}
+	if numLeaves != msg.NumLeaves || len(roots) != len(msg.Roots) {
+		return fmt.Errorf("block %v: %w", hash, errRootsMismatch)
+	}
+	for i, root := range roots {
+		if !bytes.Equal(root[:], msg.Roots[i]) {
+			return fmt.Errorf("block %v: %w", hash, errRootsMismatch)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package replication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/rpcserver/grpc"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testChain is the chain of the follower.  Every processed block becomes its
+// tip.
+type testChain struct {
+	best      blockchain.BestState
+	mainChain map[chainhash.Hash]struct{}
+	processed []blockchain.BehaviorFlags
+	udata     []*wire.UData
+}
+
+func newTestChain() *testChain {
+	genesis := chaincfg.MainNetParams.GenesisHash
+	return &testChain{
+		best:      blockchain.BestState{Hash: *genesis},
+		mainChain: map[chainhash.Hash]struct{}{*genesis: {}},
+	}
+}
+
+func (c *testChain) BestSnapshot() *blockchain.BestState {
+	best := c.best
+	return &best
+}
+
+func (c *testChain) MainChainHasBlock(hash *chainhash.Hash) bool {
+	_, ok := c.mainChain[*hash]
+	return ok
+}
+
+func (c *testChain) processBlock(block *btcutil.Block,
+	flags blockchain.BehaviorFlags) (bool, error) {
+
+	c.processed = append(c.processed, flags)
+	c.udata = append(c.udata, block.MsgBlock().UData)
+	c.mainChain[*block.Hash()] = struct{}{}
+	c.best = blockchain.BestState{Hash: *block.Hash(), Height: block.Height()}
+	return false, nil
+}
+
+// testStream streams the deltas and then fails with err.
+type testStream struct {
+	deltas []*grpc.ReplicationDelta
+	err    error
+}
+
+func (s *testStream) Recv() (*grpc.ReplicationDelta, error) {
+	if len(s.deltas) == 0 {
+		return nil, s.err
+	}
+	delta := s.deltas[0]
+	s.deltas = s.deltas[1:]
+	return delta, nil
+}
+
+func (s *testStream) Close() error { return nil }
+
+// testLeader opens a single stream and records the requested start heights.
+type testLeader struct {
+	stream       *testStream
+	startHeights chan uint32
+}
+
+func (l *testLeader) SubscribeReplication(_ context.Context,
+	startHeight uint32) (deltaStream, error) {
+
+	l.startHeights <- startHeight
+	if l.stream == nil {
+		return nil, errors.New("no stream")
+	}
+	stream := l.stream
+	l.stream = nil
+	return stream, nil
+}
+
+// newDelta returns a delta of an empty block with the given parent.
+func newDelta(t *testing.T, typ grpc.BlockNotificationType,
+	parent *chainhash.Hash, height int32, nonce uint32) (*grpc.ReplicationDelta,
+	*chainhash.Hash) {
+
+	msgBlock := wire.MsgBlock{Header: wire.BlockHeader{
+		PrevBlock: *parent,
+		Nonce:     nonce,
+	}}
+	var buf bytes.Buffer
+	if err := msgBlock.BtcEncode(&buf, 0, wire.WitnessEncoding); err != nil {
+		t.Fatal(err)
+	}
+	hash := msgBlock.BlockHash()
+	return &grpc.ReplicationDelta{
+		Type: typ,
+		Block: &grpc.Block{
+			Hash:     hash[:],
+			Height:   uint32(height),
+			RawBlock: buf.Bytes(),
+		},
+	}, &hash
+}
+
+func TestFollowerHandleDelta(t *testing.T) {
+	chain := newTestChain()
+	genesis := chaincfg.MainNetParams.GenesisHash
+	rootHash := chainhash.Hash{0xaa}
+	f := newFollower(&Config{
+		Chain:        chain,
+		ProcessBlock: chain.processBlock,
+		FetchUtreexoRoots: func(*chainhash.Hash) ([]*chainhash.Hash,
+			uint64, error) {
+
+			return []*chainhash.Hash{&rootHash}, 1, nil
+		},
+	}, nil)
+
+	// Blocks already in the main chain and disconnected blocks are
+	// skipped.
+	var buf bytes.Buffer
+	chaincfg.MainNetParams.GenesisBlock.BtcEncode(&buf, 0,
+		wire.WitnessEncoding)
+	genesisDelta := &grpc.ReplicationDelta{
+		Type:  grpc.BlockConnected,
+		Block: &grpc.Block{Hash: genesis[:], RawBlock: buf.Bytes()},
+	}
+	block1, hash1 := newDelta(t, grpc.BlockConnected, genesis, 1, 1)
+	disconnected, _ := newDelta(t, grpc.BlockDisconnected, hash1, 2, 2)
+	for _, delta := range []*grpc.ReplicationDelta{genesisDelta,
+		disconnected} {
+
+		if err := f.handleDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(chain.processed) != 0 {
+		t.Fatalf("expected no processed blocks, got %d",
+			len(chain.processed))
+	}
+
+	// Blocks extending the tip aren't validated again, but the ones of
+	// other branches are.
+	side, _ := newDelta(t, grpc.BlockConnected, genesis, 1, 3)
+	for _, delta := range []*grpc.ReplicationDelta{block1, side} {
+		if err := f.handleDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []blockchain.BehaviorFlags{blockchain.BFFastAdd,
+		blockchain.BFNone}
+	if len(chain.processed) != len(expected) ||
+		chain.processed[0] != expected[0] ||
+		chain.processed[1] != expected[1] {
+
+		t.Fatalf("expected flags %v, got %v", expected, chain.processed)
+	}
+
+	// Roots at other blocks than the tip aren't compared, but the ones
+	// at the tip have to match.
+	block2, hash2 := newDelta(t, grpc.BlockConnected, hash1, 2, 4)
+	block2.Roots = &grpc.UtreexoRoots{Hash: hash1[:], NumLeaves: 2}
+	if err := f.handleDelta(block2); err != nil {
+		t.Fatal(err)
+	}
+	block2.Roots = &grpc.UtreexoRoots{Hash: hash2[:], NumLeaves: 1,
+		Roots: [][]byte{rootHash[:]}}
+	if err := f.handleDelta(block2); err != nil {
+		t.Fatal(err)
+	}
+	block2.Roots.Roots[0] = make([]byte, 32)
+	if err := f.handleDelta(block2); !errors.Is(err, errRootsMismatch) {
+		t.Fatalf("expected errRootsMismatch, got %v", err)
+	}
+}
+
+func TestFollowerUtreexoView(t *testing.T) {
+	chain := newTestChain()
+	f := newFollower(&Config{
+		Chain:        chain,
+		ProcessBlock: chain.processBlock,
+		UtreexoView:  true,
+	}, nil)
+
+	// Without an accumulator, blocks can't be processed without their
+	// proofs.
+	delta, _ := newDelta(t, grpc.BlockConnected,
+		chaincfg.MainNetParams.GenesisHash, 1, 1)
+	if err := f.handleDelta(delta); err == nil {
+		t.Fatal("expected an error for a block without a proof")
+	}
+
+	var buf bytes.Buffer
+	if err := (&wire.UData{}).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	delta.RawProof = buf.Bytes()
+	if err := f.handleDelta(delta); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.udata) != 1 || chain.udata[0] == nil {
+		t.Fatal("expected the block to be processed with its proof")
+	}
+}
+
+func TestFollowerReplicate(t *testing.T) {
+	chain := newTestChain()
+	genesis := chaincfg.MainNetParams.GenesisHash
+	chain.best.Height = 10
+	delta, hash := newDelta(t, grpc.BlockConnected, genesis, 11, 1)
+	leader := &testLeader{
+		stream: &testStream{
+			deltas: []*grpc.ReplicationDelta{delta},
+			err:    io.EOF,
+		},
+		startHeights: make(chan uint32, 2),
+	}
+	f := newFollower(&Config{
+		Chain:        chain,
+		ProcessBlock: chain.processBlock,
+	}, leader)
+
+	// The stream starts below the tip so reorgs are followed.
+	err := f.replicate()
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if height := <-leader.startHeights; height != 11-replayDepth {
+		t.Fatalf("expected start height %d, got %d", 11-replayDepth,
+			height)
+	}
+	if !chain.MainChainHasBlock(hash) {
+		t.Fatal("expected the block to be processed")
+	}
+
+	// Stopping the follower ends the handler while it waits to retry.
+	f.Start()
+	<-leader.startHeights
+	f.Stop()
+}
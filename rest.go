@@ -0,0 +1,145 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// restUtreexoProofPath is the path of the REST endpoint that serves the
+	// utreexo proofs of blocks.  The full path is in the form of
+	// /rest/utreexoproof/<blockhash>.<bin|hex|json>.
+	restUtreexoProofPath = "/rest/utreexoproof/"
+)
+
+// restFormat is the format of the response of a REST request.
+type restFormat int
+
+const (
+	// restFormatBinary is the serialized data.
+	restFormatBinary restFormat = iota
+
+	// restFormatHex is the hex encoded serialized data.
+	restFormatHex
+
+	// restFormatJSON is the json encoded verbose data.
+	restFormatJSON
+)
+
+// restFormatExtensions maps the file extensions of the REST requests to the
+// formats of the responses.
+var restFormatExtensions = map[string]restFormat{
+	"bin":  restFormatBinary,
+	"hex":  restFormatHex,
+	"json": restFormatJSON,
+}
+
+// parseRESTPath parses the resource of the REST request path with the given
+// prefix and returns it along with the requested response format.  The path
+// must be in the form of <prefix><resource>.<bin|hex|json>.
+func parseRESTPath(path, prefix string) (string, restFormat, error) {
+	resource := strings.TrimPrefix(path, prefix)
+	dot := strings.LastIndexByte(resource, '.')
+	if dot < 0 {
+		return "", 0, fmt.Errorf("output format not found " +
+			"(available: .bin, .hex, .json)")
+	}
+
+	format, ok := restFormatExtensions[resource[dot+1:]]
+	if !ok {
+		return "", 0, fmt.Errorf("output format %q not supported "+
+			"(available: .bin, .hex, .json)", resource[dot+1:])
+	}
+
+	return resource[:dot], format, nil
+}
+
+// handleRESTUtreexoProof serves the utreexo proof of the requested block in the
+// requested format.
+func (s *rpcServer) handleRESTUtreexoProof(w http.ResponseWriter, r *http.Request) {
+	hashStr, format, err := parseRESTPath(r.URL.Path, restUtreexoProofPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	blockHash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil || len(hashStr) != hex.EncodedLen(chainhash.HashSize) {
+		http.Error(w, fmt.Sprintf("invalid hash: %s", hashStr),
+			http.StatusBadRequest)
+		return
+	}
+
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		http.Error(w, "no utreexo proof index is enabled",
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	// Only blocks in the main chain have a proof and the genesis block
+	// doesn't spend anything so it never has one.
+	height, err := s.cfg.Chain.BlockHeightByHash(blockHash)
+	if err != nil || height == 0 {
+		http.Error(w, fmt.Sprintf("no utreexo proof for block %s",
+			blockHash), http.StatusNotFound)
+		return
+	}
+
+	udata, targetHashes, err := s.fetchUtreexoProof(blockHash)
+	if err != nil {
+		rpcsLog.Errorf("Unable to fetch the utreexo proof for block %s: %v",
+			blockHash, err)
+		http.Error(w, "failed to fetch the utreexo proof",
+			http.StatusInternalServerError)
+		return
+	}
+	if err := s.checkProofSize(udata.SerializeSize()); err != nil {
+		http.Error(w, "utreexo proof exceeds the maximum allowed size",
+			http.StatusBadRequest)
+		return
+	}
+	s.recordProofAccess(proofSourceREST, blockHash, udata, r.RemoteAddr)
+
+	var buf bytes.Buffer
+	switch format {
+	case restFormatBinary, restFormatHex:
+		buf.Grow(udata.SerializeSize())
+		err = udata.Serialize(&buf)
+	case restFormatJSON:
+		var reply *btcjson.GetUtreexoProofVerboseResult
+		reply, err = utreexoProofVerboseResult(udata, targetHashes)
+		if err == nil {
+			err = json.NewEncoder(&buf).Encode(reply)
+		}
+	}
+	if err != nil {
+		rpcsLog.Errorf("Unable to encode the utreexo proof for block %s: %v",
+			blockHash, err)
+		http.Error(w, "failed to encode the utreexo proof",
+			http.StatusInternalServerError)
+		return
+	}
+
+	switch format {
+	case restFormatBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(buf.Bytes())
+	case restFormatHex:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, hex.EncodeToString(buf.Bytes()))
+	case restFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/blockchain/indexers"
+	"github.com/utreexo/utreexod/btcjson"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/database"
+	"github.com/utreexo/utreexod/txscript"
+)
+
+func TestParseRESTPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		resource    string
+		format      restFormat
+		expectedErr bool
+	}{
+		{
+			path:     "/rest/utreexoproof/abcd.bin",
+			resource: "abcd",
+			format:   restFormatBinary,
+		},
+		{
+			path:     "/rest/utreexoproof/abcd.hex",
+			resource: "abcd",
+			format:   restFormatHex,
+		},
+		{
+			path:     "/rest/utreexoproof/abcd.json",
+			resource: "abcd",
+			format:   restFormatJSON,
+		},
+		{
+			path:        "/rest/utreexoproof/abcd",
+			expectedErr: true,
+		},
+		{
+			path:        "/rest/utreexoproof/abcd.xml",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		resource, format, err := parseRESTPath(test.path, restUtreexoProofPath)
+		if test.expectedErr {
+			if err == nil {
+				t.Fatalf("%s: expected an error", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.path, err)
+		}
+		if resource != test.resource {
+			t.Fatalf("%s: expected resource %s, got %s",
+				test.path, test.resource, resource)
+		}
+		if format != test.format {
+			t.Fatalf("%s: expected format %d, got %d",
+				test.path, test.format, format)
+		}
+	}
+}
+
+func TestHandleRESTUtreexoProofErrors(t *testing.T) {
+	// A server without any utreexo proof index enabled.
+	s := &rpcServer{}
+
+	tests := []struct {
+		path       string
+		statusCode int
+	}{
+		{
+			path:       restUtreexoProofPath + "abcd.xml",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			path:       restUtreexoProofPath + "nothex.bin",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			path:       restUtreexoProofPath + "abcd.bin",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			path: restUtreexoProofPath +
+				"000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f.json",
+			statusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		rec := httptest.NewRecorder()
+		s.handleRESTUtreexoProof(rec, req)
+		if rec.Code != test.statusCode {
+			t.Fatalf("%s: expected status code %d, got %d",
+				test.path, test.statusCode, rec.Code)
+		}
+	}
+}
+
+// restTestServer returns an rpc server backed by a chain with a flat utreexo
+// proof index along with the blocks connected on top of the genesis block.
+func restTestServer(t *testing.T, numBlocks int) (*rpcServer, []*btcutil.Block) {
+	t.Helper()
+
+	// The log rotator isn't initialized in tests, so keep the subsystems
+	// from writing to it.
+	setLogLevels("off")
+
+	params := chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+
+	dbPath := t.TempDir()
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	idx, err := indexers.NewFlatUtreexoProofIndex(&indexers.UtreexoConfig{
+		MaxMemoryUsage: 50 * 1024 * 1024,
+		Params:         &params,
+		DataDir:        dbPath,
+		FlushMainDB:    db.Flush,
+	})
+	if err != nil {
+		t.Fatalf("error creating the flat utreexo proof index: %v", err)
+	}
+
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:               db,
+		ChainParams:      &params,
+		TimeSource:       blockchain.NewMedianTime(),
+		SigCache:         txscript.NewSigCache(1000),
+		UtxoCacheMaxSize: 10 * 1024 * 1024,
+		IndexManager: indexers.NewManager(db,
+			[]indexers.Indexer{idx}),
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+
+	blocks := make([]*btcutil.Block, 0, numBlocks)
+	tip := btcutil.NewBlock(params.GenesisBlock)
+	var spends []*blockchain.SpendableOut
+	for i := 0; i < numBlocks; i++ {
+		tip, spends, err = blockchain.AddBlock(chain, tip, spends)
+		if err != nil {
+			t.Fatalf("failed to add block %d: %v", i+1, err)
+		}
+		blocks = append(blocks, tip)
+	}
+
+	s := &rpcServer{cfg: rpcserverConfig{
+		Chain:                 chain,
+		ChainParams:           &params,
+		FlatUtreexoProofIndex: idx,
+	}}
+	return s, blocks
+}
+
+func TestHandleRESTUtreexoProof(t *testing.T) {
+	s, blocks := restTestServer(t, 10)
+
+	fetch := func(resource string) *httptest.ResponseRecorder {
+		path := restUtreexoProofPath + resource
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.handleRESTUtreexoProof(rec, req)
+		return rec
+	}
+
+	// Blocks outside of the main chain and the genesis block don't have a
+	// proof.
+	genesisHash := s.cfg.ChainParams.GenesisHash
+	unknownHash := chaincfg.MainNetParams.GenesisHash
+	for _, resource := range []string{
+		genesisHash.String() + ".bin",
+		unknownHash.String() + ".bin",
+	} {
+		rec := fetch(resource)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status code %d, got %d",
+				resource, http.StatusNotFound, rec.Code)
+		}
+	}
+
+	block := blocks[len(blocks)-1]
+	udata, err := s.cfg.FlatUtreexoProofIndex.FetchUtreexoProof(block.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if err := udata.Serialize(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	// The binary format is the serialized proof.
+	rec := fetch(block.Hash().String() + ".bin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bin: unexpected status code %d: %s", rec.Code,
+			rec.Body.String())
+	}
+	if !bytes.Equal(rec.Body.Bytes(), want.Bytes()) {
+		t.Fatalf("bin: expected %x, got %x", want.Bytes(),
+			rec.Body.Bytes())
+	}
+
+	// The hex format is the hex encoded serialized proof.
+	rec = fetch(block.Hash().String() + ".hex")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("hex: unexpected status code %d: %s", rec.Code,
+			rec.Body.String())
+	}
+	got, err := hex.DecodeString(strings.TrimSpace(rec.Body.String()))
+	if err != nil {
+		t.Fatalf("hex: unable to decode the body: %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatalf("hex: expected %x, got %x", want.Bytes(), got)
+	}
+
+	// The json format decodes to the verbose result with one target and
+	// preimage for each leaf that the block spends.
+	rec = fetch(block.Hash().String() + ".json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("json: unexpected status code %d: %s", rec.Code,
+			rec.Body.String())
+	}
+	var reply btcjson.GetUtreexoProofVerboseResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("json: unable to decode the body: %v", err)
+	}
+	if reply.Hex != hex.EncodeToString(want.Bytes()) {
+		t.Fatalf("json: expected hex %x, got %s", want.Bytes(), reply.Hex)
+	}
+	if len(reply.ProofHashes) != len(udata.AccProof.Proof) {
+		t.Fatalf("json: expected %d proof hashes, got %d",
+			len(udata.AccProof.Proof), len(reply.ProofHashes))
+	}
+	if len(reply.TargetPreimages) != len(udata.LeafDatas) ||
+		len(reply.TargetHashes) != len(udata.LeafDatas) {
+
+		t.Fatalf("json: expected %d targets, got %d hashes and "+
+			"%d preimages", len(udata.LeafDatas),
+			len(reply.TargetHashes), len(reply.TargetPreimages))
+	}
+}
@@ -174,6 +174,15 @@ func (cm *rpcConnManager) TxTotals() (uint64, uint64, uint64, uint64, uint64, ui
 	return cm.server.TxTotals()
 }
 
+// PeerPolicyCounts returns the counts of the peers the connection policies
+// refused or deprioritized since the server started.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverConnManager interface implementation.
+func (cm *rpcConnManager) PeerPolicyCounts() peerPolicyCounts {
+	return cm.server.PeerPolicyCounts()
+}
+
 // ConnectedPeers returns an array consisting of all connected peers.
 //
 // This function is safe for concurrent access and is part of the
@@ -238,7 +247,7 @@ func (cm *rpcConnManager) RelayTransactions(txns []*mempool.TxDesc) {
 //
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
-func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddress {
+func (cm *rpcConnManager) NodeAddresses() []*wire.NetAddressV2 {
 	return cm.server.addrManager.AddressCache()
 }
 
@@ -296,3 +305,12 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 func (b *rpcSyncMgr) LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader {
 	return b.server.chain.LocateHeaders(locators, hashStop)
 }
+
+// PeerReputations returns the reputations of all the peers that have been
+// connected as sources of blocks and their utreexo proofs.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) PeerReputations() []netsync.PeerReputation {
+	return b.syncMgr.PeerReputations()
+}
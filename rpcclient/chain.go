@@ -417,6 +417,44 @@ func (c *Client) GetDifficulty() (float64, error) {
 	return c.GetDifficultyAsync().Receive()
 }
 
+// FutureGetDiskUsageResult is a future promise to deliver the result of a
+// GetDiskUsageAsync RPC invocation (or an applicable error).
+type FutureGetDiskUsageResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// on-disk size and the forecasted growth of the block database and the indexes.
+func (r FutureGetDiskUsageResult) Receive() (*btcjson.GetDiskUsageResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the result as a getdiskusage result object.
+	var diskUsage btcjson.GetDiskUsageResult
+	err = json.Unmarshal(res, &diskUsage)
+	if err != nil {
+		return nil, err
+	}
+	return &diskUsage, nil
+}
+
+// GetDiskUsageAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetDiskUsage for the blocking version and more details.
+func (c *Client) GetDiskUsageAsync() FutureGetDiskUsageResult {
+	cmd := btcjson.NewGetDiskUsageCmd()
+	return c.SendCmd(cmd)
+}
+
+// GetDiskUsage returns the on-disk size of the block database and the indexes
+// along with their growth rates in bytes per day forecasted over a trailing
+// window.
+func (c *Client) GetDiskUsage() (*btcjson.GetDiskUsageResult, error) {
+	return c.GetDiskUsageAsync().Receive()
+}
+
 // FutureGetBlockChainInfoResult is a promise to deliver the result of a
 // GetBlockChainInfoAsync RPC invocation (or an applicable error).
 type FutureGetBlockChainInfoResult struct {
@@ -1491,6 +1529,43 @@ func (c *Client) GetUtreexoProof(blockHash *chainhash.Hash) (*btcjson.GetUtreexo
 	return c.GetUtreexoProofAsync(blockHash).Receive()
 }
 
+// FutureGetUtreexoProofsResult is a future promise to deliver the result of a
+// GetUtreexoProofsAsync RPC invocation (or an applicable error).
+type FutureGetUtreexoProofsResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the
+// serialized utreexo proofs of the requested blocks.
+func (r FutureGetUtreexoProofsResult) Receive() ([]btcjson.GetUtreexoProofsResult, error) {
+	res, err := ReceiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var utreexoProofsResult []btcjson.GetUtreexoProofsResult
+	err = json.Unmarshal(res, &utreexoProofsResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return utreexoProofsResult, nil
+}
+
+// GetUtreexoProofsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetUtreexoProofs for the blocking version and more details.
+func (c *Client) GetUtreexoProofsAsync(startHeight, endHeight int32) FutureGetUtreexoProofsResult {
+	cmd := btcjson.NewGetUtreexoProofsCmd(startHeight, endHeight)
+	return c.SendCmd(cmd)
+}
+
+// GetUtreexoProofs returns the serialized utreexo proofs of the blocks in the
+// main chain from startHeight to endHeight, inclusive.
+func (c *Client) GetUtreexoProofs(startHeight, endHeight int32) ([]btcjson.GetUtreexoProofsResult, error) {
+	return c.GetUtreexoProofsAsync(startHeight, endHeight).Receive()
+}
+
 // FutureGetUtreexoRootsResult is a future promise to deliver the result of a
 // GetUtreexoRootsAsync RPC invocation (or an applicable error).
 type FutureGetUtreexoRootsResult chan *Response
@@ -1516,16 +1591,17 @@ func (r FutureGetUtreexoRootsResult) Receive() (*btcjson.GetUtreexoRootsResult,
 //
 // See GetUtreexoRoots for the blocking version and more details.
 func (c *Client) GetUtreexoRootsAsync(blockHash *chainhash.Hash) FutureGetUtreexoRootsResult {
-	hash := ""
+	var hash *string
 	if blockHash != nil {
-		hash = blockHash.String()
+		hash = btcjson.String(blockHash.String())
 	}
 
 	cmd := btcjson.NewGetUtreexoRootsCmd(hash)
 	return c.SendCmd(cmd)
 }
 
-// GetUtreexoRoots reconsiders a specific block and the branch that the block is included in.
+// GetUtreexoRoots returns the roots and the number of leaves of the accumulator
+// at the given block.  The roots at the tip are returned if the hash is nil.
 func (c *Client) GetUtreexoRoots(blockHash *chainhash.Hash) (*btcjson.GetUtreexoRootsResult, error) {
 	return c.GetUtreexoRootsAsync(blockHash).Receive()
 }
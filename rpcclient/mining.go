@@ -108,6 +108,45 @@ func (c *Client) GenerateToAddress(numBlocks int64, address btcutil.Address, max
 	return c.GenerateToAddressAsync(numBlocks, address, maxTries).Receive()
 }
 
+// FutureGenerateBlockResult is a future promise to deliver the result of a
+// GenerateBlockAsync RPC invocation (or an applicable error).
+type FutureGenerateBlockResult chan *Response
+
+// Receive waits for the Response promised by the future and returns the hash
+// of the generated block.
+func (f FutureGenerateBlockResult) Receive() (*chainhash.Hash, error) {
+	res, err := ReceiveFuture(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a generateblock result object.
+	var result btcjson.GenerateBlockResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHashFromStr(result.Hash)
+}
+
+// GenerateBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GenerateBlock for the blocking version and more details.
+func (c *Client) GenerateBlockAsync(address btcutil.Address, transactions []string) FutureGenerateBlockResult {
+	cmd := btcjson.NewGenerateBlockCmd(address.EncodeAddress(), transactions)
+	return c.SendCmd(cmd)
+}
+
+// GenerateBlock generates a block paying to the given address with the given
+// transactions, which are either txids of transactions in the memory pool or
+// raw transactions in hex, and returns its hash.
+func (c *Client) GenerateBlock(address btcutil.Address, transactions []string) (*chainhash.Hash, error) {
+	return c.GenerateBlockAsync(address, transactions).Receive()
+}
+
 // FutureGetGenerateResult is a future promise to deliver the result of a
 // GetGenerateAsync RPC invocation (or an applicable error).
 type FutureGetGenerateResult chan *Response
@@ -991,7 +991,7 @@ func (c *Client) TestMempoolAcceptAsync(txns []*wire.MsgTx,
 		}
 	}
 
-	cmd := btcjson.NewTestMempoolAcceptCmd(rawTxns, maxFeeRate)
+	cmd := btcjson.NewTestMempoolAcceptCmd(rawTxns, maxFeeRate, nil)
 
 	return c.SendCmd(cmd)
 }
@@ -6,10 +6,12 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -22,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,7 +33,9 @@ import (
 
 	cryptorand "crypto/rand"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/websocket"
 	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/bdkwallet"
@@ -38,12 +43,14 @@ import (
 	"github.com/utreexo/utreexod/blockchain/indexers"
 	"github.com/utreexo/utreexod/btcjson"
 	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/btcutil/psbt"
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/database"
 	"github.com/utreexo/utreexod/mempool"
 	"github.com/utreexo/utreexod/mining"
 	"github.com/utreexo/utreexod/mining/cpuminer"
+	"github.com/utreexo/utreexod/netsync"
 	"github.com/utreexo/utreexod/peer"
 	"github.com/utreexo/utreexod/txscript"
 	"github.com/utreexo/utreexod/wallet"
@@ -85,6 +92,14 @@ const (
 	// defaultMaxFeeRate is the default value to use(0.1 BTC/kvB) when the
 	// `MaxFee` field is not set when calling `testmempoolaccept`.
 	defaultMaxFeeRate = 0.1
+
+	// maxUtreexoProofsPerRequest is the maximum number of blocks that the
+	// proofs can be requested for with a single getutreexoproofs call.
+	maxUtreexoProofsPerRequest = 2016
+
+	// maxUtxoSetPageSize is the maximum number of unspent outputs that can
+	// be requested with a single listutxoset call.
+	maxUtxoSetPageSize = 10000
 )
 
 var (
@@ -112,6 +127,10 @@ var (
 	// invocation for constant data.
 	gbtCapabilities = []string{"proposal"}
 
+	// gbtProofCapabilities describes the capabilities returned with a block
+	// template that includes the utreexo proof of its transactions.
+	gbtProofCapabilities = []string{"proposal", "utreexoproof"}
+
 	// JSON 2.0 batched request prefix
 	batchedRequestPrefix = []byte("[")
 )
@@ -140,77 +159,111 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 // a dependency loop.
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
-	"addnode":                            handleAddNode,
-	"balance":                            handleBalance,
-	"createtransactionfrombdkwallet":     handleCreateTransactionFromBDKWallet,
-	"createrawtransaction":               handleCreateRawTransaction,
-	"debuglevel":                         handleDebugLevel,
-	"decoderawtransaction":               handleDecodeRawTransaction,
-	"decodescript":                       handleDecodeScript,
-	"estimatefee":                        handleEstimateFee,
-	"freshaddress":                       handleFreshAddress,
-	"generate":                           handleGenerate,
-	"getaddednodeinfo":                   handleGetAddedNodeInfo,
-	"getbestblock":                       handleGetBestBlock,
-	"getbestblockhash":                   handleGetBestBlockHash,
-	"getbeststate":                       handleGetBestState,
-	"getblock":                           handleGetBlock,
-	"getblockchaininfo":                  handleGetBlockChainInfo,
-	"getblockcount":                      handleGetBlockCount,
-	"getblockhash":                       handleGetBlockHash,
-	"getblockheader":                     handleGetBlockHeader,
-	"getblocktemplate":                   handleGetBlockTemplate,
-	"getchaintips":                       handleGetChainTips,
-	"getcfilter":                         handleGetCFilter,
-	"getcfilterheader":                   handleGetCFilterHeader,
-	"getconnectioncount":                 handleGetConnectionCount,
-	"getcurrentnet":                      handleGetCurrentNet,
-	"getdifficulty":                      handleGetDifficulty,
-	"getgenerate":                        handleGetGenerate,
-	"gethashespersec":                    handleGetHashesPerSec,
-	"getheaders":                         handleGetHeaders,
-	"getinfo":                            handleGetInfo,
-	"getmempoolinfo":                     handleGetMempoolInfo,
-	"getmininginfo":                      handleGetMiningInfo,
-	"getmnemonicwords":                   handleGetMnemonicWords,
-	"getnettotals":                       handleGetNetTotals,
-	"gettxtotals":                        handleGetTxTotals,
-	"getnetworkhashps":                   handleGetNetworkHashPS,
-	"getnodeaddresses":                   handleGetNodeAddresses,
-	"getpeerinfo":                        handleGetPeerInfo,
-	"getrawmempool":                      handleGetRawMempool,
-	"getrawtransaction":                  handleGetRawTransaction,
-	"gettxout":                           handleGetTxOut,
-	"getutreexoproof":                    handleGetUtreexoProof,
-	"getutreexoroots":                    handleGetUtreexoRoots,
-	"getutreexoblocksummaryroots":        handleGetUtreexoBlockSummaryRoots,
-	"getwatchonlybalance":                handleGetWatchOnlyBalance,
-	"invalidateblock":                    handleInvalidateBlock,
-	"help":                               handleHelp,
-	"listbdktransactions":                handleListBDKTransactions,
-	"listbdkutxos":                       handleListBDKUTXOs,
-	"node":                               handleNode,
-	"peekaddress":                        handlePeekAddress,
-	"ping":                               handlePing,
-	"proveutxochaintipinclusion":         handleProveUtxoChainTipInclusion,
-	"provewatchonlychaintipinclusion":    handleProveWatchOnlyChainTipInclusion,
-	"rebroadcastunconfirmedbdktxs":       handleRebroadcastUnconfirmedBDKTxs,
-	"reconsiderblock":                    handleReconsiderBlock,
-	"registeraddressestowatchonlywallet": handleRegisterAddressesToWatchOnlyWallet,
-	"searchrawtransactions":              handleSearchRawTransactions,
-	"sendrawtransaction":                 handleSendRawTransaction,
-	"setgenerate":                        handleSetGenerate,
-	"signmessagewithprivkey":             handleSignMessageWithPrivKey,
-	"stop":                               handleStop,
-	"submitblock":                        handleSubmitBlock,
-	"unusedaddress":                      handleUnusedAddress,
-	"uptime":                             handleUptime,
-	"validateaddress":                    handleValidateAddress,
-	"verifychain":                        handleVerifyChain,
-	"verifymessage":                      handleVerifyMessage,
-	"verifyutxochaintipinclusionproof":   handleVerifyUtxoChainTipInclusionProof,
-	"version":                            handleVersion,
-	"testmempoolaccept":                  handleTestMempoolAccept,
+	"addnode":                              handleAddNode,
+	"balance":                              handleBalance,
+	"backuputreexostate":                   handleBackupUtreexoState,
+	"compactproofs":                        handleCompactProofs,
+	"createtransactionfrombdkwallet":       handleCreateTransactionFromBDKWallet,
+	"createpsbt":                           handleCreatePsbt,
+	"createrawtransaction":                 handleCreateRawTransaction,
+	"debuglevel":                           handleDebugLevel,
+	"decoderawtransaction":                 handleDecodeRawTransaction,
+	"decodescript":                         handleDecodeScript,
+	"dumptxoutset":                         handleDumpTxOutSet,
+	"estimatefee":                          handleEstimateFee,
+	"estimatesmartfee":                     handleEstimateSmartFee,
+	"finalizepsbt":                         handleFinalizePsbt,
+	"freshaddress":                         handleFreshAddress,
+	"generate":                             handleGenerate,
+	"generateblock":                        handleGenerateBlock,
+	"generatetoaddress":                    handleGenerateToAddress,
+	"generatetestutxos":                    handleGenerateTestUtxos,
+	"getaddednodeinfo":                     handleGetAddedNodeInfo,
+	"getbestblock":                         handleGetBestBlock,
+	"getbestblockhash":                     handleGetBestBlockHash,
+	"getbeststate":                         handleGetBestState,
+	"getblock":                             handleGetBlock,
+	"getblockchaininfo":                    handleGetBlockChainInfo,
+	"getblockcount":                        handleGetBlockCount,
+	"getblockhash":                         handleGetBlockHash,
+	"getblockheader":                       handleGetBlockHeader,
+	"getblockscrubinfo":                    handleGetBlockScrubInfo,
+	"getblocktemplate":                     handleGetBlockTemplate,
+	"getchaintips":                         handleGetChainTips,
+	"getbootstrappackage":                  handleGetBootstrapPackage,
+	"getcfilter":                           handleGetCFilter,
+	"getcfilterheader":                     handleGetCFilterHeader,
+	"getconformancevectors":                handleGetConformanceVectors,
+	"getconnectioncount":                   handleGetConnectionCount,
+	"getcurrentnet":                        handleGetCurrentNet,
+	"getdeploymentinfo":                    handleGetDeploymentInfo,
+	"getdifficulty":                        handleGetDifficulty,
+	"getdiskusage":                         handleGetDiskUsage,
+	"getgenerate":                          handleGetGenerate,
+	"gethashespersec":                      handleGetHashesPerSec,
+	"getheaders":                           handleGetHeaders,
+	"getindexinfo":                         handleGetIndexInfo,
+	"getinfo":                              handleGetInfo,
+	"getmempoolinfo":                       handleGetMempoolInfo,
+	"getmininginfo":                        handleGetMiningInfo,
+	"getmnemonicwords":                     handleGetMnemonicWords,
+	"getnettotals":                         handleGetNetTotals,
+	"gettxtotals":                          handleGetTxTotals,
+	"getnetworkhashps":                     handleGetNetworkHashPS,
+	"getnodeaddresses":                     handleGetNodeAddresses,
+	"getpeerinfo":                          handleGetPeerInfo,
+	"getpeerpolicyinfo":                    handleGetPeerPolicyInfo,
+	"getpeerreputation":                    handleGetPeerReputation,
+	"getrawmempool":                        handleGetRawMempool,
+	"getrawtransaction":                    handleGetRawTransaction,
+	"gettxout":                             handleGetTxOut,
+	"getutreexoinfo":                       handleGetUtreexoInfo,
+	"getutreexoproof":                      handleGetUtreexoProof,
+	"getutreexoproofs":                     handleGetUtreexoProofs,
+	"getutreexoproofstats":                 handleGetUtreexoProofStats,
+	"getleafatposition":                    handleGetLeafAtPosition,
+	"getleafbyhash":                        handleGetLeafByHash,
+	"getcoinagestats":                      handleGetCoinAgeStats,
+	"getleafttls":                          handleGetLeafTTLs,
+	"gethistoricalroots":                   handleGetHistoricalRoots,
+	"getproofaccessstats":                  handleGetProofAccessStats,
+	"getutreexoroots":                      handleGetUtreexoRoots,
+	"getutreexoblocksummaryroots":          handleGetUtreexoBlockSummaryRoots,
+	"getwalletutxos":                       handleGetWalletUtxos,
+	"getwatchonlybalance":                  handleGetWatchOnlyBalance,
+	"invalidateblock":                      handleInvalidateBlock,
+	"help":                                 handleHelp,
+	"listbdktransactions":                  handleListBDKTransactions,
+	"listbdkutxos":                         handleListBDKUTXOs,
+	"listutxoset":                          handleListUtxoSet,
+	"node":                                 handleNode,
+	"peekaddress":                          handlePeekAddress,
+	"ping":                                 handlePing,
+	"proveutxo":                            handleProveUtxo,
+	"proveutxochaintipinclusion":           handleProveUtxoChainTipInclusion,
+	"provewatchonlychaintipinclusion":      handleProveWatchOnlyChainTipInclusion,
+	"rebroadcastunconfirmedbdktxs":         handleRebroadcastUnconfirmedBDKTxs,
+	"reconsiderblock":                      handleReconsiderBlock,
+	"registeraddressestowatchonlywallet":   handleRegisterAddressesToWatchOnlyWallet,
+	"registerdescriptorstowatchonlywallet": handleRegisterDescriptorsToWatchOnlyWallet,
+	"searchrawtransactions":                handleSearchRawTransactions,
+	"sendrawtransaction":                   handleSendRawTransaction,
+	"sendrawtransactionwithproof":          handleSendRawTransactionWithProof,
+	"setgenerate":                          handleSetGenerate,
+	"signmessagewithprivkey":               handleSignMessageWithPrivKey,
+	"stop":                                 handleStop,
+	"submitblock":                          handleSubmitBlock,
+	"submitpackage":                        handleSubmitPackage,
+	"unusedaddress":                        handleUnusedAddress,
+	"uptime":                               handleUptime,
+	"utxoupdatepsbt":                       handleUtxoUpdatePsbt,
+	"validateaddress":                      handleValidateAddress,
+	"verifychain":                          handleVerifyChain,
+	"verifymessage":                        handleVerifyMessage,
+	"verifyutreexoproof":                   handleVerifyUtreexoProof,
+	"verifyutxochaintipinclusionproof":     handleVerifyUtxoChainTipInclusionProof,
+	"version":                              handleVersion,
+	"testmempoolaccept":                    handleTestMempoolAccept,
 }
 
 // list of commands that we recognize, but for which btcd has no support because
@@ -286,10 +339,13 @@ var rpcLimited = map[string]struct{}{
 	"help": {},
 
 	// HTTP/S-only commands
+	"createpsbt":                  {},
 	"createrawtransaction":        {},
 	"decoderawtransaction":        {},
 	"decodescript":                {},
 	"estimatefee":                 {},
+	"estimatesmartfee":            {},
+	"finalizepsbt":                {},
 	"getbestblock":                {},
 	"getbestblockhash":            {},
 	"getbeststate":                {},
@@ -298,11 +354,15 @@ var rpcLimited = map[string]struct{}{
 	"getblockhash":                {},
 	"getblockheader":              {},
 	"getchaintips":                {},
+	"getbootstrappackage":         {},
 	"getcfilter":                  {},
 	"getcfilterheader":            {},
+	"getconformancevectors":       {},
 	"getcurrentnet":               {},
+	"getdeploymentinfo":           {},
 	"getdifficulty":               {},
 	"getheaders":                  {},
+	"getindexinfo":                {},
 	"getinfo":                     {},
 	"getnettotals":                {},
 	"gettxtotals":                 {},
@@ -310,18 +370,31 @@ var rpcLimited = map[string]struct{}{
 	"getrawmempool":               {},
 	"getrawtransaction":           {},
 	"gettxout":                    {},
+	"getutreexoinfo":              {},
 	"getutreexoproof":             {},
+	"getutreexoproofs":            {},
+	"getutreexoproofstats":        {},
+	"getleafatposition":           {},
+	"getleafbyhash":               {},
+	"getcoinagestats":             {},
+	"getleafttls":                 {},
+	"gethistoricalroots":          {},
 	"getutreexoroots":             {},
 	"getutreexoblocksummaryroots": {},
 	"invalidateblock":             {},
+	"listutxoset":                 {},
+	"proveutxo":                   {},
 	"proveutxochaintipinclusion":  {},
 	"reconsiderblock":             {},
 	"searchrawtransactions":       {},
 	"sendrawtransaction":          {},
+	"sendrawtransactionwithproof": {},
 	"submitblock":                 {},
+	"submitpackage":               {},
 	"uptime":                      {},
 	"validateaddress":             {},
 	"verifymessage":               {},
+	"verifyutreexoproof":          {},
 	"version":                     {},
 }
 
@@ -377,16 +450,21 @@ type gbtWorkState struct {
 	prevHash      *chainhash.Hash
 	minTimestamp  time.Time
 	template      *mining.BlockTemplate
+	utreexoProof  *wire.UData
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+	chainParams   *chaincfg.Params
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+func newGbtWorkState(timeSource blockchain.MedianTimeSource,
+	chainParams *chaincfg.Params) *gbtWorkState {
+
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
-		timeSource: timeSource,
+		notifyMap:   make(map[chainhash.Hash]map[int64]chan struct{}),
+		timeSource:  timeSource,
+		chainParams: chainParams,
 	}
 }
 
@@ -620,7 +698,7 @@ func handleCreateTransactionFromBDKWallet(s *rpcServer, cmd interface{}, closeCh
 		// Notify bdkwallet and other listeners.
 		s.NotifyNewTransactions([]*mempool.TxDesc{txD})
 	} else {
-		err = s.rpcProcessTx(tx, true, false)
+		err = s.rpcProcessTx(tx, nil, true, false)
 		if err != nil {
 			return nil, err
 		}
@@ -650,9 +728,31 @@ func messageToHex(msg wire.Message) (string, error) {
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
 
+	mtx, err := s.createUnsignedTx(c.Inputs, c.Amounts, c.LockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the serialized and hex-encoded transaction.  Note that this
+	// is intentionally not directly returning because the first return
+	// value is a string and it would result in returning an empty string to
+	// the client instead of nothing (nil) in the case of an error.
+	mtxHex, err := messageToHex(mtx)
+	if err != nil {
+		return nil, err
+	}
+	return mtxHex, nil
+}
+
+// createUnsignedTx returns a transaction spending the given inputs to the given
+// addresses and amounts.  It's shared by the createrawtransaction and createpsbt
+// commands.
+func (s *rpcServer) createUnsignedTx(inputs []btcjson.TransactionInput,
+	amounts map[string]float64, lockTime *int64) (*wire.MsgTx, error) {
+
 	// Validate the locktime, if given.
-	if c.LockTime != nil &&
-		(*c.LockTime < 0 || *c.LockTime > int64(wire.MaxTxInSequenceNum)) {
+	if lockTime != nil &&
+		(*lockTime < 0 || *lockTime > int64(wire.MaxTxInSequenceNum)) {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCInvalidParameter,
 			Message: "Locktime out of range",
@@ -662,7 +762,7 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	// Add all transaction inputs to a new transaction after performing
 	// some validity checks.
 	mtx := wire.NewMsgTx(wire.TxVersion)
-	for _, input := range c.Inputs {
+	for _, input := range inputs {
 		txHash, err := chainhash.NewHashFromStr(input.Txid)
 		if err != nil {
 			return nil, rpcDecodeHexError(input.Txid)
@@ -670,7 +770,7 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 
 		prevOut := wire.NewOutPoint(txHash, input.Vout)
 		txIn := wire.NewTxIn(prevOut, []byte{}, nil)
-		if c.LockTime != nil && *c.LockTime != 0 {
+		if lockTime != nil && *lockTime != 0 {
 			txIn.Sequence = wire.MaxTxInSequenceNum - 1
 		}
 		mtx.AddTxIn(txIn)
@@ -679,7 +779,7 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	// Add all transaction outputs to the transaction after performing
 	// some validity checks.
 	params := s.cfg.ChainParams
-	for encodedAddr, amount := range c.Amounts {
+	for encodedAddr, amount := range amounts {
 		// Ensure amount is in the valid range for monetary amounts.
 		if amount <= 0 || amount*btcutil.SatoshiPerBitcoin > btcutil.MaxSatoshi {
 			return nil, &btcjson.RPCError{
@@ -703,6 +803,9 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 		switch addr.(type) {
 		case *btcutil.AddressPubKeyHash:
 		case *btcutil.AddressScriptHash:
+		case *btcutil.AddressWitnessPubKeyHash:
+		case *btcutil.AddressWitnessScriptHash:
+		case *btcutil.AddressTaproot:
 		default:
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCInvalidAddressOrKey,
@@ -736,19 +839,34 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	}
 
 	// Set the Locktime, if given.
-	if c.LockTime != nil {
-		mtx.LockTime = uint32(*c.LockTime)
+	if lockTime != nil {
+		mtx.LockTime = uint32(*lockTime)
 	}
 
-	// Return the serialized and hex-encoded transaction.  Note that this
-	// is intentionally not directly returning because the first return
-	// value is a string and it would result in returning an empty string to
-	// the client instead of nothing (nil) in the case of an error.
-	mtxHex, err := messageToHex(mtx)
+	return mtx, nil
+}
+
+// handleCreatePsbt implements the createpsbt command.
+func handleCreatePsbt(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.CreatePsbtCmd)
+
+	mtx, err := s.createUnsignedTx(c.Inputs, c.Amounts, c.LockTime)
 	if err != nil {
 		return nil, err
 	}
-	return mtxHex, nil
+
+	packet, err := psbt.NewFromUnsignedTx(mtx)
+	if err != nil {
+		context := "Failed to create psbt"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		context := "Failed to encode psbt"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return encoded, nil
 }
 
 // handleDebugLevel handles debuglevel commands.
@@ -993,6 +1111,87 @@ func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return reply, nil
 }
 
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	if s.cfg.Chain.IsUtreexoViewActive() {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The utxo set is only kept with --noutreexo or " +
+				"a utreexo proof index enabled",
+		}
+	}
+	c := cmd.(*btcjson.DumpTxOutSetCmd)
+
+	best := s.cfg.Chain.BestSnapshot()
+	height := best.Height
+	if c.Height != nil {
+		height = *c.Height
+	}
+	if height < 0 || height > best.Height {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Block height must be within 0 to %d",
+				best.Height),
+		}
+	}
+
+	// Relative paths are taken from the data directory like Bitcoin Core
+	// does.  The snapshot is written to a temporary file first so that a
+	// partially written snapshot is never left at the path.
+	path := c.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	if fileExists(path) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists", path),
+		}
+	}
+	tmpPath := path + ".incomplete"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't create the snapshot file. Error: %v", err),
+		}
+	}
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	info, err := s.cfg.Chain.DumpUtxoSnapshot(w, height, closeChan)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't write the utxo snapshot at "+
+				"height %d. Error: %v", height, err),
+		}
+	}
+	rpcsLog.Infof("Wrote %d coins of the utxo set at block %v (height %d) to %s",
+		info.CoinsCount, info.BlockHash, info.Height, path)
+
+	return &btcjson.DumpTxOutSetResult{
+		CoinsWritten: info.CoinsCount,
+		BaseHash:     info.BlockHash.String(),
+		BaseHeight:   info.Height,
+		Path:         path,
+	}, nil
+}
+
 // handleEstimateFee handles estimatefee commands.
 func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.EstimateFeeCmd)
@@ -1015,6 +1214,117 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return float64(feeRate), nil
 }
 
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	if s.cfg.SmartFeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget < 1 || c.ConfTarget > mempool.MaxSmartFeeTarget {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid conf_target, must be "+
+				"between 1 and %d", mempool.MaxSmartFeeTarget),
+		}
+	}
+
+	conservative := true
+	if c.EstimateMode != nil {
+		switch *c.EstimateMode {
+		case btcjson.EstimateModeUnset, btcjson.EstimateModeConservative:
+		case btcjson.EstimateModeEconomical:
+			conservative = false
+		default:
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid estimate_mode parameter",
+			}
+		}
+	}
+
+	feeRate, blocks, err := s.cfg.SmartFeeEstimator.EstimateSmartFee(
+		int(c.ConfTarget), conservative)
+	result := &btcjson.EstimateSmartFeeResult{Blocks: int64(blocks)}
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result, nil
+	}
+
+	// Transactions paying less than the minimum relay fee aren't relayed
+	// so never estimate below it.
+	feeRate = max(feeRate, cfg.minRelayTxFee)
+	btcPerKvB := feeRate.ToBTC()
+	result.FeeRate = &btcPerKvB
+
+	return result, nil
+}
+
+// decodePsbt parses the base64 encoded psbt passed in to a command.
+func decodePsbt(b64 string) (*psbt.Packet, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(b64), true)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "PSBT decode failed: " + err.Error(),
+		}
+	}
+
+	return packet, nil
+}
+
+// handleFinalizePsbt implements the finalizepsbt command.
+func handleFinalizePsbt(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.FinalizePsbtCmd)
+
+	packet, err := decodePsbt(c.Psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &btcjson.FinalizePsbtResult{
+		Complete: psbt.MaybeFinalizeAll(packet),
+	}
+
+	// Hand back the psbt if it's not complete or if the caller doesn't want
+	// the final transaction.
+	if !result.Complete || (c.Extract != nil && !*c.Extract) {
+		result.Psbt, err = packet.B64Encode()
+		if err != nil {
+			context := "Failed to encode psbt"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		return result, nil
+	}
+
+	tx, err := psbt.Extract(packet)
+	if err != nil {
+		context := "Failed to extract transaction"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	result.Hex, err = messageToHex(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the proof of the inputs along with the transaction if the psbt
+	// has one for all of them so that the transaction can be relayed to nodes
+	// that don't keep the utxo set.
+	ud, err := psbt.ExtractUData(packet)
+	if err == nil {
+		var proofBuf bytes.Buffer
+		err := ud.Serialize(&proofBuf)
+		if err != nil {
+			context := "Failed to serialize utreexo proof"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result.Proof = hex.EncodeToString(proofBuf.Bytes())
+	}
+
+	return result, nil
+}
+
 // handleFreshAddress implements the freshaddress command.
 func handleFreshAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Before doing anything, check that the bdk wallet is active.
@@ -1051,14 +1361,8 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 	// Respond with an error if there's virtually 0 chance of mining a block
 	// with the CPU.
-	if !s.cfg.ChainParams.GenerateSupported {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCDifficulty,
-			Message: fmt.Sprintf("No support for `generate` on "+
-				"the current network, %s, as it's unlikely to "+
-				"be possible to mine a block with the CPU.",
-				s.cfg.ChainParams.Net),
-		}
+	if err := s.checkGenerateSupported("generate"); err != nil {
+		return nil, err
 	}
 
 	c := cmd.(*btcjson.GenerateCmd)
@@ -1091,107 +1395,415 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
-// handleGetAddedNodeInfo handles getaddednodeinfo commands.
-func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
+// checkGenerateSupported returns an error if there's virtually 0 chance of
+// mining a block with the CPU on the current network.
+func (s *rpcServer) checkGenerateSupported(method string) error {
+	if s.cfg.ChainParams.GenerateSupported {
+		return nil
+	}
 
-	// Retrieve a list of persistent (added) peers from the server and
-	// filter the list of peers per the specified address (if any).
-	peers := s.cfg.ConnMgr.PersistentPeers()
-	if c.Node != nil {
-		node := *c.Node
-		found := false
-		for i, peer := range peers {
-			if peer.ToPeer().Addr() == node {
-				peers = peers[i : i+1]
-				found = true
-			}
-		}
-		if !found {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCClientNodeNotAdded,
-				Message: "Node has not been added",
-			}
-		}
+	return &btcjson.RPCError{
+		Code: btcjson.ErrRPCDifficulty,
+		Message: fmt.Sprintf("No support for `%s` on the current "+
+			"network, %s, as it's unlikely to be possible to mine "+
+			"a block with the CPU.", method, s.cfg.ChainParams.Net),
 	}
+}
 
-	// Without the dns flag, the result is just a slice of the addresses as
-	// strings.
-	if !c.DNS {
-		results := make([]string, 0, len(peers))
-		for _, peer := range peers {
-			results = append(results, peer.ToPeer().Addr())
+// decodeGenerateAddress decodes the address the coinbase of generated blocks
+// pays to.
+func (s *rpcServer) decodeGenerateAddress(encodedAddr string) (btcutil.Address, error) {
+	addr, err := btcutil.DecodeAddress(encodedAddr, s.cfg.ChainParams)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	if !addr.IsForNet(s.cfg.ChainParams) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + encodedAddr +
+				" is for the wrong network",
 		}
-		return results, nil
 	}
 
-	// With the dns flag, the result is an array of JSON objects which
-	// include the result of DNS lookups for each peer.
-	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(peers))
-	for _, rpcPeer := range peers {
-		// Set the "address" of the peer which could be an ip address
-		// or a domain name.
-		peer := rpcPeer.ToPeer()
-		var result btcjson.GetAddedNodeInfoResult
-		result.AddedNode = peer.Addr()
-		result.Connected = btcjson.Bool(peer.Connected())
+	return addr, nil
+}
 
-		// Split the address into host and port portions so we can do
-		// a DNS lookup against the host.  When no port is specified in
-		// the address, just use the address as the host.
-		host, _, err := net.SplitHostPort(peer.Addr())
-		if err != nil {
-			host = peer.Addr()
-		}
+// handleGenerateToAddress handles generatetoaddress commands.  The maximum
+// number of tries is ignored as the blocks are mined until they're solved.
+func handleGenerateToAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.checkGenerateSupported("generatetoaddress"); err != nil {
+		return nil, err
+	}
 
-		var ipList []string
-		switch {
-		case net.ParseIP(host) != nil, strings.HasSuffix(host, ".onion"):
-			ipList = make([]string, 1)
-			ipList[0] = host
-		default:
-			// Do a DNS lookup for the address.  If the lookup fails, just
-			// use the host.
-			ips, err := btcdLookup(host)
-			if err != nil {
-				ipList = make([]string, 1)
-				ipList[0] = host
-				break
-			}
-			ipList = make([]string, 0, len(ips))
-			for _, ip := range ips {
-				ipList = append(ipList, ip.String())
-			}
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+	if c.NumBlocks <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: "Please request a nonzero number of blocks to generate.",
 		}
+	}
+	addr, err := s.decodeGenerateAddress(c.Address)
+	if err != nil {
+		return nil, err
+	}
 
-		// Add the addresses and connection info to the result.
-		addrs := make([]btcjson.GetAddedNodeInfoResultAddr, 0, len(ipList))
-		for _, ip := range ipList {
-			var addr btcjson.GetAddedNodeInfoResultAddr
-			addr.Address = ip
-			addr.Connected = "false"
-			if ip == host && peer.Connected() {
-				addr.Connected = directionString(peer.Inbound())
-			}
-			addrs = append(addrs, addr)
+	payToAddrs := make([]btcutil.Address, c.NumBlocks)
+	for i := range payToAddrs {
+		payToAddrs[i] = addr
+	}
+	blockHashes, err := s.cfg.CPUMiner.GenerateBlocksTo(payToAddrs)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
 		}
-		result.Addresses = &addrs
-		results = append(results, &result)
 	}
-	return results, nil
-}
 
-// handleGetBestBlock implements the getbestblock command.
-func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	// All other "get block" commands give either the height, the
-	// hash, or both but require the block SHA.  This gets both for
-	// the best block.
-	best := s.cfg.Chain.BestSnapshot()
-	result := &btcjson.GetBestBlockResult{
-		Hash:   best.Hash.String(),
-		Height: best.Height,
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.String()
 	}
-	return result, nil
+
+	return reply, nil
+}
+
+// handleGenerateBlock handles generateblock commands.
+func handleGenerateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.checkGenerateSupported("generateblock"); err != nil {
+		return nil, err
+	}
+
+	c := cmd.(*btcjson.GenerateBlockCmd)
+	addr, err := s.decodeGenerateAddress(c.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	// The transactions are either txids of transactions in the memory pool
+	// or raw transactions.
+	txs := make([]*btcutil.Tx, 0, len(c.Transactions))
+	for _, str := range c.Transactions {
+		if len(str) == chainhash.MaxHashStringSize {
+			txHash, err := chainhash.NewHashFromStr(str)
+			if err != nil {
+				return nil, rpcDecodeHexError(str)
+			}
+			tx, err := s.cfg.TxMemPool.FetchTransaction(txHash)
+			if err != nil {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidAddressOrKey,
+					Message: fmt.Sprintf("Transaction %v not "+
+						"in mempool.", txHash),
+				}
+			}
+			txs = append(txs, tx)
+			continue
+		}
+
+		msgTx, err := decodeRawTx(str)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, btcutil.NewTx(msgTx))
+	}
+
+	blockHash, err := s.cfg.CPUMiner.GenerateBlock(addr, txs)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: err.Error(),
+		}
+	}
+
+	return &btcjson.GenerateBlockResult{Hash: blockHash.String()}, nil
+}
+
+const (
+	// maxTestUtxos is the maximum number of unspent outputs that can be
+	// created by one generatetestutxos request.  A block is mined for each
+	// of them.
+	maxTestUtxos = 1000
+
+	// defaultTestUtxoScriptType is the script type of the outputs created
+	// by generatetestutxos when none are given.
+	defaultTestUtxoScriptType = "p2wpkh"
+)
+
+// testUtxoAddress returns the address of the given script type that's spent by
+// the given public key.
+func testUtxoAddress(scriptType string, pubKey *btcec.PublicKey,
+	params *chaincfg.Params) (btcutil.Address, error) {
+
+	pkHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	switch scriptType {
+	case "p2pkh":
+		return btcutil.NewAddressPubKeyHash(pkHash, params)
+
+	case "p2wpkh":
+		return btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+
+	case "p2sh-p2wpkh":
+		witnessAddr, err := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+		if err != nil {
+			return nil, err
+		}
+		redeemScript, err := txscript.PayToAddrScript(witnessAddr)
+		if err != nil {
+			return nil, err
+		}
+		return btcutil.NewAddressScriptHash(redeemScript, params)
+
+	case "p2tr":
+		outputKey := txscript.ComputeTaprootKeyNoScript(pubKey)
+		return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), params)
+
+	default:
+		return nil, fmt.Errorf("unsupported script type %q. Supported "+
+			"script types are p2pkh, p2wpkh, p2sh-p2wpkh and p2tr",
+			scriptType)
+	}
+}
+
+// handleGenerateTestUtxos handles generatetestutxos commands.
+func handleGenerateTestUtxos(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// The keys of the outputs are handed out so they're only of use on the
+	// test networks where the coins are worthless.
+	if !(cfg.RegressionTest || cfg.SimNet) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "generatetestutxos is only available on regtest " +
+				"or simnet",
+		}
+	}
+
+	c := cmd.(*btcjson.GenerateTestUtxosCmd)
+	if c.Count == 0 || c.Count > maxTestUtxos {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Count must be between 1 and %d",
+				maxTestUtxos),
+		}
+	}
+	proofIndex := s.cfg.UtreexoProofIndex != nil || s.cfg.FlatUtreexoProofIndex != nil
+	if proofIndex {
+		if err := s.checkProofTargets(int(c.Count)); err != nil {
+			return nil, err
+		}
+	}
+
+	scriptTypes := []string{defaultTestUtxoScriptType}
+	if c.ScriptTypes != nil && len(*c.ScriptTypes) > 0 {
+		scriptTypes = *c.ScriptTypes
+	}
+
+	// Create a key for each output with the script types taking turns.
+	params := s.cfg.ChainParams
+	utxos := make([]btcjson.TestUtxoResult, c.Count)
+	payToAddrs := make([]btcutil.Address, 0,
+		int(c.Count)+int(params.CoinbaseMaturity))
+	for i := range utxos {
+		scriptType := scriptTypes[i%len(scriptTypes)]
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to create a private key")
+		}
+		addr, err := testUtxoAddress(scriptType, privKey.PubKey(), params)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+		wif, err := btcutil.NewWIF(privKey, params, true)
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to encode the private key")
+		}
+
+		utxos[i] = btcjson.TestUtxoResult{
+			ScriptType: scriptType,
+			Address:    addr.EncodeAddress(),
+			PrivKey:    wif.String(),
+		}
+		payToAddrs = append(payToAddrs, addr)
+	}
+
+	// Mine enough blocks on top for the coinbases to be spendable.  They pay
+	// to the mining addresses when there are any and to the last created
+	// address otherwise.
+	for i := 0; i < int(params.CoinbaseMaturity); i++ {
+		if len(cfg.miningAddrs) > 0 {
+			payToAddrs = append(payToAddrs,
+				cfg.miningAddrs[i%len(cfg.miningAddrs)])
+		} else {
+			payToAddrs = append(payToAddrs, payToAddrs[c.Count-1])
+		}
+	}
+
+	blockHashes, err := s.cfg.CPUMiner.GenerateBlocksTo(payToAddrs)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+
+	// Each output is the coinbase output of its block that pays to its
+	// address.
+	outpoints := make([]wire.OutPoint, 0, len(utxos))
+	for i := range utxos {
+		block, err := s.cfg.Chain.BlockByHash(blockHashes[i])
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to fetch a generated block")
+		}
+		pkScript, err := txscript.PayToAddrScript(payToAddrs[i])
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to create the public key script")
+		}
+		coinbase := block.Transactions()[0]
+		vout := -1
+		for j, txOut := range coinbase.MsgTx().TxOut {
+			if bytes.Equal(txOut.PkScript, pkScript) {
+				vout = j
+				break
+			}
+		}
+		if vout < 0 {
+			return nil, internalRPCError("no coinbase output pays "+
+				"to "+utxos[i].Address, "Failed to find a generated "+
+				"output")
+		}
+
+		utxos[i].Txid = coinbase.Hash().String()
+		utxos[i].Vout = uint32(vout)
+		utxos[i].Amount = btcutil.Amount(
+			coinbase.MsgTx().TxOut[vout].Value).ToBTC()
+		utxos[i].PkScript = hex.EncodeToString(pkScript)
+		utxos[i].BlockHash = blockHashes[i].String()
+		utxos[i].Height = block.Height()
+		outpoints = append(outpoints, *wire.NewOutPoint(coinbase.Hash(),
+			uint32(vout)))
+	}
+
+	result := &btcjson.GenerateTestUtxosResult{Utxos: utxos}
+	if proofIndex {
+		proof, err := s.proveOutpoints(outpoints)
+		if err != nil {
+			return nil, err
+		}
+		result.Proof = chainTipProofResult(proof, proof.String())
+	}
+
+	return result, nil
+}
+
+// handleGetAddedNodeInfo handles getaddednodeinfo commands.
+func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
+
+	// Retrieve a list of persistent (added) peers from the server and
+	// filter the list of peers per the specified address (if any).
+	peers := s.cfg.ConnMgr.PersistentPeers()
+	if c.Node != nil {
+		node := *c.Node
+		found := false
+		for i, peer := range peers {
+			if peer.ToPeer().Addr() == node {
+				peers = peers[i : i+1]
+				found = true
+			}
+		}
+		if !found {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientNodeNotAdded,
+				Message: "Node has not been added",
+			}
+		}
+	}
+
+	// Without the dns flag, the result is just a slice of the addresses as
+	// strings.
+	if !c.DNS {
+		results := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			results = append(results, peer.ToPeer().Addr())
+		}
+		return results, nil
+	}
+
+	// With the dns flag, the result is an array of JSON objects which
+	// include the result of DNS lookups for each peer.
+	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(peers))
+	for _, rpcPeer := range peers {
+		// Set the "address" of the peer which could be an ip address
+		// or a domain name.
+		peer := rpcPeer.ToPeer()
+		var result btcjson.GetAddedNodeInfoResult
+		result.AddedNode = peer.Addr()
+		result.Connected = btcjson.Bool(peer.Connected())
+
+		// Split the address into host and port portions so we can do
+		// a DNS lookup against the host.  When no port is specified in
+		// the address, just use the address as the host.
+		host, _, err := net.SplitHostPort(peer.Addr())
+		if err != nil {
+			host = peer.Addr()
+		}
+
+		var ipList []string
+		switch {
+		case net.ParseIP(host) != nil, strings.HasSuffix(host, ".onion"):
+			ipList = make([]string, 1)
+			ipList[0] = host
+		default:
+			// Do a DNS lookup for the address.  If the lookup fails, just
+			// use the host.
+			ips, err := btcdLookup(host)
+			if err != nil {
+				ipList = make([]string, 1)
+				ipList[0] = host
+				break
+			}
+			ipList = make([]string, 0, len(ips))
+			for _, ip := range ips {
+				ipList = append(ipList, ip.String())
+			}
+		}
+
+		// Add the addresses and connection info to the result.
+		addrs := make([]btcjson.GetAddedNodeInfoResultAddr, 0, len(ipList))
+		for _, ip := range ipList {
+			var addr btcjson.GetAddedNodeInfoResultAddr
+			addr.Address = ip
+			addr.Connected = "false"
+			if ip == host && peer.Connected() {
+				addr.Connected = directionString(peer.Inbound())
+			}
+			addrs = append(addrs, addr)
+		}
+		result.Addresses = &addrs
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+// handleGetBestBlock implements the getbestblock command.
+func handleGetBestBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// All other "get block" commands give either the height, the
+	// hash, or both but require the block SHA.  This gets both for
+	// the best block.
+	best := s.cfg.Chain.BestSnapshot()
+	result := &btcjson.GetBestBlockResult{
+		Hash:   best.Hash.String(),
+		Height: best.Height,
+	}
+	return result, nil
 }
 
 // handleGetBestBlockHash implements the getbestblockhash command.
@@ -1321,6 +1933,23 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 
 		blockReply.Tx = txNames
 	} else {
+		// Verbosity 3 also includes the decoded utreexo data.  The
+		// genesis block spends nothing so it has none.
+		if *c.Verbosity >= 3 {
+			blockReply.UData = &btcjson.UDataResult{
+				Targets:     []uint64{},
+				ProofHashes: []string{},
+				LeafDatas:   []btcjson.LeafDataResult{},
+			}
+			if blockHeight > 0 {
+				udata, targetHashes, err := s.fetchUtreexoProof(hash)
+				if err != nil {
+					return nil, err
+				}
+				blockReply.UData = udataResult(udata, targetHashes)
+			}
+		}
+
 		txns := blk.Transactions()
 		rawTxns := make([]btcjson.TxRawResult, len(txns))
 		for i, tx := range txns {
@@ -1357,6 +1986,57 @@ func softForkStatus(state blockchain.ThresholdState) (string, error) {
 	}
 }
 
+// deploymentForkName maps the integer deployment ID into a human readable
+// fork-name.
+func deploymentForkName(deployment int) (string, error) {
+	switch deployment {
+	case chaincfg.DeploymentTestDummy:
+		return "dummy", nil
+
+	case chaincfg.DeploymentTestDummyMinActivation:
+		return "dummy-min-activation", nil
+
+	case chaincfg.DeploymentCSV:
+		return "csv", nil
+
+	case chaincfg.DeploymentSegwit:
+		return "segwit", nil
+
+	case chaincfg.DeploymentTaproot:
+		return "taproot", nil
+
+	default:
+		return "", &btcjson.RPCError{
+			Code: btcjson.ErrRPCInternal.Code,
+			Message: fmt.Sprintf("Unknown deployment %v "+
+				"detected", deployment),
+		}
+	}
+}
+
+// deploymentTimes returns the median times at which the deployment starts and
+// times out as unix times.  They're 0 when the deployment isn't bound by time.
+func deploymentTimes(deployment *chaincfg.ConsensusDeployment) (int64, int64) {
+	var startTime, endTime int64
+	if starter, ok := deployment.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter); ok {
+		startTime = starter.StartTime().Unix()
+	}
+	if ender, ok := deployment.DeploymentEnder.(*chaincfg.MedianTimeDeploymentEnder); ok {
+		endTime = ender.EndTime().Unix()
+	}
+	return startTime, endTime
+}
+
+// healthWarning returns the warning about the health of the node or an empty
+// string if there's nothing to warn about.
+func (s *rpcServer) healthWarning() string {
+	if s.cfg.StaleTipMonitor == nil {
+		return ""
+	}
+
+	return s.cfg.StaleTipMonitor.Warning()
+}
+
 // handleGetBlockChainInfo implements the getblockchaininfo command.
 func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Obtain a snapshot of the current best known blockchain state. We'll
@@ -1373,6 +2053,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
 		MedianTime:    chainSnapshot.MedianTime.Unix(),
 		Pruned:        cfg.Prune != 0,
+		Warnings:      s.healthWarning(),
 		SoftForks: &btcjson.SoftForks{
 			Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
 		},
@@ -1417,29 +2098,9 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	for deployment, deploymentDetails := range params.Deployments {
 		// Map the integer deployment ID into a human readable
 		// fork-name.
-		var forkName string
-		switch deployment {
-		case chaincfg.DeploymentTestDummy:
-			forkName = "dummy"
-
-		case chaincfg.DeploymentTestDummyMinActivation:
-			forkName = "dummy-min-activation"
-
-		case chaincfg.DeploymentCSV:
-			forkName = "csv"
-
-		case chaincfg.DeploymentSegwit:
-			forkName = "segwit"
-
-		case chaincfg.DeploymentTaproot:
-			forkName = "taproot"
-
-		default:
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInternal.Code,
-				Message: fmt.Sprintf("Unknown deployment %v "+
-					"detected", deployment),
-			}
+		forkName, err := deploymentForkName(deployment)
+		if err != nil {
+			return nil, err
 		}
 
 		// Query the chain for the current status of the deployment as
@@ -1464,13 +2125,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 
 		// Finally, populate the soft-fork description with all the
 		// information gathered above.
-		var startTime, endTime int64
-		if starter, ok := deploymentDetails.DeploymentStarter.(*chaincfg.MedianTimeDeploymentStarter); ok {
-			startTime = starter.StartTime().Unix()
-		}
-		if ender, ok := deploymentDetails.DeploymentEnder.(*chaincfg.MedianTimeDeploymentEnder); ok {
-			endTime = ender.EndTime().Unix()
-		}
+		startTime, endTime := deploymentTimes(&deploymentDetails)
 		chainInfo.SoftForks.Bip9SoftForks[forkName] = &btcjson.Bip9SoftForkDescription{
 			Status:              strings.ToLower(statusString),
 			Bit:                 deploymentDetails.BitNumber,
@@ -1483,12 +2138,120 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return chainInfo, nil
 }
 
-// handleGetBlockCount implements the getblockcount command.
-func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	best := s.cfg.Chain.BestSnapshot()
-	return int64(best.Height), nil
-}
-
+// handleGetDeploymentInfo implements the getdeploymentinfo command.
+func handleGetDeploymentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDeploymentInfoCmd)
+	params := s.cfg.ChainParams
+	chain := s.cfg.Chain
+
+	// Report the deployments at the tip of the main chain unless another
+	// block of the main chain is asked for.
+	best := chain.BestSnapshot()
+	hash, height := best.Hash, best.Height
+	if c.BlockHash != nil {
+		blockHash, err := chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		height, err = chain.BlockHeightByHash(blockHash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCBlockNotFound,
+				Message: fmt.Sprintf("Block %v isn't in the main "+
+					"chain", blockHash),
+			}
+		}
+		hash = *blockHash
+	}
+
+	result := &btcjson.GetDeploymentInfoResult{
+		Hash:        hash.String(),
+		Height:      height,
+		Deployments: make(map[string]*btcjson.DeploymentInfo),
+	}
+
+	// The soft-forks deployed via the super-majority block signalling
+	// mechanism are buried at fixed heights.  Like the BIP0009 ones,
+	// they're reported as active when they're enforced for the next block.
+	buried := []struct {
+		name   string
+		height int32
+	}{
+		{"bip34", params.BIP0034Height},
+		{"bip66", params.BIP0066Height},
+		{"bip65", params.BIP0065Height},
+	}
+	for _, fork := range buried {
+		buriedHeight := fork.height
+		result.Deployments[fork.name] = &btcjson.DeploymentInfo{
+			Type:   "buried",
+			Height: &buriedHeight,
+			Active: height+1 >= buriedHeight,
+		}
+	}
+
+	for deployment := range params.Deployments {
+		forkName, err := deploymentForkName(deployment)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := chain.DeploymentInfo(&hash, uint32(deployment))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		status, err := softForkStatus(info.State)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+		statusNext, err := softForkStatus(info.NextState)
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+
+		details := &params.Deployments[deployment]
+		startTime, endTime := deploymentTimes(details)
+		bip9 := &btcjson.Bip9DeploymentInfo{
+			Bit:                 details.BitNumber,
+			StartTime:           startTime,
+			Timeout:             endTime,
+			MinActivationHeight: int32(details.MinActivationHeight),
+			Status:              status,
+			Since:               info.Since,
+			StatusNext:          statusNext,
+		}
+		if info.Stats != nil {
+			bip9.Statistics = &btcjson.DeploymentStatistics{
+				Period:    info.Stats.Period,
+				Threshold: info.Stats.Threshold,
+				Elapsed:   info.Stats.Elapsed,
+				Count:     info.Stats.Count,
+				Possible:  info.Stats.Possible,
+			}
+		}
+
+		deploymentInfo := &btcjson.DeploymentInfo{
+			Type:   "bip9",
+			Active: info.NextState == blockchain.ThresholdActive,
+			Bip9:   bip9,
+		}
+		if deploymentInfo.Active {
+			activeHeight := info.NextSince
+			deploymentInfo.Height = &activeHeight
+		}
+		result.Deployments[forkName] = deploymentInfo
+	}
+
+	return result, nil
+}
+
+// handleGetBlockCount implements the getblockcount command.
+func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	best := s.cfg.Chain.BestSnapshot()
+	return int64(best.Height), nil
+}
+
 // handleGetBlockHash implements the getblockhash command.
 func handleGetBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockHashCmd)
@@ -1571,6 +2334,50 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return blockHeaderReply, nil
 }
 
+// handleGetBlockScrubInfo implements the getblockscrubinfo command.
+func handleGetBlockScrubInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.BlockScrubber == nil {
+		return &btcjson.GetBlockScrubInfoResult{
+			Issues: []btcjson.BlockScrubIssueResult{},
+		}, nil
+	}
+
+	info := s.cfg.BlockScrubber.Info()
+	reply := &btcjson.GetBlockScrubInfoResult{
+		Enabled:        true,
+		Scrubbing:      info.scrubbing,
+		Passes:         info.passes,
+		Height:         info.height,
+		BlocksChecked:  info.blocksChecked,
+		ProofsChecked:  info.proofsChecked,
+		BadBlocks:      info.badBlocks,
+		RepairedBlocks: info.repairedBlocks,
+		BadProofs:      info.badProofs,
+		Issues:         make([]btcjson.BlockScrubIssueResult, 0, len(info.issues)),
+	}
+	if !info.passStart.IsZero() {
+		reply.PassStart = info.passStart.Unix()
+	}
+	if !info.passEnd.IsZero() {
+		reply.PassEnd = info.passEnd.Unix()
+	}
+	for _, issue := range info.issues {
+		result := btcjson.BlockScrubIssueResult{
+			Kind:   issue.kind.String(),
+			Hash:   issue.hash.String(),
+			Height: issue.height,
+			Error:  issue.err.Error(),
+			Found:  issue.found.Unix(),
+		}
+		if !issue.repairRequested.IsZero() {
+			result.RepairRequested = issue.repairRequested.Unix()
+		}
+		reply.Issues = append(reply.Issues, result)
+	}
+
+	return reply, nil
+}
+
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
 func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
@@ -1720,10 +2527,13 @@ func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGene
 // useCoinbaseValue flag is false and the existing block template does not
 // already contain a valid payment address, the block template will be updated
 // with a randomly selected payment address from the list of configured
-// addresses.
+// addresses.  When includeProof is set, the utreexo proof of the transactions of
+// the block template is generated if it wasn't already.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bool) error {
+func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue,
+	includeProof bool) error {
+
 	generator := s.cfg.Generator
 	lastTxUpdate := generator.TxSource().LastUpdated()
 	if lastTxUpdate.IsZero() {
@@ -1781,6 +2591,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// Update work state to ensure another block template isn't
 		// generated until needed.
 		state.template = template
+		state.utreexoProof = nil
 		state.lastGenerated = time.Now()
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
@@ -1843,15 +2654,72 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 			targetDifficulty)
 	}
 
+	// The proof only depends on the inputs of the transactions so it stays
+	// valid for as long as the template keeps the same transactions.  The
+	// templates generated on the test networks are already proven.
+	if includeProof && state.utreexoProof == nil {
+		ud := msgBlock.UData
+		if ud == nil {
+			var err error
+			ud, err = s.templateUtreexoProof(msgBlock)
+			if err != nil {
+				return err
+			}
+		}
+		state.utreexoProof = ud
+	}
+
 	return nil
 }
 
+// templateUtreexoProof generates the utreexo proof of the outputs spent by the
+// transactions of the passed block template against the current roots of the
+// accumulator.  Outputs created in the template itself are skipped as they're
+// never added to the accumulator.  The caller must check that one of the
+// utreexo proof indexes is enabled.
+func (s *rpcServer) templateUtreexoProof(msgBlock *wire.MsgBlock) (*wire.UData, error) {
+	var tipHash chainhash.Hash
+	if s.cfg.UtreexoProofIndex != nil {
+		_, _, tipHash = s.cfg.UtreexoProofIndex.FetchCurrentUtreexoState()
+	} else {
+		_, _, tipHash = s.cfg.FlatUtreexoProofIndex.FetchCurrentUtreexoState()
+	}
+	if tipHash != msgBlock.Header.PrevBlock {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("The utreexo proof index is at %v "+
+				"instead of the parent %v of the block template",
+				tipHash, msgBlock.Header.PrevBlock),
+		}
+	}
+
+	var (
+		ud  *wire.UData
+		err error
+	)
+	block := btcutil.NewBlock(msgBlock)
+	if s.cfg.UtreexoProofIndex != nil {
+		ud, err = s.cfg.UtreexoProofIndex.ProveBlock(block)
+	} else {
+		ud, err = s.cfg.FlatUtreexoProofIndex.ProveBlock(block)
+	}
+	if err != nil {
+		context := "Failed to prove the block template"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return ud, nil
+}
+
 // blockTemplateResult returns the current block template associated with the
 // state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
-// and returned to the caller.
+// and returned to the caller.  The utreexo proof of the template is included when
+// includeProof is set.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue, includeProof bool,
+	submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+
 	// Ensure the timestamps are still in valid range for the template.
 	// This should really only ever happen if the local clock is changed
 	// after the template is generated, but it's important to avoid serving
@@ -1953,6 +2821,20 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	if template.WitnessCommitment != nil {
 		reply.DefaultWitnessCommitment = hex.EncodeToString(template.WitnessCommitment)
 	}
+	if state.chainParams.SignetChallenge != nil {
+		reply.SignetChallenge = hex.EncodeToString(state.chainParams.SignetChallenge)
+	}
+
+	if includeProof {
+		var buf bytes.Buffer
+		err := state.utreexoProof.Serialize(&buf)
+		if err != nil {
+			context := "Failed to serialize utreexo proof"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		reply.UtreexoProof = hex.EncodeToString(buf.Bytes())
+		reply.Capabilities = gbtProofCapabilities
+	}
 
 	if useCoinbaseValue {
 		reply.CoinbaseAux = gbtCoinbaseAux
@@ -2002,14 +2884,16 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 // has passed without finding a solution.
 //
 // See https://en.bitcoin.it/wiki/BIP_0022 for more details.
-func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue bool, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue,
+	includeProof bool, closeChan <-chan struct{}) (interface{}, error) {
+
 	state := s.gbtWorkState
 	state.Lock()
 	// The state unlock is intentionally not deferred here since it needs to
 	// be manually unlocked before waiting for a notification about block
 	// template changes.
 
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, includeProof); err != nil {
 		state.Unlock()
 		return nil, err
 	}
@@ -2018,7 +2902,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// the caller is invalid.
 	prevHash, lastGenerated, err := decodeTemplateID(longPollID)
 	if err != nil {
-		result, err := state.blockTemplateResult(useCoinbaseValue, nil)
+		result, err := state.blockTemplateResult(useCoinbaseValue, includeProof, nil)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -2040,7 +2924,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 		// already been found and added to the block chain.
 		submitOld := prevHash.IsEqual(prevTemplateHash)
 		result, err := state.blockTemplateResult(useCoinbaseValue,
-			&submitOld)
+			includeProof, &submitOld)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -2072,7 +2956,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	state.Lock()
 	defer state.Unlock()
 
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, includeProof); err != nil {
 		return nil, err
 	}
 
@@ -2080,7 +2964,8 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// block template depending on whether or not a solution has already
 	// been found and added to the block chain.
 	submitOld := prevHash.IsEqual(&state.template.Block.Header.PrevBlock)
-	result, err := state.blockTemplateResult(useCoinbaseValue, &submitOld)
+	result, err := state.blockTemplateResult(useCoinbaseValue,
+		includeProof, &submitOld)
 	if err != nil {
 		return nil, err
 	}
@@ -2094,12 +2979,14 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 // requests.  In addition, it detects the capabilities reported by the caller
 // in regards to whether or not it supports creating its own coinbase (the
 // coinbasetxn and coinbasevalue capabilities) and modifies the returned block
-// template accordingly.
+// template accordingly.  Bridge nodes also include the utreexo proof of the
+// template when the caller reports the utreexoproof capability.
 func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateRequest, closeChan <-chan struct{}) (interface{}, error) {
 	// Extract the relevant passed capabilities and restrict the result to
 	// either a coinbase value or a coinbase transaction object depending on
 	// the request.  Default to only providing a coinbase value.
 	useCoinbaseValue := true
+	var includeProof bool
 	if request != nil {
 		var hasCoinbaseValue, hasCoinbaseTxn bool
 		for _, capability := range request.Capabilities {
@@ -2108,6 +2995,8 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 				hasCoinbaseTxn = true
 			case "coinbasevalue":
 				hasCoinbaseValue = true
+			case "utreexoproof":
+				includeProof = true
 			}
 		}
 
@@ -2127,6 +3016,18 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 		}
 	}
 
+	// Only bridge nodes are able to prove the transactions of the template.
+	if includeProof && s.cfg.UtreexoProofIndex == nil &&
+		s.cfg.FlatUtreexoProofIndex == nil {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled to " +
+				"include the utreexo proof. (--utreexoproofindex) " +
+				"or (--flatutreexoproofindex).",
+		}
+	}
+
 	// Return an error if there are no peers connected since there is no
 	// way to relay a found block or receive transactions to work on.
 	// However, allow this state when running in the regression test or
@@ -2154,7 +3055,7 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	// be replaced with a new one.
 	if request != nil && request.LongPollID != "" {
 		return handleGetBlockTemplateLongPoll(s, request.LongPollID,
-			useCoinbaseValue, closeChan)
+			useCoinbaseValue, includeProof, closeChan)
 	}
 
 	// Protect concurrent access when updating block templates.
@@ -2168,10 +3069,10 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	// seconds since the last template was generated.  Otherwise, the
 	// timestamp for the existing block template is updated (and possibly
 	// the difficulty on testnet per the consesus rules).
-	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
+	if err := state.updateBlockTemplate(s, useCoinbaseValue, includeProof); err != nil {
 		return nil, err
 	}
-	return state.blockTemplateResult(useCoinbaseValue, nil)
+	return state.blockTemplateResult(useCoinbaseValue, includeProof, nil)
 }
 
 // chainErrToGBTErrString converts an error returned from btcchain to a string
@@ -2386,6 +3287,100 @@ func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return ret, nil
 }
 
+// handleGetBootstrapPackage implements the getbootstrappackage command.
+func handleGetBootstrapPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBootstrapPackageCmd)
+
+	// The package starts from the tip when no block is given.
+	blockHash := &s.cfg.Chain.BestSnapshot().Hash
+	var err error
+	if c.BlockHash != nil {
+		blockHash, err = s.parseHashOrHeight(*c.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	height, err := s.cfg.Chain.BlockHeightByHash(blockHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: fmt.Sprintf("Block %v isn't in the main chain", blockHash),
+		}
+	}
+
+	numProofs := int32(0)
+	if c.NumProofs != nil {
+		numProofs = *c.NumProofs
+	}
+	if numProofs < 0 || numProofs > blockchain.MaxBootstrapProofs || numProofs > height {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("The number of proofs must be within 0 to %d",
+				min(blockchain.MaxBootstrapProofs, height)),
+		}
+	}
+
+	bp := &blockchain.BootstrapPackage{GenesisHash: *s.cfg.ChainParams.GenesisHash}
+	if height > 0 {
+		hashes, err := s.cfg.Chain.HeightToHashRange(1, blockHash, int(height))
+		if err != nil {
+			context := "Failed to fetch the block hashes"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		bp.Headers = make([]wire.BlockHeader, 0, len(hashes))
+		for i := range hashes {
+			header, err := s.cfg.Chain.HeaderByHash(&hashes[i])
+			if err != nil {
+				context := "Failed to fetch a block header"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			bp.Headers = append(bp.Headers, header)
+		}
+
+		for i := height - numProofs; i < height; i++ {
+			udata, _, err := s.fetchUtreexoProof(&hashes[i])
+			if err != nil {
+				return nil, err
+			}
+			bp.Proofs = append(bp.Proofs, udata)
+		}
+	}
+
+	hashStr := blockHash.String()
+	reply, err := handleGetUtreexoRoots(s,
+		&btcjson.GetUtreexoRootsCmd{BlockHash: &hashStr}, closeChan)
+	if err != nil {
+		return nil, err
+	}
+	roots := reply.(*btcjson.GetUtreexoRootsResult)
+	bp.NumLeaves = roots.NumLeaves
+	bp.Roots = make([]utreexo.Hash, len(roots.Roots))
+	for i, root := range roots.Roots {
+		_, err = hex.Decode(bp.Roots[i][:], []byte(root))
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+	}
+
+	var serialized bytes.Buffer
+	err = bp.Serialize(&serialized)
+	if err != nil {
+		context := "Failed to serialize the bootstrap package"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	checksum := sha256.Sum256(serialized.Bytes())
+
+	return &btcjson.GetBootstrapPackageResult{
+		Height:    height,
+		BlockHash: hashStr,
+		NumLeaves: roots.NumLeaves,
+		RootsHash: roots.RootsHash,
+		NumProofs: numProofs,
+		Checksum:  hex.EncodeToString(checksum[:]),
+		Package:   hex.EncodeToString(serialized.Bytes()),
+	}, nil
+}
+
 // handleGetCFilter implements the getcfilter command.
 func handleGetCFilter(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	if s.cfg.CfIndex == nil {
@@ -2446,6 +3441,75 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetConformanceVectors implements the getconformancevectors command.
+func handleGetConformanceVectors(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if !cfg.Conformance {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "The conformance chain must be enabled (--conformance).",
+		}
+	}
+	c := cmd.(*btcjson.GetConformanceVectorsCmd)
+
+	startHeight, endHeight := int32(1), int32(conformanceNumBlocks)
+	if c.Height != nil {
+		if *c.Height < startHeight || *c.Height > endHeight {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCOutOfRange,
+				Message: fmt.Sprintf("Height must be within %d to %d",
+					startHeight, endHeight),
+			}
+		}
+		startHeight, endHeight = *c.Height, *c.Height
+	}
+
+	vectors := make([]btcjson.ConformanceVectorResult, 0, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := s.cfg.Chain.BlockByHeight(height)
+		if err != nil {
+			context := "Failed to fetch the conformance block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			context := "Failed to serialize the conformance block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+		udata, _, err := s.fetchUtreexoProof(block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		proof, err := serializeUtreexoProof(udata)
+		if err != nil {
+			return nil, err
+		}
+
+		hashStr := block.Hash().String()
+		reply, err := handleGetUtreexoRoots(s,
+			&btcjson.GetUtreexoRootsCmd{BlockHash: &hashStr}, closeChan)
+		if err != nil {
+			return nil, err
+		}
+		roots := reply.(*btcjson.GetUtreexoRootsResult)
+
+		vectors = append(vectors, btcjson.ConformanceVectorResult{
+			Height:    height,
+			BlockHash: hashStr,
+			Block:     hex.EncodeToString(blockBytes),
+			Proof:     proof,
+			Roots:     roots.Roots,
+			NumLeaves: roots.NumLeaves,
+			RootsHash: roots.RootsHash,
+		})
+	}
+
+	return &btcjson.GetConformanceVectorsResult{
+		Network: s.cfg.ChainParams.Name,
+		Vectors: vectors,
+	}, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
@@ -2462,6 +3526,35 @@ func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return getDifficultyRatio(best.Bits, s.cfg.ChainParams), nil
 }
 
+// handleGetDiskUsage implements the getdiskusage command.
+func handleGetDiskUsage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	usages, sampledAt, err := s.cfg.DiskUsageMonitor.DiskUsage()
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't fetch the disk usage. Error: %v", err),
+		}
+	}
+
+	reply := &btcjson.GetDiskUsageResult{
+		SampledAt: sampledAt.Unix(),
+		Usage:     make([]btcjson.DiskUsageResult, 0, len(usages)),
+	}
+	for _, usage := range usages {
+		reply.TotalSize += usage.size
+		reply.TotalGrowthPerDay += usage.growthPerDay
+		reply.Usage = append(reply.Usage, btcjson.DiskUsageResult{
+			Name:         usage.name,
+			Paths:        usage.paths,
+			Size:         usage.size,
+			GrowthPerDay: usage.growthPerDay,
+			WindowSecs:   int64(usage.window.Seconds()),
+		})
+	}
+
+	return reply, nil
+}
+
 // handleGetGenerate implements the getgenerate command.
 func handleGetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.CPUMiner.IsMining(), nil
@@ -2513,6 +3606,98 @@ func handleGetHeaders(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return hexBlockHeaders, nil
 }
 
+// indexInfoNames maps the human-readable names of the indexes to the names
+// getindexinfo reports them by, which are the options that enable them.
+var indexInfoNames = map[string]string{
+	"transaction index":        "txindex",
+	"address index":            "addrindex",
+	"committed filter index":   "cfindex",
+	"utreexo proof index":      "utreexoproofindex",
+	"flat utreexo proof index": "flatutreexoproofindex",
+	"leaf data index":          "leafdataindex",
+}
+
+// ttlIndexName is the name getindexinfo reports the leaf ttls kept by the flat
+// utreexo proof index by.
+const ttlIndexName = "ttlindex"
+
+// newGetIndexInfoResult returns how far an index at the given height is caught
+// up to the main chain at the best height.
+func newGetIndexInfoResult(synced bool, height int32, hash *chainhash.Hash,
+	bestHeight int32) btcjson.GetIndexInfoResult {
+
+	// The tip may have moved on since the index info was fetched.
+	var lag int32
+	if height < bestHeight {
+		lag = bestHeight - height
+	}
+	progress := 1.0
+	if lag > 0 {
+		progress = float64(height+1) / float64(bestHeight+1)
+	}
+	return btcjson.GetIndexInfoResult{
+		Synced:           synced,
+		BestBlockHeight:  height,
+		BestBlockHash:    hash.String(),
+		Lag:              lag,
+		BackfillProgress: progress,
+	}
+}
+
+// handleGetIndexInfo implements the getindexinfo command.
+func handleGetIndexInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetIndexInfoCmd)
+
+	result := make(map[string]btcjson.GetIndexInfoResult)
+	if s.cfg.IndexManager == nil {
+		return result, nil
+	}
+
+	infos, err := s.cfg.IndexManager.IndexInfo()
+	if err != nil {
+		context := "Failed to fetch the index info"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	bestHeight := s.cfg.Chain.BestSnapshot().Height
+	for _, info := range infos {
+		name, ok := indexInfoNames[info.Name]
+		if !ok {
+			name = info.Name
+		}
+		if c.IndexName == nil || *c.IndexName == name {
+			result[name] = newGetIndexInfoResult(info.Synced,
+				info.Height, &info.Hash, bestHeight)
+		}
+
+		// The leaf ttls are kept along with the flat utreexo proof
+		// index so they're only as far as it is.
+		if s.cfg.FlatUtreexoProofIndex == nil ||
+			name != "flatutreexoproofindex" ||
+			(c.IndexName != nil && *c.IndexName != ttlIndexName) {
+
+			continue
+		}
+		ttlHeight, ok := s.cfg.FlatUtreexoProofIndex.LeafTTLsHeight()
+		if !ok {
+			continue
+		}
+		ttlHash := info.Hash
+		if ttlHeight != info.Height {
+			hash, err := s.cfg.Chain.BlockHashByHeight(ttlHeight)
+			if err != nil {
+				context := "Failed to fetch the leaf ttls tip"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			ttlHash = *hash
+		}
+		result[ttlIndexName] = newGetIndexInfoResult(
+			info.Synced && ttlHeight == info.Height, ttlHeight,
+			&ttlHash, bestHeight)
+	}
+
+	return result, nil
+}
+
 // handleGetInfo implements the getinfo command. We only return the fields
 // that are not related to wallet functionality.
 func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -2525,8 +3710,9 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		Connections:     s.cfg.ConnMgr.ConnectedCount(),
 		Proxy:           cfg.Proxy,
 		Difficulty:      getDifficultyRatio(best.Bits, s.cfg.ChainParams),
-		TestNet:         cfg.TestNet3,
+		TestNet:         cfg.TestNet3 || cfg.TestNet4,
 		RelayFee:        cfg.minRelayTxFee.ToBTC(),
+		Errors:          s.healthWarning(),
 	}
 
 	return ret, nil
@@ -2580,7 +3766,7 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		HashesPerSec:       s.cfg.CPUMiner.HashesPerSecond(),
 		NetworkHashPS:      float64(networkHashesPerSec),
 		PooledTx:           uint64(s.cfg.TxMemPool.Count()),
-		TestNet:            cfg.TestNet3,
+		TestNet:            cfg.TestNet3 || cfg.TestNet4,
 	}
 	return &result, nil
 }
@@ -2744,8 +3930,9 @@ func handleGetNodeAddresses(s *rpcServer, cmd interface{}, closeChan <-chan stru
 		address := &btcjson.GetNodeAddressesResult{
 			Time:     node.Timestamp.Unix(),
 			Services: uint64(node.Services),
-			Address:  node.IP.String(),
+			Address:  node.Addr.String(),
 			Port:     node.Port,
+			Network:  node.Addr.Network(),
 		}
 		addresses = append(addresses, address)
 	}
@@ -2781,6 +3968,11 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			BanScore:       int32(p.BanScore()),
 			FeeFilter:      p.FeeFilter(),
 			SyncNode:       statsSnap.ID == syncPeerID,
+			TransportType:  "v1",
+			SessionID:      hex.EncodeToString(statsSnap.SessionID),
+		}
+		if statsSnap.V2Transport {
+			info.TransportType = "v2"
 		}
 		if p.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2792,6 +3984,66 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// handleGetPeerPolicyInfo implements the getpeerpolicyinfo command.
+func handleGetPeerPolicyInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	rejectServices := make([]string, 0, len(cfg.rejectServices))
+	for _, services := range cfg.rejectServices {
+		rejectServices = append(rejectServices,
+			fmt.Sprintf("%016x", uint64(services)))
+	}
+
+	nonNil := func(strs []string) []string {
+		if strs == nil {
+			return []string{}
+		}
+		return strs
+	}
+
+	counts := s.cfg.ConnMgr.PeerPolicyCounts()
+	return &btcjson.GetPeerPolicyInfoResult{
+		AgentBlacklist:         nonNil(cfg.AgentBlacklist),
+		AgentWhitelist:         nonNil(cfg.AgentWhitelist),
+		AgentDeprioritize:      nonNil(cfg.AgentDeprioritize),
+		RejectServices:         rejectServices,
+		AgentBlacklisted:       counts.AgentBlacklisted,
+		AgentNotWhitelisted:    counts.AgentNotWhitelisted,
+		ServicesRejected:       counts.ServicesRejected,
+		Deprioritized:          counts.Deprioritized,
+		DeprioritizedEvicted:   counts.DeprioritizedEvicted,
+		ProofRequestsThrottled: counts.ProofRequestsThrottled,
+	}, nil
+}
+
+// handleGetPeerReputation implements the getpeerreputation command.
+func handleGetPeerReputation(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	reputations := s.cfg.SyncMgr.PeerReputations()
+
+	results := make([]btcjson.GetPeerReputationResult, 0, len(reputations))
+	for i := range reputations {
+		r := &reputations[i]
+		results = append(results, btcjson.GetPeerReputationResult{
+			Addr:           r.Addr,
+			Score:          r.Score(),
+			Connected:      r.Connected,
+			ValidProofs:    r.ValidProofs,
+			InvalidProofs:  r.InvalidProofs,
+			Timeouts:       r.Timeouts,
+			LatencyMillis:  r.Latency.Milliseconds(),
+			LatencySamples: r.LatencySamples,
+			Connections:    r.Connections,
+			Uptime:         int64(r.Uptime.Seconds()),
+			LastSeen:       r.LastSeen.Unix(),
+		})
+	}
+
+	// The most reliable peers are listed first.
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
@@ -3037,32 +4289,153 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return txOutReply, nil
 }
 
-// handleGetWatchOnlyBalance implements the getwatchonlybalance command.
-func handleGetWatchOnlyBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+// handleGetWalletUtxos implements the getwalletutxos command.
+func handleGetWalletUtxos(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetWalletUtxosCmd)
+
 	if s.cfg.WatchOnlyWallet == nil {
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCMisc,
-			Message: "watch only wallet must be enabled (--watchonlywallet)",
+			Message: "Watch only wallet must be enabled (--watchonlywallet)",
 		}
 	}
-	return s.cfg.WatchOnlyWallet.Getbalance(), nil
-}
 
-// handleInvalidateBlock implements the invalidateblock command.
-func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.InvalidateBlockCmd)
+	var descriptor string
+	if c.Descriptor != nil {
+		descriptor = *c.Descriptor
+	}
+	utxos, bestHash, numLeaves, err := s.cfg.WatchOnlyWallet.GetUtxos(descriptor)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't get the utxos of the watch only wallet. Error: %v", err),
+		}
+	}
+
+	utxoResults := make([]btcjson.WalletUtxoResult, 0, len(utxos))
+	for _, utxo := range utxos {
+		// Serialize the proof so that it can be passed along with the
+		// utxo to whoever signs for it.
+		var proofBuf bytes.Buffer
+		err := utxo.Proof.Serialize(&proofBuf)
+		if err != nil {
+			context := "Failed to serialize utreexo proof"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if err := s.checkProofSize(proofBuf.Len()); err != nil {
+			return nil, err
+		}
+
+		leaf := utxo.LeafData
+		leafHash := chainhash.Hash(leaf.LeafHash())
+		utxoResults = append(utxoResults, btcjson.WalletUtxoResult{
+			TxID:         leaf.OutPoint.Hash.String(),
+			Vout:         leaf.OutPoint.Index,
+			Amount:       leaf.Amount,
+			ScriptPubKey: hex.EncodeToString(leaf.PkScript),
+			Height:       leaf.Height,
+			BlockHash:    leaf.BlockHash.String(),
+			Coinbase:     leaf.IsCoinBase,
+			Descriptor:   utxo.Descriptor,
+			LeafHash:     leafHash.String(),
+			Proof:        hex.EncodeToString(proofBuf.Bytes()),
+		})
+	}
+
+	return &btcjson.GetWalletUtxosResult{
+		BestHash:  bestHash.String(),
+		NumLeaves: numLeaves,
+		Utxos:     utxoResults,
+	}, nil
+}
+
+// handleGetWatchOnlyBalance implements the getwatchonlybalance command.
+func handleGetWatchOnlyBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.WatchOnlyWallet == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "watch only wallet must be enabled (--watchonlywallet)",
+		}
+	}
+	return s.cfg.WatchOnlyWallet.Getbalance(), nil
+}
+
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.InvalidateBlockCmd)
 
 	invalidateHash, err := chainhash.NewHashFromStr(c.BlockHash)
 	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if s.cfg.Chain.IndexLookupNode(invalidateHash) == nil {
 		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCDeserialization,
-			Message: fmt.Sprintf("Failed to deserialize blockhash from string of %s",
-				invalidateHash),
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
 		}
 	}
 
 	err = s.cfg.Chain.InvalidateBlock(invalidateHash)
-	return nil, err
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: err.Error(),
+		}
+	}
+
+	return nil, s.flushUtreexoStateAtTip()
+}
+
+// flushUtreexoStateAtTip flushes the indexes at the tip of the main chain after
+// blocks were disconnected or connected by invalidateblock or reconsiderblock
+// and checks that the utreexo accumulators of the proof indexes were rolled to
+// the tip along with it.  The indexes that are being caught up in the background
+// are skipped as they roll themselves back as they're caught up.
+func (s *rpcServer) flushUtreexoStateAtTip() error {
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil
+	}
+
+	synced := make(map[string]bool)
+	infos, err := s.cfg.IndexManager.IndexInfo()
+	if err != nil {
+		return internalRPCError(err.Error(), "Failed to fetch the index tips")
+	}
+	for _, info := range infos {
+		synced[info.Name] = info.Synced
+	}
+
+	type utreexoStateTip struct {
+		name  string
+		fetch func() ([]*chainhash.Hash, uint64, chainhash.Hash)
+	}
+	var states []utreexoStateTip
+	if idx := s.cfg.UtreexoProofIndex; idx != nil && synced[idx.Name()] {
+		states = append(states, utreexoStateTip{idx.Name(), idx.FetchCurrentUtreexoState})
+	}
+	if idx := s.cfg.FlatUtreexoProofIndex; idx != nil && synced[idx.Name()] {
+		states = append(states, utreexoStateTip{idx.Name(), idx.FetchCurrentUtreexoState})
+	}
+
+	err = s.cfg.Chain.FlushIndexesAndRun(func(tip *blockchain.BestState) error {
+		for _, state := range states {
+			_, _, hash := state.fetch()
+			if hash != tip.Hash {
+				return fmt.Errorf("the utreexo state of the %s is at "+
+					"block %s instead of the tip %s. Restart the "+
+					"node to recover it", state.name, hash, tip.Hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
 }
 
 // handleHelp implements the help command.
@@ -3173,6 +4546,145 @@ func handleListBDKUTXOs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}
 	return res, nil
 }
 
+// utxoSetCursorSize is the size of a listutxoset cursor which is the hash of
+// the block the utxo set is at followed by the last outpoint of the page.
+const utxoSetCursorSize = chainhash.HashSize*2 + 4
+
+// encodeUtxoSetCursor returns the hex encoded listutxoset cursor for the page
+// after the given outpoint of the utxo set at the given block.
+func encodeUtxoSetCursor(snapshot *chainhash.Hash, last *wire.OutPoint) string {
+	var cursor [utxoSetCursorSize]byte
+	copy(cursor[:], snapshot[:])
+	copy(cursor[chainhash.HashSize:], last.Hash[:])
+	binary.LittleEndian.PutUint32(cursor[chainhash.HashSize*2:], last.Index)
+	return hex.EncodeToString(cursor[:])
+}
+
+// decodeUtxoSetCursor decodes a listutxoset cursor into the block the utxo set
+// is at and the outpoint the next page comes after.
+func decodeUtxoSetCursor(cursorHex string) (*chainhash.Hash, *wire.OutPoint, error) {
+	cursor, err := hex.DecodeString(cursorHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cursor) != utxoSetCursorSize {
+		return nil, nil, fmt.Errorf("cursor is %d bytes instead of %d",
+			len(cursor), utxoSetCursorSize)
+	}
+
+	var snapshot chainhash.Hash
+	copy(snapshot[:], cursor)
+	var after wire.OutPoint
+	copy(after.Hash[:], cursor[chainhash.HashSize:])
+	after.Index = binary.LittleEndian.Uint32(cursor[chainhash.HashSize*2:])
+	return &snapshot, &after, nil
+}
+
+// handleListUtxoSet implements the listutxoset command.
+func handleListUtxoSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.Chain.IsUtreexoViewActive() {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The utxo set is only kept with --noutreexo or " +
+				"a utreexo proof index enabled",
+		}
+	}
+	c := cmd.(*btcjson.ListUtxoSetCmd)
+
+	if *c.Count <= 0 || *c.Count > maxUtxoSetPageSize {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Count must be within 1 to %d",
+				maxUtxoSetPageSize),
+		}
+	}
+	if *c.IncludeProofs && s.cfg.UtreexoProofIndex == nil &&
+		s.cfg.FlatUtreexoProofIndex == nil {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
+	}
+
+	// A scan starts at the utxo set of the chain tip and the cursor keeps
+	// every page after the first at that same block.
+	var (
+		snapshot *chainhash.Hash
+		after    *wire.OutPoint
+	)
+	if c.Cursor == nil || *c.Cursor == "" {
+		snapshot = &s.cfg.Chain.BestSnapshot().Hash
+	} else {
+		var err error
+		snapshot, after, err = decodeUtxoSetCursor(*c.Cursor)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid cursor: %v", err),
+			}
+		}
+	}
+
+	entries, more, err := s.cfg.Chain.FetchUtxoSetPage(snapshot, after, *c.Count)
+	if err != nil {
+		if !s.cfg.Chain.MainChainHasBlock(snapshot) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Block %v of the cursor was "+
+					"reorganized out of the main chain. Restart "+
+					"the scan without a cursor", snapshot),
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't fetch the utxo set. Error: %v", err),
+		}
+	}
+	height, err := s.cfg.Chain.BlockHeightByHash(snapshot)
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to get block height")
+	}
+
+	result := &btcjson.ListUtxoSetResult{
+		SnapshotHash:   snapshot.String(),
+		SnapshotHeight: height,
+		Utxos:          make([]btcjson.ListUtxoSetEntry, 0, len(entries)),
+	}
+	var unspent []wire.OutPoint
+	for _, e := range entries {
+		result.Utxos = append(result.Utxos, btcjson.ListUtxoSetEntry{
+			Txid:               e.OutPoint.Hash.String(),
+			Vout:               e.OutPoint.Index,
+			Amount:             btcutil.Amount(e.Entry.Amount()).ToBTC(),
+			PkScript:           hex.EncodeToString(e.Entry.PkScript()),
+			Height:             e.Entry.BlockHeight(),
+			IsCoinBase:         e.Entry.IsCoinBase(),
+			SpentSinceSnapshot: e.SpentSinceSnapshot,
+		})
+		if !e.SpentSinceSnapshot {
+			unspent = append(unspent, e.OutPoint)
+		}
+	}
+	if more {
+		result.NextCursor = encodeUtxoSetCursor(snapshot,
+			&entries[len(entries)-1].OutPoint)
+	}
+
+	// The accumulator is only kept at the chain tip so only the outputs
+	// that are still unspent there can be proven.
+	if *c.IncludeProofs && len(unspent) > 0 {
+		proof, err := s.proveOutpoints(unspent)
+		if err != nil {
+			return nil, err
+		}
+		result.Proof = chainTipProofResult(proof, proof.String())
+	}
+
+	return result, nil
+}
+
 // handlePeekAddress implements the peekaddress command.
 func handlePeekAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Before doing anything, check that the bdk wallet is active.
@@ -3245,54 +4757,24 @@ func handleProveUtxoChainTipInclusion(s *rpcServer, cmd interface{}, closeChan <
 		outpoints = append(outpoints, *op)
 	}
 
-	// Fetch the utxos that we'll need to prove the outpoints.
-	utxos := make([]*blockchain.UtxoEntry, 0, len(c.Txids))
-	for _, outpoint := range outpoints {
-		utxo, err := s.cfg.Chain.FetchUtxoEntry(outpoint)
-		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCMisc,
-				Message: fmt.Sprintf("Requested UTXO with txid %s and vout %d "+
-					"does not exist in the UTXO set at chain tip height of %d",
-					outpoint.Hash.String(), outpoint.Index,
-					s.cfg.Chain.BestSnapshot().Height),
-			}
-		}
-
-		if utxo == nil || utxo.IsSpent() {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCMisc,
-				Message: fmt.Sprintf("Requested UTXO with txid %s and vout %d "+
-					"does not exist in the UTXO set at chain tip height of %d",
-					outpoint.Hash.String(), outpoint.Index,
-					s.cfg.Chain.BestSnapshot().Height),
-			}
-		}
-
-		utxos = append(utxos, utxo)
-	}
-
-	// We already checked that at least one index is active.  Pick one and
-	// generate the inclusion proof.
-	var proof *blockchain.ChainTipProof
-	if s.cfg.UtreexoProofIndex != nil {
-		var err error
-		proof, err = s.cfg.UtreexoProofIndex.ProveUtxos(utxos, &outpoints)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		var err error
-		proof, err = s.cfg.FlatUtreexoProofIndex.ProveUtxos(utxos, &outpoints)
-		if err != nil {
-			return nil, err
-		}
+	proof, err := s.proveOutpoints(outpoints)
+	if err != nil {
+		return nil, err
 	}
+	proofHex := proof.String()
 
 	if *c.Verbosity == 0 {
-		return proof.String(), nil
+		return proofHex, nil
 	}
 
+	return chainTipProofResult(proof, proofHex), nil
+}
+
+// chainTipProofResult returns the verbose result of the given chain tip proof
+// with the given hex encoding of it.
+func chainTipProofResult(proof *blockchain.ChainTipProof,
+	proofHex string) *btcjson.ProveUtxoChainTipInclusionVerboseResult {
+
 	// Convert the hashes to string.
 	proofString := make([]string, 0, len(proof.AccProof.Proof))
 	for _, singleProof := range proof.AccProof.Proof {
@@ -3308,20 +4790,66 @@ func handleProveUtxoChainTipInclusion(s *rpcServer, cmd interface{}, closeChan <
 		hashesProvenString = append(hashesProvenString, chainHash.String())
 	}
 
-	proveReply := &btcjson.ProveUtxoChainTipInclusionVerboseResult{
+	return &btcjson.ProveUtxoChainTipInclusionVerboseResult{
 		ProvedAtHash: proof.ProvedAtHash.String(),
 		ProofHashes:  proofString,
 		ProofTargets: proof.AccProof.Targets,
 		HashesProven: hashesProvenString,
-		Hex:          proof.String(),
+		Hex:          proofHex,
+	}
+}
+
+// proveOutpoints generates a proof for the given unspent outpoints against the
+// current accumulator of whichever utreexo proof index is enabled.  The caller
+// must check that one of the indexes is enabled.
+func (s *rpcServer) proveOutpoints(outpoints []wire.OutPoint) (*blockchain.ChainTipProof, error) {
+	if err := s.checkProofTargets(len(outpoints)); err != nil {
+		return nil, err
+	}
+
+	// Fetch the utxos that we'll need to prove the outpoints.
+	utxos := make([]*blockchain.UtxoEntry, 0, len(outpoints))
+	for _, outpoint := range outpoints {
+		utxo, err := s.cfg.Chain.FetchUtxoEntry(outpoint)
+		if err != nil || utxo == nil || utxo.IsSpent() {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Requested UTXO with txid %s and vout %d "+
+					"does not exist in the UTXO set at chain tip height of %d",
+					outpoint.Hash.String(), outpoint.Index,
+					s.cfg.Chain.BestSnapshot().Height),
+			}
+		}
+
+		utxos = append(utxos, utxo)
 	}
 
-	return proveReply, nil
+	var (
+		proof *blockchain.ChainTipProof
+		err   error
+	)
+	if s.cfg.UtreexoProofIndex != nil {
+		proof, err = s.cfg.UtreexoProofIndex.ProveUtxos(utxos, &outpoints)
+	} else {
+		proof, err = s.cfg.FlatUtreexoProofIndex.ProveUtxos(utxos, &outpoints)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	proofSize := len(proof.String()) / 2
+	if err := s.checkProofSize(proofSize); err != nil {
+		return nil, err
+	}
+
+	// The outpoints are proven against the tip.
+	s.cfg.ProofAccess.record(proofSourceRPC, 0, len(outpoints), proofSize, "")
+
+	return proof, nil
 }
 
-// handleGetUtreexoProof implements the getutreexoproof command.
-func handleGetUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
-	interface{}, error) {
+// handleProveUtxo implements the proveutxo command.
+func handleProveUtxo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Before doing anything, check that one of the indexes are active.
 	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
 		return nil, &btcjson.RPCError{
@@ -3330,73 +4858,902 @@ func handleGetUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struc
 				"(--utreexoproofindex) or (--flatutreexoproofindex).",
 		}
 	}
-	c := cmd.(*btcjson.GetUtreexoProofCmd)
+	c := cmd.(*btcjson.ProveUtxoCmd)
 
-	// Convert the provided blockhash hex to a Hash.
-	blockHash, err := chainhash.NewHashFromStr(c.BlockHash)
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
 	if err != nil {
-		return nil, rpcDecodeHexError(c.BlockHash)
+		return nil, rpcDecodeHexError(c.Txid)
 	}
 
-	var height int32
-	height, err = s.cfg.Chain.BlockHeightByHash(blockHash)
+	proof, err := s.proveOutpoints([]wire.OutPoint{*wire.NewOutPoint(txHash, c.Vout)})
 	if err != nil {
-		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCMisc,
-			Message: fmt.Sprintf("Height of blockhash %s couldn't be fetched. "+
-				"Error %v", c.BlockHash, err),
-		}
+		return nil, err
 	}
 
-	if height == 0 {
+	proofHashes := make([]string, 0, len(proof.AccProof.Proof))
+	for _, proofHash := range proof.AccProof.Proof {
+		proofHashes = append(proofHashes, chainhash.Hash(proofHash).String())
+	}
+
+	return &btcjson.ProveUtxoResult{
+		ProvedAtHash: proof.ProvedAtHash.String(),
+		LeafHash:     chainhash.Hash(proof.HashesProven[0]).String(),
+		Targets:      proof.AccProof.Targets,
+		ProofHashes:  proofHashes,
+		Hex:          proof.String(),
+	}, nil
+}
+
+// utreexoCacheInfo returns the usage of a cache of the utreexo state.
+func utreexoCacheInfo(m indexers.UtreexoCacheMetrics) *btcjson.UtreexoCacheInfoResult {
+	info := &btcjson.UtreexoCacheInfoResult{
+		Used:     m.Used,
+		Capacity: m.Capacity,
+	}
+	if m.Capacity > 0 {
+		info.Utilization = float64(m.Used) * 100 / float64(m.Capacity)
+	}
+	return info
+}
+
+// handleGetUtreexoInfo implements the getutreexoinfo command.
+func handleGetUtreexoInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	result := &btcjson.GetUtreexoInfoResult{
+		UtreexoProofIndex:     s.cfg.UtreexoProofIndex != nil,
+		FlatUtreexoProofIndex: s.cfg.FlatUtreexoProofIndex != nil,
+		Pruned:                cfg.Prune != 0,
+		ProofPruneHeight:      cfg.ProofPruneHeight,
+		ProofRetention:        cfg.ProofRetention,
+		UndoRetention:         cfg.UndoRetention,
+		RollbackSnapshots:     cfg.RollbackSnapshots,
+		RootSnapshotInterval:  cfg.RootSnapshotInterval,
+	}
+
+	var roots []*chainhash.Hash
+	var tipHash chainhash.Hash
+	var metrics indexers.UtreexoStateMetrics
+	switch {
+	case s.cfg.UtreexoProofIndex != nil:
+		result.Mode = "bridge"
+		roots, result.NumLeaves, tipHash = s.cfg.UtreexoProofIndex.FetchCurrentUtreexoState()
+		metrics = s.cfg.UtreexoProofIndex.UtreexoStateMetrics()
+
+	case s.cfg.FlatUtreexoProofIndex != nil:
+		result.Mode = "bridge"
+		roots, result.NumLeaves, tipHash = s.cfg.FlatUtreexoProofIndex.FetchCurrentUtreexoState()
+		metrics = s.cfg.FlatUtreexoProofIndex.UtreexoStateMetrics()
+		result.CompactedHeight = s.cfg.FlatUtreexoProofIndex.CompactedHeight()
+
+	case s.cfg.Chain.IsUtreexoViewActive():
+		result.Mode = "csn"
+		tipHash = s.cfg.Chain.BestSnapshot().Hash
+		view, err := s.cfg.Chain.FetchUtreexoViewpoint(&tipHash)
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to fetch the utreexo viewpoint")
+		}
+		for _, root := range view.GetRoots() {
+			result.Roots = append(result.Roots, hex.EncodeToString(root[:]))
+		}
+		result.NumLeaves = view.NumLeaves()
+
+	default:
 		return nil, &btcjson.RPCError{
 			Code: btcjson.ErrRPCMisc,
-			Message: fmt.Sprintf("Blockhash %s is the hash of the genesis "+
-				"block and thus doesn't have a utreexoproof.", c.BlockHash),
+			Message: "A utreexo proof index or utreexo must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex) or (--utreexo)",
 		}
 	}
 
-	// We already checked that at least one index is active.  Pick one and
-	// generate the inclusion proof.
-	var udata *wire.UData
-	if s.cfg.UtreexoProofIndex != nil {
-		udata, err = s.cfg.UtreexoProofIndex.FetchUtreexoProof(blockHash)
-		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCMisc,
-				Message: fmt.Sprintf("Couldn't fetch the proof for blockhash %s from "+
-					"the utreexoproofindex. Error: %v", c.BlockHash, err),
+	for _, root := range roots {
+		result.Roots = append(result.Roots, hex.EncodeToString(root[:]))
+	}
+	if result.Roots == nil {
+		result.Roots = []string{}
+	}
+	result.BlockHash = tipHash.String()
+	height, err := s.cfg.Chain.BlockHeightByHash(&tipHash)
+	if err != nil {
+		return nil, internalRPCError(err.Error(),
+			"Failed to fetch the height of the utreexo state")
+	}
+	result.Height = height
+
+	if result.Mode == "bridge" {
+		result.NodesCache = utreexoCacheInfo(metrics.Nodes)
+		result.CachedLeavesCache = utreexoCacheInfo(metrics.CachedLeaves)
+		result.CachedLeavesLive = metrics.CachedLeavesGarbage.Live
+		result.CachedLeavesGarbage = metrics.CachedLeavesGarbage.Garbage
+		result.GarbageRatio = metrics.CachedLeavesGarbage.Ratio()
+		result.GarbageCompactions = metrics.GarbageCompactions
+
+		// The block of the last flush may have been reorganized out of
+		// the main chain since, in which case only its hash is known.
+		if metrics.LastFlushHash != (chainhash.Hash{}) {
+			result.LastFlushHash = metrics.LastFlushHash.String()
+			height, err := s.cfg.Chain.BlockHeightByHash(&metrics.LastFlushHash)
+			if err == nil {
+				result.LastFlushHeight = height
 			}
 		}
-	} else {
-		udata, err = s.cfg.FlatUtreexoProofIndex.FetchUtreexoProof(height)
-		if err != nil {
+	}
+
+	return result, nil
+}
+
+// handleGetUtreexoProof implements the getutreexoproof command.
+func handleGetUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+	c := cmd.(*btcjson.GetUtreexoProofCmd)
+
+	blockHash, err := s.parseHashOrHeight(c.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	udata, targetHashes, err := s.fetchUtreexoProof(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkProofSize(udata.SerializeSize()); err != nil {
+		return nil, err
+	}
+	s.recordProofAccess(proofSourceRPC, blockHash, udata, "")
+
+	if *c.Verbosity == 0 {
+		return serializeUtreexoProof(udata)
+	}
+
+	return utreexoProofVerboseResult(udata, targetHashes)
+}
+
+// handleGetUtreexoProofs implements the getutreexoproofs command.
+func handleGetUtreexoProofs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that one of the indexes are active.
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
+	}
+	c := cmd.(*btcjson.GetUtreexoProofsCmd)
+
+	best := s.cfg.Chain.BestSnapshot()
+	if c.StartHeight < 1 || c.EndHeight < c.StartHeight || c.EndHeight > best.Height {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Height range must be within 1 to %d "+
+				"and the start height must not be after the end height",
+				best.Height),
+		}
+	}
+	if c.EndHeight-c.StartHeight+1 > maxUtreexoProofsPerRequest {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("At most %d proofs may be requested at once",
+				maxUtreexoProofsPerRequest),
+		}
+	}
+
+	results := make([]btcjson.GetUtreexoProofsResult, 0, c.EndHeight-c.StartHeight+1)
+	var totalSize int
+	fn := func(height int32, udata *wire.UData) error {
+		totalSize += udata.SerializeSize()
+		if err := s.checkProofSize(totalSize); err != nil {
+			return err
+		}
+
+		blockHash, err := s.cfg.Chain.BlockHashByHeight(height)
+		if err != nil {
+			return err
+		}
+		serialized, err := serializeUtreexoProof(udata)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, btcjson.GetUtreexoProofsResult{
+			Height:    height,
+			BlockHash: blockHash.String(),
+			Hex:       serialized,
+		})
+		s.cfg.ProofAccess.record(proofSourceRPC, best.Height-height,
+			len(udata.AccProof.Targets), udata.SerializeSize(), "")
+		return nil
+	}
+
+	var err error
+	if s.cfg.UtreexoProofIndex != nil {
+		err = s.cfg.UtreexoProofIndex.FetchUtreexoProofs(c.StartHeight, c.EndHeight, fn)
+	} else {
+		err = s.cfg.FlatUtreexoProofIndex.FetchUtreexoProofs(c.StartHeight, c.EndHeight, fn)
+	}
+	if err != nil {
+		if rpcErr, ok := err.(*btcjson.RPCError); ok {
+			return nil, rpcErr
+		}
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't fetch the proofs for heights %d "+
+				"to %d. Error: %v", c.StartHeight, c.EndHeight, err),
+		}
+	}
+
+	return results, nil
+}
+
+// handleGetUtreexoProofStats implements the getutreexoproofstats command.
+func handleGetUtreexoProofStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that one of the indexes are active.
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
+	}
+	c := cmd.(*btcjson.GetUtreexoProofStatsCmd)
+
+	var numLeaves uint64
+	var tipHash chainhash.Hash
+	startHeight := int32(1)
+	if s.cfg.UtreexoProofIndex != nil {
+		_, numLeaves, tipHash = s.cfg.UtreexoProofIndex.FetchCurrentUtreexoState()
+	} else {
+		_, numLeaves, tipHash = s.cfg.FlatUtreexoProofIndex.FetchCurrentUtreexoState()
+		startHeight = s.cfg.FlatUtreexoProofIndex.CompactedHeight() + 1
+	}
+	tipHeight, err := s.cfg.Chain.BlockHeightByHash(&tipHash)
+	if err != nil {
+		return nil, internalRPCError(err.Error(),
+			"Failed to fetch the height of the utreexo state")
+	}
+
+	endHeight := tipHeight
+	if c.StartHeight != nil {
+		startHeight = *c.StartHeight
+	}
+	if c.EndHeight != nil {
+		endHeight = *c.EndHeight
+	}
+	if startHeight < 1 || endHeight < startHeight || endHeight > tipHeight {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Height range must be within 1 to %d "+
+				"and the start height must not be after the end height",
+				tipHeight),
+		}
+	}
+
+	var stats *indexers.ProofSizeStats
+	if s.cfg.UtreexoProofIndex != nil {
+		stats, err = s.cfg.UtreexoProofIndex.ProofSizeStats(
+			startHeight, endHeight, closeChan)
+	} else {
+		stats, err = s.cfg.FlatUtreexoProofIndex.ProofSizeStats(
+			startHeight, endHeight, closeChan)
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't gather the statistics of the "+
+				"proofs for heights %d to %d. Error: %v", startHeight,
+				endHeight, err),
+		}
+	}
+
+	result := &btcjson.GetUtreexoProofStatsResult{
+		Height:          tipHeight,
+		BlockHash:       tipHash.String(),
+		NumLeaves:       numLeaves,
+		ForestRows:      utreexo.TreeRows(numLeaves),
+		StartHeight:     stats.StartHeight,
+		EndHeight:       stats.EndHeight,
+		TotalProofBytes: stats.TotalBytes,
+		AvgProofBytes:   stats.AverageBytes(),
+		MaxProofBytes:   stats.MaxBytes,
+		MaxProofHeight:  stats.MaxBytesHeight,
+	}
+	for i, blocks := range stats.TargetCounts {
+		if blocks == 0 {
+			continue
+		}
+		minTargets, maxTargets := indexers.TargetCountRange(i)
+		result.TargetsHistogram = append(result.TargetsHistogram,
+			btcjson.TargetCountBucketResult{
+				MinTargets: minTargets,
+				MaxTargets: maxTargets,
+				Blocks:     blocks,
+			})
+	}
+
+	if s.cfg.FlatUtreexoProofIndex != nil {
+		sizes, err := s.cfg.FlatUtreexoProofIndex.FlatFileSizes()
+		if err != nil {
+			return nil, internalRPCError(err.Error(),
+				"Failed to fetch the sizes of the flat files")
+		}
+		for _, size := range sizes {
+			result.FlatFiles = append(result.FlatFiles, btcjson.FlatFileSizeResult{
+				Name:       size.Name,
+				Height:     size.Height,
+				DataSize:   size.DataSize,
+				OffsetSize: size.OffsetSize,
+			})
+		}
+		result.FlatFileCount = len(sizes)
+	}
+
+	return result, nil
+}
+
+// handleCompactProofs implements the compactproofs command.
+func handleCompactProofs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that the flat index is active.
+	if s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "The flat utreexo proof index must be enabled. (--flatutreexoproofindex)",
+		}
+	}
+	c := cmd.(*btcjson.CompactProofsCmd)
+
+	pruneHeight := s.cfg.FlatUtreexoProofIndex.ConfiguredPruneHeight()
+	if c.PruneHeight != nil {
+		pruneHeight = *c.PruneHeight
+	}
+	if pruneHeight <= 0 {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "A prune height must be given when neither " +
+				"--proofpruneheight nor --proofretention apply",
+		}
+	}
+
+	height, err := s.cfg.FlatUtreexoProofIndex.CompactProofs(pruneHeight)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't compact the proofs. Error: %v", err),
+		}
+	}
+
+	return btcjson.CompactProofsResult{CompactedHeight: height}, nil
+}
+
+// handleBackupUtreexoState implements the backuputreexostate command.
+func handleBackupUtreexoState(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that one of the indexes are active.
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
+	}
+	c := cmd.(*btcjson.BackupUtreexoStateCmd)
+
+	if !filepath.IsAbs(c.DestDir) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s isn't an absolute path", c.DestDir),
+		}
+	}
+
+	// The index isn't connected to along with the chain while it's being
+	// caught up in the background.
+	infos, err := s.cfg.IndexManager.IndexInfo()
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch the index info")
+	}
+	for _, info := range infos {
+		if !info.Synced {
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCMisc,
-				Message: fmt.Sprintf("Couldn't fetch the proof for blockhash %s from "+
-					"the flatutreexoproofindex. Error: %v", c.BlockHash, err),
+				Message: fmt.Sprintf("The %s is still being caught up "+
+					"to the main chain", info.Name),
 			}
 		}
 	}
 
-	targetHashes, err := s.cfg.Chain.ReconstructUData(udata, *blockHash)
+	// Creating the directory here makes sure that an existing directory is
+	// never written to.
+	err = os.MkdirAll(filepath.Dir(c.DestDir), 0700)
+	if err == nil {
+		err = os.Mkdir(c.DestDir, 0700)
+	}
 	if err != nil {
-		return nil, err
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't create the backup directory. Error: %v", err),
+		}
+	}
+
+	var result btcjson.BackupUtreexoStateResult
+	err = s.cfg.Chain.FlushIndexesAndRun(func(tip *blockchain.BestState) error {
+		var paths []string
+		var err error
+		if s.cfg.UtreexoProofIndex != nil {
+			paths, err = s.cfg.UtreexoProofIndex.Backup(c.DestDir)
+		} else {
+			paths, err = s.cfg.FlatUtreexoProofIndex.Backup(c.DestDir)
+		}
+		if err != nil {
+			return err
+		}
+
+		result = btcjson.BackupUtreexoStateResult{
+			BlockHash: tip.Hash.String(),
+			Height:    tip.Height,
+			Paths:     paths,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't back up the utreexo state. Error: %v", err),
+		}
+	}
+	rpcsLog.Infof("Backed up the utreexo state at block %s (height %d) to %s",
+		result.BlockHash, result.Height, c.DestDir)
+
+	return &result, nil
+}
+
+// handleGetLeafAtPosition implements the getleafatposition command.
+func handleGetLeafAtPosition(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that the indexes are active.
+	if s.cfg.LeafDataIndex == nil ||
+		(s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil) {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The leaf data index and a utreexo proof index " +
+				"must be enabled. (--leafdataindex) and " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex)",
+		}
+	}
+	c := cmd.(*btcjson.GetLeafAtPositionCmd)
+
+	var leafHash utreexo.Hash
+	var found bool
+	if s.cfg.UtreexoProofIndex != nil {
+		leafHash, found = s.cfg.UtreexoProofIndex.GetPositionHash(c.Position)
+	} else {
+		leafHash, found = s.cfg.FlatUtreexoProofIndex.GetPositionHash(c.Position)
+	}
+	if !found {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Nothing at position %d", c.Position),
+		}
 	}
 
-	serialized := bytes.NewBuffer(make([]byte, udata.SerializeSize()))
-	err = udata.Serialize(serialized)
+	leafData, err := s.cfg.LeafDataIndex.FetchLeafData(leafHash)
 	if err != nil {
+		context := "Failed to fetch the leaf data"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if leafData == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Position %d holds the hash %x "+
+				"which isn't a leaf", c.Position, leafHash),
+		}
+	}
+
+	return leafResult(c.Position, leafHash, leafData), nil
+}
+
+// handleGetLeafByHash implements the getleafbyhash command.
+func handleGetLeafByHash(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that the indexes are active.
+	if s.cfg.LeafDataIndex == nil ||
+		(s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil) {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The leaf data index and a utreexo proof index " +
+				"must be enabled. (--leafdataindex) and " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex)",
+		}
+	}
+	c := cmd.(*btcjson.GetLeafByHashCmd)
+
+	var leafHash utreexo.Hash
+	if len(c.LeafHash) != hex.EncodedLen(len(leafHash)) {
+		return nil, rpcDecodeHexError(c.LeafHash)
+	}
+	_, err := hex.Decode(leafHash[:], []byte(c.LeafHash))
+	if err != nil {
+		return nil, rpcDecodeHexError(c.LeafHash)
+	}
+
+	var position uint64
+	var found bool
+	if s.cfg.UtreexoProofIndex != nil {
+		position, found = s.cfg.UtreexoProofIndex.GetLeafPosition(leafHash)
+	} else {
+		position, found = s.cfg.FlatUtreexoProofIndex.GetLeafPosition(leafHash)
+	}
+	if !found {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("The leaf %x isn't in the utreexo "+
+				"accumulator", leafHash),
+		}
+	}
+
+	leafData, err := s.cfg.LeafDataIndex.FetchLeafData(leafHash)
+	if err != nil {
+		context := "Failed to fetch the leaf data"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if leafData == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("The leaf %x is at position %d but "+
+				"isn't in the leaf data index", leafHash, position),
+		}
+	}
+
+	return leafResult(position, leafHash, leafData), nil
+}
+
+// leafResult returns the result of the getleafatposition and getleafbyhash
+// commands for the leaf at the given position.
+func leafResult(position uint64, leafHash utreexo.Hash,
+	leafData *wire.LeafData) btcjson.GetLeafAtPositionResult {
+
+	return btcjson.GetLeafAtPositionResult{
+		Position:   position,
+		LeafHash:   hex.EncodeToString(leafHash[:]),
+		BlockHash:  leafData.BlockHash.String(),
+		Txid:       leafData.OutPoint.Hash.String(),
+		Vout:       leafData.OutPoint.Index,
+		Height:     leafData.Height,
+		IsCoinBase: leafData.IsCoinBase,
+		Amount:     btcutil.Amount(leafData.Amount).ToBTC(),
+		PkScript:   hex.EncodeToString(leafData.PkScript),
+	}
+}
+
+// handleGetCoinAgeStats implements the getcoinagestats command.
+func handleGetCoinAgeStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	c := cmd.(*btcjson.GetCoinAgeStatsCmd)
+
+	// The tip is read from the leaf data index when it's enabled and every
+	// other height from the leaf ttls.
+	best := s.cfg.Chain.BestSnapshot()
+	useLeafDatas := s.cfg.LeafDataIndex != nil &&
+		(c.Height == nil || *c.Height == best.Height)
+	if !useLeafDatas && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The leaf data index or the flat utreexo proof " +
+				"index with the leaf ttls must be enabled. " +
+				"(--leafdataindex) or (--flatutreexoproofindex) " +
+				"and (--leafttls)",
+		}
+	}
+
+	height := best.Height
+	if c.Height != nil {
+		height = *c.Height
+	}
+	if height < 1 || height > best.Height {
 		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Block height must be within 1 to %d",
+				best.Height),
+		}
+	}
+
+	isDust := func(amount int64, pkScript []byte) bool {
+		txOut := wire.TxOut{Value: amount, PkScript: pkScript}
+		return mempool.IsDust(&txOut, cfg.minRelayTxFee)
+	}
+
+	var stats *indexers.CoinAgeStats
+	var err error
+	if useLeafDatas {
+		stats, err = s.cfg.LeafDataIndex.CoinAgeStats(isDust, closeChan)
+	} else {
+		stats, err = s.cfg.FlatUtreexoProofIndex.CoinAgeStats(height,
+			isDust, closeChan)
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't gather the coin age "+
+				"statistics at height %d. Error: %v", height, err),
+		}
+	}
+
+	result := &btcjson.GetCoinAgeStatsResult{
+		Height:       stats.Height,
+		BlockHash:    stats.BlockHash.String(),
+		Count:        stats.Total.Count,
+		Amount:       btcutil.Amount(stats.Total.Amount).ToBTC(),
+		DustCount:    stats.Total.DustCount,
+		DustAmount:   btcutil.Amount(stats.Total.DustAmount).ToBTC(),
+		AgeHistogram: make([]btcjson.CoinAgeBucketResult, len(stats.Buckets)),
+	}
+	for i, bucket := range stats.Buckets {
+		bucketResult := btcjson.CoinAgeBucketResult{
+			Count:      bucket.Count,
+			Amount:     btcutil.Amount(bucket.Amount).ToBTC(),
+			DustCount:  bucket.DustCount,
+			DustAmount: btcutil.Amount(bucket.DustAmount).ToBTC(),
+		}
+		if i > 0 {
+			bucketResult.MinAge = indexers.CoinAgeBounds[i-1] + 1
+		}
+		if i < len(indexers.CoinAgeBounds) {
+			maxAge := indexers.CoinAgeBounds[i]
+			bucketResult.MaxAge = &maxAge
+		}
+		result.AgeHistogram[i] = bucketResult
+	}
+
+	return result, nil
+}
+
+// handleGetLeafTTLs implements the getleafttls command.
+func handleGetLeafTTLs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that the flat index is active.
+	if s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The flat utreexo proof index must be enabled " +
+				"with the leaf ttls. (--flatutreexoproofindex) " +
+				"and (--leafttls).",
+		}
+	}
+	c := cmd.(*btcjson.GetLeafTTLsCmd)
+
+	best := s.cfg.Chain.BestSnapshot()
+	if c.Height < 1 || c.Height > best.Height {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Block height must be within 1 to %d",
+				best.Height),
+		}
+	}
+
+	blockHash, err := s.cfg.Chain.BlockHashByHeight(c.Height)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: fmt.Sprintf("Block not found at height %d", c.Height),
+		}
+	}
+
+	leafTTLs, err := s.cfg.FlatUtreexoProofIndex.FetchLeafTTLs(c.Height)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't fetch the leaf ttls for "+
+				"height %d. Error: %v", c.Height, err),
+		}
+	}
+
+	result := btcjson.GetLeafTTLsResult{
+		Height:    c.Height,
+		BlockHash: blockHash.String(),
+		LeafTTLs:  make([]btcjson.LeafTTLResult, len(leafTTLs)),
+	}
+	for i, leafTTL := range leafTTLs {
+		result.LeafTTLs[i] = btcjson.LeafTTLResult{
+			Txid: leafTTL.OutPoint.Hash.String(),
+			Vout: leafTTL.OutPoint.Index,
+			TTL:  leafTTL.TTL,
+		}
+	}
+
+	return result, nil
+}
+
+// checkProofTargets returns an error if a proof for the given number of
+// targets is more than the node is configured to generate for one request.
+func (s *rpcServer) checkProofTargets(numTargets int) error {
+	if s.cfg.MaxProofTargets > 0 && numTargets > s.cfg.MaxProofTargets {
+		return &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Requested proof for %d targets but "+
+				"at most %d are allowed (--maxprooftargets)",
+				numTargets, s.cfg.MaxProofTargets),
+		}
+	}
+	return nil
+}
+
+// recordProofAccess counts the given proof of the block with the given hash as
+// served from the given source to the client at the given address when
+// --proofaccessstats is set.
+func (s *rpcServer) recordProofAccess(source string, blockHash *chainhash.Hash,
+	udata *wire.UData, addr string) {
+
+	if s.cfg.ProofAccess == nil {
+		return
+	}
+	height, err := s.cfg.Chain.BlockHeightByHash(blockHash)
+	if err != nil {
+		return
+	}
+	s.cfg.ProofAccess.record(source, s.cfg.Chain.BestSnapshot().Height-height,
+		len(udata.AccProof.Targets), udata.SerializeSize(), addr)
+}
+
+// checkProofSize returns an error if a proof of the given serialized size is
+// larger than the node is configured to return.
+func (s *rpcServer) checkProofSize(size int) error {
+	if s.cfg.MaxProofBytes > 0 && size > s.cfg.MaxProofBytes {
+		return &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Proof of %d bytes is larger than "+
+				"the allowed %d bytes (--maxproofbytes)",
+				size, s.cfg.MaxProofBytes),
+		}
+	}
+	return nil
+}
+
+// parseHashOrHeight returns the hash of the block that the given string refers
+// to.  The string may either be a block hash or the height of a block in the
+// main chain.
+func (s *rpcServer) parseHashOrHeight(hashOrHeight string) (*chainhash.Hash, error) {
+	if height, err := strconv.ParseInt(hashOrHeight, 10, 32); err == nil {
+		blockHash, err := s.cfg.Chain.BlockHashByHeight(int32(height))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCOutOfRange,
+				Message: "Block number out of range",
+			}
+		}
+		return blockHash, nil
+	}
+
+	blockHash, err := chainhash.NewHashFromStr(hashOrHeight)
+	if err != nil {
+		return nil, rpcDecodeHexError(hashOrHeight)
+	}
+	return blockHash, nil
+}
+
+// serializeUtreexoProof returns the hex encoded serialization of the given
+// utreexo proof.
+func serializeUtreexoProof(udata *wire.UData) (string, error) {
+	var serialized bytes.Buffer
+	serialized.Grow(udata.SerializeSize())
+	err := udata.Serialize(&serialized)
+	if err != nil {
+		return "", &btcjson.RPCError{
 			Code:    btcjson.ErrRPCMisc,
 			Message: fmt.Sprintf("Couldn't serialize the fetched utreexo data. Error: %v", err),
 		}
 	}
 
-	if *c.Verbosity == 0 {
-		return hex.EncodeToString(serialized.Bytes()), nil
+	return hex.EncodeToString(serialized.Bytes()), nil
+}
+
+// fetchUtreexoProof fetches the utreexo proof of the block with the given hash
+// from whichever utreexo proof index is enabled and returns it along with the
+// hashes of the targets of the proof.
+func (s *rpcServer) fetchUtreexoProof(blockHash *chainhash.Hash) (
+	*wire.UData, []utreexo.Hash, error) {
+
+	// Before doing anything, check that one of the indexes are active.
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
 	}
 
+	height, err := s.cfg.Chain.BlockHeightByHash(blockHash)
+	if err != nil {
+		return nil, nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Height of blockhash %s couldn't be fetched. "+
+				"Error %v", blockHash, err),
+		}
+	}
+
+	if height == 0 {
+		return nil, nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Blockhash %s is the hash of the genesis "+
+				"block and thus doesn't have a utreexoproof.", blockHash),
+		}
+	}
+
+	// We already checked that at least one index is active.  Pick one and
+	// generate the inclusion proof.
+	var udata *wire.UData
+	if s.cfg.UtreexoProofIndex != nil {
+		udata, err = s.cfg.UtreexoProofIndex.FetchUtreexoProof(blockHash)
+		if err != nil {
+			return nil, nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Couldn't fetch the proof for blockhash %s from "+
+					"the utreexoproofindex. Error: %v", blockHash, err),
+			}
+		}
+	} else {
+		udata, err = s.cfg.FlatUtreexoProofIndex.FetchUtreexoProof(height)
+		if err != nil {
+			return nil, nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Couldn't fetch the proof for blockhash %s from "+
+					"the flatutreexoproofindex. Error: %v", blockHash, err),
+			}
+		}
+	}
+
+	targetHashes, err := s.cfg.Chain.ReconstructUData(udata, *blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return udata, targetHashes, nil
+}
+
+// udataResult returns the decoded utreexo data of a block for the getblock
+// command from the reconstructed udata and the hashes of its targets.
+func udataResult(udata *wire.UData, targetHashes []utreexo.Hash) *btcjson.UDataResult {
+	proofHashes := make([]string, 0, len(udata.AccProof.Proof))
+	for _, proofHash := range udata.AccProof.Proof {
+		proofHashes = append(proofHashes, hex.EncodeToString(proofHash[:]))
+	}
+
+	leafDatas := make([]btcjson.LeafDataResult, 0, len(udata.LeafDatas))
+	for i, ld := range udata.LeafDatas {
+		leafDatas = append(leafDatas, btcjson.LeafDataResult{
+			LeafHash:   hex.EncodeToString(targetHashes[i][:]),
+			BlockHash:  ld.BlockHash.String(),
+			Txid:       ld.OutPoint.Hash.String(),
+			Vout:       ld.OutPoint.Index,
+			Height:     ld.Height,
+			IsCoinBase: ld.IsCoinBase,
+			Amount:     btcutil.Amount(ld.Amount).ToBTC(),
+			PkScript:   hex.EncodeToString(ld.PkScript),
+		})
+	}
+
+	return &btcjson.UDataResult{
+		Targets:     udata.AccProof.Targets,
+		ProofHashes: proofHashes,
+		LeafDatas:   leafDatas,
+	}
+}
+
+// utreexoProofVerboseResult returns the verbose result of the given utreexo
+// proof and the hashes of its targets.
+func utreexoProofVerboseResult(udata *wire.UData, targetHashes []utreexo.Hash) (
+	*btcjson.GetUtreexoProofVerboseResult, error) {
+
 	// Convert the hashes to string.
 	proofString := make([]string, 0, len(udata.AccProof.Proof))
 	for _, singleProof := range udata.AccProof.Proof {
@@ -3413,7 +5770,7 @@ func handleGetUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	targetPreimageString := make([]string, 0, len(udata.LeafDatas))
 	for _, ld := range udata.LeafDatas {
 		var buf bytes.Buffer
-		err = ld.Serialize(&buf)
+		err := ld.Serialize(&buf)
 		if err != nil {
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCMisc,
@@ -3423,7 +5780,13 @@ func handleGetUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		targetPreimageString = append(targetPreimageString, hex.EncodeToString(buf.Bytes()))
 	}
 
+	serialized, err := serializeUtreexoProof(udata)
+	if err != nil {
+		return nil, err
+	}
+
 	getReply := &btcjson.GetUtreexoProofVerboseResult{
+		Hex:             serialized,
 		ProofHashes:     proofString,
 		TargetHashes:    targetHashString,
 		TargetPreimages: targetPreimageString,
@@ -3449,20 +5812,24 @@ func handleGetUtreexoRoots(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	}
 	c := cmd.(*btcjson.GetUtreexoRootsCmd)
 
-	// Convert the provided blockhash hex to a Hash.
-	blockHash, err := chainhash.NewHashFromStr(c.BlockHash)
-	if err != nil {
-		return nil, rpcDecodeHexError(c.BlockHash)
+	// The roots at the tip are returned when no block is given.
+	blockHash := &s.cfg.Chain.BestSnapshot().Hash
+	var err error
+	if c.BlockHash != nil {
+		blockHash, err = s.parseHashOrHeight(*c.BlockHash)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	getReply := &btcjson.GetUtreexoRootsResult{}
+	getReply := &btcjson.GetUtreexoRootsResult{BlockHash: blockHash.String()}
 	if s.cfg.Chain.IsUtreexoViewActive() {
 		view, err := s.cfg.Chain.FetchUtreexoViewpoint(blockHash)
 		if err != nil {
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCMisc,
 				Message: fmt.Sprintf("Couldn't fetch the utreexoviewpoint for blockhash %s from "+
-					"the database. Error: %v", c.BlockHash, err),
+					"the database. Error: %v", blockHash, err),
 			}
 		}
 		for _, root := range view.GetRoots() {
@@ -3470,21 +5837,24 @@ func handleGetUtreexoRoots(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		}
 		getReply.NumLeaves = view.NumLeaves()
 	} else if s.cfg.UtreexoProofIndex != nil {
-		var roots []*chainhash.Hash
-		var numLeaves uint64
-		err = s.cfg.DB.View(func(dbTx database.Tx) error {
-			roots, numLeaves, err = s.cfg.UtreexoProofIndex.FetchUtreexoState(dbTx, blockHash)
-			if err != nil {
-				return err
-			}
+		// The roots at the tip are served from the in-memory snapshot
+		// so that polling the tip doesn't contend with block connects.
+		roots, numLeaves, tipHash := s.cfg.UtreexoProofIndex.FetchCurrentUtreexoState()
+		if tipHash != *blockHash {
+			err = s.cfg.DB.View(func(dbTx database.Tx) error {
+				roots, numLeaves, err = s.cfg.UtreexoProofIndex.FetchUtreexoState(dbTx, blockHash)
+				if err != nil {
+					return err
+				}
 
-			return nil
-		})
+				return nil
+			})
+		}
 		if err != nil {
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCMisc,
 				Message: fmt.Sprintf("Couldn't fetch the utreexoview for blockhash %s from "+
-					"Error: %v", c.BlockHash, err),
+					"Error: %v", blockHash, err),
 			}
 		}
 
@@ -3498,18 +5868,21 @@ func handleGetUtreexoRoots(s *rpcServer, cmd interface{}, closeChan <-chan struc
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCMisc,
 				Message: fmt.Sprintf("Couldn't fetch the block height for blockhash %s from "+
-					"the blockindex. Error: %v", c.BlockHash, err),
+					"the blockindex. Error: %v", blockHash, err),
 			}
 		}
 
-		roots, numLeaves, err := s.cfg.FlatUtreexoProofIndex.FetchUtreexoState(height)
+		roots, numLeaves, tipHash := s.cfg.FlatUtreexoProofIndex.FetchCurrentUtreexoState()
+		if tipHash != *blockHash {
+			roots, numLeaves, err = s.cfg.FlatUtreexoProofIndex.FetchUtreexoState(height)
+		}
 		if err != nil {
 			return nil, &btcjson.RPCError{
 				Code: btcjson.ErrRPCMisc,
 				// I'm too ashamed to admit that height+1 is the problem. So I'm gonna lie
 				// to the user and just say it's the view we can't fetch. It's not wrong right?
 				Message: fmt.Sprintf("Couldn't fetch the utreexoview for blockhash %s from "+
-					"Error: %v", c.BlockHash, err),
+					"Error: %v", blockHash, err),
 			}
 		}
 
@@ -3519,9 +5892,116 @@ func handleGetUtreexoRoots(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		getReply.NumLeaves = numLeaves
 	}
 
+	// The roots hash is what --assumeutreexo takes to start from this block.
+	roots := make([]utreexo.Hash, len(getReply.Roots))
+	for i, root := range getReply.Roots {
+		_, err = hex.Decode(roots[i][:], []byte(root))
+		if err != nil {
+			return nil, internalRPCError(err.Error(), "")
+		}
+	}
+	getReply.RootsHash = blockchain.UtreexoRootsHash(getReply.NumLeaves, roots).String()
+
 	return getReply, nil
 }
 
+// handleGetHistoricalRoots implements the gethistoricalroots command.
+func handleGetHistoricalRoots(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	// Before doing anything, check that one of the indexes are active.
+	if s.cfg.UtreexoProofIndex == nil && s.cfg.FlatUtreexoProofIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex).",
+		}
+	}
+
+	// Without the snapshots, every lookup would replay the whole chain.
+	if cfg.RootSnapshotInterval <= 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "The root snapshots are disabled (--rootsnapshotinterval)",
+		}
+	}
+
+	c := cmd.(*btcjson.GetHistoricalRootsCmd)
+	bestHeight := s.cfg.Chain.BestSnapshot().Height
+	if c.Height < 0 || c.Height > bestHeight {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Block height %d out of range", c.Height),
+		}
+	}
+	blockHash, err := s.cfg.Chain.BlockHashByHeight(c.Height)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCOutOfRange,
+			Message: fmt.Sprintf("Block height %d out of range", c.Height),
+		}
+	}
+
+	var snapshot *indexers.RootSnapshot
+	err = s.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		if s.cfg.UtreexoProofIndex != nil {
+			snapshot, err = s.cfg.UtreexoProofIndex.FetchRootSnapshot(dbTx, c.Height)
+		} else {
+			snapshot, err = s.cfg.FlatUtreexoProofIndex.FetchRootSnapshot(dbTx, c.Height)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch the root snapshot")
+	}
+
+	var stump utreexo.Stump
+	if s.cfg.UtreexoProofIndex != nil {
+		stump, err = s.cfg.UtreexoProofIndex.ReplayRoots(snapshot, c.Height)
+	} else {
+		stump, err = s.cfg.FlatUtreexoProofIndex.ReplayRoots(snapshot, c.Height)
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Couldn't replay the roots at height %d "+
+				"from the root snapshot at height %d: %v", c.Height,
+				snapshot.Height, err),
+		}
+	}
+
+	roots := make([]string, 0, len(stump.Roots))
+	for _, root := range stump.Roots {
+		roots = append(roots, hex.EncodeToString(root[:]))
+	}
+
+	return &btcjson.GetHistoricalRootsResult{
+		BlockHash:      blockHash.String(),
+		Height:         c.Height,
+		Roots:          roots,
+		NumLeaves:      stump.NumLeaves,
+		RootsHash:      blockchain.UtreexoRootsHash(stump.NumLeaves, stump.Roots).String(),
+		SnapshotHeight: snapshot.Height,
+		ReplayedBlocks: c.Height - snapshot.Height,
+	}, nil
+}
+
+// handleGetProofAccessStats implements the getproofaccessstats command.
+func handleGetProofAccessStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	if s.cfg.ProofAccess == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "The proof access stats are disabled (--proofaccessstats)",
+		}
+	}
+	c := cmd.(*btcjson.GetProofAccessStatsCmd)
+
+	return s.cfg.ProofAccess.result(*c.Reset), nil
+}
+
 // handleGetUtreexoBlockSummaryRoots implements the getutreexoblocksummaryroots command.
 func handleGetUtreexoBlockSummaryRoots(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
 	interface{}, error) {
@@ -3563,34 +6043,16 @@ func handleProveWatchOnlyChainTipInclusion(s *rpcServer, cmd interface{}, closeC
 
 	proof := s.cfg.WatchOnlyWallet.GetProof()
 
-	if *c.Verbosity == 0 {
-		return proof.String(), nil
-	}
-
-	// Convert the hashes to string.
-	proofString := make([]string, 0, len(proof.AccProof.Proof))
-	for _, singleProof := range proof.AccProof.Proof {
-		// Convert to chainhash.Hash to access the String() method.
-		chainHash := chainhash.Hash(singleProof)
-		proofString = append(proofString, chainHash.String())
-	}
-
-	hashesProvenString := make([]string, 0, len(proof.HashesProven))
-	for _, singleHash := range proof.HashesProven {
-		// Convert to chainhash.Hash to access the String() method.
-		chainHash := chainhash.Hash(singleHash)
-		hashesProvenString = append(hashesProvenString, chainHash.String())
+	proofHex := proof.String()
+	if err := s.checkProofSize(len(proofHex) / 2); err != nil {
+		return nil, err
 	}
 
-	proveReply := &btcjson.ProveUtxoChainTipInclusionVerboseResult{
-		ProvedAtHash: proof.ProvedAtHash.String(),
-		ProofHashes:  proofString,
-		ProofTargets: proof.AccProof.Targets,
-		HashesProven: hashesProvenString,
-		Hex:          proof.String(),
+	if *c.Verbosity == 0 {
+		return proofHex, nil
 	}
 
-	return proveReply, nil
+	return chainTipProofResult(&proof, proofHex), nil
 }
 
 // retrievedTx represents a transaction that was either loaded from the
@@ -3823,6 +6285,8 @@ func sendTxToMempoolSpace(rawTx string, chainParams *chaincfg.Params) (string, e
 	case chaincfg.MainNetParams.Name:
 	case chaincfg.TestNet3Params.Name:
 		link = "https://mempool.space/testnet/api/tx"
+	case chaincfg.TestNet4Params.Name:
+		link = "https://mempool.space/testnet4/api/tx"
 	case chaincfg.SigNetParams.Name:
 		link = "https://mempool.space/signet/api/tx"
 	default:
@@ -3897,7 +6361,7 @@ func handleRebroadcastUnconfirmedBDKTxs(s *rpcServer, cmd interface{}, closeChan
 				Message: fmt.Sprintf("Failed to broadcast transaction to mempool.space. %v", err),
 			}
 		} else {
-			err = s.rpcProcessTx(&tx, true, false)
+			err = s.rpcProcessTx(&tx, nil, true, false)
 			if err != nil {
 				return nil, err
 			}
@@ -3915,15 +6379,24 @@ func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struc
 
 	reconsiderHash, err := chainhash.NewHashFromStr(c.BlockHash)
 	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if s.cfg.Chain.IndexLookupNode(reconsiderHash) == nil {
 		return nil, &btcjson.RPCError{
-			Code: btcjson.ErrRPCDeserialization,
-			Message: fmt.Sprintf("Failed to deserialize blockhash from string of %s",
-				reconsiderHash),
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
 		}
 	}
 
 	err = s.cfg.Chain.ReconsiderBlock(reconsiderHash)
-	return nil, err
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: err.Error(),
+		}
+	}
+
+	return nil, s.flushUtreexoStateAtTip()
 }
 
 // handleRegisterAddressessToWatchOnlyWallet implements the handleregisteraddresstowatchonlyaddress command.
@@ -3950,6 +6423,33 @@ func handleRegisterAddressesToWatchOnlyWallet(s *rpcServer, cmd interface{}, clo
 	return nil, nil
 }
 
+// handleRegisterDescriptorsToWatchOnlyWallet implements the registerdescriptorstowatchonlywallet
+// command.
+func handleRegisterDescriptorsToWatchOnlyWallet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.RegisterDescriptorsToWatchOnlyWalletCmd)
+
+	if s.cfg.WatchOnlyWallet == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Watch only wallet must be enabled (--watchonlywallet)",
+		}
+	}
+
+	registered := make([]string, 0, len(c.Descriptors))
+	for _, desc := range c.Descriptors {
+		descs, err := s.cfg.WatchOnlyWallet.RegisterDescriptor(desc)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Couldn't register the given descriptor %s. Error: %v", desc, err),
+			}
+		}
+		registered = append(registered, descs...)
+	}
+
+	return registered, nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
@@ -4211,96 +6711,301 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		}
 	}
 
-	return srtList, nil
-}
-
-// rpcProcessTx checks that the tx is accepted into the mempool and relays it to peers
-// and other processes.
-func (s *rpcServer) rpcProcessTx(tx *btcutil.Tx, allowOrphan, rateLimit bool) error {
-	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, nil, allowOrphan, rateLimit, 0)
-	if err != nil {
-		// When the error is a rule error, it means the transaction was
-		// simply rejected as opposed to something actually going wrong,
-		// so log it as such. Otherwise, something really did go wrong,
-		// so log it as an actual error and return.
-		ruleErr, ok := err.(mempool.RuleError)
-		if !ok {
-			rpcsLog.Errorf("Failed to process transaction %v: %v",
-				tx.Hash(), err)
-
-			return &btcjson.RPCError{
-				Code:    btcjson.ErrRPCTxError,
-				Message: "TX rejected: " + err.Error(),
+	return srtList, nil
+}
+
+// rpcTxRejectedError maps the error returned by the mempool when processing
+// transactions to the appropriate RPC error, matching bitcoind's behavior.
+func rpcTxRejectedError(err error) *btcjson.RPCError {
+	ruleErr, ok := err.(mempool.RuleError)
+	if !ok {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCTxError,
+			Message: "TX rejected: " + err.Error(),
+		}
+	}
+
+	code := btcjson.ErrRPCTxError
+	if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
+		errDesc := txRuleErr.Description
+		switch {
+		case strings.Contains(
+			strings.ToLower(errDesc), "orphan transaction",
+		):
+			code = btcjson.ErrRPCTxError
+
+		case strings.Contains(
+			strings.ToLower(errDesc), "transaction already exists",
+		):
+			code = btcjson.ErrRPCTxAlreadyInChain
+
+		default:
+			code = btcjson.ErrRPCTxRejected
+		}
+	}
+
+	return &btcjson.RPCError{
+		Code:    code,
+		Message: "TX rejected: " + err.Error(),
+	}
+}
+
+// rpcProcessTx checks that the tx is accepted into the mempool and relays it to peers
+// and other processes.  The utreexo data of the inputs is required for the tx to be
+// accepted on nodes without the utxo set and is ignored otherwise.
+func (s *rpcServer) rpcProcessTx(tx *btcutil.Tx, utreexoData *wire.UData, allowOrphan, rateLimit bool) error {
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, utreexoData, allowOrphan, rateLimit, 0)
+	if err != nil {
+		// When the error is a rule error, it means the transaction was
+		// simply rejected as opposed to something actually going wrong,
+		// so log it as such. Otherwise, something really did go wrong,
+		// so log it as an actual error.
+		if _, ok := err.(mempool.RuleError); !ok {
+			rpcsLog.Errorf("Failed to process transaction %v: %v",
+				tx.Hash(), err)
+		} else {
+			rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
+		}
+
+		return rpcTxRejectedError(err)
+	}
+
+	// When the transaction was accepted it should be the first item in the
+	// returned array of accepted transactions.  The only way this will not
+	// be true is if the API for ProcessTransaction changes and this code is
+	// not properly updated, but ensure the condition holds as a safeguard.
+	//
+	// Also, since an error is being returned to the caller, ensure the
+	// transaction is removed from the memory pool.
+	if len(acceptedTxs) == 0 || !acceptedTxs[0].Tx.Hash().IsEqual(tx.Hash()) {
+		s.cfg.TxMemPool.RemoveTransaction(tx, true)
+
+		errStr := fmt.Sprintf("transaction %v is not in accepted list",
+			tx.Hash())
+		return internalRPCError(errStr, "")
+	}
+
+	// Generate and relay inventory vectors for all newly accepted
+	// transactions into the memory pool due to the original being
+	// accepted.
+	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+
+	// Notify both websocket and getblocktemplate long poll clients of all
+	// newly accepted transactions.
+	s.NotifyNewTransactions(acceptedTxs)
+
+	// Keep track of all the txns so that they can be rebroadcast if they
+	// don't make their way into a block.
+	txD := acceptedTxs[0]
+	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+
+	return nil
+}
+
+// handleSendRawTransaction implements the sendrawtransaction command.
+func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SendRawTransactionCmd)
+	// Deserialize and send off to tx relay
+	msgTx, err := decodeRawTx(c.HexTx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes without the utxo set can't validate the inputs without their
+	// proof.
+	if s.cfg.Chain.IsUtreexoViewActive() && len(msgTx.TxIn) > 0 {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The utreexo proof of the inputs is needed to " +
+				"validate the transaction. Use sendrawtransactionwithproof",
+		}
+	}
+
+	// Use 0 for the tag to represent local node.
+	tx := btcutil.NewTx(msgTx)
+	err = s.rpcProcessTx(tx, nil, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Hash().String(), nil
+}
+
+// handleSendRawTransactionWithProof implements the sendrawtransactionwithproof
+// command.
+func handleSendRawTransactionWithProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SendRawTransactionWithProofCmd)
+	msgTx, err := decodeRawTx(c.HexTx)
+	if err != nil {
+		return nil, err
+	}
+
+	ud, err := s.decodeRawProof(c.HexProof, msgTx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes with the utxo set validate the inputs against it and don't
+	// need the proof.
+	var utreexoData *wire.UData
+	if s.cfg.Chain.IsUtreexoViewActive() {
+		utreexoData = ud
+	}
+	tx := btcutil.NewTx(msgTx)
+	err = s.rpcProcessTx(tx, utreexoData, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Hash().String(), nil
+}
+
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SubmitPackageCmd)
+	if len(c.RawTxns) < 2 || len(c.RawTxns) > mempool.MaxPackageCount {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Array must contain between 2 and "+
+				"%d transactions", mempool.MaxPackageCount),
+		}
+	}
+	if c.Proofs != nil && len(*c.Proofs) != len(c.RawTxns) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Expected %d proofs, got %d",
+				len(c.RawTxns), len(*c.Proofs)),
+		}
+	}
+
+	// Nodes without the utxo set can't validate the inputs without their
+	// proofs.
+	utreexoViewActive := s.cfg.Chain.IsUtreexoViewActive()
+	if utreexoViewActive && c.Proofs == nil {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The utreexo proofs of the inputs are needed " +
+				"to validate the package",
+		}
+	}
+
+	txs := make([]*btcutil.Tx, 0, len(c.RawTxns))
+	for _, rawTx := range c.RawTxns {
+		msgTx, err := decodeRawTx(rawTx)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, btcutil.NewTx(msgTx))
+	}
+
+	// The proofs are ignored by nodes with the utxo set.
+	var udatas []*wire.UData
+	if utreexoViewActive {
+		udatas = make([]*wire.UData, 0, len(txs))
+		for i, hexProof := range *c.Proofs {
+			ud, err := s.decodeRawProof(hexProof, txs[i].MsgTx())
+			if err != nil {
+				return nil, err
 			}
+			udatas = append(udatas, ud)
 		}
+	}
 
-		rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
+	result, err := s.cfg.TxMemPool.ProcessPackage(txs, udatas, false)
+	if err != nil {
+		if _, ok := err.(mempool.RuleError); !ok {
+			rpcsLog.Errorf("Failed to process package: %v", err)
+		} else {
+			rpcsLog.Debugf("Rejected package: %v", err)
+		}
 
-		// We'll then map the rule error to the appropriate RPC error,
-		// matching bitcoind's behavior.
-		code := btcjson.ErrRPCTxError
-		if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
-			errDesc := txRuleErr.Description
-			switch {
-			case strings.Contains(
-				strings.ToLower(errDesc), "orphan transaction",
-			):
-				code = btcjson.ErrRPCTxError
+		return nil, rpcTxRejectedError(err)
+	}
 
-			case strings.Contains(
-				strings.ToLower(errDesc), "transaction already exists",
-			):
-				code = btcjson.ErrRPCTxAlreadyInChain
+	// Relay and notify the newly accepted transactions and keep track of
+	// the ones from the package so that they can be rebroadcast if they
+	// don't make their way into a block.
+	s.cfg.ConnMgr.RelayTransactions(result.Accepted)
+	s.NotifyNewTransactions(result.Accepted)
 
-			default:
-				code = btcjson.ErrRPCTxRejected
-			}
+	accepted := make(map[chainhash.Hash]struct{}, len(result.Accepted))
+	var includes []string
+	for _, txD := range result.Accepted {
+		accepted[*txD.Tx.Hash()] = struct{}{}
+	}
+	for _, txD := range result.TxDescs {
+		if _, ok := accepted[*txD.Tx.Hash()]; !ok {
+			continue
 		}
+		includes = append(includes, txD.Tx.WitnessHash().String())
 
-		return &btcjson.RPCError{
-			Code:    code,
-			Message: "TX rejected: " + err.Error(),
-		}
+		iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+		s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
 	}
 
-	// When the transaction was accepted it should be the first item in the
-	// returned array of accepted transactions.  The only way this will not
-	// be true is if the API for ProcessTransaction changes and this code is
-	// not properly updated, but ensure the condition holds as a safeguard.
-	//
-	// Also, since an error is being returned to the caller, ensure the
-	// transaction is removed from the memory pool.
-	if len(acceptedTxs) == 0 || !acceptedTxs[0].Tx.Hash().IsEqual(tx.Hash()) {
-		s.cfg.TxMemPool.RemoveTransaction(tx, true)
-
-		errStr := fmt.Sprintf("transaction %v is not in accepted list",
-			tx.Hash())
-		return internalRPCError(errStr, "")
+	reply := &btcjson.SubmitPackageResult{
+		PackageMsg:           "success",
+		TxResults:            make(map[string]btcjson.SubmitPackageTxResult, len(txs)),
+		ReplacedTransactions: []string{},
 	}
+	for _, txD := range result.TxDescs {
+		txResult := btcjson.SubmitPackageTxResult{
+			Txid:  txD.Tx.Hash().String(),
+			Vsize: int32(mempool.GetTxVirtualSize(txD.Tx)),
+			Fees: btcjson.SubmitPackageFees{
+				Base:             btcutil.Amount(txD.Fee).ToBTC(),
+				EffectiveFeeRate: btcutil.Amount(txD.FeePerKB).ToBTC(),
+			},
+		}
 
-	// Generate and relay inventory vectors for all newly accepted
-	// transactions into the memory pool due to the original being
-	// accepted.
-	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+		// The transactions added along with the package are accepted
+		// for the fee rate of the package.
+		if _, ok := accepted[*txD.Tx.Hash()]; ok {
+			txResult.Fees.EffectiveFeeRate =
+				btcutil.Amount(result.FeePerKB).ToBTC()
+			txResult.Fees.EffectiveIncludes = includes
+		}
+		reply.TxResults[txD.Tx.WitnessHash().String()] = txResult
+	}
 
-	// Notify both websocket and getblocktemplate long poll clients of all
-	// newly accepted transactions.
-	s.NotifyNewTransactions(acceptedTxs)
+	return reply, nil
+}
 
-	// Keep track of all the txns so that they can be rebroadcast if they
-	// don't make their way into a block.
-	txD := acceptedTxs[0]
-	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
-	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+// decodeRawProof deserializes the hex-encoded utreexo proof of the inputs of
+// the given transaction passed in to a command.
+func (s *rpcServer) decodeRawProof(hexStr string, msgTx *wire.MsgTx) (*wire.UData, error) {
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedProof, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	if err := s.checkProofSize(len(serializedProof)); err != nil {
+		return nil, err
+	}
+	var ud wire.UData
+	err = ud.Deserialize(bytes.NewReader(serializedProof))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Proof decode failed: " + err.Error(),
+		}
+	}
+	if len(ud.LeafDatas) != len(msgTx.TxIn) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Proof has %d leaf datas for %d inputs",
+				len(ud.LeafDatas), len(msgTx.TxIn)),
+		}
+	}
 
-	return nil
+	return &ud, nil
 }
 
-// handleSendRawTransaction implements the sendrawtransaction command.
-func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.SendRawTransactionCmd)
-	// Deserialize and send off to tx relay
-	hexStr := c.HexTx
+// decodeRawTx deserializes the hex-encoded transaction passed in to a command.
+func decodeRawTx(hexStr string) (*wire.MsgTx, error) {
 	if len(hexStr)%2 != 0 {
 		hexStr = "0" + hexStr
 	}
@@ -4317,14 +7022,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		}
 	}
 
-	// Use 0 for the tag to represent local node.
-	tx := btcutil.NewTx(&msgTx)
-	err = s.rpcProcessTx(tx, false, false)
-	if err != nil {
-		return nil, err
-	}
-
-	return tx.Hash().String(), nil
+	return &msgTx, nil
 }
 
 // handleSetGenerate implements the setgenerate command.
@@ -4477,6 +7175,126 @@ func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (int
 	return time.Now().Unix() - s.cfg.StartupTime, nil
 }
 
+// proveOutpointsUData returns the leaf datas of the given unspent outpoints
+// along with a proof for all of them against the current accumulator of
+// whichever utreexo proof index is enabled.  The caller must check that one of
+// the indexes is enabled.
+func (s *rpcServer) proveOutpointsUData(outpoints []wire.OutPoint) (*wire.UData, *chainhash.Hash, error) {
+	proof, err := s.proveOutpoints(outpoints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leafDatas := make([]wire.LeafData, 0, len(outpoints))
+	for i, outpoint := range outpoints {
+		utxo, err := s.cfg.Chain.FetchUtxoEntry(outpoint)
+		if err != nil || utxo == nil || utxo.IsSpent() {
+			return nil, nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Requested UTXO with txid %s and vout %d "+
+					"does not exist in the UTXO set",
+					outpoint.Hash.String(), outpoint.Index),
+			}
+		}
+		blockHash, err := s.cfg.Chain.BlockHashByHeight(utxo.BlockHeight())
+		if err != nil {
+			context := "Failed to fetch block hash"
+			return nil, nil, internalRPCError(err.Error(), context)
+		}
+
+		leafData := wire.LeafData{
+			BlockHash:  *blockHash,
+			OutPoint:   outpoint,
+			Amount:     utxo.Amount(),
+			PkScript:   utxo.PkScript(),
+			Height:     utxo.BlockHeight(),
+			IsCoinBase: utxo.IsCoinBase(),
+		}
+
+		// A block may have been connected after the proof was generated.
+		if leafData.LeafHash() != proof.HashesProven[i] {
+			return nil, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "The UTXO set changed while proving the inputs, try again",
+			}
+		}
+		leafDatas = append(leafDatas, leafData)
+	}
+
+	return &wire.UData{AccProof: *proof.AccProof, LeafDatas: leafDatas},
+		proof.ProvedAtHash, nil
+}
+
+// handleUtxoUpdatePsbt implements the utxoupdatepsbt command.
+func handleUtxoUpdatePsbt(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Before doing anything, check that there's something to prove the
+	// inputs with.
+	if s.cfg.WatchOnlyWallet == nil && s.cfg.UtreexoProofIndex == nil &&
+		s.cfg.FlatUtreexoProofIndex == nil {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index or the watch only wallet must " +
+				"be enabled. (--utreexoproofindex), (--flatutreexoproofindex) " +
+				"or (--watchonlywallet).",
+		}
+	}
+	c := cmd.(*btcjson.UtxoUpdatePsbtCmd)
+
+	packet, err := decodePsbt(c.Psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	outpoints := make([]wire.OutPoint, 0, len(packet.UnsignedTx.TxIn))
+	for _, txIn := range packet.UnsignedTx.TxIn {
+		outpoints = append(outpoints, txIn.PreviousOutPoint)
+	}
+
+	// The watch only wallet keeps the proofs of its own utxos so it's used
+	// when enabled.  Otherwise the inputs are proven with the proof index.
+	var (
+		ud       *wire.UData
+		provedAt *chainhash.Hash
+	)
+	if s.cfg.WatchOnlyWallet != nil {
+		if err := s.checkProofTargets(len(outpoints)); err != nil {
+			return nil, err
+		}
+
+		var bestHash chainhash.Hash
+		ud, bestHash, err = s.cfg.WatchOnlyWallet.ProveOutPoints(outpoints)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Couldn't prove the inputs with the watch only wallet. Error: %v", err),
+			}
+		}
+		if err := s.checkProofSize(ud.SerializeSize()); err != nil {
+			return nil, err
+		}
+		provedAt = &bestHash
+	} else {
+		ud, provedAt, err = s.proveOutpointsUData(outpoints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = packet.AddUtreexoData(ud, *provedAt)
+	if err != nil {
+		context := "Failed to add utreexo data to psbt"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		context := "Failed to encode psbt"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return encoded, nil
+}
+
 // handleValidateAddress implements the validateaddress command.
 func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.ValidateAddressCmd)
@@ -4653,6 +7471,127 @@ func handleVersion(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return result, nil
 }
 
+// decodeUtreexoHashes decodes the given hex encoded utreexo hashes.
+func decodeUtreexoHashes(hashStrs []string) ([]utreexo.Hash, error) {
+	hashes := make([]utreexo.Hash, 0, len(hashStrs))
+	for _, hashStr := range hashStrs {
+		var hash utreexo.Hash
+		decoded, err := hex.DecodeString(hashStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hashStr)
+		}
+		if len(decoded) != len(hash) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Hash %s is %d bytes instead of %d",
+					hashStr, len(decoded), len(hash)),
+			}
+		}
+		copy(hash[:], decoded)
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+// currentUtreexoStump returns the roots and the number of leaves of the
+// accumulator at the tip of the chain.
+func (s *rpcServer) currentUtreexoStump() (utreexo.Stump, error) {
+	var (
+		roots     []*chainhash.Hash
+		numLeaves uint64
+	)
+	switch {
+	case s.cfg.UtreexoProofIndex != nil:
+		roots, numLeaves, _ = s.cfg.UtreexoProofIndex.FetchCurrentUtreexoState()
+	case s.cfg.FlatUtreexoProofIndex != nil:
+		roots, numLeaves, _ = s.cfg.FlatUtreexoProofIndex.FetchCurrentUtreexoState()
+	case s.cfg.Chain.IsUtreexoViewActive():
+		bestHash := s.cfg.Chain.BestSnapshot().Hash
+		view, err := s.cfg.Chain.FetchUtreexoViewpoint(&bestHash)
+		if err != nil {
+			return utreexo.Stump{}, &btcjson.RPCError{
+				Code: btcjson.ErrRPCMisc,
+				Message: fmt.Sprintf("Couldn't fetch the utreexoviewpoint for "+
+					"blockhash %s from the database. Error: %v", bestHash, err),
+			}
+		}
+		roots, numLeaves = view.GetRoots(), view.NumLeaves()
+	default:
+		return utreexo.Stump{}, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "The roots must be given as no utreexo index or utreexo " +
+				"is enabled. (--utreexoproofindex) or (--flatutreexoproofindex) " +
+				"or (--utreexo)",
+		}
+	}
+
+	stump := utreexo.Stump{
+		Roots:     make([]utreexo.Hash, 0, len(roots)),
+		NumLeaves: numLeaves,
+	}
+	for _, root := range roots {
+		stump.Roots = append(stump.Roots, utreexo.Hash(*root))
+	}
+	return stump, nil
+}
+
+// handleVerifyUtreexoProof implements the verifyutreexoproof command.
+func handleVerifyUtreexoProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
+	interface{}, error) {
+
+	c := cmd.(*btcjson.VerifyUtreexoProofCmd)
+
+	proofBytes, err := hex.DecodeString(c.Proof)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Proof)
+	}
+	proof, err := wire.BatchProofDeserialize(bytes.NewReader(proofBytes))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: fmt.Sprintf("Couldn't decode the given proof. Error: %v", err),
+		}
+	}
+	if err := s.checkProofTargets(len(proof.Targets)); err != nil {
+		return nil, err
+	}
+
+	delHashes, err := decodeUtreexoHashes(c.DelHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify against the current roots of the node if no roots are given.
+	var stump utreexo.Stump
+	if len(c.Roots) == 0 {
+		stump, err = s.currentUtreexoStump()
+	} else {
+		stump.NumLeaves = c.NumLeaves
+		stump.Roots, err = decodeUtreexoHashes(c.Roots)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &btcjson.VerifyUtreexoProofResult{
+		Valid:     true,
+		NumLeaves: stump.NumLeaves,
+		Roots:     make([]string, 0, len(stump.Roots)),
+	}
+	for _, root := range stump.Roots {
+		result.Roots = append(result.Roots, hex.EncodeToString(root[:]))
+	}
+
+	_, err = utreexo.Verify(stump, delHashes, *proof)
+	if err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+	}
+
+	return result, nil
+}
+
 // handleVerifyUtxoChainTipInclusionProof implements the verifyutxochaintipinclusionproof command.
 func handleVerifyUtxoChainTipInclusionProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
 	interface{}, error) {
@@ -4739,8 +7678,33 @@ func handleTestMempoolAccept(s *rpcServer, cmd interface{},
 		txns = append(txns, tx)
 	}
 
+	// Nodes without the utxo set verify the proofs of the inputs against
+	// the current roots of the accumulator and fetch the inputs from them.
+	// The proofs are ignored otherwise.
+	udatas := make([]*wire.UData, len(txns))
+	if c.Proofs != nil {
+		if len(*c.Proofs) != len(txns) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Expected %d proofs, got %d",
+					len(txns), len(*c.Proofs)),
+			}
+		}
+		if s.cfg.Chain.IsUtreexoViewActive() {
+			for i, hexProof := range *c.Proofs {
+				ud, err := s.decodeRawProof(
+					hexProof, txns[i].MsgTx(),
+				)
+				if err != nil {
+					return nil, err
+				}
+				udatas[i] = ud
+			}
+		}
+	}
+
 	results := make([]*btcjson.TestMempoolAcceptResult, 0, len(txns))
-	for _, tx := range txns {
+	for i, tx := range txns {
 		// Create a test result item.
 		item := &btcjson.TestMempoolAcceptResult{
 			Txid:  tx.Hash().String(),
@@ -4748,7 +7712,9 @@ func handleTestMempoolAccept(s *rpcServer, cmd interface{},
 		}
 
 		// Check the mempool acceptance.
-		result, err := s.cfg.TxMemPool.CheckMempoolAcceptance(tx)
+		result, err := s.cfg.TxMemPool.CheckMempoolAcceptance(
+			tx, udatas[i],
+		)
 
 		// If an error is returned, this tx is not allow, hence we
 		// record the reason.
@@ -4792,6 +7758,16 @@ func handleTestMempoolAccept(s *rpcServer, cmd interface{},
 		// fields.
 		if item.Allowed {
 			item.Vsize = int32(result.TxSize)
+
+			// Report the transactions the tx would replace, which
+			// include the descendants of the ones it conflicts
+			// with.
+			for hash := range result.Conflicts {
+				item.ReplacedTransactions = append(
+					item.ReplacedTransactions, hash.String(),
+				)
+			}
+			sort.Strings(item.ReplacedTransactions)
 		} else {
 			// NOTE: "max-fee-exceeded" is what bitcoind returns
 			// here, so we mimic the same error message.
@@ -5473,6 +8449,26 @@ func (s *rpcServer) Start() {
 		s.jsonRPCRead(w, r, isAdmin)
 	})
 
+	// Public REST endpoints.  These don't require authentication as they
+	// only serve public data.
+	if cfg.REST {
+		rpcServeMux.HandleFunc(restUtreexoProofPath, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			r.Close = true
+
+			// Limit the number of connections to max allowed.
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+
+			// Keep track of the number of connected clients.
+			s.incrementClients()
+			defer s.decrementClients()
+
+			s.handleRESTUtreexoProof(w, r)
+		})
+	}
+
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		authenticated, isAdmin, err := s.checkAuth(r, false)
@@ -5620,6 +8616,10 @@ type rpcserverConnManager interface {
 	// network for all peers for tx messages.
 	TxTotals() (uint64, uint64, uint64, uint64, uint64, uint64)
 
+	// PeerPolicyCounts returns the counts of the peers the connection
+	// policies refused or deprioritized.
+	PeerPolicyCounts() peerPolicyCounts
+
 	// ConnectedPeers returns an array consisting of all connected peers.
 	ConnectedPeers() []rpcserverPeer
 
@@ -5642,7 +8642,7 @@ type rpcserverConnManager interface {
 
 	// NodeAddresses returns an array consisting node addresses which can
 	// potentially be used to find new nodes in the network.
-	NodeAddresses() []*wire.NetAddress
+	NodeAddresses() []*wire.NetAddressV2
 }
 
 // rpcserverSyncManager represents a sync manager for use with the RPC server.
@@ -5670,6 +8670,10 @@ type rpcserverSyncManager interface {
 	// current tip is reached, up to a max of wire.MaxBlockHeadersPerMsg
 	// hashes.
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
+
+	// PeerReputations returns the reputations of all the peers that have
+	// been connected as sources of blocks and their utreexo proofs.
+	PeerReputations() []netsync.PeerReputation
 }
 
 // rpcserverConfig is a descriptor containing the RPC server configuration.
@@ -5716,13 +8720,44 @@ type rpcserverConfig struct {
 	TxIndex               *indexers.TxIndex
 	AddrIndex             *indexers.AddrIndex
 	CfIndex               *indexers.CfIndex
+	LeafDataIndex         *indexers.LeafDataIndex
 	UtreexoProofIndex     *indexers.UtreexoProofIndex
 	FlatUtreexoProofIndex *indexers.FlatUtreexoProofIndex
 
+	// IndexManager manages the optional indexes above.  It's used to report
+	// how far each index is caught up to the main chain.
+	IndexManager *indexers.Manager
+
+	// MaxProofTargets and MaxProofBytes bound the number of targets a
+	// single proof request may ask for and the size of a proof that will
+	// be returned.  A value of 0 means there is no limit.
+	MaxProofTargets int
+	MaxProofBytes   int
+
+	// ProofAccess counts the utreexo proofs served over RPC and REST.  It
+	// is nil if --proofaccessstats isn't set.
+	ProofAccess *proofAccessStats
+
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	FeeEstimator *mempool.FeeEstimator
 
+	// The smart fee estimator keeps track of how many blocks it takes for
+	// the transactions of each fee rate to confirm.
+	SmartFeeEstimator *mempool.SmartFeeEstimator
+
+	// DiskUsageMonitor keeps track of the on-disk size of the block
+	// database and the indexes.
+	DiskUsageMonitor *diskUsageMonitor
+
+	// BlockScrubber keeps track of the background passes that re-verify the
+	// stored blocks and proofs.  It is nil if block scrubbing is disabled.
+	BlockScrubber *blockScrubber
+
+	// StaleTipMonitor keeps track of when the tip last advanced.  It is nil
+	// if stale tip detection is disabled.
+	StaleTipMonitor *staleTipMonitor
+
 	// WatchOnlyWallet keeps track of relevant utxos and its utreexo proof
 	// for the given addresses and xpubs.
 	WatchOnlyWallet *wallet.WatchOnlyWalletManager
@@ -5736,7 +8771,7 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 	rpc := rpcServer{
 		cfg:                    *config,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(config.TimeSource),
+		gbtWorkState:           newGbtWorkState(config.TimeSource, config.ChainParams),
 		helpCacher:             newHelpCacher(),
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
@@ -5791,6 +8826,7 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients of incoming block.
 		s.ntfnMgr.NotifyBlockConnected(block)
+		s.notifyUtreexoRoots(block.Hash(), block.Height(), false)
 
 	case blockchain.NTBlockDisconnected:
 		block, ok := notification.Data.(*btcutil.Block)
@@ -5801,7 +8837,84 @@ func (s *rpcServer) handleBlockchainNotification(notification *blockchain.Notifi
 
 		// Notify registered websocket clients.
 		s.ntfnMgr.NotifyBlockDisconnected(block)
+		s.notifyUtreexoRoots(&block.MsgBlock().Header.PrevBlock,
+			block.Height()-1, true)
+	}
+}
+
+// notifyUtreexoRoots passes the roots of the accumulator at the given block,
+// which just became the tip, to the notification manager.  It's a no-op when
+// the node keeps no accumulator.
+func (s *rpcServer) notifyUtreexoRoots(hash *chainhash.Hash, height int32,
+	disconnected bool) {
+
+	roots, numLeaves, err := fetchTipUtreexoRoots(s.cfg.Chain,
+		s.cfg.UtreexoProofIndex, s.cfg.FlatUtreexoProofIndex, hash)
+	if err != nil {
+		if err != errNoUtreexoAccumulator {
+			rpcsLog.Warnf("Couldn't fetch the utreexo roots at "+
+				"block %v: %v", hash, err)
+		}
+		return
+	}
+
+	hexRoots := make([]string, 0, len(roots))
+	for _, root := range roots {
+		hexRoots = append(hexRoots, hex.EncodeToString(root[:]))
+	}
+	s.ntfnMgr.NotifyUtreexoRoots(btcjson.NewUtreexoRootsNtfn(hash.String(),
+		height, numLeaves, hexRoots, disconnected))
+}
+
+// errNoUtreexoAccumulator is returned when the utreexo roots are fetched from a
+// node that keeps no utreexo accumulator.
+var errNoUtreexoAccumulator = errors.New("the node keeps no utreexo " +
+	"accumulator")
+
+// fetchTipUtreexoRoots returns the roots and the number of leaves of the
+// accumulator at the given block, which must be the tip.  The roots come from
+// the utreexo proof indexes when they're enabled and from the chain of a
+// utreexo node otherwise.
+func fetchTipUtreexoRoots(chain *blockchain.BlockChain,
+	utreexoProofIndex *indexers.UtreexoProofIndex,
+	flatUtreexoProofIndex *indexers.FlatUtreexoProofIndex,
+	hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
+
+	var (
+		roots     []*chainhash.Hash
+		numLeaves uint64
+		tipHash   chainhash.Hash
+	)
+	switch {
+	case utreexoProofIndex != nil:
+		roots, numLeaves, tipHash = utreexoProofIndex.FetchCurrentUtreexoState()
+
+	case flatUtreexoProofIndex != nil:
+		roots, numLeaves, tipHash = flatUtreexoProofIndex.FetchCurrentUtreexoState()
+
+	case chain.IsUtreexoViewActive():
+		view, err := chain.FetchUtreexoViewpoint(hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if view == nil {
+			return nil, 0, fmt.Errorf("no utreexo view at block %v",
+				hash)
+		}
+		roots, numLeaves, tipHash = view.GetRoots(), view.NumLeaves(), *hash
+
+	default:
+		return nil, 0, errNoUtreexoAccumulator
+	}
+
+	// The indexes are updated along with the chain so their tip is always
+	// the block that was just connected or disconnected to.
+	if tipHash != *hash {
+		return nil, 0, fmt.Errorf("the utreexo roots are at block %v "+
+			"instead", tipHash)
 	}
+
+	return roots, numLeaves, nil
 }
 
 func init() {
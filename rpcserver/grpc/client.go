@@ -0,0 +1,182 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxResponseSize is the largest response message the client accepts.  It
+// fits the largest blocks along with their utreexo proofs.
+const maxResponseSize = 1 << 26
+
+// ClientConfig is the configuration of a Client.
+type ClientConfig struct {
+	// Host is the host:port of the gRPC server.
+	Host string
+
+	// TLSConfig is the TLS config of the connections to the server.  Its
+	// RootCAs have to include the certificate of the server unless it's
+	// signed by a trusted authority.
+	TLSConfig *tls.Config
+
+	// User and Pass are the RPC credentials of the server.  No credentials
+	// are sent when User is empty.
+	User string
+	Pass string
+}
+
+// Client calls the gRPC API of another utreexod.  Only the streaming methods
+// that followers need are implemented.
+type Client struct {
+	cfg        ClientConfig
+	httpClient *http.Client
+}
+
+// NewClient returns a client of the gRPC server in the config.  No connection
+// is made until a method is called.
+func NewClient(cfg *ClientConfig) *Client {
+	return &Client{
+		cfg: *cfg,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:   cfg.TLSConfig,
+				ForceAttemptHTTP2: true,
+			},
+		},
+	}
+}
+
+// ReplicationStream is an open SubscribeReplication stream.
+type ReplicationStream struct {
+	resp *http.Response
+}
+
+// SubscribeReplication opens a stream of the replication deltas of the main
+// chain of the server starting at the given height.  The stream is closed
+// once ctx is done.
+func (c *Client) SubscribeReplication(ctx context.Context,
+	startHeight uint32) (*ReplicationStream, error) {
+
+	req := &SubscribeReplicationRequest{StartHeight: startHeight}
+	resp, err := c.openStream(ctx, "SubscribeReplication", req)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicationStream{resp: resp}, nil
+}
+
+// Recv returns the next replication delta.  Once the stream ended, the status
+// of the call is returned as an *Error or io.EOF when it ended without error.
+func (s *ReplicationStream) Recv() (*ReplicationDelta, error) {
+	msg, err := readResponse(s.resp.Body)
+	if err == io.EOF {
+		return nil, responseStatus(s.resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var delta ReplicationDelta
+	if err := delta.Unmarshal(msg); err != nil {
+		return nil, fmt.Errorf("invalid replication delta: %v", err)
+	}
+	return &delta, nil
+}
+
+// Close closes the stream.
+func (s *ReplicationStream) Close() error {
+	return s.resp.Body.Close()
+}
+
+// openStream calls the streaming method and returns the response once its
+// headers are received.
+func (c *Client) openStream(ctx context.Context, method string,
+	req Message) (*http.Response, error) {
+
+	var body bytes.Buffer
+	if err := writeMessage(&body, req.Marshal()); err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://"+c.cfg.Host+"/"+serviceName+"/"+method, &body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", contentType+"+proto")
+	r.Header.Set("Te", "trailers")
+	if c.cfg.User != "" {
+		r.SetBasicAuth(c.cfg.User, c.cfg.Pass)
+	}
+
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// readResponse reads a length-prefixed response message.  It returns io.EOF
+// when the response ended before the next message.
+func readResponse(r io.Reader) ([]byte, error) {
+	var header [messageHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated response message")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxResponseSize {
+		return nil, fmt.Errorf("response message of %d bytes is larger "+
+			"than the max of %d", size, maxResponseSize)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("can't read the response message: %v", err)
+	}
+	return msg, nil
+}
+
+// responseStatus returns the status of the call in the trailers of the
+// response, which must have been read, as an *Error.  It returns io.EOF when
+// the call succeeded.
+func responseStatus(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// Calls that fail right away only send headers.
+		status = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status %q", status)
+	}
+	if Code(code) == CodeOK {
+		return io.EOF
+	}
+	if decoded, err := url.PathUnescape(msg); err == nil {
+		msg = decoded
+	}
+	return &Error{Code: Code(code), Message: msg}
+}
@@ -0,0 +1,512 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Message is a protobuf message of the service defined in utreexod.proto.
+type Message interface {
+	// Marshal returns the protobuf encoding of the message.
+	Marshal() []byte
+
+	// Unmarshal decodes the protobuf encoding of the message into the
+	// receiver.  Unknown fields are skipped.
+	Unmarshal(b []byte) error
+}
+
+// BlockNotificationType is the type of a block notification.
+type BlockNotificationType uint32
+
+// Types of the block notifications.
+const (
+	// BlockConnected is sent for blocks connected to the main chain.
+	BlockConnected BlockNotificationType = 0
+
+	// BlockDisconnected is sent for blocks disconnected from the main
+	// chain.
+	BlockDisconnected BlockNotificationType = 1
+)
+
+// GetBestBlockRequest is the request of GetBestBlock.
+type GetBestBlockRequest struct{}
+
+// BestBlock is the tip of the main chain.
+type BestBlock struct {
+	Hash   []byte
+	Height uint32
+}
+
+// BlockRequest picks a block of the main chain either by its hash or, when
+// the hash is nil, by its height.
+type BlockRequest struct {
+	Hash   []byte
+	Height *uint32
+}
+
+// Block is a block of the main chain serialized with its witnesses.
+type Block struct {
+	Hash     []byte
+	Height   uint32
+	RawBlock []byte
+}
+
+// BlockHeader is the serialized header of a block of the main chain.
+type BlockHeader struct {
+	Hash      []byte
+	Height    uint32
+	RawHeader []byte
+}
+
+// UtreexoProof is the serialized utreexo data of a block of the main chain.
+type UtreexoProof struct {
+	Hash     []byte
+	Height   uint32
+	RawProof []byte
+}
+
+// GetUtreexoRootsRequest is the request of GetUtreexoRoots.
+type GetUtreexoRootsRequest struct{}
+
+// UtreexoRoots are the roots of the utreexo accumulator at a block.
+type UtreexoRoots struct {
+	Hash      []byte
+	Height    uint32
+	NumLeaves uint64
+	Roots     [][]byte
+}
+
+// SubscribeBlocksRequest is the request of SubscribeBlocks.
+type SubscribeBlocksRequest struct{}
+
+// BlockNotification is a block connected to or disconnected from the main
+// chain.
+type BlockNotification struct {
+	Type  BlockNotificationType
+	Block *Block
+}
+
+// SubscribeUtreexoRootsRequest is the request of SubscribeUtreexoRoots.
+type SubscribeUtreexoRootsRequest struct{}
+
+// SubscribeReplicationRequest is the request of SubscribeReplication.
+type SubscribeReplicationRequest struct {
+	StartHeight uint32
+}
+
+// ReplicationDelta is a block connected to or disconnected from the main chain
+// along with its utreexo proof and the roots of the utreexo accumulator after
+// it.  The proof is nil when there's no proof index and for disconnected
+// blocks and the roots are nil when they aren't known.
+type ReplicationDelta struct {
+	Type     BlockNotificationType
+	Block    *Block
+	RawProof []byte
+	Roots    *UtreexoRoots
+}
+
+// appendBytes appends the bytes field unless it's empty.
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendVarint appends the varint field unless it's zero.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendMessage appends the embedded message.
+func appendMessage(b []byte, num protowire.Number, m Message) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m.Marshal())
+}
+
+// fieldDecoder decodes the value of the field with the given number and wire
+// type at the start of b and returns its length.  It returns 0 for the fields
+// it doesn't know, which are then skipped.
+type fieldDecoder func(num protowire.Number, typ protowire.Type, b []byte) (int, error)
+
+// unmarshalFields calls decode for every field of the encoded message.
+func unmarshalFields(b []byte, decode fieldDecoder) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := decode(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// skipFields is the decoder of the messages without fields.
+func skipFields(protowire.Number, protowire.Type, []byte) (int, error) {
+	return 0, nil
+}
+
+// consumeBytes decodes a bytes field into v.  The bytes are copied so that v
+// doesn't keep the whole message alive.
+func consumeBytes(num protowire.Number, typ protowire.Type, b []byte,
+	v *[]byte) (int, error) {
+
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("field %d has wire type %d instead of "+
+			"bytes", num, typ)
+	}
+	value, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = append([]byte{}, value...)
+	return n, nil
+}
+
+// consumeMessage decodes an embedded message field into m.
+func consumeMessage(num protowire.Number, typ protowire.Type, b []byte,
+	m Message) (int, error) {
+
+	var encoded []byte
+	n, err := consumeBytes(num, typ, b, &encoded)
+	if err != nil {
+		return n, err
+	}
+	return n, m.Unmarshal(encoded)
+}
+
+// consumeVarint decodes a varint field into v.
+func consumeVarint(num protowire.Number, typ protowire.Type, b []byte,
+	v *uint64) (int, error) {
+
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("field %d has wire type %d instead of "+
+			"varint", num, typ)
+	}
+	value, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = value
+	return n, nil
+}
+
+// consumeUint32 decodes a uint32 field into v.  Like protobuf does, larger
+// values are truncated.
+func consumeUint32(num protowire.Number, typ protowire.Type, b []byte,
+	v *uint32) (int, error) {
+
+	var value uint64
+	n, err := consumeVarint(num, typ, b, &value)
+	*v = uint32(value)
+	return n, err
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *GetBestBlockRequest) Marshal() []byte { return nil }
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *GetBestBlockRequest) Unmarshal(b []byte) error {
+	return unmarshalFields(b, skipFields)
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *BestBlock) Marshal() []byte {
+	b := appendBytes(nil, 1, m.Hash)
+	return appendVarint(b, 2, uint64(m.Height))
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *BestBlock) Unmarshal(b []byte) error {
+	*m = BestBlock{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			return consumeUint32(num, typ, b, &m.Height)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *BlockRequest) Marshal() []byte {
+	// The fields are part of a oneof so the hash is sent even if it's
+	// empty and the height even if it's zero.
+	var b []byte
+	switch {
+	case m.Hash != nil:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Hash)
+	case m.Height != nil:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*m.Height))
+	}
+	return b
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+// Like for any oneof, the last of the hash and the height wins.
+func (m *BlockRequest) Unmarshal(b []byte) error {
+	*m = BlockRequest{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			m.Height = nil
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			m.Hash = nil
+			m.Height = new(uint32)
+			return consumeUint32(num, typ, b, m.Height)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *Block) Marshal() []byte {
+	b := appendBytes(nil, 1, m.Hash)
+	b = appendVarint(b, 2, uint64(m.Height))
+	return appendBytes(b, 3, m.RawBlock)
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *Block) Unmarshal(b []byte) error {
+	*m = Block{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			return consumeUint32(num, typ, b, &m.Height)
+		case 3:
+			return consumeBytes(num, typ, b, &m.RawBlock)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *BlockHeader) Marshal() []byte {
+	b := appendBytes(nil, 1, m.Hash)
+	b = appendVarint(b, 2, uint64(m.Height))
+	return appendBytes(b, 3, m.RawHeader)
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *BlockHeader) Unmarshal(b []byte) error {
+	*m = BlockHeader{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			return consumeUint32(num, typ, b, &m.Height)
+		case 3:
+			return consumeBytes(num, typ, b, &m.RawHeader)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *UtreexoProof) Marshal() []byte {
+	b := appendBytes(nil, 1, m.Hash)
+	b = appendVarint(b, 2, uint64(m.Height))
+	return appendBytes(b, 3, m.RawProof)
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *UtreexoProof) Unmarshal(b []byte) error {
+	*m = UtreexoProof{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			return consumeUint32(num, typ, b, &m.Height)
+		case 3:
+			return consumeBytes(num, typ, b, &m.RawProof)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *GetUtreexoRootsRequest) Marshal() []byte { return nil }
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *GetUtreexoRootsRequest) Unmarshal(b []byte) error {
+	return unmarshalFields(b, skipFields)
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *UtreexoRoots) Marshal() []byte {
+	b := appendBytes(nil, 1, m.Hash)
+	b = appendVarint(b, 2, uint64(m.Height))
+	b = appendVarint(b, 3, m.NumLeaves)
+	for _, root := range m.Roots {
+		// Every element of a repeated field is sent, even if it's
+		// empty.
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, root)
+	}
+	return b
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *UtreexoRoots) Unmarshal(b []byte) error {
+	*m = UtreexoRoots{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			return consumeBytes(num, typ, b, &m.Hash)
+		case 2:
+			return consumeUint32(num, typ, b, &m.Height)
+		case 3:
+			return consumeVarint(num, typ, b, &m.NumLeaves)
+		case 4:
+			var root []byte
+			n, err := consumeBytes(num, typ, b, &root)
+			m.Roots = append(m.Roots, root)
+			return n, err
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *SubscribeBlocksRequest) Marshal() []byte { return nil }
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *SubscribeBlocksRequest) Unmarshal(b []byte) error {
+	return unmarshalFields(b, skipFields)
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *BlockNotification) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Type))
+	if m.Block != nil {
+		b = appendMessage(b, 2, m.Block)
+	}
+	return b
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *BlockNotification) Unmarshal(b []byte) error {
+	*m = BlockNotification{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			var value uint64
+			n, err := consumeVarint(num, typ, b, &value)
+			m.Type = BlockNotificationType(value)
+			return n, err
+		case 2:
+			m.Block = new(Block)
+			return consumeMessage(num, typ, b, m.Block)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *SubscribeUtreexoRootsRequest) Marshal() []byte { return nil }
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *SubscribeUtreexoRootsRequest) Unmarshal(b []byte) error {
+	return unmarshalFields(b, skipFields)
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *SubscribeReplicationRequest) Marshal() []byte {
+	return appendVarint(nil, 1, uint64(m.StartHeight))
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *SubscribeReplicationRequest) Unmarshal(b []byte) error {
+	*m = SubscribeReplicationRequest{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		if num == 1 {
+			return consumeUint32(num, typ, b, &m.StartHeight)
+		}
+		return 0, nil
+	})
+}
+
+// Marshal returns the protobuf encoding of the message.
+func (m *ReplicationDelta) Marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Type))
+	if m.Block != nil {
+		b = appendMessage(b, 2, m.Block)
+	}
+	b = appendBytes(b, 3, m.RawProof)
+	if m.Roots != nil {
+		b = appendMessage(b, 4, m.Roots)
+	}
+	return b
+}
+
+// Unmarshal decodes the protobuf encoding of the message into the receiver.
+func (m *ReplicationDelta) Unmarshal(b []byte) error {
+	*m = ReplicationDelta{}
+	return unmarshalFields(b, func(num protowire.Number, typ protowire.Type,
+		b []byte) (int, error) {
+
+		switch num {
+		case 1:
+			var value uint64
+			n, err := consumeVarint(num, typ, b, &value)
+			m.Type = BlockNotificationType(value)
+			return n, err
+		case 2:
+			m.Block = new(Block)
+			return consumeMessage(num, typ, b, m.Block)
+		case 3:
+			return consumeBytes(num, typ, b, &m.RawProof)
+		case 4:
+			m.Roots = new(UtreexoRoots)
+			return consumeMessage(num, typ, b, m.Roots)
+		}
+		return 0, nil
+	})
+}
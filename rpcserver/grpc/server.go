@@ -0,0 +1,782 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package grpc implements the gRPC API of utreexod that's served alongside the
+// JSON-RPC server.
+//
+// The service is defined in utreexod.proto.  It's served over HTTP/2 with TLS
+// and the messages are encoded without generated code so that no gRPC
+// dependencies are needed.  Only uncompressed messages are supported.
+//
+// The package also has a client of the replication stream, which follower
+// nodes use to apply the blocks of a leader without validating them again.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+const (
+	// serviceName is the versioned name of the gRPC service.
+	serviceName = "utreexod.v1.Utreexod"
+
+	// streamBufferSize is how many notifications are buffered for a
+	// stream.  Streams that fall further behind are ended.
+	streamBufferSize = 100
+
+	// shutdownTimeout is how long the calls in progress have to finish
+	// when the server is stopped.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Stream topics.
+const (
+	topicBlocks = iota
+	topicUtreexoRoots
+	topicReplication
+)
+
+// Chain is the chain the service queries.  It's satisfied by
+// *blockchain.BlockChain.
+type Chain interface {
+	BestSnapshot() *blockchain.BestState
+	BlockByHash(hash *chainhash.Hash) (*btcutil.Block, error)
+	BlockHashByHeight(height int32) (*chainhash.Hash, error)
+	BlockHeightByHash(hash *chainhash.Hash) (int32, error)
+	HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error)
+	Subscribe(callback blockchain.NotificationCallback)
+}
+
+// Config is the configuration of the gRPC server.
+type Config struct {
+	// Listeners are the listeners the service is served on with TLS.
+	Listeners []net.Listener
+
+	// TLSConfig holds the certificate of the server.
+	TLSConfig *tls.Config
+
+	// Chain is the chain the service queries.
+	Chain Chain
+
+	// Authenticate returns an error if the request doesn't carry valid
+	// credentials.  All requests are accepted when it's nil.
+	Authenticate func(r *http.Request) error
+
+	// FetchUtreexoProof returns the utreexo proof of a block of the main
+	// chain.  It's nil when no proofs are available.
+	FetchUtreexoProof func(hash *chainhash.Hash) (*wire.UData, error)
+
+	// FetchUtreexoRoots returns the roots and the number of leaves of the
+	// utreexo accumulator at the given block, which is the tip.  It's nil
+	// when there's no accumulator.
+	FetchUtreexoRoots func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error)
+
+	// MaxProofBytes is the size of the largest utreexo proof that's served.
+	// There's no limit when it's 0.
+	MaxProofBytes int
+
+	// MaxStreams is the max number of streams that may be open at once.
+	MaxStreams int
+}
+
+// unaryHandler handles the request of a method that returns a single message.
+type unaryHandler func(s *Server, req []byte) (Message, error)
+
+// method is a method of the service.  Streaming methods have a nil handler
+// and stream the notifications of their topic.
+type method struct {
+	handler unaryHandler
+	topic   int
+	check   func(s *Server) error
+
+	// replay sends the messages a stream starts with before the
+	// notifications of its topic.  It's nil for the streaming methods
+	// whose requests have no fields.
+	replay func(s *Server, req []byte, send func(Message) error) error
+}
+
+// methods maps the paths of the methods to their implementation.
+var methods = map[string]method{
+	"/" + serviceName + "/GetBestBlock":    {handler: handleGetBestBlock},
+	"/" + serviceName + "/GetBlock":        {handler: handleGetBlock},
+	"/" + serviceName + "/GetBlockHeader":  {handler: handleGetBlockHeader},
+	"/" + serviceName + "/GetUtreexoProof": {handler: handleGetUtreexoProof},
+	"/" + serviceName + "/GetUtreexoRoots": {handler: handleGetUtreexoRoots},
+	"/" + serviceName + "/SubscribeBlocks": {
+		topic: topicBlocks,
+		check: func(*Server) error { return nil },
+	},
+	"/" + serviceName + "/SubscribeUtreexoRoots": {
+		topic: topicUtreexoRoots,
+		check: checkUtreexoRoots,
+	},
+	"/" + serviceName + "/SubscribeReplication": {
+		topic:  topicReplication,
+		check:  func(*Server) error { return nil },
+		replay: replayReplication,
+	},
+}
+
+// stream is an open streaming call.
+type stream struct {
+	topic int
+	msgs  chan []byte
+
+	// overflow is closed when the stream fell too far behind.
+	overflow     chan struct{}
+	overflowOnce sync.Once
+}
+
+// Server serves the gRPC API.
+type Server struct {
+	started  int32
+	shutdown int32
+
+	cfg        Config
+	httpServer *http.Server
+	quit       chan struct{}
+
+	mtx     sync.Mutex
+	streams map[*stream]struct{}
+}
+
+// New returns a gRPC server with the given config.  It's subscribed to the
+// chain right away, but requests are only served once it's started.
+func New(cfg *Config) (*Server, error) {
+	if cfg.TLSConfig == nil {
+		return nil, errors.New("the gRPC server requires TLS")
+	}
+
+	s := Server{
+		cfg:     *cfg,
+		quit:    make(chan struct{}),
+		streams: make(map[*stream]struct{}),
+	}
+	s.httpServer = &http.Server{
+		Handler:           &s,
+		TLSConfig:         cfg.TLSConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.cfg.Chain.Subscribe(s.handleBlockchainNotification)
+	return &s, nil
+}
+
+// Start starts serving the requests on the listeners.
+func (s *Server) Start() {
+	// Already started?
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	for _, listener := range s.cfg.Listeners {
+		log.Infof("gRPC server listening on %s", listener.Addr())
+		go func(listener net.Listener) {
+			err := s.httpServer.ServeTLS(listener, "", "")
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("gRPC server on %s stopped: %v",
+					listener.Addr(), err)
+			}
+		}(listener)
+	}
+}
+
+// Stop ends the open streams and closes the listeners and the connections once
+// the calls in progress are done or the shutdown timeout passed.
+func (s *Server) Stop() {
+	// Already stopped?
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		log.Infof("gRPC server is already in the process of shutting down")
+		return
+	}
+
+	close(s.quit)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
+	}
+	for _, listener := range s.cfg.Listeners {
+		listener.Close()
+	}
+}
+
+// ServeHTTP serves a gRPC call.  This is part of the http.Handler interface
+// implementation.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2",
+			http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), contentType) {
+		http.Error(w, "unsupported content type",
+			http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	m, ok := methods[r.URL.Path]
+	if !ok {
+		writeStatus(w, errorf(CodeUnimplemented, "unknown method %s",
+			r.URL.Path))
+		return
+	}
+	if s.cfg.Authenticate != nil {
+		if err := s.cfg.Authenticate(r); err != nil {
+			writeStatus(w, errorf(CodeUnauthenticated, "%v", err))
+			return
+		}
+	}
+	if encoding := r.Header.Get("Grpc-Encoding"); encoding != "" &&
+		encoding != "identity" {
+
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+		writeStatus(w, errorf(CodeUnimplemented, "compression %q isn't "+
+			"supported", encoding))
+		return
+	}
+
+	req, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+
+	if m.handler == nil {
+		writeStatus(w, s.serveStream(w, r, m, req))
+		return
+	}
+	resp, err := m.handler(s, req)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+	if err := writeMessage(w, resp.Marshal()); err != nil {
+		log.Debugf("Unable to write the response of %s: %v",
+			r.URL.Path, err)
+	}
+	writeStatus(w, nil)
+}
+
+// serveStream sends the notifications of the topic of the method until the
+// client goes away or the server is stopped.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request,
+	m method, req []byte) error {
+
+	// The requests of the streams without a replay have no fields.
+	if m.replay == nil {
+		if err := unmarshalFields(req, skipFields); err != nil {
+			return errorf(CodeInvalidArgument, "invalid request: %v",
+				err)
+		}
+	}
+	if err := m.check(s); err != nil {
+		return err
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errorf(CodeInternal, "streaming isn't supported")
+	}
+
+	st := &stream{
+		topic:    m.topic,
+		msgs:     make(chan []byte, streamBufferSize),
+		overflow: make(chan struct{}),
+	}
+	s.mtx.Lock()
+	if len(s.streams) >= s.cfg.MaxStreams {
+		s.mtx.Unlock()
+		return errorf(CodeResourceExhausted, "too many open streams")
+	}
+	s.streams[st] = struct{}{}
+	s.mtx.Unlock()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.streams, st)
+		s.mtx.Unlock()
+	}()
+
+	// Send the headers right away so the client knows the stream is open.
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// The notifications are queued while the replay is sent since the
+	// stream is already registered, so none are missed.
+	if m.replay != nil {
+		err := m.replay(s, req, func(msg Message) error {
+			if err := s.streamEnded(r, st); err != nil {
+				return err
+			}
+			if err := writeMessage(w, msg.Marshal()); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case msg := <-st.msgs:
+			if err := writeMessage(w, msg); err != nil {
+				return err
+			}
+			flusher.Flush()
+
+		case <-st.overflow:
+			return errStreamOverflow
+
+		case <-r.Context().Done():
+			return errStreamCanceled
+
+		case <-s.quit:
+			return errServerShutdown
+		}
+	}
+}
+
+// Errors that end a stream.
+var (
+	errStreamOverflow = errorf(CodeResourceExhausted, "the stream fell "+
+		"too far behind")
+	errStreamCanceled = errorf(CodeCanceled, "the stream was canceled")
+	errServerShutdown = errorf(CodeUnavailable, "the server is shutting "+
+		"down")
+)
+
+// streamEnded returns the error that ends the stream if it fell too far
+// behind, was canceled or the server is shutting down.
+func (s *Server) streamEnded(r *http.Request, st *stream) error {
+	select {
+	case <-st.overflow:
+		return errStreamOverflow
+	case <-r.Context().Done():
+		return errStreamCanceled
+	case <-s.quit:
+		return errServerShutdown
+	default:
+		return nil
+	}
+}
+
+// hasStreams returns whether there are open streams of the topic.
+func (s *Server) hasStreams(topic int) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for st := range s.streams {
+		if st.topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyStreams sends the message to the open streams of the topic.
+func (s *Server) notifyStreams(topic int, msg Message) {
+	encoded := msg.Marshal()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for st := range s.streams {
+		if st.topic != topic {
+			continue
+		}
+		select {
+		case st.msgs <- encoded:
+		default:
+			st.overflowOnce.Do(func() { close(st.overflow) })
+		}
+	}
+}
+
+// handleBlockchainNotification sends the blocks connected to and disconnected
+// from the main chain and the utreexo roots whenever the tip changes to the
+// open streams.
+func (s *Server) handleBlockchainNotification(notification *blockchain.Notification) {
+	var (
+		notificationType BlockNotificationType
+		tipHash          *chainhash.Hash
+		tipHeight        int32
+	)
+	block, ok := notification.Data.(*btcutil.Block)
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		if !ok {
+			log.Warnf("Chain connected notification is not a block.")
+			return
+		}
+		notificationType = BlockConnected
+		tipHash, tipHeight = block.Hash(), block.Height()
+
+	case blockchain.NTBlockDisconnected:
+		if !ok {
+			log.Warnf("Chain disconnected notification is not a block.")
+			return
+		}
+		notificationType = BlockDisconnected
+		tipHash = &block.MsgBlock().Header.PrevBlock
+		tipHeight = block.Height() - 1
+
+	default:
+		return
+	}
+
+	if s.hasStreams(topicBlocks) {
+		msg, err := newBlock(block.Hash(), block.Height(), block.MsgBlock())
+		if err != nil {
+			log.Errorf("Can't serialize block %v: %v", block.Hash(), err)
+		} else {
+			s.notifyStreams(topicBlocks, &BlockNotification{
+				Type:  notificationType,
+				Block: msg,
+			})
+		}
+	}
+
+	if s.hasStreams(topicReplication) {
+		msg, err := s.replicationDelta(notificationType, block, tipHash,
+			tipHeight)
+		if err != nil {
+			log.Errorf("Can't create the replication delta of block "+
+				"%v: %v", block.Hash(), err)
+		} else {
+			s.notifyStreams(topicReplication, msg)
+		}
+	}
+
+	if s.cfg.FetchUtreexoRoots != nil && s.hasStreams(topicUtreexoRoots) {
+		msg, err := s.utreexoRoots(tipHash, tipHeight)
+		if err != nil {
+			log.Errorf("Can't fetch the utreexo roots at block %v: %v",
+				tipHash, err)
+			return
+		}
+		s.notifyStreams(topicUtreexoRoots, msg)
+	}
+}
+
+// replicationDelta returns the replication delta of the block.  The roots at
+// the tip are included when tipHash isn't nil and they're known.
+func (s *Server) replicationDelta(notificationType BlockNotificationType,
+	block *btcutil.Block, tipHash *chainhash.Hash,
+	tipHeight int32) (*ReplicationDelta, error) {
+
+	msg, err := newBlock(block.Hash(), block.Height(), block.MsgBlock())
+	if err != nil {
+		return nil, err
+	}
+	delta := &ReplicationDelta{Type: notificationType, Block: msg}
+
+	// Followers only need the proofs of the blocks they connect.  The
+	// genesis block never has one.
+	if notificationType == BlockConnected && block.Height() > 0 &&
+		s.cfg.FetchUtreexoProof != nil {
+
+		udata, err := s.cfg.FetchUtreexoProof(block.Hash())
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.Grow(udata.SerializeSize())
+		if err := udata.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		delta.RawProof = buf.Bytes()
+	}
+
+	if tipHash != nil && s.cfg.FetchUtreexoRoots != nil {
+		roots, err := s.utreexoRoots(tipHash, tipHeight)
+		if err != nil {
+			// The tip may have changed since so the roots are
+			// left out.
+			log.Debugf("Can't fetch the utreexo roots at block %v: %v",
+				tipHash, err)
+		} else {
+			delta.Roots = roots
+		}
+	}
+	return delta, nil
+}
+
+// newBlock returns the block message of the block serialized with its
+// witnesses, but without its utreexo proof.
+func newBlock(hash *chainhash.Hash, height int32, block *wire.MsgBlock) (*Block, error) {
+	var buf bytes.Buffer
+	buf.Grow(block.SerializeSize())
+	if err := block.BtcEncode(&buf, 0, wire.WitnessEncoding); err != nil {
+		return nil, err
+	}
+	return &Block{
+		Hash:     hash.CloneBytes(),
+		Height:   uint32(height),
+		RawBlock: buf.Bytes(),
+	}, nil
+}
+
+// utreexoRoots returns the utreexo roots message of the roots at the block.
+func (s *Server) utreexoRoots(hash *chainhash.Hash, height int32) (*UtreexoRoots, error) {
+	roots, numLeaves, err := s.cfg.FetchUtreexoRoots(hash)
+	if err != nil {
+		return nil, err
+	}
+	msg := &UtreexoRoots{
+		Hash:      hash.CloneBytes(),
+		Height:    uint32(height),
+		NumLeaves: numLeaves,
+		Roots:     make([][]byte, 0, len(roots)),
+	}
+	for _, root := range roots {
+		msg.Roots = append(msg.Roots, root.CloneBytes())
+	}
+	return msg, nil
+}
+
+// lookupBlock returns the hash and height of the requested block of the main
+// chain.
+func (s *Server) lookupBlock(req []byte) (*chainhash.Hash, int32, error) {
+	var r BlockRequest
+	if err := r.Unmarshal(req); err != nil {
+		return nil, 0, errorf(CodeInvalidArgument, "invalid request: %v",
+			err)
+	}
+
+	switch {
+	case r.Hash != nil:
+		hash, err := chainhash.NewHash(r.Hash)
+		if err != nil {
+			return nil, 0, errorf(CodeInvalidArgument, "%v", err)
+		}
+		height, err := s.cfg.Chain.BlockHeightByHash(hash)
+		if err != nil {
+			return nil, 0, errorf(CodeNotFound, "block %v is not in "+
+				"the main chain", hash)
+		}
+		return hash, height, nil
+
+	case r.Height != nil:
+		if *r.Height > math.MaxInt32 {
+			return nil, 0, errorf(CodeInvalidArgument, "height %d is "+
+				"out of range", *r.Height)
+		}
+		height := int32(*r.Height)
+		hash, err := s.cfg.Chain.BlockHashByHeight(height)
+		if err != nil {
+			return nil, 0, errorf(CodeNotFound, "no block at height "+
+				"%d in the main chain", height)
+		}
+		return hash, height, nil
+	}
+
+	return nil, 0, errorf(CodeInvalidArgument, "either the hash or the "+
+		"height of the block is required")
+}
+
+// replayReplication sends the replication deltas of the blocks of the main
+// chain from the requested start height up to the tip.  Only the delta of the
+// tip carries the roots since they're only known at the tip.
+func replayReplication(s *Server, req []byte, send func(Message) error) error {
+	var r SubscribeReplicationRequest
+	if err := r.Unmarshal(req); err != nil {
+		return errorf(CodeInvalidArgument, "invalid request: %v", err)
+	}
+	if r.StartHeight > math.MaxInt32 {
+		return errorf(CodeInvalidArgument, "height %d is out of range",
+			r.StartHeight)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	for height := int32(r.StartHeight); height <= best.Height; height++ {
+		// The blocks are looked up by height so a reorg while they're
+		// sent ends the stream and the client starts over.
+		hash, err := s.cfg.Chain.BlockHashByHeight(height)
+		if err != nil {
+			return errorf(CodeUnavailable, "no block at height %d in "+
+				"the main chain", height)
+		}
+		block, err := s.cfg.Chain.BlockByHash(hash)
+		if err != nil {
+			log.Errorf("Unable to fetch block %v: %v", hash, err)
+			return errorf(CodeInternal, "failed to fetch block %v",
+				hash)
+		}
+		block.SetHeight(height)
+
+		var tipHash *chainhash.Hash
+		if height == best.Height {
+			tipHash = hash
+		}
+		msg, err := s.replicationDelta(BlockConnected, block, tipHash,
+			height)
+		if err != nil {
+			log.Errorf("Unable to create the replication delta of "+
+				"block %v: %v", hash, err)
+			return errorf(CodeInternal, "failed to create the "+
+				"replication delta of block %v", hash)
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUtreexoRoots returns an error if there are no utreexo roots to serve.
+func checkUtreexoRoots(s *Server) error {
+	if s.cfg.FetchUtreexoRoots == nil {
+		return errorf(CodeFailedPrecondition, "utreexo roots require "+
+			"the utreexo proof index, the flat utreexo proof index or "+
+			"--noutreexo disabled")
+	}
+	return nil
+}
+
+// handleGetBestBlock implements the GetBestBlock method.
+func handleGetBestBlock(s *Server, req []byte) (Message, error) {
+	var r GetBestBlockRequest
+	if err := r.Unmarshal(req); err != nil {
+		return nil, errorf(CodeInvalidArgument, "invalid request: %v", err)
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	return &BestBlock{
+		Hash:   best.Hash.CloneBytes(),
+		Height: uint32(best.Height),
+	}, nil
+}
+
+// handleGetBlock implements the GetBlock method.
+func handleGetBlock(s *Server, req []byte) (Message, error) {
+	hash, height, err := s.lookupBlock(req)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := s.cfg.Chain.BlockByHash(hash)
+	if err != nil {
+		log.Errorf("Unable to fetch block %v: %v", hash, err)
+		return nil, errorf(CodeInternal, "failed to fetch block %v", hash)
+	}
+	msg, err := newBlock(hash, height, block.MsgBlock())
+	if err != nil {
+		log.Errorf("Unable to serialize block %v: %v", hash, err)
+		return nil, errorf(CodeInternal, "failed to serialize block %v",
+			hash)
+	}
+	return msg, nil
+}
+
+// handleGetBlockHeader implements the GetBlockHeader method.
+func handleGetBlockHeader(s *Server, req []byte) (Message, error) {
+	hash, height, err := s.lookupBlock(req)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := s.cfg.Chain.HeaderByHash(hash)
+	if err != nil {
+		log.Errorf("Unable to fetch the header of block %v: %v", hash, err)
+		return nil, errorf(CodeInternal, "failed to fetch the header of "+
+			"block %v", hash)
+	}
+	var buf bytes.Buffer
+	if err := header.Serialize(&buf); err != nil {
+		return nil, errorf(CodeInternal, "failed to serialize the header "+
+			"of block %v", hash)
+	}
+	return &BlockHeader{
+		Hash:      hash.CloneBytes(),
+		Height:    uint32(height),
+		RawHeader: buf.Bytes(),
+	}, nil
+}
+
+// handleGetUtreexoProof implements the GetUtreexoProof method.
+func handleGetUtreexoProof(s *Server, req []byte) (Message, error) {
+	if s.cfg.FetchUtreexoProof == nil {
+		return nil, errorf(CodeFailedPrecondition, "utreexo proofs "+
+			"require the utreexo proof index or the flat utreexo "+
+			"proof index")
+	}
+	hash, height, err := s.lookupBlock(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The genesis block doesn't spend anything so it never has a proof.
+	if height == 0 {
+		return nil, errorf(CodeNotFound, "the genesis block has no "+
+			"utreexo proof")
+	}
+
+	udata, err := s.cfg.FetchUtreexoProof(hash)
+	if err != nil {
+		log.Errorf("Unable to fetch the utreexo proof of block %v: %v",
+			hash, err)
+		return nil, errorf(CodeInternal, "failed to fetch the utreexo "+
+			"proof of block %v", hash)
+	}
+	size := udata.SerializeSize()
+	if s.cfg.MaxProofBytes > 0 && size > s.cfg.MaxProofBytes {
+		return nil, errorf(CodeResourceExhausted, "utreexo proof of %d "+
+			"bytes is larger than the max of %d", size,
+			s.cfg.MaxProofBytes)
+	}
+	var buf bytes.Buffer
+	buf.Grow(size)
+	if err := udata.Serialize(&buf); err != nil {
+		return nil, errorf(CodeInternal, "failed to serialize the "+
+			"utreexo proof of block %v", hash)
+	}
+	return &UtreexoProof{
+		Hash:     hash.CloneBytes(),
+		Height:   uint32(height),
+		RawProof: buf.Bytes(),
+	}, nil
+}
+
+// handleGetUtreexoRoots implements the GetUtreexoRoots method.
+func handleGetUtreexoRoots(s *Server, req []byte) (Message, error) {
+	var r GetUtreexoRootsRequest
+	if err := r.Unmarshal(req); err != nil {
+		return nil, errorf(CodeInvalidArgument, "invalid request: %v", err)
+	}
+	if err := checkUtreexoRoots(s); err != nil {
+		return nil, err
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	msg, err := s.utreexoRoots(&best.Hash, best.Height)
+	if err != nil {
+		// The tip may have changed since it was looked up so the
+		// client may retry.
+		return nil, errorf(CodeUnavailable, "failed to fetch the "+
+			"utreexo roots at block %v: %v", best.Hash, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,482 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// testChain is a chain made of the mainnet genesis block.
+type testChain struct {
+	genesis  *btcutil.Block
+	callback blockchain.NotificationCallback
+}
+
+func newTestChain() *testChain {
+	genesis := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesis.SetHeight(0)
+	return &testChain{genesis: genesis}
+}
+
+func (c *testChain) BestSnapshot() *blockchain.BestState {
+	return &blockchain.BestState{Hash: *c.genesis.Hash()}
+}
+
+func (c *testChain) BlockByHash(hash *chainhash.Hash) (*btcutil.Block, error) {
+	if *hash != *c.genesis.Hash() {
+		return nil, errors.New("block not found")
+	}
+	return c.genesis, nil
+}
+
+func (c *testChain) BlockHashByHeight(height int32) (*chainhash.Hash, error) {
+	if height != 0 {
+		return nil, errors.New("block not found")
+	}
+	return c.genesis.Hash(), nil
+}
+
+func (c *testChain) BlockHeightByHash(hash *chainhash.Hash) (int32, error) {
+	if *hash != *c.genesis.Hash() {
+		return 0, errors.New("block not found")
+	}
+	return 0, nil
+}
+
+func (c *testChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error) {
+	if *hash != *c.genesis.Hash() {
+		return wire.BlockHeader{}, errors.New("block not found")
+	}
+	return c.genesis.MsgBlock().Header, nil
+}
+
+func (c *testChain) Subscribe(callback blockchain.NotificationCallback) {
+	c.callback = callback
+}
+
+// startTestServer starts a gRPC server for the chain and returns it along with
+// a client that trusts its certificate.
+func startTestServer(t *testing.T, cfg *Config) (*Server, *http.Client, string) {
+	certPEM, keyPEM, err := btcutil.NewTLSCertPair("utreexod test",
+		time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keypair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Listeners = []net.Listener{listener}
+	cfg.TLSConfig = &tls.Config{Certificates: []tls.Certificate{keypair}}
+	if cfg.MaxStreams == 0 {
+		cfg.MaxStreams = 10
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2: true,
+		},
+		Timeout: 10 * time.Second,
+	}
+	return s, client, "https://" + listener.Addr().String()
+}
+
+// call makes a unary call and decodes the response into resp.  It returns the
+// status code of the call.
+func call(t *testing.T, client *http.Client, url, method string, req,
+	resp Message) Code {
+
+	var body bytes.Buffer
+	if err := writeMessage(&body, req.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.NewRequest(http.MethodPost,
+		url+"/"+serviceName+"/"+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", contentType+"+proto")
+	r.Header.Set("Te", "trailers")
+	httpResp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", httpResp.Proto)
+	}
+
+	msg, err := readMessage(httpResp.Body)
+	if err == nil {
+		if err := resp.Unmarshal(msg); err != nil {
+			t.Fatalf("%s: unable to decode response: %v", method, err)
+		}
+	}
+	io.Copy(io.Discard, httpResp.Body)
+	return statusCode(t, httpResp)
+}
+
+// statusCode returns the status code in the trailers of the response, which
+// must have been read.
+func statusCode(t *testing.T, resp *http.Response) Code {
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		t.Fatalf("invalid grpc-status %q", status)
+	}
+	return Code(code)
+}
+
+func TestServerUnary(t *testing.T) {
+	chain := newTestChain()
+	genesisHash := chain.genesis.Hash()
+	rootHash := chainhash.Hash{0xaa}
+	_, client, url := startTestServer(t, &Config{
+		Chain: chain,
+		FetchUtreexoRoots: func(hash *chainhash.Hash) ([]*chainhash.Hash,
+			uint64, error) {
+
+			return []*chainhash.Hash{&rootHash}, 1, nil
+		},
+	})
+
+	var best BestBlock
+	code := call(t, client, url, "GetBestBlock", &GetBestBlockRequest{},
+		&best)
+	if code != CodeOK || !bytes.Equal(best.Hash, genesisHash[:]) ||
+		best.Height != 0 {
+
+		t.Fatalf("unexpected best block %v (code %d)", best, code)
+	}
+
+	// Blocks can be requested by their hash or height.
+	var expected bytes.Buffer
+	chain.genesis.MsgBlock().BtcEncode(&expected, 0, wire.WitnessEncoding)
+	height := uint32(0)
+	requests := []*BlockRequest{
+		{Hash: genesisHash[:]},
+		{Height: &height},
+	}
+	for _, req := range requests {
+		var block Block
+		code = call(t, client, url, "GetBlock", req, &block)
+		if code != CodeOK || !bytes.Equal(block.Hash, genesisHash[:]) ||
+			!bytes.Equal(block.RawBlock, expected.Bytes()) {
+
+			t.Fatalf("unexpected block for request %v (code %d)",
+				req, code)
+		}
+
+		var header BlockHeader
+		code = call(t, client, url, "GetBlockHeader", req, &header)
+		if code != CodeOK ||
+			!bytes.Equal(header.RawHeader, expected.Bytes()[:80]) {
+
+			t.Fatalf("unexpected header for request %v (code %d)",
+				req, code)
+		}
+	}
+
+	var roots UtreexoRoots
+	code = call(t, client, url, "GetUtreexoRoots", &GetUtreexoRootsRequest{},
+		&roots)
+	if code != CodeOK || roots.NumLeaves != 1 || len(roots.Roots) != 1 ||
+		!bytes.Equal(roots.Roots[0], rootHash[:]) {
+
+		t.Fatalf("unexpected roots %v (code %d)", roots, code)
+	}
+
+	// Errors are reported with their status code.
+	otherHeight := uint32(1)
+	tests := []struct {
+		method string
+		req    Message
+		code   Code
+	}{
+		{"GetBlock", &BlockRequest{}, CodeInvalidArgument},
+		{"GetBlock", &BlockRequest{Hash: []byte{1}}, CodeInvalidArgument},
+		{"GetBlock", &BlockRequest{Height: &otherHeight}, CodeNotFound},
+		{"GetBlock", &BlockRequest{Hash: make([]byte, 32)}, CodeNotFound},
+		{"GetUtreexoProof", &BlockRequest{Height: &height},
+			CodeFailedPrecondition},
+		{"GetMempool", &GetBestBlockRequest{}, CodeUnimplemented},
+	}
+	for _, test := range tests {
+		code := call(t, client, url, test.method, test.req, &Block{})
+		if code != test.code {
+			t.Fatalf("%s %v: expected code %d, got %d", test.method,
+				test.req, test.code, code)
+		}
+	}
+}
+
+func TestServerAuthenticate(t *testing.T) {
+	_, client, url := startTestServer(t, &Config{
+		Chain: newTestChain(),
+		Authenticate: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "secret" {
+				return fmt.Errorf("invalid credentials")
+			}
+			return nil
+		},
+	})
+
+	code := call(t, client, url, "GetBestBlock", &GetBestBlockRequest{},
+		&BestBlock{})
+	if code != CodeUnauthenticated {
+		t.Fatalf("expected code %d, got %d", CodeUnauthenticated, code)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	chain := newTestChain()
+	s, client, url := startTestServer(t, &Config{Chain: chain})
+
+	var body bytes.Buffer
+	writeMessage(&body, (&SubscribeBlocksRequest{}).Marshal())
+	r, err := http.NewRequest(http.MethodPost,
+		url+"/"+serviceName+"/SubscribeBlocks", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The headers are only sent once the stream is registered.
+	if !s.hasStreams(topicBlocks) {
+		t.Fatal("expected the stream to be open")
+	}
+	block := btcutil.NewBlock(chaincfg.TestNet3Params.GenesisBlock)
+	block.SetHeight(1)
+	chain.callback(&blockchain.Notification{
+		Type: blockchain.NTBlockConnected,
+		Data: block,
+	})
+	chain.callback(&blockchain.Notification{
+		Type: blockchain.NTBlockDisconnected,
+		Data: block,
+	})
+
+	for _, want := range []BlockNotificationType{BlockConnected,
+		BlockDisconnected} {
+
+		msg, err := readMessage(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var notification BlockNotification
+		if err := notification.Unmarshal(msg); err != nil {
+			t.Fatal(err)
+		}
+		if notification.Type != want || notification.Block == nil ||
+			!bytes.Equal(notification.Block.Hash, block.Hash()[:]) ||
+			notification.Block.Height != 1 {
+
+			t.Fatalf("unexpected notification %v", notification)
+		}
+	}
+
+	// The roots can't be streamed without an accumulator.
+	code := call(t, client, url, "SubscribeUtreexoRoots",
+		&SubscribeUtreexoRootsRequest{}, &UtreexoRoots{})
+	if code != CodeFailedPrecondition {
+		t.Fatalf("expected code %d, got %d", CodeFailedPrecondition, code)
+	}
+
+	// Stopping the server ends the stream.
+	s.Stop()
+	io.Copy(io.Discard, resp.Body)
+	if code := statusCode(t, resp); code != CodeUnavailable {
+		t.Fatalf("expected code %d, got %d", CodeUnavailable, code)
+	}
+}
+
+func TestServerReplication(t *testing.T) {
+	chain := newTestChain()
+	rootHash := chainhash.Hash{0xaa}
+	s, httpClient, url := startTestServer(t, &Config{
+		Chain: chain,
+		FetchUtreexoProof: func(hash *chainhash.Hash) (*wire.UData, error) {
+			return &wire.UData{}, nil
+		},
+		FetchUtreexoRoots: func(hash *chainhash.Hash) ([]*chainhash.Hash,
+			uint64, error) {
+
+			return []*chainhash.Hash{&rootHash}, 1, nil
+		},
+	})
+	client := NewClient(&ClientConfig{
+		Host:      strings.TrimPrefix(url, "https://"),
+		TLSConfig: httpClient.Transport.(*http.Transport).TLSClientConfig,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start heights that don't fit a block height are rejected.
+	stream, err := client.SubscribeReplication(ctx, math.MaxInt32+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	var statusErr *Error
+	if !errors.As(err, &statusErr) || statusErr.Code != CodeInvalidArgument {
+		t.Fatalf("expected code %d, got %v", CodeInvalidArgument, err)
+	}
+	stream.Close()
+
+	// The stream starts with the blocks up to the tip, which is the only
+	// one sent with the roots, and goes on with the connected blocks.
+	stream, err = client.SubscribeReplication(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	delta, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisHash := chain.genesis.Hash()
+	if delta.Type != BlockConnected || delta.Block == nil ||
+		!bytes.Equal(delta.Block.Hash, genesisHash[:]) ||
+		delta.RawProof != nil || delta.Roots == nil ||
+		!bytes.Equal(delta.Roots.Hash, genesisHash[:]) {
+
+		t.Fatalf("unexpected delta %v", delta)
+	}
+
+	block := btcutil.NewBlock(chaincfg.TestNet3Params.GenesisBlock)
+	block.SetHeight(1)
+	chain.callback(&blockchain.Notification{
+		Type: blockchain.NTBlockConnected,
+		Data: block,
+	})
+	chain.callback(&blockchain.Notification{
+		Type: blockchain.NTBlockDisconnected,
+		Data: block,
+	})
+
+	delta, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var udata wire.UData
+	err = udata.Deserialize(bytes.NewReader(delta.RawProof))
+	if err != nil || delta.Type != BlockConnected ||
+		delta.Block.Height != 1 || delta.Roots == nil ||
+		!bytes.Equal(delta.Roots.Hash, block.Hash()[:]) ||
+		!bytes.Equal(delta.Roots.Roots[0], rootHash[:]) {
+
+		t.Fatalf("unexpected delta %v: %v", delta, err)
+	}
+
+	// Disconnected blocks come without a proof and with the roots at
+	// their parent.
+	delta, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := block.MsgBlock().Header.PrevBlock
+	if delta.Type != BlockDisconnected || delta.RawProof != nil ||
+		delta.Roots == nil || !bytes.Equal(delta.Roots.Hash, parent[:]) ||
+		delta.Roots.Height != 0 {
+
+		t.Fatalf("unexpected delta %v", delta)
+	}
+
+	// Stopping the server ends the stream with its status.
+	s.Stop()
+	_, err = stream.Recv()
+	if !errors.As(err, &statusErr) || statusErr.Code != CodeUnavailable {
+		t.Fatalf("expected code %d, got %v", CodeUnavailable, err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	height := uint32(0)
+	tests := []struct {
+		msg   Message
+		empty Message
+	}{
+		{&BestBlock{Hash: []byte{1, 2}, Height: 7}, &BestBlock{}},
+		{&BlockRequest{Hash: []byte{}}, &BlockRequest{}},
+		{&BlockRequest{Height: &height}, &BlockRequest{}},
+		{&Block{Hash: []byte{1}, Height: 1, RawBlock: []byte{2}}, &Block{}},
+		{&BlockHeader{Hash: []byte{1}, RawHeader: []byte{2}},
+			&BlockHeader{}},
+		{&UtreexoProof{Height: 3, RawProof: []byte{4}}, &UtreexoProof{}},
+		{&UtreexoRoots{Hash: []byte{1}, NumLeaves: 1 << 40,
+			Roots: [][]byte{{1}, {}, {3}}}, &UtreexoRoots{}},
+		{&BlockNotification{Type: BlockDisconnected,
+			Block: &Block{Height: 9}}, &BlockNotification{}},
+		{&SubscribeReplicationRequest{StartHeight: 5},
+			&SubscribeReplicationRequest{}},
+		{&ReplicationDelta{Type: BlockConnected, Block: &Block{Height: 2},
+			RawProof: []byte{3}, Roots: &UtreexoRoots{NumLeaves: 4}},
+			&ReplicationDelta{}},
+	}
+	for i, test := range tests {
+		encoded := test.msg.Marshal()
+		if err := test.empty.Unmarshal(encoded); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if !bytes.Equal(test.empty.Marshal(), encoded) {
+			t.Fatalf("test %d: expected %v, got %v", i, test.msg,
+				test.empty)
+		}
+	}
+
+	// Unknown fields are skipped and fields of the wrong type are errors.
+	var block Block
+	err := block.Unmarshal([]byte{0x28, 0x01, 0x10, 0x05})
+	if err != nil || block.Height != 5 {
+		t.Fatalf("unexpected block %v: %v", block, err)
+	}
+	if err := block.Unmarshal([]byte{0x0a, 0x05}); err == nil {
+		t.Fatal("expected an error for a truncated field")
+	}
+	if err := block.Unmarshal([]byte{0x08, 0x01}); err == nil {
+		t.Fatal("expected an error for a field of the wrong type")
+	}
+}
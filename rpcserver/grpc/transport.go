@@ -0,0 +1,132 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// contentType is the content type of the gRPC requests and responses.
+	// Requests may also carry a suffix such as +proto.
+	contentType = "application/grpc"
+
+	// messageHeaderSize is the size of the header of the length-prefixed
+	// messages.  It's a flag telling whether the message is compressed
+	// followed by the length of the message as a big endian uint32.
+	messageHeaderSize = 5
+
+	// maxRequestSize is the largest request message that's accepted.  All
+	// the requests are tiny so this is just a sanity limit.
+	maxRequestSize = 1 << 16
+)
+
+// Code is a gRPC status code.
+type Code uint32
+
+// The gRPC status codes that are returned.
+const (
+	CodeOK                 Code = 0
+	CodeCanceled           Code = 1
+	CodeInvalidArgument    Code = 3
+	CodeNotFound           Code = 5
+	CodeResourceExhausted  Code = 8
+	CodeFailedPrecondition Code = 9
+	CodeUnimplemented      Code = 12
+	CodeInternal           Code = 13
+	CodeUnavailable        Code = 14
+	CodeUnauthenticated    Code = 16
+)
+
+// Error is an error with a gRPC status code that's sent back to the client.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *Error) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// errorf returns an Error with the given code and formatted message.
+func errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// readMessage reads a length-prefixed request message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [messageHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errorf(CodeInvalidArgument, "can't read the request "+
+			"message: %v", err)
+	}
+	if header[0] != 0 {
+		return nil, errorf(CodeUnimplemented, "compressed messages "+
+			"aren't supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxRequestSize {
+		return nil, errorf(CodeResourceExhausted, "request message of "+
+			"%d bytes is larger than the max of %d", size,
+			maxRequestSize)
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errorf(CodeInvalidArgument, "can't read the request "+
+			"message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeMessage writes an uncompressed length-prefixed message.
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, messageHeaderSize, messageHeaderSize+len(msg))
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+// writeStatus sets the status of the call in the trailers of the response.
+// Errors that aren't an Error are sent as internal errors.
+func writeStatus(w http.ResponseWriter, err error) {
+	status := &Error{Code: CodeOK}
+	if err != nil {
+		var ok bool
+		status, ok = err.(*Error)
+		if !ok {
+			status = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+	}
+
+	header := w.Header()
+	header.Set(http.TrailerPrefix+"Grpc-Status",
+		strconv.FormatUint(uint64(status.Code), 10))
+	if status.Message != "" {
+		header.Set(http.TrailerPrefix+"Grpc-Message",
+			encodeStatusMessage(status.Message))
+	}
+}
+
+// encodeStatusMessage percent-encodes the status message the way gRPC
+// requires so that it's a valid header value.
+func encodeStatusMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/stretchr/testify/require"
+	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/btcjson"
 	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/mempool"
+	"github.com/utreexo/utreexod/txscript"
+	"github.com/utreexo/utreexod/wire"
 )
 
 // TestHandleTestMempoolAcceptFailDecode checks that when invalid hex string is
@@ -46,7 +52,7 @@ func TestHandleTestMempoolAcceptFailDecode(t *testing.T) {
 			t.Parallel()
 
 			// Create a request that uses invalid raw txns.
-			cmd := btcjson.NewTestMempoolAcceptCmd(tc.txns, 0)
+			cmd := btcjson.NewTestMempoolAcceptCmd(tc.txns, 0, nil)
 
 			// Call the method under test.
 			closeChan := make(chan struct{})
@@ -95,6 +101,32 @@ var (
 		"1ad504b88ac00000000"
 )
 
+// TestHandleTestMempoolAcceptProofCount checks that an error is returned when
+// the number of proofs doesn't match the number of raw txns.
+func TestHandleTestMempoolAcceptProofCount(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	// Create a testing server.
+	s := &rpcServer{}
+
+	proofs := []string{"00", "00"}
+	cmd := btcjson.NewTestMempoolAcceptCmd([]string{txHex1}, 0, &proofs)
+
+	closeChan := make(chan struct{})
+	result, err := handleTestMempoolAccept(s, cmd, closeChan)
+
+	// Ensure the expected error is returned.
+	require.Error(err)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	require.True(ok)
+	require.Equal(btcjson.ErrRPCInvalidParameter, rpcErr.Code)
+
+	// No result should be returned.
+	require.Nil(result)
+}
+
 // decodeTxHex decodes the given hex string into a transaction.
 func decodeTxHex(t *testing.T, txHex string) *btcutil.Tx {
 	rawBytes, err := hex.DecodeString(txHex)
@@ -133,7 +165,7 @@ func TestHandleTestMempoolAcceptMixedResults(t *testing.T) {
 	// We now mock the first call to `CheckMempoolAcceptance` to return an
 	// error.
 	dummyErr := errors.New("dummy error")
-	mm.On("CheckMempoolAcceptance", tx1).Return(nil, dummyErr).Once()
+	mm.On("CheckMempoolAcceptance", tx1, (*wire.UData)(nil)).Return(nil, dummyErr).Once()
 
 	// Since the call failed, we expect the first result to give us the
 	// error.
@@ -146,7 +178,7 @@ func TestHandleTestMempoolAcceptMixedResults(t *testing.T) {
 
 	// We mock the second call to `CheckMempoolAcceptance` to return a
 	// result saying the tx is missing inputs.
-	mm.On("CheckMempoolAcceptance", tx2).Return(
+	mm.On("CheckMempoolAcceptance", tx2, (*wire.UData)(nil)).Return(
 		&mempool.MempoolAcceptResult{
 			MissingParents: []*chainhash.Hash{},
 		}, nil,
@@ -163,7 +195,7 @@ func TestHandleTestMempoolAcceptMixedResults(t *testing.T) {
 	// We mock the third call to `CheckMempoolAcceptance` to return a
 	// result saying the tx allowed.
 	const feeSats = btcutil.Amount(1000)
-	mm.On("CheckMempoolAcceptance", tx3).Return(
+	mm.On("CheckMempoolAcceptance", tx3, (*wire.UData)(nil)).Return(
 		&mempool.MempoolAcceptResult{
 			TxFee:  feeSats,
 			TxSize: 100,
@@ -184,7 +216,7 @@ func TestHandleTestMempoolAcceptMixedResults(t *testing.T) {
 
 	// Create a mock request with default max fee rate of 0.1 BTC/KvB.
 	cmd := btcjson.NewTestMempoolAcceptCmd(
-		[]string{txHex1, txHex2, txHex3}, 0.1,
+		[]string{txHex1, txHex2, txHex3}, 0.1, nil,
 	)
 
 	// Call the method handler and assert the expected results are
@@ -198,6 +230,66 @@ func TestHandleTestMempoolAcceptMixedResults(t *testing.T) {
 	mm.AssertExpectations(t)
 }
 
+// TestHandleTestMempoolAcceptReplacement checks that the transactions a
+// replacement would evict are reported.
+func TestHandleTestMempoolAcceptReplacement(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	// Create a mock mempool.
+	mm := &mempool.MockTxMempool{}
+
+	// Create a testing server with the mock mempool.
+	s := &rpcServer{cfg: rpcserverConfig{
+		TxMemPool: mm,
+	}}
+
+	tx1 := decodeTxHex(t, txHex1)
+	tx2 := decodeTxHex(t, txHex2)
+	tx3 := decodeTxHex(t, txHex3)
+
+	// We mock the call to `CheckMempoolAcceptance` to return a result
+	// saying the tx replaces two transactions.
+	const feeSats = btcutil.Amount(1000)
+	mm.On("CheckMempoolAcceptance", tx1, (*wire.UData)(nil)).Return(
+		&mempool.MempoolAcceptResult{
+			TxFee:  feeSats,
+			TxSize: 100,
+			Conflicts: map[chainhash.Hash]*btcutil.Tx{
+				*tx2.Hash(): tx2,
+				*tx3.Hash(): tx3,
+			},
+		}, nil,
+	).Once()
+
+	// The replaced transactions are reported in a deterministic order.
+	replaced := []string{tx2.Hash().String(), tx3.Hash().String()}
+	if replaced[0] > replaced[1] {
+		replaced[0], replaced[1] = replaced[1], replaced[0]
+	}
+	expected := []*btcjson.TestMempoolAcceptResult{{
+		Txid:    tx1.Hash().String(),
+		Wtxid:   tx1.WitnessHash().String(),
+		Allowed: true,
+		Vsize:   100,
+		Fees: &btcjson.TestMempoolAcceptFees{
+			Base:             feeSats.ToBTC(),
+			EffectiveFeeRate: feeSats.ToBTC() * 1e3 / 100,
+		},
+		ReplacedTransactions: replaced,
+	}}
+
+	cmd := btcjson.NewTestMempoolAcceptCmd([]string{txHex1}, 0.1, nil)
+	closeChan := make(chan struct{})
+	results, err := handleTestMempoolAccept(s, cmd, closeChan)
+	require.NoError(err)
+	require.Equal(expected, results)
+
+	// Assert the mocked method is called as expected.
+	mm.AssertExpectations(t)
+}
+
 // TestValidateFeeRate checks that `validateFeeRate` behaves as expected.
 func TestValidateFeeRate(t *testing.T) {
 	t.Parallel()
@@ -360,7 +452,7 @@ func TestHandleTestMempoolAcceptFees(t *testing.T) {
 
 			// We mock the call to `CheckMempoolAcceptance` to
 			// return the result.
-			mm.On("CheckMempoolAcceptance", tx).Return(
+			mm.On("CheckMempoolAcceptance", tx, (*wire.UData)(nil)).Return(
 				&mempool.MempoolAcceptResult{
 					TxFee:  feeSats,
 					TxSize: txSize,
@@ -387,7 +479,7 @@ func TestHandleTestMempoolAcceptFees(t *testing.T) {
 
 			// Create a mock request with specified max fee rate.
 			cmd := btcjson.NewTestMempoolAcceptCmd(
-				[]string{txHex1}, tc.maxFeeRate,
+				[]string{txHex1}, tc.maxFeeRate, nil,
 			)
 
 			// Call the method handler and assert the expected
@@ -411,3 +503,225 @@ func TestHandleTestMempoolAcceptFees(t *testing.T) {
 		})
 	}
 }
+
+// TestCheckProofLimits checks that proofs over the configured number of
+// targets or bytes are refused and that a limit of 0 disables the check.
+func TestCheckProofLimits(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		maxTargets int
+		maxBytes   int
+		targets    int
+		size       int
+		targetsErr bool
+		sizeErr    bool
+	}{
+		{
+			name:       "within limits",
+			maxTargets: 10,
+			maxBytes:   1000,
+			targets:    10,
+			size:       1000,
+		},
+		{
+			name:       "over limits",
+			maxTargets: 10,
+			maxBytes:   1000,
+			targets:    11,
+			size:       1001,
+			targetsErr: true,
+			sizeErr:    true,
+		},
+		{
+			name:    "no limits",
+			targets: 1 << 20,
+			size:    1 << 30,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			s := &rpcServer{cfg: rpcserverConfig{
+				MaxProofTargets: tc.maxTargets,
+				MaxProofBytes:   tc.maxBytes,
+			}}
+
+			err := s.checkProofTargets(tc.targets)
+			require.Equal(tc.targetsErr, err != nil)
+
+			err = s.checkProofSize(tc.size)
+			require.Equal(tc.sizeErr, err != nil)
+		})
+	}
+}
+
+// TestHandleVerifyUtreexoProof checks that proofs are verified against the given
+// roots.
+func TestHandleVerifyUtreexoProof(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	// Build an accumulator and prove one of its leaves.
+	acc := utreexo.NewAccumulator()
+	leaves := make([]utreexo.Leaf, 5)
+	for i := range leaves {
+		leaves[i] = utreexo.Leaf{Hash: utreexo.Hash{byte(i + 1)}}
+	}
+	require.NoError(acc.Modify(leaves, nil, utreexo.Proof{}))
+
+	proven := leaves[2].Hash
+	proof, err := acc.Prove([]utreexo.Hash{proven})
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(wire.BatchProofSerialize(&buf, &proof))
+	proofHex := hex.EncodeToString(buf.Bytes())
+
+	roots := make([]string, 0, len(acc.GetRoots()))
+	for _, root := range acc.GetRoots() {
+		roots = append(roots, hex.EncodeToString(root[:]))
+	}
+
+	testCases := []struct {
+		name      string
+		delHashes []string
+		valid     bool
+	}{
+		{
+			name:      "valid proof",
+			delHashes: []string{hex.EncodeToString(proven[:])},
+			valid:     true,
+		},
+		{
+			name:      "wrong leaf",
+			delHashes: []string{hex.EncodeToString(leaves[3].Hash[:])},
+			valid:     false,
+		},
+	}
+
+	s := &rpcServer{}
+	for _, tc := range testCases {
+		cmd := btcjson.NewVerifyUtreexoProofCmd(roots,
+			acc.GetNumLeaves(), proofHex, tc.delHashes)
+		result, err := handleVerifyUtreexoProof(s, cmd, nil)
+		require.NoError(err, tc.name)
+
+		reply := result.(*btcjson.VerifyUtreexoProofResult)
+		require.Equal(tc.valid, reply.Valid, tc.name)
+		require.Equal(tc.valid, reply.Error == "", tc.name)
+		require.Equal(roots, reply.Roots, tc.name)
+	}
+
+	// Malformed hashes are rejected.
+	cmd := btcjson.NewVerifyUtreexoProofCmd(roots, acc.GetNumLeaves(),
+		proofHex, []string{"abcd"})
+	_, err = handleVerifyUtreexoProof(s, cmd, nil)
+	require.Error(err)
+}
+
+// TestUtxoSetCursor checks that listutxoset cursors decode to what they were
+// encoded from and that malformed ones are rejected.
+func TestUtxoSetCursor(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	snapshot := chainhash.Hash{0x01, 0x02}
+	last := wire.OutPoint{Hash: chainhash.Hash{0x03}, Index: 300}
+	cursor := encodeUtxoSetCursor(&snapshot, &last)
+
+	gotSnapshot, gotAfter, err := decodeUtxoSetCursor(cursor)
+	require.NoError(err)
+	require.Equal(snapshot, *gotSnapshot)
+	require.Equal(last, *gotAfter)
+
+	_, _, err = decodeUtxoSetCursor(cursor[:len(cursor)-2])
+	require.Error(err)
+	_, _, err = decodeUtxoSetCursor("zz" + cursor[2:])
+	require.Error(err)
+}
+
+// TestNewGetIndexInfoResult checks the lag and the backfill progress of indexes
+// behind, at and ahead of the best height.
+func TestNewGetIndexInfoResult(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		height   int32
+		lag      int32
+		progress float64
+	}{
+		{
+			name:     "nothing indexed",
+			height:   -1,
+			lag:      100,
+			progress: 0,
+		},
+		{
+			name:     "halfway",
+			height:   49,
+			lag:      50,
+			progress: 0.5,
+		},
+		{
+			name:     "synced",
+			height:   99,
+			progress: 1,
+		},
+		{
+			name:     "ahead of the fetched best height",
+			height:   100,
+			progress: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			result := newGetIndexInfoResult(tc.lag == 0, tc.height,
+				&chainhash.Hash{}, 99)
+			require.Equal(tc.height, result.BestBlockHeight)
+			require.Equal(tc.lag, result.Lag)
+			require.Equal(tc.progress, result.BackfillProgress)
+		})
+	}
+}
+
+// TestTestUtxoAddress checks that the addresses of the generatetestutxos
+// outputs are of the requested script types.
+func TestTestUtxoAddress(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	privKey, err := btcec.NewPrivateKey()
+	require.NoError(err)
+	params := &chaincfg.RegressionNetParams
+
+	tests := map[string]txscript.ScriptClass{
+		"p2pkh":       txscript.PubKeyHashTy,
+		"p2wpkh":      txscript.WitnessV0PubKeyHashTy,
+		"p2sh-p2wpkh": txscript.ScriptHashTy,
+		"p2tr":        txscript.WitnessV1TaprootTy,
+	}
+	for scriptType, class := range tests {
+		addr, err := testUtxoAddress(scriptType, privKey.PubKey(), params)
+		require.NoError(err)
+		require.True(addr.IsForNet(params))
+
+		pkScript, err := txscript.PayToAddrScript(addr)
+		require.NoError(err)
+		require.Equal(class, txscript.GetScriptClass(pkScript), scriptType)
+	}
+
+	_, err = testUtxoAddress("p2wsh", privKey.PubKey(), params)
+	require.Error(err)
+}
@@ -34,6 +34,18 @@ var helpDescsEnUS = map[string]string{
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// BackupUtreexoStateCmd help.
+	"backuputreexostate--synopsis": "Backs up the utreexo state and the flat files of the enabled utreexo proof index to a new directory while the node keeps running.\n" +
+		"The utreexo state is flushed and checkpointed and the flat files are copied while no blocks are connected so that the backup is consistent. " +
+		"The backup is laid out like the data directory so restoring it is a matter of copying its contents into the data directory of a stopped node. " +
+		"The proofs of --utreexoproofindex are kept in the block database and aren't part of the backup.",
+	"backuputreexostate-destdir": "The absolute path of the directory to back up to.  It must not exist yet",
+
+	// BackupUtreexoStateResult help.
+	"backuputreexostateresult-blockhash": "The hash of the block the backup is at",
+	"backuputreexostateresult-height":    "The height of the block the backup is at",
+	"backuputreexostateresult-paths":     "The paths that were written",
+
 	// BalanceCmd help.
 	"balance--synopsis": "Retrieves the balance from the underlying bdkwallet.",
 
@@ -43,6 +55,14 @@ var helpDescsEnUS = map[string]string{
 	"balanceresult-untrustedpending": "The balance that's part of our public keychain.",
 	"balanceresult-confirmed":        "The confirmed balance.",
 
+	// CompactProofsCmd help.
+	"compactproofs--synopsis": "Drops the proofs and the undo data of the blocks below the prune height from the flat files of the flat utreexo proof index to free up disk space.\n" +
+		"The proofs of the last 288 blocks are always kept. Requires --flatutreexoproofindex",
+	"compactproofs-pruneheight": "The height below which the proofs are dropped. Defaults to the height set by --proofpruneheight or --proofretention",
+
+	// CompactProofsResult help.
+	"compactproofsresult-compactedheight": "The height up to and including which the proofs were dropped",
+
 	// Recipient help.
 	"recipient-amount":  "The amount in satoshis to send to the recipient.",
 	"recipient-address": "The address of the recipient.",
@@ -78,6 +98,36 @@ var helpDescsEnUS = map[string]string{
 	"createrawtransaction-locktime":       "Locktime value; a non-zero value will also locktime-activate the inputs",
 	"createrawtransaction--result0":       "Hex-encoded bytes of the serialized transaction",
 
+	// CreatePsbtCmd help.
+	"createpsbt--synopsis": "Returns a new partially signed transaction (BIP 174) spending the provided inputs and sending to the provided addresses.\n" +
+		"The utxoupdatepsbt command adds the utreexo data of the inputs to the result.",
+	"createpsbt-inputs":         "The inputs to the transaction",
+	"createpsbt-amounts":        "JSON object with the destination addresses as keys and amounts as values",
+	"createpsbt-amounts--key":   "address",
+	"createpsbt-amounts--value": "n.nnn",
+	"createpsbt-amounts--desc":  "The destination address as the key and the amount in BTC as the value",
+	"createpsbt-locktime":       "Locktime value; a non-zero value will also locktime-activate the inputs",
+	"createpsbt--result0":       "Base64-encoded psbt",
+
+	// UtxoUpdatePsbtCmd help.
+	"utxoupdatepsbt--synopsis": "Adds the utreexo leaf data of every input and a proof for all of them to the psbt as proprietary fields.\n" +
+		"Inputs spending witness programs also get their witness utxo.\n" +
+		"Requires the watch only wallet (--watchonlywallet), in which case the inputs must be utxos of the wallet, or a utreexo proof index.",
+	"utxoupdatepsbt-psbt":     "Base64-encoded psbt",
+	"utxoupdatepsbt--result0": "Base64-encoded psbt with the utreexo data of its inputs",
+
+	// FinalizePsbtCmd help.
+	"finalizepsbt--synopsis": "Builds the final input scripts of the psbt from its signatures and extracts the transaction if every input is final.\n" +
+		"Inputs spending p2pkh, p2wpkh, p2sh-p2wpkh and p2tr key path outputs are supported.",
+	"finalizepsbt-psbt":    "Base64-encoded psbt",
+	"finalizepsbt-extract": "Return the transaction instead of the psbt when every input is final",
+
+	// FinalizePsbtResult help.
+	"finalizepsbtresult-psbt":     "Base64-encoded psbt, set when the transaction isn't extracted",
+	"finalizepsbtresult-hex":      "Hex-encoded bytes of the serialized transaction, set when it's extracted",
+	"finalizepsbtresult-proof":    "Hex-encoded bytes of the serialized utreexo proof of the inputs, set when the transaction is extracted and the psbt has the utreexo data of every input",
+	"finalizepsbtresult-complete": "Whether or not every input is final",
+
 	// ScriptSig help.
 	"scriptsig-asm": "Disassembly of the script",
 	"scriptsig-hex": "Hex-encoded bytes of the script",
@@ -141,6 +191,20 @@ var helpDescsEnUS = map[string]string{
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes the utxo set at a block of the main chain to a file in the format of Bitcoin Core's dumptxoutset so that Bitcoin Core nodes can be bootstrapped from it with loadtxoutset.\n" +
+		"The utxo set is rolled back from the tip with the spend journal for heights below the tip. " +
+		"No blocks are connected while the snapshot is written. " +
+		"Bitcoin Core only loads snapshots of the blocks it has assumeutxo data for",
+	"dumptxoutset-path":   "The path of the file to write the snapshot to.  Relative paths are taken from the data directory.  The file must not exist yet",
+	"dumptxoutset-height": "The height of the block to write the utxo set of.  Defaults to the tip",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "The number of unspent outputs written",
+	"dumptxoutsetresult-base_hash":     "The hash of the block the snapshot is of",
+	"dumptxoutsetresult-base_height":   "The height of the block the snapshot is of",
+	"dumptxoutsetresult-path":          "The absolute path of the snapshot file",
+
 	// EstimateFeeCmd help.
 	"estimatefee--synopsis": "Estimate the fee per kilobyte in satoshis " +
 		"required for a transaction to be mined before a certain number of " +
@@ -150,6 +214,18 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee rate needed for a transaction to begin confirmation " +
+		"within conf_target blocks from the transactions seen entering the mempool and getting confirmed.",
+	"estimatesmartfee-conftarget": "Confirmation target in blocks (1 - 1008)",
+	"estimatesmartfee-estimatemode": "The fee estimate mode. Either UNSET, ECONOMICAL or CONSERVATIVE. " +
+		"Conservative estimates use more of the history and respond slower to drops in fee rates",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "Estimated fee rate in BTC/kvB. Not set if no estimate could be made",
+	"estimatesmartfeeresult-errors":  "Errors encountered while making the estimate",
+	"estimatesmartfeeresult-blocks":  "The number of blocks the estimate was made for, which may be lower than conf_target if there's not enough data for it",
+
 	// FreshAddressCmd help.
 	"freshaddress--synopsis": "Returns an address of the next derivation index regardless of if the " +
 		"preivous derivation address has received funds or not.",
@@ -160,6 +236,45 @@ var helpDescsEnUS = map[string]string{
 	"generate-numblocks": "Number of blocks to generate",
 	"generate--result0":  "The hashes, in order, of blocks generated by the call",
 
+	// GenerateBlockCmd help.
+	"generateblock--synopsis": "Generates a block with the given transactions (simnet or regtest only) instead of the ones in the memory pool.\n" +
+		"The utreexo proof of the block is generated when the node only keeps the accumulator or has a utreexo proof index enabled.",
+	"generateblock-output":       "The address the coinbase of the block pays to",
+	"generateblock-transactions": "The transactions of the block in order, each given as the txid of a transaction in the memory pool or as a raw transaction in hex",
+
+	// GenerateBlockResult help.
+	"generateblockresult-hash": "The hash of the generated block",
+
+	// GenerateToAddressCmd help.
+	"generatetoaddress--synopsis": "Generates a set number of blocks paying to the given address (simnet or regtest only) and returns a JSON\n" +
+		" array of their hashes.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address the coinbases of the blocks pay to",
+	"generatetoaddress-maxtries":  "Unused as the blocks are mined until they're solved",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
+	// GenerateTestUtxosCmd help.
+	"generatetestutxos--synopsis": "Creates spendable unspent outputs for testing (regtest or simnet only).\n" +
+		"A block is mined for each output with its coinbase paying to a freshly created key of the output's script type, " +
+		"followed by enough blocks for the coinbases to mature.  The private keys are returned along with the outputs.",
+	"generatetestutxos-count":       "The number of unspent outputs to create (max 1000)",
+	"generatetestutxos-scripttypes": "The script types of the outputs which are used in turn (p2pkh, p2wpkh, p2sh-p2wpkh or p2tr).  Defaults to p2wpkh",
+
+	// GenerateTestUtxosResult help.
+	"generatetestutxosresult-utxos": "The created unspent outputs",
+	"generatetestutxosresult-proof": "The chain tip inclusion proof of the created unspent outputs.  Omitted when no utreexo proof index is enabled",
+
+	// TestUtxoResult help.
+	"testutxoresult-txid":       "The hash of the coinbase transaction of the output",
+	"testutxoresult-vout":       "The index of the output",
+	"testutxoresult-amount":     "The amount of the output in BTC",
+	"testutxoresult-scripttype": "The script type of the output",
+	"testutxoresult-address":    "The address the output pays to",
+	"testutxoresult-pkscript":   "The hex encoded public key script of the output",
+	"testutxoresult-privkey":    "The WIF encoded private key that spends the output",
+	"testutxoresult-blockhash":  "The hash of the block the output was created in",
+	"testutxoresult-height":     "The height of the block the output was created in",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -205,7 +320,7 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockCmd help.
 	"getblock--synopsis":   "Returns information about a block given its hash.",
 	"getblock-hash":        "The hash of the block",
-	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), or as parsed data with parsed transaction data (2) ",
+	"getblock-verbosity":   "Specifies whether the block data should be returned as a hex-encoded string (0), as parsed data with a slice of TXIDs (1), as parsed data with parsed transaction data (2) or as parsed data with parsed transaction data and the decoded utreexo data from a utreexo proof index (3)",
 	"getblock--condition0": "verbosity=0",
 	"getblock--condition1": "verbosity=1",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
@@ -225,6 +340,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-pruneheight":          "The lowest block retained in the current pruned chain",
 	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain",
 	"getblockchaininforesult-size_on_disk":         "The estimated size of the block and undo files on disk",
+	"getblockchaininforesult-warnings":             "Any health warnings such as the tip not advancing",
 	"getblockchaininforesult-initialblockdownload": "Estimate of whether this node is in Initial Block Download mode",
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
@@ -289,7 +405,7 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-versionHex":        "The block version in hexadecimal",
 	"getblockverboseresult-merkleroot":        "Root hash of the merkle tree",
 	"getblockverboseresult-tx":                "The transaction hashes (only when verbosity=1)",
-	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2)",
+	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosity=2 or verbosity=3)",
 	"getblockverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
 	"getblockverboseresult-nonce":             "The block nonce",
 	"getblockverboseresult-bits":              "The bits which represent the block difficulty",
@@ -298,6 +414,22 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 	"getblockverboseresult-strippedsize":      "The size of the block without witness data",
 	"getblockverboseresult-weight":            "The weight of the block",
+	"getblockverboseresult-udata":             "The utreexo data of the block (only when verbosity=3)",
+
+	// UDataResult help.
+	"udataresult-targets":     "The positions in the accumulator of the outputs spent by the block",
+	"udataresult-proofhashes": "The hashes of the accumulator proof of the spent outputs",
+	"udataresult-leafdatas":   "The spent outputs in the order of the inputs that spend them, leaving out the outputs created in the block itself",
+
+	// LeafDataResult help.
+	"leafdataresult-leafhash":   "The hash of the leaf in the accumulator",
+	"leafdataresult-blockhash":  "The hash of the block that created the output",
+	"leafdataresult-txid":       "The hash of the transaction that created the output",
+	"leafdataresult-vout":       "The index of the output in the transaction",
+	"leafdataresult-height":     "The height of the block that created the output",
+	"leafdataresult-iscoinbase": "Whether the output was created by a coinbase transaction",
+	"leafdataresult-amount":     "The value of the output in BTC",
+	"leafdataresult-pkscript":   "The hex-encoded public key script of the output",
 
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
@@ -330,9 +462,34 @@ var helpDescsEnUS = map[string]string{
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
 	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
 
+	// GetBlockScrubInfoCmd help.
+	"getblockscrubinfo--synopsis": "Returns the progress of the background scrubber that reads back the stored blocks and utreexo proofs along with the corruption it found that hasn't been resolved yet.",
+
+	// GetBlockScrubInfoResult help.
+	"getblockscrubinforesult-enabled":        "Whether block scrubbing is enabled with --blockscrubinterval",
+	"getblockscrubinforesult-scrubbing":      "Whether a pass over the blocks is in progress",
+	"getblockscrubinforesult-passes":         "The number of passes finished since the server started",
+	"getblockscrubinforesult-height":         "The height of the block checked last",
+	"getblockscrubinforesult-passstart":      "The time in seconds since 1 Jan 1970 GMT the latest pass started at",
+	"getblockscrubinforesult-passend":        "The time in seconds since 1 Jan 1970 GMT the latest finished pass ended at",
+	"getblockscrubinforesult-blockschecked":  "The number of stored blocks read back since the server started",
+	"getblockscrubinforesult-proofschecked":  "The number of stored utreexo proofs verified since the server started",
+	"getblockscrubinforesult-badblocks":      "The number of corrupted blocks found",
+	"getblockscrubinforesult-repairedblocks": "The number of corrupted blocks replaced with a copy fetched from a peer",
+	"getblockscrubinforesult-badproofs":      "The number of utreexo proofs found that don't verify",
+	"getblockscrubinforesult-issues":         "The corrupted blocks and proofs that haven't been resolved",
+
+	// BlockScrubIssueResult help.
+	"blockscrubissueresult-kind":            "What's corrupted (block or proof)",
+	"blockscrubissueresult-hash":            "The hash of the block",
+	"blockscrubissueresult-height":          "The height of the block",
+	"blockscrubissueresult-error":           "What was found to be wrong",
+	"blockscrubissueresult-found":           "The time in seconds since 1 Jan 1970 GMT the corruption was found at",
+	"blockscrubissueresult-repairrequested": "The time in seconds since 1 Jan 1970 GMT the block was last asked for from a peer (only if it was)",
+
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
-	"templaterequest-capabilities": "List of capabilities",
+	"templaterequest-capabilities": "List of capabilities including 'utreexoproof' to request the utreexo proof of the template (requires --utreexoproofindex or --flatutreexoproofindex)",
 	"templaterequest-longpollid":   "The long poll ID of a job to monitor for expiration; required and valid only for long poll requests ",
 	"templaterequest-sigoplimit":   "Number of signature operations allowed in blocks (this parameter is ignored)",
 	"templaterequest-sizelimit":    "Number of bytes allowed in blocks (this parameter is ignored)",
@@ -376,9 +533,11 @@ var helpDescsEnUS = map[string]string{
 	"getblocktemplateresult-mintime":                    "Minimum allowed time",
 	"getblocktemplateresult-mutable":                    "List of mutations the server explicitly allows",
 	"getblocktemplateresult-noncerange":                 "Two concatenated hex-encoded big-endian 32-bit integers which represent the valid ranges of nonces the miner may scan",
-	"getblocktemplateresult-capabilities":               "List of server capabilities including 'proposal' to indicate support for block proposals",
+	"getblocktemplateresult-capabilities":               "List of server capabilities including 'proposal' to indicate support for block proposals and 'utreexoproof' when the utreexo proof is included",
+	"getblocktemplateresult-utreexoproof":               "Hex-encoded utreexo proof of the outputs spent by the transactions against the roots of the previous block (only with the 'utreexoproof' capability)",
 	"getblocktemplateresult-reject-reason":              "Reason the proposal was invalid as-is (only applies to proposal responses)",
 	"getblocktemplateresult-default_witness_commitment": "The witness commitment itself. Will be populated if the block has witness data",
+	"getblocktemplateresult-signet_challenge":           "Hex-encoded challenge the block solution must satisfy (signet only)",
 	"getblocktemplateresult-weightlimit":                "The current limit on the max allowed weight of a block",
 
 	// GetBlockTemplateCmd help.
@@ -399,6 +558,22 @@ var helpDescsEnUS = map[string]string{
 	// GetChainTipsCmd help.
 	"getchaintips--synopsis": "Returns information about all known tips in the block tree, including the main chain as well as orphaned branches.",
 
+	// GetBootstrapPackageCmd help.
+	"getbootstrappackage--synopsis": "Returns a package that a new utreexo compact state node can start from instead of the genesis block. " +
+		"The package holds the headers up to the block, the roots of the accumulator after it and the utreexo proofs of the last blocks up to it. " +
+		"The roots and the proofs commit to the hashes of the headers and every part along with the whole package is checksummed.",
+	"getbootstrappackage-blockhash": "The hash or the height of the block to start from.  Defaults to the tip",
+	"getbootstrappackage-numproofs": "The number of blocks up to the block to include the utreexo proofs of",
+
+	// GetBootstrapPackageResult help.
+	"getbootstrappackageresult-height":    "The height of the block the package starts from",
+	"getbootstrappackageresult-blockhash": "The hash of the block the package starts from",
+	"getbootstrappackageresult-numleaves": "The number of leaves in the accumulator after the block",
+	"getbootstrappackageresult-rootshash": "The hash of the number of leaves and the roots after the block that --assumeutreexo takes",
+	"getbootstrappackageresult-numproofs": "The number of utreexo proofs in the package",
+	"getbootstrappackageresult-checksum":  "The sha256 of the serialized package",
+	"getbootstrappackageresult-package":   "The hex-encoded serialized package",
+
 	// GetCFilterCmd help.
 	"getcfilter--synopsis":  "Returns a block's committed filter given its hash.",
 	"getcfilter-filtertype": "The type of filter to return (0=regular)",
@@ -411,6 +586,24 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetConformanceVectorsCmd help.
+	"getconformancevectors--synopsis": "Returns the canonical vectors of the conformance chain that's served when --conformance is enabled. " +
+		"Every vector holds a block of the chain along with its utreexo proof and the accumulator state after it.",
+	"getconformancevectors-height": "The height of the only block to return the vector of.  Defaults to all the blocks of the conformance chain",
+
+	// GetConformanceVectorsResult help.
+	"getconformancevectorsresult-network": "The network the conformance chain is on",
+	"getconformancevectorsresult-vectors": "The vectors of the blocks of the conformance chain",
+
+	// ConformanceVectorResult help.
+	"conformancevectorresult-height":    "The height of the block",
+	"conformancevectorresult-blockhash": "The hash of the block",
+	"conformancevectorresult-block":     "The hex-encoded serialized block",
+	"conformancevectorresult-proof":     "The hex-encoded serialized utreexo proof of the block",
+	"conformancevectorresult-roots":     "The roots of the accumulator after the block",
+	"conformancevectorresult-numleaves": "The number of leaves in the accumulator after the block",
+	"conformancevectorresult-rootshash": "The hash of the number of leaves and the roots after the block",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -419,10 +612,61 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDeploymentInfoCmd help.
+	"getdeploymentinfo--synopsis": "Returns the state of the soft-fork deployments at a block of the main chain.",
+	"getdeploymentinfo-blockhash": "The hash of the block to report the deployments at (default: the best block)",
+
+	// GetDeploymentInfoResult help.
+	"getdeploymentinforesult-hash":               "The hash of the block the deployments are reported at",
+	"getdeploymentinforesult-height":             "The height of the block the deployments are reported at",
+	"getdeploymentinforesult-deployments":        "The deployments by name",
+	"getdeploymentinforesult-deployments--key":   "name",
+	"getdeploymentinforesult-deployments--value": "An object describing a deployment",
+	"getdeploymentinforesult-deployments--desc":  "The deployments by name",
+
+	// DeploymentInfo help.
+	"deploymentinfo-type":   "The type of the deployment (buried or bip9)",
+	"deploymentinfo-height": "The height of the first block that enforces the deployment.  Only set for buried deployments and for active bip9 deployments",
+	"deploymentinfo-active": "Whether the deployment is enforced for the block after the reported block",
+	"deploymentinfo-bip9":   "The state of a bip9 deployment",
+
+	// Bip9DeploymentInfo help.
+	"bip9deploymentinfo-bit":                   "The version bit that signals for the deployment",
+	"bip9deploymentinfo-start_time":            "The median time past at which the signalling starts",
+	"bip9deploymentinfo-timeout":               "The median time past at which the deployment fails if it isn't locked in",
+	"bip9deploymentinfo-min_activation_height": "The height before which the deployment can't activate",
+	"bip9deploymentinfo-status":                "The state of the deployment for the reported block (defined, started, lockedin, active or failed)",
+	"bip9deploymentinfo-since":                 "The height of the first block that had the deployment in its current state",
+	"bip9deploymentinfo-status_next":           "The state of the deployment for the block after the reported block",
+	"bip9deploymentinfo-statistics":            "The signalling in the confirmation window of the reported block.  Only set while the deployment is started or locked in",
+
+	// DeploymentStatistics help.
+	"deploymentstatistics-period":    "The number of blocks in a confirmation window",
+	"deploymentstatistics-threshold": "The number of blocks of a confirmation window that have to signal for the deployment to lock in",
+	"deploymentstatistics-elapsed":   "The number of blocks of the confirmation window up to and including the reported block",
+	"deploymentstatistics-count":     "The number of the elapsed blocks that signalled for the deployment",
+	"deploymentstatistics-possible":  "Whether the threshold can still be reached in the confirmation window",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
 
+	// GetDiskUsageCmd help.
+	"getdiskusage--synopsis": "Returns the on-disk size of the block database and the utreexo indexes along with their growth rates forecasted over a trailing window.  The sizes are from the latest periodic sample and not measured on every call.",
+
+	// GetDiskUsageResult help.
+	"getdiskusageresult-sampledat":         "The time in seconds since 1 Jan 1970 GMT the sizes were sampled at",
+	"getdiskusageresult-totalsize":         "The total size in bytes of everything that's tracked",
+	"getdiskusageresult-totalgrowthperday": "The total forecasted growth in bytes per day of everything that's tracked",
+	"getdiskusageresult-usage":             "The disk usage of each tracked index or state",
+
+	// DiskUsageResult help.
+	"diskusageresult-name":         "The name of the index or state",
+	"diskusageresult-paths":        "The paths on disk that hold the data of the index or state",
+	"diskusageresult-size":         "The size in bytes on disk",
+	"diskusageresult-growthperday": "The forecasted growth in bytes per day",
+	"diskusageresult-windowsecs":   "The length in seconds of the trailing window the growth was forecasted over.  0 if there's not enough data yet",
+
 	// GetGenerateCmd help.
 	"getgenerate--synopsis": "Returns if the server is set to generate coins (mine) or not.",
 	"getgenerate--result0":  "True if mining, false if not",
@@ -467,6 +711,20 @@ var helpDescsEnUS = map[string]string{
 	"getheaders-hashstop":      "Block hash to stop including block headers for; if not found, all headers to the latest known block are returned.",
 	"getheaders--result0":      "Serialized block headers of all located blocks, limited to some arbitrary maximum number of hashes (currently 2000, which matches the wire protocol headers message, but this is not guaranteed)",
 
+	// GetIndexInfoCmd help.
+	"getindexinfo--synopsis":       "Returns how far each of the enabled optional indexes is caught up to the main chain.",
+	"getindexinfo-indexname":       "Only return the index with this name (txindex, addrindex, cfindex, utreexoproofindex, flatutreexoproofindex, leafdataindex or ttlindex)",
+	"getindexinfo--result0--desc":  "Index objects keyed by the name of the index",
+	"getindexinfo--result0--key":   "The name of the index, which is the option that enables it",
+	"getindexinfo--result0--value": "Object containing how far the index is caught up",
+
+	// GetIndexInfoResult help.
+	"getindexinforesult-synced":            "Whether the index is caught up to the main chain.  It's false while the index is being caught up in the background",
+	"getindexinforesult-best_block_height": "The height of the last block that was indexed",
+	"getindexinforesult-best_block_hash":   "The hash of the last block that was indexed",
+	"getindexinforesult-lag":               "The number of blocks of the main chain that haven't been indexed yet",
+	"getindexinforesult-backfill_progress": "The share of the blocks of the main chain that have been indexed, from 0 to 1",
+
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
@@ -529,6 +787,7 @@ var helpDescsEnUS = map[string]string{
 	"getnodeaddressesresult-services": "The services offered",
 	"getnodeaddressesresult-address":  "The address of the node",
 	"getnodeaddressesresult-port":     "The port of the node",
+	"getnodeaddressesresult-network":  "The network of the node (ipv4, ipv6, onion or i2p)",
 
 	// GetNodeAddressesCmd help.
 	"getnodeaddresses--synopsis": "Return known addresses which can potentially be used to find new nodes in the network",
@@ -558,19 +817,57 @@ var helpDescsEnUS = map[string]string{
 	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
 	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
 
+	// The transport of the peer connection, v1 or the BIP0324 v2
+	// encrypted transport.
+	"getpeerinforesult-transport_protocol_type": "The transport protocol of the connection (v1 or v2)",
+	"getpeerinforesult-session_id":              "The session id of the v2 transport as a hex string, empty for v1",
+
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
+	// GetPeerPolicyInfoCmd help.
+	"getpeerpolicyinfo--synopsis": "Returns the policies peers are refused or deprioritized by during the version handshake and the counts of the peers they applied to since the server started.",
+
+	// GetPeerPolicyInfoResult help.
+	"getpeerpolicyinforesult-agentblacklist":         "The user agent substrings of the peers that are refused",
+	"getpeerpolicyinforesult-agentwhitelist":         "The user agent substrings of which peers must have one, no whitelisting is applied when it's empty",
+	"getpeerpolicyinforesult-agentdeprioritize":      "The user agent substrings of the peers that are deprioritized",
+	"getpeerpolicyinforesult-rejectservices":         "The service flags of the peers that are refused in hex",
+	"getpeerpolicyinforesult-agentblacklisted":       "The number of peers refused for a blacklisted user agent",
+	"getpeerpolicyinforesult-agentnotwhitelisted":    "The number of peers refused for a user agent that isn't whitelisted",
+	"getpeerpolicyinforesult-servicesrejected":       "The number of peers refused for their service flags",
+	"getpeerpolicyinforesult-deprioritized":          "The number of deprioritized peers that were connected",
+	"getpeerpolicyinforesult-deprioritizedevicted":   "The number of deprioritized peers evicted to make room for other peers",
+	"getpeerpolicyinforesult-proofrequeststhrottled": "The number of utreexo proof requests of deprioritized peers that were ignored",
+
+	// GetPeerReputationCmd help.
+	"getpeerreputation--synopsis": "Returns the long-term reliability of the peers as sources of blocks and their utreexo proofs, most reliable first.\n" +
+		"The reputations are kept across restarts and more reliable peers are preferred for the sync and block downloads.",
+
+	// GetPeerReputationResult help.
+	"getpeerreputationresult-addr":           "The address of the peer, only the host for inbound peers",
+	"getpeerreputationresult-score":          "How reliable the peer is between 0 and 1",
+	"getpeerreputationresult-connected":      "Whether the peer is currently connected",
+	"getpeerreputationresult-validproofs":    "The number of blocks with proofs from the peer that were connected",
+	"getpeerreputationresult-invalidproofs":  "The number of blocks with proofs from the peer that were rejected",
+	"getpeerreputationresult-timeouts":       "The number of times the peer didn't deliver a requested block in time or stalled the sync",
+	"getpeerreputationresult-latencyms":      "The moving average of the milliseconds the peer took to deliver a requested block and its proof",
+	"getpeerreputationresult-latencysamples": "The number of deliveries the latency was measured over",
+	"getpeerreputationresult-connections":    "The number of times the peer was connected",
+	"getpeerreputationresult-uptime":         "The total seconds the peer was connected for",
+	"getpeerreputationresult-lastseen":       "The last time the peer was connected in seconds since 1 Jan 1970 GMT",
+
 	// GetRawMempoolVerboseResult help.
-	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
-	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
-	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
-	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
-	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
-	"getrawmempoolverboseresult-currentpriority":  "Current priority",
-	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
-	"getrawmempoolverboseresult-vsize":            "The virtual size of a transaction",
-	"getrawmempoolverboseresult-weight":           "The transaction's weight (between vsize*4-3 and vsize*4)",
+	"getrawmempoolverboseresult-size":               "Transaction size in bytes",
+	"getrawmempoolverboseresult-fee":                "Transaction fee in bitcoins",
+	"getrawmempoolverboseresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getrawmempoolverboseresult-height":             "Block height when transaction entered the pool",
+	"getrawmempoolverboseresult-startingpriority":   "Priority when transaction entered the pool",
+	"getrawmempoolverboseresult-currentpriority":    "Current priority",
+	"getrawmempoolverboseresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getrawmempoolverboseresult-bip125-replaceable": "Whether this transaction can be replaced through the Replace-By-Fee (RBF) policy, either because it signals replaceability or because one of its unconfirmed ancestors does",
+	"getrawmempoolverboseresult-vsize":              "The virtual size of a transaction",
+	"getrawmempoolverboseresult-weight":             "The transaction's weight (between vsize*4-3 and vsize*4)",
 
 	// GetRawMempoolCmd help.
 	"getrawmempool--synopsis":   "Returns information about all of the transactions currently in the memory pool.",
@@ -602,11 +899,15 @@ var helpDescsEnUS = map[string]string{
 	"gettxout-includemempool": "Include the mempool when true",
 
 	// GetUtreexoProof help.
-	"getutreexoproof--synopsis": "Returns an utreexo accumulator proof and the leaf preimages for the desired block",
-	"getutreexoproof-blockhash": "The block hash where the utreexo proof was created",
-	"getutreexoproof-verbosity": "Returns a json of the utreexo proof and the leaf preimages",
+	"getutreexoproof--synopsis":   "Returns an utreexo accumulator proof and the leaf preimages for the desired block",
+	"getutreexoproof-blockhash":   "The hash or the height of the block where the utreexo proof was created",
+	"getutreexoproof-verbosity":   "Returns a json of the utreexo proof and the leaf preimages",
+	"getutreexoproof--condition0": "verbosity=0",
+	"getutreexoproof--condition1": "verbosity=1",
+	"getutreexoproof--result0":    "Hex-encoded bytes of the serialized utreexo proof",
 
 	// GetUtreexoProofVerboseResult help.
+	"getutreexoproofverboseresult-hex": "Hex-encoded bytes of the serialized utreexo proof",
 	"getutreexoproofverboseresult-proofhashes": "One half of the utreexo accumulator proof (the other half being prooftargets).\n" +
 		"The proof hashes for the utreexo accumulator proof of the given UTXOs.",
 	"getutreexoproofverboseresult-targethashes":    "Hashes that correspond to each of the prooftargets",
@@ -614,13 +915,189 @@ var helpDescsEnUS = map[string]string{
 	"getutreexoproofverboseresult-prooftargets": "One half of the utreexo accumulator proof (the other half being proofhashes).\n" +
 		"The locations of the given UTXOs in the accumulator.",
 
+	// GetLeafAtPositionCmd help.
+	"getleafatposition--synopsis": "Returns the output committed to by the leaf at the given position of the utreexo accumulator at the tip.\n" +
+		"Requires the leaf data index (--leafdataindex) and a utreexo proof index",
+	"getleafatposition-position": "The position in the utreexo accumulator",
+
+	// GetLeafByHashCmd help.
+	"getleafbyhash--synopsis": "Returns the current position in the utreexo accumulator at the tip and the output committed to by the leaf with the given hash.\n" +
+		"Requires the leaf data index (--leafdataindex) and a utreexo proof index",
+	"getleafbyhash-leafhash": "The hex-encoded hash of the leaf",
+
+	// GetLeafAtPositionResult help.
+	"getleafatpositionresult-position":   "The position in the utreexo accumulator",
+	"getleafatpositionresult-leafhash":   "The hash of the leaf at the position",
+	"getleafatpositionresult-blockhash":  "The hash of the block the output was created in",
+	"getleafatpositionresult-txid":       "The hash of the transaction that created the output",
+	"getleafatpositionresult-vout":       "The index of the output",
+	"getleafatpositionresult-height":     "The height of the block the output was created in",
+	"getleafatpositionresult-iscoinbase": "Whether or not the output was created by a coinbase transaction",
+	"getleafatpositionresult-amount":     "The value of the output in BTC",
+	"getleafatpositionresult-pkscript":   "The hex-encoded public key script of the output",
+
+	// GetLeafTTLsCmd help.
+	"getleafttls--synopsis": "Returns how many blocks each output added to the utreexo accumulator in the block at the given height lived for before it was spent.\n" +
+		"Requires the flat utreexo proof index with --leafttls",
+	"getleafttls-height": "The height of the block the outputs were created in",
+
+	// GetLeafTTLsResult help.
+	"getleafttlsresult-height":    "The height of the block",
+	"getleafttlsresult-blockhash": "The hash of the block",
+	"getleafttlsresult-leafttls":  "The time to live of each output in the order they were added to the accumulator",
+
+	// LeafTTLResult help.
+	"leafttlresult-txid": "The hash of the transaction that created the output",
+	"leafttlresult-vout": "The index of the output",
+	"leafttlresult-ttl":  "The number of blocks the output lived for before it was spent or 0 if it's still unspent",
+
+	// GetUtreexoInfoCmd help.
+	"getutreexoinfo--synopsis": "Returns a summary of the utreexo accumulator and of how the node keeps it",
+
+	// GetUtreexoInfoResult help.
+	"getutreexoinforesult-mode":                  "Whether the node is a bridge node that keeps the whole accumulator (bridge) or a compact state node (csn)",
+	"getutreexoinforesult-height":                "The height of the block the accumulator is at",
+	"getutreexoinforesult-blockhash":             "The hash of the block the accumulator is at",
+	"getutreexoinforesult-numleaves":             "The number of leaves ever added to the accumulator",
+	"getutreexoinforesult-roots":                 "The roots of the accumulator",
+	"getutreexoinforesult-utreexoproofindex":     "Whether the utreexo proof index is enabled",
+	"getutreexoinforesult-flatutreexoproofindex": "Whether the flat utreexo proof index is enabled",
+	"getutreexoinforesult-nodescache":            "The usage of the cache of the accumulator nodes (only for bridge nodes)",
+	"getutreexoinforesult-cachedleavescache":     "The usage of the cache of the cached leaves (only for bridge nodes)",
+	"getutreexoinforesult-lastflushheight":       "The height of the block the accumulator was at when it was last flushed to disk (only for bridge nodes)",
+	"getutreexoinforesult-lastflushhash":         "The hash of the block the accumulator was at when it was last flushed to disk (only for bridge nodes)",
+	"getutreexoinforesult-cachedleaveslive":      "The estimated number of cached leaves entries in the database that are live (only for bridge nodes)",
+	"getutreexoinforesult-cachedleavesgarbage":   "The estimated number of cached leaves entries in the database that are left behind by spent and moved leaves until the database is compacted (only for bridge nodes)",
+	"getutreexoinforesult-garbageratio":          "The share of the cached leaves entries in the database that are garbage (only for bridge nodes)",
+	"getutreexoinforesult-garbagecompactions":    "The number of times the database was compacted because of the garbage since the node started as set by --utreexocompactgarbage (only for bridge nodes)",
+	"getutreexoinforesult-pruned":                "Whether the node is pruned and keeps no proofs",
+	"getutreexoinforesult-proofpruneheight":      "The height below which the proofs are dropped as set by --proofpruneheight.  0 when it isn't set",
+	"getutreexoinforesult-proofretention":        "The number of blocks from the tip the proofs are kept for as set by --proofretention.  0 when it isn't set",
+	"getutreexoinforesult-undoretention":         "The number of blocks from the tip pruned nodes keep the data used to disconnect blocks on reorgs for as set by --undoretention",
+	"getutreexoinforesult-rollbacksnapshots":     "The number of snapshots of the accumulator kept to undo reorgs deeper than the undo data as set by --rollbacksnapshots.  0 when it isn't set",
+	"getutreexoinforesult-rootsnapshotinterval":  "The number of blocks between the root snapshots used by gethistoricalroots as set by --rootsnapshotinterval.  0 when they're disabled",
+	"getutreexoinforesult-compactedheight":       "The height up to which the proofs were dropped.  0 when no proofs were dropped",
+
+	// UtreexoCacheInfoResult help.
+	"utreexocacheinforesult-used":        "The number of entries in the cache",
+	"utreexocacheinforesult-capacity":    "The number of entries the cache can hold",
+	"utreexocacheinforesult-utilization": "The percentage of the cache that's in use",
+
+	// GetUtreexoProofsCmd help.
+	"getutreexoproofs--synopsis":   "Returns the serialized utreexo proofs for a range of blocks in the main chain",
+	"getutreexoproofs-startheight": "The height of the first block to return the proof of",
+	"getutreexoproofs-endheight":   "The height of the last block to return the proof of",
+
+	// GetUtreexoProofsResult help.
+	"getutreexoproofsresult-height":    "The height of the block",
+	"getutreexoproofsresult-blockhash": "The hash of the block",
+	"getutreexoproofsresult-hex":       "Hex-encoded bytes of the serialized utreexo proof",
+
+	// GetCoinAgeStatsCmd help.
+	"getcoinagestats--synopsis": "Returns the distribution of the ages of the unspent outputs in the utreexo accumulator at a block along with how many of them are dust.\n" +
+		"The tip is read from the leaf data index (--leafdataindex).  Other heights, or the tip without the leaf data index, need the flat utreexo proof index with --leafttls and read every block up to the height",
+	"getcoinagestats-height": "The height of the block to gather the statistics at.  Defaults to the tip",
+
+	// GetCoinAgeStatsResult help.
+	"getcoinagestatsresult-height":       "The height of the block the statistics are at",
+	"getcoinagestatsresult-blockhash":    "The hash of the block the statistics are at",
+	"getcoinagestatsresult-count":        "The number of unspent outputs",
+	"getcoinagestatsresult-amount":       "The value of the unspent outputs in BTC",
+	"getcoinagestatsresult-dustcount":    "The number of unspent outputs that are dust at the minimum relay fee",
+	"getcoinagestatsresult-dustamount":   "The value of the dust outputs in BTC",
+	"getcoinagestatsresult-agehistogram": "The unspent outputs by their age in blocks",
+
+	// CoinAgeBucketResult help.
+	"coinagebucketresult-minage":     "The smallest age of the outputs counted",
+	"coinagebucketresult-maxage":     "The largest age of the outputs counted, left out for the oldest outputs",
+	"coinagebucketresult-count":      "The number of outputs with an age of minage to maxage",
+	"coinagebucketresult-amount":     "The value of the outputs in BTC",
+	"coinagebucketresult-dustcount":  "The number of the outputs that are dust",
+	"coinagebucketresult-dustamount": "The value of the dust outputs in BTC",
+
+	// GetUtreexoProofStatsCmd help.
+	"getutreexoproofstats--synopsis": "Returns statistics of the utreexo proofs stored for a range of blocks along with the state of the accumulator and the sizes of the flat files.\n" +
+		"Only the size and the number of targets are read from each proof, but every proof in the range is visited",
+	"getutreexoproofstats-startheight": "The height of the first block to gather the statistics of.  Defaults to the first block whose proof is stored",
+	"getutreexoproofstats-endheight":   "The height of the last block to gather the statistics of.  Defaults to the tip of the index",
+
+	// GetUtreexoProofStatsResult help.
+	"getutreexoproofstatsresult-height":           "The height of the block the accumulator is at",
+	"getutreexoproofstatsresult-blockhash":        "The hash of the block the accumulator is at",
+	"getutreexoproofstatsresult-numleaves":        "The number of leaves ever added to the accumulator",
+	"getutreexoproofstatsresult-forestrows":       "The number of rows of the forest the accumulator needs for its leaves",
+	"getutreexoproofstatsresult-startheight":      "The height of the first block in the range",
+	"getutreexoproofstatsresult-endheight":        "The height of the last block in the range",
+	"getutreexoproofstatsresult-totalproofbytes":  "The size in bytes of all the proofs in the range",
+	"getutreexoproofstatsresult-avgproofbytes":    "The average size in bytes of the proof of a block in the range",
+	"getutreexoproofstatsresult-maxproofbytes":    "The size in bytes of the biggest proof in the range",
+	"getutreexoproofstatsresult-maxproofheight":   "The height of the block with the biggest proof in the range",
+	"getutreexoproofstatsresult-targetshistogram": "The number of blocks in the range by the number of targets of their proofs",
+	"getutreexoproofstatsresult-flatfilecount":    "The number of flat files the flat utreexo proof index keeps",
+	"getutreexoproofstatsresult-flatfiles":        "The sizes of the flat files (only with --flatutreexoproofindex)",
+
+	// TargetCountBucketResult help.
+	"targetcountbucketresult-mintargets": "The smallest number of targets of the proofs counted",
+	"targetcountbucketresult-maxtargets": "The largest number of targets of the proofs counted",
+	"targetcountbucketresult-blocks":     "The number of blocks with proofs that have from mintargets to maxtargets targets",
+
+	// FlatFileSizeResult help.
+	"flatfilesizeresult-name":       "The name of the data kept in the flat file",
+	"flatfilesizeresult-height":     "The height of the last block the flat file has data for",
+	"flatfilesizeresult-datasize":   "The size in bytes of the data file",
+	"flatfilesizeresult-offsetsize": "The size in bytes of the offset file",
+
+	// GetHistoricalRootsCmd help.
+	"gethistoricalroots--synopsis": "Returns the utreexo accumulator roots at the block of the main chain at the given height.\n" +
+		"The roots are replayed from the last root snapshot at or below the height (--rootsnapshotinterval) with the stored proofs of the blocks in between, " +
+		"so only the roots at the snapshots themselves can be looked up on pruned nodes.  " +
+		"The blocks below the first snapshot are replayed from the genesis block.",
+	"gethistoricalroots-height": "The height of the block to return the roots at",
+
+	// GetHistoricalRootsResult help.
+	"gethistoricalrootsresult-blockhash":      "The hash of the block the roots are at",
+	"gethistoricalrootsresult-height":         "The height of the block the roots are at",
+	"gethistoricalrootsresult-roots":          "The roots of the accumulator at the block",
+	"gethistoricalrootsresult-numleaves":      "The number of leaves committed in the accumulator at the block",
+	"gethistoricalrootsresult-rootshash":      "The hash of the number of leaves and the roots.  It can be given to --assumeutreexo to start a utreexo node from this block",
+	"gethistoricalrootsresult-snapshotheight": "The height of the root snapshot the roots were replayed from.  0 when they were replayed from the genesis block",
+	"gethistoricalrootsresult-replayedblocks": "The number of blocks replayed on top of the root snapshot",
+
+	// GetProofAccessStatsCmd help.
+	"getproofaccessstats--synopsis": "Returns the counts of the utreexo proofs served over P2P, RPC and REST since the node started or the counts were last reset (--proofaccessstats).\n" +
+		"The proofs are grouped by where they were asked for, how many blocks below the tip their block is and how many targets they have.  " +
+		"The proofs of outpoints are counted at a depth of 0 since they're proven against the tip.",
+	"getproofaccessstats-reset": "Start the counts over after returning them",
+
+	// GetProofAccessStatsResult help.
+	"getproofaccessstatsresult-since":       "The time the counts were started at in seconds since 1 Jan 1970 GMT",
+	"getproofaccessstatsresult-clientsmode": "How the clients are told apart as set by --proofaccessclients (none, truncated or full)",
+	"getproofaccessstatsresult-groups":      "The counts of the proofs by source, depth and size",
+	"getproofaccessstatsresult-clients":     "The counts of the proofs served over P2P and REST by client from the most bytes to the least.  The clients past the first 1000 are counted as other.  Omitted when the clients aren't told apart",
+
+	// ProofAccessGroupResult help.
+	"proofaccessgroupresult-source":  "Where the proofs were asked for (p2p, rpc or rest)",
+	"proofaccessgroupresult-depth":   "The range of the number of blocks below the tip of the blocks of the proofs",
+	"proofaccessgroupresult-size":    "The range of the number of targets of the proofs",
+	"proofaccessgroupresult-proofs":  "The number of proofs served",
+	"proofaccessgroupresult-targets": "The total number of targets of the proofs",
+	"proofaccessgroupresult-bytes":   "The total size of the proofs in bytes",
+
+	// ProofAccessClientResult help.
+	"proofaccessclientresult-client":  "The address of the client, truncated to the /24 of IPv4 or the /48 of IPv6 addresses with --proofaccessclients=truncated",
+	"proofaccessclientresult-proofs":  "The number of proofs served to the client",
+	"proofaccessclientresult-targets": "The total number of targets of the proofs",
+	"proofaccessclientresult-bytes":   "The total size of the proofs in bytes",
+
 	// GetUtreexoRoots help.
 	"getutreexoroots--synopsis": "Returns an utreexo accumulator roots and the number of leaves at the desired block",
-	"getutreexoroots-blockhash": "The block in which to fetch the accumulator state",
+	"getutreexoroots-blockhash": "The hash or the height of the block in which to fetch the accumulator state.  Defaults to the tip",
 
 	// GetUtreexoRootsResult help.
+	"getutreexorootsresult-blockhash": "The hash of the block the accumulator state is at",
 	"getutreexorootsresult-numleaves": "The number of leaves committed in the accumulator at the given block",
 	"getutreexorootsresult-roots":     "The roots of the accumulator at the given block",
+	"getutreexorootsresult-rootshash": "The hash of the number of leaves and the roots.  It can be given to --assumeutreexo to start a utreexo node from this block",
 
 	// GetUtreexoBlockSummaryRoots help.
 	"getutreexoblocksummaryroots--synopsis": "Returns the utreexo roots, number of leaves, and the blockhash of the utreexo block summary accumulator",
@@ -630,12 +1107,34 @@ var helpDescsEnUS = map[string]string{
 	"getutreexoblocksummaryrootsresult-numleaves": "The number of leaves committed in the roots of the block summary accumulator",
 	"getutreexoblocksummaryrootsresult-blockhash": "The block hash for the roots and the numleaves",
 
+	// GetWalletUtxosCmd help.
+	"getwalletutxos--synopsis":  "Returns the utxos of the watch only wallet, each with a utreexo proof of just that utxo so that it can be signed for and spent offline.",
+	"getwalletutxos-descriptor": "Only return the utxos of this registered descriptor",
+
+	// GetWalletUtxosResult help.
+	"getwalletutxosresult-besthash":  "The block hash that the proofs are for",
+	"getwalletutxosresult-numleaves": "The number of leaves in the accumulator at besthash",
+	"getwalletutxosresult-utxos":     "The utxos of the watch only wallet",
+
+	// WalletUtxoResult help.
+	"walletutxoresult-txid":         "The hash of the transaction that created the utxo",
+	"walletutxoresult-vout":         "The output index of the utxo",
+	"walletutxoresult-amount":       "The amount of the utxo in satoshis",
+	"walletutxoresult-scriptpubkey": "The hex-encoded public key script of the utxo",
+	"walletutxoresult-height":       "The height of the block that created the utxo",
+	"walletutxoresult-blockhash":    "The hash of the block that created the utxo",
+	"walletutxoresult-coinbase":     "Whether or not the utxo was created by a coinbase transaction",
+	"walletutxoresult-descriptor":   "The registered descriptor the utxo belongs to. Not set for utxos of addresses and extended public keys",
+	"walletutxoresult-leafhash":     "The hash of the utxo that is committed in the accumulator",
+	"walletutxoresult-proof":        "Hex-encoded serialized udata that proves the utxo at besthash",
+
 	// GetWatchOnlyBalanceCmd help.
 	"getwatchonlybalance--synopsis": "Returns the total balance of the watch only wallet",
 	"getwatchonlybalance--result0":  "The total balance of the watch only wallet in satoshis",
 
 	// InvalidateBlockCmd help.
-	"invalidateblock--synopsis": "Invalidates the block of the given block hash. To re-validate the invalidated block, use the reconsiderblock rpc",
+	"invalidateblock--synopsis": "Invalidates the block of the given block hash. To re-validate the invalidated block, use the reconsiderblock rpc.\n" +
+		"The utreexo accumulators of the proof indexes are rolled back along with the chain and flushed to disk at the new tip.",
 	"invalidateblock-blockhash": "The block hash of the block to invalidate",
 
 	// HelpCmd help.
@@ -668,6 +1167,31 @@ var helpDescsEnUS = map[string]string{
 	"listbdkutxosresult-derivationindex": "The derivation index of the wallet this utxo is located at.",
 	"listbdkutxosresult-confirmations":   "The total amount of blockchain confirmations this utxo has.",
 
+	// ListUtxoSetCmd help.
+	"listutxoset--synopsis": "Returns a page of the unspent outputs of the utxo set ordered by txid and output index.\n" +
+		"A scan without a cursor is of the utxo set at the chain tip and the cursor returned with each page keeps the pages after it at that same block, " +
+		"so the whole set can be enumerated without it changing as new blocks are connected.\n" +
+		"The scan has to be restarted if the block is reorganized out of the main chain.",
+	"listutxoset-cursor":        "The cursor returned with the previous page.  Starts a new scan at the chain tip when omitted",
+	"listutxoset-count":         "The maximum number of unspent outputs to return (max 10000)",
+	"listutxoset-includeproofs": "Also return a utreexo proof at the chain tip of the outputs of the page that are still unspent.  Requires a utreexo proof index",
+
+	// ListUtxoSetResult help.
+	"listutxosetresult-snapshothash":   "The hash of the block the utxo set is at",
+	"listutxosetresult-snapshotheight": "The height of the block the utxo set is at",
+	"listutxosetresult-utxos":          "The unspent outputs of the page",
+	"listutxosetresult-nextcursor":     "The cursor to pass to get the next page.  Omitted after the last page",
+	"listutxosetresult-proof":          "The chain tip inclusion proof of the outputs of the page that are still unspent",
+
+	// ListUtxoSetEntry help.
+	"listutxosetentry-txid":               "The hash of the transaction of the output",
+	"listutxosetentry-vout":               "The index of the output",
+	"listutxosetentry-amount":             "The amount of the output in BTC",
+	"listutxosetentry-pkscript":           "The hex encoded public key script of the output",
+	"listutxosetentry-height":             "The height of the block the output was created in",
+	"listutxosetentry-iscoinbase":         "Whether the output is of a coinbase transaction",
+	"listutxosetentry-spentsincesnapshot": "Whether the output was spent after the block the utxo set is at",
+
 	// PeekAddressCmd help.
 	"peekaddress--synopsis": "Returns an address of the desired derivation index",
 	"peekaddress-index":     "The desired derivation index you want to fetch the address at",
@@ -676,6 +1200,18 @@ var helpDescsEnUS = map[string]string{
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// ProveUtxoCmd help.
+	"proveutxo--synopsis": "Generates a fresh utreexo accumulator proof for the given unspent output against the current accumulator",
+	"proveutxo-txid":      "The hash of the transaction",
+	"proveutxo-vout":      "The index of the output in the transaction",
+
+	// ProveUtxoResult help.
+	"proveutxoresult-provedathash": "The blockhash at which the proof was generated at. The proof will not verify if the blockhash is different",
+	"proveutxoresult-leafhash":     "The hash of the UTXO that is committed in the accumulator",
+	"proveutxoresult-targets":      "The positions of the UTXO in the accumulator",
+	"proveutxoresult-proofhashes":  "The hashes needed to hash the UTXO up to the accumulator roots",
+	"proveutxoresult-hex":          "The hex-encoded serialization of the entire proof",
+
 	// ProveUtxoChainTipInclusionCmd help.
 	"proveutxochaintipinclusion--synopsis": "Returns an utreexo accumulator proof for the chain tip inclusion of the given UTXOs",
 	"proveutxochaintipinclusion-txids":     "The hash of the transactions",
@@ -729,11 +1265,19 @@ var helpDescsEnUS = map[string]string{
 	"searchrawtransactions--result0":    "Hex-encoded serialized transaction",
 
 	// SendRawTransactionCmd help.
-	"sendrawtransaction--synopsis":    "Submits the serialized, hex-encoded transaction to the local peer and relays it to the network.",
-	"sendrawtransaction-hextx":        "Serialized, hex-encoded signed transaction",
-	"sendrawtransaction-feesetting":   "Whether or not to allow insanely high fees in bitcoind < v0.19.0 or the max fee rate for bitcoind v0.19.0 and later (btcd does not yet implement this parameter, so it has no effect)",
-	"sendrawtransaction--result0":     "The hash of the transaction",
-	"allowhighfeesormaxfeerate-value": "Either the boolean value for the allowhighfees parameter in bitcoind < v0.19.0 or the numerical value for the maxfeerate field in bitcoind v0.19.0 and later",
+	"sendrawtransaction--synopsis":  "Submits the serialized, hex-encoded transaction to the local peer and relays it to the network.",
+	"sendrawtransaction-hextx":      "Serialized, hex-encoded signed transaction",
+	"sendrawtransaction-feesetting": "Whether or not to allow insanely high fees in bitcoind < v0.19.0 or the max fee rate for bitcoind v0.19.0 and later (btcd does not yet implement this parameter, so it has no effect)",
+	"sendrawtransaction--result0":   "The hash of the transaction",
+
+	// SendRawTransactionWithProofCmd help.
+	"sendrawtransactionwithproof--synopsis": "Submits the serialized, hex-encoded transaction along with the utreexo proof of its inputs to the local peer and relays it to the network.\n" +
+		"Nodes without the utxo set validate the inputs with the proof, which the finalizepsbt command returns along with the transaction.\n" +
+		"Nodes with the utxo set validate the inputs against it and ignore the proof.",
+	"sendrawtransactionwithproof-hextx":    "Serialized, hex-encoded signed transaction",
+	"sendrawtransactionwithproof-hexproof": "Serialized, hex-encoded utreexo proof and leaf datas of the inputs of the transaction",
+	"sendrawtransactionwithproof--result0": "The hash of the transaction",
+	"allowhighfeesormaxfeerate-value":      "Either the boolean value for the allowhighfees parameter in bitcoind < v0.19.0 or the numerical value for the maxfeerate field in bitcoind v0.19.0 and later",
 
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
@@ -761,6 +1305,27 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package made of a child transaction and its unconfirmed parents to the local mempool and relays it to the network.\n" +
+		"The package is accepted atomically and the child may pay for parents that don't pay the minimum relay fee on their own.\n" +
+		"Nodes without the utxo set require the utreexo proofs of the inputs, with the inputs spending outputs of the parents marked as unconfirmed.",
+	"submitpackage-rawtxns": "Serialized, hex-encoded signed transactions of the package, the parents first and the child last",
+	"submitpackage-proofs":  "Serialized, hex-encoded utreexo proofs and leaf datas of the inputs of the transactions in the same order as the transactions",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-package_msg":           "The result of the package submission, \"success\" when the package was accepted",
+	"submitpackageresult-tx-results":            "The results of the transactions of the package",
+	"submitpackageresult-tx-results--key":       "wtxid",
+	"submitpackageresult-tx-results--value":     "The result of the transaction",
+	"submitpackageresult-tx-results--desc":      "The results of the transactions of the package keyed by their wtxid",
+	"submitpackageresult-replaced-transactions": "The txids of the transactions replaced by the package, always empty as packages can't replace transactions",
+	"submitpackagetxresult-txid":                "The hash of the transaction",
+	"submitpackagetxresult-vsize":               "The virtual size of the transaction",
+	"submitpackagetxresult-fees":                "The fees of the transaction",
+	"submitpackagefees-base":                    "The fee of the transaction in BTC",
+	"submitpackagefees-effective-feerate":       "The fee rate in BTC/kvB the transaction was accepted for, the fee rate of the package if it was added along with the package",
+	"submitpackagefees-effective-includes":      "The wtxids of the transactions whose fees and vsizes are included in effective-feerate",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid":         "Whether or not the address is valid",
 	"validateaddresschainresult-address":         "The bitcoin address (only when isvalid is true)",
@@ -790,6 +1355,19 @@ var helpDescsEnUS = map[string]string{
 	"verifymessage-message":   "The signed message",
 	"verifymessage--result0":  "Whether or not the signature verified",
 
+	// VerifyUtreexoProofCmd help.
+	"verifyutreexoproof--synopsis": "Verifies the given utreexo accumulator proof against the given roots or the current roots of the node",
+	"verifyutreexoproof-roots":     "The hex encoded roots to verify the proof against. The current roots of the node are used if empty",
+	"verifyutreexoproof-numleaves": "The number of leaves in the accumulator of the given roots. Ignored if no roots are given",
+	"verifyutreexoproof-proof":     "The hex encoded serialized accumulator proof",
+	"verifyutreexoproof-delhashes": "The hex encoded hashes of the leaves that are proven, in the order of the targets of the proof",
+
+	// VerifyUtreexoProofResult help.
+	"verifyutreexoproofresult-valid":     "Whether or not the proof verified",
+	"verifyutreexoproofresult-error":     "The reason the proof didn't verify",
+	"verifyutreexoproofresult-roots":     "The hex encoded roots the proof was verified against",
+	"verifyutreexoproofresult-numleaves": "The number of leaves in the accumulator the proof was verified against",
+
 	// VerifyUtxoChainTipInclusionProofCmd help.
 	"verifyutxochaintipinclusionproof--synopsis": "Verify the given utxochaintipinclusion proof",
 	"verifyutxochaintipinclusionproof-proof":     "The hex encoded string of the utxochaintipinclusion proof",
@@ -807,6 +1385,12 @@ var helpDescsEnUS = map[string]string{
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
 
+	// NotifyUtreexoRootsCmd help.
+	"notifyutreexoroots--synopsis": "Send a utreexoroots notification with the roots and the number of leaves of the utreexo accumulator whenever a block is connected or disconnected from the main (best) chain.",
+
+	// StopNotifyUtreexoRootsCmd help.
+	"stopnotifyutreexoroots--synopsis": "Cancel registered notifications for whenever the utreexo accumulator changes.",
+
 	// NotifyNewTransactionsCmd help.
 	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
 	"notifynewtransactions-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives txacceptedverbose, otherwise the caller receives txaccepted",
@@ -844,8 +1428,14 @@ var helpDescsEnUS = map[string]string{
 	"registeraddressestowatchonlywallet--synopsis": "Registers a list of addresses to the watch only wallet.",
 	"registeraddressestowatchonlywallet-addresses": "Addresses to keep track of",
 
+	"registerdescriptorstowatchonlywallet--synopsis": "Registers a list of output descriptors to the watch only wallet. Supports pkh, wpkh, sh(wpkh), tr without a script tree, addr and raw descriptors.\n" +
+		"Only outputs in blocks connected after a descriptor is registered are tracked.",
+	"registerdescriptorstowatchonlywallet-descriptors": "Descriptors to keep track of. A descriptor with multipath key expressions is registered as a descriptor for each path",
+	"registerdescriptorstowatchonlywallet--result0":    "The registered descriptors with their checksums",
+
 	// ReconsiderBlockCmd help.
-	"reconsiderblock--synopsis": "Reconsiders the block of the given block hash. Can be used to re-validate blocks invalidated with invalidateblock",
+	"reconsiderblock--synopsis": "Reconsiders the block of the given block hash. Can be used to re-validate blocks invalidated with invalidateblock.\n" +
+		"The utreexo accumulators of the proof indexes are rolled forward along with the chain and flushed to disk at the new tip.",
 	"reconsiderblock-blockhash": "The block hash of the block to reconsider",
 
 	// Rescan help.
@@ -889,98 +1479,136 @@ var helpDescsEnUS = map[string]string{
 	"versionresult-buildmetadata": "Metadata about the current build",
 
 	// TestMempoolAcceptCmd help.
-	"testmempoolaccept--synopsis":  "Returns result of mempool acceptance tests indicating if raw transaction(s) would be accepted by mempool.",
+	"testmempoolaccept--synopsis": "Returns result of mempool acceptance tests indicating if raw transaction(s) would be accepted by mempool.\n" +
+		"The transactions aren't added to the mempool nor relayed.\n" +
+		"Nodes without the utxo set require the utreexo proofs of the inputs, which are verified against the current accumulator roots.",
 	"testmempoolaccept-rawtxns":    "Serialized transactions to test.",
 	"testmempoolaccept-maxfeerate": "Maximum acceptable fee rate in BTC/kB",
+	"testmempoolaccept-proofs":     "Serialized, hex-encoded utreexo proofs and leaf datas of the inputs of the transactions in the same order as the transactions",
 
 	// TestMempoolAcceptCmd result help.
-	"testmempoolacceptresult-txid":             "The transaction hash in hex.",
-	"testmempoolacceptresult-wtxid":            "The transaction witness hash in hex.",
-	"testmempoolacceptresult-package-error":    "Package validation error, if any (only possible if rawtxs had more than 1 transaction).",
-	"testmempoolacceptresult-allowed":          "Whether the transaction would be accepted to the mempool.",
-	"testmempoolacceptresult-vsize":            "Virtual transaction size as defined in BIP 141.(only present when 'allowed' is true)",
-	"testmempoolacceptresult-reject-reason":    "Rejection string (only present when 'allowed' is false).",
-	"testmempoolacceptresult-fees":             "Transaction fees (only present if 'allowed' is true).",
-	"testmempoolacceptfees-base":               "Transaction fees (only present if 'allowed' is true).",
-	"testmempoolacceptfees-effective-feerate":  "The effective feerate in BTC per KvB.",
-	"testmempoolacceptfees-effective-includes": "Transactions whose fees and vsizes are included in effective-feerate. Each item is a transaction wtxid in hex.",
+	"testmempoolacceptresult-txid":                  "The transaction hash in hex.",
+	"testmempoolacceptresult-wtxid":                 "The transaction witness hash in hex.",
+	"testmempoolacceptresult-package-error":         "Package validation error, if any (only possible if rawtxs had more than 1 transaction).",
+	"testmempoolacceptresult-allowed":               "Whether the transaction would be accepted to the mempool.",
+	"testmempoolacceptresult-vsize":                 "Virtual transaction size as defined in BIP 141.(only present when 'allowed' is true)",
+	"testmempoolacceptresult-reject-reason":         "Rejection string (only present when 'allowed' is false).",
+	"testmempoolacceptresult-replaced-transactions": "The transaction hashes of the mempool transactions, including their descendants, that this transaction would replace through the Replace-By-Fee (RBF) policy (only present when 'allowed' is true and the transaction is a replacement).",
+	"testmempoolacceptresult-fees":                  "Transaction fees (only present if 'allowed' is true).",
+	"testmempoolacceptfees-base":                    "Transaction fees (only present if 'allowed' is true).",
+	"testmempoolacceptfees-effective-feerate":       "The effective feerate in BTC per KvB.",
+	"testmempoolacceptfees-effective-includes":      "Transactions whose fees and vsizes are included in effective-feerate. Each item is a transaction wtxid in hex.",
 }
 
 // rpcResultTypes specifies the result types that each RPC command can return.
 // This information is used to generate the help.  Each result type must be a
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
-	"addnode":                            nil,
-	"balance":                            {(*btcjson.BalanceResult)(nil)},
-	"createrawtransaction":               {(*string)(nil)},
-	"createtransactionfrombdkwallet":     {(*btcjson.CreateTransactionFromBDKWalletResult)(nil)},
-	"debuglevel":                         {(*string)(nil), (*string)(nil)},
-	"decoderawtransaction":               {(*btcjson.TxRawDecodeResult)(nil)},
-	"decodescript":                       {(*btcjson.DecodeScriptResult)(nil)},
-	"estimatefee":                        {(*float64)(nil)},
-	"freshaddress":                       {(*btcjson.BDKAddressResult)(nil)},
-	"generate":                           {(*[]string)(nil)},
-	"getaddednodeinfo":                   {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
-	"getbestblock":                       {(*btcjson.GetBestBlockResult)(nil)},
-	"getbestblockhash":                   {(*string)(nil)},
-	"getbeststate":                       {(*btcjson.GetBestStateResult)(nil)},
-	"getblock":                           {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
-	"getblockcount":                      {(*int64)(nil)},
-	"getblockhash":                       {(*string)(nil)},
-	"getblockheader":                     {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
-	"getblocktemplate":                   {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
-	"getblockchaininfo":                  {(*btcjson.GetBlockChainInfoResult)(nil)},
-	"getchaintips":                       {(*[]btcjson.GetChainTipsResult)(nil)},
-	"getcfilter":                         {(*string)(nil)},
-	"getcfilterheader":                   {(*string)(nil)},
-	"getconnectioncount":                 {(*int32)(nil)},
-	"getcurrentnet":                      {(*uint32)(nil)},
-	"getdifficulty":                      {(*float64)(nil)},
-	"getgenerate":                        {(*bool)(nil)},
-	"gethashespersec":                    {(*float64)(nil)},
-	"getheaders":                         {(*[]string)(nil)},
-	"getinfo":                            {(*btcjson.InfoChainResult)(nil)},
-	"getmempoolinfo":                     {(*btcjson.GetMempoolInfoResult)(nil)},
-	"getmininginfo":                      {(*btcjson.GetMiningInfoResult)(nil)},
-	"getmnemonicwords":                   {(*[]string)(nil)},
-	"getnettotals":                       {(*btcjson.GetNetTotalsResult)(nil)},
-	"gettxtotals":                        {(*btcjson.GetTxTotalsResult)(nil)},
-	"getutreexoblocksummaryroots":        {(*btcjson.GetUtreexoBlockSummaryRootsResult)(nil)},
-	"getutreexoproof":                    {(*btcjson.GetUtreexoProofVerboseResult)(nil)},
-	"getutreexoroots":                    {(*btcjson.GetUtreexoRootsResult)(nil)},
-	"getwatchonlybalance":                {(*int64)(nil)},
-	"getnetworkhashps":                   {(*int64)(nil)},
-	"getnodeaddresses":                   {(*[]btcjson.GetNodeAddressesResult)(nil)},
-	"getpeerinfo":                        {(*[]btcjson.GetPeerInfoResult)(nil)},
-	"getrawmempool":                      {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
-	"getrawtransaction":                  {(*string)(nil), (*btcjson.TxRawResult)(nil)},
-	"gettxout":                           {(*btcjson.GetTxOutResult)(nil)},
-	"node":                               nil,
-	"help":                               {(*string)(nil), (*string)(nil)},
-	"invalidateblock":                    nil,
-	"listbdktransactions":                {(*[]btcjson.ListBDKTransactionsResult)(nil)},
-	"listbdkutxos":                       {(*[]btcjson.ListBDKUTXOsResult)(nil)},
-	"peekaddress":                        {(*btcjson.BDKAddressResult)(nil)},
-	"ping":                               nil,
-	"proveutxochaintipinclusion":         {(*btcjson.ProveUtxoChainTipInclusionVerboseResult)(nil)},
-	"provewatchonlychaintipinclusion":    {(*btcjson.ProveWatchOnlyChainTipInclusionVerboseResult)(nil)},
-	"rebroadcastunconfirmedbdktxs":       {(*[]string)(nil)},
-	"registeraddressestowatchonlywallet": nil,
-	"reconsiderblock":                    nil,
-	"searchrawtransactions":              {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
-	"sendrawtransaction":                 {(*string)(nil)},
-	"setgenerate":                        nil,
-	"signmessagewithprivkey":             {(*string)(nil)},
-	"stop":                               {(*string)(nil)},
-	"submitblock":                        {nil, (*string)(nil)},
-	"unusedaddress":                      {(*btcjson.BDKAddressResult)(nil)},
-	"uptime":                             {(*int64)(nil)},
-	"validateaddress":                    {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":                        {(*bool)(nil)},
-	"verifymessage":                      {(*bool)(nil)},
-	"verifyutxochaintipinclusionproof":   {(*bool)(nil)},
-	"version":                            {(*map[string]btcjson.VersionResult)(nil)},
-	"testmempoolaccept":                  {(*[]btcjson.TestMempoolAcceptResult)(nil)},
+	"addnode":                              nil,
+	"balance":                              {(*btcjson.BalanceResult)(nil)},
+	"backuputreexostate":                   {(*btcjson.BackupUtreexoStateResult)(nil)},
+	"compactproofs":                        {(*btcjson.CompactProofsResult)(nil)},
+	"createpsbt":                           {(*string)(nil)},
+	"createrawtransaction":                 {(*string)(nil)},
+	"finalizepsbt":                         {(*btcjson.FinalizePsbtResult)(nil)},
+	"createtransactionfrombdkwallet":       {(*btcjson.CreateTransactionFromBDKWalletResult)(nil)},
+	"debuglevel":                           {(*string)(nil), (*string)(nil)},
+	"decoderawtransaction":                 {(*btcjson.TxRawDecodeResult)(nil)},
+	"decodescript":                         {(*btcjson.DecodeScriptResult)(nil)},
+	"dumptxoutset":                         {(*btcjson.DumpTxOutSetResult)(nil)},
+	"estimatefee":                          {(*float64)(nil)},
+	"estimatesmartfee":                     {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"freshaddress":                         {(*btcjson.BDKAddressResult)(nil)},
+	"generate":                             {(*[]string)(nil)},
+	"generateblock":                        {(*btcjson.GenerateBlockResult)(nil)},
+	"generatetoaddress":                    {(*[]string)(nil)},
+	"generatetestutxos":                    {(*btcjson.GenerateTestUtxosResult)(nil)},
+	"getaddednodeinfo":                     {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getbestblock":                         {(*btcjson.GetBestBlockResult)(nil)},
+	"getbestblockhash":                     {(*string)(nil)},
+	"getbeststate":                         {(*btcjson.GetBestStateResult)(nil)},
+	"getblock":                             {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
+	"getblockcount":                        {(*int64)(nil)},
+	"getblockhash":                         {(*string)(nil)},
+	"getblockheader":                       {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockscrubinfo":                    {(*btcjson.GetBlockScrubInfoResult)(nil)},
+	"getblocktemplate":                     {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getblockchaininfo":                    {(*btcjson.GetBlockChainInfoResult)(nil)},
+	"getchaintips":                         {(*[]btcjson.GetChainTipsResult)(nil)},
+	"getbootstrappackage":                  {(*btcjson.GetBootstrapPackageResult)(nil)},
+	"getcfilter":                           {(*string)(nil)},
+	"getcfilterheader":                     {(*string)(nil)},
+	"getconformancevectors":                {(*btcjson.GetConformanceVectorsResult)(nil)},
+	"getconnectioncount":                   {(*int32)(nil)},
+	"getcurrentnet":                        {(*uint32)(nil)},
+	"getdeploymentinfo":                    {(*btcjson.GetDeploymentInfoResult)(nil)},
+	"getdifficulty":                        {(*float64)(nil)},
+	"getdiskusage":                         {(*btcjson.GetDiskUsageResult)(nil)},
+	"getgenerate":                          {(*bool)(nil)},
+	"gethashespersec":                      {(*float64)(nil)},
+	"getheaders":                           {(*[]string)(nil)},
+	"getindexinfo":                         {(*map[string]btcjson.GetIndexInfoResult)(nil)},
+	"getinfo":                              {(*btcjson.InfoChainResult)(nil)},
+	"getmempoolinfo":                       {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmininginfo":                        {(*btcjson.GetMiningInfoResult)(nil)},
+	"getmnemonicwords":                     {(*[]string)(nil)},
+	"getnettotals":                         {(*btcjson.GetNetTotalsResult)(nil)},
+	"gettxtotals":                          {(*btcjson.GetTxTotalsResult)(nil)},
+	"getutreexoblocksummaryroots":          {(*btcjson.GetUtreexoBlockSummaryRootsResult)(nil)},
+	"getutreexoinfo":                       {(*btcjson.GetUtreexoInfoResult)(nil)},
+	"getutreexoproof":                      {(*string)(nil), (*btcjson.GetUtreexoProofVerboseResult)(nil)},
+	"getutreexoproofs":                     {(*[]btcjson.GetUtreexoProofsResult)(nil)},
+	"getutreexoproofstats":                 {(*btcjson.GetUtreexoProofStatsResult)(nil)},
+	"getleafatposition":                    {(*btcjson.GetLeafAtPositionResult)(nil)},
+	"getleafbyhash":                        {(*btcjson.GetLeafAtPositionResult)(nil)},
+	"getcoinagestats":                      {(*btcjson.GetCoinAgeStatsResult)(nil)},
+	"getleafttls":                          {(*btcjson.GetLeafTTLsResult)(nil)},
+	"gethistoricalroots":                   {(*btcjson.GetHistoricalRootsResult)(nil)},
+	"getproofaccessstats":                  {(*btcjson.GetProofAccessStatsResult)(nil)},
+	"getutreexoroots":                      {(*btcjson.GetUtreexoRootsResult)(nil)},
+	"getwalletutxos":                       {(*btcjson.GetWalletUtxosResult)(nil)},
+	"getwatchonlybalance":                  {(*int64)(nil)},
+	"getnetworkhashps":                     {(*int64)(nil)},
+	"getnodeaddresses":                     {(*[]btcjson.GetNodeAddressesResult)(nil)},
+	"getpeerinfo":                          {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"getpeerpolicyinfo":                    {(*btcjson.GetPeerPolicyInfoResult)(nil)},
+	"getpeerreputation":                    {(*[]btcjson.GetPeerReputationResult)(nil)},
+	"getrawmempool":                        {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getrawtransaction":                    {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"gettxout":                             {(*btcjson.GetTxOutResult)(nil)},
+	"node":                                 nil,
+	"help":                                 {(*string)(nil), (*string)(nil)},
+	"invalidateblock":                      nil,
+	"listbdktransactions":                  {(*[]btcjson.ListBDKTransactionsResult)(nil)},
+	"listbdkutxos":                         {(*[]btcjson.ListBDKUTXOsResult)(nil)},
+	"listutxoset":                          {(*btcjson.ListUtxoSetResult)(nil)},
+	"peekaddress":                          {(*btcjson.BDKAddressResult)(nil)},
+	"ping":                                 nil,
+	"proveutxo":                            {(*btcjson.ProveUtxoResult)(nil)},
+	"proveutxochaintipinclusion":           {(*btcjson.ProveUtxoChainTipInclusionVerboseResult)(nil)},
+	"provewatchonlychaintipinclusion":      {(*btcjson.ProveWatchOnlyChainTipInclusionVerboseResult)(nil)},
+	"rebroadcastunconfirmedbdktxs":         {(*[]string)(nil)},
+	"registeraddressestowatchonlywallet":   nil,
+	"registerdescriptorstowatchonlywallet": {(*[]string)(nil)},
+	"reconsiderblock":                      nil,
+	"searchrawtransactions":                {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
+	"sendrawtransaction":                   {(*string)(nil)},
+	"sendrawtransactionwithproof":          {(*string)(nil)},
+	"setgenerate":                          nil,
+	"signmessagewithprivkey":               {(*string)(nil)},
+	"stop":                                 {(*string)(nil)},
+	"submitblock":                          {nil, (*string)(nil)},
+	"submitpackage":                        {(*btcjson.SubmitPackageResult)(nil)},
+	"unusedaddress":                        {(*btcjson.BDKAddressResult)(nil)},
+	"uptime":                               {(*int64)(nil)},
+	"utxoupdatepsbt":                       {(*string)(nil)},
+	"validateaddress":                      {(*btcjson.ValidateAddressChainResult)(nil)},
+	"verifychain":                          {(*bool)(nil)},
+	"verifymessage":                        {(*bool)(nil)},
+	"verifyutreexoproof":                   {(*btcjson.VerifyUtreexoProofResult)(nil)},
+	"verifyutxochaintipinclusionproof":     {(*bool)(nil)},
+	"version":                              {(*map[string]btcjson.VersionResult)(nil)},
+	"testmempoolaccept":                    {(*[]btcjson.TestMempoolAcceptResult)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -993,6 +1621,8 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifyreceived":        nil,
 	"notifyspent":               nil,
 	"stopnotifyspent":           nil,
+	"notifyutreexoroots":        nil,
+	"stopnotifyutreexoroots":    nil,
 	"rescan":                    nil,
 	"rescanblocks":              {(*[]btcjson.RescannedBlock)(nil)},
 }
@@ -69,11 +69,13 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
+	"notifyutreexoroots":        handleNotifyUtreexoRoots,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
+	"stopnotifyutreexoroots":    handleStopNotifyUtreexoRoots,
 	"rescan":                    handleRescan,
 	"rescanblocks":              handleRescanBlocks,
 }
@@ -226,6 +228,20 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *btcutil.Block) {
 	}
 }
 
+// NotifyUtreexoRoots passes the roots of the accumulator after a block was
+// connected or disconnected to the notification manager for utreexo root
+// notification processing.
+func (m *wsNotificationManager) NotifyUtreexoRoots(ntfn *btcjson.UtreexoRootsNtfn) {
+	// As NotifyUtreexoRoots will be called by the block manager and the
+	// RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationUtreexoRoots)(ntfn):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -447,6 +463,7 @@ func (f *wsClientFilter) removeUnspentOutPoint(op *wire.OutPoint) {
 // Notification types
 type notificationBlockConnected btcutil.Block
 type notificationBlockDisconnected btcutil.Block
+type notificationUtreexoRoots btcjson.UtreexoRootsNtfn
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
@@ -457,6 +474,8 @@ type notificationRegisterClient wsClient
 type notificationUnregisterClient wsClient
 type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
+type notificationRegisterUtreexoRoots wsClient
+type notificationUnregisterUtreexoRoots wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
 type notificationRegisterSpent struct {
@@ -490,6 +509,7 @@ func (m *wsNotificationManager) notificationHandler() {
 	// Where possible, the quit channel is used as the unique id for a client
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
+	rootsNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
@@ -532,6 +552,12 @@ out:
 						block)
 				}
 
+			case *notificationUtreexoRoots:
+				if len(rootsNotifications) != 0 {
+					m.notifyUtreexoRoots(rootsNotifications,
+						(*btcjson.UtreexoRootsNtfn)(n))
+				}
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -547,6 +573,14 @@ out:
 				wsc := (*wsClient)(n)
 				delete(blockNotifications, wsc.quit)
 
+			case *notificationRegisterUtreexoRoots:
+				wsc := (*wsClient)(n)
+				rootsNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterUtreexoRoots:
+				wsc := (*wsClient)(n)
+				delete(rootsNotifications, wsc.quit)
+
 			case *notificationRegisterClient:
 				wsc := (*wsClient)(n)
 				clients[wsc.quit] = wsc
@@ -556,6 +590,7 @@ out:
 				// Remove any requests made by the client as well as
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
+				delete(rootsNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
@@ -625,6 +660,18 @@ func (m *wsNotificationManager) UnregisterBlockUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterBlocks)(wsc)
 }
 
+// RegisterUtreexoRootsUpdates requests utreexo root update notifications to the
+// passed websocket client.
+func (m *wsNotificationManager) RegisterUtreexoRootsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterUtreexoRoots)(wsc)
+}
+
+// UnregisterUtreexoRootsUpdates removes utreexo root update notifications for
+// the passed websocket client.
+func (m *wsNotificationManager) UnregisterUtreexoRootsUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterUtreexoRoots)(wsc)
+}
+
 // subscribedClients returns the set of all websocket client quit channels that
 // are registered to receive notifications regarding tx, either due to tx
 // spending a watched output or outputting to a watched address.  Matching
@@ -730,6 +777,23 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	}
 }
 
+// notifyUtreexoRoots notifies websocket clients that have registered for
+// utreexo root updates when the accumulator changed because a block was
+// connected or disconnected.
+func (*wsNotificationManager) notifyUtreexoRoots(clients map[chan struct{}]*wsClient,
+	ntfn *btcjson.UtreexoRootsNtfn) {
+
+	marshalledJSON, err := btcjson.MarshalCmd(btcjson.RpcVersion1, nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal utreexo roots notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
@@ -2114,6 +2178,31 @@ func handleNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
 	return nil, nil
 }
 
+// handleNotifyUtreexoRoots implements the notifyutreexoroots command extension
+// for websocket connections.
+func handleNotifyUtreexoRoots(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cfg := &wsc.server.cfg
+	if cfg.UtreexoProofIndex == nil && cfg.FlatUtreexoProofIndex == nil &&
+		!cfg.Chain.IsUtreexoViewActive() {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A utreexo proof index or utreexo must be enabled. " +
+				"(--utreexoproofindex) or (--flatutreexoproofindex) or (--utreexo)",
+		}
+	}
+
+	wsc.server.ntfnMgr.RegisterUtreexoRootsUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyUtreexoRoots implements the stopnotifyutreexoroots command
+// extension for websocket connections.
+func handleStopNotifyUtreexoRoots(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterUtreexoRootsUpdates(wsc)
+	return nil, nil
+}
+
 // handleSession implements the session command extension for websocket
 // connections.
 func handleSession(wsc *wsClient, icmd interface{}) (interface{}, error) {
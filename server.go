@@ -6,14 +6,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -22,6 +27,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/utreexo/utreexo"
 	"github.com/utreexo/utreexod/addrmgr"
 	"github.com/utreexo/utreexod/bdkwallet"
@@ -32,6 +40,7 @@ import (
 	"github.com/utreexo/utreexod/chaincfg"
 	"github.com/utreexo/utreexod/chaincfg/chainhash"
 	"github.com/utreexo/utreexod/connmgr"
+	"github.com/utreexo/utreexod/corebridge"
 	"github.com/utreexo/utreexod/database"
 	"github.com/utreexo/utreexod/electrum"
 	"github.com/utreexo/utreexod/mempool"
@@ -39,16 +48,19 @@ import (
 	"github.com/utreexo/utreexod/mining/cpuminer"
 	"github.com/utreexo/utreexod/netsync"
 	"github.com/utreexo/utreexod/peer"
+	"github.com/utreexo/utreexod/replication"
+	"github.com/utreexo/utreexod/rpcserver/grpc"
 	"github.com/utreexo/utreexod/txscript"
 	"github.com/utreexo/utreexod/wallet"
 	"github.com/utreexo/utreexod/wire"
+	"github.com/utreexo/utreexod/zmq"
 )
 
 const (
 	// defaultServices describes the default services that are supported by
 	// the server.
 	defaultServices = wire.SFNodeNetwork | wire.SFNodeNetworkLimited |
-		wire.SFNodeBloom | wire.SFNodeWitness
+		wire.SFNodeWitness
 
 	// defaultRequiredServices describes the default services that are
 	// required to be supported by outbound peers.
@@ -76,6 +88,14 @@ var (
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
 var zeroHash chainhash.Hash
 
+// errFilteredBlockLimit is returned when a peer requests more filtered blocks
+// than --maxpeerfilteredblocks allows.
+var errFilteredBlockLimit = errors.New("filtered block limit reached")
+
+// errUtreexoNotServed is returned when a peer requests utreexo data over a
+// listener that doesn't advertise the utreexo service.
+var errUtreexoNotServed = errors.New("utreexo data not served to peer")
+
 // onionAddr implements the net.Addr interface and represents a tor address.
 type onionAddr struct {
 	addr string
@@ -170,6 +190,39 @@ func (ps *peerState) Count() int {
 		len(ps.persistentPeers)
 }
 
+// staleTipEvictionCandidate returns the outbound peer to disconnect when the
+// tip at the given height has gone stale or nil if there isn't one.  When
+// utreexo is enabled, peers that don't serve utreexo proofs go first since they
+// can't help a compact state node catch up.  Otherwise the peer with the lowest
+// announced block goes and peers that announced blocks past the tip are kept.
+// Persistent peers are never disconnected.
+func (ps *peerState) staleTipEvictionCandidate(tipHeight int32) *serverPeer {
+	useless := func(sp *serverPeer) bool {
+		return !cfg.NoUtreexo && !servesUtreexoProofs(sp.Services())
+	}
+
+	var candidate *serverPeer
+	for _, sp := range ps.outboundPeers {
+		switch {
+		case !useless(sp) && sp.LastBlock() > tipHeight:
+			continue
+
+		case candidate == nil:
+			candidate = sp
+
+		case useless(sp) != useless(candidate):
+			if useless(sp) {
+				candidate = sp
+			}
+
+		case sp.LastBlock() < candidate.LastBlock():
+			candidate = sp
+		}
+	}
+
+	return candidate
+}
+
 // forAllOutboundPeers is a helper function that runs closure on all outbound
 // peers known to peerState.
 func (ps *peerState) forAllOutboundPeers(closure func(sp *serverPeer)) {
@@ -216,6 +269,7 @@ type server struct {
 	bytesReceived uint64 // Total bytes received from all peers since start.
 	bytesSent     uint64 // Total bytes sent by all peers since start.
 	txBytes       txByteStats
+	policyStats   peerPolicyStats
 	started       int32
 	shutdown      int32
 	shutdownSched int32
@@ -253,13 +307,79 @@ type server struct {
 	txIndex               *indexers.TxIndex
 	addrIndex             *indexers.AddrIndex
 	cfIndex               *indexers.CfIndex
+	leafDataIndex         *indexers.LeafDataIndex
 	utreexoProofIndex     *indexers.UtreexoProofIndex
 	flatUtreexoProofIndex *indexers.FlatUtreexoProofIndex
 
+	// indexManager manages the optional indexes above.  It's nil when none
+	// of them are enabled.
+	indexManager *indexers.Manager
+
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
 
+	// The smart fee estimator keeps track of how many blocks it takes for
+	// the transactions of each fee rate to confirm.  It's saved to the
+	// data directory on shutdown.
+	smartFeeEstimator *mempool.SmartFeeEstimator
+
+	// diskUsageMonitor keeps track of the on-disk size of the block database
+	// and the utreexo indexes.
+	diskUsageMonitor *diskUsageMonitor
+
+	// staleTipMonitor keeps track of when the tip last advanced.  It is nil
+	// if stale tip detection is disabled.
+	staleTipMonitor *staleTipMonitor
+
+	// blockScrubber keeps track of the background checks of the stored
+	// blocks and utreexo proofs.  It is nil if block scrubbing is disabled.
+	blockScrubber *blockScrubber
+
+	// servedProofs caches the utreexo proofs of the blocks recently served
+	// to peers.
+	servedProofs *servedProofCache
+
+	// proofAccess counts the utreexo proofs served over P2P, RPC and REST.
+	// It is nil if --proofaccessstats isn't set.
+	proofAccess *proofAccessStats
+
+	// blockRelaySlots keeps track of the automatic outbound connections
+	// that only relay blocks.
+	blockRelaySlots blockRelaySlots
+
+	// metricsServer serves the Prometheus metrics of the utreexo state.  It
+	// is nil if it's not enabled.
+	metricsServer *metricsServer
+
+	// zmqNotifier publishes blocks, transactions and utreexo roots to ZMQ
+	// subscribers.  It is nil if none of the topics are enabled.
+	zmqNotifier *zmq.Notifier
+
+	// grpcServer serves the gRPC API alongside the RPC server.  It is nil
+	// if it's not enabled.
+	grpcServer *grpc.Server
+
+	// onion is the Tor onion service for inbound connections.  It is nil if
+	// --listenonion isn't set.
+	onion *onionService
+
+	// coreBridge cross-feeds blocks and transactions with a Bitcoin Core
+	// node.  It is nil if it's not enabled.
+	coreBridge *corebridge.Bridge
+
+	// follower adds the blocks of the leader given with --replicatefrom.
+	// It is nil if it's not enabled.
+	follower *replication.Follower
+
+	// proofAuthKey signs the proofauth challenges of the nodes that pinned
+	// this one as a proof source.  It is nil if no proofs are served.
+	proofAuthKey *btcec.PrivateKey
+
+	// proofSources are the proof sources given with --proofsource keyed by
+	// their resolved address.
+	proofSources map[string]*proofSource
+
 	// watchOnlyWallet keeps track of addresses and extended pubkeys, allowing
 	// a watch-only wallet functionality.
 	watchOnlyWallet *wallet.WatchOnlyWalletManager
@@ -291,16 +411,38 @@ type serverPeer struct {
 	// The following variables must only be used atomically
 	feeFilter int64
 
+	// pendingProofs is the number of utreexo proofs that were queued for
+	// the peer but haven't been sent out yet.
+	pendingProofs int32
+
+	// cmpctBlocks is non-zero when the peer asked for new blocks to be
+	// announced with compact blocks carrying their utreexo proofs.
+	cmpctBlocks int32
+
+	// proofClientAuthed is non-zero once the peer authenticated with one
+	// of the tokens given with --proofauthtoken.
+	proofClientAuthed int32
+
+	// filteredBlocks is an exponentially decaying count of the filtered
+	// blocks served to the peer and lastFilteredBlock is the unix time it
+	// was last updated.  They're only accessed from the goroutine that
+	// handles the getdata messages of the peer.
+	filteredBlocks    float64
+	lastFilteredBlock int64
+
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
+	connClass      connClass
 	server         *server
 	persistent     bool
+	services       wire.ServiceFlag
 	continueHash   *chainhash.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
 	sentAddrs      bool
 	isWhitelisted  bool
+	isOnion        bool
 	filter         *bloom.Filter
 	addressesMtx   sync.RWMutex
 	knownAddresses map[string]struct{}
@@ -309,6 +451,24 @@ type serverPeer struct {
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
+
+	// proofSource is the proof source the peer was connected to as.  It's
+	// nil for the other peers.
+	proofSource *proofSource
+
+	// The following fields keep track of the proofauth handshake and are
+	// only used from the goroutine handling the messages of the peer.
+	proofAuthChallenge     [wire.ProofAuthChallengeSize]byte
+	proofAuthPeerChallenge [wire.ProofAuthChallengeSize]byte
+	proofAuthStarted       bool
+	proofAuthDone          bool
+	proofAuthTimer         *time.Timer
+
+	// proofSourceAuthed and addedToSync are set once a proof source is
+	// authenticated and known to the sync manager.
+	proofAuthMtx      sync.Mutex
+	proofSourceAuthed bool
+	addedToSync       bool
 }
 
 // newServerPeer returns a new serverPeer instance. The peer needs to be set by
@@ -317,6 +477,7 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 	return &serverPeer{
 		server:         s,
 		persistent:     isPersistent,
+		services:       s.services,
 		filter:         bloom.LoadFilter(nil),
 		knownAddresses: make(map[string]struct{}),
 		quit:           make(chan struct{}),
@@ -334,7 +495,7 @@ func (sp *serverPeer) newestBlock() (*chainhash.Hash, int32, error) {
 
 // addKnownAddresses adds the given addresses to the set of known addresses to
 // the peer to prevent sending duplicate addresses.
-func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
+func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddressV2) {
 	sp.addressesMtx.Lock()
 	for _, na := range addresses {
 		sp.knownAddresses[addrmgr.NetAddressKey(na)] = struct{}{}
@@ -343,7 +504,7 @@ func (sp *serverPeer) addKnownAddresses(addresses []*wire.NetAddress) {
 }
 
 // addressKnown true if the given address is already known to the peer.
-func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
+func (sp *serverPeer) addressKnown(na *wire.NetAddressV2) bool {
 	sp.addressesMtx.RLock()
 	_, exists := sp.knownAddresses[addrmgr.NetAddressKey(na)]
 	sp.addressesMtx.RUnlock()
@@ -370,13 +531,36 @@ func (sp *serverPeer) relayTxDisabled() bool {
 }
 
 // pushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.
-func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
-	// Filter addresses already known to the peer.
+// addresses.  An addrv2 message is sent instead if the peer asked for them.
+func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddressV2) {
+	if sp.WantsAddrV2() {
+		// Filter addresses already known to the peer.
+		addrs := make([]*wire.NetAddressV2, 0, len(addresses))
+		for _, addr := range addresses {
+			if !sp.addressKnown(addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+		known, err := sp.PushAddrV2Msg(addrs)
+		if err != nil {
+			peerLog.Errorf("Can't push addrv2 message to %s: %v",
+				sp.Peer, err)
+			sp.Disconnect()
+			return
+		}
+		sp.addKnownAddresses(known)
+		return
+	}
+
+	// Filter addresses already known to the peer and the ones that can't
+	// be sent in an addr message like torv3 and i2p addresses.
 	addrs := make([]*wire.NetAddress, 0, len(addresses))
 	for _, addr := range addresses {
-		if !sp.addressKnown(addr) {
-			addrs = append(addrs, addr)
+		if sp.addressKnown(addr) {
+			continue
+		}
+		if legacy := addr.ToLegacy(); legacy != nil {
+			addrs = append(addrs, legacy)
 		}
 	}
 	known, err := sp.PushAddrMsg(addrs)
@@ -385,7 +569,11 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 		sp.Disconnect()
 		return
 	}
-	sp.addKnownAddresses(known)
+	knownAddrs := make([]*wire.NetAddressV2, 0, len(known))
+	for _, na := range known {
+		knownAddrs = append(knownAddrs, wire.NetAddressV2FromLegacy(na))
+	}
+	sp.addKnownAddresses(knownAddrs)
 }
 
 // addBanScore increases the persistent and decaying ban score fields by the
@@ -398,7 +586,7 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) b
 	if cfg.DisableBanning {
 		return false
 	}
-	if sp.isWhitelisted {
+	if sp.isWhitelisted || sp.isProofAuthenticated() {
 		peerLog.Debugf("Misbehaving whitelisted peer %s: %s", sp, reason)
 		return false
 	}
@@ -510,8 +698,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 	sp.server.timeSource.AddTimeSample(sp.Addr(), msg.Timestamp)
 
 	// Choose whether or not to relay transactions before a filter command
-	// is received.
-	sp.setDisableRelayTx(msg.DisableRelayTx)
+	// is received.  They're never relayed to block-relay-only peers.
+	sp.setDisableRelayTx(msg.DisableRelayTx ||
+		sp.connClass == connClassBlockRelay)
 
 	return nil
 }
@@ -521,9 +710,26 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
 	sp.server.AddPeer(sp)
 
+	// Authenticate with the proof sources that require it before blocks
+	// and proofs are fetched from them.
+	if sp.proofSource != nil && sp.proofSource.authenticates() {
+		sp.startProofAuth()
+	}
+
 	// Let the peer know that we prefer headers over invs for block annoucements.
 	sendHeadersMsg := wire.NewMsgSendHeaders()
 	sp.QueueMessage(sendHeadersMsg, nil)
+
+	// Utreexo nodes ask utreexo peers for compact blocks carrying the
+	// utreexo proofs of new blocks so that they can be put together from
+	// the mempool without waiting on the summaries and proofs.
+	if sp.server.chain.IsUtreexoViewActive() && sp.IsUtreexoEnabled() &&
+		sp.ProtocolVersion() >= wire.BIP0152Version {
+
+		sendCmpctMsg := wire.NewMsgSendCmpct(true,
+			wire.CmpctBlockVersionUtreexo)
+		sp.QueueMessage(sendCmpctMsg, nil)
+	}
 }
 
 // OnMemPool is invoked when a peer receives a mempool bitcoin message.
@@ -533,7 +739,7 @@ func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
 func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	// Only allow mempool requests if the server has bloom filtering
 	// enabled.
-	if sp.server.services&wire.SFNodeBloom != wire.SFNodeBloom {
+	if sp.services&wire.SFNodeBloom != wire.SFNodeBloom {
 		peerLog.Debugf("peer %v sent mempool request with bloom "+
 			"filtering disabled -- disconnecting", sp)
 		sp.Disconnect()
@@ -633,6 +839,12 @@ func (sp *serverPeer) OnUtreexoTx(_ *peer.Peer, msg *wire.MsgUtreexoTx) {
 // OnBlock is invoked when a peer receives a block bitcoin message.  It
 // blocks until the bitcoin block has been fully processed.
 func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
+	// Blocks fetched again to replace a corrupted copy on disk don't go
+	// through the sync manager.
+	if sp.server.repairBlock(sp, msg) {
+		return
+	}
+
 	// Convert the raw MsgBlock to a btcutil.Block which provides some
 	// convenience methods and things such as hash caching.
 	block := btcutil.NewBlockFromBlockAndBytes(msg, buf)
@@ -705,6 +917,12 @@ func (sp *serverPeer) OnUtreexoSummaries(_ *peer.Peer, msg *wire.MsgUtreexoSumma
 	sp.server.syncManager.QueueUtreexoSummaries(msg, sp.Peer)
 }
 
+// OnUtreexoRoot is invoked when a peer receives a utreexo root bitcoin
+// message.  The message is passed down to the sync manager.
+func (sp *serverPeer) OnUtreexoRoot(_ *peer.Peer, msg *wire.MsgUtreexoRoot) {
+	sp.server.syncManager.QueueUtreexoRoot(msg, sp.Peer)
+}
+
 // handleGetData is invoked when a peer receives a getdata bitcoin message and
 // is used to deliver block and transaction information.
 func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
@@ -730,6 +948,10 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 	var waitChan chan struct{}
 	doneChan := make(chan struct{}, 1)
 
+	// Utreexo blocks and transactions are only served if they're advertised
+	// on the listener the peer connected to.
+	servesUtreexo := sp.services&wire.SFNodeUtreexo == wire.SFNodeUtreexo
+
 	for i := 0; i < len(msg.InvList); i++ {
 		iv := msg.InvList[i]
 
@@ -773,6 +995,11 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 				}
 			}
 
+			if !servesUtreexo {
+				err = errUtreexoNotServed
+				break
+			}
+
 			// All utreexo nodes are segwit nodes. Not including the witness will make it
 			// impossible to generate the leaf hashes since they're propagated in the compact
 			// form.
@@ -782,8 +1009,16 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 		case wire.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
 		case wire.InvTypeUtreexoBlock:
+			if !servesUtreexo {
+				err = errUtreexoNotServed
+				break
+			}
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.UtreexoEncoding)
 		case wire.InvTypeWitnessUtreexoBlock:
+			if !servesUtreexo {
+				err = errUtreexoNotServed
+				break
+			}
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.UtreexoEncoding|wire.WitnessEncoding)
 		case wire.InvTypeFilteredWitnessBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
@@ -902,6 +1137,12 @@ func (sp *serverPeer) OnGetUtreexoSummaries(_ *peer.Peer, msg *wire.MsgGetUtreex
 		return
 	}
 
+	// Ignore the request if utreexo data isn't served on the listener the
+	// peer connected to.
+	if sp.services&wire.SFNodeUtreexo != wire.SFNodeUtreexo {
+		return
+	}
+
 	height, err := sp.server.chain.BlockHeightByHash(&msg.StartHash)
 	if err != nil {
 		chanLog.Debugf("Unable to fetch height for block hash %v: %v",
@@ -1295,6 +1536,23 @@ func (sp *serverPeer) OnGetUtreexoProof(_ *peer.Peer, msg *wire.MsgGetUtreexoPro
 	if sp.server.utreexoProofIndex == nil && sp.server.flatUtreexoProofIndex == nil && cfg.NoUtreexo {
 		return
 	}
+	if sp.services&wire.SFNodeUtreexo != wire.SFNodeUtreexo {
+		return
+	}
+
+	// Bound the resources a single peer is able to tie up by ignoring
+	// requests that are too large or that pile up faster than the peer
+	// reads the responses.
+	if pending, ignore := sp.tooManyPendingProofs(); ignore {
+		peerLog.Debugf("Ignoring getutreexoproof from %s with %d proofs "+
+			"still waiting to be sent", sp, pending)
+		return
+	}
+	if numTargets := msg.NumLeafDatasRequested(); numTargets > cfg.MaxProofTargets {
+		peerLog.Debugf("Ignoring getutreexoproof from %s for %d targets "+
+			"(max %d)", sp, numTargets, cfg.MaxProofTargets)
+		return
+	}
 
 	height, err := sp.server.chain.BlockHeightByHash(&msg.BlockHash)
 	if err != nil {
@@ -1316,33 +1574,37 @@ func (sp *serverPeer) OnGetUtreexoProof(_ *peer.Peer, msg *wire.MsgGetUtreexoPro
 		return
 	}
 
-	// Fetch UData.
-	var udata *wire.UData
-	if !cfg.NoUtreexo {
-		udata = block.MsgBlock().UData
-	}
-	if sp.server.utreexoProofIndex != nil {
-		udata, err = sp.server.utreexoProofIndex.FetchUtreexoProof(&msg.BlockHash)
-		if err != nil {
-			chanLog.Debugf("Unable to fetch utreexo proof for block hash %v: %v",
-				msg.BlockHash, err)
-			return
+	// Fetch UData.  The reconstructed proofs are cached since the same
+	// recent blocks are asked for by every syncing peer.
+	udata, cached := sp.server.servedProofs.get(&msg.BlockHash, true)
+	if !cached {
+		if !cfg.NoUtreexo {
+			udata = block.MsgBlock().UData
 		}
-	}
-	if sp.server.flatUtreexoProofIndex != nil {
-		udata, err = sp.server.flatUtreexoProofIndex.FetchUtreexoProof(height)
+		if sp.server.utreexoProofIndex != nil {
+			udata, err = sp.server.utreexoProofIndex.FetchUtreexoProof(&msg.BlockHash)
+			if err != nil {
+				chanLog.Debugf("Unable to fetch utreexo proof for block hash %v: %v",
+					msg.BlockHash, err)
+				return
+			}
+		}
+		if sp.server.flatUtreexoProofIndex != nil {
+			udata, err = sp.server.flatUtreexoProofIndex.FetchUtreexoProof(height)
+			if err != nil {
+				chanLog.Debugf("Unable to fetch utreexo proof for block hash %v: %v",
+					msg.BlockHash, err)
+				return
+			}
+		}
+
+		_, err = sp.server.chain.ReconstructUData(udata, msg.BlockHash)
 		if err != nil {
 			chanLog.Debugf("Unable to fetch utreexo proof for block hash %v: %v",
 				msg.BlockHash, err)
 			return
 		}
-	}
-
-	_, err = sp.server.chain.ReconstructUData(udata, msg.BlockHash)
-	if err != nil {
-		chanLog.Debugf("Unable to fetch utreexo proof for block hash %v: %v",
-			msg.BlockHash, err)
-		return
+		sp.server.servedProofs.add(&msg.BlockHash, true, udata)
 	}
 
 	// Construct utreexo proof to send.
@@ -1365,7 +1627,29 @@ func (sp *serverPeer) OnGetUtreexoProof(_ *peer.Peer, msg *wire.MsgGetUtreexoPro
 		LeafDatas:   leafDatas,
 	}
 
-	sp.QueueMessage(&utreexoProof, nil)
+	proofSize := len(proofHashes) * chainhash.HashSize
+	for i := range leafDatas {
+		proofSize += leafDatas[i].SerializeSize()
+	}
+	if proofSize > cfg.MaxProofBytes {
+		peerLog.Debugf("Not sending the utreexo proof of %d bytes for "+
+			"block %v to %s (max %d)", proofSize, msg.BlockHash, sp,
+			cfg.MaxProofBytes)
+		return
+	}
+
+	// The done channel is always signaled, even when the peer disconnects
+	// before the proof is sent.
+	atomic.AddInt32(&sp.pendingProofs, 1)
+	doneChan := make(chan struct{}, 1)
+	go func() {
+		<-doneChan
+		atomic.AddInt32(&sp.pendingProofs, -1)
+	}()
+	sp.QueueMessage(&utreexoProof, doneChan)
+	sp.server.proofAccess.record(proofSourceP2P,
+		sp.server.chain.BestSnapshot().Height-height, len(leafDatas),
+		proofSize, sp.Addr())
 }
 
 // OnGetUtreexoRoot is invoked when a peer receives a getutreexoroot bitcoin message.
@@ -1379,6 +1663,9 @@ func (sp *serverPeer) OnGetUtreexoRoot(_ *peer.Peer, msg *wire.MsgGetUtreexoRoot
 	if sp.server.utreexoProofIndex == nil && sp.server.flatUtreexoProofIndex == nil {
 		return
 	}
+	if sp.services&wire.SFNodeUtreexo != wire.SFNodeUtreexo {
+		return
+	}
 
 	var err error
 	var utreexoRootMsg *wire.MsgUtreexoRoot
@@ -1403,6 +1690,148 @@ func (sp *serverPeer) OnGetUtreexoRoot(_ *peer.Peer, msg *wire.MsgGetUtreexoRoot
 	sp.QueueMessage(utreexoRootMsg, nil)
 }
 
+// OnGetUtreexoTxProof is invoked when a peer receives a getutxproof bitcoin
+// message.  The requested outpoints are proven against the current accumulator
+// and the ones that aren't in the utxo set are reported back as missing.
+func (sp *serverPeer) OnGetUtreexoTxProof(_ *peer.Peer, msg *wire.MsgGetUtreexoTxProof) {
+	// Ignore getutxproof requests if not in sync.
+	if !sp.server.syncManager.IsCurrent() {
+		return
+	}
+
+	// Check if we're a utreexo bridge node. Ignore if we're not.
+	if sp.server.utreexoProofIndex == nil && sp.server.flatUtreexoProofIndex == nil {
+		return
+	}
+	if sp.services&wire.SFNodeUtreexo != wire.SFNodeUtreexo {
+		return
+	}
+
+	if pending, ignore := sp.tooManyPendingProofs(); ignore {
+		peerLog.Debugf("Ignoring getutxproof from %s with %d proofs "+
+			"still waiting to be sent", sp, pending)
+		return
+	}
+	if numTargets := len(msg.OutPoints); numTargets > cfg.MaxProofTargets {
+		peerLog.Debugf("Ignoring getutxproof from %s for %d targets "+
+			"(max %d)", sp, numTargets, cfg.MaxProofTargets)
+		return
+	}
+
+	proofMsg, err := sp.server.utreexoTxProof(msg.OutPoints)
+	if err != nil {
+		chanLog.Debugf("Unable to prove the outpoints requested by %s: %v",
+			sp, err)
+		return
+	}
+	proofSize := proofMsg.SerializeSize()
+	if proofSize > cfg.MaxProofBytes {
+		peerLog.Debugf("Not sending the utreexo proof of %d bytes for "+
+			"%d outpoints to %s (max %d)", proofSize,
+			len(msg.OutPoints), sp, cfg.MaxProofBytes)
+		return
+	}
+
+	// The done channel is always signaled, even when the peer disconnects
+	// before the proof is sent.
+	atomic.AddInt32(&sp.pendingProofs, 1)
+	doneChan := make(chan struct{}, 1)
+	go func() {
+		<-doneChan
+		atomic.AddInt32(&sp.pendingProofs, -1)
+	}()
+	sp.QueueMessage(proofMsg, doneChan)
+
+	// The outpoints are proven against the tip.
+	sp.server.proofAccess.record(proofSourceP2P, 0, len(proofMsg.LeafDatas),
+		proofSize, sp.Addr())
+}
+
+// utreexoTxProof returns the utxproof message that proves the given outpoints
+// against the current accumulator of whichever utreexo proof index is enabled.
+// The outpoints that aren't in the utxo set are left out of the proof and are
+// listed as missing.
+func (s *server) utreexoTxProof(outPoints []wire.OutPoint) (*wire.MsgUtreexoTxProof, error) {
+	msg := &wire.MsgUtreexoTxProof{}
+	utxos := make([]*blockchain.UtxoEntry, 0, len(outPoints))
+	found := make([]wire.OutPoint, 0, len(outPoints))
+	for _, outPoint := range outPoints {
+		utxo, err := s.chain.FetchUtxoEntry(outPoint)
+		if err != nil {
+			return nil, err
+		}
+		if utxo == nil || utxo.IsSpent() {
+			msg.Missing = append(msg.Missing, outPoint)
+			continue
+		}
+
+		utxos = append(utxos, utxo)
+		found = append(found, outPoint)
+	}
+
+	var (
+		proof *blockchain.ChainTipProof
+		err   error
+	)
+	if s.utreexoProofIndex != nil {
+		proof, err = s.utreexoProofIndex.ProveUtxos(utxos, &found)
+	} else {
+		proof, err = s.flatUtreexoProofIndex.ProveUtxos(utxos, &found)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.BlockHash = *proof.ProvedAtHash
+	msg.AccProof = *proof.AccProof
+
+	// The proof only commits to the leaf hashes so the leaf datas are sent
+	// along for the requester to check them against.
+	msg.LeafDatas = make([]wire.LeafData, 0, len(utxos))
+	for i, utxo := range utxos {
+		blockHash, err := s.chain.BlockHashByHeight(utxo.BlockHeight())
+		if err != nil {
+			return nil, err
+		}
+		msg.LeafDatas = append(msg.LeafDatas, wire.LeafData{
+			BlockHash:  *blockHash,
+			OutPoint:   found[i],
+			Amount:     utxo.Amount(),
+			PkScript:   utxo.PkScript(),
+			Height:     utxo.BlockHeight(),
+			IsCoinBase: utxo.IsCoinBase(),
+		})
+	}
+
+	return msg, nil
+}
+
+// proveBlockFromPool returns the utreexo proof of the outputs spent by the
+// passed block, which must extend the tip of the chain, from the leaf datas of
+// its transactions in the memory pool.  It's used to mine blocks on nodes that
+// only keep the accumulator: the leaves the pool transactions spend are cached
+// in the accumulator when they're accepted.
+func (s *server) proveBlockFromPool(block *btcutil.Block) (*wire.UData, error) {
+	var dels []wire.LeafData
+	for _, tx := range block.Transactions()[1:] {
+		leaves, err := s.txMemPool.FetchLeafDatas(tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("unable to prove tx %v: %v",
+				tx.Hash(), err)
+		}
+
+		// The outputs that are still unconfirmed are created in the
+		// block and aren't in the accumulator.
+		for _, ld := range leaves {
+			if ld.IsUnconfirmed() {
+				continue
+			}
+			dels = append(dels, ld)
+		}
+	}
+
+	return s.chain.GenerateUData(dels)
+}
+
 // OnUtreexoProof is invoked when a peer receives a utreexoproof bitcoin message.
 func (sp *serverPeer) OnUtreexoProof(_ *peer.Peer, msg *wire.MsgUtreexoProof) {
 	sp.server.syncManager.QueueUtreexoProof(msg, sp.Peer)
@@ -1413,7 +1842,7 @@ func (sp *serverPeer) OnUtreexoProof(_ *peer.Peer, msg *wire.MsgUtreexoProof) {
 // version  that is high enough to observe the bloom filter service support bit,
 // it will be banned since it is intentionally violating the protocol.
 func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
-	if sp.server.services&wire.SFNodeBloom != wire.SFNodeBloom {
+	if sp.services&wire.SFNodeBloom != wire.SFNodeBloom {
 		// Ban the peer if the protocol version is high enough that the
 		// peer is knowingly violating the protocol and banning is
 		// enabled.
@@ -1470,6 +1899,13 @@ func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *wire.MsgFilterAdd) {
 		return
 	}
 
+	// A decaying ban score increase is applied to prevent flooding as
+	// every added element changes the filter that's matched against the
+	// relayed transactions and blocks.
+	if sp.addBanScore(0, 1, "filteradd") {
+		return
+	}
+
 	if !sp.filter.IsLoaded() {
 		peerLog.Debugf("%s sent a filteradd request with no filter "+
 			"loaded -- disconnecting", sp)
@@ -1513,6 +1949,13 @@ func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *wire.MsgFilterLoad) {
 		return
 	}
 
+	// A decaying ban score increase is applied to prevent flooding.  SPV
+	// clients load a filter once a connection and only reload it now and
+	// then, so a burst of loads passes the ban threshold.
+	if sp.addBanScore(0, 20, "filterload") {
+		return
+	}
+
 	sp.setDisableRelayTx(false)
 
 	sp.filter.Reload(msg)
@@ -1557,6 +2000,27 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 // OnAddr is invoked when a peer receives an addr bitcoin message and is
 // used to notify the server about advertised addresses.
 func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
+	// Ignore old style addresses which don't include a timestamp.
+	if sp.ProtocolVersion() < wire.NetAddressTimeVersion {
+		return
+	}
+
+	addrs := make([]*wire.NetAddressV2, 0, len(msg.AddrList))
+	for _, na := range msg.AddrList {
+		addrs = append(addrs, wire.NetAddressV2FromLegacy(na))
+	}
+	sp.handleAddresses(msg.Command(), addrs)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	sp.handleAddresses(msg.Command(), msg.AddrList)
+}
+
+// handleAddresses adds the addresses advertised by the peer in an addr or
+// addrv2 message to the address manager.
+func (sp *serverPeer) handleAddresses(command string, addrList []*wire.NetAddressV2) {
 	// Ignore addresses when running on the simulation test network.  This
 	// helps prevent the network from becoming another public test network
 	// since it will not be able to learn about other peers that have not
@@ -1565,20 +2029,22 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
-	// Ignore old style addresses which don't include a timestamp.
-	if sp.ProtocolVersion() < wire.NetAddressTimeVersion {
+	// Addresses aren't relayed over block-relay-only connections.
+	if sp.connClass == connClassBlockRelay {
+		peerLog.Debugf("Ignoring addresses from block-relay-only peer "+
+			"%v", sp)
 		return
 	}
 
 	// A message that has no addresses is invalid.
-	if len(msg.AddrList) == 0 {
+	if len(addrList) == 0 {
 		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
-			msg.Command(), sp.Peer)
+			command, sp.Peer)
 		sp.Disconnect()
 		return
 	}
 
-	for _, na := range msg.AddrList {
+	for _, na := range addrList {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -1593,7 +2059,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		}
 
 		// Add address to known addresses for this peer.
-		sp.addKnownAddresses([]*wire.NetAddress{na})
+		sp.addKnownAddresses([]*wire.NetAddressV2{na})
 	}
 
 	// Add addresses to server address manager.  The address manager handles
@@ -1601,7 +2067,7 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrList, sp.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
@@ -1749,6 +2215,14 @@ func (s *server) AnnounceNewTransactions(txns []*mempool.TxDesc) {
 	if s.watchOnlyWallet != nil {
 		s.watchOnlyWallet.NotifyNewTransactions(txns)
 	}
+
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.NotifyNewTransactions(txns)
+	}
+
+	if s.coreBridge != nil {
+		s.coreBridge.NotifyNewTransactions(txns)
+	}
 }
 
 // Transaction has one confirmation on the main chain. Now we can mark it as no
@@ -1908,6 +2382,39 @@ func (s *server) pushTxMsg(sp *serverPeer, hash *chainhash.Hash, packedPositions
 	return nil
 }
 
+// fetchUData returns the utreexo accumulator proof of the block with the given
+// hash to serve to a peer.  The returned proof may be shared with other peers
+// through the served proof cache and must not be modified.
+func (s *server) fetchUData(hash *chainhash.Hash) (*wire.UData, error) {
+	if ud, ok := s.servedProofs.get(hash, false); ok {
+		return ud, nil
+	}
+
+	ud, err := s.fetchStoredUData(hash)
+	if err != nil {
+		return nil, err
+	}
+	s.servedProofs.add(hash, false, ud)
+	return ud, nil
+}
+
+// fetchStoredUData returns the utreexo accumulator proof of the block with the
+// given hash from whichever of the proof indexes is active.
+func (s *server) fetchStoredUData(hash *chainhash.Hash) (*wire.UData, error) {
+	if s.utreexoProofIndex != nil {
+		return s.utreexoProofIndex.FetchUtreexoProof(hash)
+	}
+	if s.flatUtreexoProofIndex == nil {
+		return nil, fmt.Errorf("no utreexo proof index is active")
+	}
+
+	height, err := s.chain.BlockHeightByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.flatUtreexoProofIndex.FetchUtreexoProof(height)
+}
+
 // pushBlockMsg sends a block message for the provided block hash to the
 // connected peer.  An error is returned if the block hash is not known.
 func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{},
@@ -1957,46 +2464,28 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 
 	// Fetch the Utreexo accumulator proof.
 	if doUtreexo && msgBlock.UData == nil {
-		var ud *wire.UData
-
-		// We already checked that at least one is active.  Pick one and
-		// generate the UData.
-		if s.utreexoProofIndex != nil {
-			ud, err = s.utreexoProofIndex.FetchUtreexoProof(hash)
-			if err != nil {
-				peerLog.Debugf("Unable to fetch requested utreexo data for block hash %v: %v",
-					hash, err)
-
-				if doneChan != nil {
-					doneChan <- struct{}{}
-				}
-				return err
-			}
-		} else {
-			height, err := s.chain.BlockHeightByHash(hash)
-			if err != nil {
-				chanLog.Debugf("Unable to fetch height for block hash %v: %v",
-					hash, err)
-
-				if doneChan != nil {
-					doneChan <- struct{}{}
-				}
-				return err
-			}
-			ud, err = s.flatUtreexoProofIndex.FetchUtreexoProof(height)
-			if err != nil {
-				peerLog.Debugf("Unable to fetch requested utreexo data for block hash %v: %v",
-					hash, err)
+		ud, err := s.fetchUData(hash)
+		if err != nil {
+			peerLog.Debugf("Unable to fetch requested utreexo data for block hash %v: %v",
+				hash, err)
 
-				if doneChan != nil {
-					doneChan <- struct{}{}
-				}
-				return err
+			if doneChan != nil {
+				doneChan <- struct{}{}
 			}
+			return err
 		}
 
 		msgBlock.UData = ud
 	}
+	if doUtreexo && s.proofAccess != nil {
+		height, err := s.chain.BlockHeightByHash(hash)
+		if err == nil {
+			s.proofAccess.record(proofSourceP2P,
+				s.chain.BestSnapshot().Height-height,
+				len(msgBlock.UData.AccProof.Targets),
+				msgBlock.UData.SerializeSize(), sp.Addr())
+		}
+	}
 
 	// Once we have fetched data wait for any previous operation to finish.
 	if waitChan != nil {
@@ -2029,10 +2518,33 @@ func (s *server) pushBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan cha
 	return nil
 }
 
+// allowFilteredBlock returns whether another filtered block may be served to
+// the peer without going over --maxpeerfilteredblocks.  The served blocks are
+// counted with an exponentially decaying one minute window so that filtering
+// blocks for a single peer can't tie up the server.
+func (sp *serverPeer) allowFilteredBlock() bool {
+	if cfg.MaxPeerFilteredBlocks == 0 {
+		return true
+	}
+
+	nowUnix := time.Now().Unix()
+	sp.filteredBlocks *= math.Pow(1.0-1.0/60.0,
+		float64(nowUnix-sp.lastFilteredBlock))
+	sp.lastFilteredBlock = nowUnix
+
+	if sp.filteredBlocks >= float64(cfg.MaxPeerFilteredBlocks) {
+		return false
+	}
+	sp.filteredBlocks++
+
+	return true
+}
+
 // pushMerkleBlockMsg sends a merkleblock message for the provided block hash to
 // the connected peer.  Since a merkle block requires the peer to have a filter
 // loaded, this call will simply be ignored if there is no filter loaded.  An
-// error is returned if the block hash is not known.
+// error is returned if the block hash is not known or if the peer requested
+// more filtered blocks than it's allowed to.
 func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 	doneChan chan<- struct{}, waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
@@ -2044,11 +2556,22 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash,
 		return nil
 	}
 
-	// Fetch the raw block bytes from the database.
-	blk, err := sp.server.chain.BlockByHash(hash)
-	if err != nil {
-		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
-			hash, err)
+	if !sp.allowFilteredBlock() {
+		peerLog.Debugf("Peer %v requested more than %d filtered blocks "+
+			"per minute -- not serving block %v", sp,
+			cfg.MaxPeerFilteredBlocks, hash)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return errFilteredBlockLimit
+	}
+
+	// Fetch the raw block bytes from the database.
+	blk, err := sp.server.chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
 
 		if doneChan != nil {
 			doneChan <- struct{}{}
@@ -2125,8 +2648,8 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		return false
 	}
 
-	// Disconnect peers with unwanted user agents.
-	if sp.HasUndesiredUserAgent(s.agentBlacklist, s.agentWhitelist) {
+	// Disconnect peers refused by the connection policies.
+	if s.refusedByPolicy(sp) {
 		sp.Disconnect()
 		return false
 	}
@@ -2138,14 +2661,15 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		return false
 	}
 
-	// Disconnect banned peers.
+	// Disconnect banned peers.  Peers of the onion service are never
+	// banned since they all come from localhost.
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
 		srvrLog.Debugf("can't split hostport %v", err)
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
+	if banEnd, ok := state.banned[host]; ok && !sp.isOnion {
 		if time.Now().Before(banEnd) {
 			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
 				host, time.Until(banEnd))
@@ -2159,6 +2683,20 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// TODO: Check for max peers from a single IP.
 
+	// Make room for inbound peers that aren't deprioritized by evicting
+	// one that is.
+	deprioritized := sp.isDeprioritized()
+	if state.Count() >= cfg.MaxPeers && sp.Inbound() && !deprioritized {
+		if evict := state.deprioritizedEvictionCandidate(); evict != nil {
+			srvrLog.Infof("Max peers reached [%d] - evicting "+
+				"deprioritized peer %s for peer %s", cfg.MaxPeers,
+				evict, sp)
+			atomic.AddUint64(&s.policyStats.deprioritizedEvicted, 1)
+			delete(state.inboundPeers, evict.ID())
+			evict.Disconnect()
+		}
+	}
+
 	// Limit max number of total peers.
 	if state.Count() >= cfg.MaxPeers {
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
@@ -2171,6 +2709,11 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// Add the new peer and start it.
 	srvrLog.Debugf("New peer %s", sp)
+	if deprioritized {
+		srvrLog.Debugf("Deprioritizing peer %s with user agent %s", sp,
+			sp.UserAgent())
+		atomic.AddUint64(&s.policyStats.deprioritized, 1)
+	}
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
@@ -2190,13 +2733,17 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 
 	// Signal the sync manager this peer is a new sync candidate.
 	s.syncManager.NewPeer(sp.Peer)
+	if sp.proofSource != nil {
+		sp.proofSourceReady(false, true)
+	}
 
 	// Update the address manager and request known addresses from the
 	// remote peer for outbound connections. This is skipped when running on
 	// the simulation test network since it is only intended to connect to
 	// specified peers and actively avoids advertising and connecting to
-	// discovered peers.
-	if !cfg.SimNet && !sp.Inbound() {
+	// discovered peers.  Addresses aren't relayed over block-relay-only
+	// connections.
+	if !cfg.SimNet && !sp.Inbound() && sp.connClass != connClassBlockRelay {
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
 		// known tip.
@@ -2205,7 +2752,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			lna := s.addrManager.GetBestLocalAddress(sp.NA())
 			if addrmgr.IsRoutable(lna) {
 				// Filter addresses the peer already knows about.
-				addresses := []*wire.NetAddress{lna}
+				addresses := []*wire.NetAddressV2{lna}
 				sp.pushAddrMsg(addresses)
 			}
 		}
@@ -2241,9 +2788,28 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	// our connection manager about the disconnection. This can happen if we
 	// process a peer's `done` message before its `add`.
 	if !sp.Inbound() {
+		// Peers that disconnected before sending their key for the v2
+		// transport are most likely peers that only support v1, so
+		// they're connected to again right away with v1.  Persistent
+		// peers are retried with it by the connection manager.
+		reconnectV1 := sp.ShouldReconnectV1()
+		if reconnectV1 {
+			fallBackToV1(sp)
+		}
+
 		if sp.persistent {
 			s.connManager.Disconnect(sp.connReq.ID())
+		} else if reconnectV1 {
+			// The connection keeps its class, along with the
+			// block-relay-only slot it holds.
+			s.connManager.Remove(sp.connReq.ID())
+			go s.connManager.Connect(&connmgr.ConnReq{
+				Addr: sp.connReq.Addr,
+			})
 		} else {
+			if sp.connClass == connClassBlockRelay {
+				s.blockRelaySlots.release()
+			}
 			s.connManager.Remove(sp.connReq.ID())
 			go s.connManager.NewConnReq()
 		}
@@ -2262,6 +2828,15 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 // handleBanPeerMsg deals with banning peers.  It is invoked from the
 // peerHandler goroutine.
 func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
+	// The peers of the onion service all connect from localhost through
+	// Tor, so banning the host would ban all of them.  They're only
+	// disconnected.
+	if sp.isOnion {
+		srvrLog.Infof("Disconnected misbehaving onion service peer %s "+
+			"without banning it", sp)
+		return
+	}
+
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
 		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
@@ -2384,6 +2959,16 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					" is not a block header")
 				return
 			}
+
+			// Peers that asked for compact blocks get one instead.
+			// The block is read from the database so don't hold up
+			// the relaying to the other peers.
+			if sp.wantsCmpctBlocks() {
+				go s.pushCmpctBlock(sp, &msg.invVect.Hash,
+					&blockHeader)
+				return
+			}
+
 			msgHeaders := wire.NewMsgHeaders()
 			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
 				peerLog.Errorf("Failed to add block"+
@@ -2475,6 +3060,10 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
+type getArchivalBridgeCountMsg struct {
+	reply chan int
+}
+
 type getAddedNodesMsg struct {
 	reply chan []*serverPeer
 }
@@ -2544,7 +3133,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 
 		// TODO: if too many, nuke a non-perm peer.
 		go s.connManager.Connect(&connmgr.ConnReq{
-			Addr:      netAddr,
+			Addr:      &classAddr{Addr: netAddr, class: s.relayConnClass()},
 			Permanent: msg.permanent,
 		})
 		msg.reply <- nil
@@ -2567,6 +3156,14 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
+	case getArchivalBridgeCountMsg:
+		count := 0
+		for _, sp := range state.outboundPeers {
+			if sp.Connected() && isArchivalBridge(sp.Services()) {
+				count++
+			}
+		}
+		msg.reply <- count
 	// Request a list of the persistent (added) peers.
 	case getAddedNodesMsg:
 		// Respond with a slice of the relevant peers.
@@ -2644,9 +3241,16 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnInv:                 sp.OnInv,
 			OnHeaders:             sp.OnHeaders,
 			OnUtreexoSummaries:    sp.OnUtreexoSummaries,
+			OnUtreexoRoot:         sp.OnUtreexoRoot,
 			OnUtreexoProof:        sp.OnUtreexoProof,
 			OnGetUtreexoProof:     sp.OnGetUtreexoProof,
 			OnGetUtreexoRoot:      sp.OnGetUtreexoRoot,
+			OnGetUtreexoTxProof:   sp.OnGetUtreexoTxProof,
+			OnSendCmpct:           sp.OnSendCmpct,
+			OnCmpctBlock:          sp.OnCmpctBlock,
+			OnGetBlockTxn:         sp.OnGetBlockTxn,
+			OnBlockTxn:            sp.OnBlockTxn,
+			OnProofAuth:           sp.OnProofAuth,
 			OnGetData:             sp.OnGetData,
 			OnGetBlocks:           sp.OnGetBlocks,
 			OnGetHeaders:          sp.OnGetHeaders,
@@ -2660,6 +3264,7 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnFilterLoad:          sp.OnFilterLoad,
 			OnGetAddr:             sp.OnGetAddr,
 			OnAddr:                sp.OnAddr,
+			OnAddrV2:              sp.OnAddrV2,
 			OnRead:                sp.OnRead,
 			OnWrite:               sp.OnWrite,
 			OnNotFound:            sp.OnNotFound,
@@ -2677,20 +3282,53 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		UserAgentVersion:  userAgentVersion,
 		UserAgentComments: cfg.UserAgentComments,
 		ChainParams:       sp.server.chainParams,
-		Services:          sp.server.services,
-		DisableRelayTx:    cfg.BlocksOnly,
+		Services:          sp.services,
+		DisableRelayTx:    cfg.BlocksOnly || sp.connClass == connClassBlockRelay,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 		TrickleInterval:   cfg.TrickleInterval,
+		V2Transport:       !cfg.NoV2Transport,
 	}
 }
 
+// useV2Transport returns whether the outbound connection to addr should start
+// with the handshake of the v2 transport.  The addresses from the address
+// manager only use it when they're known to support it while the peers given by
+// the user are tried with it first.  It's not used for the peers that failed the
+// handshake.
+func useV2Transport(addr net.Addr) bool {
+	if cfg.NoV2Transport {
+		return false
+	}
+
+	ca, ok := addr.(*classAddr)
+	return !ok || !ca.v1
+}
+
+// fallBackToV1 marks the connection request of the outbound peer that failed
+// the handshake of the v2 transport so that it's connected to again with the v1
+// transport.  Persistent peers keep their request, so they stay on v1 from then
+// on.  Other peers are only connected to with v2 again once the address manager
+// learns from their version message that they support it.
+func fallBackToV1(sp *serverPeer) {
+	addr := sp.connReq.Addr
+	srvrLog.Debugf("Peer %s didn't finish the v2 transport handshake, "+
+		"reconnecting with v1", addr)
+
+	if ca, ok := addr.(*classAddr); ok {
+		addr = ca.Addr
+	}
+	sp.connReq.Addr = &classAddr{Addr: addr, class: sp.connClass, v1: true}
+}
+
 // inboundPeerConnected is invoked by the connection manager when a new inbound
 // connection is established.  It initializes a new inbound server peer
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
 	sp := newServerPeer(s, false)
+	sp.services = connServices(conn, s.services)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
+	sp.isOnion = isOnionConn(conn)
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
@@ -2703,12 +3341,23 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	sp.connClass = connClassOf(c.Addr)
+	sp.proofSource = s.proofSources[c.Addr.String()]
+	if sp.proofSource != nil && !sp.proofSource.authenticates() {
+		sp.proofSourceAuthed = true
+	}
+	peerCfg := newPeerConfig(sp)
+	peerCfg.Proxy = connClassProxy(sp.connClass)
+	peerCfg.V2Transport = useV2Transport(c.Addr)
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		if c.Permanent {
 			s.connManager.Disconnect(c.ID())
 		} else {
+			if sp.connClass == connClassBlockRelay {
+				s.blockRelaySlots.release()
+			}
 			s.connManager.Remove(c.ID())
 			go s.connManager.NewConnReq()
 		}
@@ -2718,9 +3367,31 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp.connReq = c
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.AssociateConnection(conn)
+	srvrLog.Debugf("Connected to %s peer %s", sp.connClass, c.Addr)
 	go s.peerDoneHandler(sp)
 }
 
+// relayConnClass returns the class of the outbound connections that relay
+// transactions.  A CSN requests the proofs of the transactions it learns about
+// from these peers so they're proof connections when the utreexo view is
+// active.
+func (s *server) relayConnClass() connClass {
+	if s.chain.IsUtreexoViewActive() {
+		return connClassProof
+	}
+	return connClassFullRelay
+}
+
+// dialOutbound dials the outbound connection to addr and frees the slot of a
+// block-relay-only connection that couldn't be made.
+func (s *server) dialOutbound(addr net.Addr) (net.Conn, error) {
+	conn, err := btcdDial(addr)
+	if err != nil && connClassOf(addr) == connClassBlockRelay {
+		s.blockRelaySlots.release()
+	}
+	return conn, err
+}
+
 // peerDoneHandler handles peer disconnects by notifiying the server that it's
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
@@ -2742,6 +3413,56 @@ func (s *server) peerDoneHandler(sp *serverPeer) {
 	close(sp.quit)
 }
 
+// seedFromDNS adds the peers discovered through the DNS seeds to the address
+// manager unless DNS seeding is disabled.
+func (s *server) seedFromDNS() {
+	if cfg.DisableDNSSeed {
+		return
+	}
+
+	requiredServices := defaultRequiredServices
+	if !cfg.NoUtreexo {
+		requiredServices |= wire.SFNodeUtreexo
+	}
+	connmgr.SeedFromDNS(activeNetParams.Params, requiredServices,
+		btcdLookup, func(addrs []*wire.NetAddress) {
+			// Bitcoind uses a lookup of the dns seeder here. This
+			// is rather strange since the values looked up by the
+			// DNS seed lookups will vary quite a lot.
+			// to replicate this behaviour we put all addresses as
+			// having come from the first one.
+			addrsV2 := make([]*wire.NetAddressV2, 0, len(addrs))
+			for _, na := range addrs {
+				addrsV2 = append(addrsV2,
+					wire.NetAddressV2FromLegacy(na))
+			}
+			s.addrManager.AddAddresses(addrsV2, addrsV2[0])
+		})
+}
+
+// handleStaleTipCheck checks whether the tip has gone stale and, if it has,
+// raises a warning, queries the DNS seeds again and disconnects the outbound
+// peer that's least likely to give us new blocks so that the connection manager
+// replaces it with a new one.
+//
+// It must only be called from the peerHandler goroutine.
+func (s *server) handleStaleTipCheck(state *peerState) {
+	best := s.chain.BestSnapshot()
+	if !s.staleTipMonitor.check(time.Now(), best.Hash, best.Height) {
+		return
+	}
+	srvrLog.Warnf("%s. Refreshing the outbound peers",
+		s.staleTipMonitor.Warning())
+
+	s.seedFromDNS()
+
+	if sp := state.staleTipEvictionCandidate(best.Height); sp != nil {
+		srvrLog.Infof("Disconnecting outbound peer %v (last block %d) to "+
+			"look for peers with newer blocks", sp, sp.LastBlock())
+		sp.Disconnect()
+	}
+}
+
 // peerHandler is used to handle peer operations such as adding and removing
 // peers to and from the server, banning peers, and broadcasting messages to
 // peers.  It must be run in a goroutine.
@@ -2753,6 +3474,9 @@ func (s *server) peerHandler() {
 	// in this handler.
 	s.addrManager.Start()
 	s.syncManager.Start()
+	if s.indexManager != nil {
+		s.indexManager.Start()
+	}
 
 	srvrLog.Tracef("Starting peer handler")
 
@@ -2764,27 +3488,24 @@ func (s *server) peerHandler() {
 		outboundGroups:  make(map[string]int),
 	}
 
-	if !cfg.DisableDNSSeed {
-		requiredServices := defaultRequiredServices
-		if !cfg.NoUtreexo {
-			requiredServices |= wire.SFNodeUtreexo
-		}
-		// Add peers discovered through DNS to the address manager.
-		connmgr.SeedFromDNS(activeNetParams.Params, requiredServices,
-			btcdLookup, func(addrs []*wire.NetAddress) {
-				// Bitcoind uses a lookup of the dns seeder here. This
-				// is rather strange since the values looked up by the
-				// DNS seed lookups will vary quite a lot.
-				// to replicate this behaviour we put all addresses as
-				// having come from the first one.
-				s.addrManager.AddAddresses(addrs, addrs[0])
-			})
-	}
+	s.seedFromDNS()
 	go s.connManager.Start()
 
+	// The tip is only checked for being stale when it's enabled.
+	var staleTipCheck <-chan time.Time
+	if s.staleTipMonitor != nil {
+		ticker := time.NewTicker(staleTipCheckInterval)
+		defer ticker.Stop()
+		staleTipCheck = ticker.C
+	}
+
 out:
 	for {
 		select {
+		// Time to check whether the tip went stale.
+		case <-staleTipCheck:
+			s.handleStaleTipCheck(state)
+
 		// New peers connected to the server.
 		case p := <-s.newPeers:
 			s.handleAddPeerMsg(state, p)
@@ -2824,23 +3545,30 @@ out:
 	}
 
 	s.connManager.Stop()
+	if s.onion != nil {
+		if err := s.onion.Close(); err != nil {
+			srvrLog.Errorf("Unable to remove the onion service: %v", err)
+		}
+	}
 	s.syncManager.Stop()
 	s.addrManager.Stop()
 
+	// Stop catching up the indexes in the background before their states
+	// are flushed and closed below.
+	if s.indexManager != nil {
+		s.indexManager.Stop()
+	}
+
 	// If utreexoProofIndex option is on, flush it after closing down syncManager.
 	if s.utreexoProofIndex != nil {
-		err := s.utreexoProofIndex.CloseUtreexoState()
-		if err != nil {
-			btcdLog.Errorf("Error while flushing utreexo state: %v", err)
-		}
+		closeUtreexoState(s.utreexoProofIndex.CloseUtreexoState,
+			cfg.UtreexoShutdownTimeout)
 	}
 
 	// If flatUtreexoProofIndex option is on, flush it after closing down syncManager.
 	if s.flatUtreexoProofIndex != nil {
-		err := s.flatUtreexoProofIndex.CloseUtreexoState()
-		if err != nil {
-			btcdLog.Errorf("Error while flushing utreexo state: %v", err)
-		}
+		closeUtreexoState(s.flatUtreexoProofIndex.CloseUtreexoState,
+			cfg.UtreexoShutdownTimeout)
 	}
 
 	// Drain channels before exiting so nothing is left waiting around
@@ -2904,6 +3632,14 @@ func (s *server) OutboundGroupCount(key string) int {
 	return <-replyChan
 }
 
+// ArchivalBridgeCount returns the number of connected outbound peers that are
+// archival bridges.
+func (s *server) ArchivalBridgeCount() int {
+	replyChan := make(chan int)
+	s.query <- getArchivalBridgeCountMsg{reply: replyChan}
+	return <-replyChan
+}
+
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *server) AddBytesSent(bytesSent uint64) {
@@ -3079,6 +3815,20 @@ func (s *server) Start() {
 		go s.upnpUpdateThread()
 	}
 
+	// Start the blockScrubHandler, which reads back the stored blocks and
+	// proofs to catch the ones corrupted on disk.
+	if s.blockScrubber != nil {
+		s.wg.Add(1)
+		go s.blockScrubHandler()
+	}
+
+	// Start the compactionHandler, which does the heavy compactions of the
+	// utreexo proof indexes in the configured windows.
+	if len(cfg.compactWindows) > 0 {
+		s.wg.Add(1)
+		go s.compactionHandler()
+	}
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
@@ -3086,9 +3836,46 @@ func (s *server) Start() {
 		// the RPC server are rebroadcast until being included in a block.
 		go s.rebroadcastHandler()
 
+		// Start the diskUsageHandler, which samples the disk usage
+		// for the growth forecasts served by the RPC server.
+		s.wg.Add(1)
+		go s.diskUsageHandler()
+
 		s.rpcServer.Start()
 	}
 
+	// Start the readReplicaHandler, which hands off snapshots of the flat
+	// utreexo proof index to the read replicas.
+	if cfg.ReadReplicaDir != "" {
+		s.wg.Add(1)
+		go s.readReplicaHandler()
+	}
+
+	// Start the gRPC server if it's enabled.
+	if s.grpcServer != nil {
+		s.grpcServer.Start()
+	}
+
+	// Start the metrics server if it's enabled.
+	if s.metricsServer != nil {
+		s.metricsServer.Start()
+	}
+
+	// Start publishing ZMQ notifications if they're enabled.
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.Start()
+	}
+
+	// Start the bridge with Bitcoin Core if it's enabled.
+	if s.coreBridge != nil {
+		s.coreBridge.Start()
+	}
+
+	// Start following the leader if replication is enabled.
+	if s.follower != nil {
+		s.follower.Start()
+	}
+
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
@@ -3101,6 +3888,72 @@ func (s *server) Start() {
 	}
 }
 
+// diskUsageHandler periodically samples the on-disk size of the block database
+// and the indexes so that their growth rates can be forecasted.
+//
+// It must be run as a goroutine.
+func (s *server) diskUsageHandler() {
+	timer := time.NewTimer(0)
+
+out:
+	for {
+		select {
+		case <-timer.C:
+			err := s.diskUsageMonitor.sample()
+			if err != nil {
+				srvrLog.Warnf("Unable to sample the disk usage: %v", err)
+			}
+			timer.Reset(diskUsageSampleInterval)
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	timer.Stop()
+	s.wg.Done()
+}
+
+// readReplicaHandler periodically hands off a snapshot of the flat utreexo
+// proof index to --readreplicadir when the tip changed.  Only the first snapshot
+// is written while the chain is syncing so that the index isn't flushed on
+// every interval.
+//
+// It must be run as a goroutine.
+func (s *server) readReplicaHandler() {
+	timer := time.NewTimer(0)
+	var lastHash chainhash.Hash
+
+out:
+	for {
+		select {
+		case <-timer.C:
+			best := s.chain.BestSnapshot()
+			if best.Hash != lastHash && (lastHash == chainhash.Hash{} ||
+				s.syncManager.IsCurrent()) {
+
+				err := s.chain.FlushIndexesAndRun(func(tip *blockchain.BestState) error {
+					lastHash = tip.Hash
+					return s.flatUtreexoProofIndex.WriteReplicaSnapshot(
+						cfg.ReadReplicaDir, tip)
+				})
+				if err != nil {
+					srvrLog.Warnf("Unable to hand off a snapshot to "+
+						"the read replicas: %v", err)
+					lastHash = chainhash.Hash{}
+				}
+			}
+			timer.Reset(cfg.ReadReplicaInterval)
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	timer.Stop()
+	s.wg.Done()
+}
+
 // Stop gracefully shuts down the server by stopping and disconnecting all
 // peers and the main listener.
 func (s *server) Stop() error {
@@ -3115,17 +3968,46 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop the bridge with Bitcoin Core before the sync manager it hands
+	// the blocks to.
+	if s.coreBridge != nil {
+		s.coreBridge.Stop()
+	}
+
+	// Likewise for the follower of the leader.
+	if s.follower != nil {
+		s.follower.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
 	}
 
+	// Shutdown the gRPC server if it's enabled.
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+
 	// Stop the watch only wallet if it's enabled.
 	if cfg.WatchOnlyWallet {
 		s.watchOnlyWallet.Stop()
 		s.electrumServer.Stop()
 	}
 
+	// Stop publishing ZMQ notifications if they're enabled.
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.Stop()
+	}
+
+	// Stop the metrics server if it's enabled.
+	if s.metricsServer != nil {
+		err := s.metricsServer.Stop()
+		if err != nil {
+			srvrLog.Errorf("Unable to stop the metrics server: %v", err)
+		}
+	}
+
 	// Save fee estimator state in the database.
 	s.db.Update(func(tx database.Tx) error {
 		metadata := tx.Metadata()
@@ -3134,11 +4016,74 @@ func (s *server) Stop() error {
 		return nil
 	})
 
+	// Save the smart fee estimator to the data directory.
+	err := saveSmartFeeEstimator(s.smartFeeEstimator)
+	if err != nil {
+		srvrLog.Errorf("Unable to save the smart fee estimator: %v", err)
+	}
+
 	// Signal the remaining goroutines to quit.
 	close(s.quit)
 	return nil
 }
 
+// smartFeeEstimatorPath returns the path of the file in the data directory the
+// smart fee estimator is saved to.
+func smartFeeEstimatorPath() string {
+	return filepath.Join(cfg.DataDir, mempool.SmartFeeEstimatorFile)
+}
+
+// loadSmartFeeEstimator restores the smart fee estimator saved to the data
+// directory.  A new one is returned if none was saved or if it can't be
+// restored.
+func loadSmartFeeEstimator() *mempool.SmartFeeEstimator {
+	path := smartFeeEstimatorPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			srvrLog.Errorf("Unable to open the smart fee estimator "+
+				"%s: %v", path, err)
+		}
+		return mempool.NewSmartFeeEstimator()
+	}
+	defer f.Close()
+
+	ef, err := mempool.RestoreSmartFeeEstimator(bufio.NewReader(f))
+	if err != nil {
+		srvrLog.Errorf("Failed to restore the smart fee estimator "+
+			"%s: %v", path, err)
+		return mempool.NewSmartFeeEstimator()
+	}
+
+	return ef
+}
+
+// saveSmartFeeEstimator writes the smart fee estimator to the data directory.
+func saveSmartFeeEstimator(ef *mempool.SmartFeeEstimator) error {
+	path := smartFeeEstimatorPath()
+
+	// The estimator is written to a temporary file first so that a crash
+	// while writing never leaves a partial file behind.
+	tmpFile := path + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = ef.Save(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
 // WaitForShutdown blocks until the main listener and peer handlers are stopped.
 func (s *server) WaitForShutdown() {
 	s.wg.Wait()
@@ -3256,8 +4201,8 @@ out:
 					srvrLog.Warnf("UPnP can't get external address: %v", err)
 					continue out
 				}
-				na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
-					s.services)
+				na := wire.NetAddressV2FromBytes(time.Now(), s.services,
+					externalip, uint16(listenPort))
 				err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
 				if err != nil {
 					// XXX DeletePortMapping?
@@ -3338,9 +4283,14 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	db database.DB, chainParams *chaincfg.Params,
 	interrupt <-chan struct{}) (*server, error) {
 
+	if cfg.CSN {
+		srvrLog.Info("Running as a compact state node. Only the roots " +
+			"of the utreexo accumulator are kept")
+	}
+
 	services := defaultServices
-	if cfg.NoPeerBloomFilters {
-		services &^= wire.SFNodeBloom
+	if cfg.PeerBloomFilters {
+		services |= wire.SFNodeBloom
 	}
 	if cfg.CFilters {
 		services |= wire.SFNodeCF
@@ -3356,8 +4306,9 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			services &^= wire.SFNodeNetworkLimited
 		}
 	}
-	if !cfg.NoUtreexo || cfg.UtreexoProofIndex || cfg.FlatUtreexoProofIndex {
-		services |= wire.SFNodeUtreexo
+	services |= utreexoServices(cfg)
+	if !cfg.NoV2Transport {
+		services |= wire.SFNodeP2PV2
 	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
@@ -3375,12 +4326,57 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 	}
 
+	// Create the onion service for inbound connections over Tor.  Its
+	// listener only accepts the connections forwarded by Tor on localhost
+	// so it's created even when listening on the other interfaces is
+	// disabled.
+	var onion *onionService
+	if cfg.ListenOnion {
+		var err error
+		onion, err = newOnionService(cfg.DataDir,
+			activeNetParams.DefaultPort, cfg.TorControl,
+			cfg.TorPassword)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, &onionListener{onion.listener})
+		srvrLog.Infof("Accepting inbound connections on onion service %s",
+			onion.Addr())
+
+		// Advertise the onion service so that peers can connect to it.
+		// Peers that don't support addrv2 won't learn about it since
+		// torv3 addresses can't be relayed in addr messages.
+		na, err := amgr.HostToNetAddress(onion.service.Hostname(),
+			onion.port, services)
+		if err != nil {
+			return nil, err
+		}
+		err = amgr.AddLocalAddress(na, addrmgr.ManualPrio)
+		if err != nil {
+			srvrLog.Warnf("Unable to advertise the onion service: %v",
+				err)
+		}
+
+		// Reach the onion addresses of other peers through the same Tor
+		// daemon unless a proxy that can was configured.
+		if cfg.OnionProxy == "" && cfg.Proxy == "" {
+			if err := onion.useSocksListener(); err != nil {
+				srvrLog.Warnf("Unable to get the tor SOCKS proxy: %v",
+					err)
+			}
+		}
+	}
+
 	if len(agentBlacklist) > 0 {
 		srvrLog.Infof("User-agent blacklist %s", agentBlacklist)
 	}
 	if len(agentWhitelist) > 0 {
 		srvrLog.Infof("User-agent whitelist %s", agentWhitelist)
 	}
+	if len(cfg.AgentDeprioritize) > 0 {
+		srvrLog.Infof("User-agent deprioritize list %s",
+			cfg.AgentDeprioritize)
+	}
 
 	s := server{
 		chainParams:          chainParams,
@@ -3395,6 +4391,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		modifyRebroadcastInv: make(chan interface{}),
 		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
 		nat:                  nat,
+		onion:                onion,
 		db:                   db,
 		timeSource:           blockchain.NewMedianTime(),
 		services:             services,
@@ -3436,13 +4433,56 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
 		indexes = append(indexes, s.cfIndex)
 	}
+	if cfg.LeafDataIndex {
+		indxLog.Info("Leaf data index is enabled")
+		s.leafDataIndex = indexers.NewLeafDataIndex(db)
+		indexes = append(indexes, s.leafDataIndex)
+	}
+	if cfg.HybridValidation {
+		indxLog.Info("Hybrid validation is enabled. Blocks will be " +
+			"cross-checked against the UTXO set and the utreexo accumulator")
+	}
+	cpuQuota := indexers.NewCPUQuota(cfg.BackgroundCPUPercent)
+	if cpuQuota != nil {
+		indxLog.Infof("Capping background work to %.1f of %d CPU cores",
+			cpuQuota.Cores(), runtime.NumCPU())
+	}
+	utreexoConfig := &indexers.UtreexoConfig{
+		MaxMemoryUsage:        cfg.UtreexoProofIndexMaxMemory * 1024 * 1024,
+		MaxNodesMemory:        cfg.UtreexoMaxNodesMemory * 1024 * 1024,
+		MaxCachedLeavesMemory: cfg.UtreexoMaxCachedLeavesMemory * 1024 * 1024,
+		Params:                chainParams,
+		Pruned:                cfg.Prune != 0,
+		DataDir:               cfg.DataDir,
+		FlushMainDB:           db.Flush,
+		FlushPolicy: indexers.FlushPolicy{
+			BlockInterval:    cfg.UtreexoFlushBlockInterval,
+			TimeInterval:     cfg.UtreexoFlushInterval,
+			CacheUtilization: cfg.UtreexoFlushCacheUsage,
+		},
+		CrossCheck:       cfg.HybridValidation,
+		ProofCacheSize:   cfg.UtreexoProofCacheSize,
+		LeafTTLs:         cfg.LeafTTLs,
+		ProofPruneHeight: cfg.ProofPruneHeight,
+		ProofRetention:   cfg.ProofRetention,
+		UndoRetention:    cfg.UndoRetention,
+		SyncPolicy:       utreexoSyncPolicy(cfg),
+		FlushBatchSize:   int(cfg.UtreexoFlushBatchSize * 1024 * 1024),
+		AuditLog:         cfg.UtreexoAuditLog,
+		AuditLogMaxSize:  cfg.UtreexoAuditLogMaxSize * 1024 * 1024,
+		CPUQuota:         cpuQuota,
+
+		RollbackSnapshots:    cfg.RollbackSnapshots,
+		RootSnapshotInterval: cfg.RootSnapshotInterval,
+
+		CompactionWindows:   cfg.compactWindows,
+		GarbageCompactRatio: cfg.UtreexoCompactGarbage / 100,
+	}
 	if cfg.UtreexoProofIndex {
 		indxLog.Info("Utreexo Proof index is enabled")
 
 		var err error
-		s.utreexoProofIndex, err = indexers.NewUtreexoProofIndex(
-			db, cfg.Prune != 0, cfg.UtreexoProofIndexMaxMemory*1024*1024,
-			chainParams, cfg.DataDir, db.Flush)
+		s.utreexoProofIndex, err = indexers.NewUtreexoProofIndex(db, utreexoConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -3453,19 +4493,92 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		indxLog.Info("Flat Utreexo Proof index is enabled")
 
 		var err error
-		s.flatUtreexoProofIndex, err = indexers.NewFlatUtreexoProofIndex(
-			cfg.Prune != 0, chainParams, cfg.UtreexoProofIndexMaxMemory*1024*1024,
-			cfg.DataDir, db.Flush)
+		s.flatUtreexoProofIndex, err = indexers.NewFlatUtreexoProofIndex(utreexoConfig)
 		if err != nil {
 			return nil, err
 		}
 		indexes = append(indexes, s.flatUtreexoProofIndex)
 	}
 
+	// Nodes serving proofs answer the proofauth challenges of the nodes
+	// pinning them as a proof source with their own key.
+	if cfg.UtreexoProofIndex || cfg.FlatUtreexoProofIndex {
+		var err error
+		s.proofAuthKey, err = loadProofAuthKey(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		srvrLog.Infof("Proof source public key: %x",
+			schnorr.SerializePubKey(s.proofAuthKey.PubKey()))
+	}
+
+	// Track the disk usage of the block database and of the utreexo
+	// indexes as they keep their data outside of the block database.
+	diskUsageTargets := []diskUsageTarget{
+		{name: "blocks", paths: []string{blockDbPath(cfg.DbType)}},
+	}
+	if s.utreexoProofIndex != nil {
+		diskUsageTargets = append(diskUsageTargets, diskUsageTarget{
+			name:  "utreexoproofindex",
+			paths: s.utreexoProofIndex.StoragePaths(),
+		})
+	}
+	if s.flatUtreexoProofIndex != nil {
+		diskUsageTargets = append(diskUsageTargets, diskUsageTarget{
+			name:  "flatutreexoproofindex",
+			paths: s.flatUtreexoProofIndex.StoragePaths(),
+		})
+	}
+	s.diskUsageMonitor = newDiskUsageMonitor(diskUsageTargets)
+
+	if cfg.StaleTipTimeout > 0 {
+		s.staleTipMonitor = newStaleTipMonitor(cfg.StaleTipTimeout)
+	}
+
+	if cfg.BlockScrubInterval > 0 {
+		s.blockScrubber = newBlockScrubber()
+	}
+	s.servedProofs = newServedProofCache(cfg.ServedProofCacheSize)
+	if cfg.ProofAccessStats {
+		s.proofAccess = newProofAccessStats(cfg.ProofAccessClients)
+	}
+
+	if cfg.PrometheusListen != "" {
+		var sources []utreexoMetricsSource
+		if s.utreexoProofIndex != nil {
+			sources = append(sources, utreexoMetricsSource{
+				name:  "utreexoproofindex",
+				fetch: s.utreexoProofIndex.UtreexoStateMetrics,
+			})
+		}
+		if s.flatUtreexoProofIndex != nil {
+			sources = append(sources, utreexoMetricsSource{
+				name:  "flatutreexoproofindex",
+				fetch: s.flatUtreexoProofIndex.UtreexoStateMetrics,
+			})
+		}
+
+		collectors := []prometheus.Collector{newUtreexoCollector(sources)}
+		if s.proofAccess != nil {
+			collectors = append(collectors,
+				newProofAccessCollector(s.proofAccess))
+		}
+
+		var err error
+		s.metricsServer, err = newMetricsServer(cfg.PrometheusListen,
+			collectors...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
-		indexManager = indexers.NewManager(db, indexes)
+		s.indexManager = indexers.NewManager(db, indexes)
+		s.indexManager.SetCPUQuota(cpuQuota)
+		s.indexManager.SetDeferSync(cfg.DeferIndexSync)
+		indexManager = s.indexManager
 	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
@@ -3474,6 +4587,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
 	}
 
+	// Generate the conformance chain and checkpoint its last block so that
+	// it can't be reorganized away.
+	var conformanceChain []*btcutil.Block
+	if cfg.Conformance {
+		var err error
+		conformanceChain, err = conformanceBlocks(s.chainParams)
+		if err != nil {
+			return nil, err
+		}
+		if !cfg.DisableCheckpoints {
+			checkpoints = mergeCheckpoints(checkpoints,
+				[]chaincfg.Checkpoint{conformanceCheckpoint(conformanceChain)})
+		}
+	}
+
 	// If Utreexo is enabled, make an empty UtreexoViewpoint to signal that utreexo
 	// accumulators are enabled.
 	var utreexo *blockchain.UtreexoViewpoint
@@ -3484,6 +4612,8 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	assumeUtreexoPoint := chainParams.AssumeUtreexoPoint
 	if cfg.NoAssumeUtreexo {
 		assumeUtreexoPoint = chaincfg.AssumeUtreexo{}
+	} else if cfg.assumeUtreexo != nil {
+		assumeUtreexoPoint = *cfg.assumeUtreexo
 	}
 
 	// Create a new block chain instance with the appropriate configuration.
@@ -3506,6 +4636,13 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		return nil, err
 	}
 
+	if cfg.Conformance {
+		err = connectConformanceBlocks(s.chain, conformanceChain)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Search for a FeeEstimator state in the database. If none can be found
 	// or if it cannot be loaded, create a new one.
 	db.Update(func(tx database.Tx) error {
@@ -3536,6 +4673,8 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			mempool.DefaultEstimateFeeMinRegisteredBlocks)
 	}
 
+	s.smartFeeEstimator = loadSmartFeeEstimator()
+
 	txC := mempool.Config{
 		Policy: mempool.Policy{
 			DisableRelayPriority: cfg.NoRelayPriority,
@@ -3545,6 +4684,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
 			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 			MinRelayTxFee:        cfg.minRelayTxFee,
+			IncrementalRelayFee:  &cfg.incrementalRelayFee,
 			MaxTxVersion:         2,
 			RejectReplacement:    cfg.RejectReplacement,
 		},
@@ -3559,13 +4699,23 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		IsUtreexoViewActive:  s.chain.IsUtreexoViewActive,
 		VerifyUData:          s.chain.VerifyUData,
 		PruneFromAccumulator: s.chain.PruneFromAccumulator,
+		GenerateUData:        s.chain.GenerateUData,
+		CacheAccProof:        s.chain.CacheAccProof,
 		SigCache:             s.sigCache,
 		HashCache:            s.hashCache,
 		AddrIndex:            s.addrIndex,
 		FeeEstimator:         s.feeEstimator,
+		SmartFeeEstimator:    s.smartFeeEstimator,
 	}
 	s.txMemPool = mempool.New(&txC)
 
+	// Keep the proofs of the utxos that the transactions in the mempool
+	// spend while they're unconfirmed so that the transactions can be
+	// relayed with the proofs of all their inputs once the utxos confirm.
+	if s.chain.IsUtreexoViewActive() {
+		s.chain.SetUtreexoRememberFunc(s.txMemPool.IsUnconfirmedSpend)
+	}
+
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
 		Chain:              s.chain,
@@ -3574,6 +4724,8 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		DisableCheckpoints: cfg.DisableCheckpoints,
 		MaxPeers:           cfg.MaxPeers,
 		FeeEstimator:       s.feeEstimator,
+		SmartFeeEstimator:  s.smartFeeEstimator,
+		DataDir:            cfg.DataDir,
 	})
 	if err != nil {
 		return nil, err
@@ -3592,9 +4744,23 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		BlockPrioritySize: cfg.BlockPrioritySize,
 		TxMinFreeFee:      cfg.minRelayTxFee,
 	}
+
+	// Blocks mined on nodes that only keep the accumulator need a utreexo
+	// proof to be connected.  On the test networks, the blocks mined by
+	// bridge nodes are proven as well so that the proofs they serve for
+	// them are checked the way the nodes they serve them to do.
+	var proveBlock func(*btcutil.Block) (*wire.UData, error)
+	switch {
+	case s.chain.IsUtreexoViewActive():
+		proveBlock = s.proveBlockFromPool
+	case (cfg.RegressionTest || cfg.SimNet) && s.utreexoProofIndex != nil:
+		proveBlock = s.utreexoProofIndex.ProveBlock
+	case (cfg.RegressionTest || cfg.SimNet) && s.flatUtreexoProofIndex != nil:
+		proveBlock = s.flatUtreexoProofIndex.ProveBlock
+	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
-		s.sigCache, s.hashCache)
+		s.sigCache, s.hashCache, proveBlock)
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
 		BlockTemplateGenerator: blockTemplateGenerator,
@@ -3613,12 +4779,31 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	var newAddressFunc func() (net.Addr, error)
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
+			// Archival bridges are preferred while a CSN still
+			// needs the proofs of historical blocks and isn't
+			// connected to enough of them.
+			archival := s.needsArchivalBridges()
 			for tries := 0; tries < 100; tries++ {
-				addr := s.addrManager.GetAddress()
+				var addr *addrmgr.KnownAddress
+				if archival && tries < 50 {
+					addr = s.addrManager.GetAddressWithServices(
+						wire.SFNodeUtreexo | wire.SFNodeUtreexoArchive)
+				}
+				if addr == nil {
+					archival = false
+					addr = s.addrManager.GetAddress()
+				}
 				if addr == nil {
 					break
 				}
 
+				// Skip the addresses of networks that can't be
+				// reached or that connections were restricted
+				// from with --onlynet.
+				if !isReachable(addr.NetAddress()) {
+					continue
+				}
+
 				// Address will not be invalid, local or unroutable
 				// because addrmanager rejects those on addition.
 				// Just check that we don't already have an address
@@ -3646,7 +4831,24 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				s.addrManager.Attempt(addr.NetAddress())
 
 				addrString := addrmgr.NetAddressKey(addr.NetAddress())
-				return addrStringToNetAddr(addrString)
+				netAddr, err := addrStringToNetAddr(addrString)
+				if err != nil {
+					return nil, err
+				}
+
+				// Fill the block-relay-only slots before making
+				// full-relay connections.
+				class := s.relayConnClass()
+				if s.blockRelaySlots.reserve() {
+					class = connClassBlockRelay
+				}
+				// The v2 transport is only used with the peers
+				// that are known to support it.
+				return &classAddr{
+					Addr:  netAddr,
+					class: class,
+					v1:    addr.Services()&wire.SFNodeP2PV2 == 0,
+				}, nil
 			}
 
 			return nil, errors.New("no valid connect address")
@@ -3655,6 +4857,10 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 
 	// Create a connection manager.
 	targetOutbound := defaultTargetOutbound
+	if newAddressFunc != nil {
+		targetOutbound += cfg.BlockRelayConns
+		s.blockRelaySlots.max = cfg.BlockRelayConns
+	}
 	if cfg.MaxPeers < targetOutbound {
 		targetOutbound = cfg.MaxPeers
 	}
@@ -3663,7 +4869,7 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		OnAccept:       s.inboundPeerConnected,
 		RetryDuration:  connectionRetryInterval,
 		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
+		Dial:           s.dialOutbound,
 		OnConnection:   s.outboundPeerConnected,
 		GetNewAddress:  newAddressFunc,
 	})
@@ -3684,10 +4890,13 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		go s.connManager.Connect(&connmgr.ConnReq{
-			Addr:      netAddr,
+			Addr:      &classAddr{Addr: netAddr, class: s.relayConnClass()},
 			Permanent: true,
 		})
 	}
+	if err := s.connectProofSources(cfg.proofSources); err != nil {
+		return nil, err
+	}
 
 	if cfg.WatchOnlyWallet {
 		s.watchOnlyWallet, err = wallet.New(&wallet.Config{
@@ -3720,36 +4929,42 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			var hdType wallet.HDVersion
 			switch ty {
 			case "p2pkh":
-				switch chainParams.Net {
-				case chaincfg.MainNetParams.Net:
+				switch chainParams.Name {
+				case chaincfg.MainNetParams.Name:
 					hdType = wallet.HDVersionMainNetBIP0044
-				case chaincfg.SigNetParams.Net:
+				case chaincfg.TestNet4Params.Name:
+					hdType = wallet.HDVersionTestNetBIP0044
+				case chaincfg.SigNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0044
-				case chaincfg.RegressionNetParams.Net:
+				case chaincfg.RegressionNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0044
-				case chaincfg.SimNetParams.Net:
+				case chaincfg.SimNetParams.Name:
 					hdType = wallet.HDVersionSimNetBIP0044
 				}
 			case "p2wpkh":
-				switch chainParams.Net {
-				case chaincfg.MainNetParams.Net:
+				switch chainParams.Name {
+				case chaincfg.MainNetParams.Name:
 					hdType = wallet.HDVersionMainNetBIP0084
-				case chaincfg.SigNetParams.Net:
+				case chaincfg.TestNet4Params.Name:
+					hdType = wallet.HDVersionTestNetBIP0084
+				case chaincfg.SigNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0084
-				case chaincfg.RegressionNetParams.Net:
+				case chaincfg.RegressionNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0084
-				case chaincfg.SimNetParams.Net:
+				case chaincfg.SimNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0084
 				}
 			case "p2sh":
-				switch chainParams.Net {
-				case chaincfg.MainNetParams.Net:
+				switch chainParams.Name {
+				case chaincfg.MainNetParams.Name:
 					hdType = wallet.HDVersionMainNetBIP0049
-				case chaincfg.SigNetParams.Net:
+				case chaincfg.TestNet4Params.Name:
 					hdType = wallet.HDVersionTestNetBIP0049
-				case chaincfg.RegressionNetParams.Net:
+				case chaincfg.SigNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0049
-				case chaincfg.SimNetParams.Net:
+				case chaincfg.RegressionNetParams.Name:
+					hdType = wallet.HDVersionTestNetBIP0049
+				case chaincfg.SimNetParams.Name:
 					hdType = wallet.HDVersionTestNetBIP0049
 				}
 			}
@@ -3759,6 +4974,14 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				return nil, err
 			}
 		}
+
+		// Register descriptors that are requested to be watched.
+		for _, desc := range cfg.RegisterDescriptorsToWatchOnlyWallet {
+			_, err := s.watchOnlyWallet.RegisterDescriptor(desc)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if !cfg.NoBdkWallet {
@@ -3807,9 +5030,18 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			TxIndex:               s.txIndex,
 			AddrIndex:             s.addrIndex,
 			CfIndex:               s.cfIndex,
+			LeafDataIndex:         s.leafDataIndex,
 			UtreexoProofIndex:     s.utreexoProofIndex,
 			FlatUtreexoProofIndex: s.flatUtreexoProofIndex,
+			IndexManager:          s.indexManager,
+			MaxProofTargets:       cfg.MaxProofTargets,
+			MaxProofBytes:         cfg.MaxProofBytes,
+			ProofAccess:           s.proofAccess,
 			FeeEstimator:          s.feeEstimator,
+			SmartFeeEstimator:     s.smartFeeEstimator,
+			DiskUsageMonitor:      s.diskUsageMonitor,
+			BlockScrubber:         s.blockScrubber,
+			StaleTipMonitor:       s.staleTipMonitor,
 			WatchOnlyWallet:       s.watchOnlyWallet,
 			BDKWallet:             s.bdkWallet,
 		})
@@ -3822,6 +5054,73 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			<-s.rpcServer.RequestedProcessShutdown()
 			shutdownRequestChannel <- struct{}{}
 		}()
+
+		if len(cfg.GRPCListeners) > 0 {
+			s.grpcServer, err = newGRPCServer(&s)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.ZMQPubRawBlock != "" || cfg.ZMQPubRawTx != "" ||
+		cfg.ZMQPubUtreexoRoots != "" {
+
+		if cfg.ZMQPubUtreexoRoots != "" && s.utreexoProofIndex == nil &&
+			s.flatUtreexoProofIndex == nil && !s.chain.IsUtreexoViewActive() {
+
+			return nil, errors.New("--zmqpubutreexoroots requires a " +
+				"utreexo proof index or --noutreexo disabled")
+		}
+
+		s.zmqNotifier, err = zmq.New(&zmq.Config{
+			PubRawBlock:     cfg.ZMQPubRawBlock,
+			PubRawTx:        cfg.ZMQPubRawTx,
+			PubUtreexoRoots: cfg.ZMQPubUtreexoRoots,
+			Chain:           s.chain,
+			FetchUtreexoRoots: func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
+				return fetchTipUtreexoRoots(s.chain, s.utreexoProofIndex,
+					s.flatUtreexoProofIndex, hash)
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CoreRPC != "" {
+		s.coreBridge, err = corebridge.New(&corebridge.Config{
+			RPCHost:      cfg.CoreRPC,
+			RPCUser:      cfg.CoreRPCUser,
+			RPCPass:      cfg.CoreRPCPass,
+			ZMQRawBlock:  cfg.CoreZMQRawBlock,
+			ZMQRawTx:     cfg.CoreZMQRawTx,
+			PollInterval: cfg.CorePollInterval,
+			Chain:        s.chain,
+			ProcessBlock: func(block *btcutil.Block) (bool, error) {
+				return s.syncManager.ProcessBlock(block,
+					blockchain.BFNone)
+			},
+			ProcessTransaction: func(tx *btcutil.Tx) error {
+				acceptedTxs, err := s.txMemPool.ProcessTransaction(
+					tx, nil, false, false, 0)
+				if err != nil {
+					return err
+				}
+				s.AnnounceNewTransactions(acceptedTxs)
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ReplicateFrom != "" {
+		s.follower, err = newFollower(&s)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if cfg.WatchOnlyWallet && !cfg.DisableElectrum {
@@ -3868,6 +5167,93 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	return &s, nil
 }
 
+// newGRPCServer returns the gRPC server serving on the configured listeners
+// with the TLS certificate and the credentials of the RPC server.
+func newGRPCServer(s *server) (*grpc.Server, error) {
+	listeners, err := setupListeners(cfg.GRPCListeners, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("GRPC: No valid listen address")
+	}
+	keypair, err := tls.LoadX509KeyPair(cfg.RPCCert, cfg.RPCKey)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcCfg := grpc.Config{
+		Listeners: listeners,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{keypair},
+			MinVersion:   tls.VersionTLS12,
+		},
+		Chain: s.chain,
+		Authenticate: func(r *http.Request) error {
+			_, _, err := s.rpcServer.checkAuth(r, true)
+			return err
+		},
+		MaxProofBytes: cfg.MaxProofBytes,
+		MaxStreams:    cfg.RPCMaxWebsockets,
+	}
+	if s.utreexoProofIndex != nil || s.flatUtreexoProofIndex != nil {
+		grpcCfg.FetchUtreexoProof = func(hash *chainhash.Hash) (*wire.UData, error) {
+			udata, _, err := s.rpcServer.fetchUtreexoProof(hash)
+			return udata, err
+		}
+	}
+	if s.utreexoProofIndex != nil || s.flatUtreexoProofIndex != nil ||
+		s.chain.IsUtreexoViewActive() {
+
+		grpcCfg.FetchUtreexoRoots = func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
+			return fetchTipUtreexoRoots(s.chain, s.utreexoProofIndex,
+				s.flatUtreexoProofIndex, hash)
+		}
+	}
+	return grpc.New(&grpcCfg)
+}
+
+// newFollower returns the follower of the leader given with --replicatefrom.
+// Its blocks are checked against the utreexo roots of the node when it has an
+// accumulator.
+func newFollower(s *server) (*replication.Follower, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ReplicateCert != "" {
+		pem, err := os.ReadFile(cfg.ReplicateCert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s",
+				cfg.ReplicateCert)
+		}
+	}
+
+	followerCfg := replication.Config{
+		Leader:    cfg.ReplicateFrom,
+		TLSConfig: tlsConfig,
+		User:      cfg.ReplicateUser,
+		Pass:      cfg.ReplicatePass,
+		Chain:     s.chain,
+		ProcessBlock: func(block *btcutil.Block,
+			flags blockchain.BehaviorFlags) (bool, error) {
+
+			return s.syncManager.ProcessBlock(block, flags)
+		},
+		UtreexoView: s.chain.IsUtreexoViewActive(),
+	}
+	if s.utreexoProofIndex != nil || s.flatUtreexoProofIndex != nil ||
+		s.chain.IsUtreexoViewActive() {
+
+		followerCfg.FetchUtreexoRoots = func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error) {
+			return fetchTipUtreexoRoots(s.chain, s.utreexoProofIndex,
+				s.flatUtreexoProofIndex, hash)
+		}
+	}
+	return replication.New(&followerCfg), nil
+}
+
 // initListeners initializes the configured net listeners and adds any bound
 // addresses to the address manager. Returns the listeners and a NAT interface,
 // which is non-nil if UPnP is in use.
@@ -3885,6 +5271,22 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services wir
 			srvrLog.Warnf("Can't listen on %s: %v", addr, err)
 			continue
 		}
+
+		// Listeners with their own services only advertise the ones
+		// the server offers as well.
+		if listenServices, ok := cfg.listenServices[addr.String()]; ok {
+			if listenServices&^services != 0 {
+				srvrLog.Warnf("Not advertising %v on %s as the "+
+					"services aren't offered", listenServices&^services,
+					addr)
+			}
+			srvrLog.Infof("Advertising %v on %s", listenServices&services,
+				addr)
+			listener = &serviceListener{
+				Listener: listener,
+				services: listenServices & services,
+			}
+		}
 		listeners = append(listeners, listener)
 	}
 
@@ -3935,8 +5337,13 @@ func initListeners(amgr *addrmgr.AddrManager, listenAddrs []string, services wir
 
 		// Add bound addresses to address manager to be advertised to peers.
 		for _, listener := range listeners {
+			listenServices := services
+			if sl, ok := listener.(*serviceListener); ok {
+				listenServices = sl.services
+			}
+
 			addr := listener.Addr().String()
-			err := addLocalAddress(amgr, addr, services)
+			err := addLocalAddress(amgr, addr, listenServices)
 			if err != nil {
 				amgrLog.Warnf("Skipping bound address %s: %v", addr, err)
 			}
@@ -3994,6 +5401,13 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 	}, nil
 }
 
+// isReachable returns whether automatic outbound connections are made to the
+// network of the passed address.
+func isReachable(na *wire.NetAddressV2) bool {
+	_, ok := cfg.reachableNets[na.Addr.Network()]
+	return ok
+}
+
 // addLocalAddress adds an address that this node is listening on to the
 // address manager so that it may be relayed to peers.
 func addLocalAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.ServiceFlag) error {
@@ -4025,7 +5439,8 @@ func addLocalAddress(addrMgr *addrmgr.AddrManager, addr string, services wire.Se
 				continue
 			}
 
-			netAddr := wire.NewNetAddressIPPort(ifaceIP, uint16(port), services)
+			netAddr := wire.NetAddressV2FromBytes(time.Now(), services,
+				ifaceIP, uint16(port))
 			addrMgr.AddLocalAddress(netAddr, addrmgr.BoundPrio)
 		}
 	} else {
@@ -4140,47 +5555,3 @@ func mergeCheckpoints(defaultCheckpoints, additional []chaincfg.Checkpoint) []ch
 	sort.Sort(checkpointSorter(checkpoints))
 	return checkpoints
 }
-
-// HasUndesiredUserAgent determines whether the server should continue to pursue
-// a connection with this peer based on its advertised user agent. It performs
-// the following steps:
-// 1) Reject the peer if it contains a blacklisted agent.
-// 2) If no whitelist is provided, accept all user agents.
-// 3) Accept the peer if it contains a whitelisted agent.
-// 4) Reject all other peers.
-func (sp *serverPeer) HasUndesiredUserAgent(blacklistedAgents,
-	whitelistedAgents []string) bool {
-
-	agent := sp.UserAgent()
-
-	// First, if peer's user agent contains any blacklisted substring, we
-	// will ignore the connection request.
-	for _, blacklistedAgent := range blacklistedAgents {
-		if strings.Contains(agent, blacklistedAgent) {
-			srvrLog.Debugf("Ignoring peer %s, user agent "+
-				"contains blacklisted user agent: %s", sp,
-				agent)
-			return true
-		}
-	}
-
-	// If no whitelist is provided, we will accept all user agents.
-	if len(whitelistedAgents) == 0 {
-		return false
-	}
-
-	// Peer's user agent passed blacklist. Now check to see if it contains
-	// one of our whitelisted user agents, if so accept.
-	for _, whitelistedAgent := range whitelistedAgents {
-		if strings.Contains(agent, whitelistedAgent) {
-			return false
-		}
-	}
-
-	// Otherwise, the peer's user agent was not included in our whitelist.
-	// Ignore just in case it could stall the initial block download.
-	srvrLog.Debugf("Ignoring peer %s, user agent: %s not found in "+
-		"whitelist", sp, agent)
-
-	return true
-}
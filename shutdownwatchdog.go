@@ -0,0 +1,51 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// errCloseTimeout is returned by closeWithTimeout when the close didn't finish
+// in time.
+var errCloseTimeout = errors.New("timed out")
+
+// closeWithTimeout runs closeFn and waits for up to timeout for it to return.
+// errCloseTimeout is returned when it doesn't and closeFn is left running in
+// the background.  A timeout of 0 waits for as long as closeFn runs.
+func closeWithTimeout(closeFn func() error, timeout time.Duration) error {
+	if timeout <= 0 {
+		return closeFn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- closeFn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errCloseTimeout
+	}
+}
+
+// closeUtreexoState flushes and closes a utreexo state on shutdown with
+// closeFn.  The shutdown goes on without it once the timeout is over so that a
+// long flush can't hold it up indefinitely.  The utreexo state is recovered on
+// the next start in that case.
+func closeUtreexoState(closeFn func() error, timeout time.Duration) {
+	err := closeWithTimeout(closeFn, timeout)
+	switch {
+	case err == errCloseTimeout:
+		btcdLog.Warnf("Gave up on flushing the utreexo state after %v. "+
+			"The interrupted flush is resumed or the blocks since "+
+			"the last flush are replayed on the next start", timeout)
+	case err != nil:
+		btcdLog.Errorf("Error while flushing utreexo state: %v", err)
+	}
+}
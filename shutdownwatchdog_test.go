@@ -0,0 +1,48 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseWithTimeout(t *testing.T) {
+	testErr := errors.New("test")
+
+	// The error of a close that finishes in time is returned.
+	err := closeWithTimeout(func() error { return testErr }, time.Minute)
+	if err != testErr {
+		t.Fatalf("expected %v, got %v", testErr, err)
+	}
+
+	// A close that takes too long is left running.
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	err = closeWithTimeout(func() error {
+		<-release
+		close(finished)
+		return nil
+	}, 10*time.Millisecond)
+	if err != errCloseTimeout {
+		t.Fatalf("expected %v, got %v", errCloseTimeout, err)
+	}
+	close(release)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("the timed out close didn't keep running")
+	}
+
+	// No timeout waits for the close.
+	err = closeWithTimeout(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// staleTipCheckInterval is how often the tip is checked for being stale.
+const staleTipCheckInterval = time.Minute
+
+// staleTipMonitor keeps track of when the tip last advanced and decides when
+// the peers should be refreshed because the tip has gone stale.
+type staleTipMonitor struct {
+	timeout time.Duration
+
+	mtx         sync.Mutex
+	tipHash     chainhash.Hash
+	tipHeight   int32
+	tipChanged  time.Time
+	lastRefresh time.Time
+	stale       bool
+}
+
+// newStaleTipMonitor returns a new stale tip monitor that considers the tip
+// stale once it hasn't advanced for the given timeout.
+func newStaleTipMonitor(timeout time.Duration) *staleTipMonitor {
+	return &staleTipMonitor{timeout: timeout}
+}
+
+// check records the tip seen at the given time and returns whether the peers
+// should be refreshed.  The peers are refreshed once the tip has been stale for
+// the timeout and then again every timeout for as long as it stays stale.
+//
+// This function is safe for concurrent access.
+func (m *staleTipMonitor) check(now time.Time, tipHash chainhash.Hash, tipHeight int32) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.tipChanged.IsZero() || tipHash != m.tipHash {
+		if m.stale {
+			srvrLog.Infof("The tip advanced to %v (height %d) and is "+
+				"no longer stale", tipHash, tipHeight)
+		}
+		m.tipHash = tipHash
+		m.tipHeight = tipHeight
+		m.tipChanged = now
+		m.lastRefresh = time.Time{}
+		m.stale = false
+		return false
+	}
+
+	if now.Sub(m.tipChanged) < m.timeout {
+		return false
+	}
+	m.stale = true
+	if !m.lastRefresh.IsZero() && now.Sub(m.lastRefresh) < m.timeout {
+		return false
+	}
+	m.lastRefresh = now
+
+	return true
+}
+
+// Warning returns the health warning about the stale tip or an empty string if
+// the tip isn't stale.
+//
+// This function is safe for concurrent access.
+func (m *staleTipMonitor) Warning() string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if !m.stale {
+		return ""
+	}
+
+	return fmt.Sprintf("The tip %v (height %d) hasn't advanced since %v. "+
+		"The node may be missing blocks from its peers", m.tipHash,
+		m.tipHeight, m.tipChanged.Format(time.RFC3339))
+}
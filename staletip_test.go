@@ -0,0 +1,49 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestStaleTipMonitor(t *testing.T) {
+	setLogLevels("off")
+
+	timeout := time.Minute * 30
+	m := newStaleTipMonitor(timeout)
+	start := time.Unix(1700000000, 0)
+	tip := chainhash.Hash{1}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		tip     chainhash.Hash
+		refresh bool
+		stale   bool
+	}{
+		{"first tip", 0, tip, false, false},
+		{"before the timeout", timeout - time.Second, tip, false, false},
+		{"at the timeout", timeout, tip, true, true},
+		{"right after a refresh", timeout + time.Minute, tip, false, true},
+		{"a timeout after the refresh", timeout * 2, tip, true, true},
+		{"new tip", timeout*2 + time.Minute, chainhash.Hash{2}, false, false},
+		{"new tip before the timeout", timeout * 3, chainhash.Hash{2}, false, false},
+		{"new tip at the timeout", timeout*3 + time.Minute, chainhash.Hash{2}, true, true},
+	}
+	for _, test := range tests {
+		refresh := m.check(start.Add(test.elapsed), test.tip, 100)
+		if refresh != test.refresh {
+			t.Fatalf("%s: expected refresh %v, got %v", test.name,
+				test.refresh, refresh)
+		}
+		if stale := m.Warning() != ""; stale != test.stale {
+			t.Fatalf("%s: expected stale %v, got %v", test.name,
+				test.stale, stale)
+		}
+	}
+}
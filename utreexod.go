@@ -72,6 +72,12 @@ func pruneChecks(db database.DB) error {
 			"previously pruned. You must delete the files in the datadir: \"%s\" "+
 			"and sync from the beginning to enable the desired index", cfg.DataDir)
 	}
+	// No way to sync up the leaf data index if the node has already been pruned.
+	if beenPruned && cfg.LeafDataIndex {
+		return fmt.Errorf("--leafdataindex cannot be enabled as the node has been "+
+			"previously pruned. You must delete the files in the datadir: \"%s\" "+
+			"and sync from the beginning to enable the desired index", cfg.DataDir)
+	}
 	// If we've previously been pruned and the utreexoproofindex isn't present, it means that
 	// theh user wants to enable the index after the node has already synced up while being pruned.
 	if beenPruned && !indexers.UtreexoProofIndexInitialized(db) && cfg.UtreexoProofIndex {
@@ -287,6 +293,14 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropLeafDataIndex {
+		if err := indexers.DropLeafDataIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropUtreexoProofIndex {
 		if err := indexers.DropUtreexoProofIndex(db, cfg.DataDir, interrupt); err != nil {
 			btcdLog.Errorf("%v", err)
@@ -489,6 +503,14 @@ func loadBlockDB() (database.DB, error) {
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
 	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	if dbErr, ok := err.(database.Error); ok &&
+		dbErr.ErrorCode == database.ErrCorruption && !cfg.NoDbRepair {
+
+		db, err = repairBlockDB(dbPath, err)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -513,6 +535,45 @@ func loadBlockDB() (database.DB, error) {
 	return db, nil
 }
 
+// repairBlockDB attempts to repair the block database at dbPath that failed to
+// open with the given corruption error and opens it again.  If the database
+// can't be repaired, an error saying that it needs to be rebuilt is returned.
+func repairBlockDB(dbPath string, openErr error) (database.DB, error) {
+	btcdLog.Warnf("Block database is corrupted: %v", openErr)
+	btcdLog.Warnf("Attempting to repair the block database.  Start with " +
+		"--nodbrepair to disable this")
+
+	err := database.Repair(cfg.DbType, dbPath, activeNetParams.Net)
+	if err == nil {
+		var db database.DB
+		db, err = database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+		if err == nil {
+			err = db.View(verifyRepairedTips)
+			if err == nil {
+				btcdLog.Infof("Block database repaired")
+				return db, nil
+			}
+			db.Close()
+		}
+	}
+
+	return nil, fmt.Errorf("unable to repair the block database: %v -- "+
+		"the block database needs to be rebuilt by removing %s and "+
+		"restarting", err, dbPath)
+}
+
+// verifyRepairedTips ensures the best chain state and the index tips of a
+// repaired block database still point at main chain blocks that agree with each
+// other.
+func verifyRepairedTips(dbTx database.Tx) error {
+	_, bestHeight, err := blockchain.VerifyBestState(dbTx)
+	if err != nil {
+		return err
+	}
+
+	return indexers.VerifyIndexTips(dbTx, bestHeight)
+}
+
 func main() {
 	// Block and transaction processing can cause bursty allocations.  This
 	// limits the garbage collector from excessively overallocating during
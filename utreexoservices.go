@@ -0,0 +1,60 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/utreexo/utreexod/wire"
+)
+
+// utreexoServices returns the utreexo services the node offers with the given
+// config.  Bridges that keep the proofs of every block are archival bridges,
+// bridges that drop the older proofs only serve the recent ones and pruned
+// bridges don't serve blocks to go along with the proofs at all.
+func utreexoServices(cfg *config) wire.ServiceFlag {
+	switch {
+	case cfg.UtreexoProofIndex || cfg.FlatUtreexoProofIndex:
+		services := wire.ServiceFlag(wire.SFNodeUtreexo)
+		switch {
+		case cfg.Prune != 0:
+		case cfg.ProofPruneHeight != 0 || cfg.ProofRetention != 0:
+			services |= wire.SFNodeUtreexoRecent
+		default:
+			services |= wire.SFNodeUtreexoArchive | wire.SFNodeUtreexoRecent
+		}
+		return services
+
+	case !cfg.NoUtreexo:
+		return wire.SFNodeUtreexo | wire.SFNodeUtreexoCSN
+	}
+
+	return 0
+}
+
+// servesUtreexoProofs returns whether a peer with the given services serves
+// utreexo proofs.  Peers from before the services that tell bridges and CSNs
+// apart only signal SFNodeUtreexo and are assumed to serve them.
+func servesUtreexoProofs(services wire.ServiceFlag) bool {
+	return services.HasFlag(wire.SFNodeUtreexo) &&
+		!services.HasFlag(wire.SFNodeUtreexoCSN)
+}
+
+// isArchivalBridge returns whether a peer with the given services serves the
+// utreexo proofs of every block.
+func isArchivalBridge(services wire.ServiceFlag) bool {
+	return services.HasFlag(wire.SFNodeUtreexo | wire.SFNodeUtreexoArchive)
+}
+
+// needsArchivalBridges returns whether outbound connections should be made to
+// archival bridges to fill the --archivalconns.  Only a CSN that hasn't
+// caught up needs the proofs of historical blocks.  Once the tip is current
+// it's within the last 288 blocks that every bridge serves the proofs of.
+func (s *server) needsArchivalBridges() bool {
+	if cfg.ArchivalConns == 0 || !s.chain.IsUtreexoViewActive() ||
+		s.syncManager.IsCurrent() {
+
+		return false
+	}
+	return s.ArchivalBridgeCount() < cfg.ArchivalConns
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+func TestUtreexoServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config
+		services wire.ServiceFlag
+	}{
+		{
+			name:     "not a utreexo node",
+			cfg:      config{NoUtreexo: true},
+			services: 0,
+		},
+		{
+			name:     "csn",
+			cfg:      config{},
+			services: wire.SFNodeUtreexo | wire.SFNodeUtreexoCSN,
+		},
+		{
+			name: "archival bridge",
+			cfg:  config{NoUtreexo: true, UtreexoProofIndex: true},
+			services: wire.SFNodeUtreexo | wire.SFNodeUtreexoArchive |
+				wire.SFNodeUtreexoRecent,
+		},
+		{
+			name: "recent bridge",
+			cfg: config{NoUtreexo: true, FlatUtreexoProofIndex: true,
+				ProofRetention: 1000},
+			services: wire.SFNodeUtreexo | wire.SFNodeUtreexoRecent,
+		},
+		{
+			name: "pruned bridge",
+			cfg: config{NoUtreexo: true, FlatUtreexoProofIndex: true,
+				Prune: 550},
+			services: wire.SFNodeUtreexo,
+		},
+	}
+	for _, test := range tests {
+		services := utreexoServices(&test.cfg)
+		if services != test.services {
+			t.Errorf("%s: got services %v, want %v", test.name,
+				services, test.services)
+		}
+	}
+
+	csn := wire.ServiceFlag(wire.SFNodeUtreexo | wire.SFNodeUtreexoCSN)
+	if servesUtreexoProofs(csn) || isArchivalBridge(csn) {
+		t.Errorf("expected a csn to serve no proofs")
+	}
+	legacy := wire.ServiceFlag(wire.SFNodeUtreexo)
+	if !servesUtreexoProofs(legacy) || isArchivalBridge(legacy) {
+		t.Errorf("expected a legacy utreexo peer to serve proofs without " +
+			"being an archival bridge")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// rekeyInterval is the number of messages the ciphers encrypt or decrypt
+// before they switch to a new key derived from the current one.
+const rekeyInterval = 224
+
+// fsChaCha20 is the forward secure ChaCha20 stream cipher of BIP0324 that the
+// lengths of the packets are encrypted with.  The lengths are encrypted with a
+// single stream that's rekeyed every rekeyInterval lengths.
+type fsChaCha20 struct {
+	stream       *chacha20.Cipher
+	chunkCounter uint32
+	rekeyCounter uint64
+}
+
+// newFSChaCha20 returns the forward secure ChaCha20 cipher with the passed
+// initial key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	c.setKey(key)
+	return c
+}
+
+// setKey starts a new stream with the passed key and a nonce of the current
+// rekey counter.
+func (c *fsChaCha20) setKey(key []byte) {
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+
+	// The key and nonce always have the right sizes.
+	c.stream, _ = chacha20.NewUnauthenticatedCipher(key, nonce[:])
+}
+
+// crypt encrypts or decrypts the passed chunk in place.
+func (c *fsChaCha20) crypt(chunk []byte) {
+	c.stream.XORKeyStream(chunk, chunk)
+
+	c.chunkCounter++
+	if c.chunkCounter == rekeyInterval {
+		// The new key is the next part of the stream.
+		var key [chacha20.KeySize]byte
+		c.stream.XORKeyStream(key[:], key[:])
+		c.chunkCounter = 0
+		c.rekeyCounter++
+		c.setKey(key[:])
+	}
+}
+
+// fsChaCha20Poly1305 is the forward secure ChaCha20Poly1305 AEAD of BIP0324
+// that the contents of the packets are encrypted with.  The nonce of a packet
+// is its position since the last rekey followed by the number of rekeys.
+type fsChaCha20Poly1305 struct {
+	aead          cipher.AEAD
+	key           [chacha20poly1305.KeySize]byte
+	packetCounter uint32
+	rekeyCounter  uint64
+}
+
+// newFSChaCha20Poly1305 returns the forward secure ChaCha20Poly1305 AEAD with
+// the passed initial key.
+func newFSChaCha20Poly1305(key []byte) *fsChaCha20Poly1305 {
+	c := &fsChaCha20Poly1305{}
+	copy(c.key[:], key)
+
+	// The key always has the right size.
+	c.aead, _ = chacha20poly1305.New(c.key[:])
+	return c
+}
+
+// nonce returns the nonce of the next packet.
+func (c *fsChaCha20Poly1305) nonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:4], c.packetCounter)
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+	return nonce[:]
+}
+
+// nextPacket moves on to the next packet and rekeys when needed.  The new key
+// is the start of the ChaCha20 keystream, skipping the block used for the
+// Poly1305 key, for a nonce with all the bits of the packet counter set.
+func (c *fsChaCha20Poly1305) nextPacket() {
+	c.packetCounter++
+	if c.packetCounter != rekeyInterval {
+		return
+	}
+
+	var nonce [chacha20.NonceSize]byte
+	binary.LittleEndian.PutUint32(nonce[:4], 0xffffffff)
+	binary.LittleEndian.PutUint64(nonce[4:], c.rekeyCounter)
+	stream, _ := chacha20.NewUnauthenticatedCipher(c.key[:], nonce[:])
+	stream.SetCounter(1)
+
+	var zeros [chacha20poly1305.KeySize]byte
+	stream.XORKeyStream(c.key[:], zeros[:])
+	c.aead, _ = chacha20poly1305.New(c.key[:])
+	c.packetCounter = 0
+	c.rekeyCounter++
+}
+
+// encrypt appends the encryption of the plaintext authenticated along with the
+// passed associated data to dst and returns the result.
+func (c *fsChaCha20Poly1305) encrypt(dst, aad, plaintext []byte) []byte {
+	ret := c.aead.Seal(dst, c.nonce(), plaintext, aad)
+	c.nextPacket()
+	return ret
+}
+
+// decrypt returns the plaintext of the passed ciphertext after checking that
+// both it and the associated data are authentic.
+func (c *fsChaCha20Poly1305) decrypt(aad, ciphertext []byte) ([]byte, error) {
+	ret, err := c.aead.Open(ciphertext[:0], c.nonce(), ciphertext, aad)
+	c.nextPacket()
+	return ret, err
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package v2transport implements the v2 encrypted transport of the bitcoin
+peer-to-peer protocol as defined by BIP0324.
+
+# Overview
+
+The v2 transport encrypts the messages of a connection with keys derived from
+an ECDH key exchange between the peers.  The public keys are sent with the
+ElligatorSwift encoding and followed by random garbage so that the whole
+connection is indistinguishable from random bytes to a passive observer.
+
+A connection is established with a Handshake.  The initiator sends its key
+first and the responder answers with its own once it received it:
+
+	h, err := v2transport.NewHandshake(conn, conn, wire.MainNet, true)
+	...
+	err = h.SendKey()
+	...
+	err = h.ReceiveKey()
+	...
+	t, err := h.Finish()
+
+The messages are then sent and received with the returned Transport.  Peers
+that only support the v1 transport close the connection after receiving the
+key of the initiator, in which case it should be made again with the v1
+transport.  Responders recognize connections of the v1 transport by their
+first V1PrefixSize bytes, which V1Prefix returns.
+*/
+package v2transport
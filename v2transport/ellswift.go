@@ -0,0 +1,282 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// EllswiftSize is the size of a public key encoded with ElligatorSwift.
+const EllswiftSize = 64
+
+var (
+	// fieldPrime is the prime of the field of secp256k1.
+	fieldPrime = btcec.S256().P
+
+	// sqrtMinus3 is the square root of -3 in the field that's used by the
+	// ElligatorSwift encoding.  Of the two roots, the encoding is defined
+	// with the one that's a square itself.
+	sqrtMinus3 = fieldPow(big.NewInt(-3), sqrtExp)
+
+	// fieldHalf is the inverse of 2 in the field.
+	fieldHalf = new(big.Int).ModInverse(big.NewInt(2), fieldPrime)
+
+	// sqrtExp is the exponent the square roots in the field are calculated
+	// with since p = 3 mod 4.
+	sqrtExp = new(big.Int).Rsh(new(big.Int).Add(fieldPrime, big.NewInt(1)), 2)
+
+	// ellswiftXDHTag is the tag of the hash the shared secret of the
+	// ElligatorSwift x-only ECDH is derived with.
+	ellswiftXDHTag = []byte("bip324_ellswift_xonly_ecdh")
+)
+
+// fieldPow returns a^e in the field.
+func fieldPow(a, e *big.Int) *big.Int {
+	return new(big.Int).Exp(new(big.Int).Mod(a, fieldPrime), e, fieldPrime)
+}
+
+// fieldMul returns the product of the passed values in the field.
+func fieldMul(values ...*big.Int) *big.Int {
+	r := big.NewInt(1)
+	for _, v := range values {
+		r.Mul(r, v)
+		r.Mod(r, fieldPrime)
+	}
+	return r
+}
+
+// fieldAdd returns the sum of the passed values in the field.
+func fieldAdd(values ...*big.Int) *big.Int {
+	r := new(big.Int)
+	for _, v := range values {
+		r.Add(r, v)
+	}
+	return r.Mod(r, fieldPrime)
+}
+
+// fieldNeg returns -a in the field.
+func fieldNeg(a *big.Int) *big.Int {
+	r := new(big.Int).Neg(a)
+	return r.Mod(r, fieldPrime)
+}
+
+// fieldInv returns 1/a in the field.  The inverse of 0 is 0.
+func fieldInv(a *big.Int) *big.Int {
+	r := new(big.Int).ModInverse(new(big.Int).Mod(a, fieldPrime), fieldPrime)
+	if r == nil {
+		return new(big.Int)
+	}
+	return r
+}
+
+// fieldSqrt returns the square root of a in the field or nil if a isn't a
+// square.
+func fieldSqrt(a *big.Int) *big.Int {
+	r := fieldPow(a, sqrtExp)
+	if fieldMul(r, r).Cmp(new(big.Int).Mod(a, fieldPrime)) != 0 {
+		return nil
+	}
+	return r
+}
+
+// curveRHS returns x^3 + 7, the right side of the curve equation.
+func curveRHS(x *big.Int) *big.Int {
+	return fieldAdd(fieldMul(x, x, x), big.NewInt(7))
+}
+
+// isValidX returns whether x is the X coordinate of a point on the curve.
+func isValidX(x *big.Int) bool {
+	return big.Jacobi(curveRHS(x), fieldPrime) != -1
+}
+
+// xswiftec returns the X coordinate on the curve the field elements u and t
+// decode to as defined by BIP0324.
+func xswiftec(u, t *big.Int) *big.Int {
+	u = new(big.Int).Mod(u, fieldPrime)
+	t = new(big.Int).Mod(t, fieldPrime)
+	if u.Sign() == 0 {
+		u.SetInt64(1)
+	}
+	if t.Sign() == 0 {
+		t.SetInt64(1)
+	}
+	gu := curveRHS(u)
+	if fieldAdd(gu, fieldMul(t, t)).Sign() == 0 {
+		t = fieldMul(t, big.NewInt(2))
+	}
+
+	// X = (u^3 + 7 - t^2) / (2t)
+	// Y = (X + t) / (sqrt(-3) * u)
+	x := fieldMul(fieldAdd(gu, fieldNeg(fieldMul(t, t))),
+		fieldInv(fieldMul(big.NewInt(2), t)))
+	y := fieldMul(fieldAdd(x, t), fieldInv(fieldMul(sqrtMinus3, u)))
+
+	// The first of u + 4Y^2, (-X/Y - u) / 2 and (X/Y - u) / 2 that's on
+	// the curve.  One of them always is.
+	x3 := fieldAdd(u, fieldMul(big.NewInt(4), y, y))
+	if isValidX(x3) {
+		return x3
+	}
+	xOverY := fieldMul(x, fieldInv(y))
+	x2 := fieldMul(fieldAdd(fieldNeg(xOverY), fieldNeg(u)), fieldHalf)
+	if isValidX(x2) {
+		return x2
+	}
+	return fieldMul(fieldAdd(xOverY, fieldNeg(u)), fieldHalf)
+}
+
+// xswiftecInv returns a field element t such that xswiftec(u, t) = x, or nil
+// if there's none for the passed case.  There are up to 8 of them, one for
+// each case from 0 to 7.
+func xswiftecInv(x, u *big.Int, c int) *big.Int {
+	var s, v *big.Int
+	if c&2 == 0 {
+		// The preimage is only valid if x is the first candidate
+		// xswiftec picks.
+		if isValidX(fieldAdd(fieldNeg(x), fieldNeg(u))) {
+			return nil
+		}
+		v = x
+		den := fieldAdd(fieldMul(u, u), fieldMul(u, v), fieldMul(v, v))
+		if den.Sign() == 0 {
+			return nil
+		}
+		s = fieldMul(fieldNeg(curveRHS(u)), fieldInv(den))
+	} else {
+		s = fieldAdd(x, fieldNeg(u))
+		if s.Sign() == 0 {
+			return nil
+		}
+		// r = sqrt(-s * (4(u^3 + 7) + 3 * s * u^2))
+		q := fieldMul(fieldNeg(s), fieldAdd(
+			fieldMul(big.NewInt(4), curveRHS(u)),
+			fieldMul(big.NewInt(3), s, u, u)))
+		r := fieldSqrt(q)
+		if r == nil || (c&1 == 1 && r.Sign() == 0) {
+			return nil
+		}
+		v = fieldMul(fieldAdd(fieldMul(r, fieldInv(s)), fieldNeg(u)),
+			fieldHalf)
+	}
+
+	w := fieldSqrt(s)
+	if w == nil {
+		return nil
+	}
+
+	// u * (1 - sqrt(-3)) / 2 + v or u * (1 + sqrt(-3)) / 2 + v depending
+	// on the first bit of the case and its sign depending on the third.
+	var m *big.Int
+	if c&1 == 0 {
+		m = fieldAdd(big.NewInt(1), fieldNeg(sqrtMinus3))
+	} else {
+		m = fieldAdd(big.NewInt(1), sqrtMinus3)
+	}
+	t := fieldMul(w, fieldAdd(fieldMul(u, m, fieldHalf), v))
+	if c&5 == 0 || c&5 == 5 {
+		t = fieldNeg(t)
+	}
+	return t
+}
+
+// randomFieldElement returns a random non-zero field element.
+func randomFieldElement() (*big.Int, error) {
+	for {
+		var b [32]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		u := new(big.Int).SetBytes(b[:])
+		if u.Sign() != 0 && u.Cmp(fieldPrime) < 0 {
+			return u, nil
+		}
+	}
+}
+
+// ellswiftEncode returns a random ElligatorSwift encoding of the passed X
+// coordinate.  Every point has many encodings, which are indistinguishable
+// from uniformly random bytes.
+func ellswiftEncode(x *big.Int) ([EllswiftSize]byte, error) {
+	var enc [EllswiftSize]byte
+	for {
+		u, err := randomFieldElement()
+		if err != nil {
+			return enc, err
+		}
+		var c [1]byte
+		if _, err := rand.Read(c[:]); err != nil {
+			return enc, err
+		}
+		t := xswiftecInv(x, u, int(c[0]&7))
+		if t == nil || xswiftec(u, t).Cmp(x) != 0 {
+			continue
+		}
+
+		u.FillBytes(enc[:32])
+		t.FillBytes(enc[32:])
+		return enc, nil
+	}
+}
+
+// ellswiftDecode returns the X coordinate of the point the passed
+// ElligatorSwift encoding decodes to.  All 64 byte strings are valid encodings.
+func ellswiftDecode(enc *[EllswiftSize]byte) *big.Int {
+	u := new(big.Int).SetBytes(enc[:32])
+	t := new(big.Int).SetBytes(enc[32:])
+	return xswiftec(u, t)
+}
+
+// newEllswiftKey returns a new private key along with a random ElligatorSwift
+// encoding of its public key.
+func newEllswiftKey() (*btcec.PrivateKey, [EllswiftSize]byte, error) {
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, [EllswiftSize]byte{}, err
+	}
+	x := new(big.Int).SetBytes(privKey.PubKey().X().Bytes())
+	enc, err := ellswiftEncode(x)
+	if err != nil {
+		return nil, [EllswiftSize]byte{}, err
+	}
+	return privKey, enc, nil
+}
+
+// ellswiftXDH returns the secret shared with the owner of the public key with
+// the passed ElligatorSwift encoding as defined by BIP0324.  The encoding of
+// the public key of the initiator of the connection comes first in the hash.
+func ellswiftXDH(privKey *btcec.PrivateKey, ours, theirs *[EllswiftSize]byte,
+	initiator bool) (*chainhash.Hash, error) {
+
+	var x, y btcec.FieldVal
+	var xBytes [32]byte
+	ellswiftDecode(theirs).FillBytes(xBytes[:])
+	x.SetBytes(&xBytes)
+	if !btcec.DecompressY(&x, false, &y) {
+		return nil, errors.New("ellswift encoding decoded to a point " +
+			"not on the curve")
+	}
+
+	var point, result btcec.JacobianPoint
+	point = btcec.MakeJacobianPoint(&x, &y, new(btcec.FieldVal).SetInt(1))
+	btcec.ScalarMultNonConst(&privKey.Key, &point, &result)
+	result.ToAffine()
+	if result.X.IsZero() && result.Y.IsZero() {
+		return nil, errors.New("ecdh resulted in the point at infinity")
+	}
+	result.X.Normalize()
+	shared := result.X.Bytes()
+
+	if initiator {
+		return chainhash.TaggedHash(ellswiftXDHTag, ours[:], theirs[:],
+			shared[:]), nil
+	}
+	return chainhash.TaggedHash(ellswiftXDHTag, theirs[:], ours[:],
+		shared[:]), nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// TestSqrtMinus3 ensures the square root of -3 the encoding is defined with is
+// used.
+func TestSqrtMinus3(t *testing.T) {
+	want, _ := new(big.Int).SetString("a2d2ba93507f1df233770c2a797962cc"+
+		"61f6d15da14ecd47d8d27ae1cd5f852", 16)
+	if sqrtMinus3.Cmp(want) != 0 {
+		t.Fatalf("got %x, want %x", sqrtMinus3, want)
+	}
+}
+
+// TestXSwiftECInv ensures the field elements found for every case decode back
+// to the encoded X coordinate and that all the cases are used.
+func TestXSwiftECInv(t *testing.T) {
+	var found [8]int
+	for i := 0; i < 200; i++ {
+		privKey, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := new(big.Int).SetBytes(privKey.PubKey().X().Bytes())
+		u, err := randomFieldElement()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for c := 0; c < 8; c++ {
+			tt := xswiftecInv(x, u, c)
+			if tt == nil {
+				continue
+			}
+			found[c]++
+			if got := xswiftec(u, tt); got.Cmp(x) != 0 {
+				t.Fatalf("case %d: u %x t %x decoded to %x, "+
+					"want %x", c, u, tt, got, x)
+			}
+		}
+	}
+	for c, n := range found {
+		if n == 0 {
+			t.Fatalf("case %d never had a preimage", c)
+		}
+	}
+}
+
+// TestEllswiftDecode ensures every encoding decodes to a point on the curve,
+// including the ones with field elements that are mapped to other values.
+func TestEllswiftDecode(t *testing.T) {
+	var encodings [][EllswiftSize]byte
+
+	// All zeros and all ones, which are above the field prime.
+	var zero, ones [EllswiftSize]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	encodings = append(encodings, zero, ones)
+
+	// u^3 + t^2 + 7 = 0 for t = sqrt(-(u^3 + 7)) when it exists.
+	for u := int64(1); ; u++ {
+		tt := fieldSqrt(fieldNeg(curveRHS(big.NewInt(u))))
+		if tt == nil {
+			continue
+		}
+		var special [EllswiftSize]byte
+		big.NewInt(u).FillBytes(special[:32])
+		tt.FillBytes(special[32:])
+		encodings = append(encodings, special)
+		break
+	}
+
+	for i, enc := range encodings {
+		if x := ellswiftDecode(&enc); !isValidX(x) {
+			t.Fatalf("encoding #%d decoded to %x that's not on the "+
+				"curve", i, x)
+		}
+	}
+}
+
+// TestEllswiftXDH ensures both sides derive the same shared secret and that it
+// differs for other keys.
+func TestEllswiftXDH(t *testing.T) {
+	privA, encA, err := newEllswiftKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privB, encB, err := newEllswiftKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privC, encC, err := newEllswiftKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The encoding decodes to the public key.
+	pubX := new(big.Int).SetBytes(privA.PubKey().X().Bytes())
+	if x := ellswiftDecode(&encA); x.Cmp(pubX) != 0 {
+		t.Fatalf("encoding decoded to %x, want %x", x, pubX)
+	}
+
+	secretA, err := ellswiftXDH(privA, &encA, &encB, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretB, err := ellswiftXDH(privB, &encB, &encA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *secretA != *secretB {
+		t.Fatalf("shared secrets differ: %v and %v", secretA, secretB)
+	}
+
+	// The role of the sides is part of the secret.
+	secretB, err = ellswiftXDH(privB, &encB, &encA, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *secretA == *secretB {
+		t.Fatal("shared secret doesn't depend on the initiator")
+	}
+
+	secretC, err := ellswiftXDH(privC, &encC, &encB, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *secretA == *secretC {
+		t.Fatal("shared secret doesn't depend on the keys")
+	}
+}
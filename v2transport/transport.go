@@ -0,0 +1,415 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/wire"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// V1PrefixSize is the size of the start of the version message of the
+	// v1 transport that inbound connections using it are recognized by.
+	V1PrefixSize = 16
+
+	// MaxContentsSize is the maximum size of the contents of a packet.
+	// The length of the contents is sent in 3 bytes.
+	MaxContentsSize = 1<<24 - 1
+
+	// garbageTerminatorSize is the size of the terminator that marks the
+	// end of the garbage that follows the public key of each side.
+	garbageTerminatorSize = 16
+
+	// maxGarbageSize is the maximum size of the garbage.
+	maxGarbageSize = 4095
+
+	// lengthSize is the size of the encrypted length of a packet.
+	lengthSize = 3
+
+	// headerSize is the size of the header of the contents of a packet.
+	headerSize = 1
+
+	// ignoreBit is the bit of the header that marks decoy packets that
+	// are ignored by the receiver.
+	ignoreBit = 1 << 7
+)
+
+var (
+	// ErrGarbageTerminator is returned when the garbage terminator of the
+	// remote peer isn't found after the maximum size of the garbage.
+	ErrGarbageTerminator = errors.New("garbage terminator not found")
+
+	// ErrPacketAuthentication is returned when a packet fails to decrypt,
+	// which means it was modified or that the remote peer derived
+	// different keys.
+	ErrPacketAuthentication = errors.New("packet authentication failed")
+
+	// sharedSecretSalt is the start of the salt the keys of the ciphers
+	// are derived from the shared secret with.  It's followed by the
+	// network magic.
+	sharedSecretSalt = []byte("bitcoin_v2_shared_secret")
+)
+
+// V1Prefix returns the start of the version message of the v1 transport on the
+// passed network.  It's the network magic followed by the zero padded version
+// command.  Inbound connections that start with it use the v1 transport.
+func V1Prefix(btcnet wire.BitcoinNet) []byte {
+	prefix := make([]byte, V1PrefixSize)
+	binary.LittleEndian.PutUint32(prefix, uint32(btcnet))
+	copy(prefix[4:], wire.CmdVersion)
+	return prefix
+}
+
+// Handshake performs the handshake of the v2 transport that establishes the
+// keys of the connection as defined by BIP0324.  Both sides send their
+// ElligatorSwift encoded public key followed by random garbage.  Once each side
+// has the key of the other, it sends the terminator of its garbage and the
+// version packet.  The initiator of the connection sends its key first and the
+// responder answers after receiving it.
+type Handshake struct {
+	r         *bufio.Reader
+	w         io.Writer
+	btcnet    wire.BitcoinNet
+	initiator bool
+
+	privKey *btcec.PrivateKey
+	ourKey  [EllswiftSize]byte
+	garbage []byte
+
+	transport      *Transport
+	sendTerminator []byte
+	recvTerminator []byte
+	keySent        bool
+	keyReceived    bool
+}
+
+// NewHandshake returns the handshake of the v2 transport for a connection on
+// the passed network that's read from r and written to w.
+func NewHandshake(r io.Reader, w io.Writer, btcnet wire.BitcoinNet,
+	initiator bool) (*Handshake, error) {
+
+	// The initiator must not send a key that looks like the start of a
+	// v1 connection or the responder would treat it as one.
+	var privKey *btcec.PrivateKey
+	var ourKey [EllswiftSize]byte
+	for {
+		var err error
+		privKey, ourKey, err = newEllswiftKey()
+		if err != nil {
+			return nil, err
+		}
+		if !initiator || !bytes.Equal(ourKey[:V1PrefixSize],
+			V1Prefix(btcnet)) {
+
+			break
+		}
+	}
+
+	garbageLen, err := rand.Int(rand.Reader, big.NewInt(maxGarbageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	garbage := make([]byte, garbageLen.Int64())
+	if _, err := rand.Read(garbage); err != nil {
+		return nil, err
+	}
+
+	return &Handshake{
+		r:         bufio.NewReader(r),
+		w:         w,
+		btcnet:    btcnet,
+		initiator: initiator,
+		privKey:   privKey,
+		ourKey:    ourKey,
+		garbage:   garbage,
+	}, nil
+}
+
+// SendKey sends our public key followed by the garbage.  The initiator calls it
+// first while the responder calls it after ReceiveKey.
+func (h *Handshake) SendKey() error {
+	msg := make([]byte, 0, EllswiftSize+len(h.garbage))
+	msg = append(msg, h.ourKey[:]...)
+	msg = append(msg, h.garbage...)
+	if _, err := h.w.Write(msg); err != nil {
+		return err
+	}
+	h.keySent = true
+	return nil
+}
+
+// ReceiveKey reads the public key of the remote peer and derives the keys of
+// the connection from the secret shared with it.
+func (h *Handshake) ReceiveKey() error {
+	var theirKey [EllswiftSize]byte
+	if _, err := io.ReadFull(h.r, theirKey[:]); err != nil {
+		return err
+	}
+
+	secret, err := ellswiftXDH(h.privKey, &h.ourKey, &theirKey, h.initiator)
+	if err != nil {
+		return err
+	}
+
+	keys := deriveSessionKeys(secret, h.btcnet)
+	t := newTransport(h.r, h.w, keys, h.initiator)
+	if h.initiator {
+		h.sendTerminator = keys.garbageTerminators[:garbageTerminatorSize]
+		h.recvTerminator = keys.garbageTerminators[garbageTerminatorSize:]
+	} else {
+		h.sendTerminator = keys.garbageTerminators[garbageTerminatorSize:]
+		h.recvTerminator = keys.garbageTerminators[:garbageTerminatorSize]
+	}
+	h.transport = t
+	h.keyReceived = true
+
+	return nil
+}
+
+// Finish sends the garbage terminator along with the version packet and waits
+// for the ones of the remote peer.  It returns the transport the messages of
+// the connection are sent with.  Both keys must have been exchanged.
+func (h *Handshake) Finish() (*Transport, error) {
+	if !h.keySent || !h.keyReceived {
+		return nil, errors.New("the keys of the handshake weren't " +
+			"exchanged")
+	}
+	t := h.transport
+
+	// The version packet is authenticated along with the garbage so that
+	// it can't be modified.  Its contents are empty as no features that
+	// would be negotiated with it are defined yet.
+	msg := make([]byte, 0, garbageTerminatorSize+lengthSize+headerSize+
+		chacha20poly1305.Overhead)
+	msg = append(msg, h.sendTerminator...)
+	msg = t.appendPacket(msg, nil, h.garbage, false)
+	if _, err := h.w.Write(msg); err != nil {
+		return nil, err
+	}
+
+	// Skip the garbage of the remote peer up to its terminator.
+	received := make([]byte, garbageTerminatorSize,
+		maxGarbageSize+garbageTerminatorSize)
+	if _, err := io.ReadFull(h.r, received); err != nil {
+		return nil, err
+	}
+	for !bytes.HasSuffix(received, h.recvTerminator) {
+		if len(received) == maxGarbageSize+garbageTerminatorSize {
+			return nil, ErrGarbageTerminator
+		}
+		b, err := h.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		received = append(received, b)
+	}
+	theirGarbage := received[:len(received)-garbageTerminatorSize]
+
+	// The contents of the version packet are ignored for the features
+	// that might be negotiated with it in the future.
+	if _, _, err := t.readPacket(theirGarbage); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// sessionKeys are the keys of a connection derived from the shared secret.
+type sessionKeys struct {
+	initiatorL         []byte
+	initiatorP         []byte
+	responderL         []byte
+	responderP         []byte
+	garbageTerminators []byte
+	sessionID          []byte
+}
+
+// deriveSessionKeys derives the keys of a connection on the passed network
+// from the shared secret.  The keys are derived with HKDF-SHA256 from the
+// shared secret salted with the network magic so that connections to
+// different networks never share keys.
+func deriveSessionKeys(secret *chainhash.Hash, btcnet wire.BitcoinNet) *sessionKeys {
+	salt := make([]byte, len(sharedSecretSalt)+4)
+	copy(salt, sharedSecretSalt)
+	binary.LittleEndian.PutUint32(salt[len(sharedSecretSalt):],
+		uint32(btcnet))
+	prk := hkdf.Extract(sha256.New, secret[:], salt)
+	expand := func(info string) []byte {
+		key := make([]byte, 32)
+		_, _ = io.ReadFull(hkdf.Expand(sha256.New, prk, []byte(info)), key)
+		return key
+	}
+
+	return &sessionKeys{
+		initiatorL:         expand("initiator_L"),
+		initiatorP:         expand("initiator_P"),
+		responderL:         expand("responder_L"),
+		responderP:         expand("responder_P"),
+		garbageTerminators: expand("garbage_terminators"),
+		sessionID:          expand("session_id"),
+	}
+}
+
+// Transport sends and receives the encrypted packets of a connection that
+// completed the handshake of the v2 transport.  A packet is the encrypted
+// length of its contents followed by the contents along with a header that
+// are encrypted and authenticated with the forward secure ChaCha20Poly1305.
+//
+// Packets can be sent and received concurrently, but only one goroutine may
+// send and one may receive at a time.
+type Transport struct {
+	r         *bufio.Reader
+	w         io.Writer
+	sendL     *fsChaCha20
+	sendP     *fsChaCha20Poly1305
+	recvL     *fsChaCha20
+	recvP     *fsChaCha20Poly1305
+	sessionID [32]byte
+}
+
+// newTransport returns the transport of a connection that's read from r and
+// written to w with the passed keys.  The initiator sends with the keys of the
+// initiator and receives with the ones of the responder.
+func newTransport(r *bufio.Reader, w io.Writer, keys *sessionKeys,
+	initiator bool) *Transport {
+
+	initiatorL := newFSChaCha20(keys.initiatorL)
+	initiatorP := newFSChaCha20Poly1305(keys.initiatorP)
+	responderL := newFSChaCha20(keys.responderL)
+	responderP := newFSChaCha20Poly1305(keys.responderP)
+
+	t := &Transport{r: r, w: w}
+	copy(t.sessionID[:], keys.sessionID)
+	if initiator {
+		t.sendL, t.sendP = initiatorL, initiatorP
+		t.recvL, t.recvP = responderL, responderP
+	} else {
+		t.sendL, t.sendP = responderL, responderP
+		t.recvL, t.recvP = initiatorL, initiatorP
+	}
+	return t
+}
+
+// SessionID returns the id of the session that's the same for both sides of
+// the connection.  It can be compared out of band to detect a man in the
+// middle.
+func (t *Transport) SessionID() [32]byte {
+	return t.sessionID
+}
+
+// appendPacket appends the packet with the passed contents, authenticated
+// along with the associated data, to dst and returns the result.  Decoy packets
+// have the ignore bit set in their header.
+func (t *Transport) appendPacket(dst, contents, aad []byte, ignore bool) []byte {
+	var length [lengthSize]byte
+	length[0] = byte(len(contents))
+	length[1] = byte(len(contents) >> 8)
+	length[2] = byte(len(contents) >> 16)
+	t.sendL.crypt(length[:])
+	dst = append(dst, length[:]...)
+
+	plaintext := make([]byte, headerSize+len(contents))
+	if ignore {
+		plaintext[0] = ignoreBit
+	}
+	copy(plaintext[headerSize:], contents)
+	return t.sendP.encrypt(dst, aad, plaintext)
+}
+
+// WritePacket sends a packet with the passed contents.  It returns the number
+// of bytes written.
+func (t *Transport) WritePacket(contents []byte) (int, error) {
+	if len(contents) > MaxContentsSize {
+		return 0, fmt.Errorf("packet contents of %d bytes are larger "+
+			"than the maximum of %d bytes", len(contents),
+			MaxContentsSize)
+	}
+
+	packet := make([]byte, 0, lengthSize+headerSize+len(contents)+
+		chacha20poly1305.Overhead)
+	packet = t.appendPacket(packet, contents, nil, false)
+	return t.w.Write(packet)
+}
+
+// readPacket reads the next packet that's not a decoy and returns its contents
+// along with the number of bytes read.  The first packet read is authenticated
+// along with the passed associated data.
+func (t *Transport) readPacket(aad []byte) ([]byte, int, error) {
+	var totalBytes int
+	for {
+		var length [lengthSize]byte
+		n, err := io.ReadFull(t.r, length[:])
+		totalBytes += n
+		if err != nil {
+			return nil, totalBytes, err
+		}
+		t.recvL.crypt(length[:])
+		contentsLen := int(length[0]) | int(length[1])<<8 |
+			int(length[2])<<16
+
+		packet := make([]byte, headerSize+contentsLen+
+			chacha20poly1305.Overhead)
+		n, err = io.ReadFull(t.r, packet)
+		totalBytes += n
+		if err != nil {
+			return nil, totalBytes, err
+		}
+		plaintext, err := t.recvP.decrypt(aad, packet)
+		if err != nil {
+			return nil, totalBytes, ErrPacketAuthentication
+		}
+		aad = nil
+
+		if plaintext[0]&ignoreBit == 0 {
+			return plaintext[headerSize:], totalBytes, nil
+		}
+	}
+}
+
+// ReadPacket reads the next packet and returns its contents along with the
+// number of bytes read.  Decoy packets are skipped.
+func (t *Transport) ReadPacket() ([]byte, int, error) {
+	return t.readPacket(nil)
+}
+
+// WriteMessage sends the passed message in a packet.  It returns the number of
+// bytes written.
+func (t *Transport) WriteMessage(msg wire.Message, pver uint32,
+	encoding wire.MessageEncoding) (int, error) {
+
+	contents, err := wire.EncodeV2Message(msg, pver, encoding)
+	if err != nil {
+		return 0, err
+	}
+	return t.WritePacket(contents)
+}
+
+// ReadMessage reads the message in the next packet.  It returns the number of
+// bytes read along with the message and its payload.  Like with the v1
+// transport, wire.ErrUnknownMessage is returned for unknown messages, which
+// can be skipped.
+func (t *Transport) ReadMessage(pver uint32, encoding wire.MessageEncoding) (
+	int, wire.Message, []byte, error) {
+
+	contents, n, err := t.ReadPacket()
+	if err != nil {
+		return n, nil, nil, err
+	}
+	msg, payload, err := wire.DecodeV2Message(contents, pver, encoding)
+	return n, msg, payload, err
+}
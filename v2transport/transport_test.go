@@ -0,0 +1,278 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+// connect returns both ends of a tcp connection on localhost.  Unlike with
+// net.Pipe, writes don't wait for the other end to read them.
+func connect(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	out, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, ok := <-accepted
+	if !ok {
+		t.Fatal("unable to accept the connection")
+	}
+	t.Cleanup(func() {
+		out.Close()
+		in.Close()
+	})
+
+	return out, in
+}
+
+// handshake performs the handshake over a new connection and returns the
+// transports of the initiator and the responder.
+func handshake(t *testing.T, btcnet wire.BitcoinNet) (*Transport, *Transport) {
+	out, in := connect(t)
+
+	type result struct {
+		transport *Transport
+		err       error
+	}
+	responded := make(chan result, 1)
+	go func() {
+		h, err := NewHandshake(in, in, btcnet, false)
+		if err == nil {
+			err = h.ReceiveKey()
+		}
+		if err == nil {
+			err = h.SendKey()
+		}
+		var transport *Transport
+		if err == nil {
+			transport, err = h.Finish()
+		}
+		responded <- result{transport, err}
+	}()
+
+	h, err := NewHandshake(out, out, btcnet, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SendKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReceiveKey(); err != nil {
+		t.Fatal(err)
+	}
+	initiator, err := h.Finish()
+	if err != nil {
+		t.Fatalf("initiator handshake failed: %v", err)
+	}
+
+	r := <-responded
+	if r.err != nil {
+		t.Fatalf("responder handshake failed: %v", r.err)
+	}
+
+	return initiator, r.transport
+}
+
+// TestV1Prefix ensures the prefix of v1 connections is the start of their
+// version message.
+func TestV1Prefix(t *testing.T) {
+	want, _ := hex.DecodeString("f9beb4d976657273696f6e0000000000")
+	if got := V1Prefix(wire.MainNet); !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+
+	var buf bytes.Buffer
+	err := wire.WriteMessage(&buf, wire.NewMsgVersion(&wire.NetAddress{},
+		&wire.NetAddress{}, 0, 0), wire.ProtocolVersion, wire.TestNet3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), V1Prefix(wire.TestNet3)) {
+		t.Fatalf("version message %x doesn't start with the prefix",
+			buf.Bytes())
+	}
+}
+
+// TestTransport ensures messages are sent both ways after the handshake,
+// including after the ciphers are rekeyed, and that decoy packets are skipped.
+func TestTransport(t *testing.T) {
+	initiator, responder := handshake(t, wire.MainNet)
+	if initiator.SessionID() != responder.SessionID() {
+		t.Fatalf("session ids differ: %x and %x", initiator.SessionID(),
+			responder.SessionID())
+	}
+
+	pver := wire.ProtocolVersion
+	msgs := []wire.Message{
+		wire.NewMsgPing(1),
+		wire.NewMsgVerAck(),
+		wire.NewMsgSendAddrV2(),
+		wire.NewMsgAddrV2(),
+	}
+
+	for _, test := range []struct {
+		name     string
+		sender   *Transport
+		receiver *Transport
+	}{
+		{"initiator to responder", initiator, responder},
+		{"responder to initiator", responder, initiator},
+	} {
+		// Send enough messages for both ciphers to be rekeyed a few
+		// times.
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < rekeyInterval*3; i++ {
+				// A decoy packet is sent before some of the
+				// messages.
+				if i%100 == 0 {
+					decoy := make([]byte, 0, 64)
+					decoy = append(decoy, 0, 0, 0)
+					contents := []byte{ignoreBit, 'x'}
+					decoy[0] = byte(len(contents) - 1)
+					test.sender.sendL.crypt(decoy[:3])
+					decoy = test.sender.sendP.encrypt(decoy,
+						nil, contents)
+					if _, err := test.sender.w.Write(decoy); err != nil {
+						done <- err
+						return
+					}
+				}
+
+				msg := msgs[i%len(msgs)]
+				_, err := test.sender.WriteMessage(msg, pver,
+					wire.LatestEncoding)
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+		for i := 0; i < rekeyInterval*3; i++ {
+			_, msg, _, err := test.receiver.ReadMessage(pver,
+				wire.LatestEncoding)
+			if err != nil {
+				t.Fatalf("%s: message #%d: %v", test.name, i, err)
+			}
+			if !reflect.DeepEqual(msg, msgs[i%len(msgs)]) {
+				t.Fatalf("%s: message #%d: got %v, want %v",
+					test.name, i, msg, msgs[i%len(msgs)])
+			}
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+	}
+}
+
+// TestTransportTampered ensures modified packets are rejected.
+func TestTransportTampered(t *testing.T) {
+	initiator, responder := handshake(t, wire.TestNet3)
+
+	var buf bytes.Buffer
+	w := initiator.w
+	initiator.w = &buf
+	_, err := initiator.WriteMessage(wire.NewMsgPing(2),
+		wire.ProtocolVersion, wire.LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := buf.Bytes()
+	packet[len(packet)-1] ^= 1
+	if _, err := w.Write(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = responder.ReadPacket()
+	if err != ErrPacketAuthentication {
+		t.Fatalf("expected ErrPacketAuthentication, got %v", err)
+	}
+}
+
+// TestHandshakeGarbageTerminator ensures the handshake fails when the remote
+// peer sends more garbage than allowed.
+func TestHandshakeGarbageTerminator(t *testing.T) {
+	_, theirKey, err := newEllswiftKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := bytes.NewBuffer(theirKey[:])
+	received.Write(make([]byte, maxGarbageSize+garbageTerminatorSize+1))
+
+	h, err := NewHandshake(received, io.Discard, wire.MainNet, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SendKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReceiveKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Finish(); err != ErrGarbageTerminator {
+		t.Fatalf("expected ErrGarbageTerminator, got %v", err)
+	}
+}
+
+// TestHandshakeDifferentNetworks ensures peers on different networks can't
+// complete the handshake since their keys are derived differently.
+func TestHandshakeDifferentNetworks(t *testing.T) {
+	out, in := connect(t)
+
+	// Neither side finds the garbage terminator of the other, so the
+	// responder gives up after a while and closes the connection.
+	in.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	go func() {
+		defer in.Close()
+		h, err := NewHandshake(in, in, wire.TestNet3, false)
+		if err != nil {
+			return
+		}
+		if h.ReceiveKey() != nil || h.SendKey() != nil {
+			return
+		}
+		h.Finish()
+	}()
+
+	h, err := NewHandshake(out, out, wire.MainNet, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SendKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReceiveKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Finish(); err == nil {
+		t.Fatal("expected the handshake to fail")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package v2transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// readVectors returns the rows of the BIP0324 test vectors in the csv file with
+// the passed name in the testdata directory keyed by their column names.
+func readVectors(t *testing.T, name string) []map[string]string {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) < 2 {
+		t.Fatalf("%s has no test vectors", name)
+	}
+
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// hexToBytes decodes the hex string of a test vector.
+func hexToBytes(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// hexToField decodes the hex string of a field element of a test vector.
+func hexToField(t *testing.T, s string) *big.Int {
+	return new(big.Int).SetBytes(hexToBytes(t, s))
+}
+
+// fieldHex returns the hex encoding of the passed field element.
+func fieldHex(f *big.Int) string {
+	var b [32]byte
+	f.FillBytes(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// TestEllswiftDecodeVectors ensures the ElligatorSwift encodings of the BIP0324
+// test vectors decode to their X coordinates.
+func TestEllswiftDecodeVectors(t *testing.T) {
+	for i, row := range readVectors(t, "ellswift_decode_test_vectors.csv") {
+		var enc [EllswiftSize]byte
+		copy(enc[:], hexToBytes(t, row["ellswift"]))
+		if got := fieldHex(ellswiftDecode(&enc)); got != row["x"] {
+			t.Fatalf("vector #%d: decoded to %s, want %s", i, got,
+				row["x"])
+		}
+	}
+}
+
+// TestXSwiftECInvVectors ensures the field elements found for every case of
+// the BIP0324 test vectors match, including the cases without one.
+func TestXSwiftECInvVectors(t *testing.T) {
+	for i, row := range readVectors(t, "xswiftec_inv_test_vectors.csv") {
+		u := hexToField(t, row["u"])
+		x := hexToField(t, row["x"])
+		for c := 0; c < 8; c++ {
+			want := row["case"+strconv.Itoa(c)+"_t"]
+
+			var got string
+			if tt := xswiftecInv(x, u, c); tt != nil {
+				got = fieldHex(tt)
+			}
+			if got != want {
+				t.Fatalf("vector #%d case %d: got %q, want %q",
+					i, c, got, want)
+			}
+		}
+	}
+}
+
+// TestPacketEncodingVectors ensures the shared secret, the keys and the
+// encrypted packets derived for the BIP0324 test vectors match.  The vectors
+// are for mainnet.
+func TestPacketEncodingVectors(t *testing.T) {
+	for i, row := range readVectors(t, "packet_encoding_test_vectors.csv") {
+		privKey, pubKey := btcec.PrivKeyFromBytes(
+			hexToBytes(t, row["in_priv_ours"]))
+		initiator := row["in_initiating"] == "1"
+		var ours, theirs [EllswiftSize]byte
+		copy(ours[:], hexToBytes(t, row["in_ellswift_ours"]))
+		copy(theirs[:], hexToBytes(t, row["in_ellswift_theirs"]))
+
+		type check struct {
+			name string
+			got  []byte
+		}
+		checks := []check{
+			{"mid_x_ours", pubKey.X().FillBytes(make([]byte, 32))},
+			{"mid_x_ours", ellswiftDecode(&ours).FillBytes(make([]byte, 32))},
+			{"mid_x_theirs", ellswiftDecode(&theirs).FillBytes(make([]byte, 32))},
+		}
+
+		// The x coordinate of the shared point is the one of their
+		// public key multiplied by our private key.
+		var x, y btcec.FieldVal
+		x.SetByteSlice(ellswiftDecode(&theirs).Bytes())
+		if !btcec.DecompressY(&x, false, &y) {
+			t.Fatalf("vector #%d: their key isn't on the curve", i)
+		}
+		var point, shared btcec.JacobianPoint
+		point = btcec.MakeJacobianPoint(&x, &y, new(btcec.FieldVal).SetInt(1))
+		btcec.ScalarMultNonConst(&privKey.Key, &point, &shared)
+		shared.ToAffine()
+		sharedX := shared.X.Bytes()
+		checks = append(checks, check{"mid_x_shared", sharedX[:]})
+
+		secret, err := ellswiftXDH(privKey, &ours, &theirs, initiator)
+		if err != nil {
+			t.Fatalf("vector #%d: %v", i, err)
+		}
+		keys := deriveSessionKeys(secret, wire.MainNet)
+		sendTerminator := keys.garbageTerminators[:garbageTerminatorSize]
+		recvTerminator := keys.garbageTerminators[garbageTerminatorSize:]
+		if !initiator {
+			sendTerminator, recvTerminator = recvTerminator, sendTerminator
+		}
+		checks = append(checks, []check{
+			{"mid_shared_secret", secret[:]},
+			{"mid_initiator_l", keys.initiatorL},
+			{"mid_initiator_p", keys.initiatorP},
+			{"mid_responder_l", keys.responderL},
+			{"mid_responder_p", keys.responderP},
+			{"mid_send_garbage_terminator", sendTerminator},
+			{"mid_recv_garbage_terminator", recvTerminator},
+			{"out_session_id", keys.sessionID},
+		}...)
+		for _, c := range checks {
+			want := hexToBytes(t, row[c.name])
+			if !bytes.Equal(c.got, want) {
+				t.Fatalf("vector #%d: got %s %x, want %x", i,
+					c.name, c.got, want)
+			}
+		}
+
+		// The packet is the one at in_idx sent with our keys.
+		var buf bytes.Buffer
+		tr := newTransport(bufio.NewReader(&buf), &buf, keys, initiator)
+		for j := 0; j < mustAtoi(t, row["in_idx"]); j++ {
+			tr.appendPacket(nil, nil, nil, false)
+		}
+		contents := bytes.Repeat(hexToBytes(t, row["in_contents"]),
+			mustAtoi(t, row["in_multiply"]))
+		packet := tr.appendPacket(nil, contents,
+			hexToBytes(t, row["in_aad"]), row["in_ignore"] == "1")
+
+		got := hex.EncodeToString(packet)
+		if want := row["out_ciphertext"]; want != "" && got != want {
+			t.Fatalf("vector #%d: got packet %s, want %s", i, got, want)
+		}
+		if want := row["out_ciphertext_endswith"]; want != "" &&
+			!strings.HasSuffix(got, want) {
+
+			t.Fatalf("vector #%d: packet doesn't end with %s", i, want)
+		}
+	}
+}
+
+// mustAtoi parses the integer of a test vector.
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatalf("invalid integer %q: %v", s, err)
+	}
+	return n
+}
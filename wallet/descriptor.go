@@ -0,0 +1,532 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/txscript"
+)
+
+const (
+	// descInputCharset are the characters that may appear in a descriptor
+	// in the order that the checksum uses them.
+	descInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// descChecksumCharset are the characters the checksum is encoded with.
+	descChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	// descChecksumLen is the length of a descriptor checksum.
+	descChecksumLen = 8
+
+	// pubKeyBytesLenUncompressed is the length of a serialized uncompressed
+	// public key.
+	pubKeyBytesLenUncompressed = 65
+)
+
+// descGenerator is the generator of the BCH code the descriptor checksum is
+// computed with.
+var descGenerator = [5]uint64{
+	0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+}
+
+// descPolymod feeds the value into the checksum.
+func descPolymod(c uint64, val int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(val)
+	for i, gen := range descGenerator {
+		if (c0>>i)&1 != 0 {
+			c ^= gen
+		}
+	}
+	return c
+}
+
+// DescriptorChecksum returns the checksum of the descriptor as defined in
+// BIP0380.  The descriptor must not include a checksum.
+func DescriptorChecksum(desc string) (string, error) {
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(descInputCharset, ch)
+		if pos == -1 {
+			return "", fmt.Errorf("invalid character %q in descriptor", ch)
+		}
+
+		// Emit a symbol for the position inside the group, for every
+		// character.
+		c = descPolymod(c, pos&31)
+
+		// Accumulate the group numbers and emit them for every three
+		// characters.
+		cls = cls*3 + pos>>5
+		clsCount++
+		if clsCount == 3 {
+			c = descPolymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = descPolymod(c, cls)
+	}
+	for i := 0; i < descChecksumLen; i++ {
+		c = descPolymod(c, 0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, descChecksumLen)
+	for i := range checksum {
+		checksum[i] = descChecksumCharset[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// descriptorType is the kind of script a descriptor produces.
+type descriptorType int
+
+const (
+	descTypePKH descriptorType = iota
+	descTypeWPKH
+	descTypeSHWPKH
+	descTypeTR
+	descTypeAddr
+	descTypeRaw
+)
+
+// descriptorKey is a key expression of a descriptor.  It's either a single
+// public key or an extended public key along with the path to derive from it.
+type descriptorKey struct {
+	// pubKey is the public key when the key isn't an extended public key.
+	pubKey *btcec.PublicKey
+
+	// uncompressed is true when pubKey was given uncompressed.
+	uncompressed bool
+
+	// xpub is the extended public key that the keys are derived from.
+	xpub *hdkeychain.ExtendedKey
+
+	// path is the derivation path after the extended public key, not
+	// including the last step of ranged keys.
+	path []uint32
+
+	// ranged is true when the key expression ends with a /* and thus the
+	// key derived depends on the index.
+	ranged bool
+}
+
+// key returns the public key of the key expression for the given index.
+func (k *descriptorKey) key(index uint32) (*btcec.PublicKey, error) {
+	if k.xpub == nil {
+		return k.pubKey, nil
+	}
+
+	var err error
+	key := k.xpub
+	for _, step := range k.path {
+		key, err = key.Derive(step)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.ranged {
+		key, err = key.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key.ECPubKey()
+}
+
+// serializedKey returns the public key of the key expression for the given
+// index serialized the way it was given.
+func (k *descriptorKey) serializedKey(index uint32) ([]byte, error) {
+	pubKey, err := k.key(index)
+	if err != nil {
+		return nil, err
+	}
+	if k.uncompressed {
+		return pubKey.SerializeUncompressed(), nil
+	}
+	return pubKey.SerializeCompressed(), nil
+}
+
+// Descriptor is an output descriptor that the watch only wallet can keep track
+// of.  Only the descriptors that produce a single key or address are
+// supported: pkh, wpkh, sh(wpkh), tr without a script tree, addr and raw.
+type Descriptor struct {
+	desc     string
+	descType descriptorType
+	key      *descriptorKey
+	script   []byte
+	params   *chaincfg.Params
+}
+
+// String returns the descriptor along with its checksum.
+func (d *Descriptor) String() string {
+	return d.desc
+}
+
+// IsRange returns true if the descriptor produces a script for every index
+// rather than a single script.
+func (d *Descriptor) IsRange() bool {
+	return d.key != nil && d.key.ranged
+}
+
+// Script returns the script of the descriptor at the given index.  The index is
+// ignored for descriptors that aren't ranged.
+func (d *Descriptor) Script(index uint32) ([]byte, error) {
+	var addr btcutil.Address
+	switch d.descType {
+	case descTypeAddr, descTypeRaw:
+		return d.script, nil
+
+	case descTypePKH:
+		pubKey, err := d.key.serializedKey(index)
+		if err != nil {
+			return nil, err
+		}
+		addr, err = btcutil.NewAddressPubKeyHash(
+			btcutil.Hash160(pubKey), d.params)
+		if err != nil {
+			return nil, err
+		}
+
+	case descTypeWPKH, descTypeSHWPKH:
+		pubKey, err := d.key.serializedKey(index)
+		if err != nil {
+			return nil, err
+		}
+		addr, err = btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(pubKey), d.params)
+		if err != nil {
+			return nil, err
+		}
+		if d.descType == descTypeWPKH {
+			break
+		}
+
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		addr, err = btcutil.NewAddressScriptHash(script, d.params)
+		if err != nil {
+			return nil, err
+		}
+
+	case descTypeTR:
+		internalKey, err := d.key.key(index)
+		if err != nil {
+			return nil, err
+		}
+		outputKey := txscript.ComputeTaprootKeyNoScript(internalKey)
+		addr, err = btcutil.NewAddressTaproot(
+			schnorr.SerializePubKey(outputKey), d.params)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown descriptor type %d", d.descType)
+	}
+
+	return txscript.PayToAddrScript(addr)
+}
+
+// ParseDescriptor parses the descriptor for the given network.  The checksum is
+// verified if the descriptor has one.  A descriptor with multipath key
+// expressions such as xpub/<0;1>/* is returned as a descriptor for each of the
+// paths.
+func ParseDescriptor(desc string, params *chaincfg.Params) ([]*Descriptor, error) {
+	body := desc
+	if idx := strings.IndexByte(desc, '#'); idx != -1 {
+		body = desc[:idx]
+		checksum, err := DescriptorChecksum(body)
+		if err != nil {
+			return nil, err
+		}
+		if desc[idx+1:] != checksum {
+			return nil, fmt.Errorf("invalid checksum %q, expected %q",
+				desc[idx+1:], checksum)
+		}
+	}
+
+	bodies, err := expandMultipath(body)
+	if err != nil {
+		return nil, err
+	}
+
+	descs := make([]*Descriptor, 0, len(bodies))
+	for _, body := range bodies {
+		d, err := parseDescriptorBody(body, params)
+		if err != nil {
+			return nil, err
+		}
+		descs = append(descs, d)
+	}
+
+	return descs, nil
+}
+
+// expandMultipath returns the descriptor for each of the paths of its multipath
+// key expressions.  All the multipath expressions must have the same number of
+// paths.  The descriptor is returned as is if it doesn't have any.
+func expandMultipath(desc string) ([]string, error) {
+	var (
+		parts  []string
+		groups [][]string
+	)
+	rest := desc
+	for {
+		start := strings.IndexByte(rest, '<')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '>')
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated multipath expression")
+		}
+		end += start
+
+		paths := strings.Split(rest[start+1:end], ";")
+		if len(paths) < 2 {
+			return nil, fmt.Errorf("multipath expression <%s> needs "+
+				"at least two paths", rest[start+1:end])
+		}
+		if len(groups) > 0 && len(paths) != len(groups[0]) {
+			return nil, fmt.Errorf("multipath expressions have " +
+				"different numbers of paths")
+		}
+
+		parts = append(parts, rest[:start])
+		groups = append(groups, paths)
+		rest = rest[end+1:]
+	}
+	if len(groups) == 0 {
+		return []string{desc}, nil
+	}
+
+	descs := make([]string, len(groups[0]))
+	for i := range descs {
+		var b strings.Builder
+		for j, part := range parts {
+			b.WriteString(part)
+			b.WriteString(groups[j][i])
+		}
+		b.WriteString(rest)
+		descs[i] = b.String()
+	}
+
+	return descs, nil
+}
+
+// unwrapDescriptor returns the argument of the descriptor function of the given
+// name if the descriptor is that function.
+func unwrapDescriptor(desc, name string) (string, bool) {
+	if !strings.HasPrefix(desc, name+"(") || !strings.HasSuffix(desc, ")") {
+		return "", false
+	}
+	return desc[len(name)+1 : len(desc)-1], true
+}
+
+// parseDescriptorBody parses a descriptor without a checksum or multipath key
+// expressions.
+func parseDescriptorBody(body string, params *chaincfg.Params) (*Descriptor, error) {
+	checksum, err := DescriptorChecksum(body)
+	if err != nil {
+		return nil, err
+	}
+	d := &Descriptor{
+		desc:   body + "#" + checksum,
+		params: params,
+	}
+
+	if arg, ok := unwrapDescriptor(body, "sh"); ok {
+		inner, ok := unwrapDescriptor(arg, "wpkh")
+		if !ok {
+			return nil, fmt.Errorf("only sh(wpkh(KEY)) descriptors are " +
+				"supported")
+		}
+		d.descType = descTypeSHWPKH
+		d.key, err = parseDescriptorKey(inner, params, false, false)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if arg, ok := unwrapDescriptor(body, "pkh"); ok {
+		d.descType = descTypePKH
+		d.key, err = parseDescriptorKey(arg, params, true, false)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if arg, ok := unwrapDescriptor(body, "wpkh"); ok {
+		d.descType = descTypeWPKH
+		d.key, err = parseDescriptorKey(arg, params, false, false)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if arg, ok := unwrapDescriptor(body, "tr"); ok {
+		if strings.ContainsRune(arg, ',') {
+			return nil, fmt.Errorf("tr descriptors with script trees " +
+				"are not supported")
+		}
+		d.descType = descTypeTR
+		d.key, err = parseDescriptorKey(arg, params, false, true)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if arg, ok := unwrapDescriptor(body, "addr"); ok {
+		addr, err := btcutil.DecodeAddress(arg, params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s: %v", arg, err)
+		}
+		if !addr.IsForNet(params) {
+			return nil, fmt.Errorf("address %s is not for %s", arg,
+				params.Name)
+		}
+		d.descType = descTypeAddr
+		d.script, err = txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	if arg, ok := unwrapDescriptor(body, "raw"); ok {
+		d.descType = descTypeRaw
+		d.script, err = hex.DecodeString(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script %s: %v", arg, err)
+		}
+		return d, nil
+	}
+
+	return nil, fmt.Errorf("unsupported descriptor %s", body)
+}
+
+// parseDescriptorKey parses the key expression of a descriptor.  Uncompressed
+// public keys are only allowed when allowUncompressed is set and x-only public
+// keys only when xOnly is set.
+func parseDescriptorKey(expr string, params *chaincfg.Params,
+	allowUncompressed, xOnly bool) (*descriptorKey, error) {
+
+	// The origin of the key is only informational so it's checked and
+	// left out.
+	if strings.HasPrefix(expr, "[") {
+		end := strings.IndexByte(expr, ']')
+		if end == -1 {
+			return nil, fmt.Errorf("key origin of %s is not terminated",
+				expr)
+		}
+		origin := strings.Split(expr[1:end], "/")
+		fingerprint, err := hex.DecodeString(origin[0])
+		if err != nil || len(fingerprint) != 4 {
+			return nil, fmt.Errorf("invalid key origin fingerprint %s",
+				origin[0])
+		}
+		for _, step := range origin[1:] {
+			step = strings.TrimRight(step, "'h")
+			if _, err := strconv.ParseUint(step, 10, 31); err != nil {
+				return nil, fmt.Errorf("invalid key origin path "+
+					"step %s", step)
+			}
+		}
+		expr = expr[end+1:]
+	}
+
+	steps := strings.Split(expr, "/")
+	keyStr := steps[0]
+
+	// A single public key can't be followed by a derivation path.
+	if keyBytes, err := hex.DecodeString(keyStr); err == nil {
+		if len(steps) > 1 {
+			return nil, fmt.Errorf("cannot derive from public key %s",
+				keyStr)
+		}
+
+		key := &descriptorKey{}
+		switch {
+		case len(keyBytes) == btcec.PubKeyBytesLenCompressed:
+			key.pubKey, err = btcec.ParsePubKey(keyBytes)
+
+		case len(keyBytes) == schnorr.PubKeyBytesLen && xOnly:
+			key.pubKey, err = schnorr.ParsePubKey(keyBytes)
+
+		case len(keyBytes) == pubKeyBytesLenUncompressed &&
+			allowUncompressed:
+
+			key.pubKey, err = btcec.ParsePubKey(keyBytes)
+			key.uncompressed = true
+
+		default:
+			return nil, fmt.Errorf("invalid public key %s", keyStr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %v",
+				keyStr, err)
+		}
+
+		return key, nil
+	}
+
+	xpub, err := hdkeychain.NewKeyFromString(keyStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %s: %v", keyStr, err)
+	}
+	if xpub.IsPrivate() {
+		return nil, fmt.Errorf("private keys are not supported")
+	}
+	if !bytes.Equal(xpub.Version(), params.HDPublicKeyID[:]) {
+		return nil, fmt.Errorf("extended public key %s is not for %s",
+			keyStr, params.Name)
+	}
+
+	key := &descriptorKey{xpub: xpub}
+	for i, step := range steps[1:] {
+		if strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h") {
+			return nil, fmt.Errorf("hardened derivation step %s "+
+				"requires a private key", step)
+		}
+		if step == "*" {
+			if i != len(steps)-2 {
+				return nil, fmt.Errorf("* must be the last step " +
+					"of the derivation path")
+			}
+			key.ranged = true
+			break
+		}
+
+		idx, err := strconv.ParseUint(step, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation step %s", step)
+		}
+		key.path = append(key.path, uint32(idx))
+	}
+
+	return key, nil
+}
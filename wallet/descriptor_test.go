@@ -0,0 +1,213 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wallet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg"
+	"github.com/utreexo/utreexod/txscript"
+)
+
+// mustDescriptorChecksum returns the checksum of the descriptor and panics if
+// it has invalid characters.
+func mustDescriptorChecksum(desc string) string {
+	checksum, err := DescriptorChecksum(desc)
+	if err != nil {
+		panic(err)
+	}
+	return checksum
+}
+
+// toXpub returns the extended public key with the mainnet xpub version.
+func toXpub(key string) string {
+	xkey, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		panic(err)
+	}
+	xkey, err = xkey.CloneWithVersion(chaincfg.MainNetParams.HDPublicKeyID[:])
+	if err != nil {
+		panic(err)
+	}
+	return xkey.String()
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	tests := []struct {
+		desc     string
+		checksum string
+	}{
+		{"raw(deadbeef)", "89f8spxm"},
+		{
+			"pkh([d34db33f/44'/0'/0']xpub6ERApfZwUNrhLCkDtcHTcxd75Rbz" +
+				"S1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY" +
+				"2grBGRjaDMzQLcgJvLJuZZvRcEL/1/*)",
+			"ml40v0wf",
+		},
+	}
+
+	for _, test := range tests {
+		checksum, err := DescriptorChecksum(test.desc)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.desc, err)
+		}
+		if checksum != test.checksum {
+			t.Fatalf("%s: expected checksum %s, got %s", test.desc,
+				test.checksum, checksum)
+		}
+	}
+
+	if _, err := DescriptorChecksum("raw(deadbeef)\n"); err == nil {
+		t.Fatalf("expected an error for an invalid character")
+	}
+}
+
+func TestParseDescriptor(t *testing.T) {
+	// The keys are the account keys of the "abandon abandon ... about"
+	// mnemonic from the test vectors of BIP0044, BIP0049, BIP0084 and
+	// BIP0086.
+	bip44 := "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGF" +
+		"Nbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	bip49 := toXpub("ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9a" +
+		"zLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP")
+	bip84 := toXpub("zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPh" +
+		"XNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs")
+	bip86 := "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLt" +
+		"eoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+
+	tests := []struct {
+		name    string
+		desc    string
+		isRange bool
+
+		// addrs are the addresses of the expanded descriptors at index 0.
+		addrs []string
+	}{
+		{
+			name:    "pkh",
+			desc:    "pkh([73c5da0a/44'/0'/0']" + bip44 + "/0/*)",
+			isRange: true,
+			addrs:   []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		},
+		{
+			name:    "sh(wpkh)",
+			desc:    "sh(wpkh(" + bip49 + "/0/*))",
+			isRange: true,
+			addrs:   []string{"37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		},
+		{
+			name:    "wpkh multipath",
+			desc:    "wpkh([73c5da0a/84h/0h/0h]" + bip84 + "/<0;1>/*)",
+			isRange: true,
+			addrs: []string{
+				"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+				"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+			},
+		},
+		{
+			name:    "tr",
+			desc:    "tr(" + bip86 + "/0/*)",
+			isRange: true,
+			addrs: []string{
+				"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+			},
+		},
+		{
+			name:  "addr",
+			desc:  "addr(bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu)",
+			addrs: []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		},
+		{
+			name: "wpkh with checksum",
+			desc: "wpkh(" + bip84 + "/0/*)#" +
+				mustDescriptorChecksum("wpkh("+bip84+"/0/*)"),
+			isRange: true,
+			addrs:   []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		},
+	}
+
+	for _, test := range tests {
+		descs, err := ParseDescriptor(test.desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if len(descs) != len(test.addrs) {
+			t.Fatalf("%s: expected %d descriptors, got %d", test.name,
+				len(test.addrs), len(descs))
+		}
+
+		for i, desc := range descs {
+			if desc.IsRange() != test.isRange {
+				t.Fatalf("%s: expected range %v, got %v", test.name,
+					test.isRange, desc.IsRange())
+			}
+
+			// The descriptor must parse back to itself with the
+			// checksum it's returned with.
+			reparsed, err := ParseDescriptor(desc.String(),
+				&chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+			if reparsed[0].String() != desc.String() {
+				t.Fatalf("%s: expected %s, got %s", test.name,
+					desc.String(), reparsed[0].String())
+			}
+
+			addr, err := btcutil.DecodeAddress(test.addrs[i],
+				&chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := desc.Script(0)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", test.name, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s: expected script %x, got %x", test.name,
+					want, got)
+			}
+		}
+	}
+}
+
+func TestParseDescriptorErrors(t *testing.T) {
+	xpub := "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGF" +
+		"Nbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	tpub := "tpubDC6ej6KDdtPrhrGN1EHDymPL6pK6hcRyWE3r3tLn4W6ePHvk7LUEi86yn" +
+		"guY4KJjRD4kUmHYhC2C4UEdiyM9TT9vYgaRRsqezkQUkypSFUg"
+	xprv := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiC" +
+		"hkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	tests := []struct {
+		name string
+		desc string
+	}{
+		{"bad checksum", "wpkh(" + xpub + "/0/*)#aaaaaaaa"},
+		{"private key", "wpkh(" + xprv + "/0/*)"},
+		{"hardened step", "wpkh(" + xpub + "/0'/*)"},
+		{"hardened range", "wpkh(" + xpub + "/0/*h)"},
+		{"range not last", "wpkh(" + xpub + "/*/0)"},
+		{"wrong network", "wpkh(" + tpub + "/0/*)"},
+		{"uneven multipath", "wpkh(" + xpub + "/<0;1>/<0;1;2>/*)"},
+		{"script tree", "tr(" + xpub + "/0/*,pk(" + xpub + "/1/*))"},
+		{"sh without wpkh", "sh(pkh(" + xpub + "/0/*))"},
+		{"unsupported", "multi(1," + xpub + "/0/*)"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseDescriptor(test.desc, &chaincfg.MainNetParams)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -298,6 +298,18 @@ type WalletState struct {
 
 	// RelevantMempoolTxs are the mempool txs that the wallet controls.
 	RelevantMempoolTxs map[chainhash.Hash]MempoolTx `json:"relevantmempooltxs"`
+
+	/*
+	 * The below fields are all the fields that are relevant to the descriptors of a wallet.
+	 */
+
+	// WatchedDescriptors are a map of maps mapping descriptors to the hex encoded
+	// scripts derived from them and the index each script was derived at.
+	WatchedDescriptors map[string]map[string]uint32 `json:"watcheddescriptors"`
+
+	// LastDescriptorIndex refers to the index the next script of each descriptor
+	// will be derived at.
+	LastDescriptorIndex map[string]uint32 `json:"lastdescriptorindex"`
 }
 
 func (wp WalletState) MarshalJSON() ([]byte, error) {
@@ -337,6 +349,9 @@ func (wp WalletState) MarshalJSON() ([]byte, error) {
 		LastExternalIndex map[string]uint32          `json:"lastexternalindex"`
 		LastInternalIndex map[string]uint32          `json:"lastinternalindex"`
 
+		WatchedDescriptors  map[string]map[string]uint32 `json:"watcheddescriptors"`
+		LastDescriptorIndex map[string]uint32            `json:"lastdescriptorindex"`
+
 		BestHash           string                    `json:"besthash"`
 		RelevantUtxos      []LeafDataExtras          `json:"relevantutxos"`
 		RelevantStxos      []LeafDataExtras          `json:"relevantstxos"`
@@ -352,6 +367,9 @@ func (wp WalletState) MarshalJSON() ([]byte, error) {
 		LastExternalIndex: wp.LastExternalIndex,
 		LastInternalIndex: wp.LastInternalIndex,
 
+		WatchedDescriptors:  wp.WatchedDescriptors,
+		LastDescriptorIndex: wp.LastDescriptorIndex,
+
 		BestHash:           wp.BestHash.String(),
 		RelevantUtxos:      utxos,
 		RelevantStxos:      stxos,
@@ -373,6 +391,9 @@ func (wp *WalletState) UnmarshalJSON(data []byte) error {
 		LastExternalIndex map[string]uint32          `json:"lastexternalindex"`
 		LastInternalIndex map[string]uint32          `json:"lastinternalindex"`
 
+		WatchedDescriptors  map[string]map[string]uint32 `json:"watcheddescriptors"`
+		LastDescriptorIndex map[string]uint32            `json:"lastdescriptorindex"`
+
 		BestHash           string                    `json:"besthash"`
 		RelevantUtxos      []LeafDataExtras          `json:"relevantutxos"`
 		RelevantStxos      []LeafDataExtras          `json:"relevantstxos"`
@@ -399,6 +420,8 @@ func (wp *WalletState) UnmarshalJSON(data []byte) error {
 	wp.WatchedKeys = s.WatchedKeys
 	wp.LastExternalIndex = s.LastExternalIndex
 	wp.LastInternalIndex = s.LastInternalIndex
+	wp.WatchedDescriptors = s.WatchedDescriptors
+	wp.LastDescriptorIndex = s.LastDescriptorIndex
 
 	wp.RelevantUtxos = make(map[wire.OutPoint]LeafDataExtras, len(s.RelevantUtxos))
 	for _, utxo := range s.RelevantUtxos {
@@ -459,6 +482,7 @@ type WalletConfig struct {
 	Net          string
 	ExtendedKeys map[string]HDVersion
 	Addresses    map[string]struct{}
+	Descriptors  map[string]struct{}
 	GapLimit     uint32
 }
 
@@ -468,16 +492,23 @@ func (ws WalletConfig) MarshalJSON() ([]byte, error) {
 		addresses = append(addresses, k)
 	}
 
+	descriptors := make([]string, 0, len(ws.Descriptors))
+	for k := range ws.Descriptors {
+		descriptors = append(descriptors, k)
+	}
+
 	s := struct {
 		Net          string               `json:"net"`
 		ExtendedKeys map[string]HDVersion `json:"extendedkeys"`
 		Addresses    []string             `json:"addresses"`
+		Descriptors  []string             `json:"descriptors"`
 		GapLimit     uint32               `json:"gaplimit"`
 	}{
 		Net:          ws.Net,
 		ExtendedKeys: ws.ExtendedKeys,
 		GapLimit:     ws.GapLimit,
 		Addresses:    addresses,
+		Descriptors:  descriptors,
 	}
 
 	return json.Marshal(s)
@@ -488,6 +519,7 @@ func (ws *WalletConfig) UnmarshalJSON(data []byte) error {
 		Net          string            `json:"net"`
 		ExtendedKeys map[string]uint32 `json:"extendedkeys"`
 		Addresses    []string          `json:"addresses"`
+		Descriptors  []string          `json:"descriptors"`
 		GapLimit     uint32            `json:"gaplimit"`
 	}{}
 	err := json.Unmarshal(data, &s)
@@ -508,6 +540,8 @@ func (ws *WalletConfig) UnmarshalJSON(data []byte) error {
 		params = chaincfg.MainNetParams
 	case chaincfg.TestNet3Params.Name:
 		params = chaincfg.TestNet3Params
+	case chaincfg.TestNet4Params.Name:
+		params = chaincfg.TestNet4Params
 	case chaincfg.RegressionNetParams.Name:
 		params = chaincfg.RegressionNetParams
 	case chaincfg.SimNetParams.Name:
@@ -527,6 +561,19 @@ func (ws *WalletConfig) UnmarshalJSON(data []byte) error {
 
 		ws.Addresses[addr.String()] = struct{}{}
 	}
+
+	ws.Descriptors = make(map[string]struct{}, len(s.Descriptors))
+	for _, descriptor := range s.Descriptors {
+		descs, err := ParseDescriptor(descriptor, &params)
+		if err != nil {
+			return fmt.Errorf("Failed to parse the descriptor %s. Error: %v",
+				descriptor, err)
+		}
+
+		for _, desc := range descs {
+			ws.Descriptors[desc.String()] = struct{}{}
+		}
+	}
 	ws.GapLimit = s.GapLimit
 
 	return nil
@@ -546,6 +593,9 @@ type WatchOnlyWalletManager struct {
 	wallet       WalletState
 	walletConfig WalletConfig
 
+	// descriptors are the parsed descriptors of the wallet config.
+	descriptors map[string]*Descriptor
+
 	// scriptHashSubscribers are the subscribers we need to push updates to.
 	scriptHashSubscribers []chan interface{}
 }
@@ -872,16 +922,38 @@ func (wm *WatchOnlyWalletManager) ProveTx(tx *btcutil.Tx) (*wire.UData, error) {
 	return &ud, nil
 }
 
-// scanForScript scans all the addresses and the extended pubkeys for the script passed in.
-// Returns true if we have the key for the script and creates the next key in the gap if the
-// script belongs to an extended pubkey.
+// scanForScript scans all the addresses, the extended pubkeys, and the descriptors for the
+// script passed in. Returns true if we have the key for the script and creates the next key
+// in the gap if the script belongs to an extended pubkey or a ranged descriptor.
 func (wm *WatchOnlyWalletManager) scanForScript(pkScript []byte) (bool, error) {
+	var found bool
+	scriptStr := hex.EncodeToString(pkScript)
+	for descStr, scripts := range wm.wallet.WatchedDescriptors {
+		idx, f := scripts[scriptStr]
+		if !f {
+			continue
+		}
+		found = f
+
+		desc, f := wm.descriptors[descStr]
+		if !f || !desc.IsRange() {
+			continue
+		}
+
+		// Keep the gap limit worth of scripts after the used one watched.
+		for wm.wallet.LastDescriptorIndex[descStr] <= idx+wm.walletConfig.GapLimit {
+			err := wm.nextDescriptorScript(desc)
+			if err != nil {
+				return found, err
+			}
+		}
+	}
+
 	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, wm.config.ChainParams)
 	if err != nil {
-		return false, err
+		return found, err
 	}
 
-	var found bool
 	for _, addr := range addrs {
 		addrString := addr.String()
 
@@ -1651,6 +1723,226 @@ func (wm *WatchOnlyWalletManager) RegisterAddress(address string) error {
 	return nil
 }
 
+// nextDescriptorScript derives the script of the descriptor at the stored index and adds
+// it to the scripts to be watched.
+func (wm *WatchOnlyWalletManager) nextDescriptorScript(desc *Descriptor) error {
+	descStr := desc.String()
+	idx := wm.wallet.LastDescriptorIndex[descStr]
+
+	script, err := desc.Script(idx)
+	if err != nil {
+		return err
+	}
+	wm.wallet.LastDescriptorIndex[descStr] = idx + 1
+
+	scriptStr := hex.EncodeToString(script)
+	scripts, found := wm.wallet.WatchedDescriptors[descStr]
+	if found {
+		scripts[scriptStr] = idx
+	} else {
+		wm.wallet.WatchedDescriptors[descStr] = map[string]uint32{scriptStr: idx}
+	}
+
+	log.Debugf("Watching script %s at index %d with descriptor %s\n", scriptStr, idx, descStr)
+
+	return nil
+}
+
+// RegisterDescriptor registers an output descriptor for the watch only wallet to keep track
+// of. A descriptor with multipath key expressions is registered as a descriptor for each of
+// its paths. Returns the registered descriptors along with their checksums.
+func (wm *WatchOnlyWalletManager) RegisterDescriptor(descriptor string) ([]string, error) {
+	descs, err := ParseDescriptor(descriptor, wm.config.ChainParams)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse the passed in descriptor %s. Error: %v",
+			descriptor, err)
+	}
+
+	wm.walletLock.Lock()
+	defer wm.walletLock.Unlock()
+
+	registered := make([]string, 0, len(descs))
+	for _, desc := range descs {
+		descStr := desc.String()
+		registered = append(registered, descStr)
+
+		_, found := wm.walletConfig.Descriptors[descStr]
+		if found {
+			log.Infof("Descriptor: %s is already registered", descStr)
+			continue
+		}
+
+		wm.walletConfig.Descriptors[descStr] = struct{}{}
+		wm.descriptors[descStr] = desc
+		wm.wallet.LastDescriptorIndex[descStr] = 0
+
+		// Generate scripts to be watched up til the gap limit. Descriptors that
+		// aren't ranged only have the one script.
+		count := uint32(1)
+		if desc.IsRange() {
+			count = wm.walletConfig.GapLimit
+		}
+		for i := uint32(0); i < count; i++ {
+			err := wm.nextDescriptorScript(desc)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		log.Infof("Registered descriptor: %s", descStr)
+	}
+
+	return registered, nil
+}
+
+// WalletUtxo is a utxo that the watch only wallet keeps track of along with a proof that
+// it's in the accumulator.
+type WalletUtxo struct {
+	LeafDataExtras
+
+	// Descriptor is the registered descriptor the utxo was found with. Empty if the
+	// utxo was found with an address or an extended pubkey.
+	Descriptor string
+
+	// Proof proves the utxo against the accumulator at the best hash of the wallet.
+	Proof *wire.UData
+}
+
+// GetUtxos returns the utxos that this watch only wallet is keeping track of, each with
+// its own proof so that they can be spent independently of each other. If descriptor isn't
+// empty, only the utxos of that registered descriptor are returned. The best hash and the
+// number of leaves that the proofs are for are returned as well.
+func (wm *WatchOnlyWalletManager) GetUtxos(descriptor string) ([]WalletUtxo, chainhash.Hash, uint64, error) {
+	wm.walletLock.RLock()
+	defer wm.walletLock.RUnlock()
+
+	var wantDescs map[string]struct{}
+	if descriptor != "" {
+		descs, err := ParseDescriptor(descriptor, wm.config.ChainParams)
+		if err != nil {
+			return nil, chainhash.Hash{}, 0, fmt.Errorf("Failed to parse the "+
+				"passed in descriptor %s. Error: %v", descriptor, err)
+		}
+
+		wantDescs = make(map[string]struct{}, len(descs))
+		for _, desc := range descs {
+			_, found := wm.walletConfig.Descriptors[desc.String()]
+			if !found {
+				return nil, chainhash.Hash{}, 0, fmt.Errorf("Descriptor %s "+
+					"is not registered", desc.String())
+			}
+			wantDescs[desc.String()] = struct{}{}
+		}
+	}
+
+	scriptDescs := make(map[string]string)
+	for descStr, scripts := range wm.wallet.WatchedDescriptors {
+		for script := range scripts {
+			scriptDescs[script] = descStr
+		}
+	}
+
+	utxos := []WalletUtxo{}
+	for _, txData := range wm.wallet.RelevantUtxos {
+		descStr := scriptDescs[hex.EncodeToString(txData.LeafData.PkScript)]
+		if wantDescs != nil {
+			if _, found := wantDescs[descStr]; !found {
+				continue
+			}
+		}
+
+		leafHash := txData.LeafData.LeafHash()
+		targetsToProve := []uint64{}
+		for idx, hash := range wm.wallet.UtreexoLeaves {
+			if leafHash == hash {
+				targetsToProve = append(targetsToProve, wm.wallet.UtreexoProof.Targets[idx])
+				break
+			}
+		}
+		if len(targetsToProve) == 0 {
+			return nil, chainhash.Hash{}, 0, fmt.Errorf("Couldn't find the "+
+				"leaf of utxo %s", txData.LeafData.OutPoint.String())
+		}
+
+		// Extract only the proof needed to prove this utxo from the batched
+		// proof we're keeping.
+		_, proof, err := utreexo.GetProofSubset(
+			wm.wallet.UtreexoProof, wm.wallet.UtreexoLeaves, targetsToProve, wm.wallet.NumLeaves)
+		if err != nil {
+			return nil, chainhash.Hash{}, 0, fmt.Errorf("Couldn't grab the "+
+				"utreexo proof for utxo %s. Error: %v",
+				txData.LeafData.OutPoint.String(), err)
+		}
+
+		utxos = append(utxos, WalletUtxo{
+			LeafDataExtras: txData,
+			Descriptor:     descStr,
+			Proof: &wire.UData{
+				AccProof:  proof,
+				LeafDatas: []wire.LeafData{txData.LeafData},
+			},
+		})
+	}
+
+	// Sort by the "blockchain ordering" which means to sort by height, then the
+	// implied transaction index inside of a block and then the output index.
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].BlockHeight != utxos[j].BlockHeight {
+			return utxos[i].BlockHeight < utxos[j].BlockHeight
+		}
+		if utxos[i].BlockIdx != utxos[j].BlockIdx {
+			return utxos[i].BlockIdx < utxos[j].BlockIdx
+		}
+		return utxos[i].LeafData.OutPoint.Index < utxos[j].LeafData.OutPoint.Index
+	})
+
+	return utxos, wm.wallet.BestHash, wm.wallet.NumLeaves, nil
+}
+
+// ProveOutPoints returns the leaf datas of the passed in outpoints along with a
+// single proof for all of them. The leaf datas and the proof targets are in the
+// same order as the outpoints. All the outpoints must be utxos of the wallet. The
+// best hash that the proof is for is returned as well.
+func (wm *WatchOnlyWalletManager) ProveOutPoints(outPoints []wire.OutPoint) (*wire.UData, chainhash.Hash, error) {
+	wm.walletLock.RLock()
+	defer wm.walletLock.RUnlock()
+
+	leafDatas := make([]wire.LeafData, 0, len(outPoints))
+	targetsToProve := make([]uint64, 0, len(outPoints))
+	for _, outPoint := range outPoints {
+		txData, found := wm.wallet.RelevantUtxos[outPoint]
+		if !found {
+			return nil, chainhash.Hash{}, fmt.Errorf("Outpoint %s is not "+
+				"a utxo of the wallet", outPoint.String())
+		}
+
+		leafHash := txData.LeafData.LeafHash()
+		found = false
+		for idx, hash := range wm.wallet.UtreexoLeaves {
+			if leafHash == hash {
+				targetsToProve = append(targetsToProve, wm.wallet.UtreexoProof.Targets[idx])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, chainhash.Hash{}, fmt.Errorf("Couldn't find the "+
+				"leaf of utxo %s", outPoint.String())
+		}
+
+		leafDatas = append(leafDatas, txData.LeafData)
+	}
+
+	_, proof, err := utreexo.GetProofSubset(
+		wm.wallet.UtreexoProof, wm.wallet.UtreexoLeaves, targetsToProve, wm.wallet.NumLeaves)
+	if err != nil {
+		return nil, chainhash.Hash{}, fmt.Errorf("Couldn't grab the "+
+			"utreexo proof for the outpoints. Error: %v", err)
+	}
+
+	return &wire.UData{AccProof: proof, LeafDatas: leafDatas}, wm.wallet.BestHash, nil
+}
+
 // GetProof returns a proof that can be used to verify the utreexo leaves.
 func (wm *WatchOnlyWalletManager) GetProof() blockchain.ChainTipProof {
 	wm.walletLock.RLock()
@@ -1712,6 +2004,7 @@ func New(config *Config) (*WatchOnlyWalletManager, error) {
 		Net:          config.ChainParams.Name,
 		ExtendedKeys: make(map[string]HDVersion),
 		Addresses:    make(map[string]struct{}),
+		Descriptors:  make(map[string]struct{}),
 		GapLimit:     20, // 20 is the default.
 	}
 
@@ -1747,15 +2040,27 @@ func New(config *Config) (*WatchOnlyWalletManager, error) {
 	}
 	wm.walletConfig = walletConfig
 
+	wm.descriptors = make(map[string]*Descriptor, len(walletConfig.Descriptors))
+	for descriptor := range walletConfig.Descriptors {
+		descs, err := ParseDescriptor(descriptor, config.ChainParams)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse descriptor %s in the "+
+				"wallet config. Error: %v", descriptor, err)
+		}
+		wm.descriptors[descriptor] = descs[0]
+	}
+
 	wallet := WalletState{
-		BestHash:           *config.ChainParams.GenesisHash,
-		WatchedKeys:        make(map[string]map[string]bool),
-		LastExternalIndex:  make(map[string]uint32),
-		LastInternalIndex:  make(map[string]uint32),
-		RelevantUtxos:      make(map[wire.OutPoint]LeafDataExtras),
-		RelevantStxos:      make(map[wire.OutPoint]LeafDataExtras),
-		RelevantTxs:        make(map[chainhash.Hash]RelevantTxData),
-		RelevantMempoolTxs: make(map[chainhash.Hash]MempoolTx),
+		BestHash:            *config.ChainParams.GenesisHash,
+		WatchedKeys:         make(map[string]map[string]bool),
+		LastExternalIndex:   make(map[string]uint32),
+		LastInternalIndex:   make(map[string]uint32),
+		WatchedDescriptors:  make(map[string]map[string]uint32),
+		LastDescriptorIndex: make(map[string]uint32),
+		RelevantUtxos:       make(map[wire.OutPoint]LeafDataExtras),
+		RelevantStxos:       make(map[wire.OutPoint]LeafDataExtras),
+		RelevantTxs:         make(map[chainhash.Hash]RelevantTxData),
+		RelevantMempoolTxs:  make(map[chainhash.Hash]MempoolTx),
 	}
 	// Check if the wallet state exists on disk.
 	walletName := filepath.Join(walletDir, defaultWalletName)
@@ -1772,6 +2077,15 @@ func New(config *Config) (*WatchOnlyWalletManager, error) {
 			return nil, fmt.Errorf("Couldn't unmarshal contents from "+
 				"wallet at %s. Error: %v", walletName, err)
 		}
+
+		// Wallets written before descriptors were supported don't have
+		// the descriptor fields.
+		if wallet.WatchedDescriptors == nil {
+			wallet.WatchedDescriptors = make(map[string]map[string]uint32)
+		}
+		if wallet.LastDescriptorIndex == nil {
+			wallet.LastDescriptorIndex = make(map[string]uint32)
+		}
 	}
 	wm.wallet = wallet
 
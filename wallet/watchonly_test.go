@@ -131,6 +131,7 @@ func TestWalletConfigMarshal(t *testing.T) {
 				Net:          "mainnet",
 				Addresses:    make(map[string]struct{}),
 				ExtendedKeys: make(map[string]HDVersion),
+				Descriptors:  make(map[string]struct{}),
 				GapLimit:     20,
 			},
 		},
@@ -154,6 +155,14 @@ func TestWalletConfigMarshal(t *testing.T) {
 					m["tb1qu2ux2hwyp734ng039h7kkdnley2sn0gdfv94aw"] = struct{}{}
 					return m
 				}(),
+				Descriptors: func() map[string]struct{} {
+					m := make(map[string]struct{})
+					m["wpkh(tpubDC6ej6KDdtPrhrGN1EHDymPL6pK6hcRyWE3r3tLn4W6ePHvk7LUEi86ynguY4KJjRD4kUmHYhC2C4UEdiyM9TT9vYgaRRsqezkQUkypSFUg/0/*)#"+
+						mustDescriptorChecksum("wpkh(tpubDC6ej6KDdtPrhrGN1EHDymPL6pK6hcRyWE3r3tLn4W6ePHvk7LUEi86ynguY4KJjRD4kUmHYhC2C4UEdiyM9TT9vYgaRRsqezkQUkypSFUg/0/*)")] = struct{}{}
+					m["addr(tb1q6ruejymgrt8qdmfmc2c9t7ukl0kwk0hnsvfg74)#"+
+						mustDescriptorChecksum("addr(tb1q6ruejymgrt8qdmfmc2c9t7ukl0kwk0hnsvfg74)")] = struct{}{}
+					return m
+				}(),
 				GapLimit: 20,
 			},
 		},
@@ -186,16 +195,18 @@ func TestWalletStateMarshal(t *testing.T) {
 		{
 			name: "emtpy mainnet",
 			state: WalletState{
-				BestHash:           *chaincfg.MainNetParams.GenesisHash,
-				WatchedKeys:        make(map[string]map[string]bool),
-				LastExternalIndex:  make(map[string]uint32),
-				LastInternalIndex:  make(map[string]uint32),
-				RelevantUtxos:      make(map[wire.OutPoint]LeafDataExtras),
-				RelevantStxos:      make(map[wire.OutPoint]LeafDataExtras),
-				RelevantTxs:        make(map[chainhash.Hash]RelevantTxData),
-				RelevantMempoolTxs: make(map[chainhash.Hash]MempoolTx),
-				UtreexoLeaves:      []utreexo.Hash{},
-				UtreexoProof:       utreexo.Proof{Targets: []uint64{}, Proof: []utreexo.Hash{}},
+				BestHash:            *chaincfg.MainNetParams.GenesisHash,
+				WatchedKeys:         make(map[string]map[string]bool),
+				LastExternalIndex:   make(map[string]uint32),
+				LastInternalIndex:   make(map[string]uint32),
+				RelevantUtxos:       make(map[wire.OutPoint]LeafDataExtras),
+				RelevantStxos:       make(map[wire.OutPoint]LeafDataExtras),
+				RelevantTxs:         make(map[chainhash.Hash]RelevantTxData),
+				RelevantMempoolTxs:  make(map[chainhash.Hash]MempoolTx),
+				WatchedDescriptors:  make(map[string]map[string]uint32),
+				LastDescriptorIndex: make(map[string]uint32),
+				UtreexoLeaves:       []utreexo.Hash{},
+				UtreexoProof:        utreexo.Proof{Targets: []uint64{}, Proof: []utreexo.Hash{}},
 			},
 		},
 		{
@@ -506,3 +517,171 @@ func TestWalletStateMarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestGetUtxos(t *testing.T) {
+	wm := WatchOnlyWalletManager{
+		config: &Config{ChainParams: &chaincfg.RegressionNetParams},
+		walletConfig: WalletConfig{
+			Descriptors: make(map[string]struct{}),
+			GapLimit:    3,
+		},
+		wallet: WalletState{
+			WatchedDescriptors:  make(map[string]map[string]uint32),
+			LastDescriptorIndex: make(map[string]uint32),
+			RelevantUtxos:       make(map[wire.OutPoint]LeafDataExtras),
+		},
+		descriptors: make(map[string]*Descriptor),
+	}
+
+	desc := "wpkh(tpubDC6ej6KDdtPrhrGN1EHDymPL6pK6hcRyWE3r3tLn4W6ePHvk7LUE" +
+		"i86ynguY4KJjRD4kUmHYhC2C4UEdiyM9TT9vYgaRRsqezkQUkypSFUg/0/*)"
+	registered, err := wm.RegisterDescriptor(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 1 || wm.wallet.LastDescriptorIndex[registered[0]] != 3 {
+		t.Fatalf("expected 3 scripts of %v to be watched, got %d", registered,
+			wm.wallet.LastDescriptorIndex[registered[0]])
+	}
+
+	// Receiving to the last script in the gap should keep the gap limit worth
+	// of scripts after it watched.
+	descs, err := ParseDescriptor(desc, wm.config.ChainParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script2, err := descs[0].Script(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := wm.scanForScript(script2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || wm.wallet.LastDescriptorIndex[registered[0]] != 6 {
+		t.Fatalf("expected the script to be found and 6 scripts to be "+
+			"watched, got %v and %d", found,
+			wm.wallet.LastDescriptorIndex[registered[0]])
+	}
+
+	// Add leaves to the accumulator with a few of them belonging to the wallet.
+	script0, err := descs[0].Script(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherScript, err := hex.DecodeString("0014" +
+		"0000000000000000000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc := utreexo.NewAccumulator()
+	var adds []utreexo.Leaf
+	for i := 0; i < 10; i++ {
+		ld := wire.LeafData{
+			OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i)}, Index: uint32(i)},
+			Height:   int32(i),
+			Amount:   int64(i) * 1000,
+			PkScript: otherScript,
+		}
+		switch i {
+		case 3:
+			ld.PkScript = script0
+		case 7:
+			ld.PkScript = script2
+		}
+
+		leafHash := ld.LeafHash()
+		adds = append(adds, utreexo.Leaf{Hash: leafHash})
+		if i == 3 || i == 5 || i == 7 {
+			wm.wallet.UtreexoLeaves = append(wm.wallet.UtreexoLeaves, leafHash)
+			wm.wallet.RelevantUtxos[ld.OutPoint] = LeafDataExtras{
+				LeafData:    ld,
+				BlockHeight: i,
+			}
+		}
+	}
+	err = acc.Modify(adds, nil, utreexo.Proof{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm.wallet.UtreexoProof, err = acc.Prove(wm.wallet.UtreexoLeaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm.wallet.NumLeaves = acc.GetNumLeaves()
+	stump := utreexo.Stump{Roots: acc.GetRoots(), NumLeaves: acc.GetNumLeaves()}
+
+	tests := []struct {
+		descriptor  string
+		wantHeights []int
+	}{
+		{"", []int{3, 5, 7}},
+		{desc, []int{3, 7}},
+	}
+	for _, test := range tests {
+		utxos, _, numLeaves, err := wm.GetUtxos(test.descriptor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if numLeaves != stump.NumLeaves {
+			t.Fatalf("expected %d leaves, got %d", stump.NumLeaves, numLeaves)
+		}
+		if len(utxos) != len(test.wantHeights) {
+			t.Fatalf("expected %d utxos, got %d", len(test.wantHeights), len(utxos))
+		}
+
+		for i, utxo := range utxos {
+			if utxo.BlockHeight != test.wantHeights[i] {
+				t.Fatalf("expected utxo at height %d, got %d",
+					test.wantHeights[i], utxo.BlockHeight)
+			}
+			wantDesc := registered[0]
+			if utxo.BlockHeight == 5 {
+				wantDesc = ""
+			}
+			if utxo.Descriptor != wantDesc {
+				t.Fatalf("expected descriptor %q, got %q", wantDesc,
+					utxo.Descriptor)
+			}
+
+			// Each utxo must be provable on its own.
+			leafHash := utxo.LeafData.LeafHash()
+			_, err := utreexo.Verify(stump, []utreexo.Hash{leafHash}, utxo.Proof.AccProof)
+			if err != nil {
+				t.Fatalf("proof of utxo at height %d fails verification: %v",
+					utxo.BlockHeight, err)
+			}
+		}
+	}
+
+	_, _, _, err = wm.GetUtxos("raw(00)")
+	if err == nil {
+		t.Fatalf("expected an error for a descriptor that isn't registered")
+	}
+
+	// A batched proof for outpoints passed in out of the blockchain order must
+	// keep the order of the outpoints.
+	outPoints := []wire.OutPoint{
+		{Hash: chainhash.Hash{7}, Index: 7},
+		{Hash: chainhash.Hash{3}, Index: 3},
+	}
+	ud, _, err := wm.ProveOutPoints(outPoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]utreexo.Hash, 0, len(ud.LeafDatas))
+	for i, ld := range ud.LeafDatas {
+		if ld.OutPoint != outPoints[i] {
+			t.Fatalf("expected leaf data for %v, got %v", outPoints[i], ld.OutPoint)
+		}
+		hashes = append(hashes, ld.LeafHash())
+	}
+	if _, err := utreexo.Verify(stump, hashes, ud.AccProof); err != nil {
+		t.Fatalf("batched proof fails verification: %v", err)
+	}
+
+	_, _, err = wm.ProveOutPoints([]wire.OutPoint{{Hash: chainhash.Hash{1}, Index: 1}})
+	if err == nil {
+		t.Fatalf("expected an error for an outpoint that isn't a wallet utxo")
+	}
+}
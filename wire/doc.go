@@ -47,7 +47,8 @@ interactions in no particular order.
 
 	Peer A Sends                          Peer B Responds
 	----------------------------------------------------------------------------
-	getaddr message (MsgGetAddr)          addr message (MsgAddr)
+	getaddr message (MsgGetAddr)          addr message (MsgAddr) -or-
+	                                      addrv2 message (MsgAddrV2)**
 	getblocks message (MsgGetBlocks)      inv message (MsgInv)
 	inv message (MsgInv)                  getdata message (MsgGetData)
 	getdata message (MsgGetData)          block message (MsgBlock) -or-
@@ -61,6 +62,9 @@ interactions in no particular order.
 	* The pong message was not added until later protocol versions as defined
 	  in BIP0031.  The BIP0031Version constant can be used to detect a recent
 	  enough protocol version for this purpose (version > BIP0031Version).
+	** The addrv2 message is sent instead of the addr message to peers that
+	  sent a sendaddrv2 message (MsgSendAddrV2) during the initial handshake
+	  as defined in BIP0155.  It was added with AddrV2Version.
 
 # Common Parameters
 
@@ -86,6 +90,7 @@ the following constants:
 	wire.MainNet
 	wire.TestNet  (Regression test network)
 	wire.TestNet3 (Test network version 3)
+	wire.TestNet4 (Test network version 4)
 	wire.SimNet   (Simulation test network)
 
 # Determining Message Type
@@ -158,5 +163,6 @@ This package includes spec changes outlined by the following BIPs:
 	BIP0111	(https://github.com/bitcoin/bips/blob/master/bip-0111.mediawiki)
 	BIP0130 (https://github.com/bitcoin/bips/blob/master/bip-0130.mediawiki)
 	BIP0133 (https://github.com/bitcoin/bips/blob/master/bip-0133.mediawiki)
+	BIP0155 (https://github.com/bitcoin/bips/blob/master/bip-0155.mediawiki)
 */
 package wire
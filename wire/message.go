@@ -32,6 +32,7 @@ const (
 	CmdVerAck              = "verack"
 	CmdGetAddr             = "getaddr"
 	CmdAddr                = "addr"
+	CmdAddrV2              = "addrv2"
 	CmdGetBlocks           = "getblocks"
 	CmdInv                 = "inv"
 	CmdGetData             = "getdata"
@@ -65,6 +66,13 @@ const (
 	CmdGetUtreexoProof     = "getuproof"
 	CmdUtreexoRoot         = "uroot"
 	CmdGetUtreexoRoot      = "geturoot"
+	CmdUtreexoTxProof      = "utxproof"
+	CmdGetUtreexoTxProof   = "getutxproof"
+	CmdSendCmpct           = "sendcmpct"
+	CmdCmpctBlock          = "cmpctblock"
+	CmdGetBlockTxn         = "getblocktxn"
+	CmdBlockTxn            = "blocktxn"
+	CmdProofAuth           = "proofauth"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -89,6 +97,13 @@ const (
 // protocol.
 var LatestEncoding = WitnessEncoding
 
+// ErrUnknownMessage is the error returned when decoding an unknown message.
+var ErrUnknownMessage = fmt.Errorf("received unknown message")
+
+// ErrInvalidHandshake is the error returned when a peer sends us a known
+// message that does not belong in the version-verack handshake.
+var ErrInvalidHandshake = fmt.Errorf("invalid message during handshake")
+
 // Message is an interface that describes a bitcoin message.  A type that
 // implements Message has complete control over the representation of its data
 // and may therefore contain additional or fewer fields than those which
@@ -120,6 +135,9 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdAddr:
 		msg = &MsgAddr{}
 
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
 	case CmdGetBlocks:
 		msg = &MsgGetBlocks{}
 
@@ -171,6 +189,27 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdGetUtreexoRoot:
 		msg = &MsgGetUtreexoRoot{}
 
+	case CmdUtreexoTxProof:
+		msg = &MsgUtreexoTxProof{}
+
+	case CmdGetUtreexoTxProof:
+		msg = &MsgGetUtreexoTxProof{}
+
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdProofAuth:
+		msg = &MsgProofAuth{}
+
 	case CmdAlert:
 		msg = &MsgAlert{}
 
@@ -217,7 +256,7 @@ func makeEmptyMessage(command string) (Message, error) {
 		msg = &MsgCFCheckpt{}
 
 	default:
-		return nil, fmt.Errorf("unhandled command [%s]", command)
+		return nil, ErrUnknownMessage
 	}
 	return msg, nil
 }
@@ -410,9 +449,10 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	// Create struct of appropriate message type based on the command.
 	msg, err := makeEmptyMessage(command)
 	if err != nil {
+		// makeEmptyMessage can only return ErrUnknownMessage and it is
+		// important that we bubble it up to the caller.
 		discardInput(r, hdr.length)
-		return totalBytes, nil, nil, messageError("ReadMessage",
-			err.Error())
+		return totalBytes, nil, nil, err
 	}
 
 	// Check for maximum length based on the message type as a malicious client
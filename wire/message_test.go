@@ -51,6 +51,7 @@ func TestMessage(t *testing.T) {
 	msgVerack := NewMsgVerAck()
 	msgGetAddr := NewMsgGetAddr()
 	msgAddr := NewMsgAddr()
+	msgAddrV2 := NewMsgAddrV2()
 	msgGetBlocks := NewMsgGetBlocks(&chainhash.Hash{})
 	msgBlock := &blockOne
 	msgInv := NewMsgInv()
@@ -89,6 +90,7 @@ func TestMessage(t *testing.T) {
 		{msgVerack, msgVerack, pver, MainNet, 24},
 		{msgGetAddr, msgGetAddr, pver, MainNet, 24},
 		{msgAddr, msgAddr, pver, MainNet, 25},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
 		{msgGetBlocks, msgGetBlocks, pver, MainNet, 61},
 		{msgBlock, msgBlock, pver, MainNet, 239},
 		{msgInv, msgInv, pver, MainNet, 25},
@@ -297,7 +299,7 @@ func TestReadMessageWireErrors(t *testing.T) {
 			pver,
 			btcnet,
 			len(unsupportedCommandBytes),
-			&MessageError{},
+			ErrUnknownMessage,
 			24,
 		},
 
@@ -347,7 +349,7 @@ func TestReadMessageWireErrors(t *testing.T) {
 			pver,
 			btcnet,
 			len(discardBytes),
-			&MessageError{},
+			ErrUnknownMessage,
 			24,
 		},
 	}
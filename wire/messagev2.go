@@ -0,0 +1,173 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// v2ShortIDs are the commands of the messages that are sent with a single byte
+// id instead of the full command in the v2 transport as defined by BIP0324.
+// The index of a command is its id and id 0 means the full command follows.
+// Ids without a command are reserved for future messages.
+var v2ShortIDs = [...]string{
+	1:  CmdAddr,
+	2:  CmdBlock,
+	3:  CmdBlockTxn,
+	4:  CmdCmpctBlock,
+	5:  CmdFeeFilter,
+	6:  CmdFilterAdd,
+	7:  CmdFilterClear,
+	8:  CmdFilterLoad,
+	9:  CmdGetBlocks,
+	10: CmdGetBlockTxn,
+	11: CmdGetData,
+	12: CmdGetHeaders,
+	13: CmdHeaders,
+	14: CmdInv,
+	15: CmdMemPool,
+	16: CmdMerkleBlock,
+	17: CmdNotFound,
+	18: CmdPing,
+	19: CmdPong,
+	20: CmdSendCmpct,
+	21: CmdTx,
+	22: CmdGetCFilters,
+	23: CmdCFilter,
+	24: CmdGetCFHeaders,
+	25: CmdCFHeaders,
+	26: CmdGetCFCheckpt,
+	27: CmdCFCheckpt,
+	28: CmdAddrV2,
+}
+
+// v2ShortIDOf maps the commands with a short id to it.
+var v2ShortIDOf = func() map[string]byte {
+	ids := make(map[string]byte, len(v2ShortIDs))
+	for id, cmd := range v2ShortIDs {
+		if cmd != "" {
+			ids[cmd] = byte(id)
+		}
+	}
+	return ids
+}()
+
+// EncodeV2Message returns the contents of the v2 transport packet that the
+// passed message is sent in as defined by BIP0324.  The contents are the short
+// id of the command, or a zero byte followed by the zero padded command for
+// commands that don't have one, and the payload of the message.
+func EncodeV2Message(msg Message, pver uint32, encoding MessageEncoding) ([]byte, error) {
+	cmd := msg.Command()
+	if len(cmd) > CommandSize {
+		str := fmt.Sprintf("command [%s] is too long [max %v]",
+			cmd, CommandSize)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	var bw bytes.Buffer
+	if id, ok := v2ShortIDOf[cmd]; ok {
+		bw.WriteByte(id)
+	} else {
+		var command [CommandSize]byte
+		copy(command[:], cmd)
+		bw.WriteByte(0)
+		bw.Write(command[:])
+	}
+	headerLen := bw.Len()
+
+	err := msg.BtcEncode(&bw, pver, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enforce maximum overall message payload.
+	lenp := bw.Len() - headerLen
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, cmd, mpl)
+		return nil, messageError("EncodeV2Message", str)
+	}
+
+	return bw.Bytes(), nil
+}
+
+// DecodeV2Message parses the message in the contents of a v2 transport packet
+// as defined by BIP0324.  It returns the message along with its payload.
+// ErrUnknownMessage is returned for unknown commands and short ids so that
+// they can be ignored like with the v1 transport.
+func DecodeV2Message(contents []byte, pver uint32, encoding MessageEncoding) (Message, []byte, error) {
+	if len(contents) == 0 {
+		return nil, nil, messageError("DecodeV2Message",
+			"packet has no message")
+	}
+
+	var command string
+	payload := contents[1:]
+	if id := contents[0]; id != 0 {
+		if int(id) >= len(v2ShortIDs) || v2ShortIDs[id] == "" {
+			return nil, nil, ErrUnknownMessage
+		}
+		command = v2ShortIDs[id]
+	} else {
+		if len(payload) < CommandSize {
+			str := fmt.Sprintf("packet of %d bytes is too short "+
+				"for a command", len(contents))
+			return nil, nil, messageError("DecodeV2Message", str)
+		}
+
+		// The command must be zero padded without any other bytes
+		// after the padding starts.
+		cmd := payload[:CommandSize]
+		payload = payload[CommandSize:]
+		end := bytes.IndexByte(cmd, 0)
+		if end == -1 {
+			end = CommandSize
+		}
+		if !utf8.Valid(cmd[:end]) ||
+			bytes.Count(cmd[end:], []byte{0}) != CommandSize-end {
+
+			str := fmt.Sprintf("invalid command %v", cmd)
+			return nil, nil, messageError("DecodeV2Message", str)
+		}
+		command = string(cmd[:end])
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl || len(payload) > MaxMessagePayload {
+		str := fmt.Sprintf("payload exceeds max length - packet "+
+			"has %v bytes, but max payload size for messages of "+
+			"type [%v] is %v.", len(payload), command, mpl)
+		return nil, nil, messageError("DecodeV2Message", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	pr := bytes.NewBuffer(payload)
+	err = msg.BtcDecode(pr, pver, encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msg, payload, nil
+}
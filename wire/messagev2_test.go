@@ -0,0 +1,104 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// TestV2Message tests the encoding and decoding of messages in the contents of
+// v2 transport packets.
+func TestV2Message(t *testing.T) {
+	pver := ProtocolVersion
+
+	tests := []struct {
+		in     Message
+		prefix []byte // Expected bytes before the payload
+	}{
+		// Messages with a short id.
+		{NewMsgPing(123), []byte{18}},
+		{NewMsgAddrV2(), []byte{28}},
+		{NewMsgInv(), []byte{14}},
+
+		// Messages sent with the full command.
+		{NewMsgGetAddr(), append([]byte{0}, "getaddr\x00\x00\x00\x00\x00"...)},
+		{NewMsgVerAck(), append([]byte{0}, "verack\x00\x00\x00\x00\x00\x00"...)},
+		{NewMsgSendAddrV2(), append([]byte{0}, "sendaddrv2\x00\x00"...)},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		contents, err := EncodeV2Message(test.in, pver, LatestEncoding)
+		if err != nil {
+			t.Fatalf("EncodeV2Message #%d error %v", i, err)
+		}
+		if !bytes.HasPrefix(contents, test.prefix) {
+			t.Fatalf("EncodeV2Message #%d got %x, want prefix %x", i,
+				contents, test.prefix)
+		}
+
+		var payload bytes.Buffer
+		if err := test.in.BtcEncode(&payload, pver, LatestEncoding); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents[len(test.prefix):], payload.Bytes()) {
+			t.Fatalf("EncodeV2Message #%d got payload %x, want %x",
+				i, contents[len(test.prefix):], payload.Bytes())
+		}
+
+		msg, gotPayload, err := DecodeV2Message(contents, pver, LatestEncoding)
+		if err != nil {
+			t.Fatalf("DecodeV2Message #%d error %v", i, err)
+		}
+		if !reflect.DeepEqual(msg, test.in) {
+			t.Fatalf("DecodeV2Message #%d got %v, want %v", i, msg,
+				test.in)
+		}
+		if !bytes.Equal(gotPayload, payload.Bytes()) {
+			t.Fatalf("DecodeV2Message #%d got payload %x, want %x",
+				i, gotPayload, payload.Bytes())
+		}
+	}
+}
+
+// TestV2MessageErrors tests that malformed contents of v2 transport packets
+// are rejected and that unknown messages are reported as such.
+func TestV2MessageErrors(t *testing.T) {
+	pver := ProtocolVersion
+
+	tests := []struct {
+		name     string
+		contents []byte
+		unknown  bool
+	}{
+		{"empty", nil, false},
+		{"truncated command", []byte{0, 'p', 'i', 'n', 'g'}, false},
+		{
+			"bytes after the padding",
+			append([]byte{0}, "ping\x00\x00x\x00\x00\x00\x00\x00"...),
+			false,
+		},
+		{
+			"unknown command",
+			append([]byte{0}, "wtxidrelay\x00\x00"...),
+			true,
+		},
+		{"reserved short id", []byte{29}, true},
+		{"last short id", []byte{255}, true},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		_, _, err := DecodeV2Message(test.contents, pver, LatestEncoding)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.name)
+		}
+		if (err == ErrUnknownMessage) != test.unknown {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/aead/siphash"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+const (
+	// ShortIDSize is the size of the short ids of the transactions of a
+	// cmpctblock message.
+	ShortIDSize = 6
+
+	// shortIDMask masks a siphash down to the size of a short id.
+	shortIDMask = 1<<(ShortIDSize*8) - 1
+)
+
+// PrefilledTx is a transaction that's sent in full in a cmpctblock message
+// instead of as a short id.
+type PrefilledTx struct {
+	// Index is the index of the transaction in the block.
+	Index uint32
+
+	// Tx is the transaction.
+	Tx *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It announces a block by its header and the short ids of
+// its transactions so that the receiver can reconstruct it from the
+// transactions it already has in its mempool (BIP0152).
+//
+// When the compact block version CmpctBlockVersionUtreexo was negotiated, the
+// utreexo proof of the block is appended to the message.
+//
+// This message was not added until protocol version BIP0152Version.
+type MsgCmpctBlock struct {
+	// Header is the header of the block.
+	Header BlockHeader
+
+	// Nonce is the nonce the short ids are keyed with along with the
+	// header.
+	Nonce uint64
+
+	// ShortIDs are the short ids of the transactions of the block that
+	// aren't prefilled in the order they're in the block.
+	ShortIDs []uint64
+
+	// PrefilledTxs are the transactions that are sent in full.  They're
+	// ordered by their index in the block.
+	PrefilledTxs []PrefilledTx
+
+	// UData is the utreexo proof of the block.  It's nil when it isn't
+	// sent along.
+	UData *UData
+}
+
+// TxCount returns the number of transactions in the block.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// ShortIDKey returns the siphash key that the short ids of the message are
+// computed with.  It's the first 16 bytes of the single sha256 of the header
+// followed by the nonce.
+func (msg *MsgCmpctBlock) ShortIDKey() [16]byte {
+	var buf bytes.Buffer
+	buf.Grow(MaxBlockHeaderPayload + 8)
+	// Writing to a bytes.Buffer can't fail.
+	_ = msg.Header.Serialize(&buf)
+	var nonce [8]byte
+	binary.LittleEndian.PutUint64(nonce[:], msg.Nonce)
+	buf.Write(nonce[:])
+
+	hash := sha256.Sum256(buf.Bytes())
+	var key [16]byte
+	copy(key[:], hash[:16])
+	return key
+}
+
+// ShortTxID returns the short id of the transaction with the given witness
+// hash under the given key.
+func ShortTxID(key *[16]byte, wtxid *chainhash.Hash) uint64 {
+	return siphash.Sum64(wtxid[:], key) & shortIDMask
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids to fit into a block "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+	msg.ShortIDs = make([]uint64, count)
+	var buf [8]byte
+	for i := range msg.ShortIDs {
+		_, err = io.ReadFull(r, buf[:ShortIDSize])
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs[i] = binary.LittleEndian.Uint64(buf[:])
+	}
+
+	count, err = ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count+uint64(len(msg.ShortIDs)) > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions to fit into a block "+
+			"[count %d, max %d]", count+uint64(len(msg.ShortIDs)),
+			maxTxPerBlock)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	// The indexes of the prefilled transactions are encoded as the
+	// difference to the index of the previous one.  The utreexo proof is
+	// never attached to them as it's attached to the block.
+	txEncoding := enc &^ UtreexoEncoding
+	msg.PrefilledTxs = make([]PrefilledTx, count)
+	var index uint64
+	for i := range msg.PrefilledTxs {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index += diff
+		if index >= uint64(msg.TxCount()) {
+			str := fmt.Sprintf("prefilled transaction index %d out "+
+				"of range for a block of %d transactions", index,
+				msg.TxCount())
+			return messageError("MsgCmpctBlock.BtcDecode", str)
+		}
+
+		tx := MsgTx{}
+		err = tx.BtcDecode(r, pver, txEncoding)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxs[i] = PrefilledTx{Index: uint32(index), Tx: &tx}
+		index++
+	}
+
+	// The utreexo proof is only there when the utreexo version of compact
+	// blocks was negotiated.  Like for MsgBlock, reaching the end of the
+	// message means it isn't there.
+	msg.UData = new(UData)
+	err = msg.UData.Deserialize(r)
+	if err != nil {
+		if err == io.EOF {
+			msg.UData = nil
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var buf [8]byte
+	for _, shortID := range msg.ShortIDs {
+		binary.LittleEndian.PutUint64(buf[:], shortID)
+		_, err = w.Write(buf[:ShortIDSize])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	txEncoding := enc &^ UtreexoEncoding
+	var next uint32
+	for _, prefilled := range msg.PrefilledTxs {
+		if prefilled.Index < next {
+			str := "prefilled transactions are not in order"
+			return messageError("MsgCmpctBlock.BtcEncode", str)
+		}
+		err = WriteVarInt(w, pver, uint64(prefilled.Index-next))
+		if err != nil {
+			return err
+		}
+		err = prefilled.Tx.BtcEncode(w, pver, txEncoding)
+		if err != nil {
+			return err
+		}
+		next = prefilled.Index + 1
+	}
+
+	if msg.UData != nil {
+		return msg.UData.Serialize(w)
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	// The utreexo proof can take the message past the size of a block.
+	return MaxMessagePayload
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message of the block with
+// its short ids keyed with the given nonce.  Only the coinbase is prefilled.
+// The utreexo proof of the block is sent along if the block has it.
+func NewMsgCmpctBlock(block *MsgBlock, nonce uint64) *MsgCmpctBlock {
+	msg := &MsgCmpctBlock{
+		Header: block.Header,
+		Nonce:  nonce,
+		UData:  block.UData,
+	}
+	if len(block.Transactions) == 0 {
+		return msg
+	}
+
+	msg.PrefilledTxs = []PrefilledTx{{Index: 0, Tx: block.Transactions[0]}}
+	key := msg.ShortIDKey()
+	msg.ShortIDs = make([]uint64, 0, len(block.Transactions)-1)
+	for _, tx := range block.Transactions[1:] {
+		wtxid := tx.WitnessHash()
+		msg.ShortIDs = append(msg.ShortIDs, ShortTxID(&key, &wtxid))
+	}
+
+	return msg
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// cmpctTestBlock returns a block of blockOne's coinbase followed by copies of
+// multiTx that differ by their lock time.
+func cmpctTestBlock(numTxs int) *MsgBlock {
+	block := &MsgBlock{Header: blockOne.Header}
+	block.AddTransaction(blockOne.Transactions[0])
+	for i := 1; i < numTxs; i++ {
+		tx := multiTx.Copy()
+		tx.LockTime = uint32(i)
+		block.AddTransaction(tx)
+	}
+	return block
+}
+
+// reencode returns the encoding of msg after it went through a round trip of
+// encoding and decoding into empty.
+func reencode(t *testing.T, msg, empty Message, pver uint32) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, pver, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := append([]byte(nil), buf.Bytes()...)
+	if uint32(len(encoded)) > msg.MaxPayloadLength(pver) {
+		t.Fatalf("%s: encoded %d bytes but the max payload is %d",
+			msg.Command(), len(encoded), msg.MaxPayloadLength(pver))
+	}
+
+	err = empty.BtcDecode(&buf, pver, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var after bytes.Buffer
+	err = empty.BtcEncode(&after, pver, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, after.Bytes()) {
+		t.Fatalf("%s: round trip changed the encoding", msg.Command())
+	}
+
+	// The messages are rejected for protocol versions before BIP0152.
+	err = msg.BtcEncode(&buf, BIP0152Version-1, LatestEncoding)
+	if err == nil {
+		t.Fatalf("%s: expected an error encoding for an old protocol "+
+			"version", msg.Command())
+	}
+
+	return encoded
+}
+
+func TestMsgSendCmpct(t *testing.T) {
+	msg := NewMsgSendCmpct(true, CmpctBlockVersionUtreexo)
+	var after MsgSendCmpct
+	reencode(t, msg, &after, ProtocolVersion)
+	if after != *msg {
+		t.Fatalf("expected %v but got %v", *msg, after)
+	}
+}
+
+func TestMsgCmpctBlock(t *testing.T) {
+	block := cmpctTestBlock(5)
+	block.UData = &UData{
+		AccProof: utreexo.Proof{
+			Targets: []uint64{3, 9},
+			Proof:   []utreexo.Hash{{1}, {2}, {3}},
+		},
+		LeafDatas: mainNetBlock104773.leavesPerBlock,
+	}
+
+	msg := NewMsgCmpctBlock(block, 0x1234)
+	if msg.TxCount() != 5 || len(msg.PrefilledTxs) != 1 ||
+		msg.PrefilledTxs[0].Index != 0 {
+
+		t.Fatalf("expected the coinbase prefilled and 4 short ids, got "+
+			"%d prefilled and %d short ids", len(msg.PrefilledTxs),
+			len(msg.ShortIDs))
+	}
+	key := msg.ShortIDKey()
+	for i, tx := range block.Transactions[1:] {
+		wtxid := tx.WitnessHash()
+		if msg.ShortIDs[i] != ShortTxID(&key, &wtxid) {
+			t.Fatalf("wrong short id for tx %d", i+1)
+		}
+		if msg.ShortIDs[i] > shortIDMask {
+			t.Fatalf("short id %x is more than %d bytes",
+				msg.ShortIDs[i], ShortIDSize)
+		}
+	}
+
+	var after MsgCmpctBlock
+	reencode(t, msg, &after, ProtocolVersion)
+	if after.UData == nil {
+		t.Fatal("expected the utreexo proof to be decoded")
+	}
+
+	// Without the utreexo proof, the message is a plain BIP0152 one.
+	msg.UData = nil
+	msg.PrefilledTxs = append(msg.PrefilledTxs,
+		PrefilledTx{Index: 3, Tx: block.Transactions[3]})
+	msg.ShortIDs = append(msg.ShortIDs[:2], msg.ShortIDs[3])
+	after = MsgCmpctBlock{}
+	reencode(t, msg, &after, ProtocolVersion)
+	if after.UData != nil {
+		t.Fatal("expected no utreexo proof")
+	}
+	if after.PrefilledTxs[1].Index != 3 {
+		t.Fatalf("expected the second prefilled tx at index 3, got %d",
+			after.PrefilledTxs[1].Index)
+	}
+
+	// Prefilled transactions past the end of the block are rejected.
+	msg.PrefilledTxs[1].Index = 5
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = after.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error decoding an out of range prefilled tx")
+	}
+}
+
+func TestMsgGetBlockTxnAndBlockTxn(t *testing.T) {
+	hash := chainhash.Hash{7}
+	getMsg := NewMsgGetBlockTxn(&hash, []uint32{1, 2, 5, 100})
+	var getAfter MsgGetBlockTxn
+	reencode(t, getMsg, &getAfter, ProtocolVersion)
+	if !reflect.DeepEqual(getAfter, *getMsg) {
+		t.Fatalf("expected %v but got %v", *getMsg, getAfter)
+	}
+
+	// Unordered indexes can't be encoded.
+	unordered := NewMsgGetBlockTxn(&hash, []uint32{2, 1})
+	err := unordered.BtcEncode(&bytes.Buffer{}, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error encoding unordered indexes")
+	}
+
+	block := cmpctTestBlock(3)
+	msg := NewMsgBlockTxn(&hash, block.Transactions[1:])
+	var after MsgBlockTxn
+	reencode(t, msg, &after, ProtocolVersion)
+	if after.BlockHash != hash || len(after.Txs) != 2 ||
+		after.Txs[1].TxHash() != block.Transactions[2].TxHash() {
+
+		t.Fatalf("unexpected blocktxn message %v", after)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions of a block
+// announced with a cmpctblock message that couldn't be found in the mempool
+// (BIP0152).
+//
+// This message was not added until protocol version BIP0152Version.
+type MsgGetBlockTxn struct {
+	// BlockHash is the hash of the block the transactions are of.
+	BlockHash chainhash.Hash
+
+	// Indexes are the indexes of the requested transactions in the block
+	// in increasing order.
+	Indexes []uint32
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions requested "+
+			"[count %d, max %d]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	// The indexes are encoded as the difference to the previous one.
+	msg.Indexes = make([]uint32, count)
+	var index uint64
+	for i := range msg.Indexes {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index += diff
+		if index >= maxTxPerBlock {
+			str := fmt.Sprintf("transaction index %d out of range",
+				index)
+			return messageError("MsgGetBlockTxn.BtcDecode", str)
+		}
+		msg.Indexes[i] = uint32(index)
+		index++
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.Indexes)))
+	if err != nil {
+		return err
+	}
+	var next uint32
+	for _, index := range msg.Indexes {
+		if index < next {
+			str := "requested transactions are not in order"
+			return messageError("MsgGetBlockTxn.BtcEncode", str)
+		}
+		err = WriteVarInt(w, pver, uint64(index-next))
+		if err != nil {
+			return err
+		}
+		next = index + 1
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max indexes (varInt each).
+	return chainhash.HashSize + MaxVarIntPayload +
+		maxTxPerBlock*MaxVarIntPayload
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms to
+// the Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash, indexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   indexes,
+	}
+}
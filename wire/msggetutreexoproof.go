@@ -5,7 +5,9 @@
 package wire
 
 import (
+	"fmt"
 	"io"
+	"math/bits"
 	"sort"
 
 	"github.com/utreexo/utreexo"
@@ -41,6 +43,11 @@ func (msg *MsgGetUtreexoProof) BtcDecode(r io.Reader, pver uint32, enc MessageEn
 	if err != nil {
 		return err
 	}
+	if proofCount > MaxBlockPayload {
+		str := fmt.Sprintf("proof index bitmap is too large "+
+			"[count %d, max %d]", proofCount, MaxBlockPayload)
+		return messageError("MsgGetUtreexoProof.BtcDecode", str)
+	}
 
 	msg.ProofIndexBitMap = make([]byte, proofCount)
 	_, err = r.Read(msg.ProofIndexBitMap[:])
@@ -52,6 +59,11 @@ func (msg *MsgGetUtreexoProof) BtcDecode(r io.Reader, pver uint32, enc MessageEn
 	if err != nil {
 		return err
 	}
+	if leafCount > MaxBlockPayload {
+		str := fmt.Sprintf("leaf index bitmap is too large "+
+			"[count %d, max %d]", leafCount, MaxBlockPayload)
+		return messageError("MsgGetUtreexoProof.BtcDecode", str)
+	}
 
 	msg.LeafIndexBitMap = make([]byte, leafCount)
 	_, err = r.Read(msg.LeafIndexBitMap[:])
@@ -117,6 +129,15 @@ func (msg *MsgGetUtreexoProof) IsProofRequested(idx int) bool {
 	return isBitSet(msg.ProofIndexBitMap, idx)
 }
 
+// NumLeafDatasRequested returns the number of leafdatas that are requested.
+func (msg *MsgGetUtreexoProof) NumLeafDatasRequested() int {
+	count := 0
+	for _, b := range msg.LeafIndexBitMap {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
 // Returns true if the bit at the given index is set.
 func isBitSet(slice []byte, idx int) bool {
 	bytesIdx := idx / 8
@@ -174,17 +195,26 @@ func ConstructGetProofMsg(blockHash *chainhash.Hash, numLeaves uint64,
 	for i := range proofIndexes {
 		proofIndexes[i] = true
 	}
-	proofBytes := createBitmap(proofIndexes)
 
 	targetIndexes := make([]bool, len(targets))
 	for i := range targets {
 		targetIndexes[i] = true
 	}
-	targetBytes := createBitmap(targetIndexes)
+
+	return ConstructGetPartialProofMsg(blockHash, proofIndexes, targetIndexes)
+}
+
+// ConstructGetPartialProofMsg returns a constructed MsgGetUtreexoProof message that
+// only requests the proof hashes and the leaf datas that are marked as true.
+//
+// The proofIncludes must be in the order of the proof positions for the sorted
+// targets and the leafIncludes must be in the order of the targets.
+func ConstructGetPartialProofMsg(blockHash *chainhash.Hash,
+	proofIncludes, leafIncludes []bool) *MsgGetUtreexoProof {
 
 	return &MsgGetUtreexoProof{
 		BlockHash:        *blockHash,
-		ProofIndexBitMap: proofBytes,
-		LeafIndexBitMap:  targetBytes,
+		ProofIndexBitMap: createBitmap(proofIncludes),
+		LeafIndexBitMap:  createBitmap(leafIncludes),
 	}
 }
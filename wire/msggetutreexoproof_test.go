@@ -107,6 +107,31 @@ func TestIsBitSet(t *testing.T) {
 	}
 }
 
+func TestNumLeafDatasRequested(t *testing.T) {
+	msg := MsgGetUtreexoProof{
+		LeafIndexBitMap: setBitSlice(100, []int{0, 7, 8, 63, 99}),
+	}
+	assert.Equal(t, 5, msg.NumLeafDatasRequested())
+
+	msg.LeafIndexBitMap = nil
+	assert.Equal(t, 0, msg.NumLeafDatasRequested())
+}
+
+func TestMsgGetUtreexoProofDecodeTooLarge(t *testing.T) {
+	// A bitmap count that's larger than the maximum payload must be
+	// rejected before anything is allocated for it.
+	var buf bytes.Buffer
+	hash := chainhash.HashH([]byte("too large"))
+	buf.Write(hash[:])
+	WriteVarInt(&buf, 0, MaxBlockPayload+1)
+
+	var msg MsgGetUtreexoProof
+	err := msg.BtcDecode(&buf, ProtocolVersion, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("expected a MessageError, got %v", err)
+	}
+}
+
 func TestCreateBitmap(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -153,3 +178,23 @@ func TestCreateBitmap(t *testing.T) {
 		assert.Equal(t, tc.expected, bitmap)
 	}
 }
+
+func TestConstructGetPartialProofMsg(t *testing.T) {
+	blockHash := chainhash.Hash{1}
+	proofIncludes := []bool{true, false, true, false, false, true, false, false, true}
+	leafIncludes := []bool{false, true, false}
+
+	msg := ConstructGetPartialProofMsg(&blockHash, proofIncludes, leafIncludes)
+	assert.Equal(t, blockHash, msg.BlockHash)
+
+	for i, include := range proofIncludes {
+		assert.Equal(t, include, msg.IsProofRequested(i))
+	}
+	for i, include := range leafIncludes {
+		assert.Equal(t, include, msg.IsLeafDataRequested(i))
+	}
+
+	// Indexes past the includes should never be requested.
+	assert.False(t, msg.IsProofRequested(len(proofIncludes)+8))
+	assert.False(t, msg.IsLeafDataRequested(len(leafIncludes)+8))
+}
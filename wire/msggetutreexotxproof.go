@@ -0,0 +1,102 @@
+// Copyright (c) 2025 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MaxGetUtreexoTxProofOutPoints is the maximum number of outpoints a single
+// getutxproof message may ask a proof for.
+const MaxGetUtreexoTxProofOutPoints = 50000
+
+// MsgGetUtreexoTxProof implements the Message interface and represents a bitcoin
+// getutxproof message.  It's used to request the proof of the given unspent
+// outpoints against the current utreexo accumulator of a bridge node instead of
+// the proof of a whole block.
+type MsgGetUtreexoTxProof struct {
+	// OutPoints are the unspent outpoints that the requester wants proven.
+	OutPoints []OutPoint
+}
+
+// AddOutPoint adds an outpoint to the message.
+func (msg *MsgGetUtreexoTxProof) AddOutPoint(op OutPoint) error {
+	if len(msg.OutPoints)+1 > MaxGetUtreexoTxProofOutPoints {
+		str := fmt.Sprintf("too many outpoints in message [max %v]",
+			MaxGetUtreexoTxProofOutPoints)
+		return messageError("MsgGetUtreexoTxProof.AddOutPoint", str)
+	}
+
+	msg.OutPoints = append(msg.OutPoints, op)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetUtreexoTxProof) BtcDecode(r io.Reader, pver uint32, _ MessageEncoding) error {
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max outpoints per message.
+	if count > MaxGetUtreexoTxProofOutPoints {
+		str := fmt.Sprintf("too many outpoints in message [%v]", count)
+		return messageError("MsgGetUtreexoTxProof.BtcDecode", str)
+	}
+
+	msg.OutPoints = make([]OutPoint, count)
+	for i := range msg.OutPoints {
+		err = readOutPoint(r, pver, 0, &msg.OutPoints[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetUtreexoTxProof) BtcEncode(w io.Writer, pver uint32, _ MessageEncoding) error {
+	count := len(msg.OutPoints)
+	if count > MaxGetUtreexoTxProofOutPoints {
+		str := fmt.Sprintf("too many outpoints in message [%v]", count)
+		return messageError("MsgGetUtreexoTxProof.BtcEncode", str)
+	}
+
+	err := WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	for i := range msg.OutPoints {
+		err = WriteOutPoint(w, pver, 0, &msg.OutPoints[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetUtreexoTxProof) Command() string {
+	return CmdGetUtreexoTxProof
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetUtreexoTxProof) MaxPayloadLength(_ uint32) uint32 {
+	// Num outpoints (varint) + max allowed outpoints of 36 bytes each.
+	return MaxVarIntPayload + (MaxGetUtreexoTxProofOutPoints * (4 + 32))
+}
+
+// NewMsgGetUtreexoTxProof returns a new bitcoin getutxproof message that
+// conforms to the Message interface.  See MsgGetUtreexoTxProof for details.
+func NewMsgGetUtreexoTxProof(outPoints []OutPoint) *MsgGetUtreexoTxProof {
+	return &MsgGetUtreexoTxProof{OutPoints: outPoints}
+}
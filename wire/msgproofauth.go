@@ -0,0 +1,92 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// ProofAuthChallengeSize is the size of the random challenge of a
+	// proofauth message.
+	ProofAuthChallengeSize = 32
+
+	// MaxProofAuthResponseSize is the largest response a proofauth message
+	// may carry.  Responses are either a schnorr signature or an HMAC.
+	MaxProofAuthResponseSize = 64
+)
+
+// MsgProofAuth implements the Message interface and represents a utreexo
+// proofauth message.  It's exchanged with the proof sources an operator pins a
+// node to so that the node can tell it's talking to its own bridges and the
+// bridges can tell the node is one of theirs.
+//
+// A node starts by sending its challenge.  The bridge answers with its own
+// challenge and its signature of the node's challenge.  The node then answers
+// the bridge's challenge with the HMAC of its auth token.
+type MsgProofAuth struct {
+	// Challenge is the random challenge the other side is asked to answer.
+	Challenge [ProofAuthChallengeSize]byte
+
+	// Response is the answer to the challenge of the other side.  It's
+	// empty when there's nothing to answer with.
+	Response []byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgProofAuth) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if _, err := io.ReadFull(r, msg.Challenge[:]); err != nil {
+		return err
+	}
+
+	response, err := ReadVarBytes(r, pver, MaxProofAuthResponseSize,
+		"proofauth response")
+	if err != nil {
+		return err
+	}
+	msg.Response = response
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgProofAuth) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if len(msg.Response) > MaxProofAuthResponseSize {
+		str := fmt.Sprintf("proofauth response is too large [size %d, "+
+			"max %d]", len(msg.Response), MaxProofAuthResponseSize)
+		return messageError("MsgProofAuth.BtcEncode", str)
+	}
+
+	if _, err := w.Write(msg.Challenge[:]); err != nil {
+		return err
+	}
+	return WriteVarBytes(w, pver, msg.Response)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgProofAuth) Command() string {
+	return CmdProofAuth
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgProofAuth) MaxPayloadLength(pver uint32) uint32 {
+	return ProofAuthChallengeSize + MaxVarIntPayload +
+		MaxProofAuthResponseSize
+}
+
+// NewMsgProofAuth returns a new utreexo proofauth message that conforms to the
+// Message interface.  See MsgProofAuth for details.
+func NewMsgProofAuth(challenge [ProofAuthChallengeSize]byte,
+	response []byte) *MsgProofAuth {
+
+	return &MsgProofAuth{
+		Challenge: challenge,
+		Response:  response,
+	}
+}
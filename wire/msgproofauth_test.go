@@ -0,0 +1,58 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMsgProofAuth(t *testing.T) {
+	challenge := [ProofAuthChallengeSize]byte{1, 2, 3}
+	tests := []*MsgProofAuth{
+		NewMsgProofAuth(challenge, nil),
+		NewMsgProofAuth(challenge, bytes.Repeat([]byte{0xaa}, 32)),
+		NewMsgProofAuth(challenge, bytes.Repeat([]byte{0xbb},
+			MaxProofAuthResponseSize)),
+	}
+	for i, msg := range tests {
+		var buf bytes.Buffer
+		err := msg.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint32(buf.Len()) > msg.MaxPayloadLength(ProtocolVersion) {
+			t.Fatalf("test %d: encoded %d bytes but the max payload "+
+				"is %d", i, buf.Len(),
+				msg.MaxPayloadLength(ProtocolVersion))
+		}
+		var after MsgProofAuth
+		err = after.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Challenge != msg.Challenge ||
+			!bytes.Equal(after.Response, msg.Response) {
+
+			t.Fatalf("test %d: expected %v but got %v", i, *msg, after)
+		}
+	}
+
+	// Responses larger than the max can't be encoded or decoded.
+	msg := NewMsgProofAuth(challenge, make([]byte, MaxProofAuthResponseSize+1))
+	var buf bytes.Buffer
+	err := msg.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error encoding a too large response")
+	}
+	buf.Reset()
+	buf.Write(challenge[:])
+	WriteVarBytes(&buf, ProtocolVersion, msg.Response)
+	var after MsgProofAuth
+	err = after.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error decoding a too large response")
+	}
+}
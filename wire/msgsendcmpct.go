@@ -0,0 +1,91 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// CmpctBlockVersionWitness is the compact block version of BIP0152
+	// where the short ids are of the witness hashes of the transactions.
+	CmpctBlockVersionWitness uint64 = 2
+
+	// CmpctBlockVersionUtreexo extends CmpctBlockVersionWitness with the
+	// utreexo proof of the block appended to the cmpctblock message so that
+	// compact state nodes can validate the block as soon as it's
+	// reconstructed.
+	CmpctBlockVersionUtreexo uint64 = 0x75740002
+)
+
+// MsgSendCmpct implements the Message interface and represents a bitcoin
+// sendcmpct message.  It is used to tell the peer which version of compact
+// blocks are understood and whether new blocks should be announced with them
+// (BIP0152).
+//
+// This message was not added until protocol version BIP0152Version.
+type MsgSendCmpct struct {
+	// Announce is whether new blocks should be announced with cmpctblock
+	// messages instead of invs or headers.
+	Announce bool
+
+	// Version is the version of compact blocks that's understood.
+	Version uint64
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.Announce)
+	if err != nil {
+		return err
+	}
+	return readElement(r, &msg.Version)
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	if pver < BIP0152Version {
+		str := fmt.Sprintf("sendcmpct message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgSendCmpct.BtcEncode", str)
+	}
+
+	err := writeElement(w, msg.Announce)
+	if err != nil {
+		return err
+	}
+	return writeElement(w, msg.Version)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	// Announce bool 1 byte + version 8 bytes.
+	return 9
+}
+
+// NewMsgSendCmpct returns a new bitcoin sendcmpct message that conforms to the
+// Message interface.  See MsgSendCmpct for details.
+func NewMsgSendCmpct(announce bool, version uint64) *MsgSendCmpct {
+	return &MsgSendCmpct{
+		Announce: announce,
+		Version:  version,
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2025 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// MsgUtreexoTxProof implements the Message interface and represents a bitcoin
+// utxproof message.  It's used to deliver the proof of the outpoints requested
+// with a getutxproof message.
+type MsgUtreexoTxProof struct {
+	// BlockHash is the hash of the block at which the accumulator that the
+	// leaf datas are proven against was.  The requester is able to fetch the
+	// roots of that accumulator with a getutreexoroot message.
+	BlockHash chainhash.Hash
+
+	// AccProof is the proof of the leaf datas.
+	AccProof utreexo.Proof
+
+	// LeafDatas are the leaf datas of the requested outpoints that are
+	// unspent, in the order they were requested in.
+	LeafDatas []LeafData
+
+	// Missing are the requested outpoints that aren't in the utxo set and
+	// thus aren't proven.
+	Missing []OutPoint
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgUtreexoTxProof) BtcDecode(r io.Reader, pver uint32, _ MessageEncoding) error {
+	_, err := io.ReadFull(r, msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	proof, err := BatchProofDeserialize(r)
+	if err != nil {
+		return err
+	}
+	msg.AccProof = *proof
+
+	leafCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if leafCount > MaxGetUtreexoTxProofOutPoints {
+		str := fmt.Sprintf("too many leaf datas in message [%v]", leafCount)
+		return messageError("MsgUtreexoTxProof.BtcDecode", str)
+	}
+	msg.LeafDatas = make([]LeafData, leafCount)
+	for i := range msg.LeafDatas {
+		err = msg.LeafDatas[i].Deserialize(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	missingCount, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if missingCount > MaxGetUtreexoTxProofOutPoints {
+		str := fmt.Sprintf("too many missing outpoints in message [%v]",
+			missingCount)
+		return messageError("MsgUtreexoTxProof.BtcDecode", str)
+	}
+	msg.Missing = make([]OutPoint, missingCount)
+	for i := range msg.Missing {
+		err = readOutPoint(r, pver, 0, &msg.Missing[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgUtreexoTxProof) BtcEncode(w io.Writer, pver uint32, _ MessageEncoding) error {
+	_, err := w.Write(msg.BlockHash[:])
+	if err != nil {
+		return err
+	}
+
+	err = BatchProofSerialize(w, &msg.AccProof)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.LeafDatas)))
+	if err != nil {
+		return err
+	}
+	for i := range msg.LeafDatas {
+		err = msg.LeafDatas[i].Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.Missing)))
+	if err != nil {
+		return err
+	}
+	for i := range msg.Missing {
+		err = WriteOutPoint(w, pver, 0, &msg.Missing[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SerializeSize returns the number of bytes it would take to serialize the
+// message.
+func (msg *MsgUtreexoTxProof) SerializeSize() int {
+	size := chainhash.HashSize + BatchProofSerializeSize(&msg.AccProof)
+
+	size += VarIntSerializeSize(uint64(len(msg.LeafDatas)))
+	for i := range msg.LeafDatas {
+		size += msg.LeafDatas[i].SerializeSize()
+	}
+
+	size += VarIntSerializeSize(uint64(len(msg.Missing)))
+	return size + len(msg.Missing)*(4+chainhash.HashSize)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgUtreexoTxProof) Command() string {
+	return CmdUtreexoTxProof
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgUtreexoTxProof) MaxPayloadLength(_ uint32) uint32 {
+	return MaxMessagePayload
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2025 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/utreexo/utreexo"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+func TestMsgGetUtreexoTxProofEncode(t *testing.T) {
+	outPoints := []OutPoint{
+		{Hash: genesisHash, Index: 0},
+		{Hash: chainhash.Hash{1}, Index: 7},
+	}
+	beforeMsg := NewMsgGetUtreexoTxProof(outPoints)
+
+	var buf bytes.Buffer
+	err := beforeMsg.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint32(buf.Len()) > beforeMsg.MaxPayloadLength(ProtocolVersion) {
+		t.Fatalf("encoded %d bytes but the max payload is %d",
+			buf.Len(), beforeMsg.MaxPayloadLength(ProtocolVersion))
+	}
+
+	var afterMsg MsgGetUtreexoTxProof
+	err = afterMsg.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(afterMsg.OutPoints, outPoints) {
+		t.Fatalf("expected %v but got %v", outPoints, afterMsg.OutPoints)
+	}
+
+	// Too many outpoints are rejected both ways.
+	tooMany := &MsgGetUtreexoTxProof{
+		OutPoints: make([]OutPoint, MaxGetUtreexoTxProofOutPoints+1),
+	}
+	err = tooMany.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error encoding too many outpoints")
+	}
+	buf.Reset()
+	err = WriteVarInt(&buf, ProtocolVersion, MaxGetUtreexoTxProofOutPoints+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = afterMsg.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+	if err == nil {
+		t.Fatal("expected an error decoding too many outpoints")
+	}
+
+	full := &MsgGetUtreexoTxProof{
+		OutPoints: make([]OutPoint, MaxGetUtreexoTxProofOutPoints),
+	}
+	err = full.AddOutPoint(OutPoint{})
+	if err == nil {
+		t.Fatal("expected an error adding too many outpoints")
+	}
+}
+
+func TestMsgUtreexoTxProofEncode(t *testing.T) {
+	beforeMsg := &MsgUtreexoTxProof{
+		BlockHash: genesisHash,
+		AccProof: utreexo.Proof{
+			Targets: []uint64{3, 12},
+			Proof:   []utreexo.Hash{{1}, {2}, {3}},
+		},
+		LeafDatas: []LeafData{
+			{
+				BlockHash:  chainhash.Hash{4},
+				OutPoint:   OutPoint{Hash: chainhash.Hash{5}, Index: 1},
+				Amount:     5000,
+				PkScript:   []byte{0x51},
+				Height:     10,
+				IsCoinBase: true,
+			},
+			{
+				BlockHash: chainhash.Hash{6},
+				OutPoint:  OutPoint{Hash: chainhash.Hash{7}, Index: 0},
+				Amount:    1234,
+				PkScript:  []byte{0x00, 0x14, 0x01, 0x02},
+				Height:    200,
+			},
+		},
+		Missing: []OutPoint{{Hash: chainhash.Hash{8}, Index: 3}},
+	}
+
+	var buf bytes.Buffer
+	err := beforeMsg.BtcEncode(&buf, ProtocolVersion, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != beforeMsg.SerializeSize() {
+		t.Fatalf("encoded %d bytes but expected %d", buf.Len(),
+			beforeMsg.SerializeSize())
+	}
+
+	var afterMsg MsgUtreexoTxProof
+	err = afterMsg.BtcDecode(&buf, ProtocolVersion, LatestEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&afterMsg, beforeMsg) {
+		t.Fatalf("expected %v but got %v", beforeMsg, &afterMsg)
+	}
+}
@@ -0,0 +1,624 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// maxAddrV2Size is the maximum size an address may be in the addrv2
+	// message.
+	maxAddrV2Size = 512
+)
+
+var (
+	// ErrInvalidAddressSize is an error that means an incorrect address
+	// size was decoded for a networkID or that the address exceeded the
+	// maximum size for an unknown networkID.
+	ErrInvalidAddressSize = fmt.Errorf("invalid address size")
+
+	// ErrSkippedNetworkID is returned when the cjdns or unknown networks
+	// are encountered during decoding.  In the case of an unknown
+	// networkID, this is so that a future BIP reserving a new networkID
+	// does not cause older addrv2-supporting software to disconnect upon
+	// receiving the new addresses.  This error can also be returned when
+	// an OnionCat-encoded torv2 address is received with the ipv6
+	// networkID.  This error signals to the caller to continue reading.
+	ErrSkippedNetworkID = fmt.Errorf("skipped networkID")
+)
+
+// Network names returned by the Network method of the addresses a
+// NetAddressV2 holds.
+const (
+	// NetworkIPv4 is the name of the ipv4 network.
+	NetworkIPv4 = "ipv4"
+
+	// NetworkIPv6 is the name of the ipv6 network.
+	NetworkIPv6 = "ipv6"
+
+	// NetworkOnion is the name of the Tor network.  Both torv2 and torv3
+	// addresses belong to it.
+	NetworkOnion = "onion"
+
+	// NetworkI2P is the name of the I2P network.
+	NetworkI2P = "i2p"
+)
+
+// maxNetAddressV2Payload returns the max payload size for an address used in
+// the addrv2 message.
+func maxNetAddressV2Payload() uint32 {
+	// The timestamp takes up four bytes.
+	plen := uint32(4)
+
+	// The ServiceFlag is a varint and its maximum size is 9 bytes.
+	plen += 9
+
+	// The netID is a single byte.
+	plen += 1
+
+	// The largest address is 512 bytes.  Even though it will not be a
+	// valid address, we should read and ignore it.  The preceding varint
+	// to store 512 bytes is 3 bytes long.  This gives us a total of 515
+	// bytes.
+	plen += 515
+
+	// The port is 2 bytes.
+	plen += 2
+
+	return plen
+}
+
+// isOnionCatTor returns whether a given ip address is actually an encoded tor
+// v2 address.  The wire package is unable to use the addrmgr's IsOnionCatTor
+// as doing so would give an import cycle.
+func isOnionCatTor(ip net.IP) bool {
+	onionCatNet := net.IPNet{
+		IP:   net.ParseIP("fd87:d87e:eb43::"),
+		Mask: net.CIDRMask(48, 128),
+	}
+	return onionCatNet.Contains(ip)
+}
+
+// NetAddressV2 defines information about a peer on the network including the
+// last time it was seen, the services it supports, its address, and port.
+// This struct is used in the addrv2 message (MsgAddrV2) and can contain
+// larger addresses, like torv3 and i2p.  Additionally, it can contain any
+// NetAddress address.
+type NetAddressV2 struct {
+	// Last time the address was seen.  This is, unfortunately, encoded as
+	// a uint32 on the wire and therefore is limited to 2106.  This field
+	// is not present in the bitcoin version message (MsgVersion) nor was
+	// it added until protocol version >= NetAddressTimeVersion.
+	Timestamp time.Time
+
+	// Services is a bitfield which identifies the services supported by
+	// the address.  This is encoded in CompactSize.
+	Services ServiceFlag
+
+	// Addr is the network address of the peer.  This is a variable-length
+	// address.  Network() returns the name of the network the address
+	// belongs to, one of the Network constants.  String() returns the
+	// address as a string.
+	Addr net.Addr
+
+	// Port is the port of the address.  This is 0 if the network doesn't
+	// use ports.
+	Port uint16
+}
+
+// HasService returns whether the specified service is supported by the
+// address.
+func (na *NetAddressV2) HasService(service ServiceFlag) bool {
+	return na.Services&service == service
+}
+
+// AddService adds a service to the Services bitfield.
+func (na *NetAddressV2) AddService(service ServiceFlag) {
+	na.Services |= service
+}
+
+// ToLegacy attempts to convert a NetAddressV2 to a legacy NetAddress.  This
+// only works for ipv4, ipv6, or torv2 addresses as they can be encoded with
+// the OnionCat encoding.  If this method is called on a torv3 or i2p address,
+// nil will be returned.
+func (na *NetAddressV2) ToLegacy() *NetAddress {
+	legacyNa := &NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      na.Port,
+	}
+
+	switch a := na.Addr.(type) {
+	case *ipv4Addr:
+		legacyNa.IP = a.addr[:]
+	case *ipv6Addr:
+		legacyNa.IP = a.addr[:]
+	case *torv2Addr:
+		legacyNa.IP = a.onionCatEncoding()
+	default:
+		return nil
+	}
+
+	return legacyNa
+}
+
+// IsTorV3 returns a bool that signals to the caller whether or not this is a
+// torv3 address.
+func (na *NetAddressV2) IsTorV3() bool {
+	_, ok := na.Addr.(*torv3Addr)
+	return ok
+}
+
+// IsI2P returns a bool that signals to the caller whether or not this is an
+// i2p address.
+func (na *NetAddressV2) IsI2P() bool {
+	_, ok := na.Addr.(*i2pAddr)
+	return ok
+}
+
+// AddrKey returns the first byte of the key of a torv3 or i2p address.  This
+// is used in the addrmgr to calculate a key from a network group.
+func (na *NetAddressV2) AddrKey() byte {
+	switch a := na.Addr.(type) {
+	case *torv3Addr:
+		return a.addr[0]
+	case *i2pAddr:
+		return a.addr[0]
+	}
+
+	// This should never be called on other addresses.
+	panic("unexpected AddrKey call on non-torv3 and non-i2p address")
+}
+
+// NetAddressV2FromBytes creates a NetAddressV2 from a byte slice.  It will
+// also handle a torv2 address using the OnionCat encoding.  Since torv3 and
+// i2p addresses are the same size, i2p addresses have to be created with
+// NewNetAddressV2I2P.
+func NetAddressV2FromBytes(timestamp time.Time, services ServiceFlag,
+	addrBytes []byte, port uint16) *NetAddressV2 {
+
+	var netAddr net.Addr
+	switch len(addrBytes) {
+	case ipv4Size:
+		addr := &ipv4Addr{}
+		copy(addr.addr[:], addrBytes)
+		netAddr = addr
+	case ipv6Size:
+		if isOnionCatTor(addrBytes) {
+			addr := &torv2Addr{}
+			copy(addr.addr[:], addrBytes[6:])
+			netAddr = addr
+			break
+		}
+
+		// IPv4-mapped addresses are kept as ipv4 so that the same
+		// address has a single encoding.
+		if ip := net.IP(addrBytes).To4(); ip != nil {
+			addr := &ipv4Addr{}
+			copy(addr.addr[:], ip)
+			netAddr = addr
+			break
+		}
+
+		addr := &ipv6Addr{}
+		copy(addr.addr[:], addrBytes)
+		netAddr = addr
+	case torv2Size:
+		addr := &torv2Addr{}
+		copy(addr.addr[:], addrBytes)
+		netAddr = addr
+	case TorV3Size:
+		addr := &torv3Addr{}
+		copy(addr.addr[:], addrBytes)
+		netAddr = addr
+	}
+
+	return &NetAddressV2{
+		Timestamp: timestamp,
+		Services:  services,
+		Addr:      netAddr,
+		Port:      port,
+	}
+}
+
+// NewNetAddressV2I2P creates a NetAddressV2 for the i2p destination with the
+// passed hash.
+func NewNetAddressV2I2P(timestamp time.Time, services ServiceFlag,
+	hash [I2PSize]byte, port uint16) *NetAddressV2 {
+
+	return &NetAddressV2{
+		Timestamp: timestamp,
+		Services:  services,
+		Addr:      &i2pAddr{addr: hash},
+		Port:      port,
+	}
+}
+
+// NetAddressV2FromLegacy creates a NetAddressV2 from the passed legacy
+// NetAddress.
+func NetAddressV2FromLegacy(na *NetAddress) *NetAddressV2 {
+	ip := na.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if len(ip) != ipv4Size && len(ip) != ipv6Size {
+		ip = net.IPv6zero
+	}
+
+	return NetAddressV2FromBytes(na.Timestamp, na.Services, ip, na.Port)
+}
+
+// writeNetAddressV2 writes a NetAddressV2 to a writer.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+
+	if err := WriteVarInt(w, pver, uint64(na.Services)); err != nil {
+		return err
+	}
+
+	var (
+		netID   networkID
+		address []byte
+	)
+
+	switch a := na.Addr.(type) {
+	case *ipv4Addr:
+		netID = ipv4
+		address = a.addr[:]
+	case *ipv6Addr:
+		netID = ipv6
+		address = a.addr[:]
+	case *torv2Addr:
+		netID = torv2
+		address = a.addr[:]
+	case *torv3Addr:
+		netID = torv3
+		address = a.addr[:]
+	case *i2pAddr:
+		netID = i2p
+		address = a.addr[:]
+	default:
+		// This should not occur.
+		return fmt.Errorf("unexpected address type")
+	}
+
+	if err := writeElement(w, uint8(netID)); err != nil {
+		return err
+	}
+
+	if err := WriteVarBytes(w, pver, address); err != nil {
+		return err
+	}
+
+	return binary.Write(w, bigEndian, na.Port)
+}
+
+// readNetAddressV2 reads a NetAddressV2 from a reader.  This function has
+// checks that the corresponding write function doesn't.  This is because
+// reading from the peer is untrusted whereas writing assumes we have already
+// validated the NetAddressV2.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	// Services is encoded as a variable length integer in addrv2.
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	na.Services = ServiceFlag(services)
+
+	var netID uint8
+	if err := readElement(r, &netID); err != nil {
+		return err
+	}
+
+	decodedSize, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	if !isKnownNetworkID(netID) {
+		// In the case of an unknown networkID, we'll read the address
+		// size and error with ErrInvalidAddressSize if it's greater
+		// than maxAddrV2Size.  If the address size is within the
+		// valid range, we'll just read and discard the address.  In
+		// this case, ErrSkippedNetworkID will be returned to signal to
+		// the caller to continue reading.
+		if decodedSize > maxAddrV2Size {
+			return ErrInvalidAddressSize
+		}
+
+		// The +2 is the port field.
+		discardedAddrPort := make([]byte, decodedSize+2)
+		if _, err := io.ReadFull(r, discardedAddrPort); err != nil {
+			return err
+		}
+
+		return ErrSkippedNetworkID
+	}
+
+	if decodedSize != uint64(networkID(netID).addrSize()) {
+		return ErrInvalidAddressSize
+	}
+	address := make([]byte, decodedSize)
+	if _, err := io.ReadFull(r, address); err != nil {
+		return err
+	}
+	bs := newSerializer()
+	na.Port, err = bs.Uint16(r, bigEndian)
+	bs.free()
+	if err != nil {
+		return err
+	}
+
+	switch networkID(netID) {
+	case ipv4:
+		addr := &ipv4Addr{}
+		copy(addr.addr[:], address)
+		na.Addr = addr
+
+	case ipv6:
+		// BIP-155 says to ignore OnionCat addresses and IPv4-mapped
+		// addresses in addrv2 messages.
+		ip := net.IP(address)
+		if isOnionCatTor(ip) || ip.To4() != nil {
+			return ErrSkippedNetworkID
+		}
+
+		addr := &ipv6Addr{}
+		copy(addr.addr[:], address)
+		na.Addr = addr
+
+	case torv2:
+		addr := &torv2Addr{}
+		copy(addr.addr[:], address)
+		na.Addr = addr
+
+	case torv3:
+		// BIP-155 does not specify to validate the public key here.
+		// bitcoind does not validate the ed25519 pubkey.
+		addr := &torv3Addr{}
+		copy(addr.addr[:], address)
+		na.Addr = addr
+
+	case i2p:
+		addr := &i2pAddr{}
+		copy(addr.addr[:], address)
+		na.Addr = addr
+
+	case cjdns:
+		// cjdns addresses are read to advance the reader but aren't
+		// supported.
+		return ErrSkippedNetworkID
+	}
+
+	return nil
+}
+
+// networkID represents the network that a given address is in as defined by
+// BIP-155.
+type networkID uint8
+
+const (
+	// ipv4 means the following address is ipv4.
+	ipv4 networkID = iota + 1
+
+	// ipv6 means the following address is ipv6.
+	ipv6
+
+	// torv2 means the following address is a torv2 hidden service address.
+	torv2
+
+	// torv3 means the following address is a torv3 hidden service address.
+	torv3
+
+	// i2p means the following address is an i2p address.
+	i2p
+
+	// cjdns means the following address is a cjdns address.
+	cjdns
+)
+
+const (
+	// ipv4Size is the size of an ipv4 address.
+	ipv4Size = 4
+
+	// ipv6Size is the size of an ipv6 address.
+	ipv6Size = 16
+
+	// torv2Size is the size of a torv2 address.
+	torv2Size = 10
+
+	// TorV3Size is the size of a torv3 address in bytes.
+	TorV3Size = 32
+
+	// I2PSize is the size of an i2p address in bytes.  It's the SHA256
+	// hash of the destination.
+	I2PSize = 32
+
+	// cjdnsSize is the size of a cjdns address.
+	cjdnsSize = 16
+)
+
+const (
+	// TorV2EncodedSize is the size of a torv2 address encoded in base32
+	// with the ".onion" suffix.
+	TorV2EncodedSize = 22
+
+	// TorV3EncodedSize is the size of a torv3 address encoded in base32
+	// with the ".onion" suffix.
+	TorV3EncodedSize = 62
+
+	// I2PEncodedSize is the size of an i2p address encoded in base32
+	// without padding with the ".b32.i2p" suffix.
+	I2PEncodedSize = 60
+)
+
+// addrSize returns the size of the addresses of the network.
+func (id networkID) addrSize() int {
+	switch id {
+	case ipv4:
+		return ipv4Size
+	case ipv6:
+		return ipv6Size
+	case torv2:
+		return torv2Size
+	case torv3:
+		return TorV3Size
+	case i2p:
+		return I2PSize
+	case cjdns:
+		return cjdnsSize
+	}
+
+	return 0
+}
+
+// isKnownNetworkID returns true if the networkID is one listed above and false
+// otherwise.
+func isKnownNetworkID(netID uint8) bool {
+	return uint8(ipv4) <= netID && netID <= uint8(cjdns)
+}
+
+// i2pEncoding is the base32 encoding i2p addresses are written in.
+var i2pEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type ipv4Addr struct {
+	addr [ipv4Size]byte
+}
+
+// Part of the net.Addr interface.
+func (a *ipv4Addr) String() string {
+	return net.IP(a.addr[:]).String()
+}
+
+// Part of the net.Addr interface.
+func (a *ipv4Addr) Network() string {
+	return NetworkIPv4
+}
+
+// Compile-time constraints to check that ipv4Addr meets the net.Addr
+// interface.
+var _ net.Addr = (*ipv4Addr)(nil)
+
+type ipv6Addr struct {
+	addr [ipv6Size]byte
+}
+
+// Part of the net.Addr interface.
+func (a *ipv6Addr) String() string {
+	return net.IP(a.addr[:]).String()
+}
+
+// Part of the net.Addr interface.
+func (a *ipv6Addr) Network() string {
+	return NetworkIPv6
+}
+
+// Compile-time constraints to check that ipv6Addr meets the net.Addr
+// interface.
+var _ net.Addr = (*ipv6Addr)(nil)
+
+type torv2Addr struct {
+	addr [torv2Size]byte
+}
+
+// Part of the net.Addr interface.
+func (a *torv2Addr) String() string {
+	base32Hash := base32.StdEncoding.EncodeToString(a.addr[:])
+	return strings.ToLower(base32Hash) + ".onion"
+}
+
+// Part of the net.Addr interface.
+func (a *torv2Addr) Network() string {
+	return NetworkOnion
+}
+
+// onionCatEncoding returns a torv2 address as an ipv6 address.
+func (a *torv2Addr) onionCatEncoding() net.IP {
+	prefix := []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+	return net.IP(append(prefix, a.addr[:]...))
+}
+
+// Compile-time constraints to check that torv2Addr meets the net.Addr
+// interface.
+var _ net.Addr = (*torv2Addr)(nil)
+
+type torv3Addr struct {
+	addr [TorV3Size]byte
+}
+
+// Part of the net.Addr interface.
+func (a *torv3Addr) String() string {
+	// BIP-155 describes the torv3 address format:
+	// onion_address = base32(PUBKEY | CHECKSUM | VERSION) + ".onion"
+	// CHECKSUM = H(".onion checksum" | PUBKEY | VERSION)[:2]
+	// PUBKEY = addr, which is the ed25519 pubkey of the hidden service.
+	// VERSION = '\x03'
+	// H() is the SHA3-256 cryptographic hash function.
+	torV3Version := []byte("\x03")
+	checksumConst := []byte(".onion checksum")
+
+	// Write never returns an error so there is no need to handle it.
+	h := sha3.New256()
+	h.Write(checksumConst)
+	h.Write(a.addr[:])
+	h.Write(torV3Version)
+	truncatedChecksum := h.Sum(nil)[:2]
+
+	var base32Input [35]byte
+	copy(base32Input[:32], a.addr[:])
+	copy(base32Input[32:34], truncatedChecksum)
+	copy(base32Input[34:], torV3Version)
+
+	base32Hash := base32.StdEncoding.EncodeToString(base32Input[:])
+	return strings.ToLower(base32Hash) + ".onion"
+}
+
+// Part of the net.Addr interface.
+func (a *torv3Addr) Network() string {
+	return NetworkOnion
+}
+
+// Compile-time constraints to check that torv3Addr meets the net.Addr
+// interface.
+var _ net.Addr = (*torv3Addr)(nil)
+
+type i2pAddr struct {
+	addr [I2PSize]byte
+}
+
+// Part of the net.Addr interface.
+func (a *i2pAddr) String() string {
+	// BIP-155 describes the i2p address format as the base32 encoding of
+	// the SHA256 hash of the destination without padding followed by
+	// ".b32.i2p".
+	return strings.ToLower(i2pEncoding.EncodeToString(a.addr[:])) +
+		".b32.i2p"
+}
+
+// Part of the net.Addr interface.
+func (a *i2pAddr) Network() string {
+	return NetworkI2P
+}
+
+// Compile-time constraints to check that i2pAddr meets the net.Addr
+// interface.
+var _ net.Addr = (*i2pAddr)(nil)
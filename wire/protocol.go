@@ -55,6 +55,17 @@ const (
 	// FeeFilterVersion is the protocol version which added a new
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
+
+	// BIP0152Version is the protocol version which added the compact block
+	// relay messages sendcmpct, cmpctblock, getblocktxn and blocktxn.
+	BIP0152Version uint32 = 70014
+
+	// AddrV2Version is the protocol version which added two new messages.
+	// sendaddrv2 is sent during the version-verack handshake and signals
+	// support for sending and receiving the addrv2 message.  In the future,
+	// new messages that occur during the version-verack handshake will not
+	// come with a protocol version bump.
+	AddrV2Version uint32 = 70016
 )
 
 const (
@@ -101,12 +112,30 @@ const (
 	// the last 288 blocks.
 	SFNodeNetworkLimited = 1 << 10
 
+	// SFNodeP2PV2 is a flag used to indicate a peer supports the v2
+	// encrypted transport (BIP0324).
+	SFNodeP2PV2 = 1 << 11
+
 	// SFNodeUtreexo is a flag used to indicate a peer is running the utreexo
 	// protocol.
 	//
 	// TODO: Using bit 24 at the moment as bits 24-31 are reserved for
 	// experiments.  The bit used will definitely change in the future.
 	SFNodeUtreexo = 1 << 24
+
+	// SFNodeUtreexoArchive is a flag used to indicate a peer is a utreexo
+	// bridge node that serves the utreexo proofs of every block.
+	SFNodeUtreexoArchive = 1 << 25
+
+	// SFNodeUtreexoRecent is a flag used to indicate a peer is a utreexo
+	// bridge node that serves the utreexo proofs of at least the last 288
+	// blocks.  Archival bridges signal it as well.
+	SFNodeUtreexoRecent = 1 << 26
+
+	// SFNodeUtreexoCSN is a flag used to indicate a peer is a utreexo
+	// compact state node.  It only keeps the roots of the accumulator and
+	// doesn't serve any utreexo proofs.
+	SFNodeUtreexoCSN = 1 << 27
 )
 
 // Map of service flags back to their constant names for pretty printing.
@@ -120,7 +149,11 @@ var sfStrings = map[ServiceFlag]string{
 	SFNodeBit5:           "SFNodeBit5",
 	SFNodeCF:             "SFNodeCF",
 	SFNode2X:             "SFNode2X",
+	SFNodeP2PV2:          "SFNodeP2PV2",
 	SFNodeUtreexo:        "SFNodeUtreexo",
+	SFNodeUtreexoArchive: "SFNodeUtreexoArchive",
+	SFNodeUtreexoRecent:  "SFNodeUtreexoRecent",
+	SFNodeUtreexoCSN:     "SFNodeUtreexoCSN",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -135,7 +168,11 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeBit5,
 	SFNodeCF,
 	SFNode2X,
+	SFNodeP2PV2,
 	SFNodeUtreexo,
+	SFNodeUtreexoArchive,
+	SFNodeUtreexoRecent,
+	SFNodeUtreexoCSN,
 }
 
 // HasFlag returns a bool indicating if the service has the given flag.
@@ -185,6 +222,9 @@ const (
 	// TestNet3 represents the test network (version 3).
 	TestNet3 BitcoinNet = 0x0709110b
 
+	// TestNet4 represents the test network (version 4).
+	TestNet4 BitcoinNet = 0x283f161c
+
 	// SimNet represents the simulation test network.
 	SimNet BitcoinNet = 0x12141c16
 )
@@ -195,6 +235,7 @@ var bnStrings = map[BitcoinNet]string{
 	MainNet:  "MainNet",
 	TestNet:  "TestNet",
 	TestNet3: "TestNet3",
+	TestNet4: "TestNet4",
 	SimNet:   "SimNet",
 }
 
@@ -26,8 +26,12 @@ func TestServiceFlagStringer(t *testing.T) {
 		{SFNodeBit5, "SFNodeBit5"},
 		{SFNodeCF, "SFNodeCF"},
 		{SFNode2X, "SFNode2X"},
+		{SFNodeP2PV2, "SFNodeP2PV2"},
 		{SFNodeUtreexo, "SFNodeUtreexo"},
-		{0xffffffff, "SFNodeNetwork|SFNodeNetworkLimited|SFNodeGetUTXO|SFNodeBloom|SFNodeWitness|SFNodeXthin|SFNodeBit5|SFNodeCF|SFNode2X|SFNodeUtreexo|0xfefffb00"},
+		{SFNodeUtreexoArchive, "SFNodeUtreexoArchive"},
+		{SFNodeUtreexoRecent, "SFNodeUtreexoRecent"},
+		{SFNodeUtreexoCSN, "SFNodeUtreexoCSN"},
+		{0xffffffff, "SFNodeNetwork|SFNodeNetworkLimited|SFNodeGetUTXO|SFNodeBloom|SFNodeWitness|SFNodeXthin|SFNodeBit5|SFNodeCF|SFNode2X|SFNodeP2PV2|SFNodeUtreexo|SFNodeUtreexoArchive|SFNodeUtreexoRecent|SFNodeUtreexoCSN|0xf0fff300"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -50,6 +54,7 @@ func TestBitcoinNetStringer(t *testing.T) {
 		{MainNet, "MainNet"},
 		{TestNet, "TestNet"},
 		{TestNet3, "TestNet3"},
+		{TestNet4, "TestNet4"},
 		{SimNet, "SimNet"},
 		{0xffffffff, "Unknown BitcoinNet (4294967295)"},
 	}
@@ -0,0 +1,231 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/utreexo/utreexod/blockchain"
+	"github.com/utreexo/utreexod/btcutil"
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+	"github.com/utreexo/utreexod/mempool"
+	"github.com/utreexo/utreexod/wire"
+)
+
+// Topics of the notifications.  rawblock and rawtx are the same as Bitcoin
+// Core's.
+const (
+	// TopicRawBlock is the topic of the serialized blocks that are
+	// connected to the main chain.
+	TopicRawBlock = "rawblock"
+
+	// TopicRawTx is the topic of the serialized transactions that are
+	// accepted to the mempool or connected to the main chain in a block.
+	TopicRawTx = "rawtx"
+
+	// TopicUtreexoRoots is the topic of the roots of the utreexo
+	// accumulator every time the tip changes.  The body is the hash of the
+	// tip in the byte order it's displayed in, its height as an uint32 and
+	// the number of leaves as an uint64, both in little endian, followed by
+	// the 32 byte roots.
+	TopicUtreexoRoots = "utreexoroots"
+)
+
+// Config is the configuration of the ZMQ notifier.
+type Config struct {
+	// PubRawBlock, PubRawTx and PubUtreexoRoots are the endpoints such as
+	// tcp://127.0.0.1:28332 the topics are published on.  A topic isn't
+	// published when its endpoint is empty.  Topics may share an endpoint.
+	PubRawBlock     string
+	PubRawTx        string
+	PubUtreexoRoots string
+
+	// Chain is the chain the blocks are published from.
+	Chain *blockchain.BlockChain
+
+	// FetchUtreexoRoots returns the roots and the number of leaves of the
+	// utreexo accumulator at the given block, which just became the tip.
+	// It's required when the utreexo roots are published.
+	FetchUtreexoRoots func(hash *chainhash.Hash) ([]*chainhash.Hash, uint64, error)
+}
+
+// Notifier publishes the blocks, transactions and utreexo roots to ZMQ
+// subscribers.
+type Notifier struct {
+	started  int32
+	shutdown int32
+
+	cfg Config
+
+	publishers   []*publisher
+	rawBlock     *publisher
+	rawTx        *publisher
+	utreexoRoots *publisher
+}
+
+// New returns a notifier that's bound to the configured endpoints.  It's
+// subscribed to the chain right away, but subscribers can only connect once
+// it's started.
+func New(cfg *Config) (*Notifier, error) {
+	n := Notifier{cfg: *cfg}
+
+	// Topics that share an endpoint share the publisher bound to it.
+	byEndpoint := make(map[string]*publisher)
+	bind := func(endpoint string) (*publisher, error) {
+		if endpoint == "" {
+			return nil, nil
+		}
+		if p, ok := byEndpoint[endpoint]; ok {
+			return p, nil
+		}
+		p, err := newPublisher(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		byEndpoint[endpoint] = p
+		n.publishers = append(n.publishers, p)
+		return p, nil
+	}
+
+	var err error
+	if n.rawBlock, err = bind(cfg.PubRawBlock); err == nil {
+		if n.rawTx, err = bind(cfg.PubRawTx); err == nil {
+			n.utreexoRoots, err = bind(cfg.PubUtreexoRoots)
+		}
+	}
+	if err != nil {
+		for _, p := range n.publishers {
+			p.listener.Close()
+		}
+		return nil, err
+	}
+
+	n.cfg.Chain.Subscribe(n.handleBlockchainNotification)
+	return &n, nil
+}
+
+// Start starts accepting subscribers.
+func (n *Notifier) Start() {
+	// Already started?
+	if atomic.AddInt32(&n.started, 1) != 1 {
+		return
+	}
+
+	for _, p := range n.publishers {
+		p.start()
+	}
+}
+
+// Stop disconnects all the subscribers.
+func (n *Notifier) Stop() {
+	// Already stopped?
+	if atomic.AddInt32(&n.shutdown, 1) != 1 {
+		log.Infof("ZMQ notifier is already in the process of shutting " +
+			"down")
+		return
+	}
+
+	for _, p := range n.publishers {
+		p.stop()
+	}
+}
+
+// NotifyNewTransactions publishes the transactions accepted to the mempool.
+func (n *Notifier) NotifyNewTransactions(txns []*mempool.TxDesc) {
+	if n.rawTx == nil {
+		return
+	}
+	for _, txD := range txns {
+		n.publishTx(txD.Tx)
+	}
+}
+
+// publishTx publishes the transaction serialized with its witness.
+func (n *Notifier) publishTx(tx *btcutil.Tx) {
+	var buf bytes.Buffer
+	if err := tx.MsgTx().Serialize(&buf); err != nil {
+		log.Errorf("Can't serialize transaction %v: %v", tx.Hash(), err)
+		return
+	}
+	n.rawTx.publish(TopicRawTx, buf.Bytes())
+}
+
+// handleBlockchainNotification publishes the blocks connected to the main
+// chain along with their transactions and the utreexo roots whenever the tip
+// changes.
+func (n *Notifier) handleBlockchainNotification(notification *blockchain.Notification) {
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			log.Warnf("Chain connected notification is not a block.")
+			break
+		}
+
+		if n.rawBlock != nil {
+			// The utreexo proof of the block isn't part of the
+			// block that's published.
+			var buf bytes.Buffer
+			err := block.MsgBlock().BtcEncode(&buf, 0,
+				wire.WitnessEncoding)
+			if err != nil {
+				log.Errorf("Can't serialize block %v: %v",
+					block.Hash(), err)
+			} else {
+				n.rawBlock.publish(TopicRawBlock, buf.Bytes())
+			}
+		}
+		if n.rawTx != nil {
+			for _, tx := range block.Transactions() {
+				n.publishTx(tx)
+			}
+		}
+		n.publishUtreexoRoots(block.Hash(), block.Height())
+
+	case blockchain.NTBlockDisconnected:
+		block, ok := notification.Data.(*btcutil.Block)
+		if !ok {
+			log.Warnf("Chain disconnected notification is not a block.")
+			break
+		}
+		n.publishUtreexoRoots(&block.MsgBlock().Header.PrevBlock,
+			block.Height()-1)
+	}
+}
+
+// publishUtreexoRoots publishes the roots of the utreexo accumulator at the
+// block, which just became the tip.
+func (n *Notifier) publishUtreexoRoots(hash *chainhash.Hash, height int32) {
+	if n.utreexoRoots == nil {
+		return
+	}
+	roots, numLeaves, err := n.cfg.FetchUtreexoRoots(hash)
+	if err != nil {
+		log.Warnf("Can't fetch the utreexo roots at block %v: %v", hash,
+			err)
+		return
+	}
+	n.utreexoRoots.publish(TopicUtreexoRoots,
+		serializeUtreexoRoots(hash, height, numLeaves, roots))
+}
+
+// serializeUtreexoRoots returns the body of a utreexoroots message.
+func serializeUtreexoRoots(hash *chainhash.Hash, height int32, numLeaves uint64,
+	roots []*chainhash.Hash) []byte {
+
+	body := make([]byte, chainhash.HashSize+12, chainhash.HashSize+12+
+		len(roots)*chainhash.HashSize)
+	for i := 0; i < chainhash.HashSize; i++ {
+		body[i] = hash[chainhash.HashSize-1-i]
+	}
+	binary.LittleEndian.PutUint32(body[chainhash.HashSize:], uint32(height))
+	binary.LittleEndian.PutUint64(body[chainhash.HashSize+4:], numLeaves)
+	for _, root := range roots {
+		body = append(body, root[:]...)
+	}
+	return body
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sendHighWaterMark is the most messages queued for a subscriber.  Any
+	// more are dropped until the subscriber catches up, just like libzmq
+	// does for PUB sockets.
+	sendHighWaterMark = 1000
+
+	// handshakeTimeout is how long a subscriber has to complete the
+	// handshake after connecting.
+	handshakeTimeout = 10 * time.Second
+
+	// writeTimeout is how long writing a message to a subscriber may take
+	// before it's disconnected.
+	writeTimeout = time.Minute
+)
+
+// listenAddress returns the address to listen on for an endpoint such as
+// tcp://127.0.0.1:28332.  Only tcp endpoints are supported and the * wildcard
+// for the host listens on all interfaces.
+func listenAddress(endpoint string) (string, error) {
+	if !strings.HasPrefix(endpoint, "tcp://") {
+		return "", fmt.Errorf("unsupported endpoint %q -- only tcp:// "+
+			"endpoints are supported", endpoint)
+	}
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(endpoint, "tcp://"))
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// subscriber is a connection to a SUB socket along with its subscriptions.
+type subscriber struct {
+	conn net.Conn
+
+	// subscriptions are the topic prefixes the subscriber subscribed to
+	// and how many times it subscribed to them.
+	subMtx        sync.Mutex
+	subscriptions map[string]int
+
+	sendQueue chan [][]byte
+	quit      chan struct{}
+}
+
+// wants returns whether the subscriber subscribed to a prefix of the topic.
+func (s *subscriber) wants(topic []byte) bool {
+	s.subMtx.Lock()
+	defer s.subMtx.Unlock()
+
+	for prefix := range s.subscriptions {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSubscription updates the subscriptions with the body of a subscription
+// message or of a SUBSCRIBE or CANCEL command.
+func (s *subscriber) handleSubscription(subscribe bool, prefix []byte) {
+	s.subMtx.Lock()
+	defer s.subMtx.Unlock()
+
+	if subscribe {
+		s.subscriptions[string(prefix)]++
+		return
+	}
+	if s.subscriptions[string(prefix)] > 1 {
+		s.subscriptions[string(prefix)]--
+	} else {
+		delete(s.subscriptions, string(prefix))
+	}
+}
+
+// publisher is a PUB socket bound to an endpoint that sends the messages to
+// all the subscribers that subscribed to their topic.
+//
+// This type is safe for concurrent access.
+type publisher struct {
+	endpoint string
+	listener net.Listener
+
+	mtx         sync.Mutex
+	subscribers map[*subscriber]struct{}
+	sequences   map[string]uint32
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newPublisher returns a publisher listening on the endpoint.
+func newPublisher(endpoint string) (*publisher, error) {
+	addr, err := listenAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &publisher{
+		endpoint:    endpoint,
+		listener:    listener,
+		subscribers: make(map[*subscriber]struct{}),
+		sequences:   make(map[string]uint32),
+		quit:        make(chan struct{}),
+	}, nil
+}
+
+// start starts accepting subscribers.
+func (p *publisher) start() {
+	p.wg.Add(1)
+	go p.acceptSubscribers()
+	log.Infof("Publishing notifications on %s", p.endpoint)
+}
+
+// stop disconnects all the subscribers and stops accepting new ones.
+func (p *publisher) stop() {
+	close(p.quit)
+	p.listener.Close()
+
+	p.mtx.Lock()
+	for sub := range p.subscribers {
+		sub.conn.Close()
+	}
+	p.mtx.Unlock()
+
+	p.wg.Wait()
+}
+
+// acceptSubscribers accepts the connections of subscribers until the publisher
+// is stopped.
+//
+// It must be run as a goroutine.
+func (p *publisher) acceptSubscribers() {
+	defer p.wg.Done()
+
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			select {
+			case <-p.quit:
+			default:
+				log.Errorf("Can't accept subscribers on %s: %v",
+					p.endpoint, err)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go p.handleSubscriber(conn)
+	}
+}
+
+// handleSubscriber does the handshake with a subscriber and then reads its
+// subscriptions until it disconnects.
+//
+// It must be run as a goroutine.
+func (p *publisher) handleSubscriber(conn net.Conn) {
+	defer p.wg.Done()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	if err := handshake(conn, r, "PUB", "SUB", "XSUB"); err != nil {
+		log.Debugf("Handshake with subscriber %s failed: %v",
+			conn.RemoteAddr(), err)
+		return
+	}
+
+	sub := &subscriber{
+		conn:          conn,
+		subscriptions: make(map[string]int),
+		sendQueue:     make(chan [][]byte, sendHighWaterMark),
+		quit:          make(chan struct{}),
+	}
+	p.mtx.Lock()
+	select {
+	case <-p.quit:
+		p.mtx.Unlock()
+		return
+	default:
+	}
+	p.subscribers[sub] = struct{}{}
+	p.mtx.Unlock()
+	log.Debugf("New subscriber %s on %s", conn.RemoteAddr(), p.endpoint)
+
+	p.wg.Add(1)
+	go p.sendHandler(sub)
+
+	err := readSubscriptions(r, sub)
+	select {
+	case <-p.quit:
+	default:
+		log.Debugf("Subscriber %s on %s disconnected: %v",
+			conn.RemoteAddr(), p.endpoint, err)
+	}
+
+	p.mtx.Lock()
+	delete(p.subscribers, sub)
+	p.mtx.Unlock()
+	close(sub.quit)
+}
+
+// handshake exchanges the greeting and the READY commands with the peer.  The
+// socket type of the peer has to be one of the given ones.
+func handshake(conn net.Conn, r *bufio.Reader, socketType string,
+	peerSocketTypes ...string) error {
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := writeGreeting(conn); err != nil {
+		return err
+	}
+	if err := readGreeting(r); err != nil {
+		return err
+	}
+	if err := writeReadyCommand(conn, socketType); err != nil {
+		return err
+	}
+
+	f, err := readFrame(r, maxInboundFrameSize)
+	if err != nil {
+		return err
+	}
+	if !f.isCommand() {
+		return errors.New("expected the READY command")
+	}
+	name, data, err := parseCommand(f.body)
+	if err != nil {
+		return err
+	}
+	if name != "READY" {
+		return fmt.Errorf("expected the READY command, got %s", name)
+	}
+	properties, err := parseProperties(data)
+	if err != nil {
+		return err
+	}
+	peerSocketType := properties["socket-type"]
+	for _, allowed := range peerSocketTypes {
+		if peerSocketType == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("socket type %q can't connect to a %s socket",
+		peerSocketType, socketType)
+}
+
+// readSubscriptions reads the subscriptions of the subscriber until it fails to
+// read from it.
+func readSubscriptions(r *bufio.Reader, sub *subscriber) error {
+	for {
+		f, err := readFrame(r, maxInboundFrameSize)
+		if err != nil {
+			return err
+		}
+
+		// ZMTP 3.1 subscribers send their subscriptions as commands
+		// and earlier ones as messages.
+		if f.isCommand() {
+			name, data, err := parseCommand(f.body)
+			if err != nil {
+				return err
+			}
+			switch name {
+			case "SUBSCRIBE":
+				sub.handleSubscription(true, data)
+			case "CANCEL":
+				sub.handleSubscription(false, data)
+			}
+			continue
+		}
+		if len(f.body) == 0 {
+			continue
+		}
+		switch f.body[0] {
+		case subscribeByte:
+			sub.handleSubscription(true, f.body[1:])
+		case unsubscribeByte:
+			sub.handleSubscription(false, f.body[1:])
+		}
+	}
+}
+
+// sendHandler writes the queued messages to the subscriber.
+//
+// It must be run as a goroutine.
+func (p *publisher) sendHandler(sub *subscriber) {
+	defer p.wg.Done()
+
+	w := bufio.NewWriter(sub.conn)
+	for {
+		select {
+		case parts := <-sub.sendQueue:
+			sub.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := writeMessage(w, parts)
+			if err == nil && len(sub.sendQueue) == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				log.Debugf("Can't send to subscriber %s: %v",
+					sub.conn.RemoteAddr(), err)
+				sub.conn.Close()
+				return
+			}
+
+		case <-sub.quit:
+			return
+		}
+	}
+}
+
+// publish sends the body to the subscribers of the topic as a message made of
+// the topic, the body and the sequence number of the message on the topic in
+// little endian, like Bitcoin Core does.
+func (p *publisher) publish(topic string, body []byte) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	var sequence [4]byte
+	binary.LittleEndian.PutUint32(sequence[:], p.sequences[topic])
+	p.sequences[topic]++
+
+	parts := [][]byte{[]byte(topic), body, sequence[:]}
+	for sub := range p.subscribers {
+		if !sub.wants(parts[0]) {
+			continue
+		}
+		select {
+		case sub.sendQueue <- parts:
+		default:
+			log.Debugf("Dropping %s message for subscriber %s that "+
+				"is too far behind", topic, sub.conn.RemoteAddr())
+		}
+	}
+}
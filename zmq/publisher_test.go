@@ -0,0 +1,216 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/utreexo/utreexod/chaincfg/chainhash"
+)
+
+// testSubscriber is a SUB socket connected to a publisher.
+type testSubscriber struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialSubscriber connects a SUB socket to the publisher and subscribes it to
+// the given topic prefixes.
+func dialSubscriber(t *testing.T, p *publisher, prefixes ...string) *testSubscriber {
+	conn, err := net.Dial("tcp", p.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	sub := &testSubscriber{conn: conn, r: bufio.NewReader(conn)}
+
+	if err := writeGreeting(conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := readGreeting(sub.r); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeReadyCommand(conn, "SUB"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := readFrame(sub.r, maxNotificationFrameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := parseCommand(f.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties, err := parseProperties(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties["socket-type"] != "PUB" {
+		t.Fatalf("expected a PUB socket, got %q", properties["socket-type"])
+	}
+
+	for _, prefix := range prefixes {
+		body := append([]byte{subscribeByte}, prefix...)
+		if err := writeFrame(conn, 0, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitForSubscriptions(t, p, conn, len(prefixes))
+	return sub
+}
+
+// waitForSubscriptions waits for the publisher to have the given number of
+// subscriptions of the subscriber connected over conn so that nothing
+// published afterwards is missed.
+func waitForSubscriptions(t *testing.T, p *publisher, conn net.Conn, n int) {
+	for i := 0; ; i++ {
+		p.mtx.Lock()
+		var subscribed int
+		for s := range p.subscribers {
+			if s.conn.RemoteAddr().String() != conn.LocalAddr().String() {
+				continue
+			}
+			s.subMtx.Lock()
+			subscribed = len(s.subscriptions)
+			s.subMtx.Unlock()
+		}
+		p.mtx.Unlock()
+		if subscribed >= n {
+			return
+		}
+		if i == 100 {
+			t.Fatal("timed out waiting for the subscriptions")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readMessage reads the parts of the next message.
+func (s *testSubscriber) readMessage(t *testing.T) [][]byte {
+	var parts [][]byte
+	for {
+		f, err := readFrame(s.r, maxNotificationFrameSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, f.body)
+		if f.flags&flagMore == 0 {
+			return parts
+		}
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	if _, err := listenAddress("ipc:///tmp/utreexod"); err == nil {
+		t.Fatal("expected ipc endpoints to be rejected")
+	}
+
+	p, err := newPublisher("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.start()
+	defer p.stop()
+
+	txSub := dialSubscriber(t, p, TopicRawTx)
+	allSub := dialSubscriber(t, p, "")
+
+	// A body larger than 255 bytes needs a long frame.
+	block := bytes.Repeat([]byte{0xab}, 1000)
+	p.publish(TopicRawBlock, block)
+	p.publish(TopicRawTx, []byte{1})
+	p.publish(TopicRawTx, []byte{2})
+
+	tests := []struct {
+		sub      *testSubscriber
+		topic    string
+		body     []byte
+		sequence uint32
+	}{
+		{txSub, TopicRawTx, []byte{1}, 0},
+		{txSub, TopicRawTx, []byte{2}, 1},
+		{allSub, TopicRawBlock, block, 0},
+		{allSub, TopicRawTx, []byte{1}, 0},
+		{allSub, TopicRawTx, []byte{2}, 1},
+	}
+	for i, test := range tests {
+		parts := test.sub.readMessage(t)
+		if len(parts) != 3 {
+			t.Fatalf("test %d: expected 3 parts, got %d", i, len(parts))
+		}
+		if string(parts[0]) != test.topic ||
+			!bytes.Equal(parts[1], test.body) ||
+			binary.LittleEndian.Uint32(parts[2]) != test.sequence {
+
+			t.Fatalf("test %d: got topic %s, body %x and sequence "+
+				"%x", i, parts[0], parts[1], parts[2])
+		}
+	}
+}
+
+func TestSerializeUtreexoRoots(t *testing.T) {
+	hash := chainhash.DoubleHashH([]byte("block"))
+	roots := []*chainhash.Hash{
+		{0x01},
+		{0x02},
+	}
+	body := serializeUtreexoRoots(&hash, 840000, 1234, roots)
+	if len(body) != 32+4+8+2*32 {
+		t.Fatalf("unexpected size %d", len(body))
+	}
+
+	if hex.EncodeToString(body[:32]) != hash.String() ||
+		binary.LittleEndian.Uint32(body[32:]) != 840000 ||
+		binary.LittleEndian.Uint64(body[36:]) != 1234 ||
+		body[44] != 0x01 || body[76] != 0x02 {
+
+		t.Fatalf("unexpected body %x", body)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	if _, err := Subscribe("tcp://*:28332"); err == nil {
+		t.Fatal("expected an endpoint without a host to be rejected")
+	}
+
+	p, err := newPublisher("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.start()
+	defer p.stop()
+
+	s, err := Subscribe("tcp://"+p.listener.Addr().String(), TopicRawBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	waitForSubscriptions(t, p, s.conn, 1)
+
+	// Only the subscribed topic is received, with its sequence number.
+	block := bytes.Repeat([]byte{0xcd}, 1000)
+	p.publish(TopicRawTx, []byte{1})
+	p.publish(TopicRawBlock, []byte{2})
+	p.publish(TopicRawBlock, block)
+	s.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	for i, want := range [][]byte{{2}, block} {
+		n, err := s.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Topic != TopicRawBlock || !bytes.Equal(n.Body, want) ||
+			!n.HasSequence || n.Sequence != uint32(i) {
+
+			t.Fatalf("unexpected notification %d: %v", i, n)
+		}
+	}
+}
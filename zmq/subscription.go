@@ -0,0 +1,109 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// dialTimeout is how long connecting to a publisher may take.
+const dialTimeout = 30 * time.Second
+
+// Notification is a message received from a publisher.
+type Notification struct {
+	// Topic is the topic the notification was published on.
+	Topic string
+
+	// Body is the body of the notification.
+	Body []byte
+
+	// Sequence is the sequence number of the notification within its
+	// topic.  It's only set when HasSequence is.
+	Sequence    uint32
+	HasSequence bool
+}
+
+// Subscription is a SUB socket connected to a publisher such as the one of the
+// notifications of Bitcoin Core.
+type Subscription struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Subscribe connects to the publisher at the endpoint such as
+// tcp://127.0.0.1:28332 and subscribes to the given topics.
+func Subscribe(endpoint string, topics ...string) (*Subscription, error) {
+	addr, err := listenAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(addr, ":") {
+		return nil, fmt.Errorf("endpoint %q has no host to connect to",
+			endpoint)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{conn: conn, r: bufio.NewReader(conn)}
+	if err := handshake(conn, s.r, "SUB", "PUB", "XPUB"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	for _, topic := range topics {
+		body := append([]byte{subscribeByte}, topic...)
+		if err := writeFrame(conn, 0, body); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Receive waits for the next notification.  Notifications published while the
+// subscription wasn't able to keep up may have been dropped by the publisher,
+// which shows as a gap in the sequence numbers.
+func (s *Subscription) Receive() (*Notification, error) {
+	var parts [][]byte
+	for {
+		f, err := readFrame(s.r, maxNotificationFrameSize)
+		if err != nil {
+			return nil, err
+		}
+
+		// Commands such as the PING of later versions of ZMTP aren't
+		// part of a message.
+		if f.isCommand() {
+			continue
+		}
+		parts = append(parts, f.body)
+		if f.flags&flagMore == 0 {
+			break
+		}
+	}
+
+	n := &Notification{Topic: string(parts[0])}
+	if len(parts) > 1 {
+		n.Body = parts[1]
+	}
+	if len(parts) > 2 && len(parts[2]) == 4 {
+		n.Sequence = binary.LittleEndian.Uint32(parts[2])
+		n.HasSequence = true
+	}
+	return n, nil
+}
+
+// Close disconnects from the publisher.  Any Receive in progress returns an
+// error.
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2024 The utreexo developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/utreexo/utreexod/wire"
+)
+
+// The subset of ZMTP 3.0 (https://rfc.zeromq.org/spec/23/) needed to serve
+// subscribers as a PUB socket and to subscribe to a publisher as a SUB socket
+// with the NULL security mechanism is implemented here.  This is all that
+// libzmq uses for the notifications of Bitcoin Core.
+
+const (
+	// greetingSize is the size of the greeting both sides of a connection
+	// start with.
+	greetingSize = 64
+
+	// zmtpMajorVersion and zmtpMinorVersion are the version of ZMTP sent in
+	// the greeting.  With 3.0 the subscribers send their subscriptions as
+	// messages which libzmq does for any version below 3.1.
+	zmtpMajorVersion = 3
+	zmtpMinorVersion = 0
+
+	// maxInboundFrameSize is the largest frame accepted from a subscriber.
+	// Subscribers only send their handshake and subscriptions.
+	maxInboundFrameSize = 1 << 16
+
+	// maxNotificationFrameSize is the largest frame accepted from a
+	// publisher.  It fits any block.
+	maxNotificationFrameSize = wire.MaxMessagePayload
+)
+
+// Flags of a frame.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// Bytes a subscription message starts with.
+const (
+	unsubscribeByte = 0x00
+	subscribeByte   = 0x01
+)
+
+var (
+	// mechanismNull is the name of the NULL security mechanism, which
+	// doesn't authenticate or encrypt anything.
+	mechanismNull = []byte("NULL")
+
+	// errMalformedGreeting is returned when a peer sends a greeting that
+	// isn't a ZMTP 3 greeting with the NULL mechanism.
+	errMalformedGreeting = errors.New("malformed greeting")
+)
+
+// frame is a frame of a message or a command.
+type frame struct {
+	flags byte
+	body  []byte
+}
+
+// isCommand returns whether the frame is a command.
+func (f *frame) isCommand() bool {
+	return f.flags&flagCommand == flagCommand
+}
+
+// writeGreeting writes the greeting of a peer that isn't the server of the
+// NULL mechanism, which has no server.
+func writeGreeting(w io.Writer) error {
+	var greeting [greetingSize]byte
+	greeting[0] = 0xff
+	greeting[8] = 0x01
+	greeting[9] = 0x7f
+	greeting[10] = zmtpMajorVersion
+	greeting[11] = zmtpMinorVersion
+	copy(greeting[12:32], mechanismNull)
+	_, err := w.Write(greeting[:])
+	return err
+}
+
+// readGreeting reads the greeting of the peer and checks that it speaks ZMTP 3
+// or later with the NULL mechanism.
+func readGreeting(r io.Reader) error {
+	var greeting [greetingSize]byte
+	if _, err := io.ReadFull(r, greeting[:]); err != nil {
+		return err
+	}
+	if greeting[0] != 0xff || greeting[9]&0x01 != 0x01 {
+		return errMalformedGreeting
+	}
+	if greeting[10] < zmtpMajorVersion {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", greeting[10],
+			greeting[11])
+	}
+	mechanism := bytes.TrimRight(greeting[12:32], "\x00")
+	if !bytes.Equal(mechanism, mechanismNull) {
+		return fmt.Errorf("unsupported security mechanism %q", mechanism)
+	}
+	return nil
+}
+
+// writeFrame writes a frame with the given flags.  The long flag is set as
+// needed.
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var header [9]byte
+	n := 2
+	if len(body) > 0xff {
+		header[0] = flags | flagLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+		n = 9
+	} else {
+		header[0] = flags
+		header[1] = byte(len(body))
+	}
+	if _, err := w.Write(header[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// writeMessage writes the parts of a message as frames.
+func writeMessage(w io.Writer, parts [][]byte) error {
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = flagMore
+		}
+		if err := writeFrame(w, flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads a frame of at most maxSize bytes.
+func readFrame(r io.Reader, maxSize uint64) (*frame, error) {
+	var flags [1]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+
+	var size uint64
+	if flags[0]&flagLong == flagLong {
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(buf[:])
+	} else {
+		var buf [1]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		size = uint64(buf[0])
+	}
+	if size > maxSize {
+		return nil, fmt.Errorf("frame of %d bytes is larger than the "+
+			"max of %d", size, maxSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &frame{flags: flags[0], body: body}, nil
+}
+
+// writeReadyCommand writes the READY command with the given socket type.
+func writeReadyCommand(w io.Writer, socketType string) error {
+	var body bytes.Buffer
+	body.WriteByte(byte(len("READY")))
+	body.WriteString("READY")
+	body.WriteByte(byte(len("Socket-Type")))
+	body.WriteString("Socket-Type")
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(socketType)))
+	body.Write(size[:])
+	body.WriteString(socketType)
+	return writeFrame(w, flagCommand, body.Bytes())
+}
+
+// parseCommand returns the name of the command and its data.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || int(body[0]) > len(body)-1 {
+		return "", nil, errors.New("malformed command")
+	}
+	nameLen := int(body[0])
+	return string(body[1 : 1+nameLen]), body[1+nameLen:], nil
+}
+
+// parseProperties parses the properties of a READY command.  The names of the
+// properties are case insensitive so they're returned in lower case.
+func parseProperties(data []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	for len(data) > 0 {
+		nameLen := int(data[0])
+		if len(data) < 1+nameLen+4 {
+			return nil, errors.New("malformed property")
+		}
+		name := strings.ToLower(string(data[1 : 1+nameLen]))
+		data = data[1+nameLen:]
+
+		valueLen := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(len(data)) < uint64(valueLen) {
+			return nil, errors.New("malformed property")
+		}
+		properties[name] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+	return properties, nil
+}